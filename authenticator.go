@@ -23,6 +23,20 @@ type DeliveryMethod string
 // 2FA.
 type TFAOptions string
 
+// TFALevel describes the 2FA options a ClientApplication accepts
+// to complete authentication.
+type TFALevel string
+
+const (
+	// TFALevelOTP accepts any 2FA option. This is the default.
+	TFALevelOTP TFALevel = "otp"
+	// TFALevelTOTP accepts TOTP codes and Webauthn devices but not
+	// OTP codes delivered by email or SMS.
+	TFALevelTOTP TFALevel = "totp"
+	// TFALevelDevice only accepts Webauthn devices.
+	TFALevelDevice TFALevel = "device"
+)
+
 // MessageType describes a classification of a Message
 type MessageType string
 
@@ -46,6 +60,9 @@ const (
 	Phone DeliveryMethod = "phone"
 	// Email is a delivery method for email.
 	Email = "email"
+	// Matrix is a delivery method for messages to a Matrix ID,
+	// e.g. `@alice:example.com`, over Matrix federation.
+	Matrix = "matrix"
 )
 
 const (
@@ -66,6 +83,164 @@ const (
 	OTPLogin MessageType = "otp_login"
 	// OTPSignup is a message containing an OTP code for signup.
 	OTPSignup MessageType = "otp_signup"
+	// CanaryAlert is a message alerting operators of a login
+	// attempt against a canary account.
+	CanaryAlert MessageType = "canary_alert"
+	// LoginDigest is a message summarizing a User's recent
+	// sign-ins and new devices.
+	LoginDigest MessageType = "login_digest"
+	// OrganizationInvite is a message inviting a recipient
+	// to join an Organization.
+	OrganizationInvite MessageType = "organization_invite"
+	// LoginApproval is a message containing a link to approve
+	// a pending login.
+	LoginApproval MessageType = "login_approval"
+	// AccountRecovery is a message notifying a User that recovery
+	// of their account was requested.
+	AccountRecovery MessageType = "account_recovery"
+	// TrustedContactShare is a message delivering a share of a
+	// User's recovery code to a trusted contact.
+	TrustedContactShare MessageType = "trusted_contact_share"
+	// SecurityChange is a message notifying a User of a pending
+	// change to their 2FA settings or contact details.
+	SecurityChange MessageType = "security_change"
+	// TFAEnrollmentReminder is a message reminding a User to enroll
+	// a second factor before their enrollment deadline.
+	TFAEnrollmentReminder MessageType = "tfa_enrollment_reminder"
+	// OTPUnlock is a message containing an OTP code to unlock
+	// an account locked after repeated failed logins.
+	OTPUnlock MessageType = "otp_unlock"
+	// PasswordReset is a message containing a link to set a new
+	// password after an operator expired a User's password.
+	PasswordReset MessageType = "password_reset"
+	// BreachAlert is a message alerting a User that their credentials
+	// may be compromised and of the actions taken to protect them.
+	BreachAlert MessageType = "breach_alert"
+)
+
+// MessageCategory groups MessageTypes which are sent from the
+// same sender, e.g. OTP codes or security alerts.
+type MessageCategory string
+
+const (
+	// MessageCategoryOTP are messages containing a code or link
+	// to complete authentication.
+	MessageCategoryOTP MessageCategory = "otp"
+	// MessageCategorySecurity are messages alerting Users or
+	// operators of security sensitive activity.
+	MessageCategorySecurity MessageCategory = "security"
+	// MessageCategoryDigest are periodic summaries of activity.
+	MessageCategoryDigest MessageCategory = "digest"
+	// MessageCategoryInvite are invitations to the service.
+	MessageCategoryInvite MessageCategory = "invite"
+)
+
+// Category returns the MessageCategory of a MessageType.
+func (t MessageType) Category() MessageCategory {
+	switch t {
+	case CanaryAlert, AccountRecovery, TrustedContactShare, SecurityChange, TFAEnrollmentReminder,
+		PasswordReset, BreachAlert:
+		return MessageCategorySecurity
+	case LoginDigest:
+		return MessageCategoryDigest
+	case OrganizationInvite:
+		return MessageCategoryInvite
+	default:
+		return MessageCategoryOTP
+	}
+}
+
+// MessagePriority determines the order Messages are delivered in.
+// Each priority is delivered by its own workers so time critical
+// Messages are not delayed behind bulk notifications.
+type MessagePriority string
+
+const (
+	// PriorityHigh is for time critical Messages such as OTP codes.
+	PriorityHigh MessagePriority = "high"
+	// PriorityNormal is for Messages such as security alerts.
+	PriorityNormal MessagePriority = "normal"
+	// PriorityLow is for bulk notifications such as digests.
+	PriorityLow MessagePriority = "low"
+)
+
+// Priority returns the default MessagePriority of a MessageType.
+func (t MessageType) Priority() MessagePriority {
+	switch t.Category() {
+	case MessageCategoryOTP:
+		return PriorityHigh
+	case MessageCategoryDigest, MessageCategoryInvite:
+		return PriorityLow
+	default:
+		return PriorityNormal
+	}
+}
+
+// MemberRole describes the permissions of a User within
+// an Organization.
+type MemberRole string
+
+const (
+	// RoleOwner may manage an Organization and its members.
+	RoleOwner MemberRole = "owner"
+	// RoleAdmin may invite and remove members.
+	RoleAdmin MemberRole = "admin"
+	// RoleMember has no management permissions.
+	RoleMember MemberRole = "member"
+)
+
+// ActionPurpose describes the single action an ActionToken
+// may be redeemed for.
+type ActionPurpose string
+
+const (
+	// PurposeResetPassword authorizes a password reset.
+	PurposeResetPassword ActionPurpose = "reset_password"
+	// PurposeAcceptInvite accepts an Organization invitation.
+	PurposeAcceptInvite ActionPurpose = "accept_invite"
+	// PurposeApproveLogin approves a pending login from
+	// another device.
+	PurposeApproveLogin ActionPurpose = "approve_login"
+	// PurposeRecoverAccount verifies a signing device to
+	// recover an account.
+	PurposeRecoverAccount ActionPurpose = "recover_account"
+	// PurposeCancelRecovery cancels a pending account recovery.
+	PurposeCancelRecovery ActionPurpose = "cancel_recovery"
+	// PurposeCancelChange cancels a pending security change.
+	PurposeCancelChange ActionPurpose = "cancel_change"
+	// PurposeVerifyContact confirms a trusted contact received
+	// their share of a recovery code.
+	PurposeVerifyContact ActionPurpose = "verify_trusted_contact"
+)
+
+// Feature is a feature of the service which may be toggled
+// by operators at runtime.
+type Feature string
+
+const (
+	// FeatureSignUp allows new Users to register.
+	FeatureSignUp Feature = "signup"
+	// FeatureCaptcha requires flagged sources to solve a CAPTCHA.
+	FeatureCaptcha Feature = "captcha"
+	// FeatureOrganizations allows Users to create and join Organizations.
+	FeatureOrganizations Feature = "organizations"
+	// FeatureLoginDigest allows Users to receive login digests.
+	FeatureLoginDigest Feature = "login_digest"
+	// FeatureMaintenance rejects requests which modify state while
+	// operators perform maintenance. It is disabled by default.
+	FeatureMaintenance Feature = "maintenance"
+)
+
+// NetworkClass is a class of anonymizing network.
+type NetworkClass string
+
+const (
+	// NetworkTor is a Tor exit node.
+	NetworkTor NetworkClass = "tor"
+	// NetworkVPN is a commercial VPN endpoint.
+	NetworkVPN NetworkClass = "vpn"
+	// NetworkProxy is an open or anonymizing proxy.
+	NetworkProxy NetworkClass = "proxy"
 )
 
 // User represents a user who is registered with the service.
@@ -96,8 +271,11 @@ type User struct {
 	// an email or phone number by validating a one time code
 	// after registration.
 	IsVerified bool
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	// IsPasswordExpired specifies a user must reset their password
+	// before they may login with a password again.
+	IsPasswordExpired bool
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
 }
 
 // DefaultTFA is the recommended enabled TFA option clients should
@@ -120,7 +298,7 @@ func (u *User) DefaultTFA() TFAOptions {
 
 // DefaultOTPDelivery returns the default OTP delivery method.
 func (u *User) DefaultOTPDelivery() DeliveryMethod {
-	if u.Email.String != "" {
+	if u.Email.String != "" && u.IsEmailOTPAllowed {
 		return Email
 	}
 
@@ -171,8 +349,22 @@ type Device struct {
 	// than or equal to the device value, it is indicative that the
 	// device may be cloned or malfunctioning.
 	SignCount uint32
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	// BackupEligible is set for credentials which may be synced
+	// across devices, such as Apple and Google passkeys, as
+	// opposed to hardware bound keys.
+	BackupEligible bool
+	// BackedUp is set while a backup eligible credential is
+	// synced. It is refreshed on each authentication.
+	BackedUp bool
+	// Model is the human readable authenticator model published
+	// by the FIDO Metadata Service for the device AAGUID.
+	Model string
+	// MetadataStatus is the latest FIDO Metadata Service status
+	// of the authenticator model at registration, e.g.
+	// FIDO_CERTIFIED_L1 or REVOKED.
+	MetadataStatus string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
 }
 
 // LoginHistory represents a login associated with a user.
@@ -187,10 +379,316 @@ type LoginHistory struct {
 	IsRevoked bool
 	// ExpiresAt is the expiry time of the JWT token.
 	ExpiresAt time.Time
+	// IPAddress is the client address the login was made from.
+	IPAddress string
+	// Country and City are the location of the IPAddress at the
+	// time of login, if a GeoResolver is configured.
+	Country   string
+	City      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// LoginStatus describes the state of a LoginHistory's session.
+type LoginStatus string
+
+const (
+	// LoginActive is a session that is neither revoked nor expired.
+	LoginActive LoginStatus = "active"
+	// LoginRevoked is a session that has been revoked.
+	LoginRevoked LoginStatus = "revoked"
+)
+
+// LoginHistoryFilter narrows the LoginHistory retrieved for a User.
+type LoginHistoryFilter struct {
+	// Cursor is the TokenID of the last LoginHistory of the previous
+	// page. Records are ordered from newest to oldest by TokenID.
+	Cursor string
+	// Limit is the maximum number of records to retrieve.
+	Limit int
+	// From and To restrict records to those created within a time
+	// range. Zero values leave the range unbounded.
+	From time.Time
+	To   time.Time
+	// Status restricts records to sessions of a LoginStatus. An
+	// empty status matches every session.
+	Status LoginStatus
+}
+
+// LoginDigestSubscription represents a User's opt-in to receive
+// periodic digests of recent sign-ins and new devices.
+type LoginDigestSubscription struct {
+	// UserID is the ID of the subscribed User.
+	UserID string
+	// LastSentAt is the time the last digest was sent. Digests
+	// cover activity since this time.
+	LastSentAt time.Time
+	CreatedAt  time.Time
+}
+
+// TFAEnrollment tracks the deadline for a User to enroll a second
+// factor while 2FA enrollment is mandatory.
+type TFAEnrollment struct {
+	// UserID is the ID of the User who has yet to enroll.
+	UserID string
+	// Deadline is the time after which the User's tokens are
+	// restricted to 2FA and contact setup.
+	Deadline time.Time
+	// LastRemindedAt is the time the User was last reminded
+	// to enroll. It is zero if no reminder was sent.
+	LastRemindedAt time.Time
+	CreatedAt      time.Time
+}
+
+// TrustedRecovery is a User's designation of trusted contacts who may
+// together restore access to the User's account. Each contact receives a
+// share of a recovery code of which Threshold shares restore access.
+type TrustedRecovery struct {
+	// UserID is the ID of the User the recovery restores.
+	UserID string
+	// Contacts are the email addresses and phone numbers
+	// shares were delivered to.
+	Contacts []string
+	// Verified are the Contacts who confirmed receipt of
+	// their share.
+	Verified []string
+	// Threshold is the number of shares required to
+	// reconstruct the recovery code.
+	Threshold int
+	// CodeHash is a hash of the recovery code. The code
+	// itself is never stored.
+	CodeHash  string
+	CreatedAt time.Time
+}
+
+// Organization is a group of Users, typically representing
+// a business customer of a consuming application.
+type Organization struct {
+	// ID is a unique ID for the Organization.
+	ID string
+	// Name is a human readable name of the Organization.
+	Name      string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
+// Membership represents a User's membership in an Organization.
+type Membership struct {
+	// OrganizationID is the ID of the Organization.
+	OrganizationID string
+	// UserID is the ID of the member.
+	UserID string
+	// Role describes the member's permissions.
+	Role      MemberRole
+	CreatedAt time.Time
+}
+
+// CanManageMembers returns true if the member may invite and
+// remove other members.
+func (m *Membership) CanManageMembers() bool {
+	return m.Role == RoleOwner || m.Role == RoleAdmin
+}
+
+// Invitation is a pending invitation for an email address
+// to join an Organization.
+type Invitation struct {
+	// ID is a unique ID for the Invitation.
+	ID string
+	// OrganizationID is the ID of the Organization.
+	OrganizationID string
+	// Email is the address the Invitation was sent to.
+	Email string
+	// Role is the role granted on acceptance.
+	Role MemberRole
+	// CodeHash is the hash of a randomly generated code delivered
+	// to the invited email address.
+	CodeHash string
+	// InvitedBy is the ID of the User who created the Invitation.
+	InvitedBy string
+	// ExpiresAt is the time the Invitation may no longer be accepted.
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// Consent records a User's acceptance of a version of a
+// policy document such as the terms of service.
+type Consent struct {
+	// UserID is the ID of the User who accepted the policy.
+	UserID string
+	// Policy is the name of the policy document (e.g. tos, privacy).
+	Policy string
+	// Version is the version of the policy document accepted.
+	Version string
+	// IPAddress is the client address the acceptance was recorded from.
+	IPAddress string
+	// AcceptedAt is the time the policy was accepted.
+	AcceptedAt time.Time
+}
+
+// Canary is a decoy account identity. Canaries do not belong to
+// real users and any attempt to login with one indicates a leaked
+// credential list is being tested against the service.
+type Canary struct {
+	// Identity is the email or phone number of the decoy account.
+	Identity string
+	// Note describes where the canary was planted.
+	Note      string
+	CreatedAt time.Time
+}
+
+// ClientApplication is a frontend registered with the service.
+// Clients identify themselves through a request header to receive
+// policies distinct from other frontends of the same deployment.
+type ClientApplication struct {
+	// ID uniquely identifies the ClientApplication.
+	ID string
+	// Name is a human readable name for the ClientApplication.
+	Name string
+	// AllowedOrigins are the origins the ClientApplication may be
+	// used from. Any origin allowed by the service is accepted if empty.
+	AllowedOrigins []string
+	// TokenExpiry overrides how long JWT tokens are valid for.
+	TokenExpiry time.Duration
+	// RefreshTokenExpiry overrides how long refresh tokens are valid for.
+	RefreshTokenExpiry time.Duration
+	// RequiredTFA is the 2FA level required to authenticate.
+	RequiredTFA TFALevel
+	// LogoutURL receives back-channel logout notifications when
+	// Users log out of the ClientApplication.
+	LogoutURL string
+	// Audiences are the audiences the ClientApplication may request
+	// for its tokens. No audience may be requested if empty.
+	Audiences []string
+	// Scopes are the scopes the ClientApplication may request for
+	// its tokens. No scope may be requested if empty.
+	Scopes    []string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// LogoutNotice notifies a ClientApplication that a User logged out.
+type LogoutNotice struct {
+	UserID string `json:"userID"`
+	// TokenID is the ID of the token which was logged out. It is
+	// empty if the User logged out of every session.
+	TokenID  string `json:"tokenID,omitempty"`
+	IssuedAt int64  `json:"issuedAt"`
+}
+
+// IsOriginAllowed checks if the ClientApplication may be used
+// from an origin.
+func (c *ClientApplication) IsOriginAllowed(origin string) bool {
+	if len(c.AllowedOrigins) == 0 {
+		return true
+	}
+
+	for _, o := range c.AllowedOrigins {
+		if o == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsAudience checks if the ClientApplication may request
+// tokens for an audience.
+func (c *ClientApplication) AllowsAudience(audience string) bool {
+	for _, aud := range c.Audiences {
+		if aud == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsScope checks if the ClientApplication may request tokens
+// granted a scope.
+func (c *ClientApplication) AllowsScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsTFA checks if a 2FA option satisfies the ClientApplication's
+// required 2FA level.
+func (c *ClientApplication) AllowsTFA(option TFAOptions) bool {
+	switch c.RequiredTFA {
+	case TFALevelDevice:
+		return option == FIDODevice
+	case TFALevelTOTP:
+		return option == FIDODevice || option == TOTP
+	default:
+		return true
+	}
+}
+
+// CanAuthenticate checks if a User has enabled a 2FA option
+// satisfying the ClientApplication's required 2FA level.
+func (c *ClientApplication) CanAuthenticate(u *User) bool {
+	switch c.RequiredTFA {
+	case TFALevelDevice:
+		return u.IsDeviceAllowed
+	case TFALevelTOTP:
+		return u.IsDeviceAllowed || u.IsTOTPAllowed
+	default:
+		return true
+	}
+}
+
+// U2FRegistration is a legacy FIDO U2F key registered with
+// another system.
+type U2FRegistration struct {
+	// KeyHandle is the credential ID issued by the key.
+	KeyHandle []byte
+	// PublicKey is the uncompressed P-256 public key of the
+	// credential.
+	PublicKey []byte
+	// Counter is the last known signature counter of the key.
+	Counter uint32
+	// Name is a human readable name for the key.
+	Name string
+}
+
+// AuthenticatorMetadata describes an authenticator model published
+// by the FIDO Metadata Service.
+type AuthenticatorMetadata struct {
+	// Description is the human readable name of the model.
+	Description string
+	// Status is the latest status reported for the model, e.g.
+	// FIDO_CERTIFIED_L1 or REVOKED.
+	Status string
+	// Compromised is set if the model should no longer be trusted,
+	// such as after a revocation or a known key compromise.
+	Compromised bool
+}
+
+// ExternalUser is a user whose credentials are managed by an
+// external user database.
+type ExternalUser struct {
+	// ID uniquely identifies the user in the external database.
+	ID string
+	// Email is the user's email address, if any.
+	Email string
+	// Phone is the user's phone number, if any.
+	Phone string
+}
+
+// ExternalAccount links an ExternalUser to the local User record
+// which manages their 2FA settings, devices and tokens.
+type ExternalAccount struct {
+	// ExternalID is the ID of the user in the external database.
+	ExternalID string
+	// UserID is the ID of the linked User.
+	UserID    string
+	CreatedAt time.Time
+}
+
 // Token is a token that provides proof of User authentication.
 type Token struct {
 	// jwt.StandardClaims provides standard JWT fields
@@ -236,6 +734,131 @@ type Token struct {
 	TFAOptions []TFAOptions `json:"tfa_options"`
 	// DefaultTFA is the develop TFA method clients should offer a user.
 	DefaultTFA TFAOptions `json:"default_tfa"`
+	// Organizations are the Organizations the User is a member
+	// of. They are only set on authorized tokens.
+	Organizations []OrganizationClaim `json:"orgs,omitempty"`
+	// ConsentRequired is set on authorized tokens when the User has
+	// yet to accept the latest version of a required policy. Tokens
+	// requiring consent are limited to recording consent.
+	ConsentRequired bool `json:"consent_required,omitempty"`
+	// EnrollmentRequired is set on authorized tokens when 2FA
+	// enrollment is mandatory and the User has yet to enable a TOTP
+	// app or WebAuthn device. Tokens requiring enrollment are limited
+	// to 2FA and contact setup.
+	EnrollmentRequired bool `json:"enrollment_required,omitempty"`
+	// EnrollmentDeadline is the unix time after which tokens of a
+	// User who has yet to enroll a second factor require enrollment.
+	// It is set on authorized tokens during the grace period.
+	EnrollmentDeadline int64 `json:"enrollment_deadline,omitempty"`
+	// Generation is the User's token generation at the time the token
+	// was issued. Tokens from an earlier generation are considered
+	// revoked.
+	Generation int64 `json:"generation,omitempty"`
+	// Audiences are the APIs the token is intended for. APIs
+	// expecting an audience reject tokens without one unless
+	// configured otherwise.
+	Audiences []string `json:"aud,omitempty"`
+	// Scopes are the permissions granted to the token.
+	Scopes []string `json:"scopes,omitempty"`
+	// ClientApplicationID is the ID of the ClientApplication the
+	// token was issued to, if any.
+	ClientApplicationID string `json:"azp,omitempty"`
+	// Fingerprint is the fingerprint of the client the token was
+	// issued to, if tokens are bound to clients.
+	Fingerprint string `json:"fph,omitempty"`
+	// AuthMethods are the factors the User completed to obtain
+	// the token, e.g. password and device.
+	AuthMethods []string `json:"amr,omitempty"`
+	// TTL is the lifetime in seconds requested for the token and its
+	// refresh token when shorter than the defaults, e.g. for kiosk
+	// logins. It is carried over to tokens refreshed from it.
+	TTL int64 `json:"ttl,omitempty"`
+	// Custom holds claims added by Hooks before the token is issued.
+	Custom map[string]interface{} `json:"ext,omitempty"`
+}
+
+// HasAudience reports whether a Token is intended for an audience.
+func (t *Token) HasAudience(audience string) bool {
+	for _, aud := range t.Audiences {
+		if aud == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasScopes reports whether a Token has been granted every scope.
+func (t *Token) HasScopes(scopes ...string) bool {
+	granted := make(map[string]bool, len(t.Scopes))
+	for _, scope := range t.Scopes {
+		granted[scope] = true
+	}
+
+	for _, scope := range scopes {
+		if !granted[scope] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ActionToken is a short lived, single use token authorizing one
+// action. Unlike Token it does not authenticate a session and is
+// signed with a separate key so the two may not be substituted.
+type ActionToken struct {
+	// jwt.StandardClaims provides standard JWT fields
+	// such as ExpiresAt, Id, Issuer.
+	jwt.StandardClaims
+	// UserID is the ID of the User the action is performed
+	// for. It is empty for actions on behalf of unregistered
+	// recipients (e.g. invitations).
+	UserID string `json:"user_id,omitempty"`
+	// Purpose is the action the token may be redeemed for.
+	Purpose ActionPurpose `json:"purpose"`
+	// Data contains values the action is bound to, such as
+	// an email address or invitation ID.
+	Data map[string]string `json:"data,omitempty"`
+}
+
+// SecurityChangeType describes a security change which may be delayed.
+type SecurityChangeType string
+
+const (
+	// ChangeEmail replaces a User's verified email address.
+	ChangeEmail SecurityChangeType = "change_email"
+	// ChangeDisableOTP disables a User's last OTP delivery method.
+	ChangeDisableOTP SecurityChangeType = "disable_otp"
+	// ChangeRemoveAddress removes a User's last OTP delivery address.
+	ChangeRemoveAddress SecurityChangeType = "remove_address"
+	// ChangeRemoveDevice removes a User's last WebAuthn Device.
+	ChangeRemoveDevice SecurityChangeType = "remove_device"
+	// ChangeDisableTOTP disables TOTP for a User.
+	ChangeDisableTOTP SecurityChangeType = "disable_totp"
+)
+
+// PendingChange is a sensitive change to a User's account which
+// takes effect once its delay has passed, unless cancelled.
+type PendingChange struct {
+	ID   string             `json:"id"`
+	Type SecurityChangeType `json:"type"`
+	// DeliveryMethod is the delivery method affected by the change.
+	// The User is notified through it of the change.
+	DeliveryMethod DeliveryMethod `json:"deliveryMethod"`
+	// Address is the email address set by a ChangeEmail.
+	Address      string `json:"address,omitempty"`
+	IsOTPEnabled bool   `json:"isOTPEnabled,omitempty"`
+	// DeviceID is the ID of the Device removed by a ChangeRemoveDevice.
+	DeviceID    string    `json:"deviceID,omitempty"`
+	AvailableAt time.Time `json:"availableAt"`
+}
+
+// OrganizationClaim describes a User's membership in an
+// Organization within a Token.
+type OrganizationClaim struct {
+	ID   string     `json:"id"`
+	Role MemberRole `json:"role"`
 }
 
 // Message is a message to be delivered to a user.
@@ -253,22 +876,147 @@ type Message struct {
 	Content string
 	// Delivery address of the user (e.g. phone or email).
 	Address string
+	// NotBefore is the earliest time we can attempt delivery.
+	// Messages are delivered immediately if it is not set.
+	NotBefore time.Time
 	// ExpiresAt is the latest time we can attempt delivery.
 	ExpiresAt time.Time
 	// DeliveryAttempts is the total amount of delivery attempts made.
 	DeliveryAttempts int
+	// Tenant is the ID of the ClientApplication a Message is sent
+	// on behalf of, if any.
+	Tenant string
+	// Sender overrides the provider's default sender.
+	Sender MessageSender
+	// Locale is the language the Message is rendered in. It is
+	// empty for the default language.
+	Locale string
+	// Priority determines the order the Message is delivered in.
+	// Messages without a priority are delivered as PriorityNormal.
+	Priority MessagePriority
+}
+
+// MessageSender identifies who a Message is sent from. Empty fields
+// fall back to the provider's configured defaults.
+type MessageSender struct {
+	// FromAddr is the origin email address.
+	FromAddr string
+	// FromName is the origin name for email.
+	FromName string
+	// SMSSender is the origin phone number or alphanumeric
+	// sender ID for SMS.
+	SMSSender string
+}
+
+// MessageDeliveryStatus is the status of a MessageDelivery.
+type MessageDeliveryStatus string
+
+const (
+	// MessageQueued is a MessageDelivery about to be handed to a provider.
+	MessageQueued MessageDeliveryStatus = "queued"
+	// MessageSent is a MessageDelivery accepted by a provider.
+	MessageSent MessageDeliveryStatus = "sent"
+	// MessageDelivered is a MessageDelivery the provider reports
+	// as delivered to the recipient.
+	MessageDelivered MessageDeliveryStatus = "delivered"
+	// MessageBounced is a MessageDelivery rejected by the
+	// recipient's mail server.
+	MessageBounced MessageDeliveryStatus = "bounced"
+	// MessageFailed is a MessageDelivery which failed to reach a
+	// provider or which the provider could not deliver.
+	MessageFailed MessageDeliveryStatus = "failed"
+)
+
+// Preceding returns the statuses a MessageDelivery may transition to
+// a status from. Provider reports may arrive out of order and must not
+// revert a later status. Delivered, bounced and failed are final.
+func (s MessageDeliveryStatus) Preceding() []MessageDeliveryStatus {
+	switch s {
+	case MessageSent:
+		return []MessageDeliveryStatus{MessageQueued}
+	case MessageDelivered, MessageBounced, MessageFailed:
+		return []MessageDeliveryStatus{MessageQueued, MessageSent}
+	default:
+		return nil
+	}
+}
+
+// MessageDelivery is an attempt to deliver a Message through a
+// provider. Its status is updated as the provider reports progress.
+type MessageDelivery struct {
+	ID       string
+	Type     MessageType
+	Delivery DeliveryMethod
+	Address  string
+	Status   MessageDeliveryStatus
+	// Detail describes a failure reported by us or the provider.
+	Detail    string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DeliveryOutcome is the result of an attempt to deliver a Message.
+type DeliveryOutcome string
+
+const (
+	// DeliverySent is an attempt accepted by a provider.
+	DeliverySent DeliveryOutcome = "sent"
+	// DeliveryFailed is an attempt rejected by a provider or which
+	// failed to reach it. Failed Messages are retried until expiry.
+	DeliveryFailed DeliveryOutcome = "failed"
+	// DeliveryExpired is a Message dropped after it expired.
+	DeliveryExpired DeliveryOutcome = "expired"
+)
+
+// DeliveryStats is the number of Message delivery attempts through
+// a DeliveryMethod on a day by outcome.
+type DeliveryStats struct {
+	Date     time.Time
+	Delivery DeliveryMethod
+	Outcomes map[DeliveryOutcome]int64
+}
+
+// DailyCount is the number of events on a day.
+type DailyCount struct {
+	Date  time.Time
+	Count int64
+}
+
+// TFAAdoption is the number of verified Users with each 2FA
+// method enabled.
+type TFAAdoption struct {
+	Users  int64
+	Email  int64
+	Phone  int64
+	TOTP   int64
+	Device int64
 }
 
 // MessageRepository represents a local storage for outgoing messages.
 // This service will deliver OTP codes via email or SMS if enabled for the user.
 type MessageRepository interface {
 	// Publish prepares a message for a user. Behind the scenes we write the
-	// message into a channel to be processed by a consumer.
+	// message into a channel to be processed by a consumer. Messages are
+	// stored until their NotBefore time.
 	Publish(ctx context.Context, msg *Message) error
 	// Recent retrieves a list of messages to be delivered.
 	Recent(ctx context.Context) (<-chan *Message, <-chan error)
 }
 
+// MessageDeliveryRepository represents a local storage for MessageDelivery.
+type MessageDeliveryRepository interface {
+	// ByID retrieves a MessageDelivery by its ID.
+	ByID(ctx context.Context, id string) (*MessageDelivery, error)
+	// ByAddress retrieves the most recent MessageDeliveries to an address.
+	ByAddress(ctx context.Context, address string, limit int) ([]*MessageDelivery, error)
+	// Create creates a new MessageDelivery.
+	Create(ctx context.Context, d *MessageDelivery) error
+	// UpdateStatus updates the status of a MessageDelivery if its
+	// current status precedes it. Updates which would revert a later
+	// status are ignored.
+	UpdateStatus(ctx context.Context, id string, status MessageDeliveryStatus, detail string) error
+}
+
 // LoginHistoryRepository represents a local storage for LoginHistory.
 type LoginHistoryRepository interface {
 	// ByTokenID retrieves a LoginHistory record by a JWT token ID.
@@ -276,12 +1024,21 @@ type LoginHistoryRepository interface {
 	// ByUserID retrieves recent LoginHistory associated with a User's ID.
 	// It supports pagination through a limit or offset value.
 	ByUserID(ctx context.Context, userID string, limit, offset int) ([]*LoginHistory, error)
+	// List retrieves a page of LoginHistory associated with a User's ID
+	// matching a filter.
+	List(ctx context.Context, userID string, filter *LoginHistoryFilter) ([]*LoginHistory, error)
 	// Create creates a new LoginHistory.
 	Create(ctx context.Context, login *LoginHistory) error
 	// GetForUpdate retrieves a LoginHistory by TokenID for updating.
 	GetForUpdate(ctx context.Context, tokenID string) (*LoginHistory, error)
 	// Update updates a LoginHistory.
 	Update(ctx context.Context, login *LoginHistory) error
+	// CountActive returns the number of LoginHistory records
+	// which are neither revoked nor expired.
+	CountActive(ctx context.Context) (int64, error)
+	// CountActiveByUserID returns the number of a User's LoginHistory
+	// records which are neither revoked nor expired.
+	CountActiveByUserID(ctx context.Context, userID string) (int64, error)
 }
 
 // DeviceRepository represents a local storage for Device.
@@ -297,6 +1054,9 @@ type DeviceRepository interface {
 	Create(ctx context.Context, device *Device) error
 	// GetForUpdate retrieves a Device by ID for updating.
 	GetForUpdate(ctx context.Context, deviceID string) (*Device, error)
+	// GetForUpdateByClientID retrieves a Device associated with a
+	// User by a ClientID for updating.
+	GetForUpdateByClientID(ctx context.Context, userID string, clientID []byte) (*Device, error)
 	// Update updates a Device.
 	Update(ctx context.Context, device *Device) error
 	// Removes a Devie associated with a User.
@@ -310,6 +1070,9 @@ type UserRepository interface {
 	ByIdentity(ctx context.Context, attribute, value string) (*User, error)
 	// GetForUpdate retrieves a User by ID for updating.
 	GetForUpdate(ctx context.Context, userID string) (*User, error)
+	// List retrieves Users ordered by ID, starting after a given
+	// ID. An empty ID starts from the first User.
+	List(ctx context.Context, afterID string, limit int) ([]*User, error)
 	// Create creates a new User Record.
 	Create(ctx context.Context, u *User) error
 	// ReCreate updates an existing, unverified User record,
@@ -323,6 +1086,128 @@ type UserRepository interface {
 	DisableOTP(ctx context.Context, userID string, method DeliveryMethod) (*User, error)
 	// RemoveDeliveryMethod removes a phone or email from a User.
 	RemoveDeliveryMethod(ctx context.Context, userID string, method DeliveryMethod) (*User, error)
+	// CountSignups returns the number of verified Users created
+	// on each day since a given time.
+	CountSignups(ctx context.Context, since time.Time) ([]*DailyCount, error)
+	// CountTFA returns the number of verified Users with each
+	// 2FA method enabled.
+	CountTFA(ctx context.Context) (*TFAAdoption, error)
+}
+
+// CanaryRepository represents a local storage for Canary.
+type CanaryRepository interface {
+	// ByIdentity retrieves a Canary by its identity.
+	ByIdentity(ctx context.Context, identity string) (*Canary, error)
+	// List retrieves all Canaries.
+	List(ctx context.Context) ([]*Canary, error)
+	// Create creates a new Canary.
+	Create(ctx context.Context, c *Canary) error
+	// Remove removes a Canary by its identity.
+	Remove(ctx context.Context, identity string) error
+}
+
+// ClientApplicationRepository represents a local storage for
+// ClientApplication.
+type ClientApplicationRepository interface {
+	// ByID retrieves a ClientApplication by its ID.
+	ByID(ctx context.Context, clientID string) (*ClientApplication, error)
+	// List retrieves all ClientApplications.
+	List(ctx context.Context) ([]*ClientApplication, error)
+	// Create creates a new ClientApplication.
+	Create(ctx context.Context, c *ClientApplication) error
+	// Remove removes a ClientApplication by its ID.
+	Remove(ctx context.Context, clientID string) error
+}
+
+// LoginDigestRepository represents a local storage for
+// LoginDigestSubscription.
+type LoginDigestRepository interface {
+	// ByUserID retrieves a LoginDigestSubscription for a User.
+	ByUserID(ctx context.Context, userID string) (*LoginDigestSubscription, error)
+	// Due retrieves subscriptions last sent before a given time.
+	Due(ctx context.Context, before time.Time, limit int) ([]*LoginDigestSubscription, error)
+	// Create creates a new LoginDigestSubscription.
+	Create(ctx context.Context, sub *LoginDigestSubscription) error
+	// MarkSent updates the time a digest was last sent to a User.
+	MarkSent(ctx context.Context, userID string, sentAt time.Time) error
+	// Remove removes a User's LoginDigestSubscription.
+	Remove(ctx context.Context, userID string) error
+}
+
+// TFAEnrollmentRepository represents a local storage for
+// TFAEnrollment.
+type TFAEnrollmentRepository interface {
+	// ByUserID retrieves a User's TFAEnrollment.
+	ByUserID(ctx context.Context, userID string) (*TFAEnrollment, error)
+	// Create persists a TFAEnrollment. A User's existing deadline
+	// is retained and set on the TFAEnrollment.
+	Create(ctx context.Context, enrollment *TFAEnrollment) error
+	// Due retrieves enrollments whose deadline has yet to pass at a
+	// given time and which were last reminded before another.
+	Due(ctx context.Context, now, remindedBefore time.Time, limit int) ([]*TFAEnrollment, error)
+	// MarkReminded updates the time a User was last reminded.
+	MarkReminded(ctx context.Context, userID string, remindedAt time.Time) error
+}
+
+// TrustedRecoveryRepository represents a local storage for
+// TrustedRecovery.
+type TrustedRecoveryRepository interface {
+	// ByUserID retrieves a User's TrustedRecovery.
+	ByUserID(ctx context.Context, userID string) (*TrustedRecovery, error)
+	// Create persists a TrustedRecovery, replacing a User's
+	// existing TrustedRecovery.
+	Create(ctx context.Context, recovery *TrustedRecovery) error
+	// Verify marks a contact of a User's TrustedRecovery
+	// as verified.
+	Verify(ctx context.Context, userID, contact string) error
+	// Remove removes a User's TrustedRecovery.
+	Remove(ctx context.Context, userID string) error
+}
+
+// OrganizationRepository represents a local storage for Organization.
+type OrganizationRepository interface {
+	// ByID retrieves an Organization by its ID.
+	ByID(ctx context.Context, orgID string) (*Organization, error)
+	// Create creates a new Organization.
+	Create(ctx context.Context, org *Organization) error
+}
+
+// MembershipRepository represents a local storage for Membership
+// and Invitation.
+type MembershipRepository interface {
+	// Get retrieves a User's Membership in an Organization.
+	Get(ctx context.Context, orgID, userID string) (*Membership, error)
+	// ByUserID retrieves all Memberships of a User.
+	ByUserID(ctx context.Context, userID string) ([]*Membership, error)
+	// ByOrganizationID retrieves all Memberships of an Organization.
+	ByOrganizationID(ctx context.Context, orgID string) ([]*Membership, error)
+	// Create creates a new Membership.
+	Create(ctx context.Context, m *Membership) error
+	// Remove removes a User from an Organization.
+	Remove(ctx context.Context, orgID, userID string) error
+	// CreateInvitation creates a new Invitation.
+	CreateInvitation(ctx context.Context, inv *Invitation) error
+	// InvitationByID retrieves an Invitation by its ID.
+	InvitationByID(ctx context.Context, invitationID string) (*Invitation, error)
+	// RemoveInvitation removes an Invitation.
+	RemoveInvitation(ctx context.Context, invitationID string) error
+}
+
+// ConsentRepository represents a local storage for Consent.
+type ConsentRepository interface {
+	// ByUserID retrieves all Consent recorded for a User.
+	ByUserID(ctx context.Context, userID string) ([]*Consent, error)
+	// Create records a new Consent. Recording a previously
+	// accepted version retains the original acceptance.
+	Create(ctx context.Context, consent *Consent) error
+}
+
+// ExternalAccountRepository represents a local storage for ExternalAccounts.
+type ExternalAccountRepository interface {
+	// ByExternalID retrieves an ExternalAccount by the external user's ID.
+	ByExternalID(ctx context.Context, externalID string) (*ExternalAccount, error)
+	// Create links an external user to a User.
+	Create(ctx context.Context, account *ExternalAccount) error
 }
 
 // RepositoryManager manages repositories stored in storages
@@ -340,18 +1225,57 @@ type RepositoryManager interface {
 	Device() DeviceRepository
 	// User returns a UserRepository.
 	User() UserRepository
+	// Canary returns a CanaryRepository.
+	Canary() CanaryRepository
+	// LoginDigest returns a LoginDigestRepository.
+	LoginDigest() LoginDigestRepository
+	// Organization returns an OrganizationRepository.
+	Organization() OrganizationRepository
+	// Membership returns a MembershipRepository.
+	Membership() MembershipRepository
+	// Consent returns a ConsentRepository.
+	Consent() ConsentRepository
+	// ExternalAccount returns an ExternalAccountRepository.
+	ExternalAccount() ExternalAccountRepository
+	// ClientApplication returns a ClientApplicationRepository.
+	ClientApplication() ClientApplicationRepository
+	// TrustedRecovery returns a TrustedRecoveryRepository.
+	TrustedRecovery() TrustedRecoveryRepository
+	// MessageDelivery returns a MessageDeliveryRepository.
+	MessageDelivery() MessageDeliveryRepository
+	// TFAEnrollment returns a TFAEnrollmentRepository.
+	TFAEnrollment() TFAEnrollmentRepository
 }
 
 // TokenConfiguration provides configurable settings for a JWT token.
 type TokenConfiguration struct {
-	DeliveryMethod   DeliveryMethod
-	DeliveryAddress  string
-	RefreshableToken *Token
+	DeliveryMethod      DeliveryMethod
+	DeliveryAddress     string
+	RefreshableToken    *Token
+	RotatedRefreshToken string
+	Audiences           []string
+	Scopes              []string
+	DeviceID            string
+	AuthMethods         []string
+	TFAOptions          []TFAOptions
+	TTL                 time.Duration
 }
 
 // TokenOption configures a new JWT token.
 type TokenOption func(*TokenConfiguration)
 
+// ValidateConfiguration provides additional requirements a
+// JWT token must meet to be considered valid.
+type ValidateConfiguration struct {
+	Audience          string
+	AllowAudienceless bool
+	Scopes            []string
+	DeviceID          string
+}
+
+// ValidateOption configures JWT token validation.
+type ValidateOption func(*ValidateConfiguration)
+
 // TokenService represents a service to manage JWT tokens.
 type TokenService interface {
 	// Create creates a new JWT token with optional configuration settings.
@@ -360,18 +1284,71 @@ type TokenService interface {
 	Sign(ctx context.Context, token *Token) (string, error)
 	// Validate checks that a JWT token is signed by us, unexpired,
 	// unrevoked, and from the a valid client. On success it will return the unpacked
-	// Token struct.
-	Validate(ctx context.Context, signedToken string, clientID string) (*Token, error)
+	// Token struct. Options may further restrict the tokens accepted.
+	Validate(ctx context.Context, signedToken string, clientID string, options ...ValidateOption) (*Token, error)
 	// Revoke Revokes a token by it's ID.
 	Revoke(ctx context.Context, tokenID string) error
+	// RevokeAll revokes every outstanding token for a User.
+	RevokeAll(ctx context.Context, userID string) error
 	// Cookies returns secure cookies to accompany a token.
 	Cookies(ctx context.Context, token *Token) []*http.Cookie
-	// Refreshable checks if a provided token can be refreshed.
-	Refreshable(ctx context.Context, token *Token, refreshToken string) error
+	// CookieNames returns the names of the client ID and refresh
+	// token cookies.
+	CookieNames() (clientID, refreshToken string)
+	// Refreshable checks if a provided token can be refreshed. Options
+	// may further restrict the refresh tokens accepted.
+	Refreshable(ctx context.Context, token *Token, refreshToken string, options ...ValidateOption) error
 	// RefreshableTill returns the latest validity time for a token's accompanying refresh token.
 	RefreshableTill(ctx context.Context, token *Token, refreshToken string) time.Time
 }
 
+// ActionTokenService issues and redeems single use ActionTokens.
+type ActionTokenService interface {
+	// Issue creates a signed ActionToken for a purpose.
+	Issue(ctx context.Context, userID string, purpose ActionPurpose, data map[string]string) (string, error)
+	// Parse validates a signed ActionToken was issued for a purpose,
+	// is unexpired and has not been redeemed.
+	Parse(ctx context.Context, signedToken string, purpose ActionPurpose) (*ActionToken, error)
+	// Redeem marks an ActionToken as used. It fails if the token
+	// was already redeemed.
+	Redeem(ctx context.Context, token *ActionToken) error
+}
+
+// SecurityChangeService delays sensitive changes to a User's account,
+// such as removing their last 2FA method, and notifies the User with a
+// link to cancel them. This protects Users from hijacked sessions.
+type SecurityChangeService interface {
+	// IsEnabled returns true if security changes are delayed.
+	IsEnabled() bool
+	// Delay stores a PendingChange and notifies the User
+	// with a link to cancel it. A User may only have one pending
+	// change.
+	Delay(ctx context.Context, user *User, change *PendingChange) error
+	// Pending returns a User's PendingChange or nil if
+	// no change is pending.
+	Pending(ctx context.Context, userID string) (*PendingChange, error)
+	// Remove removes a User's PendingChange. It returns
+	// false if no change was pending.
+	Remove(ctx context.Context, userID string) (bool, error)
+	// Cancel cancels a User's PendingChange with the token
+	// delivered to the User.
+	Cancel(ctx context.Context, signedToken string) (*PendingChange, error)
+}
+
+// ClientApplicationService resolves the ClientApplications
+// requests are made on behalf of.
+type ClientApplicationService interface {
+	// ByID retrieves a registered ClientApplication.
+	ByID(ctx context.Context, clientID string) (*ClientApplication, error)
+	// IsOriginAllowed checks if any registered ClientApplication
+	// may be used from an origin.
+	IsOriginAllowed(ctx context.Context, origin string) bool
+	// NotifyLogout delivers a LogoutNotice to the back-channel logout
+	// URL of a ClientApplication. Every ClientApplication is notified
+	// if no ID is provided.
+	NotifyLogout(ctx context.Context, clientID string, notice *LogoutNotice) error
+}
+
 // WebAuthnService manages the protocol for WebAuthn authentication.
 type WebAuthnService interface {
 	// BeginSignUp attempts to register a new WebAuthn device.
@@ -382,6 +1359,16 @@ type WebAuthnService interface {
 	BeginLogin(ctx context.Context, user *User) ([]byte, error)
 	// FinishLogin confirms that a device successfully signed a challenge.
 	FinishLogin(ctx context.Context, user *User, r *http.Request) error
+	// BeginDiscoverableLogin starts the authentication flow for a User
+	// identified by the discoverable credential (passkey) their device
+	// selects, such as through browser autofill.
+	BeginDiscoverableLogin(ctx context.Context) ([]byte, error)
+	// FinishDiscoverableLogin confirms that a discoverable credential
+	// signed a challenge and returns the User owning it.
+	FinishDiscoverableLogin(ctx context.Context, r *http.Request) (*User, error)
+	// ImportU2F registers a Device from a legacy FIDO U2F registration,
+	// allowing users migrating from another system to keep their keys.
+	ImportU2F(ctx context.Context, user *User, reg *U2FRegistration) (*Device, error)
 }
 
 // PasswordService manages the protocol for password management and validation.
@@ -393,6 +1380,10 @@ type PasswordService interface {
 	Validate(user *User, password string) error
 	// OKForUser checks if a password may be used for a user.
 	OKForUser(password string) error
+	// Rehash returns a new hash of a User's validated password if
+	// their stored hash does not match the cost used for logins from
+	// API or interactive clients. It returns nil if no rehash is needed.
+	Rehash(user *User, password string, isAPI bool) ([]byte, error)
 }
 
 // OTPService manages the protocol for SMS/Email 2FA codes and TOTP codes.
@@ -409,6 +1400,193 @@ type OTPService interface {
 	ValidateTOTP(ctx context.Context, user *User, code string) error
 }
 
+// AttestationService verifies that requests originate from a genuine
+// instance of our mobile applications running on an unmodified device.
+type AttestationService interface {
+	// Challenge issues a single use challenge for a client to
+	// bind its next attestation to.
+	Challenge(ctx context.Context) (string, error)
+	// Verify checks the attestation submitted alongside a request.
+	Verify(ctx context.Context, r *http.Request) error
+}
+
+// AnomalyDetector detects credential stuffing from failed login
+// attempts and mitigates requests from offending sources.
+type AnomalyDetector interface {
+	// RecordFailure records a failed login attempt from an IP
+	// address against an account identity.
+	RecordFailure(ctx context.Context, ip, identity string) error
+	// Check returns an error if a request originates from a flagged
+	// source and does not satisfy its mitigations.
+	Check(ctx context.Context, r *http.Request) error
+	// Challenge reports whether a request must solve a CAPTCHA
+	// before it is served.
+	Challenge(ctx context.Context, r *http.Request) (bool, error)
+	// Run periodically analyzes recent failures until the context
+	// is cancelled.
+	Run(ctx context.Context) error
+}
+
+// NetworkReputation classifies IP addresses by the anonymizing
+// networks they belong to.
+type NetworkReputation interface {
+	// Classify returns the class of network an IP address belongs
+	// to. Addresses of no known class return an empty NetworkClass.
+	Classify(ctx context.Context, ip string) (NetworkClass, error)
+	// Run periodically refreshes network lists until the context
+	// is cancelled.
+	Run(ctx context.Context) error
+}
+
+// SignupAbuseDetector throttles bursts of registrations sharing a
+// network source, device fingerprint or email domain.
+type SignupAbuseDetector interface {
+	// Check records a signup attempt for an email address and returns
+	// an error if the attempt is throttled or requires additional
+	// verification.
+	Check(ctx context.Context, r *http.Request, email string) error
+	// Challenge reports whether a signup for an email address must
+	// solve a CAPTCHA. The attempt is not recorded.
+	Challenge(ctx context.Context, r *http.Request, email string) (bool, error)
+	// Stats returns the number of signup attempts by outcome.
+	Stats(ctx context.Context) (map[string]int64, error)
+}
+
+// DeliveryStatsService records the outcome of Message deliveries.
+type DeliveryStatsService interface {
+	// Record records the outcome of an attempt to deliver a Message.
+	Record(ctx context.Context, delivery DeliveryMethod, outcome DeliveryOutcome) error
+	// Daily returns the outcomes of delivery attempts on each of the
+	// most recent days, including today.
+	Daily(ctx context.Context, days int) ([]*DeliveryStats, error)
+}
+
+// FeatureFlagService determines which features of the service are
+// enabled. Operators may toggle features at runtime without redeploying.
+type FeatureFlagService interface {
+	// Enabled reports whether a Feature is enabled.
+	Enabled(ctx context.Context, f Feature) bool
+	// Set enables or disables a Feature at runtime.
+	Set(ctx context.Context, f Feature, enabled bool) error
+	// Reset reverts a Feature to its configured default.
+	Reset(ctx context.Context, f Feature) error
+	// List returns the state of all known Features.
+	List(ctx context.Context) (map[Feature]bool, error)
+}
+
+// ExternalUserProvider verifies credentials against an external user
+// database. When configured, credentials are owned by the external
+// database and the service manages only 2FA, devices and tokens.
+type ExternalUserProvider interface {
+	// Authenticate verifies a password for an identity, where attribute
+	// is the identity type (Email or Phone). Unknown identities and
+	// incorrect passwords are reported as an ErrBadRequest.
+	Authenticate(ctx context.Context, attribute, identity, password string) (*ExternalUser, error)
+}
+
+// CanaryService detects login attempts against decoy accounts.
+type CanaryService interface {
+	// Trip reports whether an identity belongs to a Canary. Operators
+	// are alerted of every attempt against a Canary.
+	Trip(ctx context.Context, r *http.Request, identity string) (bool, error)
+}
+
+// LoginDigestService sends subscribed Users periodic digests
+// of recent sign-ins and new devices.
+type LoginDigestService interface {
+	// Run periodically sends due digests until the context
+	// is cancelled.
+	Run(ctx context.Context) error
+}
+
+// Hooks run custom logic of programs embedding the service at points
+// of the signup, login and token lifecycle. A hook returning an error
+// aborts the request and the error is returned to the client, so
+// hooks should return a DomainError such as ErrForbidden to control
+// the response. Embed NopHooks to implement a subset of hooks.
+type Hooks interface {
+	// BeforeSignup is called with a User about to be registered,
+	// before the User is stored or sent a signup code.
+	BeforeSignup(ctx context.Context, user *User) error
+	// AfterSignup is called once a User verifies their signup
+	// code, before the authorized token is returned.
+	AfterSignup(ctx context.Context, user *User) error
+	// AfterLogin is called once a User completes login, before
+	// the authorized token is returned.
+	AfterLogin(ctx context.Context, user *User, token *Token) error
+	// BeforeTokenIssue is called with every token about to be
+	// issued to a User, including refreshed tokens. Claims may be
+	// added to the token's Custom field.
+	BeforeTokenIssue(ctx context.Context, user *User, token *Token) error
+}
+
+// NopHooks implements Hooks without custom logic.
+type NopHooks struct{}
+
+// BeforeSignup allows every signup.
+func (NopHooks) BeforeSignup(ctx context.Context, user *User) error { return nil }
+
+// AfterSignup allows every signup.
+func (NopHooks) AfterSignup(ctx context.Context, user *User) error { return nil }
+
+// AfterLogin allows every login.
+func (NopHooks) AfterLogin(ctx context.Context, user *User, token *Token) error { return nil }
+
+// BeforeTokenIssue issues every token unchanged.
+func (NopHooks) BeforeTokenIssue(ctx context.Context, user *User, token *Token) error { return nil }
+
+// EnrollmentReminderService reminds Users to enroll a second factor
+// before their enrollment deadline.
+type EnrollmentReminderService interface {
+	// Run periodically sends due reminders until the context
+	// is cancelled.
+	Run(ctx context.Context) error
+}
+
+// MetadataService resolves authenticator models from the FIDO
+// Metadata Service.
+type MetadataService interface {
+	// Lookup returns the metadata of an authenticator model by its
+	// AAGUID. Unknown models return nil.
+	Lookup(aaguid []byte) *AuthenticatorMetadata
+	// Run periodically refreshes metadata until the context
+	// is cancelled.
+	Run(ctx context.Context) error
+}
+
+// GeoLocation is the approximate location of an IP address.
+type GeoLocation struct {
+	// Country is the ISO 3166-1 alpha-2 country code.
+	Country string
+	City    string
+	// ASN is the number of the autonomous system announcing the
+	// IP address. A zero value means it is unknown.
+	ASN            uint
+	ASOrganization string
+}
+
+// String returns the location in a human readable form.
+func (g *GeoLocation) String() string {
+	switch {
+	case g.City != "" && g.Country != "":
+		return g.City + ", " + g.Country
+	case g.Country != "":
+		return g.Country
+	default:
+		return g.City
+	}
+}
+
+// GeoResolver resolves the location of IP addresses.
+type GeoResolver interface {
+	// Lookup returns the location of an IP address. Unknown
+	// addresses return nil.
+	Lookup(ip string) *GeoLocation
+	// Run periodically reloads location databases which changed
+	// on disk until the context is cancelled.
+	Run(ctx context.Context) error
+}
+
 // MessagingService sends messages through email or SMS.
 type MessagingService interface {
 	// Send sends a message to a user.
@@ -430,6 +1608,66 @@ type LoginAPI interface {
 	// a TOTP or randomly generated code delivered by SMS/Email.
 	// On success it will return a JWT token in an auhtorized state.
 	VerifyCode(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// RequestApproval delivers a link to approve a pending login
+	// from another device.
+	RequestApproval(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Approve approves a pending login.
+	Approve(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// ApprovalEvents streams the approval status of a pending login.
+	ApprovalEvents(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// VerifyApproval exchanges an approved login for a JWT token
+	// in an authorized state.
+	VerifyApproval(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// PasskeyChallenge retrieves a challenge to be signed by any
+	// discoverable credential, for browser passkey autofill.
+	PasskeyChallenge(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Challenge reports whether a login from the client must solve
+	// a CAPTCHA.
+	Challenge(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// RequestUnlock delivers a code to a verified contact of a User
+	// to unlock an account locked after repeated failed logins.
+	RequestUnlock(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Unlock verifies an unlock code and lifts the lockout of an
+	// account.
+	Unlock(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// ResetPassword sets a new password for a User whose password
+	// was expired.
+	ResetPassword(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// VerifyPasskey identifies and authenticates a User through a
+	// discoverable credential. On success it will return a JWT token
+	// in an authorized state.
+	VerifyPasskey(w http.ResponseWriter, r *http.Request) (interface{}, error)
+}
+
+// RecoveryAPI provides HTTP handlers to recover an account
+// with a signing device.
+type RecoveryAPI interface {
+	// Recover retrieves a device challenge to be signed by the
+	// client to recover an account.
+	Recover(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Verify verifies a signed device challenge. The first
+	// verification starts a recovery which may be completed by
+	// verifying again once its delay has passed. On completion it
+	// will return a JWT token in an authorized state.
+	Verify(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Cancel cancels a pending recovery.
+	Cancel(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// TrustedContacts retrieves a User's trusted contacts.
+	TrustedContacts(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// ConfigureTrustedContacts designates trusted contacts and
+	// delivers each a share of a new recovery code.
+	ConfigureTrustedContacts(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// VerifyTrustedContact confirms a trusted contact received
+	// their share.
+	VerifyTrustedContact(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// RemoveTrustedContacts removes a User's trusted contacts.
+	RemoveTrustedContacts(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// RecoverWithShares restores access to an account with shares
+	// of its recovery code. Like Verify, the first submission starts
+	// a recovery which may be completed by submitting the shares
+	// again once its delay has passed. On completion it will return
+	// a JWT token in an authorized state.
+	RecoverWithShares(w http.ResponseWriter, r *http.Request) (interface{}, error)
 }
 
 // SignUpAPI provides HTTP handlers for user registration.
@@ -441,6 +1679,12 @@ type SignUpAPI interface {
 	// User's authenticity. On success it will return a JWT
 	// token in an authozied state.
 	Verify(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Resend delivers a new code to a User who has not yet
+	// completed registration.
+	Resend(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Challenge reports whether a registration from the client
+	// must solve a CAPTCHA.
+	Challenge(w http.ResponseWriter, r *http.Request) (interface{}, error)
 }
 
 // ContactAPI provides HTTP handlers to manage email/SMS configuration for a User.
@@ -463,6 +1707,12 @@ type ContactAPI interface {
 	// Send allows a user to request an OTP code to be delivered to them through
 	// a pre-approved channel.
 	Send(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// ApplyChange applies a User's pending security change once
+	// its delay has passed.
+	ApplyChange(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// CancelChange cancels a pending security change with the token
+	// delivered to the User's previous contact address.
+	CancelChange(w http.ResponseWriter, r *http.Request) (interface{}, error)
 }
 
 // TOTPAPI provides HTTP handlers to manage TOTP configuration for a User.
@@ -498,12 +1748,20 @@ type DeviceAPI interface {
 type TokenAPI interface {
 	// Revoke revokes a User's token for a logged in session.
 	Revoke(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// RevokeAll revokes every logged in session of a User, including
+	// the current session.
+	RevokeAll(w http.ResponseWriter, r *http.Request) (interface{}, error)
 	// Verify verifies a User's token is authenticated and
 	// valid. A valid token is not expired and not revoked.
 	Verify(w http.ResponseWriter, r *http.Request) (interface{}, error)
 	// Refresh refreshes an expired token with a new expiry time.
 	// Refreshed tokens share a token's original ID and client ID.
 	Refresh(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Logout revokes the current session, or every session of a User,
+	// and clears the session's cookies.
+	Logout(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// History retrieves a page of a User's login history.
+	History(w http.ResponseWriter, r *http.Request) (interface{}, error)
 }
 
 // UserAPI proivdes HTTP handlers to configure a registered User's
@@ -513,6 +1771,122 @@ type UserAPI interface {
 	UpdatePassword(w http.ResponseWriter, r *http.Request) (interface{}, error)
 }
 
+// LoginDigestAPI provides HTTP handlers for a User to manage
+// login digest emails.
+type LoginDigestAPI interface {
+	// Subscribe opts a User in to login digest emails.
+	Subscribe(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Unsubscribe opts a User out of login digest emails.
+	Unsubscribe(w http.ResponseWriter, r *http.Request) (interface{}, error)
+}
+
+// OrganizationAPI provides HTTP handlers to manage Organizations
+// and their members.
+type OrganizationAPI interface {
+	// Create creates an Organization owned by the User.
+	Create(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// List returns all Organizations the User is a member of.
+	List(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Members returns all members of an Organization.
+	Members(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Invite invites an email address to join an Organization.
+	Invite(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Accept accepts an Invitation on behalf of the User.
+	Accept(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// RemoveMember removes a member from an Organization.
+	RemoveMember(w http.ResponseWriter, r *http.Request) (interface{}, error)
+}
+
+// ConsentAPI provides HTTP handlers to record a User's
+// acceptance of policy documents.
+type ConsentAPI interface {
+	// Accept records acceptance of policy versions.
+	Accept(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Status returns the required policies and the User's acceptance.
+	Status(w http.ResponseWriter, r *http.Request) (interface{}, error)
+}
+
+// ProfileAPI provides HTTP handlers for a User to retrieve
+// their profile.
+type ProfileAPI interface {
+	// Profile returns a User's profile and the claims of their token.
+	Profile(w http.ResponseWriter, r *http.Request) (interface{}, error)
+}
+
+// AttestationAPI provides HTTP handlers for mobile clients
+// to attest their integrity.
+type AttestationAPI interface {
+	// Challenge issues a single use challenge to bind
+	// an attestation to.
+	Challenge(w http.ResponseWriter, r *http.Request) (interface{}, error)
+}
+
+// SecurityAPI provides HTTP handlers summarizing the security
+// settings of a User's account.
+type SecurityAPI interface {
+	// Settings returns a User's enabled factors, contact addresses,
+	// devices, active session count and previous login.
+	Settings(w http.ResponseWriter, r *http.Request) (interface{}, error)
+}
+
+// AdminAPI provides HTTP handlers for operators to manage the service.
+type AdminAPI interface {
+	// CreateCanary registers a decoy account identity.
+	CreateCanary(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// ListCanaries returns all registered decoy account identities.
+	ListCanaries(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// RemoveCanary removes a decoy account identity.
+	RemoveCanary(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// ListFeatures returns the state of all feature flags.
+	ListFeatures(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// SetFeature enables or disables a feature at runtime.
+	SetFeature(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// ResetFeature reverts a feature to its configured default.
+	ResetFeature(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// ExportUsers returns a page of Users with their contact methods
+	// and registered devices. Secrets are excluded.
+	ExportUsers(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// RevokeUserTokens revokes every logged in session of a User.
+	RevokeUserTokens(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// ImportU2F imports a User's legacy FIDO U2F keys as
+	// WebAuthn devices.
+	ImportU2F(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// CreateClient registers a ClientApplication.
+	CreateClient(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// ListClients returns all registered ClientApplications.
+	ListClients(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// RemoveClient removes a ClientApplication.
+	RemoveClient(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// SignupAbuseStats returns the number of signup attempts by outcome.
+	SignupAbuseStats(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Stats returns aggregate statistics of the service for
+	// operational dashboards.
+	Stats(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// ListDeliveries returns the most recent MessageDeliveries to
+	// an address.
+	ListDeliveries(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// CreateJob starts a bulk action, such as expiring passwords or
+	// revoking sessions, against a set of Users.
+	CreateJob(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// GetJob returns the progress of a bulk action.
+	GetJob(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// Run waits until the context is cancelled, then interrupts
+	// running bulk actions and marks them failed.
+	Run(ctx context.Context) error
+	// CreateBreach starts a bulk action applying every response to
+	// compromised credentials against a set of Users.
+	CreateBreach(w http.ResponseWriter, r *http.Request) (interface{}, error)
+}
+
+// DeliveryAPI receives message delivery status reports from providers.
+type DeliveryAPI interface {
+	// TwilioStatus receives SMS status callbacks from Twilio.
+	TwilioStatus(w http.ResponseWriter, r *http.Request) (interface{}, error)
+	// SendGridEvents receives email events from SendGrid's
+	// event webhook.
+	SendGridEvents(w http.ResponseWriter, r *http.Request) (interface{}, error)
+}
+
 // Emailer exposes an email API.
 type Emailer interface {
 	// Email sends an email to an email address
@@ -524,3 +1898,9 @@ type SMSer interface {
 	// SMS sends an SMS to an phone number
 	SMS(ctx context.Context, phoneNumber string, message string) error
 }
+
+// Matrixer exposes a Matrix client-server API.
+type Matrixer interface {
+	// Matrix sends a message to a Matrix ID
+	Matrix(ctx context.Context, matrixID string, message string) error
+}
@@ -0,0 +1,56 @@
+package authenticator
+
+import (
+	"testing"
+)
+
+func TestClientApplication_TFAPolicies(t *testing.T) {
+	user := &User{IsTOTPAllowed: true}
+
+	tt := []struct {
+		name            string
+		level           TFALevel
+		canAuthenticate bool
+		allowsOTP       bool
+		allowsTOTP      bool
+	}{
+		{
+			name:            "Default level",
+			level:           "",
+			canAuthenticate: true,
+			allowsOTP:       true,
+			allowsTOTP:      true,
+		},
+		{
+			name:            "TOTP level",
+			level:           TFALevelTOTP,
+			canAuthenticate: true,
+			allowsTOTP:      true,
+		},
+		{
+			name:  "Device level",
+			level: TFALevelDevice,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			app := &ClientApplication{RequiredTFA: tc.level}
+			if app.CanAuthenticate(user) != tc.canAuthenticate {
+				t.Errorf("incorrect CanAuthenticate, want %v got %v",
+					tc.canAuthenticate, app.CanAuthenticate(user))
+			}
+			if app.AllowsTFA(OTPEmail) != tc.allowsOTP {
+				t.Errorf("incorrect AllowsTFA(%s), want %v got %v",
+					OTPEmail, tc.allowsOTP, app.AllowsTFA(OTPEmail))
+			}
+			if app.AllowsTFA(TOTP) != tc.allowsTOTP {
+				t.Errorf("incorrect AllowsTFA(%s), want %v got %v",
+					TOTP, tc.allowsTOTP, app.AllowsTFA(TOTP))
+			}
+			if !app.AllowsTFA(FIDODevice) {
+				t.Errorf("expected AllowsTFA(%s) to be true", FIDODevice)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// Command import migrates users exported from other authentication
+// systems. Exports are CSV or JSON files of users with an email address,
+// phone number and bcrypt password hash.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/logredact"
+	"github.com/fmitra/authenticator/internal/postgres"
+	"github.com/fmitra/authenticator/internal/userimport"
+	"github.com/fmitra/authenticator/server"
+)
+
+func main() {
+	ctx := context.Background()
+
+	var err error
+	var logger log.Logger
+	{
+		logger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+		logger = logredact.NewLogger(logger)
+		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+	}
+
+	var configPath string
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	{
+		fs.String("pg.conn-string", "", "Postgres connection string")
+		fs.String("pg.encryption.key", "", "Secret key to encrypt PII columns of users. Encryption is disabled if empty")
+		fs.Int("pg.encryption.version", 1, "Version of the PII encryption key. Increment when rotating the key")
+		fs.String("pg.encryption.retired-keys", "", "Comma separated version:key list of previous PII encryption keys")
+		fs.String("pg.encryption.index-key", "", "Secret key of blind indexes used to look up encrypted phones and emails. Must not change")
+		fs.String("phone.default-region", "", "ISO 3166-1 region of phone numbers exported without a country code")
+		fs.Bool("email.match-aliases", false, "Match Gmail addresses which differ only by dots or a plus suffix. Requires the email-canonical migration when changed")
+		fs.String("import.file", "", "Path to a CSV or JSON export of users")
+		fs.String("import.format", "", "Format of the export, csv or json. Defaults to the file extension")
+		fs.Bool("import.dry-run", false, "Validate the export and check for duplicates without creating users")
+		fs.Bool("import.stop-on-duplicate", false, "Abort the import on the first duplicate user instead of skipping it")
+		fs.Int("import.progress", 1000, "Log progress after every n records")
+
+		fs.StringVar(&configPath, "config", "", "Path to the config file")
+		err = fs.Parse(os.Args[1:])
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		if err != nil {
+			logger.Log("message", "failed to parse cli flags", "error", err, "source", "cmd/import")
+			os.Exit(1)
+		}
+	}
+
+	if _, err = os.Stat(configPath); !os.IsNotExist(err) {
+		viper.SetConfigFile(configPath)
+		err = viper.ReadInConfig()
+		if err != nil {
+			logger.Log("message", "failed to load config file", "error", err, "source", "cmd/import")
+			os.Exit(1)
+		}
+	}
+	if err = viper.BindPFlags(fs); err != nil {
+		logger.Log("message", "failed to load cli flags", "error", err, "source", "cmd/import")
+		os.Exit(1)
+	}
+
+	if err = contactchecker.SetDefaultRegion(viper.GetString("phone.default-region")); err != nil {
+		logger.Log("message", "invalid phone region", "error", err, "source", "cmd/import")
+		os.Exit(1)
+	}
+	contactchecker.SetEmailAliases(viper.GetBool("email.match-aliases"))
+
+	records, err := readRecords(viper.GetString("import.file"), viper.GetString("import.format"))
+	if err != nil {
+		logger.Log("message", "failed to read export", "error", err, "source", "cmd/import")
+		os.Exit(1)
+	}
+
+	pgDB, err := sql.Open("postgres", viper.GetString("pg.conn-string"))
+	if err != nil {
+		logger.Log("message", "postgres connection failed", "error", err, "source", "cmd/import")
+		os.Exit(1)
+	}
+	defer pgDB.Close()
+	if err = pgDB.Ping(); err != nil {
+		logger.Log("message", "postgres did not respond", "error", err, "source", "cmd/import")
+		os.Exit(1)
+	}
+
+	// Exported passwords are stored as is rather than hashed again.
+	pgOptions, err := server.EncryptionOptions(viper.GetViper())
+	if err != nil {
+		logger.Log("message", "invalid encryption keys", "error", err, "source", "cmd/import")
+		os.Exit(1)
+	}
+	repoMngr := postgres.NewClient(append(pgOptions,
+		postgres.WithLogger(logger),
+		postgres.WithPassword(&userimport.HashedPassword{}),
+		postgres.WithDB(pgDB),
+	)...)
+
+	importer := userimport.New(
+		userimport.WithLogger(logger),
+		userimport.WithRepoManager(repoMngr),
+		userimport.WithDryRun(viper.GetBool("import.dry-run")),
+		userimport.WithStopOnDuplicate(viper.GetBool("import.stop-on-duplicate")),
+		userimport.WithProgress(viper.GetInt("import.progress")),
+	)
+
+	summary, err := importer.Run(ctx, records)
+	for _, recordErr := range summary.Errors {
+		level.Warn(logger).Log(
+			"message", "record not imported",
+			"line", recordErr.Line,
+			"error", recordErr.Err,
+			"source", "cmd/import",
+		)
+	}
+	if err != nil {
+		logger.Log("message", "import aborted", "error", err, "source", "cmd/import")
+		os.Exit(1)
+	}
+}
+
+// readRecords reads an export, inferring its format from the file
+// extension if not provided.
+func readRecords(path, format string) ([]*userimport.Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	var read func(io.Reader) ([]*userimport.Record, error)
+	switch strings.ToLower(format) {
+	case "csv":
+		read = userimport.ReadCSV
+	case "json":
+		read = userimport.ReadJSON
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+
+	return read(f)
+}
@@ -0,0 +1,149 @@
+// Command migrate applies data migrations which cannot be expressed
+// in the SQL schema.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/logredact"
+	"github.com/fmitra/authenticator/internal/postgres"
+	"github.com/fmitra/authenticator/server"
+)
+
+func main() {
+	ctx := context.Background()
+
+	var err error
+	var logger log.Logger
+	{
+		logger = log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+		logger = logredact.NewLogger(logger)
+		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+	}
+
+	var configPath string
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	{
+		fs.String("pg.conn-string", "", "Postgres connection string")
+		fs.String("phone.default-region", "", "ISO 3166-1 region of phone numbers stored without a country code")
+		fs.String("pg.encryption.key", "", "Secret key to encrypt PII columns of users. Encryption is disabled if empty")
+		fs.Int("pg.encryption.version", 1, "Version of the PII encryption key. Increment when rotating the key")
+		fs.String("pg.encryption.retired-keys", "", "Comma separated version:key list of previous PII encryption keys")
+		fs.String("pg.encryption.index-key", "", "Secret key of blind indexes used to look up encrypted phones and emails. Must not change")
+		fs.Bool("email.match-aliases", false, "Match Gmail addresses which differ only by dots or a plus suffix")
+		fs.String("migrate.name", "", "Migration to apply. Supports phone-e164, email-canonical and pii-encryption")
+		fs.Int("migrate.batch-size", 500, "Number of rows migrated per batch")
+		fs.Bool("migrate.dry-run", false, "Report changes without applying them")
+
+		fs.StringVar(&configPath, "config", "", "Path to the config file")
+		err = fs.Parse(os.Args[1:])
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		if err != nil {
+			logger.Log("message", "failed to parse cli flags", "error", err, "source", "cmd/migrate")
+			os.Exit(1)
+		}
+	}
+
+	if _, err = os.Stat(configPath); !os.IsNotExist(err) {
+		viper.SetConfigFile(configPath)
+		err = viper.ReadInConfig()
+		if err != nil {
+			logger.Log("message", "failed to load config file", "error", err, "source", "cmd/migrate")
+			os.Exit(1)
+		}
+	}
+	if err = viper.BindPFlags(fs); err != nil {
+		logger.Log("message", "failed to load cli flags", "error", err, "source", "cmd/migrate")
+		os.Exit(1)
+	}
+
+	if err = contactchecker.SetDefaultRegion(viper.GetString("phone.default-region")); err != nil {
+		logger.Log("message", "invalid phone region", "error", err, "source", "cmd/migrate")
+		os.Exit(1)
+	}
+
+	contactchecker.SetEmailAliases(viper.GetBool("email.match-aliases"))
+
+	pgDB, err := sql.Open("postgres", viper.GetString("pg.conn-string"))
+	if err != nil {
+		logger.Log("message", "postgres connection failed", "error", err, "source", "cmd/migrate")
+		os.Exit(1)
+	}
+	defer pgDB.Close()
+	if err = pgDB.Ping(); err != nil {
+		logger.Log("message", "postgres did not respond", "error", err, "source", "cmd/migrate")
+		os.Exit(1)
+	}
+
+	pgOptions, err := server.EncryptionOptions(viper.GetViper())
+	if err != nil {
+		logger.Log("message", "invalid encryption keys", "error", err, "source", "cmd/migrate")
+		os.Exit(1)
+	}
+	repoMngr := postgres.NewClient(append(pgOptions,
+		postgres.WithLogger(logger),
+		postgres.WithDB(pgDB),
+	)...)
+
+	var migrate func(ctx context.Context, batchSize int, dryRun bool) (*postgres.Migration, error)
+	switch name := viper.GetString("migrate.name"); name {
+	case "phone-e164":
+		migrate = repoMngr.MigratePhoneNumbers
+	case "email-canonical":
+		migrate = repoMngr.MigrateCanonicalEmails
+	case "pii-encryption":
+		migrate = repoMngr.MigrateEncryption
+	default:
+		logger.Log("message", "unknown migration", "name", name, "source", "cmd/migrate")
+		os.Exit(1)
+	}
+
+	result, err := migrate(ctx, viper.GetInt("migrate.batch-size"), viper.GetBool("migrate.dry-run"))
+	if result != nil {
+		logResult(logger, result)
+	}
+	if err != nil {
+		logger.Log("message", "migration failed", "error", err, "source", "cmd/migrate")
+		os.Exit(1)
+	}
+}
+
+// logResult logs the result of a migration. Users whose values
+// cannot be migrated are logged for manual review.
+func logResult(logger log.Logger, result *postgres.Migration) {
+	for _, userID := range result.Conflicts {
+		level.Warn(logger).Log(
+			"message", "migrated value belongs to another user",
+			"user_id", userID,
+			"source", "cmd/migrate",
+		)
+	}
+	for _, userID := range result.Invalid {
+		level.Warn(logger).Log(
+			"message", "value cannot be migrated",
+			"user_id", userID,
+			"source", "cmd/migrate",
+		)
+	}
+	level.Info(logger).Log(
+		"message", "migration finished",
+		"name", viper.GetString("migrate.name"),
+		"checked", result.Checked,
+		"updated", result.Updated,
+		"conflicts", len(result.Conflicts),
+		"invalid", len(result.Invalid),
+		"canaries", result.Canaries,
+		"dry_run", viper.GetBool("migrate.dry-run"),
+		"source", "cmd/migrate",
+	)
+}
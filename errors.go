@@ -22,6 +22,36 @@ const (
 	EWebAuthn ErrCode = "webauthn"
 	// EThrottle represents a rate limiting error.
 	EThrottle ErrCode = "too_many_requests"
+	// EForbidden represents a request that is not permitted
+	// regardless of authentication.
+	EForbidden ErrCode = "forbidden"
+	// EUnavailable represents a request that cannot be served
+	// while the service is in maintenance.
+	EUnavailable ErrCode = "unavailable"
+	// ETooLarge represents a request body exceeding the
+	// configured size limit.
+	ETooLarge ErrCode = "request_too_large"
+	// EValidation represents a request payload with invalid fields.
+	EValidation ErrCode = "validation_failed"
+	// EChallenge represents a request which must solve a challenge,
+	// such as a CAPTCHA, before it is served.
+	EChallenge ErrCode = "challenge_required"
+	// EQuota represents a request exceeding a usage quota, such as
+	// the number of tokens issued per hour.
+	EQuota ErrCode = "quota_exceeded"
+)
+
+const (
+	// FieldRequired describes a missing field.
+	FieldRequired FieldCode = "required"
+	// FieldInvalid describes a field with an unsupported value.
+	FieldInvalid FieldCode = "invalid"
+	// FieldFormat describes a field with a malformed value.
+	FieldFormat FieldCode = "invalid_format"
+	// FieldType describes a field of the wrong JSON type.
+	FieldType FieldCode = "invalid_type"
+	// FieldUnknown describes a field which is not part of a request.
+	FieldUnknown FieldCode = "unknown_field"
 )
 
 // Error represents an error within the authenticator domain.
@@ -85,6 +115,75 @@ func (e ErrThrottle) Code() ErrCode   { return EThrottle }
 func (e ErrThrottle) Error() string   { return fmt.Sprintf("[%s] %s", e.Code(), string(e)) }
 func (e ErrThrottle) Message() string { return string(e) }
 
+// ErrForbidden represents an error where a request is denied access.
+type ErrForbidden string
+
+func (e ErrForbidden) Code() ErrCode   { return EForbidden }
+func (e ErrForbidden) Error() string   { return fmt.Sprintf("[%s] %s", e.Code(), string(e)) }
+func (e ErrForbidden) Message() string { return string(e) }
+
+// ErrUnavailable represents an error where a request cannot be served
+// until the service leaves maintenance.
+type ErrUnavailable string
+
+func (e ErrUnavailable) Code() ErrCode   { return EUnavailable }
+func (e ErrUnavailable) Error() string   { return fmt.Sprintf("[%s] %s", e.Code(), string(e)) }
+func (e ErrUnavailable) Message() string { return string(e) }
+
+// ErrTooLarge represents an error where a request body exceeds
+// the configured size limit.
+type ErrTooLarge string
+
+func (e ErrTooLarge) Code() ErrCode   { return ETooLarge }
+func (e ErrTooLarge) Error() string   { return fmt.Sprintf("[%s] %s", e.Code(), string(e)) }
+func (e ErrTooLarge) Message() string { return string(e) }
+
+// ErrChallenge represents an error where a request must solve a
+// challenge, such as a CAPTCHA, before it is served.
+type ErrChallenge string
+
+func (e ErrChallenge) Code() ErrCode   { return EChallenge }
+func (e ErrChallenge) Error() string   { return fmt.Sprintf("[%s] %s", e.Code(), string(e)) }
+func (e ErrChallenge) Message() string { return string(e) }
+
+// ErrQuota represents an error where a request exceeds a usage
+// quota, such as the number of tokens issued per hour.
+type ErrQuota string
+
+func (e ErrQuota) Code() ErrCode   { return EQuota }
+func (e ErrQuota) Error() string   { return fmt.Sprintf("[%s] %s", e.Code(), string(e)) }
+func (e ErrQuota) Message() string { return string(e) }
+
+// FieldCode is a machine readable code describing why a
+// field of a request payload is invalid.
+type FieldCode string
+
+// FieldError describes an invalid field of a request payload.
+type FieldError struct {
+	Field   string    `json:"field"`
+	Code    FieldCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// ErrValidation represents an error where one or more fields of
+// a request payload are invalid. Its message is the message of the
+// first invalid field.
+type ErrValidation []FieldError
+
+func (e ErrValidation) Code() ErrCode { return EValidation }
+func (e ErrValidation) Error() string { return fmt.Sprintf("[%s] %s", e.Code(), e.Message()) }
+func (e ErrValidation) Message() string {
+	if len(e) == 0 {
+		return "request is invalid"
+	}
+	return e[0].Message
+}
+
+// ErrField returns a validation error for a single field.
+func ErrField(field string, code FieldCode, message string) ErrValidation {
+	return ErrValidation{{Field: field, Code: code, Message: message}}
+}
+
 // DomainError returns a domain error if available.
 func DomainError(err error) Error {
 	if err == nil {
@@ -3,8 +3,10 @@ module github.com/fmitra/authenticator
 go 1.13
 
 require (
+	github.com/VividCortex/gohistogram v1.0.0 // indirect
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/duo-labs/webauthn v0.0.0-20200714211715-1daaee874e43
+	github.com/fxamacker/cbor/v2 v2.2.0
 	github.com/go-kit/kit v0.8.0
 	github.com/go-logfmt/logfmt v0.4.0 // indirect
 	github.com/go-redis/redis/v8 v8.0.0-beta.7
@@ -16,11 +18,15 @@ require (
 	github.com/nyaruka/phonenumbers v1.0.40
 	github.com/oklog/run v1.0.0
 	github.com/oklog/ulid/v2 v2.0.2
+	github.com/oschwald/maxminddb-golang v1.7.0
 	github.com/pquerna/otp v1.2.0
-	github.com/sendgrid/rest v2.6.0+incompatible // indirect
+	github.com/prometheus/client_golang v0.9.2
+	github.com/sendgrid/rest v2.6.0+incompatible
 	github.com/sendgrid/sendgrid-go v3.6.1+incompatible
 	github.com/spf13/pflag v1.0.3
 	github.com/spf13/viper v1.3.2
+	github.com/yuin/gopher-lua v0.0.0-20200816102855-ee81675732da
 	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
-	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b // indirect
+	golang.org/x/net v0.0.0-20200226121028-0de0cce0169b
+	golang.org/x/text v0.3.2
 )
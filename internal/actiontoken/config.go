@@ -0,0 +1,83 @@
+package actiontoken
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/entropy"
+)
+
+const (
+	defaultTokenExpiry = time.Minute * 30
+	defaultIssuer      = "authenticator"
+)
+
+// NewService returns a new ActionTokenService.
+func NewService(options ...ConfigOption) auth.ActionTokenService {
+	s := service{
+		logger:        log.NewNopLogger(),
+		tokenExpiry:   defaultTokenExpiry,
+		purposeExpiry: make(map[auth.ActionPurpose]time.Duration),
+		issuer:        defaultIssuer,
+	}
+
+	s.entropy = entropy.New()
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithDB configures the service with a redis DB.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithTokenExpiry defines how long tokens are valid for.
+// The default value is 30 minutes.
+func WithTokenExpiry(expiresIn time.Duration) ConfigOption {
+	return func(s *service) {
+		s.tokenExpiry = expiresIn
+	}
+}
+
+// WithPurposeExpiry overrides how long tokens issued for a purpose
+// are valid for, e.g. to match the lifetime of an invitation.
+func WithPurposeExpiry(purpose auth.ActionPurpose, expiresIn time.Duration) ConfigOption {
+	return func(s *service) {
+		s.purposeExpiry[purpose] = expiresIn
+	}
+}
+
+// WithSecret configures the service with a secret value
+// for signing functions. A signing key distinct from the one
+// used for session tokens is derived from the secret.
+func WithSecret(secret string) ConfigOption {
+	return func(s *service) {
+		s.secret = deriveKey(secret)
+	}
+}
+
+// WithIssuer is the issuer identity for the JWT
+// token.
+func WithIssuer(issuer string) ConfigOption {
+	return func(s *service) {
+		s.issuer = issuer
+	}
+}
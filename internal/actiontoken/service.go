@@ -0,0 +1,157 @@
+// Package actiontoken issues short lived, single use tokens for actions
+// such as email verification, password resets and invitations.
+package actiontoken
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	redislib "github.com/go-redis/redis/v8"
+	"github.com/oklog/ulid/v2"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// keyContext separates the action token signing key from the key
+// used to sign session tokens.
+const keyContext = "action-token"
+
+// rediser is an interface to go-redis.
+type rediser interface {
+	Get(ctx context.Context, key string) *redislib.StringCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redislib.BoolCmd
+	Close() error
+}
+
+// service is an implementation of auth.ActionTokenService
+// backed by redis.
+type service struct {
+	logger        log.Logger
+	tokenExpiry   time.Duration
+	purposeExpiry map[auth.ActionPurpose]time.Duration
+	entropy       io.Reader
+	secret        []byte
+	issuer        string
+	db            rediser
+}
+
+// Issue creates a signed ActionToken for a purpose.
+func (s *service) Issue(ctx context.Context, userID string, purpose auth.ActionPurpose, data map[string]string) (string, error) {
+	tokenULID, err := ulid.New(ulid.Now(), s.entropy)
+	if err != nil {
+		return "", fmt.Errorf("cannot generate unique token ID: %w", err)
+	}
+
+	expiresIn, ok := s.purposeExpiry[purpose]
+	if !ok {
+		expiresIn = s.tokenExpiry
+	}
+
+	now := time.Now()
+	token := &auth.ActionToken{
+		StandardClaims: jwt.StandardClaims{
+			Id:        tokenULID.String(),
+			ExpiresAt: now.Add(expiresIn).Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    s.issuer,
+		},
+		UserID:  userID,
+		Purpose: purpose,
+		Data:    data,
+	}
+
+	jwtUnsigned := jwt.NewWithClaims(jwt.SigningMethodHS512, token)
+	signedToken, err := jwtUnsigned.SignedString(s.secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return signedToken, nil
+}
+
+// Parse validates a signed ActionToken was issued for a purpose,
+// is unexpired and has not been redeemed.
+func (s *service) Parse(ctx context.Context, signedToken string, purpose auth.ActionPurpose) (*auth.ActionToken, error) {
+	tokenParser := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+
+		return s.secret, nil
+	}
+
+	unpackedToken, err := jwt.Parse(signedToken, tokenParser)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrInvalidToken("token is invalid"))
+	}
+
+	claims, ok := unpackedToken.Claims.(jwt.MapClaims)
+	if !ok || !unpackedToken.Valid {
+		return nil, fmt.Errorf("token claims unavailable")
+	}
+
+	var token auth.ActionToken
+	{
+		b, err := json.Marshal(claims)
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal token to JSON: %w", err)
+		}
+
+		err = json.Unmarshal(b, &token)
+		if err != nil {
+			return nil, fmt.Errorf("cannot unmarshall token to struct: %w", err)
+		}
+	}
+
+	if token.Purpose != purpose {
+		return nil, auth.ErrInvalidToken("token purpose is invalid")
+	}
+
+	err = s.db.Get(ctx, RedemptionKey(token.Id)).Err()
+	if err == nil {
+		return nil, auth.ErrInvalidToken("token is already used")
+	}
+	if err != redislib.Nil {
+		return nil, fmt.Errorf("cannot check token redemption: %w", err)
+	}
+
+	return &token, nil
+}
+
+// Redeem marks an ActionToken as used. It fails if the token
+// was already redeemed.
+func (s *service) Redeem(ctx context.Context, token *auth.ActionToken) error {
+	// The redemption record only needs to outlive the token itself.
+	expiresIn := time.Until(time.Unix(token.ExpiresAt, 0))
+	if expiresIn <= 0 {
+		return auth.ErrInvalidToken("token is expired")
+	}
+
+	ok, err := s.db.SetNX(ctx, RedemptionKey(token.Id), true, expiresIn).Result()
+	if err != nil {
+		return fmt.Errorf("cannot redeem token: %w", err)
+	}
+	if !ok {
+		return auth.ErrInvalidToken("token is already used")
+	}
+
+	return nil
+}
+
+// RedemptionKey is the key used to record a redeemed ActionToken.
+func RedemptionKey(tokenID string) string {
+	return fmt.Sprintf("%s_action_redeemed", tokenID)
+}
+
+func deriveKey(secret string) []byte {
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write([]byte(keyContext))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,132 @@
+package actiontoken
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/memstore"
+	"github.com/fmitra/authenticator/internal/token"
+)
+
+func NewTestActionTokenSvc(db rediser, expiresIn time.Duration) auth.ActionTokenService {
+	return NewService(
+		WithLogger(log.NewNopLogger()),
+		WithDB(db),
+		WithTokenExpiry(expiresIn),
+		WithSecret("my-signing-secret"),
+		WithIssuer("authenticator"),
+	)
+}
+
+func TestActionTokenSvc_IssueAndRedeem(t *testing.T) {
+	ctx := context.Background()
+	svc := NewTestActionTokenSvc(memstore.New(), time.Minute)
+
+	signedToken, err := svc.Issue(ctx, "user-id", auth.PurposeAcceptInvite, map[string]string{
+		"email": "jane@example.com",
+	})
+	if err != nil {
+		t.Fatal("failed to issue token:", err)
+	}
+
+	actionToken, err := svc.Parse(ctx, signedToken, auth.PurposeAcceptInvite)
+	if err != nil {
+		t.Fatal("failed to parse token:", err)
+	}
+	if actionToken.UserID != "user-id" {
+		t.Errorf("incorrect user ID, want %s got %s", "user-id", actionToken.UserID)
+	}
+	if actionToken.Data["email"] != "jane@example.com" {
+		t.Errorf("incorrect data, want %s got %s", "jane@example.com", actionToken.Data["email"])
+	}
+
+	if err = svc.Redeem(ctx, actionToken); err != nil {
+		t.Fatal("failed to redeem token:", err)
+	}
+
+	err = svc.Redeem(ctx, actionToken)
+	if auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code on second redemption, want %s got %s",
+			auth.EInvalidToken, auth.ErrorCode(err))
+	}
+
+	_, err = svc.Parse(ctx, signedToken, auth.PurposeAcceptInvite)
+	if auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code for redeemed token, want %s got %s",
+			auth.EInvalidToken, auth.ErrorCode(err))
+	}
+}
+
+func TestActionTokenSvc_ParseInvalid(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New()
+	svc := NewTestActionTokenSvc(db, time.Minute)
+	expiredSvc := NewTestActionTokenSvc(db, -time.Minute)
+	otherSvc := NewService(WithDB(db), WithSecret("other-secret"))
+	overrideSvc := NewService(
+		WithDB(db),
+		WithSecret("my-signing-secret"),
+		WithPurposeExpiry(auth.PurposeAcceptInvite, -time.Minute),
+	)
+	sessionSvc := token.NewService(token.WithDB(db), token.WithSecret("my-signing-secret"))
+
+	sessionToken, err := sessionSvc.Sign(ctx, &auth.Token{UserID: "user-id"})
+	if err != nil {
+		t.Fatal("failed to sign session token:", err)
+	}
+
+	tt := []struct {
+		name  string
+		token func() (string, error)
+	}{
+		{
+			name: "Purpose mismatch",
+			token: func() (string, error) {
+				return svc.Issue(ctx, "user-id", auth.PurposeResetPassword, nil)
+			},
+		},
+		{
+			name: "Expired token",
+			token: func() (string, error) {
+				return expiredSvc.Issue(ctx, "user-id", auth.PurposeAcceptInvite, nil)
+			},
+		},
+		{
+			name: "Expired purpose override",
+			token: func() (string, error) {
+				return overrideSvc.Issue(ctx, "user-id", auth.PurposeAcceptInvite, nil)
+			},
+		},
+		{
+			name: "Unknown signing key",
+			token: func() (string, error) {
+				return otherSvc.Issue(ctx, "user-id", auth.PurposeAcceptInvite, nil)
+			},
+		},
+		{
+			name: "Session token",
+			token: func() (string, error) {
+				return sessionToken, nil
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			signedToken, err := tc.token()
+			if err != nil {
+				t.Fatal("failed to issue token:", err)
+			}
+
+			_, err = svc.Parse(ctx, signedToken, auth.PurposeAcceptInvite)
+			if auth.ErrorCode(err) != auth.EInvalidToken {
+				t.Errorf("incorrect error code, want %s got %s",
+					auth.EInvalidToken, auth.ErrorCode(err))
+			}
+		})
+	}
+}
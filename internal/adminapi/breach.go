@@ -0,0 +1,127 @@
+package adminapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// changeDescriptions describe the actions applied to a User in the
+// alert sent by actionNotify.
+var changeDescriptions = map[string]string{
+	actionExpirePassword: "your password was expired",
+	actionResetTFA:       "your authenticator app was removed",
+	actionRevokeTokens:   "you were signed out of every session",
+}
+
+// CreateBreach starts breach mode for a User or cohort whose credentials
+// may be compromised. It is a job applying every action: passwords are
+// expired, authenticator apps are removed, sessions are revoked and
+// Users are alerted of the changes.
+func (s *service) CreateBreach(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if s.db == nil {
+		return nil, auth.ErrForbidden("bulk jobs are disabled")
+	}
+
+	req, err := decodeBreachRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.startJob(r.Context(), req)
+	if err != nil {
+		return nil, err
+	}
+
+	level.Info(s.logger).Log(
+		"source", "AdminAPI",
+		"audit", "breach_mode",
+		"job_id", resp.Job.ID,
+		"user_ids", len(req.UserIDs),
+	)
+
+	return resp, nil
+}
+
+// resetTFA removes a User's authenticator app and its secret, which
+// may have been copied, so the User must enroll an app again. WebAuthn
+// devices are kept as their keys cannot be copied. Users left without
+// a second factor may receive OTP codes at their addresses.
+func (s *service) resetTFA(ctx context.Context, user *auth.User) (bool, error) {
+	if !user.IsTOTPAllowed && user.TFASecret == "" {
+		return false, nil
+	}
+
+	client, err := s.repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = client.WithAtomic(func() (interface{}, error) {
+		user, err := client.User().GetForUpdate(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		user.IsTOTPAllowed = false
+		user.TFASecret = ""
+		if !user.IsDeviceAllowed && !user.IsEmailOTPAllowed && !user.IsPhoneOTPAllowed {
+			user.IsEmailOTPAllowed = user.Email.String != ""
+			user.IsPhoneOTPAllowed = user.Phone.String != ""
+		}
+		if err = client.User().Update(ctx, user); err != nil {
+			return nil, fmt.Errorf("cannot reset TOTP: %w", err)
+		}
+
+		return user, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// notifyBreach alerts a User that their credentials may be compromised
+// and of the actions applied to their account.
+func (s *service) notifyBreach(ctx context.Context, user *auth.User, changes []string) error {
+	msg := &auth.Message{
+		Type:     auth.BreachAlert,
+		Delivery: auth.Email,
+		Address:  user.Email.String,
+		Vars:     map[string]string{"changes": describeChanges(changes)},
+	}
+	if user.Email.String == "" {
+		msg.Delivery = auth.Phone
+		msg.Address = user.Phone.String
+	}
+
+	return s.message.Send(ctx, msg)
+}
+
+// describeChanges joins the descriptions of applied actions into a
+// sentence, e.g. "your password was expired and you were signed out
+// of every session".
+func describeChanges(changes []string) string {
+	descriptions := []string{}
+	for _, change := range changes {
+		if d, ok := changeDescriptions[change]; ok {
+			descriptions = append(descriptions, d)
+		}
+	}
+
+	switch len(descriptions) {
+	case 0:
+		return "no changes were made to your account"
+	case 1:
+		return descriptions[0]
+	default:
+		last := len(descriptions) - 1
+		return strings.Join(descriptions[:last], ", ") + " and " + descriptions[last]
+	}
+}
@@ -0,0 +1,107 @@
+package adminapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/deliverystats"
+	"github.com/fmitra/authenticator/internal/featureflag"
+	"github.com/fmitra/authenticator/internal/signupabuse"
+)
+
+// NewService returns a new implementation of auth.AdminAPI.
+func NewService(options ...ConfigOption) auth.AdminAPI {
+	s := service{
+		logger:   log.NewNopLogger(),
+		features: featureflag.NewService(),
+		abuse:    signupabuse.NewService(),
+		delivery: deliverystats.NewService(),
+		now:      time.Now,
+	}
+
+	s.jobCtx, s.stopJobs = context.WithCancel(context.Background())
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithRepoManager configures the service with a new RepositoryManager.
+func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
+	return func(s *service) {
+		s.repoMngr = repoMngr
+	}
+}
+
+// WithFeatureFlags configures the service with a FeatureFlagService.
+func WithFeatureFlags(f auth.FeatureFlagService) ConfigOption {
+	return func(s *service) {
+		s.features = f
+	}
+}
+
+// WithTokenService configures the service with a TokenService.
+func WithTokenService(t auth.TokenService) ConfigOption {
+	return func(s *service) {
+		s.token = t
+	}
+}
+
+// WithWebAuthn configures the service with a WebAuthnService
+// to import legacy U2F keys.
+func WithWebAuthn(w auth.WebAuthnService) ConfigOption {
+	return func(s *service) {
+		s.webauthn = w
+	}
+}
+
+// WithSignupAbuseDetector configures the service with a
+// SignupAbuseDetector to report signup outcomes.
+func WithSignupAbuseDetector(a auth.SignupAbuseDetector) ConfigOption {
+	return func(s *service) {
+		s.abuse = a
+	}
+}
+
+// WithDeliveryStats configures the service with a DeliveryStatsService
+// to report message delivery outcomes.
+func WithDeliveryStats(d auth.DeliveryStatsService) ConfigOption {
+	return func(s *service) {
+		s.delivery = d
+	}
+}
+
+// WithDB configures the service with a Redis DB to track the
+// progress of bulk jobs.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithPasswordReset configures the service to deliver links to set
+// a new password when bulk jobs expire passwords. The reset token is
+// appended to the URL as the token query parameter. Passwords may not
+// be expired without a URL.
+func WithPasswordReset(resetURL string, t auth.ActionTokenService, m auth.MessagingService) ConfigOption {
+	return func(s *service) {
+		s.passwordResetURL = resetURL
+		s.actionTokens = t
+		s.message = m
+	}
+}
@@ -0,0 +1,201 @@
+package adminapi
+
+import (
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+// SetupHTTPHandler converts a service's public methods
+// to http handlers. Routes are restricted to operators
+// presenting the admin API key from addresses permitted
+// by the IP filter, if one is provided.
+func SetupHTTPHandler(svc auth.AdminAPI, router *mux.Router, apiKey string, ipFilter *httpapi.IPFilter, logger log.Logger, lmt httpapi.LimiterFactory) {
+	policy := httpapi.AdminPolicy(apiKey)
+
+	var handler httpapi.JSONAPIHandler
+	{
+		handler = httpapi.PolicyMiddleware(svc.CreateCanary, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.CreateCanary", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusCreated)
+		router.HandleFunc("/api/v1/admin/canary", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.ListCanaries, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.ListCanaries", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/canary", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.RemoveCanary, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.RemoveCanary", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/canary/{identity}", httpHandler).Methods("Delete")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.ListFeatures, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.ListFeatures", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/feature", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.SetFeature, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.SetFeature", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/feature/{feature}", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.ResetFeature, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.ResetFeature", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/feature/{feature}", httpHandler).Methods("Delete")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.ExportUsers, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.ExportUsers", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/export", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.RevokeUserTokens, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.RevokeUserTokens", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/user/{userID}/token", httpHandler).Methods("Delete")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.ImportU2F, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.ImportU2F", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusCreated)
+		router.HandleFunc("/api/v1/admin/user/{userID}/u2f", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.CreateClient, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.CreateClient", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusCreated)
+		router.HandleFunc("/api/v1/admin/client", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.ListClients, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.ListClients", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/client", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.RemoveClient, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.RemoveClient", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/client/{clientID}", httpHandler).Methods("Delete")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.SignupAbuseStats, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.SignupAbuseStats", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/signup-abuse", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.Stats, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.Stats", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/stats", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.ListDeliveries, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.ListDeliveries", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/delivery", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.CreateJob, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.CreateJob", httpapi.PerMinute, int64(10),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusAccepted)
+		router.HandleFunc("/api/v1/admin/job", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.GetJob, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.GetJob", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/admin/job/{jobID}", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.CreateBreach, nil, policy)
+		handler = httpapi.IPFilterMiddleware(handler, ipFilter)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AdminAPI.CreateBreach", httpapi.PerMinute, int64(10),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusAccepted)
+		router.HandleFunc("/api/v1/admin/breach", httpHandler).Methods("Post")
+	}
+}
@@ -0,0 +1,1407 @@
+package adminapi
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/memstore"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+const testAdminKey = "admin-key"
+
+func TestAdminAPI_CreateCanary(t *testing.T) {
+	tt := []struct {
+		name        string
+		statusCode  int
+		authHeader  string
+		reqBody     []byte
+		errMessage  string
+		userFn      func() (*auth.User, error)
+		canaryFn    func() (*auth.Canary, error)
+		createCalls int
+		identity    string
+	}{
+		{
+			name:       "Authentication error with no admin key",
+			statusCode: http.StatusUnauthorized,
+			reqBody:    []byte(`{"identity":"decoy@example.com"}`),
+			errMessage: "Admin key is invalid",
+		},
+		{
+			name:       "Authentication error with bad admin key",
+			statusCode: http.StatusUnauthorized,
+			authHeader: "Bearer bad-key",
+			reqBody:    []byte(`{"identity":"decoy@example.com"}`),
+			errMessage: "Admin key is invalid",
+		},
+		{
+			name:       "Invalid identity",
+			statusCode: http.StatusBadRequest,
+			authHeader: "Bearer " + testAdminKey,
+			reqBody:    []byte(`{"identity":"decoy"}`),
+			errMessage: "Identity must be an email or phone number",
+		},
+		{
+			name:       "Identity belongs to user",
+			statusCode: http.StatusBadRequest,
+			authHeader: "Bearer " + testAdminKey,
+			reqBody:    []byte(`{"identity":"jane@example.com"}`),
+			errMessage: "Identity belongs to a registered user",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{}, nil
+			},
+		},
+		{
+			name:       "Canary already exists",
+			statusCode: http.StatusBadRequest,
+			authHeader: "Bearer " + testAdminKey,
+			reqBody:    []byte(`{"identity":"decoy@example.com"}`),
+			errMessage: "Canary already exists",
+			userFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+			canaryFn: func() (*auth.Canary, error) {
+				return &auth.Canary{}, nil
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusCreated,
+			authHeader: "Bearer " + testAdminKey,
+			reqBody:    []byte(`{"identity":"decoy@example.com","note":"CRM export"}`),
+			userFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+			canaryFn: func() (*auth.Canary, error) {
+				return nil, sql.ErrNoRows
+			},
+			createCalls: 1,
+			identity:    "decoy@example.com",
+		},
+		{
+			name:       "Successful request with canonical email",
+			statusCode: http.StatusCreated,
+			authHeader: "Bearer " + testAdminKey,
+			reqBody:    []byte(`{"identity":"Decoy@Example.com"}`),
+			userFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+			canaryFn: func() (*auth.Canary, error) {
+				return nil, sql.ErrNoRows
+			},
+			createCalls: 1,
+			identity:    "decoy@example.com",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			userRepo := &test.UserRepository{ByIdentityFn: tc.userFn}
+			canaryRepo := &test.CanaryRepository{ByIdentityFn: tc.canaryFn}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return userRepo
+				},
+				CanaryFn: func() auth.CanaryRepository {
+					return canaryRepo
+				},
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/admin/canary", bytes.NewBuffer(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			if tc.authHeader != "" {
+				req.Header.Set("AUTHORIZATION", tc.authHeader)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if canaryRepo.Calls.Create != tc.createCalls {
+				t.Errorf("incorrect CanaryRepository.Create() call count, want %v got %v",
+					tc.createCalls, canaryRepo.Calls.Create)
+			}
+
+			if tc.identity != "" {
+				var resp canaryResponse
+				if err = json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+					t.Fatal("failed to decode response:", err)
+				}
+				if resp.Canary.Identity != tc.identity {
+					t.Errorf("incorrect identity, want %s got %s", tc.identity, resp.Canary.Identity)
+				}
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAdminAPI_RemoveCanary(t *testing.T) {
+	tt := []struct {
+		name       string
+		statusCode int
+		errMessage string
+		removeFn   func() error
+	}{
+		{
+			name:       "Non existent canary",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Canary does not exist",
+			removeFn: func() error {
+				return auth.ErrNotFound("canary does not exist")
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			canaryRepo := &test.CanaryRepository{RemoveFn: tc.removeFn}
+			repoMngr := &test.RepositoryManager{
+				CanaryFn: func() auth.CanaryRepository {
+					return canaryRepo
+				},
+			}
+			svc := NewService(WithRepoManager(repoMngr))
+
+			req, err := http.NewRequest("DELETE", "/api/v1/admin/canary/+15555555555", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if canaryRepo.Calls.Remove != 1 {
+				t.Errorf("incorrect CanaryRepository.Remove() call count, want 1 got %v",
+					canaryRepo.Calls.Remove)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAdminAPI_CreateClient(t *testing.T) {
+	tt := []struct {
+		name        string
+		statusCode  int
+		reqBody     []byte
+		errMessage  string
+		createCalls int
+		requiredTFA auth.TFALevel
+	}{
+		{
+			name:       "Blank name",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"name":" "}`),
+			errMessage: "Name cannot be blank",
+		},
+		{
+			name:       "Invalid origin",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"name":"mobile","allowedOrigins":["https://example.com/app"]}`),
+			errMessage: "Origin https://example.com/app is invalid",
+		},
+		{
+			name:       "Invalid token expiry",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"name":"mobile","tokenExpiry":"-5m"}`),
+			errMessage: "TokenExpiry must be a positive duration",
+		},
+		{
+			name:       "Invalid logout URL",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"name":"mobile","logoutURL":"app.example.com/logout"}`),
+			errMessage: "LogoutURL must be an HTTP or HTTPS URL",
+		},
+		{
+			name:       "Blank scope",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"name":"mobile","scopes":["invoices:read"," "]}`),
+			errMessage: "Scopes cannot be blank",
+		},
+		{
+			name:       "Invalid 2FA level",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"name":"mobile","requiredTFA":"sms"}`),
+			errMessage: "RequiredTFA must be otp, totp or device",
+		},
+		{
+			name:        "Successful request with defaults",
+			statusCode:  http.StatusCreated,
+			reqBody:     []byte(`{"name":"mobile"}`),
+			createCalls: 1,
+			requiredTFA: auth.TFALevelOTP,
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusCreated,
+			reqBody: []byte(`{
+				"name":"admin-dashboard",
+				"allowedOrigins":["https://admin.example.com"],
+				"tokenExpiry":"5m",
+				"refreshTokenExpiry":"24h",
+				"requiredTFA":"device",
+				"logoutURL":"https://admin.example.com/logout",
+				"audiences":["billing"],
+				"scopes":["invoices:read"]
+			}`),
+			createCalls: 1,
+			requiredTFA: auth.TFALevelDevice,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			clientRepo := &test.ClientApplicationRepository{}
+			repoMngr := &test.RepositoryManager{
+				ClientApplicationFn: func() auth.ClientApplicationRepository {
+					return clientRepo
+				},
+			}
+			svc := NewService(WithRepoManager(repoMngr))
+
+			req, err := http.NewRequest("POST", "/api/v1/admin/client", bytes.NewBuffer(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if clientRepo.Calls.Create != tc.createCalls {
+				t.Errorf("incorrect ClientApplicationRepository.Create() call count, want %v got %v",
+					tc.createCalls, clientRepo.Calls.Create)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if tc.createCalls == 0 {
+				return
+			}
+
+			var resp clientResponse
+			if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal("failed to decode response:", err)
+			}
+			if resp.Client.RequiredTFA != tc.requiredTFA {
+				t.Errorf("incorrect required 2FA level, want %s got %s",
+					tc.requiredTFA, resp.Client.RequiredTFA)
+			}
+		})
+	}
+}
+
+func TestAdminAPI_RemoveClient(t *testing.T) {
+	tt := []struct {
+		name       string
+		statusCode int
+		errMessage string
+		removeFn   func() error
+	}{
+		{
+			name:       "Non existent client",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Client application does not exist",
+			removeFn: func() error {
+				return auth.ErrNotFound("client application does not exist")
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			clientRepo := &test.ClientApplicationRepository{RemoveFn: tc.removeFn}
+			repoMngr := &test.RepositoryManager{
+				ClientApplicationFn: func() auth.ClientApplicationRepository {
+					return clientRepo
+				},
+			}
+			svc := NewService(WithRepoManager(repoMngr))
+
+			req, err := http.NewRequest("DELETE", "/api/v1/admin/client/01EF3Z6V5QJ2XN4WQ3Y8ZK1ABC", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if clientRepo.Calls.Remove != 1 {
+				t.Errorf("incorrect ClientApplicationRepository.Remove() call count, want 1 got %v",
+					clientRepo.Calls.Remove)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAdminAPI_SetFeature(t *testing.T) {
+	tt := []struct {
+		name       string
+		statusCode int
+		path       string
+		reqBody    []byte
+		errMessage string
+		setCalls   int
+	}{
+		{
+			name:       "Unknown feature",
+			statusCode: http.StatusBadRequest,
+			path:       "/api/v1/admin/feature/magic_links",
+			reqBody:    []byte(`{"enabled":false}`),
+			errMessage: "Feature is not recognized",
+		},
+		{
+			name:       "Missing enabled field",
+			statusCode: http.StatusBadRequest,
+			path:       "/api/v1/admin/feature/signup",
+			reqBody:    []byte(`{}`),
+			errMessage: "Enabled must be provided",
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			path:       "/api/v1/admin/feature/signup",
+			reqBody:    []byte(`{"enabled":false}`),
+			setCalls:   1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			features := &test.FeatureFlagService{}
+			svc := NewService(WithFeatureFlags(features))
+
+			req, err := http.NewRequest("POST", tc.path, bytes.NewBuffer(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if features.Calls.Set != tc.setCalls {
+				t.Errorf("incorrect FeatureFlagService.Set() call count, want %v got %v",
+					tc.setCalls, features.Calls.Set)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAdminAPI_ExportUsers(t *testing.T) {
+	users := []*auth.User{
+		{ID: "user-1", Password: "hash", TFASecret: "secret"},
+		{ID: "user-2"},
+		{ID: "user-3"},
+	}
+
+	tt := []struct {
+		name        string
+		statusCode  int
+		query       string
+		errMessage  string
+		nextCursor  string
+		userCount   int
+		deviceCalls int
+	}{
+		{
+			name:       "Invalid limit",
+			statusCode: http.StatusBadRequest,
+			query:      "?limit=1000",
+			errMessage: "Limit must be between 1 and 500",
+		},
+		{
+			name:        "Partial page",
+			statusCode:  http.StatusOK,
+			query:       "?limit=2",
+			nextCursor:  "user-2",
+			userCount:   2,
+			deviceCalls: 2,
+		},
+		{
+			name:        "Last page",
+			statusCode:  http.StatusOK,
+			userCount:   3,
+			deviceCalls: 3,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			userRepo := &test.UserRepository{
+				ListFn: func() ([]*auth.User, error) {
+					return users, nil
+				},
+			}
+			deviceRepo := &test.DeviceRepository{
+				ByUserIDFn: func() ([]*auth.Device, error) {
+					return []*auth.Device{{ID: "device-id", PublicKey: []byte("public-key")}}, nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return userRepo
+				},
+				DeviceFn: func() auth.DeviceRepository {
+					return deviceRepo
+				},
+			}
+			svc := NewService(WithRepoManager(repoMngr))
+
+			req, err := http.NewRequest("GET", "/api/v1/admin/export"+tc.query, nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if deviceRepo.Calls.ByUserID != tc.deviceCalls {
+				t.Errorf("incorrect DeviceRepository.ByUserID() call count, want %v got %v",
+					tc.deviceCalls, deviceRepo.Calls.ByUserID)
+			}
+
+			if tc.errMessage != "" {
+				err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+
+			body := rr.Body.String()
+			if strings.Contains(body, "secret") || strings.Contains(body, "public-key") ||
+				strings.Contains(body, "cHVibGljLWtleQ") {
+				t.Error("export contains secrets:", body)
+			}
+
+			var resp exportResponse
+			if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal("failed to decode response:", err)
+			}
+			if len(resp.Users) != tc.userCount {
+				t.Errorf("incorrect user count, want %v got %v", tc.userCount, len(resp.Users))
+			}
+			if resp.NextCursor != tc.nextCursor {
+				t.Errorf("incorrect next cursor, want %s got %s", tc.nextCursor, resp.NextCursor)
+			}
+		})
+	}
+}
+
+func TestAdminAPI_RevokeUserTokens(t *testing.T) {
+	tt := []struct {
+		name           string
+		statusCode     int
+		errMessage     string
+		userFn         func() (*auth.User, error)
+		revokeAllCalls int
+	}{
+		{
+			name:       "Non existent user",
+			statusCode: http.StatusBadRequest,
+			errMessage: "User not found",
+			userFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+			revokeAllCalls: 0,
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			userFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id"}, nil
+			},
+			revokeAllCalls: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			userRepo := &test.UserRepository{ByIdentityFn: tc.userFn}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return userRepo
+				},
+			}
+			tokenSvc := &test.TokenService{
+				RevokeAllFn: func() error {
+					return nil
+				},
+			}
+			svc := NewService(
+				WithRepoManager(repoMngr),
+				WithTokenService(tokenSvc),
+			)
+
+			req, err := http.NewRequest("DELETE", "/api/v1/admin/user/user-id/token", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if tokenSvc.Calls.RevokeAll != tc.revokeAllCalls {
+				t.Errorf("incorrect TokenService.RevokeAll() call count, want %v got %v",
+					tc.revokeAllCalls, tokenSvc.Calls.RevokeAll)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAdminAPI_ImportU2F(t *testing.T) {
+	tt := []struct {
+		name           string
+		statusCode     int
+		errMessage     string
+		body           string
+		userFn         func() (*auth.User, error)
+		importU2FCalls int
+	}{
+		{
+			name:       "No devices",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Devices must contain between 1 and 20 keys",
+			body:       `{"devices":[]}`,
+			userFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id"}, nil
+			},
+		},
+		{
+			name:       "Invalid key handle",
+			statusCode: http.StatusBadRequest,
+			errMessage: "KeyHandle must be websafe base64",
+			body:       `{"devices":[{"keyHandle":"+/+/","publicKey":"BAEC"}]}`,
+			userFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id"}, nil
+			},
+		},
+		{
+			name:       "Non existent user",
+			statusCode: http.StatusBadRequest,
+			errMessage: "User not found",
+			body:       `{"devices":[{"keyHandle":"a2V5LWhhbmRsZQ","publicKey":"BAEC"}]}`,
+			userFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusCreated,
+			body: `{"devices":[
+				{"keyHandle":"a2V5LWhhbmRsZQ==","publicKey":"BAEC","counter":3},
+				{"keyHandle":"b3RoZXIta2V5","publicKey":"BAEC","name":"Backup key"}
+			]}`,
+			userFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id"}, nil
+			},
+			importU2FCalls: 2,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			userRepo := &test.UserRepository{ByIdentityFn: tc.userFn}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return userRepo
+				},
+			}
+			webauthnSvc := &test.WebAuthnService{
+				ImportU2FFn: func() (*auth.Device, error) {
+					return &auth.Device{ID: "device-id"}, nil
+				},
+			}
+			svc := NewService(
+				WithRepoManager(repoMngr),
+				WithWebAuthn(webauthnSvc),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/admin/user/user-id/u2f", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if webauthnSvc.Calls.ImportU2F != tc.importU2FCalls {
+				t.Errorf("incorrect WebAuthnService.ImportU2F() call count, want %v got %v",
+					tc.importU2FCalls, webauthnSvc.Calls.ImportU2F)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestAdminAPI_SignupAbuseStats(t *testing.T) {
+	router := mux.NewRouter()
+	abuse := &test.SignupAbuseDetector{
+		StatsFn: func() (map[string]int64, error) {
+			return map[string]int64{"allowed": 10, "throttled": 2}, nil
+		},
+	}
+	svc := NewService(WithSignupAbuseDetector(abuse))
+
+	req, err := http.NewRequest("GET", "/api/v1/admin/signup-abuse", nil)
+	if err != nil {
+		t.Fatal("failed to create request:", err)
+	}
+	req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+
+	var resp signupAbuseResponse
+	if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal("failed to decode response:", err)
+	}
+	if resp.Outcomes["allowed"] != 10 || resp.Outcomes["throttled"] != 2 {
+		t.Errorf("incorrect outcomes: %v", resp.Outcomes)
+	}
+}
+
+func TestAdminAPI_IPFilter(t *testing.T) {
+	tt := []struct {
+		name       string
+		remoteAddr string
+		statusCode int
+	}{
+		{
+			name:       "Allowed address",
+			remoteAddr: "10.0.0.5:5000",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Denied address",
+			remoteAddr: "203.0.113.5:5000",
+			statusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			svc := NewService(WithSignupAbuseDetector(&test.SignupAbuseDetector{}))
+
+			ipFilter, err := httpapi.NewIPFilter([]string{"10.0.0.0/8"}, nil, nil)
+			if err != nil {
+				t.Fatal("failed to create IP filter:", err)
+			}
+
+			req := httptest.NewRequest("GET", "/api/v1/admin/signup-abuse", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, ipFilter, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+		})
+	}
+}
+
+func TestAdminAPI_Stats(t *testing.T) {
+	tt := []struct {
+		name       string
+		query      string
+		statusCode int
+		errMessage string
+		days       int
+	}{
+		{
+			name:       "Invalid days",
+			query:      "?days=31",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Days must be between 1 and 30",
+		},
+		{
+			name:       "Default days",
+			statusCode: http.StatusOK,
+			days:       7,
+		},
+		{
+			name:       "Requested days",
+			query:      "?days=2",
+			statusCode: http.StatusOK,
+			days:       2,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			today := time.Date(2020, 6, 10, 0, 0, 0, 0, time.UTC)
+			userRepo := &test.UserRepository{
+				CountSignupsFn: func() ([]*auth.DailyCount, error) {
+					return []*auth.DailyCount{{Date: today, Count: 4}}, nil
+				},
+				CountTFAFn: func() (*auth.TFAAdoption, error) {
+					return &auth.TFAAdoption{Users: 10, Email: 8, TOTP: 3}, nil
+				},
+			}
+			loginRepo := &test.LoginHistoryRepository{
+				CountActiveFn: func() (int64, error) {
+					return 12, nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return userRepo
+				},
+				LoginHistoryFn: func() auth.LoginHistoryRepository {
+					return loginRepo
+				},
+			}
+			deliveryStats := &test.DeliveryStatsService{
+				DailyFn: func() ([]*auth.DeliveryStats, error) {
+					return []*auth.DeliveryStats{
+						{
+							Date:     today,
+							Delivery: auth.Email,
+							Outcomes: map[auth.DeliveryOutcome]int64{
+								auth.DeliverySent:   3,
+								auth.DeliveryFailed: 1,
+							},
+						},
+						{
+							Date:     today,
+							Delivery: auth.Phone,
+							Outcomes: map[auth.DeliveryOutcome]int64{},
+						},
+					}, nil
+				},
+			}
+			svc := NewService(
+				WithRepoManager(repoMngr),
+				WithDeliveryStats(deliveryStats),
+			)
+			svc.(*service).now = func() time.Time {
+				return today.Add(time.Hour * 15)
+			}
+
+			req, err := http.NewRequest("GET", "/api/v1/admin/stats"+tc.query, nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Fatalf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+			if tc.statusCode != http.StatusOK {
+				if err = test.ValidateErrMessage(tc.errMessage, rr.Body); err != nil {
+					t.Error(err)
+				}
+				return
+			}
+
+			var resp statsResponse
+			if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal("failed to decode response:", err)
+			}
+
+			if len(resp.Signups) != tc.days {
+				t.Fatalf("incorrect signup days, want %v got %v", tc.days, len(resp.Signups))
+			}
+			last := resp.Signups[len(resp.Signups)-1]
+			if last.Date != "2020-06-10" || last.Count != 4 {
+				t.Errorf("incorrect signups today: %+v", last)
+			}
+			if resp.Signups[0].Count != 0 {
+				t.Errorf("incorrect signups on %s, want 0 got %v", resp.Signups[0].Date, resp.Signups[0].Count)
+			}
+			if resp.ActiveSessions != 12 {
+				t.Errorf("incorrect active sessions, want 12 got %v", resp.ActiveSessions)
+			}
+			if resp.TFAAdoption.Users != 10 || resp.TFAAdoption.TOTP != 3 {
+				t.Errorf("incorrect 2FA adoption: %+v", resp.TFAAdoption)
+			}
+			if len(resp.Deliveries) != 2 {
+				t.Fatalf("incorrect deliveries, want 2 got %v", len(resp.Deliveries))
+			}
+			if rate := resp.Deliveries[0].SuccessRate; rate == nil || *rate != 0.75 {
+				t.Errorf("incorrect email success rate: %v", rate)
+			}
+			if resp.Deliveries[1].SuccessRate != nil {
+				t.Error("success rate should be omitted without attempts")
+			}
+		})
+	}
+}
+
+func TestAdminAPI_ListDeliveries(t *testing.T) {
+	tt := []struct {
+		name       string
+		query      string
+		statusCode int
+		errMessage string
+		address    string
+		limit      int
+	}{
+		{
+			name:       "Missing address",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Address must be an email or phone number",
+		},
+		{
+			name:       "Invalid limit",
+			query:      "?address=jane@example.com&limit=101",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Limit must be between 1 and 100",
+		},
+		{
+			name:       "Email address",
+			query:      "?address=jane@example.com",
+			statusCode: http.StatusOK,
+			address:    "jane@example.com",
+			limit:      20,
+		},
+		{
+			name:       "Phone number is normalized",
+			query:      "?address=%2B1+(415)+555-2671&limit=5",
+			statusCode: http.StatusOK,
+			address:    "+14155552671",
+			limit:      5,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			created := time.Date(2020, 6, 10, 12, 0, 0, 0, time.UTC)
+			deliveryRepo := &test.MessageDeliveryRepository{
+				ByAddressFn: func(address string, limit int) ([]*auth.MessageDelivery, error) {
+					if address != tc.address || limit != tc.limit {
+						t.Errorf("incorrect lookup, want %s/%v got %s/%v", tc.address, tc.limit, address, limit)
+					}
+					return []*auth.MessageDelivery{
+						{
+							ID:        "delivery-id",
+							Type:      auth.OTPLogin,
+							Delivery:  auth.Phone,
+							Address:   address,
+							Status:    auth.MessageFailed,
+							Detail:    "twilio error 30003",
+							CreatedAt: created,
+							UpdatedAt: created,
+						},
+					}, nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				MessageDeliveryFn: func() auth.MessageDeliveryRepository {
+					return deliveryRepo
+				},
+			}
+			svc := NewService(WithRepoManager(repoMngr))
+
+			req, err := http.NewRequest("GET", "/api/v1/admin/delivery"+tc.query, nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Fatalf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+			if tc.statusCode != http.StatusOK {
+				if err = test.ValidateErrMessage(tc.errMessage, rr.Body); err != nil {
+					t.Error(err)
+				}
+				if deliveryRepo.Calls.ByAddress != 0 {
+					t.Error("deliveries should not be retrieved")
+				}
+				return
+			}
+
+			var resp listDeliveryResponse
+			if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal("failed to decode response:", err)
+			}
+			if len(resp.Deliveries) != 1 {
+				t.Fatalf("incorrect deliveries, want 1 got %v", len(resp.Deliveries))
+			}
+			d := resp.Deliveries[0]
+			if d.Status != "failed" || d.Detail != "twilio error 30003" || d.Method != "phone" {
+				t.Errorf("incorrect delivery: %+v", d)
+			}
+		})
+	}
+}
+
+func TestAdminAPI_Job(t *testing.T) {
+	users := []*auth.User{
+		{
+			ID:        "user-1",
+			Password:  "password-hash",
+			Email:     sql.NullString{String: "jane@example.com", Valid: true},
+			CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:        "user-2",
+			Password:  "password-hash",
+			Email:     sql.NullString{String: "john@example.org", Valid: true},
+			CreatedAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	tt := []struct {
+		name           string
+		statusCode     int
+		path           string
+		reqBody        string
+		resetURL       string
+		errMessage     string
+		userFn         func() (*auth.User, error)
+		processed      int
+		failed         int
+		revokeAllCalls int
+		messageCalls   int
+	}{
+		{
+			name:       "Missing targets",
+			statusCode: http.StatusBadRequest,
+			reqBody:    `{"actions": ["revoke_tokens"]}`,
+			errMessage: "Either userIds or a filter must be provided",
+		},
+		{
+			name:       "Invalid action",
+			statusCode: http.StatusBadRequest,
+			reqBody:    `{"actions": ["delete_user"], "userIds": ["user-1"]}`,
+			errMessage: "Actions must be one of expire_password, reset_tfa, revoke_tokens, notify",
+		},
+		{
+			name:       "Password reset disabled",
+			statusCode: http.StatusBadRequest,
+			reqBody:    `{"actions": ["expire_password"], "userIds": ["user-1"]}`,
+			errMessage: "Password reset is disabled",
+		},
+		{
+			name:       "Unknown user ID",
+			statusCode: http.StatusAccepted,
+			reqBody:    `{"actions": ["revoke_tokens"], "userIds": ["user-1"]}`,
+			userFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+			processed:      1,
+			failed:         1,
+			revokeAllCalls: 0,
+		},
+		{
+			name:       "User IDs",
+			statusCode: http.StatusAccepted,
+			reqBody:    `{"actions": ["revoke_tokens"], "userIds": ["user-1", "user-2"]}`,
+			userFn: func() (*auth.User, error) {
+				return users[0], nil
+			},
+			processed:      2,
+			revokeAllCalls: 2,
+		},
+		{
+			name:           "Filter",
+			statusCode:     http.StatusAccepted,
+			reqBody:        `{"actions": ["expire_password", "revoke_tokens"], "filter": {"emailDomain": "example.com"}}`,
+			resetURL:       "https://example.com/reset",
+			processed:      1,
+			revokeAllCalls: 1,
+			messageCalls:   1,
+		},
+		{
+			name:       "Breach mode without password reset",
+			statusCode: http.StatusBadRequest,
+			path:       "/api/v1/admin/breach",
+			reqBody:    `{"userIds": ["user-1"]}`,
+			errMessage: "Password reset is disabled",
+		},
+		{
+			name:       "Breach mode",
+			statusCode: http.StatusAccepted,
+			path:       "/api/v1/admin/breach",
+			reqBody:    `{"userIds": ["user-3"]}`,
+			resetURL:   "https://example.com/reset",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{
+					ID:            "user-3",
+					Password:      "password-hash",
+					TFASecret:     "tfa-secret",
+					IsTOTPAllowed: true,
+					Email:         sql.NullString{String: "jane@example.com", Valid: true},
+				}, nil
+			},
+			processed:      1,
+			revokeAllCalls: 1,
+			messageCalls:   2,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path := tc.path
+			if path == "" {
+				path = "/api/v1/admin/job"
+			}
+
+			router := mux.NewRouter()
+			listCalls := 0
+			userRepo := &test.UserRepository{
+				ByIdentityFn: tc.userFn,
+				ListFn: func() ([]*auth.User, error) {
+					listCalls++
+					if listCalls > 1 {
+						return []*auth.User{}, nil
+					}
+					return users, nil
+				},
+				GetForUpdateFn: func() (*auth.User, error) {
+					return users[0], nil
+				},
+				UpdateFn: func() error {
+					return nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return userRepo
+				},
+				WithAtomicFn: func() (interface{}, error) {
+					return users[0], nil
+				},
+			}
+			tokenSvc := &test.TokenService{
+				RevokeAllFn: func() error {
+					return nil
+				},
+			}
+			actionTokens := &test.ActionTokenService{
+				IssueFn: func() (string, error) {
+					return "reset-token", nil
+				},
+			}
+			messagingSvc := &test.MessagingService{}
+			svc := NewService(
+				WithRepoManager(repoMngr),
+				WithTokenService(tokenSvc),
+				WithDB(memstore.New()),
+				WithPasswordReset(tc.resetURL, actionTokens, messagingSvc),
+			)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, testAdminKey, nil, logger, &httpapi.MockLimiterFactory{})
+
+			req, err := http.NewRequest("POST", path, strings.NewReader(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Fatalf("incorrect status code, want %v got %v: %s", tc.statusCode, rr.Code, rr.Body.String())
+			}
+			if tc.errMessage != "" {
+				if err = test.ValidateErrMessage(tc.errMessage, rr.Body); err != nil {
+					t.Error(err)
+				}
+				return
+			}
+
+			var resp jobResponse
+			if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal("failed to decode response:", err)
+			}
+
+			deadline := time.Now().Add(time.Second * 2)
+			for resp.Job.Status == jobRunning && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond * 10)
+
+				req, err = http.NewRequest("GET", "/api/v1/admin/job/"+resp.Job.ID, nil)
+				if err != nil {
+					t.Fatal("failed to create request:", err)
+				}
+				req.Header.Set("AUTHORIZATION", "Bearer "+testAdminKey)
+
+				rr = httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+				if rr.Code != http.StatusOK {
+					t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+				}
+				if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+					t.Fatal("failed to decode response:", err)
+				}
+			}
+
+			if resp.Job.Status != jobComplete {
+				t.Fatalf("incorrect job status, want %s got %s", jobComplete, resp.Job.Status)
+			}
+			if resp.Job.Processed != tc.processed || resp.Job.Failed != tc.failed {
+				t.Errorf("incorrect job progress, want %v processed %v failed got %v processed %v failed",
+					tc.processed, tc.failed, resp.Job.Processed, resp.Job.Failed)
+			}
+			if resp.Job.Total != tc.processed {
+				t.Errorf("incorrect job total, want %v got %v", tc.processed, resp.Job.Total)
+			}
+			if tokenSvc.Calls.RevokeAll != tc.revokeAllCalls {
+				t.Errorf("incorrect TokenService.RevokeAll() call count, want %v got %v",
+					tc.revokeAllCalls, tokenSvc.Calls.RevokeAll)
+			}
+			if messagingSvc.Calls.Send != tc.messageCalls {
+				t.Errorf("incorrect MessagingService.Send() call count, want %v got %v",
+					tc.messageCalls, messagingSvc.Calls.Send)
+			}
+		})
+	}
+}
+
+func TestAdminAPI_JobShutdown(t *testing.T) {
+	userRepo := &test.UserRepository{
+		ByIdentityFn: func() (*auth.User, error) {
+			return &auth.User{ID: "user-1"}, nil
+		},
+	}
+	repoMngr := &test.RepositoryManager{
+		UserFn: func() auth.UserRepository {
+			return userRepo
+		},
+	}
+
+	var (
+		mu      sync.Mutex
+		revoked int
+	)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	tokenSvc := &test.TokenService{
+		RevokeAllFn: func() error {
+			mu.Lock()
+			revoked++
+			n := revoked
+			mu.Unlock()
+			if n == 1 {
+				panic("revocation failed")
+			}
+			if n == 2 {
+				close(started)
+				<-release
+			}
+			return nil
+		},
+	}
+
+	db := memstore.New()
+	svc := NewService(
+		WithRepoManager(repoMngr),
+		WithTokenService(tokenSvc),
+		WithDB(db),
+	).(*service)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- svc.Run(ctx)
+	}()
+
+	resp, err := svc.startJob(context.Background(), &jobRequest{
+		Actions: []string{actionRevokeTokens},
+		UserIDs: []string{"user-1", "user-2", "user-3"},
+	})
+	if err != nil {
+		t.Fatal("failed to start job:", err)
+	}
+
+	<-started
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("shutdown should wait for running jobs")
+	case <-time.After(time.Millisecond * 50):
+	}
+	close(release)
+	if err = <-done; err != context.Canceled {
+		t.Errorf("incorrect shutdown error, want %v got %v", context.Canceled, err)
+	}
+
+	j, err := svc.loadJob(context.Background(), resp.Job.ID)
+	if err != nil {
+		t.Fatal("failed to load job:", err)
+	}
+	if j.Status != jobFailed || j.Error != "job was interrupted by shutdown" {
+		t.Errorf("incorrect interrupted job: %+v", j)
+	}
+	// The panic fails the first User without stopping the job.
+	if j.Processed != 2 || j.Failed != 1 {
+		t.Errorf("incorrect job progress, want 2 processed 1 failed got %v processed %v failed",
+			j.Processed, j.Failed)
+	}
+
+	_, err = svc.startJob(context.Background(), &jobRequest{
+		Actions: []string{actionRevokeTokens},
+		UserIDs: []string{"user-1"},
+	})
+	if err == nil {
+		t.Error("expected error starting job after shutdown, got nil")
+	}
+}
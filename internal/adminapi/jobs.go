@@ -0,0 +1,478 @@
+package adminapi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
+)
+
+const (
+	// actionExpirePassword expires a User's password and delivers
+	// a link to set a new one.
+	actionExpirePassword = "expire_password"
+	// actionResetTFA removes a User's authenticator app so it must
+	// be enrolled again.
+	actionResetTFA = "reset_tfa"
+	// actionRevokeTokens revokes every logged in session of a User.
+	actionRevokeTokens = "revoke_tokens"
+	// actionNotify alerts a User that their credentials may be
+	// compromised and of the actions taken.
+	actionNotify = "notify"
+
+	jobRunning  = "running"
+	jobComplete = "complete"
+	jobFailed   = "failed"
+
+	// jobExpiry is how long the progress of a job is retained.
+	jobExpiry = time.Hour * 24
+	// jobPageSize is the number of Users processed between
+	// progress updates.
+	jobPageSize = 100
+	// maxJobUserIDs is the number of User IDs a job may list.
+	maxJobUserIDs = 10000
+)
+
+// jobActions are the actions a job may apply, in the order they
+// are applied.
+var jobActions = []string{actionExpirePassword, actionResetTFA, actionRevokeTokens, actionNotify}
+
+// rediser is a minimal interface for go-redis.
+type rediser interface {
+	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
+	HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+}
+
+// job is the progress of a bulk action against a set of Users.
+type job struct {
+	ID          string
+	Actions     []string
+	Status      string
+	Total       int
+	Processed   int
+	Failed      int
+	Error       string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	CompletedAt time.Time
+}
+
+// CreateJob starts a bulk action against a list of User IDs or every
+// User matching a filter, e.g. to force password resets and revoke
+// sessions in response to a breach. Jobs run in the background and
+// their progress is retrieved with GetJob.
+func (s *service) CreateJob(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if s.db == nil {
+		return nil, auth.ErrForbidden("bulk jobs are disabled")
+	}
+
+	req, err := decodeJobRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startJob(r.Context(), req)
+}
+
+// GetJob returns the progress of a bulk job.
+func (s *service) GetJob(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if s.db == nil {
+		return nil, auth.ErrForbidden("bulk jobs are disabled")
+	}
+
+	j, err := s.loadJob(r.Context(), mux.Vars(r)["jobID"])
+	if err != nil {
+		return nil, err
+	}
+
+	resp := jobResponse{}
+	resp.Create(j)
+	return resp, nil
+}
+
+// Run waits until ctx is cancelled, then interrupts running jobs and
+// returns once they are marked failed. Jobs are not started once ctx
+// is cancelled.
+func (s *service) Run(ctx context.Context) error {
+	<-ctx.Done()
+
+	s.jobMu.Lock()
+	s.stopJobs()
+	s.jobMu.Unlock()
+
+	s.jobs.Wait()
+	return ctx.Err()
+}
+
+// startJob stores a new job and runs it in the background.
+func (s *service) startJob(ctx context.Context, req *jobRequest) (*jobResponse, error) {
+	// Jobs are registered while holding the lock so Run does not
+	// return before every started job is interrupted.
+	s.jobMu.Lock()
+	defer s.jobMu.Unlock()
+
+	if s.jobCtx.Err() != nil {
+		return nil, auth.ErrForbidden("bulk jobs are stopped for shutdown")
+	}
+	if req.hasAction(actionExpirePassword) && (s.passwordResetURL == "" || s.actionTokens == nil) {
+		return nil, auth.ErrBadRequest("password reset is disabled")
+	}
+	if req.hasAction(actionNotify) && s.message == nil {
+		return nil, auth.ErrBadRequest("messaging is disabled")
+	}
+
+	id, err := crypto.String(32, "0123456789abcdefghijklmnopqrstuvwxyz")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create job ID: %w", err)
+	}
+
+	now := s.now()
+	j := &job{
+		ID:        id,
+		Actions:   req.Actions,
+		Status:    jobRunning,
+		Total:     len(req.UserIDs),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err = s.saveJob(ctx, j); err != nil {
+		return nil, err
+	}
+
+	level.Info(s.logger).Log(
+		"source", "AdminAPI",
+		"audit", "job_created",
+		"job_id", j.ID,
+		"actions", strings.Join(j.Actions, ","),
+		"user_ids", len(req.UserIDs),
+	)
+
+	resp := jobResponse{}
+	resp.Create(j)
+
+	// Jobs outlive the request which created them.
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		s.runJob(s.jobCtx, j, req)
+	}()
+
+	return &resp, nil
+}
+
+// runJob applies a job's actions to every targeted User, saving its
+// progress after each page of Users. Jobs interrupted by ctx are
+// marked failed.
+func (s *service) runJob(ctx context.Context, j *job, req *jobRequest) {
+	err := s.eachTarget(ctx, req, func(users []*auth.User, notFound []string) error {
+		for _, userID := range notFound {
+			j.Failed++
+			j.Processed++
+			level.Error(s.logger).Log(
+				"source", "AdminAPI.CreateJob",
+				"message", "bulk action failed",
+				"job_id", j.ID,
+				"user_id", userID,
+				"error", "user not found",
+			)
+		}
+		for _, user := range users {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := s.applyUser(ctx, user, j.Actions); err != nil {
+				j.Failed++
+				level.Error(s.logger).Log(
+					"source", "AdminAPI.CreateJob",
+					"message", "bulk action failed",
+					"job_id", j.ID,
+					"user_id", user.ID,
+					"error", err,
+				)
+			}
+			j.Processed++
+		}
+		j.UpdatedAt = s.now()
+		return s.saveJob(ctx, j)
+	})
+
+	j.Status = jobComplete
+	if err != nil {
+		j.Status = jobFailed
+		j.Error = err.Error()
+	}
+	if ctx.Err() != nil {
+		j.Error = "job was interrupted by shutdown"
+	}
+	if len(req.UserIDs) == 0 {
+		j.Total = j.Processed
+	}
+	j.UpdatedAt = s.now()
+	j.CompletedAt = j.UpdatedAt
+
+	// The final progress is saved even if the job was interrupted.
+	if err = s.saveJob(context.Background(), j); err != nil {
+		level.Error(s.logger).Log(
+			"source", "AdminAPI.CreateJob",
+			"message", "failed to save job",
+			"job_id", j.ID,
+			"error", err,
+		)
+	}
+
+	level.Info(s.logger).Log(
+		"source", "AdminAPI",
+		"audit", "job_completed",
+		"job_id", j.ID,
+		"status", j.Status,
+		"processed", j.Processed,
+		"failed", j.Failed,
+	)
+}
+
+// eachTarget calls fn with pages of Users targeted by a job. Users
+// are either listed by ID or matched against a filter. Listed IDs
+// which do not belong to a User are passed to fn as not found.
+func (s *service) eachTarget(ctx context.Context, req *jobRequest, fn func([]*auth.User, []string) error) error {
+	if len(req.UserIDs) > 0 {
+		for i := 0; i < len(req.UserIDs); i += jobPageSize {
+			end := i + jobPageSize
+			if end > len(req.UserIDs) {
+				end = len(req.UserIDs)
+			}
+
+			var (
+				users    []*auth.User
+				notFound []string
+			)
+			for _, userID := range req.UserIDs[i:end] {
+				user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+				if err == sql.ErrNoRows {
+					notFound = append(notFound, userID)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				users = append(users, user)
+			}
+
+			if err := fn(users, notFound); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var cursor string
+	for {
+		users, err := s.repoMngr.User().List(ctx, cursor, jobPageSize)
+		if err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			return nil
+		}
+		cursor = users[len(users)-1].ID
+
+		matched := make([]*auth.User, 0, len(users))
+		for _, user := range users {
+			if req.Filter.matches(user) {
+				matched = append(matched, user)
+			}
+		}
+		if len(matched) > 0 {
+			if err = fn(matched, nil); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// applyUser applies a job's actions to a User, recovering from a
+// panic so it fails the User rather than the job.
+func (s *service) applyUser(ctx context.Context, user *auth.User, actions []string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return s.applyActions(ctx, user, actions)
+}
+
+// applyActions applies a job's actions to a User in the order of
+// jobActions, so Users are notified once every other action is
+// complete.
+func (s *service) applyActions(ctx context.Context, user *auth.User, actions []string) error {
+	var changes []string
+	for _, action := range jobActions {
+		if !containsAction(actions, action) {
+			continue
+		}
+
+		var (
+			changed bool
+			err     error
+		)
+		switch action {
+		case actionExpirePassword:
+			changed, err = s.expirePassword(ctx, user)
+		case actionResetTFA:
+			changed, err = s.resetTFA(ctx, user)
+		case actionRevokeTokens:
+			changed, err = true, s.token.RevokeAll(ctx, user.ID)
+		case actionNotify:
+			err = s.notifyBreach(ctx, user, changes)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", action, err)
+		}
+		if changed {
+			changes = append(changes, action)
+		}
+	}
+
+	return nil
+}
+
+// expirePassword requires a User to set a new password before they may
+// login with a password again and delivers a link to do so. Users
+// without a password are unaffected.
+func (s *service) expirePassword(ctx context.Context, user *auth.User) (bool, error) {
+	if user.Password == "" {
+		return false, nil
+	}
+
+	client, err := s.repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = client.WithAtomic(func() (interface{}, error) {
+		user, err := client.User().GetForUpdate(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		user.IsPasswordExpired = true
+		if err = client.User().Update(ctx, user); err != nil {
+			return nil, fmt.Errorf("cannot expire password: %w", err)
+		}
+
+		return user, nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	resetToken, err := s.actionTokens.Issue(ctx, user.ID, auth.PurposeResetPassword, nil)
+	if err != nil {
+		return false, err
+	}
+
+	link, err := url.Parse(s.passwordResetURL)
+	if err != nil {
+		return false, fmt.Errorf("invalid password reset URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", resetToken)
+	link.RawQuery = query.Encode()
+
+	msg := &auth.Message{
+		Type:     auth.PasswordReset,
+		Delivery: auth.Email,
+		Address:  user.Email.String,
+		Vars:     map[string]string{"link": link.String()},
+	}
+	if user.Email.String == "" {
+		msg.Delivery = auth.Phone
+		msg.Address = user.Phone.String
+	}
+
+	return true, s.message.Send(ctx, msg)
+}
+
+// saveJob stores the progress of a job.
+func (s *service) saveJob(ctx context.Context, j *job) error {
+	values := []interface{}{
+		"actions", strings.Join(j.Actions, ","),
+		"status", j.Status,
+		"total", j.Total,
+		"processed", j.Processed,
+		"failed", j.Failed,
+		"error", j.Error,
+		"created_at", j.CreatedAt.Unix(),
+		"updated_at", j.UpdatedAt.Unix(),
+	}
+	if !j.CompletedAt.IsZero() {
+		values = append(values, "completed_at", j.CompletedAt.Unix())
+	}
+
+	if err := s.db.HSet(ctx, JobKey(j.ID), values...).Err(); err != nil {
+		return fmt.Errorf("cannot save job: %w", err)
+	}
+	if err := s.db.Expire(ctx, JobKey(j.ID), jobExpiry).Err(); err != nil {
+		return fmt.Errorf("cannot expire job: %w", err)
+	}
+	return nil
+}
+
+// loadJob retrieves the progress of a job.
+func (s *service) loadJob(ctx context.Context, jobID string) (*job, error) {
+	fields, err := s.db.HGetAll(ctx, JobKey(jobID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve job: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, auth.ErrNotFound("job not found")
+	}
+
+	unix := func(field string) time.Time {
+		sec, err := strconv.ParseInt(fields[field], 10, 64)
+		if err != nil || sec == 0 {
+			return time.Time{}
+		}
+		return time.Unix(sec, 0).UTC()
+	}
+
+	j := &job{
+		ID:          jobID,
+		Actions:     strings.Split(fields["actions"], ","),
+		Status:      fields["status"],
+		Error:       fields["error"],
+		CreatedAt:   unix("created_at"),
+		UpdatedAt:   unix("updated_at"),
+		CompletedAt: unix("completed_at"),
+	}
+	j.Total, _ = strconv.Atoi(fields["total"])
+	j.Processed, _ = strconv.Atoi(fields["processed"])
+	j.Failed, _ = strconv.Atoi(fields["failed"])
+
+	return j, nil
+}
+
+// JobKey is the key holding the progress of a bulk job.
+func JobKey(jobID string) string {
+	return fmt.Sprintf("%s_admin_job", jobID)
+}
+
+func containsAction(actions []string, action string) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,495 @@
+package adminapi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+type canaryRequest struct {
+	Identity string `json:"identity"`
+	Note     string `json:"note"`
+}
+
+// UserAttribute returns the User attribute matching the
+// canary's identity.
+func (r *canaryRequest) UserAttribute() string {
+	if contactchecker.IsEmailValid(r.Identity) {
+		return "Email"
+	}
+	return "Phone"
+}
+
+type jobFilter struct {
+	CreatedAfter  time.Time `json:"createdAfter"`
+	CreatedBefore time.Time `json:"createdBefore"`
+	EmailDomain   string    `json:"emailDomain"`
+}
+
+// isEmpty reports whether a filter has no criteria. Empty filters
+// are rejected so a job may not target every User by mistake.
+func (f *jobFilter) isEmpty() bool {
+	return f.CreatedAfter.IsZero() && f.CreatedBefore.IsZero() && f.EmailDomain == ""
+}
+
+// matches reports whether a User meets every criterion of a filter.
+func (f *jobFilter) matches(user *auth.User) bool {
+	if !f.CreatedAfter.IsZero() && !user.CreatedAt.After(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !user.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	if f.EmailDomain != "" {
+		at := strings.LastIndex(user.Email.String, "@")
+		if at < 0 || !strings.EqualFold(user.Email.String[at+1:], f.EmailDomain) {
+			return false
+		}
+	}
+	return true
+}
+
+type jobRequest struct {
+	Actions []string   `json:"actions"`
+	UserIDs []string   `json:"userIds"`
+	Filter  *jobFilter `json:"filter"`
+}
+
+func (r *jobRequest) hasAction(action string) bool {
+	return containsAction(r.Actions, action)
+}
+
+func decodeCanaryRequest(r *http.Request) (*canaryRequest, error) {
+	var (
+		req canaryRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	req.Identity = strings.TrimSpace(req.Identity)
+	req.Note = strings.TrimSpace(req.Note)
+
+	if !contactchecker.IsEmailValid(req.Identity) && !contactchecker.IsPhoneValid(req.Identity) {
+		return nil, auth.ErrInvalidField("identity must be an email or phone number")
+	}
+	// Canaries are matched by the same normalized phone numbers and
+	// canonical emails as Users, so aliases of a decoy email trip it.
+	if req.UserAttribute() == "Phone" {
+		req.Identity = contactchecker.NormalizePhone(req.Identity)
+	} else {
+		req.Identity = contactchecker.CanonicalEmail(req.Identity)
+	}
+
+	return &req, nil
+}
+
+type featureRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func decodeJobRequest(r *http.Request) (*jobRequest, error) {
+	var (
+		req jobRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	if len(req.Actions) == 0 {
+		return nil, auth.ErrInvalidField("actions cannot be empty")
+	}
+	for _, action := range req.Actions {
+		if !containsAction(jobActions, action) {
+			return nil, auth.ErrInvalidField("actions must be one of " + strings.Join(jobActions, ", "))
+		}
+	}
+
+	return validateJobTargets(&req)
+}
+
+func decodeBreachRequest(r *http.Request) (*jobRequest, error) {
+	var (
+		req jobRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	req.Actions = jobActions
+
+	return validateJobTargets(&req)
+}
+
+// validateJobTargets checks a job targets either a list of User IDs
+// or a filter.
+func validateJobTargets(req *jobRequest) (*jobRequest, error) {
+	hasFilter := req.Filter != nil && !req.Filter.isEmpty()
+	if len(req.UserIDs) == 0 && !hasFilter {
+		return nil, auth.ErrInvalidField("either userIds or a filter must be provided")
+	}
+	if len(req.UserIDs) > 0 && req.Filter != nil {
+		return nil, auth.ErrInvalidField("either userIds or a filter must be provided, not both")
+	}
+	if len(req.UserIDs) > maxJobUserIDs {
+		return nil, auth.ErrInvalidField(fmt.Sprintf("userIds cannot exceed %v", maxJobUserIDs))
+	}
+	if hasFilter {
+		req.Filter.EmailDomain = strings.TrimPrefix(strings.TrimSpace(req.Filter.EmailDomain), "@")
+	}
+
+	return req, nil
+}
+
+func decodeFeatureRequest(r *http.Request) (*featureRequest, error) {
+	var (
+		req featureRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	if req.Enabled == nil {
+		return nil, auth.ErrInvalidField("enabled must be provided")
+	}
+
+	return &req, nil
+}
+
+const (
+	defaultExportLimit = 100
+	maxExportLimit     = 500
+)
+
+type exportRequest struct {
+	Cursor string
+	Limit  int
+}
+
+func decodeExportRequest(r *http.Request) (*exportRequest, error) {
+	req := exportRequest{
+		Cursor: r.URL.Query().Get("cursor"),
+		Limit:  defaultExportLimit,
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxExportLimit {
+			return nil, auth.ErrInvalidField(
+				fmt.Sprintf("limit must be between 1 and %v", maxExportLimit),
+			)
+		}
+		req.Limit = n
+	}
+
+	return &req, nil
+}
+
+const (
+	defaultStatsDays = 7
+	maxStatsDays     = 30
+)
+
+type statsRequest struct {
+	Days int
+}
+
+func decodeStatsRequest(r *http.Request) (*statsRequest, error) {
+	req := statsRequest{Days: defaultStatsDays}
+
+	if days := r.URL.Query().Get("days"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 || n > maxStatsDays {
+			return nil, auth.ErrInvalidField(
+				fmt.Sprintf("days must be between 1 and %v", maxStatsDays),
+			)
+		}
+		req.Days = n
+	}
+
+	return &req, nil
+}
+
+const (
+	defaultDeliveryLimit = 20
+	maxDeliveryLimit     = 100
+)
+
+type deliveryRequest struct {
+	Address string
+	Limit   int
+}
+
+func decodeDeliveryRequest(r *http.Request) (*deliveryRequest, error) {
+	req := deliveryRequest{Limit: defaultDeliveryLimit}
+
+	address := r.URL.Query().Get("address")
+	switch {
+	case contactchecker.IsEmailValid(address):
+		req.Address = contactchecker.Normalize(auth.Email, address)
+	case contactchecker.IsPhoneValid(address):
+		req.Address = contactchecker.Normalize(auth.Phone, address)
+	default:
+		return nil, auth.ErrInvalidField("address must be an email or phone number")
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxDeliveryLimit {
+			return nil, auth.ErrInvalidField(
+				fmt.Sprintf("limit must be between 1 and %v", maxDeliveryLimit),
+			)
+		}
+		req.Limit = n
+	}
+
+	return &req, nil
+}
+
+type clientRequest struct {
+	Name               string        `json:"name"`
+	AllowedOrigins     []string      `json:"allowedOrigins"`
+	TokenExpiry        string        `json:"tokenExpiry"`
+	RefreshTokenExpiry string        `json:"refreshTokenExpiry"`
+	RequiredTFA        auth.TFALevel `json:"requiredTFA"`
+	LogoutURL          string        `json:"logoutURL"`
+	Audiences          []string      `json:"audiences"`
+	Scopes             []string      `json:"scopes"`
+
+	tokenExpiry        time.Duration
+	refreshTokenExpiry time.Duration
+}
+
+// ClientApplication returns the ClientApplication described
+// by the request.
+func (r *clientRequest) ClientApplication() *auth.ClientApplication {
+	return &auth.ClientApplication{
+		Name:               r.Name,
+		AllowedOrigins:     r.AllowedOrigins,
+		TokenExpiry:        r.tokenExpiry,
+		RefreshTokenExpiry: r.refreshTokenExpiry,
+		RequiredTFA:        r.RequiredTFA,
+		LogoutURL:          r.LogoutURL,
+		Audiences:          r.Audiences,
+		Scopes:             r.Scopes,
+	}
+}
+
+func decodeClientRequest(r *http.Request) (*clientRequest, error) {
+	var (
+		req clientRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, auth.ErrInvalidField("name cannot be blank")
+	}
+	if len(req.Name) > 255 {
+		return nil, auth.ErrInvalidField("name cannot exceed 255 characters")
+	}
+
+	for _, origin := range req.AllowedOrigins {
+		if !isOriginValid(origin) {
+			return nil, auth.ErrInvalidField(fmt.Sprintf("origin %s is invalid", origin))
+		}
+	}
+
+	for _, aud := range req.Audiences {
+		if strings.TrimSpace(aud) == "" {
+			return nil, auth.ErrInvalidField("audiences cannot be blank")
+		}
+	}
+	for _, scope := range req.Scopes {
+		if strings.TrimSpace(scope) == "" {
+			return nil, auth.ErrInvalidField("scopes cannot be blank")
+		}
+	}
+
+	if req.LogoutURL != "" && !isURLValid(req.LogoutURL) {
+		return nil, auth.ErrInvalidField("logoutURL must be an HTTP or HTTPS URL")
+	}
+
+	if req.tokenExpiry, err = parseExpiry(req.TokenExpiry); err != nil {
+		return nil, auth.ErrInvalidField("tokenExpiry must be a positive duration")
+	}
+	if req.refreshTokenExpiry, err = parseExpiry(req.RefreshTokenExpiry); err != nil {
+		return nil, auth.ErrInvalidField("refreshTokenExpiry must be a positive duration")
+	}
+
+	if req.RequiredTFA == "" {
+		req.RequiredTFA = auth.TFALevelOTP
+	}
+	switch req.RequiredTFA {
+	case auth.TFALevelOTP, auth.TFALevelTOTP, auth.TFALevelDevice:
+	default:
+		return nil, auth.ErrInvalidField("requiredTFA must be otp, totp or device")
+	}
+
+	return &req, nil
+}
+
+// isOriginValid checks an origin consists of only a scheme and host
+// as sent by browsers in the Origin header.
+func isOriginValid(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	isHTTP := u.Scheme == "http" || u.Scheme == "https"
+	return isHTTP && u.Host != "" && u.Path == "" && u.RawQuery == "" && u.User == nil
+}
+
+// isURLValid checks a URL is an absolute HTTP or HTTPS URL.
+func isURLValid(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// parseExpiry parses an optional expiry. An empty value defers
+// to the service defaults.
+func parseExpiry(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("expiry must be positive")
+	}
+
+	return d, nil
+}
+
+// maxU2FImport is the maximum number of keys imported per request.
+const maxU2FImport = 20
+
+// defaultU2FName is the name of imported keys without a name.
+const defaultU2FName = "Security key"
+
+type u2fRegistration struct {
+	KeyHandle string `json:"keyHandle"`
+	PublicKey string `json:"publicKey"`
+	Counter   uint32 `json:"counter"`
+	Name      string `json:"name"`
+}
+
+type u2fImportRequest struct {
+	Devices []u2fRegistration `json:"devices"`
+
+	registrations []*auth.U2FRegistration
+}
+
+// Registrations returns the decoded U2F registrations of the request.
+func (r *u2fImportRequest) Registrations() []*auth.U2FRegistration {
+	return r.registrations
+}
+
+func decodeU2FImportRequest(r *http.Request) (*u2fImportRequest, error) {
+	var (
+		req u2fImportRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	if len(req.Devices) == 0 || len(req.Devices) > maxU2FImport {
+		return nil, auth.ErrInvalidField(
+			fmt.Sprintf("devices must contain between 1 and %v keys", maxU2FImport),
+		)
+	}
+
+	for _, d := range req.Devices {
+		keyHandle, err := decodeWebsafe(d.KeyHandle)
+		if err != nil || len(keyHandle) == 0 {
+			return nil, auth.ErrInvalidField("keyHandle must be websafe base64")
+		}
+		publicKey, err := decodeWebsafe(d.PublicKey)
+		if err != nil || len(publicKey) == 0 {
+			return nil, auth.ErrInvalidField("publicKey must be websafe base64")
+		}
+
+		name := strings.TrimSpace(d.Name)
+		if name == "" {
+			name = defaultU2FName
+		}
+		if len(name) > 255 {
+			return nil, auth.ErrInvalidField("name cannot exceed 255 characters")
+		}
+
+		req.registrations = append(req.registrations, &auth.U2FRegistration{
+			KeyHandle: keyHandle,
+			PublicKey: publicKey,
+			Counter:   d.Counter,
+			Name:      name,
+		})
+	}
+
+	return &req, nil
+}
+
+// decodeWebsafe decodes websafe base64 as used by FIDO U2F,
+// with or without padding.
+func decodeWebsafe(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
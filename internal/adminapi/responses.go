@@ -0,0 +1,403 @@
+package adminapi
+
+import (
+	"sort"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const dateFormat = "2006-01-02"
+
+// canaryItem is the response format for authenticator.Canary.
+type canaryItem struct {
+	Identity  string    `json:"identity"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// canaryResponse is a success response for a single Canary.
+type canaryResponse struct {
+	Canary canaryItem `json:"canary"`
+}
+
+// listCanaryResponse is a success response for AdminAPI.ListCanaries.
+type listCanaryResponse struct {
+	Canaries []canaryItem `json:"canaries"`
+}
+
+// clientItem is the response format for authenticator.ClientApplication.
+type clientItem struct {
+	ID                 string        `json:"id"`
+	Name               string        `json:"name"`
+	AllowedOrigins     []string      `json:"allowedOrigins"`
+	TokenExpiry        string        `json:"tokenExpiry,omitempty"`
+	RefreshTokenExpiry string        `json:"refreshTokenExpiry,omitempty"`
+	RequiredTFA        auth.TFALevel `json:"requiredTFA"`
+	LogoutURL          string        `json:"logoutURL,omitempty"`
+	Audiences          []string      `json:"audiences"`
+	Scopes             []string      `json:"scopes"`
+	CreatedAt          time.Time     `json:"createdAt"`
+}
+
+// clientResponse is a success response for a single ClientApplication.
+type clientResponse struct {
+	Client clientItem `json:"client"`
+}
+
+// listClientResponse is a success response for AdminAPI.ListClients.
+type listClientResponse struct {
+	Clients []clientItem `json:"clients"`
+}
+
+// featureResponse is the response format for a single feature flag.
+type featureResponse struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// listFeatureResponse is a success response for AdminAPI.ListFeatures.
+type listFeatureResponse struct {
+	Features []featureResponse `json:"features"`
+}
+
+// signupAbuseResponse is a success response for AdminAPI.SignupAbuseStats.
+type signupAbuseResponse struct {
+	Outcomes map[string]int64 `json:"outcomes"`
+}
+
+// dailyCountItem is the response format for authenticator.DailyCount.
+type dailyCountItem struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// tfaAdoptionItem is the response format for authenticator.TFAAdoption.
+type tfaAdoptionItem struct {
+	Users  int64 `json:"users"`
+	Email  int64 `json:"email"`
+	Phone  int64 `json:"phone"`
+	TOTP   int64 `json:"totp"`
+	Device int64 `json:"device"`
+}
+
+// deliveryItem is the response format for authenticator.DeliveryStats.
+// SuccessRate is omitted on days without delivery attempts.
+type deliveryItem struct {
+	Date        string   `json:"date"`
+	Method      string   `json:"method"`
+	Sent        int64    `json:"sent"`
+	Failed      int64    `json:"failed"`
+	Expired     int64    `json:"expired"`
+	SuccessRate *float64 `json:"successRate,omitempty"`
+}
+
+// statsResponse is a success response for AdminAPI.Stats.
+type statsResponse struct {
+	Signups        []dailyCountItem `json:"signups"`
+	ActiveSessions int64            `json:"activeSessions"`
+	TFAAdoption    tfaAdoptionItem  `json:"tfaAdoption"`
+	Deliveries     []deliveryItem   `json:"deliveries"`
+}
+
+// messageDeliveryItem is the response format for
+// authenticator.MessageDelivery.
+type messageDeliveryItem struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Method    string    `json:"method"`
+	Address   string    `json:"address"`
+	Status    string    `json:"status"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// listDeliveryResponse is a success response for AdminAPI.ListDeliveries.
+type listDeliveryResponse struct {
+	Deliveries []messageDeliveryItem `json:"deliveries"`
+}
+
+// exportDevice is the export format for authenticator.Device.
+// Credentials are excluded.
+type exportDevice struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	AAGUID         []byte    `json:"aaguid"`
+	SignCount      uint32    `json:"signCount"`
+	BackupEligible bool      `json:"backupEligible"`
+	BackedUp       bool      `json:"backedUp"`
+	Model          string    `json:"model"`
+	MetadataStatus string    `json:"metadataStatus"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// importU2FResponse is a success response for AdminAPI.ImportU2F.
+type importU2FResponse struct {
+	Devices []exportDevice `json:"devices"`
+}
+
+// exportUser is the export format for authenticator.User.
+// Password hashes and TOTP secrets are excluded.
+type exportUser struct {
+	ID                string         `json:"id"`
+	Email             string         `json:"email"`
+	Phone             string         `json:"phone"`
+	HasPassword       bool           `json:"hasPassword"`
+	IsVerified        bool           `json:"isVerified"`
+	IsEmailOTPAllowed bool           `json:"isEmailOTPAllowed"`
+	IsPhoneOTPAllowed bool           `json:"isPhoneOTPAllowed"`
+	IsTOTPAllowed     bool           `json:"isTOTPAllowed"`
+	IsDeviceAllowed   bool           `json:"isDeviceAllowed"`
+	Devices           []exportDevice `json:"devices"`
+	CreatedAt         time.Time      `json:"createdAt"`
+	UpdatedAt         time.Time      `json:"updatedAt"`
+}
+
+// exportResponse is a success response for AdminAPI.ExportUsers.
+type exportResponse struct {
+	Users      []exportUser `json:"users"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// removeResponse is a success response for AdminAPI.RemoveCanary
+// and AdminAPI.RemoveClient.
+type removeResponse struct {
+	Result string `json:"result"`
+}
+
+// Create populates a canaryResponse with a Canary.
+func (r *canaryResponse) Create(c *auth.Canary) {
+	r.Canary = canaryItem{
+		Identity:  c.Identity,
+		Note:      c.Note,
+		CreatedAt: c.CreatedAt,
+	}
+}
+
+// Create populates a listCanaryResponse with a list of Canaries.
+func (r *listCanaryResponse) Create(canaries []*auth.Canary) {
+	items := []canaryItem{}
+	for _, c := range canaries {
+		items = append(items, canaryItem{
+			Identity:  c.Identity,
+			Note:      c.Note,
+			CreatedAt: c.CreatedAt,
+		})
+	}
+	r.Canaries = items
+}
+
+// Create populates a clientResponse with a ClientApplication.
+func (r *clientResponse) Create(c *auth.ClientApplication) {
+	r.Client = newClientItem(c)
+}
+
+// Create populates a listClientResponse with a list of ClientApplications.
+func (r *listClientResponse) Create(clients []*auth.ClientApplication) {
+	items := []clientItem{}
+	for _, c := range clients {
+		items = append(items, newClientItem(c))
+	}
+	r.Clients = items
+}
+
+func newClientItem(c *auth.ClientApplication) clientItem {
+	item := clientItem{
+		ID:             c.ID,
+		Name:           c.Name,
+		AllowedOrigins: c.AllowedOrigins,
+		RequiredTFA:    c.RequiredTFA,
+		LogoutURL:      c.LogoutURL,
+		Audiences:      c.Audiences,
+		Scopes:         c.Scopes,
+		CreatedAt:      c.CreatedAt,
+	}
+	if item.AllowedOrigins == nil {
+		item.AllowedOrigins = []string{}
+	}
+	if item.Audiences == nil {
+		item.Audiences = []string{}
+	}
+	if item.Scopes == nil {
+		item.Scopes = []string{}
+	}
+	if c.TokenExpiry > 0 {
+		item.TokenExpiry = c.TokenExpiry.String()
+	}
+	if c.RefreshTokenExpiry > 0 {
+		item.RefreshTokenExpiry = c.RefreshTokenExpiry.String()
+	}
+	return item
+}
+
+// Create populates a listFeatureResponse with the state of each
+// feature flag, sorted by name.
+func (r *listFeatureResponse) Create(features map[auth.Feature]bool) {
+	items := []featureResponse{}
+	for f, enabled := range features {
+		items = append(items, featureResponse{
+			Name:    string(f),
+			Enabled: enabled,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Name < items[j].Name
+	})
+	r.Features = items
+}
+
+// Create populates a statsResponse. Days without signups are
+// reported with a count of 0.
+func (r *statsResponse) Create(since time.Time, days int, signups []*auth.DailyCount,
+	adoption *auth.TFAAdoption, deliveries []*auth.DeliveryStats) {
+	counts := make(map[string]int64, len(signups))
+	for _, c := range signups {
+		counts[c.Date.Format(dateFormat)] = c.Count
+	}
+
+	r.Signups = make([]dailyCountItem, 0, days)
+	for i := 0; i < days; i++ {
+		date := since.AddDate(0, 0, i).Format(dateFormat)
+		r.Signups = append(r.Signups, dailyCountItem{Date: date, Count: counts[date]})
+	}
+
+	r.TFAAdoption = tfaAdoptionItem{
+		Users:  adoption.Users,
+		Email:  adoption.Email,
+		Phone:  adoption.Phone,
+		TOTP:   adoption.TOTP,
+		Device: adoption.Device,
+	}
+
+	r.Deliveries = make([]deliveryItem, 0, len(deliveries))
+	for _, d := range deliveries {
+		item := deliveryItem{
+			Date:    d.Date.Format(dateFormat),
+			Method:  string(d.Delivery),
+			Sent:    d.Outcomes[auth.DeliverySent],
+			Failed:  d.Outcomes[auth.DeliveryFailed],
+			Expired: d.Outcomes[auth.DeliveryExpired],
+		}
+		if attempts := item.Sent + item.Failed + item.Expired; attempts > 0 {
+			rate := float64(item.Sent) / float64(attempts)
+			item.SuccessRate = &rate
+		}
+		r.Deliveries = append(r.Deliveries, item)
+	}
+}
+
+// Create populates an exportResponse with Users and their Devices.
+func (r *exportResponse) Create(users []*auth.User, devices map[string][]*auth.Device) {
+	items := []exportUser{}
+	for _, u := range users {
+		userDevices := []exportDevice{}
+		for _, d := range devices[u.ID] {
+			userDevices = append(userDevices, exportDevice{
+				ID:             d.ID,
+				Name:           d.Name,
+				AAGUID:         d.AAGUID,
+				SignCount:      d.SignCount,
+				BackupEligible: d.BackupEligible,
+				BackedUp:       d.BackedUp,
+				Model:          d.Model,
+				MetadataStatus: d.MetadataStatus,
+				CreatedAt:      d.CreatedAt,
+				UpdatedAt:      d.UpdatedAt,
+			})
+		}
+
+		items = append(items, exportUser{
+			ID:                u.ID,
+			Email:             u.Email.String,
+			Phone:             u.Phone.String,
+			HasPassword:       u.Password != "",
+			IsVerified:        u.IsVerified,
+			IsEmailOTPAllowed: u.IsEmailOTPAllowed,
+			IsPhoneOTPAllowed: u.IsPhoneOTPAllowed,
+			IsTOTPAllowed:     u.IsTOTPAllowed,
+			IsDeviceAllowed:   u.IsDeviceAllowed,
+			Devices:           userDevices,
+			CreatedAt:         u.CreatedAt,
+			UpdatedAt:         u.UpdatedAt,
+		})
+	}
+	r.Users = items
+}
+
+// Create populates a listDeliveryResponse with MessageDeliveries.
+func (r *listDeliveryResponse) Create(deliveries []*auth.MessageDelivery) {
+	r.Deliveries = make([]messageDeliveryItem, 0, len(deliveries))
+	for _, d := range deliveries {
+		r.Deliveries = append(r.Deliveries, messageDeliveryItem{
+			ID:        d.ID,
+			Type:      string(d.Type),
+			Method:    string(d.Delivery),
+			Address:   d.Address,
+			Status:    string(d.Status),
+			Detail:    d.Detail,
+			CreatedAt: d.CreatedAt,
+			UpdatedAt: d.UpdatedAt,
+		})
+	}
+}
+
+type revokeResponse struct {
+	Result string `json:"result"`
+}
+
+// Create populates an importU2FResponse with imported Devices.
+func (r *importU2FResponse) Create(devices []*auth.Device) {
+	items := []exportDevice{}
+	for _, d := range devices {
+		items = append(items, exportDevice{
+			ID:        d.ID,
+			Name:      d.Name,
+			AAGUID:    d.AAGUID,
+			SignCount: d.SignCount,
+			CreatedAt: d.CreatedAt,
+			UpdatedAt: d.UpdatedAt,
+		})
+	}
+	r.Devices = items
+}
+
+// jobItem is the response format for the progress of a bulk job.
+type jobItem struct {
+	ID          string     `json:"id"`
+	Actions     []string   `json:"actions"`
+	Status      string     `json:"status"`
+	Total       int        `json:"total"`
+	Processed   int        `json:"processed"`
+	Failed      int        `json:"failed"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// jobResponse is a success response for AdminAPI.CreateJob
+// and AdminAPI.GetJob.
+type jobResponse struct {
+	Job jobItem `json:"job"`
+}
+
+// Create populates a jobResponse with a job.
+func (r *jobResponse) Create(j *job) {
+	r.Job = jobItem{
+		ID:        j.ID,
+		Actions:   j.Actions,
+		Status:    j.Status,
+		Total:     j.Total,
+		Processed: j.Processed,
+		Failed:    j.Failed,
+		Error:     j.Error,
+		CreatedAt: j.CreatedAt,
+		UpdatedAt: j.UpdatedAt,
+	}
+	if !j.CompletedAt.IsZero() {
+		completedAt := j.CompletedAt
+		r.Job.CompletedAt = &completedAt
+	}
+}
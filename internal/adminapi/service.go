@@ -0,0 +1,363 @@
+// Package adminapi provides an HTTP API for operators to manage the service.
+package adminapi
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/featureflag"
+)
+
+type service struct {
+	logger   log.Logger
+	repoMngr auth.RepositoryManager
+	features auth.FeatureFlagService
+	token    auth.TokenService
+	webauthn auth.WebAuthnService
+	abuse    auth.SignupAbuseDetector
+	delivery auth.DeliveryStatsService
+	now      func() time.Time
+
+	db               rediser
+	actionTokens     auth.ActionTokenService
+	message          auth.MessagingService
+	passwordResetURL string
+
+	// jobCtx is cancelled to interrupt running jobs on shutdown.
+	jobCtx   context.Context
+	stopJobs context.CancelFunc
+	jobMu    sync.Mutex
+	jobs     sync.WaitGroup
+}
+
+// CreateCanary registers a decoy account identity. Identities
+// belonging to registered Users are rejected.
+func (s *service) CreateCanary(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	req, err := decodeCanaryRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.repoMngr.User().ByIdentity(ctx, req.UserAttribute(), req.Identity)
+	if err == nil {
+		return nil, auth.ErrBadRequest("identity belongs to a registered user")
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	_, err = s.repoMngr.Canary().ByIdentity(ctx, req.Identity)
+	if err == nil {
+		return nil, auth.ErrBadRequest("canary already exists")
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	canary := &auth.Canary{
+		Identity: req.Identity,
+		Note:     req.Note,
+	}
+	if err = s.repoMngr.Canary().Create(ctx, canary); err != nil {
+		return nil, err
+	}
+
+	resp := canaryResponse{}
+	resp.Create(canary)
+	return resp, nil
+}
+
+// ListCanaries returns all registered decoy account identities.
+func (s *service) ListCanaries(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	canaries, err := s.repoMngr.Canary().List(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := listCanaryResponse{}
+	resp.Create(canaries)
+	return resp, nil
+}
+
+// RemoveCanary removes a decoy account identity.
+func (s *service) RemoveCanary(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	identity := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/canary/")
+
+	if err := s.repoMngr.Canary().Remove(r.Context(), identity); err != nil {
+		return nil, err
+	}
+
+	return &removeResponse{Result: "success"}, nil
+}
+
+// CreateClient registers a ClientApplication. Registered
+// ClientApplications are recognized once the service reloads them.
+func (s *service) CreateClient(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	req, err := decodeClientRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	app := req.ClientApplication()
+	if err = s.repoMngr.ClientApplication().Create(r.Context(), app); err != nil {
+		return nil, err
+	}
+
+	resp := clientResponse{}
+	resp.Create(app)
+	return resp, nil
+}
+
+// ListClients returns all registered ClientApplications.
+func (s *service) ListClients(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	apps, err := s.repoMngr.ClientApplication().List(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := listClientResponse{}
+	resp.Create(apps)
+	return resp, nil
+}
+
+// RemoveClient removes a ClientApplication.
+func (s *service) RemoveClient(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	clientID := mux.Vars(r)["clientID"]
+
+	if err := s.repoMngr.ClientApplication().Remove(r.Context(), clientID); err != nil {
+		return nil, err
+	}
+
+	return &removeResponse{Result: "success"}, nil
+}
+
+// SignupAbuseStats returns the number of signup attempts by outcome.
+func (s *service) SignupAbuseStats(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	stats, err := s.abuse.Stats(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return &signupAbuseResponse{Outcomes: stats}, nil
+}
+
+// Stats returns aggregate statistics of the service for operational
+// dashboards: daily signups and message delivery outcomes over the
+// requested number of days, active sessions and 2FA adoption.
+func (s *service) Stats(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	req, err := decodeStatsRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	today := s.now().UTC().Truncate(time.Hour * 24)
+	since := today.AddDate(0, 0, 1-req.Days)
+
+	signups, err := s.repoMngr.User().CountSignups(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	adoption, err := s.repoMngr.User().CountTFA(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.repoMngr.LoginHistory().CountActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.delivery.Daily(ctx, req.Days)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := statsResponse{ActiveSessions: sessions}
+	resp.Create(since, req.Days, signups, adoption, deliveries)
+	return resp, nil
+}
+
+// ListDeliveries returns the most recent MessageDeliveries to an
+// address, allowing support to confirm whether an OTP reached a user.
+func (s *service) ListDeliveries(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	req, err := decodeDeliveryRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.repoMngr.MessageDelivery().ByAddress(r.Context(), req.Address, req.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := listDeliveryResponse{}
+	resp.Create(deliveries)
+	return resp, nil
+}
+
+// ListFeatures returns the state of all feature flags.
+func (s *service) ListFeatures(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	features, err := s.features.List(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := listFeatureResponse{}
+	resp.Create(features)
+	return resp, nil
+}
+
+// SetFeature enables or disables a feature at runtime.
+func (s *service) SetFeature(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	feature, err := featureFromPath(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := decodeFeatureRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.features.Set(ctx, feature, *req.Enabled); err != nil {
+		return nil, err
+	}
+
+	return &featureResponse{
+		Name:    string(feature),
+		Enabled: s.features.Enabled(ctx, feature),
+	}, nil
+}
+
+// ResetFeature reverts a feature to its configured default.
+func (s *service) ResetFeature(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	feature, err := featureFromPath(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.features.Reset(ctx, feature); err != nil {
+		return nil, err
+	}
+
+	return &featureResponse{
+		Name:    string(feature),
+		Enabled: s.features.Enabled(ctx, feature),
+	}, nil
+}
+
+// ExportUsers returns a page of Users with their contact methods and
+// registered devices. Pages are requested with the cursor returned
+// by the previous page.
+func (s *service) ExportUsers(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	req, err := decodeExportRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// An extra User is requested to determine if another page exists.
+	users, err := s.repoMngr.User().List(ctx, req.Cursor, req.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	var nextCursor string
+	if len(users) > req.Limit {
+		users = users[:req.Limit]
+		nextCursor = users[len(users)-1].ID
+	}
+
+	devices := make(map[string][]*auth.Device)
+	for _, u := range users {
+		devices[u.ID], err = s.repoMngr.Device().ByUserID(ctx, u.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp := exportResponse{NextCursor: nextCursor}
+	resp.Create(users, devices)
+	return resp, nil
+}
+
+// RevokeUserTokens revokes every logged in session of a User, e.g.
+// in response to a reported account compromise.
+func (s *service) RevokeUserTokens(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userID"]
+
+	_, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrNotFound("user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.token.RevokeAll(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return &revokeResponse{Result: "success"}, nil
+}
+
+// ImportU2F imports a User's FIDO U2F keys registered with another
+// system as WebAuthn devices, so migrating users need not register
+// their keys again.
+func (s *service) ImportU2F(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := mux.Vars(r)["userID"]
+
+	req, err := decodeU2FImportRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrNotFound("user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []*auth.Device{}
+	for _, reg := range req.Registrations() {
+		device, err := s.webauthn.ImportU2F(ctx, user, reg)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+
+	resp := importU2FResponse{}
+	resp.Create(devices)
+	return resp, nil
+}
+
+func featureFromPath(r *http.Request) (auth.Feature, error) {
+	feature := auth.Feature(mux.Vars(r)["feature"])
+	if !featureflag.IsKnown(feature) {
+		return "", auth.ErrInvalidField("feature is not recognized")
+	}
+	return feature, nil
+}
@@ -0,0 +1,43 @@
+package anomaly
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+// Alert describes a source flagged for credential stuffing.
+type Alert struct {
+	Source       string        `json:"source"`
+	Failures     int64         `json:"failures"`
+	Accounts     int64         `json:"accounts"`
+	Window       time.Duration `json:"window"`
+	FlaggedUntil time.Time     `json:"flagged_until"`
+}
+
+// Alerter delivers alerts to operators.
+type Alerter interface {
+	// Alert delivers an alert.
+	Alert(ctx context.Context, a *Alert) error
+}
+
+type webhookAlerter struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAlerter returns an Alerter that POSTs alerts
+// as JSON to a webhook URL.
+func NewWebhookAlerter(url string, client *http.Client) Alerter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &webhookAlerter{url: url, client: client}
+}
+
+// Alert delivers an alert to the webhook.
+func (w *webhookAlerter) Alert(ctx context.Context, a *Alert) error {
+	return httpapi.PostJSON(ctx, w.client, w.url, a)
+}
@@ -0,0 +1,65 @@
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CaptchaVerifier verifies CAPTCHA responses.
+type CaptchaVerifier interface {
+	// Verify returns an error if a CAPTCHA response is invalid.
+	Verify(ctx context.Context, token, ip string) error
+}
+
+type siteVerify struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewSiteVerifyCaptcha returns a CaptchaVerifier for providers implementing
+// the siteverify API (e.g. reCAPTCHA, hCaptcha, Turnstile).
+func NewSiteVerifyCaptcha(verifyURL, secret string, client *http.Client) CaptchaVerifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &siteVerify{url: verifyURL, secret: secret, client: client}
+}
+
+// Verify validates a CAPTCHA response with the provider.
+func (c *siteVerify) Verify(ctx context.Context, token, ip string) error {
+	form := url.Values{}
+	form.Set("secret", c.secret)
+	form.Set("response", token)
+	form.Set("remoteip", ip)
+
+	req, err := http.NewRequest("POST", c.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("cannot create captcha request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid captcha response: %w", err)
+	}
+
+	if !result.Success {
+		return fmt.Errorf("captcha verification failed")
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package anomaly
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/featureflag"
+)
+
+const (
+	defaultWindow       = time.Minute * 5
+	defaultInterval     = time.Minute
+	defaultMinFailures  = 50
+	defaultMinAccounts  = 10
+	defaultFlagDuration = time.Hour
+	defaultFlaggedLimit = 5
+)
+
+// NewService returns a new AnomalyDetector. Without a database,
+// detection is disabled.
+func NewService(options ...ConfigOption) auth.AnomalyDetector {
+	s := service{
+		logger:       log.NewNopLogger(),
+		source:       PrefixSource(24, 48),
+		features:     featureflag.NewService(),
+		window:       defaultWindow,
+		interval:     defaultInterval,
+		minFailures:  defaultMinFailures,
+		minAccounts:  defaultMinAccounts,
+		flagDuration: defaultFlagDuration,
+		flaggedLimit: defaultFlaggedLimit,
+		now:          time.Now,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithDB configures the service with a Redis DB.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithSourceResolver configures how IP addresses are grouped into sources.
+func WithSourceResolver(r SourceResolver) ConfigOption {
+	return func(s *service) {
+		s.source = r
+	}
+}
+
+// WithAlerter configures the service to deliver alerts
+// when a source is flagged.
+func WithAlerter(a Alerter) ConfigOption {
+	return func(s *service) {
+		s.alerter = a
+	}
+}
+
+// WithCaptcha requires flagged sources to solve a CAPTCHA.
+func WithCaptcha(c CaptchaVerifier) ConfigOption {
+	return func(s *service) {
+		s.captcha = c
+	}
+}
+
+// WithWindow configures the window in which failures are counted
+// and how often they are analyzed.
+func WithWindow(window, interval time.Duration) ConfigOption {
+	return func(s *service) {
+		s.window = window
+		s.interval = interval
+	}
+}
+
+// WithThresholds configures the minimum failures and distinct accounts
+// from a source within a window before it is flagged.
+func WithThresholds(minFailures, minAccounts int64) ConfigOption {
+	return func(s *service) {
+		s.minFailures = minFailures
+		s.minAccounts = minAccounts
+	}
+}
+
+// WithFlagDuration configures how long a source remains flagged.
+func WithFlagDuration(d time.Duration) ConfigOption {
+	return func(s *service) {
+		s.flagDuration = d
+	}
+}
+
+// WithFlaggedRateLimit configures the requests per minute
+// allowed from a flagged source.
+func WithFlaggedRateLimit(limit int64) ConfigOption {
+	return func(s *service) {
+		s.flaggedLimit = limit
+	}
+}
+
+// WithReputation configures the service to apply a NetworkPolicy to
+// requests from Tor, VPN and proxy networks.
+func WithReputation(r auth.NetworkReputation, policy NetworkPolicy) ConfigOption {
+	return func(s *service) {
+		s.reputation = r
+		s.networkPolicy = policy
+	}
+}
+
+// WithFeatureFlags configures the service with a FeatureFlagService.
+func WithFeatureFlags(f auth.FeatureFlagService) ConfigOption {
+	return func(s *service) {
+		s.features = f
+	}
+}
@@ -0,0 +1,38 @@
+package anomaly
+
+import (
+	"fmt"
+	"strings"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// NetworkAction is the mitigation applied to requests from a class
+// of anonymizing network.
+type NetworkAction string
+
+const (
+	// NetworkAllow serves requests without mitigation.
+	NetworkAllow NetworkAction = "allow"
+	// NetworkStepUp applies the mitigations of a flagged source.
+	NetworkStepUp NetworkAction = "step-up"
+	// NetworkBlock rejects requests.
+	NetworkBlock NetworkAction = "block"
+)
+
+// ParseNetworkAction parses a NetworkAction. An empty string
+// is parsed as NetworkAllow.
+func ParseNetworkAction(s string) (NetworkAction, error) {
+	switch a := NetworkAction(strings.ToLower(strings.TrimSpace(s))); a {
+	case "":
+		return NetworkAllow, nil
+	case NetworkAllow, NetworkStepUp, NetworkBlock:
+		return a, nil
+	default:
+		return "", fmt.Errorf("invalid network action %q", s)
+	}
+}
+
+// NetworkPolicy is the NetworkAction applied to each class of
+// network. Classes without an action are allowed.
+type NetworkPolicy map[auth.NetworkClass]NetworkAction
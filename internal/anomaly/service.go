@@ -0,0 +1,350 @@
+// Package anomaly detects credential stuffing by analyzing failed
+// login attempts and mitigates attacks from offending sources.
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+const captchaHeader = "X-Captcha-Token"
+
+// rediser is a minimal interface for go-redis.
+type rediser interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SMembers(ctx context.Context, key string) *redis.StringSliceCmd
+	PFAdd(ctx context.Context, key string, els ...interface{}) *redis.IntCmd
+	PFCount(ctx context.Context, keys ...string) *redis.IntCmd
+}
+
+// service is an implementation of auth.AnomalyDetector backed by redis.
+// Failed logins are counted per source in fixed windows alongside an
+// estimate of the distinct accounts targeted. Sources exceeding both
+// thresholds within a window are flagged.
+type service struct {
+	logger       log.Logger
+	db           rediser
+	source       SourceResolver
+	alerter      Alerter
+	captcha      CaptchaVerifier
+	features     auth.FeatureFlagService
+	window       time.Duration
+	interval     time.Duration
+	minFailures  int64
+	minAccounts  int64
+	flagDuration time.Duration
+	flaggedLimit int64
+	now          func() time.Time
+
+	reputation    auth.NetworkReputation
+	networkPolicy NetworkPolicy
+}
+
+// RecordFailure records a failed login attempt from an IP address
+// against an account identity.
+func (s *service) RecordFailure(ctx context.Context, ip, identity string) error {
+	if s.db == nil {
+		return nil
+	}
+
+	source := s.source(ip)
+	if source == "" {
+		return nil
+	}
+
+	h, err := crypto.Hash(identity)
+	if err != nil {
+		return fmt.Errorf("cannot hash identity: %w", err)
+	}
+
+	bucket := s.bucket(s.now())
+	ttl := s.window * 2
+
+	if err = s.db.SAdd(ctx, sourcesKey(bucket), source).Err(); err != nil {
+		return fmt.Errorf("cannot record failure source: %w", err)
+	}
+	if err = s.db.Expire(ctx, sourcesKey(bucket), ttl).Err(); err != nil {
+		return fmt.Errorf("cannot record failure source: %w", err)
+	}
+	if err = s.db.Incr(ctx, failuresKey(bucket, source)).Err(); err != nil {
+		return fmt.Errorf("cannot record failure count: %w", err)
+	}
+	if err = s.db.Expire(ctx, failuresKey(bucket, source), ttl).Err(); err != nil {
+		return fmt.Errorf("cannot record failure count: %w", err)
+	}
+	if err = s.db.PFAdd(ctx, accountsKey(bucket, source), h).Err(); err != nil {
+		return fmt.Errorf("cannot record failure account: %w", err)
+	}
+
+	return s.db.Expire(ctx, accountsKey(bucket, source), ttl).Err()
+}
+
+// Check applies mitigations to requests from flagged sources. Flagged
+// sources are subject to a tightened rate limit and, if a CaptchaVerifier
+// is configured and the captcha feature is enabled, must solve a CAPTCHA.
+// Requests from anonymizing networks are blocked or treated as flagged
+// according to the NetworkPolicy.
+func (s *service) Check(ctx context.Context, r *http.Request) error {
+	if s.db == nil {
+		return nil
+	}
+
+	ip := httpapi.GetIP(r)
+	source := s.source(ip)
+	if source == "" {
+		return nil
+	}
+
+	class, action := s.classify(ctx, ip)
+	if action == NetworkBlock {
+		return auth.ErrForbidden(fmt.Sprintf("requests from %s networks are not allowed", class))
+	}
+
+	if action != NetworkStepUp {
+		flagged, err := s.isFlagged(ctx, source)
+		if err != nil || !flagged {
+			return err
+		}
+	}
+
+	if s.requiresCaptcha(ctx) {
+		token := r.Header.Get(captchaHeader)
+		if token == "" {
+			return auth.ErrChallenge("captcha is required")
+		}
+		if err := s.captcha.Verify(ctx, token, ip); err != nil {
+			return fmt.Errorf("%v: %w", err, auth.ErrChallenge("captcha is invalid"))
+		}
+	}
+
+	key := limitKey(source, s.now().Format(httpapi.HHMM))
+	count, err := s.db.Incr(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("cannot apply source rate limit: %w", err)
+	}
+	if err = s.db.Expire(ctx, key, time.Minute).Err(); err != nil {
+		return fmt.Errorf("cannot apply source rate limit: %w", err)
+	}
+	if count > s.flaggedLimit {
+		return auth.ErrThrottle("too many requests")
+	}
+
+	return nil
+}
+
+// Challenge reports whether a request must solve a CAPTCHA before
+// it is served. Requests are not counted against any limit.
+func (s *service) Challenge(ctx context.Context, r *http.Request) (bool, error) {
+	if s.db == nil || !s.requiresCaptcha(ctx) {
+		return false, nil
+	}
+
+	ip := httpapi.GetIP(r)
+	source := s.source(ip)
+	if source == "" {
+		return false, nil
+	}
+
+	_, action := s.classify(ctx, ip)
+	switch action {
+	case NetworkStepUp:
+		return true, nil
+	case NetworkBlock:
+		return false, nil
+	default:
+		return s.isFlagged(ctx, source)
+	}
+}
+
+// isFlagged reports whether a source is flagged.
+func (s *service) isFlagged(ctx context.Context, source string) (bool, error) {
+	err := s.db.Get(ctx, flaggedKey(source)).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot lookup flagged source: %w", err)
+	}
+	return true, nil
+}
+
+// requiresCaptcha reports whether flagged sources must solve a CAPTCHA.
+func (s *service) requiresCaptcha(ctx context.Context) bool {
+	return s.captcha != nil && s.features.Enabled(ctx, auth.FeatureCaptcha)
+}
+
+// classify returns the class of network an IP address belongs to and
+// the action applied to it. Requests are allowed if the network cannot
+// be classified, so that an unavailable API does not lock out users.
+func (s *service) classify(ctx context.Context, ip string) (auth.NetworkClass, NetworkAction) {
+	if s.reputation == nil {
+		return "", NetworkAllow
+	}
+
+	class, err := s.reputation.Classify(ctx, ip)
+	if err != nil {
+		level.Warn(s.logger).Log(
+			"source", "AnomalyDetector.Check",
+			"message", "failed to classify network",
+			"error", err,
+		)
+		return "", NetworkAllow
+	}
+	if class == "" {
+		return "", NetworkAllow
+	}
+
+	action, ok := s.networkPolicy[class]
+	if !ok {
+		return class, NetworkAllow
+	}
+
+	return class, action
+}
+
+// Run periodically analyzes recent failures until the context is cancelled.
+func (s *service) Run(ctx context.Context) error {
+	if s.db == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := s.Analyze(ctx); err != nil {
+				level.Error(s.logger).Log(
+					"source", "AnomalyDetector.Run",
+					"message", "failed to analyze login failures",
+					"error", err,
+				)
+			}
+		}
+	}
+}
+
+// Analyze flags sources exceeding failure thresholds within
+// the current window.
+func (s *service) Analyze(ctx context.Context) error {
+	bucket := s.bucket(s.now())
+
+	sources, err := s.db.SMembers(ctx, sourcesKey(bucket)).Result()
+	if err != nil {
+		return fmt.Errorf("cannot retrieve failure sources: %w", err)
+	}
+
+	for _, source := range sources {
+		failures, err := s.db.Get(ctx, failuresKey(bucket, source)).Int64()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("cannot retrieve failure count: %w", err)
+		}
+		if failures < s.minFailures {
+			continue
+		}
+
+		accounts, err := s.db.PFCount(ctx, accountsKey(bucket, source)).Result()
+		if err != nil {
+			return fmt.Errorf("cannot retrieve failure accounts: %w", err)
+		}
+		if accounts < s.minAccounts {
+			continue
+		}
+
+		if err = s.flag(ctx, source, failures, accounts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *service) flag(ctx context.Context, source string, failures, accounts int64) error {
+	err := s.db.Get(ctx, flaggedKey(source)).Err()
+	if err == nil {
+		// Source is already flagged, no need to alert again.
+		return nil
+	}
+	if err != redis.Nil {
+		return fmt.Errorf("cannot lookup flagged source: %w", err)
+	}
+
+	flaggedUntil := s.now().Add(s.flagDuration)
+	if err = s.db.Set(ctx, flaggedKey(source), flaggedUntil.Unix(), s.flagDuration).Err(); err != nil {
+		return fmt.Errorf("cannot flag source: %w", err)
+	}
+
+	alert := &Alert{
+		Source:       source,
+		Failures:     failures,
+		Accounts:     accounts,
+		Window:       s.window,
+		FlaggedUntil: flaggedUntil,
+	}
+
+	level.Warn(s.logger).Log(
+		"source", "AnomalyDetector.Analyze",
+		"message", "credential stuffing detected",
+		"offending_source", source,
+		"failures", failures,
+		"accounts", accounts,
+		"flagged_until", flaggedUntil,
+	)
+
+	if s.alerter == nil {
+		return nil
+	}
+
+	if err = s.alerter.Alert(ctx, alert); err != nil {
+		level.Error(s.logger).Log(
+			"source", "AnomalyDetector.Analyze",
+			"message", "failed to deliver alert",
+			"error", err,
+		)
+	}
+
+	return nil
+}
+
+func (s *service) bucket(t time.Time) string {
+	return strconv.FormatInt(t.Truncate(s.window).Unix(), 10)
+}
+
+func sourcesKey(bucket string) string {
+	return fmt.Sprintf("anomaly:%s:sources", bucket)
+}
+
+func failuresKey(bucket, source string) string {
+	return fmt.Sprintf("anomaly:%s:%s:failures", bucket, source)
+}
+
+func accountsKey(bucket, source string) string {
+	return fmt.Sprintf("anomaly:%s:%s:accounts", bucket, source)
+}
+
+func flaggedKey(source string) string {
+	return fmt.Sprintf("anomaly:flagged:%s", source)
+}
+
+func limitKey(source, minute string) string {
+	return fmt.Sprintf("anomaly:limit:%s:%s", source, minute)
+}
@@ -0,0 +1,481 @@
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/featureflag"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+// fakeRedis is an in-memory implementation of the commands used by
+// the service. Expiry is not simulated.
+type fakeRedis struct {
+	values map[string]string
+	sets   map[string]map[string]bool
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{
+		values: make(map[string]string),
+		sets:   make(map[string]map[string]bool),
+	}
+}
+
+func (f *fakeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	v, ok := f.values[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(v, nil)
+}
+
+func (f *fakeRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	f.values[key] = fmt.Sprint(value)
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (f *fakeRedis) Incr(ctx context.Context, key string) *redis.IntCmd {
+	v, _ := strconv.ParseInt(f.values[key], 10, 64)
+	v++
+	f.values[key] = strconv.FormatInt(v, 10)
+	return redis.NewIntResult(v, nil)
+}
+
+func (f *fakeRedis) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	return redis.NewBoolResult(true, nil)
+}
+
+func (f *fakeRedis) add(key string, members ...interface{}) *redis.IntCmd {
+	if f.sets[key] == nil {
+		f.sets[key] = make(map[string]bool)
+	}
+	for _, m := range members {
+		f.sets[key][fmt.Sprint(m)] = true
+	}
+	return redis.NewIntResult(int64(len(members)), nil)
+}
+
+func (f *fakeRedis) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	return f.add(key, members...)
+}
+
+func (f *fakeRedis) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
+	members := []string{}
+	for m := range f.sets[key] {
+		members = append(members, m)
+	}
+	return redis.NewStringSliceResult(members, nil)
+}
+
+func (f *fakeRedis) PFAdd(ctx context.Context, key string, els ...interface{}) *redis.IntCmd {
+	return f.add(key, els...)
+}
+
+func (f *fakeRedis) PFCount(ctx context.Context, keys ...string) *redis.IntCmd {
+	return redis.NewIntResult(int64(len(f.sets[keys[0]])), nil)
+}
+
+type mockAlerter struct {
+	alerts []*Alert
+}
+
+func (m *mockAlerter) Alert(ctx context.Context, a *Alert) error {
+	m.alerts = append(m.alerts, a)
+	return nil
+}
+
+type mockCaptcha struct {
+	err error
+}
+
+func (m *mockCaptcha) Verify(ctx context.Context, token, ip string) error {
+	return m.err
+}
+
+func TestAnomaly_Analyze(t *testing.T) {
+	tt := []struct {
+		name      string
+		failures  int
+		accounts  int
+		isFlagged bool
+	}{
+		{
+			name:      "Flags many failures across many accounts",
+			failures:  20,
+			accounts:  10,
+			isFlagged: true,
+		},
+		{
+			name:      "Ignores many failures against one account",
+			failures:  20,
+			accounts:  1,
+			isFlagged: false,
+		},
+		{
+			name:      "Ignores few failures",
+			failures:  5,
+			accounts:  5,
+			isFlagged: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newFakeRedis()
+			alerter := &mockAlerter{}
+			svc := NewService(
+				WithDB(db),
+				WithAlerter(alerter),
+				WithThresholds(10, 5),
+			).(*service)
+
+			for i := 0; i < tc.failures; i++ {
+				identity := fmt.Sprintf("user-%v@example.com", i%tc.accounts)
+				ip := fmt.Sprintf("203.0.113.%v", i%200)
+				if err := svc.RecordFailure(ctx, ip, identity); err != nil {
+					t.Fatal("failed to record failure:", err)
+				}
+			}
+			// Unrelated source with a single failure.
+			if err := svc.RecordFailure(ctx, "198.51.100.1", "jane@example.com"); err != nil {
+				t.Fatal("failed to record failure:", err)
+			}
+
+			if err := svc.Analyze(ctx); err != nil {
+				t.Fatal("failed to analyze failures:", err)
+			}
+			// Repeated analysis should not trigger repeated alerts.
+			if err := svc.Analyze(ctx); err != nil {
+				t.Fatal("failed to analyze failures:", err)
+			}
+
+			_, isFlagged := db.values[flaggedKey("203.0.113.0/24")]
+			if isFlagged != tc.isFlagged {
+				t.Errorf("incorrect flagged state, want %v got %v", tc.isFlagged, isFlagged)
+			}
+			if _, ok := db.values[flaggedKey("198.51.100.0/24")]; ok {
+				t.Error("unrelated source should not be flagged")
+			}
+
+			expectedAlerts := 0
+			if tc.isFlagged {
+				expectedAlerts = 1
+			}
+			if len(alerter.alerts) != expectedAlerts {
+				t.Errorf("incorrect alert count, want %v got %v", expectedAlerts, len(alerter.alerts))
+			}
+		})
+	}
+}
+
+func TestAnomaly_Check(t *testing.T) {
+	tt := []struct {
+		name         string
+		isFlagged    bool
+		captcha      CaptchaVerifier
+		captchaToken string
+		captchaOff   bool
+		network      auth.NetworkClass
+		networkErr   error
+		requests     int
+		errCode      auth.ErrCode
+	}{
+		{
+			name:     "Allows unflagged source",
+			requests: 10,
+		},
+		{
+			name:      "Tightens limit for flagged source",
+			isFlagged: true,
+			requests:  3,
+			errCode:   auth.EThrottle,
+		},
+		{
+			name:      "Requires captcha for flagged source",
+			isFlagged: true,
+			captcha:   &mockCaptcha{},
+			requests:  1,
+			errCode:   auth.EChallenge,
+		},
+		{
+			name:         "Rejects invalid captcha",
+			isFlagged:    true,
+			captcha:      &mockCaptcha{err: fmt.Errorf("invalid response")},
+			captchaToken: "captcha-token",
+			requests:     1,
+			errCode:      auth.EChallenge,
+		},
+		{
+			name:         "Accepts valid captcha",
+			isFlagged:    true,
+			captcha:      &mockCaptcha{},
+			captchaToken: "captcha-token",
+			requests:     2,
+		},
+		{
+			name:       "Skips captcha when feature is disabled",
+			isFlagged:  true,
+			captcha:    &mockCaptcha{},
+			captchaOff: true,
+			requests:   1,
+		},
+		{
+			name:     "Blocks network by policy",
+			network:  auth.NetworkProxy,
+			requests: 1,
+			errCode:  auth.EForbidden,
+		},
+		{
+			name:     "Steps up network by policy",
+			network:  auth.NetworkTor,
+			captcha:  &mockCaptcha{},
+			requests: 1,
+			errCode:  auth.EChallenge,
+		},
+		{
+			name:         "Steps up network with valid captcha",
+			network:      auth.NetworkTor,
+			captcha:      &mockCaptcha{},
+			captchaToken: "captcha-token",
+			requests:     2,
+		},
+		{
+			name:     "Allows network by policy",
+			network:  auth.NetworkVPN,
+			captcha:  &mockCaptcha{},
+			requests: 10,
+		},
+		{
+			name:       "Allows network which cannot be classified",
+			networkErr: fmt.Errorf("reputation API is unavailable"),
+			captcha:    &mockCaptcha{},
+			requests:   10,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newFakeRedis()
+			if tc.isFlagged {
+				db.values[flaggedKey("203.0.113.0/24")] = "1"
+			}
+
+			reputation := &test.NetworkReputation{
+				ClassifyFn: func(ip string) (auth.NetworkClass, error) {
+					return tc.network, tc.networkErr
+				},
+			}
+			policy := NetworkPolicy{
+				auth.NetworkTor:   NetworkStepUp,
+				auth.NetworkVPN:   NetworkAllow,
+				auth.NetworkProxy: NetworkBlock,
+			}
+
+			options := []ConfigOption{
+				WithDB(db),
+				WithFlaggedRateLimit(2),
+				WithReputation(reputation, policy),
+			}
+			if tc.captcha != nil {
+				options = append(options, WithCaptcha(tc.captcha))
+			}
+			if tc.captchaOff {
+				options = append(options, WithFeatureFlags(
+					featureflag.NewService(featureflag.WithDisabled(auth.FeatureCaptcha)),
+				))
+			}
+			svc := NewService(options...)
+
+			var err error
+			for i := 0; i < tc.requests; i++ {
+				r := httptest.NewRequest("POST", "/api/v1/login", nil)
+				r.RemoteAddr = "203.0.113.5:5000"
+				if tc.captchaToken != "" {
+					r.Header.Set("X-Captcha-Token", tc.captchaToken)
+				}
+				err = svc.Check(ctx, r)
+			}
+
+			if auth.ErrorCode(err) != tc.errCode {
+				t.Errorf("incorrect error code, want '%s' got '%s'", tc.errCode, auth.ErrorCode(err))
+			}
+		})
+	}
+}
+
+func TestAnomaly_ParseNetworkAction(t *testing.T) {
+	tt := []struct {
+		s        string
+		action   NetworkAction
+		hasError bool
+	}{
+		{s: "", action: NetworkAllow},
+		{s: "Block", action: NetworkBlock},
+		{s: "step-up", action: NetworkStepUp},
+		{s: "deny", hasError: true},
+	}
+
+	for _, tc := range tt {
+		action, err := ParseNetworkAction(tc.s)
+		if tc.hasError != (err != nil) {
+			t.Errorf("incorrect error for %q, want error %v got %v", tc.s, tc.hasError, err)
+		}
+		if action != tc.action {
+			t.Errorf("incorrect action for %q, want %q got %q", tc.s, tc.action, action)
+		}
+	}
+}
+
+func TestAnomaly_Challenge(t *testing.T) {
+	tt := []struct {
+		name       string
+		isFlagged  bool
+		network    auth.NetworkClass
+		captcha    CaptchaVerifier
+		captchaOff bool
+		required   bool
+	}{
+		{
+			name:    "No challenge for unflagged source",
+			captcha: &mockCaptcha{},
+		},
+		{
+			name:      "Challenges flagged source",
+			isFlagged: true,
+			captcha:   &mockCaptcha{},
+			required:  true,
+		},
+		{
+			name:     "Challenges stepped up network",
+			network:  auth.NetworkTor,
+			captcha:  &mockCaptcha{},
+			required: true,
+		},
+		{
+			name:      "No challenge without captcha",
+			isFlagged: true,
+		},
+		{
+			name:       "No challenge when feature is disabled",
+			isFlagged:  true,
+			captcha:    &mockCaptcha{},
+			captchaOff: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newFakeRedis()
+			if tc.isFlagged {
+				db.values[flaggedKey("203.0.113.0/24")] = "1"
+			}
+
+			reputation := &test.NetworkReputation{
+				ClassifyFn: func(ip string) (auth.NetworkClass, error) {
+					return tc.network, nil
+				},
+			}
+			options := []ConfigOption{
+				WithDB(db),
+				WithReputation(reputation, NetworkPolicy{auth.NetworkTor: NetworkStepUp}),
+			}
+			if tc.captcha != nil {
+				options = append(options, WithCaptcha(tc.captcha))
+			}
+			if tc.captchaOff {
+				options = append(options, WithFeatureFlags(
+					featureflag.NewService(featureflag.WithDisabled(auth.FeatureCaptcha)),
+				))
+			}
+			svc := NewService(options...)
+
+			r := httptest.NewRequest("GET", "/api/v1/login/challenge", nil)
+			r.RemoteAddr = "203.0.113.5:5000"
+			required, err := svc.Challenge(context.Background(), r)
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+			if required != tc.required {
+				t.Errorf("incorrect challenge, want %v got %v", tc.required, required)
+			}
+		})
+	}
+}
+
+func TestAnomaly_Disabled(t *testing.T) {
+	svc := NewService()
+	r := httptest.NewRequest("POST", "/api/v1/login", nil)
+
+	if err := svc.RecordFailure(context.Background(), "203.0.113.5", "jane@example.com"); err != nil {
+		t.Error("expected nil error:", err)
+	}
+	if err := svc.Check(context.Background(), r); err != nil {
+		t.Error("expected nil error:", err)
+	}
+}
+
+func TestAnomaly_PrefixSource(t *testing.T) {
+	source := PrefixSource(24, 48)
+
+	if s := source("203.0.113.5"); s != "203.0.113.0/24" {
+		t.Errorf("incorrect IPv4 source, want 203.0.113.0/24 got %s", s)
+	}
+	if s := source("2001:db8:1:2::1"); s != "2001:db8:1::/48" {
+		t.Errorf("incorrect IPv6 source, want 2001:db8:1::/48 got %s", s)
+	}
+	if s := source("unknown"); s != "" {
+		t.Errorf("expected empty source, got %s", s)
+	}
+}
+
+func TestAnomaly_ASNSource(t *testing.T) {
+	geo := &test.GeoResolver{
+		LookupFn: func(ip string) *auth.GeoLocation {
+			if ip == "203.0.113.5" {
+				return &auth.GeoLocation{Country: "DE", ASN: 3320}
+			}
+			return &auth.GeoLocation{Country: "DE"}
+		},
+	}
+	source := ASNSource(geo, PrefixSource(24, 48))
+
+	if s := source("203.0.113.5"); s != "AS3320" {
+		t.Errorf("incorrect ASN source, want AS3320 got %s", s)
+	}
+	if s := source("198.51.100.5"); s != "198.51.100.0/24" {
+		t.Errorf("incorrect fallback source, want 198.51.100.0/24 got %s", s)
+	}
+}
+
+func TestAnomaly_SiteVerifyCaptcha(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal("failed to parse form:", err)
+		}
+		if r.PostForm.Get("secret") != "secret" {
+			t.Error("secret not sent")
+		}
+		success := r.PostForm.Get("response") == "valid"
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"success": %v}`, success)))
+	}))
+	defer srv.Close()
+
+	captcha := NewSiteVerifyCaptcha(srv.URL, "secret", nil)
+	if err := captcha.Verify(context.Background(), "valid", "203.0.113.5"); err != nil {
+		t.Error("expected nil error:", err)
+	}
+	if err := captcha.Verify(context.Background(), "invalid", "203.0.113.5"); err == nil {
+		t.Error("expected error, not nil")
+	}
+}
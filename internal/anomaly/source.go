@@ -0,0 +1,42 @@
+package anomaly
+
+import (
+	"fmt"
+	"net"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// SourceResolver groups IP addresses into the source used to detect
+// attacks (e.g. an ASN or network prefix). An empty source is ignored.
+type SourceResolver func(ip string) string
+
+// PrefixSource groups IP addresses by network prefix. It is a stand-in
+// for ASNSource when an ASN database is not available.
+func PrefixSource(ipv4Bits, ipv6Bits int) SourceResolver {
+	return func(ip string) string {
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return ""
+		}
+
+		if v4 := addr.To4(); v4 != nil {
+			n := net.IPNet{IP: v4.Mask(net.CIDRMask(ipv4Bits, 32)), Mask: net.CIDRMask(ipv4Bits, 32)}
+			return n.String()
+		}
+
+		n := net.IPNet{IP: addr.Mask(net.CIDRMask(ipv6Bits, 128)), Mask: net.CIDRMask(ipv6Bits, 128)}
+		return n.String()
+	}
+}
+
+// ASNSource groups IP addresses by the autonomous system announcing
+// them. Addresses without a known ASN are grouped by fallback.
+func ASNSource(geo auth.GeoResolver, fallback SourceResolver) SourceResolver {
+	return func(ip string) string {
+		if loc := geo.Lookup(ip); loc != nil && loc.ASN != 0 {
+			return fmt.Sprintf("AS%d", loc.ASN)
+		}
+		return fallback(ip)
+	}
+}
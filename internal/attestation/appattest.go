@@ -0,0 +1,339 @@
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+const appAttestFormat = "apple-appattest"
+
+// appleAppAttestRootCA is Apple's App Attestation Root CA, available at
+// https://www.apple.com/certificateauthority/Apple_App_Attestation_Root_CA.pem
+const appleAppAttestRootCA = `-----BEGIN CERTIFICATE-----
+MIICITCCAaegAwIBAgIQC/O+DvHN0uD7jG5yH2IXmDAKBggqhkjOPQQDAzBSMSYw
+JAYDVQQDDB1BcHBsZSBBcHAgQXR0ZXN0YXRpb24gUm9vdCBDQTETMBEGA1UECgwK
+QXBwbGUgSW5jLjETMBEGA1UECAwKQ2FsaWZvcm5pYTAeFw0yMDAzMTgxODMyNTNa
+Fw00NTAzMTUwMDAwMDBaMFIxJjAkBgNVBAMMHUFwcGxlIEFwcCBBdHRlc3RhdGlv
+biBSb290IENBMRMwEQYDVQQKDApBcHBsZSBJbmMuMRMwEQYDVQQIDApDYWxpZm9y
+bmlhMHYwEAYHKoZIzj0CAQYFK4EEACIDYgAERTHhmLW07ATaFQIEVwTtT4dyctdh
+NbJhFs/Ii2FdCgAHGbpphY3+d8qjuDngIN3WVhQUBHAoMeQ/cLiP1sOUtgjqK9au
+Yen1mMEvRq9Sk3Jm5X8U62H+xTD3FE9TgS41o0IwQDAPBgNVHRMBAf8EBTADAQH/
+MB0GA1UdDgQWBBSskRBTM72+aEH/pwyp5frq5eWKoTAOBgNVHQ8BAf8EBAMCAQYw
+CgYIKoZIzj0EAwMDaAAwZQIwQgFGnByvsiVbpTKwSga0kP0e8EeDS4+sQmTvb7vn
+53O5+FRXgeLhpJ06ysC5PrOyAjEAp5U4xDgEgllF7En3VcE3iexZZtKeYnpqtijV
+oyFraWVIyd/dganmrduC1bmTBGwD
+-----END CERTIFICATE-----`
+
+var (
+	// nonceExtensionOID is the credential certificate extension
+	// containing the attestation nonce.
+	nonceExtensionOID = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 8, 2}
+
+	aaguidProduction  = append([]byte("appattest"), make([]byte, 7)...)
+	aaguidDevelopment = []byte("appattestdevelop")
+)
+
+type attestationObject struct {
+	Format       string `cbor:"fmt"`
+	AttStatement struct {
+		X5C     [][]byte `cbor:"x5c"`
+		Receipt []byte   `cbor:"receipt"`
+	} `cbor:"attStmt"`
+	AuthData []byte `cbor:"authData"`
+}
+
+type assertionObject struct {
+	Signature         []byte `cbor:"signature"`
+	AuthenticatorData []byte `cbor:"authenticatorData"`
+}
+
+type nonceExtension struct {
+	Nonce []byte `asn1:"tag:1,explicit"`
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// attestedKey is the public key of an attested App Attest key and
+// the counter of its last accepted assertion.
+type attestedKey struct {
+	PublicKey []byte `json:"publicKey"`
+	Counter   uint32 `json:"counter"`
+}
+
+type authData struct {
+	rpIDHash     []byte
+	counter      uint32
+	aaguid       []byte
+	credentialID []byte
+}
+
+type appAttest struct {
+	appID            string
+	allowDevelopment bool
+	roots            *x509.CertPool
+	db               rediser
+}
+
+// NewAppAttestVerifier returns a Verifier for Apple App Attest attestation
+// objects and assertions. The appID is the application's team ID and bundle
+// ID (e.g. `ABCDE12345.com.example.app`). Attestations from the development
+// environment are only accepted if allowDevelopment is set. The public key
+// of each attested key is stored in the DB to verify its later assertions.
+func NewAppAttestVerifier(appID string, allowDevelopment bool, db rediser) Verifier {
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM([]byte(appleAppAttestRootCA))
+
+	return &appAttest{
+		appID:            appID,
+		allowDevelopment: allowDevelopment,
+		roots:            roots,
+		db:               db,
+	}
+}
+
+// Verify validates an App Attest attestation object or an assertion
+// of a previously attested key following Apple's server side validation
+// steps. Clients attest a new key once and submit assertions afterwards.
+func (a *appAttest) Verify(ctx context.Context, att *Attestation) error {
+	raw, err := base64.StdEncoding.DecodeString(att.Token)
+	if err != nil {
+		return fmt.Errorf("cannot decode attestation object: %w", err)
+	}
+
+	keyID, err := base64.StdEncoding.DecodeString(att.KeyID)
+	if err != nil || len(keyID) == 0 {
+		return fmt.Errorf("invalid key ID")
+	}
+
+	var obj attestationObject
+	if err = cbor.Unmarshal(raw, &obj); err != nil {
+		return fmt.Errorf("invalid attestation object: %w", err)
+	}
+
+	// Assertions carry a signature in place of an attestation statement.
+	if obj.Format == "" {
+		return a.verifyAssertion(ctx, raw, keyID, att.RequestHash)
+	}
+
+	if obj.Format != appAttestFormat {
+		return fmt.Errorf("unsupported attestation format %s", obj.Format)
+	}
+
+	credCert, err := a.verifyChain(obj.AttStatement.X5C)
+	if err != nil {
+		return err
+	}
+
+	nonce := sha256.Sum256(append(append([]byte{}, obj.AuthData...), att.RequestHash...))
+	if err = verifyNonce(credCert, nonce[:]); err != nil {
+		return err
+	}
+
+	pubKey, ok := credCert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("unexpected credential public key type")
+	}
+	pubKeyHash := sha256.Sum256(elliptic.Marshal(pubKey.Curve, pubKey.X, pubKey.Y))
+	if !bytes.Equal(pubKeyHash[:], keyID) {
+		return fmt.Errorf("credential public key does not match key ID")
+	}
+
+	data, err := parseAuthData(obj.AuthData)
+	if err != nil {
+		return err
+	}
+
+	appIDHash := sha256.Sum256([]byte(a.appID))
+	if !bytes.Equal(data.rpIDHash, appIDHash[:]) {
+		return fmt.Errorf("attestation is not issued for app ID")
+	}
+
+	if data.counter != 0 {
+		return fmt.Errorf("attestation counter must be 0")
+	}
+
+	isProduction := bytes.Equal(data.aaguid, aaguidProduction)
+	isDevelopment := a.allowDevelopment && bytes.Equal(data.aaguid, aaguidDevelopment)
+	if !isProduction && !isDevelopment {
+		return fmt.Errorf("attestation environment is not accepted")
+	}
+
+	if !bytes.Equal(data.credentialID, keyID) {
+		return fmt.Errorf("credential ID does not match key ID")
+	}
+
+	key, err := json.Marshal(&attestedKey{
+		PublicKey: elliptic.Marshal(pubKey.Curve, pubKey.X, pubKey.Y),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot encode attested key: %w", err)
+	}
+
+	ok, err = a.db.SetNX(ctx, AppAttestKey(keyID), key, 0).Result()
+	if err != nil {
+		return fmt.Errorf("cannot store attested key: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("key is already attested")
+	}
+
+	return nil
+}
+
+// verifyAssertion validates an assertion signed by an attested key.
+// The assertion counter must exceed the counter of the key's last
+// accepted assertion.
+func (a *appAttest) verifyAssertion(ctx context.Context, raw, keyID, requestHash []byte) error {
+	b, err := a.db.Get(ctx, AppAttestKey(keyID)).Bytes()
+	if err == redis.Nil {
+		return fmt.Errorf("key is not attested")
+	}
+	if err != nil {
+		return fmt.Errorf("cannot retrieve attested key: %w", err)
+	}
+
+	var key attestedKey
+	if err = json.Unmarshal(b, &key); err != nil {
+		return fmt.Errorf("invalid attested key: %w", err)
+	}
+
+	var assertion assertionObject
+	if err = cbor.Unmarshal(raw, &assertion); err != nil {
+		return fmt.Errorf("invalid assertion: %w", err)
+	}
+
+	const counterEnd = 37
+	data := assertion.AuthenticatorData
+	if len(data) < counterEnd {
+		return fmt.Errorf("authenticator data is too short")
+	}
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), key.PublicKey)
+	if x == nil {
+		return fmt.Errorf("invalid attested public key")
+	}
+
+	var sig ecdsaSignature
+	if _, err = asn1.Unmarshal(assertion.Signature, &sig); err != nil {
+		return fmt.Errorf("invalid assertion signature: %w", err)
+	}
+
+	nonce := sha256.Sum256(append(append([]byte{}, data...), requestHash...))
+	digest := sha256.Sum256(nonce[:])
+	pubKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	if !ecdsa.Verify(pubKey, digest[:], sig.R, sig.S) {
+		return fmt.Errorf("assertion is not bound to request")
+	}
+
+	appIDHash := sha256.Sum256([]byte(a.appID))
+	if !bytes.Equal(data[0:32], appIDHash[:]) {
+		return fmt.Errorf("assertion is not issued for app ID")
+	}
+
+	counter := binary.BigEndian.Uint32(data[33:counterEnd])
+	if counter <= key.Counter {
+		return fmt.Errorf("assertion counter did not increase")
+	}
+
+	key.Counter = counter
+	b, err = json.Marshal(&key)
+	if err != nil {
+		return fmt.Errorf("cannot encode attested key: %w", err)
+	}
+	if err = a.db.Set(ctx, AppAttestKey(keyID), b, 0).Err(); err != nil {
+		return fmt.Errorf("cannot store attested key: %w", err)
+	}
+
+	return nil
+}
+
+// AppAttestKey is the key holding an attested App Attest key.
+func AppAttestKey(keyID []byte) string {
+	return fmt.Sprintf("attestation_key_%s", base64.RawURLEncoding.EncodeToString(keyID))
+}
+
+func (a *appAttest) verifyChain(x5c [][]byte) (*x509.Certificate, error) {
+	if len(x5c) == 0 {
+		return nil, fmt.Errorf("attestation certificate chain is missing")
+	}
+
+	certs := make([]*x509.Certificate, len(x5c))
+	for i, der := range x5c {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attestation certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         a.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("attestation certificate is not trusted: %w", err)
+	}
+
+	return certs[0], nil
+}
+
+func verifyNonce(cert *x509.Certificate, nonce []byte) error {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(nonceExtensionOID) {
+			continue
+		}
+
+		var n nonceExtension
+		if _, err := asn1.Unmarshal(ext.Value, &n); err != nil {
+			return fmt.Errorf("invalid nonce extension: %w", err)
+		}
+		if !bytes.Equal(n.Nonce, nonce) {
+			return fmt.Errorf("attestation is not bound to request")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("attestation nonce is missing")
+}
+
+// parseAuthData parses authenticator data containing attested
+// credential data. See https://www.w3.org/TR/webauthn/#sctn-authenticator-data
+func parseAuthData(b []byte) (*authData, error) {
+	const credentialIDOffset = 55
+	if len(b) < credentialIDOffset {
+		return nil, fmt.Errorf("authenticator data is too short")
+	}
+
+	idLen := int(binary.BigEndian.Uint16(b[53:55]))
+	if len(b) < credentialIDOffset+idLen {
+		return nil, fmt.Errorf("authenticator data is too short")
+	}
+
+	return &authData{
+		rpIDHash:     b[0:32],
+		counter:      binary.BigEndian.Uint32(b[33:37]),
+		aaguid:       b[37:53],
+		credentialID: b[credentialIDOffset : credentialIDOffset+idLen],
+	}, nil
+}
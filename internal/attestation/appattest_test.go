@@ -0,0 +1,329 @@
+package attestation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/fmitra/authenticator/internal/memstore"
+)
+
+type appAttestFixture struct {
+	appID       string
+	aaguid      []byte
+	counter     uint32
+	requestHash []byte
+	nonceHash   []byte
+}
+
+// newAppAttestFixture creates an attestation object signed by a test
+// root CA. It returns the encoded attestation, key ID, root CA and the
+// attested key.
+func newAppAttestFixture(t *testing.T, f appAttestFixture) (string, string, *x509.CertPool, *ecdsa.PrivateKey) {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to create root key:", err)
+	}
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal("failed to create root certificate:", err)
+	}
+	root, _ := x509.ParseCertificate(rootDER)
+
+	credKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to create credential key:", err)
+	}
+	pubKeyHash := sha256.Sum256(elliptic.Marshal(elliptic.P256(), credKey.X, credKey.Y))
+	keyID := pubKeyHash[:]
+
+	var authData []byte
+	{
+		rpIDHash := sha256.Sum256([]byte(f.appID))
+		counter := make([]byte, 4)
+		binary.BigEndian.PutUint32(counter, f.counter)
+		idLen := make([]byte, 2)
+		binary.BigEndian.PutUint16(idLen, uint16(len(keyID)))
+
+		authData = append(authData, rpIDHash[:]...)
+		authData = append(authData, 0x40)
+		authData = append(authData, counter...)
+		authData = append(authData, f.aaguid...)
+		authData = append(authData, idLen...)
+		authData = append(authData, keyID...)
+	}
+
+	nonceHash := f.nonceHash
+	if nonceHash == nil {
+		nonceHash = f.requestHash
+	}
+	nonce := sha256.Sum256(append(append([]byte{}, authData...), nonceHash...))
+	nonceExt, err := asn1.Marshal(nonceExtension{Nonce: nonce[:]})
+	if err != nil {
+		t.Fatal("failed to marshal nonce:", err)
+	}
+
+	credTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Credential"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{
+			{Id: nonceExtensionOID, Value: nonceExt},
+		},
+	}
+	credDER, err := x509.CreateCertificate(rand.Reader, credTmpl, root, &credKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal("failed to create credential certificate:", err)
+	}
+
+	var obj attestationObject
+	obj.Format = appAttestFormat
+	obj.AttStatement.X5C = [][]byte{credDER}
+	obj.AuthData = authData
+
+	b, err := cbor.Marshal(obj)
+	if err != nil {
+		t.Fatal("failed to marshal attestation object:", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	return base64.StdEncoding.EncodeToString(b), base64.StdEncoding.EncodeToString(keyID), roots, credKey
+}
+
+// newAssertion creates an assertion signed by an attested key.
+func newAssertion(t *testing.T, key *ecdsa.PrivateKey, appID string, counter uint32, requestHash []byte) string {
+	rpIDHash := sha256.Sum256([]byte(appID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, 0x00)
+	c := make([]byte, 4)
+	binary.BigEndian.PutUint32(c, counter)
+	data = append(data, c...)
+
+	nonce := sha256.Sum256(append(append([]byte{}, data...), requestHash...))
+	digest := sha256.Sum256(nonce[:])
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal("failed to sign assertion:", err)
+	}
+	sig, err := asn1.Marshal(ecdsaSignature{R: r, S: s})
+	if err != nil {
+		t.Fatal("failed to marshal signature:", err)
+	}
+
+	b, err := cbor.Marshal(assertionObject{Signature: sig, AuthenticatorData: data})
+	if err != nil {
+		t.Fatal("failed to marshal assertion:", err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestAttestation_AppAttest(t *testing.T) {
+	requestHash := sha256.Sum256([]byte("request-body"))
+
+	tt := []struct {
+		name             string
+		fixture          appAttestFixture
+		allowDevelopment bool
+		useAppleRoot     bool
+		hasErr           bool
+	}{
+		{
+			name: "Valid production attestation",
+			fixture: appAttestFixture{
+				appID:  "ABCDE12345.com.example.app",
+				aaguid: aaguidProduction,
+			},
+		},
+		{
+			name: "Valid development attestation",
+			fixture: appAttestFixture{
+				appID:  "ABCDE12345.com.example.app",
+				aaguid: aaguidDevelopment,
+			},
+			allowDevelopment: true,
+		},
+		{
+			name: "Development attestation not allowed",
+			fixture: appAttestFixture{
+				appID:  "ABCDE12345.com.example.app",
+				aaguid: aaguidDevelopment,
+			},
+			hasErr: true,
+		},
+		{
+			name: "Untrusted certificate",
+			fixture: appAttestFixture{
+				appID:  "ABCDE12345.com.example.app",
+				aaguid: aaguidProduction,
+			},
+			useAppleRoot: true,
+			hasErr:       true,
+		},
+		{
+			name: "Incorrect app ID",
+			fixture: appAttestFixture{
+				appID:  "ABCDE12345.com.example.other",
+				aaguid: aaguidProduction,
+			},
+			hasErr: true,
+		},
+		{
+			name: "Nonce mismatch",
+			fixture: appAttestFixture{
+				appID:     "ABCDE12345.com.example.app",
+				aaguid:    aaguidProduction,
+				nonceHash: []byte("other-request"),
+			},
+			hasErr: true,
+		},
+		{
+			name: "Non zero counter",
+			fixture: appAttestFixture{
+				appID:   "ABCDE12345.com.example.app",
+				aaguid:  aaguidProduction,
+				counter: 1,
+			},
+			hasErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fixture.requestHash = requestHash[:]
+			token, keyID, roots, _ := newAppAttestFixture(t, tc.fixture)
+
+			v := NewAppAttestVerifier("ABCDE12345.com.example.app", tc.allowDevelopment, memstore.New())
+			if !tc.useAppleRoot {
+				v.(*appAttest).roots = roots
+			}
+
+			err := v.Verify(context.Background(), &Attestation{
+				Token:       token,
+				KeyID:       keyID,
+				RequestHash: requestHash[:],
+			})
+			if tc.hasErr && err == nil {
+				t.Error("expected error, not nil")
+			}
+			if !tc.hasErr && err != nil {
+				t.Error("expected nil error:", err)
+			}
+		})
+	}
+}
+
+func TestAttestation_AppAttestAssertion(t *testing.T) {
+	ctx := context.Background()
+	appID := "ABCDE12345.com.example.app"
+	requestHash := sha256.Sum256([]byte("request-body"))
+
+	token, keyID, roots, key := newAppAttestFixture(t, appAttestFixture{
+		appID:       appID,
+		aaguid:      aaguidProduction,
+		requestHash: requestHash[:],
+	})
+
+	v := NewAppAttestVerifier(appID, false, memstore.New())
+	v.(*appAttest).roots = roots
+
+	unknown := newAssertion(t, key, appID, 1, requestHash[:])
+	err := v.Verify(ctx, &Attestation{Token: unknown, KeyID: keyID, RequestHash: requestHash[:]})
+	if err == nil {
+		t.Error("expected error for assertion of unattested key, not nil")
+	}
+
+	attestation := &Attestation{Token: token, KeyID: keyID, RequestHash: requestHash[:]}
+	if err = v.Verify(ctx, attestation); err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	if err = v.Verify(ctx, attestation); err == nil {
+		t.Error("expected error for key attested twice, not nil")
+	}
+
+	otherHash := sha256.Sum256([]byte("other-body"))
+	tt := []struct {
+		name       string
+		appID      string
+		counter    uint32
+		signedHash []byte
+		hasErr     bool
+	}{
+		{
+			name:       "Valid assertion",
+			appID:      appID,
+			counter:    1,
+			signedHash: requestHash[:],
+		},
+		{
+			name:       "Replayed counter",
+			appID:      appID,
+			counter:    1,
+			signedHash: requestHash[:],
+			hasErr:     true,
+		},
+		{
+			name:       "Signed for another request",
+			appID:      appID,
+			counter:    2,
+			signedHash: otherHash[:],
+			hasErr:     true,
+		},
+		{
+			name:       "Incorrect app ID",
+			appID:      "ABCDE12345.com.example.other",
+			counter:    2,
+			signedHash: requestHash[:],
+			hasErr:     true,
+		},
+		{
+			name:       "Increased counter",
+			appID:      appID,
+			counter:    5,
+			signedHash: requestHash[:],
+		},
+		{
+			name:       "Decreased counter",
+			appID:      appID,
+			counter:    3,
+			signedHash: requestHash[:],
+			hasErr:     true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			assertion := newAssertion(t, key, tc.appID, tc.counter, tc.signedHash)
+			err := v.Verify(ctx, &Attestation{Token: assertion, KeyID: keyID, RequestHash: requestHash[:]})
+			if tc.hasErr && err == nil {
+				t.Error("expected error, not nil")
+			}
+			if !tc.hasErr && err != nil {
+				t.Error("expected nil error:", err)
+			}
+		})
+	}
+}
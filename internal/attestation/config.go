@@ -0,0 +1,67 @@
+package attestation
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const defaultChallengeTTL = 5 * time.Minute
+
+// NewService returns a new AttestationService. Without any configured
+// verifiers, attestation is disabled.
+func NewService(options ...ConfigOption) auth.AttestationService {
+	s := service{
+		logger:       log.NewNopLogger(),
+		verifiers:    make(map[string]Verifier),
+		challengeTTL: defaultChallengeTTL,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithRequired rejects requests that do not submit an attestation.
+func WithRequired(required bool) ConfigOption {
+	return func(s *service) {
+		s.required = required
+	}
+}
+
+// WithDB configures the service with a Redis DB to store issued
+// challenges. Attestations are rejected without a DB.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithChallengeTTL configures how long an issued challenge may be
+// used. The default value is 5 minutes.
+func WithChallengeTTL(ttl time.Duration) ConfigOption {
+	return func(s *service) {
+		s.challengeTTL = ttl
+	}
+}
+
+// WithVerifier configures the Verifier for a platform.
+func WithVerifier(platform string, v Verifier) ConfigOption {
+	return func(s *service) {
+		s.verifiers[platform] = v
+	}
+}
@@ -0,0 +1,110 @@
+package attestation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	playIntegrityScope = "https://www.googleapis.com/auth/playintegrity"
+	jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// TokenSource returns an OAuth2 access token for Google APIs.
+type TokenSource func(ctx context.Context) (string, error)
+
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+type accessToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// NewServiceAccountTokenSource returns a TokenSource authenticated with a
+// Google service account JSON key. Access tokens are cached until shortly
+// before they expire.
+func NewServiceAccountTokenSource(key []byte, client *http.Client) (TokenSource, error) {
+	var sa serviceAccount
+	if err := json.Unmarshal(key, &sa); err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(sa.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account private key: %w", err)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var (
+		mu        sync.Mutex
+		token     string
+		expiresAt time.Time
+	)
+
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if token != "" && time.Now().Before(expiresAt) {
+			return token, nil
+		}
+
+		now := time.Now()
+		assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   sa.ClientEmail,
+			"scope": playIntegrityScope,
+			"aud":   sa.TokenURI,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}).SignedString(privateKey)
+		if err != nil {
+			return "", fmt.Errorf("cannot sign token assertion: %w", err)
+		}
+
+		form := url.Values{}
+		form.Set("grant_type", jwtBearerGrantType)
+		form.Set("assertion", assertion)
+
+		req, err := http.NewRequest("POST", sa.TokenURI, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", fmt.Errorf("cannot create token request: %w", err)
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("token request failed: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("unexpected token response: %s", resp.Status)
+		}
+
+		var t accessToken
+		if err = json.NewDecoder(resp.Body).Decode(&t); err != nil {
+			return "", fmt.Errorf("invalid token response: %w", err)
+		}
+
+		token = t.AccessToken
+		expiresAt = now.Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+
+		return token, nil
+	}, nil
+}
@@ -0,0 +1,158 @@
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	playIntegrityURL = "https://playintegrity.googleapis.com"
+	// playRecognized indicates the app binary matches the one
+	// distributed through Google Play.
+	playRecognized = "PLAY_RECOGNIZED"
+	// meetsDeviceIntegrity indicates the app runs on a genuine
+	// Android device with Google Play services.
+	meetsDeviceIntegrity = "MEETS_DEVICE_INTEGRITY"
+	// defaultMaxTokenAge is the maximum age of an integrity token.
+	defaultMaxTokenAge = 5 * time.Minute
+)
+
+type integrityPayload struct {
+	TokenPayloadExternal struct {
+		RequestDetails struct {
+			RequestPackageName string `json:"requestPackageName"`
+			RequestHash        string `json:"requestHash"`
+			Nonce              string `json:"nonce"`
+			TimestampMillis    string `json:"timestampMillis"`
+		} `json:"requestDetails"`
+		AppIntegrity struct {
+			AppRecognitionVerdict string `json:"appRecognitionVerdict"`
+		} `json:"appIntegrity"`
+		DeviceIntegrity struct {
+			DeviceRecognitionVerdict []string `json:"deviceRecognitionVerdict"`
+		} `json:"deviceIntegrity"`
+	} `json:"tokenPayloadExternal"`
+}
+
+type playIntegrity struct {
+	packageName string
+	tokenSource TokenSource
+	client      *http.Client
+	baseURL     string
+	maxAge      time.Duration
+}
+
+// NewPlayIntegrityVerifier returns a Verifier for Google Play Integrity tokens.
+// Tokens are decoded through Google's API and must be issued for the package
+// name, bound to the request hash (as a hex encoded `requestHash` or a base64
+// encoded `nonce`), recognized by Play and issued on a genuine device.
+func NewPlayIntegrityVerifier(packageName string, ts TokenSource, client *http.Client) Verifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &playIntegrity{
+		packageName: packageName,
+		tokenSource: ts,
+		client:      client,
+		baseURL:     playIntegrityURL,
+		maxAge:      defaultMaxTokenAge,
+	}
+}
+
+// Verify decodes and validates a Play Integrity token.
+func (p *playIntegrity) Verify(ctx context.Context, a *Attestation) error {
+	payload, err := p.decode(ctx, a.Token)
+	if err != nil {
+		return err
+	}
+
+	details := payload.TokenPayloadExternal.RequestDetails
+	if details.RequestPackageName != p.packageName {
+		return fmt.Errorf("package name %s is not accepted", details.RequestPackageName)
+	}
+
+	if !p.matchesRequest(details.RequestHash, details.Nonce, a.RequestHash) {
+		return fmt.Errorf("integrity token is not bound to request")
+	}
+
+	ts, err := strconv.ParseInt(details.TimestampMillis, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integrity token timestamp: %w", err)
+	}
+	if time.Since(time.Unix(0, ts*int64(time.Millisecond))) > p.maxAge {
+		return fmt.Errorf("integrity token is expired")
+	}
+
+	verdict := payload.TokenPayloadExternal.AppIntegrity.AppRecognitionVerdict
+	if verdict != playRecognized {
+		return fmt.Errorf("app is not recognized: %s", verdict)
+	}
+
+	for _, v := range payload.TokenPayloadExternal.DeviceIntegrity.DeviceRecognitionVerdict {
+		if v == meetsDeviceIntegrity {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("device does not meet integrity requirements")
+}
+
+func (p *playIntegrity) matchesRequest(requestHash, nonce string, expected []byte) bool {
+	if requestHash != "" {
+		h, err := hex.DecodeString(requestHash)
+		return err == nil && subtle.ConstantTimeCompare(h, expected) == 1
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil {
+		n, err = base64.URLEncoding.DecodeString(nonce)
+	}
+	return err == nil && subtle.ConstantTimeCompare(n, expected) == 1
+}
+
+func (p *playIntegrity) decode(ctx context.Context, token string) (*integrityPayload, error) {
+	accessToken, err := p.tokenSource(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve access token: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]string{"integrity_token": token})
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/v1/%s:decodeIntegrityToken", p.baseURL, p.packageName)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create decode request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("decode request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected decode response: %s", resp.Status)
+	}
+
+	var payload integrityPayload
+	if err = json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid decode response: %w", err)
+	}
+
+	return &payload, nil
+}
@@ -0,0 +1,121 @@
+package attestation
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAttestation_PlayIntegrity(t *testing.T) {
+	requestHash := []byte("request-hash-value")
+	now := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	expired := strconv.FormatInt(time.Now().Add(-time.Hour).UnixNano()/int64(time.Millisecond), 10)
+
+	payload := func(pkg, hash, nonce, ts, app, device string) string {
+		return fmt.Sprintf(`{"tokenPayloadExternal":{
+			"requestDetails":{"requestPackageName":"%s","requestHash":"%s","nonce":"%s","timestampMillis":"%s"},
+			"appIntegrity":{"appRecognitionVerdict":"%s"},
+			"deviceIntegrity":{"deviceRecognitionVerdict":["%s"]}
+		}}`, pkg, hash, nonce, ts, app, device)
+	}
+
+	tt := []struct {
+		name       string
+		statusCode int
+		payload    string
+		hasErr     bool
+	}{
+		{
+			name:       "Valid token with request hash",
+			statusCode: http.StatusOK,
+			payload: payload("com.example.app", hex.EncodeToString(requestHash), "",
+				now, "PLAY_RECOGNIZED", "MEETS_DEVICE_INTEGRITY"),
+		},
+		{
+			name:       "Valid token with nonce",
+			statusCode: http.StatusOK,
+			payload: payload("com.example.app", "", base64.RawURLEncoding.EncodeToString(requestHash),
+				now, "PLAY_RECOGNIZED", "MEETS_DEVICE_INTEGRITY"),
+		},
+		{
+			name:       "Decode failure",
+			statusCode: http.StatusBadRequest,
+			payload:    "{}",
+			hasErr:     true,
+		},
+		{
+			name:       "Incorrect package",
+			statusCode: http.StatusOK,
+			payload: payload("com.example.other", hex.EncodeToString(requestHash), "",
+				now, "PLAY_RECOGNIZED", "MEETS_DEVICE_INTEGRITY"),
+			hasErr: true,
+		},
+		{
+			name:       "Incorrect request hash",
+			statusCode: http.StatusOK,
+			payload: payload("com.example.app", hex.EncodeToString([]byte("other")), "",
+				now, "PLAY_RECOGNIZED", "MEETS_DEVICE_INTEGRITY"),
+			hasErr: true,
+		},
+		{
+			name:       "Expired token",
+			statusCode: http.StatusOK,
+			payload: payload("com.example.app", hex.EncodeToString(requestHash), "",
+				expired, "PLAY_RECOGNIZED", "MEETS_DEVICE_INTEGRITY"),
+			hasErr: true,
+		},
+		{
+			name:       "Unrecognized app",
+			statusCode: http.StatusOK,
+			payload: payload("com.example.app", hex.EncodeToString(requestHash), "",
+				now, "UNRECOGNIZED_VERSION", "MEETS_DEVICE_INTEGRITY"),
+			hasErr: true,
+		},
+		{
+			name:       "Device integrity failure",
+			statusCode: http.StatusOK,
+			payload: payload("com.example.app", hex.EncodeToString(requestHash), "",
+				now, "PLAY_RECOGNIZED", "MEETS_BASIC_INTEGRITY"),
+			hasErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/com.example.app:decodeIntegrityToken" {
+					t.Errorf("incorrect decode path %s", r.URL.Path)
+				}
+				if r.Header.Get("Authorization") != "Bearer access-token" {
+					t.Error("access token not set")
+				}
+				w.WriteHeader(tc.statusCode)
+				_, _ = w.Write([]byte(tc.payload))
+			}))
+			defer srv.Close()
+
+			ts := func(ctx context.Context) (string, error) {
+				return "access-token", nil
+			}
+			v := NewPlayIntegrityVerifier("com.example.app", ts, nil)
+			v.(*playIntegrity).baseURL = srv.URL
+
+			err := v.Verify(context.Background(), &Attestation{
+				Token:       "integrity-token",
+				RequestHash: requestHash,
+			})
+			if tc.hasErr && err == nil {
+				t.Error("expected error, not nil")
+			}
+			if !tc.hasErr && err != nil {
+				t.Error("expected nil error:", err)
+			}
+		})
+	}
+}
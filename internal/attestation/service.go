@@ -0,0 +1,203 @@
+// Package attestation verifies that requests originate from genuine
+// instances of our mobile applications using Google Play Integrity
+// and Apple App Attest.
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
+)
+
+const (
+	// PlatformAndroid identifies attestations from Google Play Integrity.
+	PlatformAndroid = "android"
+	// PlatformIOS identifies attestations from Apple App Attest.
+	PlatformIOS = "ios"
+)
+
+const (
+	platformHeader  = "X-Attestation-Platform"
+	tokenHeader     = "X-Attestation-Token"
+	keyIDHeader     = "X-Attestation-Key-ID"
+	challengeHeader = "X-Attestation-Challenge"
+)
+
+// maxBodySize is the maximum request body size read
+// to compute a request hash.
+const maxBodySize = 1 << 20
+
+// challengeLen is the length in bytes of an attestation challenge.
+const challengeLen = 32
+
+// rediser is a minimal interface for go-redis.
+type rediser interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+}
+
+// Attestation is an attestation submitted by a mobile client.
+type Attestation struct {
+	// Token is a Play Integrity token or a base64 encoded
+	// App Attest attestation object.
+	Token string
+	// KeyID is the base64 encoded App Attest key identifier.
+	// It is not used on Android.
+	KeyID string
+	// RequestHash is the SHA256 hash of a challenge issued by the
+	// service followed by the request body. Clients use it as the
+	// attestation challenge to bind the attestation to the request.
+	RequestHash []byte
+}
+
+// Verifier verifies attestations for a single platform.
+type Verifier interface {
+	// Verify returns an error if an attestation is not genuine.
+	Verify(ctx context.Context, a *Attestation) error
+}
+
+// service is an implementation of auth.AttestationService.
+type service struct {
+	logger       log.Logger
+	required     bool
+	verifiers    map[string]Verifier
+	db           rediser
+	challengeTTL time.Duration
+}
+
+// Challenge issues a single use challenge for a client to bind
+// its next attestation to.
+func (s *service) Challenge(ctx context.Context) (string, error) {
+	if s.db == nil {
+		return "", auth.ErrForbidden("device attestation is disabled")
+	}
+
+	challenge, err := crypto.String(challengeLen)
+	if err != nil {
+		return "", fmt.Errorf("cannot create challenge: %w", err)
+	}
+
+	if err = s.db.Set(ctx, ChallengeKey(challenge), true, s.challengeTTL).Err(); err != nil {
+		return "", fmt.Errorf("cannot store challenge: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// Verify checks the attestation submitted alongside a request. Requests
+// without an attestation are accepted unless attestation is required.
+// Attestations must be bound to an unexpired challenge, which is consumed
+// whether or not the attestation is genuine.
+func (s *service) Verify(ctx context.Context, r *http.Request) error {
+	platform := strings.ToLower(r.Header.Get(platformHeader))
+	if platform == "" {
+		if s.required {
+			return auth.ErrForbidden("device attestation is required")
+		}
+		return nil
+	}
+
+	verifier, ok := s.verifiers[platform]
+	if !ok {
+		return auth.ErrBadRequest("attestation platform is not supported")
+	}
+
+	token := r.Header.Get(tokenHeader)
+	if token == "" {
+		return auth.ErrBadRequest("attestation token is missing")
+	}
+
+	challenge := r.Header.Get(challengeHeader)
+	if err := s.consumeChallenge(ctx, challenge); err != nil {
+		return err
+	}
+
+	requestHash, err := hashBody(r, challenge)
+	if err != nil {
+		return err
+	}
+
+	a := &Attestation{
+		Token:       token,
+		KeyID:       r.Header.Get(keyIDHeader),
+		RequestHash: requestHash,
+	}
+
+	if err = verifier.Verify(ctx, a); err != nil {
+		level.Info(s.logger).Log(
+			"source", "AttestationService.Verify",
+			"platform", platform,
+			"error", err,
+		)
+		return fmt.Errorf("%v: %w", err, auth.ErrForbidden("device attestation failed"))
+	}
+
+	return nil
+}
+
+// consumeChallenge removes a challenge issued by the service. It
+// returns an error if the challenge was not issued, expired or was
+// already used.
+func (s *service) consumeChallenge(ctx context.Context, challenge string) error {
+	if s.db == nil {
+		return auth.ErrForbidden("device attestation is disabled")
+	}
+	if challenge == "" {
+		return auth.ErrBadRequest("attestation challenge is missing")
+	}
+
+	removed, err := s.db.Del(ctx, ChallengeKey(challenge)).Result()
+	if err != nil {
+		return fmt.Errorf("cannot remove challenge: %w", err)
+	}
+	if removed == 0 {
+		return auth.ErrForbidden("attestation challenge is invalid")
+	}
+
+	return nil
+}
+
+// hashBody returns the SHA256 hash of a challenge followed by the
+// request body. The body is restored so it may be read again by the
+// request handler. Bodies larger than maxBodySize are rejected rather
+// than hashed in part.
+func hashBody(r *http.Request, challenge string) ([]byte, error) {
+	h := sha256.New()
+	h.Write([]byte(challenge))
+
+	if r.Body == nil {
+		return h.Sum(nil), nil
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read request body: %w", err)
+	}
+	if len(b) > maxBodySize {
+		return nil, auth.ErrBadRequest("request body is too large")
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	h.Write(b)
+	return h.Sum(nil), nil
+}
+
+// ChallengeKey is the key holding an unused attestation challenge.
+func ChallengeKey(challenge string) string {
+	return fmt.Sprintf("attestation_challenge_%s", challenge)
+}
@@ -0,0 +1,168 @@
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/memstore"
+)
+
+type mockVerifier struct {
+	err         error
+	attestation *Attestation
+}
+
+func (m *mockVerifier) Verify(ctx context.Context, a *Attestation) error {
+	m.attestation = a
+	return m.err
+}
+
+func TestAttestation_Verify(t *testing.T) {
+	tt := []struct {
+		name        string
+		required    bool
+		platform    string
+		token       string
+		challenge   string
+		body        []byte
+		verifierErr error
+		errCode     auth.ErrCode
+	}{
+		{
+			name: "Optional attestation without headers",
+		},
+		{
+			name:     "Required attestation without headers",
+			required: true,
+			errCode:  auth.EForbidden,
+		},
+		{
+			name:      "Unsupported platform",
+			platform:  "windows",
+			token:     "token",
+			challenge: "issued",
+			errCode:   auth.EBadRequest,
+		},
+		{
+			name:      "Missing token",
+			platform:  "android",
+			challenge: "issued",
+			errCode:   auth.EBadRequest,
+		},
+		{
+			name:     "Missing challenge",
+			platform: "android",
+			token:    "token",
+			errCode:  auth.EBadRequest,
+		},
+		{
+			name:      "Unknown challenge",
+			platform:  "android",
+			token:     "token",
+			challenge: "unknown",
+			errCode:   auth.EForbidden,
+		},
+		{
+			name:      "Oversized body",
+			platform:  "android",
+			token:     "token",
+			challenge: "issued",
+			body:      bytes.Repeat([]byte("a"), maxBodySize+1),
+			errCode:   auth.EBadRequest,
+		},
+		{
+			name:        "Verification failure",
+			platform:    "android",
+			token:       "token",
+			challenge:   "issued",
+			verifierErr: fmt.Errorf("device is rooted"),
+			errCode:     auth.EForbidden,
+		},
+		{
+			name:      "Successful verification",
+			required:  true,
+			platform:  "Android",
+			token:     "token",
+			challenge: "issued",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			verifier := &mockVerifier{err: tc.verifierErr}
+			db := memstore.New()
+			svc := NewService(
+				WithRequired(tc.required),
+				WithDB(db),
+				WithVerifier(PlatformAndroid, verifier),
+			)
+
+			challenge, err := svc.Challenge(ctx)
+			if err != nil {
+				t.Fatal("failed to issue challenge:", err)
+			}
+
+			body := tc.body
+			if body == nil {
+				body = []byte(`{"identity":"jane@example.com"}`)
+			}
+			r := httptest.NewRequest("POST", "/api/v1/login", bytes.NewBuffer(body))
+			if tc.platform != "" {
+				r.Header.Set("X-Attestation-Platform", tc.platform)
+			}
+			if tc.token != "" {
+				r.Header.Set("X-Attestation-Token", tc.token)
+			}
+			switch tc.challenge {
+			case "issued":
+				r.Header.Set("X-Attestation-Challenge", challenge)
+			case "unknown":
+				r.Header.Set("X-Attestation-Challenge", "unknown")
+			}
+
+			err = svc.Verify(ctx, r)
+			if auth.ErrorCode(err) != tc.errCode {
+				t.Fatalf("incorrect error code, want '%s' got '%s'", tc.errCode, auth.ErrorCode(err))
+			}
+
+			if tc.errCode == "" || tc.verifierErr != nil {
+				b, err := ioutil.ReadAll(r.Body)
+				if err != nil || !bytes.Equal(b, body) {
+					t.Error("request body was not restored")
+				}
+			}
+
+			if tc.errCode == "" && tc.platform != "" {
+				h := sha256.Sum256(append([]byte(challenge), body...))
+				if !bytes.Equal(verifier.attestation.RequestHash, h[:]) {
+					t.Error("request hash does not match challenge and body")
+				}
+
+				// Challenges may only be used once.
+				r = httptest.NewRequest("POST", "/api/v1/login", bytes.NewBuffer(body))
+				r.Header.Set("X-Attestation-Platform", tc.platform)
+				r.Header.Set("X-Attestation-Token", tc.token)
+				r.Header.Set("X-Attestation-Challenge", challenge)
+				if err = svc.Verify(ctx, r); auth.ErrorCode(err) != auth.EForbidden {
+					t.Errorf("incorrect error code for reused challenge, want '%s' got '%s'",
+						auth.EForbidden, auth.ErrorCode(err))
+				}
+			}
+		})
+	}
+}
+
+func TestAttestation_ChallengeDisabled(t *testing.T) {
+	svc := NewService()
+	_, err := svc.Challenge(context.Background())
+	if auth.ErrorCode(err) != auth.EForbidden {
+		t.Errorf("incorrect error code, want '%s' got '%s'", auth.EForbidden, auth.ErrorCode(err))
+	}
+}
@@ -0,0 +1,37 @@
+package attestationapi
+
+import (
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// NewService returns a new implementation of auth.AttestationAPI.
+func NewService(options ...ConfigOption) auth.AttestationAPI {
+	s := service{
+		logger: log.NewNopLogger(),
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithAttestation configures the service with an AttestationService.
+func WithAttestation(a auth.AttestationService) ConfigOption {
+	return func(s *service) {
+		s.attestation = a
+	}
+}
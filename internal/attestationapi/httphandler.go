@@ -0,0 +1,26 @@
+package attestationapi
+
+import (
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+// SetupHTTPHandler converts a service's public methods
+// to http handlers.
+func SetupHTTPHandler(svc auth.AttestationAPI, router *mux.Router, tokenSvc auth.TokenService, logger log.Logger, lmt httpapi.LimiterFactory) {
+	var handler httpapi.JSONAPIHandler
+	{
+		handler = httpapi.PolicyMiddleware(svc.Challenge, tokenSvc, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"AttestationAPI.Challenge", httpapi.PerMinute, int64(30),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/attestation/challenge", httpHandler).Methods("Post")
+	}
+}
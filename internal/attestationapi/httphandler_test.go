@@ -0,0 +1,78 @@
+package attestationapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestAttestationAPI_Challenge(t *testing.T) {
+	tt := []struct {
+		name        string
+		statusCode  int
+		errMessage  string
+		challengeFn func() (string, error)
+	}{
+		{
+			name:       "Attestation disabled",
+			statusCode: http.StatusForbidden,
+			errMessage: "Device attestation is disabled",
+			challengeFn: func() (string, error) {
+				return "", auth.ErrForbidden("device attestation is disabled")
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			challengeFn: func() (string, error) {
+				return "challenge", nil
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			attestationSvc := &test.AttestationService{ChallengeFn: tc.challengeFn}
+			svc := NewService(WithAttestation(attestationSvc))
+
+			req, err := http.NewRequest("POST", "/api/v1/attestation/challenge", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			SetupHTTPHandler(svc, router, &test.TokenService{}, log.NewNopLogger(), &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+
+			if tc.statusCode == http.StatusOK {
+				var resp challengeResponse
+				if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+					t.Fatal("failed to decode response:", err)
+				}
+				if resp.Challenge != "challenge" {
+					t.Errorf("incorrect challenge, want challenge got %s", resp.Challenge)
+				}
+				return
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+package attestationapi
+
+// challengeResponse is a challenge to bind an attestation to.
+type challengeResponse struct {
+	Challenge string `json:"challenge"`
+}
@@ -0,0 +1,28 @@
+// Package attestationapi provides an HTTP API for mobile clients to
+// retrieve challenges their attestations are bound to.
+package attestationapi
+
+import (
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+type service struct {
+	logger      log.Logger
+	attestation auth.AttestationService
+}
+
+// Challenge issues a single use challenge. Clients hash the challenge
+// followed by the body of their next signup or login request and bind
+// their attestation to the result.
+func (s *service) Challenge(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	challenge, err := s.attestation.Challenge(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return &challengeResponse{Challenge: challenge}, nil
+}
@@ -0,0 +1,79 @@
+// Package branding describes how the service presents itself to Users
+// in messages, web pages and authenticator apps.
+package branding
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+)
+
+const (
+	// DefaultName is the name of the service when none is configured.
+	DefaultName = "Authenticator"
+	// DefaultColor is the accent color when none is configured.
+	DefaultColor = "#2f6fde"
+)
+
+// colorRe matches hex colors and CSS color keywords. Colors are
+// rendered into stylesheets and must not contain anything else.
+var colorRe = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+)$`)
+
+// Brand is the identity of a deployment.
+type Brand struct {
+	// Name is the product name shown to Users.
+	Name string
+	// LogoURL is an absolute HTTPS URL of the product logo. Pages
+	// and messages show the name if it is empty.
+	LogoURL string
+	// Color is the accent color of buttons and links.
+	Color string
+	// SupportEmail is the address Users are asked to contact for
+	// help. It is omitted if empty.
+	SupportEmail string
+}
+
+// Default returns the Brand used when none is configured.
+func Default() Brand {
+	return Brand{
+		Name:  DefaultName,
+		Color: DefaultColor,
+	}
+}
+
+// WithDefaults returns the Brand with empty names and colors set to
+// their defaults.
+func (b Brand) WithDefaults() Brand {
+	if b.Name == "" {
+		b.Name = DefaultName
+	}
+	if b.Color == "" {
+		b.Color = DefaultColor
+	}
+	return b
+}
+
+// Validate returns an error if the logo URL, color or support email
+// is malformed.
+func (b Brand) Validate() error {
+	if b.LogoURL != "" {
+		u, err := url.Parse(b.LogoURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("logo URL %q must be an absolute HTTPS URL", b.LogoURL)
+		}
+	}
+
+	if b.Color != "" && !colorRe.MatchString(b.Color) {
+		return fmt.Errorf("color %q must be a hex color or CSS color name", b.Color)
+	}
+
+	if b.SupportEmail != "" {
+		addr, err := mail.ParseAddress(b.SupportEmail)
+		if err != nil || addr.Address != b.SupportEmail {
+			return fmt.Errorf("support email %q must be an email address", b.SupportEmail)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package branding
+
+import "testing"
+
+func TestBranding_Validate(t *testing.T) {
+	tt := []struct {
+		name    string
+		brand   Brand
+		isValid bool
+	}{
+		{
+			name:    "Default brand",
+			brand:   Default(),
+			isValid: true,
+		},
+		{
+			name: "Complete brand",
+			brand: Brand{
+				Name:         "Acme",
+				LogoURL:      "https://acme.com/logo.png",
+				Color:        "rebeccapurple",
+				SupportEmail: "help@acme.com",
+			},
+			isValid: true,
+		},
+		{
+			name:    "Insecure logo URL",
+			brand:   Brand{LogoURL: "http://acme.com/logo.png"},
+			isValid: false,
+		},
+		{
+			name:    "Relative logo URL",
+			brand:   Brand{LogoURL: "/logo.png"},
+			isValid: false,
+		},
+		{
+			name:    "Color with CSS",
+			brand:   Brand{Color: "red; background: url(https://evil.com)"},
+			isValid: false,
+		},
+		{
+			name:    "Support email with name",
+			brand:   Brand{SupportEmail: "Acme <help@acme.com>"},
+			isValid: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.brand.Validate()
+			if tc.isValid && err != nil {
+				t.Error("expected brand to be valid:", err)
+			}
+			if !tc.isValid && err == nil {
+				t.Error("expected brand to be invalid")
+			}
+		})
+	}
+}
+
+func TestBranding_WithDefaults(t *testing.T) {
+	b := Brand{Name: "Acme"}.WithDefaults()
+	if b.Name != "Acme" || b.Color != DefaultColor {
+		t.Errorf("incorrect brand, got %+v", b)
+	}
+}
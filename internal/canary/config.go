@@ -0,0 +1,62 @@
+package canary
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// NewService returns a new CanaryService. Without a
+// RepositoryManager, no identity is treated as a Canary.
+func NewService(options ...ConfigOption) auth.CanaryService {
+	s := service{
+		logger: log.NewNopLogger(),
+		client: http.DefaultClient,
+		now:    time.Now,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithRepoManager configures the service with a new RepositoryManager.
+func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
+	return func(s *service) {
+		s.repoMngr = repoMngr
+	}
+}
+
+// WithWebhook configures the service to POST alerts as JSON to a URL.
+func WithWebhook(url string, client *http.Client) ConfigOption {
+	return func(s *service) {
+		s.webhookURL = url
+		if client != nil {
+			s.client = client
+		}
+	}
+}
+
+// WithMessaging configures the service to send alerts to email
+// addresses or phone numbers through a MessagingService.
+func WithMessaging(m auth.MessagingService, recipients []string) ConfigOption {
+	return func(s *service) {
+		s.message = m
+		s.recipients = recipients
+	}
+}
@@ -0,0 +1,145 @@
+// Package canary detects login attempts against decoy accounts
+// and alerts operators of leaked credential lists.
+package canary
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+// alertTimeout is the maximum time spent delivering an alert.
+const alertTimeout = time.Second * 10
+
+// Alert describes a login attempt against a Canary.
+type Alert struct {
+	Identity    string    `json:"identity"`
+	Note        string    `json:"note"`
+	IP          string    `json:"ip"`
+	Country     string    `json:"country,omitempty"`
+	City        string    `json:"city,omitempty"`
+	UserAgent   string    `json:"user_agent"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// service is an implementation of auth.CanaryService.
+type service struct {
+	logger     log.Logger
+	repoMngr   auth.RepositoryManager
+	message    auth.MessagingService
+	recipients []string
+	webhookURL string
+	client     *http.Client
+	now        func() time.Time
+}
+
+// Trip reports whether an identity belongs to a Canary. Alerts are
+// delivered in the background so that responses for Canaries are
+// indistinguishable from failed logins against real accounts.
+func (s *service) Trip(ctx context.Context, r *http.Request, identity string) (bool, error) {
+	if s.repoMngr == nil || identity == "" {
+		return false, nil
+	}
+
+	canary, err := s.repoMngr.Canary().ByIdentity(ctx, identity)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot lookup canary: %w", err)
+	}
+
+	a := &Alert{
+		Identity:    canary.Identity,
+		Note:        canary.Note,
+		IP:          httpapi.GetIP(r),
+		UserAgent:   r.UserAgent(),
+		AttemptedAt: s.now(),
+	}
+	if loc := httpapi.GetLocation(r); loc != nil {
+		a.Country = loc.Country
+		a.City = loc.City
+	}
+
+	level.Warn(s.logger).Log(
+		"source", "CanaryService.Trip",
+		"message", "login attempted against canary",
+		"identity", a.Identity,
+		"ip", a.IP,
+	)
+
+	go func() {
+		alertCtx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+		defer cancel()
+		s.alert(alertCtx, a)
+	}()
+
+	return true, nil
+}
+
+// alert delivers an Alert to the webhook and all configured
+// recipients. Delivery failures are logged.
+func (s *service) alert(ctx context.Context, a *Alert) {
+	if s.webhookURL != "" {
+		if err := httpapi.PostJSON(ctx, s.client, s.webhookURL, a); err != nil {
+			level.Error(s.logger).Log(
+				"source", "CanaryService.alert",
+				"message", "failed to deliver webhook alert",
+				"error", err,
+			)
+		}
+	}
+
+	if s.message == nil {
+		return
+	}
+
+	for _, address := range s.recipients {
+		msg := &auth.Message{
+			Type:     auth.CanaryAlert,
+			Delivery: deliveryMethod(address),
+			Address:  address,
+			Vars: map[string]string{
+				"identity": a.Identity,
+				"ip":       a.IP,
+				"location": a.location(),
+			},
+		}
+		if err := s.message.Send(ctx, msg); err != nil {
+			level.Error(s.logger).Log(
+				"source", "CanaryService.alert",
+				"message", "failed to send alert",
+				"error", err,
+			)
+		}
+	}
+}
+
+// location returns the location of the alert in a human readable
+// form for messages.
+func (a *Alert) location() string {
+	loc := auth.GeoLocation{Country: a.Country, City: a.City}
+	if s := loc.String(); s != "" {
+		return s
+	}
+	return "unknown location"
+}
+
+func deliveryMethod(address string) auth.DeliveryMethod {
+	if contactchecker.IsMatrixIDValid(address) {
+		return auth.Matrix
+	}
+	if contactchecker.IsPhoneValid(address) {
+		return auth.Phone
+	}
+	return auth.Email
+}
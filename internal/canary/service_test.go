@@ -0,0 +1,120 @@
+package canary
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestCanarySvc_Trip(t *testing.T) {
+	tt := []struct {
+		name         string
+		identity     string
+		byIdentityFn func() (*auth.Canary, error)
+		isCanary     bool
+		hasErr       bool
+	}{
+		{
+			name:     "Canary identity",
+			identity: "decoy@example.com",
+			byIdentityFn: func() (*auth.Canary, error) {
+				return &auth.Canary{Identity: "decoy@example.com"}, nil
+			},
+			isCanary: true,
+		},
+		{
+			name:     "Regular identity",
+			identity: "jane@example.com",
+			byIdentityFn: func() (*auth.Canary, error) {
+				return nil, sql.ErrNoRows
+			},
+		},
+		{
+			name:     "Repository failure",
+			identity: "jane@example.com",
+			byIdentityFn: func() (*auth.Canary, error) {
+				return nil, fmt.Errorf("connection refused")
+			},
+			hasErr: true,
+		},
+		{
+			name:     "Empty identity",
+			identity: "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			canaryRepo := &test.CanaryRepository{ByIdentityFn: tc.byIdentityFn}
+			repoMngr := &test.RepositoryManager{
+				CanaryFn: func() auth.CanaryRepository {
+					return canaryRepo
+				},
+			}
+			svc := NewService(WithRepoManager(repoMngr))
+
+			r := httptest.NewRequest("POST", "/api/v1/login", nil)
+			isCanary, err := svc.Trip(context.Background(), r, tc.identity)
+			if tc.hasErr != (err != nil) {
+				t.Fatalf("incorrect error result, want error %v got %v", tc.hasErr, err)
+			}
+			if isCanary != tc.isCanary {
+				t.Errorf("incorrect canary result, want %v got %v", tc.isCanary, isCanary)
+			}
+		})
+	}
+}
+
+func TestCanarySvc_Alert(t *testing.T) {
+	received := make(chan Alert, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			t.Error("failed to decode alert:", err)
+		}
+		received <- a
+	}))
+	defer srv.Close()
+
+	messagingSvc := &test.MessagingService{}
+	s := service{
+		logger:     &test.Logger{},
+		client:     srv.Client(),
+		webhookURL: srv.URL,
+		message:    messagingSvc,
+		recipients: []string{"security@example.com", "+15555555555"},
+		now:        time.Now,
+	}
+
+	s.alert(context.Background(), &Alert{
+		Identity: "decoy@example.com",
+		IP:       "127.0.0.1",
+		Country:  "DE",
+		City:     "Berlin",
+	})
+
+	select {
+	case a := <-received:
+		if a.Identity != "decoy@example.com" {
+			t.Errorf("incorrect alert identity, want decoy@example.com got %s", a.Identity)
+		}
+		if a.Country != "DE" || a.City != "Berlin" {
+			t.Errorf("incorrect alert location, want Berlin, DE got %s, %s", a.City, a.Country)
+		}
+	default:
+		t.Error("webhook alert not delivered")
+	}
+
+	if messagingSvc.Calls.Send != 2 {
+		t.Errorf("incorrect MessagingService.Send() call count, want 2 got %v",
+			messagingSvc.Calls.Send)
+	}
+}
@@ -0,0 +1,77 @@
+package clientapp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// defaultRefreshInterval is the default time ClientApplications
+// are cached before being reloaded from storage.
+const defaultRefreshInterval = time.Minute
+
+// defaultLogoutTimeout is the default time allowed for a
+// ClientApplication to acknowledge a logout notification.
+const defaultLogoutTimeout = time.Second * 5
+
+// NewService returns a new ClientApplicationService.
+func NewService(options ...ConfigOption) auth.ClientApplicationService {
+	s := service{
+		logger:          log.NewNopLogger(),
+		refreshInterval: defaultRefreshInterval,
+		client:          &http.Client{Timeout: defaultLogoutTimeout},
+		now:             time.Now,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithRepoManager configures the service with a new RepositoryManager.
+func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
+	return func(s *service) {
+		s.repoMngr = repoMngr
+	}
+}
+
+// WithRefreshInterval configures how long ClientApplications are
+// cached before being reloaded from storage. Changes to registered
+// ClientApplications take effect after this interval.
+func WithRefreshInterval(d time.Duration) ConfigOption {
+	return func(s *service) {
+		s.refreshInterval = d
+	}
+}
+
+// WithLogoutSecret configures the secret back-channel logout
+// notifications are signed with. Notifications are not delivered
+// without a secret.
+func WithLogoutSecret(secret string) ConfigOption {
+	return func(s *service) {
+		s.logoutSecret = []byte(secret)
+	}
+}
+
+// WithHTTPClient configures the client used to deliver
+// back-channel logout notifications.
+func WithHTTPClient(client *http.Client) ConfigOption {
+	return func(s *service) {
+		s.client = client
+	}
+}
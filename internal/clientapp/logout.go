@@ -0,0 +1,121 @@
+package clientapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// SignatureHeader carries the signature of a back-channel logout
+// notification. ClientApplications verify a notification by comparing
+// the header with the HMAC-SHA256 of the request body, keyed by the
+// logout secret, prefixed with "sha256=".
+const SignatureHeader = "X-Authenticator-Signature"
+
+// NotifyLogout delivers a LogoutNotice to the back-channel logout URL
+// of a ClientApplication, or of every ClientApplication if no ID is
+// provided. Notifications are only delivered if a logout secret is
+// configured to sign them.
+func (s *service) NotifyLogout(ctx context.Context, clientID string, notice *auth.LogoutNotice) error {
+	if len(s.logoutSecret) == 0 {
+		return nil
+	}
+
+	urls, err := s.logoutURLs(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(notice)
+	if err != nil {
+		return fmt.Errorf("cannot encode logout notice: %w", err)
+	}
+	signature := Sign(s.logoutSecret, body)
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []string
+	)
+	for _, url := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			if err := s.postLogout(ctx, url, body, signature); err != nil {
+				mu.Lock()
+				errs = append(errs, err.Error())
+				mu.Unlock()
+			}
+		}(url)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return fmt.Errorf("cannot notify client applications of logout: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Sign returns the signature of a back-channel logout notification.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// logoutURLs returns the back-channel logout URLs to notify.
+func (s *service) logoutURLs(ctx context.Context, clientID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		return nil, err
+	}
+
+	urls := []string{}
+	for _, app := range s.apps {
+		if app.LogoutURL == "" || (clientID != "" && app.ID != clientID) {
+			continue
+		}
+		urls = append(urls, app.LogoutURL)
+	}
+	sort.Strings(urls)
+
+	return urls, nil
+}
+
+func (s *service) postLogout(ctx context.Context, url string, body []byte, signature string) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create logout request: %w", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, signature)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("logout request to %s failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected logout response from %s: %s", url, resp.Status)
+	}
+
+	return nil
+}
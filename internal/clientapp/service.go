@@ -0,0 +1,114 @@
+// Package clientapp resolves the ClientApplications requests
+// are made on behalf of.
+package clientapp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+type contextKey string
+
+const clientApplicationContextKey contextKey = "client_application"
+
+// NewContext returns a context carrying a ClientApplication.
+func NewContext(ctx context.Context, app *auth.ClientApplication) context.Context {
+	return context.WithValue(ctx, clientApplicationContextKey, app)
+}
+
+// FromContext returns the ClientApplication a request is made on
+// behalf of or nil if the request did not identify one.
+func FromContext(ctx context.Context) *auth.ClientApplication {
+	app, _ := ctx.Value(clientApplicationContextKey).(*auth.ClientApplication)
+	return app
+}
+
+// service is an implementation of auth.ClientApplicationService.
+// ClientApplications are few and rarely change, so all of them
+// are cached in memory and periodically reloaded.
+type service struct {
+	logger          log.Logger
+	repoMngr        auth.RepositoryManager
+	refreshInterval time.Duration
+	logoutSecret    []byte
+	client          *http.Client
+	now             func() time.Time
+
+	mu       sync.Mutex
+	apps     map[string]*auth.ClientApplication
+	origins  map[string]bool
+	loadedAt time.Time
+}
+
+// ByID retrieves a registered ClientApplication.
+func (s *service) ByID(ctx context.Context, clientID string) (*auth.ClientApplication, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		return nil, err
+	}
+
+	app, ok := s.apps[clientID]
+	if !ok {
+		return nil, auth.ErrBadRequest("client application is invalid")
+	}
+
+	return app, nil
+}
+
+// IsOriginAllowed checks if any registered ClientApplication
+// may be used from an origin.
+func (s *service) IsOriginAllowed(ctx context.Context, origin string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		return false
+	}
+
+	return s.origins[origin]
+}
+
+// load reloads ClientApplications once the refresh interval has
+// elapsed. If reloading fails, previously loaded ClientApplications
+// remain in use. Callers must hold the lock.
+func (s *service) load(ctx context.Context) error {
+	if s.apps != nil && s.now().Sub(s.loadedAt) < s.refreshInterval {
+		return nil
+	}
+
+	apps, err := s.repoMngr.ClientApplication().List(ctx)
+	if err != nil {
+		if s.apps != nil {
+			level.Error(s.logger).Log(
+				"source", "ClientApplicationService.load",
+				"message", "failed to reload client applications",
+				"error", err,
+			)
+			s.loadedAt = s.now()
+			return nil
+		}
+		return fmt.Errorf("cannot load client applications: %w", err)
+	}
+
+	s.apps = make(map[string]*auth.ClientApplication, len(apps))
+	s.origins = make(map[string]bool)
+	for _, app := range apps {
+		s.apps[app.ID] = app
+		for _, origin := range app.AllowedOrigins {
+			s.origins[origin] = true
+		}
+	}
+	s.loadedAt = s.now()
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package clientapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestClientApplicationSvc_ByID(t *testing.T) {
+	now := time.Now()
+	var listErr error
+	appRepo := &test.ClientApplicationRepository{
+		ListFn: func() ([]*auth.ClientApplication, error) {
+			if listErr != nil {
+				return nil, listErr
+			}
+			return []*auth.ClientApplication{
+				{ID: "web", AllowedOrigins: []string{"https://app.example.com"}},
+				{ID: "mobile"},
+			}, nil
+		},
+	}
+	repoMngr := &test.RepositoryManager{
+		ClientApplicationFn: func() auth.ClientApplicationRepository {
+			return appRepo
+		},
+	}
+	svc := NewService(
+		WithRepoManager(repoMngr),
+		WithRefreshInterval(time.Minute),
+	)
+	svc.(*service).now = func() time.Time { return now }
+
+	ctx := context.Background()
+	app, err := svc.ByID(ctx, "web")
+	if err != nil {
+		t.Fatal("failed to retrieve client application:", err)
+	}
+	if app.ID != "web" {
+		t.Errorf("incorrect client application, want %s got %s", "web", app.ID)
+	}
+
+	_, err = svc.ByID(ctx, "desktop")
+	if auth.ErrorCode(err) != auth.EBadRequest {
+		t.Errorf("incorrect error code, want %s got %s", auth.EBadRequest, auth.ErrorCode(err))
+	}
+
+	if !svc.IsOriginAllowed(ctx, "https://app.example.com") {
+		t.Error("expected registered origin to be allowed")
+	}
+	if svc.IsOriginAllowed(ctx, "https://evil.example.com") {
+		t.Error("expected unregistered origin to be rejected")
+	}
+
+	if appRepo.Calls.List != 1 {
+		t.Errorf("incorrect ClientApplicationRepository.List() call count, want %v got %v",
+			1, appRepo.Calls.List)
+	}
+
+	now = now.Add(time.Minute)
+	listErr = fmt.Errorf("connection refused")
+	if _, err = svc.ByID(ctx, "mobile"); err != nil {
+		t.Error("expected cached client applications on reload failure, got:", err)
+	}
+	if appRepo.Calls.List != 2 {
+		t.Errorf("incorrect ClientApplicationRepository.List() call count, want %v got %v",
+			2, appRepo.Calls.List)
+	}
+}
+
+func TestClientApplicationSvc_LoadFailure(t *testing.T) {
+	repoMngr := &test.RepositoryManager{
+		ClientApplicationFn: func() auth.ClientApplicationRepository {
+			return &test.ClientApplicationRepository{
+				ListFn: func() ([]*auth.ClientApplication, error) {
+					return nil, fmt.Errorf("connection refused")
+				},
+			}
+		},
+	}
+	svc := NewService(WithRepoManager(repoMngr))
+
+	ctx := context.Background()
+	if _, err := svc.ByID(ctx, "web"); err == nil {
+		t.Error("expected error when client applications cannot be loaded")
+	}
+	if svc.IsOriginAllowed(ctx, "https://app.example.com") {
+		t.Error("expected origin to be rejected when client applications cannot be loaded")
+	}
+}
+
+func TestClientApplicationSvc_NotifyLogout(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received = map[string]*auth.LogoutNotice{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error("failed to read request:", err)
+		}
+		if sig := r.Header.Get(SignatureHeader); sig != Sign([]byte("logout-secret"), body) {
+			t.Errorf("incorrect signature %s", sig)
+		}
+
+		var notice auth.LogoutNotice
+		if err = json.Unmarshal(body, &notice); err != nil {
+			t.Error("failed to decode notice:", err)
+		}
+
+		mu.Lock()
+		received[r.URL.Path] = &notice
+		mu.Unlock()
+
+		if r.URL.Path == "/failing" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	appRepo := &test.ClientApplicationRepository{
+		ListFn: func() ([]*auth.ClientApplication, error) {
+			return []*auth.ClientApplication{
+				{ID: "web", LogoutURL: server.URL + "/web"},
+				{ID: "mobile", LogoutURL: server.URL + "/mobile"},
+				{ID: "desktop"},
+			}, nil
+		},
+	}
+	repoMngr := &test.RepositoryManager{
+		ClientApplicationFn: func() auth.ClientApplicationRepository {
+			return appRepo
+		},
+	}
+	ctx := context.Background()
+	notice := &auth.LogoutNotice{UserID: "user-id", TokenID: "token-id"}
+
+	unsigned := NewService(WithRepoManager(repoMngr))
+	if err := unsigned.NotifyLogout(ctx, "", notice); err != nil {
+		t.Error("expected nil error without logout secret:", err)
+	}
+	if len(received) != 0 {
+		t.Errorf("expected no notifications without logout secret, got %v", len(received))
+	}
+
+	svc := NewService(
+		WithRepoManager(repoMngr),
+		WithLogoutSecret("logout-secret"),
+	)
+	if err := svc.NotifyLogout(ctx, "web", notice); err != nil {
+		t.Error("failed to notify client application:", err)
+	}
+	if len(received) != 1 || received["/web"] == nil || received["/web"].TokenID != "token-id" {
+		t.Errorf("incorrect notifications received: %v", received)
+	}
+
+	if err := svc.NotifyLogout(ctx, "", &auth.LogoutNotice{UserID: "user-id"}); err != nil {
+		t.Error("failed to notify client applications:", err)
+	}
+	if len(received) != 2 || received["/mobile"] == nil {
+		t.Errorf("incorrect notifications received: %v", received)
+	}
+
+	appRepo.ListFn = func() ([]*auth.ClientApplication, error) {
+		return []*auth.ClientApplication{{ID: "web", LogoutURL: server.URL + "/failing"}}, nil
+	}
+	failing := NewService(
+		WithRepoManager(repoMngr),
+		WithLogoutSecret("logout-secret"),
+	)
+	if err := failing.NotifyLogout(ctx, "", notice); err == nil {
+		t.Error("expected error for failed notification")
+	}
+}
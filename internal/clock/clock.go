@@ -0,0 +1,76 @@
+// Package clock provides the current time to services so that
+// tests may control it and operators may correct for clock skew.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock reports the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// New returns a Clock reporting the system time.
+func New() Clock {
+	return systemClock{}
+}
+
+type offsetClock struct {
+	clock  Clock
+	offset time.Duration
+}
+
+func (c offsetClock) Now() time.Time {
+	return c.clock.Now().Add(c.offset)
+}
+
+// WithOffset returns a Clock shifted from c by offset. A positive
+// offset moves the clock forward. It is intended to compensate for,
+// or reproduce, skew between this host and its clients.
+func WithOffset(c Clock, offset time.Duration) Clock {
+	if offset == 0 {
+		return c
+	}
+	return offsetClock{clock: c, offset: offset}
+}
+
+// Fake is a Clock which only moves when told to, allowing tests
+// to simulate expiry without sleeping. It is safe for concurrent use.
+type Fake struct {
+	mtx sync.Mutex
+	now time.Time
+}
+
+// NewFake returns a Fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the time the clock is set to.
+func (f *Fake) Now() time.Time {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.now
+}
+
+// Set moves the clock to now.
+func (f *Fake) Set(now time.Time) {
+	f.mtx.Lock()
+	f.now = now
+	f.mtx.Unlock()
+}
+
+// Advance moves the clock forward by d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mtx.Lock()
+	f.now = f.now.Add(d)
+	f.mtx.Unlock()
+}
@@ -0,0 +1,49 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock_Fake(t *testing.T) {
+	start := time.Date(2020, 6, 10, 15, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+
+	if !c.Now().Equal(start) {
+		t.Errorf("incorrect time, want %v got %v", start, c.Now())
+	}
+
+	c.Advance(time.Minute)
+	if want := start.Add(time.Minute); !c.Now().Equal(want) {
+		t.Errorf("incorrect time after advance, want %v got %v", want, c.Now())
+	}
+
+	c.Set(start)
+	if !c.Now().Equal(start) {
+		t.Errorf("incorrect time after set, want %v got %v", start, c.Now())
+	}
+}
+
+func TestClock_WithOffset(t *testing.T) {
+	start := time.Date(2020, 6, 10, 15, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+
+	tt := []struct {
+		name   string
+		offset time.Duration
+		want   time.Time
+	}{
+		{name: "No offset", offset: 0, want: start},
+		{name: "Ahead", offset: time.Minute, want: start.Add(time.Minute)},
+		{name: "Behind", offset: -time.Minute, want: start.Add(-time.Minute)},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := WithOffset(fake, tc.offset)
+			if !c.Now().Equal(tc.want) {
+				t.Errorf("incorrect time, want %v got %v", tc.want, c.Now())
+			}
+		})
+	}
+}
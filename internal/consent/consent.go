@@ -0,0 +1,75 @@
+// Package consent determines which policy documents a User must
+// accept before completing login.
+package consent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// Policies maps the name of each required policy document
+// to its latest version.
+type Policies map[string]string
+
+// Parse parses a comma separated list of policy=version pairs
+// (e.g. tos=2020-06-01,privacy=3).
+func Parse(s string) (Policies, error) {
+	policies := Policies{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("policy %q must be in the format policy=version", pair)
+		}
+
+		policy := strings.TrimSpace(parts[0])
+		version := strings.TrimSpace(parts[1])
+		if policy == "" || version == "" {
+			return nil, fmt.Errorf("policy %q must be in the format policy=version", pair)
+		}
+		if _, ok := policies[policy]; ok {
+			return nil, fmt.Errorf("policy %q is declared more than once", policy)
+		}
+
+		policies[policy] = version
+	}
+
+	return policies, nil
+}
+
+// Names returns the names of all required policies in sorted order.
+func (p Policies) Names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pending returns the names of required policies which have not
+// been accepted at their latest version.
+func (p Policies) Pending(consents []*auth.Consent) []string {
+	accepted := make(map[string]bool)
+	for _, c := range consents {
+		if p[c.Policy] == c.Version {
+			accepted[c.Policy] = true
+		}
+	}
+
+	pending := []string{}
+	for _, name := range p.Names() {
+		if !accepted[name] {
+			pending = append(pending, name)
+		}
+	}
+
+	return pending
+}
@@ -0,0 +1,105 @@
+package consent
+
+import (
+	"reflect"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+func TestConsent_Parse(t *testing.T) {
+	tt := []struct {
+		name     string
+		value    string
+		policies Policies
+		hasErr   bool
+	}{
+		{
+			name:     "Empty value",
+			value:    "",
+			policies: Policies{},
+		},
+		{
+			name:  "Multiple policies",
+			value: "tos=2020-06-01, privacy=3",
+			policies: Policies{
+				"tos":     "2020-06-01",
+				"privacy": "3",
+			},
+		},
+		{
+			name:   "Missing version",
+			value:  "tos",
+			hasErr: true,
+		},
+		{
+			name:   "Blank version",
+			value:  "tos=",
+			hasErr: true,
+		},
+		{
+			name:   "Duplicate policy",
+			value:  "tos=1,tos=2",
+			hasErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			policies, err := Parse(tc.value)
+			if tc.hasErr && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !tc.hasErr && err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			if !tc.hasErr && !reflect.DeepEqual(policies, tc.policies) {
+				t.Errorf("incorrect policies, want %v got %v", tc.policies, policies)
+			}
+		})
+	}
+}
+
+func TestConsent_Pending(t *testing.T) {
+	policies := Policies{
+		"tos":     "2",
+		"privacy": "1",
+	}
+
+	tt := []struct {
+		name     string
+		consents []*auth.Consent
+		pending  []string
+	}{
+		{
+			name:    "No consent recorded",
+			pending: []string{"privacy", "tos"},
+		},
+		{
+			name: "Outdated version accepted",
+			consents: []*auth.Consent{
+				{Policy: "tos", Version: "1"},
+				{Policy: "privacy", Version: "1"},
+			},
+			pending: []string{"tos"},
+		},
+		{
+			name: "Latest versions accepted",
+			consents: []*auth.Consent{
+				{Policy: "tos", Version: "1"},
+				{Policy: "tos", Version: "2"},
+				{Policy: "privacy", Version: "1"},
+			},
+			pending: []string{},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			pending := policies.Pending(tc.consents)
+			if !reflect.DeepEqual(pending, tc.pending) {
+				t.Errorf("incorrect pending policies, want %v got %v", tc.pending, pending)
+			}
+		})
+	}
+}
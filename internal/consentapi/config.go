@@ -0,0 +1,53 @@
+package consentapi
+
+import (
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/consent"
+)
+
+// NewService returns a new implementation of auth.ConsentAPI.
+func NewService(options ...ConfigOption) auth.ConsentAPI {
+	s := service{
+		logger:   log.NewNopLogger(),
+		policies: consent.Policies{},
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithRepoManager configures the service with a new RepositoryManager.
+func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
+	return func(s *service) {
+		s.repoMngr = repoMngr
+	}
+}
+
+// WithTokenService configures the service with a TokenService.
+func WithTokenService(t auth.TokenService) ConfigOption {
+	return func(s *service) {
+		s.token = t
+	}
+}
+
+// WithPolicies configures the policies Users are required to accept.
+func WithPolicies(policies consent.Policies) ConfigOption {
+	return func(s *service) {
+		s.policies = policies
+	}
+}
@@ -0,0 +1,35 @@
+package consentapi
+
+import (
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+// SetupHTTPHandler converts a service's public methods
+// to http handlers.
+func SetupHTTPHandler(svc auth.ConsentAPI, router *mux.Router, tokenSvc auth.TokenService, logger log.Logger, lmt httpapi.LimiterFactory) {
+	var handler httpapi.JSONAPIHandler
+	{
+		handler = httpapi.PolicyMiddleware(svc.Accept, tokenSvc, httpapi.ConsentPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"ConsentAPI.Accept", httpapi.PerMinute, int64(10),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/consent", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.Status, tokenSvc, httpapi.ConsentPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"ConsentAPI.Status", httpapi.PerMinute, int64(60),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/consent", httpHandler).Methods("Get")
+	}
+}
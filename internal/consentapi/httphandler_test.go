@@ -0,0 +1,155 @@
+package consentapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/consent"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestConsentAPI_Accept(t *testing.T) {
+	tt := []struct {
+		name            string
+		statusCode      int
+		reqBody         []byte
+		errMessage      string
+		token           *auth.Token
+		byUserIDFn      func() ([]*auth.Consent, error)
+		createCalls     int
+		tokenCreateCall int
+	}{
+		{
+			name:       "Missing policies",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"policies":[]}`),
+			errMessage: "Policies cannot be blank",
+			token:      &auth.Token{UserID: "user-id", State: auth.JWTPreAuthorized},
+		},
+		{
+			name:       "Unknown policy",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"policies":[{"policy":"cookies","version":"1"}]}`),
+			errMessage: "Policy is not recognized",
+			token:      &auth.Token{UserID: "user-id", State: auth.JWTPreAuthorized},
+		},
+		{
+			name:       "Outdated version",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"policies":[{"policy":"tos","version":"1"}]}`),
+			errMessage: "Policy version is not the latest",
+			token:      &auth.Token{UserID: "user-id", State: auth.JWTPreAuthorized},
+		},
+		{
+			name:        "Consent recorded during signup",
+			statusCode:  http.StatusOK,
+			reqBody:     []byte(`{"policies":[{"policy":"tos","version":"2"}]}`),
+			token:       &auth.Token{UserID: "user-id", State: auth.JWTPreAuthorized},
+			createCalls: 1,
+		},
+		{
+			name:       "Consent pending after login",
+			statusCode: http.StatusOK,
+			reqBody:    []byte(`{"policies":[{"policy":"tos","version":"2"}]}`),
+			token: &auth.Token{
+				UserID:          "user-id",
+				State:           auth.JWTAuthorized,
+				ConsentRequired: true,
+			},
+			byUserIDFn: func() ([]*auth.Consent, error) {
+				return []*auth.Consent{{Policy: "tos", Version: "2"}}, nil
+			},
+			createCalls: 1,
+		},
+		{
+			name:       "Consent completed after login",
+			statusCode: http.StatusOK,
+			reqBody: []byte(`{"policies":[
+				{"policy":"tos","version":"2"},
+				{"policy":"privacy","version":"1"}
+			]}`),
+			token: &auth.Token{
+				UserID:          "user-id",
+				State:           auth.JWTAuthorized,
+				ConsentRequired: true,
+			},
+			byUserIDFn: func() ([]*auth.Consent, error) {
+				return []*auth.Consent{
+					{Policy: "tos", Version: "2"},
+					{Policy: "privacy", Version: "1"},
+				}, nil
+			},
+			createCalls:     2,
+			tokenCreateCall: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			consentRepo := &test.ConsentRepository{ByUserIDFn: tc.byUserIDFn}
+			repoMngr := &test.RepositoryManager{
+				ConsentFn: func() auth.ConsentRepository {
+					return consentRepo
+				},
+			}
+			tokenSvc := &test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					return tc.token, nil
+				},
+				CreateFn: func() (*auth.Token, error) {
+					return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+				},
+				SignFn: func() (string, error) {
+					return "jwt-token", nil
+				},
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+				WithTokenService(tokenSvc),
+				WithPolicies(consent.Policies{"tos": "2", "privacy": "1"}),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/consent", bytes.NewBuffer(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			test.SetAuthHeaders(req)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if consentRepo.Calls.Create != tc.createCalls {
+				t.Errorf("incorrect ConsentRepository.Create() call count, want %v got %v",
+					tc.createCalls, consentRepo.Calls.Create)
+			}
+
+			if tokenSvc.Calls.Create != tc.tokenCreateCall {
+				t.Errorf("incorrect TokenService.Create() call count, want %v got %v",
+					tc.tokenCreateCall, tokenSvc.Calls.Create)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
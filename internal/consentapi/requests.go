@@ -0,0 +1,35 @@
+package consentapi
+
+import (
+	"fmt"
+	"net/http"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+type policyVersion struct {
+	Policy  string `json:"policy"`
+	Version string `json:"version"`
+}
+
+type acceptRequest struct {
+	Policies []policyVersion `json:"policies"`
+}
+
+func decodeAcceptRequest(r *http.Request) (*acceptRequest, error) {
+	var req acceptRequest
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	if err := httpapi.DecodeJSON(r, &req); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	if len(req.Policies) == 0 {
+		return nil, auth.ErrInvalidField("policies cannot be blank")
+	}
+
+	return &req, nil
+}
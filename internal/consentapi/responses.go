@@ -0,0 +1,49 @@
+package consentapi
+
+import (
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/consent"
+)
+
+// Response is a success response for ConsentAPI.Accept. A new
+// token is returned once all required policies are accepted by
+// a User whose token required consent.
+type Response struct {
+	Pending []string `json:"pending"`
+	Token   string   `json:"token,omitempty"`
+}
+
+// policyStatus describes a User's acceptance of a required policy.
+type policyStatus struct {
+	Policy     string     `json:"policy"`
+	Version    string     `json:"version"`
+	Accepted   bool       `json:"accepted"`
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty"`
+}
+
+// statusResponse is a success response for ConsentAPI.Status.
+type statusResponse struct {
+	Policies []policyStatus `json:"policies"`
+}
+
+// Create populates a statusResponse with the required policies
+// and a User's Consent.
+func (r *statusResponse) Create(policies consent.Policies, consents []*auth.Consent) {
+	r.Policies = []policyStatus{}
+	for _, name := range policies.Names() {
+		status := policyStatus{
+			Policy:  name,
+			Version: policies[name],
+		}
+		for _, c := range consents {
+			if c.Policy == name && c.Version == status.Version {
+				acceptedAt := c.AcceptedAt
+				status.Accepted = true
+				status.AcceptedAt = &acceptedAt
+			}
+		}
+		r.Policies = append(r.Policies, status)
+	}
+}
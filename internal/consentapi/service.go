@@ -0,0 +1,107 @@
+// Package consentapi provides an HTTP API to record a User's
+// acceptance of policy documents such as the terms of service.
+package consentapi
+
+import (
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/consent"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	tokenLib "github.com/fmitra/authenticator/internal/token"
+)
+
+type service struct {
+	logger   log.Logger
+	repoMngr auth.RepositoryManager
+	token    auth.TokenService
+	policies consent.Policies
+}
+
+// Accept records a User's acceptance of policy versions. It may be
+// called during signup with a pre-authorized token or after login
+// when a token requires consent. Once all required policies are
+// accepted, tokens requiring consent are exchanged for a new token.
+func (s *service) Accept(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+	token := httpapi.GetToken(r)
+
+	req, err := decodeAcceptRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range req.Policies {
+		version, ok := s.policies[p.Policy]
+		if !ok {
+			return nil, auth.ErrInvalidField("policy is not recognized")
+		}
+		if version != p.Version {
+			return nil, auth.ErrInvalidField("policy version is not the latest")
+		}
+	}
+
+	ip := httpapi.GetIP(r)
+	for _, p := range req.Policies {
+		c := &auth.Consent{
+			UserID:    userID,
+			Policy:    p.Policy,
+			Version:   p.Version,
+			IPAddress: ip,
+		}
+		if err = s.repoMngr.Consent().Create(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+
+	consents, err := s.repoMngr.Consent().ByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := Response{Pending: s.policies.Pending(consents)}
+	if !token.ConsentRequired || len(resp.Pending) > 0 {
+		return &resp, nil
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err = s.token.Create(
+		ctx,
+		user,
+		auth.JWTAuthorized,
+		tokenLib.WithRefreshableToken(token),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Token, err = s.token.Sign(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// Status returns the policies a User is required to accept
+// and whether the latest version of each has been accepted.
+func (s *service) Status(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	consents, err := s.repoMngr.Consent().ByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := statusResponse{}
+	resp.Create(s.policies, consents)
+	return &resp, nil
+}
@@ -0,0 +1,127 @@
+package contactapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/deviceapi"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/securitychange"
+	"github.com/fmitra/authenticator/internal/totpapi"
+)
+
+// ApplyChange applies the User's pending security change once its
+// delay has passed. A change may only be applied once.
+func (s *service) ApplyChange(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	if !s.changes.IsEnabled() {
+		return nil, auth.ErrForbidden("delayed security changes are disabled")
+	}
+
+	change, err := s.changes.Pending(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if change == nil {
+		return nil, auth.ErrBadRequest("no security change is pending")
+	}
+
+	if s.now().Before(change.AvailableAt) {
+		return securitychange.NewPendingResponse(change), nil
+	}
+
+	removed, err := s.changes.Remove(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !removed {
+		return nil, auth.ErrBadRequest("no security change is pending")
+	}
+
+	user, err := s.apply(ctx, userID, change)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.respond(ctx, r, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &securitychange.Response{
+		Status:   securitychange.StatusApplied,
+		Change:   change.Type,
+		Response: resp,
+	}, nil
+}
+
+// CancelChange cancels a pending security change with the token
+// delivered to the User.
+func (s *service) CancelChange(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	if !s.changes.IsEnabled() {
+		return nil, auth.ErrForbidden("delayed security changes are disabled")
+	}
+
+	req, err := decodeCancelChangeRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := s.changes.Cancel(ctx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &securitychange.Response{
+		Status: securitychange.StatusCancelled,
+		Change: change.Type,
+	}, nil
+}
+
+// delay delays a security change, notifying the User with a
+// link to cancel it.
+func (s *service) delay(ctx context.Context, user *auth.User, change *auth.PendingChange) (*securitychange.Response, error) {
+	if err := s.changes.Delay(ctx, user, change); err != nil {
+		return nil, err
+	}
+	return securitychange.NewPendingResponse(change), nil
+}
+
+// apply makes a security change take effect.
+func (s *service) apply(ctx context.Context, userID string, change *auth.PendingChange) (*auth.User, error) {
+	switch change.Type {
+	case auth.ChangeEmail:
+		return s.setAddress(ctx, userID, auth.Email, change.Address, change.IsOTPEnabled)
+	case auth.ChangeDisableOTP:
+		return s.repoMngr.User().DisableOTP(ctx, userID, change.DeliveryMethod)
+	case auth.ChangeRemoveAddress:
+		return s.repoMngr.User().RemoveDeliveryMethod(ctx, userID, change.DeliveryMethod)
+	case auth.ChangeRemoveDevice:
+		return deviceapi.RemoveDevice(ctx, s.repoMngr, userID, change.DeviceID)
+	case auth.ChangeDisableTOTP:
+		return totpapi.SetTOTP(ctx, s.repoMngr, userID, false)
+	default:
+		return nil, fmt.Errorf("unknown security change: %s", change.Type)
+	}
+}
+
+// isEmailChange returns true if a verified address replaces
+// the User's existing email address.
+func isEmailChange(user *auth.User, method auth.DeliveryMethod, address string) bool {
+	return method == auth.Email && user.Email.Valid && user.Email.String != address
+}
+
+// isLastOTPMethod returns true if a delivery method is the only one
+// the User receives OTP codes through.
+func isLastOTPMethod(user *auth.User, method auth.DeliveryMethod) bool {
+	if method == auth.Email {
+		return user.IsEmailOTPAllowed && !user.IsPhoneOTPAllowed
+	}
+	return user.IsPhoneOTPAllowed && !user.IsEmailOTPAllowed
+}
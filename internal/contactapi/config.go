@@ -1,15 +1,20 @@
 package contactapi
 
 import (
+	"time"
+
 	"github.com/go-kit/kit/log"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/securitychange"
 )
 
 // NewService returns a new implementation of auth.ContactAPI
 func NewService(options ...ConfigOption) auth.ContactAPI {
 	s := service{
-		logger: log.NewNopLogger(),
+		logger:  log.NewNopLogger(),
+		changes: securitychange.NewService(),
+		now:     time.Now,
 	}
 
 	for _, opt := range options {
@@ -56,3 +61,12 @@ func WithTokenService(t auth.TokenService) ConfigOption {
 		s.token = t
 	}
 }
+
+// WithSecurityChanges configures the service with a SecurityChangeService
+// to delay changing a User's email address or removing their last OTP
+// delivery method. Changes are applied immediately if it is not enabled.
+func WithSecurityChanges(c auth.SecurityChangeService) ConfigOption {
+	return func(s *service) {
+		s.changes = c
+	}
+}
@@ -15,7 +15,7 @@ import (
 func SetupHTTPHandler(svc auth.ContactAPI, router *mux.Router, tokenSvc auth.TokenService, logger log.Logger, lmt httpapi.LimiterFactory) {
 	var handler httpapi.JSONAPIHandler
 	{
-		handler = httpapi.AuthMiddleware(svc.CheckAddress, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.CheckAddress, tokenSvc, httpapi.EnrollmentPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"ContactAPI.CheckAddress", httpapi.PerMinute, int64(10),
 		))
@@ -24,7 +24,7 @@ func SetupHTTPHandler(svc auth.ContactAPI, router *mux.Router, tokenSvc auth.Tok
 		router.HandleFunc("/api/v1/contact/check-address", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Disable, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Disable, tokenSvc, httpapi.AuthorizedPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"ContactAPI.Disable", httpapi.PerMinute, int64(20),
 		))
@@ -33,7 +33,7 @@ func SetupHTTPHandler(svc auth.ContactAPI, router *mux.Router, tokenSvc auth.Tok
 		router.HandleFunc("/api/v1/contact/disable", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Verify, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Verify, tokenSvc, httpapi.EnrollmentPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"ContactAPI.Verify", httpapi.PerMinute, int64(10),
 		))
@@ -42,7 +42,7 @@ func SetupHTTPHandler(svc auth.ContactAPI, router *mux.Router, tokenSvc auth.Tok
 		router.HandleFunc("/api/v1/contact/verify", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Remove, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Remove, tokenSvc, httpapi.AuthorizedPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"ContactAPI.Remove", httpapi.PerMinute, int64(20),
 		))
@@ -51,7 +51,7 @@ func SetupHTTPHandler(svc auth.ContactAPI, router *mux.Router, tokenSvc auth.Tok
 		router.HandleFunc("/api/v1/contact/remove", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Send, tokenSvc, auth.JWTPreAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Send, tokenSvc, httpapi.PreAuthorizedPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"ContactAPI.Send", httpapi.PerMinute, int64(10),
 		))
@@ -59,4 +59,22 @@ func SetupHTTPHandler(svc auth.ContactAPI, router *mux.Router, tokenSvc auth.Tok
 		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusAccepted)
 		router.HandleFunc("/api/v1/contact/send", httpHandler).Methods("Post")
 	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.ApplyChange, tokenSvc, httpapi.EnrollmentPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"ContactAPI.ApplyChange", httpapi.PerMinute, int64(10),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/contact/apply-change", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.CancelChange, tokenSvc, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"ContactAPI.CancelChange", httpapi.PerMinute, int64(10),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/contact/cancel-change", httpHandler).Methods("Post")
+	}
 }
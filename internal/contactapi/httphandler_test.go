@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -16,8 +17,11 @@ import (
 	"github.com/gorilla/mux"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
 	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/memstore"
 	"github.com/fmitra/authenticator/internal/postgres"
+	"github.com/fmitra/authenticator/internal/securitychange"
 	"github.com/fmitra/authenticator/internal/test"
 )
 
@@ -1250,3 +1254,175 @@ func TestContactAPI_Send(t *testing.T) {
 		})
 	}
 }
+
+func TestContactAPI_DelayedChange(t *testing.T) {
+	now := time.Now()
+	cancelToken := &auth.ActionToken{
+		UserID:  "user-id",
+		Purpose: auth.PurposeCancelChange,
+	}
+
+	userRepo := &test.UserRepository{
+		ByIdentityFn: func() (*auth.User, error) {
+			return &auth.User{
+				ID:                "user-id",
+				Email:             sql.NullString{String: "jane@example.com", Valid: true},
+				Phone:             sql.NullString{String: "+6594867353", Valid: true},
+				IsEmailOTPAllowed: true,
+				IsTOTPAllowed:     true,
+			}, nil
+		},
+		RemoveDeliveryMethodFn: func() (*auth.User, error) {
+			return &auth.User{ID: "user-id", IsTOTPAllowed: true}, nil
+		},
+	}
+	repoMngr := &test.RepositoryManager{
+		UserFn: func() auth.UserRepository {
+			return userRepo
+		},
+	}
+	tokenSvc := &test.TokenService{
+		ValidateFn: func() (*auth.Token, error) {
+			return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+		},
+		CreateFn: func() (*auth.Token, error) {
+			return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+		},
+		SignFn: func() (string, error) {
+			return "jwt-token", nil
+		},
+	}
+	actionTokens := &test.ActionTokenService{
+		IssueFn: func() (string, error) {
+			return "cancel-token", nil
+		},
+		ParseFn: func() (*auth.ActionToken, error) {
+			return cancelToken, nil
+		},
+		RedeemFn: func() error {
+			return nil
+		},
+	}
+	msgSvc := &test.MessagingService{}
+	clk := clock.NewFake(now)
+	changes := securitychange.NewService(
+		securitychange.WithClock(clk),
+		securitychange.WithMessaging(msgSvc),
+		securitychange.WithActionTokens(actionTokens),
+		securitychange.WithDB(memstore.New()),
+		securitychange.WithCancelURL("https://example.com/contact/cancel"),
+		securitychange.WithChangeDelay(time.Hour, time.Hour),
+	)
+	svc := NewService(
+		WithRepoManager(repoMngr),
+		WithMessaging(msgSvc),
+		WithTokenService(tokenSvc),
+		WithSecurityChanges(changes),
+	)
+	svc.(*service).now = clk.Now
+
+	router := mux.NewRouter()
+	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+	post := func(path string, body []byte) (*httptest.ResponseRecorder, *securitychange.Response) {
+		req, err := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatal("failed to create request:", err)
+		}
+		test.SetAuthHeaders(req)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var resp securitychange.Response
+		if rr.Code == http.StatusOK {
+			if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal("failed to decode response:", err)
+			}
+		}
+		return rr, &resp
+	}
+	removeBody := []byte(`{"deliveryMethod":"email"}`)
+
+	rr, resp := post("/api/v1/contact/remove", removeBody)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+	if resp.Status != securitychange.StatusPending || resp.Change != auth.ChangeRemoveAddress || resp.Response != nil {
+		t.Errorf("incorrect response, want pending change got %+v", resp)
+	}
+	if resp.AvailableAt == nil || !resp.AvailableAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("incorrect available at, want %v got %v", now.Add(time.Hour), resp.AvailableAt)
+	}
+	if msgSvc.Calls.Send != 1 {
+		t.Errorf("incorrect MessagingService.Send() call count, want 1 got %v", msgSvc.Calls.Send)
+	}
+
+	rr, _ = post("/api/v1/contact/disable", removeBody)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusBadRequest, rr.Code)
+	}
+	if err := test.ValidateErrMessage("A security change is already pending", rr.Body); err != nil {
+		t.Error(err)
+	}
+
+	rr, resp = post("/api/v1/contact/apply-change", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+	if resp.Status != securitychange.StatusPending {
+		t.Errorf("incorrect status, want %s got %s", securitychange.StatusPending, resp.Status)
+	}
+
+	cancelToken.Data = map[string]string{"change_id": "stale-change-id"}
+	rr, _ = post("/api/v1/contact/cancel-change", []byte(`{"token":"cancel-token"}`))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusBadRequest, rr.Code)
+	}
+
+	pending, err := changes.Pending(context.Background(), "user-id")
+	if err != nil || pending == nil {
+		t.Fatal("failed to retrieve pending change:", err)
+	}
+	cancelToken.Data = map[string]string{"change_id": pending.ID}
+	rr, resp = post("/api/v1/contact/cancel-change", []byte(`{"token":"cancel-token"}`))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+	if resp.Status != securitychange.StatusCancelled {
+		t.Errorf("incorrect status, want %s got %s", securitychange.StatusCancelled, resp.Status)
+	}
+
+	clk.Advance(time.Hour)
+	rr, _ = post("/api/v1/contact/apply-change", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusBadRequest, rr.Code)
+	}
+	if err := test.ValidateErrMessage("No security change is pending", rr.Body); err != nil {
+		t.Error(err)
+	}
+
+	rr, _ = post("/api/v1/contact/remove", removeBody)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+
+	clk.Advance(time.Hour)
+	rr, resp = post("/api/v1/contact/apply-change", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+	if resp.Status != securitychange.StatusApplied || resp.Response == nil || resp.Token != "jwt-token" {
+		t.Errorf("incorrect response, want applied change got %+v", resp)
+	}
+	if userRepo.Calls.RemoveDeliveryMethod != 1 {
+		t.Errorf("incorrect UserRepository.RemoveDeliveryMethod() call count, want 1 got %v",
+			userRepo.Calls.RemoveDeliveryMethod)
+	}
+
+	rr, _ = post("/api/v1/contact/apply-change", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("incorrect status code, want %v got %v", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -1,13 +1,12 @@
 package contactapi
 
 import (
-	"encoding/json"
-	"fmt"
 	"net/http"
 	"strings"
 
 	auth "github.com/fmitra/authenticator"
 	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/httpapi"
 )
 
 type verifyRequest struct {
@@ -32,6 +31,19 @@ type sendRequest struct {
 	DeliveryMethod auth.DeliveryMethod `json:"deliveryMethod"`
 }
 
+type cancelChangeRequest struct {
+	Token string `json:"token"`
+}
+
+// isDeliveryMethod returns true if a delivery method is supported.
+func isDeliveryMethod(method auth.DeliveryMethod) bool {
+	return method == auth.Phone || method == auth.Email
+}
+
+func errDeliveryMethod() auth.ErrValidation {
+	return auth.ErrField("deliveryMethod", auth.FieldInvalid, "deliveryMethod must be `phone` or `email`")
+}
+
 func decodeSendRequest(r *http.Request) (*sendRequest, error) {
 	var (
 		req sendRequest
@@ -42,12 +54,12 @@ func decodeSendRequest(r *http.Request) (*sendRequest, error) {
 		return nil, auth.ErrBadRequest("no request body received")
 	}
 
-	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	if err = httpapi.DecodeJSON(r, &req); err != nil {
+		return nil, httpapi.DecodeJSONError(err)
 	}
 
-	if req.DeliveryMethod != auth.Phone && req.DeliveryMethod != auth.Email {
-		return nil, auth.ErrInvalidField("deliveryMethod must be `phone` or `email`")
+	if !isDeliveryMethod(req.DeliveryMethod) {
+		return nil, errDeliveryMethod()
 	}
 
 	return &req, nil
@@ -63,23 +75,29 @@ func decodeDeliveryRequest(r *http.Request) (*deliveryRequest, error) {
 		return nil, auth.ErrBadRequest("no request body received")
 	}
 
-	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	if err = httpapi.DecodeJSON(r, &req); err != nil {
+		return nil, httpapi.DecodeJSONError(err)
 	}
 
-	if req.Address == "" {
-		return nil, auth.ErrInvalidField("address cannot be empty")
+	var errs auth.ErrValidation
+	if !isDeliveryMethod(req.DeliveryMethod) {
+		errs = append(errs, errDeliveryMethod()...)
 	}
-
-	if req.DeliveryMethod != auth.Phone && req.DeliveryMethod != auth.Email {
-		return nil, auth.ErrInvalidField("deliveryMethod must be `phone` or `email`")
+	switch {
+	case req.Address == "":
+		errs = append(errs, auth.FieldError{
+			Field: "address", Code: auth.FieldRequired, Message: "address cannot be empty",
+		})
+	case isDeliveryMethod(req.DeliveryMethod) && !contactchecker.Validator(req.DeliveryMethod)(req.Address):
+		errs = append(errs, auth.FieldError{
+			Field: "address", Code: auth.FieldFormat, Message: "address format is invalid",
+		})
 	}
-
-	if !contactchecker.Validator(req.DeliveryMethod)(req.Address) {
-		return nil, auth.ErrInvalidField("address format is invalid")
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
-	req.Address = strings.ToLower(strings.TrimSpace(req.Address))
+	req.Address = contactchecker.Normalize(req.DeliveryMethod, strings.ToLower(req.Address))
 
 	return &req, nil
 }
@@ -94,12 +112,12 @@ func decodeDeactivateRequest(r *http.Request) (*deactivateRequest, error) {
 		return nil, auth.ErrBadRequest("no request body received")
 	}
 
-	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	if err = httpapi.DecodeJSON(r, &req); err != nil {
+		return nil, httpapi.DecodeJSONError(err)
 	}
 
-	if req.DeliveryMethod != auth.Phone && req.DeliveryMethod != auth.Email {
-		return nil, auth.ErrInvalidField("deliveryMethod must be `phone` or `email`")
+	if !isDeliveryMethod(req.DeliveryMethod) {
+		return nil, errDeliveryMethod()
 	}
 
 	return &req, nil
@@ -115,12 +133,12 @@ func decodeVerifyRequest(r *http.Request) (*verifyRequest, error) {
 		return nil, auth.ErrBadRequest("no request body received")
 	}
 
-	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
-		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	if err = httpapi.DecodeJSON(r, &req); err != nil {
+		return nil, httpapi.DecodeJSONError(err)
 	}
 
 	if req.Code == "" {
-		return nil, auth.ErrInvalidField("code cannot be empty")
+		return nil, auth.ErrField("code", auth.FieldRequired, "code cannot be empty")
 	}
 
 	req.IsOTPEnabled = true
@@ -132,3 +150,24 @@ func decodeVerifyRequest(r *http.Request) (*verifyRequest, error) {
 
 	return &req, nil
 }
+
+func decodeCancelChangeRequest(r *http.Request) (*cancelChangeRequest, error) {
+	var (
+		req cancelChangeRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	if err = httpapi.DecodeJSON(r, &req); err != nil {
+		return nil, httpapi.DecodeJSONError(err)
+	}
+
+	if req.Token == "" {
+		return nil, auth.ErrField("token", auth.FieldRequired, "token cannot be empty")
+	}
+
+	return &req, nil
+}
@@ -208,3 +208,52 @@ func TestContactAPI_DeactivateRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestContactAPI_DeliveryRequestFieldErrors(t *testing.T) {
+	tt := []struct {
+		name    string
+		request []byte
+		fields  auth.ErrValidation
+	}{
+		{
+			name:    "Missing address and deliveryMethod",
+			request: []byte(`{}`),
+			fields: auth.ErrValidation{
+				{Field: "deliveryMethod", Code: auth.FieldInvalid, Message: "deliveryMethod must be `phone` or `email`"},
+				{Field: "address", Code: auth.FieldRequired, Message: "address cannot be empty"},
+			},
+		},
+		{
+			name:    "Invalid address format",
+			request: []byte(`{"address": "not-a-real-email", "deliveryMethod": "email"}`),
+			fields: auth.ErrValidation{
+				{Field: "address", Code: auth.FieldFormat, Message: "address format is invalid"},
+			},
+		},
+		{
+			name:    "Invalid address type",
+			request: []byte(`{"address": 12345, "deliveryMethod": "phone"}`),
+			fields: auth.ErrValidation{
+				{Field: "address", Code: auth.FieldType, Message: "address must be a string"},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := http.NewRequest("GET", "", bytes.NewBuffer(tc.request))
+			if err != nil {
+				t.Fatal("failed to create mock reqeust:", err)
+			}
+
+			_, err = decodeDeliveryRequest(r)
+			fields, ok := auth.DomainError(err).(auth.ErrValidation)
+			if !ok {
+				t.Fatalf("incorrect error, want validation error got %v", err)
+			}
+			if !cmp.Equal(fields, tc.fields) {
+				t.Error(cmp.Diff(fields, tc.fields))
+			}
+		})
+	}
+}
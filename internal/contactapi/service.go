@@ -2,9 +2,11 @@
 package contactapi
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-kit/kit/log"
 
@@ -20,6 +22,8 @@ type service struct {
 	message  auth.MessagingService
 	repoMngr auth.RepositoryManager
 	token    auth.TokenService
+	changes  auth.SecurityChangeService
+	now      func() time.Time
 }
 
 // CheckAddress requests an OTP code to be delivered to the user through a
@@ -76,7 +80,8 @@ func (s *service) CheckAddress(w http.ResponseWriter, r *http.Request) (interfac
 }
 
 // Disable disables a verified email or phone number from receiving OTP codes in
-// the future.
+// the future. If changes are delayed, disabling the User's last OTP delivery
+// method only takes effect once the delay has passed.
 func (s *service) Disable(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	req, err := decodeDeactivateRequest(r)
 	if err != nil {
@@ -86,34 +91,33 @@ func (s *service) Disable(w http.ResponseWriter, r *http.Request) (interface{},
 	ctx := r.Context()
 	userID := httpapi.GetUserID(r)
 
-	user, err := s.repoMngr.User().DisableOTP(ctx, userID, req.DeliveryMethod)
-	if err != nil {
-		return nil, err
-	}
+	if s.changes.IsEnabled() {
+		user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+		if err != nil {
+			return nil, err
+		}
 
-	token := httpapi.GetToken(r)
-	token, err = s.token.Create(
-		ctx,
-		user,
-		auth.JWTAuthorized,
-		tokenLib.WithRefreshableToken(token),
-	)
-	if err != nil {
-		return nil, err
+		if isLastOTPMethod(user, req.DeliveryMethod) {
+			return s.delay(ctx, user, &auth.PendingChange{
+				Type:           auth.ChangeDisableOTP,
+				DeliveryMethod: req.DeliveryMethod,
+			})
+		}
 	}
 
-	signedToken, err := s.token.Sign(ctx, token)
+	user, err := s.repoMngr.User().DisableOTP(ctx, userID, req.DeliveryMethod)
 	if err != nil {
 		return nil, err
 	}
 
-	return &tokenLib.Response{Token: signedToken}, nil
+	return s.respond(ctx, r, user)
 }
 
 // Verify verifies an OTP code sent to an email or phone number. If the delivery
 // address is new to the user, it will be set on the profile. By default, verified
 // addresses are enabled for future OTP code delivery unless the client explicitly
-// says otherwise.
+// says otherwise. If changes are delayed, replacing the User's email address only
+// takes effect once the delay has passed.
 func (s *service) Verify(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	req, err := decodeVerifyRequest(r)
 	if err != nil {
@@ -133,63 +137,34 @@ func (s *service) Verify(w http.ResponseWriter, r *http.Request) (interface{}, e
 		return nil, err
 	}
 
-	txClient, err := s.repoMngr.NewWithTransaction(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	entity, err := txClient.WithAtomic(func() (interface{}, error) {
-		user, err := txClient.User().GetForUpdate(ctx, userID)
+	if s.changes.IsEnabled() {
+		user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
 		if err != nil {
 			return nil, err
 		}
 
-		if otpHash.DeliveryMethod == auth.Phone {
-			user.Phone = sql.NullString{String: otpHash.Address, Valid: true}
-			user.IsPhoneOTPAllowed = req.IsOTPEnabled
+		if isEmailChange(user, otpHash.DeliveryMethod, otpHash.Address) {
+			return s.delay(ctx, user, &auth.PendingChange{
+				Type:           auth.ChangeEmail,
+				DeliveryMethod: auth.Email,
+				Address:        otpHash.Address,
+				IsOTPEnabled:   req.IsOTPEnabled,
+			})
 		}
-
-		if otpHash.DeliveryMethod == auth.Email {
-			user.Email = sql.NullString{String: otpHash.Address, Valid: true}
-			user.IsEmailOTPAllowed = req.IsOTPEnabled
-		}
-
-		if err = txClient.User().Update(ctx, user); err != nil {
-			return nil, err
-		}
-
-		return user, nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf(
-			"%v: %w",
-			err,
-			auth.ErrBadRequest("sorry we can't update your contact details"),
-		)
-	}
-
-	user := entity.(*auth.User)
-	token, err = s.token.Create(
-		ctx,
-		user,
-		auth.JWTAuthorized,
-		tokenLib.WithRefreshableToken(token),
-	)
-	if err != nil {
-		return nil, err
 	}
 
-	signedToken, err := s.token.Sign(ctx, token)
+	user, err := s.setAddress(ctx, userID, otpHash.DeliveryMethod, otpHash.Address, req.IsOTPEnabled)
 	if err != nil {
 		return nil, err
 	}
 
-	return &tokenLib.Response{Token: signedToken}, nil
+	return s.respond(ctx, r, user)
 }
 
 // Remove removes a verified email or phone number from the User's profile. Removed
 // addresses must be re-verified with an OTP code in order to be set back onto the
-// profile.
+// profile. If changes are delayed, removing the User's last OTP delivery address
+// only takes effect once the delay has passed.
 func (s *service) Remove(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	req, err := decodeDeactivateRequest(r)
 	if err != nil {
@@ -199,28 +174,26 @@ func (s *service) Remove(w http.ResponseWriter, r *http.Request) (interface{}, e
 	ctx := r.Context()
 	userID := httpapi.GetUserID(r)
 
-	user, err := s.repoMngr.User().RemoveDeliveryMethod(ctx, userID, req.DeliveryMethod)
-	if err != nil {
-		return nil, err
-	}
+	if s.changes.IsEnabled() {
+		user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+		if err != nil {
+			return nil, err
+		}
 
-	token := httpapi.GetToken(r)
-	token, err = s.token.Create(
-		ctx,
-		user,
-		auth.JWTAuthorized,
-		tokenLib.WithRefreshableToken(token),
-	)
-	if err != nil {
-		return nil, err
+		if isLastOTPMethod(user, req.DeliveryMethod) {
+			return s.delay(ctx, user, &auth.PendingChange{
+				Type:           auth.ChangeRemoveAddress,
+				DeliveryMethod: req.DeliveryMethod,
+			})
+		}
 	}
 
-	signedToken, err := s.token.Sign(ctx, token)
+	user, err := s.repoMngr.User().RemoveDeliveryMethod(ctx, userID, req.DeliveryMethod)
 	if err != nil {
 		return nil, err
 	}
 
-	return &tokenLib.Response{Token: signedToken}, nil
+	return s.respond(ctx, r, user)
 }
 
 // Send allows a user to request an OTP code to be delivered to them through a
@@ -276,3 +249,64 @@ func (s *service) Send(w http.ResponseWriter, r *http.Request) (interface{}, err
 
 	return &tokenLib.Response{Token: signedToken}, nil
 }
+
+// setAddress sets a verified address on a User's profile.
+func (s *service) setAddress(ctx context.Context, userID string, method auth.DeliveryMethod, address string, isOTPEnabled bool) (*auth.User, error) {
+	txClient, err := s.repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entity, err := txClient.WithAtomic(func() (interface{}, error) {
+		user, err := txClient.User().GetForUpdate(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		if method == auth.Phone {
+			user.Phone = sql.NullString{String: address, Valid: true}
+			user.IsPhoneOTPAllowed = isOTPEnabled
+		}
+
+		if method == auth.Email {
+			user.Email = sql.NullString{String: address, Valid: true}
+			user.IsEmailOTPAllowed = isOTPEnabled
+		}
+
+		if err = txClient.User().Update(ctx, user); err != nil {
+			return nil, err
+		}
+
+		return user, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%v: %w",
+			err,
+			auth.ErrBadRequest("sorry we can't update your contact details"),
+		)
+	}
+
+	return entity.(*auth.User), nil
+}
+
+// respond refreshes the request's token to reflect changes
+// to a User's profile.
+func (s *service) respond(ctx context.Context, r *http.Request, user *auth.User) (*tokenLib.Response, error) {
+	token, err := s.token.Create(
+		ctx,
+		user,
+		auth.JWTAuthorized,
+		tokenLib.WithRefreshableToken(httpapi.GetToken(r)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	signedToken, err := s.token.Sign(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenLib.Response{Token: signedToken}, nil
+}
@@ -3,19 +3,41 @@
 package contactchecker
 
 import (
+	"fmt"
+	"net"
 	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/nyaruka/phonenumbers"
+	"golang.org/x/text/unicode/norm"
 
 	auth "github.com/fmitra/authenticator"
 )
 
+// defaultRegion is the region of phone numbers supplied
+// without a country code.
+var defaultRegion = ""
+
+// SetDefaultRegion sets the ISO 3166-1 alpha-2 region of phone numbers
+// supplied without a country code. Without a default region, phone
+// numbers must include a country code. It is expected to be called
+// once during startup.
+func SetDefaultRegion(region string) error {
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if region != "" && phonenumbers.GetCountryCodeForRegion(region) == 0 {
+		return fmt.Errorf("unsupported phone region %q", region)
+	}
+
+	defaultRegion = region
+	return nil
+}
+
 // IsPhoneValid checks if a phone string is a valid format.
 func IsPhoneValid(phone string) bool {
-	// We expect phone numbers to be supplied with valid country
-	// codes. Due to this, we leave country ISO values blank.
-	countryISO := ""
-	meta, err := phonenumbers.Parse(phone, countryISO)
+	meta, err := phonenumbers.Parse(phone, defaultRegion)
 	if err != nil {
 		return false
 	}
@@ -23,13 +45,232 @@ func IsPhoneValid(phone string) bool {
 	return phonenumbers.IsValidNumber(meta)
 }
 
+// ParsePhone parses a phone number and formats it in E.164.
+func ParsePhone(phone string) (string, error) {
+	meta, err := phonenumbers.Parse(phone, defaultRegion)
+	if err != nil {
+		return "", err
+	}
+
+	return phonenumbers.Format(meta, phonenumbers.E164), nil
+}
+
+// PhoneRegion returns the ISO 3166-1 region code of a phone number,
+// e.g. `US`. It is empty if the number cannot be parsed.
+func PhoneRegion(phone string) string {
+	meta, err := phonenumbers.Parse(phone, defaultRegion)
+	if err != nil {
+		return ""
+	}
+
+	return phonenumbers.GetRegionCodeForNumber(meta)
+}
+
+// NormalizePhone formats a phone number in E.164 so the same number
+// supplied in different formats is stored and looked up once. Numbers
+// which cannot be parsed are returned trimmed and are expected to be
+// rejected by IsPhoneValid.
+func NormalizePhone(phone string) string {
+	phone = NormalizeUnicode(phone)
+	if phone == "" {
+		return ""
+	}
+
+	normalized, err := ParsePhone(phone)
+	if err != nil {
+		return phone
+	}
+
+	return normalized
+}
+
+// Normalize normalizes an address for a delivery method. Phone
+// numbers are formatted in E.164.
+func Normalize(method auth.DeliveryMethod, address string) string {
+	if method == auth.Phone {
+		return NormalizePhone(address)
+	}
+
+	return NormalizeUnicode(address)
+}
+
+// NormalizeUnicode applies NFKC normalization to an identity and trims
+// surrounding whitespace, so compatibility characters such as fullwidth
+// letters and digits match their canonical equivalents.
+func NormalizeUnicode(s string) string {
+	return strings.TrimSpace(norm.NFKC.String(s))
+}
+
+// allowedScripts are combinations of scripts commonly used together
+// in a single word, as in the highly restrictive profile of Unicode
+// Technical Standard #39.
+var allowedScripts = []map[string]bool{
+	{"Latin": true, "Han": true, "Hiragana": true, "Katakana": true},
+	{"Latin": true, "Han": true, "Bopomofo": true},
+	{"Latin": true, "Han": true, "Hangul": true},
+}
+
+// IsMixedScript checks if a word combines letters from scripts not
+// commonly used together, such as Latin letters with Cyrillic lookalikes
+// in a homograph of another identity. Characters common to all scripts,
+// such as digits and punctuation, are ignored.
+func IsMixedScript(word string) bool {
+	scripts := make(map[string]bool)
+	for _, r := range word {
+		if script := scriptOf(r); script != "" {
+			scripts[script] = true
+		}
+	}
+	if len(scripts) < 2 {
+		return false
+	}
+
+	for _, allowed := range allowedScripts {
+		isAllowed := true
+		for script := range scripts {
+			if !allowed[script] {
+				isAllowed = false
+				break
+			}
+		}
+		if isAllowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsEmailHomograph checks if the local part or any domain label of an
+// email address mixes scripts. Each part is checked separately so
+// addresses in a single non-Latin script at a Latin domain are allowed.
+func IsEmailHomograph(email string) bool {
+	parts := strings.FieldsFunc(NormalizeUnicode(email), func(r rune) bool {
+		return r == '@' || r == '.'
+	})
+	for _, part := range parts {
+		if IsMixedScript(part) {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptOf returns the script of a rune, or an empty string for
+// characters shared across scripts.
+func scriptOf(r rune) string {
+	if r < unicode.MaxASCII {
+		if unicode.IsLetter(r) {
+			return "Latin"
+		}
+		return ""
+	}
+	if unicode.In(r, unicode.Common, unicode.Inherited) {
+		return ""
+	}
+
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// emailAliases enables matching of Gmail addresses which
+// differ only by dots or a plus suffix.
+var emailAliases = false
+
+// gmailDomains are domains which ignore dots and plus suffixes
+// in the local part of an address.
+var gmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+}
+
+// SetEmailAliases enables matching of Gmail addresses which differ only
+// by dots or a plus suffix, such as jane.doe+news@gmail.com and
+// janedoe@gmail.com. It is expected to be called once during startup.
+func SetEmailAliases(enabled bool) {
+	emailAliases = enabled
+}
+
+// CanonicalEmail returns the form of an email address used to match
+// addresses delivered to the same mailbox. Addresses are NFKC normalized
+// and lowercased and,
+// if alias matching is enabled, dots and plus suffixes are removed from
+// Gmail addresses.
+func CanonicalEmail(email string) string {
+	email = strings.ToLower(NormalizeUnicode(email))
+	if !emailAliases {
+		return email
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+
+	local, domain := email[:at], email[at+1:]
+	if !gmailDomains[domain] {
+		return email
+	}
+
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	local = strings.Replace(local, ".", "", -1)
+
+	return fmt.Sprintf("%s@gmail.com", local)
+}
+
 // IsEmailValid checks if an email string is a valid format.
 func IsEmailValid(email string) bool {
 	_, err := mail.ParseAddress(email)
 	return err == nil
 }
 
-// Validator returns an email or phone validator.
+// matrixLocalpart matches the characters allowed in the localpart
+// of a Matrix user ID.
+var matrixLocalpart = regexp.MustCompile(`^[a-z0-9._=/+-]+$`)
+
+// matrixHostname matches a DNS name or IPv4 address in the server
+// name of a Matrix user ID.
+var matrixHostname = regexp.MustCompile(`^[A-Za-z0-9.-]+$`)
+
+// maxMatrixIDLength is the maximum length of a Matrix user ID.
+const maxMatrixIDLength = 255
+
+// IsMatrixIDValid checks if a Matrix user ID, e.g. `@alice:example.com`,
+// is a valid format.
+func IsMatrixIDValid(matrixID string) bool {
+	if len(matrixID) > maxMatrixIDLength || !strings.HasPrefix(matrixID, "@") {
+		return false
+	}
+
+	parts := strings.SplitN(matrixID[1:], ":", 2)
+	if len(parts) != 2 || !matrixLocalpart.MatchString(parts[0]) {
+		return false
+	}
+
+	host := parts[1]
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return false
+		}
+		host = h
+	}
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return true
+	}
+
+	return matrixHostname.MatchString(host)
+}
+
+// Validator returns an email, phone or Matrix ID validator.
 func Validator(method auth.DeliveryMethod) func(s string) bool {
 	if method == auth.Email {
 		return IsEmailValid
@@ -39,6 +280,10 @@ func Validator(method auth.DeliveryMethod) func(s string) bool {
 		return IsPhoneValid
 	}
 
+	if method == auth.Matrix {
+		return IsMatrixIDValid
+	}
+
 	return func(s string) bool {
 		return false
 	}
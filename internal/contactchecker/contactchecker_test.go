@@ -68,3 +68,269 @@ func TestContactChecker_ValidatesEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestContactChecker_ValidatesMatrixID(t *testing.T) {
+	tt := []struct {
+		name string
+		in   string
+		out  bool
+	}{
+		{
+			name: "Valid Matrix ID",
+			in:   "@jane:example.com",
+			out:  true,
+		},
+		{
+			name: "Valid Matrix ID with port",
+			in:   "@jane.doe:matrix.example.com:8448",
+			out:  true,
+		},
+		{
+			name: "Valid Matrix ID with IPv6 server",
+			in:   "@jane:[2001:db8::1]:8448",
+			out:  true,
+		},
+		{
+			name: "Invalid Matrix ID without sigil",
+			in:   "jane:example.com",
+			out:  false,
+		},
+		{
+			name: "Invalid Matrix ID without server",
+			in:   "@jane",
+			out:  false,
+		},
+		{
+			name: "Invalid Matrix ID with uppercase localpart",
+			in:   "@Jane:example.com",
+			out:  false,
+		},
+		{
+			name: "Invalid Matrix ID with invalid port",
+			in:   "@jane:example.com:port",
+			out:  false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res := Validator(auth.Matrix)(tc.in)
+			if res != tc.out {
+				t.Error("Matrix ID validation failed", cmp.Diff(res, tc.out))
+			}
+		})
+	}
+}
+
+func TestContactChecker_NormalizesPhone(t *testing.T) {
+	tt := []struct {
+		name   string
+		region string
+		in     string
+		out    string
+		valid  bool
+	}{
+		{
+			name:  "Formats international number",
+			in:    "+65 9486 7353",
+			out:   "+6594867353",
+			valid: true,
+		},
+		{
+			name:  "Formats international number with punctuation",
+			in:    " +1 (415) 555-2671 ",
+			out:   "+14155552671",
+			valid: true,
+		},
+		{
+			name:  "Leaves national number without default region",
+			in:    "9486 7353",
+			out:   "9486 7353",
+			valid: false,
+		},
+		{
+			name:   "Formats national number with default region",
+			region: "SG",
+			in:     "9486 7353",
+			out:    "+6594867353",
+			valid:  true,
+		},
+		{
+			name:   "Formats international number with default region",
+			region: "SG",
+			in:     "+1 415 555 2671",
+			out:    "+14155552671",
+			valid:  true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := SetDefaultRegion(tc.region); err != nil {
+				t.Fatal("failed to set default region:", err)
+			}
+			defer func() { _ = SetDefaultRegion("") }()
+
+			out := Normalize(auth.Phone, tc.in)
+			if out != tc.out {
+				t.Error("phone normalization failed", cmp.Diff(out, tc.out))
+			}
+			if valid := IsPhoneValid(tc.in); valid != tc.valid {
+				t.Errorf("incorrect phone validation, want %v got %v", tc.valid, valid)
+			}
+		})
+	}
+}
+
+func TestContactChecker_PhoneRegion(t *testing.T) {
+	for phone, region := range map[string]string{
+		"+14155552671":  "US",
+		"+442071838750": "GB",
+		"not-a-phone":   "",
+	} {
+		if r := PhoneRegion(phone); r != region {
+			t.Errorf("incorrect region for %s, want '%s' got '%s'", phone, region, r)
+		}
+	}
+}
+
+func TestContactChecker_SetDefaultRegion(t *testing.T) {
+	defer func() { _ = SetDefaultRegion("") }()
+
+	if err := SetDefaultRegion("sg"); err != nil {
+		t.Error("expected lowercase region to be accepted:", err)
+	}
+	if err := SetDefaultRegion("XX"); err == nil {
+		t.Error("expected unsupported region to be rejected")
+	}
+}
+
+func TestContactChecker_CanonicalEmail(t *testing.T) {
+	tt := []struct {
+		name    string
+		aliases bool
+		in      string
+		out     string
+	}{
+		{
+			name: "Lowercases address",
+			in:   " Jane.Doe@Example.com ",
+			out:  "jane.doe@example.com",
+		},
+		{
+			name: "Keeps Gmail aliases when disabled",
+			in:   "Jane.Doe+news@gmail.com",
+			out:  "jane.doe+news@gmail.com",
+		},
+		{
+			name:    "Removes Gmail dots and plus suffix",
+			aliases: true,
+			in:      "Jane.Doe+news@gmail.com",
+			out:     "janedoe@gmail.com",
+		},
+		{
+			name:    "Replaces Googlemail domain",
+			aliases: true,
+			in:      "jane.doe@googlemail.com",
+			out:     "janedoe@gmail.com",
+		},
+		{
+			name:    "Keeps aliases of other domains",
+			aliases: true,
+			in:      "jane.doe+news@example.com",
+			out:     "jane.doe+news@example.com",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			SetEmailAliases(tc.aliases)
+			defer SetEmailAliases(false)
+
+			out := CanonicalEmail(tc.in)
+			if out != tc.out {
+				t.Error("email canonicalization failed", cmp.Diff(out, tc.out))
+			}
+		})
+	}
+}
+
+func TestContactChecker_NormalizeUnicode(t *testing.T) {
+	tt := []struct {
+		name   string
+		method auth.DeliveryMethod
+		in     string
+		out    string
+	}{
+		{
+			name:   "Normalizes fullwidth email",
+			method: auth.Email,
+			in:     "ｊａｎｅ@example.com",
+			out:    "jane@example.com",
+		},
+		{
+			name:   "Normalizes composed characters",
+			method: auth.Email,
+			in:     "jose\u0301@example.com",
+			out:    "jos\u00e9@example.com",
+		},
+		{
+			name:   "Normalizes fullwidth phone",
+			method: auth.Phone,
+			in:     "＋６５９４８６７３５３",
+			out:    "+6594867353",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			out := Normalize(tc.method, tc.in)
+			if out != tc.out {
+				t.Error("unicode normalization failed", cmp.Diff(out, tc.out))
+			}
+		})
+	}
+}
+
+func TestContactChecker_IsEmailHomograph(t *testing.T) {
+	tt := []struct {
+		name string
+		in   string
+		out  bool
+	}{
+		{
+			name: "Latin address",
+			in:   "jane.doe+1@example.com",
+			out:  false,
+		},
+		{
+			name: "Cyrillic lookalike in local part",
+			in:   "j\u0430ne@example.com",
+			out:  true,
+		},
+		{
+			name: "Greek lookalike in domain",
+			in:   "jane@ex\u03b1mple.com",
+			out:  true,
+		},
+		{
+			name: "Cyrillic local part at Latin domain",
+			in:   "иван@example.com",
+			out:  false,
+		},
+		{
+			name: "Japanese scripts with Latin",
+			in:   "山田タロウちゃんabc@example.jp",
+			out:  false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			out := IsEmailHomograph(tc.in)
+			if out != tc.out {
+				t.Error("homograph detection failed", cmp.Diff(out, tc.out))
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package deliveryapi
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// NewService returns a new implementation of auth.DeliveryAPI.
+func NewService(options ...ConfigOption) auth.DeliveryAPI {
+	s := service{
+		logger: log.NewNopLogger(),
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithRepoManager configures the service with a new RepositoryManager.
+func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
+	return func(s *service) {
+		s.repoMngr = repoMngr
+	}
+}
+
+// WithTwilio enables Twilio status callbacks. Callbacks are verified
+// with the account's auth token against the configured callback URL.
+func WithTwilio(authToken, callbackURL string) ConfigOption {
+	return func(s *service) {
+		s.twilioToken = authToken
+		s.twilioCallback = callbackURL
+	}
+}
+
+// WithSendGrid enables SendGrid's event webhook. Events are verified
+// with the webhook's public key.
+func WithSendGrid(key *ecdsa.PublicKey) ConfigOption {
+	return func(s *service) {
+		s.sendGridKey = key
+	}
+}
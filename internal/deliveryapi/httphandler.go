@@ -0,0 +1,36 @@
+package deliveryapi
+
+import (
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+// SetupHTTPHandler converts a service's public methods
+// to http handlers. Requests are authenticated by the
+// provider's signature rather than a JWT token.
+func SetupHTTPHandler(svc auth.DeliveryAPI, router *mux.Router, logger log.Logger, lmt httpapi.LimiterFactory) {
+	var handler httpapi.JSONAPIHandler
+	{
+		handler = httpapi.PolicyMiddleware(svc.TwilioStatus, nil, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"DeliveryAPI.TwilioStatus", httpapi.PerMinute, int64(600),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/delivery/twilio", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.SendGridEvents, nil, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"DeliveryAPI.SendGridEvents", httpapi.PerMinute, int64(600),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/delivery/sendgrid", httpHandler).Methods("Post")
+	}
+}
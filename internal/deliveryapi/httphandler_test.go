@@ -0,0 +1,269 @@
+package deliveryapi
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+const (
+	testTwilioToken    = "twilio-token"
+	testTwilioCallback = "https://auth.example.com/api/v1/delivery/twilio"
+)
+
+type statusUpdate struct {
+	id     string
+	status auth.MessageDeliveryStatus
+	detail string
+}
+
+func signTwilio(callback string, form url.Values) string {
+	mac := hmac.New(sha1.New, []byte(testTwilioToken))
+	mac.Write([]byte(callback))
+	for _, k := range []string{"ErrorCode", "MessageSid", "MessageStatus"} {
+		if v, ok := form[k]; ok {
+			mac.Write([]byte(k + v[0]))
+		}
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signSendGrid(t *testing.T, key *ecdsa.PrivateKey, timestamp string, body []byte) string {
+	h := sha256.Sum256(append([]byte(timestamp), body...))
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal("failed to sign payload:", err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal("failed to encode signature:", err)
+	}
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+func TestDeliveryAPI_TwilioStatus(t *testing.T) {
+	tt := []struct {
+		name       string
+		statusCode int
+		errMessage string
+		form       url.Values
+		badSig     bool
+		updates    []statusUpdate
+	}{
+		{
+			name:       "Invalid signature",
+			statusCode: http.StatusForbidden,
+			errMessage: "Signature is invalid",
+			form:       url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"delivered"}},
+			badSig:     true,
+		},
+		{
+			name:       "Delivered message",
+			statusCode: http.StatusOK,
+			form:       url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"delivered"}},
+			updates:    []statusUpdate{{"delivery-id", auth.MessageDelivered, ""}},
+		},
+		{
+			name:       "Undelivered message",
+			statusCode: http.StatusOK,
+			form: url.Values{
+				"MessageSid":    {"SM1"},
+				"MessageStatus": {"undelivered"},
+				"ErrorCode":     {"30003"},
+			},
+			updates: []statusUpdate{{"delivery-id", auth.MessageFailed, "twilio error 30003"}},
+		},
+		{
+			name:       "Intermediate status is ignored",
+			statusCode: http.StatusOK,
+			form:       url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"sending"}},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			var updates []statusUpdate
+			deliveryRepo := &test.MessageDeliveryRepository{
+				UpdateStatusFn: func(id string, status auth.MessageDeliveryStatus, detail string) error {
+					updates = append(updates, statusUpdate{id, status, detail})
+					return nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				MessageDeliveryFn: func() auth.MessageDeliveryRepository {
+					return deliveryRepo
+				},
+			}
+			svc := NewService(
+				WithRepoManager(repoMngr),
+				WithTwilio(testTwilioToken, testTwilioCallback),
+			)
+
+			callback := testTwilioCallback + "?deliveryID=delivery-id"
+			req, err := http.NewRequest("POST", callback, strings.NewReader(tc.form.Encode()))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			signature := signTwilio(callback, tc.form)
+			if tc.badSig {
+				signature = signTwilio(testTwilioCallback, tc.form)
+			}
+			req.Header.Set("X-Twilio-Signature", signature)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Fatalf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+			if tc.statusCode != http.StatusOK {
+				if err = test.ValidateErrMessage(tc.errMessage, rr.Body); err != nil {
+					t.Error(err)
+				}
+			}
+			if len(updates) != len(tc.updates) {
+				t.Fatalf("incorrect updates, want %v got %v", tc.updates, updates)
+			}
+			for i := range updates {
+				if updates[i] != tc.updates[i] {
+					t.Errorf("incorrect update, want %+v got %+v", tc.updates[i], updates[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDeliveryAPI_SendGridEvents(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal("failed to marshal key:", err)
+	}
+	pub, err := ParseSendGridKey(base64.StdEncoding.EncodeToString(der))
+	if err != nil {
+		t.Fatal("failed to parse key:", err)
+	}
+
+	tt := []struct {
+		name       string
+		statusCode int
+		errMessage string
+		reqBody    []byte
+		badSig     bool
+		updates    []statusUpdate
+	}{
+		{
+			name:       "Invalid signature",
+			statusCode: http.StatusForbidden,
+			errMessage: "Signature is invalid",
+			reqBody:    []byte(`[{"event":"delivered","deliveryID":"a"}]`),
+			badSig:     true,
+		},
+		{
+			name:       "Invalid JSON",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Invalid JSON request",
+			reqBody:    []byte(`{"event":`),
+		},
+		{
+			name:       "Events are applied",
+			statusCode: http.StatusOK,
+			reqBody: []byte(`[
+				{"event":"processed","deliveryID":"a","sg_event_id":"1"},
+				{"event":"deferred","deliveryID":"a"},
+				{"event":"bounce","deliveryID":"b","reason":"550 mailbox unavailable"},
+				{"event":"delivered"}
+			]`),
+			updates: []statusUpdate{
+				{"a", auth.MessageSent, ""},
+				{"b", auth.MessageBounced, "550 mailbox unavailable"},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			var updates []statusUpdate
+			deliveryRepo := &test.MessageDeliveryRepository{
+				UpdateStatusFn: func(id string, status auth.MessageDeliveryStatus, detail string) error {
+					updates = append(updates, statusUpdate{id, status, detail})
+					return nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				MessageDeliveryFn: func() auth.MessageDeliveryRepository {
+					return deliveryRepo
+				},
+			}
+			svc := NewService(
+				WithRepoManager(repoMngr),
+				WithSendGrid(pub),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/delivery/sendgrid", bytes.NewBuffer(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			timestamp := "1600000000"
+			signature := signSendGrid(t, key, timestamp, tc.reqBody)
+			if tc.badSig {
+				signature = signSendGrid(t, key, "1600000001", tc.reqBody)
+			}
+			req.Header.Set("X-Twilio-Email-Event-Webhook-Timestamp", timestamp)
+			req.Header.Set("X-Twilio-Email-Event-Webhook-Signature", signature)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Fatalf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+			if tc.statusCode != http.StatusOK {
+				if err = test.ValidateErrMessage(tc.errMessage, rr.Body); err != nil {
+					t.Error(err)
+				}
+			}
+			if len(updates) != len(tc.updates) {
+				t.Fatalf("incorrect updates, want %v got %v", tc.updates, updates)
+			}
+			for i := range updates {
+				if updates[i] != tc.updates[i] {
+					t.Errorf("incorrect update, want %+v got %+v", tc.updates[i], updates[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package deliveryapi
+
+// statusResponse is a success response for DeliveryAPI.TwilioStatus
+// and DeliveryAPI.SendGridEvents.
+type statusResponse struct {
+	Result string `json:"result"`
+}
@@ -0,0 +1,159 @@
+// Package deliveryapi provides an HTTP API for providers to report the
+// status of message deliveries.
+package deliveryapi
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/msgdelivery"
+)
+
+const (
+	twilioSignatureHeader   = "X-Twilio-Signature"
+	sendGridSignatureHeader = "X-Twilio-Email-Event-Webhook-Signature"
+	sendGridTimestampHeader = "X-Twilio-Email-Event-Webhook-Timestamp"
+)
+
+type service struct {
+	logger         log.Logger
+	repoMngr       auth.RepositoryManager
+	twilioToken    string
+	twilioCallback string
+	sendGridKey    *ecdsa.PublicKey
+}
+
+// sendGridEvent is an event reported by SendGrid's event webhook.
+// Custom arguments of the message are returned as top level fields.
+type sendGridEvent struct {
+	Event      string `json:"event"`
+	Reason     string `json:"reason"`
+	DeliveryID string `json:"deliveryID"`
+}
+
+// TwilioStatus receives SMS status callbacks from Twilio. Callbacks
+// must be signed with the account's auth token.
+func (s *service) TwilioStatus(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if s.twilioToken == "" || s.twilioCallback == "" {
+		return nil, auth.ErrNotFound("twilio status callbacks are not enabled")
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid form request"))
+	}
+
+	id := r.URL.Query().Get(msgdelivery.IDParam)
+	callback, err := msgdelivery.CallbackURL(s.twilioCallback, id)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyTwilio(s.twilioToken, callback, r.PostForm, r.Header.Get(twilioSignatureHeader)) {
+		return nil, auth.ErrForbidden("signature is invalid")
+	}
+
+	status, detail, ok := twilioStatus(r.PostForm.Get("MessageStatus"), r.PostForm.Get("ErrorCode"))
+	if ok && id != "" {
+		if err = s.repoMngr.MessageDelivery().UpdateStatus(r.Context(), id, status, detail); err != nil {
+			return nil, err
+		}
+	}
+
+	return &statusResponse{Result: "success"}, nil
+}
+
+// SendGridEvents receives email events from SendGrid's event webhook.
+// Events must be signed with the webhook's verification key.
+func (s *service) SendGridEvents(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if s.sendGridKey == nil {
+		return nil, auth.ErrNotFound("sendgrid events are not enabled")
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("cannot read request body"))
+	}
+
+	ok := verifySendGrid(
+		s.sendGridKey,
+		r.Header.Get(sendGridTimestampHeader),
+		b,
+		r.Header.Get(sendGridSignatureHeader),
+	)
+	if !ok {
+		return nil, auth.ErrForbidden("signature is invalid")
+	}
+
+	// Events are decoded leniently as SendGrid adds fields to
+	// events without notice.
+	var events []sendGridEvent
+	if err = json.Unmarshal(b, &events); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	ctx := r.Context()
+	for _, e := range events {
+		status, ok := sendGridStatus(e.Event)
+		if !ok || e.DeliveryID == "" {
+			continue
+		}
+
+		// SendGrid retries the batch if the request fails. Events
+		// already applied are ignored on retry as updates never
+		// revert a later status.
+		if err = s.repoMngr.MessageDelivery().UpdateStatus(ctx, e.DeliveryID, status, e.Reason); err != nil {
+			level.Error(s.logger).Log(
+				"source", "DeliveryAPI.SendGridEvents",
+				"message", "failed to update message delivery",
+				"delivery_id", e.DeliveryID,
+				"error", err,
+			)
+			return nil, err
+		}
+	}
+
+	return &statusResponse{Result: "success"}, nil
+}
+
+// twilioStatus maps a Twilio message status to a MessageDeliveryStatus.
+// Intermediate statuses are not tracked.
+func twilioStatus(status, errorCode string) (auth.MessageDeliveryStatus, string, bool) {
+	var detail string
+	if errorCode != "" {
+		detail = fmt.Sprintf("twilio error %s", errorCode)
+	}
+
+	switch status {
+	case "sent":
+		return auth.MessageSent, "", true
+	case "delivered":
+		return auth.MessageDelivered, "", true
+	case "undelivered", "failed":
+		return auth.MessageFailed, detail, true
+	default:
+		return "", "", false
+	}
+}
+
+// sendGridStatus maps a SendGrid event to a MessageDeliveryStatus.
+// Engagement and deferral events are not tracked.
+func sendGridStatus(event string) (auth.MessageDeliveryStatus, bool) {
+	switch event {
+	case "processed":
+		return auth.MessageSent, true
+	case "delivered":
+		return auth.MessageDelivered, true
+	case "bounce":
+		return auth.MessageBounced, true
+	case "dropped":
+		return auth.MessageFailed, true
+	default:
+		return "", false
+	}
+}
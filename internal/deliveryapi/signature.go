@@ -0,0 +1,85 @@
+package deliveryapi
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sort"
+)
+
+// ParseSendGridKey parses the base64 encoded public key SendGrid
+// signs event webhook requests with.
+func ParseSendGridKey(s string) (*ecdsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sendgrid key encoding: %w", err)
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sendgrid key: %w", err)
+	}
+
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("sendgrid key is not an ECDSA key")
+	}
+	return key, nil
+}
+
+// verifyTwilio reports whether a Twilio request signature is valid.
+// Twilio signs the callback URL followed by each form parameter's
+// name and value, sorted by name, with HMAC-SHA1.
+func verifyTwilio(token, callback string, form url.Values, signature string) bool {
+	expected, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(expected) == 0 {
+		return false
+	}
+
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	mac := hmac.New(sha1.New, []byte(token))
+	mac.Write([]byte(callback))
+	for _, k := range keys {
+		for _, v := range form[k] {
+			mac.Write([]byte(k + v))
+		}
+	}
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// verifySendGrid reports whether a SendGrid event webhook signature
+// is valid. SendGrid signs the timestamp followed by the raw request
+// body with ECDSA over SHA-256.
+func verifySendGrid(key *ecdsa.PublicKey, timestamp string, body []byte, signature string) bool {
+	der, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || timestamp == "" {
+		return false
+	}
+
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err = asn1.Unmarshal(der, &sig); err != nil {
+		return false
+	}
+	if sig.R == nil || sig.S == nil {
+		return false
+	}
+
+	h := sha256.New()
+	h.Write([]byte(timestamp))
+	h.Write(body)
+	return ecdsa.Verify(key, h.Sum(nil), sig.R, sig.S)
+}
@@ -0,0 +1,51 @@
+package deliverystats
+
+import (
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
+)
+
+const defaultRetention = 30
+
+// NewService returns a new DeliveryStatsService. Without a database,
+// outcomes are not recorded.
+func NewService(options ...ConfigOption) auth.DeliveryStatsService {
+	s := service{
+		retention: defaultRetention,
+		now:       time.Now,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithDB configures the service with a Redis DB.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithClock configures the service with a clock used to date
+// outcomes and expire them after the retention period. Defaults
+// to the system clock.
+func WithClock(c clock.Clock) ConfigOption {
+	return func(s *service) {
+		s.now = c.Now
+	}
+}
+
+// WithRetention configures the number of days outcomes are retained.
+func WithRetention(days int) ConfigOption {
+	return func(s *service) {
+		s.retention = days
+	}
+}
@@ -0,0 +1,105 @@
+// Package deliverystats records the outcome of message deliveries in
+// daily counters for operational dashboards.
+package deliverystats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const dateFormat = "2006-01-02"
+
+// deliveries are the DeliveryMethods reported by Daily.
+var deliveries = []auth.DeliveryMethod{auth.Email, auth.Phone}
+
+// outcomes are the DeliveryOutcomes reported by Daily.
+var outcomes = []auth.DeliveryOutcome{auth.DeliverySent, auth.DeliveryFailed, auth.DeliveryExpired}
+
+// rediser is a minimal interface for go-redis.
+type rediser interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+}
+
+// service is an implementation of auth.DeliveryStatsService backed
+// by redis. Outcomes are counted per UTC day and retained for a
+// limited number of days.
+type service struct {
+	db        rediser
+	retention int
+	now       func() time.Time
+}
+
+// Record records the outcome of an attempt to deliver a Message.
+func (s *service) Record(ctx context.Context, delivery auth.DeliveryMethod, outcome auth.DeliveryOutcome) error {
+	if s.db == nil {
+		return nil
+	}
+
+	key := statsKey(s.now().UTC(), delivery, outcome)
+	if err := s.db.Incr(ctx, key).Err(); err != nil {
+		return fmt.Errorf("cannot record delivery outcome: %w", err)
+	}
+	ttl := time.Hour * 24 * time.Duration(s.retention+1)
+	if err := s.db.Expire(ctx, key, ttl).Err(); err != nil {
+		return fmt.Errorf("cannot record delivery outcome: %w", err)
+	}
+	return nil
+}
+
+// Daily returns the outcomes of delivery attempts on each of the most
+// recent days, oldest first. Days beyond the retention period are
+// not reported.
+func (s *service) Daily(ctx context.Context, days int) ([]*auth.DeliveryStats, error) {
+	if days > s.retention {
+		days = s.retention
+	}
+
+	today := s.now().UTC().Truncate(time.Hour * 24)
+	stats := make([]*auth.DeliveryStats, 0, days*len(deliveries))
+	for i := days - 1; i >= 0; i-- {
+		date := today.AddDate(0, 0, -i)
+		for _, delivery := range deliveries {
+			ds := auth.DeliveryStats{
+				Date:     date,
+				Delivery: delivery,
+				Outcomes: make(map[auth.DeliveryOutcome]int64, len(outcomes)),
+			}
+			for _, outcome := range outcomes {
+				count, err := s.count(ctx, statsKey(date, delivery, outcome))
+				if err != nil {
+					return nil, err
+				}
+				ds.Outcomes[outcome] = count
+			}
+			stats = append(stats, &ds)
+		}
+	}
+
+	return stats, nil
+}
+
+func (s *service) count(ctx context.Context, key string) (int64, error) {
+	if s.db == nil {
+		return 0, nil
+	}
+
+	count, err := s.db.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot retrieve delivery outcomes: %w", err)
+	}
+	return count, nil
+}
+
+func statsKey(date time.Time, delivery auth.DeliveryMethod, outcome auth.DeliveryOutcome) string {
+	return fmt.Sprintf("deliverystats:%s:%s:%s", date.Format(dateFormat), delivery, outcome)
+}
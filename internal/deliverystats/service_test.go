@@ -0,0 +1,75 @@
+package deliverystats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/memstore"
+)
+
+func TestDeliveryStats_Daily(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 6, 10, 15, 0, 0, 0, time.UTC)
+	svc := &service{db: memstore.New(), retention: 7, now: func() time.Time { return now }}
+
+	record := func(delivery auth.DeliveryMethod, outcome auth.DeliveryOutcome, n int) {
+		for i := 0; i < n; i++ {
+			if err := svc.Record(ctx, delivery, outcome); err != nil {
+				t.Fatal("failed to record outcome:", err)
+			}
+		}
+	}
+
+	record(auth.Email, auth.DeliverySent, 3)
+	record(auth.Email, auth.DeliveryFailed, 1)
+	now = now.AddDate(0, 0, -1)
+	record(auth.Phone, auth.DeliveryExpired, 2)
+	now = now.AddDate(0, 0, 1)
+
+	stats, err := svc.Daily(ctx, 2)
+	if err != nil {
+		t.Fatal("failed to retrieve stats:", err)
+	}
+	if len(stats) != 4 {
+		t.Fatalf("incorrect stats count, want 4 got %v", len(stats))
+	}
+
+	tt := []struct {
+		index    int
+		date     string
+		delivery auth.DeliveryMethod
+		outcome  auth.DeliveryOutcome
+		count    int64
+	}{
+		{index: 0, date: "2020-06-09", delivery: auth.Email, outcome: auth.DeliverySent, count: 0},
+		{index: 1, date: "2020-06-09", delivery: auth.Phone, outcome: auth.DeliveryExpired, count: 2},
+		{index: 2, date: "2020-06-10", delivery: auth.Email, outcome: auth.DeliverySent, count: 3},
+		{index: 2, date: "2020-06-10", delivery: auth.Email, outcome: auth.DeliveryFailed, count: 1},
+		{index: 3, date: "2020-06-10", delivery: auth.Phone, outcome: auth.DeliverySent, count: 0},
+	}
+	for _, tc := range tt {
+		ds := stats[tc.index]
+		if ds.Date.Format(dateFormat) != tc.date || ds.Delivery != tc.delivery {
+			t.Errorf("incorrect stats at %v, want %s %s got %s %s",
+				tc.index, tc.date, tc.delivery, ds.Date.Format(dateFormat), ds.Delivery)
+		}
+		if ds.Outcomes[tc.outcome] != tc.count {
+			t.Errorf("incorrect %s count on %s, want %v got %v",
+				tc.outcome, tc.date, tc.count, ds.Outcomes[tc.outcome])
+		}
+	}
+}
+
+func TestDeliveryStats_Retention(t *testing.T) {
+	svc := NewService(WithDB(memstore.New()), WithRetention(3))
+
+	stats, err := svc.Daily(context.Background(), 30)
+	if err != nil {
+		t.Fatal("failed to retrieve stats:", err)
+	}
+	if len(stats) != 6 {
+		t.Errorf("incorrect stats count, want 6 got %v", len(stats))
+	}
+}
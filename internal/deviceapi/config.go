@@ -4,12 +4,14 @@ import (
 	"github.com/go-kit/kit/log"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/securitychange"
 )
 
 // NewService returns a new implementation of auth.DeviceAPI.
 func NewService(options ...ConfigOption) auth.DeviceAPI {
 	s := service{
-		logger: log.NewNopLogger(),
+		logger:  log.NewNopLogger(),
+		changes: securitychange.NewService(),
 	}
 
 	for _, opt := range options {
@@ -49,3 +51,12 @@ func WithTokenService(t auth.TokenService) ConfigOption {
 		s.token = t
 	}
 }
+
+// WithSecurityChanges configures the service with a SecurityChangeService
+// to delay removing a User's last Device. The change is applied immediately if it
+// is not enabled.
+func WithSecurityChanges(c auth.SecurityChangeService) ConfigOption {
+	return func(s *service) {
+		s.changes = c
+	}
+}
@@ -15,7 +15,7 @@ import (
 func SetupHTTPHandler(svc auth.DeviceAPI, router *mux.Router, tokenSvc auth.TokenService, logger log.Logger, lmt httpapi.LimiterFactory) {
 	var handler httpapi.JSONAPIHandler
 	{
-		handler = httpapi.AuthMiddleware(svc.Create, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Create, tokenSvc, httpapi.EnrollmentPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"DeviceAPI.Create", httpapi.PerMinute, int64(20),
 		))
@@ -24,7 +24,7 @@ func SetupHTTPHandler(svc auth.DeviceAPI, router *mux.Router, tokenSvc auth.Toke
 		router.HandleFunc("/api/v1/device", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Verify, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Verify, tokenSvc, httpapi.EnrollmentPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"DeviceAPI.Verify", httpapi.PerMinute, int64(20),
 		))
@@ -33,7 +33,7 @@ func SetupHTTPHandler(svc auth.DeviceAPI, router *mux.Router, tokenSvc auth.Toke
 		router.HandleFunc("/api/v1/device/verify", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Remove, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Remove, tokenSvc, httpapi.AuthorizedPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"DeviceAPI.Remove", httpapi.PerMinute, int64(20),
 		))
@@ -42,7 +42,7 @@ func SetupHTTPHandler(svc auth.DeviceAPI, router *mux.Router, tokenSvc auth.Toke
 		router.HandleFunc("/api/v1/device/{deviceID}", httpHandler).Methods("Delete")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Rename, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Rename, tokenSvc, httpapi.AuthorizedPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"DeviceAPI.Rename", httpapi.PerMinute, int64(20),
 		))
@@ -51,7 +51,7 @@ func SetupHTTPHandler(svc auth.DeviceAPI, router *mux.Router, tokenSvc auth.Toke
 		router.HandleFunc("/api/v1/device/{deviceID}", httpHandler).Methods("Patch")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.List, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.List, tokenSvc, httpapi.EnrollmentPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"DeviceAPI.List", httpapi.PerMinute, int64(60),
 		))
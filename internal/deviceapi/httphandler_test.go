@@ -336,6 +336,8 @@ func TestDeviceAPI_Remove(t *testing.T) {
 		tokenSignFn     func() (string, error)
 		authHeader      bool
 		isDeviceAllowed bool
+		delaysChanges   bool
+		delayCalls      int
 	}{
 		{
 			name:       "Authentication error with no token",
@@ -483,6 +485,79 @@ func TestDeviceAPI_Remove(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:       "Last device removal delayed",
+			statusCode: http.StatusOK,
+			authHeader: true,
+			errMessage: "",
+			tokenValidateFn: func() (*auth.Token, error) {
+				return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+			},
+			user: auth.User{
+				Password: "swordfish",
+				Email: sql.NullString{
+					String: "jane@example.com",
+					Valid:  true,
+				},
+				IsDeviceAllowed: true,
+				IsVerified:      true,
+			},
+			totalDevices:    1,
+			devicePath:      "/api/v1/device/%s",
+			isDeviceAllowed: true,
+			devices: []*auth.Device{
+				{
+					ClientID:  []byte(""),
+					PublicKey: []byte(""),
+					AAGUID:    []byte(""),
+					SignCount: 0,
+				},
+			},
+			delaysChanges: true,
+			delayCalls:    1,
+		},
+		{
+			name:       "Device removal not delayed with devices remaining",
+			statusCode: http.StatusOK,
+			authHeader: true,
+			errMessage: "",
+			tokenCreateFn: func() (*auth.Token, error) {
+				return &auth.Token{CodeHash: "token:1:address:phone"}, nil
+			},
+			tokenSignFn: func() (string, error) {
+				return "token", nil
+			},
+			tokenValidateFn: func() (*auth.Token, error) {
+				return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+			},
+			user: auth.User{
+				Password: "swordfish",
+				Email: sql.NullString{
+					String: "jane@example.com",
+					Valid:  true,
+				},
+				IsDeviceAllowed: true,
+				IsVerified:      true,
+			},
+			totalDevices:    1,
+			devicePath:      "/api/v1/device/%s",
+			isDeviceAllowed: true,
+			devices: []*auth.Device{
+				{
+					ClientID:  []byte(""),
+					PublicKey: []byte(""),
+					AAGUID:    []byte(""),
+					SignCount: 0,
+				},
+				{
+					ClientID:  []byte(""),
+					PublicKey: []byte(""),
+					AAGUID:    []byte(""),
+					SignCount: 0,
+				},
+			},
+			delaysChanges: true,
+		},
 	}
 
 	for _, tc := range tt {
@@ -520,11 +595,17 @@ func TestDeviceAPI_Remove(t *testing.T) {
 				CreateFn: tc.tokenCreateFn,
 				SignFn:   tc.tokenSignFn,
 			}
+			changes := &test.SecurityChangeService{
+				IsEnabledFn: func() bool {
+					return tc.delaysChanges
+				},
+			}
 			svc := NewService(
 				WithLogger(&test.Logger{}),
 				WithWebAuthn(webauthnSvc),
 				WithRepoManager(repoMngr),
 				WithTokenService(tokenSvc),
+				WithSecurityChanges(changes),
 			)
 
 			deviceID := tc.devices[0].ID
@@ -578,6 +659,11 @@ func TestDeviceAPI_Remove(t *testing.T) {
 					user.IsDeviceAllowed,
 				))
 			}
+
+			if changes.Calls.Delay != tc.delayCalls {
+				t.Errorf("incorrect SecurityChangeService.Delay() call count, want %v got %v",
+					tc.delayCalls, changes.Calls.Delay)
+			}
 		})
 	}
 }
@@ -1,12 +1,12 @@
 package deviceapi
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
 )
 
 type renameRequest struct {
@@ -23,7 +23,7 @@ func decodeRenameRequest(r *http.Request) (*renameRequest, error) {
 		return nil, auth.ErrBadRequest("no request body received")
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err = httpapi.DecodeJSON(r, &req)
 	if err != nil {
 		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
 	}
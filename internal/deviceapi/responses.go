@@ -7,11 +7,18 @@ import (
 )
 
 // deviceResponse is the response format for authenticator.Device.
+// BackupEligible and BackedUp distinguish synced passkeys
+// from hardware bound keys. Model and MetadataStatus are
+// resolved from the FIDO Metadata Service at registration.
 type deviceResponse struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	BackupEligible bool      `json:"backupEligible"`
+	BackedUp       bool      `json:"backedUp"`
+	Model          string    `json:"model"`
+	MetadataStatus string    `json:"metadataStatus"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
 }
 
 // listResponse is a success response for DeviceAPI.List
@@ -29,10 +36,14 @@ func (r *listResponse) Create(devices []*auth.Device) {
 	rd := []deviceResponse{}
 	for _, d := range devices {
 		rd = append(rd, deviceResponse{
-			ID:        d.ID,
-			Name:      d.Name,
-			CreatedAt: d.CreatedAt,
-			UpdatedAt: d.UpdatedAt,
+			ID:             d.ID,
+			Name:           d.Name,
+			BackupEligible: d.BackupEligible,
+			BackedUp:       d.BackedUp,
+			Model:          d.Model,
+			MetadataStatus: d.MetadataStatus,
+			CreatedAt:      d.CreatedAt,
+			UpdatedAt:      d.UpdatedAt,
 		})
 	}
 	r.Devices = rd
@@ -42,6 +53,10 @@ func (r *listResponse) Create(devices []*auth.Device) {
 func (r *singleResponse) Create(device *auth.Device) {
 	r.Device.ID = device.ID
 	r.Device.Name = device.Name
+	r.Device.BackupEligible = device.BackupEligible
+	r.Device.BackedUp = device.BackedUp
+	r.Device.Model = device.Model
+	r.Device.MetadataStatus = device.MetadataStatus
 	r.Device.CreatedAt = device.CreatedAt
 	r.Device.UpdatedAt = device.UpdatedAt
 }
@@ -2,6 +2,7 @@
 package deviceapi
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -10,6 +11,7 @@ import (
 
 	auth "github.com/fmitra/authenticator"
 	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/securitychange"
 	tokenLib "github.com/fmitra/authenticator/internal/token"
 )
 
@@ -18,6 +20,7 @@ type service struct {
 	webauthn auth.WebAuthnService
 	repoMngr auth.RepositoryManager
 	token    auth.TokenService
+	changes  auth.SecurityChangeService
 }
 
 // Create is an initial request to add a new Device for a User.
@@ -67,7 +70,8 @@ func (s *service) Verify(w http.ResponseWriter, r *http.Request) (interface{}, e
 	return &tokenLib.Response{Token: signedToken}, nil
 }
 
-// Remove removes a Device associated with a User.
+// Remove removes a Device associated with a User. If changes are delayed,
+// removing the User's last Device only takes effect once the delay has passed.
 func (s *service) Remove(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	ctx := r.Context()
 	userID := httpapi.GetUserID(r)
@@ -82,34 +86,28 @@ func (s *service) Remove(w http.ResponseWriter, r *http.Request) (interface{}, e
 		return nil, auth.ErrBadRequest("no devices found")
 	}
 
-	txClient, err := s.repoMngr.NewWithTransaction(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	entity, err := txClient.WithAtomic(func() (interface{}, error) {
-		user, err := txClient.User().GetForUpdate(ctx, userID)
+	if s.changes.IsEnabled() && len(devices) == 1 && devices[0].ID == deviceID {
+		user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
 		if err != nil {
 			return nil, err
 		}
 
-		isDeviceAllowed := len(devices) > 1
-		if err = txClient.Device().Remove(ctx, deviceID, userID); err != nil {
-			return nil, err
+		change := &auth.PendingChange{
+			Type:     auth.ChangeRemoveDevice,
+			DeviceID: deviceID,
 		}
-
-		user.IsDeviceAllowed = isDeviceAllowed
-		if err = txClient.User().Update(ctx, user); err != nil {
+		if err = s.changes.Delay(ctx, user, change); err != nil {
 			return nil, err
 		}
 
-		return user, err
-	})
+		return securitychange.NewPendingResponse(change), nil
+	}
+
+	user, err := RemoveDevice(ctx, s.repoMngr, userID, deviceID)
 	if err != nil {
 		return nil, err
 	}
 
-	user := entity.(*auth.User)
 	token := httpapi.GetToken(r)
 
 	token, err = s.token.Create(
@@ -189,3 +187,40 @@ func (s *service) Rename(w http.ResponseWriter, r *http.Request) (interface{}, e
 
 	return resp, nil
 }
+
+// RemoveDevice removes a User's Device, disabling WebAuthn
+// if no other Device remains.
+func RemoveDevice(ctx context.Context, repoMngr auth.RepositoryManager, userID, deviceID string) (*auth.User, error) {
+	txClient, err := repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entity, err := txClient.WithAtomic(func() (interface{}, error) {
+		user, err := txClient.User().GetForUpdate(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = txClient.Device().Remove(ctx, deviceID, userID); err != nil {
+			return nil, err
+		}
+
+		devices, err := txClient.Device().ByUserID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		user.IsDeviceAllowed = len(devices) > 0
+		if err = txClient.User().Update(ctx, user); err != nil {
+			return nil, err
+		}
+
+		return user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entity.(*auth.User), nil
+}
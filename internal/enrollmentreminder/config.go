@@ -0,0 +1,73 @@
+package enrollmentreminder
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const (
+	defaultPeriod    = time.Hour * 24 * 3
+	defaultInterval  = time.Hour
+	defaultBatchSize = 100
+)
+
+// NewService returns a new EnrollmentReminderService. Without a
+// RepositoryManager and MessagingService, no reminders are sent.
+func NewService(options ...ConfigOption) auth.EnrollmentReminderService {
+	s := service{
+		logger:    log.NewNopLogger(),
+		period:    defaultPeriod,
+		interval:  defaultInterval,
+		batchSize: defaultBatchSize,
+		now:       time.Now,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithRepoManager configures the service with a new RepositoryManager.
+func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
+	return func(s *service) {
+		s.repoMngr = repoMngr
+	}
+}
+
+// WithMessaging configures the service with a MessagingService.
+func WithMessaging(m auth.MessagingService) ConfigOption {
+	return func(s *service) {
+		s.message = m
+	}
+}
+
+// WithSchedule configures how often users are reminded to enroll
+// and how often due reminders are checked.
+func WithSchedule(period, interval time.Duration) ConfigOption {
+	return func(s *service) {
+		s.period = period
+		s.interval = interval
+	}
+}
+
+// WithBatchSize configures the maximum reminders sent per interval.
+func WithBatchSize(n int) ConfigOption {
+	return func(s *service) {
+		s.batchSize = n
+	}
+}
@@ -0,0 +1,107 @@
+// Package enrollmentreminder reminds users who have not enrolled
+// a second factor to do so before their enrollment deadline.
+package enrollmentreminder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// timeFormat is the format of the deadline listed in a reminder.
+const timeFormat = "Jan 2, 2006 15:04 MST"
+
+// service is an implementation of auth.EnrollmentReminderService.
+type service struct {
+	logger    log.Logger
+	repoMngr  auth.RepositoryManager
+	message   auth.MessagingService
+	period    time.Duration
+	interval  time.Duration
+	batchSize int
+	now       func() time.Time
+}
+
+// Run periodically sends due reminders until the context is cancelled.
+func (s *service) Run(ctx context.Context) error {
+	if s.repoMngr == nil || s.message == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := s.SendDue(ctx); err != nil {
+				level.Error(s.logger).Log(
+					"source", "EnrollmentReminderService.Run",
+					"message", "failed to send enrollment reminders",
+					"error", err,
+				)
+			}
+		}
+	}
+}
+
+// SendDue reminds users whose enrollment deadline has not passed
+// and who have not been reminded within the configured period.
+func (s *service) SendDue(ctx context.Context) error {
+	now := s.now()
+
+	enrollments, err := s.repoMngr.TFAEnrollment().Due(ctx, now, now.Add(-s.period), s.batchSize)
+	if err != nil {
+		return fmt.Errorf("cannot retrieve due reminders: %w", err)
+	}
+
+	for _, e := range enrollments {
+		if err = s.send(ctx, e, now); err != nil {
+			level.Error(s.logger).Log(
+				"source", "EnrollmentReminderService.SendDue",
+				"message", "failed to send enrollment reminder",
+				"user_id", e.UserID,
+				"error", err,
+			)
+		}
+	}
+
+	return nil
+}
+
+// send delivers a reminder of the enrollment deadline. Users who
+// have since enrolled a TOTP app or WebAuthn device are skipped.
+func (s *service) send(ctx context.Context, e *auth.TFAEnrollment, now time.Time) error {
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", e.UserID)
+	if err != nil {
+		return fmt.Errorf("cannot retrieve user: %w", err)
+	}
+
+	if !user.IsTOTPAllowed && !user.IsDeviceAllowed {
+		msg := &auth.Message{
+			Type:     auth.TFAEnrollmentReminder,
+			Delivery: auth.Email,
+			Address:  user.Email.String,
+			Vars: map[string]string{
+				"deadline": e.Deadline.UTC().Format(timeFormat),
+			},
+		}
+		if user.Email.String == "" {
+			msg.Delivery = auth.Phone
+			msg.Address = user.Phone.String
+		}
+		if err = s.message.Send(ctx, msg); err != nil {
+			return fmt.Errorf("cannot send reminder: %w", err)
+		}
+	}
+
+	return s.repoMngr.TFAEnrollment().MarkReminded(ctx, e.UserID, now)
+}
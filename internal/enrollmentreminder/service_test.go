@@ -0,0 +1,100 @@
+package enrollmentreminder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestEnrollmentReminderSvc_SendDue(t *testing.T) {
+	now := time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		name              string
+		user              *auth.User
+		sendFn            func() error
+		sendCalls         int
+		markRemindedCalls int
+	}{
+		{
+			name:              "Reminds user by email",
+			user:              &auth.User{Email: sql.NullString{String: "jane@example.com", Valid: true}},
+			sendCalls:         1,
+			markRemindedCalls: 1,
+		},
+		{
+			name:              "Reminds user by phone",
+			user:              &auth.User{Phone: sql.NullString{String: "+15555555555", Valid: true}},
+			sendCalls:         1,
+			markRemindedCalls: 1,
+		},
+		{
+			name: "Skips enrolled user",
+			user: &auth.User{
+				Email:         sql.NullString{String: "jane@example.com", Valid: true},
+				IsTOTPAllowed: true,
+			},
+			sendCalls:         0,
+			markRemindedCalls: 1,
+		},
+		{
+			name: "Retries failed delivery",
+			user: &auth.User{Email: sql.NullString{String: "jane@example.com", Valid: true}},
+			sendFn: func() error {
+				return fmt.Errorf("whoops")
+			},
+			sendCalls:         1,
+			markRemindedCalls: 0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			enrollmentRepo := &test.TFAEnrollmentRepository{
+				DueFn: func() ([]*auth.TFAEnrollment, error) {
+					return []*auth.TFAEnrollment{
+						{UserID: "user-id", Deadline: now.Add(time.Hour * 24)},
+					}, nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				TFAEnrollmentFn: func() auth.TFAEnrollmentRepository {
+					return enrollmentRepo
+				},
+				UserFn: func() auth.UserRepository {
+					return &test.UserRepository{
+						ByIdentityFn: func() (*auth.User, error) {
+							return tc.user, nil
+						},
+					}
+				},
+			}
+			messagingSvc := &test.MessagingService{SendFn: tc.sendFn}
+
+			s := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+				WithMessaging(messagingSvc),
+			).(*service)
+			s.now = func() time.Time { return now }
+
+			if err := s.SendDue(context.Background()); err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+
+			if messagingSvc.Calls.Send != tc.sendCalls {
+				t.Errorf("incorrect MessagingService.Send() call count, want %v got %v",
+					tc.sendCalls, messagingSvc.Calls.Send)
+			}
+			if enrollmentRepo.Calls.MarkReminded != tc.markRemindedCalls {
+				t.Errorf("incorrect TFAEnrollmentRepository.MarkReminded() call count, want %v got %v",
+					tc.markRemindedCalls, enrollmentRepo.Calls.MarkReminded)
+			}
+		})
+	}
+}
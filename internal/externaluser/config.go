@@ -0,0 +1,85 @@
+package externaluser
+
+import (
+	"database/sql"
+
+	"github.com/go-kit/kit/log"
+	"golang.org/x/crypto/bcrypt"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// NewService returns a new implementation of auth.ExternalUserProvider.
+// By default, users are read from a users table with id, email and
+// password columns, with passwords stored as bcrypt hashes.
+func NewService(options ...ConfigOption) (auth.ExternalUserProvider, error) {
+	s := service{
+		logger: log.NewNopLogger(),
+		schema: Schema{
+			Table:          "users",
+			IDColumn:       "id",
+			EmailColumn:    "email",
+			PasswordColumn: "password",
+		},
+		compare: compareBcrypt,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	if err := s.createQueries(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithDB configures the service with the external Postgres DB.
+func WithDB(db *sql.DB) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithSchema configures the table and columns users are read from.
+// Empty fields retain their defaults.
+func WithSchema(schema Schema) ConfigOption {
+	return func(s *service) {
+		if schema.Table != "" {
+			s.schema.Table = schema.Table
+		}
+		if schema.IDColumn != "" {
+			s.schema.IDColumn = schema.IDColumn
+		}
+		if schema.EmailColumn != "" {
+			s.schema.EmailColumn = schema.EmailColumn
+		}
+		if schema.PasswordColumn != "" {
+			s.schema.PasswordColumn = schema.PasswordColumn
+		}
+		s.schema.PhoneColumn = schema.PhoneColumn
+	}
+}
+
+// WithPasswordComparer configures how a submitted password is compared
+// against a stored hash for databases not using bcrypt.
+func WithPasswordComparer(compare func(hash, password string) error) ConfigOption {
+	return func(s *service) {
+		s.compare = compare
+	}
+}
+
+func compareBcrypt(hash, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
@@ -0,0 +1,122 @@
+// Package externaluser provides a reference auth.ExternalUserProvider
+// for user databases stored in Postgres.
+package externaluser
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/lib/pq"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// identifierRegex matches a plain SQL identifier, optionally
+// qualified by a schema (e.g. public.users).
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Schema describes the table holding external users. PhoneColumn
+// may be left empty if users do not login with a phone number.
+type Schema struct {
+	Table          string
+	IDColumn       string
+	EmailColumn    string
+	PhoneColumn    string
+	PasswordColumn string
+}
+
+// service is an implementation of auth.ExternalUserProvider backed by
+// a table in an existing Postgres user database.
+type service struct {
+	logger  log.Logger
+	db      *sql.DB
+	schema  Schema
+	compare func(hash, password string) error
+	queries map[string]string
+}
+
+// Authenticate verifies a password for an email address or phone number.
+func (s *service) Authenticate(ctx context.Context, attribute, identity, password string) (*auth.ExternalUser, error) {
+	query, ok := s.queries[attribute]
+	if !ok {
+		return nil, auth.ErrBadRequest("identity type is not supported")
+	}
+
+	var (
+		user  auth.ExternalUser
+		email sql.NullString
+		phone sql.NullString
+		hash  string
+	)
+
+	row := s.db.QueryRowContext(ctx, query, identity)
+	err := row.Scan(&user.ID, &email, &phone, &hash)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("user does not exist"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve external user: %w", err)
+	}
+
+	if err = s.compare(hash, password); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("incorrect password"))
+	}
+
+	user.Email = email.String
+	user.Phone = phone.String
+	return &user, nil
+}
+
+// createQueries builds lookup queries for each supported identity type.
+func (s *service) createQueries() error {
+	columns := []string{
+		s.schema.Table,
+		s.schema.IDColumn,
+		s.schema.EmailColumn,
+		s.schema.PasswordColumn,
+	}
+	if s.schema.PhoneColumn != "" {
+		columns = append(columns, s.schema.PhoneColumn)
+	}
+	for _, c := range columns {
+		if !identifierRegex.MatchString(c) {
+			return fmt.Errorf("invalid identifier %q", c)
+		}
+	}
+
+	phone := "NULL"
+	if s.schema.PhoneColumn != "" {
+		phone = quote(s.schema.PhoneColumn)
+	}
+
+	selectQ := fmt.Sprintf(
+		"SELECT %s, %s, %s, %s FROM %s",
+		quote(s.schema.IDColumn),
+		quote(s.schema.EmailColumn),
+		phone,
+		quote(s.schema.PasswordColumn),
+		quote(s.schema.Table),
+	)
+
+	s.queries = map[string]string{
+		"Email": fmt.Sprintf("%s WHERE %s = $1;", selectQ, quote(s.schema.EmailColumn)),
+	}
+	if s.schema.PhoneColumn != "" {
+		s.queries["Phone"] = fmt.Sprintf("%s WHERE %s = $1;", selectQ, phone)
+	}
+
+	return nil
+}
+
+// quote quotes a validated identifier, preserving schema qualification.
+func quote(identifier string) string {
+	parts := strings.Split(identifier, ".")
+	for i, p := range parts {
+		parts[i] = pq.QuoteIdentifier(p)
+	}
+	return strings.Join(parts, ".")
+}
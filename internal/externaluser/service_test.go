@@ -0,0 +1,80 @@
+package externaluser
+
+import (
+	"context"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+func TestExternalUser_Queries(t *testing.T) {
+	tt := []struct {
+		name    string
+		schema  Schema
+		queries map[string]string
+		hasErr  bool
+	}{
+		{
+			name: "Default schema",
+			queries: map[string]string{
+				"Email": `SELECT "id", "email", NULL, "password" FROM "users" WHERE "email" = $1;`,
+			},
+		},
+		{
+			name: "Custom schema with phone",
+			schema: Schema{
+				Table:          "accounts.members",
+				PasswordColumn: "password_hash",
+				PhoneColumn:    "mobile",
+			},
+			queries: map[string]string{
+				"Email": `SELECT "id", "email", "mobile", "password_hash" FROM "accounts"."members" ` +
+					`WHERE "email" = $1;`,
+				"Phone": `SELECT "id", "email", "mobile", "password_hash" FROM "accounts"."members" ` +
+					`WHERE "mobile" = $1;`,
+			},
+		},
+		{
+			name:   "Invalid identifier",
+			schema: Schema{Table: "users; DROP TABLE users"},
+			hasErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := NewService(WithSchema(tc.schema))
+			if tc.hasErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("failed to create service:", err)
+			}
+
+			queries := p.(*service).queries
+			if len(queries) != len(tc.queries) {
+				t.Errorf("incorrect query count, want %v got %v", len(tc.queries), len(queries))
+			}
+			for k, want := range tc.queries {
+				if queries[k] != want {
+					t.Errorf("incorrect %s query, want %s got %s", k, want, queries[k])
+				}
+			}
+		})
+	}
+}
+
+func TestExternalUser_UnsupportedIdentity(t *testing.T) {
+	p, err := NewService()
+	if err != nil {
+		t.Fatal("failed to create service:", err)
+	}
+
+	_, err = p.Authenticate(context.Background(), "Phone", "+15555555555", "swordfish")
+	if auth.ErrorCode(err) != auth.EBadRequest {
+		t.Errorf("incorrect error code, want '%s' got '%s'", auth.EBadRequest, auth.ErrorCode(err))
+	}
+}
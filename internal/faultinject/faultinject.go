@@ -0,0 +1,141 @@
+// Package faultinject injects latency and errors into calls to
+// dependencies such as Postgres, Redis and message providers. It is
+// intended for staging environments to verify timeout and retry
+// behavior end to end and must not be enabled in production.
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dependencies faults may be injected into.
+const (
+	Postgres  = "postgres"
+	Redis     = "redis"
+	Providers = "providers"
+)
+
+// ErrInjected is returned by calls failed by an Injector.
+var ErrInjected = errors.New("injected fault")
+
+// Fault configures the faults injected into calls to a dependency.
+type Fault struct {
+	// Latency is added before each call. Calls fail with the
+	// context's error if it is cancelled while waiting.
+	Latency time.Duration
+	// ErrorRate is the fraction of calls, between 0 and 1, which
+	// fail with ErrInjected.
+	ErrorRate float64
+}
+
+// Injector injects faults into calls to dependencies. A nil Injector
+// injects no faults.
+type Injector struct {
+	faults map[string]Fault
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// New returns an Injector.
+func New(options ...ConfigOption) *Injector {
+	i := Injector{
+		faults: make(map[string]Fault),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	for _, opt := range options {
+		opt(&i)
+	}
+
+	return &i
+}
+
+// ConfigOption configures the Injector.
+type ConfigOption func(*Injector)
+
+// WithFault injects a Fault into calls to a dependency.
+func WithFault(dependency string, f Fault) ConfigOption {
+	return func(i *Injector) {
+		i.faults[dependency] = f
+	}
+}
+
+// WithSeed seeds the selection of failed calls.
+func WithSeed(seed int64) ConfigOption {
+	return func(i *Injector) {
+		i.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// ParseFault parses a Fault in the format `latency,error-rate`,
+// e.g. `200ms,0.05`. Either value may be omitted.
+func ParseFault(s string) (Fault, error) {
+	var f Fault
+	if strings.TrimSpace(s) == "" {
+		return f, nil
+	}
+
+	parts := strings.Split(s, ",")
+	if len(parts) > 2 {
+		return f, fmt.Errorf("fault must be in the format latency,error-rate")
+	}
+
+	var err error
+	if v := strings.TrimSpace(parts[0]); v != "" {
+		if f.Latency, err = time.ParseDuration(v); err != nil || f.Latency < 0 {
+			return f, fmt.Errorf("invalid fault latency %s", v)
+		}
+	}
+	if len(parts) == 2 {
+		v := strings.TrimSpace(parts[1])
+		if f.ErrorRate, err = strconv.ParseFloat(v, 64); err != nil || f.ErrorRate < 0 || f.ErrorRate > 1 {
+			return f, fmt.Errorf("invalid fault error rate %s", v)
+		}
+	}
+
+	return f, nil
+}
+
+// Inject applies the Fault of a dependency to a call, waiting for
+// its latency and returning ErrInjected if the call should fail.
+func (i *Injector) Inject(ctx context.Context, dependency string) error {
+	if i == nil {
+		return nil
+	}
+
+	f, ok := i.faults[dependency]
+	if !ok {
+		return nil
+	}
+
+	if f.Latency > 0 {
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	if f.ErrorRate <= 0 {
+		return nil
+	}
+
+	i.mu.Lock()
+	failed := i.rand.Float64() < f.ErrorRate
+	i.mu.Unlock()
+
+	if failed {
+		return fmt.Errorf("%s: %w", dependency, ErrInjected)
+	}
+	return nil
+}
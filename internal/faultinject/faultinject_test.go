@@ -0,0 +1,107 @@
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestInjector_Inject(t *testing.T) {
+	tt := []struct {
+		name    string
+		fault   Fault
+		timeout time.Duration
+		err     error
+	}{
+		{
+			name: "No fault",
+		},
+		{
+			name:  "Failed call",
+			fault: Fault{ErrorRate: 1},
+			err:   ErrInjected,
+		},
+		{
+			name:    "Latency within timeout",
+			fault:   Fault{Latency: time.Millisecond},
+			timeout: time.Second,
+		},
+		{
+			name:    "Latency exceeds timeout",
+			fault:   Fault{Latency: time.Second},
+			timeout: time.Millisecond,
+			err:     context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			i := New(WithFault(Postgres, tc.fault))
+			err := i.Inject(ctx, Postgres)
+			if !errors.Is(err, tc.err) || (tc.err == nil && err != nil) {
+				t.Errorf("incorrect error, want %v got %v", tc.err, err)
+			}
+			if err = i.Inject(ctx, Redis); err != nil {
+				t.Error("expected no fault for other dependency, got:", err)
+			}
+		})
+	}
+
+	var nilInjector *Injector
+	if err := nilInjector.Inject(context.Background(), Postgres); err != nil {
+		t.Error("expected nil injector to inject no faults, got:", err)
+	}
+}
+
+func TestInjector_ErrorRate(t *testing.T) {
+	i := New(WithFault(Redis, Fault{ErrorRate: 0.25}), WithSeed(1))
+
+	var failed int
+	for n := 0; n < 1000; n++ {
+		if err := i.Inject(context.Background(), Redis); err != nil {
+			failed++
+		}
+	}
+	if failed < 200 || failed > 300 {
+		t.Errorf("incorrect number of failed calls, want about 250 got %v", failed)
+	}
+}
+
+func TestParseFault(t *testing.T) {
+	tt := []struct {
+		value    string
+		fault    Fault
+		hasError bool
+	}{
+		{value: "", fault: Fault{}},
+		{value: "200ms", fault: Fault{Latency: time.Millisecond * 200}},
+		{value: "200ms,0.05", fault: Fault{Latency: time.Millisecond * 200, ErrorRate: 0.05}},
+		{value: ",1", fault: Fault{ErrorRate: 1}},
+		{value: "fast", hasError: true},
+		{value: "200ms,2", hasError: true},
+		{value: "200ms,0.1,1", hasError: true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.value, func(t *testing.T) {
+			fault, err := ParseFault(tc.value)
+			if tc.hasError && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !tc.hasError && err != nil {
+				t.Fatal("expected nil error, got:", err)
+			}
+			if !tc.hasError && fault != tc.fault {
+				t.Errorf("incorrect fault, want %+v got %+v", tc.fault, fault)
+			}
+		})
+	}
+}
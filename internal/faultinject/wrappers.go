@@ -0,0 +1,86 @@
+package faultinject
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// Transport returns an http.RoundTripper which injects the faults of
+// a dependency into requests before sending them with base. Injected
+// errors are reported as connection errors.
+func (i *Injector) Transport(dependency string, base http.RoundTripper) http.RoundTripper {
+	if i == nil {
+		return base
+	}
+	return &transport{injector: i, dependency: dependency, base: base}
+}
+
+type transport struct {
+	injector   *Injector
+	dependency string
+	base       http.RoundTripper
+}
+
+// RoundTrip sends a request unless it is failed by the Injector.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.injector.Inject(req.Context(), t.dependency); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// RedisHook returns a redis.Hook which injects Redis faults into
+// commands and pipelines.
+func (i *Injector) RedisHook() redis.Hook {
+	return &redisHook{injector: i}
+}
+
+type redisHook struct {
+	injector *Injector
+}
+
+func (h *redisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, h.injector.Inject(ctx, Redis)
+}
+
+func (h *redisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (h *redisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, h.injector.Inject(ctx, Redis)
+}
+
+func (h *redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+// Emailer returns an auth.Emailer which injects the faults of a
+// dependency into emails sent without HTTP, such as over SMTP.
+func (i *Injector) Emailer(dependency string, e auth.Emailer) auth.Emailer {
+	if i == nil {
+		return e
+	}
+	return &emailer{injector: i, dependency: dependency, next: e}
+}
+
+type emailer struct {
+	injector   *Injector
+	dependency string
+	next       auth.Emailer
+}
+
+// Email sends an email unless it is failed by the Injector.
+func (e *emailer) Email(ctx context.Context, email, subject, message string) error {
+	if err := e.injector.Inject(ctx, e.dependency); err != nil {
+		return err
+	}
+	return e.next.Email(ctx, email, subject, message)
+}
@@ -0,0 +1,74 @@
+package featureflag
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// defaultCacheTTL is the default time runtime overrides are cached.
+const defaultCacheTTL = time.Second * 10
+
+// NewService returns a new implementation of auth.FeatureFlagService.
+// Without a redis DB, Features are only configurable through defaults.
+func NewService(options ...ConfigOption) auth.FeatureFlagService {
+	s := service{
+		logger:    log.NewNopLogger(),
+		defaults:  map[auth.Feature]bool{auth.FeatureMaintenance: false},
+		overrides: make(map[auth.Feature]bool),
+		cacheTTL:  defaultCacheTTL,
+		now:       time.Now,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithDB configures the service with a redis DB to
+// store runtime overrides.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithDisabled disables Features by default.
+func WithDisabled(features ...auth.Feature) ConfigOption {
+	return func(s *service) {
+		for _, f := range features {
+			s.defaults[f] = false
+		}
+	}
+}
+
+// WithEnabled enables Features by default.
+func WithEnabled(features ...auth.Feature) ConfigOption {
+	return func(s *service) {
+		for _, f := range features {
+			s.defaults[f] = true
+		}
+	}
+}
+
+// WithCacheTTL configures how long runtime overrides are cached.
+// Toggled features take effect on other instances once expired.
+func WithCacheTTL(ttl time.Duration) ConfigOption {
+	return func(s *service) {
+		s.cacheTTL = ttl
+	}
+}
@@ -0,0 +1,179 @@
+// Package featureflag toggles features of the service at runtime.
+// Defaults are loaded from config and may be overridden by operators
+// through Redis without redeploying.
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// flagsKey is the redis hash storing runtime overrides.
+const flagsKey = "feature_flags"
+
+// Known are the Features which may be toggled.
+var Known = []auth.Feature{
+	auth.FeatureSignUp,
+	auth.FeatureCaptcha,
+	auth.FeatureOrganizations,
+	auth.FeatureLoginDigest,
+	auth.FeatureMaintenance,
+}
+
+// rediser is a minimal interface for go-redis.
+type rediser interface {
+	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
+	HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd
+}
+
+// service is an implementation of auth.FeatureFlagService. Features
+// are enabled unless disabled in config or by a runtime override, with
+// the exception of maintenance which must be explicitly enabled.
+// Overrides are cached to avoid a redis query on every request.
+type service struct {
+	logger   log.Logger
+	db       rediser
+	defaults map[auth.Feature]bool
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	overrides map[auth.Feature]bool
+	loadedAt  time.Time
+}
+
+// Enabled reports whether a Feature is enabled. If overrides cannot
+// be loaded, the last known overrides are used.
+func (s *service) Enabled(ctx context.Context, f auth.Feature) bool {
+	overrides, err := s.loadOverrides(ctx)
+	if err != nil {
+		level.Error(s.logger).Log(
+			"message", "cannot load feature flags",
+			"error", err,
+			"source", "featureflag.Enabled",
+		)
+	}
+
+	if enabled, ok := overrides[f]; ok {
+		return enabled
+	}
+
+	if enabled, ok := s.defaults[f]; ok {
+		return enabled
+	}
+
+	return true
+}
+
+// Set enables or disables a Feature at runtime.
+func (s *service) Set(ctx context.Context, f auth.Feature, enabled bool) error {
+	if s.db == nil {
+		return fmt.Errorf("cannot set feature flag without redis")
+	}
+
+	if err := s.db.HSet(ctx, flagsKey, string(f), fmt.Sprint(enabled)).Err(); err != nil {
+		return fmt.Errorf("cannot set feature flag: %w", err)
+	}
+
+	s.invalidate()
+	return nil
+}
+
+// Reset reverts a Feature to its configured default.
+func (s *service) Reset(ctx context.Context, f auth.Feature) error {
+	if s.db == nil {
+		return fmt.Errorf("cannot reset feature flag without redis")
+	}
+
+	if err := s.db.HDel(ctx, flagsKey, string(f)).Err(); err != nil {
+		return fmt.Errorf("cannot reset feature flag: %w", err)
+	}
+
+	s.invalidate()
+	return nil
+}
+
+// List returns the state of all known Features.
+func (s *service) List(ctx context.Context) (map[auth.Feature]bool, error) {
+	s.invalidate()
+	if _, err := s.loadOverrides(ctx); err != nil {
+		return nil, err
+	}
+
+	features := make(map[auth.Feature]bool)
+	for _, f := range Known {
+		features[f] = s.Enabled(ctx, f)
+	}
+
+	return features, nil
+}
+
+// loadOverrides returns runtime overrides, refreshing them from
+// redis when the cache has expired.
+func (s *service) loadOverrides(ctx context.Context) (map[auth.Feature]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db == nil || s.now().Sub(s.loadedAt) < s.cacheTTL {
+		return s.overrides, nil
+	}
+
+	values, err := s.db.HGetAll(ctx, flagsKey).Result()
+	if err != nil {
+		return s.overrides, err
+	}
+
+	overrides := make(map[auth.Feature]bool)
+	for k, v := range values {
+		overrides[auth.Feature(k)] = v == "true"
+	}
+
+	s.overrides = overrides
+	s.loadedAt = s.now()
+	return s.overrides, nil
+}
+
+func (s *service) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadedAt = time.Time{}
+}
+
+// IsKnown reports whether a Feature may be toggled.
+func IsKnown(f auth.Feature) bool {
+	for _, known := range Known {
+		if known == f {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseList parses a comma separated list of Features.
+func ParseList(s string) ([]auth.Feature, error) {
+	var features []auth.Feature
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		f := auth.Feature(name)
+		if !IsKnown(f) {
+			return nil, fmt.Errorf("feature %q is not recognized", name)
+		}
+		features = append(features, f)
+	}
+
+	return features, nil
+}
@@ -0,0 +1,187 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+type fakeRedis struct {
+	hash  map[string]string
+	err   error
+	reads int
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{hash: make(map[string]string)}
+}
+
+func (f *fakeRedis) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	f.reads++
+	values := make(map[string]string)
+	for k, v := range f.hash {
+		values[k] = v
+	}
+	return redis.NewStringStringMapResult(values, f.err)
+}
+
+func (f *fakeRedis) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	for i := 0; i+1 < len(values); i += 2 {
+		f.hash[fmt.Sprint(values[i])] = fmt.Sprint(values[i+1])
+	}
+	return redis.NewIntResult(1, nil)
+}
+
+func (f *fakeRedis) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	for _, field := range fields {
+		delete(f.hash, field)
+	}
+	return redis.NewIntResult(1, nil)
+}
+
+func TestFeatureFlag_Enabled(t *testing.T) {
+	tt := []struct {
+		name      string
+		disabled  []auth.Feature
+		defaultOn []auth.Feature
+		overrides map[string]string
+		feature   auth.Feature
+		enabled   bool
+	}{
+		{
+			name:    "Enabled by default",
+			feature: auth.FeatureSignUp,
+			enabled: true,
+		},
+		{
+			name:     "Disabled by config",
+			disabled: []auth.Feature{auth.FeatureSignUp},
+			feature:  auth.FeatureSignUp,
+			enabled:  false,
+		},
+		{
+			name:      "Enabled by override",
+			disabled:  []auth.Feature{auth.FeatureCaptcha},
+			overrides: map[string]string{"captcha": "true"},
+			feature:   auth.FeatureCaptcha,
+			enabled:   true,
+		},
+		{
+			name:      "Disabled by override",
+			overrides: map[string]string{"captcha": "false"},
+			feature:   auth.FeatureCaptcha,
+			enabled:   false,
+		},
+		{
+			name:    "Maintenance disabled by default",
+			feature: auth.FeatureMaintenance,
+			enabled: false,
+		},
+		{
+			name:      "Maintenance enabled by config",
+			defaultOn: []auth.Feature{auth.FeatureMaintenance},
+			feature:   auth.FeatureMaintenance,
+			enabled:   true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db := newFakeRedis()
+			for k, v := range tc.overrides {
+				db.hash[k] = v
+			}
+
+			svc := NewService(
+				WithDB(db),
+				WithDisabled(tc.disabled...),
+				WithEnabled(tc.defaultOn...),
+			)
+			if enabled := svc.Enabled(context.Background(), tc.feature); enabled != tc.enabled {
+				t.Errorf("incorrect feature state, want %v got %v", tc.enabled, enabled)
+			}
+		})
+	}
+}
+
+func TestFeatureFlag_SetAndReset(t *testing.T) {
+	ctx := context.Background()
+	db := newFakeRedis()
+	svc := NewService(WithDB(db), WithDisabled(auth.FeatureLoginDigest))
+
+	if err := svc.Set(ctx, auth.FeatureLoginDigest, true); err != nil {
+		t.Fatal("failed to set feature:", err)
+	}
+	if !svc.Enabled(ctx, auth.FeatureLoginDigest) {
+		t.Error("feature should be enabled after override")
+	}
+
+	if err := svc.Reset(ctx, auth.FeatureLoginDigest); err != nil {
+		t.Fatal("failed to reset feature:", err)
+	}
+	if svc.Enabled(ctx, auth.FeatureLoginDigest) {
+		t.Error("feature should revert to its default after reset")
+	}
+
+	features, err := svc.List(ctx)
+	if err != nil {
+		t.Fatal("failed to list features:", err)
+	}
+	if len(features) != len(Known) {
+		t.Errorf("incorrect feature count, want %v got %v", len(Known), len(features))
+	}
+	if features[auth.FeatureLoginDigest] {
+		t.Error("listed feature should be disabled")
+	}
+}
+
+func TestFeatureFlag_Cache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	db := newFakeRedis()
+	s := NewService(WithDB(db), WithCacheTTL(time.Minute)).(*service)
+	s.now = func() time.Time { return now }
+
+	s.Enabled(ctx, auth.FeatureSignUp)
+	s.Enabled(ctx, auth.FeatureSignUp)
+	if db.reads != 1 {
+		t.Errorf("incorrect redis read count, want 1 got %v", db.reads)
+	}
+
+	// Overrides set by another instance are read once the cache expires.
+	db.hash["signup"] = "false"
+	if !s.Enabled(ctx, auth.FeatureSignUp) {
+		t.Error("cached feature state should be used before expiry")
+	}
+
+	now = now.Add(time.Minute)
+	if s.Enabled(ctx, auth.FeatureSignUp) {
+		t.Error("feature should be disabled after cache expiry")
+	}
+
+	// Last known overrides are used if redis is unavailable.
+	db.err = fmt.Errorf("connection refused")
+	now = now.Add(time.Minute)
+	if s.Enabled(ctx, auth.FeatureSignUp) {
+		t.Error("last known feature state should be used on failure")
+	}
+}
+
+func TestFeatureFlag_ParseList(t *testing.T) {
+	features, err := ParseList("signup, captcha")
+	if err != nil {
+		t.Fatal("failed to parse features:", err)
+	}
+	if len(features) != 2 {
+		t.Errorf("incorrect feature count, want 2 got %v", len(features))
+	}
+
+	if _, err = ParseList("magic_links"); err == nil {
+		t.Error("expected error for unknown feature")
+	}
+}
@@ -0,0 +1,89 @@
+package fidomds
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const defaultInterval = time.Hour * 24
+
+// NewService returns a new MetadataService. Without a URL and
+// trusted root certificates, no metadata is retrieved.
+func NewService(options ...ConfigOption) auth.MetadataService {
+	s := service{
+		logger:   log.NewNopLogger(),
+		client:   http.DefaultClient,
+		interval: defaultInterval,
+		entries:  map[string]*auth.AuthenticatorMetadata{},
+		now:      time.Now,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ReadRoots parses PEM encoded root certificates trusted
+// to sign the metadata BLOB.
+func ReadRoots(r io.Reader) (*x509.CertPool, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read root certificates: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no root certificates found")
+	}
+
+	return roots, nil
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithURL configures the service with the URL of the metadata BLOB.
+func WithURL(url string) ConfigOption {
+	return func(s *service) {
+		s.url = url
+	}
+}
+
+// WithRoots configures the root certificates trusted to sign
+// the metadata BLOB.
+func WithRoots(roots *x509.CertPool) ConfigOption {
+	return func(s *service) {
+		s.roots = roots
+	}
+}
+
+// WithClient configures the HTTP client used to retrieve metadata.
+func WithClient(c *http.Client) ConfigOption {
+	return func(s *service) {
+		s.client = c
+	}
+}
+
+// WithInterval sets the interval to refresh metadata.
+func WithInterval(interval time.Duration) ConfigOption {
+	return func(s *service) {
+		s.interval = interval
+	}
+}
@@ -0,0 +1,244 @@
+// Package fidomds resolves authenticator models from the FIDO
+// Metadata Service (MDS3).
+package fidomds
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// maxBlobSize is the maximum size of a metadata BLOB we accept.
+const maxBlobSize = 32 << 20
+
+// compromised are statuses of authenticator models which should
+// no longer be trusted.
+var compromised = map[string]bool{
+	"REVOKED":                      true,
+	"USER_VERIFICATION_BYPASS":     true,
+	"ATTESTATION_KEY_COMPROMISE":   true,
+	"USER_KEY_REMOTE_COMPROMISE":   true,
+	"USER_KEY_PHYSICAL_COMPROMISE": true,
+}
+
+// blob is the payload of a metadata BLOB.
+type blob struct {
+	No      int         `json:"no"`
+	Entries []blobEntry `json:"entries"`
+}
+
+// blobEntry is an authenticator model listed in a metadata BLOB.
+type blobEntry struct {
+	AAGUID            string `json:"aaguid"`
+	MetadataStatement struct {
+		Description string `json:"description"`
+	} `json:"metadataStatement"`
+	StatusReports []struct {
+		Status        string `json:"status"`
+		EffectiveDate string `json:"effectiveDate"`
+	} `json:"statusReports"`
+}
+
+// service is an implementation of auth.MetadataService. Metadata
+// is retrieved from a BLOB signed by a certificate chaining to a
+// trusted root and held in memory between refreshes.
+type service struct {
+	logger   log.Logger
+	url      string
+	roots    *x509.CertPool
+	client   *http.Client
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.RWMutex
+	entries map[string]*auth.AuthenticatorMetadata
+}
+
+// Lookup returns the metadata of an authenticator model by its AAGUID.
+func (s *service) Lookup(aaguid []byte) *auth.AuthenticatorMetadata {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.entries[hex.EncodeToString(aaguid)]
+}
+
+// Run refreshes metadata on start and then periodically until
+// the context is cancelled.
+func (s *service) Run(ctx context.Context) error {
+	if s.url == "" || s.roots == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil {
+			level.Error(s.logger).Log(
+				"source", "MetadataService.Run",
+				"message", "failed to refresh authenticator metadata",
+				"error", err,
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh retrieves and verifies the metadata BLOB, replacing
+// previously retrieved metadata.
+func (s *service) Refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create metadata request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot retrieve metadata: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot retrieve metadata: status %d", resp.StatusCode)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBlobSize))
+	if err != nil {
+		return fmt.Errorf("cannot read metadata: %w", err)
+	}
+
+	payload, err := s.verify(strings.TrimSpace(string(b)))
+	if err != nil {
+		return err
+	}
+
+	entries := map[string]*auth.AuthenticatorMetadata{}
+	for _, e := range payload.Entries {
+		if e.AAGUID == "" {
+			continue
+		}
+
+		status := latestStatus(e)
+		entries[strings.ToLower(strings.Replace(e.AAGUID, "-", "", -1))] = &auth.AuthenticatorMetadata{
+			Description: e.MetadataStatement.Description,
+			Status:      status,
+			Compromised: compromised[status],
+		}
+	}
+
+	s.mu.Lock()
+	s.entries = entries
+	s.mu.Unlock()
+
+	level.Info(s.logger).Log(
+		"source", "MetadataService.Refresh",
+		"message", "refreshed authenticator metadata",
+		"no", payload.No,
+		"entries", len(entries),
+	)
+
+	return nil
+}
+
+// verify checks the signature of a metadata BLOB against the
+// certificate chain in its x5c header, which must chain to a
+// trusted root, and returns its payload.
+func (s *service) verify(raw string) (*blob, error) {
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+
+		x5c, ok := token.Header["x5c"].([]interface{})
+		if !ok || len(x5c) == 0 {
+			return nil, fmt.Errorf("missing x5c header")
+		}
+
+		var chain []*x509.Certificate
+		for _, c := range x5c {
+			encoded, ok := c.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid x5c header")
+			}
+			der, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("invalid x5c certificate: %w", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("invalid x5c certificate: %w", err)
+			}
+			chain = append(chain, cert)
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range chain[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		_, err := chain[0].Verify(x509.VerifyOptions{
+			Roots:         s.roots,
+			Intermediates: intermediates,
+			CurrentTime:   s.now(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("untrusted certificate chain: %w", err)
+		}
+
+		return chain[0].PublicKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata BLOB: %w", err)
+	}
+
+	b, err := json.Marshal(token.Claims)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata BLOB: %w", err)
+	}
+
+	var payload blob
+	if err = json.Unmarshal(b, &payload); err != nil {
+		return nil, fmt.Errorf("invalid metadata BLOB: %w", err)
+	}
+
+	return &payload, nil
+}
+
+// latestStatus returns the most recently effective status reported
+// for an authenticator model. Reports without a date are assumed to
+// be effective while present.
+func latestStatus(e blobEntry) string {
+	var status, date string
+	for _, r := range e.StatusReports {
+		if r.EffectiveDate >= date {
+			status = r.Status
+			date = r.EffectiveDate
+		}
+	}
+	return status
+}
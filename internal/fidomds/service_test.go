@@ -0,0 +1,218 @@
+package fidomds
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+type testCA struct {
+	root    *x509.Certificate
+	leaf    *x509.Certificate
+	leafKey *ecdsa.PrivateKey
+}
+
+func newCertificate(t *testing.T, tmpl, parent *x509.Certificate, pub, priv interface{}) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+	if err != nil {
+		t.Fatal("failed to create certificate:", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("failed to parse certificate:", err)
+	}
+	return cert
+}
+
+func newTestCA(t *testing.T) *testCA {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test MDS Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	root := newCertificate(t, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test MDS Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leaf := newCertificate(t, leafTmpl, root, &leafKey.PublicKey, rootKey)
+
+	return &testCA{root: root, leaf: leaf, leafKey: leafKey}
+}
+
+func (ca *testCA) roots() *x509.CertPool {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.root)
+	return roots
+}
+
+func (ca *testCA) sign(t *testing.T, payload jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, payload)
+	token.Header["x5c"] = []string{base64.StdEncoding.EncodeToString(ca.leaf.Raw)}
+	blob, err := token.SignedString(ca.leafKey)
+	if err != nil {
+		t.Fatal("failed to sign blob:", err)
+	}
+	return blob
+}
+
+func testPayload() jwt.MapClaims {
+	return jwt.MapClaims{
+		"no":         12,
+		"nextUpdate": "2020-07-01",
+		"entries": []interface{}{
+			map[string]interface{}{
+				"aaguid": "ee882879-721c-4913-9775-3dfcce97072a",
+				"metadataStatement": map[string]interface{}{
+					"description": "YubiKey 5 Series",
+				},
+				"statusReports": []interface{}{
+					map[string]interface{}{"status": "FIDO_CERTIFIED", "effectiveDate": "2019-01-04"},
+					map[string]interface{}{"status": "FIDO_CERTIFIED_L1", "effectiveDate": "2020-05-12"},
+				},
+			},
+			map[string]interface{}{
+				"aaguid": "fa2b99dc-9e39-4257-8f92-4a30d23c4118",
+				"metadataStatement": map[string]interface{}{
+					"description": "Compromised Key",
+				},
+				"statusReports": []interface{}{
+					map[string]interface{}{"status": "REVOKED", "effectiveDate": "2020-06-01"},
+					map[string]interface{}{"status": "FIDO_CERTIFIED", "effectiveDate": "2018-03-20"},
+				},
+			},
+			map[string]interface{}{
+				"attestationCertificateKeyIdentifiers": []string{"923881fe2f214ee465484371aeb72e97f5a58e0a"},
+				"metadataStatement": map[string]interface{}{
+					"description": "U2F Key",
+				},
+			},
+		},
+	}
+}
+
+func aaguid(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal("invalid aaguid:", err)
+	}
+	return b
+}
+
+func TestMetadataSvc_Refresh(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+
+	tt := []struct {
+		name     string
+		blob     string
+		status   int
+		hasError bool
+	}{
+		{
+			name:   "Trusted BLOB",
+			blob:   ca.sign(t, testPayload()),
+			status: http.StatusOK,
+		},
+		{
+			name:     "Untrusted BLOB",
+			blob:     otherCA.sign(t, testPayload()),
+			status:   http.StatusOK,
+			hasError: true,
+		},
+		{
+			name:     "Tampered BLOB",
+			blob:     ca.sign(t, testPayload())[:40] + "x" + ca.sign(t, testPayload())[41:],
+			status:   http.StatusOK,
+			hasError: true,
+		},
+		{
+			name:     "Unavailable BLOB",
+			status:   http.StatusServiceUnavailable,
+			hasError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.blob))
+			}))
+			defer server.Close()
+
+			svc := NewService(
+				WithURL(server.URL),
+				WithRoots(ca.roots()),
+			).(*service)
+
+			err := svc.Refresh(context.Background())
+			if tc.hasError && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !tc.hasError && err != nil {
+				t.Fatal("expected nil error, got:", err)
+			}
+			if tc.hasError {
+				if md := svc.Lookup(aaguid(t, "ee882879721c491397753dfcce97072a")); md != nil {
+					t.Error("expected no metadata, got:", md)
+				}
+				return
+			}
+
+			md := svc.Lookup(aaguid(t, "ee882879721c491397753dfcce97072a"))
+			expected := auth.AuthenticatorMetadata{
+				Description: "YubiKey 5 Series",
+				Status:      "FIDO_CERTIFIED_L1",
+			}
+			if md == nil || *md != expected {
+				t.Errorf("incorrect metadata, want %+v got %+v", expected, md)
+			}
+
+			md = svc.Lookup(aaguid(t, "fa2b99dc9e3942578f924a30d23c4118"))
+			expected = auth.AuthenticatorMetadata{
+				Description: "Compromised Key",
+				Status:      "REVOKED",
+				Compromised: true,
+			}
+			if md == nil || *md != expected {
+				t.Errorf("incorrect metadata, want %+v got %+v", expected, md)
+			}
+
+			if md = svc.Lookup(make([]byte, 16)); md != nil {
+				t.Error("expected no metadata for unknown AAGUID, got:", md)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Package fingerprint derives a fingerprint of the client software a
+// request is made from. Tokens bound to a fingerprint are harder to
+// replay from another client if stolen.
+package fingerprint
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type contextKey string
+
+const fingerprintContextKey contextKey = "fingerprint"
+
+// headers identify the client software making a request. Client
+// hints are only sent by Chromium based browsers and are empty
+// for other clients.
+var headers = []string{
+	"User-Agent",
+	"Sec-CH-UA",
+	"Sec-CH-UA-Mobile",
+	"Sec-CH-UA-Platform",
+}
+
+// Mode is how strictly tokens are bound to a fingerprint.
+type Mode string
+
+const (
+	// Off does not bind tokens to a fingerprint.
+	Off Mode = "off"
+	// Log binds tokens to a fingerprint and logs tokens presented
+	// from another client without rejecting them. It allows operators
+	// to evaluate binding before enforcing it.
+	Log Mode = "log"
+	// Strict rejects tokens presented from another client.
+	Strict Mode = "strict"
+)
+
+// ParseMode parses a Mode. An empty string is Off.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return Off, nil
+	case Off, Log, Strict:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unsupported fingerprint mode %q", s)
+	}
+}
+
+// FromRequest returns the fingerprint of the client a request is made
+// from. A TLS client certificate, if presented, is part of the fingerprint.
+func FromRequest(r *http.Request) string {
+	h := sha256.New()
+	for _, name := range headers {
+		_, _ = fmt.Fprintf(h, "%s=%s\n", name, r.Header.Get(name))
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		_, _ = h.Write(r.TLS.PeerCertificates[0].Raw)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Headers returns the headers of a request which identify the client
+// software. A service checking a token on behalf of a client forwards
+// them so the client's fingerprint, rather than its own, is compared.
+// TLS client certificates cannot be forwarded.
+func Headers(r *http.Request) http.Header {
+	h := http.Header{}
+	for _, name := range headers {
+		// Empty headers are kept so an HTTP client does
+		// not set its own User-Agent in their place.
+		h.Set(name, r.Header.Get(name))
+	}
+	return h
+}
+
+// NewContext returns a context carrying a fingerprint.
+func NewContext(ctx context.Context, fp string) context.Context {
+	return context.WithValue(ctx, fingerprintContextKey, fp)
+}
+
+// FromContext returns the fingerprint of the client a request is
+// made from or an empty string if it is unknown.
+func FromContext(ctx context.Context) string {
+	fp, _ := ctx.Value(fingerprintContextKey).(string)
+	return fp
+}
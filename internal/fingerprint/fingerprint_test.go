@@ -0,0 +1,72 @@
+package fingerprint
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"testing"
+)
+
+func TestFingerprint_FromRequest(t *testing.T) {
+	newRequest := func(userAgent, platform string) *http.Request {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal("failed to create request:", err)
+		}
+		r.Header.Set("User-Agent", userAgent)
+		r.Header.Set("Sec-CH-UA-Platform", platform)
+		return r
+	}
+
+	chrome := FromRequest(newRequest("Chrome/85.0", `"macOS"`))
+	if chrome != FromRequest(newRequest("Chrome/85.0", `"macOS"`)) {
+		t.Error("expected fingerprint to be stable")
+	}
+	if chrome == FromRequest(newRequest("Chrome/85.0", `"Windows"`)) {
+		t.Error("expected fingerprint to differ by platform")
+	}
+	if chrome == FromRequest(newRequest("Firefox/80.0", `"macOS"`)) {
+		t.Error("expected fingerprint to differ by user agent")
+	}
+
+	r := newRequest("Chrome/85.0", `"macOS"`)
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{{Raw: []byte("certificate")}},
+	}
+	if chrome == FromRequest(r) {
+		t.Error("expected fingerprint to differ by client certificate")
+	}
+
+	ctx := NewContext(context.Background(), chrome)
+	if fp := FromContext(ctx); fp != chrome {
+		t.Errorf("incorrect fingerprint from context, want %s got %s", chrome, fp)
+	}
+	if fp := FromContext(context.Background()); fp != "" {
+		t.Errorf("expected empty fingerprint, got %s", fp)
+	}
+}
+
+func TestFingerprint_ParseMode(t *testing.T) {
+	tt := []struct {
+		value string
+		mode  Mode
+		isErr bool
+	}{
+		{value: "", mode: Off},
+		{value: "off", mode: Off},
+		{value: "Log", mode: Log},
+		{value: " strict ", mode: Strict},
+		{value: "enforce", isErr: true},
+	}
+
+	for _, tc := range tt {
+		mode, err := ParseMode(tc.value)
+		if tc.isErr != (err != nil) {
+			t.Errorf("incorrect error for %q: %v", tc.value, err)
+		}
+		if mode != tc.mode {
+			t.Errorf("incorrect mode for %q, want %s got %s", tc.value, tc.mode, mode)
+		}
+	}
+}
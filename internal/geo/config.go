@@ -0,0 +1,70 @@
+package geo
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const defaultInterval = time.Minute
+
+// NewResolver returns a new GeoResolver. Databases are loaded on
+// creation and an error is returned if they cannot be read. Without
+// databases, no IP address is resolved.
+func NewResolver(options ...ConfigOption) (auth.GeoResolver, error) {
+	r := resolver{
+		logger:   log.NewNopLogger(),
+		interval: defaultInterval,
+	}
+
+	for _, opt := range options {
+		opt(&r)
+	}
+
+	for _, db := range r.databases() {
+		if _, err := db.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &r, nil
+}
+
+// ConfigOption configures the resolver.
+type ConfigOption func(*resolver)
+
+// WithLogger configures the resolver with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(r *resolver) {
+		r.logger = l
+	}
+}
+
+// WithCityDB configures the path to a GeoLite2 City or Country
+// database used to resolve countries and cities.
+func WithCityDB(path string) ConfigOption {
+	return func(r *resolver) {
+		if path != "" {
+			r.city = &database{path: path}
+		}
+	}
+}
+
+// WithASNDB configures the path to a GeoLite2 ASN database used
+// to resolve autonomous systems.
+func WithASNDB(path string) ConfigOption {
+	return func(r *resolver) {
+		if path != "" {
+			r.asn = &database{path: path}
+		}
+	}
+}
+
+// WithInterval sets the interval to check databases for changes.
+func WithInterval(interval time.Duration) ConfigOption {
+	return func(r *resolver) {
+		r.interval = interval
+	}
+}
@@ -0,0 +1,201 @@
+// Package geo resolves the location of IP addresses from MaxMind
+// GeoLite2 databases.
+package geo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oschwald/maxminddb-golang"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// cityRecord is the subset of a GeoLite2 City or Country record
+// we resolve.
+type cityRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// asnRecord is a GeoLite2 ASN record.
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// database is a MaxMind database read from a local file. The
+// file is read into memory so that it may be replaced on disk
+// while in use.
+type database struct {
+	path string
+
+	mu      sync.RWMutex
+	modTime time.Time
+	reader  *maxminddb.Reader
+}
+
+// lookup decodes the record of an IP address into result and
+// reports whether one was found.
+func (d *database) lookup(ip net.IP, result interface{}) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.reader == nil {
+		return false
+	}
+
+	offset, err := d.reader.LookupOffset(ip)
+	if err != nil || offset == maxminddb.NotFound {
+		return false
+	}
+
+	return d.reader.Decode(offset, result) == nil
+}
+
+// load reads the database if it changed on disk since it was last
+// read and reports whether it was replaced.
+func (d *database) load() (bool, error) {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return false, fmt.Errorf("cannot read geo database: %w", err)
+	}
+
+	d.mu.RLock()
+	unchanged := d.reader != nil && info.ModTime().Equal(d.modTime)
+	d.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	b, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return false, fmt.Errorf("cannot read geo database: %w", err)
+	}
+
+	reader, err := maxminddb.FromBytes(b)
+	if err != nil {
+		return false, fmt.Errorf("invalid geo database %s: %w", d.path, err)
+	}
+
+	d.mu.Lock()
+	d.reader = reader
+	d.modTime = info.ModTime()
+	d.mu.Unlock()
+
+	return true, nil
+}
+
+// resolver is an implementation of auth.GeoResolver.
+type resolver struct {
+	logger   log.Logger
+	interval time.Duration
+	city     *database
+	asn      *database
+}
+
+// Lookup returns the location of an IP address.
+func (r *resolver) Lookup(ip string) *auth.GeoLocation {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil
+	}
+
+	var (
+		loc   auth.GeoLocation
+		found bool
+	)
+
+	if r.city != nil {
+		var rec cityRecord
+		if r.city.lookup(addr, &rec) {
+			loc.Country = rec.Country.ISOCode
+			loc.City = rec.City.Names["en"]
+			found = found || loc.Country != "" || loc.City != ""
+		}
+	}
+
+	if r.asn != nil {
+		var rec asnRecord
+		if r.asn.lookup(addr, &rec) {
+			loc.ASN = rec.Number
+			loc.ASOrganization = rec.Organization
+			found = found || loc.ASN != 0
+		}
+	}
+
+	if !found {
+		return nil
+	}
+
+	return &loc
+}
+
+// Run periodically reloads databases which changed on disk until
+// the context is cancelled. A database which fails to load is
+// logged and the previously loaded version remains in use.
+func (r *resolver) Run(ctx context.Context) error {
+	databases := r.databases()
+	if len(databases) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		for _, db := range databases {
+			r.reload(db)
+		}
+	}
+}
+
+func (r *resolver) reload(db *database) {
+	reloaded, err := db.load()
+	if err != nil {
+		level.Error(r.logger).Log(
+			"source", "GeoResolver.Run",
+			"message", "failed to reload geo database",
+			"path", db.path,
+			"error", err,
+		)
+		return
+	}
+
+	if reloaded {
+		level.Info(r.logger).Log(
+			"source", "GeoResolver.Run",
+			"message", "reloaded geo database",
+			"path", db.path,
+		)
+	}
+}
+
+func (r *resolver) databases() []*database {
+	var databases []*database
+	if r.city != nil {
+		databases = append(databases, r.city)
+	}
+	if r.asn != nil {
+		databases = append(databases, r.asn)
+	}
+	return databases
+}
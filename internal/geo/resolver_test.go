@@ -0,0 +1,236 @@
+package geo
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// encode encodes a value in the MaxMind DB data format. Only the
+// types used by GeoLite2 records in these tests are supported.
+func encode(v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		if len(v) >= 29 {
+			return append([]byte{2<<5 | 29, byte(len(v) - 29)}, v...)
+		}
+		return append([]byte{2<<5 | byte(len(v))}, v...)
+	case uint32:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		return append([]byte{6<<5 | 4}, b...)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b := []byte{7<<5 | byte(len(v))}
+		for _, k := range keys {
+			b = append(b, encode(k)...)
+			b = append(b, encode(v[k])...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+// writeDatabase writes an IPv4 database with a single node. IP
+// addresses with a leading 0 bit resolve to the low record and all
+// others resolve to the high record.
+func writeDatabase(t *testing.T, path string, low, high map[string]interface{}) {
+	lowData, highData := encode(low), encode(high)
+
+	const nodeCount = 1
+	record := func(offset int) []byte {
+		p := uint32(nodeCount + 16 + offset)
+		return []byte{byte(p >> 16), byte(p >> 8), byte(p)}
+	}
+
+	var b []byte
+	b = append(b, record(0)...)
+	b = append(b, record(len(lowData))...)
+	b = append(b, make([]byte, 16)...)
+	b = append(b, lowData...)
+	b = append(b, highData...)
+	b = append(b, "\xAB\xCD\xEFMaxMind.com"...)
+	b = append(b, encode(map[string]interface{}{
+		"node_count":  uint32(nodeCount),
+		"record_size": uint32(24),
+		"ip_version":  uint32(4),
+	})...)
+
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal("failed to write database:", err)
+	}
+}
+
+func cityData(country, city string) map[string]interface{} {
+	return map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": country},
+		"city": map[string]interface{}{
+			"names": map[string]interface{}{"en": city},
+		},
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "geo")
+	if err != nil {
+		t.Fatal("failed to create temp dir:", err)
+	}
+	return dir
+}
+
+func TestResolver_Lookup(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	cityPath := filepath.Join(dir, "city.mmdb")
+	asnPath := filepath.Join(dir, "asn.mmdb")
+	writeDatabase(t, cityPath, cityData("DE", "Berlin"), map[string]interface{}{})
+	writeDatabase(t, asnPath, map[string]interface{}{
+		"autonomous_system_number":       uint32(3320),
+		"autonomous_system_organization": "Deutsche Telekom AG",
+	}, map[string]interface{}{})
+
+	tt := []struct {
+		name     string
+		options  []ConfigOption
+		ip       string
+		location *auth.GeoLocation
+	}{
+		{
+			name:    "City and ASN",
+			options: []ConfigOption{WithCityDB(cityPath), WithASNDB(asnPath)},
+			ip:      "10.0.0.1",
+			location: &auth.GeoLocation{
+				Country:        "DE",
+				City:           "Berlin",
+				ASN:            3320,
+				ASOrganization: "Deutsche Telekom AG",
+			},
+		},
+		{
+			name:     "City only",
+			options:  []ConfigOption{WithCityDB(cityPath)},
+			ip:       "10.0.0.1",
+			location: &auth.GeoLocation{Country: "DE", City: "Berlin"},
+		},
+		{
+			name:     "Empty record",
+			options:  []ConfigOption{WithCityDB(cityPath), WithASNDB(asnPath)},
+			ip:       "192.168.0.1",
+			location: nil,
+		},
+		{
+			name:     "Invalid IP",
+			options:  []ConfigOption{WithCityDB(cityPath)},
+			ip:       "not-an-ip",
+			location: nil,
+		},
+		{
+			name:     "No databases",
+			options:  []ConfigOption{},
+			ip:       "10.0.0.1",
+			location: nil,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewResolver(tc.options...)
+			if err != nil {
+				t.Fatal("failed to create resolver:", err)
+			}
+
+			loc := r.Lookup(tc.ip)
+			if tc.location == nil {
+				if loc != nil {
+					t.Errorf("incorrect location, want nil got %+v", loc)
+				}
+				return
+			}
+			if loc == nil || *loc != *tc.location {
+				t.Errorf("incorrect location, want %#v got %#v", tc.location, loc)
+			}
+		})
+	}
+}
+
+func TestResolver_MissingDatabase(t *testing.T) {
+	_, err := NewResolver(WithCityDB("/does/not/exist.mmdb"))
+	if err == nil {
+		t.Error("expected error for missing database")
+	}
+}
+
+func TestResolver_Reload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "city.mmdb")
+	writeDatabase(t, path, cityData("DE", "Berlin"), map[string]interface{}{})
+
+	r, err := NewResolver(WithCityDB(path), WithInterval(time.Millisecond*10))
+	if err != nil {
+		t.Fatal("failed to create resolver:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	waitFor := func(city string) {
+		deadline := time.Now().Add(time.Second * 2)
+		for time.Now().Before(deadline) {
+			if loc := r.Lookup("10.0.0.1"); loc != nil && loc.City == city {
+				return
+			}
+			time.Sleep(time.Millisecond * 10)
+		}
+		t.Fatalf("database was not reloaded, want city %s", city)
+	}
+
+	writeDatabase(t, path, cityData("FR", "Paris"), map[string]interface{}{})
+	modTime := time.Now().Add(time.Minute)
+	if err = os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal("failed to change mod time:", err)
+	}
+	waitFor("Paris")
+
+	if err = ioutil.WriteFile(path, []byte("invalid"), 0600); err != nil {
+		t.Fatal("failed to write database:", err)
+	}
+	modTime = modTime.Add(time.Minute)
+	if err = os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal("failed to change mod time:", err)
+	}
+	time.Sleep(time.Millisecond * 50)
+	waitFor("Paris")
+}
+
+func TestGeoLocation_String(t *testing.T) {
+	tt := []struct {
+		location auth.GeoLocation
+		s        string
+	}{
+		{auth.GeoLocation{Country: "DE", City: "Berlin"}, "Berlin, DE"},
+		{auth.GeoLocation{Country: "DE"}, "DE"},
+		{auth.GeoLocation{}, ""},
+	}
+
+	for _, tc := range tt {
+		if s := tc.location.String(); s != tc.s {
+			t.Errorf("incorrect string, want %q got %q", tc.s, s)
+		}
+	}
+}
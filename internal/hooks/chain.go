@@ -0,0 +1,58 @@
+// Package hooks composes auth.Hooks and runs hooks written as Lua
+// scripts, for operators who cannot recompile the service.
+package hooks
+
+import (
+	"context"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// chain runs Hooks in order, stopping at the first error.
+type chain []auth.Hooks
+
+// Chain returns Hooks running each of hooks in order. The first
+// error aborts the request and later hooks are not run.
+func Chain(hooks ...auth.Hooks) auth.Hooks {
+	return chain(hooks)
+}
+
+// BeforeSignup runs BeforeSignup of every hook.
+func (c chain) BeforeSignup(ctx context.Context, user *auth.User) error {
+	for _, h := range c {
+		if err := h.BeforeSignup(ctx, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AfterSignup runs AfterSignup of every hook.
+func (c chain) AfterSignup(ctx context.Context, user *auth.User) error {
+	for _, h := range c {
+		if err := h.AfterSignup(ctx, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AfterLogin runs AfterLogin of every hook.
+func (c chain) AfterLogin(ctx context.Context, user *auth.User, token *auth.Token) error {
+	for _, h := range c {
+		if err := h.AfterLogin(ctx, user, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BeforeTokenIssue runs BeforeTokenIssue of every hook.
+func (c chain) BeforeTokenIssue(ctx context.Context, user *auth.User, token *auth.Token) error {
+	for _, h := range c {
+		if err := h.BeforeTokenIssue(ctx, user, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package hooks
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const defaultTimeout = time.Millisecond * 100
+
+// NewScript returns Hooks running the functions of a Lua script.
+// The script is compiled and run once to report errors early.
+func NewScript(options ...ConfigOption) (auth.Hooks, error) {
+	s := script{
+		logger:  log.NewNopLogger(),
+		timeout: defaultTimeout,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	if err := s.compile(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// ConfigOption configures the script.
+type ConfigOption func(*script)
+
+// WithLogger configures the script with a logger. Messages
+// passed to the script's log function are written to it.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *script) {
+		s.logger = l
+	}
+}
+
+// WithScript configures the path of the Lua script.
+func WithScript(path string) ConfigOption {
+	return func(s *script) {
+		s.path = path
+	}
+}
+
+// WithTimeout configures the maximum time a hook may run.
+func WithTimeout(d time.Duration) ConfigOption {
+	return func(s *script) {
+		s.timeout = d
+	}
+}
+
+// WithFailOpen configures requests to proceed when a hook fails
+// with an error or timeout, rather than failing the request.
+// Rejections returned by a hook are always enforced.
+func WithFailOpen(failOpen bool) ConfigOption {
+	return func(s *script) {
+		s.failOpen = failOpen
+	}
+}
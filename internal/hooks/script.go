@@ -0,0 +1,413 @@
+package hooks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// Functions a script may define. Undefined functions are skipped.
+const (
+	fnBeforeSignup     = "before_signup"
+	fnAfterSignup      = "after_signup"
+	fnAfterLogin       = "after_login"
+	fnBeforeTokenIssue = "before_token_issue"
+)
+
+const (
+	// maxDepth is the maximum nesting of tables converted to claims.
+	maxDepth = 8
+	// maxPoolSize is the maximum number of idle states kept for reuse.
+	maxPoolSize = 16
+	// maxStringSize is the maximum length of a string built by string.rep.
+	maxStringSize = 1 << 20
+	// callStackSize is the maximum depth of nested calls in a script.
+	callStackSize = 64
+	// registrySize is the size of a state's data stack. It does not grow.
+	registrySize = 1024 * 8
+)
+
+// unsafeGlobals are removed from the base library so scripts cannot
+// load code, reach the file system or write to stdout.
+var unsafeGlobals = []string{
+	"collectgarbage", "dofile", "getfenv", "load", "loadfile",
+	"loadstring", "module", "newproxy", "print", "require", "setfenv",
+}
+
+// script is an implementation of auth.Hooks running functions of a
+// Lua script. Scripts only have access to the base, table, string and
+// math libraries and a log function. The script is run in a fresh
+// environment for every call so globals set by one request are not
+// visible to another. Each function is called with
+// tables describing the User and, where available, the token. It
+// returns nil to allow the request or a string to reject it with the
+// string as the reason. before_token_issue may instead return a table
+// of claims added to the token.
+type script struct {
+	logger   log.Logger
+	path     string
+	timeout  time.Duration
+	failOpen bool
+
+	proto *lua.FunctionProto
+	mu    sync.Mutex
+	pool  []*lua.LState
+}
+
+// BeforeSignup runs the script's before_signup function.
+func (s *script) BeforeSignup(ctx context.Context, user *auth.User) error {
+	_, err := s.run(ctx, fnBeforeSignup, func(L *lua.LState) []lua.LValue {
+		return []lua.LValue{userTable(L, user)}
+	})
+	return err
+}
+
+// AfterSignup runs the script's after_signup function.
+func (s *script) AfterSignup(ctx context.Context, user *auth.User) error {
+	_, err := s.run(ctx, fnAfterSignup, func(L *lua.LState) []lua.LValue {
+		return []lua.LValue{userTable(L, user)}
+	})
+	return err
+}
+
+// AfterLogin runs the script's after_login function.
+func (s *script) AfterLogin(ctx context.Context, user *auth.User, token *auth.Token) error {
+	_, err := s.run(ctx, fnAfterLogin, func(L *lua.LState) []lua.LValue {
+		return []lua.LValue{userTable(L, user), tokenTable(L, token)}
+	})
+	return err
+}
+
+// BeforeTokenIssue runs the script's before_token_issue function
+// and adds returned claims to the token.
+func (s *script) BeforeTokenIssue(ctx context.Context, user *auth.User, token *auth.Token) error {
+	claims, err := s.run(ctx, fnBeforeTokenIssue, func(L *lua.LState) []lua.LValue {
+		return []lua.LValue{userTable(L, user), tokenTable(L, token)}
+	})
+	if err != nil || len(claims) == 0 {
+		return err
+	}
+
+	if token.Custom == nil {
+		token.Custom = map[string]interface{}{}
+	}
+	for k, v := range claims {
+		token.Custom[k] = v
+	}
+
+	return nil
+}
+
+// run calls a function of the script within the configured timeout.
+// It returns the claims of a returned table, or an error if the
+// function rejected the request or failed.
+func (s *script) run(ctx context.Context, name string, args func(*lua.LState) []lua.LValue) (map[string]interface{}, error) {
+	L := s.get()
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	L.SetContext(ctx)
+	env, err := s.load(L)
+	if err != nil {
+		L.RemoveContext()
+		L.Close()
+		return nil, s.fail(name, err)
+	}
+
+	fn := env.RawGetString(name)
+	if fn.Type() != lua.LTFunction {
+		L.RemoveContext()
+		s.put(L)
+		return nil, nil
+	}
+
+	err = L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, args(L)...)
+	L.RemoveContext()
+	if err != nil {
+		// An interrupted state may be left inconsistent and
+		// is not reused.
+		L.Close()
+		return nil, s.fail(name, err)
+	}
+
+	ret := L.Get(-1)
+	L.Pop(1)
+
+	var claims map[string]interface{}
+	switch ret := ret.(type) {
+	case *lua.LNilType:
+	case lua.LString:
+		err = auth.ErrForbidden(string(ret))
+	case *lua.LTable:
+		claims, _ = toGo(ret, 0).(map[string]interface{})
+	default:
+		err = s.fail(name, fmt.Errorf("unexpected return value of type %s", ret.Type()))
+	}
+
+	s.put(L)
+	return claims, err
+}
+
+// fail reports a failed function. Requests proceed if the
+// script is configured to fail open.
+func (s *script) fail(name string, err error) error {
+	level.Error(s.logger).Log(
+		"source", "hooks.Script",
+		"message", "script hook failed",
+		"hook", name,
+		"error", err,
+	)
+
+	if s.failOpen {
+		return nil
+	}
+
+	return fmt.Errorf("script hook %s failed: %w", name, err)
+}
+
+// compile compiles the script and runs it once to report errors.
+func (s *script) compile() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("cannot open script: %w", err)
+	}
+	defer f.Close()
+
+	chunk, err := parse.Parse(bufio.NewReader(f), s.path)
+	if err != nil {
+		return fmt.Errorf("cannot parse script: %w", err)
+	}
+
+	s.proto, err = lua.Compile(chunk, s.path)
+	if err != nil {
+		return fmt.Errorf("cannot compile script: %w", err)
+	}
+
+	L := s.get()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	L.SetContext(ctx)
+	_, err = s.load(L)
+	L.RemoveContext()
+	if err != nil {
+		L.Close()
+		return err
+	}
+	s.put(L)
+
+	return nil
+}
+
+// load runs the script in a fresh environment and returns it. The
+// environment holds copies of the state's globals and libraries, so
+// changes made by the script do not outlive the call.
+func (s *script) load(L *lua.LState) (*lua.LTable, error) {
+	env := L.NewTable()
+	L.G.Global.ForEach(func(k, v lua.LValue) {
+		if lib, ok := v.(*lua.LTable); ok {
+			cp := L.NewTable()
+			lib.ForEach(cp.RawSet)
+			v = cp
+		}
+		env.RawSet(k, v)
+	})
+	env.RawSetString("_G", env)
+
+	chunk := L.NewFunctionFromProto(s.proto)
+	chunk.Env = env
+	if err := L.CallByParam(lua.P{Fn: chunk, Protect: true}); err != nil {
+		return nil, fmt.Errorf("cannot run script: %w", err)
+	}
+
+	return env, nil
+}
+
+// get returns an idle state or a new one. States are not safe
+// for concurrent use.
+func (s *script) get() *lua.LState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.pool)
+	if n == 0 {
+		return s.newState()
+	}
+
+	L := s.pool[n-1]
+	s.pool = s.pool[:n-1]
+	return L
+}
+
+// put returns a state to the pool, or closes it if the
+// pool is full.
+func (s *script) put(L *lua.LState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pool) >= maxPoolSize {
+		L.Close()
+		return
+	}
+	s.pool = append(s.pool, L)
+}
+
+// newState creates a sandboxed state with limited stack sizes.
+// The script is not run in it until a call loads it.
+func (s *script) newState() *lua.LState {
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:  true,
+		CallStackSize: callStackSize,
+		RegistrySize:  registrySize,
+	})
+
+	libs := []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	}
+	for _, lib := range libs {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range unsafeGlobals {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.SetGlobal("log", L.NewFunction(s.log))
+	L.SetGlobal("getmetatable", L.NewFunction(getMetatable))
+	L.SetField(L.GetGlobal(lua.StringLibName), "rep", L.NewFunction(strRep))
+
+	return L
+}
+
+// getMetatable replaces the base getmetatable so scripts cannot
+// reach the string library shared by every environment through
+// the metatable of strings.
+func getMetatable(L *lua.LState) int {
+	if t, ok := L.CheckAny(1).(*lua.LTable); ok {
+		L.Push(L.GetMetatable(t))
+		return 1
+	}
+	L.Push(lua.LNil)
+	return 1
+}
+
+// strRep replaces string.rep to limit the length of the result.
+// A call is only interrupted between instructions, so a single
+// large repetition would otherwise exhaust memory.
+func strRep(L *lua.LState) int {
+	str := L.CheckString(1)
+	n := L.CheckInt(2)
+	if n <= 0 || len(str) == 0 {
+		L.Push(lua.LString(""))
+		return 1
+	}
+	if n > maxStringSize/len(str) {
+		L.RaiseError("string.rep result exceeds %d bytes", maxStringSize)
+		return 0
+	}
+	L.Push(lua.LString(strings.Repeat(str, n)))
+	return 1
+}
+
+// log writes a message from the script to the logger.
+func (s *script) log(L *lua.LState) int {
+	level.Info(s.logger).Log(
+		"source", "hooks.Script",
+		"message", L.CheckString(1),
+	)
+	return 0
+}
+
+// userTable describes a User to a script. Secrets are omitted.
+func userTable(L *lua.LState, user *auth.User) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("id", lua.LString(user.ID))
+	t.RawSetString("email", lua.LString(user.Email.String))
+	t.RawSetString("phone", lua.LString(user.Phone.String))
+	t.RawSetString("is_verified", lua.LBool(user.IsVerified))
+	t.RawSetString("is_email_otp_allowed", lua.LBool(user.IsEmailOTPAllowed))
+	t.RawSetString("is_phone_otp_allowed", lua.LBool(user.IsPhoneOTPAllowed))
+	t.RawSetString("is_totp_allowed", lua.LBool(user.IsTOTPAllowed))
+	t.RawSetString("is_device_allowed", lua.LBool(user.IsDeviceAllowed))
+	return t
+}
+
+// tokenTable describes the claims of a token to a script.
+func tokenTable(L *lua.LState, token *auth.Token) *lua.LTable {
+	orgs := L.NewTable()
+	for _, o := range token.Organizations {
+		org := L.NewTable()
+		org.RawSetString("id", lua.LString(o.ID))
+		org.RawSetString("role", lua.LString(o.Role))
+		orgs.Append(org)
+	}
+
+	t := L.NewTable()
+	t.RawSetString("id", lua.LString(token.Id))
+	t.RawSetString("state", lua.LString(token.State))
+	t.RawSetString("amr", stringsTable(L, token.AuthMethods))
+	t.RawSetString("aud", stringsTable(L, token.Audiences))
+	t.RawSetString("scopes", stringsTable(L, token.Scopes))
+	t.RawSetString("azp", lua.LString(token.ClientApplicationID))
+	t.RawSetString("orgs", orgs)
+	return t
+}
+
+func stringsTable(L *lua.LState, values []string) *lua.LTable {
+	t := L.NewTable()
+	for _, v := range values {
+		t.Append(lua.LString(v))
+	}
+	return t
+}
+
+// toGo converts a Lua value to a claim. Tables with a sequence are
+// converted to lists and other tables to maps. Functions and tables
+// nested deeper than maxDepth are dropped.
+func toGo(v lua.LValue, depth int) interface{} {
+	switch v := v.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if depth >= maxDepth {
+			return nil
+		}
+		if n := v.MaxN(); n > 0 {
+			list := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				list = append(list, toGo(v.RawGetInt(i), depth+1))
+			}
+			return list
+		}
+		m := map[string]interface{}{}
+		v.ForEach(func(k, value lua.LValue) {
+			m[k.String()] = toGo(value, depth+1)
+		})
+		return m
+	default:
+		return nil
+	}
+}
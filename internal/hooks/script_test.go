@@ -0,0 +1,276 @@
+package hooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func writeScript(t *testing.T, src string) string {
+	f, err := ioutil.TempFile("", "hooks-*.lua")
+	if err != nil {
+		t.Fatal("failed to create script:", err)
+	}
+	defer f.Close()
+
+	if _, err = f.WriteString(src); err != nil {
+		t.Fatal("failed to write script:", err)
+	}
+
+	return f.Name()
+}
+
+func TestHooks_Script(t *testing.T) {
+	tt := []struct {
+		name     string
+		src      string
+		failOpen bool
+		hasErr   bool
+		errCode  auth.ErrCode
+		claims   map[string]interface{}
+	}{
+		{
+			name: "Allows request",
+			src: `
+				function before_token_issue(user, token)
+					return nil
+				end
+			`,
+		},
+		{
+			name:   "Skips undefined function",
+			src:    `function before_signup(user) return "no signups" end`,
+			hasErr: false,
+		},
+		{
+			name: "Rejects request",
+			src: `
+				function before_token_issue(user, token)
+					if string.find(user.email, "@blocked.com$") then
+						return "domain is blocked"
+					end
+				end
+			`,
+			hasErr:  true,
+			errCode: auth.EForbidden,
+		},
+		{
+			name: "Adds claims",
+			src: `
+				function before_token_issue(user, token)
+					return {tenant = "acme", amr = token.amr}
+				end
+			`,
+			claims: map[string]interface{}{
+				"tenant": "acme",
+				"amr":    []interface{}{"password", "totp"},
+			},
+		},
+		{
+			name: "Fails closed on timeout",
+			src: `
+				function before_token_issue(user, token)
+					while true do end
+				end
+			`,
+			hasErr: true,
+		},
+		{
+			name: "Fails open on timeout",
+			src: `
+				function before_token_issue(user, token)
+					while true do end
+				end
+			`,
+			failOpen: true,
+		},
+		{
+			name: "Sandbox excludes os library",
+			src: `
+				function before_token_issue(user, token)
+					os.exit(1)
+				end
+			`,
+			hasErr: true,
+		},
+		{
+			name: "Sandbox excludes loading code",
+			src: `
+				function before_token_issue(user, token)
+					dofile("/etc/passwd")
+				end
+			`,
+			hasErr: true,
+		},
+		{
+			name: "Limits string repetition",
+			src: `
+				function before_token_issue(user, token)
+					local s = ("x"):rep(1024)
+					return {size = #string.rep(s, 1024 * 1024)}
+				end
+			`,
+			hasErr: true,
+		},
+		{
+			name: "Limits call depth",
+			src: `
+				local function recurse(n) return 1 + recurse(n + 1) end
+				function before_token_issue(user, token)
+					return {depth = recurse(0)}
+				end
+			`,
+			hasErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeScript(t, tc.src)
+			defer os.Remove(path)
+
+			h, err := NewScript(
+				WithLogger(&test.Logger{}),
+				WithScript(path),
+				WithTimeout(time.Millisecond*50),
+				WithFailOpen(tc.failOpen),
+			)
+			if err != nil {
+				t.Fatal("failed to create script hooks:", err)
+			}
+
+			user := &auth.User{ID: "user-id", Email: sql.NullString{String: "jane@blocked.com", Valid: true}}
+			token := &auth.Token{AuthMethods: []string{"password", "totp"}}
+			err = h.BeforeTokenIssue(context.Background(), user, token)
+			if tc.hasErr != (err != nil) {
+				t.Fatalf("incorrect error, want error %v got %v", tc.hasErr, err)
+			}
+
+			var domainErr auth.Error
+			if tc.errCode != "" && (!errors.As(err, &domainErr) || domainErr.Code() != tc.errCode) {
+				t.Errorf("incorrect error code, want %v got %v", tc.errCode, err)
+			}
+
+			for k, v := range tc.claims {
+				if !equalClaim(token.Custom[k], v) {
+					t.Errorf("incorrect claim %s, want %v got %v", k, v, token.Custom[k])
+				}
+			}
+		})
+	}
+}
+
+func TestHooks_ScriptIsolation(t *testing.T) {
+	path := writeScript(t, `
+		function after_login(user, token)
+			string.upper = function() return "leaked" end
+			seen = user.id
+		end
+
+		function before_token_issue(user, token)
+			return {seen = seen or "", upper = string.upper("a")}
+		end
+	`)
+	defer os.Remove(path)
+
+	h, err := NewScript(WithScript(path))
+	if err != nil {
+		t.Fatal("failed to create script hooks:", err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < maxPoolSize+4; i++ {
+		if err = h.AfterLogin(ctx, &auth.User{ID: "first-user"}, &auth.Token{}); err != nil {
+			t.Fatal("failed to run after_login:", err)
+		}
+	}
+
+	token := &auth.Token{}
+	if err = h.BeforeTokenIssue(ctx, &auth.User{ID: "second-user"}, token); err != nil {
+		t.Fatal("failed to run before_token_issue:", err)
+	}
+	if token.Custom["seen"] != "" {
+		t.Errorf("global leaked between calls, got %v", token.Custom["seen"])
+	}
+	if token.Custom["upper"] != "A" {
+		t.Errorf("library change leaked between calls, got %v", token.Custom["upper"])
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < maxPoolSize*2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.AfterLogin(ctx, &auth.User{ID: "user-id"}, &auth.Token{})
+		}()
+	}
+	wg.Wait()
+
+	if n := len(h.(*script).pool); n > maxPoolSize {
+		t.Errorf("pool exceeds its limit, want at most %d got %d", maxPoolSize, n)
+	}
+}
+
+func TestHooks_ScriptInvalid(t *testing.T) {
+	path := writeScript(t, `function before_signup(user`)
+	defer os.Remove(path)
+
+	_, err := NewScript(WithScript(path))
+	if err == nil {
+		t.Error("expected parse error, got nil")
+	}
+
+	_, err = NewScript(WithScript("/does/not/exist.lua"))
+	if err == nil {
+		t.Error("expected missing script error, got nil")
+	}
+}
+
+func TestHooks_Chain(t *testing.T) {
+	first := &test.Hooks{
+		BeforeSignupFn: func() error {
+			return auth.ErrForbidden("signup is blocked")
+		},
+	}
+	second := &test.Hooks{}
+
+	h := Chain(first, second)
+	if err := h.BeforeSignup(context.Background(), &auth.User{}); err == nil {
+		t.Error("expected chain to return the first error")
+	}
+	if second.Calls.BeforeSignup != 0 {
+		t.Error("expected chain to stop at the first error")
+	}
+
+	if err := h.AfterSignup(context.Background(), &auth.User{}); err != nil {
+		t.Error("expected nil error:", err)
+	}
+	if first.Calls.AfterSignup != 1 || second.Calls.AfterSignup != 1 {
+		t.Error("expected chain to run every hook")
+	}
+}
+
+func equalClaim(a, b interface{}) bool {
+	al, aok := a.([]interface{})
+	bl, bok := b.([]interface{})
+	if aok || bok {
+		if len(al) != len(bl) {
+			return false
+		}
+		for i := range al {
+			if al[i] != bl[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
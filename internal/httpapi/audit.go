@@ -0,0 +1,21 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Audit writes a structured audit log entry for an account security
+// event, recording the client making the request.
+func Audit(logger log.Logger, r *http.Request, source, event, userID string, keyvals ...interface{}) {
+	keyvals = append([]interface{}{
+		"source", source,
+		"audit", event,
+		"user_id", userID,
+		"ip", GetIP(r),
+		"user_agent", r.UserAgent(),
+	}, keyvals...)
+	level.Info(logger).Log(keyvals...)
+}
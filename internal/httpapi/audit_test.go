@@ -0,0 +1,26 @@
+package httpapi
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestHTTPAPI_Audit(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.NewLogfmtLogger(&buf)
+
+	req := httptest.NewRequest("POST", "/api/v1/login", nil)
+	req.RemoteAddr = "203.0.113.7:4000"
+	req.Header.Set("User-Agent", "test-agent")
+
+	Audit(logger, req, "LoginAPI", "account_locked", "user-id", "failures", 5)
+
+	want := "level=info source=LoginAPI audit=account_locked user_id=user-id " +
+		"ip=203.0.113.7 user_agent=test-agent failures=5\n"
+	if buf.String() != want {
+		t.Errorf("incorrect audit entry, want %q got %q", want, buf.String())
+	}
+}
@@ -0,0 +1,178 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const strictJSONContextKey contextKey = "strictJSON"
+
+// BodyLimits configures the limits enforced on request bodies.
+type BodyLimits struct {
+	// MaxBytes is the maximum size of a request body. Bodies are
+	// not limited if it is 0.
+	MaxBytes int64
+	// MaxDepth is the maximum nesting depth of JSON objects and
+	// arrays in a request body. Nesting is not limited if it is 0.
+	MaxDepth int
+	// DisallowUnknownFields rejects JSON request bodies containing
+	// fields which are not part of the request.
+	DisallowUnknownFields bool
+}
+
+// BodyLimitMiddleware enforces BodyLimits on every request. Bodies
+// exceeding the size limit are rejected with a 413 and bodies nested
+// too deeply with a 400 before reaching a handler.
+func BodyLimitMiddleware(limits BodyLimits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limits.DisallowUnknownFields {
+				r = r.WithContext(context.WithValue(r.Context(), strictJSONContextKey, true))
+			}
+
+			if r.Body == nil || r.Body == http.NoBody || (limits.MaxBytes == 0 && limits.MaxDepth == 0) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if limits.MaxBytes > 0 && r.ContentLength > limits.MaxBytes {
+				ErrorResponse(w, auth.ErrTooLarge("request body is too large"))
+				return
+			}
+
+			var body io.Reader = r.Body
+			if limits.MaxBytes > 0 {
+				body = io.LimitReader(r.Body, limits.MaxBytes+1)
+			}
+			b, err := ioutil.ReadAll(body)
+			if err != nil {
+				ErrorResponse(w, auth.ErrBadRequest("cannot read request body"))
+				return
+			}
+
+			if limits.MaxBytes > 0 && int64(len(b)) > limits.MaxBytes {
+				ErrorResponse(w, auth.ErrTooLarge("request body is too large"))
+				return
+			}
+
+			if limits.MaxDepth > 0 && jsonDepth(b) > limits.MaxDepth {
+				ErrorResponse(w, auth.ErrBadRequest("request body is nested too deeply"))
+				return
+			}
+
+			r.Body = ioutil.NopCloser(bytes.NewReader(b))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DecodeJSON decodes a JSON request body. Unknown fields are rejected
+// if BodyLimitMiddleware is configured to disallow them.
+func DecodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	if strict, _ := r.Context().Value(strictJSONContextKey).(bool); strict {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
+
+// DecodeJSONError converts an error returned by DecodeJSON to a
+// validation error describing the offending field. Malformed JSON
+// is reported as a bad request.
+func DecodeJSONError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Errorf("%v: %w", err, auth.ErrField(
+			typeErr.Field,
+			auth.FieldType,
+			fmt.Sprintf("%s must be %s", typeErr.Field, jsonType(typeErr.Type)),
+		))
+	}
+
+	// The json package does not export an error type for
+	// unknown fields.
+	const unknownPrefix = "json: unknown field "
+	if msg := err.Error(); strings.HasPrefix(msg, unknownPrefix) {
+		field, unquoteErr := strconv.Unquote(strings.TrimPrefix(msg, unknownPrefix))
+		if unquoteErr == nil {
+			return fmt.Errorf("%v: %w", err, auth.ErrField(
+				field,
+				auth.FieldUnknown,
+				fmt.Sprintf("%s is not a supported field", field),
+			))
+		}
+	}
+
+	return fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+}
+
+// jsonType describes the JSON type expected for a Go type.
+func jsonType(t reflect.Type) string {
+	if t == nil {
+		return "a valid value"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a valid value"
+	}
+}
+
+// jsonDepth returns the maximum nesting depth of objects and arrays
+// in a JSON document without decoding it. Brackets within strings
+// are ignored.
+func jsonDepth(b []byte) int {
+	var depth, max int
+	var inString, escaped bool
+
+	for _, c := range b {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+
+	return max
+}
@@ -0,0 +1,189 @@
+package httpapi
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestHTTPAPI_BodyLimitMiddleware(t *testing.T) {
+	tt := []struct {
+		name       string
+		body       string
+		statusCode int
+		message    string
+	}{
+		{
+			name:       "Accepts body within limits",
+			body:       `{"identity":"jane@example.com","nested":{"a":[1,2]}}`,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Rejects body exceeding size",
+			body:       `{"identity":"` + strings.Repeat("a", 100) + `"}`,
+			statusCode: http.StatusRequestEntityTooLarge,
+			message:    "Request body is too large",
+		},
+		{
+			name:       "Rejects body nested too deeply",
+			body:       strings.Repeat("[", 4) + strings.Repeat("]", 4),
+			statusCode: http.StatusBadRequest,
+			message:    "Request body is nested too deeply",
+		},
+		{
+			name:       "Ignores brackets within strings",
+			body:       `{"identity":"[[[[\"{{{{"}`,
+			statusCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var received string
+			handler := BodyLimitMiddleware(BodyLimits{MaxBytes: 64, MaxDepth: 3})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, err := ioutil.ReadAll(r.Body)
+					if err != nil {
+						t.Fatal("failed to read body:", err)
+					}
+					received = string(b)
+				}),
+			)
+
+			req := httptest.NewRequest("POST", "/api/v1/login", bytes.NewBufferString(tc.body))
+			// Clients may omit or misreport the length of a body.
+			req.ContentLength = -1
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.statusCode {
+				t.Fatalf("incorrect status code, want %v got %v", tc.statusCode, resp.StatusCode)
+			}
+
+			if tc.statusCode == http.StatusOK {
+				if received != tc.body {
+					t.Errorf("incorrect body received, want %s got %s", tc.body, received)
+				}
+				return
+			}
+
+			b, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal("failed to read body:", err)
+			}
+			if err = test.ValidateErrMessage(tc.message, bytes.NewBuffer(b)); err != nil {
+				t.Error("error message does not match:", err)
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_DecodeJSON(t *testing.T) {
+	tt := []struct {
+		name   string
+		strict bool
+		hasErr bool
+	}{
+		{
+			name:   "Ignores unknown fields",
+			strict: false,
+			hasErr: false,
+		},
+		{
+			name:   "Rejects unknown fields",
+			strict: true,
+			hasErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var decodeErr error
+			handler := BodyLimitMiddleware(BodyLimits{DisallowUnknownFields: tc.strict})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var req struct {
+						Identity string `json:"identity"`
+					}
+					decodeErr = DecodeJSON(r, &req)
+				}),
+			)
+
+			body := bytes.NewBufferString(`{"identity":"jane@example.com","isAdmin":true}`)
+			req := httptest.NewRequest("POST", "/api/v1/signup", body)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if tc.hasErr != (decodeErr != nil) {
+				t.Errorf("incorrect error result, want error %v got %v", tc.hasErr, decodeErr)
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_DecodeJSONError(t *testing.T) {
+	tt := []struct {
+		name   string
+		body   string
+		strict bool
+		code   auth.ErrCode
+		fields auth.ErrValidation
+	}{
+		{
+			name: "Describes field of wrong type",
+			body: `{"identity":true}`,
+			code: auth.EValidation,
+			fields: auth.ErrValidation{
+				{Field: "identity", Code: auth.FieldType, Message: "identity must be a string"},
+			},
+		},
+		{
+			name:   "Describes unknown field",
+			body:   `{"identity":"jane@example.com","isAdmin":true}`,
+			strict: true,
+			code:   auth.EValidation,
+			fields: auth.ErrValidation{
+				{Field: "isAdmin", Code: auth.FieldUnknown, Message: "isAdmin is not a supported field"},
+			},
+		},
+		{
+			name: "Reports malformed JSON as bad request",
+			body: `{"identity":`,
+			code: auth.EBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var decodeErr error
+			handler := BodyLimitMiddleware(BodyLimits{DisallowUnknownFields: tc.strict})(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					var req struct {
+						Identity string `json:"identity"`
+					}
+					decodeErr = DecodeJSONError(DecodeJSON(r, &req))
+				}),
+			)
+
+			req := httptest.NewRequest("POST", "/api/v1/signup", bytes.NewBufferString(tc.body))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if code := auth.ErrorCode(decodeErr); code != tc.code {
+				t.Fatalf("incorrect error code, want %s got %s", tc.code, code)
+			}
+			fields, _ := auth.DomainError(decodeErr).(auth.ErrValidation)
+			if !cmp.Equal(fields, tc.fields) {
+				t.Error(cmp.Diff(fields, tc.fields))
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package httpapi
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/fmitra/authenticator/internal/faultinject"
+)
+
+// ClientConfig holds configuration options for HTTP clients of
+// external providers.
+type ClientConfig struct {
+	// Proxy is the URL of a proxy requests are sent through. Proxies
+	// are read from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+	// variables if it is empty.
+	Proxy string
+	// Timeout is the maximum duration to connect to a provider and to
+	// await its response on each attempt of a request. Attempts are not
+	// timed out if it is 0.
+	Timeout time.Duration
+	// MaxRetries is the number of times a request is retried after
+	// a connection error or a response signalling the provider is
+	// rate limiting or temporarily unavailable.
+	MaxRetries int
+	// RetryWait is the base duration to wait before retrying a
+	// request. It doubles on each retry.
+	RetryWait time.Duration
+	// MaxRetryWait is the maximum duration to wait before retrying
+	// a request.
+	MaxRetryWait time.Duration
+	// Faults injects provider faults into each attempt of a request.
+	Faults *faultinject.Injector
+}
+
+// NewClient returns an HTTP client for requests to external providers.
+// Retries wait a random duration between half and all of the current
+// backoff so retries from many instances do not arrive at once. A
+// provider may ask to wait longer with a Retry-After header, up to
+// MaxRetryWait, after which the request is no longer retried.
+func NewClient(conf ClientConfig) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if conf.Proxy != "" {
+		u, err := url.Parse(conf.Proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", conf.Proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   conf.Timeout,
+		KeepAlive: time.Second * 30,
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   conf.Timeout,
+		ResponseHeaderTimeout: conf.Timeout,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       time.Second * 90,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+
+	return &http.Client{
+		Transport: &retryTransport{
+			base:       conf.Faults.Transport(faultinject.Providers, transport),
+			maxRetries: conf.MaxRetries,
+			wait:       conf.RetryWait,
+			maxWait:    conf.MaxRetryWait,
+		},
+	}, nil
+}
+
+// retryTransport retries requests with exponential backoff and jitter.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	wait       time.Duration
+	maxWait    time.Duration
+}
+
+// RoundTrip sends a request, retrying it on failure. Requests whose
+// body cannot be replayed are not retried.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+
+		resp, err := t.base.RoundTrip(r)
+
+		isReplayable := req.Body == nil || req.GetBody != nil
+		if attempt >= t.maxRetries || !isReplayable || !isRetryable(resp, err) ||
+			req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait, ok := t.backoff(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// backoff returns the duration to wait before a retry. It reports
+// false if the provider asks to wait longer than the maximum wait.
+func (t *retryTransport) backoff(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+		if err == nil && seconds > 0 {
+			retryAfter := time.Duration(seconds) * time.Second
+			return retryAfter, retryAfter <= t.maxWait
+		}
+	}
+
+	wait := t.wait << uint(attempt)
+	if wait > t.maxWait || wait <= 0 {
+		wait = t.maxWait
+	}
+	if wait <= 0 {
+		return 0, true
+	}
+
+	half := int64(wait / 2)
+	return time.Duration(half + rand.Int63n(half+1)), true
+}
+
+// isRetryable reports whether a request failed with a connection error
+// or a response signalling the provider is rate limiting or temporarily
+// unavailable. Other errors are not retried as the provider may have
+// processed the request.
+func isRetryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,153 @@
+package httpapi
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fmitra/authenticator/internal/faultinject"
+)
+
+func TestHTTPAPI_ClientRetries(t *testing.T) {
+	tt := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		maxRetries int
+		attempts   int
+		statusCode int
+	}{
+		{
+			name:       "Retries unavailable provider",
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusCreated},
+			maxRetries: 2,
+			attempts:   3,
+			statusCode: http.StatusCreated,
+		},
+		{
+			name:       "Stops after max retries",
+			statuses:   []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			maxRetries: 1,
+			attempts:   2,
+			statusCode: http.StatusBadGateway,
+		},
+		{
+			name:       "Does not retry rejected request",
+			statuses:   []int{http.StatusBadRequest, http.StatusCreated},
+			maxRetries: 2,
+			attempts:   1,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Does not retry beyond max wait",
+			statuses:   []int{http.StatusTooManyRequests, http.StatusCreated},
+			retryAfter: "60",
+			maxRetries: 2,
+			attempts:   1,
+			statusCode: http.StatusTooManyRequests,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				if string(body) != "hello world" {
+					t.Errorf("incorrect request body on attempt %v: %q", attempts, body)
+				}
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(tc.statuses[attempts])
+				attempts++
+			}))
+			defer srv.Close()
+
+			client, err := NewClient(ClientConfig{
+				Timeout:      time.Second,
+				MaxRetries:   tc.maxRetries,
+				RetryWait:    time.Millisecond,
+				MaxRetryWait: time.Millisecond * 10,
+			})
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+
+			resp, err := client.Post(srv.URL, "text/plain", bytes.NewBufferString("hello world"))
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+			resp.Body.Close()
+
+			if attempts != tc.attempts {
+				t.Errorf("incorrect attempts, want %v got %v", tc.attempts, attempts)
+			}
+			if resp.StatusCode != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_ClientProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	client, err := NewClient(ClientConfig{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+
+	resp, err := client.Get("http://provider.example.com/messages")
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	resp.Body.Close()
+
+	if proxied != "http://provider.example.com/messages" {
+		t.Errorf("request not sent through proxy, got %q", proxied)
+	}
+
+	if _, err = NewClient(ClientConfig{Proxy: "proxy.example.com"}); err == nil {
+		t.Error("expected error for invalid proxy URL, received nil")
+	}
+}
+
+func TestHTTPAPI_ClientFaults(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(ClientConfig{
+		Timeout:      time.Second,
+		MaxRetries:   2,
+		RetryWait:    time.Millisecond,
+		MaxRetryWait: time.Millisecond * 10,
+		Faults: faultinject.New(
+			faultinject.WithFault(faultinject.Providers, faultinject.Fault{ErrorRate: 1}),
+		),
+	})
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+
+	_, err = client.Post(srv.URL, "text/plain", bytes.NewBufferString("hello world"))
+	if !errors.Is(err, faultinject.ErrInjected) {
+		t.Errorf("expected injected fault, got %v", err)
+	}
+	if attempts != 0 {
+		t.Errorf("expected no attempts to reach the provider, got %v", attempts)
+	}
+}
@@ -0,0 +1,43 @@
+package httpapi
+
+import (
+	"net/http"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clientapp"
+)
+
+// ClientApplicationHeader is the request header identifying the
+// ClientApplication a request is made on behalf of.
+const ClientApplicationHeader = "X-Client-ID"
+
+// ClientApplicationMiddleware resolves the ClientApplication identified
+// by a request and makes it available through clientapp.FromContext.
+// Requests without the header are served with the service defaults.
+// Requests from origins the ClientApplication may not be used from
+// are rejected.
+func ClientApplicationMiddleware(apps auth.ClientApplicationService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clientID := r.Header.Get(ClientApplicationHeader)
+			if clientID == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			app, err := apps.ByID(r.Context(), clientID)
+			if err != nil {
+				ErrorResponse(w, err)
+				return
+			}
+
+			origin := r.Header.Get("Origin")
+			if origin != "" && !app.IsOriginAllowed(origin) {
+				ErrorResponse(w, auth.ErrForbidden("origin is not allowed for client application"))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(clientapp.NewContext(r.Context(), app)))
+		})
+	}
+}
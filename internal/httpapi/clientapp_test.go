@@ -0,0 +1,95 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clientapp"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestHTTPAPI_ClientApplicationMiddleware(t *testing.T) {
+	tt := []struct {
+		name       string
+		clientID   string
+		origin     string
+		statusCode int
+		appID      string
+	}{
+		{
+			name:       "Serves request without client application",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Rejects unknown client application",
+			clientID:   "unknown",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "Rejects disallowed origin",
+			clientID:   "web",
+			origin:     "https://evil.example.com",
+			statusCode: http.StatusForbidden,
+		},
+		{
+			name:       "Serves allowed origin",
+			clientID:   "web",
+			origin:     "https://app.example.com",
+			statusCode: http.StatusOK,
+			appID:      "web",
+		},
+		{
+			name:       "Serves request without origin",
+			clientID:   "web",
+			statusCode: http.StatusOK,
+			appID:      "web",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			apps := &test.ClientApplicationService{
+				ByIDFn: func() (*auth.ClientApplication, error) {
+					if tc.clientID != "web" {
+						return nil, auth.ErrBadRequest("client application is invalid")
+					}
+					return &auth.ClientApplication{
+						ID:             "web",
+						AllowedOrigins: []string{"https://app.example.com"},
+					}, nil
+				},
+			}
+
+			var appID string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if app := clientapp.FromContext(r.Context()); app != nil {
+					appID = app.ID
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req, err := http.NewRequest("POST", "/api/v1/login", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			if tc.clientID != "" {
+				req.Header.Set(ClientApplicationHeader, tc.clientID)
+			}
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+
+			rr := httptest.NewRecorder()
+			ClientApplicationMiddleware(apps)(next).ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+			if appID != tc.appID {
+				t.Errorf("incorrect client application, want %q got %q", tc.appID, appID)
+			}
+		})
+	}
+}
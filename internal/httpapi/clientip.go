@@ -0,0 +1,108 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const clientIPContextKey contextKey = "clientIP"
+
+// IPResolver derives the real client IP address of a request.
+// Forwarding headers (X-Forwarded-For, X-Real-IP) are only honored
+// when the request arrives through a trusted proxy, either identified
+// by its address or by a fixed number of proxy hops in front of the
+// service. Peers connected over a Unix socket carry no address and
+// are treated as a trusted local proxy.
+type IPResolver struct {
+	trusted []*net.IPNet
+	hops    int
+}
+
+// NewIPResolver returns a new IPResolver. Trusted proxies accept CIDR
+// notation or single IP addresses. Hops is the number of reverse proxies
+// deployed in front of the service and is used when proxy addresses
+// are not known ahead of time (e.g. cloud load balancers).
+func NewIPResolver(trustedProxies []string, hops int) (*IPResolver, error) {
+	trusted, err := ParseCIDRs(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	if hops < 0 {
+		return nil, fmt.Errorf("proxy hops cannot be negative")
+	}
+
+	return &IPResolver{trusted: trusted, hops: hops}, nil
+}
+
+// ClientIP returns the address of the client that originated the request.
+func (res *IPResolver) ClientIP(r *http.Request) string {
+	remoteIP := stripPort(r.RemoteAddr)
+	ip := net.ParseIP(remoteIP)
+	isTrustedPeer := ip != nil && containsIP(res.trusted, ip)
+	// Unix socket peers are reverse proxies on the same host and
+	// are expected to forward the client address.
+	isSocketPeer := ip == nil
+
+	if !isTrustedPeer && !isSocketPeer && res.hops == 0 {
+		return remoteIP
+	}
+
+	forwarded := forwardedFor(r)
+	if len(forwarded) == 0 {
+		realIP := strings.TrimSpace(r.Header.Get("X-Real-IP"))
+		if net.ParseIP(realIP) != nil {
+			return realIP
+		}
+		return remoteIP
+	}
+
+	if isTrustedPeer || res.hops == 0 {
+		// Walk the chain from the closest hop and return the first
+		// address we do not trust.
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			if !containsIP(res.trusted, net.ParseIP(forwarded[i])) {
+				return forwarded[i]
+			}
+		}
+		return forwarded[0]
+	}
+
+	// Each proxy appends the address of its peer, the client
+	// is therefore found `hops` entries from the end of the list.
+	idx := len(forwarded) - res.hops
+	if idx < 0 {
+		idx = 0
+	}
+
+	return forwarded[idx]
+}
+
+// ClientIPMiddleware resolves the client IP address of each request
+// and sets it in context for retrieval by GetIP.
+func ClientIPMiddleware(res *IPResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPContextKey, res.ClientIP(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// forwardedFor returns all valid IP addresses listed in
+// an X-Forwarded-For header.
+func forwardedFor(r *http.Request) []string {
+	addrs := []string{}
+	for _, v := range r.Header[http.CanonicalHeaderKey("X-Forwarded-For")] {
+		for _, addr := range strings.Split(v, ",") {
+			addr = strings.TrimSpace(addr)
+			if net.ParseIP(addr) != nil {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	return addrs
+}
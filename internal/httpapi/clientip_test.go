@@ -0,0 +1,124 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPAPI_IPResolver(t *testing.T) {
+	tt := []struct {
+		name         string
+		trusted      []string
+		hops         int
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		clientIP     string
+	}{
+		{
+			name:         "Ignores headers from untrusted peer",
+			remoteAddr:   "203.0.113.5:5000",
+			forwardedFor: "10.0.0.1",
+			realIP:       "10.0.0.2",
+			clientIP:     "203.0.113.5",
+		},
+		{
+			name:         "Resolves through trusted proxy",
+			trusted:      []string{"192.168.0.0/24"},
+			remoteAddr:   "192.168.0.1:5000",
+			forwardedFor: "198.51.100.1, 203.0.113.5, 192.168.0.2",
+			clientIP:     "203.0.113.5",
+		},
+		{
+			name:       "Falls back to X-Real-IP from trusted proxy",
+			trusted:    []string{"192.168.0.1"},
+			remoteAddr: "192.168.0.1:5000",
+			realIP:     "203.0.113.5",
+			clientIP:   "203.0.113.5",
+		},
+		{
+			name:         "Resolves through unix socket peer",
+			remoteAddr:   "@",
+			forwardedFor: "198.51.100.1, 203.0.113.5",
+			clientIP:     "203.0.113.5",
+		},
+		{
+			name:       "Falls back to X-Real-IP from unix socket peer",
+			remoteAddr: "",
+			realIP:     "203.0.113.5",
+			clientIP:   "203.0.113.5",
+		},
+		{
+			name:         "Resolves by proxy hops",
+			hops:         2,
+			remoteAddr:   "172.16.0.1:5000",
+			forwardedFor: "198.51.100.1, 203.0.113.5, 172.16.0.2",
+			clientIP:     "203.0.113.5",
+		},
+		{
+			name:         "Uses first address when hops exceed header",
+			hops:         3,
+			remoteAddr:   "172.16.0.1:5000",
+			forwardedFor: "203.0.113.5",
+			clientIP:     "203.0.113.5",
+		},
+		{
+			name:         "Ignores malformed addresses",
+			hops:         1,
+			remoteAddr:   "172.16.0.1:5000",
+			forwardedFor: "203.0.113.5, unknown",
+			clientIP:     "203.0.113.5",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := NewIPResolver(tc.trusted, tc.hops)
+			if err != nil {
+				t.Fatal("failed to create resolver:", err)
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-IP", tc.realIP)
+			}
+
+			ip := res.ClientIP(r)
+			if ip != tc.clientIP {
+				t.Errorf("incorrect client IP, want %s got %s", tc.clientIP, ip)
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_ClientIPMiddleware(t *testing.T) {
+	res, err := NewIPResolver(nil, 1)
+	if err != nil {
+		t.Fatal("failed to create resolver:", err)
+	}
+
+	var ip string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip = GetIP(r)
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "172.16.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "203.0.113.5")
+
+	ClientIPMiddleware(res)(handler).ServeHTTP(httptest.NewRecorder(), r)
+	if ip != "203.0.113.5" {
+		t.Errorf("incorrect client IP, want 203.0.113.5 got %s", ip)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "172.16.0.1:5000"
+	if GetIP(r) != "172.16.0.1" {
+		t.Errorf("incorrect default IP, want 172.16.0.1 got %s", GetIP(r))
+	}
+}
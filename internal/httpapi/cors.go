@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/handlers"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// corsHeaders are the request headers clients may send cross-origin.
+var corsHeaders = []string{
+	"X-Requested-With",
+	"Content-Type",
+	"Authorization",
+	"X-Captcha-Token",
+	ClientApplicationHeader,
+	TokenClientIDHeader,
+	RefreshTokenHeader,
+	DeviceIDHeader,
+	DeviceFingerprintHeader,
+	IdempotencyKeyHeader,
+}
+
+// corsMethods are the methods clients may use cross-origin.
+var corsMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "HEAD"}
+
+// CORSRule configures the origins allowed to make cross-origin
+// requests to a group of routes.
+type CORSRule struct {
+	// Prefix is the path prefix of the routes the rule applies to.
+	Prefix string
+	// Origins are the origins allowed for the routes. A "*" entry
+	// accepts all origins, though only listed origins may make
+	// credentialed requests.
+	Origins []string
+	// ClientApplications also accepts the origins of registered
+	// ClientApplications.
+	ClientApplications bool
+}
+
+// CORSMiddleware handles cross-origin requests. Requests are matched
+// against the rule with the longest matching path prefix. Requests not
+// matching a rule accept the default origins as well as the origins of
+// registered ClientApplications. Origins accepted only by a "*" entry
+// receive a wildcard response which browsers never send credentials
+// with.
+func CORSMiddleware(apps auth.ClientApplicationService, origins []string, rules ...CORSRule) func(http.Handler) http.Handler {
+	sorted := make([]CORSRule, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+
+	return func(next http.Handler) http.Handler {
+		fallback := corsHandler(origins, apps)(next)
+
+		routes := make([]http.Handler, len(sorted))
+		for i, rule := range sorted {
+			var ruleApps auth.ClientApplicationService
+			if rule.ClientApplications {
+				ruleApps = apps
+			}
+			routes[i] = corsHandler(rule.Origins, ruleApps)(next)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i, rule := range sorted {
+				if strings.HasPrefix(r.URL.Path, rule.Prefix) {
+					routes[i].ServeHTTP(w, r)
+					return
+				}
+			}
+			fallback.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ParseCORSRules parses CORS rules separated by semicolons. Each rule is
+// a path prefix and a comma separated list of origins separated by an
+// equals sign, e.g. `/api/v1/admin/=https://admin.example.com`. A
+// `+apps` origin also accepts the origins of registered
+// ClientApplications.
+func ParseCORSRules(s string) ([]CORSRule, error) {
+	var rules []CORSRule
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "/") {
+			return nil, fmt.Errorf("invalid CORS rule %q", entry)
+		}
+
+		rule := CORSRule{Prefix: strings.TrimSpace(parts[0])}
+		for _, origin := range strings.Split(parts[1], ",") {
+			origin = strings.TrimSpace(origin)
+			switch origin {
+			case "":
+			case "+apps":
+				rule.ClientApplications = true
+			default:
+				rule.Origins = append(rule.Origins, origin)
+			}
+		}
+		if len(rule.Origins) == 0 && !rule.ClientApplications {
+			return nil, fmt.Errorf("CORS rule %q has no origins", entry)
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// OriginValidator returns a CORS origin validator accepting origins
+// allowed by the service as well as origins of registered
+// ClientApplications, if a ClientApplicationService is provided.
+// Accepted origins may make credentialed requests, so a "*" entry
+// does not accept any origin.
+func OriginValidator(allowed []string, apps auth.ClientApplicationService) func(string) bool {
+	origins := make(map[string]bool, len(allowed))
+	for _, o := range allowed {
+		if o != "*" {
+			origins[o] = true
+		}
+	}
+
+	return func(origin string) bool {
+		if origins[origin] {
+			return true
+		}
+		if apps == nil {
+			return false
+		}
+		return apps.IsOriginAllowed(context.Background(), origin)
+	}
+}
+
+// corsHandler allows credentialed requests from the origins accepted
+// by OriginValidator. If a "*" entry is allowed, requests from every
+// other origin receive a wildcard response without credentials.
+func corsHandler(allowed []string, apps auth.ClientApplicationService) func(http.Handler) http.Handler {
+	validator := OriginValidator(allowed, apps)
+	credentialed := handlers.CORS(
+		handlers.AllowedOriginValidator(validator),
+		handlers.AllowedHeaders(corsHeaders),
+		handlers.AllowCredentials(),
+		handlers.AllowedMethods(corsMethods),
+	)
+
+	hasWildcard := false
+	for _, o := range allowed {
+		hasWildcard = hasWildcard || o == "*"
+	}
+	if !hasWildcard {
+		return credentialed
+	}
+
+	wildcard := handlers.CORS(
+		handlers.AllowedOrigins([]string{"*"}),
+		handlers.AllowedHeaders(corsHeaders),
+		handlers.AllowedMethods(corsMethods),
+	)
+
+	return func(next http.Handler) http.Handler {
+		withCredentials := credentialed(next)
+		withoutCredentials := wildcard(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if validator(r.Header.Get("Origin")) {
+				withCredentials.ServeHTTP(w, r)
+				return
+			}
+			withoutCredentials.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestHTTPAPI_CORSMiddleware(t *testing.T) {
+	tt := []struct {
+		name        string
+		path        string
+		origin      string
+		allowOrigin string
+		credentials string
+	}{
+		{
+			name:        "Default origin allowed on unmatched route",
+			path:        "/api/v1/login",
+			origin:      "https://authenticator.local",
+			allowOrigin: "https://authenticator.local",
+			credentials: "true",
+		},
+		{
+			name:        "Client application origin allowed on unmatched route",
+			path:        "/api/v1/login",
+			origin:      "https://app.example.com",
+			allowOrigin: "https://app.example.com",
+			credentials: "true",
+		},
+		{
+			name:        "Internal origin allowed on admin route",
+			path:        "/api/v1/admin/users",
+			origin:      "https://admin.internal",
+			allowOrigin: "https://admin.internal",
+			credentials: "true",
+		},
+		{
+			name:   "Default origin rejected on admin route",
+			path:   "/api/v1/admin/users",
+			origin: "https://authenticator.local",
+		},
+		{
+			name:   "Client application origin rejected on admin route",
+			path:   "/api/v1/admin/users",
+			origin: "https://app.example.com",
+		},
+		{
+			name:        "Longest prefix applies",
+			path:        "/api/v1/admin/export",
+			origin:      "https://export.internal",
+			allowOrigin: "https://export.internal",
+			credentials: "true",
+		},
+		{
+			name:   "Shorter prefix ignored",
+			path:   "/api/v1/admin/export",
+			origin: "https://admin.internal",
+		},
+		{
+			name:        "Client application origin allowed by rule",
+			path:        "/api/v1/signup",
+			origin:      "https://app.example.com",
+			allowOrigin: "https://app.example.com",
+			credentials: "true",
+		},
+		{
+			name:   "Default origin rejected by rule",
+			path:   "/api/v1/signup",
+			origin: "https://authenticator.local",
+		},
+		{
+			name:        "Listed origin credentialed by wildcard rule",
+			path:        "/api/v1/token/verify",
+			origin:      "https://app.internal",
+			allowOrigin: "https://app.internal",
+			credentials: "true",
+		},
+		{
+			name:        "Unlisted origin not credentialed by wildcard rule",
+			path:        "/api/v1/token/verify",
+			origin:      "https://evil.example.com",
+			allowOrigin: "*",
+		},
+		{
+			name:        "Client application origin not credentialed by wildcard rule",
+			path:        "/api/v1/token/verify",
+			origin:      "https://app.example.com",
+			allowOrigin: "*",
+		},
+	}
+
+	apps := &test.ClientApplicationService{
+		IsOriginAllowedFn: func(origin string) bool {
+			return origin == "https://app.example.com"
+		},
+	}
+	rules := []CORSRule{
+		{Prefix: "/api/v1/admin/", Origins: []string{"https://admin.internal"}},
+		{Prefix: "/api/v1/admin/export", Origins: []string{"https://export.internal"}},
+		{Prefix: "/api/v1/signup", ClientApplications: true},
+		{Prefix: "/api/v1/token/verify", Origins: []string{"*", "https://app.internal"}},
+	}
+
+	var nextCalls int
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalls++
+	})
+	handler := CORSMiddleware(apps, []string{"https://authenticator.local"}, rules...)(next)
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			nextCalls = 0
+
+			req := httptest.NewRequest("OPTIONS", tc.path, nil)
+			req.Header.Set("Origin", tc.origin)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			req.Header.Set("Access-Control-Request-Headers", "Authorization")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if allowOrigin := rr.Header().Get("Access-Control-Allow-Origin"); allowOrigin != tc.allowOrigin {
+				t.Errorf("incorrect allowed origin, want %q got %q", tc.allowOrigin, allowOrigin)
+			}
+			if credentials := rr.Header().Get("Access-Control-Allow-Credentials"); credentials != tc.credentials {
+				t.Errorf("incorrect allowed credentials, want %q got %q", tc.credentials, credentials)
+			}
+			if nextCalls != 0 {
+				t.Errorf("preflight request served by next handler")
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_ParseCORSRules(t *testing.T) {
+	tt := []struct {
+		name   string
+		value  string
+		rules  []CORSRule
+		hasErr bool
+	}{
+		{
+			name:  "Empty rules",
+			value: "",
+		},
+		{
+			name:  "Multiple rules",
+			value: "/api/v1/admin/=https://a.internal, https://b.internal; /api/v1/login=+apps,https://app.local",
+			rules: []CORSRule{
+				{Prefix: "/api/v1/admin/", Origins: []string{"https://a.internal", "https://b.internal"}},
+				{Prefix: "/api/v1/login", Origins: []string{"https://app.local"}, ClientApplications: true},
+			},
+		},
+		{
+			name:   "Missing origins",
+			value:  "/api/v1/admin/=",
+			hasErr: true,
+		},
+		{
+			name:   "Missing prefix",
+			value:  "https://a.internal",
+			hasErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := ParseCORSRules(tc.value)
+			if tc.hasErr != (err != nil) {
+				t.Fatalf("incorrect error result, want error %v got %v", tc.hasErr, err)
+			}
+			if !cmp.Equal(rules, tc.rules) {
+				t.Error(cmp.Diff(rules, tc.rules))
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_OriginValidator(t *testing.T) {
+	apps := &test.ClientApplicationService{
+		IsOriginAllowedFn: func(origin string) bool {
+			return origin == "https://app.example.com"
+		},
+	}
+
+	validate := OriginValidator([]string{"https://authenticator.local"}, apps)
+	if !validate("https://authenticator.local") {
+		t.Error("expected configured origin to be allowed")
+	}
+	if !validate("https://app.example.com") {
+		t.Error("expected client application origin to be allowed")
+	}
+	if validate("https://evil.example.com") {
+		t.Error("expected unknown origin to be rejected")
+	}
+
+	if OriginValidator([]string{"*"}, apps)("https://evil.example.com") {
+		t.Error("expected wildcard not to allow credentialed origins")
+	}
+	if OriginValidator([]string{"https://authenticator.local"}, nil)("https://app.example.com") {
+		t.Error("expected client application origin to be rejected without a service")
+	}
+}
+
+func TestHTTPAPI_CORSWildcard(t *testing.T) {
+	tt := []struct {
+		name        string
+		method      string
+		origin      string
+		allowOrigin string
+		credentials string
+	}{
+		{
+			name:        "Listed origin preflight",
+			method:      "OPTIONS",
+			origin:      "https://authenticator.local",
+			allowOrigin: "https://authenticator.local",
+			credentials: "true",
+		},
+		{
+			name:        "Client application origin",
+			method:      "POST",
+			origin:      "https://app.example.com",
+			allowOrigin: "https://app.example.com",
+			credentials: "true",
+		},
+		{
+			name:        "Unlisted origin preflight",
+			method:      "OPTIONS",
+			origin:      "https://evil.example",
+			allowOrigin: "*",
+		},
+		{
+			name:        "Unlisted origin request",
+			method:      "POST",
+			origin:      "https://evil.example",
+			allowOrigin: "*",
+		},
+	}
+
+	apps := &test.ClientApplicationService{
+		IsOriginAllowedFn: func(origin string) bool {
+			return origin == "https://app.example.com"
+		},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := CORSMiddleware(apps, []string{"*", "https://authenticator.local"})(next)
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/api/v1/token/refresh", nil)
+			req.Header.Set("Origin", tc.origin)
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if allowOrigin := rr.Header().Get("Access-Control-Allow-Origin"); allowOrigin != tc.allowOrigin {
+				t.Errorf("incorrect allowed origin, want %q got %q", tc.allowOrigin, allowOrigin)
+			}
+			if credentials := rr.Header().Get("Access-Control-Allow-Credentials"); credentials != tc.credentials {
+				t.Errorf("incorrect allowed credentials, want %q got %q", tc.credentials, credentials)
+			}
+		})
+	}
+}
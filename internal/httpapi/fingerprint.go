@@ -0,0 +1,16 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/fmitra/authenticator/internal/fingerprint"
+)
+
+// FingerprintMiddleware derives the fingerprint of the client making
+// each request and sets it in context for tokens to be bound to.
+func FingerprintMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := fingerprint.NewContext(r.Context(), fingerprint.FromRequest(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,42 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const geoResolverContextKey contextKey = "geoResolver"
+
+// GeoMiddleware sets a GeoResolver in context for the location of
+// each request to be resolved on demand by GetLocation.
+func GeoMiddleware(geo auth.GeoResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), geoResolverContextKey, geo)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetLocation retrieves the location of the client IP address. It
+// returns nil if the location is unknown or GeoMiddleware is not used.
+func GetLocation(r *http.Request) *auth.GeoLocation {
+	geo, ok := r.Context().Value(geoResolverContextKey).(auth.GeoResolver)
+	if !ok || geo == nil {
+		return nil
+	}
+
+	return geo.Lookup(GetIP(r))
+}
+
+// SetLoginOrigin records the client IP address and location of a
+// request on a LoginHistory.
+func SetLoginOrigin(login *auth.LoginHistory, r *http.Request) {
+	login.IPAddress = GetIP(r)
+	if loc := GetLocation(r); loc != nil {
+		login.Country = loc.Country
+		login.City = loc.City
+	}
+}
@@ -0,0 +1,38 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestHTTPAPI_GeoMiddleware(t *testing.T) {
+	geo := &test.GeoResolver{
+		LookupFn: func(ip string) *auth.GeoLocation {
+			if ip == "127.0.0.1" {
+				return &auth.GeoLocation{Country: "DE", City: "Berlin"}
+			}
+			return nil
+		},
+	}
+
+	var loc *auth.GeoLocation
+	h := GeoMiddleware(geo)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		loc = GetLocation(r)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:8080"
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if loc == nil || loc.Country != "DE" || loc.City != "Berlin" {
+		t.Errorf("incorrect location, want Berlin, DE got %v", loc)
+	}
+
+	if loc = GetLocation(req); loc != nil {
+		t.Errorf("expected no location without middleware, got %v", loc)
+	}
+}
@@ -0,0 +1,218 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// IdempotencyKeyHeader is the request header clients set to safely
+// retry a request. Retries with the same key receive the response of
+// the original request instead of being processed again.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set on responses replayed from a
+// previous request.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLen is the maximum length of an idempotency key.
+const maxIdempotencyKeyLen = 255
+
+// idempotencyLockTTL is the duration a request holds its idempotency
+// key while in progress. It bounds how long retries are rejected if the
+// original request never completes.
+const idempotencyLockTTL = time.Minute
+
+// idempotencyStore is a minimal interface for go-redis.
+type idempotencyStore interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+}
+
+// idempotentResponse is a response stored against an idempotency key.
+// A response without a status code belongs to a request in progress.
+type idempotentResponse struct {
+	RequestHash string              `json:"requestHash"`
+	StatusCode  int                 `json:"statusCode,omitempty"`
+	Header      map[string][]string `json:"header,omitempty"`
+	Body        []byte              `json:"body,omitempty"`
+}
+
+// responseRecorder captures a response as it is written.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware stores successful responses to POST requests
+// carrying an IdempotencyKeyHeader for the duration of the TTL. Retries
+// with the same key, credentials and body are replayed the stored response.
+// Only the listed paths are handled. Responses are stored as they were
+// written, so paths issuing authorized tokens should not be listed.
+// Unsuccessful responses are not stored so the request may be retried.
+func IdempotencyMiddleware(db idempotencyStore, ttl time.Duration, paths ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get(IdempotencyKeyHeader)
+			skip := db == nil ||
+				ttl <= 0 ||
+				idempotencyKey == "" ||
+				r.Method != http.MethodPost ||
+				!hasPath(r.URL.Path, paths)
+			if skip {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(idempotencyKey) > maxIdempotencyKeyLen {
+				ErrorResponse(w, auth.ErrBadRequest("idempotency key is invalid"))
+				return
+			}
+
+			requestHash, err := hashRequest(r)
+			if err != nil {
+				ErrorResponse(w, auth.ErrBadRequest("no request body received"))
+				return
+			}
+
+			ctx := r.Context()
+			key := IdempotencyKey(r.URL.Path, r.Header.Get(authorizationHeader), idempotencyKey)
+
+			lock, err := json.Marshal(&idempotentResponse{RequestHash: requestHash})
+			if err != nil {
+				ErrorResponse(w, err)
+				return
+			}
+
+			ok, err := db.SetNX(ctx, key, lock, idempotencyLockTTL).Result()
+			if err != nil {
+				ErrorResponse(w, fmt.Errorf("cannot lock idempotency key: %w", err))
+				return
+			}
+			if !ok {
+				replay(ctx, w, db, key, requestHash)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			if rec.statusCode < 200 || rec.statusCode >= 300 {
+				db.Del(ctx, key)
+				return
+			}
+
+			b, err := json.Marshal(&idempotentResponse{
+				RequestHash: requestHash,
+				StatusCode:  rec.statusCode,
+				Header: map[string][]string{
+					"Content-Type": rec.Header()["Content-Type"],
+					"Set-Cookie":   rec.Header()["Set-Cookie"],
+				},
+				Body: rec.body.Bytes(),
+			})
+			if err != nil || db.Set(ctx, key, b, ttl).Err() != nil {
+				db.Del(ctx, key)
+			}
+		})
+	}
+}
+
+// replay writes the response stored against an idempotency key.
+func replay(ctx context.Context, w http.ResponseWriter, db idempotencyStore, key, requestHash string) {
+	b, err := db.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		ErrorResponse(w, auth.ErrThrottle("request is in progress, try again later"))
+		return
+	}
+	if err != nil {
+		ErrorResponse(w, fmt.Errorf("cannot retrieve idempotent response: %w", err))
+		return
+	}
+
+	var resp idempotentResponse
+	if err = json.Unmarshal(b, &resp); err != nil {
+		ErrorResponse(w, fmt.Errorf("invalid idempotent response: %w", err))
+		return
+	}
+
+	if resp.RequestHash != requestHash {
+		ErrorResponse(w, auth.ErrBadRequest("idempotency key was used for a different request"))
+		return
+	}
+
+	if resp.StatusCode == 0 {
+		ErrorResponse(w, auth.ErrThrottle("request is in progress, try again later"))
+		return
+	}
+
+	for name, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(name, v)
+		}
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(resp.Body)
+}
+
+// hashRequest returns a hash of a request's body. The body is
+// restored to be read again by the next handler.
+func hashRequest(r *http.Request) (string, error) {
+	if r.Body == nil {
+		return "", nil
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// hasPath checks if a path is one of the listed paths.
+func hasPath(path string, paths []string) bool {
+	for _, p := range paths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// IdempotencyKey is the key of a response stored for a client provided
+// idempotency key. Keys are scoped to the path and credentials of the
+// request.
+func IdempotencyKey(path, authorization, idempotencyKey string) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%s", path, authorization, idempotencyKey)))
+	return fmt.Sprintf("idempotency_%s", hex.EncodeToString(h[:]))
+}
@@ -0,0 +1,146 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fmitra/authenticator/internal/memstore"
+)
+
+func TestHTTPAPI_IdempotencyMiddleware(t *testing.T) {
+	tt := []struct {
+		name       string
+		method     string
+		path       string
+		keys       [2]string
+		bodies     [2]string
+		statusCode int
+		nextCalls  int
+		replayed   bool
+	}{
+		{
+			name:       "Replays retried request",
+			method:     "POST",
+			path:       "/api/v1/signup",
+			keys:       [2]string{"key-1", "key-1"},
+			bodies:     [2]string{`{"identity":"jane@example.com"}`, `{"identity":"jane@example.com"}`},
+			statusCode: http.StatusCreated,
+			nextCalls:  1,
+			replayed:   true,
+		},
+		{
+			name:       "Rejects key reused with a different body",
+			method:     "POST",
+			path:       "/api/v1/signup",
+			keys:       [2]string{"key-1", "key-1"},
+			bodies:     [2]string{`{"identity":"jane@example.com"}`, `{"identity":"john@example.com"}`},
+			statusCode: http.StatusBadRequest,
+			nextCalls:  1,
+		},
+		{
+			name:       "Processes requests with different keys",
+			method:     "POST",
+			path:       "/api/v1/signup",
+			keys:       [2]string{"key-1", "key-2"},
+			bodies:     [2]string{`{}`, `{}`},
+			statusCode: http.StatusCreated,
+			nextCalls:  2,
+		},
+		{
+			name:       "Processes requests without a key",
+			method:     "POST",
+			path:       "/api/v1/signup",
+			bodies:     [2]string{`{}`, `{}`},
+			statusCode: http.StatusCreated,
+			nextCalls:  2,
+		},
+		{
+			name:       "Retries failed requests",
+			method:     "POST",
+			path:       "/api/v1/signup",
+			keys:       [2]string{"fail", "fail"},
+			bodies:     [2]string{`{}`, `{}`},
+			statusCode: http.StatusInternalServerError,
+			nextCalls:  2,
+		},
+		{
+			name:       "Ignores paths not listed",
+			method:     "POST",
+			path:       "/api/v1/token/revoke",
+			keys:       [2]string{"key-1", "key-1"},
+			bodies:     [2]string{`{}`, `{}`},
+			statusCode: http.StatusCreated,
+			nextCalls:  2,
+		},
+		{
+			name:       "Rejects invalid key",
+			method:     "POST",
+			path:       "/api/v1/signup",
+			keys:       [2]string{strings.Repeat("k", 256), strings.Repeat("k", 256)},
+			bodies:     [2]string{`{}`, `{}`},
+			statusCode: http.StatusBadRequest,
+			nextCalls:  0,
+		},
+		{
+			name:       "Ignores paths below a listed path",
+			method:     "POST",
+			path:       "/api/v1/signup/verify",
+			keys:       [2]string{"key-1", "key-1"},
+			bodies:     [2]string{`{}`, `{}`},
+			statusCode: http.StatusCreated,
+			nextCalls:  2,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var nextCalls int
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nextCalls++
+				if r.Header.Get(IdempotencyKeyHeader) == "fail" {
+					internalErrorResponse(w)
+					return
+				}
+				http.SetCookie(w, &http.Cookie{Name: "CLIENTID", Value: "client-id"})
+				JSONResponse(w, map[string]string{"token": "jwt-token"}, http.StatusCreated)
+			})
+			handler := IdempotencyMiddleware(memstore.New(), time.Hour, "/api/v1/signup")(next)
+
+			var rr *httptest.ResponseRecorder
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.bodies[i]))
+				if tc.keys[i] != "" {
+					req.Header.Set(IdempotencyKeyHeader, tc.keys[i])
+				}
+				rr = httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+			}
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+			if nextCalls != tc.nextCalls {
+				t.Errorf("incorrect handler call count, want %v got %v", tc.nextCalls, nextCalls)
+			}
+
+			replayed := rr.Header().Get(IdempotentReplayedHeader) == "true"
+			if replayed != tc.replayed {
+				t.Errorf("incorrect replayed header, want %v got %v", tc.replayed, replayed)
+			}
+			if !tc.replayed {
+				return
+			}
+
+			if body := strings.TrimSpace(rr.Body.String()); body != `{"token":"jwt-token"}` {
+				t.Errorf("incorrect replayed body: %s", body)
+			}
+			cookies := rr.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Value != "client-id" {
+				t.Errorf("incorrect replayed cookies: %v", cookies)
+			}
+		})
+	}
+}
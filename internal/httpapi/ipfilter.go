@@ -0,0 +1,135 @@
+package httpapi
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// IPFilter allows or denies requests based on the client's IP address.
+// Deny rules take precedence over allow rules. If no allow rules are
+// configured, all addresses not explicitly denied are allowed.
+type IPFilter struct {
+	allow    []*net.IPNet
+	deny     []*net.IPNet
+	resolver *IPResolver
+}
+
+// NewIPFilter returns a new IPFilter. Each list accepts CIDR notation
+// (e.g. 10.0.0.0/8) or a single IP address. The resolver determines
+// the client's IP address, taking trusted proxies into account.
+func NewIPFilter(allow, deny []string, resolver *IPResolver) (*IPFilter, error) {
+	var (
+		f   IPFilter
+		err error
+	)
+
+	f.resolver = resolver
+	if f.resolver == nil {
+		f.resolver = &IPResolver{}
+	}
+
+	if f.allow, err = ParseCIDRs(allow); err != nil {
+		return nil, fmt.Errorf("invalid allowlist: %w", err)
+	}
+	if f.deny, err = ParseCIDRs(deny); err != nil {
+		return nil, fmt.Errorf("invalid denylist: %w", err)
+	}
+
+	return &f, nil
+}
+
+// Allowed checks if a request is permitted by the filter.
+func (f *IPFilter) Allowed(r *http.Request) bool {
+	ip := net.ParseIP(f.resolver.ClientIP(r))
+	if ip == nil {
+		return false
+	}
+
+	if containsIP(f.deny, ip) {
+		return false
+	}
+
+	if len(f.allow) == 0 {
+		return true
+	}
+
+	return containsIP(f.allow, ip)
+}
+
+// Handler wraps an http.Handler to reject requests from
+// addresses that are not permitted by the filter.
+func (f *IPFilter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !f.Allowed(r) {
+			ErrorResponse(w, auth.ErrForbidden("access denied"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IPFilterMiddleware rejects requests from addresses that are not
+// permitted by an IPFilter. A nil IPFilter permits every request.
+func IPFilterMiddleware(jsonHandler JSONAPIHandler, f *IPFilter) JSONAPIHandler {
+	return func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+		if f != nil && !f.Allowed(r) {
+			return nil, auth.ErrForbidden("access denied")
+		}
+
+		return jsonHandler(w, r)
+	}
+}
+
+// ParseCIDRs parses a list of CIDR ranges. Single IP addresses are
+// treated as a /32 (IPv4) or /128 (IPv6) range. Blank entries are ignored.
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("%s is not a valid IP address", v)
+			}
+			if ip.To4() != nil {
+				v = fmt.Sprintf("%s/32", v)
+			} else {
+				v = fmt.Sprintf("%s/128", v)
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func stripPort(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
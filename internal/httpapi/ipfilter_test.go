@@ -0,0 +1,132 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+func TestHTTPAPI_IPFilter(t *testing.T) {
+	tt := []struct {
+		name         string
+		allow        []string
+		deny         []string
+		trusted      []string
+		remoteAddr   string
+		forwardedFor string
+		isAllowed    bool
+	}{
+		{
+			name:       "Allows all with no rules",
+			remoteAddr: "203.0.113.5:5000",
+			isAllowed:  true,
+		},
+		{
+			name:       "Allows address in allowlist",
+			allow:      []string{"10.0.0.0/8"},
+			remoteAddr: "10.1.2.3:5000",
+			isAllowed:  true,
+		},
+		{
+			name:       "Rejects address outside of allowlist",
+			allow:      []string{"10.0.0.0/8"},
+			remoteAddr: "203.0.113.5:5000",
+			isAllowed:  false,
+		},
+		{
+			name:       "Denylist takes precedence",
+			allow:      []string{"10.0.0.0/8"},
+			deny:       []string{"10.1.2.3"},
+			remoteAddr: "10.1.2.3:5000",
+			isAllowed:  false,
+		},
+		{
+			name:         "Ignores forwarded header from untrusted source",
+			allow:        []string{"10.0.0.0/8"},
+			remoteAddr:   "203.0.113.5:5000",
+			forwardedFor: "10.1.2.3",
+			isAllowed:    false,
+		},
+		{
+			name:         "Uses forwarded header from trusted proxy",
+			allow:        []string{"10.0.0.0/8"},
+			trusted:      []string{"192.168.0.1"},
+			remoteAddr:   "192.168.0.1:5000",
+			forwardedFor: "203.0.113.9, 10.1.2.3",
+			isAllowed:    true,
+		},
+		{
+			name:         "Skips chained trusted proxies",
+			deny:         []string{"203.0.113.9"},
+			trusted:      []string{"192.168.0.0/24"},
+			remoteAddr:   "192.168.0.1:5000",
+			forwardedFor: "203.0.113.9, 192.168.0.2",
+			isAllowed:    false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver, err := NewIPResolver(tc.trusted, 0)
+			if err != nil {
+				t.Fatal("failed to create resolver:", err)
+			}
+
+			f, err := NewIPFilter(tc.allow, tc.deny, resolver)
+			if err != nil {
+				t.Fatal("failed to create filter:", err)
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+
+			if f.Allowed(r) != tc.isAllowed {
+				t.Errorf("incorrect filter result, want %v got %v", tc.isAllowed, !tc.isAllowed)
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_IPFilterMiddleware(t *testing.T) {
+	f, err := NewIPFilter([]string{"10.0.0.0/8"}, nil, nil)
+	if err != nil {
+		t.Fatal("failed to create filter:", err)
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+		return []byte(`{"foo":"bar"}`), nil
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "203.0.113.5:5000"
+
+	_, err = IPFilterMiddleware(handler, f)(httptest.NewRecorder(), r)
+	if auth.ErrorCode(err) != auth.EForbidden {
+		t.Errorf("incorrect error code, want %s got %s", auth.EForbidden, auth.ErrorCode(err))
+	}
+
+	w := httptest.NewRecorder()
+	f.Handler(http.NotFoundHandler()).ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("incorrect status code, want %v got %v", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestHTTPAPI_ParseCIDRs(t *testing.T) {
+	if _, err := ParseCIDRs([]string{"not-an-ip"}); err == nil {
+		t.Error("expected error for invalid address, not nil")
+	}
+
+	nets, err := ParseCIDRs([]string{"", "10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	if len(nets) != 2 {
+		t.Errorf("incorrect number of ranges, want 2 got %v", len(nets))
+	}
+}
@@ -0,0 +1,82 @@
+package httpapi
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	unixScheme    = "unix://"
+	systemdScheme = "systemd://"
+
+	// listenFDsStart is the first file descriptor passed
+	// by systemd during socket activation.
+	listenFDsStart = 3
+)
+
+// Listen announces on a network address. The address may be a TCP
+// address (e.g. `:8080`), a Unix domain socket (e.g. `unix:///run/authenticator.sock`)
+// or a socket inherited through systemd socket activation (e.g. `systemd://`
+// for the first socket or `systemd://<name>` for a named socket).
+// Requests received over a Unix socket resolve the client address from
+// forwarding headers set by the local proxy, see IPResolver.
+func Listen(addr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, unixScheme):
+		return listenUnix(strings.TrimPrefix(addr, unixScheme))
+	case strings.HasPrefix(addr, systemdScheme):
+		return listenSystemd(strings.TrimPrefix(addr, systemdScheme))
+	default:
+		return net.Listen("tcp", addr)
+	}
+}
+
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, fmt.Errorf("unix socket path is empty")
+	}
+
+	// A socket left behind by a previous process would prevent us
+	// from binding to the path. Other file types are left untouched.
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("cannot remove stale socket: %w", err)
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+func listenSystemd(name string) (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, fmt.Errorf("no sockets passed by systemd")
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("no sockets passed by systemd")
+	}
+
+	idx := 0
+	if name != "" {
+		idx = -1
+		for i, n := range strings.Split(os.Getenv("LISTEN_FDNAMES"), ":") {
+			if n == name {
+				idx = i
+				break
+			}
+		}
+	}
+	if idx < 0 || idx >= count {
+		return nil, fmt.Errorf("systemd socket %s not found", name)
+	}
+
+	f := os.NewFile(uintptr(listenFDsStart+idx), name)
+	defer f.Close()
+
+	return net.FileListener(f)
+}
@@ -0,0 +1,158 @@
+package httpapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPAPI_ListenTCP(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	defer l.Close()
+
+	if l.Addr().Network() != "tcp" {
+		t.Errorf("incorrect network, want tcp got %s", l.Addr().Network())
+	}
+}
+
+func TestHTTPAPI_ListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authenticator")
+	if err != nil {
+		t.Fatal("failed to create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "api.sock")
+	l, err := Listen("unix://" + path)
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	if l.Addr().Network() != "unix" {
+		t.Errorf("incorrect network, want unix got %s", l.Addr().Network())
+	}
+
+	// Simulate a stale socket left behind by an unclean shutdown.
+	l.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+	l.Close()
+
+	l, err = Listen("unix://" + path)
+	if err != nil {
+		t.Fatal("expected stale socket to be replaced:", err)
+	}
+	l.Close()
+
+	if _, err = Listen("unix://"); err == nil {
+		t.Error("expected error for empty socket path, not nil")
+	}
+}
+
+func TestHTTPAPI_ServeUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authenticator")
+	if err != nil {
+		t.Fatal("failed to create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "api.sock")
+	l, err := Listen("unix://" + path)
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+
+	res, err := NewIPResolver(nil, 0)
+	if err != nil {
+		t.Fatal("failed to create resolver:", err)
+	}
+	ipFilter, err := NewIPFilter([]string{"203.0.113.0/24"}, nil, res)
+	if err != nil {
+		t.Fatal("failed to create filter:", err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetIP(r)))
+	})
+	srv := &http.Server{Handler: ClientIPMiddleware(res)(ipFilter.Handler(handler))}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+
+	tt := []struct {
+		name         string
+		forwardedFor string
+		statusCode   int
+		clientIP     string
+	}{
+		{
+			name:         "Allows forwarded client",
+			forwardedFor: "203.0.113.7",
+			statusCode:   http.StatusOK,
+			clientIP:     "203.0.113.7",
+		},
+		{
+			name:         "Denies forwarded client",
+			forwardedFor: "198.51.100.7",
+			statusCode:   http.StatusForbidden,
+		},
+		{
+			name:       "Denies request without client address",
+			statusCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "http://authenticator/", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			if tc.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, resp.StatusCode)
+			}
+			if tc.clientIP == "" {
+				return
+			}
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal("failed to read body:", err)
+			}
+			if string(body) != tc.clientIP {
+				t.Errorf("incorrect client IP, want %s got %s", tc.clientIP, body)
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_ListenSystemd(t *testing.T) {
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+
+	if _, err := Listen("systemd://"); err == nil {
+		t.Error("expected error without systemd sockets, not nil")
+	}
+}
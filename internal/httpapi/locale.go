@@ -0,0 +1,16 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/fmitra/authenticator/internal/locale"
+)
+
+// LocaleMiddleware sets the languages preferred by the client making
+// each request in context for messages to be localized.
+func LocaleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := locale.NewContext(r.Context(), locale.FromRequest(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,70 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// tokenPaths are served during maintenance so existing sessions
+// continue to be verified and refreshed.
+var tokenPaths = []string{
+	"/api/v1/token/verify",
+	"/api/v1/token/refresh",
+}
+
+// MaintenanceMiddleware rejects requests which may modify state while
+// the maintenance feature is enabled. Safe methods such as GET and token
+// verification and refresh continue to be served. Paths beginning with an
+// exempt prefix are always served, allowing operators to leave maintenance
+// through the admin API.
+func MaintenanceMiddleware(features auth.FeatureFlagService, retryAfter time.Duration, exempt ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isSafeMethod(r.Method) || isTokenPath(r.URL.Path) || hasPrefix(r.URL.Path, exempt) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !features.Enabled(r.Context(), auth.FeatureMaintenance) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if retryAfter > 0 {
+				w.Header().Set("Retry-After", fmt.Sprint(int(retryAfter.Seconds())))
+			}
+			ErrorResponse(w, auth.ErrUnavailable("service is undergoing maintenance"))
+		})
+	}
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+func isTokenPath(path string) bool {
+	for _, p := range tokenPaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefix(path string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if p != "" && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestHTTPAPI_MaintenanceMiddleware(t *testing.T) {
+	tt := []struct {
+		name        string
+		maintenance bool
+		method      string
+		path        string
+		statusCode  int
+		retryAfter  string
+	}{
+		{
+			name:       "Serves mutating request outside of maintenance",
+			method:     "POST",
+			path:       "/api/v1/login",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:        "Rejects mutating request during maintenance",
+			maintenance: true,
+			method:      "POST",
+			path:        "/api/v1/login",
+			statusCode:  http.StatusServiceUnavailable,
+			retryAfter:  "300",
+		},
+		{
+			name:        "Serves token verification during maintenance",
+			maintenance: true,
+			method:      "POST",
+			path:        "/api/v1/token/verify",
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Serves token refresh during maintenance",
+			maintenance: true,
+			method:      "POST",
+			path:        "/api/v1/token/refresh",
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Serves safe method during maintenance",
+			maintenance: true,
+			method:      "GET",
+			path:        "/api/v1/user/me",
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Serves exempt path during maintenance",
+			maintenance: true,
+			method:      "POST",
+			path:        "/api/v1/admin/feature/maintenance",
+			statusCode:  http.StatusOK,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			features := &test.FeatureFlagService{
+				EnabledFn: func(f auth.Feature) bool {
+					return f == auth.FeatureMaintenance && tc.maintenance
+				},
+			}
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := MaintenanceMiddleware(features, time.Minute*5, "/api/v1/admin/")(next)
+
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+			if retryAfter := rr.Header().Get("Retry-After"); retryAfter != tc.retryAfter {
+				t.Errorf("incorrect Retry-After header, want %q got %q", tc.retryAfter, retryAfter)
+			}
+		})
+	}
+}
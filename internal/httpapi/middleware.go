@@ -8,7 +8,6 @@ import (
 	"github.com/go-kit/kit/log/level"
 
 	auth "github.com/fmitra/authenticator"
-	"github.com/fmitra/authenticator/internal/token"
 )
 
 type contextKey string
@@ -17,6 +16,25 @@ const authorizationHeader = "AUTHORIZATION"
 const userIDContextKey contextKey = "userID"
 const tokenContextKey contextKey = "token"
 const refreshTokenContextKey contextKey = "refreshToken"
+const refreshTokenHeaderContextKey contextKey = "refreshTokenHeader"
+
+const (
+	// TokenClientIDHeader is the request header native clients, which
+	// cannot rely on cookies, deliver a token's client ID with.
+	TokenClientIDHeader = "X-Token-Client-ID"
+	// RefreshTokenHeader is the request header native clients deliver
+	// a refresh token with. Refresh tokens delivered this way are
+	// rotated on every refresh.
+	RefreshTokenHeader = "X-Refresh-Token"
+	// DeviceIDHeader is the request header identifying the installation
+	// of a native client. Refresh tokens issued to requests with the
+	// header are bound to it.
+	DeviceIDHeader = "X-Device-ID"
+	// DeviceFingerprintHeader is the request header clients deliver a
+	// device fingerprint with, as computed by a client side fingerprinting
+	// library. It is used to detect bursts of registrations.
+	DeviceFingerprintHeader = "X-Device-Fingerprint"
+)
 
 // RateLimitMiddleware rate limits HTTP requests.
 func RateLimitMiddleware(jsonHandler JSONAPIHandler, lmt Limiter) JSONAPIHandler {
@@ -30,47 +48,27 @@ func RateLimitMiddleware(jsonHandler JSONAPIHandler, lmt Limiter) JSONAPIHandler
 	}
 }
 
-// AuthMiddleware validates an Authorization header if available.
+// AuthMiddleware validates an Authorization header and requires
+// the token to be in a specific state.
 func AuthMiddleware(jsonHandler JSONAPIHandler, tokenSvc auth.TokenService, state auth.TokenState) JSONAPIHandler {
-	return func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
-		ctx := r.Context()
-		jwtToken := r.Header.Get(authorizationHeader)
-		if jwtToken == "" {
-			return nil, auth.ErrInvalidToken("user is not authenticated")
-		}
-
-		clientIDCookie, err := r.Cookie(token.ClientIDCookie)
-		if err != nil {
-			return nil, auth.ErrInvalidToken("token source is invalid")
-		}
-
-		token, err := tokenSvc.Validate(ctx, jwtToken, clientIDCookie.Value)
-		if err != nil {
-			return nil, err
-		}
-
-		if token.State != state {
-			return nil, auth.ErrInvalidToken("token state is not supported")
-		}
-
-		var newCtx context.Context
-		{
-			newCtx = context.WithValue(ctx, userIDContextKey, token.UserID)
-			newCtx = context.WithValue(newCtx, tokenContextKey, token)
-		}
-
-		r = r.WithContext(newCtx)
-
-		return jsonHandler(w, r)
-	}
+	return PolicyMiddleware(jsonHandler, tokenSvc, Policy{States: []auth.TokenState{state}})
 }
 
-// RefreshTokenMiddleware sets a refresh token in context.
-func RefreshTokenMiddleware(jsonHandler JSONAPIHandler) JSONAPIHandler {
+// RefreshTokenMiddleware sets a refresh token in context. Refresh
+// tokens are read from the RefreshTokenHeader before falling back
+// to the refresh token cookie.
+func RefreshTokenMiddleware(jsonHandler JSONAPIHandler, tokenSvc auth.TokenService) JSONAPIHandler {
 	return func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 		ctx := r.Context()
 
-		refreshToken, err := r.Cookie(token.RefreshTokenCookie)
+		if refreshToken := r.Header.Get(RefreshTokenHeader); refreshToken != "" {
+			newCtx := context.WithValue(ctx, refreshTokenContextKey, refreshToken)
+			newCtx = context.WithValue(newCtx, refreshTokenHeaderContextKey, true)
+			return jsonHandler(w, r.WithContext(newCtx))
+		}
+
+		_, refreshTokenCookieName := tokenSvc.CookieNames()
+		refreshToken, err := r.Cookie(refreshTokenCookieName)
 		if err == nil {
 			newCtx := context.WithValue(ctx, refreshTokenContextKey, refreshToken.Value)
 			r = r.WithContext(newCtx)
@@ -63,7 +63,7 @@ func TestHTTPAPI_RefreshTokenMiddleware(t *testing.T) {
 
 	var h JSONAPIHandler
 	h = AuthMiddleware(handler, &tokenSvc, auth.JWTAuthorized)
-	h = RefreshTokenMiddleware(h)
+	h = RefreshTokenMiddleware(h, &test.TokenService{})
 
 	v, err := h(w, r)
 	if err != nil {
@@ -80,6 +80,45 @@ func TestHTTPAPI_RefreshTokenMiddleware(t *testing.T) {
 	}
 }
 
+func TestHTTPAPI_RefreshTokenMiddlewareHeader(t *testing.T) {
+	refreshTokenMock := "2e147090cd3d455da10896213649e49d" // #nosec
+	handler := func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+		refreshToken := GetRefreshToken(r)
+		if refreshToken != refreshTokenMock {
+			t.Error("refresh token does not match", cmp.Diff(refreshToken, refreshTokenMock))
+		}
+		if !IsRefreshTokenHeader(r) {
+			t.Error("expected refresh token to be delivered by header")
+		}
+
+		return []byte(`{}`), nil
+	}
+	tokenSvc := test.TokenService{
+		ValidateFn: func() (*auth.Token, error) {
+			return &auth.Token{State: auth.JWTAuthorized}, nil
+		},
+	}
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "", bytes.NewBuffer([]byte("{}")))
+	if err != nil {
+		t.Fatal("failed to create mock request:", err)
+	}
+
+	r.Header.Set("AUTHORIZATION", "JWTTOKEN")
+	r.Header.Set(TokenClientIDHeader, "client-id")
+	r.Header.Set(RefreshTokenHeader, refreshTokenMock)
+	r.AddCookie(&http.Cookie{Name: "REFRESHTOKEN", Value: "cookie-refresh-token"})
+
+	var h JSONAPIHandler
+	h = AuthMiddleware(handler, &tokenSvc, auth.JWTAuthorized)
+	h = RefreshTokenMiddleware(h, &test.TokenService{})
+
+	if _, err = h(w, r); err != nil {
+		t.Error("expected nil error:", err)
+	}
+}
+
 func TestHTTPAPI_AuthMiddleware(t *testing.T) {
 	handler := func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 		return []byte(`{"foo":"bar"}`), nil
@@ -0,0 +1,16 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/fmitra/authenticator/internal/origin"
+)
+
+// OriginMiddleware sets the origin each request is made from in
+// context for services serving several frontends.
+func OriginMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := origin.NewContext(r.Context(), origin.FromRequest(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,156 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// Policy declares the token requirements of a route. Every route
+// is expected to declare a Policy in SetupHTTPHandler, including
+// public routes, so access rules are visible in one place.
+type Policy struct {
+	// Public routes do not require a token.
+	Public bool
+	// States are the token states accepted by the route. If empty,
+	// tokens in any state are accepted.
+	States []auth.TokenState
+	// RequireTFA rejects tokens that have not completed 2FA.
+	RequireTFA bool
+	// AdminKey restricts the route to operators presenting
+	// the key as a bearer token in place of a user's JWT.
+	AdminKey string
+	// AllowPendingConsent accepts tokens issued to users who have
+	// yet to accept the latest version of a required policy.
+	AllowPendingConsent bool
+	// AllowPendingEnrollment accepts tokens issued to users who
+	// have yet to enroll a mandatory second factor.
+	AllowPendingEnrollment bool
+}
+
+var (
+	// PublicPolicy allows access without a token.
+	PublicPolicy = Policy{Public: true}
+	// PreAuthorizedPolicy allows access to users who have yet
+	// to complete 2FA.
+	PreAuthorizedPolicy = Policy{States: []auth.TokenState{auth.JWTPreAuthorized}}
+	// AuthorizedPolicy allows access to fully authenticated users.
+	AuthorizedPolicy = Policy{States: []auth.TokenState{auth.JWTAuthorized}, RequireTFA: true}
+	// ConsentPolicy allows users to record their acceptance of
+	// policies during signup or before completing login.
+	ConsentPolicy = Policy{
+		States:                 []auth.TokenState{auth.JWTPreAuthorized, auth.JWTAuthorized},
+		AllowPendingConsent:    true,
+		AllowPendingEnrollment: true,
+	}
+	// EnrollmentPolicy allows fully authenticated users, including
+	// users who have yet to enroll a mandatory second factor, to set
+	// up 2FA and contact addresses.
+	EnrollmentPolicy = Policy{
+		States:                 []auth.TokenState{auth.JWTAuthorized},
+		RequireTFA:             true,
+		AllowPendingEnrollment: true,
+	}
+)
+
+// AdminPolicy allows access to operators presenting an admin API key.
+func AdminPolicy(apiKey string) Policy {
+	return Policy{AdminKey: apiKey}
+}
+
+func (p Policy) isZero() bool {
+	return !p.Public && len(p.States) == 0 && !p.RequireTFA && p.AdminKey == "" &&
+		!p.AllowPendingConsent && !p.AllowPendingEnrollment
+}
+
+func (p Policy) allowsAdmin(r *http.Request) bool {
+	key := strings.TrimPrefix(r.Header.Get(authorizationHeader), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(key), []byte(p.AdminKey)) == 1
+}
+
+func (p Policy) allowsState(state auth.TokenState) bool {
+	if p.RequireTFA && state != auth.JWTAuthorized {
+		return false
+	}
+
+	if len(p.States) == 0 {
+		return true
+	}
+
+	for _, s := range p.States {
+		if s == state {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PolicyMiddleware enforces a route's Policy. Tokens are read from the
+// Authorization header and validated against the client ID cookie, or
+// the TokenClientIDHeader for native clients, before being set in
+// context. A zero Policy is a programming error and panics during setup
+// to prevent routes from being exposed without access rules.
+func PolicyMiddleware(jsonHandler JSONAPIHandler, tokenSvc auth.TokenService, policy Policy) JSONAPIHandler {
+	if policy.isZero() {
+		panic("httpapi: route policy is not declared")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+		if policy.Public {
+			return jsonHandler(w, r)
+		}
+
+		if policy.AdminKey != "" {
+			if !policy.allowsAdmin(r) {
+				return nil, auth.ErrInvalidToken("admin key is invalid")
+			}
+			return jsonHandler(w, r)
+		}
+
+		ctx := r.Context()
+		jwtToken := r.Header.Get(authorizationHeader)
+		if jwtToken == "" {
+			return nil, auth.ErrInvalidToken("user is not authenticated")
+		}
+
+		clientID := r.Header.Get(TokenClientIDHeader)
+		clientIDCookieName, _ := tokenSvc.CookieNames()
+		if clientIDCookie, err := r.Cookie(clientIDCookieName); err == nil {
+			clientID = clientIDCookie.Value
+		}
+		if clientID == "" {
+			return nil, auth.ErrInvalidToken("token source is invalid")
+		}
+
+		token, err := tokenSvc.Validate(ctx, jwtToken, clientID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !policy.allowsState(token.State) {
+			return nil, auth.ErrInvalidToken("token state is not supported")
+		}
+
+		if token.ConsentRequired && !policy.AllowPendingConsent {
+			return nil, auth.ErrForbidden("consent to the latest policies is required")
+		}
+
+		if token.EnrollmentRequired && !policy.AllowPendingEnrollment {
+			return nil, auth.ErrForbidden("enrollment of a TOTP app or WebAuthn device is required")
+		}
+
+		var newCtx context.Context
+		{
+			newCtx = context.WithValue(ctx, userIDContextKey, token.UserID)
+			newCtx = context.WithValue(newCtx, tokenContextKey, token)
+		}
+
+		r = r.WithContext(newCtx)
+
+		return jsonHandler(w, r)
+	}
+}
@@ -0,0 +1,175 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestHTTPAPI_PolicyMiddleware(t *testing.T) {
+	tt := []struct {
+		name       string
+		policy     Policy
+		hasToken   bool
+		tokenState auth.TokenState
+		consent    bool
+		enrollment bool
+		adminKey   string
+		errMessage string
+	}{
+		{
+			name:   "Public route without token",
+			policy: PublicPolicy,
+		},
+		{
+			name:       "Protected route without token",
+			policy:     AuthorizedPolicy,
+			errMessage: "user is not authenticated",
+		},
+		{
+			name:       "Pre-authorized route with pre-authorized token",
+			policy:     PreAuthorizedPolicy,
+			hasToken:   true,
+			tokenState: auth.JWTPreAuthorized,
+		},
+		{
+			name:       "Authorized route with pre-authorized token",
+			policy:     AuthorizedPolicy,
+			hasToken:   true,
+			tokenState: auth.JWTPreAuthorized,
+			errMessage: "token state is not supported",
+		},
+		{
+			name:       "2FA required for any state",
+			policy:     Policy{RequireTFA: true},
+			hasToken:   true,
+			tokenState: auth.JWTPreAuthorized,
+			errMessage: "token state is not supported",
+		},
+		{
+			name:       "Any state accepted",
+			policy:     Policy{States: []auth.TokenState{auth.JWTPreAuthorized, auth.JWTAuthorized}},
+			hasToken:   true,
+			tokenState: auth.JWTAuthorized,
+		},
+		{
+			name:       "Authorized route with consent required",
+			policy:     AuthorizedPolicy,
+			hasToken:   true,
+			tokenState: auth.JWTAuthorized,
+			consent:    true,
+			errMessage: "consent to the latest policies is required",
+		},
+		{
+			name:       "Consent route with consent required",
+			policy:     ConsentPolicy,
+			hasToken:   true,
+			tokenState: auth.JWTAuthorized,
+			consent:    true,
+		},
+		{
+			name:       "Consent route with pre-authorized token",
+			policy:     ConsentPolicy,
+			hasToken:   true,
+			tokenState: auth.JWTPreAuthorized,
+		},
+		{
+			name:       "Authorized route with enrollment required",
+			policy:     AuthorizedPolicy,
+			hasToken:   true,
+			tokenState: auth.JWTAuthorized,
+			enrollment: true,
+			errMessage: "enrollment of a TOTP app or WebAuthn device is required",
+		},
+		{
+			name:       "Enrollment route with enrollment required",
+			policy:     EnrollmentPolicy,
+			hasToken:   true,
+			tokenState: auth.JWTAuthorized,
+			enrollment: true,
+		},
+		{
+			name:       "Enrollment route with pre-authorized token",
+			policy:     EnrollmentPolicy,
+			hasToken:   true,
+			tokenState: auth.JWTPreAuthorized,
+			errMessage: "token state is not supported",
+		},
+		{
+			name:     "Admin route with admin key",
+			policy:   AdminPolicy("admin-key"),
+			adminKey: "Bearer admin-key",
+		},
+		{
+			name:       "Admin route with invalid admin key",
+			policy:     AdminPolicy("admin-key"),
+			adminKey:   "Bearer another-key",
+			errMessage: "admin key is invalid",
+		},
+		{
+			name:       "Admin route with user token",
+			policy:     AdminPolicy("admin-key"),
+			hasToken:   true,
+			tokenState: auth.JWTAuthorized,
+			errMessage: "admin key is invalid",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tokenSvc := test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					return &auth.Token{
+						UserID:             "user-id",
+						State:              tc.tokenState,
+						ConsentRequired:    tc.consent,
+						EnrollmentRequired: tc.enrollment,
+					}, nil
+				},
+			}
+
+			var userID string
+			handler := func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+				userID = GetUserID(r)
+				return nil, nil
+			}
+
+			r := httptest.NewRequest("GET", "/", nil)
+			if tc.hasToken {
+				r.Header.Set("AUTHORIZATION", "JWTTOKEN")
+				r.AddCookie(&http.Cookie{Name: "CLIENTID", Value: "client-id"})
+			}
+			if tc.adminKey != "" {
+				r.Header.Set("AUTHORIZATION", tc.adminKey)
+			}
+
+			_, err := PolicyMiddleware(handler, &tokenSvc, tc.policy)(httptest.NewRecorder(), r)
+			domainErr := auth.DomainError(err)
+			if tc.errMessage == "" && err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+			if tc.errMessage != "" && (domainErr == nil || domainErr.Message() != tc.errMessage) {
+				t.Fatalf("error message does not match, want '%s' got '%v'", tc.errMessage, err)
+			}
+			if tc.errMessage == "" && tc.hasToken && userID != "user-id" {
+				t.Errorf("incorrect user ID in context, want user-id got %s", userID)
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_PolicyMiddlewareUndeclared(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for undeclared policy")
+		}
+	}()
+
+	handler := func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	PolicyMiddleware(handler, &test.TokenService{}, Policy{})
+}
@@ -5,11 +5,13 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/memstore"
 )
 
 // Rate is the rate of allowed requests. We support
@@ -31,9 +33,41 @@ const HHMMSS = "15:04:05"
 // Reference: https://yourbasic.org/golang/format-parse-string-time-date-example/
 const HHMM = "15:04"
 
+// incrScript increments a counter and starts its expiry when it is
+// created, atomically and in a single round trip.
+var incrScript = redis.NewScript(`
+local count = redis.call("INCRBY", KEYS[1], ARGV[1])
+if count == tonumber(ARGV[1]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return count
+`)
+
 // rediser is a minimal interface for go-redis
 type rediser interface {
-	TxPipelined(ctx context.Context, fn func(pipe redis.Pipeliner) error) ([]redis.Cmder, error)
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd
+	ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd
+	ScriptLoad(ctx context.Context, script string) *redis.StringCmd
+}
+
+// LimiterConfig holds configuration options for Redis backed Limiters.
+type LimiterConfig struct {
+	// Shards is the number of keys each counter is split across, so
+	// requests of a busy client are spread over a Redis cluster rather
+	// than concentrated on a single hot key. Each instance increments
+	// the shards of a counter in turn, and each shard allows an even
+	// share of the limit, so an instance admits exactly the limit. With
+	// several instances a client may be throttled up to one request per
+	// instance early. Limits lower than the number of shards use one
+	// shard per request allowed. Counters are not sharded if it is 0 or 1.
+	Shards int
+	// Batch is the number of requests an instance counts in process
+	// before adding them to Redis in a single increment. Requests in
+	// between are admitted against the last count read from Redis, so
+	// each instance may admit up to Batch requests beyond the limit.
+	// Every request is counted in Redis if it is 0 or 1.
+	Batch int
 }
 
 // Limiter provides rate limiting tooling
@@ -49,7 +83,9 @@ type LimiterFactory interface {
 }
 
 type factory struct {
-	rdb rediser
+	rdb   rediser
+	conf  LimiterConfig
+	local *localCounts
 }
 
 type ratelimiter struct {
@@ -57,15 +93,29 @@ type ratelimiter struct {
 	rate   Rate
 	max    int64
 	prefix string
+	shards int64
+	batch  int64
+	local  *localCounts
 }
 
 // NewLimiter creates a new Limiter.
 func (f *factory) NewLimiter(prefix string, rate Rate, max int64) Limiter {
+	shards := int64(f.conf.Shards)
+	if shards > max {
+		shards = max
+	}
+	if shards < 1 {
+		shards = 1
+	}
+
 	return &ratelimiter{
 		rdb:    f.rdb,
 		prefix: prefix,
 		rate:   rate,
 		max:    max,
+		shards: shards,
+		batch:  int64(f.conf.Batch),
+		local:  f.local,
 	}
 }
 
@@ -73,46 +123,255 @@ func (f *factory) NewLimiter(prefix string, rate Rate, max int64) Limiter {
 // in Redis' onboarding documentation.
 // Reference: https://redislabs.com/redis-best-practices/basic-rate-limiting/
 func (l *ratelimiter) RateLimit(r *http.Request) error {
-	var now string
-	var expiry time.Duration
-	var id string
+	key, expiry := counterKey(r, l.prefix, l.rate)
+	ctx := r.Context()
 
-	if l.rate == PerSecond {
-		now = time.Now().Format(HHMMSS)
-		expiry = time.Second
-	} else {
-		now = time.Now().Format(HHMM)
-		expiry = time.Minute
+	max := l.max
+	if l.shards > 1 {
+		shard := l.local.nextShard(key, expiry, l.shards)
+		key = fmt.Sprintf("%s:%d", key, shard)
+		max = shardMax(l.max, l.shards, shard)
 	}
 
-	id = GetUserID(r)
-	if id == "" {
-		id = GetIP(r)
+	count, err := l.count(ctx, key, expiry)
+	if err != nil {
+		return fmt.Errorf("failed to increment counter: %w", err)
 	}
 
-	ctx := r.Context()
-	key := fmt.Sprintf("%s:%s:%s", l.prefix, id, now)
-	key = base64.RawURLEncoding.EncodeToString([]byte(key))
+	if count > max {
+		return auth.ErrThrottle("requests are throttled, try again later")
+	}
+
+	return nil
+}
+
+// shardMax returns the share of a limit allowed by a shard. Shards
+// before the remainder of an uneven split allow one extra request so
+// the shares add up to the limit.
+func shardMax(max, shards, shard int64) int64 {
+	n := max / shards
+	if shard < max%shards {
+		n++
+	}
+	return n
+}
+
+// count counts a request and returns the number of requests counted
+// for a key in the current window.
+func (l *ratelimiter) count(ctx context.Context, key string, expiry time.Duration) (int64, error) {
+	if l.batch <= 1 {
+		return l.incr(ctx, key, 1, expiry)
+	}
+
+	pending, estimate := l.local.add(key, expiry, l.batch)
+	if pending == 0 {
+		return estimate, nil
+	}
+
+	count, err := l.incr(ctx, key, pending, expiry)
+	if err != nil {
+		l.local.restore(key, pending)
+		return 0, err
+	}
+
+	return l.local.observe(key, count), nil
+}
+
+func (l *ratelimiter) incr(ctx context.Context, key string, n int64, expiry time.Duration) (int64, error) {
+	return incrScript.Run(ctx, l.rdb, []string{key}, n, expiry.Milliseconds()).Int64()
+}
+
+// localCounts aggregates requests in process before they are added
+// to Redis.
+type localCounts struct {
+	now func() time.Time
+
+	mu     sync.Mutex
+	counts map[string]*localCount
+	swept  time.Time
+}
+
+// localCount is the in process count of a key.
+type localCount struct {
+	// known is the last count read from Redis.
+	known int64
+	// pending is the number of requests not yet added to Redis.
+	pending int64
+	// cursor is the number of requests routed across the shards
+	// of a sharded key.
+	cursor    int64
+	expiresAt time.Time
+}
+
+func newLocalCounts() *localCounts {
+	return &localCounts{
+		now:    time.Now,
+		counts: make(map[string]*localCount),
+	}
+}
+
+// add counts a request. It returns the number of pending requests to
+// add to Redis if the batch is full or the key was not read from Redis
+// yet, otherwise the estimated count of the key.
+func (c *localCounts) add(key string, expiry time.Duration, batch int64) (int64, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.sweep(now)
+
+	lc, ok := c.counts[key]
+	if !ok {
+		lc = &localCount{expiresAt: now.Add(expiry)}
+		c.counts[key] = lc
+	}
+
+	lc.pending++
+	if lc.known == 0 || lc.pending >= batch {
+		pending := lc.pending
+		lc.pending = 0
+		return pending, 0
+	}
+
+	return 0, lc.known + lc.pending
+}
 
-	var incr *redis.IntCmd
-	_, err := l.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
-		incr = pipe.Incr(ctx, key)
-		pipe.Expire(ctx, key, expiry)
-		return nil
-	})
+// nextShard returns the shard of a key the next request is counted
+// in. Requests are routed across shards in turn, starting from the
+// first shard of each window.
+func (c *localCounts) nextShard(key string, expiry time.Duration, shards int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
+	now := c.now()
+	c.sweep(now)
+
+	lc, ok := c.counts[key]
+	if !ok {
+		lc = &localCount{expiresAt: now.Add(expiry)}
+		c.counts[key] = lc
+	}
+
+	shard := lc.cursor % shards
+	lc.cursor++
+	return shard
+}
+
+// observe records the count of a key read from Redis and returns it
+// along with requests counted since.
+func (c *localCounts) observe(key string, count int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lc, ok := c.counts[key]
+	if !ok {
+		return count
+	}
+	if count > lc.known {
+		lc.known = count
+	}
+	return lc.known + lc.pending
+}
+
+// restore returns requests which failed to be added to Redis to the
+// pending count of a key.
+func (c *localCounts) restore(key string, pending int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if lc, ok := c.counts[key]; ok {
+		lc.pending += pending
+	}
+}
+
+// sweep removes the counts of past windows, at most once a second.
+func (c *localCounts) sweep(now time.Time) {
+	if now.Sub(c.swept) < time.Second {
+		return
+	}
+	c.swept = now
+
+	for key, lc := range c.counts {
+		if !now.Before(lc.expiresAt) {
+			delete(c.counts, key)
+		}
+	}
+}
+
+type memoryFactory struct {
+	store *memstore.Store
+}
+
+type memoryRatelimiter struct {
+	store  *memstore.Store
+	rate   Rate
+	max    int64
+	prefix string
+}
+
+// NewLimiter creates a new Limiter.
+func (f *memoryFactory) NewLimiter(prefix string, rate Rate, max int64) Limiter {
+	return &memoryRatelimiter{
+		store:  f.store,
+		prefix: prefix,
+		rate:   rate,
+		max:    max,
+	}
+}
+
+// RateLimit applies the same fixed window rate limiting as the
+// Redis backed Limiter, with counters held in process memory.
+func (l *memoryRatelimiter) RateLimit(r *http.Request) error {
+	key, expiry := counterKey(r, l.prefix, l.rate)
+	ctx := r.Context()
+
+	count, err := l.store.Incr(ctx, key).Result()
 	if err != nil {
 		return fmt.Errorf("failed to increment counter: %w", err)
 	}
+	if count == 1 {
+		l.store.Expire(ctx, key, expiry)
+	}
 
-	if incr.Val() > l.max {
+	if count > l.max {
 		return auth.ErrThrottle("requests are throttled, try again later")
 	}
 
 	return nil
 }
 
+// counterKey returns the key of the counter tracking requests for the
+// current window along with the window's duration. Requests are
+// identified by user ID if available, otherwise by IP address.
+func counterKey(r *http.Request, prefix string, rate Rate) (string, time.Duration) {
+	var now string
+	var expiry time.Duration
+
+	if rate == PerSecond {
+		now = time.Now().Format(HHMMSS)
+		expiry = time.Second
+	} else {
+		now = time.Now().Format(HHMM)
+		expiry = time.Minute
+	}
+
+	id := GetUserID(r)
+	if id == "" {
+		id = GetIP(r)
+	}
+
+	key := fmt.Sprintf("%s:%s:%s", prefix, id, now)
+	return base64.RawURLEncoding.EncodeToString([]byte(key)), expiry
+}
+
 // NewRateLimiter returns a new Limiter.
-func NewRateLimiter(db rediser) LimiterFactory {
-	return &factory{rdb: db}
+func NewRateLimiter(db rediser, conf LimiterConfig) LimiterFactory {
+	return &factory{rdb: db, conf: conf, local: newLocalCounts()}
+}
+
+// NewMemoryRateLimiter returns a new Limiter backed by an in-memory
+// store. Counters are not shared between instances so it is only
+// suitable for single node deployments.
+func NewMemoryRateLimiter(store *memstore.Store) LimiterFactory {
+	return &memoryFactory{store: store}
 }
@@ -0,0 +1,187 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/memstore"
+)
+
+func TestHTTPAPI_MemoryRateLimiter(t *testing.T) {
+	lmt := NewMemoryRateLimiter(memstore.New()).NewLimiter("Test.Method", PerMinute, 2)
+
+	req := httptest.NewRequest("POST", "/api/v1/test", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	for i := 0; i < 2; i++ {
+		if err := lmt.RateLimit(req); err != nil {
+			t.Fatal("expected request to be allowed:", err)
+		}
+	}
+
+	err := lmt.RateLimit(req)
+	var domainErr auth.Error
+	if !errors.As(err, &domainErr) || domainErr.Code() != auth.EThrottle {
+		t.Errorf("incorrect error, want %s got %v", auth.EThrottle, err)
+	}
+
+	other := httptest.NewRequest("POST", "/api/v1/test", nil)
+	other.RemoteAddr = "192.0.2.2:1234"
+	if err = lmt.RateLimit(other); err != nil {
+		t.Error("expected request from another client to be allowed:", err)
+	}
+}
+
+// scriptDB runs the increment script against counters held in memory.
+type scriptDB struct {
+	counts map[string]int64
+	calls  int
+}
+
+func (db *scriptDB) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	return db.EvalSha(ctx, "", keys, args...)
+}
+
+func (db *scriptDB) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	db.calls++
+	db.counts[keys[0]] += args[0].(int64)
+	return redis.NewCmdResult(db.counts[keys[0]], nil)
+}
+
+func (db *scriptDB) ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd {
+	return redis.NewBoolSliceResult([]bool{true}, nil)
+}
+
+func (db *scriptDB) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
+	return redis.NewStringResult("", nil)
+}
+
+func TestHTTPAPI_RateLimiter(t *testing.T) {
+	tt := []struct {
+		name    string
+		conf    LimiterConfig
+		max     int64
+		allowed int
+		calls   int
+		total   int64
+	}{
+		{
+			name:    "Counts every request",
+			max:     3,
+			allowed: 3,
+			calls:   10,
+			total:   10,
+		},
+		{
+			name:    "Counts requests in batches",
+			conf:    LimiterConfig{Batch: 5},
+			max:     100,
+			allowed: 10,
+			calls:   2,
+			total:   6,
+		},
+		{
+			name:    "Throttles batched requests in process",
+			conf:    LimiterConfig{Batch: 10},
+			max:     3,
+			allowed: 3,
+			calls:   1,
+			total:   1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &scriptDB{counts: make(map[string]int64)}
+			lmt := NewRateLimiter(db, tc.conf).NewLimiter("Test.Method", PerMinute, tc.max)
+
+			req := httptest.NewRequest("POST", "/api/v1/test", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+
+			allowed := 0
+			for i := 0; i < 10; i++ {
+				err := lmt.RateLimit(req)
+				if err == nil {
+					allowed++
+					continue
+				}
+				var domainErr auth.Error
+				if !errors.As(err, &domainErr) || domainErr.Code() != auth.EThrottle {
+					t.Fatalf("incorrect error, want %s got %v", auth.EThrottle, err)
+				}
+			}
+
+			var total int64
+			for _, count := range db.counts {
+				total += count
+			}
+
+			if allowed != tc.allowed {
+				t.Errorf("incorrect allowed requests, want %v got %v", tc.allowed, allowed)
+			}
+			if db.calls != tc.calls {
+				t.Errorf("incorrect Redis calls, want %v got %v", tc.calls, db.calls)
+			}
+			if total != tc.total {
+				t.Errorf("incorrect counted requests, want %v got %v", tc.total, total)
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_ShardedRateLimiter(t *testing.T) {
+	tt := []struct {
+		name   string
+		shards int
+		max    int64
+	}{
+		{
+			name:   "Even split",
+			shards: 4,
+			max:    8,
+		},
+		{
+			name:   "Uneven split",
+			shards: 4,
+			max:    10,
+		},
+		{
+			name:   "Shards capped at limit",
+			shards: 10,
+			max:    5,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &scriptDB{counts: make(map[string]int64)}
+			lmt := NewRateLimiter(db, LimiterConfig{Shards: tc.shards}).
+				NewLimiter("Test.Method", PerMinute, tc.max)
+
+			req := httptest.NewRequest("POST", "/api/v1/test", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+
+			for i := int64(0); i < tc.max; i++ {
+				if err := lmt.RateLimit(req); err != nil {
+					t.Fatalf("request %v should be allowed: %v", i+1, err)
+				}
+			}
+
+			if err := lmt.RateLimit(req); auth.ErrorCode(err) != auth.EThrottle {
+				t.Errorf("incorrect error code, want %s got %v", auth.EThrottle, err)
+			}
+
+			shards := int64(tc.shards)
+			if shards > tc.max {
+				shards = tc.max
+			}
+			if int64(len(db.counts)) != shards {
+				t.Errorf("incorrect shard count, want %v got %v", shards, len(db.counts))
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// RoutePrefix is the path prefix API modules register their routes under.
+const RoutePrefix = "/api/v1"
+
+// Registrar registers the routes of API modules on a router, skipping
+// modules disabled by configuration, and serves them under a base path.
+type Registrar struct {
+	router   *mux.Router
+	basePath string
+	disabled map[string]bool
+	modules  map[string]bool
+}
+
+// NewRegistrar returns a Registrar for a router. Routes registered under
+// RoutePrefix are served under basePath instead, e.g. `/auth/api/v1`.
+// An empty base path serves routes under RoutePrefix.
+func NewRegistrar(router *mux.Router, basePath string, disabled []string) (*Registrar, error) {
+	basePath = strings.TrimRight(strings.TrimSpace(basePath), "/")
+	if basePath == "" {
+		basePath = RoutePrefix
+	}
+	if !strings.HasPrefix(basePath, "/") {
+		return nil, fmt.Errorf("base path %q must begin with /", basePath)
+	}
+
+	r := Registrar{
+		router:   router,
+		basePath: basePath,
+		disabled: make(map[string]bool),
+		modules:  make(map[string]bool),
+	}
+	for _, module := range disabled {
+		module = strings.TrimSpace(module)
+		if module != "" {
+			r.disabled[module] = true
+		}
+	}
+
+	return &r, nil
+}
+
+// BasePath returns the path prefix APIs are served under.
+func (r *Registrar) BasePath() string {
+	return r.basePath
+}
+
+// Register registers the routes of a module unless it is disabled.
+func (r *Registrar) Register(module string, setup func(router *mux.Router)) {
+	r.modules[module] = true
+	if r.disabled[module] {
+		return
+	}
+	setup(r.router)
+}
+
+// Enabled reports whether the routes of a module are registered.
+func (r *Registrar) Enabled(module string) bool {
+	return r.modules[module] && !r.disabled[module]
+}
+
+// Validate returns an error if a disabled module was never registered,
+// which is most likely a misspelled module name.
+func (r *Registrar) Validate() error {
+	var unknown []string
+	for module := range r.disabled {
+		if !r.modules[module] {
+			unknown = append(unknown, module)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown modules: %s", strings.Join(unknown, ", "))
+}
+
+// Middleware rewrites requests under the base path to RoutePrefix so
+// they are routed, and every middleware behind it sees, the path the
+// module registered. Requests under RoutePrefix itself are not found
+// when another base path is configured. Other paths, such as health
+// checks, are served unchanged.
+func (r *Registrar) Middleware(next http.Handler) http.Handler {
+	if r.basePath == RoutePrefix {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case hasPathPrefix(req.URL.Path, r.basePath):
+			u := *req.URL
+			u.Path = RoutePrefix + strings.TrimPrefix(req.URL.Path, r.basePath)
+			u.RawPath = ""
+
+			req2 := new(http.Request)
+			*req2 = *req
+			req2.URL = &u
+			next.ServeHTTP(w, req2)
+		case hasPathPrefix(req.URL.Path, RoutePrefix):
+			http.NotFound(w, req)
+		default:
+			next.ServeHTTP(w, req)
+		}
+	})
+}
+
+// hasPathPrefix reports whether path is prefix or a path beneath it.
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
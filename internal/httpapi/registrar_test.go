@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestHTTPAPI_RegistrarModules(t *testing.T) {
+	router := mux.NewRouter()
+	reg, err := NewRegistrar(router, "", []string{"signup", " "})
+	if err != nil {
+		t.Fatal("failed to create registrar:", err)
+	}
+
+	var registered []string
+	for _, module := range []string{"login", "signup"} {
+		module := module
+		reg.Register(module, func(router *mux.Router) {
+			registered = append(registered, module)
+		})
+	}
+
+	if len(registered) != 1 || registered[0] != "login" {
+		t.Errorf("incorrect modules registered, want [login] got %v", registered)
+	}
+	if !reg.Enabled("login") || reg.Enabled("signup") || reg.Enabled("admin") {
+		t.Error("incorrect enabled modules")
+	}
+	if err = reg.Validate(); err != nil {
+		t.Error("expected disabled modules to be valid:", err)
+	}
+
+	reg, _ = NewRegistrar(router, "", []string{"singup"})
+	reg.Register("signup", func(router *mux.Router) {})
+	if err = reg.Validate(); err == nil {
+		t.Error("expected unknown disabled module to be invalid")
+	}
+}
+
+func TestHTTPAPI_RegistrarBasePath(t *testing.T) {
+	tt := []struct {
+		name       string
+		basePath   string
+		path       string
+		statusCode int
+		routedPath string
+	}{
+		{
+			name:       "Serves default prefix",
+			basePath:   "",
+			path:       "/api/v1/login",
+			statusCode: http.StatusOK,
+			routedPath: "/api/v1/login",
+		},
+		{
+			name:       "Serves base path",
+			basePath:   "/auth/api/v1/",
+			path:       "/auth/api/v1/login",
+			statusCode: http.StatusOK,
+			routedPath: "/api/v1/login",
+		},
+		{
+			name:       "Hides default prefix under another base path",
+			basePath:   "/auth/api/v1",
+			path:       "/api/v1/login",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Matches base path on segment boundaries",
+			basePath:   "/auth",
+			path:       "/authz/login",
+			statusCode: http.StatusOK,
+			routedPath: "/authz/login",
+		},
+		{
+			name:       "Serves paths outside of base path",
+			basePath:   "/auth/api/v1",
+			path:       "/healthcheck",
+			statusCode: http.StatusOK,
+			routedPath: "/healthcheck",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			reg, err := NewRegistrar(mux.NewRouter(), tc.basePath, nil)
+			if err != nil {
+				t.Fatal("failed to create registrar:", err)
+			}
+
+			var routedPath string
+			h := reg.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				routedPath = r.URL.Path
+			}))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", tc.path, nil)
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, w.Code)
+			}
+			if routedPath != tc.routedPath {
+				t.Errorf("incorrect routed path, want %q got %q", tc.routedPath, routedPath)
+			}
+			if r.URL.Path != tc.path {
+				t.Error("original request was modified")
+			}
+		})
+	}
+
+	if _, err := NewRegistrar(mux.NewRouter(), "auth", nil); err == nil {
+		t.Error("expected relative base path to be invalid")
+	}
+}
@@ -26,6 +26,17 @@ func ToHandlerFunc(jsonHandler JSONAPIHandler, successCode int) http.HandlerFunc
 	}
 }
 
+// ToStreamHandlerFunc converts a JSONAPIHandler which streams its own
+// response, such as server-sent events, to an http.HandlerFunc. Only
+// errors returned before the stream begins are written.
+func ToStreamHandlerFunc(jsonHandler JSONAPIHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := jsonHandler(w, r); err != nil {
+			ErrorResponse(w, err)
+		}
+	}
+}
+
 // GetUserID retrieves a User ID from context.
 func GetUserID(r *http.Request) string {
 	ctx := r.Context()
@@ -56,24 +67,28 @@ func GetRefreshToken(r *http.Request) string {
 	return token
 }
 
-// GetIP Retrieves the client IP address
-func GetIP(r *http.Request) string {
-	var ip string
-
-	ip = r.Header.Get("X-Forwarded-For")
-	if ip != "" && strings.Contains(ip, ",") {
-		ip = strings.Split(ip, ",")[0]
-	}
+// IsRefreshTokenHeader returns true if the refresh token in context
+// was delivered through the RefreshTokenHeader.
+func IsRefreshTokenHeader(r *http.Request) bool {
+	isHeader, _ := r.Context().Value(refreshTokenHeaderContextKey).(bool)
+	return isHeader
+}
 
-	if ip == "" {
-		ip = r.Header.Get("X-Real-IP")
-	}
+// GetDeviceID retrieves the device ID of a native client.
+func GetDeviceID(r *http.Request) string {
+	return r.Header.Get(DeviceIDHeader)
+}
 
-	if ip == "" {
-		ip = r.RemoteAddr
+// GetIP retrieves the client IP address. The address is resolved
+// by ClientIPMiddleware, otherwise we default to the address of
+// the connecting peer.
+func GetIP(r *http.Request) string {
+	ip, ok := r.Context().Value(clientIPContextKey).(string)
+	if ok && ip != "" {
+		return ip
 	}
 
-	return ip
+	return stripPort(r.RemoteAddr)
 }
 
 // JSONResponse writes a response body. If a struct is provided
@@ -113,27 +128,47 @@ func ErrorResponse(w http.ResponseWriter, err error) {
 	switch domainErr.Code() {
 	case auth.EInvalidToken:
 		statusCode = http.StatusUnauthorized
-	case auth.EThrottle:
+	case auth.EThrottle, auth.EQuota:
 		statusCode = http.StatusTooManyRequests
+	case auth.EForbidden, auth.EChallenge:
+		statusCode = http.StatusForbidden
+	case auth.EUnavailable:
+		statusCode = http.StatusServiceUnavailable
+	case auth.ETooLarge:
+		statusCode = http.StatusRequestEntityTooLarge
 	default:
 		statusCode = http.StatusBadRequest
 	}
 
-	content := errorMessage(string(domainErr.Code()), domainErr.Message())
+	// Validation errors describe each invalid field so clients
+	// may highlight the offending input.
+	var fields []auth.FieldError
+	if v, ok := domainErr.(auth.ErrValidation); ok {
+		fields = v
+	}
+
+	content := errorMessage(string(domainErr.Code()), domainErr.Message(), fields...)
 	response(w, content, statusCode)
 }
 
-func errorMessage(code, message string) []byte {
-	var friendlyMsg string
-	if message != "" {
-		c := strings.ToUpper(string(message[0]))
-		friendlyMsg = fmt.Sprintf("%s%s", c, message[1:])
+type errorBody struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  []auth.FieldError `json:"fields,omitempty"`
+}
+
+func errorMessage(code, message string, fields ...auth.FieldError) []byte {
+	friendlyFields := make([]auth.FieldError, len(fields))
+	for i, f := range fields {
+		f.Message = capitalize(f.Message)
+		friendlyFields[i] = f
 	}
 
-	response := map[string]map[string]string{
+	response := map[string]errorBody{
 		"error": {
-			"code":    code,
-			"message": friendlyMsg,
+			Code:    code,
+			Message: capitalize(message),
+			Fields:  friendlyFields,
 		},
 	}
 	b, err := json.Marshal(response)
@@ -144,6 +179,14 @@ func errorMessage(code, message string) []byte {
 	return b
 }
 
+func capitalize(message string) string {
+	if message == "" {
+		return ""
+	}
+	c := strings.ToUpper(string(message[0]))
+	return fmt.Sprintf("%s%s", c, message[1:])
+}
+
 func response(w http.ResponseWriter, content []byte, statusCode int) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(statusCode)
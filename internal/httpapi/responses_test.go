@@ -87,9 +87,11 @@ func TestHTTPAPI_JSONResponse(t *testing.T) {
 
 func TestHTTPAPI_ErrorResponse(t *testing.T) {
 	tt := []struct {
-		name    string
-		err     error
-		message string
+		name       string
+		err        error
+		message    string
+		fields     []auth.FieldError
+		statusCode int
 	}{
 		{
 			name:    "Handles auth error",
@@ -101,6 +103,24 @@ func TestHTTPAPI_ErrorResponse(t *testing.T) {
 			err:     auth.ErrBadRequest("something bad happened"),
 			message: "Something bad happened",
 		},
+		{
+			name: "Handles validation error",
+			err: auth.ErrValidation{
+				{Field: "type", Code: auth.FieldInvalid, Message: "identity type must be email or phone"},
+				{Field: "identity", Code: auth.FieldRequired, Message: "identity cannot be empty"},
+			},
+			message: "Identity type must be email or phone",
+			fields: []auth.FieldError{
+				{Field: "type", Code: auth.FieldInvalid, Message: "Identity type must be email or phone"},
+				{Field: "identity", Code: auth.FieldRequired, Message: "Identity cannot be empty"},
+			},
+		},
+		{
+			name:       "Handles challenge error",
+			err:        auth.ErrChallenge("captcha is required"),
+			message:    "Captcha is required",
+			statusCode: http.StatusForbidden,
+		},
 		{
 			name:    "Handles internal error",
 			err:     fmt.Errorf("whoops"),
@@ -116,6 +136,10 @@ func TestHTTPAPI_ErrorResponse(t *testing.T) {
 			resp := w.Result()
 			defer resp.Body.Close()
 
+			if tc.statusCode != 0 && resp.StatusCode != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, resp.StatusCode)
+			}
+
 			body, err := ioutil.ReadAll(resp.Body)
 			if err != nil {
 				t.Fatal("failed to read body:", err)
@@ -125,6 +149,11 @@ func TestHTTPAPI_ErrorResponse(t *testing.T) {
 			if err != nil {
 				t.Error("Error messsage does not match:", err)
 			}
+
+			err = test.ValidateErrFields(tc.fields, bytes.NewBuffer(body))
+			if err != nil {
+				t.Error("Error fields do not match:", err)
+			}
 		})
 	}
 }
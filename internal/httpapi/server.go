@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// ServerConfig configures the timeouts, limits and protocols
+// of an http.Server.
+type ServerConfig struct {
+	// ReadTimeout is the maximum duration for reading a request,
+	// including its body.
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout is the maximum duration for reading request
+	// headers. ReadTimeout applies if it is 0.
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout is the maximum duration before timing out
+	// writes of a response.
+	WriteTimeout time.Duration
+	// IdleTimeout is the maximum duration to wait for the next
+	// request on a keep-alive connection.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes is the maximum size of request headers.
+	// http.DefaultMaxHeaderBytes applies if it is 0.
+	MaxHeaderBytes int
+	// HTTP2 enables HTTP/2 for TLS connections.
+	HTTP2 bool
+	// H2C enables HTTP/2 without TLS, as expected by gRPC-aware
+	// load balancers. It may not be enabled with TLS.
+	H2C bool
+	// MaxConcurrentStreams is the maximum number of HTTP/2 streams
+	// per connection. The http2 package default applies if it is 0.
+	MaxConcurrentStreams uint32
+}
+
+// ConfigureServer applies a ServerConfig to a server. TLS must be
+// configured on the server beforehand.
+func ConfigureServer(srv *http.Server, conf ServerConfig) error {
+	srv.ReadTimeout = conf.ReadTimeout
+	srv.ReadHeaderTimeout = conf.ReadHeaderTimeout
+	srv.WriteTimeout = conf.WriteTimeout
+	srv.IdleTimeout = conf.IdleTimeout
+	srv.MaxHeaderBytes = conf.MaxHeaderBytes
+
+	h2s := &http2.Server{
+		IdleTimeout:          conf.IdleTimeout,
+		MaxConcurrentStreams: conf.MaxConcurrentStreams,
+	}
+
+	if conf.H2C {
+		if srv.TLSConfig != nil {
+			return fmt.Errorf("h2c may not be enabled with TLS")
+		}
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	}
+
+	if srv.TLSConfig == nil {
+		return nil
+	}
+
+	if !conf.HTTP2 {
+		// A non-nil, empty map disables the standard library's
+		// HTTP/2 support. The protocol must also no longer be
+		// advertised during the TLS handshake.
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		srv.TLSConfig.NextProtos = removeProto(srv.TLSConfig.NextProtos, http2.NextProtoTLS)
+		return nil
+	}
+
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		return fmt.Errorf("cannot configure HTTP/2: %w", err)
+	}
+	return nil
+}
+
+func removeProto(protos []string, proto string) []string {
+	var filtered []string
+	for _, p := range protos {
+		if p != proto {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/net/http2"
+)
+
+func TestHTTPAPI_ConfigureServer(t *testing.T) {
+	tt := []struct {
+		name       string
+		tlsConfig  *tls.Config
+		conf       ServerConfig
+		nextProtos []string
+		hasErr     bool
+	}{
+		{
+			name: "Configures plain HTTP server",
+			conf: ServerConfig{HTTP2: true},
+		},
+		{
+			name:       "Enables HTTP/2 over TLS",
+			tlsConfig:  &tls.Config{MinVersion: tls.VersionTLS12},
+			conf:       ServerConfig{HTTP2: true},
+			nextProtos: []string{"h2"},
+		},
+		{
+			name:       "Disables HTTP/2 over TLS",
+			tlsConfig:  &tls.Config{MinVersion: tls.VersionTLS12, NextProtos: []string{"h2", "http/1.1"}},
+			conf:       ServerConfig{HTTP2: false},
+			nextProtos: []string{"http/1.1"},
+		},
+		{
+			name:      "Rejects h2c with TLS",
+			tlsConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+			conf:      ServerConfig{H2C: true},
+			hasErr:    true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.conf.ReadTimeout = time.Second
+			tc.conf.ReadHeaderTimeout = time.Second * 2
+			tc.conf.WriteTimeout = time.Second * 3
+			tc.conf.IdleTimeout = time.Second * 4
+			tc.conf.MaxHeaderBytes = 4096
+
+			srv := &http.Server{TLSConfig: tc.tlsConfig, Handler: http.NotFoundHandler()}
+			err := ConfigureServer(srv, tc.conf)
+			if tc.hasErr != (err != nil) {
+				t.Fatalf("incorrect error result, want error %v got %v", tc.hasErr, err)
+			}
+			if tc.hasErr {
+				return
+			}
+
+			if srv.ReadTimeout != time.Second || srv.ReadHeaderTimeout != time.Second*2 ||
+				srv.WriteTimeout != time.Second*3 || srv.IdleTimeout != time.Second*4 {
+				t.Errorf("incorrect timeouts: %v %v %v %v",
+					srv.ReadTimeout, srv.ReadHeaderTimeout, srv.WriteTimeout, srv.IdleTimeout)
+			}
+			if srv.MaxHeaderBytes != 4096 {
+				t.Errorf("incorrect max header bytes, want 4096 got %v", srv.MaxHeaderBytes)
+			}
+			if tc.tlsConfig == nil {
+				if srv.TLSConfig != nil {
+					t.Error("TLS configured on plain HTTP server")
+				}
+				return
+			}
+
+			if !cmp.Equal(srv.TLSConfig.NextProtos, tc.nextProtos) {
+				t.Error(cmp.Diff(srv.TLSConfig.NextProtos, tc.nextProtos))
+			}
+			_, hasH2 := srv.TLSNextProto["h2"]
+			if hasH2 != tc.conf.HTTP2 {
+				t.Errorf("incorrect HTTP/2 handler, want %v got %v", tc.conf.HTTP2, hasH2)
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_ConfigureServerH2C(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	if err := ConfigureServer(srv.Config, ServerConfig{H2C: true}); err != nil {
+		t.Fatal("failed to configure server:", err)
+	}
+	srv.Start()
+	defer srv.Close()
+
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal("h2c request failed:", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.ProtoMajor != 2 {
+		t.Errorf("incorrect protocol, want HTTP/2 got %s", resp.Proto)
+	}
+}
@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion returns the TLS version identifier for a
+// version string such as `1.2`. An empty string defaults to TLS 1.2.
+func ParseTLSVersion(v string) (uint16, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return tls.VersionTLS12, nil
+	}
+
+	version, ok := tlsVersions[v]
+	if !ok {
+		return 0, fmt.Errorf("%s is not a supported TLS version", v)
+	}
+
+	return version, nil
+}
+
+// HTTPSRedirectHandler redirects plain HTTP requests to HTTPS. If httpsPort
+// is set, it replaces the port of the requested host, otherwise the default
+// HTTPS port is assumed.
+func HTTPSRedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			http.Error(w, "Use HTTPS", http.StatusBadRequest)
+			return
+		}
+
+		host := stripPort(r.Host)
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+}
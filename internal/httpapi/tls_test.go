@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPAPI_ParseTLSVersion(t *testing.T) {
+	tt := []struct {
+		name    string
+		version string
+		result  uint16
+		hasErr  bool
+	}{
+		{
+			name:    "Defaults to TLS 1.2",
+			version: "",
+			result:  tls.VersionTLS12,
+		},
+		{
+			name:    "Parses TLS 1.3",
+			version: "1.3",
+			result:  tls.VersionTLS13,
+		},
+		{
+			name:    "Rejects unknown version",
+			version: "2.0",
+			hasErr:  true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := ParseTLSVersion(tc.version)
+			if tc.hasErr && err == nil {
+				t.Fatal("expected error, not nil")
+			}
+			if !tc.hasErr && err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+			if v != tc.result {
+				t.Errorf("incorrect TLS version, want %v got %v", tc.result, v)
+			}
+		})
+	}
+}
+
+func TestHTTPAPI_HTTPSRedirectHandler(t *testing.T) {
+	tt := []struct {
+		name      string
+		httpsPort string
+		method    string
+		url       string
+		location  string
+		code      int
+	}{
+		{
+			name:     "Redirects to default port",
+			method:   "GET",
+			url:      "http://example.com:8080/api/v1/login?foo=bar",
+			location: "https://example.com/api/v1/login?foo=bar",
+			code:     http.StatusFound,
+		},
+		{
+			name:      "Redirects to custom port",
+			httpsPort: "8443",
+			method:    "GET",
+			url:       "http://example.com/healthcheck",
+			location:  "https://example.com:8443/healthcheck",
+			code:      http.StatusFound,
+		},
+		{
+			name:   "Rejects non GET requests",
+			method: "POST",
+			url:    "http://example.com/api/v1/login",
+			code:   http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tc.method, tc.url, nil)
+			HTTPSRedirectHandler(tc.httpsPort).ServeHTTP(w, r)
+
+			if w.Code != tc.code {
+				t.Errorf("incorrect status code, want %v got %v", tc.code, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != tc.location {
+				t.Errorf("incorrect location, want %s got %s", tc.location, location)
+			}
+		})
+	}
+}
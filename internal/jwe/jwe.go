@@ -0,0 +1,133 @@
+// Package jwe encrypts signed JWT tokens as JSON Web Encryption (JWE)
+// compact serializations, so their claims cannot be read by the clients
+// holding them. Tokens are encrypted directly with a key derived from
+// the token secret (alg `dir`) using AES-256-GCM (enc `A256GCM`).
+package jwe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fmitra/authenticator/internal/crypto"
+)
+
+// keyContext separates the token encryption key from the key used
+// to sign tokens.
+const keyContext = "token-encryption"
+
+// header is the JOSE header of encrypted tokens. The content type
+// marks the payload as a nested, signed JWT.
+type header struct {
+	Algorithm  string `json:"alg"`
+	Encryption string `json:"enc"`
+	Type       string `json:"cty"`
+}
+
+var encoding = base64.RawURLEncoding
+
+// DeriveKey returns the key tokens are encrypted with from the secret
+// they are signed with.
+func DeriveKey(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(keyContext))
+	return mac.Sum(nil)
+}
+
+// IsEncrypted reports whether a token is a JWE compact serialization
+// rather than a signed JWT.
+func IsEncrypted(token string) bool {
+	return strings.Count(token, ".") == 4
+}
+
+// Encrypt encrypts a signed JWT with a key from DeriveKey.
+func Encrypt(key []byte, signedToken string) (string, error) {
+	b, err := json.Marshal(header{Algorithm: "dir", Encryption: "A256GCM", Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	protected := encoding.EncodeToString(b)
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	iv, err := crypto.Bytes(aead.NonceSize())
+	if err != nil {
+		return "", fmt.Errorf("cannot generate IV: %w", err)
+	}
+
+	sealed := aead.Seal(nil, iv, []byte(signedToken), []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-aead.Overhead()], sealed[len(sealed)-aead.Overhead():]
+
+	// Keys used directly leave the encrypted key segment empty.
+	return strings.Join([]string{
+		protected,
+		"",
+		encoding.EncodeToString(iv),
+		encoding.EncodeToString(ciphertext),
+		encoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// Decrypt returns the signed JWT encrypted by Encrypt. The signature
+// of the returned token must still be validated.
+func Decrypt(key []byte, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return "", errors.New("token is not encrypted")
+	}
+	if parts[1] != "" {
+		return "", errors.New("unexpected encrypted key")
+	}
+
+	b, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("invalid header: %w", err)
+	}
+	var h header
+	if err = json.Unmarshal(b, &h); err != nil {
+		return "", fmt.Errorf("invalid header: %w", err)
+	}
+	if h.Algorithm != "dir" || h.Encryption != "A256GCM" {
+		return "", fmt.Errorf("unsupported encryption %s/%s", h.Algorithm, h.Encryption)
+	}
+
+	var segments [3][]byte
+	for i, part := range parts[2:] {
+		if segments[i], err = encoding.DecodeString(part); err != nil {
+			return "", fmt.Errorf("invalid token segment: %w", err)
+		}
+	}
+	iv, ciphertext, tag := segments[0], segments[1], segments[2]
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	if len(iv) != aead.NonceSize() || len(tag) != aead.Overhead() {
+		return "", errors.New("invalid IV or authentication tag")
+	}
+
+	plaintext, err := aead.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt token: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,125 @@
+package linkpages
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/fmitra/authenticator/internal/branding"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+// NewHandler returns an http.Handler serving the landing pages of
+// the configured actions under Path.
+func NewHandler(options ...ConfigOption) (http.Handler, error) {
+	h := handler{
+		logger:  log.NewNopLogger(),
+		actions: make(map[string]Action),
+		brand:   branding.Default(),
+		tmpl:    defaultTemplate,
+	}
+
+	for _, opt := range options {
+		if err := opt(&h); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, a := range h.actions {
+		jsonHandler := a.Handler
+		if h.lmt != nil {
+			jsonHandler = httpapi.RateLimitMiddleware(jsonHandler, h.lmt.NewLimiter(
+				"LinkPages."+name, httpapi.PerMinute, int64(10),
+			))
+		}
+		a.Handler = httpapi.ErrorLoggingMiddleware(jsonHandler, h.logger)
+		h.actions[name] = a
+	}
+
+	return &h, nil
+}
+
+// ConfigOption configures the handler.
+type ConfigOption func(*handler) error
+
+// WithLogger configures the handler with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(h *handler) error {
+		h.logger = l
+		return nil
+	}
+}
+
+// WithRateLimiter configures the handler to rate limit confirmations
+// of each action.
+func WithRateLimiter(lmt httpapi.LimiterFactory) ConfigOption {
+	return func(h *handler) error {
+		h.lmt = lmt
+		return nil
+	}
+}
+
+// WithAction serves the landing page of an action.
+func WithAction(a Action) ConfigOption {
+	return func(h *handler) error {
+		h.actions[a.Name] = a
+		return nil
+	}
+}
+
+// WithBrand configures the brand shown on pages. Empty names and
+// colors keep their defaults.
+func WithBrand(b branding.Brand) ConfigOption {
+	return func(h *handler) error {
+		h.brand = b.WithDefaults()
+		return nil
+	}
+}
+
+// WithTemplateFile renders pages with an html/template file instead
+// of the default template. Templates are executed with a Page.
+func WithTemplateFile(path string) ConfigOption {
+	return func(h *handler) error {
+		if path == "" {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read landing page template: %w", err)
+		}
+
+		tmpl, err := template.New("page").Parse(string(b))
+		if err != nil {
+			return fmt.Errorf("invalid landing page template: %w", err)
+		}
+
+		h.tmpl = tmpl
+		return nil
+	}
+}
+
+// WithRedirects redirects Users to a URL once an action completes
+// instead of rendering a result page. The action is set as the `action`
+// query parameter and failures set the error code as `error`. An empty
+// URL renders the result page.
+func WithRedirects(successURL, failureURL string) ConfigOption {
+	return func(h *handler) error {
+		for _, u := range []string{successURL, failureURL} {
+			if u == "" {
+				continue
+			}
+			if _, err := url.Parse(u); err != nil {
+				return fmt.Errorf("invalid landing page redirect URL: %w", err)
+			}
+		}
+
+		h.successURL = successURL
+		h.failureURL = failureURL
+		return nil
+	}
+}
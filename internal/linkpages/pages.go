@@ -0,0 +1,261 @@
+// Package linkpages serves landing pages for links delivered to Users,
+// such as login approvals and cancellations of account recoveries. Links
+// open a page asking the User to confirm the action, which is performed
+// by the API once the page's form is submitted. Confirming on a separate
+// request prevents email scanners following links from performing the
+// action on the User's behalf.
+package linkpages
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/branding"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+// Path is the path landing pages are served under. Each action is
+// served on Path followed by its name, e.g. `/links/approve-login`.
+const Path = "/links"
+
+// Page statuses.
+const (
+	StatusConfirm = "confirm"
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// Action is an API action performed from a landing page. Its handler
+// receives a JSON request body with the token of the link.
+type Action struct {
+	// Name is the path of the action's page beneath Path.
+	Name string
+	// Title is the heading of the action's pages.
+	Title string
+	// Prompt asks the User to confirm the action.
+	Prompt string
+	// Button is the label of the confirmation button.
+	Button string
+	// Success is shown once the action completes.
+	Success string
+	// Handler performs the action.
+	Handler httpapi.JSONAPIHandler
+}
+
+// ApproveLogin returns the action approving a pending login.
+func ApproveLogin(h httpapi.JSONAPIHandler) Action {
+	return Action{
+		Name:    "approve-login",
+		Title:   "Approve login",
+		Prompt:  "Someone is trying to log in to your account. Approve the login only if it was you.",
+		Button:  "Approve login",
+		Success: "Your login is approved. You may return to the device you are logging in from.",
+		Handler: h,
+	}
+}
+
+// CancelRecovery returns the action cancelling a pending account recovery.
+func CancelRecovery(h httpapi.JSONAPIHandler) Action {
+	return Action{
+		Name:    "cancel-recovery",
+		Title:   "Cancel account recovery",
+		Prompt:  "An account recovery was requested for your account. Cancel it if it was not you.",
+		Button:  "Cancel recovery",
+		Success: "The account recovery is cancelled.",
+		Handler: h,
+	}
+}
+
+// VerifyTrustedContact returns the action confirming a trusted
+// contact received their share of a recovery code.
+func VerifyTrustedContact(h httpapi.JSONAPIHandler) Action {
+	return Action{
+		Name:    "verify-contact",
+		Title:   "Confirm trusted contact",
+		Prompt:  "Confirm you received a recovery code share as a trusted contact.",
+		Button:  "Confirm",
+		Success: "Thank you. Keep the recovery code share until it is needed.",
+		Handler: h,
+	}
+}
+
+// CancelChange returns the action cancelling a pending security change.
+func CancelChange(h httpapi.JSONAPIHandler) Action {
+	return Action{
+		Name:    "cancel-change",
+		Title:   "Cancel security change",
+		Prompt:  "A change to the security of your account is pending. Cancel it if it was not you.",
+		Button:  "Cancel change",
+		Success: "The security change is cancelled.",
+		Handler: h,
+	}
+}
+
+// Page is the data landing page templates are executed with.
+type Page struct {
+	Brand  branding.Brand
+	Action string
+	Status string
+	Title  string
+	// Message describes the action or its result.
+	Message string
+	// Button and Token are set on confirmation pages, whose form
+	// posts the token back to the page.
+	Button string
+	Token  string
+}
+
+type handler struct {
+	logger     log.Logger
+	lmt        httpapi.LimiterFactory
+	actions    map[string]Action
+	brand      branding.Brand
+	tmpl       *template.Template
+	successURL string
+	failureURL string
+}
+
+// ServeHTTP renders the confirmation page of an action on GET requests
+// and performs the action on POST requests.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, Path+"/")
+	a, ok := h.actions[name]
+	if !ok || !strings.HasPrefix(r.URL.Path, Path+"/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			h.render(w, a, StatusFailure, "This link is invalid.", "")
+			return
+		}
+		h.render(w, a, StatusConfirm, a.Prompt, token)
+	case http.MethodPost:
+		h.confirm(w, r, a)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// confirm performs an action with the token posted by its confirmation
+// page and renders, or redirects to, the result.
+func (h *handler) confirm(w http.ResponseWriter, r *http.Request, a Action) {
+	if err := r.ParseForm(); err != nil {
+		h.fail(w, r, a, auth.ErrBadRequest("invalid form"))
+		return
+	}
+
+	body, err := json.Marshal(map[string]string{"token": r.PostForm.Get("token")})
+	if err != nil {
+		h.fail(w, r, a, err)
+		return
+	}
+
+	req := r.Clone(r.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if _, err = a.Handler(w, req); err != nil {
+		h.fail(w, r, a, err)
+		return
+	}
+
+	if h.successURL != "" {
+		http.Redirect(w, r, redirectURL(h.successURL, a.Name, ""), http.StatusSeeOther)
+		return
+	}
+	h.render(w, a, StatusSuccess, a.Success, "")
+}
+
+// fail renders, or redirects to, the failure of an action. Messages of
+// domain errors are shown to the User while other errors are hidden.
+func (h *handler) fail(w http.ResponseWriter, r *http.Request, a Action, err error) {
+	code := string(auth.EInternal)
+	message := "Something went wrong, please try again later."
+	if domainErr := auth.DomainError(err); domainErr != nil {
+		code = string(domainErr.Code())
+		message = domainErr.Message()
+	}
+
+	if h.failureURL != "" {
+		http.Redirect(w, r, redirectURL(h.failureURL, a.Name, code), http.StatusSeeOther)
+		return
+	}
+	h.render(w, a, StatusFailure, message, "")
+}
+
+func (h *handler) render(w http.ResponseWriter, a Action, status, message, token string) {
+	p := Page{
+		Brand:   h.brand,
+		Action:  a.Name,
+		Status:  status,
+		Title:   a.Title,
+		Message: message,
+	}
+	if status == StatusConfirm {
+		p.Button = a.Button
+		p.Token = token
+	}
+
+	var b bytes.Buffer
+	if err := h.tmpl.Execute(&b, p); err != nil {
+		level.Error(h.logger).Log(
+			"source", "linkpages.render",
+			"action", a.Name,
+			"error", err,
+		)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	statusCode := http.StatusOK
+	if status == StatusFailure {
+		statusCode = http.StatusBadRequest
+	}
+
+	// Links carry their token in the URL, which must not leak to
+	// third parties through referrers or caches.
+	headers := w.Header()
+	headers.Set("Content-Type", "text/html; charset=utf-8")
+	headers.Set("Cache-Control", "no-store")
+	headers.Set("Referrer-Policy", "no-referrer")
+	headers.Set("X-Content-Type-Options", "nosniff")
+	headers.Set("X-Frame-Options", "DENY")
+	headers.Set("Content-Security-Policy",
+		"default-src 'none'; style-src 'unsafe-inline'; img-src https: data:; form-action 'self'; frame-ancestors 'none'",
+	)
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(b.Bytes())
+}
+
+// redirectURL appends the action and error code of a result to a
+// redirect URL.
+func redirectURL(base, action, code string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+
+	query := u.Query()
+	query.Set("action", action)
+	if code != "" {
+		query.Set("error", code)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,209 @@
+package linkpages
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/branding"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+func TestLinkPages_Handler(t *testing.T) {
+	tt := []struct {
+		name        string
+		method      string
+		path        string
+		form        url.Values
+		options     []ConfigOption
+		actionErr   error
+		statusCode  int
+		body        string
+		location    string
+		actionToken string
+	}{
+		{
+			name:       "Renders confirmation",
+			method:     http.MethodGet,
+			path:       "/links/approve-login?token=abc",
+			statusCode: http.StatusOK,
+			body:       `name="token" value="abc"`,
+		},
+		{
+			name:       "Renders brand",
+			method:     http.MethodGet,
+			path:       "/links/approve-login?token=abc",
+			options:    []ConfigOption{WithBrand(branding.Brand{Name: "Acme"})},
+			statusCode: http.StatusOK,
+			body:       "Approve login - Acme",
+		},
+		{
+			name:       "Renders support email",
+			method:     http.MethodGet,
+			path:       "/links/approve-login?token=abc",
+			options:    []ConfigOption{WithBrand(branding.Brand{SupportEmail: "help@acme.com"})},
+			statusCode: http.StatusOK,
+			body:       `<a href="mailto:help@acme.com">`,
+		},
+		{
+			name:       "Rejects missing token",
+			method:     http.MethodGet,
+			path:       "/links/approve-login",
+			statusCode: http.StatusBadRequest,
+			body:       "This link is invalid.",
+		},
+		{
+			name:       "Unknown action",
+			method:     http.MethodGet,
+			path:       "/links/delete-account?token=abc",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:        "Performs action",
+			method:      http.MethodPost,
+			path:        "/links/approve-login",
+			form:        url.Values{"token": {"abc"}},
+			statusCode:  http.StatusOK,
+			body:        "Your login is approved.",
+			actionToken: "abc",
+		},
+		{
+			name:        "Renders domain error",
+			method:      http.MethodPost,
+			path:        "/links/approve-login",
+			form:        url.Values{"token": {"abc"}},
+			actionErr:   auth.ErrBadRequest("login approval is expired"),
+			statusCode:  http.StatusBadRequest,
+			body:        "login approval is expired",
+			actionToken: "abc",
+		},
+		{
+			name:        "Hides internal error",
+			method:      http.MethodPost,
+			path:        "/links/approve-login",
+			form:        url.Values{"token": {"abc"}},
+			actionErr:   fmt.Errorf("redis is down"),
+			statusCode:  http.StatusBadRequest,
+			body:        "Something went wrong",
+			actionToken: "abc",
+		},
+		{
+			name:        "Redirects on success",
+			method:      http.MethodPost,
+			path:        "/links/approve-login",
+			form:        url.Values{"token": {"abc"}},
+			options:     []ConfigOption{WithRedirects("https://example.com/done?lang=en", "")},
+			statusCode:  http.StatusSeeOther,
+			location:    "https://example.com/done?action=approve-login&lang=en",
+			actionToken: "abc",
+		},
+		{
+			name:        "Redirects on failure",
+			method:      http.MethodPost,
+			path:        "/links/approve-login",
+			form:        url.Values{"token": {"abc"}},
+			options:     []ConfigOption{WithRedirects("", "https://example.com/failed")},
+			actionErr:   auth.ErrBadRequest("login approval is expired"),
+			statusCode:  http.StatusSeeOther,
+			location:    "https://example.com/failed?action=approve-login&error=bad_request",
+			actionToken: "abc",
+		},
+		{
+			name:       "Rejects other methods",
+			method:     http.MethodDelete,
+			path:       "/links/approve-login",
+			statusCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var actionToken string
+			approve := func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+				var req struct {
+					Token string `json:"token"`
+				}
+				if err := httpapi.DecodeJSON(r, &req); err != nil {
+					t.Fatal("failed to decode action request:", err)
+				}
+				actionToken = req.Token
+				return nil, tc.actionErr
+			}
+
+			options := append([]ConfigOption{WithAction(ApproveLogin(approve))}, tc.options...)
+			h, err := NewHandler(options...)
+			if err != nil {
+				t.Fatal("failed to create handler:", err)
+			}
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.form.Encode()))
+			if tc.form != nil {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tc.body) {
+				t.Errorf("expected body to contain %q, got %s", tc.body, rr.Body.String())
+			}
+			if got := rr.Header().Get("Location"); got != tc.location {
+				t.Errorf("incorrect redirect, want %q got %q", tc.location, got)
+			}
+			if actionToken != tc.actionToken {
+				t.Errorf("incorrect action token, want %q got %q", tc.actionToken, actionToken)
+			}
+		})
+	}
+}
+
+func TestLinkPages_TemplateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "linkpages")
+	if err != nil {
+		t.Fatal("failed to create temp dir:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "page.html")
+	content := `<h1>{{.Brand.Name}}: {{.Title}}</h1>{{if .Token}}<input value="{{.Token}}">{{end}}`
+	if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal("failed to write template:", err)
+	}
+
+	noop := func(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	h, err := NewHandler(
+		WithAction(CancelRecovery(noop)),
+		WithBrand(branding.Brand{Name: "Acme", SupportEmail: "help@acme.com"}),
+		WithTemplateFile(path),
+	)
+	if err != nil {
+		t.Fatal("failed to create handler:", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/links/cancel-recovery?token=%3Cscript%3E", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	want := `<h1>Acme: Cancel account recovery</h1><input value="&lt;script&gt;">`
+	if rr.Body.String() != want {
+		t.Errorf("incorrect page, want %s got %s", want, rr.Body.String())
+	}
+
+	if err = ioutil.WriteFile(path, []byte("{{.Title"), 0600); err != nil {
+		t.Fatal("failed to write template:", err)
+	}
+	if _, err = NewHandler(WithTemplateFile(path)); err == nil {
+		t.Error("expected invalid template to be rejected")
+	}
+}
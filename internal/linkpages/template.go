@@ -0,0 +1,40 @@
+package linkpages
+
+import "html/template"
+
+// defaultTemplate renders landing pages when no template file is
+// configured. It is self contained so pages render without any
+// further assets.
+var defaultTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="referrer" content="no-referrer">
+<title>{{.Title}} - {{.Brand.Name}}</title>
+<style>
+  body { margin: 0; font-family: system-ui, -apple-system, "Segoe UI", Roboto, sans-serif; background: #f5f5f5; color: #222; }
+  main { max-width: 28rem; margin: 3rem auto; padding: 2rem; background: #fff; border-radius: 0.5rem; text-align: center; }
+  img { max-height: 3rem; margin-bottom: 1rem; }
+  button { font: inherit; padding: 0.75rem 1.5rem; border: 0; border-radius: 0.25rem; color: #fff; background: {{.Brand.Color}}; cursor: pointer; }
+  a { color: {{.Brand.Color}}; }
+  .support { margin-top: 2rem; font-size: 0.85rem; color: #666; }
+  .failure h1 { color: #b3261e; }
+</style>
+</head>
+<body>
+<main class="{{.Status}}">
+  {{if .Brand.LogoURL}}<img src="{{.Brand.LogoURL}}" alt="{{.Brand.Name}}">{{else}}<p><strong>{{.Brand.Name}}</strong></p>{{end}}
+  <h1>{{.Title}}</h1>
+  <p>{{.Message}}</p>
+  {{if .Token}}
+  <form method="post">
+    <input type="hidden" name="token" value="{{.Token}}">
+    <button type="submit">{{.Button}}</button>
+  </form>
+  {{end}}
+  {{if .Brand.SupportEmail}}<p class="support">Need help? Contact <a href="mailto:{{.Brand.SupportEmail}}">{{.Brand.SupportEmail}}</a></p>{{end}}
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,69 @@
+// Package locale resolves the languages a client prefers messages to
+// be sent in.
+package locale
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/text/language"
+)
+
+type contextKey string
+
+const localeContextKey contextKey = "locale"
+
+// FromRequest returns the languages preferred by the client making a
+// request, most preferred first, from its Accept-Language header.
+func FromRequest(r *http.Request) []string {
+	tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if err != nil {
+		return nil
+	}
+
+	preferences := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		preferences = append(preferences, tag.String())
+	}
+	return preferences
+}
+
+// NewContext returns a context carrying a client's preferred languages.
+func NewContext(ctx context.Context, preferences []string) context.Context {
+	return context.WithValue(ctx, localeContextKey, preferences)
+}
+
+// FromContext returns the preferred languages in context.
+func FromContext(ctx context.Context) []string {
+	preferences, _ := ctx.Value(localeContextKey).([]string)
+	return preferences
+}
+
+// Parse parses a language tag in its canonical form, e.g. `pt-BR`.
+func Parse(s string) (string, error) {
+	tag, err := language.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return tag.String(), nil
+}
+
+// Match returns the first preferred language which is supported.
+// Languages with a region fall back to their base language, e.g.
+// `pt-BR` matches `pt`. It is empty if none are supported.
+func Match(preferences []string, supported func(locale string) bool) string {
+	for _, preference := range preferences {
+		if supported(preference) {
+			return preference
+		}
+
+		tag, err := language.Parse(preference)
+		if err != nil {
+			continue
+		}
+		if base, confidence := tag.Base(); confidence != language.No && supported(base.String()) {
+			return base.String()
+		}
+	}
+	return ""
+}
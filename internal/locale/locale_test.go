@@ -0,0 +1,90 @@
+package locale
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLocale_FromRequest(t *testing.T) {
+	tt := []struct {
+		name        string
+		header      string
+		preferences []string
+	}{
+		{
+			name:        "No header",
+			preferences: []string{},
+		},
+		{
+			name:        "Orders by quality",
+			header:      "en;q=0.5, pt-br, es;q=0.8",
+			preferences: []string{"pt-BR", "es", "en"},
+		},
+		{
+			name:   "Invalid header",
+			header: "en;q=x",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tc.header != "" {
+				r.Header.Set("Accept-Language", tc.header)
+			}
+
+			preferences := FromRequest(r)
+			if !cmp.Equal(preferences, tc.preferences) {
+				t.Error(cmp.Diff(preferences, tc.preferences))
+			}
+
+			ctx := NewContext(context.Background(), preferences)
+			if !cmp.Equal(FromContext(ctx), tc.preferences) {
+				t.Error(cmp.Diff(FromContext(ctx), tc.preferences))
+			}
+		})
+	}
+}
+
+func TestLocale_Match(t *testing.T) {
+	supported := func(locale string) bool {
+		return locale == "pt" || locale == "es-MX"
+	}
+
+	tt := []struct {
+		name        string
+		preferences []string
+		locale      string
+	}{
+		{
+			name:        "Exact match",
+			preferences: []string{"es-MX", "pt"},
+			locale:      "es-MX",
+		},
+		{
+			name:        "Falls back to base language",
+			preferences: []string{"pt-BR"},
+			locale:      "pt",
+		},
+		{
+			name:        "Skips unsupported languages",
+			preferences: []string{"fr", "es", "pt"},
+			locale:      "pt",
+		},
+		{
+			name:        "No match",
+			preferences: []string{"fr"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if locale := Match(tc.preferences, supported); locale != tc.locale {
+				t.Errorf("incorrect locale, want '%s' got '%s'", tc.locale, locale)
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package loginapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clientapp"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/token"
+)
+
+const (
+	// approvalPending is the status of a login awaiting approval.
+	approvalPending = "pending"
+	// approvalApproved is the status of an approved login which
+	// may be exchanged for an authorized token.
+	approvalApproved = "approved"
+	// approvalExpired is reported to subscribers once a login
+	// approval no longer exists.
+	approvalExpired = "expired"
+)
+
+// rediser is a minimal interface for go-redis.
+type rediser interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+}
+
+// approvalHub notifies subscribers on this instance when a login is
+// approved. Subscribers also poll storage to learn of approvals handled
+// by other instances.
+type approvalHub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+}
+
+func newApprovalHub() *approvalHub {
+	return &approvalHub{subs: make(map[string]map[chan struct{}]struct{})}
+}
+
+// subscribe returns a channel signalled when the login of a token
+// ID is approved and a function to unsubscribe.
+func (h *approvalHub) subscribe(tokenID string) (<-chan struct{}, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan struct{}, 1)
+	if h.subs[tokenID] == nil {
+		h.subs[tokenID] = make(map[chan struct{}]struct{})
+	}
+	h.subs[tokenID][ch] = struct{}{}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		delete(h.subs[tokenID], ch)
+		if len(h.subs[tokenID]) == 0 {
+			delete(h.subs, tokenID)
+		}
+	}
+}
+
+// notify signals every subscriber of a token ID.
+func (h *approvalHub) notify(tokenID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[tokenID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// RequestApproval delivers a link to approve a pending login to the
+// User's email address or phone. The login may be approved from another
+// device, after which it is exchanged for an authorized token through
+// VerifyApproval.
+func (s *service) RequestApproval(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+	preAuthToken := httpapi.GetToken(r)
+
+	if s.approvalURL == "" || s.db == nil {
+		return nil, auth.ErrForbidden("login approval is disabled")
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Approval links are delivered as OTP codes are and may not be
+	// used by Users who must complete 2FA with a TOTP app or device.
+	if !user.CanSendDefaultOTP() {
+		return nil, auth.ErrBadRequest("login approval is not available")
+	}
+
+	delivery := user.DefaultOTPDelivery()
+	if _, err = s.authorize(preAuthToken, otpOption(delivery)); err != nil {
+		return nil, err
+	}
+
+	address := user.Email.String
+	if delivery == auth.Phone {
+		address = user.Phone.String
+	}
+
+	approvalToken, err := s.actionTokens.Issue(ctx, user.ID, auth.PurposeApproveLogin, map[string]string{
+		"token_id": preAuthToken.Id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	expiresIn := time.Until(time.Unix(preAuthToken.ExpiresAt, 0))
+	if err = s.db.Set(ctx, ApprovalKey(preAuthToken.Id), approvalPending, expiresIn).Err(); err != nil {
+		return nil, fmt.Errorf("cannot store login approval: %w", err)
+	}
+
+	link, err := url.Parse(s.approvalURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid login approval URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", approvalToken)
+	link.RawQuery = query.Encode()
+
+	msg := &auth.Message{
+		Type:     auth.LoginApproval,
+		Delivery: delivery,
+		Address:  address,
+		Vars:     map[string]string{"link": link.String()},
+	}
+	if err = s.message.Send(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	return &approvalResponse{Status: approvalPending}, nil
+}
+
+// Approve approves a pending login with the token delivered by
+// RequestApproval. Subscribers to the login's approval events
+// are notified.
+func (s *service) Approve(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	if s.db == nil {
+		return nil, auth.ErrForbidden("login approval is disabled")
+	}
+
+	req, err := decodeApproveRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	approvalToken, err := s.actionTokens.Parse(ctx, req.Token, auth.PurposeApproveLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenID := approvalToken.Data["token_id"]
+	status, err := s.approvalStatus(ctx, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	if status != approvalPending {
+		return nil, auth.ErrBadRequest("login approval is expired")
+	}
+
+	if err = s.actionTokens.Redeem(ctx, approvalToken); err != nil {
+		return nil, err
+	}
+
+	expiresIn := time.Until(time.Unix(approvalToken.ExpiresAt, 0))
+	if err = s.db.Set(ctx, ApprovalKey(tokenID), approvalApproved, expiresIn).Err(); err != nil {
+		return nil, fmt.Errorf("cannot store login approval: %w", err)
+	}
+	s.approvals.notify(tokenID)
+
+	return &approvalResponse{Status: approvalApproved}, nil
+}
+
+// ApprovalEvents streams the approval status of the pending login as
+// server-sent events. The stream ends once the login is approved or the
+// approval expires. Streams are also closed after a configured duration
+// to stay within the server's write timeout, after which clients are
+// expected to reconnect.
+func (s *service) ApprovalEvents(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	preAuthToken := httpapi.GetToken(r)
+
+	if s.db == nil {
+		return nil, auth.ErrForbidden("login approval is disabled")
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("response does not support streaming")
+	}
+
+	notify, unsubscribe := s.approvals.subscribe(preAuthToken.Id)
+	defer unsubscribe()
+
+	status, err := s.approvalStatus(ctx, preAuthToken.Id)
+	if err != nil {
+		return nil, err
+	}
+	if status == "" {
+		return nil, auth.ErrBadRequest("login approval was not requested")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", s.approvalPollInterval.Milliseconds())
+
+	poll := time.NewTicker(s.approvalPollInterval)
+	defer poll.Stop()
+	deadline := time.NewTimer(s.approvalStreamDuration)
+	defer deadline.Stop()
+
+	lastStatus := ""
+	for {
+		if status == "" {
+			status = approvalExpired
+		}
+		if status != lastStatus {
+			fmt.Fprintf(w, "event: %s\ndata: {\"status\":%q}\n\n", status, status)
+			flusher.Flush()
+			lastStatus = status
+		}
+		if status != approvalPending {
+			return nil, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-deadline.C:
+			return nil, nil
+		case <-notify:
+		case <-poll.C:
+		}
+
+		if status, err = s.approvalStatus(ctx, preAuthToken.Id); err != nil {
+			level.Error(s.logger).Log(
+				"source", "LoginAPI.ApprovalEvents",
+				"message", "failed to check login approval",
+				"error", err,
+			)
+			return nil, nil
+		}
+	}
+}
+
+// VerifyApproval exchanges an approved login for an authorized token.
+// An approval may only be exchanged once.
+func (s *service) VerifyApproval(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+	preAuthToken := httpapi.GetToken(r)
+
+	if s.db == nil {
+		return nil, auth.ErrForbidden("login approval is disabled")
+	}
+
+	if app := clientapp.FromContext(ctx); app != nil && !app.AllowsTFA(auth.OTPEmail) {
+		return nil, auth.ErrForbidden("client application requires stronger two-factor authentication")
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Approval links are delivered as OTP codes are.
+	factors, err := s.authorize(preAuthToken, otpOption(user.DefaultOTPDelivery()))
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := s.approvalStatus(ctx, preAuthToken.Id)
+	if err != nil {
+		return nil, err
+	}
+	if status != approvalApproved {
+		return nil, auth.ErrBadRequest("login is not approved")
+	}
+
+	removed, err := s.db.Del(ctx, ApprovalKey(preAuthToken.Id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot remove login approval: %w", err)
+	}
+	if removed == 0 {
+		return nil, auth.ErrBadRequest("login is not approved")
+	}
+
+	jwtToken, err := s.token.Create(
+		ctx,
+		user,
+		auth.JWTAuthorized,
+		token.WithAudiences(preAuthToken.Audiences...),
+		token.WithScopes(preAuthToken.Scopes...),
+		token.WithTTL(time.Duration(preAuthToken.TTL)*time.Second),
+		token.WithDeviceBinding(httpapi.GetDeviceID(r)),
+		token.WithAuthMethods(factors...),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	loginHistory := &auth.LoginHistory{
+		UserID:    userID,
+		TokenID:   jwtToken.Id,
+		ExpiresAt: s.token.RefreshableTill(ctx, jwtToken, jwtToken.RefreshToken),
+	}
+	httpapi.SetLoginOrigin(loginHistory, r)
+	if err = s.repoMngr.LoginHistory().Create(ctx, loginHistory); err != nil {
+		return nil, err
+	}
+
+	return s.respond(ctx, w, user, jwtToken)
+}
+
+// approvalStatus returns the approval status of the login of a token
+// ID. An empty status is returned if approval was never requested or
+// has expired.
+func (s *service) approvalStatus(ctx context.Context, tokenID string) (string, error) {
+	status, err := s.db.Get(ctx, ApprovalKey(tokenID)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot check login approval: %w", err)
+	}
+	return status, nil
+}
+
+// ApprovalKey is the key holding the approval status of the
+// login of a pre-authorized token ID.
+func ApprovalKey(tokenID string) string {
+	return fmt.Sprintf("%s_login_approval", tokenID)
+}
@@ -1,15 +1,35 @@
 package loginapi
 
 import (
+	"time"
+
 	"github.com/go-kit/kit/log"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/anomaly"
+	"github.com/fmitra/authenticator/internal/attestation"
+	"github.com/fmitra/authenticator/internal/canary"
+)
+
+const (
+	defaultApprovalPollInterval = time.Second
+	// defaultApprovalStreamDuration closes approval event streams
+	// before the API server's default 10 second write timeout.
+	defaultApprovalStreamDuration = time.Second * 8
 )
 
 // NewService returns a new implementation of auth.LoginAPI.
 func NewService(options ...ConfigOption) auth.LoginAPI {
 	s := service{
-		logger: log.NewNopLogger(),
+		logger:      log.NewNopLogger(),
+		attestation: attestation.NewService(),
+		anomaly:     anomaly.NewService(),
+		canary:      canary.NewService(),
+		hooks:       auth.NopHooks{},
+
+		approvals:              newApprovalHub(),
+		approvalPollInterval:   defaultApprovalPollInterval,
+		approvalStreamDuration: defaultApprovalStreamDuration,
 	}
 
 	for _, opt := range options {
@@ -70,3 +90,107 @@ func WithPassword(p auth.PasswordService) ConfigOption {
 		s.password = p
 	}
 }
+
+// WithAttestation configures the service with an AttestationService
+// to verify mobile clients before issuing tokens.
+func WithAttestation(a auth.AttestationService) ConfigOption {
+	return func(s *service) {
+		s.attestation = a
+	}
+}
+
+// WithAnomalyDetector configures the service with an AnomalyDetector
+// to record failed logins and mitigate credential stuffing.
+func WithAnomalyDetector(a auth.AnomalyDetector) ConfigOption {
+	return func(s *service) {
+		s.anomaly = a
+	}
+}
+
+// WithCaptchaSiteKey configures the public site key clients render
+// a CAPTCHA with when a login is challenged.
+func WithCaptchaSiteKey(key string) ConfigOption {
+	return func(s *service) {
+		s.captchaSiteKey = key
+	}
+}
+
+// WithCanary configures the service with a CanaryService
+// to alert operators of login attempts against decoy accounts.
+func WithCanary(c auth.CanaryService) ConfigOption {
+	return func(s *service) {
+		s.canary = c
+	}
+}
+
+// WithExternalUsers configures the service to verify credentials
+// against an external user database.
+func WithExternalUsers(p auth.ExternalUserProvider) ConfigOption {
+	return func(s *service) {
+		s.external = p
+	}
+}
+
+// WithPolicy configures the combinations of factors which authorize
+// a login.
+func WithPolicy(p Policy) ConfigOption {
+	return func(s *service) {
+		s.policy = p
+	}
+}
+
+// WithDB configures the service with a Redis DB to track
+// login approvals.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithActionTokens configures the service with an ActionTokenService
+// to issue login approval tokens.
+func WithActionTokens(t auth.ActionTokenService) ConfigOption {
+	return func(s *service) {
+		s.actionTokens = t
+	}
+}
+
+// WithApprovalURL configures the URL delivered to Users to approve a
+// login from another device. The approval token is appended as the
+// token query parameter. Login approval is disabled without a URL.
+func WithApprovalURL(u string) ConfigOption {
+	return func(s *service) {
+		s.approvalURL = u
+	}
+}
+
+// WithApprovalStream configures how often login approval event streams
+// check for approvals handled by other instances and how long a stream
+// remains open before the client must reconnect.
+func WithApprovalStream(pollInterval, duration time.Duration) ConfigOption {
+	return func(s *service) {
+		s.approvalPollInterval = pollInterval
+		s.approvalStreamDuration = duration
+	}
+}
+
+// WithLockout configures the service to lock an account for a duration
+// once a maximum number of failed passwords is reached within a window.
+// Locked Users may unlock their account early with a code delivered to
+// a verified contact. Lockout is disabled if maxFailures is 0 and
+// requires a DB configured with WithDB.
+func WithLockout(maxFailures int64, window, duration time.Duration) ConfigOption {
+	return func(s *service) {
+		s.lockoutMaxFailures = maxFailures
+		s.lockoutWindow = window
+		s.lockoutDuration = duration
+	}
+}
+
+// WithHooks configures the service with Hooks run once a login
+// is complete.
+func WithHooks(h auth.Hooks) ConfigOption {
+	return func(s *service) {
+		s.hooks = h
+	}
+}
@@ -15,7 +15,7 @@ import (
 func SetupHTTPHandler(svc auth.LoginAPI, router *mux.Router, tokenSvc auth.TokenService, logger log.Logger, lmt httpapi.LimiterFactory) {
 	var handler httpapi.JSONAPIHandler
 	{
-		handler = svc.Login
+		handler = httpapi.PolicyMiddleware(svc.Login, tokenSvc, httpapi.PublicPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"LoginAPI.Login", httpapi.PerMinute, int64(10),
 		))
@@ -24,7 +24,7 @@ func SetupHTTPHandler(svc auth.LoginAPI, router *mux.Router, tokenSvc auth.Token
 		router.HandleFunc("/api/v1/login", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.DeviceChallenge, tokenSvc, auth.JWTPreAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.DeviceChallenge, tokenSvc, httpapi.PreAuthorizedPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"LoginAPI.DeviceChallenge", httpapi.PerMinute, int64(20),
 		))
@@ -33,7 +33,7 @@ func SetupHTTPHandler(svc auth.LoginAPI, router *mux.Router, tokenSvc auth.Token
 		router.HandleFunc("/api/v1/login/verify-device", httpHandler).Methods("Get")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.VerifyDevice, tokenSvc, auth.JWTPreAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.VerifyDevice, tokenSvc, httpapi.PreAuthorizedPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"LoginAPI.VerifyDevice", httpapi.PerMinute, int64(20),
 		))
@@ -42,7 +42,7 @@ func SetupHTTPHandler(svc auth.LoginAPI, router *mux.Router, tokenSvc auth.Token
 		router.HandleFunc("/api/v1/login/verify-device", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.VerifyCode, tokenSvc, auth.JWTPreAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.VerifyCode, tokenSvc, httpapi.PreAuthorizedPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"LoginAPI.VerifyCode", httpapi.PerMinute, int64(10),
 		))
@@ -50,4 +50,94 @@ func SetupHTTPHandler(svc auth.LoginAPI, router *mux.Router, tokenSvc auth.Token
 		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
 		router.HandleFunc("/api/v1/login/verify-code", httpHandler).Methods("Post")
 	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.RequestApproval, tokenSvc, httpapi.PreAuthorizedPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"LoginAPI.RequestApproval", httpapi.PerMinute, int64(5),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/login/approval", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.ApprovalEvents, tokenSvc, httpapi.PreAuthorizedPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"LoginAPI.ApprovalEvents", httpapi.PerMinute, int64(20),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToStreamHandlerFunc(handler)
+		router.HandleFunc("/api/v1/login/approval/events", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.Approve, tokenSvc, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"LoginAPI.Approve", httpapi.PerMinute, int64(10),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/login/approve", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.VerifyApproval, tokenSvc, httpapi.PreAuthorizedPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"LoginAPI.VerifyApproval", httpapi.PerMinute, int64(10),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/login/verify-approval", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.PasskeyChallenge, tokenSvc, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"LoginAPI.PasskeyChallenge", httpapi.PerMinute, int64(20),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/login/passkey", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.Challenge, tokenSvc, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"LoginAPI.Challenge", httpapi.PerMinute, int64(20),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/login/challenge", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.RequestUnlock, tokenSvc, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"LoginAPI.RequestUnlock", httpapi.PerMinute, int64(5),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusAccepted)
+		router.HandleFunc("/api/v1/login/unlock", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.Unlock, tokenSvc, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"LoginAPI.Unlock", httpapi.PerMinute, int64(10),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/login/unlock/verify", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.ResetPassword, tokenSvc, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"LoginAPI.ResetPassword", httpapi.PerMinute, int64(10),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/login/password-reset", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.VerifyPasskey, tokenSvc, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"LoginAPI.VerifyPasskey", httpapi.PerMinute, int64(10),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/login/passkey", httpHandler).Methods("Post")
+	}
 }
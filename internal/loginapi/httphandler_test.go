@@ -1,12 +1,14 @@
 package loginapi
 
 import (
+	"bufio"
 	"bytes"
 	"database/sql"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,7 +16,9 @@ import (
 	"github.com/gorilla/mux"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clientapp"
 	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/memstore"
 	"github.com/fmitra/authenticator/internal/otp"
 	"github.com/fmitra/authenticator/internal/password"
 	"github.com/fmitra/authenticator/internal/test"
@@ -32,7 +36,58 @@ func TestLoginAPI_Login(t *testing.T) {
 		userFn         func() (*auth.User, error)
 		tokenCreateFn  func() (*auth.Token, error)
 		tokenSignFn    func() (string, error)
+		attestationFn  func() error
+		canaryFn       func() (bool, error)
+		clientApp      *auth.ClientApplication
+		failureCalls   int
 	}{
+		{
+			name:       "Device attestation failure",
+			statusCode: http.StatusForbidden,
+			reqBody: []byte(`{
+				"type": "email",
+				"password": "swordfish",
+				"identity": "jane@example.com"
+			}`),
+			messagingCalls: 0,
+			errMessage:     "Device attestation failed",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{Password: validPassword}, nil
+			},
+			tokenCreateFn: func() (*auth.Token, error) {
+				return &auth.Token{Code: "123456"}, nil
+			},
+			tokenSignFn: func() (string, error) {
+				return "jwt-token", nil
+			},
+			attestationFn: func() error {
+				return auth.ErrForbidden("device attestation failed")
+			},
+		},
+		{
+			name:       "Canary identity failure",
+			statusCode: http.StatusBadRequest,
+			reqBody: []byte(`{
+				"type": "email",
+				"password": "swordfish",
+				"identity": "decoy@example.com"
+			}`),
+			messagingCalls: 0,
+			failureCalls:   1,
+			errMessage:     "Invalid username or password",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{Password: validPassword}, nil
+			},
+			tokenCreateFn: func() (*auth.Token, error) {
+				return &auth.Token{Code: "123456"}, nil
+			},
+			tokenSignFn: func() (string, error) {
+				return "jwt-token", nil
+			},
+			canaryFn: func() (bool, error) {
+				return true, nil
+			},
+		},
 		{
 			name:       "Non existent user failure",
 			statusCode: http.StatusBadRequest,
@@ -42,6 +97,7 @@ func TestLoginAPI_Login(t *testing.T) {
 				"identity": "jane@example.com"
 			}`),
 			messagingCalls: 0,
+			failureCalls:   1,
 			errMessage:     "Invalid username or password",
 			userFn: func() (*auth.User, error) {
 				return nil, sql.ErrNoRows
@@ -62,6 +118,7 @@ func TestLoginAPI_Login(t *testing.T) {
 				"identity": "jane@example.com"
 			}`),
 			messagingCalls: 0,
+			failureCalls:   1,
 			errMessage:     "Invalid username or password",
 			userFn: func() (*auth.User, error) {
 				return &auth.User{Password: validPassword}, nil
@@ -140,6 +197,80 @@ func TestLoginAPI_Login(t *testing.T) {
 				return "jwt-token", nil
 			},
 		},
+		{
+			name:       "Passwordless user with password",
+			statusCode: http.StatusBadRequest,
+			reqBody: []byte(`{
+				"type": "email",
+				"password": "swordfish",
+				"identity": "jane@example.com"
+			}`),
+			messagingCalls: 0,
+			errMessage:     "Invalid username or password",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{Password: ""}, nil
+			},
+			tokenCreateFn: func() (*auth.Token, error) {
+				return &auth.Token{Code: "123456"}, nil
+			},
+			tokenSignFn: func() (string, error) {
+				return "jwt-token", nil
+			},
+			failureCalls: 1,
+		},
+		{
+			name:       "Passwordless user",
+			statusCode: http.StatusOK,
+			reqBody: []byte(`{
+				"type": "email",
+				"identity": "jane@example.com"
+			}`),
+			messagingCalls: 1,
+			userFn: func() (*auth.User, error) {
+				return &auth.User{
+					Email: sql.NullString{
+						String: "jane@example.com",
+						Valid:  true,
+					},
+				}, nil
+			},
+			tokenCreateFn: func() (*auth.Token, error) {
+				return &auth.Token{
+					CodeHash: test.MockTokenHash("", "", time.Now().Add(time.Minute*5).Unix()),
+					State:    auth.JWTPreAuthorized,
+					Code:     test.OTPCode,
+				}, nil
+			},
+			tokenSignFn: func() (string, error) {
+				return "jwt-token", nil
+			},
+		},
+		{
+			name:       "Repeated request reusing delivered code",
+			statusCode: http.StatusOK,
+			reqBody: []byte(`{
+				"type": "email",
+				"identity": "jane@example.com"
+			}`),
+			messagingCalls: 0,
+			userFn: func() (*auth.User, error) {
+				return &auth.User{
+					Email: sql.NullString{
+						String: "jane@example.com",
+						Valid:  true,
+					},
+				}, nil
+			},
+			tokenCreateFn: func() (*auth.Token, error) {
+				return &auth.Token{
+					CodeHash: test.MockTokenHash("", "", time.Now().Add(time.Minute*5).Unix()),
+					State:    auth.JWTPreAuthorized,
+				}, nil
+			},
+			tokenSignFn: func() (string, error) {
+				return "jwt-token", nil
+			},
+		},
 		{
 			name:       "Successful request",
 			statusCode: http.StatusOK,
@@ -170,6 +301,47 @@ func TestLoginAPI_Login(t *testing.T) {
 				return "jwt-token", nil
 			},
 		},
+		{
+			name:       "Client application requires stronger 2FA",
+			statusCode: http.StatusForbidden,
+			reqBody: []byte(`{
+				"type": "email",
+				"password": "swordfish",
+				"identity": "jane@example.com"
+			}`),
+			errMessage: "Client application requires stronger two-factor authentication",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{
+					Password:          validPassword,
+					IsEmailOTPAllowed: true,
+					Email: sql.NullString{
+						String: "jane@example.com",
+						Valid:  true,
+					},
+				}, nil
+			},
+			clientApp: &auth.ClientApplication{ID: "admin", RequiredTFA: auth.TFALevelDevice},
+		},
+		{
+			name:       "Expired password",
+			statusCode: http.StatusForbidden,
+			reqBody: []byte(`{
+				"type": "email",
+				"password": "swordfish",
+				"identity": "jane@example.com"
+			}`),
+			errMessage: "Password has expired and must be reset",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{
+					Password:          validPassword,
+					IsPasswordExpired: true,
+					Email: sql.NullString{
+						String: "jane@example.com",
+						Valid:  true,
+					},
+				}, nil
+			},
+		},
 	}
 
 	for _, tc := range tt {
@@ -189,12 +361,22 @@ func TestLoginAPI_Login(t *testing.T) {
 			}
 			messagingSvc := &test.MessagingService{}
 			passwordSvc := password.NewPassword()
+			attestationSvc := &test.AttestationService{
+				VerifyFn: tc.attestationFn,
+			}
+			anomalySvc := &test.AnomalyDetector{}
+			canarySvc := &test.CanaryService{
+				TripFn: tc.canaryFn,
+			}
 			svc := NewService(
 				WithLogger(&test.Logger{}),
 				WithTokenService(tokenSvc),
 				WithRepoManager(repoMngr),
 				WithMessaging(messagingSvc),
 				WithPassword(passwordSvc),
+				WithAttestation(attestationSvc),
+				WithAnomalyDetector(anomalySvc),
+				WithCanary(canarySvc),
 			)
 
 			req, err := http.NewRequest(
@@ -205,6 +387,9 @@ func TestLoginAPI_Login(t *testing.T) {
 			if err != nil {
 				t.Fatal("failed to create request:", err)
 			}
+			if tc.clientApp != nil {
+				req = req.WithContext(clientapp.NewContext(req.Context(), tc.clientApp))
+			}
 
 			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
 			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
@@ -222,6 +407,234 @@ func TestLoginAPI_Login(t *testing.T) {
 					tc.messagingCalls, messagingSvc.Calls.Send)
 			}
 
+			if anomalySvc.Calls.RecordFailure != tc.failureCalls {
+				t.Errorf("incorrect AnomalyDetector.RecordFailure() call count, want %v got %v",
+					tc.failureCalls, anomalySvc.Calls.RecordFailure)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestLoginAPI_LoginRehash(t *testing.T) {
+	validPassword := "$2a$10$zURdae3ekOWKobmadhWdROZLolGAIWrCEzjSfegV6Y/nsxJ1wqM2y" // nolint
+
+	tt := []struct {
+		name        string
+		origin      string
+		passwordSvc auth.PasswordService
+		rehashCalls int
+	}{
+		{
+			name:        "Rehashes password of API client",
+			passwordSvc: password.NewPassword(password.WithCost(10), password.WithAPICost(4)),
+			rehashCalls: 1,
+		},
+		{
+			name:        "Keeps password of interactive client",
+			origin:      "https://app.example.com",
+			passwordSvc: password.NewPassword(password.WithCost(10), password.WithAPICost(4)),
+		},
+		{
+			name:        "Rehashes password below interactive cost",
+			origin:      "https://app.example.com",
+			passwordSvc: password.NewPassword(password.WithCost(11)),
+			rehashCalls: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			userRepo := &test.UserRepository{
+				ByIdentityFn: func() (*auth.User, error) {
+					return &auth.User{ID: "user-id", Password: validPassword}, nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return userRepo
+				},
+				WithAtomicFn: func() (interface{}, error) {
+					return nil, nil
+				},
+			}
+			tokenSvc := &test.TokenService{
+				CreateFn: func() (*auth.Token, error) {
+					return &auth.Token{State: auth.JWTPreAuthorized}, nil
+				},
+				SignFn: func() (string, error) {
+					return "jwt-token", nil
+				},
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithTokenService(tokenSvc),
+				WithRepoManager(repoMngr),
+				WithMessaging(&test.MessagingService{}),
+				WithPassword(tc.passwordSvc),
+				WithAttestation(&test.AttestationService{}),
+				WithAnomalyDetector(&test.AnomalyDetector{}),
+				WithCanary(&test.CanaryService{}),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/login", bytes.NewBufferString(`{
+				"type": "email",
+				"password": "swordfish",
+				"identity": "jane@example.com"
+			}`))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+			}
+			if repoMngr.Calls.WithAtomic != tc.rehashCalls {
+				t.Errorf("incorrect password rehash count, want %v got %v",
+					tc.rehashCalls, repoMngr.Calls.WithAtomic)
+			}
+		})
+	}
+}
+
+func TestLoginAPI_LoginExternal(t *testing.T) {
+	tt := []struct {
+		name           string
+		statusCode     int
+		errMessage     string
+		authenticateFn func() (*auth.ExternalUser, error)
+		accountFn      func() (*auth.ExternalAccount, error)
+		failureCalls   int
+		atomicCalls    int
+	}{
+		{
+			name:       "Invalid credentials",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Invalid username or password",
+			authenticateFn: func() (*auth.ExternalUser, error) {
+				return nil, auth.ErrBadRequest("incorrect password")
+			},
+			failureCalls: 1,
+		},
+		{
+			name:       "External database failure",
+			statusCode: http.StatusInternalServerError,
+			authenticateFn: func() (*auth.ExternalUser, error) {
+				return nil, fmt.Errorf("connection refused")
+			},
+		},
+		{
+			name:       "Linked user",
+			statusCode: http.StatusOK,
+			authenticateFn: func() (*auth.ExternalUser, error) {
+				return &auth.ExternalUser{ID: "42", Email: "jane@example.com"}, nil
+			},
+			accountFn: func() (*auth.ExternalAccount, error) {
+				return &auth.ExternalAccount{ExternalID: "42", UserID: "user-id"}, nil
+			},
+		},
+		{
+			name:       "Provisions user on first login",
+			statusCode: http.StatusOK,
+			authenticateFn: func() (*auth.ExternalUser, error) {
+				return &auth.ExternalUser{ID: "42", Email: "jane@example.com"}, nil
+			},
+			accountFn: func() (*auth.ExternalAccount, error) {
+				return nil, sql.ErrNoRows
+			},
+			atomicCalls: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			accountRepo := &test.ExternalAccountRepository{
+				ByExternalIDFn: tc.accountFn,
+			}
+			repoMngr := &test.RepositoryManager{
+				ExternalAccountFn: func() auth.ExternalAccountRepository {
+					return accountRepo
+				},
+				WithAtomicFn: func() (interface{}, error) {
+					return &auth.ExternalAccount{}, nil
+				},
+			}
+			repoMngr.NewWithTransactionFn = func() (auth.RepositoryManager, error) {
+				return repoMngr, nil
+			}
+			tokenSvc := &test.TokenService{
+				CreateFn: func() (*auth.Token, error) {
+					return &auth.Token{State: auth.JWTPreAuthorized}, nil
+				},
+				SignFn: func() (string, error) {
+					return "jwt-token", nil
+				},
+			}
+			anomalySvc := &test.AnomalyDetector{}
+			externalSvc := &test.ExternalUserProvider{
+				AuthenticateFn: tc.authenticateFn,
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithTokenService(tokenSvc),
+				WithRepoManager(repoMngr),
+				WithMessaging(&test.MessagingService{}),
+				WithPassword(password.NewPassword()),
+				WithAttestation(&test.AttestationService{}),
+				WithAnomalyDetector(anomalySvc),
+				WithCanary(&test.CanaryService{}),
+				WithExternalUsers(externalSvc),
+			)
+
+			req, err := http.NewRequest(
+				"POST",
+				"/api/v1/login",
+				bytes.NewBuffer([]byte(`{
+					"type": "email",
+					"password": "swordfish",
+					"identity": "jane@example.com"
+				}`)),
+			)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if anomalySvc.Calls.RecordFailure != tc.failureCalls {
+				t.Errorf("incorrect AnomalyDetector.RecordFailure() call count, want %v got %v",
+					tc.failureCalls, anomalySvc.Calls.RecordFailure)
+			}
+
+			if repoMngr.Calls.WithAtomic != tc.atomicCalls {
+				t.Errorf("incorrect RepositoryManager.WithAtomic() call count, want %v got %v",
+					tc.atomicCalls, repoMngr.Calls.WithAtomic)
+			}
+
 			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
 			if err != nil {
 				t.Error(err)
@@ -568,8 +981,277 @@ func TestLoginAPI_VerifyDevice(t *testing.T) {
 				t.Fatal("failed to create request:", err)
 			}
 
-			test.SetAuthHeaders(req)
-
+			test.SetAuthHeaders(req)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if messagingSvc.Calls.Send != tc.messagingCalls {
+				t.Errorf("incorrect MessagingService.Send() call count, want %v got %v",
+					tc.messagingCalls, messagingSvc.Calls.Send)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestLoginAPI_PasskeyChallenge(t *testing.T) {
+	tt := []struct {
+		name       string
+		statusCode int
+		errMessage string
+		webauthnFn func() ([]byte, error)
+	}{
+		{
+			name:       "Webauthn failure",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Cannot create challenge",
+			webauthnFn: func() ([]byte, error) {
+				return nil, auth.ErrBadRequest("cannot create challenge")
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			errMessage: "",
+			webauthnFn: func() ([]byte, error) {
+				return []byte(""), nil
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			tokenSvc := &test.TokenService{}
+			webauthnSvc := &test.WebAuthnService{
+				BeginDiscoverableLoginFn: tc.webauthnFn,
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithTokenService(tokenSvc),
+				WithRepoManager(&test.RepositoryManager{}),
+				WithWebAuthn(webauthnSvc),
+			)
+
+			req, err := http.NewRequest("GET", "/api/v1/login/passkey", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestLoginAPI_Challenge(t *testing.T) {
+	tt := []struct {
+		name        string
+		statusCode  int
+		errMessage  string
+		challengeFn func() (bool, error)
+		body        string
+	}{
+		{
+			name:       "Anomaly detector failure",
+			statusCode: http.StatusInternalServerError,
+			errMessage: "An internal error occurred",
+			challengeFn: func() (bool, error) {
+				return false, fmt.Errorf("whoops")
+			},
+		},
+		{
+			name:       "No challenge required",
+			statusCode: http.StatusOK,
+			challengeFn: func() (bool, error) {
+				return false, nil
+			},
+			body: `{"required":false}`,
+		},
+		{
+			name:       "Challenge required",
+			statusCode: http.StatusOK,
+			challengeFn: func() (bool, error) {
+				return true, nil
+			},
+			body: `{"required":true,"type":"captcha","siteKey":"site-key"}`,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			tokenSvc := &test.TokenService{}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithTokenService(tokenSvc),
+				WithRepoManager(&test.RepositoryManager{}),
+				WithAnomalyDetector(&test.AnomalyDetector{ChallengeFn: tc.challengeFn}),
+				WithCaptchaSiteKey("site-key"),
+			)
+
+			req, err := http.NewRequest("GET", "/api/v1/login/challenge", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if tc.body != "" && strings.TrimSpace(rr.Body.String()) != tc.body {
+				t.Errorf("incorrect response, want %s got %s", tc.body, rr.Body.String())
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestLoginAPI_VerifyPasskey(t *testing.T) {
+	tt := []struct {
+		name              string
+		statusCode        int
+		errMessage        string
+		webauthnFn        func() (*auth.User, error)
+		loginHistoryFn    func() error
+		loginHistoryCalls int
+		policy            Policy
+	}{
+		{
+			name:       "Webauthn login failure",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Credential is not registered",
+			webauthnFn: func() (*auth.User, error) {
+				return nil, auth.ErrWebAuthn("credential is not registered")
+			},
+			loginHistoryFn: func() error {
+				return nil
+			},
+		},
+		{
+			name:       "Login history persisted failure",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Cannot save login",
+			webauthnFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id"}, nil
+			},
+			loginHistoryFn: func() error {
+				return auth.ErrBadRequest("cannot save login")
+			},
+			loginHistoryCalls: 1,
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			errMessage: "",
+			webauthnFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id"}, nil
+			},
+			loginHistoryFn: func() error {
+				return nil
+			},
+			loginHistoryCalls: 1,
+		},
+		{
+			name:       "Policy requiring a second factor",
+			statusCode: http.StatusOK,
+			errMessage: "",
+			webauthnFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id", IsEmailOTPAllowed: true}, nil
+			},
+			loginHistoryFn: func() error {
+				return nil
+			},
+			loginHistoryCalls: 0,
+			policy:            Policy{{"passkey", "otp_email"}},
+		},
+		{
+			name:       "Policy without an enabled second factor",
+			statusCode: http.StatusForbidden,
+			errMessage: "No two-factor authentication method satisfies the login policy",
+			webauthnFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id", IsEmailOTPAllowed: true}, nil
+			},
+			loginHistoryFn: func() error {
+				return nil
+			},
+			loginHistoryCalls: 0,
+			policy:            Policy{{"passkey", "device"}},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			loginHistoryRepo := &test.LoginHistoryRepository{
+				CreateFn: tc.loginHistoryFn,
+			}
+			repoMngr := &test.RepositoryManager{
+				LoginHistoryFn: func() auth.LoginHistoryRepository {
+					return loginHistoryRepo
+				},
+			}
+			tokenSvc := &test.TokenService{
+				CreateFn: func() (*auth.Token, error) {
+					return &auth.Token{}, nil
+				},
+				SignFn: func() (string, error) {
+					return "jwt-token", nil
+				},
+			}
+			webauthnSvc := &test.WebAuthnService{
+				FinishDiscoverableLoginFn: tc.webauthnFn,
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithTokenService(tokenSvc),
+				WithRepoManager(repoMngr),
+				WithWebAuthn(webauthnSvc),
+				WithPolicy(tc.policy),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/login/passkey", bytes.NewBufferString("{}"))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
 			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
 			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
 
@@ -580,10 +1262,9 @@ func TestLoginAPI_VerifyDevice(t *testing.T) {
 				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
 				t.Error(rr.Body.String())
 			}
-
-			if messagingSvc.Calls.Send != tc.messagingCalls {
-				t.Errorf("incorrect MessagingService.Send() call count, want %v got %v",
-					tc.messagingCalls, messagingSvc.Calls.Send)
+			if loginHistoryRepo.Calls.Create != tc.loginHistoryCalls {
+				t.Errorf("incorrect LoginHistory.Create() call count, want %v got %v",
+					tc.loginHistoryCalls, loginHistoryRepo.Calls.Create)
 			}
 
 			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
@@ -606,6 +1287,9 @@ func TestLoginAPI_VerifyCode(t *testing.T) {
 		tokenSignFn       func() (string, error)
 		tokenValidationFn func() (*auth.Token, error)
 		loginHistoryFn    func() error
+		clientApp         *auth.ClientApplication
+		policy            Policy
+		afterLoginFn      func() error
 	}{
 		{
 			name:           "Invalid token failure",
@@ -763,6 +1447,24 @@ func TestLoginAPI_VerifyCode(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name:           "Client application rejects OTP code",
+			statusCode:     http.StatusForbidden,
+			messagingCalls: 0,
+			errMessage:     "Client application requires stronger two-factor authentication",
+			reqBody:        []byte(`{"code": "123456"}`),
+			userFn: func() (*auth.User, error) {
+				return &auth.User{IsEmailOTPAllowed: true, IsTOTPAllowed: true}, nil
+			},
+			tokenValidationFn: func() (*auth.Token, error) {
+				return &auth.Token{
+					CodeHash: test.MockTokenHash("", "", time.Now().Add(time.Minute*5).Unix()),
+					State:    auth.JWTPreAuthorized,
+					Code:     test.OTPCode,
+				}, nil
+			},
+			clientApp: &auth.ClientApplication{ID: "admin", RequiredTFA: auth.TFALevelTOTP},
+		},
 		{
 			name:           "Successful request",
 			statusCode:     http.StatusOK,
@@ -789,6 +1491,91 @@ func TestLoginAPI_VerifyCode(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name:           "Hook rejecting login failure",
+			statusCode:     http.StatusForbidden,
+			messagingCalls: 0,
+			errMessage:     "Account is suspended",
+			reqBody:        []byte(`{"code": "123456"}`),
+			userFn: func() (*auth.User, error) {
+				return &auth.User{IsEmailOTPAllowed: true}, nil
+			},
+			tokenCreateFn: func() (*auth.Token, error) {
+				return &auth.Token{State: auth.JWTAuthorized}, nil
+			},
+			tokenSignFn: func() (string, error) {
+				return "jwt-token", nil
+			},
+			tokenValidationFn: func() (*auth.Token, error) {
+				return &auth.Token{
+					CodeHash: test.MockTokenHash("", "", time.Now().Add(time.Minute*5).Unix()),
+					State:    auth.JWTPreAuthorized,
+					Code:     test.OTPCode,
+				}, nil
+			},
+			loginHistoryFn: func() error {
+				return nil
+			},
+			afterLoginFn: func() error {
+				return auth.ErrForbidden("account is suspended")
+			},
+		},
+		{
+			name:           "Policy rejecting SMS failure",
+			statusCode:     http.StatusForbidden,
+			messagingCalls: 0,
+			errMessage:     "Two-factor authentication method does not satisfy the login policy",
+			reqBody:        []byte(`{"code": "123456"}`),
+			userFn: func() (*auth.User, error) {
+				return &auth.User{IsPhoneOTPAllowed: true}, nil
+			},
+			tokenCreateFn: func() (*auth.Token, error) {
+				return &auth.Token{}, nil
+			},
+			tokenSignFn: func() (string, error) {
+				return "jwt-token", nil
+			},
+			tokenValidationFn: func() (*auth.Token, error) {
+				return &auth.Token{
+					CodeHash:    test.MockTokenHash("+15555555555", "phone", time.Now().Add(time.Minute*5).Unix()),
+					State:       auth.JWTPreAuthorized,
+					Code:        test.OTPCode,
+					AuthMethods: []string{"password"},
+				}, nil
+			},
+			loginHistoryFn: func() error {
+				return nil
+			},
+			policy: Policy{{"password", "device"}, {"password", "otp_email"}},
+		},
+		{
+			name:           "Policy allowing email OTP",
+			statusCode:     http.StatusOK,
+			messagingCalls: 0,
+			errMessage:     "",
+			reqBody:        []byte(`{"code": "123456"}`),
+			userFn: func() (*auth.User, error) {
+				return &auth.User{IsEmailOTPAllowed: true}, nil
+			},
+			tokenCreateFn: func() (*auth.Token, error) {
+				return &auth.Token{}, nil
+			},
+			tokenSignFn: func() (string, error) {
+				return "jwt-token", nil
+			},
+			tokenValidationFn: func() (*auth.Token, error) {
+				return &auth.Token{
+					CodeHash:    test.MockTokenHash("", "", time.Now().Add(time.Minute*5).Unix()),
+					State:       auth.JWTPreAuthorized,
+					Code:        test.OTPCode,
+					AuthMethods: []string{"password"},
+				}, nil
+			},
+			loginHistoryFn: func() error {
+				return nil
+			},
+			policy: Policy{{"password", "device"}, {"password", "otp_email"}},
+		},
 	}
 
 	for _, tc := range tt {
@@ -821,6 +1608,8 @@ func TestLoginAPI_VerifyCode(t *testing.T) {
 				WithRepoManager(repoMngr),
 				WithMessaging(messagingSvc),
 				WithOTP(otpSvc),
+				WithPolicy(tc.policy),
+				WithHooks(&test.Hooks{AfterLoginFn: tc.afterLoginFn}),
 			)
 
 			req, err := http.NewRequest(
@@ -831,6 +1620,9 @@ func TestLoginAPI_VerifyCode(t *testing.T) {
 			if err != nil {
 				t.Fatal("failed to create request:", err)
 			}
+			if tc.clientApp != nil {
+				req = req.WithContext(clientapp.NewContext(req.Context(), tc.clientApp))
+			}
 
 			test.SetAuthHeaders(req)
 
@@ -857,3 +1649,403 @@ func TestLoginAPI_VerifyCode(t *testing.T) {
 		})
 	}
 }
+
+func TestLoginAPI_Approval(t *testing.T) {
+	preAuthToken := &auth.Token{
+		State:  auth.JWTPreAuthorized,
+		UserID: "user-id",
+	}
+	preAuthToken.Id = "token-id"
+	preAuthToken.ExpiresAt = time.Now().Add(time.Minute * 5).Unix()
+
+	approvalToken := &auth.ActionToken{
+		Purpose: auth.PurposeApproveLogin,
+		Data:    map[string]string{"token_id": "token-id"},
+	}
+	approvalToken.ExpiresAt = time.Now().Add(time.Minute * 10).Unix()
+
+	userRepo := &test.UserRepository{
+		ByIdentityFn: func() (*auth.User, error) {
+			return &auth.User{
+				ID:                "user-id",
+				Email:             sql.NullString{String: "jane@example.com", Valid: true},
+				IsEmailOTPAllowed: true,
+			}, nil
+		},
+	}
+	loginHistoryRepo := &test.LoginHistoryRepository{}
+	repoMngr := &test.RepositoryManager{
+		UserFn: func() auth.UserRepository {
+			return userRepo
+		},
+		LoginHistoryFn: func() auth.LoginHistoryRepository {
+			return loginHistoryRepo
+		},
+	}
+	tokenSvc := &test.TokenService{
+		ValidateFn: func() (*auth.Token, error) {
+			return preAuthToken, nil
+		},
+		CreateFn: func() (*auth.Token, error) {
+			return &auth.Token{State: auth.JWTAuthorized}, nil
+		},
+		SignFn: func() (string, error) {
+			return "jwt-token", nil
+		},
+	}
+	actionTokens := &test.ActionTokenService{
+		IssueFn: func() (string, error) {
+			return "approval-token", nil
+		},
+		ParseFn: func() (*auth.ActionToken, error) {
+			return approvalToken, nil
+		},
+		RedeemFn: func() error {
+			return nil
+		},
+	}
+	messagingSvc := &test.MessagingService{}
+	svc := NewService(
+		WithLogger(&test.Logger{}),
+		WithTokenService(tokenSvc),
+		WithRepoManager(repoMngr),
+		WithMessaging(messagingSvc),
+		WithDB(memstore.New()),
+		WithActionTokens(actionTokens),
+		WithApprovalURL("https://example.com/approve"),
+		WithApprovalStream(time.Second, time.Second*5),
+	)
+
+	router := mux.NewRouter()
+	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	post := func(path string, body []byte) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatal("failed to create request:", err)
+		}
+		test.SetAuthHeaders(req)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post("/api/v1/login/verify-approval", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusBadRequest, rr.Code)
+	}
+	if err := test.ValidateErrMessage("Login is not approved", rr.Body); err != nil {
+		t.Error(err)
+	}
+
+	rr = post("/api/v1/login/approval", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+	if messagingSvc.Calls.Send != 1 {
+		t.Errorf("incorrect MessagingService.Send() call count, want 1 got %v", messagingSvc.Calls.Send)
+	}
+
+	req, err := http.NewRequest("GET", server.URL+"/api/v1/login/approval/events", nil)
+	if err != nil {
+		t.Fatal("failed to create request:", err)
+	}
+	test.SetAuthHeaders(req)
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal("failed to subscribe to approval events:", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("incorrect content type, want text/event-stream got %s", ct)
+	}
+
+	events := bufio.NewReader(resp.Body)
+	nextEvent := func() string {
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatal("failed to read event:", err)
+			}
+			if strings.HasPrefix(line, "event: ") {
+				return strings.TrimSpace(strings.TrimPrefix(line, "event: "))
+			}
+		}
+	}
+
+	if event := nextEvent(); event != "pending" {
+		t.Errorf("incorrect event, want pending got %s", event)
+	}
+
+	rr = post("/api/v1/login/approve", []byte(`{"token": "approval-token"}`))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+
+	if event := nextEvent(); event != "approved" {
+		t.Errorf("incorrect event, want approved got %s", event)
+	}
+
+	rr = post("/api/v1/login/approve", []byte(`{"token": "approval-token"}`))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("incorrect status code, want %v got %v", http.StatusBadRequest, rr.Code)
+	}
+
+	rr = post("/api/v1/login/verify-approval", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+	if loginHistoryRepo.Calls.Create != 1 {
+		t.Errorf("incorrect LoginHistoryRepository.Create() call count, want 1 got %v",
+			loginHistoryRepo.Calls.Create)
+	}
+
+	rr = post("/api/v1/login/verify-approval", nil)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("incorrect status code, want %v got %v", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestLoginAPI_Lockout(t *testing.T) {
+	validPassword := "$2a$10$zURdae3ekOWKobmadhWdROZLolGAIWrCEzjSfegV6Y/nsxJ1wqM2y" // nolint
+
+	userRepo := &test.UserRepository{
+		ByIdentityFn: func() (*auth.User, error) {
+			return &auth.User{
+				ID:         "user-id",
+				Password:   validPassword,
+				Email:      sql.NullString{String: "jane@example.com", Valid: true},
+				IsVerified: true,
+			}, nil
+		},
+	}
+	repoMngr := &test.RepositoryManager{
+		UserFn: func() auth.UserRepository {
+			return userRepo
+		},
+	}
+	tokenSvc := &test.TokenService{
+		CreateFn: func() (*auth.Token, error) {
+			return &auth.Token{State: auth.JWTPreAuthorized}, nil
+		},
+		SignFn: func() (string, error) {
+			return "jwt-token", nil
+		},
+	}
+	otpSvc := &test.OTPService{
+		OTPCodeFn: func(address string, method auth.DeliveryMethod) (string, string, error) {
+			return "123456", "code-hash", nil
+		},
+		ValidateOTPFn: func(code, hash string) error {
+			if code != "123456" || hash != "code-hash" {
+				return auth.ErrInvalidCode("incorrect code provided")
+			}
+			return nil
+		},
+	}
+	messagingSvc := &test.MessagingService{}
+	svc := NewService(
+		WithLogger(&test.Logger{}),
+		WithTokenService(tokenSvc),
+		WithRepoManager(repoMngr),
+		WithMessaging(messagingSvc),
+		WithOTP(otpSvc),
+		WithPassword(password.NewPassword()),
+		WithDB(memstore.New()),
+		WithLockout(2, time.Minute*15, time.Minute*30),
+	)
+
+	router := mux.NewRouter()
+	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+	post := func(path string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal("failed to create request:", err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	badLogin := `{"type": "email", "identity": "jane@example.com", "password": "password"}`
+	login := `{"type": "email", "identity": "jane@example.com", "password": "swordfish"}`
+
+	rr := post("/api/v1/login/unlock", `{"type": "email", "identity": "jane@example.com"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusAccepted, rr.Code)
+	}
+	if messagingSvc.Calls.Send != 0 {
+		t.Errorf("unlock code delivered to unlocked account, got %v calls", messagingSvc.Calls.Send)
+	}
+
+	for i := 0; i < 2; i++ {
+		rr = post("/api/v1/login", badLogin)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("incorrect status code, want %v got %v", http.StatusBadRequest, rr.Code)
+		}
+	}
+
+	rr = post("/api/v1/login", login)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusForbidden, rr.Code)
+	}
+	if err := test.ValidateErrMessage("Account is temporarily locked", rr.Body); err != nil {
+		t.Error(err)
+	}
+
+	rr = post("/api/v1/login/unlock", `{"type": "email", "identity": "jane@example.com"}`)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusAccepted, rr.Code)
+	}
+	if messagingSvc.Calls.Send != 1 {
+		t.Errorf("incorrect MessagingService.Send() call count, want 1 got %v", messagingSvc.Calls.Send)
+	}
+
+	rr = post("/api/v1/login/unlock/verify", `{"type": "email", "identity": "jane@example.com", "code": "654321"}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusBadRequest, rr.Code)
+	}
+	if err := test.ValidateErrMessage("Incorrect code provided", rr.Body); err != nil {
+		t.Error(err)
+	}
+
+	rr = post("/api/v1/login/unlock/verify", `{"type": "email", "identity": "jane@example.com", "code": "123456"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+
+	rr = post("/api/v1/login", login)
+	if rr.Code != http.StatusOK {
+		t.Errorf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+		t.Error(rr.Body.String())
+	}
+}
+
+func TestLoginAPI_ResetPassword(t *testing.T) {
+	expiredPassword := "$2a$10$zURdae3ekOWKobmadhWdROZLolGAIWrCEzjSfegV6Y/nsxJ1wqM2y" // nolint
+
+	tt := []struct {
+		name           string
+		statusCode     int
+		reqBody        string
+		errMessage     string
+		userFn         func() (*auth.User, error)
+		revokeAllCalls int
+	}{
+		{
+			name:       "Missing token",
+			statusCode: http.StatusBadRequest,
+			reqBody:    `{"password": "correct horse battery"}`,
+			userFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id", Password: expiredPassword, IsPasswordExpired: true}, nil
+			},
+		},
+		{
+			name:       "Password not expired",
+			statusCode: http.StatusBadRequest,
+			reqBody:    `{"token": "reset-token", "password": "correct horse battery"}`,
+			errMessage: "Password reset is not required",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id", Password: expiredPassword}, nil
+			},
+		},
+		{
+			name:       "Password reused",
+			statusCode: http.StatusBadRequest,
+			reqBody:    `{"token": "reset-token", "password": "swordfish"}`,
+			errMessage: "Password must differ from the expired password",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id", Password: expiredPassword, IsPasswordExpired: true}, nil
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			reqBody:    `{"token": "reset-token", "password": "correct horse battery"}`,
+			userFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id", Password: expiredPassword, IsPasswordExpired: true}, nil
+			},
+			revokeAllCalls: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			userRepo := &test.UserRepository{
+				ByIdentityFn:   tc.userFn,
+				GetForUpdateFn: tc.userFn,
+				UpdateFn: func() error {
+					return nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return userRepo
+				},
+				WithAtomicFn: func() (interface{}, error) {
+					return tc.userFn()
+				},
+			}
+			tokenSvc := &test.TokenService{
+				RevokeAllFn: func() error {
+					return nil
+				},
+			}
+			actionTokens := &test.ActionTokenService{
+				ParseFn: func() (*auth.ActionToken, error) {
+					return &auth.ActionToken{
+						UserID:  "user-id",
+						Purpose: auth.PurposeResetPassword,
+					}, nil
+				},
+				RedeemFn: func() error {
+					return nil
+				},
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithTokenService(tokenSvc),
+				WithRepoManager(repoMngr),
+				WithPassword(password.NewPassword()),
+				WithActionTokens(actionTokens),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/login/password-reset", bytes.NewBufferString(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if tokenSvc.Calls.RevokeAll != tc.revokeAllCalls {
+				t.Errorf("incorrect TokenService.RevokeAll() call count, want %v got %v",
+					tc.revokeAllCalls, tokenSvc.Calls.RevokeAll)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package loginapi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+const (
+	// maxUnlockRequests is the number of unlock codes which may be
+	// delivered to a User during a single lockout.
+	maxUnlockRequests = 3
+	// maxUnlockAttempts is the number of unlock codes which may be
+	// submitted before a new code must be requested.
+	maxUnlockAttempts = 5
+
+	// unlockRequested is reported for every unlock request so the
+	// response does not disclose whether an account exists or
+	// is locked.
+	unlockRequested = "requested"
+	// unlockComplete is reported once an account is unlocked.
+	unlockComplete = "unlocked"
+)
+
+// RequestUnlock delivers a code to unlock an account locked after
+// repeated failed logins. The code is only delivered to the verified
+// contact address identified in the request.
+func (s *service) RequestUnlock(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	if !s.isLockoutEnabled() {
+		return nil, auth.ErrForbidden("account lockout is disabled")
+	}
+
+	req, err := decodeUnlockRequest(r, false)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, req.UserAttribute(), req.Identity)
+	if err == sql.ErrNoRows {
+		return &unlockResponse{Status: unlockRequested}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	isLocked, err := s.isLocked(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !isLocked || !user.IsVerified {
+		return &unlockResponse{Status: unlockRequested}, nil
+	}
+
+	count, err := s.incrWithin(ctx, UnlockRequestsKey(user.ID))
+	if err != nil {
+		return nil, err
+	}
+	if count > maxUnlockRequests {
+		httpapi.Audit(s.logger, r, "LoginAPI", "unlock_throttled", user.ID)
+		return nil, auth.ErrThrottle("too many unlock requests")
+	}
+
+	code, hash, err := s.otp.OTPCode(req.Identity, req.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.db.Set(ctx, UnlockCodeKey(user.ID), hash, s.lockoutDuration).Err(); err != nil {
+		return nil, fmt.Errorf("cannot store unlock code: %w", err)
+	}
+	if err = s.db.Del(ctx, UnlockAttemptsKey(user.ID)).Err(); err != nil {
+		return nil, fmt.Errorf("cannot reset unlock attempts: %w", err)
+	}
+
+	msg := &auth.Message{
+		Type:     auth.OTPUnlock,
+		Delivery: req.Type,
+		Address:  req.Identity,
+		Vars:     map[string]string{"code": code},
+	}
+	if err = s.message.Send(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	httpapi.Audit(s.logger, r, "LoginAPI", "unlock_requested", user.ID, "delivery", req.Type)
+
+	return &unlockResponse{Status: unlockRequested}, nil
+}
+
+// Unlock verifies a code delivered by RequestUnlock and lifts the
+// lockout of the account. Users must still login afterwards.
+func (s *service) Unlock(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	if !s.isLockoutEnabled() {
+		return nil, auth.ErrForbidden("account lockout is disabled")
+	}
+
+	req, err := decodeUnlockRequest(r, true)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, req.UserAttribute(), req.Identity)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrInvalidCode("incorrect code provided"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := s.db.Get(ctx, UnlockCodeKey(user.ID)).Result()
+	if err == redis.Nil {
+		return nil, auth.ErrInvalidCode("incorrect code provided")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve unlock code: %w", err)
+	}
+
+	count, err := s.incrWithin(ctx, UnlockAttemptsKey(user.ID))
+	if err != nil {
+		return nil, err
+	}
+	if count > maxUnlockAttempts {
+		if err = s.db.Del(ctx, UnlockCodeKey(user.ID)).Err(); err != nil {
+			return nil, fmt.Errorf("cannot remove unlock code: %w", err)
+		}
+		httpapi.Audit(s.logger, r, "LoginAPI", "unlock_failed", user.ID, "reason", "too many attempts")
+		return nil, auth.ErrThrottle("too many unlock attempts, request a new code")
+	}
+
+	if err = s.otp.ValidateOTP(req.Code, hash); err != nil {
+		httpapi.Audit(s.logger, r, "LoginAPI", "unlock_failed", user.ID, "reason", "invalid code")
+		return nil, err
+	}
+
+	err = s.db.Del(ctx,
+		LockoutKey(user.ID),
+		LockoutFailuresKey(user.ID),
+		UnlockCodeKey(user.ID),
+		UnlockAttemptsKey(user.ID),
+		UnlockRequestsKey(user.ID),
+	).Err()
+	if err != nil {
+		return nil, fmt.Errorf("cannot unlock account: %w", err)
+	}
+
+	httpapi.Audit(s.logger, r, "LoginAPI", "account_unlocked", user.ID)
+
+	return &unlockResponse{Status: unlockComplete}, nil
+}
+
+// isLockoutEnabled reports whether accounts are locked after
+// repeated failed logins.
+func (s *service) isLockoutEnabled() bool {
+	return s.lockoutMaxFailures > 0 && s.db != nil
+}
+
+// isLocked reports whether a User's account is locked.
+func (s *service) isLocked(ctx context.Context, userID string) (bool, error) {
+	err := s.db.Get(ctx, LockoutKey(userID)).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot check account lockout: %w", err)
+	}
+	return true, nil
+}
+
+// checkLockout returns an error if a User's account is locked.
+func (s *service) checkLockout(ctx context.Context, user *auth.User) error {
+	if !s.isLockoutEnabled() {
+		return nil
+	}
+
+	isLocked, err := s.isLocked(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if isLocked {
+		return auth.ErrForbidden("account is temporarily locked")
+	}
+	return nil
+}
+
+// recordLockoutFailure counts a failed password against a User and
+// locks the account once the maximum failures within the lockout
+// window is reached. Failures to record are logged and do not affect
+// the response.
+func (s *service) recordLockoutFailure(ctx context.Context, r *http.Request, user *auth.User) {
+	if !s.isLockoutEnabled() {
+		return
+	}
+
+	count, err := s.db.Incr(ctx, LockoutFailuresKey(user.ID)).Result()
+	if err == nil && count == 1 {
+		err = s.db.Expire(ctx, LockoutFailuresKey(user.ID), s.lockoutWindow).Err()
+	}
+	if err == nil && count >= s.lockoutMaxFailures {
+		err = s.db.Set(ctx, LockoutKey(user.ID), count, s.lockoutDuration).Err()
+		if err == nil {
+			err = s.db.Del(ctx, LockoutFailuresKey(user.ID)).Err()
+			httpapi.Audit(s.logger, r, "LoginAPI", "account_locked", user.ID, "failures", count)
+		}
+	}
+	if err != nil {
+		level.Error(s.logger).Log(
+			"source", "LoginAPI.Login",
+			"message", "failed to record lockout failure",
+			"error", err,
+		)
+	}
+}
+
+// clearLockoutFailures resets the failed password count of a User
+// after a successful password check.
+func (s *service) clearLockoutFailures(ctx context.Context, user *auth.User) {
+	if !s.isLockoutEnabled() {
+		return
+	}
+
+	if err := s.db.Del(ctx, LockoutFailuresKey(user.ID)).Err(); err != nil {
+		level.Error(s.logger).Log(
+			"source", "LoginAPI.Login",
+			"message", "failed to clear lockout failures",
+			"error", err,
+		)
+	}
+}
+
+// incrWithin increments a counter which expires after the lockout
+// duration.
+func (s *service) incrWithin(ctx context.Context, key string) (int64, error) {
+	count, err := s.db.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("cannot increment %s: %w", key, err)
+	}
+	if count == 1 {
+		if err = s.db.Expire(ctx, key, s.lockoutDuration).Err(); err != nil {
+			return 0, fmt.Errorf("cannot expire %s: %w", key, err)
+		}
+	}
+	return count, nil
+}
+
+// LockoutKey is the key marking a User's account as locked.
+func LockoutKey(userID string) string {
+	return fmt.Sprintf("%s_lockout", userID)
+}
+
+// LockoutFailuresKey is the key counting a User's failed passwords
+// within the lockout window.
+func LockoutFailuresKey(userID string) string {
+	return fmt.Sprintf("%s_lockout_failures", userID)
+}
+
+// UnlockCodeKey is the key holding the hash of a User's unlock code.
+func UnlockCodeKey(userID string) string {
+	return fmt.Sprintf("%s_unlock_code", userID)
+}
+
+// UnlockAttemptsKey is the key counting submissions of a User's
+// unlock code.
+func UnlockAttemptsKey(userID string) string {
+	return fmt.Sprintf("%s_unlock_attempts", userID)
+}
+
+// UnlockRequestsKey is the key counting unlock codes delivered to
+// a User during a lockout.
+func UnlockRequestsKey(userID string) string {
+	return fmt.Sprintf("%s_unlock_requests", userID)
+}
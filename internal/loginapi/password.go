@@ -0,0 +1,85 @@
+package loginapi
+
+import (
+	"fmt"
+	"net/http"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+// ResetPassword sets a new password for a User with the token delivered
+// after an operator expired their password. Every session of the User
+// is revoked once the password is set.
+func (s *service) ResetPassword(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	if s.actionTokens == nil {
+		return nil, auth.ErrForbidden("password reset is disabled")
+	}
+
+	req, err := decodeResetPasswordRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	resetToken, err := s.actionTokens.Parse(ctx, req.Token, auth.PurposeResetPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", resetToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsPasswordExpired {
+		return nil, auth.ErrBadRequest("password reset is not required")
+	}
+
+	if err = s.password.OKForUser(req.Password); err != nil {
+		return nil, err
+	}
+	if err = s.password.Validate(user, req.Password); err == nil {
+		return nil, auth.ErrInvalidField("password must differ from the expired password")
+	}
+
+	passwordHash, err := s.password.Hash(req.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err = s.actionTokens.Redeem(ctx, resetToken); err != nil {
+		return nil, err
+	}
+
+	client, err := s.repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.WithAtomic(func() (interface{}, error) {
+		user, err := client.User().GetForUpdate(ctx, resetToken.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		user.Password = string(passwordHash)
+		user.IsPasswordExpired = false
+		if err = client.User().Update(ctx, user); err != nil {
+			return nil, fmt.Errorf("cannot reset password: %w", err)
+		}
+
+		return user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.token.RevokeAll(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	httpapi.Audit(s.logger, r, "LoginAPI", "password_reset", user.ID)
+
+	return &passwordResetResponse{Result: "success"}, nil
+}
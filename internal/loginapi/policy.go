@@ -0,0 +1,203 @@
+package loginapi
+
+import (
+	"fmt"
+	"strings"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/token"
+)
+
+const (
+	// factorPassword is completed by logging in with a password.
+	factorPassword = "password"
+	// factorPasskey is completed by logging in with a discoverable
+	// WebAuthn credential.
+	factorPasskey = "passkey"
+)
+
+// secondFactors are the factors completing a login after the User
+// is identified.
+var secondFactors = []auth.TFAOptions{
+	auth.FIDODevice,
+	auth.TOTP,
+	auth.OTPEmail,
+	auth.OTPPhone,
+}
+
+// Policy is the combinations of factors which authorize a login. A
+// login is authorized once every factor of any combination is complete.
+// An empty Policy authorizes a login completed by any 2FA option or
+// by a passkey.
+type Policy [][]string
+
+// ParsePolicy parses a comma separated list of combinations whose
+// factors are joined by `+`, e.g. `password+device,password+totp,passkey`.
+// Factors are password, passkey, device, totp, otp_email and otp_phone.
+func ParsePolicy(s string) (Policy, error) {
+	var policy Policy
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var combination []string
+		for _, factor := range strings.Split(entry, "+") {
+			factor = strings.ToLower(strings.TrimSpace(factor))
+			if !isFactor(factor) {
+				return nil, fmt.Errorf("invalid factor %q in %q", factor, entry)
+			}
+			combination = append(combination, factor)
+		}
+
+		if len(combination) == 1 && combination[0] == factorPassword {
+			return nil, fmt.Errorf("password requires a second factor in %q", entry)
+		}
+
+		policy = append(policy, combination)
+	}
+
+	return policy, nil
+}
+
+// Allows reports whether completed factors authorize a login.
+func (p Policy) Allows(factors []string) bool {
+	if len(p) == 0 {
+		for _, factor := range factors {
+			if factor != factorPassword {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, combination := range p {
+		if hasFactors(factors, combination) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Next returns the 2FA options which authorize a login once the factors
+// are complete. Only options a User has enabled are returned.
+func (p Policy) Next(factors []string, enabled []auth.TFAOptions) []auth.TFAOptions {
+	next := []auth.TFAOptions{}
+	for _, option := range enabled {
+		if p.Allows(withFactor(factors, string(option))) {
+			next = append(next, option)
+		}
+	}
+
+	return next
+}
+
+// preAuthorize returns the options of a pre-authorized token for a
+// login whose first factors are complete. The token offers the 2FA
+// options which would satisfy the policy, and the login is rejected
+// if the User has enabled none of them.
+func (s *service) preAuthorize(user *auth.User, factors []string) ([]auth.TokenOption, error) {
+	options := []auth.TokenOption{token.WithAuthMethods(factors...)}
+
+	next := s.policy.Next(factors, enabledTFA(user))
+	if len(s.policy) > 0 {
+		if len(next) == 0 {
+			return nil, auth.ErrForbidden("no two-factor authentication method satisfies the login policy")
+		}
+		options = append(options, token.WithTFAOptions(next...))
+	}
+
+	delivery := user.DefaultOTPDelivery()
+	if user.CanSendDefaultOTP() && (len(s.policy) == 0 || hasOption(next, otpOption(delivery))) {
+		options = append(options, token.WithOTPDeliveryMethod(delivery))
+	}
+
+	return options, nil
+}
+
+// authorize returns the factors of a login completed by a 2FA option,
+// or an error if they do not satisfy the policy.
+func (s *service) authorize(preAuthToken *auth.Token, option auth.TFAOptions) ([]string, error) {
+	factors := withFactor(preAuthToken.AuthMethods, string(option))
+	if !s.policy.Allows(factors) {
+		return nil, auth.ErrForbidden("two-factor authentication method does not satisfy the login policy")
+	}
+
+	return factors, nil
+}
+
+// enabledTFA returns the 2FA options a User has enabled.
+func enabledTFA(user *auth.User) []auth.TFAOptions {
+	var options []auth.TFAOptions
+	if user.IsDeviceAllowed {
+		options = append(options, auth.FIDODevice)
+	}
+	if user.IsTOTPAllowed {
+		options = append(options, auth.TOTP)
+	}
+	if user.IsEmailOTPAllowed {
+		options = append(options, auth.OTPEmail)
+	}
+	if user.IsPhoneOTPAllowed {
+		options = append(options, auth.OTPPhone)
+	}
+
+	return options
+}
+
+// otpOption returns the 2FA option of an OTP delivery method.
+func otpOption(delivery auth.DeliveryMethod) auth.TFAOptions {
+	if delivery == auth.Phone {
+		return auth.OTPPhone
+	}
+
+	return auth.OTPEmail
+}
+
+// withFactor returns completed factors with another factor.
+func withFactor(factors []string, factor string) []string {
+	return append(append([]string{}, factors...), factor)
+}
+
+func hasOption(options []auth.TFAOptions, option auth.TFAOptions) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isFactor(factor string) bool {
+	if factor == factorPassword || factor == factorPasskey {
+		return true
+	}
+
+	for _, option := range secondFactors {
+		if factor == string(option) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasFactors(factors, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, f := range factors {
+			if f == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,141 @@
+package loginapi
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+func TestLoginAPI_ParsePolicy(t *testing.T) {
+	tt := []struct {
+		name     string
+		value    string
+		policy   Policy
+		hasError bool
+	}{
+		{
+			name:   "Empty policy",
+			value:  "",
+			policy: nil,
+		},
+		{
+			name:  "Several combinations",
+			value: "password+device, Password+TOTP,passkey",
+			policy: Policy{
+				{"password", "device"},
+				{"password", "totp"},
+				{"passkey"},
+			},
+		},
+		{
+			name:     "Unknown factor",
+			value:    "password+sms",
+			hasError: true,
+		},
+		{
+			name:     "Password alone",
+			value:    "password",
+			hasError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			policy, err := ParsePolicy(tc.value)
+			if tc.hasError {
+				if err == nil {
+					t.Error("expected policy to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+			if !cmp.Equal(policy, tc.policy) {
+				t.Error("policy does not match", cmp.Diff(policy, tc.policy))
+			}
+		})
+	}
+}
+
+func TestLoginAPI_PolicyAllows(t *testing.T) {
+	tt := []struct {
+		name    string
+		policy  Policy
+		factors []string
+		allowed bool
+	}{
+		{
+			name:    "Default policy with password alone",
+			factors: []string{"password"},
+			allowed: false,
+		},
+		{
+			name:    "Default policy with 2FA",
+			factors: []string{"password", "otp_phone"},
+			allowed: true,
+		},
+		{
+			name:    "Default policy with passkey",
+			factors: []string{"passkey"},
+			allowed: true,
+		},
+		{
+			name:    "Default policy without password",
+			factors: []string{"otp_email"},
+			allowed: true,
+		},
+		{
+			name:    "Combination complete",
+			policy:  Policy{{"password", "device"}},
+			factors: []string{"password", "device"},
+			allowed: true,
+		},
+		{
+			name:    "Combination incomplete",
+			policy:  Policy{{"password", "device"}},
+			factors: []string{"password", "otp_phone"},
+			allowed: false,
+		},
+		{
+			name:    "Passkey requiring OTP",
+			policy:  Policy{{"passkey", "otp_email"}},
+			factors: []string{"passkey"},
+			allowed: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if allowed := tc.policy.Allows(tc.factors); allowed != tc.allowed {
+				t.Errorf("incorrect result for %v, want %v got %v", tc.factors, tc.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestLoginAPI_PolicyNext(t *testing.T) {
+	policy := Policy{
+		{"password", "device"},
+		{"password", "totp"},
+		{"passkey", "otp_email"},
+	}
+	enabled := []auth.TFAOptions{auth.FIDODevice, auth.TOTP, auth.OTPEmail, auth.OTPPhone}
+
+	next := policy.Next([]string{"password"}, enabled)
+	if want := []auth.TFAOptions{auth.FIDODevice, auth.TOTP}; !cmp.Equal(next, want) {
+		t.Error("next options do not match", cmp.Diff(next, want))
+	}
+
+	next = policy.Next([]string{"passkey"}, enabled)
+	if want := []auth.TFAOptions{auth.OTPEmail}; !cmp.Equal(next, want) {
+		t.Error("next options do not match", cmp.Diff(next, want))
+	}
+
+	next = policy.Next(nil, enabled)
+	if len(next) != 0 {
+		t.Errorf("expected no options without a first factor, got %v", next)
+	}
+}
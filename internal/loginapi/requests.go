@@ -1,26 +1,54 @@
 package loginapi
 
 import (
-	"encoding/json"
-	"fmt"
 	"net/http"
 	"strings"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/httpapi"
 )
 
 type loginRequest struct {
-	Password string              `json:"password"`
-	Identity string              `json:"identity"`
-	Type     auth.DeliveryMethod `json:"type"`
+	Password  string              `json:"password"`
+	Identity  string              `json:"identity"`
+	Type      auth.DeliveryMethod `json:"type"`
+	Audiences []string            `json:"audiences"`
+	Scopes    []string            `json:"scopes"`
+	// TTL is the lifetime in seconds requested for the session
+	// when shorter than the default, e.g. for kiosk logins.
+	TTL int64 `json:"ttl"`
 }
 
 type verifyCodeRequest struct {
 	Code string `json:"code"`
 }
 
+type approveRequest struct {
+	Token string `json:"token"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type unlockRequest struct {
+	Identity string              `json:"identity"`
+	Type     auth.DeliveryMethod `json:"type"`
+	Code     string              `json:"code"`
+}
+
 func (r *loginRequest) UserAttribute() string {
-	switch r.Type {
+	return userAttribute(r.Type)
+}
+
+func (r *unlockRequest) UserAttribute() string {
+	return userAttribute(r.Type)
+}
+
+func userAttribute(method auth.DeliveryMethod) string {
+	switch method {
 	case auth.Email:
 		return "Email"
 	case auth.Phone:
@@ -40,16 +68,32 @@ func decodeLoginRequest(r *http.Request) (*loginRequest, error) {
 		return nil, auth.ErrBadRequest("no request body received")
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err = httpapi.DecodeJSON(r, &req)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+		return nil, httpapi.DecodeJSONError(err)
 	}
 
+	req.Identity = contactchecker.Normalize(req.Type, req.Identity)
+
+	var errs auth.ErrValidation
 	if req.UserAttribute() == "" {
-		return nil, auth.ErrBadRequest("identity type must be email or phone")
+		errs = append(errs, auth.FieldError{
+			Field: "type", Code: auth.FieldInvalid, Message: "identity type must be email or phone",
+		})
+	}
+	if req.Identity == "" {
+		errs = append(errs, auth.FieldError{
+			Field: "identity", Code: auth.FieldRequired, Message: "identity cannot be empty",
+		})
+	}
+	if req.TTL < 0 {
+		errs = append(errs, auth.FieldError{
+			Field: "ttl", Code: auth.FieldInvalid, Message: "ttl cannot be negative",
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errs
 	}
-
-	req.Identity = strings.TrimSpace(req.Identity)
 
 	return &req, nil
 }
@@ -64,12 +108,111 @@ func decodeVerifyCodeRequest(r *http.Request) (*verifyCodeRequest, error) {
 		return nil, auth.ErrBadRequest("no request body received")
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, httpapi.DecodeJSONError(err)
+	}
+
+	req.Code = strings.TrimSpace(req.Code)
+
+	return &req, nil
+}
+
+func decodeApproveRequest(r *http.Request) (*approveRequest, error) {
+	var (
+		req approveRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, httpapi.DecodeJSONError(err)
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		return nil, auth.ErrField("token", auth.FieldRequired, "token must be provided")
+	}
+
+	return &req, nil
+}
+
+func decodeUnlockRequest(r *http.Request, requireCode bool) (*unlockRequest, error) {
+	var (
+		req unlockRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+		return nil, httpapi.DecodeJSONError(err)
 	}
 
+	req.Identity = contactchecker.Normalize(req.Type, req.Identity)
 	req.Code = strings.TrimSpace(req.Code)
 
+	var errs auth.ErrValidation
+	if req.UserAttribute() == "" {
+		errs = append(errs, auth.FieldError{
+			Field: "type", Code: auth.FieldInvalid, Message: "identity type must be email or phone",
+		})
+	}
+	if req.Identity == "" {
+		errs = append(errs, auth.FieldError{
+			Field: "identity", Code: auth.FieldRequired, Message: "identity cannot be empty",
+		})
+	}
+	if requireCode && req.Code == "" {
+		errs = append(errs, auth.FieldError{
+			Field: "code", Code: auth.FieldRequired, Message: "code cannot be empty",
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return &req, nil
+}
+
+func decodeResetPasswordRequest(r *http.Request) (*resetPasswordRequest, error) {
+	var (
+		req resetPasswordRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, httpapi.DecodeJSONError(err)
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+
+	var errs auth.ErrValidation
+	if req.Token == "" {
+		errs = append(errs, auth.FieldError{
+			Field: "token", Code: auth.FieldRequired, Message: "token must be provided",
+		})
+	}
+	if req.Password == "" {
+		errs = append(errs, auth.FieldError{
+			Field: "password", Code: auth.FieldRequired, Message: "password cannot be empty",
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	return &req, nil
 }
@@ -83,6 +83,16 @@ func TestLoginAPI_LoginRequestDecode(t *testing.T) {
 			}`),
 			hasError: true,
 		},
+		{
+			name: "Negative TTL error",
+			request: []byte(`{
+				"password": "swordfish",
+				"identity": "+15555555555",
+				"type": "phone",
+				"ttl": -60
+			}`),
+			hasError: true,
+		},
 		{
 			name: "Valid request",
 			request: []byte(`{
@@ -0,0 +1,25 @@
+package loginapi
+
+// approvalResponse is a success response for login approval requests.
+type approvalResponse struct {
+	Status string `json:"status"`
+}
+
+// challengeResponse is a success response for LoginAPI.Challenge.
+type challengeResponse struct {
+	Required bool   `json:"required"`
+	Type     string `json:"type,omitempty"`
+	SiteKey  string `json:"siteKey,omitempty"`
+}
+
+// unlockResponse is a success response for LoginAPI.RequestUnlock
+// and LoginAPI.Unlock.
+type unlockResponse struct {
+	Status string `json:"status"`
+}
+
+// passwordResetResponse is a success response for
+// LoginAPI.ResetPassword.
+type passwordResetResponse struct {
+	Result string `json:"result"`
+}
@@ -6,64 +6,275 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clientapp"
 	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/origin"
 	"github.com/fmitra/authenticator/internal/otp"
 	"github.com/fmitra/authenticator/internal/token"
 )
 
 type service struct {
-	logger   log.Logger
-	token    auth.TokenService
-	repoMngr auth.RepositoryManager
-	otp      auth.OTPService
-	password auth.PasswordService
-	webauthn auth.WebAuthnService
-	message  auth.MessagingService
+	logger      log.Logger
+	token       auth.TokenService
+	repoMngr    auth.RepositoryManager
+	otp         auth.OTPService
+	password    auth.PasswordService
+	webauthn    auth.WebAuthnService
+	message     auth.MessagingService
+	attestation auth.AttestationService
+	anomaly     auth.AnomalyDetector
+	canary      auth.CanaryService
+	external    auth.ExternalUserProvider
+	policy      Policy
+	hooks       auth.Hooks
+
+	captchaSiteKey string
+
+	db                     rediser
+	actionTokens           auth.ActionTokenService
+	approvals              *approvalHub
+	approvalURL            string
+	approvalPollInterval   time.Duration
+	approvalStreamDuration time.Duration
+
+	lockoutMaxFailures int64
+	lockoutWindow      time.Duration
+	lockoutDuration    time.Duration
 }
 
 // Login is the initial login step to identify a User.
 func (s *service) Login(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	ctx := r.Context()
 
+	if err := s.anomaly.Check(ctx, r); err != nil {
+		return nil, err
+	}
+
+	if err := s.attestation.Verify(ctx, r); err != nil {
+		return nil, err
+	}
+
 	req, err := decodeLoginRequest(r)
 	if err != nil {
 		return nil, err
 	}
 
+	isCanary, err := s.canary.Trip(ctx, r, req.Identity)
+	if err != nil {
+		return nil, err
+	}
+	if isCanary {
+		s.recordFailure(ctx, r, req.Identity)
+		return nil, auth.ErrBadRequest("invalid username or password")
+	}
+
+	var user *auth.User
+	if s.external != nil {
+		user, err = s.verifyExternal(ctx, r, req)
+	} else {
+		user, err = s.verifyLocal(ctx, r, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if app := clientapp.FromContext(ctx); app != nil && !app.CanAuthenticate(user) {
+		return nil, auth.ErrForbidden("client application requires stronger two-factor authentication")
+	}
+
+	// Users registered without a password are identified
+	// by 2FA alone.
+	var factors []string
+	if user.Password != "" || s.external != nil {
+		factors = append(factors, factorPassword)
+	}
+
+	options, err := s.preAuthorize(user, factors)
+	if err != nil {
+		return nil, err
+	}
+
+	// Requested audiences, scopes and TTL are carried over to the
+	// authorized token once 2FA is complete.
+	options = append(options,
+		token.WithAudiences(req.Audiences...),
+		token.WithScopes(req.Scopes...),
+		token.WithTTL(time.Duration(req.TTL)*time.Second),
+	)
+
+	jwtToken, err := s.token.Create(ctx, user, auth.JWTPreAuthorized, options...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.respond(ctx, w, user, jwtToken)
+}
+
+// verifyLocal verifies a User's credentials against local storage.
+func (s *service) verifyLocal(ctx context.Context, r *http.Request, req *loginRequest) (*auth.User, error) {
 	user, err := s.repoMngr.User().ByIdentity(ctx, req.UserAttribute(), req.Identity)
 	if err == sql.ErrNoRows {
+		s.recordFailure(ctx, r, req.Identity)
 		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid username or password"))
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	if err = s.password.Validate(user, req.Password); err != nil {
+	if err = s.checkLockout(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err = s.validatePassword(user, req.Password); err != nil {
+		s.recordFailure(ctx, r, req.Identity)
+		s.recordLockoutFailure(ctx, r, user)
 		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid username or password"))
 	}
 
-	var jwtToken *auth.Token
+	s.clearLockoutFailures(ctx, user)
+
+	if user.IsPasswordExpired {
+		return nil, auth.ErrForbidden("password has expired and must be reset")
+	}
+
+	s.rehashPassword(ctx, r, user, req.Password)
+
+	return user, nil
+}
+
+// rehashPassword rehashes a User's validated password if it was hashed
+// at a different cost than logins from their client use, e.g. after the
+// cost is tuned or for Users imported from another system. Requests
+// without an origin are not made by browsers and use the API cost.
+// Failures are logged rather than failing the login.
+func (s *service) rehashPassword(ctx context.Context, r *http.Request, user *auth.User, password string) {
+	if user.Password == "" {
+		return
+	}
 
-	if user.CanSendDefaultOTP() {
-		jwtToken, err = s.token.Create(
-			ctx,
-			user,
-			auth.JWTPreAuthorized,
-			token.WithOTPDeliveryMethod(user.DefaultOTPDelivery()),
+	isAPI := origin.FromRequest(r) == ""
+	passwordHash, err := s.password.Rehash(user, password, isAPI)
+	if err == nil && passwordHash != nil {
+		err = s.updatePasswordHash(ctx, user, string(passwordHash))
+	}
+	if err != nil {
+		level.Error(s.logger).Log(
+			"source", "LoginAPI.Login",
+			"message", "failed to rehash password",
+			"error", err,
 		)
-	} else {
-		jwtToken, err = s.token.Create(ctx, user, auth.JWTPreAuthorized)
 	}
+}
 
+// updatePasswordHash replaces a User's password hash unless their
+// password changed since it was validated.
+func (s *service) updatePasswordHash(ctx context.Context, user *auth.User, passwordHash string) error {
+	client, err := s.repoMngr.NewWithTransaction(ctx)
 	if err != nil {
+		return err
+	}
+
+	_, err = client.WithAtomic(func() (interface{}, error) {
+		u, err := client.User().GetForUpdate(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if u.Password != user.Password {
+			return u, nil
+		}
+
+		u.Password = passwordHash
+		return u, client.User().Update(ctx, u)
+	})
+	return err
+}
+
+// verifyExternal verifies a User's credentials against an external
+// user database. A local User is provisioned on first login to manage
+// the user's 2FA settings, devices and tokens.
+func (s *service) verifyExternal(ctx context.Context, r *http.Request, req *loginRequest) (*auth.User, error) {
+	extUser, err := s.external.Authenticate(ctx, req.UserAttribute(), req.Identity, req.Password)
+	if auth.ErrorCode(err) == auth.EBadRequest {
+		s.recordFailure(ctx, r, req.Identity)
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid username or password"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot authenticate external user: %w", err)
+	}
+
+	account, err := s.repoMngr.ExternalAccount().ByExternalID(ctx, extUser.ID)
+	if err == nil {
+		return s.repoMngr.User().ByIdentity(ctx, "ID", account.UserID)
+	}
+	if err != sql.ErrNoRows {
 		return nil, err
 	}
 
-	return s.respond(ctx, w, user, jwtToken)
+	return s.provisionExternal(ctx, extUser)
+}
+
+// provisionExternal creates a local User linked to an external user.
+// The local User has no password as credentials remain with the
+// external database.
+func (s *service) provisionExternal(ctx context.Context, extUser *auth.ExternalUser) (*auth.User, error) {
+	user := &auth.User{
+		Email: sql.NullString{
+			String: extUser.Email,
+			Valid:  extUser.Email != "",
+		},
+		Phone: sql.NullString{
+			String: extUser.Phone,
+			Valid:  extUser.Phone != "",
+		},
+		IsVerified: true,
+	}
+
+	client, err := s.repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.WithAtomic(func() (interface{}, error) {
+		if err := client.User().Create(ctx, user); err != nil {
+			return nil, err
+		}
+
+		account := &auth.ExternalAccount{
+			ExternalID: extUser.ID,
+			UserID:     user.ID,
+		}
+		if err := client.ExternalAccount().Create(ctx, account); err != nil {
+			return nil, err
+		}
+
+		return account, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot provision external user: %w", err)
+	}
+
+	return user, nil
+}
+
+// validatePassword validates a User's password. Users registered
+// without a password proceed directly to OTP verification.
+func (s *service) validatePassword(user *auth.User, password string) error {
+	if user.Password == "" && password == "" {
+		return nil
+	}
+
+	if user.Password == "" {
+		return auth.ErrBadRequest("invalid username or password")
+	}
+
+	return s.password.Validate(user, password)
 }
 
 // DeviceChallenge requests a challenge to be signed by the client.
@@ -72,6 +283,10 @@ func (s *service) DeviceChallenge(w http.ResponseWriter, r *http.Request) (inter
 	ctx := r.Context()
 	userID := httpapi.GetUserID(r)
 
+	if _, err := s.authorize(httpapi.GetToken(r), auth.FIDODevice); err != nil {
+		return nil, err
+	}
+
 	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
 	if err != nil {
 		return nil, err
@@ -90,12 +305,27 @@ func (s *service) VerifyDevice(w http.ResponseWriter, r *http.Request) (interfac
 		return nil, err
 	}
 
+	preAuthToken := httpapi.GetToken(r)
+	factors, err := s.authorize(preAuthToken, auth.FIDODevice)
+	if err != nil {
+		return nil, err
+	}
+
 	err = s.webauthn.FinishLogin(ctx, user, r)
 	if err != nil {
 		return nil, err
 	}
 
-	jwtToken, err := s.token.Create(ctx, user, auth.JWTAuthorized)
+	jwtToken, err := s.token.Create(
+		ctx,
+		user,
+		auth.JWTAuthorized,
+		token.WithAudiences(preAuthToken.Audiences...),
+		token.WithScopes(preAuthToken.Scopes...),
+		token.WithTTL(time.Duration(preAuthToken.TTL)*time.Second),
+		token.WithDeviceBinding(httpapi.GetDeviceID(r)),
+		token.WithAuthMethods(factors...),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -105,6 +335,96 @@ func (s *service) VerifyDevice(w http.ResponseWriter, r *http.Request) (interfac
 		TokenID:   jwtToken.Id,
 		ExpiresAt: s.token.RefreshableTill(ctx, jwtToken, jwtToken.RefreshToken),
 	}
+	httpapi.SetLoginOrigin(loginHistory, r)
+	if err = s.repoMngr.LoginHistory().Create(ctx, loginHistory); err != nil {
+		return nil, err
+	}
+
+	return s.respond(ctx, w, user, jwtToken)
+}
+
+// PasskeyChallenge requests a challenge to be signed by any discoverable
+// credential. It requires no prior identity, allowing browsers to offer
+// passkeys through autofill.
+func (s *service) PasskeyChallenge(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	if err := s.anomaly.Check(ctx, r); err != nil {
+		return nil, err
+	}
+
+	return s.webauthn.BeginDiscoverableLogin(ctx)
+}
+
+// Challenge reports whether a login from the client must solve a
+// CAPTCHA, so that clients only present one to suspicious requests.
+func (s *service) Challenge(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	required, err := s.anomaly.Challenge(r.Context(), r)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := challengeResponse{Required: required}
+	if required {
+		resp.Type = "captcha"
+		resp.SiteKey = s.captchaSiteKey
+	}
+	return resp, nil
+}
+
+// VerifyPasskey identifies a User through the discoverable credential
+// which signed a PasskeyChallenge. User verification by the device stands
+// in for both the password and 2FA steps.
+func (s *service) VerifyPasskey(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	if err := s.anomaly.Check(ctx, r); err != nil {
+		return nil, err
+	}
+
+	if err := s.attestation.Verify(ctx, r); err != nil {
+		return nil, err
+	}
+
+	user, err := s.webauthn.FinishDiscoverableLogin(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Policies may require passkey logins to be completed by
+	// another factor.
+	factors := []string{factorPasskey}
+	if !s.policy.Allows(factors) {
+		options, err := s.preAuthorize(user, factors)
+		if err != nil {
+			return nil, err
+		}
+
+		jwtToken, err := s.token.Create(ctx, user, auth.JWTPreAuthorized, options...)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.respond(ctx, w, user, jwtToken)
+	}
+
+	jwtToken, err := s.token.Create(
+		ctx,
+		user,
+		auth.JWTAuthorized,
+		token.WithDeviceBinding(httpapi.GetDeviceID(r)),
+		token.WithAuthMethods(factors...),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	loginHistory := &auth.LoginHistory{
+		UserID:    user.ID,
+		TokenID:   jwtToken.Id,
+		ExpiresAt: s.token.RefreshableTill(ctx, jwtToken, jwtToken.RefreshToken),
+	}
+	httpapi.SetLoginOrigin(loginHistory, r)
 	if err = s.repoMngr.LoginHistory().Create(ctx, loginHistory); err != nil {
 		return nil, err
 	}
@@ -117,7 +437,7 @@ func (s *service) VerifyDevice(w http.ResponseWriter, r *http.Request) (interfac
 func (s *service) VerifyCode(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	ctx := r.Context()
 	userID := httpapi.GetUserID(r)
-	token := httpapi.GetToken(r)
+	preAuthToken := httpapi.GetToken(r)
 
 	req, err := decodeVerifyCodeRequest(r)
 	if err != nil {
@@ -129,8 +449,26 @@ func (s *service) VerifyCode(w http.ResponseWriter, r *http.Request) (interface{
 		return nil, err
 	}
 
-	if token.CodeHash != "" {
-		err = s.otp.ValidateOTP(req.Code, token.CodeHash)
+	// Codes delivered by email or SMS are embedded in the token while
+	// TOTP codes are generated by the User's application.
+	option := auth.TFAOptions(auth.TOTP)
+	if preAuthToken.CodeHash != "" {
+		option = auth.OTPEmail
+		if h, err := otp.FromOTPHash(preAuthToken.CodeHash); err == nil {
+			option = otpOption(h.DeliveryMethod)
+		}
+	}
+	if app := clientapp.FromContext(ctx); app != nil && !app.AllowsTFA(option) {
+		return nil, auth.ErrForbidden("client application requires stronger two-factor authentication")
+	}
+
+	factors, err := s.authorize(preAuthToken, option)
+	if err != nil {
+		return nil, err
+	}
+
+	if preAuthToken.CodeHash != "" {
+		err = s.otp.ValidateOTP(req.Code, preAuthToken.CodeHash)
 	} else {
 		err = s.otp.ValidateTOTP(ctx, user, req.Code)
 	}
@@ -139,7 +477,16 @@ func (s *service) VerifyCode(w http.ResponseWriter, r *http.Request) (interface{
 		return nil, err
 	}
 
-	jwtToken, err := s.token.Create(ctx, user, auth.JWTAuthorized)
+	jwtToken, err := s.token.Create(
+		ctx,
+		user,
+		auth.JWTAuthorized,
+		token.WithAudiences(preAuthToken.Audiences...),
+		token.WithScopes(preAuthToken.Scopes...),
+		token.WithTTL(time.Duration(preAuthToken.TTL)*time.Second),
+		token.WithDeviceBinding(httpapi.GetDeviceID(r)),
+		token.WithAuthMethods(factors...),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -149,6 +496,7 @@ func (s *service) VerifyCode(w http.ResponseWriter, r *http.Request) (interface{
 		TokenID:   jwtToken.Id,
 		ExpiresAt: s.token.RefreshableTill(ctx, jwtToken, jwtToken.RefreshToken),
 	}
+	httpapi.SetLoginOrigin(loginHistory, r)
 	if err = s.repoMngr.LoginHistory().Create(ctx, loginHistory); err != nil {
 		return nil, err
 	}
@@ -156,8 +504,15 @@ func (s *service) VerifyCode(w http.ResponseWriter, r *http.Request) (interface{
 	return s.respond(ctx, w, user, jwtToken)
 }
 
-// respond creates a JWT token response.
-func (s *service) respond(ctx context.Context, w http.ResponseWriter, _ *auth.User, jwtToken *auth.Token) (*token.Response, error) {
+// respond creates a JWT token response. Hooks.AfterLogin is run
+// before an authorized token is returned.
+func (s *service) respond(ctx context.Context, w http.ResponseWriter, user *auth.User, jwtToken *auth.Token) (*token.Response, error) {
+	if jwtToken.State == auth.JWTAuthorized {
+		if err := s.hooks.AfterLogin(ctx, user, jwtToken); err != nil {
+			return nil, err
+		}
+	}
+
 	tokenStr, err := s.token.Sign(ctx, jwtToken)
 	if err != nil {
 		return nil, err
@@ -167,7 +522,9 @@ func (s *service) respond(ctx context.Context, w http.ResponseWriter, _ *auth.Us
 		http.SetCookie(w, cookie)
 	}
 
-	if jwtToken.CodeHash != "" {
+	// Tokens reusing a code delivered moments ago carry no code
+	// to deliver.
+	if jwtToken.Code != "" {
 		h, err := otp.FromOTPHash(jwtToken.CodeHash)
 		if err != nil {
 			return nil, fmt.Errorf("invalid OTP created: %w", err)
@@ -185,8 +542,10 @@ func (s *service) respond(ctx context.Context, w http.ResponseWriter, _ *auth.Us
 	}
 
 	resp := token.Response{
-		Token:    tokenStr,
-		ClientID: jwtToken.ClientID,
+		Token:      tokenStr,
+		ClientID:   jwtToken.ClientID,
+		State:      jwtToken.State,
+		TFAOptions: jwtToken.TFAOptions,
 	}
 	if jwtToken.State == auth.JWTAuthorized {
 		resp.RefreshToken = jwtToken.RefreshToken
@@ -194,3 +553,15 @@ func (s *service) respond(ctx context.Context, w http.ResponseWriter, _ *auth.Us
 
 	return &resp, nil
 }
+
+// recordFailure records a failed login attempt for anomaly detection.
+// Failures to record are logged and do not affect the response.
+func (s *service) recordFailure(ctx context.Context, r *http.Request, identity string) {
+	if err := s.anomaly.RecordFailure(ctx, httpapi.GetIP(r), identity); err != nil {
+		level.Error(s.logger).Log(
+			"source", "LoginAPI.Login",
+			"message", "failed to record login failure",
+			"error", err,
+		)
+	}
+}
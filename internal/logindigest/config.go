@@ -0,0 +1,84 @@
+package logindigest
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/featureflag"
+)
+
+const (
+	defaultPeriod    = time.Hour * 24 * 7
+	defaultInterval  = time.Hour
+	defaultBatchSize = 100
+	defaultMaxItems  = 50
+)
+
+// NewService returns a new LoginDigestService. Without a
+// RepositoryManager and MessagingService, no digests are sent.
+func NewService(options ...ConfigOption) auth.LoginDigestService {
+	s := service{
+		logger:    log.NewNopLogger(),
+		period:    defaultPeriod,
+		interval:  defaultInterval,
+		batchSize: defaultBatchSize,
+		maxItems:  defaultMaxItems,
+		features:  featureflag.NewService(),
+		now:       time.Now,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithRepoManager configures the service with a new RepositoryManager.
+func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
+	return func(s *service) {
+		s.repoMngr = repoMngr
+	}
+}
+
+// WithMessaging configures the service with a MessagingService.
+func WithMessaging(m auth.MessagingService) ConfigOption {
+	return func(s *service) {
+		s.message = m
+	}
+}
+
+// WithSchedule configures how often subscribers receive a digest
+// and how often due digests are checked.
+func WithSchedule(period, interval time.Duration) ConfigOption {
+	return func(s *service) {
+		s.period = period
+		s.interval = interval
+	}
+}
+
+// WithBatchSize configures the maximum digests sent per interval.
+func WithBatchSize(n int) ConfigOption {
+	return func(s *service) {
+		s.batchSize = n
+	}
+}
+
+// WithFeatureFlags configures the service with a FeatureFlagService.
+func WithFeatureFlags(f auth.FeatureFlagService) ConfigOption {
+	return func(s *service) {
+		s.features = f
+	}
+}
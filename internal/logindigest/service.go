@@ -0,0 +1,158 @@
+// Package logindigest sends subscribed users periodic digests
+// of recent sign-ins and new devices.
+package logindigest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// timeFormat is the format of timestamps listed in a digest.
+const timeFormat = "Jan 2, 2006 15:04 MST"
+
+// escaper escapes user provided content. Braces are escaped to
+// avoid being interpreted as template variables.
+var escaper = strings.NewReplacer(
+	"&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&#34;", "'", "&#39;",
+	"{", "&#123;", "}", "&#125;",
+)
+
+// service is an implementation of auth.LoginDigestService.
+type service struct {
+	logger    log.Logger
+	repoMngr  auth.RepositoryManager
+	message   auth.MessagingService
+	period    time.Duration
+	interval  time.Duration
+	batchSize int
+	maxItems  int
+	features  auth.FeatureFlagService
+	now       func() time.Time
+}
+
+// Run periodically sends due digests until the context is cancelled.
+func (s *service) Run(ctx context.Context) error {
+	if s.repoMngr == nil || s.message == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := s.SendDue(ctx); err != nil {
+				level.Error(s.logger).Log(
+					"source", "LoginDigestService.Run",
+					"message", "failed to send login digests",
+					"error", err,
+				)
+			}
+		}
+	}
+}
+
+// SendDue sends digests to subscribers who have not received
+// one within the configured period. Nothing is sent while the
+// login digest feature is disabled or during maintenance.
+func (s *service) SendDue(ctx context.Context) error {
+	if !s.features.Enabled(ctx, auth.FeatureLoginDigest) ||
+		s.features.Enabled(ctx, auth.FeatureMaintenance) {
+		return nil
+	}
+
+	now := s.now()
+
+	subs, err := s.repoMngr.LoginDigest().Due(ctx, now.Add(-s.period), s.batchSize)
+	if err != nil {
+		return fmt.Errorf("cannot retrieve due digests: %w", err)
+	}
+
+	for _, sub := range subs {
+		if err = s.send(ctx, sub, now); err != nil {
+			level.Error(s.logger).Log(
+				"source", "LoginDigestService.SendDue",
+				"message", "failed to send login digest",
+				"user_id", sub.UserID,
+				"error", err,
+			)
+		}
+	}
+
+	return nil
+}
+
+// send delivers a digest of activity since the subscription was last
+// sent. Users without an email address or recent activity are skipped
+// until the next period.
+func (s *service) send(ctx context.Context, sub *auth.LoginDigestSubscription, now time.Time) error {
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", sub.UserID)
+	if err != nil {
+		return fmt.Errorf("cannot retrieve user: %w", err)
+	}
+
+	if user.Email.String == "" {
+		return s.repoMngr.LoginDigest().MarkSent(ctx, sub.UserID, now)
+	}
+
+	logins, err := s.repoMngr.LoginHistory().ByUserID(ctx, sub.UserID, s.maxItems, 0)
+	if err != nil {
+		return fmt.Errorf("cannot retrieve login history: %w", err)
+	}
+
+	devices, err := s.repoMngr.Device().ByUserID(ctx, sub.UserID)
+	if err != nil {
+		return fmt.Errorf("cannot retrieve devices: %w", err)
+	}
+
+	var loginItems, deviceItems []string
+	for _, l := range logins {
+		if l != nil && l.CreatedAt.After(sub.LastSentAt) {
+			loginItems = append(loginItems, l.CreatedAt.UTC().Format(timeFormat))
+		}
+	}
+	for _, d := range devices {
+		if d != nil && d.CreatedAt.After(sub.LastSentAt) {
+			deviceItems = append(deviceItems, fmt.Sprintf(
+				"%s (%s)", escaper.Replace(d.Name), d.CreatedAt.UTC().Format(timeFormat),
+			))
+		}
+	}
+
+	if len(loginItems) > 0 || len(deviceItems) > 0 {
+		msg := &auth.Message{
+			Type:     auth.LoginDigest,
+			Delivery: auth.Email,
+			Address:  user.Email.String,
+			Vars: map[string]string{
+				"since":   sub.LastSentAt.UTC().Format(timeFormat),
+				"logins":  listItems(loginItems, "No new sign-ins"),
+				"devices": listItems(deviceItems, "No new devices"),
+			},
+		}
+		if err = s.message.Send(ctx, msg); err != nil {
+			return fmt.Errorf("cannot send digest: %w", err)
+		}
+	}
+
+	return s.repoMngr.LoginDigest().MarkSent(ctx, sub.UserID, now)
+}
+
+// listItems formats items as an HTML list.
+func listItems(items []string, empty string) string {
+	if len(items) == 0 {
+		return fmt.Sprintf("<li>%s</li>", empty)
+	}
+	return "<li>" + strings.Join(items, "</li><li>") + "</li>"
+}
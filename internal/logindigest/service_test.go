@@ -0,0 +1,152 @@
+package logindigest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestLoginDigestSvc_SendDue(t *testing.T) {
+	now := time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC)
+	lastSent := now.Add(-time.Hour * 24 * 7)
+
+	tt := []struct {
+		name          string
+		user          *auth.User
+		logins        []*auth.LoginHistory
+		devices       []*auth.Device
+		sendFn        func() error
+		sendCalls     int
+		markSentCalls int
+		content       []string
+	}{
+		{
+			name: "Sends digest of new activity",
+			user: &auth.User{Email: sql.NullString{String: "jane@example.com", Valid: true}},
+			logins: []*auth.LoginHistory{
+				{CreatedAt: now.Add(-time.Hour)},
+				{CreatedAt: lastSent.Add(-time.Hour)},
+			},
+			devices: []*auth.Device{
+				{Name: "Yubikey <5C>", CreatedAt: now.Add(-time.Hour)},
+			},
+			sendCalls:     1,
+			markSentCalls: 1,
+			content:       []string{"Aug 9, 2020 23:00 UTC", "Yubikey &lt;5C&gt;"},
+		},
+		{
+			name: "Skips digest without activity",
+			user: &auth.User{Email: sql.NullString{String: "jane@example.com", Valid: true}},
+			logins: []*auth.LoginHistory{
+				{CreatedAt: lastSent.Add(-time.Hour)},
+			},
+			sendCalls:     0,
+			markSentCalls: 1,
+		},
+		{
+			name: "Skips user without email",
+			user: &auth.User{Phone: sql.NullString{String: "+15555555555", Valid: true}},
+			logins: []*auth.LoginHistory{
+				{CreatedAt: now.Add(-time.Hour)},
+			},
+			sendCalls:     0,
+			markSentCalls: 1,
+		},
+		{
+			name: "Retries failed delivery",
+			user: &auth.User{Email: sql.NullString{String: "jane@example.com", Valid: true}},
+			logins: []*auth.LoginHistory{
+				{CreatedAt: now.Add(-time.Hour)},
+			},
+			sendFn: func() error {
+				return fmt.Errorf("whoops")
+			},
+			sendCalls:     1,
+			markSentCalls: 0,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			digestRepo := &test.LoginDigestRepository{
+				DueFn: func() ([]*auth.LoginDigestSubscription, error) {
+					return []*auth.LoginDigestSubscription{
+						{UserID: "user-id", LastSentAt: lastSent},
+					}, nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				LoginDigestFn: func() auth.LoginDigestRepository {
+					return digestRepo
+				},
+				UserFn: func() auth.UserRepository {
+					return &test.UserRepository{
+						ByIdentityFn: func() (*auth.User, error) {
+							return tc.user, nil
+						},
+					}
+				},
+				LoginHistoryFn: func() auth.LoginHistoryRepository {
+					return &test.LoginHistoryRepository{
+						ByUserIDFn: func() ([]*auth.LoginHistory, error) {
+							return tc.logins, nil
+						},
+					}
+				},
+				DeviceFn: func() auth.DeviceRepository {
+					return &test.DeviceRepository{
+						ByUserIDFn: func() ([]*auth.Device, error) {
+							return tc.devices, nil
+						},
+					}
+				},
+			}
+
+			var content string
+			messagingSvc := &test.MessagingService{SendFn: tc.sendFn}
+			msgSvc := &messageRecorder{MessagingService: messagingSvc, content: &content}
+
+			s := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+				WithMessaging(msgSvc),
+			).(*service)
+			s.now = func() time.Time { return now }
+
+			if err := s.SendDue(context.Background()); err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+
+			if messagingSvc.Calls.Send != tc.sendCalls {
+				t.Errorf("incorrect MessagingService.Send() call count, want %v got %v",
+					tc.sendCalls, messagingSvc.Calls.Send)
+			}
+			if digestRepo.Calls.MarkSent != tc.markSentCalls {
+				t.Errorf("incorrect LoginDigestRepository.MarkSent() call count, want %v got %v",
+					tc.markSentCalls, digestRepo.Calls.MarkSent)
+			}
+			for _, c := range tc.content {
+				if !strings.Contains(content, c) {
+					t.Errorf("digest does not contain %s: %s", c, content)
+				}
+			}
+		})
+	}
+}
+
+// messageRecorder records the variables of sent messages.
+type messageRecorder struct {
+	*test.MessagingService
+	content *string
+}
+
+func (m *messageRecorder) Send(ctx context.Context, msg *auth.Message) error {
+	*m.content = msg.Vars["logins"] + msg.Vars["devices"]
+	return m.MessagingService.Send(ctx, msg)
+}
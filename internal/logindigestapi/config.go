@@ -0,0 +1,46 @@
+package logindigestapi
+
+import (
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/featureflag"
+)
+
+// NewService returns a new implementation of auth.LoginDigestAPI.
+func NewService(options ...ConfigOption) auth.LoginDigestAPI {
+	s := service{
+		logger:   log.NewNopLogger(),
+		features: featureflag.NewService(),
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithRepoManager configures the service with a new RepositoryManager.
+func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
+	return func(s *service) {
+		s.repoMngr = repoMngr
+	}
+}
+
+// WithFeatureFlags configures the service with a FeatureFlagService.
+func WithFeatureFlags(f auth.FeatureFlagService) ConfigOption {
+	return func(s *service) {
+		s.features = f
+	}
+}
@@ -0,0 +1,121 @@
+package logindigestapi
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestLoginDigestAPI_Subscribe(t *testing.T) {
+	tt := []struct {
+		name        string
+		statusCode  int
+		authHeader  bool
+		errMessage  string
+		userFn      func() (*auth.User, error)
+		byUserIDFn  func() (*auth.LoginDigestSubscription, error)
+		createCalls int
+	}{
+		{
+			name:       "Authentication error with no token",
+			statusCode: http.StatusUnauthorized,
+			authHeader: false,
+			errMessage: "User is not authenticated",
+		},
+		{
+			name:       "User without email",
+			statusCode: http.StatusBadRequest,
+			authHeader: true,
+			errMessage: "An email address is required for login digests",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{Phone: sql.NullString{String: "+15555555555", Valid: true}}, nil
+			},
+		},
+		{
+			name:       "Already subscribed",
+			statusCode: http.StatusOK,
+			authHeader: true,
+			userFn: func() (*auth.User, error) {
+				return &auth.User{Email: sql.NullString{String: "jane@example.com", Valid: true}}, nil
+			},
+			byUserIDFn: func() (*auth.LoginDigestSubscription, error) {
+				return &auth.LoginDigestSubscription{UserID: "user-id"}, nil
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			authHeader: true,
+			userFn: func() (*auth.User, error) {
+				return &auth.User{Email: sql.NullString{String: "jane@example.com", Valid: true}}, nil
+			},
+			byUserIDFn: func() (*auth.LoginDigestSubscription, error) {
+				return nil, sql.ErrNoRows
+			},
+			createCalls: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			digestRepo := &test.LoginDigestRepository{ByUserIDFn: tc.byUserIDFn}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return &test.UserRepository{ByIdentityFn: tc.userFn}
+				},
+				LoginDigestFn: func() auth.LoginDigestRepository {
+					return digestRepo
+				},
+			}
+			tokenSvc := &test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+				},
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/login-digest", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			if tc.authHeader {
+				test.SetAuthHeaders(req)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if digestRepo.Calls.Create != tc.createCalls {
+				t.Errorf("incorrect LoginDigestRepository.Create() call count, want %v got %v",
+					tc.createCalls, digestRepo.Calls.Create)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package logindigestapi
+
+// Response is a success response describing a User's
+// login digest subscription.
+type Response struct {
+	Subscribed bool `json:"subscribed"`
+}
@@ -0,0 +1,66 @@
+// Package logindigestapi provides an HTTP API to manage login digest emails.
+package logindigestapi
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+type service struct {
+	logger   log.Logger
+	repoMngr auth.RepositoryManager
+	features auth.FeatureFlagService
+}
+
+// Subscribe opts a User in to login digest emails. Digests are
+// delivered by email and require an email address on the account.
+func (s *service) Subscribe(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	if !s.features.Enabled(ctx, auth.FeatureLoginDigest) {
+		return nil, auth.ErrForbidden("login digests are disabled")
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Email.String == "" {
+		return nil, auth.ErrBadRequest("an email address is required for login digests")
+	}
+
+	_, err = s.repoMngr.LoginDigest().ByUserID(ctx, userID)
+	if err == nil {
+		return &Response{Subscribed: true}, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	sub := &auth.LoginDigestSubscription{UserID: userID}
+	if err = s.repoMngr.LoginDigest().Create(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	return &Response{Subscribed: true}, nil
+}
+
+// Unsubscribe opts a User out of login digest emails.
+func (s *service) Unsubscribe(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	err := s.repoMngr.LoginDigest().Remove(ctx, userID)
+	if err != nil && auth.ErrorCode(err) != auth.ENotFound {
+		return nil, err
+	}
+
+	return &Response{Subscribed: false}, nil
+}
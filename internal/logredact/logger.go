@@ -0,0 +1,158 @@
+// Package logredact redacts personal information and credentials
+// from structured log values before they reach log aggregation.
+package logredact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Redacted replaces redacted log values.
+const Redacted = "[REDACTED]"
+
+// DefaultKeys are log keys whose values are always redacted. Keys
+// are matched case insensitively by suffix, so `otp_code` matches
+// `code`.
+var DefaultKeys = []string{
+	"password",
+	"secret",
+	"token",
+	"code",
+	"otp",
+	"authorization",
+	"cookie",
+	"email",
+	"phone",
+	"identity",
+	"recipient",
+}
+
+// DefaultPatterns match emails, phone numbers in international format
+// and JWT tokens within log values.
+var DefaultPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	regexp.MustCompile(`\+[1-9][0-9 ().\-]{6,18}[0-9]`),
+	regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`),
+}
+
+// redactor is a log.Logger which redacts values before passing
+// them on to another log.Logger.
+type redactor struct {
+	next     log.Logger
+	keys     []string
+	patterns []*regexp.Regexp
+}
+
+// NewLogger returns a log.Logger which redacts values of sensitive
+// keys and substrings matching sensitive patterns.
+func NewLogger(next log.Logger, options ...ConfigOption) log.Logger {
+	r := redactor{
+		next:     next,
+		keys:     DefaultKeys,
+		patterns: DefaultPatterns,
+	}
+
+	for _, opt := range options {
+		opt(&r)
+	}
+
+	return &r
+}
+
+// ConfigOption configures the logger.
+type ConfigOption func(*redactor)
+
+// WithKeys redacts the values of additional log keys. Blank keys
+// are ignored.
+func WithKeys(keys ...string) ConfigOption {
+	return func(r *redactor) {
+		merged := append([]string{}, r.keys...)
+		for _, key := range keys {
+			if key = strings.TrimSpace(key); key != "" {
+				merged = append(merged, key)
+			}
+		}
+		r.keys = merged
+	}
+}
+
+// WithPatterns redacts substrings of log values matching additional
+// regular expressions.
+func WithPatterns(patterns ...*regexp.Regexp) ConfigOption {
+	return func(r *redactor) {
+		r.patterns = append(append([]*regexp.Regexp{}, r.patterns...), patterns...)
+	}
+}
+
+// ParsePatterns compiles a list of regular expressions.
+func ParsePatterns(exprs []string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, expr := range exprs {
+		if expr == "" {
+			continue
+		}
+		p, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s: %w", expr, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// Log redacts keyvals and logs them with the next log.Logger.
+func (r *redactor) Log(keyvals ...interface{}) error {
+	redacted := make([]interface{}, len(keyvals))
+	for i := 0; i < len(keyvals); i += 2 {
+		redacted[i] = keyvals[i]
+		if i+1 >= len(keyvals) {
+			break
+		}
+
+		if r.isSensitiveKey(keyvals[i]) && keyvals[i+1] != nil {
+			redacted[i+1] = Redacted
+			continue
+		}
+		redacted[i+1] = r.redactValue(keyvals[i+1])
+	}
+
+	return r.next.Log(redacted...)
+}
+
+func (r *redactor) isSensitiveKey(key interface{}) bool {
+	k := strings.ToLower(fmt.Sprint(key))
+	for _, sensitive := range r.keys {
+		if strings.HasSuffix(k, strings.ToLower(sensitive)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue replaces sensitive substrings of text values. Values
+// which are not text are logged as is.
+func (r *redactor) redactValue(value interface{}) interface{} {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		return value
+	}
+
+	redacted := s
+	for _, p := range r.patterns {
+		redacted = p.ReplaceAllString(redacted, Redacted)
+	}
+	if redacted == s {
+		return value
+	}
+	return redacted
+}
@@ -0,0 +1,191 @@
+// Package logsink writes structured logs to configurable sinks:
+// stderr, rotating files, syslog and OTLP collectors.
+package logsink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Logger is a log.Logger which writes records to every configured
+// sink. Debug records may be sampled by source to reduce noise.
+type Logger struct {
+	loggers []log.Logger
+	closers []io.Closer
+	otlp    *otlpExporter
+	sampler *sampler
+}
+
+// config holds the sinks to be opened by NewLogger.
+type config struct {
+	writers []io.Writer
+	file    *fileConfig
+	syslog  *syslogConfig
+	otlp    *otlpConfig
+	rates   map[string]int
+}
+
+type fileConfig struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+}
+
+type syslogConfig struct {
+	network string
+	addr    string
+	tag     string
+}
+
+type otlpConfig struct {
+	endpoint      string
+	serviceName   string
+	flushInterval time.Duration
+	client        *http.Client
+}
+
+// ConfigOption configures the Logger.
+type ConfigOption func(*config)
+
+// WithWriter writes JSON records to a writer, such as stderr.
+func WithWriter(w io.Writer) ConfigOption {
+	return func(c *config) {
+		c.writers = append(c.writers, w)
+	}
+}
+
+// WithFile writes JSON records to a file which is rotated once
+// it exceeds maxSize bytes. Up to maxBackups rotated files are kept.
+func WithFile(path string, maxSize int64, maxBackups int) ConfigOption {
+	return func(c *config) {
+		c.file = &fileConfig{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	}
+}
+
+// WithSyslog writes JSON records to a syslog daemon. The local
+// daemon is used if network and addr are empty.
+func WithSyslog(network, addr, tag string) ConfigOption {
+	return func(c *config) {
+		c.syslog = &syslogConfig{network: network, addr: addr, tag: tag}
+	}
+}
+
+// WithOTLP exports records in batches to an OTLP/HTTP logs endpoint,
+// such as http://localhost:4318/v1/logs.
+func WithOTLP(endpoint, serviceName string, flushInterval time.Duration, client *http.Client) ConfigOption {
+	return func(c *config) {
+		if client == nil {
+			client = &http.Client{Timeout: time.Second * 10}
+		}
+		c.otlp = &otlpConfig{
+			endpoint:      endpoint,
+			serviceName:   serviceName,
+			flushInterval: flushInterval,
+			client:        client,
+		}
+	}
+}
+
+// WithDebugSampling logs one in every n debug records of a source,
+// where rates maps the `source` value of records to n.
+func WithDebugSampling(rates map[string]int) ConfigOption {
+	return func(c *config) {
+		c.rates = rates
+	}
+}
+
+// NewLogger opens the configured sinks and returns a Logger writing
+// to all of them. Records are discarded if no sink is configured.
+func NewLogger(options ...ConfigOption) (*Logger, error) {
+	var c config
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	var l Logger
+	writers := c.writers
+
+	if c.file != nil {
+		f, err := newRotatingFile(c.file.path, c.file.maxSize, c.file.maxBackups)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, f)
+		l.closers = append(l.closers, f)
+	}
+
+	if c.syslog != nil {
+		w, err := newSyslog(c.syslog.network, c.syslog.addr, c.syslog.tag)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		writers = append(writers, w)
+		l.closers = append(l.closers, w)
+	}
+
+	for _, w := range writers {
+		l.loggers = append(l.loggers, log.NewJSONLogger(log.NewSyncWriter(w)))
+	}
+
+	if c.otlp != nil {
+		l.otlp = newOTLPExporter(c.otlp)
+		l.loggers = append(l.loggers, l.otlp)
+	}
+
+	if len(c.rates) > 0 {
+		l.sampler = newSampler(c.rates)
+	}
+
+	return &l, nil
+}
+
+// Log writes a record to every sink, returning the first error
+// encountered.
+func (l *Logger) Log(keyvals ...interface{}) error {
+	if l.sampler != nil && !l.sampler.allow(keyvals) {
+		return nil
+	}
+
+	var firstErr error
+	for _, logger := range l.loggers {
+		if err := logger.Log(keyvals...); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Run exports OTLP records periodically until the context is
+// cancelled.
+func (l *Logger) Run(ctx context.Context) error {
+	if l.otlp == nil {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return l.otlp.run(ctx)
+}
+
+// Close exports pending OTLP records and closes file and syslog sinks.
+func (l *Logger) Close() error {
+	var firstErr error
+	if l.otlp != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		firstErr = l.otlp.flush(ctx)
+		cancel()
+	}
+	for _, c := range l.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf("failed to close log sinks: %w", firstErr)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package logsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+func TestLogger_File(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logsink")
+	if err != nil {
+		t.Fatal("failed to create directory:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "api.log")
+	logger, err := NewLogger(WithFile(path, 100, 2))
+	if err != nil {
+		t.Fatal("failed to create logger:", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err = logger.Log("message", "rotated record", "n", i); err != nil {
+			t.Fatal("failed to log:", err)
+		}
+	}
+	if err = logger.Close(); err != nil {
+		t.Fatal("failed to close logger:", err)
+	}
+
+	for _, name := range []string{"api.log", "api.log.1", "api.log.2"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal("failed to read log file:", err)
+		}
+		if len(b) == 0 || len(b) > 100 {
+			t.Errorf("incorrect size of %s: %v", name, len(b))
+		}
+	}
+	if _, err = os.Stat(filepath.Join(dir, "api.log.3")); !os.IsNotExist(err) {
+		t.Error("expected only 2 backups to be kept")
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("failed to read log file:", err)
+	}
+	if !strings.Contains(string(b), `"n":9`) {
+		t.Errorf("expected latest record in log file, got %s", b)
+	}
+}
+
+func TestLogger_DebugSampling(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(
+		WithWriter(&buf),
+		WithDebugSampling(map[string]int{"httpapi.RateLimiter": 3}),
+	)
+	if err != nil {
+		t.Fatal("failed to create logger:", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		level.Debug(logger).Log("message", "noisy", "source", "httpapi.RateLimiter")
+		level.Info(logger).Log("message", "info", "source", "httpapi.RateLimiter")
+		level.Debug(logger).Log("message", "quiet", "source", "loginapi.Login")
+	}
+
+	out := buf.String()
+	for msg, want := range map[string]int{"noisy": 2, "info": 6, "quiet": 6} {
+		if got := strings.Count(out, `"message":"`+msg+`"`); got != want {
+			t.Errorf("incorrect count of %s records, want %v got %v", msg, want, got)
+		}
+	}
+}
+
+func TestParseSampling(t *testing.T) {
+	rates, err := ParseSampling("httpapi.RateLimiter=100, msgconsumer.Run=10")
+	if err != nil {
+		t.Fatal("expected nil error, got:", err)
+	}
+	if rates["httpapi.RateLimiter"] != 100 || rates["msgconsumer.Run"] != 10 {
+		t.Errorf("incorrect sampling rates: %v", rates)
+	}
+
+	for _, s := range []string{"httpapi.RateLimiter", "httpapi.RateLimiter=0", "=10"} {
+		if _, err = ParseSampling(s); err == nil {
+			t.Errorf("expected error for %s, got nil", s)
+		}
+	}
+}
+
+func TestLogger_OTLP(t *testing.T) {
+	var payloads []map[string]interface{}
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusOK {
+			var payload map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				t.Error("invalid payload:", err)
+			}
+			payloads = append(payloads, payload)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	logger, err := NewLogger(WithOTLP(server.URL, "authenticator", 0, nil))
+	if err != nil {
+		t.Fatal("failed to create logger:", err)
+	}
+
+	level.Warn(logger).Log("message", "login failed", "source", "loginapi.Login")
+	if err = logger.otlp.flush(context.Background()); err == nil {
+		t.Error("expected export error, got nil")
+	}
+
+	// Records are retained until the collector is available.
+	status = http.StatusOK
+	if err = logger.Close(); err != nil {
+		t.Fatal("failed to close logger:", err)
+	}
+	if len(payloads) != 1 {
+		t.Fatalf("incorrect number of exports, want 1 got %v", len(payloads))
+	}
+
+	b, err := json.Marshal(payloads[0])
+	if err != nil {
+		t.Fatal("failed to encode payload:", err)
+	}
+	for _, s := range []string{
+		`"severityText":"warn"`,
+		`"severityNumber":13`,
+		`"body":{"stringValue":"login failed"}`,
+		`{"key":"source","value":{"stringValue":"loginapi.Login"}}`,
+		`{"key":"service.name","value":{"stringValue":"authenticator"}}`,
+	} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("expected %s in payload, got %s", s, b)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package logsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+const (
+	// otlpBatchSize is the number of records exported per request.
+	otlpBatchSize = 512
+	// otlpMaxPending is the number of records held before new
+	// records are dropped while the collector is unavailable.
+	otlpMaxPending = otlpBatchSize * 20
+)
+
+// OTLP severity numbers of go-kit levels.
+var otlpSeverity = map[string]int{
+	"debug": 5,
+	"info":  9,
+	"warn":  13,
+	"error": 17,
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpRecord struct {
+	TimeUnixNano   string          `json:"timeUnixNano"`
+	SeverityNumber int             `json:"severityNumber,omitempty"`
+	SeverityText   string          `json:"severityText,omitempty"`
+	Body           otlpValue       `json:"body"`
+	Attributes     []otlpAttribute `json:"attributes"`
+}
+
+// otlpExporter is a log.Logger which holds records until they are
+// exported to an OTLP/HTTP logs endpoint with JSON encoding.
+type otlpExporter struct {
+	endpoint      string
+	serviceName   string
+	flushInterval time.Duration
+	client        *http.Client
+	full          chan struct{}
+
+	mu      sync.Mutex
+	pending []otlpRecord
+	dropped int
+}
+
+func newOTLPExporter(c *otlpConfig) *otlpExporter {
+	interval := c.flushInterval
+	if interval <= 0 {
+		interval = time.Second * 5
+	}
+	return &otlpExporter{
+		endpoint:      c.endpoint,
+		serviceName:   c.serviceName,
+		flushInterval: interval,
+		client:        c.client,
+		full:          make(chan struct{}, 1),
+	}
+}
+
+// Log converts keyvals to an OTLP record. The `message` value is the
+// record body and remaining values are attributes.
+func (e *otlpExporter) Log(keyvals ...interface{}) error {
+	r := otlpRecord{
+		TimeUnixNano: strconv.FormatInt(time.Now().UnixNano(), 10),
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		var value interface{} = log.ErrMissingValue
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+
+		switch {
+		case key == "message":
+			r.Body.StringValue = fmt.Sprint(value)
+		case keyvals[i] == level.Key():
+			r.SeverityText = fmt.Sprint(value)
+			r.SeverityNumber = otlpSeverity[r.SeverityText]
+		default:
+			r.Attributes = append(r.Attributes, otlpAttribute{
+				Key:   key,
+				Value: otlpValue{StringValue: fmt.Sprint(value)},
+			})
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.pending) >= otlpMaxPending {
+		e.dropped++
+		return nil
+	}
+	e.pending = append(e.pending, r)
+	if len(e.pending) >= otlpBatchSize {
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// run exports records periodically, or once a batch is full, until
+// the context is cancelled.
+func (e *otlpExporter) run(ctx context.Context) error {
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-e.full:
+		}
+		// Records which fail to export are retried on the next
+		// flush, so errors are not reported through the Logger.
+		e.flush(ctx)
+	}
+}
+
+// flush exports pending records in batches. Records of a failed
+// batch remain pending.
+func (e *otlpExporter) flush(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		n := len(e.pending)
+		if n > otlpBatchSize {
+			n = otlpBatchSize
+		}
+		batch := e.pending[:n]
+		dropped := e.dropped
+		e.mu.Unlock()
+
+		if n == 0 && dropped == 0 {
+			return nil
+		}
+		if dropped > 0 {
+			batch = append(batch[:n:n], otlpRecord{
+				TimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+				SeverityNumber: otlpSeverity["warn"],
+				SeverityText:   "warn",
+				Body:           otlpValue{StringValue: fmt.Sprintf("dropped %d log records", dropped)},
+			})
+		}
+
+		if err := e.export(ctx, batch); err != nil {
+			return err
+		}
+
+		e.mu.Lock()
+		e.pending = e.pending[n:]
+		e.dropped -= dropped
+		e.mu.Unlock()
+	}
+}
+
+func (e *otlpExporter) export(ctx context.Context, records []otlpRecord) error {
+	payload := map[string]interface{}{
+		"resourceLogs": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpAttribute{
+						{Key: "service.name", Value: otlpValue{StringValue: e.serviceName}},
+					},
+				},
+				"scopeLogs": []interface{}{
+					map[string]interface{}{
+						"scope":      map[string]string{"name": "github.com/fmitra/authenticator"},
+						"logRecords": records,
+					},
+				},
+			},
+		},
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("cannot encode log records: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("cannot create log export request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot export log records: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("cannot export log records: status %d", resp.StatusCode)
+	}
+	return nil
+}
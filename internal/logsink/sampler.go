@@ -0,0 +1,76 @@
+package logsink
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// sampler passes one in every n debug records of a source.
+type sampler struct {
+	mu     sync.Mutex
+	rates  map[string]int
+	counts map[string]int
+}
+
+func newSampler(rates map[string]int) *sampler {
+	return &sampler{
+		rates:  rates,
+		counts: make(map[string]int),
+	}
+}
+
+// ParseSampling parses a comma separated list of debug sampling rates
+// in the format `source=n`.
+func ParseSampling(s string) (map[string]int, error) {
+	rates := make(map[string]int)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("sampling rate must be in the format source=n")
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid sampling rate for %s", parts[0])
+		}
+
+		rates[parts[0]] = n
+	}
+
+	return rates, nil
+}
+
+// allow reports whether a record should be logged. Records other
+// than debug records are always logged.
+func (s *sampler) allow(keyvals []interface{}) bool {
+	var isDebug bool
+	var source string
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		switch keyvals[i] {
+		case level.Key():
+			isDebug = keyvals[i+1] == level.DebugValue()
+		case "source":
+			source = fmt.Sprint(keyvals[i+1])
+		}
+	}
+
+	n, ok := s.rates[source]
+	if !isDebug || !ok || n <= 1 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := s.counts[source]
+	s.counts[source] = (count + 1) % n
+	return count == 0
+}
@@ -0,0 +1,18 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package logsink
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+)
+
+func newSyslog(network, addr, tag string) (io.WriteCloser, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to syslog: %w", err)
+	}
+	return w, nil
+}
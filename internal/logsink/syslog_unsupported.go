@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package logsink
+
+import (
+	"fmt"
+	"io"
+)
+
+func newSyslog(network, addr, tag string) (io.WriteCloser, error) {
+	return nil, fmt.Errorf("syslog is not supported on this platform")
+}
@@ -1,15 +1,41 @@
 package mail
 
 import (
+	"crypto"
+	"crypto/tls"
 	"net/smtp"
+	"time"
 
 	auth "github.com/fmitra/authenticator"
 )
 
+const (
+	// defaultTimeout is the default time to connect to the mail server
+	// and to deliver a message.
+	defaultTimeout = time.Second * 30
+	// defaultIdleTimeout is the default time an idle connection is
+	// kept open for reuse.
+	defaultIdleTimeout = time.Second * 30
+	// defaultMaxIdle is the default number of idle connections
+	// kept open for reuse.
+	defaultMaxIdle = 2
+)
+
 // NewService returns a new mailing service.
-func NewService(configuration ConfigOption) auth.Emailer {
-	s := service{}
-	configuration(&s)
+func NewService(options ...ConfigOption) auth.Emailer {
+	s := service{
+		pool: pool{
+			tlsMode:     TLSOpportunistic,
+			timeout:     defaultTimeout,
+			idleTimeout: defaultIdleTimeout,
+			maxIdle:     defaultMaxIdle,
+			now:         time.Now,
+		},
+		now: time.Now,
+	}
+	for _, opt := range options {
+		opt(&s)
+	}
 	return &s
 }
 
@@ -35,12 +61,52 @@ func WithConfig(config Config) ConfigOption {
 }
 
 // WithDefaults configures the service with a default
-// mailer (net/smtp)
+// mailer (net/smtp) sending mail over pooled connections.
 func WithDefaults(serverAddr, fromAddr string, auth smtp.Auth) ConfigOption {
 	return func(s *service) {
 		s.serverAddr = serverAddr
 		s.fromAddr = fromAddr
 		s.auth = auth
-		s.mailFn = smtp.SendMail
+		s.mailFn = s.pool.sendMail
+	}
+}
+
+// WithTLS configures how connections to the mail server are secured.
+// The TLS config is optional and defaults to verifying the certificate
+// of the mail server's host.
+func WithTLS(mode TLSMode, config *tls.Config) ConfigOption {
+	return func(s *service) {
+		s.pool.tlsMode = mode
+		s.pool.tlsConfig = config
+	}
+}
+
+// WithTimeout configures the time to connect to the mail server
+// and to deliver each message.
+func WithTimeout(d time.Duration) ConfigOption {
+	return func(s *service) {
+		s.pool.timeout = d
+	}
+}
+
+// WithMaxIdleConns configures the number of idle connections kept
+// open for reuse. Connections are not reused if it is 0.
+func WithMaxIdleConns(n int) ConfigOption {
+	return func(s *service) {
+		s.pool.maxIdle = n
+	}
+}
+
+// WithDKIM configures the service to sign outgoing mail with DKIM.
+// The public key must be published in DNS at
+// `<selector>._domainkey.<domain>`.
+func WithDKIM(domain, selector string, key crypto.Signer) ConfigOption {
+	return func(s *service) {
+		s.dkim = &dkimSigner{
+			domain:   domain,
+			selector: selector,
+			key:      key,
+			now:      time.Now,
+		}
 	}
 }
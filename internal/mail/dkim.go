@@ -0,0 +1,185 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dkimHeaders are the headers covered by a DKIM signature.
+var dkimHeaders = []string{
+	"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type",
+}
+
+// dkimSigner signs messages with DKIM (RFC 6376) using relaxed header
+// and body canonicalization.
+type dkimSigner struct {
+	domain   string
+	selector string
+	key      crypto.Signer
+	now      func() time.Time
+}
+
+// ParseDKIMKey parses a PEM encoded RSA or Ed25519 private key to
+// sign messages with.
+func ParseDKIMKey(b []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded key found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// sign returns a message with a DKIM-Signature header prepended. The
+// message must use CRLF line endings.
+func (d *dkimSigner) sign(msg []byte) ([]byte, error) {
+	header, body := splitMessage(msg)
+
+	algorithm := "rsa-sha256"
+	if _, ok := d.key.(ed25519.PrivateKey); ok {
+		algorithm = "ed25519-sha256"
+	}
+
+	fields := parseHeader(header)
+	signed := make([]string, 0, len(dkimHeaders))
+	var canonical bytes.Buffer
+	for _, name := range dkimHeaders {
+		field, ok := fields[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		signed = append(signed, strings.ToLower(name))
+		canonical.WriteString(relaxedHeader(field))
+		canonical.WriteString("\r\n")
+	}
+
+	bodyHash := sha256.Sum256([]byte(relaxedBody(body)))
+	signature := fmt.Sprintf(
+		"DKIM-Signature: v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; t=%d; h=%s; bh=%s; b=",
+		algorithm,
+		d.domain,
+		d.selector,
+		d.now().Unix(),
+		strings.Join(signed, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]),
+	)
+	canonical.WriteString(relaxedHeader(signature))
+
+	hash := sha256.Sum256(canonical.Bytes())
+
+	var (
+		b   []byte
+		err error
+	)
+	if algorithm == "ed25519-sha256" {
+		b, err = d.key.Sign(rand.Reader, hash[:], crypto.Hash(0))
+	} else {
+		b, err = d.key.Sign(rand.Reader, hash[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+
+	signature = fmt.Sprintf("%s%s\r\n", signature, base64.StdEncoding.EncodeToString(b))
+	return append([]byte(signature), msg...), nil
+}
+
+// splitMessage splits a message into its header and body.
+func splitMessage(msg []byte) (string, string) {
+	s := string(msg)
+	i := strings.Index(s, "\r\n\r\n")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i+2], s[i+4:]
+}
+
+// parseHeader returns the last occurrence of each header field by its
+// lowercase name. Fields include their folded continuation lines.
+func parseHeader(header string) map[string]string {
+	fields := make(map[string]string)
+	var name, field string
+	for _, line := range strings.SplitAfter(header, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			field += line
+			fields[name] = strings.TrimSuffix(field, "\r\n")
+			continue
+		}
+		field = line
+		name = strings.ToLower(strings.TrimSpace(strings.SplitN(line, ":", 2)[0]))
+		fields[name] = strings.TrimSuffix(field, "\r\n")
+	}
+	return fields
+}
+
+// relaxedHeader canonicalizes a header field with the relaxed
+// algorithm of RFC 6376 section 3.4.2, without a trailing CRLF.
+func relaxedHeader(field string) string {
+	parts := strings.SplitN(field, ":", 2)
+	name := strings.ToLower(strings.TrimSpace(parts[0]))
+	value := ""
+	if len(parts) == 2 {
+		value = parts[1]
+	}
+
+	value = strings.Replace(value, "\r\n", "", -1)
+	value = strings.Join(strings.FieldsFunc(value, isWSP), " ")
+
+	return fmt.Sprintf("%s:%s", name, value)
+}
+
+// relaxedBody canonicalizes a message body with the relaxed
+// algorithm of RFC 6376 section 3.4.4.
+func relaxedBody(body string) string {
+	lines := strings.Split(body, "\r\n")
+	for i, line := range lines {
+		fields := strings.FieldsFunc(line, isWSP)
+		line = strings.Join(fields, " ")
+		if len(fields) > 0 && isWSP(rune(lines[i][0])) {
+			line = " " + line
+		}
+		lines[i] = line
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
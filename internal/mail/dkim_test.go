@@ -0,0 +1,177 @@
+package mail
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestMail_RelaxedCanonicalization(t *testing.T) {
+	// Examples from RFC 6376 section 3.4.5.
+	header := parseHeader("A: X\r\nB : Y\t\r\n\tZ  \r\n")
+	if got := relaxedHeader(header["a"]); got != "a:X" {
+		t.Errorf("incorrect canonical header, want %q got %q", "a:X", got)
+	}
+	if got := relaxedHeader(header["b"]); got != "b:Y Z" {
+		t.Errorf("incorrect canonical header, want %q got %q", "b:Y Z", got)
+	}
+
+	body := " C \r\nD \t E\r\n\r\n\r\n"
+	if got := relaxedBody(body); got != " C\r\nD E\r\n" {
+		t.Errorf("incorrect canonical body, want %q got %q", " C\r\nD E\r\n", got)
+	}
+	if got := relaxedBody("\r\n\r\n"); got != "" {
+		t.Errorf("incorrect canonical empty body, want empty got %q", got)
+	}
+}
+
+func TestMail_SignsDKIM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("failed to generate RSA key:", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate Ed25519 key:", err)
+	}
+
+	tt := []struct {
+		name      string
+		key       crypto.Signer
+		algorithm string
+		verify    func(hash, sig []byte) bool
+	}{
+		{
+			name:      "RSA key",
+			key:       rsaKey,
+			algorithm: "rsa-sha256",
+			verify: func(hash, sig []byte) bool {
+				return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, hash, sig) == nil
+			},
+		},
+		{
+			name:      "Ed25519 key",
+			key:       edKey,
+			algorithm: "ed25519-sha256",
+			verify: func(hash, sig []byte) bool {
+				return ed25519.Verify(edKey.Public().(ed25519.PublicKey), hash, sig)
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var content []byte
+			mailSvc := NewService(
+				WithConfig(Config{
+					serverAddr: "localhost:8000",
+					fromAddr:   "test@example.com",
+					mailFn: func(addr string, a smtp.Auth, f string, to []string, msg []byte) error {
+						content = msg
+						return nil
+					},
+				}),
+				WithDKIM("example.com", "mail", tc.key),
+			)
+
+			err := mailSvc.Email(context.Background(), "jane@example.com", "Hello", "<p>hello  world</p>\n")
+			if err != nil {
+				t.Fatal("expected nil error, received:", err)
+			}
+
+			header, body := splitMessage(content)
+			fields := parseHeader(header)
+			signature := fields["dkim-signature"]
+			tags := make(map[string]string)
+			for _, tag := range strings.Split(strings.TrimPrefix(signature, "DKIM-Signature: "), "; ") {
+				kv := strings.SplitN(tag, "=", 2)
+				tags[kv[0]] = kv[1]
+			}
+
+			if tags["a"] != tc.algorithm || tags["d"] != "example.com" || tags["s"] != "mail" {
+				t.Errorf("incorrect signature tags: %s", signature)
+			}
+			if tags["h"] != "from:to:subject:date:message-id:mime-version:content-type" {
+				t.Errorf("incorrect signed headers: %s", tags["h"])
+			}
+
+			bodyHash := sha256.Sum256([]byte("<p>hello world</p>\r\n"))
+			if tags["bh"] != base64.StdEncoding.EncodeToString(bodyHash[:]) {
+				t.Errorf("incorrect body hash for body %q", body)
+			}
+
+			var canonical strings.Builder
+			for _, name := range strings.Split(tags["h"], ":") {
+				canonical.WriteString(relaxedHeader(fields[name]) + "\r\n")
+			}
+			canonical.WriteString(relaxedHeader(strings.TrimSuffix(signature, tags["b"])))
+			hash := sha256.Sum256([]byte(canonical.String()))
+
+			sig, err := base64.StdEncoding.DecodeString(tags["b"])
+			if err != nil {
+				t.Fatal("invalid signature encoding:", err)
+			}
+			if !tc.verify(hash[:], sig) {
+				t.Error("invalid DKIM signature")
+			}
+		})
+	}
+}
+
+func TestMail_ParseDKIMKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("failed to generate RSA key:", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate Ed25519 key:", err)
+	}
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal("failed to marshal Ed25519 key:", err)
+	}
+
+	tt := []struct {
+		name     string
+		pem      []byte
+		hasError bool
+	}{
+		{
+			name: "PKCS1 RSA key",
+			pem: pem.EncodeToMemory(&pem.Block{
+				Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey),
+			}),
+		},
+		{
+			name: "PKCS8 Ed25519 key",
+			pem:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}),
+		},
+		{
+			name:     "Invalid key",
+			pem:      []byte("not a key"),
+			hasError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseDKIMKey(tc.pem)
+			if err != nil && !tc.hasError {
+				t.Error("expected nil error, received:", err)
+			}
+			if err == nil && tc.hasError {
+				t.Error("expected error, received nil")
+			}
+		})
+	}
+}
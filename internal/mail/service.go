@@ -3,24 +3,80 @@ package mail
 import (
 	"context"
 	"fmt"
+	"net/mail"
 	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/msgsender"
 )
 
+// messageIDSample are the characters of a random Message-ID.
+const messageIDSample = "abcdefghijklmnopqrstuvwxyz0123456789"
+
 type service struct {
 	serverAddr string
 	fromAddr   string
 	auth       smtp.Auth
 	mailFn     func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	pool       pool
+	dkim       *dkimSigner
+	now        func() time.Time
 }
 
 // Email delivers an email to an email address.
 func (s *service) Email(ctx context.Context, email, subject, message string) error {
-	mimeHeaders := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";"
+	from := mail.Address{Address: s.fromAddr}
+	if sender := msgsender.FromContext(ctx); sender.FromAddr != "" {
+		from = mail.Address{Name: sender.FromName, Address: sender.FromAddr}
+	}
+
+	messageID, err := s.messageID(from.Address)
+	if err != nil {
+		return err
+	}
+
 	content := []byte(
-		fmt.Sprintf("To: %s\r\n", email) +
+		fmt.Sprintf("From: %s\r\n", from.String()) +
+			fmt.Sprintf("To: %s\r\n", email) +
 			fmt.Sprintf("Subject: %s\r\n", subject) +
-			fmt.Sprintf("%s\n\n", mimeHeaders) +
-			message,
+			fmt.Sprintf("Date: %s\r\n", s.now().Format(time.RFC1123Z)) +
+			fmt.Sprintf("Message-ID: %s\r\n", messageID) +
+			"MIME-Version: 1.0\r\n" +
+			"Content-Type: text/html; charset=\"UTF-8\"\r\n" +
+			"\r\n" +
+			toCRLF(message),
 	)
-	return s.mailFn(s.serverAddr, s.auth, s.fromAddr, []string{email}, content)
+
+	if s.dkim != nil {
+		if content, err = s.dkim.sign(content); err != nil {
+			return err
+		}
+	}
+
+	return s.mailFn(s.serverAddr, s.auth, from.Address, []string{email}, content)
+}
+
+// messageID returns a unique Message-ID at the domain of
+// the sender.
+func (s *service) messageID(fromAddr string) (string, error) {
+	id, err := crypto.String(24, messageIDSample)
+	if err != nil {
+		return "", fmt.Errorf("failed to create message ID: %w", err)
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(fromAddr, "@"); at >= 0 {
+		domain = fromAddr[at+1:]
+	}
+
+	return fmt.Sprintf("<%s@%s>", id, domain), nil
+}
+
+// toCRLF converts the line endings of a message body to CRLF, as they
+// are sent by net/smtp, so the body is signed as it is delivered.
+func toCRLF(s string) string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	return strings.Replace(s, "\n", "\r\n", -1)
 }
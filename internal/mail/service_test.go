@@ -3,7 +3,11 @@ package mail
 import (
 	"context"
 	"net/smtp"
+	"strings"
 	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/msgsender"
 )
 
 func TestMail_SendsEmail(t *testing.T) {
@@ -20,3 +24,51 @@ func TestMail_SendsEmail(t *testing.T) {
 		t.Error("expected nil error, received:", err)
 	}
 }
+
+func TestMail_SendsFromSender(t *testing.T) {
+	tt := []struct {
+		name   string
+		sender auth.MessageSender
+		from   string
+		header string
+	}{
+		{
+			name:   "Default sender",
+			from:   "test@test.com",
+			header: "From: <test@test.com>\r\n",
+		},
+		{
+			name:   "Message sender",
+			sender: auth.MessageSender{FromAddr: "security@example.com", FromName: "Security"},
+			from:   "security@example.com",
+			header: "From: \"Security\" <security@example.com>\r\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var from string
+			var content []byte
+			mailSvc := NewService(WithConfig(Config{
+				serverAddr: "localhost:8000",
+				fromAddr:   "test@test.com",
+				mailFn: func(addr string, a smtp.Auth, f string, to []string, msg []byte) error {
+					from = f
+					content = msg
+					return nil
+				},
+			}))
+
+			ctx := msgsender.NewContext(context.Background(), tc.sender)
+			if err := mailSvc.Email(ctx, "jane@example.com", "Hello", "hello world"); err != nil {
+				t.Fatal("expected nil error, received:", err)
+			}
+			if from != tc.from {
+				t.Errorf("incorrect sender, want %s got %s", tc.from, from)
+			}
+			if !strings.HasPrefix(string(content), tc.header) {
+				t.Errorf("incorrect From header, want %q in %q", tc.header, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package mail
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"sync"
+	"time"
+)
+
+// TLSMode determines how connections to the mail server are secured.
+type TLSMode string
+
+const (
+	// TLSOpportunistic upgrades connections with STARTTLS if the
+	// server supports it.
+	TLSOpportunistic TLSMode = "opportunistic"
+	// TLSStartTLS requires connections to be upgraded with STARTTLS.
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects over TLS, typically on port 465.
+	TLSImplicit = "implicit"
+	// TLSNone does not secure connections.
+	TLSNone = "none"
+)
+
+// ParseTLSMode parses a TLSMode.
+func ParseTLSMode(s string) (TLSMode, error) {
+	mode := TLSMode(s)
+	switch mode {
+	case TLSOpportunistic, TLSStartTLS, TLSImplicit, TLSNone:
+		return mode, nil
+	case "":
+		return TLSOpportunistic, nil
+	default:
+		return "", fmt.Errorf("unsupported TLS mode %q", s)
+	}
+}
+
+// conn is an SMTP connection to a mail server.
+type conn struct {
+	netConn   net.Conn
+	client    *smtp.Client
+	idleSince time.Time
+}
+
+// pool sends mail over a pool of reusable connections to a mail
+// server. Connections are reset between messages and closed when
+// they have been idle for longer than the idle timeout.
+type pool struct {
+	tlsMode     TLSMode
+	tlsConfig   *tls.Config
+	timeout     time.Duration
+	idleTimeout time.Duration
+	maxIdle     int
+	now         func() time.Time
+
+	mu   sync.Mutex
+	idle []*conn
+}
+
+// sendMail sends a message to recipients as net/smtp's SendMail does,
+// reusing an idle connection if one is available.
+func (p *pool) sendMail(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	c, err := p.get(addr, a)
+	if err != nil {
+		return err
+	}
+
+	if err = p.transact(c, from, to, msg); err != nil {
+		c.client.Close()
+		return err
+	}
+
+	p.put(c)
+	return nil
+}
+
+func (p *pool) transact(c *conn, from string, to []string, msg []byte) error {
+	if err := c.netConn.SetDeadline(p.now().Add(p.timeout)); err != nil {
+		return err
+	}
+
+	if err := c.client.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := c.client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// get returns an idle connection or dials a new one. Idle connections
+// the server closed are discarded.
+func (p *pool) get(addr string, a smtp.Auth) (*conn, error) {
+	for {
+		c := p.pop()
+		if c == nil {
+			return p.dial(addr, a)
+		}
+
+		if p.now().Sub(c.idleSince) > p.idleTimeout {
+			c.client.Close()
+			continue
+		}
+
+		if err := c.netConn.SetDeadline(p.now().Add(p.timeout)); err != nil {
+			c.client.Close()
+			continue
+		}
+		if err := c.client.Reset(); err != nil {
+			c.client.Close()
+			continue
+		}
+
+		return c, nil
+	}
+}
+
+func (p *pool) pop() *conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.idle) == 0 {
+		return nil
+	}
+
+	c := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	return c
+}
+
+// put returns a connection to the pool, closing it if the pool
+// is full.
+func (p *pool) put(c *conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.idle) >= p.maxIdle {
+		_ = c.client.Quit()
+		return
+	}
+
+	c.idleSince = p.now()
+	p.idle = append(p.idle, c)
+}
+
+// dial connects and authenticates to a mail server.
+func (p *pool) dial(addr string, a smtp.Auth) (*conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mail server address: %w", err)
+	}
+
+	tlsConfig := &tls.Config{ServerName: host}
+	if p.tlsConfig != nil {
+		tlsConfig = p.tlsConfig.Clone()
+	}
+
+	dialer := &net.Dialer{Timeout: p.timeout}
+
+	var netConn net.Conn
+	if p.tlsMode == TLSImplicit {
+		netConn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		netConn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to mail server: %w", err)
+	}
+
+	if err = netConn.SetDeadline(p.now().Add(p.timeout)); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(netConn, host)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	if err = p.secure(client, tlsConfig); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if a != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("smtp: server doesn't support AUTH")
+		}
+		if err = client.Auth(a); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return &conn{netConn: netConn, client: client}, nil
+}
+
+// secure upgrades a connection with STARTTLS according to the TLSMode.
+func (p *pool) secure(client *smtp.Client, tlsConfig *tls.Config) error {
+	if p.tlsMode == TLSImplicit || p.tlsMode == TLSNone {
+		return nil
+	}
+
+	if ok, _ := client.Extension("STARTTLS"); !ok {
+		if p.tlsMode == TLSStartTLS {
+			return fmt.Errorf("smtp: server doesn't support STARTTLS")
+		}
+		return nil
+	}
+
+	return client.StartTLS(tlsConfig)
+}
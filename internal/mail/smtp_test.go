@@ -0,0 +1,180 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpServer is a mail server accepting all messages.
+type smtpServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	conns    int
+	messages []string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	s := &smtpServer{listener: l}
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns++
+		s.mu.Unlock()
+		go s.handle(c)
+	}
+}
+
+func (s *smtpServer) handle(c net.Conn) {
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	reply := func(line string) {
+		_, _ = c.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 Go ahead")
+			var msg strings.Builder
+			for {
+				line, err = r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				msg.WriteString(line)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestMail_PoolsConnections(t *testing.T) {
+	tt := []struct {
+		name     string
+		maxIdle  int
+		tlsMode  TLSMode
+		conns    int
+		messages int
+		hasError bool
+	}{
+		{
+			name:     "Reuses idle connection",
+			maxIdle:  1,
+			tlsMode:  TLSOpportunistic,
+			conns:    1,
+			messages: 2,
+		},
+		{
+			name:     "Does not reuse connection without idle connections",
+			maxIdle:  0,
+			tlsMode:  TLSOpportunistic,
+			conns:    2,
+			messages: 2,
+		},
+		{
+			name:     "Requires STARTTLS",
+			maxIdle:  1,
+			tlsMode:  TLSStartTLS,
+			conns:    2,
+			messages: 0,
+			hasError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newSMTPServer(t)
+			defer srv.listener.Close()
+
+			mailSvc := NewService(
+				WithDefaults(srv.listener.Addr().String(), "test@test.com", nil),
+				WithTLS(tc.tlsMode, nil),
+				WithMaxIdleConns(tc.maxIdle),
+			)
+
+			ctx := context.Background()
+			for i := 0; i < 2; i++ {
+				err := mailSvc.Email(ctx, "jane@example.com", "Hello", "hello world")
+				if err != nil && !tc.hasError {
+					t.Fatal("expected nil error, received:", err)
+				}
+				if err == nil && tc.hasError {
+					t.Fatal("expected error, received nil")
+				}
+			}
+
+			srv.mu.Lock()
+			defer srv.mu.Unlock()
+			if srv.conns != tc.conns {
+				t.Errorf("incorrect connections, want %v got %v", tc.conns, srv.conns)
+			}
+			if len(srv.messages) != tc.messages {
+				t.Errorf("incorrect messages, want %v got %v", tc.messages, len(srv.messages))
+			}
+		})
+	}
+}
+
+func TestMail_ParseTLSMode(t *testing.T) {
+	tt := []struct {
+		in       string
+		mode     TLSMode
+		hasError bool
+	}{
+		{in: "", mode: TLSOpportunistic},
+		{in: "starttls", mode: TLSStartTLS},
+		{in: "implicit", mode: TLSImplicit},
+		{in: "ssl", hasError: true},
+	}
+
+	for _, tc := range tt {
+		mode, err := ParseTLSMode(tc.in)
+		if err != nil && !tc.hasError {
+			t.Errorf("expected nil error for %q, received: %v", tc.in, err)
+		}
+		if err == nil && tc.hasError {
+			t.Errorf("expected error for %q, received nil", tc.in)
+		}
+		if mode != tc.mode {
+			t.Errorf("incorrect TLS mode for %q, want %s got %s", tc.in, tc.mode, mode)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Package matrix exposes the Matrix client-server API.
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/msgdelivery"
+)
+
+// directAccountData is the account data event listing the direct
+// message rooms of a Matrix user by the Matrix ID of the other member.
+const directAccountData = "m.direct"
+
+// client is a consumer of a homeserver's client-server API. Messages
+// are sent from the account of the access token, a bot account, in a
+// direct message room shared with each recipient. Rooms are created on
+// first delivery and recorded in the bot's m.direct account data so
+// later deliveries reuse them.
+type client struct {
+	baseURL     string
+	accessToken string
+	httpClient  *http.Client
+
+	// mu serializes room lookups so concurrent deliveries to the
+	// same recipient do not create more than one room.
+	mu sync.Mutex
+	// userID is the Matrix ID of the bot account.
+	userID string
+	// rooms are the direct message room IDs by recipient.
+	rooms map[string]string
+}
+
+// ConfigOption configures the client.
+type ConfigOption func(*client)
+
+// NewClient returns a Matrix client authenticated with the access token
+// of a bot account on a homeserver, e.g. `https://matrix.example.com`.
+func NewClient(homeserverURL, accessToken string, options ...ConfigOption) auth.Matrixer {
+	c := client{
+		baseURL:     strings.TrimSuffix(homeserverURL, "/"),
+		accessToken: accessToken,
+		httpClient:  &http.Client{},
+		rooms:       make(map[string]string),
+	}
+	for _, opt := range options {
+		opt(&c)
+	}
+	return &c
+}
+
+// WithHTTPClient configures the HTTP client requests to the
+// homeserver are sent with.
+func WithHTTPClient(httpClient *http.Client) ConfigOption {
+	return func(c *client) {
+		c.httpClient = httpClient
+	}
+}
+
+// Matrix sends a text message to a Matrix ID.
+func (c *client) Matrix(ctx context.Context, matrixID string, message string) error {
+	roomID, err := c.directRoom(ctx, matrixID)
+	if err != nil {
+		return err
+	}
+
+	// Transaction IDs make retries of the same delivery attempt
+	// idempotent on the homeserver.
+	txnID := msgdelivery.FromContext(ctx)
+	if txnID == "" {
+		txnID, err = crypto.String(16)
+		if err != nil {
+			return fmt.Errorf("failed to create transaction ID: %w", err)
+		}
+	}
+
+	path := fmt.Sprintf(
+		"/rooms/%s/send/m.room.message/%s",
+		url.PathEscape(roomID),
+		url.PathEscape(txnID),
+	)
+	content := map[string]string{
+		"msgtype": "m.text",
+		"body":    message,
+	}
+
+	return c.request(ctx, "PUT", path, content, nil)
+}
+
+// directRoom returns the ID of the direct message room shared with a
+// Matrix ID, creating it if it does not exist.
+func (c *client) directRoom(ctx context.Context, matrixID string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if roomID, ok := c.rooms[matrixID]; ok {
+		return roomID, nil
+	}
+
+	if c.userID == "" {
+		var whoami struct {
+			UserID string `json:"user_id"`
+		}
+		if err := c.request(ctx, "GET", "/account/whoami", nil, &whoami); err != nil {
+			return "", err
+		}
+		c.userID = whoami.UserID
+	}
+
+	directPath := fmt.Sprintf(
+		"/user/%s/account_data/%s",
+		url.PathEscape(c.userID),
+		directAccountData,
+	)
+
+	direct := make(map[string][]string)
+	err := c.request(ctx, "GET", directPath, nil, &direct)
+	if err != nil && !isNotFound(err) {
+		return "", err
+	}
+
+	// The most recently created room is listed last.
+	if rooms := direct[matrixID]; len(rooms) > 0 {
+		c.rooms[matrixID] = rooms[len(rooms)-1]
+		return c.rooms[matrixID], nil
+	}
+
+	var room struct {
+		RoomID string `json:"room_id"`
+	}
+	createRoom := map[string]interface{}{
+		"invite":    []string{matrixID},
+		"is_direct": true,
+		"preset":    "trusted_private_chat",
+	}
+	if err := c.request(ctx, "POST", "/createRoom", createRoom, &room); err != nil {
+		return "", err
+	}
+
+	direct[matrixID] = append(direct[matrixID], room.RoomID)
+	if err := c.request(ctx, "PUT", directPath, direct, nil); err != nil {
+		return "", err
+	}
+
+	c.rooms[matrixID] = room.RoomID
+	return room.RoomID, nil
+}
+
+// apiError is an error returned by the client-server API.
+type apiError struct {
+	StatusCode int
+	ErrCode    string `json:"errcode"`
+	Message    string `json:"error"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("expected status %v, got %v: %s %s",
+		http.StatusOK, e.StatusCode, e.ErrCode, e.Message)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*apiError)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// request sends a JSON request to a client-server API path and decodes
+// the response into out, if it is not nil.
+func (c *client) request(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	url := fmt.Sprintf("%s/_matrix/client/v3%s", c.baseURL, path)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return fmt.Errorf("cannot create HTTP request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	rBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		e := &apiError{StatusCode: resp.StatusCode}
+		_ = json.Unmarshal(rBody, e)
+		return e
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(rBody, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/fmitra/authenticator/internal/msgdelivery"
+)
+
+type homeserver struct {
+	direct      map[string][]string
+	sendStatus  int
+	createCount int
+	sent        []string
+	txnIDs      []string
+}
+
+func (h *homeserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"errcode": "M_UNKNOWN_TOKEN", "error": "Invalid access token"}`)
+		return
+	}
+
+	directPath := "/_matrix/client/v3/user/@bot:example.com/account_data/m.direct"
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/_matrix/client/v3/account/whoami":
+		fmt.Fprint(w, `{"user_id": "@bot:example.com"}`)
+	case r.Method == "GET" && r.URL.Path == directPath:
+		if h.direct == nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errcode": "M_NOT_FOUND", "error": "Account data not found"}`)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(h.direct)
+	case r.Method == "PUT" && r.URL.Path == directPath:
+		_ = json.NewDecoder(r.Body).Decode(&h.direct)
+		fmt.Fprint(w, `{}`)
+	case r.Method == "POST" && r.URL.Path == "/_matrix/client/v3/createRoom":
+		h.createCount++
+		fmt.Fprintf(w, `{"room_id": "!created%d:example.com"}`, h.createCount)
+	case r.Method == "PUT":
+		var content map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&content)
+		h.sent = append(h.sent, fmt.Sprintf("%s %s", r.URL.EscapedPath(), content["body"]))
+		if h.sendStatus != 0 {
+			w.WriteHeader(h.sendStatus)
+		}
+		fmt.Fprint(w, `{"event_id": "$event"}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errcode": "M_UNRECOGNIZED", "error": "Unrecognized request"}`)
+	}
+}
+
+func TestMatrix_SendsDirectMessage(t *testing.T) {
+	tt := []struct {
+		name        string
+		direct      map[string][]string
+		sendStatus  int
+		createCount int
+		sent        []string
+		hasError    bool
+	}{
+		{
+			name:        "Creates direct message room",
+			createCount: 1,
+			sent: []string{
+				"/_matrix/client/v3/rooms/%21created1:example.com/send/m.room.message/delivery-id hello world",
+				"/_matrix/client/v3/rooms/%21created1:example.com/send/m.room.message/delivery-id hello again",
+			},
+		},
+		{
+			name: "Reuses direct message room",
+			direct: map[string][]string{
+				"@jane:example.com": {"!old:example.com", "!recent:example.com"},
+			},
+			createCount: 0,
+			sent: []string{
+				"/_matrix/client/v3/rooms/%21recent:example.com/send/m.room.message/delivery-id hello world",
+				"/_matrix/client/v3/rooms/%21recent:example.com/send/m.room.message/delivery-id hello again",
+			},
+		},
+		{
+			name:        "Fails on rejected message",
+			sendStatus:  http.StatusForbidden,
+			createCount: 1,
+			sent: []string{
+				"/_matrix/client/v3/rooms/%21created1:example.com/send/m.room.message/delivery-id hello world",
+			},
+			hasError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			hs := &homeserver{direct: tc.direct, sendStatus: tc.sendStatus}
+			srv := httptest.NewServer(hs)
+			defer srv.Close()
+
+			ctx := msgdelivery.NewContext(context.Background(), "delivery-id")
+			c := NewClient(srv.URL+"/", "token")
+
+			for _, message := range []string{"hello world", "hello again"} {
+				err := c.Matrix(ctx, "@jane:example.com", message)
+				if err != nil && !tc.hasError {
+					t.Fatal("expected nil error:", err)
+				}
+				if err == nil && tc.hasError {
+					t.Fatal("expected error, received nil")
+				}
+				if err != nil {
+					break
+				}
+			}
+
+			if hs.createCount != tc.createCount {
+				t.Errorf("incorrect rooms created, want %v got %v", tc.createCount, hs.createCount)
+			}
+			if !cmp.Equal(hs.sent, tc.sent) {
+				t.Error(cmp.Diff(hs.sent, tc.sent))
+			}
+			if _, ok := hs.direct["@jane:example.com"]; !ok {
+				t.Error("direct message room not recorded in account data")
+			}
+		})
+	}
+}
+
+func TestMatrix_InvalidToken(t *testing.T) {
+	srv := httptest.NewServer(&homeserver{})
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "invalid-token")
+	err := c.Matrix(context.Background(), "@jane:example.com", "hello world")
+	if err == nil {
+		t.Fatal("expected error, received nil")
+	}
+}
@@ -0,0 +1,430 @@
+// Package memstore provides an in-memory substitute for the subset of
+// Redis commands used by the service. It allows the service to run as a
+// single node without Redis, e.g. during development. State is lost on
+// restart and is not shared between instances.
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// sweepInterval is the number of writes between sweeps of expired keys.
+const sweepInterval = 1000
+
+type entry struct {
+	value     string
+	set       map[string]struct{}
+	hash      map[string]string
+	zset      map[string]float64
+	expiresAt time.Time
+}
+
+func (e *entry) isExpired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// Store is an in-memory key value store mirroring the go-redis API.
+// Keys are expired lazily when accessed and periodically on writes.
+type Store struct {
+	mu     sync.Mutex
+	data   map[string]*entry
+	writes int
+	now    func() time.Time
+}
+
+// New returns a new Store.
+func New() *Store {
+	return &Store{
+		data: make(map[string]*entry),
+		now:  time.Now,
+	}
+}
+
+// Get returns the string value of a key or redis.Nil if it
+// does not exist.
+func (s *Store) Get(ctx context.Context, key string) *redis.StringCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.lookup(key)
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(e.value, nil)
+}
+
+// Set stores the string value of a key. An expiration of zero
+// persists the key indefinitely.
+func (s *Store) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &entry{value: format(value)}
+	if expiration > 0 {
+		e.expiresAt = s.now().Add(expiration)
+	}
+	s.write(key, e)
+	return redis.NewStatusResult("OK", nil)
+}
+
+// SetNX stores the string value of a key only if it does not
+// already exist. It returns true if the value was set.
+func (s *Store) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lookup(key); ok {
+		return redis.NewBoolResult(false, nil)
+	}
+
+	e := &entry{value: format(value)}
+	if expiration > 0 {
+		e.expiresAt = s.now().Add(expiration)
+	}
+	s.write(key, e)
+	return redis.NewBoolResult(true, nil)
+}
+
+// Del removes keys and returns the number removed.
+func (s *Store) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed int64
+	for _, key := range keys {
+		if _, ok := s.lookup(key); ok {
+			delete(s.data, key)
+			removed++
+		}
+	}
+	return redis.NewIntResult(removed, nil)
+}
+
+// Incr increments the integer value of a key by one.
+func (s *Store) Incr(ctx context.Context, key string) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.lookup(key)
+	if !ok {
+		e = &entry{value: "0"}
+		s.write(key, e)
+	}
+
+	n, err := strconv.ParseInt(e.value, 10, 64)
+	if err != nil {
+		return redis.NewIntResult(0, fmt.Errorf("value is not an integer: %w", err))
+	}
+	n++
+	e.value = strconv.FormatInt(n, 10)
+	return redis.NewIntResult(n, nil)
+}
+
+// Expire sets a timeout on a key. It returns false if the key
+// does not exist.
+func (s *Store) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.lookup(key)
+	if !ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	e.expiresAt = s.now().Add(expiration)
+	return redis.NewBoolResult(true, nil)
+}
+
+// SAdd adds members to a set and returns the number of new members.
+func (s *Store) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return redis.NewIntResult(s.addMembers(key, members), nil)
+}
+
+// SMembers returns all members of a set.
+func (s *Store) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.lookup(key)
+	if !ok {
+		return redis.NewStringSliceResult([]string{}, nil)
+	}
+
+	members := make([]string, 0, len(e.set))
+	for m := range e.set {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return redis.NewStringSliceResult(members, nil)
+}
+
+// PFAdd adds elements to a cardinality counter. Unlike Redis, counts
+// are exact as elements are stored in a set.
+func (s *Store) PFAdd(ctx context.Context, key string, els ...interface{}) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.addMembers(key, els) > 0 {
+		return redis.NewIntResult(1, nil)
+	}
+	return redis.NewIntResult(0, nil)
+}
+
+// PFCount returns the number of unique elements across cardinality counters.
+func (s *Store) PFCount(ctx context.Context, keys ...string) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unique := make(map[string]struct{})
+	for _, key := range keys {
+		e, ok := s.lookup(key)
+		if !ok {
+			continue
+		}
+		for m := range e.set {
+			unique[m] = struct{}{}
+		}
+	}
+	return redis.NewIntResult(int64(len(unique)), nil)
+}
+
+// HGetAll returns all fields of a hash.
+func (s *Store) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := make(map[string]string)
+	if e, ok := s.lookup(key); ok {
+		for k, v := range e.hash {
+			values[k] = v
+		}
+	}
+	return redis.NewStringStringMapResult(values, nil)
+}
+
+// HSet sets field value pairs of a hash and returns the number of
+// fields added.
+func (s *Store) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(values)%2 != 0 {
+		return redis.NewIntResult(0, fmt.Errorf("hset requires field value pairs"))
+	}
+
+	e, ok := s.lookup(key)
+	if !ok {
+		e = &entry{hash: make(map[string]string)}
+		s.write(key, e)
+	}
+
+	var added int64
+	for i := 0; i < len(values); i += 2 {
+		field := format(values[i])
+		if _, ok := e.hash[field]; !ok {
+			added++
+		}
+		e.hash[field] = format(values[i+1])
+	}
+	return redis.NewIntResult(added, nil)
+}
+
+// HDel removes fields from a hash and returns the number removed.
+func (s *Store) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.lookup(key)
+	if !ok {
+		return redis.NewIntResult(0, nil)
+	}
+
+	var removed int64
+	for _, field := range fields {
+		if _, ok := e.hash[field]; ok {
+			delete(e.hash, field)
+			removed++
+		}
+	}
+	return redis.NewIntResult(removed, nil)
+}
+
+// ZAdd adds members to a sorted set, updating the score of existing
+// members, and returns the number of new members.
+func (s *Store) ZAdd(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.lookup(key)
+	if !ok {
+		e = &entry{zset: make(map[string]float64)}
+		s.write(key, e)
+	}
+
+	var added int64
+	for _, m := range members {
+		v := format(m.Member)
+		if _, ok := e.zset[v]; !ok {
+			added++
+		}
+		e.zset[v] = m.Score
+	}
+	return redis.NewIntResult(added, nil)
+}
+
+// ZRangeByScore returns members of a sorted set with a score between
+// opt.Min and opt.Max inclusive, ordered by score. Unlike Redis,
+// exclusive intervals are not supported.
+func (s *Store) ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	min, err := strconv.ParseFloat(opt.Min, 64)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, fmt.Errorf("min is not a float: %w", err))
+	}
+	max, err := strconv.ParseFloat(opt.Max, 64)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, fmt.Errorf("max is not a float: %w", err))
+	}
+
+	e, ok := s.lookup(key)
+	if !ok {
+		return redis.NewStringSliceResult([]string{}, nil)
+	}
+
+	members := make([]string, 0, len(e.zset))
+	for m, score := range e.zset {
+		if score >= min && score <= max {
+			members = append(members, m)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		a, b := e.zset[members[i]], e.zset[members[j]]
+		if a == b {
+			return members[i] < members[j]
+		}
+		return a < b
+	})
+
+	if opt.Offset > 0 {
+		if opt.Offset >= int64(len(members)) {
+			return redis.NewStringSliceResult([]string{}, nil)
+		}
+		members = members[opt.Offset:]
+	}
+	if opt.Count > 0 && opt.Count < int64(len(members)) {
+		members = members[:opt.Count]
+	}
+	return redis.NewStringSliceResult(members, nil)
+}
+
+// ZRem removes members from a sorted set and returns the number removed.
+func (s *Store) ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.lookup(key)
+	if !ok {
+		return redis.NewIntResult(0, nil)
+	}
+
+	var removed int64
+	for _, m := range members {
+		v := format(m)
+		if _, ok := e.zset[v]; ok {
+			delete(e.zset, v)
+			removed++
+		}
+	}
+	return redis.NewIntResult(removed, nil)
+}
+
+// Close releases all stored keys.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data = make(map[string]*entry)
+	return nil
+}
+
+func (s *Store) addMembers(key string, members []interface{}) int64 {
+	e, ok := s.lookup(key)
+	if !ok {
+		e = &entry{set: make(map[string]struct{})}
+		s.write(key, e)
+	}
+
+	var added int64
+	for _, m := range members {
+		v := format(m)
+		if _, ok := e.set[v]; !ok {
+			e.set[v] = struct{}{}
+			added++
+		}
+	}
+	return added
+}
+
+// lookup returns an unexpired entry. Callers must hold the lock.
+func (s *Store) lookup(key string) (*entry, bool) {
+	e, ok := s.data[key]
+	if !ok {
+		return nil, false
+	}
+	if e.isExpired(s.now()) {
+		delete(s.data, key)
+		return nil, false
+	}
+	return e, true
+}
+
+// write stores an entry and periodically removes expired keys
+// which were never accessed again. Callers must hold the lock.
+func (s *Store) write(key string, e *entry) {
+	s.data[key] = e
+	s.writes++
+	if s.writes < sweepInterval {
+		return
+	}
+
+	s.writes = 0
+	now := s.now()
+	for k, v := range s.data {
+		if v.isExpired(now) {
+			delete(s.data, k)
+		}
+	}
+}
+
+// format converts a value to its string representation in the
+// same manner as go-redis does when writing command arguments.
+func format(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
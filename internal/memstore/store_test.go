@@ -0,0 +1,184 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestStore_GetSet(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := New()
+	s.now = func() time.Time { return now }
+
+	if err := s.Get(ctx, "missing").Err(); !errors.Is(err, redis.Nil) {
+		t.Fatalf("incorrect error, want %v got %v", redis.Nil, err)
+	}
+
+	if err := s.Set(ctx, "revoked", true, time.Minute).Err(); err != nil {
+		t.Fatal("failed to set key:", err)
+	}
+	if err := s.Set(ctx, "session", []byte("data"), 0).Err(); err != nil {
+		t.Fatal("failed to set key:", err)
+	}
+
+	val, err := s.Get(ctx, "revoked").Result()
+	if err != nil {
+		t.Fatal("failed to get key:", err)
+	}
+	if val != "1" {
+		t.Errorf("incorrect value, want %s got %s", "1", val)
+	}
+
+	now = now.Add(time.Minute)
+	if err = s.Get(ctx, "revoked").Err(); !errors.Is(err, redis.Nil) {
+		t.Errorf("expected key to expire, got %v", err)
+	}
+	if val, _ = s.Get(ctx, "session").Result(); val != "data" {
+		t.Errorf("incorrect value, want %s got %s", "data", val)
+	}
+}
+
+func TestStore_SetNX(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := New()
+	s.now = func() time.Time { return now }
+
+	if ok := s.SetNX(ctx, "lock", "a", time.Minute).Val(); !ok {
+		t.Error("expected first SetNX to succeed")
+	}
+	if ok := s.SetNX(ctx, "lock", "b", time.Minute).Val(); ok {
+		t.Error("expected SetNX on existing key to fail")
+	}
+	if val := s.Get(ctx, "lock").Val(); val != "a" {
+		t.Errorf("incorrect value, want %s got %s", "a", val)
+	}
+
+	now = now.Add(time.Minute)
+	if ok := s.SetNX(ctx, "lock", "c", time.Minute).Val(); !ok {
+		t.Error("expected SetNX on expired key to succeed")
+	}
+}
+
+func TestStore_Del(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	s.Set(ctx, "a", "1", 0)
+	s.Set(ctx, "b", "2", 0)
+
+	if n := s.Del(ctx, "a", "b", "missing").Val(); n != 2 {
+		t.Errorf("incorrect keys removed, want %v got %v", 2, n)
+	}
+	if err := s.Get(ctx, "a").Err(); !errors.Is(err, redis.Nil) {
+		t.Errorf("incorrect error, want %v got %v", redis.Nil, err)
+	}
+}
+
+func TestStore_IncrExpire(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := New()
+	s.now = func() time.Time { return now }
+
+	if ok := s.Expire(ctx, "counter", time.Second).Val(); ok {
+		t.Error("expected expire to fail on missing key")
+	}
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := s.Incr(ctx, "counter").Result()
+		if err != nil {
+			t.Fatal("failed to increment:", err)
+		}
+		if n != i {
+			t.Errorf("incorrect count, want %v got %v", i, n)
+		}
+	}
+
+	if ok := s.Expire(ctx, "counter", time.Second).Val(); !ok {
+		t.Error("expected expire to succeed")
+	}
+	now = now.Add(time.Second)
+	if n := s.Incr(ctx, "counter").Val(); n != 1 {
+		t.Errorf("incorrect count after expiry, want %v got %v", 1, n)
+	}
+
+	s.Set(ctx, "text", "abc", 0)
+	if err := s.Incr(ctx, "text").Err(); err == nil {
+		t.Error("expected error incrementing non integer")
+	}
+}
+
+func TestStore_Sets(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	if n := s.SAdd(ctx, "sources", "a", "b", "a").Val(); n != 2 {
+		t.Errorf("incorrect members added, want %v got %v", 2, n)
+	}
+	members := s.SMembers(ctx, "sources").Val()
+	if len(members) != 2 || members[0] != "a" || members[1] != "b" {
+		t.Errorf("incorrect members: %v", members)
+	}
+
+	s.PFAdd(ctx, "accounts:1", "x", "y")
+	s.PFAdd(ctx, "accounts:2", "y", "z")
+	if n := s.PFCount(ctx, "accounts:1", "accounts:2").Val(); n != 3 {
+		t.Errorf("incorrect count, want %v got %v", 3, n)
+	}
+}
+
+func TestStore_Hash(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	if n := s.HSet(ctx, "flags", "signup", "true", "captcha", false).Val(); n != 2 {
+		t.Errorf("incorrect fields added, want %v got %v", 2, n)
+	}
+	if err := s.HSet(ctx, "flags", "signup").Err(); err == nil {
+		t.Error("expected error for missing value")
+	}
+	if n := s.HDel(ctx, "flags", "signup", "missing").Val(); n != 1 {
+		t.Errorf("incorrect fields removed, want %v got %v", 1, n)
+	}
+
+	values := s.HGetAll(ctx, "flags").Val()
+	if len(values) != 1 || values["captcha"] != "0" {
+		t.Errorf("incorrect hash values: %v", values)
+	}
+}
+
+func TestStore_SortedSet(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+
+	n := s.ZAdd(ctx, "scheduled", &redis.Z{Score: 3, Member: "c"}, &redis.Z{Score: 1, Member: "a"}).Val()
+	if n != 2 {
+		t.Errorf("incorrect members added, want %v got %v", 2, n)
+	}
+	if n = s.ZAdd(ctx, "scheduled", &redis.Z{Score: 2, Member: "c"}).Val(); n != 0 {
+		t.Errorf("incorrect members added, want %v got %v", 0, n)
+	}
+
+	members := s.ZRangeByScore(ctx, "scheduled", &redis.ZRangeBy{Min: "-inf", Max: "2"}).Val()
+	if len(members) != 2 || members[0] != "a" || members[1] != "c" {
+		t.Errorf("incorrect members: %v", members)
+	}
+	members = s.ZRangeByScore(ctx, "scheduled", &redis.ZRangeBy{Min: "-inf", Max: "+inf", Count: 1}).Val()
+	if len(members) != 1 || members[0] != "a" {
+		t.Errorf("incorrect members: %v", members)
+	}
+
+	if n = s.ZRem(ctx, "scheduled", "a", "missing").Val(); n != 1 {
+		t.Errorf("incorrect members removed, want %v got %v", 1, n)
+	}
+	members = s.ZRangeByScore(ctx, "scheduled", &redis.ZRangeBy{Min: "-inf", Max: "+inf"}).Val()
+	if len(members) != 1 || members[0] != "c" {
+		t.Errorf("incorrect members: %v", members)
+	}
+}
@@ -1,22 +1,53 @@
 package msgconsumer
 
 import (
+	"time"
+
 	"github.com/go-kit/kit/log"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
+	"github.com/fmitra/authenticator/internal/deliverystats"
 )
 
-// defaultWorkers represents the default number of workers to process a queue.
-const defaultWorkers = 4
+const (
+	// defaultHighPriorityWorkers is the default number of workers
+	// delivering high priority messages.
+	defaultHighPriorityWorkers = 4
+	// defaultWorkers is the default number of workers delivering
+	// normal priority messages.
+	defaultWorkers = 4
+	// defaultLowPriorityWorkers is the default number of workers
+	// delivering low priority messages.
+	defaultLowPriorityWorkers = 1
+	// defaultQueueSize is the default number of messages held in
+	// memory for each priority.
+	defaultQueueSize = 100
+	// defaultDrainTimeout is the default time workers are given to
+	// deliver queued messages after the consumer is stopped.
+	defaultDrainTimeout = 10 * time.Second
+)
 
 // NewService returns a new Consumer
 func NewService(r auth.MessageRepository, smsLib auth.SMSer, emailLib auth.Emailer, options ...ConfigOption) Consumer {
 	s := service{
-		logger:       log.NewNopLogger(),
-		totalWorkers: defaultWorkers,
+		logger: log.NewNopLogger(),
+		workers: map[auth.MessagePriority]int{
+			auth.PriorityHigh:   defaultHighPriorityWorkers,
+			auth.PriorityNormal: defaultWorkers,
+			auth.PriorityLow:    defaultLowPriorityWorkers,
+		},
 		messageRepo:  r,
 		smsLib:       smsLib,
 		emailLib:     emailLib,
+		stats:        deliverystats.NewService(),
+		metrics:      discardMetrics(),
+		providers:    make(map[auth.DeliveryMethod]string),
+		queues:       make(map[auth.MessagePriority]*queue),
+		queueStats:   make(map[auth.MessagePriority]*QueueStats),
+		clock:        clock.New(),
+		queueSize:    defaultQueueSize,
+		drainTimeout: defaultDrainTimeout,
 	}
 
 	for _, opt := range options {
@@ -36,10 +67,77 @@ func WithLogger(l log.Logger) ConfigOption {
 	}
 }
 
-// WithWorkers determines the total number of workers to process
-// a message queue.
-func WithWorkers(w int) ConfigOption {
+// WithWorkers determines the number of workers delivering messages
+// of a priority.
+func WithWorkers(priority auth.MessagePriority, w int) ConfigOption {
+	return func(s *service) {
+		s.workers[priority] = w
+	}
+}
+
+// WithQueueSize configures the number of messages of each priority
+// held in memory awaiting a worker. Messages are left in the message
+// repository while the queue of their priority is full.
+func WithQueueSize(n int) ConfigOption {
+	return func(s *service) {
+		s.queueSize = n
+	}
+}
+
+// WithDrainTimeout configures the time workers are given to deliver
+// queued messages after the consumer is stopped. Messages still
+// queued after it are dead lettered.
+func WithDrainTimeout(d time.Duration) ConfigOption {
+	return func(s *service) {
+		s.drainTimeout = d
+	}
+}
+
+// WithClock configures the service with a clock used to expire
+// undelivered messages. Defaults to the system clock.
+func WithClock(c clock.Clock) ConfigOption {
+	return func(s *service) {
+		s.clock = c
+	}
+}
+
+// WithDeliveryStats configures the service to record the
+// outcome of delivery attempts.
+func WithDeliveryStats(d auth.DeliveryStatsService) ConfigOption {
+	return func(s *service) {
+		s.stats = d
+	}
+}
+
+// WithDeliveryRepository configures the service to track the status
+// of each delivery attempt.
+func WithDeliveryRepository(r auth.MessageDeliveryRepository) ConfigOption {
+	return func(s *service) {
+		s.deliveries = r
+	}
+}
+
+// WithMatrix configures the service to deliver messages
+// to Matrix IDs.
+func WithMatrix(m auth.Matrixer) ConfigOption {
+	return func(s *service) {
+		s.matrixLib = m
+	}
+}
+
+// WithMetrics configures the service to record the state of the
+// message pipeline.
+func WithMetrics(m Metrics) ConfigOption {
+	return func(s *service) {
+		s.metrics = m
+	}
+}
+
+// WithProvider names the provider messages of a DeliveryMethod are
+// delivered through in metrics and logs, e.g. `twilio`. Providers
+// are named by their DeliveryMethod by default.
+func WithProvider(delivery auth.DeliveryMethod, name string) ConfigOption {
 	return func(s *service) {
-		s.totalWorkers = w
+		s.providers[delivery] = name
 	}
 }
@@ -0,0 +1,18 @@
+package msgconsumer
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+// SetupHTTPHandler exposes the state of a consumer's queues for
+// debugging. The route is unauthenticated and should only be served
+// on an internal address.
+func SetupHTTPHandler(c Consumer, router *mux.Router) {
+	router.HandleFunc("/internal/queues", func(w http.ResponseWriter, r *http.Request) {
+		httpapi.JSONResponse(w, map[string]interface{}{"queues": c.Queues()}, http.StatusOK)
+	}).Methods("Get")
+}
@@ -0,0 +1,57 @@
+package msgconsumer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestMsgConsumer_QueuesHTTP(t *testing.T) {
+	svc := NewService(&test.MessageRepository{}, &smsMock{}, &emailMock{}).(*service)
+	q := newQueue(svc.queueSize, svc.metrics.QueueDepth)
+	q.push(context.Background(), &auth.Message{Priority: auth.PriorityHigh})
+	svc.queues[auth.PriorityHigh] = q
+	svc.queueStats[auth.PriorityHigh] = &QueueStats{
+		Priority: auth.PriorityHigh,
+		Workers:  4,
+		Busy:     1,
+		Sent:     10,
+	}
+
+	router := mux.NewRouter()
+	SetupHTTPHandler(svc, router)
+
+	req := httptest.NewRequest("GET", "/internal/queues", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+
+	var resp struct {
+		Queues []QueueStats `json:"queues"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal("invalid response:", err)
+	}
+
+	want := []QueueStats{{
+		Priority: auth.PriorityHigh,
+		Depth:    1,
+		Workers:  4,
+		Busy:     1,
+		Sent:     10,
+	}}
+	if !cmp.Equal(resp.Queues, want) {
+		t.Error(cmp.Diff(resp.Queues, want))
+	}
+}
@@ -0,0 +1,82 @@
+package msgconsumer
+
+import (
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// Dead letter reasons are the reasons a message is dropped without
+// being delivered.
+const (
+	// DeadLetterExpired is for messages which expired before a worker
+	// could deliver them.
+	DeadLetterExpired = "expired"
+	// DeadLetterRetryFailed is for failed messages which could not be
+	// sent back to the queue, typically because they expired while
+	// being delivered.
+	DeadLetterRetryFailed = "retry_failed"
+	// DeadLetterShutdown is for messages which were still queued
+	// when the consumer stopped and its drain timeout passed.
+	DeadLetterShutdown = "shutdown"
+)
+
+// Metrics are the instruments the message pipeline is observed with.
+type Metrics struct {
+	// QueueDepth is the number of messages awaiting a worker,
+	// labeled by `priority`.
+	QueueDepth metrics.Gauge
+	// DeliveryDuration observes the seconds a provider takes to
+	// deliver a message, labeled by `delivery`, `provider` and
+	// `outcome`.
+	DeliveryDuration metrics.Histogram
+	// Retries counts failed deliveries sent back to the queue,
+	// labeled by `delivery` and `provider`.
+	Retries metrics.Counter
+	// DeadLetters counts messages dropped without being delivered,
+	// labeled by `delivery` and `reason`.
+	DeadLetters metrics.Counter
+}
+
+// NewPrometheusMetrics returns Metrics registered with the default
+// Prometheus registry. It may only be called once.
+func NewPrometheusMetrics() Metrics {
+	return Metrics{
+		QueueDepth: kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "authenticator",
+			Subsystem: "messages",
+			Name:      "queue_depth",
+			Help:      "Number of messages awaiting a worker.",
+		}, []string{"priority"}),
+		DeliveryDuration: kitprometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "authenticator",
+			Subsystem: "messages",
+			Name:      "delivery_duration_seconds",
+			Help:      "Seconds taken by a provider to deliver a message.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"delivery", "provider", "outcome"}),
+		Retries: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "authenticator",
+			Subsystem: "messages",
+			Name:      "retries_total",
+			Help:      "Number of failed deliveries sent back to the queue.",
+		}, []string{"delivery", "provider"}),
+		DeadLetters: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "authenticator",
+			Subsystem: "messages",
+			Name:      "dead_letters_total",
+			Help:      "Number of messages dropped without being delivered.",
+		}, []string{"delivery", "reason"}),
+	}
+}
+
+// discardMetrics returns Metrics which record nothing.
+func discardMetrics() Metrics {
+	return Metrics{
+		QueueDepth:       discard.NewGauge(),
+		DeliveryDuration: discard.NewHistogram(),
+		Retries:          discard.NewCounter(),
+		DeadLetters:      discard.NewCounter(),
+	}
+}
@@ -0,0 +1,137 @@
+package msgconsumer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kit/kit/metrics"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// queue is a bounded FIFO queue of messages awaiting a worker. Pushing
+// to a full queue blocks, so messages are left in the message repository
+// rather than read into memory faster than workers deliver them.
+type queue struct {
+	mu     sync.Mutex
+	msgs   []*auth.Message
+	size   int
+	closed bool
+	// ready is signalled when a message is pushed or the queue closes.
+	ready chan struct{}
+	// space is signalled when a message is popped.
+	space chan struct{}
+	// depth is set to the length of the queue as it changes.
+	depth metrics.Gauge
+}
+
+func newQueue(size int, depth metrics.Gauge) *queue {
+	if size < 1 {
+		size = 1
+	}
+	return &queue{
+		size:  size,
+		ready: make(chan struct{}, 1),
+		space: make(chan struct{}, 1),
+		depth: depth,
+	}
+}
+
+// push adds a message to the end of the queue, waiting for space if
+// the queue is full. It reports false if the context is done first.
+func (q *queue) push(ctx context.Context, msg *auth.Message) bool {
+	for {
+		q.mu.Lock()
+		if len(q.msgs) < q.size {
+			q.msgs = append(q.msgs, msg)
+			q.depth.Set(float64(len(q.msgs)))
+			q.mu.Unlock()
+
+			signal(q.ready)
+			return true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.space:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// pop removes the message at the front of the queue, waiting for one
+// to be pushed if the queue is empty. It reports false if the context
+// is done first or the queue is closed and empty.
+func (q *queue) pop(ctx context.Context) (*auth.Message, bool) {
+	for {
+		if ctx.Err() != nil {
+			return nil, false
+		}
+
+		q.mu.Lock()
+		if len(q.msgs) > 0 {
+			msg := q.msgs[0]
+			q.msgs[0] = nil
+			q.msgs = q.msgs[1:]
+			q.depth.Set(float64(len(q.msgs)))
+			hasMore := len(q.msgs) > 0
+			q.mu.Unlock()
+
+			signal(q.space)
+			// Wake another worker for the remaining messages.
+			if hasMore {
+				signal(q.ready)
+			}
+			return msg, true
+		}
+		closed := q.closed
+		q.mu.Unlock()
+
+		if closed {
+			// Wake another worker to find the queue closed.
+			signal(q.ready)
+			return nil, false
+		}
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// close stops workers once the remaining messages are popped.
+func (q *queue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	signal(q.ready)
+}
+
+// flush removes and returns every message in the queue.
+func (q *queue) flush() []*auth.Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	msgs := q.msgs
+	q.msgs = nil
+	q.depth.Set(0)
+	return msgs
+}
+
+// len returns the number of messages in the queue.
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.msgs)
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -1,87 +1,314 @@
-// Package msgconsumer reads and sends SMS/Email messages from a repository.
+// Package msgconsumer reads and sends SMS/Email/Matrix messages from a repository.
 package msgconsumer
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
+	"github.com/fmitra/authenticator/internal/msgdelivery"
+	"github.com/fmitra/authenticator/internal/msgsender"
 )
 
 // Consumer reads a message stream from a repository.
 type Consumer interface {
 	Run(ctx context.Context) error
+	// Queues returns the state of the queue of each MessagePriority.
+	// It is empty until the consumer is running.
+	Queues() []QueueStats
 }
 
+// QueueStats describes the queue of a MessagePriority. Message counts
+// are totals since the consumer started.
+type QueueStats struct {
+	Priority auth.MessagePriority `json:"priority"`
+	// Depth is the number of messages awaiting a worker.
+	Depth int `json:"depth"`
+	// Workers is the number of workers delivering messages.
+	Workers int `json:"workers"`
+	// Busy is the number of workers delivering a message.
+	Busy int `json:"busy"`
+	// Sent is the number of messages accepted by a provider.
+	Sent int `json:"sent"`
+	// Retried is the number of failed messages sent back to the
+	// message repository to be retried.
+	Retried int `json:"retried"`
+	// DeadLettered is the number of messages dropped without being
+	// delivered.
+	DeadLettered int `json:"deadLettered"`
+}
+
+// priorities are the MessagePriorities workers are allocated to.
+var priorities = []auth.MessagePriority{auth.PriorityHigh, auth.PriorityNormal, auth.PriorityLow}
+
 // Service consumes messages to be delivered in a parallel through
 // goroutines.
 type service struct {
-	logger       log.Logger
-	smsLib       auth.SMSer
-	emailLib     auth.Emailer
-	totalWorkers int
-	messageRepo  auth.MessageRepository
+	logger      log.Logger
+	smsLib      auth.SMSer
+	emailLib    auth.Emailer
+	matrixLib   auth.Matrixer
+	workers     map[auth.MessagePriority]int
+	messageRepo auth.MessageRepository
+	stats       auth.DeliveryStatsService
+	deliveries  auth.MessageDeliveryRepository
+	metrics     Metrics
+	// providers are the names of the providers of each
+	// DeliveryMethod, to label metrics and logs.
+	providers map[auth.DeliveryMethod]string
+	// clock determines whether a message expired before delivery.
+	clock clock.Clock
+	// queueSize is the number of messages held in memory for each
+	// priority.
+	queueSize int
+	// drainTimeout is the time workers are given to deliver queued
+	// messages after the consumer is stopped.
+	drainTimeout time.Duration
+
+	mu         sync.Mutex
+	queues     map[auth.MessagePriority]*queue
+	queueStats map[auth.MessagePriority]*QueueStats
 }
 
 // Run retrieves recent messages from the repository and passes
-// them into a channel to be consumed by goroutines.
+// them into a channel to be consumed by goroutines. Once ctx is
+// cancelled, messages already read from the repository are delivered
+// before it returns, for up to the drain timeout.
 func (s *service) Run(ctx context.Context) error {
+	// Workers outlive ctx so messages held in memory are not lost
+	// when the consumer shuts down.
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
 	msgc, errc := s.messageRepo.Recent(ctx)
 
-	s.startWorkers(ctx, msgc)
+	workers := s.startWorkers(workCtx, msgc)
 
-	for {
-		select {
-		case err := <-errc:
-			return err
-		case <-ctx.Done():
-			return ctx.Err()
-		}
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = ctx.Err()
 	}
+
+	s.drain(workers, cancelWork)
+	return err
 }
 
-// startWorkers starts a finite number of workers to deliver messages found
-// in the message queue.
-func (s *service) startWorkers(ctx context.Context, msgc <-chan *auth.Message) {
-	for i := 0; i < s.totalWorkers; i++ {
-		go func() {
-			for msg := range msgc {
-				s.processMessage(ctx, msg)
+// startWorkers starts a finite number of workers for each priority to
+// deliver messages found in the message queue. Messages are queued by
+// priority as they arrive so workers of one priority are never held up
+// by a backlog of another. Reading stops while the queue of a message
+// is full. At least one worker is started for each priority. The
+// returned WaitGroup is done once the workers stop.
+func (s *service) startWorkers(ctx context.Context, msgc <-chan *auth.Message) *sync.WaitGroup {
+	var wg sync.WaitGroup
+
+	queues := make(map[auth.MessagePriority]*queue, len(priorities))
+	for _, priority := range priorities {
+		q := newQueue(s.queueSize, s.metrics.QueueDepth.With("priority", string(priority)))
+		queues[priority] = q
+
+		workers := s.workers[priority]
+		if workers < 1 {
+			workers = 1
+		}
+
+		s.mu.Lock()
+		s.queues[priority] = q
+		s.queueStats[priority] = &QueueStats{Priority: priority, Workers: workers}
+		s.mu.Unlock()
+
+		wg.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer wg.Done()
+				for {
+					msg, ok := q.pop(ctx)
+					if !ok {
+						return
+					}
+					s.processMessage(ctx, msg)
+				}
+			}()
+		}
+	}
+
+	go func() {
+		for msg := range msgc {
+			if !queues[priorityOf(msg)].push(ctx, msg) {
+				s.deadLetter(s.messageLogger(msg), msg, DeadLetterShutdown)
 			}
-		}()
+		}
+		for _, q := range queues {
+			q.close()
+		}
+	}()
+
+	return &wg
+}
+
+// drain waits for workers to deliver the messages remaining in the
+// queues once the message repository is closed. Workers are stopped if
+// they do not finish within the drain timeout and messages they did
+// not reach are dead lettered. Deliveries in progress are not waited
+// for past the timeout.
+func (s *service) drain(workers *sync.WaitGroup, stop context.CancelFunc) {
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(s.drainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	stop()
+
+	s.mu.Lock()
+	queues := make([]*queue, 0, len(s.queues))
+	for _, q := range s.queues {
+		queues = append(queues, q)
+	}
+	s.mu.Unlock()
+
+	for _, q := range queues {
+		for _, msg := range q.flush() {
+			s.deadLetter(s.messageLogger(msg), msg, DeadLetterShutdown)
+		}
+	}
+}
+
+// messageLogger returns a logger describing a message.
+func (s *service) messageLogger(msg *auth.Message) log.Logger {
+	return log.With(
+		s.logger,
+		"source", "msgconsumer.drain",
+		"address", msg.Address,
+		"delivery", msg.Delivery,
+		"type", msg.Type,
+		"priority", priorityOf(msg),
+	)
+}
+
+// priorityOf returns the priority a message is delivered by. Messages
+// without a known priority are delivered as PriorityNormal.
+func priorityOf(msg *auth.Message) auth.MessagePriority {
+	switch msg.Priority {
+	case auth.PriorityHigh, auth.PriorityLow:
+		return msg.Priority
+	default:
+		return auth.PriorityNormal
+	}
+}
+
+// Queues returns the state of the queue of each MessagePriority.
+func (s *service) Queues() []QueueStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]QueueStats, 0, len(s.queueStats))
+	for _, priority := range priorities {
+		st, ok := s.queueStats[priority]
+		if !ok {
+			continue
+		}
+		qs := *st
+		qs.Depth = s.queues[priority].len()
+		stats = append(stats, qs)
+	}
+
+	return stats
+}
+
+// tally updates the stats of the queue of a priority.
+func (s *service) tally(priority auth.MessagePriority, fn func(*QueueStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.queueStats[priority]; ok {
+		fn(st)
 	}
 }
 
-// processMessage delivers a message through email or SMS.
+// provider returns the name of the provider of a DeliveryMethod.
+func (s *service) provider(delivery auth.DeliveryMethod) string {
+	if name, ok := s.providers[delivery]; ok {
+		return name
+	}
+	return string(delivery)
+}
+
+// processMessage delivers a message through email, SMS or Matrix.
 func (s *service) processMessage(ctx context.Context, msg *auth.Message) {
+	priority := priorityOf(msg)
+	provider := s.provider(msg.Delivery)
 	logger := log.With(
 		s.logger,
 		"source", "msgconsumer.processMessage",
 		"address", msg.Address,
 		"delivery", msg.Delivery,
+		"provider", provider,
 		"type", msg.Type,
+		"priority", priority,
 		"delivery_attempts", msg.DeliveryAttempts,
 		"expires_at", msg.ExpiresAt,
 	)
-	isExpired := time.Now().After(msg.ExpiresAt)
+	isExpired := s.clock.Now().After(msg.ExpiresAt)
+
+	s.tally(priority, func(st *QueueStats) { st.Busy++ })
+	defer s.tally(priority, func(st *QueueStats) { st.Busy-- })
 
 	if isExpired {
-		level.Info(logger).Log("message", "dropping expired message")
+		s.deadLetter(logger, msg, DeadLetterExpired)
+		s.record(ctx, logger, msg, auth.DeliveryExpired)
+		s.track(ctx, logger, msg, auth.MessageFailed, "message expired before delivery")
 		return
 	}
 
+	ctx, deliveryID := s.track(ctx, logger, msg, auth.MessageQueued, "")
+	logger = log.With(logger, "delivery_id", deliveryID)
+	ctx = msgsender.NewContext(ctx, msg.Sender)
+
+	start := time.Now()
 	var err error
 	if msg.Delivery == auth.Phone {
 		err = s.smsLib.SMS(ctx, msg.Address, msg.Content)
 	} else if msg.Delivery == auth.Email {
 		err = s.emailLib.Email(ctx, msg.Address, msg.Subject, msg.Content)
+	} else if msg.Delivery == auth.Matrix {
+		err = s.matrix(ctx, msg)
+	}
+	duration := time.Since(start)
+	logger = log.With(logger, "duration", duration)
+
+	outcome := auth.DeliverySent
+	if err != nil {
+		outcome = auth.DeliveryFailed
 	}
+	s.metrics.DeliveryDuration.With(
+		"delivery", string(msg.Delivery),
+		"provider", provider,
+		"outcome", string(outcome),
+	).Observe(duration.Seconds())
 
 	if err == nil {
 		level.Info(logger).Log("message", "message sent")
+		s.tally(priority, func(st *QueueStats) { st.Sent++ })
+		s.record(ctx, logger, msg, auth.DeliverySent)
+		s.updateStatus(ctx, logger, deliveryID, auth.MessageSent, "")
 		// Enable in config.json: api.debug
 		level.Debug(logger).Log(
 			"content", msg.Content,
@@ -92,6 +319,8 @@ func (s *service) processMessage(ctx context.Context, msg *auth.Message) {
 
 	// Continue to retry the message until expiry.
 	level.Info(logger).Log("message", "retrying message", "error", err)
+	s.record(ctx, logger, msg, auth.DeliveryFailed)
+	s.updateStatus(ctx, logger, deliveryID, auth.MessageFailed, err.Error())
 
 	if err := s.messageRepo.Publish(ctx, msg); err != nil {
 		level.Info(logger).Log(
@@ -100,9 +329,72 @@ func (s *service) processMessage(ctx context.Context, msg *auth.Message) {
 			"error",
 			err,
 		)
+		s.deadLetter(logger, msg, DeadLetterRetryFailed)
 	} else {
 		level.Info(logger).Log(
 			"message", "message sent back to queue",
 		)
+		s.metrics.Retries.With("delivery", string(msg.Delivery), "provider", provider).Add(1)
+		s.tally(priority, func(st *QueueStats) { st.Retried++ })
+	}
+}
+
+// deadLetter records a message dropped without being delivered.
+func (s *service) deadLetter(logger log.Logger, msg *auth.Message, reason string) {
+	level.Warn(logger).Log("message", "message dead lettered", "reason", reason)
+	s.metrics.DeadLetters.With("delivery", string(msg.Delivery), "reason", reason).Add(1)
+	s.tally(priorityOf(msg), func(st *QueueStats) { st.DeadLettered++ })
+}
+
+// matrix delivers a message to a Matrix ID. Messages are retried
+// until expiry if Matrix delivery is not configured.
+func (s *service) matrix(ctx context.Context, msg *auth.Message) error {
+	if s.matrixLib == nil {
+		return fmt.Errorf("matrix delivery is not configured")
+	}
+	return s.matrixLib.Matrix(ctx, msg.Address, msg.Content)
+}
+
+// record records the outcome of a delivery attempt.
+func (s *service) record(ctx context.Context, logger log.Logger, msg *auth.Message, outcome auth.DeliveryOutcome) {
+	if err := s.stats.Record(ctx, msg.Delivery, outcome); err != nil {
+		level.Error(logger).Log("message", "failed to record delivery outcome", "error", err)
+	}
+}
+
+// track creates a MessageDelivery to follow an attempt to deliver a
+// message. The returned context carries its ID for providers to
+// report its status. Messages are delivered even if the attempt
+// cannot be tracked.
+func (s *service) track(ctx context.Context, logger log.Logger, msg *auth.Message,
+	status auth.MessageDeliveryStatus, detail string) (context.Context, string) {
+	if s.deliveries == nil {
+		return ctx, ""
+	}
+
+	d := &auth.MessageDelivery{
+		Type:     msg.Type,
+		Delivery: msg.Delivery,
+		Address:  msg.Address,
+		Status:   status,
+		Detail:   detail,
+	}
+	if err := s.deliveries.Create(ctx, d); err != nil {
+		level.Error(logger).Log("message", "failed to track message delivery", "error", err)
+		return ctx, ""
+	}
+
+	return msgdelivery.NewContext(ctx, d.ID), d.ID
+}
+
+// updateStatus updates the status of a tracked delivery attempt.
+func (s *service) updateStatus(ctx context.Context, logger log.Logger, id string,
+	status auth.MessageDeliveryStatus, detail string) {
+	if s.deliveries == nil || id == "" {
+		return
+	}
+
+	if err := s.deliveries.UpdateStatus(ctx, id, status, detail); err != nil {
+		level.Error(logger).Log("message", "failed to update message delivery", "error", err)
 	}
 }
@@ -6,9 +6,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
 	"github.com/google/go-cmp/cmp"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
+	"github.com/fmitra/authenticator/internal/msgdelivery"
 	"github.com/fmitra/authenticator/internal/test"
 )
 
@@ -22,6 +26,25 @@ type smsMock struct {
 	SMSFn     func(ctx context.Context, phoneNumber, message string) error
 }
 
+type matrixMock struct {
+	callCount int
+	MatrixFn  func(ctx context.Context, matrixID, message string) error
+}
+
+func (m *matrixMock) Matrix(ctx context.Context, matrixID, message string) error {
+	m.callCount++
+	if m.MatrixFn != nil {
+		return m.MatrixFn(ctx, matrixID, message)
+	}
+	return nil
+}
+
+type emailFunc func(ctx context.Context, email, subject, message string) error
+
+func (f emailFunc) Email(ctx context.Context, email, subject, message string) error {
+	return f(ctx, email, subject, message)
+}
+
 func (m *emailMock) Email(ctx context.Context, email, subject, message string) error {
 	m.callCount++
 	if m.EmailFn != nil {
@@ -206,9 +229,11 @@ func TestMsgConsumer_ProcessMessage(t *testing.T) {
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			smsChan := make(chan bool)
-			emailChan := make(chan bool)
-			publishChan := make(chan bool)
+			// Run waits for messages to be delivered, so deliveries
+			// must not block on the test reading them.
+			smsChan := make(chan bool, 1)
+			emailChan := make(chan bool, 1)
+			publishChan := make(chan bool, 1)
 
 			defer close(smsChan)
 			defer close(emailChan)
@@ -265,3 +290,544 @@ func TestMsgConsumer_ProcessMessage(t *testing.T) {
 		})
 	}
 }
+
+func TestMsgConsumer_RecordsDeliveryOutcome(t *testing.T) {
+	tt := []struct {
+		name      string
+		expiresAt time.Time
+		emailErr  error
+		outcome   auth.DeliveryOutcome
+	}{
+		{
+			name:      "Records sent message",
+			expiresAt: time.Now().Add(time.Minute),
+			outcome:   auth.DeliverySent,
+		},
+		{
+			name:      "Records failed message",
+			expiresAt: time.Now().Add(time.Minute),
+			emailErr:  fmt.Errorf("provider unavailable"),
+			outcome:   auth.DeliveryFailed,
+		},
+		{
+			name:      "Records expired message",
+			expiresAt: time.Now().Add(-time.Minute),
+			outcome:   auth.DeliveryExpired,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var recorded auth.DeliveryOutcome
+			stats := &test.DeliveryStatsService{
+				RecordFn: func(delivery auth.DeliveryMethod, outcome auth.DeliveryOutcome) error {
+					if delivery != auth.Email {
+						t.Errorf("incorrect delivery method, want email got %s", delivery)
+					}
+					recorded = outcome
+					return nil
+				},
+			}
+			emailLib := emailMock{
+				EmailFn: func(ctx context.Context, email, subject, message string) error {
+					return tc.emailErr
+				},
+			}
+			svc := NewService(
+				&test.MessageRepository{}, &smsMock{}, &emailLib, WithDeliveryStats(stats),
+			).(*service)
+
+			svc.processMessage(context.Background(), &auth.Message{
+				Delivery:  auth.Email,
+				ExpiresAt: tc.expiresAt,
+			})
+
+			if stats.Calls.Record != 1 {
+				t.Errorf("incorrect DeliveryStatsService.Record() call count, want 1 got %v", stats.Calls.Record)
+			}
+			if recorded != tc.outcome {
+				t.Errorf("incorrect outcome, want %s got %s", tc.outcome, recorded)
+			}
+		})
+	}
+}
+
+func TestMsgConsumer_ExpiresByClock(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	expiresAt := c.Now().Add(time.Minute)
+
+	var recorded []auth.DeliveryOutcome
+	stats := &test.DeliveryStatsService{
+		RecordFn: func(delivery auth.DeliveryMethod, outcome auth.DeliveryOutcome) error {
+			recorded = append(recorded, outcome)
+			return nil
+		},
+	}
+	svc := NewService(
+		&test.MessageRepository{}, &smsMock{}, &emailMock{},
+		WithDeliveryStats(stats), WithClock(c),
+	).(*service)
+
+	svc.processMessage(context.Background(), &auth.Message{
+		Delivery:  auth.Email,
+		ExpiresAt: expiresAt,
+	})
+	c.Advance(time.Minute + time.Second)
+	svc.processMessage(context.Background(), &auth.Message{
+		Delivery:  auth.Email,
+		ExpiresAt: expiresAt,
+	})
+
+	want := []auth.DeliveryOutcome{auth.DeliverySent, auth.DeliveryExpired}
+	if !cmp.Equal(recorded, want) {
+		t.Error("incorrect delivery outcomes", cmp.Diff(want, recorded))
+	}
+}
+
+func TestMsgConsumer_TracksDelivery(t *testing.T) {
+	tt := []struct {
+		name      string
+		expiresAt time.Time
+		emailErr  error
+		statuses  []auth.MessageDeliveryStatus
+	}{
+		{
+			name:      "Tracks sent message",
+			expiresAt: time.Now().Add(time.Minute),
+			statuses:  []auth.MessageDeliveryStatus{auth.MessageQueued, auth.MessageSent},
+		},
+		{
+			name:      "Tracks failed message",
+			expiresAt: time.Now().Add(time.Minute),
+			emailErr:  fmt.Errorf("provider unavailable"),
+			statuses:  []auth.MessageDeliveryStatus{auth.MessageQueued, auth.MessageFailed},
+		},
+		{
+			name:      "Tracks expired message",
+			expiresAt: time.Now().Add(-time.Minute),
+			statuses:  []auth.MessageDeliveryStatus{auth.MessageFailed},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var statuses []auth.MessageDeliveryStatus
+			deliveryRepo := &test.MessageDeliveryRepository{
+				CreateFn: func(d *auth.MessageDelivery) error {
+					d.ID = "delivery-id"
+					statuses = append(statuses, d.Status)
+					return nil
+				},
+				UpdateStatusFn: func(id string, status auth.MessageDeliveryStatus, detail string) error {
+					if id != "delivery-id" {
+						t.Errorf("incorrect delivery ID, want delivery-id got %s", id)
+					}
+					statuses = append(statuses, status)
+					return nil
+				},
+			}
+			emailLib := emailMock{
+				EmailFn: func(ctx context.Context, email, subject, message string) error {
+					if id := msgdelivery.FromContext(ctx); id != "delivery-id" {
+						t.Errorf("incorrect delivery ID in context, want delivery-id got %s", id)
+					}
+					return tc.emailErr
+				},
+			}
+			svc := NewService(
+				&test.MessageRepository{}, &smsMock{}, &emailLib, WithDeliveryRepository(deliveryRepo),
+			).(*service)
+
+			svc.processMessage(context.Background(), &auth.Message{
+				Delivery:  auth.Email,
+				ExpiresAt: tc.expiresAt,
+			})
+
+			if !cmp.Equal(statuses, tc.statuses) {
+				t.Error(cmp.Diff(statuses, tc.statuses))
+			}
+		})
+	}
+}
+
+func TestMsgConsumer_SendsMatrix(t *testing.T) {
+	tt := []struct {
+		name      string
+		matrixLib *matrixMock
+		callCount int
+		outcome   auth.DeliveryOutcome
+	}{
+		{
+			name:      "Sends Matrix message",
+			matrixLib: &matrixMock{},
+			callCount: 1,
+			outcome:   auth.DeliverySent,
+		},
+		{
+			name:      "Fails without Matrix client",
+			callCount: 0,
+			outcome:   auth.DeliveryFailed,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var recorded auth.DeliveryOutcome
+			stats := &test.DeliveryStatsService{
+				RecordFn: func(delivery auth.DeliveryMethod, outcome auth.DeliveryOutcome) error {
+					recorded = outcome
+					return nil
+				},
+			}
+			options := []ConfigOption{WithDeliveryStats(stats)}
+			if tc.matrixLib != nil {
+				options = append(options, WithMatrix(tc.matrixLib))
+			}
+			svc := NewService(
+				&test.MessageRepository{}, &smsMock{}, &emailMock{}, options...,
+			).(*service)
+
+			svc.processMessage(context.Background(), &auth.Message{
+				Delivery:  auth.Matrix,
+				Address:   "@jane:example.com",
+				ExpiresAt: time.Now().Add(time.Minute),
+			})
+
+			if tc.matrixLib != nil && tc.matrixLib.callCount != tc.callCount {
+				t.Errorf("incorrect calls to Matrix library, want %v got %v",
+					tc.callCount, tc.matrixLib.callCount)
+			}
+			if recorded != tc.outcome {
+				t.Errorf("incorrect outcome, want %s got %s", tc.outcome, recorded)
+			}
+		})
+	}
+}
+
+func TestMsgConsumer_PrioritizesMessages(t *testing.T) {
+	release := make(chan bool)
+	delivered := make(chan string, 3)
+	// Workers deliver concurrently, so the email library does not
+	// count its calls.
+	emailLib := emailFunc(func(ctx context.Context, email, subject, message string) error {
+		if email == "digest@example.com" {
+			<-release
+		}
+		delivered <- email
+		return nil
+	})
+	messageRepo := test.MessageRepository{
+		RecentFn: func(ctx context.Context) (<-chan *auth.Message, <-chan error) {
+			msgc := make(chan *auth.Message)
+			go func() {
+				for _, msg := range []*auth.Message{
+					{Address: "digest@example.com", Priority: auth.PriorityLow},
+					{Address: "digest@example.com", Priority: auth.PriorityLow},
+					{Address: "otp@example.com", Priority: auth.PriorityHigh},
+				} {
+					msg.Delivery = auth.Email
+					msg.ExpiresAt = time.Now().Add(time.Minute)
+					msgc <- msg
+				}
+			}()
+			return msgc, make(chan error)
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumerSvc := NewService(
+		&messageRepo, &smsMock{}, emailLib,
+		WithWorkers(auth.PriorityLow, 1),
+	)
+	go func() {
+		_ = consumerSvc.Run(ctx)
+	}()
+
+	select {
+	case email := <-delivered:
+		if email != "otp@example.com" {
+			t.Errorf("incorrect message delivered first, want otp@example.com got %s", email)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("high priority message delayed behind low priority messages")
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-delivered:
+		case <-time.After(time.Second):
+			t.Fatal("low priority messages not delivered")
+		}
+	}
+}
+
+func TestMsgConsumer_BoundsQueues(t *testing.T) {
+	q := newQueue(1, discard.NewGauge())
+	ctx := context.Background()
+
+	if !q.push(ctx, &auth.Message{Address: "first@example.com"}) {
+		t.Fatal("expected message to be queued")
+	}
+
+	full, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	if q.push(full, &auth.Message{Address: "second@example.com"}) {
+		t.Fatal("expected push to a full queue to block")
+	}
+
+	pushed := make(chan bool)
+	go func() {
+		pushed <- q.push(ctx, &auth.Message{Address: "second@example.com"})
+	}()
+
+	msg, ok := q.pop(ctx)
+	if !ok || msg.Address != "first@example.com" {
+		t.Fatalf("incorrect message popped, want first@example.com got %v", msg)
+	}
+
+	select {
+	case ok = <-pushed:
+		if !ok {
+			t.Error("expected message to be queued once space is available")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("push not released once space is available")
+	}
+}
+
+func TestMsgConsumer_DrainsQueuesOnShutdown(t *testing.T) {
+	tt := []struct {
+		name         string
+		drainTimeout time.Duration
+		delivered    int
+		deadLettered float64
+	}{
+		{
+			name:         "Queued messages delivered",
+			drainTimeout: time.Second,
+			delivered:    3,
+		},
+		{
+			name:         "Queued messages dead lettered after timeout",
+			drainTimeout: time.Millisecond * 50,
+			delivered:    1,
+			deadLettered: 2,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			started := make(chan bool, 3)
+			release := make(chan bool)
+			delivered := make(chan string, 3)
+			emailLib := emailFunc(func(ctx context.Context, email, subject, message string) error {
+				started <- true
+				select {
+				case <-release:
+				case <-time.After(tc.drainTimeout * 2):
+				}
+				delivered <- email
+				return nil
+			})
+
+			messageRepo := test.MessageRepository{
+				RecentFn: func(ctx context.Context) (<-chan *auth.Message, <-chan error) {
+					msgc := make(chan *auth.Message)
+					errc := make(chan error, 1)
+					go func() {
+						defer close(msgc)
+						for i := 0; i < 3; i++ {
+							msgc <- &auth.Message{
+								Address:   fmt.Sprintf("user%v@example.com", i),
+								Delivery:  auth.Email,
+								Priority:  auth.PriorityLow,
+								ExpiresAt: time.Now().Add(time.Minute),
+							}
+						}
+						<-ctx.Done()
+						errc <- ctx.Err()
+					}()
+					return msgc, errc
+				},
+			}
+
+			deadLetters := &counterMock{}
+			metrics := discardMetrics()
+			metrics.DeadLetters = deadLetters
+			consumerSvc := NewService(
+				&messageRepo, &smsMock{}, emailLib,
+				WithWorkers(auth.PriorityLow, 1),
+				WithQueueSize(2),
+				WithDrainTimeout(tc.drainTimeout),
+				WithMetrics(metrics),
+			)
+
+			errc := make(chan error)
+			go func() {
+				errc <- consumerSvc.Run(ctx)
+			}()
+
+			<-started
+			cancel()
+			if tc.deadLettered == 0 {
+				close(release)
+			}
+
+			select {
+			case <-errc:
+			case <-time.After(time.Second * 5):
+				t.Fatal("consumer did not stop")
+			}
+
+			if tc.deadLettered != 0 {
+				close(release)
+			}
+			if deadLetters.value != tc.deadLettered {
+				t.Errorf("incorrect dead lettered messages, want %v got %v",
+					tc.deadLettered, deadLetters.value)
+			}
+
+			count := 0
+			for done := false; !done; {
+				select {
+				case <-delivered:
+					count++
+				case <-time.After(tc.drainTimeout * 3):
+					done = true
+				}
+			}
+			if count != tc.delivered {
+				t.Errorf("incorrect delivered messages, want %v got %v", tc.delivered, count)
+			}
+		})
+	}
+}
+
+type counterMock struct {
+	labels []string
+	value  float64
+}
+
+func (c *counterMock) With(labelValues ...string) metrics.Counter {
+	c.labels = labelValues
+	return c
+}
+
+func (c *counterMock) Add(delta float64) {
+	c.value += delta
+}
+
+type histogramMock struct {
+	labels       []string
+	observations int
+}
+
+func (h *histogramMock) With(labelValues ...string) metrics.Histogram {
+	h.labels = labelValues
+	return h
+}
+
+func (h *histogramMock) Observe(value float64) {
+	h.observations++
+}
+
+func TestMsgConsumer_RecordsMetrics(t *testing.T) {
+	tt := []struct {
+		name             string
+		expiresAt        time.Time
+		emailErr         error
+		publishErr       error
+		durationLabels   []string
+		retries          float64
+		deadLetterLabels []string
+		stats            QueueStats
+	}{
+		{
+			name:           "Sent message",
+			expiresAt:      time.Now().Add(time.Minute),
+			durationLabels: []string{"delivery", "email", "provider", "smtp", "outcome", "sent"},
+			stats:          QueueStats{Priority: auth.PriorityNormal, Workers: 1, Sent: 1},
+		},
+		{
+			name:           "Retried message",
+			expiresAt:      time.Now().Add(time.Minute),
+			emailErr:       fmt.Errorf("provider unavailable"),
+			durationLabels: []string{"delivery", "email", "provider", "smtp", "outcome", "failed"},
+			retries:        1,
+			stats:          QueueStats{Priority: auth.PriorityNormal, Workers: 1, Retried: 1},
+		},
+		{
+			name:             "Failed retry",
+			expiresAt:        time.Now().Add(time.Minute),
+			emailErr:         fmt.Errorf("provider unavailable"),
+			publishErr:       fmt.Errorf("cannot publish expired message"),
+			durationLabels:   []string{"delivery", "email", "provider", "smtp", "outcome", "failed"},
+			deadLetterLabels: []string{"delivery", "email", "reason", DeadLetterRetryFailed},
+			stats:            QueueStats{Priority: auth.PriorityNormal, Workers: 1, DeadLettered: 1},
+		},
+		{
+			name:             "Expired message",
+			expiresAt:        time.Now().Add(-time.Minute),
+			deadLetterLabels: []string{"delivery", "email", "reason", DeadLetterExpired},
+			stats:            QueueStats{Priority: auth.PriorityNormal, Workers: 1, DeadLettered: 1},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			duration := &histogramMock{}
+			retries := &counterMock{}
+			deadLetters := &counterMock{}
+			emailLib := emailMock{
+				EmailFn: func(ctx context.Context, email, subject, message string) error {
+					return tc.emailErr
+				},
+			}
+			messageRepo := test.MessageRepository{
+				PublishFn: func(ctx context.Context, msg *auth.Message) error {
+					return tc.publishErr
+				},
+			}
+			svc := NewService(
+				&messageRepo, &smsMock{}, &emailLib,
+				WithProvider(auth.Email, "smtp"),
+				WithMetrics(Metrics{
+					QueueDepth:       discard.NewGauge(),
+					DeliveryDuration: duration,
+					Retries:          retries,
+					DeadLetters:      deadLetters,
+				}),
+			).(*service)
+			svc.queues[auth.PriorityNormal] = newQueue(defaultQueueSize, discard.NewGauge())
+			svc.queueStats[auth.PriorityNormal] = &QueueStats{Priority: auth.PriorityNormal, Workers: 1}
+
+			svc.processMessage(context.Background(), &auth.Message{
+				Delivery:  auth.Email,
+				Priority:  auth.PriorityNormal,
+				ExpiresAt: tc.expiresAt,
+			})
+
+			if !cmp.Equal(duration.labels, tc.durationLabels) {
+				t.Error(cmp.Diff(duration.labels, tc.durationLabels))
+			}
+			if len(tc.durationLabels) > 0 && duration.observations != 1 {
+				t.Errorf("incorrect delivery duration observations, want 1 got %v", duration.observations)
+			}
+			if retries.value != tc.retries {
+				t.Errorf("incorrect retries, want %v got %v", tc.retries, retries.value)
+			}
+			if !cmp.Equal(deadLetters.labels, tc.deadLetterLabels) {
+				t.Error(cmp.Diff(deadLetters.labels, tc.deadLetterLabels))
+			}
+			if !cmp.Equal(svc.Queues(), []QueueStats{tc.stats}) {
+				t.Error(cmp.Diff(svc.Queues(), []QueueStats{tc.stats}))
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+// Package msgdelivery correlates attempts to deliver a message with
+// the status reports of providers. The ID of a MessageDelivery is set
+// in context for providers to attach to the message they send, and
+// returned to us when the provider reports on its progress.
+package msgdelivery
+
+import (
+	"context"
+	"net/url"
+)
+
+type contextKey string
+
+const deliveryIDContextKey contextKey = "deliveryID"
+
+// IDParam is the name of the parameter providers return a
+// MessageDelivery's ID in.
+const IDParam = "deliveryID"
+
+// NewContext returns a context carrying the ID of a MessageDelivery.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, deliveryIDContextKey, id)
+}
+
+// FromContext returns the ID of the MessageDelivery in context.
+// It is empty if deliveries are not tracked.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(deliveryIDContextKey).(string)
+	return id
+}
+
+// CallbackURL returns a status callback URL identifying a
+// MessageDelivery through a query parameter.
+func CallbackURL(base, id string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set(IDParam, id)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
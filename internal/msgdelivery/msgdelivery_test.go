@@ -0,0 +1,49 @@
+package msgdelivery
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMsgDelivery_Context(t *testing.T) {
+	ctx := context.Background()
+	if id := FromContext(ctx); id != "" {
+		t.Errorf("expected empty ID, got %s", id)
+	}
+
+	ctx = NewContext(ctx, "01EF3Z6V5QJ2XN4WQ3Y8ZK1ABC")
+	if id := FromContext(ctx); id != "01EF3Z6V5QJ2XN4WQ3Y8ZK1ABC" {
+		t.Errorf("incorrect ID, want 01EF3Z6V5QJ2XN4WQ3Y8ZK1ABC got %s", id)
+	}
+}
+
+func TestMsgDelivery_CallbackURL(t *testing.T) {
+	tt := []struct {
+		name     string
+		base     string
+		expected string
+	}{
+		{
+			name:     "Adds delivery ID",
+			base:     "https://auth.example.com/api/v1/delivery/twilio",
+			expected: "https://auth.example.com/api/v1/delivery/twilio?deliveryID=abc",
+		},
+		{
+			name:     "Preserves existing query",
+			base:     "https://auth.example.com/api/v1/delivery/twilio?region=eu",
+			expected: "https://auth.example.com/api/v1/delivery/twilio?deliveryID=abc&region=eu",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := CallbackURL(tc.base, "abc")
+			if err != nil {
+				t.Fatal("failed to create callback URL:", err)
+			}
+			if u != tc.expected {
+				t.Errorf("incorrect URL, want %s got %s", tc.expected, u)
+			}
+		})
+	}
+}
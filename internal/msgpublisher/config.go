@@ -6,16 +6,25 @@ import (
 	"github.com/go-kit/kit/log"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/branding"
 )
 
-// defaultExpiry is the default expiry time for a message to be published.
-const defaultExpiry = time.Minute * 10
+const (
+	// defaultExpiry is the default expiry time for a message to be published.
+	defaultExpiry = time.Minute * 10
+	// defaultAppName is the default name of the service in messages.
+	defaultAppName = "Authenticator"
+	// defaultCodeExpiry is the default time OTP codes are valid for.
+	defaultCodeExpiry = time.Minute * 5
+)
 
 // NewService returns a new implementation of auth.MessagingService.
 func NewService(r auth.MessageRepository, options ...ConfigOption) auth.MessagingService {
 	s := service{
 		messageRepo: r,
 		expireAfter: defaultExpiry,
+		appName:     defaultAppName,
+		codeExpiry:  defaultCodeExpiry,
 		logger:      log.NewNopLogger(),
 	}
 
@@ -44,3 +53,45 @@ func WithExpiry(t time.Duration) ConfigOption {
 		s.expireAfter = t
 	}
 }
+
+// WithSenders configures the senders of messages by category and
+// tenant. Messages without a matching rule are sent from the
+// provider's default sender.
+func WithSenders(rules []SenderRule) ConfigOption {
+	return func(s *service) {
+		s.senders = rules
+	}
+}
+
+// WithSMSTemplates configures localized SMS templates. Messages are
+// rendered in the client's most preferred language with a template.
+func WithSMSTemplates(t SMSTemplates) ConfigOption {
+	return func(s *service) {
+		s.localized = t
+	}
+}
+
+// WithAppName sets the name of the service in messages. Messages sent
+// on behalf of a ClientApplication use its name instead.
+func WithAppName(name string) ConfigOption {
+	return func(s *service) {
+		s.appName = name
+	}
+}
+
+// WithBrand wraps emails in a layout showing the brand's logo and
+// support address. Messages sent on behalf of a ClientApplication
+// keep the layout but show its name.
+func WithBrand(b branding.Brand) ConfigOption {
+	return func(s *service) {
+		s.brand = b.WithDefaults()
+	}
+}
+
+// WithCodeExpiry sets the time OTP codes are valid for, as shown
+// in messages.
+func WithCodeExpiry(d time.Duration) ConfigOption {
+	return func(s *service) {
+		s.codeExpiry = d
+	}
+}
@@ -0,0 +1,111 @@
+package msgpublisher
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+)
+
+// anyCategory matches every MessageCategory in a SenderRule.
+const anyCategory auth.MessageCategory = "*"
+
+// smsSenderID matches alphanumeric SMS sender IDs.
+var smsSenderID = regexp.MustCompile(`^[A-Za-z0-9 ]{1,11}$`)
+
+var categories = map[auth.MessageCategory]bool{
+	auth.MessageCategoryOTP:      true,
+	auth.MessageCategorySecurity: true,
+	auth.MessageCategoryDigest:   true,
+	auth.MessageCategoryInvite:   true,
+	anyCategory:                  true,
+}
+
+// SenderRule overrides the sender of messages in a category, sent on
+// behalf of a tenant. A rule without a tenant applies to messages sent
+// on behalf of any tenant.
+type SenderRule struct {
+	Tenant   string
+	Category auth.MessageCategory
+	Sender   auth.MessageSender
+}
+
+// ParseSenders parses sender rules separated by semicolons. Each rule
+// is a scope and a sender separated by an equals sign. A scope is a
+// MessageCategory, optionally prefixed by a ClientApplication ID and a
+// slash, where `*` matches every category. Email senders are formatted
+// as an address, e.g. `otp=Example <otp@example.com>`, while any other
+// sender is an SMS phone number or alphanumeric sender ID, e.g.
+// `01EF3Z6V5QJ2XN4WQ3Y8ZK1ABC/*=Partner`. A scope may be repeated to
+// set both.
+func ParseSenders(s string) ([]SenderRule, error) {
+	var rules []SenderRule
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid sender rule %q", entry)
+		}
+
+		rule := SenderRule{Category: auth.MessageCategory(strings.TrimSpace(parts[0]))}
+		if i := strings.LastIndex(string(rule.Category), "/"); i >= 0 {
+			rule.Tenant = strings.TrimSpace(string(rule.Category[:i]))
+			rule.Category = auth.MessageCategory(strings.TrimSpace(string(rule.Category[i+1:])))
+		}
+		if !categories[rule.Category] {
+			return nil, fmt.Errorf("invalid sender rule %q: unknown category %q", entry, rule.Category)
+		}
+
+		sender := strings.TrimSpace(parts[1])
+		if addr, err := mail.ParseAddress(sender); err == nil {
+			rule.Sender.FromAddr = addr.Address
+			rule.Sender.FromName = addr.Name
+		} else if contactchecker.IsPhoneValid(sender) {
+			rule.Sender.SMSSender = contactchecker.NormalizePhone(sender)
+		} else if smsSenderID.MatchString(sender) {
+			rule.Sender.SMSSender = sender
+		} else {
+			return nil, fmt.Errorf("invalid sender rule %q: sender is not an email, phone number or sender ID", entry)
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// sender resolves the sender of a message. Fields already set on the
+// message take precedence, followed by rules for the message's tenant
+// and category, the tenant, and the category.
+func (s *service) sender(msg *auth.Message) auth.MessageSender {
+	sender := msg.Sender
+	category := msg.Type.Category()
+
+	scopes := []SenderRule{
+		{Tenant: msg.Tenant, Category: category},
+		{Tenant: msg.Tenant, Category: anyCategory},
+		{Category: category},
+		{Category: anyCategory},
+	}
+	for _, scope := range scopes {
+		for _, rule := range s.senders {
+			if rule.Tenant != scope.Tenant || rule.Category != scope.Category {
+				continue
+			}
+			if sender.FromAddr == "" {
+				sender.FromAddr = rule.Sender.FromAddr
+				sender.FromName = rule.Sender.FromName
+			}
+			if sender.SMSSender == "" {
+				sender.SMSSender = rule.Sender.SMSSender
+			}
+		}
+	}
+	return sender
+}
@@ -0,0 +1,153 @@
+package msgpublisher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clientapp"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestMsgPublisher_ParseSenders(t *testing.T) {
+	tt := []struct {
+		name     string
+		senders  string
+		hasError bool
+		rules    []SenderRule
+	}{
+		{
+			name: "Parses rules",
+			senders: "otp=Example <otp@example.com>; otp=+1 (415) 555-2671;" +
+				"client-id/*=Partner;client-id/digest=digest@partner.com",
+			rules: []SenderRule{
+				{
+					Category: auth.MessageCategoryOTP,
+					Sender:   auth.MessageSender{FromAddr: "otp@example.com", FromName: "Example"},
+				},
+				{
+					Category: auth.MessageCategoryOTP,
+					Sender:   auth.MessageSender{SMSSender: "+14155552671"},
+				},
+				{
+					Tenant:   "client-id",
+					Category: anyCategory,
+					Sender:   auth.MessageSender{SMSSender: "Partner"},
+				},
+				{
+					Tenant:   "client-id",
+					Category: auth.MessageCategoryDigest,
+					Sender:   auth.MessageSender{FromAddr: "digest@partner.com"},
+				},
+			},
+		},
+		{
+			name:     "Rejects unknown category",
+			senders:  "marketing=news@example.com",
+			hasError: true,
+		},
+		{
+			name:     "Rejects invalid sender",
+			senders:  "otp=not a valid sender id",
+			hasError: true,
+		},
+		{
+			name:     "Rejects missing sender",
+			senders:  "otp",
+			hasError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, err := ParseSenders(tc.senders)
+			if tc.hasError {
+				if err == nil {
+					t.Error("expected error, received nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+			if !cmp.Equal(rules, tc.rules) {
+				t.Error(cmp.Diff(rules, tc.rules))
+			}
+		})
+	}
+}
+
+func TestMsgPublisher_SendsFromSender(t *testing.T) {
+	rules, err := ParseSenders(
+		"otp=Example <otp@example.com>;otp=ExampleOTP;security=security@example.com;" +
+			"client-id/*=Partner <no-reply@partner.com>;client-id/otp=PartnerOTP",
+	)
+	if err != nil {
+		t.Fatal("failed to parse senders:", err)
+	}
+
+	tt := []struct {
+		name     string
+		msgType  auth.MessageType
+		clientID string
+		sender   auth.MessageSender
+	}{
+		{
+			name:    "Uses category sender",
+			msgType: auth.OTPLogin,
+			sender:  auth.MessageSender{FromAddr: "otp@example.com", FromName: "Example", SMSSender: "ExampleOTP"},
+		},
+		{
+			name:    "Uses provider default without rule",
+			msgType: auth.LoginDigest,
+		},
+		{
+			name:     "Prefers tenant sender",
+			msgType:  auth.OTPLogin,
+			clientID: "client-id",
+			sender:   auth.MessageSender{FromAddr: "no-reply@partner.com", FromName: "Partner", SMSSender: "PartnerOTP"},
+		},
+		{
+			name:     "Falls back to category sender for other tenants",
+			msgType:  auth.SecurityChange,
+			clientID: "other-client-id",
+			sender:   auth.MessageSender{FromAddr: "security@example.com"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var published *auth.Message
+			repo := test.MessageRepository{
+				PublishFn: func(ctx context.Context, msg *auth.Message) error {
+					published = msg
+					return nil
+				},
+			}
+			svc := NewService(&repo, WithSenders(rules))
+
+			ctx := context.Background()
+			if tc.clientID != "" {
+				ctx = clientapp.NewContext(ctx, &auth.ClientApplication{ID: tc.clientID})
+			}
+			err := svc.Send(ctx, &auth.Message{
+				Type:     tc.msgType,
+				Delivery: auth.Email,
+				Address:  "jane@example.com",
+				Content:  "hello world",
+			})
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+
+			if published.Tenant != tc.clientID {
+				t.Errorf("incorrect tenant, want '%s' got '%s'", tc.clientID, published.Tenant)
+			}
+			if published.Sender != tc.sender {
+				t.Errorf("incorrect sender, want %+v got %+v", tc.sender, published.Sender)
+			}
+		})
+	}
+}
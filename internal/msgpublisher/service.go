@@ -4,12 +4,15 @@ package msgpublisher
 import (
 	"context"
 	"fmt"
+	"html"
 	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/branding"
+	"github.com/fmitra/authenticator/internal/clientapp"
 	"github.com/fmitra/authenticator/internal/contactchecker"
 )
 
@@ -21,6 +24,11 @@ type service struct {
 	smsTemplates   map[auth.MessageType]string
 	emailTemplates map[auth.MessageType]string
 	subjects       map[auth.MessageType]string
+	localized      SMSTemplates
+	senders        []SenderRule
+	appName        string
+	brand          branding.Brand
+	codeExpiry     time.Duration
 }
 
 // Send sends a message to a User. Behind the scenes, a message is stored
@@ -30,10 +38,22 @@ func (s *service) Send(ctx context.Context, msg *auth.Message) error {
 		return fmt.Errorf("invalid message delivery method")
 	}
 
-	if err := s.setMessageFields(msg); err != nil {
+	if isText(msg.Delivery) && msg.Locale == "" {
+		msg.Locale = s.smsLocale(ctx, msg.Type)
+	}
+
+	if err := s.setMessageFields(msg, s.vars(ctx, msg)); err != nil {
 		return err
 	}
 
+	if app := clientapp.FromContext(ctx); app != nil && msg.Tenant == "" {
+		msg.Tenant = app.ID
+	}
+	msg.Sender = s.sender(msg)
+	if msg.Priority == "" {
+		msg.Priority = msg.Type.Priority()
+	}
+
 	if err := s.messageRepo.Publish(ctx, msg); err != nil {
 		return fmt.Errorf("failed to publish to repository: %w", err)
 	}
@@ -41,20 +61,26 @@ func (s *service) Send(ctx context.Context, msg *auth.Message) error {
 	return nil
 }
 
-func (s *service) setMessageFields(msg *auth.Message) error {
-	msg.ExpiresAt = time.Now().Add(s.expireAfter)
+func (s *service) setMessageFields(msg *auth.Message, vars map[string]string) error {
+	// Scheduled messages may be delivered for the same time
+	// after they are due.
+	sendAt := time.Now()
+	if msg.NotBefore.After(sendAt) {
+		sendAt = msg.NotBefore
+	}
+	msg.ExpiresAt = sendAt.Add(s.expireAfter)
 
 	// Message content was set by caller. Do not overwrite.
 	if msg.Content != "" {
 		return nil
 	}
 
-	template := s.template(msg.Type, msg.Delivery)
+	template := s.template(msg.Type, msg.Delivery, msg.Locale)
 	if template == "" {
 		return fmt.Errorf("no template set for %s", msg.Type)
 	}
 
-	for k, v := range msg.Vars {
+	for k, v := range vars {
 		k = fmt.Sprintf("{{%s}}", k)
 		template = strings.Replace(template, k, v, -1)
 	}
@@ -68,8 +94,14 @@ func (s *service) setMessageFields(msg *auth.Message) error {
 	return nil
 }
 
-func (s *service) template(t auth.MessageType, d auth.DeliveryMethod) string {
-	if d == auth.Phone {
+func (s *service) template(t auth.MessageType, d auth.DeliveryMethod, locale string) string {
+	if isText(d) {
+		if template := s.localized[locale][t]; template != "" {
+			return template
+		}
+		if template := s.localized[DefaultLocale][t]; template != "" {
+			return template
+		}
 		return s.smsTemplates[t]
 	}
 
@@ -80,12 +112,32 @@ func (s *service) template(t auth.MessageType, d auth.DeliveryMethod) string {
 	return ""
 }
 
+// isText reports whether a delivery method sends plain text messages.
+// Matrix messages share SMS templates.
+func isText(d auth.DeliveryMethod) bool {
+	return d == auth.Phone || d == auth.Matrix
+}
+
 func (s *service) createTemplates() {
 	s.smsTemplates = map[auth.MessageType]string{
-		auth.OTPLogin:   "Your login code is {{code}}",
-		auth.OTPSignup:  "Your signup code is {{code}}",
-		auth.OTPResend:  "Youre new code is {{code}}",
-		auth.OTPAddress: "Use the code {{code}} to verify your new contact address",
+		auth.OTPLogin:      "Your login code is {{code}}",
+		auth.OTPSignup:     "Your signup code is {{code}}",
+		auth.OTPResend:     "Youre new code is {{code}}",
+		auth.OTPAddress:    "Use the code {{code}} to verify your new contact address",
+		auth.OTPUnlock:     "Use the code {{code}} to unlock your account",
+		auth.CanaryAlert:   "Login attempted on canary account {{identity}} from {{ip}} ({{location}})",
+		auth.LoginApproval: "Approve your login: {{link}}",
+		auth.AccountRecovery: "Your account will be recovered with a security key after {{available_at}}. " +
+			"If this was not you, cancel: {{link}}",
+		auth.TrustedContactShare: "{{identity}} chose you as a trusted contact to recover their account. " +
+			"Only share this code with them if they ask for it: {{share}}. Confirm you received it: {{link}}",
+		auth.SecurityChange: "A request was made to {{change}}. It takes effect after {{available_at}}. " +
+			"If this was not you, cancel: {{link}}",
+		auth.TFAEnrollmentReminder: "Enroll an authenticator app or security key before {{deadline}} " +
+			"to keep full access to your account",
+		auth.PasswordReset: "Your password was expired as a security precaution. Set a new password: {{link}}",
+		auth.BreachAlert: "Your account credentials may have been compromised. To protect you, " +
+			"{{changes}}. Secure your email and any accounts sharing your password",
 	}
 
 	s.emailTemplates = map[auth.MessageType]string{
@@ -105,12 +157,132 @@ func (s *service) createTemplates() {
 			<span>Code: <strong>{{code}}</strong></span>
 			<p>Enter the code above to verify your new contact address</p>
 		`,
+		auth.OTPUnlock: `
+			<span>Code: <strong>{{code}}</strong></span>
+			<p>Your account was locked after repeated failed logins.
+			Enter the code above to unlock it.</p>
+			<p>If you did not request this, change your password.</p>
+		`,
+		auth.CanaryAlert: `
+			<span>Login attempted on canary account <strong>{{identity}}</strong></span>
+			<p>Source IP: {{ip}} ({{location}})</p>
+			<p>Canary accounts do not belong to real users. This attempt
+			suggests a leaked credential list is being tested against the service.</p>
+		`,
+		auth.LoginDigest: `
+			<span>Here's your account activity since {{since}}</span>
+			<p>Sign-ins:</p>
+			<ul>{{logins}}</ul>
+			<p>New devices:</p>
+			<ul>{{devices}}</ul>
+			<p>If you don't recognize this activity, change your password
+			and remove unknown devices.</p>
+		`,
+		auth.OrganizationInvite: `
+			<span>You've been invited to join <strong>{{organization}}</strong></span>
+			<p>Invitation: {{invitation_id}}</p>
+			<p>Code: <strong>{{code}}</strong></p>
+			<p>Sign in with this email address and enter the code above
+			to accept the invitation.</p>
+			<p>Alternatively, accept with the token: {{token}}</p>
+		`,
+		auth.LoginApproval: `
+			<span>A login to your account is awaiting approval</span>
+			<p><a href="{{link}}">Approve login</a></p>
+			<p>If you did not attempt to login, ignore this message
+			and change your password.</p>
+		`,
+		auth.AccountRecovery: `
+			<span>A request was made to recover your account with a security key</span>
+			<p>Access will be granted after {{available_at}}.</p>
+			<p>If you did not request this, <a href="{{link}}">cancel the recovery</a>
+			and remove unknown devices.</p>
+		`,
+		auth.TrustedContactShare: `
+			<span><strong>{{identity}}</strong> chose you as a trusted contact to recover their account</span>
+			<p>Recovery code share: <strong>{{share}}</strong></p>
+			<p>Keep this message. Only share the code with them if they lose
+			access to their account and ask you for it.</p>
+			<p><a href="{{link}}">Confirm you received this code</a></p>
+		`,
+		auth.SecurityChange: `
+			<span>A request was made to {{change}}</span>
+			<p>The change takes effect after {{available_at}}.</p>
+			<p>If you did not request this, <a href="{{link}}">cancel the change</a>
+			and change your password.</p>
+		`,
+		auth.TFAEnrollmentReminder: `
+			<span>Your account requires two-factor authentication</span>
+			<p>Enroll an authenticator app or security key before {{deadline}}.</p>
+			<p>After this date, you will only be able to sign in to complete
+			the enrollment.</p>
+		`,
+		auth.BreachAlert: `
+			<span>Your account credentials may have been compromised</span>
+			<p>To protect your account, {{changes}}.</p>
+			<p>Follow any instructions we sent separately to regain access. Change
+			the password of other accounts where you used the same password, and
+			secure your email account.</p>
+		`,
+		auth.PasswordReset: `
+			<span>Your password was expired as a security precaution</span>
+			<p>You must <a href="{{link}}">set a new password</a> before you
+			can login with a password again. Setting a new password signs
+			out your existing sessions.</p>
+		`,
+	}
+
+	if s.brand.Name != "" {
+		for t, content := range s.emailTemplates {
+			s.emailTemplates[t] = brandedEmail(s.brand, content)
+		}
 	}
 
 	s.subjects = map[auth.MessageType]string{
-		auth.OTPAddress: "Verify your contact details",
-		auth.OTPLogin:   "Your login verification code",
-		auth.OTPResend:  "You've requested a new verification code",
-		auth.OTPSignup:  "Your signup verification code",
+		auth.OTPAddress:            "Verify your contact details",
+		auth.OTPLogin:              "Your login verification code",
+		auth.OTPResend:             "You've requested a new verification code",
+		auth.OTPSignup:             "Your signup verification code",
+		auth.CanaryAlert:           "Canary account login attempt",
+		auth.LoginDigest:           "Your recent account activity",
+		auth.OrganizationInvite:    "You've been invited to an organization",
+		auth.LoginApproval:         "Approve your login",
+		auth.AccountRecovery:       "Your account is being recovered",
+		auth.TrustedContactShare:   "You've been chosen as a trusted contact",
+		auth.SecurityChange:        "A change to your account was requested",
+		auth.TFAEnrollmentReminder: "Enroll a second factor on your account",
+		auth.OTPUnlock:             "Unlock your account",
+		auth.PasswordReset:         "Reset your password",
+		auth.BreachAlert:           "Your account may be compromised",
 	}
 }
+
+// brandedEmail wraps the content of an email in a layout showing the
+// brand's logo, or the name of the service if there is none, and its
+// support address.
+func brandedEmail(b branding.Brand, content string) string {
+	color := html.EscapeString(b.Color)
+
+	header := fmt.Sprintf(`<strong style="color: %s;">{{app_name}}</strong>`, color)
+	if b.LogoURL != "" {
+		header = fmt.Sprintf(`<img src="%s" alt="{{app_name}}" style="max-height: 48px;">`,
+			html.EscapeString(b.LogoURL),
+		)
+	}
+
+	var footer string
+	if b.SupportEmail != "" {
+		email := html.EscapeString(b.SupportEmail)
+		footer = fmt.Sprintf(
+			`<p style="margin-top: 32px; font-size: 13px; color: #666;">`+
+				`Need help? Contact <a href="mailto:%s" style="color: %s;">%s</a></p>`,
+			email, color, email,
+		)
+	}
+
+	return fmt.Sprintf(
+		`<div style="max-width: 560px; margin: 0 auto; font-family: Helvetica, Arial, sans-serif; color: #222;">`+
+			`<p>%s</p>%s%s</div>`,
+		header, content, footer,
+	)
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/branding"
 	"github.com/fmitra/authenticator/internal/test"
 )
 
@@ -27,6 +29,9 @@ func TestMsgPublisher_Send(t *testing.T) {
 				if msg.Delivery != auth.Phone {
 					t.Errorf("incorrect delivery method: want %s, got %s", auth.Phone, msg.Delivery)
 				}
+				if msg.Priority != auth.PriorityHigh {
+					t.Errorf("incorrect priority: want %s, got %s", auth.PriorityHigh, msg.Priority)
+				}
 				if !strings.Contains(msg.Content, "111") {
 					t.Errorf("variable not set in msg: %s", msg.Content)
 				}
@@ -57,6 +62,27 @@ func TestMsgPublisher_Send(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name:           "Sends Matrix message",
+			deliveryMethod: auth.Matrix,
+			address:        "@jane:example.com",
+			isFailed:       false,
+			publishMock: func(ctx context.Context, msg *auth.Message) error {
+				if msg.Content != "Your login code is 111" {
+					t.Errorf("incorrect Matrix message content: %s", msg.Content)
+				}
+				return nil
+			},
+		},
+		{
+			name:           "Fails to send to invalid Matrix ID",
+			deliveryMethod: auth.Matrix,
+			address:        "jane@example.com",
+			isFailed:       true,
+			publishMock: func(ctx context.Context, msg *auth.Message) error {
+				return nil
+			},
+		},
 		{
 			name:           "Fails to send email",
 			deliveryMethod: auth.Email,
@@ -93,3 +119,84 @@ func TestMsgPublisher_Send(t *testing.T) {
 		})
 	}
 }
+
+func TestMsgPublisher_SendScheduled(t *testing.T) {
+	notBefore := time.Now().Add(time.Hour * 24)
+	messageRepo := test.MessageRepository{
+		PublishFn: func(ctx context.Context, msg *auth.Message) error {
+			if !msg.NotBefore.Equal(notBefore) {
+				t.Errorf("incorrect NotBefore: want %s, got %s", notBefore, msg.NotBefore)
+			}
+			if want := notBefore.Add(time.Minute * 10); !msg.ExpiresAt.Equal(want) {
+				t.Errorf("incorrect ExpiresAt: want %s, got %s", want, msg.ExpiresAt)
+			}
+			return nil
+		},
+	}
+
+	publisherSvc := NewService(&messageRepo, WithExpiry(time.Minute*10))
+	err := publisherSvc.Send(context.Background(), &auth.Message{
+		Type:      auth.OTPLogin,
+		Delivery:  auth.Email,
+		Address:   "jane@example.com",
+		NotBefore: notBefore,
+		Vars: map[string]string{
+			"code": "111",
+		},
+	})
+	if err != nil {
+		t.Error("expected nil error, received:", err)
+	}
+	if messageRepo.Calls.Publish != 1 {
+		t.Errorf("incorrect MessageRepository.Publish() call count, want 1 got %v", messageRepo.Calls.Publish)
+	}
+}
+
+func TestMsgPublisher_BrandedEmail(t *testing.T) {
+	var published *auth.Message
+	repo := test.MessageRepository{
+		PublishFn: func(ctx context.Context, msg *auth.Message) error {
+			published = msg
+			return nil
+		},
+	}
+	svc := NewService(&repo, WithAppName("Acme"), WithBrand(branding.Brand{
+		Name:         "Acme",
+		LogoURL:      "https://acme.com/logo.png?size=2&v=1",
+		Color:        "#ff0000",
+		SupportEmail: "help@acme.com",
+	}))
+
+	err := svc.Send(context.Background(), &auth.Message{
+		Type:     auth.OTPLogin,
+		Delivery: auth.Email,
+		Address:  "jane@example.com",
+		Vars:     map[string]string{"code": "111"},
+	})
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+
+	for _, want := range []string{
+		`<img src="https://acme.com/logo.png?size=2&amp;v=1" alt="Acme"`,
+		"<strong>111</strong>",
+		`<a href="mailto:help@acme.com" style="color: #ff0000;">help@acme.com</a>`,
+	} {
+		if !strings.Contains(published.Content, want) {
+			t.Errorf("expected content to contain %s, got %s", want, published.Content)
+		}
+	}
+
+	err = svc.Send(context.Background(), &auth.Message{
+		Type:     auth.OTPLogin,
+		Delivery: auth.Phone,
+		Address:  "+639455189172",
+		Vars:     map[string]string{"code": "111"},
+	})
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	if published.Content != "Your login code is 111" {
+		t.Errorf("expected SMS not to be branded, got %s", published.Content)
+	}
+}
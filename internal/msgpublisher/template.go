@@ -0,0 +1,94 @@
+package msgpublisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clientapp"
+	"github.com/fmitra/authenticator/internal/locale"
+)
+
+// DefaultLocale is the key of SMSTemplates replacing the built-in
+// templates for clients without a supported preferred language.
+const DefaultLocale = "default"
+
+// SMSTemplates are SMS templates by locale and MessageType, e.g.
+// `{"es": {"otp_login": "{{app_name}}: tu código es {{code}}"}}`.
+// Besides the variables of a message, templates may use the
+// `{{app_name}}` and `{{expiry}}` placeholders.
+type SMSTemplates map[string]map[auth.MessageType]string
+
+// ReadSMSTemplates reads SMSTemplates encoded as JSON. Locales are
+// language tags such as `pt` or `pt-BR`, or DefaultLocale.
+func ReadSMSTemplates(r io.Reader) (SMSTemplates, error) {
+	var raw SMSTemplates
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("cannot decode SMS templates: %w", err)
+	}
+
+	templates := make(SMSTemplates, len(raw))
+	for key, byType := range raw {
+		tag := key
+		if key != DefaultLocale {
+			var err error
+			if tag, err = locale.Parse(key); err != nil {
+				return nil, fmt.Errorf("invalid SMS template locale %q: %w", key, err)
+			}
+		}
+		for t := range byType {
+			if !knownTypes[t] {
+				return nil, fmt.Errorf("invalid SMS template %q for locale %q", t, key)
+			}
+		}
+		templates[tag] = byType
+	}
+	return templates, nil
+}
+
+var knownTypes = map[auth.MessageType]bool{
+	auth.OTPAddress:            true,
+	auth.OTPResend:             true,
+	auth.OTPLogin:              true,
+	auth.OTPSignup:             true,
+	auth.CanaryAlert:           true,
+	auth.LoginDigest:           true,
+	auth.OrganizationInvite:    true,
+	auth.LoginApproval:         true,
+	auth.AccountRecovery:       true,
+	auth.TrustedContactShare:   true,
+	auth.SecurityChange:        true,
+	auth.TFAEnrollmentReminder: true,
+	auth.OTPUnlock:             true,
+	auth.PasswordReset:         true,
+	auth.BreachAlert:           true,
+}
+
+// smsLocale returns the locale a message is rendered in, the client's
+// most preferred language with a template for the message. It is empty
+// if the default template is used.
+func (s *service) smsLocale(ctx context.Context, t auth.MessageType) string {
+	return locale.Match(locale.FromContext(ctx), func(l string) bool {
+		return l != DefaultLocale && s.localized[l][t] != ""
+	})
+}
+
+// vars returns the variables of a message, including the placeholders
+// available to every template. Variables set by the caller take precedence.
+func (s *service) vars(ctx context.Context, msg *auth.Message) map[string]string {
+	vars := map[string]string{
+		"app_name": s.appName,
+		"expiry":   strconv.Itoa(int(s.codeExpiry / time.Minute)),
+	}
+	if app := clientapp.FromContext(ctx); app != nil && app.Name != "" {
+		vars["app_name"] = app.Name
+	}
+	for k, v := range msg.Vars {
+		vars[k] = v
+	}
+	return vars
+}
@@ -0,0 +1,151 @@
+package msgpublisher
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clientapp"
+	"github.com/fmitra/authenticator/internal/locale"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestMsgPublisher_ReadSMSTemplates(t *testing.T) {
+	tt := []struct {
+		name      string
+		templates string
+		hasError  bool
+		locales   []string
+	}{
+		{
+			name: "Reads templates",
+			templates: `{
+				"default": {"otp_login": "{{app_name}}: {{code}}"},
+				"pt-br": {"otp_login": "{{app_name}}: seu código é {{code}}"}
+			}`,
+			locales: []string{"default", "pt-BR"},
+		},
+		{
+			name:      "Rejects invalid locale",
+			templates: `{"not a locale": {"otp_login": "{{code}}"}}`,
+			hasError:  true,
+		},
+		{
+			name:      "Rejects unknown message type",
+			templates: `{"es": {"otp_logout": "{{code}}"}}`,
+			hasError:  true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			templates, err := ReadSMSTemplates(strings.NewReader(tc.templates))
+			if tc.hasError {
+				if err == nil {
+					t.Error("expected error, received nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+			for _, l := range tc.locales {
+				if _, ok := templates[l]; !ok {
+					t.Errorf("locale %s not found in %v", l, templates)
+				}
+			}
+		})
+	}
+}
+
+func TestMsgPublisher_RendersSMSTemplate(t *testing.T) {
+	templates, err := ReadSMSTemplates(strings.NewReader(`{
+		"default": {"otp_login": "{{app_name}}: your code is {{code}}, valid for {{expiry}} minutes"},
+		"pt": {"otp_login": "{{app_name}}: seu código é {{code}}"},
+		"es-MX": {"otp_signup": "{{app_name}}: tu código es {{code}}"}
+	}`))
+	if err != nil {
+		t.Fatal("failed to read templates:", err)
+	}
+
+	tt := []struct {
+		name        string
+		msgType     auth.MessageType
+		preferences []string
+		app         *auth.ClientApplication
+		content     string
+		locale      string
+	}{
+		{
+			name:    "Default template",
+			msgType: auth.OTPLogin,
+			content: "Example: your code is 111, valid for 10 minutes",
+		},
+		{
+			name:        "Localized template",
+			msgType:     auth.OTPLogin,
+			preferences: []string{"fr", "pt-BR"},
+			content:     "Example: seu código é 111",
+			locale:      "pt",
+		},
+		{
+			name:        "Default template without localization for type",
+			msgType:     auth.OTPLogin,
+			preferences: []string{"es-MX"},
+			content:     "Example: your code is 111, valid for 10 minutes",
+		},
+		{
+			name:        "Built-in template without override",
+			msgType:     auth.OTPResend,
+			preferences: []string{"pt"},
+			content:     "Youre new code is 111",
+		},
+		{
+			name:    "Client application name",
+			msgType: auth.OTPLogin,
+			app:     &auth.ClientApplication{ID: "client-id", Name: "Partner"},
+			content: "Partner: your code is 111, valid for 10 minutes",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var published *auth.Message
+			repo := test.MessageRepository{
+				PublishFn: func(ctx context.Context, msg *auth.Message) error {
+					published = msg
+					return nil
+				},
+			}
+			svc := NewService(
+				&repo,
+				WithSMSTemplates(templates),
+				WithAppName("Example"),
+				WithCodeExpiry(time.Minute*10),
+			)
+
+			ctx := locale.NewContext(context.Background(), tc.preferences)
+			if tc.app != nil {
+				ctx = clientapp.NewContext(ctx, tc.app)
+			}
+			err := svc.Send(ctx, &auth.Message{
+				Type:     tc.msgType,
+				Delivery: auth.Phone,
+				Address:  "+639455189172",
+				Vars:     map[string]string{"code": "111"},
+			})
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+
+			if published.Content != tc.content {
+				t.Errorf("incorrect content, want '%s' got '%s'", tc.content, published.Content)
+			}
+			if published.Locale != tc.locale {
+				t.Errorf("incorrect locale, want '%s' got '%s'", tc.locale, published.Locale)
+			}
+		})
+	}
+}
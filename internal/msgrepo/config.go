@@ -1,16 +1,26 @@
 package msgrepo
 
 import (
+	"crypto/sha256"
+	"time"
+
 	"github.com/go-kit/kit/log"
 
 	auth "github.com/fmitra/authenticator"
 )
 
+// defaultPollInterval is the interval messages stored in Redis
+// are checked for delivery.
+const defaultPollInterval = time.Second
+
 // NewService returns a new MessageRepository
 func NewService(options ...ConfigOption) auth.MessageRepository {
 	s := service{
 		logger:       log.NewNopLogger(),
+		pollInterval: defaultPollInterval,
 		messageQueue: make(chan *auth.Message),
+		done:         make(chan struct{}),
+		published:    make(map[[sha256.Size]byte]time.Time),
 	}
 
 	for _, opt := range options {
@@ -29,3 +39,29 @@ func WithLogger(l log.Logger) ConfigOption {
 		s.logger = l
 	}
 }
+
+// WithDedupWindow configures the time an identical message to the
+// same address is dropped for after it is published. Messages are
+// not deduplicated if it is 0.
+func WithDedupWindow(d time.Duration) ConfigOption {
+	return func(s *service) {
+		s.dedupWindow = d
+	}
+}
+
+// WithDB configures the service with Redis to store messages until
+// they are due. Messages are otherwise held in memory and are lost
+// if the service restarts.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithPollInterval configures the interval messages stored in
+// Redis are checked for delivery.
+func WithPollInterval(d time.Duration) ConfigOption {
+	return func(s *service) {
+		s.pollInterval = d
+	}
+}
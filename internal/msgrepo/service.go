@@ -3,59 +3,331 @@ package msgrepo
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math/rand"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-redis/redis/v8"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
 )
 
+// scheduledKey is the sorted set of messages waiting to be delivered,
+// scored by the Unix time in milliseconds they are due.
+const scheduledKey = "msgrepo:scheduled"
+
+// pollBatch is the maximum number of due messages read per poll.
+const pollBatch = 100
+
+// dedupKeyPrefix prefixes the keys marking messages published within
+// the deduplication window.
+const dedupKeyPrefix = "msgrepo:dedup:"
+
+type rediser interface {
+	ZAdd(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd
+	ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd
+	ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+}
+
+// scheduledMessage is a Message stored until it is due. The ID keeps
+// identical messages from overwriting each other in the sorted set.
+type scheduledMessage struct {
+	ID      string        `json:"id"`
+	Message *auth.Message `json:"message"`
+}
+
 // service is an implementation of auth.MessageRepository
 type service struct {
 	logger       log.Logger
+	db           rediser
+	pollInterval time.Duration
 	messageQueue chan *auth.Message
+	// dedupWindow is the time an identical message to the same
+	// address is dropped for after it is published.
+	dedupWindow time.Duration
+
+	mu sync.Mutex
+	// published are the times recently published messages may no
+	// longer be duplicated by their key, if Redis is not configured.
+	published map[[sha256.Size]byte]time.Time
+	// closed is set once the messageQueue is closing. done is closed
+	// alongside it to release goroutines waiting to write to the
+	// queue, which are tracked by senders.
+	closed  bool
+	done    chan struct{}
+	senders sync.WaitGroup
 }
 
-// Publish writes an unsent message to a channel.
+// Publish writes an unsent message to a channel once it is due. Messages
+// which are not yet due, such as scheduled messages and retries, are
+// stored in Redis if it is configured so they survive a restart.
 func (s *service) Publish(ctx context.Context, msg *auth.Message) error {
 	isExpired := time.Now().After(msg.ExpiresAt)
 	if isExpired {
 		return fmt.Errorf("cannot publish expired message")
 	}
 
+	if msg.DeliveryAttempts == 0 && s.isDuplicate(ctx, msg) {
+		level.Info(s.logger).Log(
+			"source", "msgrepo.Publish",
+			"message", "dropping duplicate message",
+			"address", msg.Address,
+			"type", msg.Type,
+		)
+		return nil
+	}
+
+	msg.DeliveryAttempts++
+
+	dueAt := msg.NotBefore
+	if msg.DeliveryAttempts > 1 {
+		dueAt = time.Now().Add(delay(msg.DeliveryAttempts))
+	}
+
+	if s.db != nil && time.Now().Before(dueAt) {
+		return s.schedule(ctx, msg, dueAt)
+	}
+
+	return s.enqueue(msg, dueAt)
+}
+
+// schedule stores a message in Redis until it is due.
+func (s *service) schedule(ctx context.Context, msg *auth.Message, dueAt time.Time) error {
+	id, err := crypto.String(16)
+	if err != nil {
+		return fmt.Errorf("cannot create message ID: %w", err)
+	}
+
+	b, err := json.Marshal(scheduledMessage{ID: id, Message: msg})
+	if err != nil {
+		return fmt.Errorf("cannot encode message: %w", err)
+	}
+
+	err = s.db.ZAdd(ctx, scheduledKey, &redis.Z{
+		Score:  float64(unixMilli(dueAt)),
+		Member: string(b),
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("cannot schedule message: %w", err)
+	}
+
+	return nil
+}
+
+// enqueue writes a message to the queue once it is due. Messages
+// waiting in memory are dropped when the queue closes.
+func (s *service) enqueue(msg *auth.Message, dueAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("cannot publish to closed queue")
+	}
+
+	s.senders.Add(1)
 	go func() {
-		msg.DeliveryAttempts++
+		defer s.senders.Done()
+
+		timer := time.NewTimer(time.Until(dueAt))
+		defer timer.Stop()
 
-		if msg.DeliveryAttempts == 1 {
-			s.messageQueue <- msg
+		select {
+		case <-timer.C:
+		case <-s.done:
 			return
 		}
 
-		waitTime := delay(msg.DeliveryAttempts)
-		time.Sleep(waitTime)
-
-		s.messageQueue <- msg
+		select {
+		case s.messageQueue <- msg:
+		case <-s.done:
+		}
 	}()
 
 	return nil
 }
 
-// Recent retrieves recently published unsent messages.
+// poll writes messages stored in Redis to the queue as they become
+// due until the context is cancelled.
+func (s *service) poll(ctx context.Context) {
+	defer s.senders.Done()
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.dispatchDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchDue writes due messages stored in Redis to the queue. A
+// message is claimed by removing it, so that only one instance
+// delivers it.
+func (s *service) dispatchDue(ctx context.Context) {
+	members, err := s.db.ZRangeByScore(ctx, scheduledKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(unixMilli(time.Now()), 10),
+		Count: pollBatch,
+	}).Result()
+	if err != nil {
+		level.Error(s.logger).Log(
+			"source", "msgrepo.dispatchDue",
+			"message", "cannot read scheduled messages",
+			"error", err,
+		)
+		return
+	}
+
+	for _, member := range members {
+		removed, err := s.db.ZRem(ctx, scheduledKey, member).Result()
+		if err != nil {
+			level.Error(s.logger).Log(
+				"source", "msgrepo.dispatchDue",
+				"message", "cannot claim scheduled message",
+				"error", err,
+			)
+			return
+		}
+		if removed == 0 {
+			continue
+		}
+
+		var scheduled scheduledMessage
+		if err = json.Unmarshal([]byte(member), &scheduled); err != nil || scheduled.Message == nil {
+			level.Error(s.logger).Log(
+				"source", "msgrepo.dispatchDue",
+				"message", "dropping malformed scheduled message",
+				"error", err,
+			)
+			continue
+		}
+
+		msg := scheduled.Message
+		if time.Now().After(msg.ExpiresAt) {
+			level.Info(s.logger).Log(
+				"source", "msgrepo.dispatchDue",
+				"message", "dropping expired scheduled message",
+				"address", msg.Address,
+				"type", msg.Type,
+			)
+			continue
+		}
+
+		select {
+		case s.messageQueue <- msg:
+		case <-ctx.Done():
+			// The context is cancelled, so the message is returned
+			// with a fresh one for another instance to deliver.
+			err = s.db.ZAdd(context.Background(), scheduledKey, &redis.Z{
+				Score:  float64(unixMilli(time.Now())),
+				Member: member,
+			}).Err()
+			if err != nil {
+				level.Error(s.logger).Log(
+					"source", "msgrepo.dispatchDue",
+					"message", "cannot return scheduled message",
+					"error", err,
+				)
+			}
+			return
+		}
+	}
+}
+
+// isDuplicate reports whether an identical message was published to
+// the same address within the deduplication window, such as an alert
+// triggered twice. Retries of a message are not checked. The window
+// is kept in Redis if it is configured so that it is shared between
+// instances. Messages are published if the window cannot be checked.
+func (s *service) isDuplicate(ctx context.Context, msg *auth.Message) bool {
+	if s.dedupWindow <= 0 {
+		return false
+	}
+
+	key := sha256.Sum256([]byte(fmt.Sprintf(
+		"%s\x00%s\x00%s\x00%s", msg.Delivery, msg.Address, msg.Subject, msg.Content,
+	)))
+
+	if s.db != nil {
+		isNew, err := s.db.SetNX(ctx, dedupKeyPrefix+hex.EncodeToString(key[:]), 1, s.dedupWindow).Result()
+		if err != nil {
+			level.Error(s.logger).Log(
+				"source", "msgrepo.isDuplicate",
+				"message", "cannot check duplicate message",
+				"error", err,
+			)
+			return false
+		}
+		return !isNew
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, expiresAt := range s.published {
+		if now.After(expiresAt) {
+			delete(s.published, k)
+		}
+	}
+
+	if _, ok := s.published[key]; ok {
+		return true
+	}
+
+	s.published[key] = now.Add(s.dedupWindow)
+	return false
+}
+
+// Recent retrieves recently published unsent messages. Messages
+// stored in Redis are polled until the context is cancelled, after
+// which the queue is closed.
 func (s *service) Recent(ctx context.Context) (<-chan *auth.Message, <-chan error) {
 	errc := make(chan error, 1)
 
+	if s.db != nil {
+		s.senders.Add(1)
+		go s.poll(ctx)
+	}
+
 	go func() {
 		defer close(errc)
-		defer close(s.messageQueue)
 		<-ctx.Done()
+
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+
+		close(s.done)
+		s.senders.Wait()
+		close(s.messageQueue)
+
 		errc <- ctx.Err()
 	}()
 
 	return s.messageQueue, errc
 }
 
+// unixMilli returns t as a Unix time in milliseconds.
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
 // delay calculates the amount of time to wait before
 // publishing a message back into the queue
 func delay(deliveryAttempts int) time.Duration {
@@ -8,6 +8,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/memstore"
 )
 
 func TestMsgRepo_Publish(t *testing.T) {
@@ -66,3 +67,221 @@ func TestMsgRepo_Recent(t *testing.T) {
 		}
 	}
 }
+
+func TestMsgRepo_RecentScheduled(t *testing.T) {
+	tt := []struct {
+		name    string
+		options []ConfigOption
+	}{
+		{
+			name: "Scheduled in memory",
+		},
+		{
+			name:    "Scheduled in Redis",
+			options: []ConfigOption{WithDB(memstore.New()), WithPollInterval(time.Millisecond * 10)},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			notBefore := time.Now().Add(time.Millisecond * 200)
+			msg := auth.Message{
+				NotBefore: notBefore,
+				ExpiresAt: time.Now().Add(time.Second * 5),
+			}
+			ctx := context.Background()
+			svc := NewService(tc.options...)
+			err := svc.Publish(ctx, &msg)
+			if err != nil {
+				t.Error("failed to publish message", err)
+			}
+
+			msgc, _ := svc.Recent(ctx)
+			select {
+			case <-msgc:
+				if time.Now().Before(notBefore) {
+					t.Error("scheduled message retrieved before it is due")
+				}
+			case <-time.After(time.Second):
+				t.Error("scheduled message not retrieved after it is due")
+			}
+		})
+	}
+}
+
+func TestMsgRepo_RecentScheduledAfterRestart(t *testing.T) {
+	db := memstore.New()
+	msg := auth.Message{
+		Address:   "jane@example.com",
+		NotBefore: time.Now().Add(time.Millisecond * 100),
+		ExpiresAt: time.Now().Add(time.Second * 5),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	svc := NewService(WithDB(db), WithPollInterval(time.Millisecond*10))
+	if err := svc.Publish(ctx, &msg); err != nil {
+		t.Fatal("failed to publish message", err)
+	}
+	msgc, _ := svc.Recent(ctx)
+	cancel()
+	for range msgc {
+		t.Fatal("scheduled message retrieved before it is due")
+	}
+
+	svc = NewService(WithDB(db), WithPollInterval(time.Millisecond*10))
+	msgc, _ = svc.Recent(context.Background())
+	select {
+	case m := <-msgc:
+		if m.Address != msg.Address {
+			t.Errorf("incorrect message address, want %s got %s", msg.Address, m.Address)
+		}
+	case <-time.After(time.Second):
+		t.Error("scheduled message not retrieved after restart")
+	}
+}
+
+func TestMsgRepo_PublishAfterClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	svc := NewService()
+
+	retry := auth.Message{
+		ExpiresAt:        time.Now().Add(time.Second * 5),
+		DeliveryAttempts: 1,
+	}
+	if err := svc.Publish(ctx, &retry); err != nil {
+		t.Fatal("failed to publish message", err)
+	}
+
+	msgc, errc := svc.Recent(ctx)
+	cancel()
+	for range msgc {
+		t.Error("retried message retrieved before it is due")
+	}
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("incorrect error, want %v got %v", context.Canceled, err)
+	}
+
+	msg := auth.Message{ExpiresAt: time.Now().Add(time.Second * 5)}
+	if err := svc.Publish(context.Background(), &msg); err == nil {
+		t.Error("expected error publishing to closed queue")
+	}
+}
+
+func TestMsgRepo_DropsDuplicates(t *testing.T) {
+	tt := []struct {
+		name        string
+		dedupWindow time.Duration
+		msgs        []auth.Message
+		received    int
+	}{
+		{
+			name:        "Drops identical message",
+			dedupWindow: time.Minute,
+			msgs: []auth.Message{
+				{Delivery: auth.Phone, Address: "+6594867353", Content: "Your login code is 111"},
+				{Delivery: auth.Phone, Address: "+6594867353", Content: "Your login code is 111"},
+			},
+			received: 1,
+		},
+		{
+			name:        "Publishes messages with different content",
+			dedupWindow: time.Minute,
+			msgs: []auth.Message{
+				{Delivery: auth.Phone, Address: "+6594867353", Content: "Your login code is 111"},
+				{Delivery: auth.Phone, Address: "+6594867353", Content: "Your login code is 222"},
+			},
+			received: 2,
+		},
+		{
+			name:        "Publishes messages to different addresses",
+			dedupWindow: time.Minute,
+			msgs: []auth.Message{
+				{Delivery: auth.Phone, Address: "+6594867353", Content: "Your login code is 111"},
+				{Delivery: auth.Phone, Address: "+6594867354", Content: "Your login code is 111"},
+			},
+			received: 2,
+		},
+		{
+			name:        "Publishes identical message without window",
+			dedupWindow: 0,
+			msgs: []auth.Message{
+				{Delivery: auth.Phone, Address: "+6594867353", Content: "Your login code is 111"},
+				{Delivery: auth.Phone, Address: "+6594867353", Content: "Your login code is 111"},
+			},
+			received: 2,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			svc := NewService(WithDedupWindow(tc.dedupWindow))
+			for i := range tc.msgs {
+				tc.msgs[i].ExpiresAt = time.Now().Add(time.Second * 5)
+				if err := svc.Publish(ctx, &tc.msgs[i]); err != nil {
+					t.Fatal("failed to publish message", err)
+				}
+			}
+
+			msgc, _ := svc.Recent(ctx)
+			received := 0
+			for {
+				select {
+				case <-msgc:
+					received++
+					continue
+				case <-time.After(time.Millisecond * 100):
+				}
+				break
+			}
+
+			if received != tc.received {
+				t.Errorf("incorrect messages received, want %v got %v", tc.received, received)
+			}
+		})
+	}
+}
+
+func TestMsgRepo_DropsDuplicatesAcrossInstances(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db := memstore.New()
+	first := NewService(WithDB(db), WithDedupWindow(time.Minute))
+	second := NewService(WithDB(db), WithDedupWindow(time.Minute))
+
+	msg := auth.Message{
+		Delivery:  auth.Email,
+		Address:   "jane@example.com",
+		Content:   "A new device signed in to your account",
+		ExpiresAt: time.Now().Add(time.Second * 5),
+	}
+	duplicate := msg
+
+	if err := first.Publish(ctx, &msg); err != nil {
+		t.Fatal("failed to publish message", err)
+	}
+	if err := second.Publish(ctx, &duplicate); err != nil {
+		t.Fatal("failed to publish message", err)
+	}
+
+	firstc, _ := first.Recent(ctx)
+	secondc, _ := second.Recent(ctx)
+	received := 0
+	for {
+		select {
+		case <-firstc:
+			received++
+			continue
+		case <-secondc:
+			received++
+			continue
+		case <-time.After(time.Millisecond * 100):
+		}
+		break
+	}
+
+	if received != 1 {
+		t.Errorf("incorrect messages received, want 1 got %v", received)
+	}
+}
@@ -0,0 +1,26 @@
+// Package msgsender carries the sender of a message to the providers
+// delivering it. Providers fall back to their configured defaults for
+// any field which is not set.
+package msgsender
+
+import (
+	"context"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+type contextKey string
+
+const senderContextKey contextKey = "sender"
+
+// NewContext returns a context carrying a MessageSender.
+func NewContext(ctx context.Context, sender auth.MessageSender) context.Context {
+	return context.WithValue(ctx, senderContextKey, sender)
+}
+
+// FromContext returns the MessageSender in context. It is empty
+// if providers should use their defaults.
+func FromContext(ctx context.Context) auth.MessageSender {
+	sender, _ := ctx.Value(senderContextKey).(auth.MessageSender)
+	return sender
+}
@@ -0,0 +1,20 @@
+package msgsender
+
+import (
+	"context"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+func TestMsgSender_Context(t *testing.T) {
+	ctx := context.Background()
+	if sender := FromContext(ctx); sender != (auth.MessageSender{}) {
+		t.Errorf("expected empty sender, got %+v", sender)
+	}
+
+	sender := auth.MessageSender{FromAddr: "security@example.com", SMSSender: "Example"}
+	if got := FromContext(NewContext(ctx, sender)); got != sender {
+		t.Errorf("incorrect sender, want %+v got %+v", sender, got)
+	}
+}
@@ -0,0 +1,75 @@
+package orgapi
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/featureflag"
+)
+
+// defaultInviteExpiry is the default time an Invitation may be accepted.
+const defaultInviteExpiry = time.Hour * 24 * 7
+
+// NewService returns a new implementation of auth.OrganizationAPI.
+func NewService(options ...ConfigOption) auth.OrganizationAPI {
+	s := service{
+		logger:       log.NewNopLogger(),
+		inviteExpiry: defaultInviteExpiry,
+		features:     featureflag.NewService(),
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithRepoManager configures the service with a new RepositoryManager.
+func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
+	return func(s *service) {
+		s.repoMngr = repoMngr
+	}
+}
+
+// WithMessaging configures the service with a MessagingService
+// to deliver invitations.
+func WithMessaging(m auth.MessagingService) ConfigOption {
+	return func(s *service) {
+		s.message = m
+	}
+}
+
+// WithActionTokens configures the service with an ActionTokenService
+// to issue invitation tokens.
+func WithActionTokens(t auth.ActionTokenService) ConfigOption {
+	return func(s *service) {
+		s.actionTokens = t
+	}
+}
+
+// WithInviteExpiry configures how long an Invitation may be accepted.
+func WithInviteExpiry(d time.Duration) ConfigOption {
+	return func(s *service) {
+		s.inviteExpiry = d
+	}
+}
+
+// WithFeatureFlags configures the service with a FeatureFlagService.
+func WithFeatureFlags(f auth.FeatureFlagService) ConfigOption {
+	return func(s *service) {
+		s.features = f
+	}
+}
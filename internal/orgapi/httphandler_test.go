@@ -0,0 +1,522 @@
+package orgapi
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestOrganizationAPI_Invite(t *testing.T) {
+	tt := []struct {
+		name                  string
+		statusCode            int
+		authHeader            bool
+		reqBody               []byte
+		errMessage            string
+		isDisabled            bool
+		getFn                 func() (*auth.Membership, error)
+		createInvitationCalls int
+		sendCalls             int
+	}{
+		{
+			name:       "Authentication error with no token",
+			statusCode: http.StatusUnauthorized,
+			authHeader: false,
+			reqBody:    []byte(`{"email":"jane@example.com"}`),
+			errMessage: "User is not authenticated",
+		},
+		{
+			name:       "Organizations feature disabled",
+			statusCode: http.StatusForbidden,
+			authHeader: true,
+			reqBody:    []byte(`{"email":"jane@example.com"}`),
+			errMessage: "Organizations are disabled",
+			isDisabled: true,
+		},
+		{
+			name:       "Invalid email",
+			statusCode: http.StatusBadRequest,
+			authHeader: true,
+			reqBody:    []byte(`{"email":"jane"}`),
+			errMessage: "Email address is invalid",
+		},
+		{
+			name:       "Invalid role",
+			statusCode: http.StatusBadRequest,
+			authHeader: true,
+			reqBody:    []byte(`{"email":"jane@example.com","role":"superuser"}`),
+			errMessage: "Role must be owner, admin or member",
+		},
+		{
+			name:       "Non member",
+			statusCode: http.StatusBadRequest,
+			authHeader: true,
+			reqBody:    []byte(`{"email":"jane@example.com"}`),
+			errMessage: "Membership does not exist",
+			getFn: func() (*auth.Membership, error) {
+				return nil, sql.ErrNoRows
+			},
+		},
+		{
+			name:       "Member without permission",
+			statusCode: http.StatusForbidden,
+			authHeader: true,
+			reqBody:    []byte(`{"email":"jane@example.com"}`),
+			errMessage: "Only owners and admins may invite members",
+			getFn: func() (*auth.Membership, error) {
+				return &auth.Membership{Role: auth.RoleMember}, nil
+			},
+		},
+		{
+			name:       "Admin cannot invite owner",
+			statusCode: http.StatusForbidden,
+			authHeader: true,
+			reqBody:    []byte(`{"email":"jane@example.com","role":"owner"}`),
+			errMessage: "Only owners may invite owners",
+			getFn: func() (*auth.Membership, error) {
+				return &auth.Membership{Role: auth.RoleAdmin}, nil
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusCreated,
+			authHeader: true,
+			reqBody:    []byte(`{"email":"jane@example.com","role":"admin"}`),
+			getFn: func() (*auth.Membership, error) {
+				return &auth.Membership{Role: auth.RoleAdmin}, nil
+			},
+			createInvitationCalls: 1,
+			sendCalls:             1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			membershipRepo := &test.MembershipRepository{GetFn: tc.getFn}
+			repoMngr := &test.RepositoryManager{
+				MembershipFn: func() auth.MembershipRepository {
+					return membershipRepo
+				},
+			}
+			messagingSvc := &test.MessagingService{}
+			tokenSvc := &test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+				},
+			}
+			actionTokenSvc := &test.ActionTokenService{
+				IssueFn: func() (string, error) {
+					return "invite-token", nil
+				},
+			}
+			features := &test.FeatureFlagService{
+				EnabledFn: func(f auth.Feature) bool {
+					return !tc.isDisabled
+				},
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+				WithMessaging(messagingSvc),
+				WithActionTokens(actionTokenSvc),
+				WithFeatureFlags(features),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/org/org-id/invitation", bytes.NewBuffer(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			if tc.authHeader {
+				test.SetAuthHeaders(req)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if membershipRepo.Calls.CreateInvitation != tc.createInvitationCalls {
+				t.Errorf("incorrect MembershipRepository.CreateInvitation() call count, want %v got %v",
+					tc.createInvitationCalls, membershipRepo.Calls.CreateInvitation)
+			}
+
+			if messagingSvc.Calls.Send != tc.sendCalls {
+				t.Errorf("incorrect MessagingService.Send() call count, want %v got %v",
+					tc.sendCalls, messagingSvc.Calls.Send)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestOrganizationAPI_Accept(t *testing.T) {
+	codeHash, err := crypto.Hash("ABCDEFGH")
+	if err != nil {
+		t.Fatal("failed to hash code:", err)
+	}
+
+	tt := []struct {
+		name            string
+		statusCode      int
+		reqBody         []byte
+		errMessage      string
+		invitationFn    func() (*auth.Invitation, error)
+		userFn          func() (*auth.User, error)
+		getFn           func() (*auth.Membership, error)
+		parseFn         func() (*auth.ActionToken, error)
+		redeemCalls     int
+		withAtomicCalls int
+	}{
+		{
+			name:       "Missing code",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"invitationID":"invitation-id"}`),
+			errMessage: "InvitationID and code are required",
+		},
+		{
+			name:       "Invitation not found",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"invitationID":"invitation-id","code":"ABCDEFGH"}`),
+			errMessage: "Invitation is invalid",
+			invitationFn: func() (*auth.Invitation, error) {
+				return nil, sql.ErrNoRows
+			},
+		},
+		{
+			name:       "Incorrect code",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"invitationID":"invitation-id","code":"ZZZZZZZZ"}`),
+			errMessage: "Invitation is invalid",
+			invitationFn: func() (*auth.Invitation, error) {
+				return &auth.Invitation{
+					CodeHash:  codeHash,
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil
+			},
+		},
+		{
+			name:       "Expired invitation",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"invitationID":"invitation-id","code":"abcdefgh"}`),
+			errMessage: "Invitation is expired",
+			invitationFn: func() (*auth.Invitation, error) {
+				return &auth.Invitation{
+					CodeHash:  codeHash,
+					ExpiresAt: time.Now().Add(-time.Hour),
+				}, nil
+			},
+		},
+		{
+			name:       "Email mismatch",
+			statusCode: http.StatusForbidden,
+			reqBody:    []byte(`{"invitationID":"invitation-id","code":"ABCDEFGH"}`),
+			errMessage: "Invitation was sent to another email address",
+			invitationFn: func() (*auth.Invitation, error) {
+				return &auth.Invitation{
+					Email:     "jane@example.com",
+					CodeHash:  codeHash,
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil
+			},
+			userFn: func() (*auth.User, error) {
+				return &auth.User{Email: sql.NullString{String: "john@example.com", Valid: true}}, nil
+			},
+		},
+		{
+			name:       "Already a member",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"invitationID":"invitation-id","code":"ABCDEFGH"}`),
+			errMessage: "User is already a member",
+			invitationFn: func() (*auth.Invitation, error) {
+				return &auth.Invitation{
+					Email:     "jane@example.com",
+					CodeHash:  codeHash,
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil
+			},
+			userFn: func() (*auth.User, error) {
+				return &auth.User{Email: sql.NullString{String: "Jane@example.com", Valid: true}}, nil
+			},
+		},
+		{
+			name:       "Membership created",
+			statusCode: http.StatusOK,
+			reqBody:    []byte(`{"invitationID":"invitation-id","code":"ABCDEFGH"}`),
+			invitationFn: func() (*auth.Invitation, error) {
+				return &auth.Invitation{
+					Email:     "jane@example.com",
+					CodeHash:  codeHash,
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil
+			},
+			userFn: func() (*auth.User, error) {
+				return &auth.User{Email: sql.NullString{String: "jane@example.com", Valid: true}}, nil
+			},
+			getFn: func() (*auth.Membership, error) {
+				return nil, sql.ErrNoRows
+			},
+			withAtomicCalls: 1,
+		},
+		{
+			name:       "Invalid invitation token",
+			statusCode: http.StatusUnauthorized,
+			reqBody:    []byte(`{"token":"invite-token"}`),
+			errMessage: "Token is already used",
+			parseFn: func() (*auth.ActionToken, error) {
+				return nil, auth.ErrInvalidToken("token is already used")
+			},
+		},
+		{
+			name:       "Membership created with invitation token",
+			statusCode: http.StatusOK,
+			reqBody:    []byte(`{"token":"invite-token"}`),
+			parseFn: func() (*auth.ActionToken, error) {
+				return &auth.ActionToken{
+					Purpose: auth.PurposeAcceptInvite,
+					Data:    map[string]string{"invitation_id": "invitation-id"},
+				}, nil
+			},
+			invitationFn: func() (*auth.Invitation, error) {
+				return &auth.Invitation{
+					Email:     "jane@example.com",
+					CodeHash:  codeHash,
+					ExpiresAt: time.Now().Add(time.Hour),
+				}, nil
+			},
+			userFn: func() (*auth.User, error) {
+				return &auth.User{Email: sql.NullString{String: "jane@example.com", Valid: true}}, nil
+			},
+			getFn: func() (*auth.Membership, error) {
+				return nil, sql.ErrNoRows
+			},
+			redeemCalls:     1,
+			withAtomicCalls: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			membershipRepo := &test.MembershipRepository{
+				GetFn:            tc.getFn,
+				InvitationByIDFn: tc.invitationFn,
+			}
+			repoMngr := &test.RepositoryManager{
+				MembershipFn: func() auth.MembershipRepository {
+					return membershipRepo
+				},
+				UserFn: func() auth.UserRepository {
+					return &test.UserRepository{ByIdentityFn: tc.userFn}
+				},
+				WithAtomicFn: func() (interface{}, error) {
+					return &auth.Membership{OrganizationID: "org-id", UserID: "user-id"}, nil
+				},
+			}
+			tokenSvc := &test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+				},
+			}
+			actionTokenSvc := &test.ActionTokenService{
+				ParseFn:  tc.parseFn,
+				RedeemFn: func() error { return nil },
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+				WithMessaging(&test.MessagingService{}),
+				WithActionTokens(actionTokenSvc),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/org/invitation/accept", bytes.NewBuffer(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			test.SetAuthHeaders(req)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if repoMngr.Calls.WithAtomic != tc.withAtomicCalls {
+				t.Errorf("incorrect RepositoryManager.WithAtomic() call count, want %v got %v",
+					tc.withAtomicCalls, repoMngr.Calls.WithAtomic)
+			}
+
+			if actionTokenSvc.Calls.Redeem != tc.redeemCalls {
+				t.Errorf("incorrect ActionTokenService.Redeem() call count, want %v got %v",
+					tc.redeemCalls, actionTokenSvc.Calls.Redeem)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestOrganizationAPI_RemoveMember(t *testing.T) {
+	tt := []struct {
+		name        string
+		statusCode  int
+		path        string
+		errMessage  string
+		roles       map[string]auth.MemberRole
+		members     []*auth.Membership
+		removeCalls int
+	}{
+		{
+			name:       "Member cannot remove others",
+			statusCode: http.StatusForbidden,
+			path:       "/api/v1/org/org-id/member/other-id",
+			errMessage: "Only owners and admins may remove members",
+			roles: map[string]auth.MemberRole{
+				"user-id":  auth.RoleMember,
+				"other-id": auth.RoleMember,
+			},
+		},
+		{
+			name:       "Admin cannot remove owner",
+			statusCode: http.StatusForbidden,
+			path:       "/api/v1/org/org-id/member/other-id",
+			errMessage: "Only owners may remove owners",
+			roles: map[string]auth.MemberRole{
+				"user-id":  auth.RoleAdmin,
+				"other-id": auth.RoleOwner,
+			},
+		},
+		{
+			name:       "Last owner cannot leave",
+			statusCode: http.StatusBadRequest,
+			path:       "/api/v1/org/org-id/member/user-id",
+			errMessage: "Organization must have an owner",
+			roles: map[string]auth.MemberRole{
+				"user-id": auth.RoleOwner,
+			},
+			members: []*auth.Membership{
+				{UserID: "user-id", Role: auth.RoleOwner},
+				{UserID: "other-id", Role: auth.RoleMember},
+			},
+		},
+		{
+			name:       "Member leaves",
+			statusCode: http.StatusOK,
+			path:       "/api/v1/org/org-id/member/user-id",
+			roles: map[string]auth.MemberRole{
+				"user-id": auth.RoleMember,
+			},
+			removeCalls: 1,
+		},
+		{
+			name:       "Admin removes member",
+			statusCode: http.StatusOK,
+			path:       "/api/v1/org/org-id/member/other-id",
+			roles: map[string]auth.MemberRole{
+				"user-id":  auth.RoleAdmin,
+				"other-id": auth.RoleMember,
+			},
+			removeCalls: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			// Memberships are looked up for the requesting user first,
+			// followed by the member being removed.
+			lookups := []string{
+				"user-id",
+				strings.TrimPrefix(tc.path, "/api/v1/org/org-id/member/"),
+			}
+			var getCalls int
+			membershipRepo := &test.MembershipRepository{
+				GetFn: func() (*auth.Membership, error) {
+					userID := lookups[getCalls]
+					getCalls++
+					role, ok := tc.roles[userID]
+					if !ok {
+						return nil, sql.ErrNoRows
+					}
+					return &auth.Membership{UserID: userID, Role: role}, nil
+				},
+				ByOrganizationIDFn: func() ([]*auth.Membership, error) {
+					return tc.members, nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				MembershipFn: func() auth.MembershipRepository {
+					return membershipRepo
+				},
+			}
+			tokenSvc := &test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+				},
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+			)
+
+			req, err := http.NewRequest("DELETE", tc.path, nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			test.SetAuthHeaders(req)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if membershipRepo.Calls.Remove != tc.removeCalls {
+				t.Errorf("incorrect MembershipRepository.Remove() call count, want %v got %v",
+					tc.removeCalls, membershipRepo.Calls.Remove)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package orgapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+type createRequest struct {
+	Name string `json:"name"`
+}
+
+type inviteRequest struct {
+	Email string          `json:"email"`
+	Role  auth.MemberRole `json:"role"`
+}
+
+type acceptRequest struct {
+	InvitationID string `json:"invitationID"`
+	Code         string `json:"code"`
+	Token        string `json:"token"`
+}
+
+func decodeCreateRequest(r *http.Request) (*createRequest, error) {
+	var req createRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, auth.ErrInvalidField("name cannot be blank")
+	}
+	if len(req.Name) > 255 {
+		return nil, auth.ErrInvalidField("name cannot exceed 255 characters")
+	}
+
+	return &req, nil
+}
+
+func decodeInviteRequest(r *http.Request) (*inviteRequest, error) {
+	var req inviteRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if !contactchecker.IsEmailValid(req.Email) {
+		return nil, auth.ErrInvalidField("email address is invalid")
+	}
+
+	if req.Role == "" {
+		req.Role = auth.RoleMember
+	}
+	switch req.Role {
+	case auth.RoleOwner, auth.RoleAdmin, auth.RoleMember:
+	default:
+		return nil, auth.ErrInvalidField("role must be owner, admin or member")
+	}
+
+	return &req, nil
+}
+
+func decodeAcceptRequest(r *http.Request) (*acceptRequest, error) {
+	var req acceptRequest
+	if err := decodeJSON(r, &req); err != nil {
+		return nil, err
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token != "" {
+		return &req, nil
+	}
+
+	req.Code = strings.ToUpper(strings.TrimSpace(req.Code))
+	if req.InvitationID == "" || req.Code == "" {
+		return nil, auth.ErrBadRequest("invitationID and code are required")
+	}
+
+	return &req, nil
+}
+
+func decodeJSON(r *http.Request, v interface{}) error {
+	if r == nil || r.Body == nil {
+		return auth.ErrBadRequest("no request body received")
+	}
+
+	if err := httpapi.DecodeJSON(r, v); err != nil {
+		return fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package orgapi
+
+import (
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// Response is a success response.
+type Response struct {
+	Result string `json:"result"`
+}
+
+// organizationItem is the response format for authenticator.Organization.
+type organizationItem struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Role      auth.MemberRole `json:"role"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// memberItem is the response format for authenticator.Membership.
+type memberItem struct {
+	OrganizationID string          `json:"organizationID"`
+	UserID         string          `json:"userID"`
+	Role           auth.MemberRole `json:"role"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+// organizationResponse is a success response for a single Organization.
+type organizationResponse struct {
+	Organization organizationItem `json:"organization"`
+}
+
+// listResponse is a success response for OrganizationAPI.List.
+type listResponse struct {
+	Organizations []organizationItem `json:"organizations"`
+}
+
+// memberResponse is a success response for a single Membership.
+type memberResponse struct {
+	Member memberItem `json:"member"`
+}
+
+// membersResponse is a success response for OrganizationAPI.Members.
+type membersResponse struct {
+	Members []memberItem `json:"members"`
+}
+
+// invitationResponse is a success response for OrganizationAPI.Invite.
+type invitationResponse struct {
+	Invitation struct {
+		ID        string          `json:"id"`
+		Email     string          `json:"email"`
+		Role      auth.MemberRole `json:"role"`
+		ExpiresAt time.Time       `json:"expiresAt"`
+	} `json:"invitation"`
+}
+
+func newOrganizationItem(org *auth.Organization, role auth.MemberRole) organizationItem {
+	return organizationItem{
+		ID:        org.ID,
+		Name:      org.Name,
+		Role:      role,
+		CreatedAt: org.CreatedAt,
+	}
+}
+
+func newMemberItem(m *auth.Membership) memberItem {
+	return memberItem{
+		OrganizationID: m.OrganizationID,
+		UserID:         m.UserID,
+		Role:           m.Role,
+		CreatedAt:      m.CreatedAt,
+	}
+}
+
+// Create populates an organizationResponse with an Organization.
+func (r *organizationResponse) Create(org *auth.Organization, role auth.MemberRole) {
+	r.Organization = newOrganizationItem(org, role)
+}
+
+// Add adds an Organization to a listResponse.
+func (r *listResponse) Add(org *auth.Organization, role auth.MemberRole) {
+	r.Organizations = append(r.Organizations, newOrganizationItem(org, role))
+}
+
+// Create populates a memberResponse with a Membership.
+func (r *memberResponse) Create(m *auth.Membership) {
+	r.Member = newMemberItem(m)
+}
+
+// Create populates a membersResponse with a list of Memberships.
+func (r *membersResponse) Create(memberships []*auth.Membership) {
+	items := []memberItem{}
+	for _, m := range memberships {
+		items = append(items, newMemberItem(m))
+	}
+	r.Members = items
+}
+
+// Create populates an invitationResponse with an Invitation.
+// Invitation codes are only delivered to the invited address.
+func (r *invitationResponse) Create(inv *auth.Invitation) {
+	r.Invitation.ID = inv.ID
+	r.Invitation.Email = inv.Email
+	r.Invitation.Role = inv.Role
+	r.Invitation.ExpiresAt = inv.ExpiresAt
+}
@@ -0,0 +1,373 @@
+// Package orgapi provides an HTTP API to manage Organizations and their members.
+package orgapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+const (
+	// inviteCodeLen is the length of a generated invitation code.
+	inviteCodeLen = 20
+	// inviteCodeSample is the sample invitation codes are generated
+	// from. Ambiguous characters are excluded.
+	inviteCodeSample = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+type service struct {
+	logger       log.Logger
+	repoMngr     auth.RepositoryManager
+	message      auth.MessagingService
+	actionTokens auth.ActionTokenService
+	inviteExpiry time.Duration
+	features     auth.FeatureFlagService
+}
+
+// Create creates an Organization owned by the User.
+func (s *service) Create(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	if !s.features.Enabled(ctx, auth.FeatureOrganizations) {
+		return nil, auth.ErrForbidden("organizations are disabled")
+	}
+
+	req, err := decodeCreateRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entity, err := client.WithAtomic(func() (interface{}, error) {
+		org := &auth.Organization{Name: req.Name}
+		if err := client.Organization().Create(ctx, org); err != nil {
+			return nil, err
+		}
+
+		membership := &auth.Membership{
+			OrganizationID: org.ID,
+			UserID:         userID,
+			Role:           auth.RoleOwner,
+		}
+		if err := client.Membership().Create(ctx, membership); err != nil {
+			return nil, err
+		}
+
+		return org, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := organizationResponse{}
+	resp.Create(entity.(*auth.Organization), auth.RoleOwner)
+	return &resp, nil
+}
+
+// List returns all Organizations the User is a member of.
+func (s *service) List(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	memberships, err := s.repoMngr.Membership().ByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := listResponse{Organizations: []organizationItem{}}
+	for _, m := range memberships {
+		org, err := s.repoMngr.Organization().ByID(ctx, m.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+		resp.Add(org, m.Role)
+	}
+
+	return &resp, nil
+}
+
+// Members returns all members of an Organization. Only members
+// of the Organization may view its members.
+func (s *service) Members(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+	orgID := mux.Vars(r)["orgID"]
+
+	if _, err := s.membership(ctx, orgID, userID); err != nil {
+		return nil, err
+	}
+
+	memberships, err := s.repoMngr.Membership().ByOrganizationID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := membersResponse{}
+	resp.Create(memberships)
+	return &resp, nil
+}
+
+// Invite invites an email address to join an Organization. An
+// invitation code and a single use invitation token are delivered
+// to the address. Either must be provided by the recipient to accept
+// the Invitation.
+func (s *service) Invite(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+	orgID := mux.Vars(r)["orgID"]
+
+	if !s.features.Enabled(ctx, auth.FeatureOrganizations) {
+		return nil, auth.ErrForbidden("organizations are disabled")
+	}
+
+	req, err := decodeInviteRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	inviter, err := s.membership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !inviter.CanManageMembers() {
+		return nil, auth.ErrForbidden("only owners and admins may invite members")
+	}
+	if req.Role == auth.RoleOwner && inviter.Role != auth.RoleOwner {
+		return nil, auth.ErrForbidden("only owners may invite owners")
+	}
+
+	org, err := s.repoMngr.Organization().ByID(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := crypto.String(inviteCodeLen, inviteCodeSample)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate invitation code: %w", err)
+	}
+
+	codeHash, err := crypto.Hash(code)
+	if err != nil {
+		return nil, fmt.Errorf("cannot hash invitation code: %w", err)
+	}
+
+	inv := &auth.Invitation{
+		OrganizationID: orgID,
+		Email:          req.Email,
+		Role:           req.Role,
+		CodeHash:       codeHash,
+		InvitedBy:      userID,
+		ExpiresAt:      time.Now().Add(s.inviteExpiry),
+	}
+	if err = s.repoMngr.Membership().CreateInvitation(ctx, inv); err != nil {
+		return nil, err
+	}
+
+	inviteToken, err := s.actionTokens.Issue(ctx, "", auth.PurposeAcceptInvite, map[string]string{
+		"invitation_id": inv.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &auth.Message{
+		Type:     auth.OrganizationInvite,
+		Delivery: auth.Email,
+		Address:  inv.Email,
+		Vars: map[string]string{
+			"organization":  org.Name,
+			"invitation_id": inv.ID,
+			"code":          code,
+			"token":         inviteToken,
+		},
+	}
+	if err = s.message.Send(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	resp := invitationResponse{}
+	resp.Create(inv)
+	return &resp, nil
+}
+
+// Accept accepts an Invitation on behalf of the User. Invitations
+// may only be accepted by a User owning the invited email address.
+func (s *service) Accept(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	if !s.features.Enabled(ctx, auth.FeatureOrganizations) {
+		return nil, auth.ErrForbidden("organizations are disabled")
+	}
+
+	req, err := decodeAcceptRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var inviteToken *auth.ActionToken
+	if req.Token != "" {
+		inviteToken, err = s.actionTokens.Parse(ctx, req.Token, auth.PurposeAcceptInvite)
+		if err != nil {
+			return nil, err
+		}
+		req.InvitationID = inviteToken.Data["invitation_id"]
+	}
+
+	inv, err := s.repoMngr.Membership().InvitationByID(ctx, req.InvitationID)
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrBadRequest("invitation is invalid")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if inviteToken == nil {
+		codeHash, err := crypto.Hash(req.Code)
+		if err != nil {
+			return nil, fmt.Errorf("cannot hash invitation code: %w", err)
+		}
+		if subtle.ConstantTimeCompare([]byte(codeHash), []byte(inv.CodeHash)) != 1 {
+			return nil, auth.ErrBadRequest("invitation is invalid")
+		}
+	}
+	if time.Now().After(inv.ExpiresAt) {
+		return nil, auth.ErrBadRequest("invitation is expired")
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(user.Email.String, inv.Email) {
+		return nil, auth.ErrForbidden("invitation was sent to another email address")
+	}
+
+	_, err = s.repoMngr.Membership().Get(ctx, inv.OrganizationID, userID)
+	if err == nil {
+		return nil, auth.ErrBadRequest("user is already a member")
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if inviteToken != nil {
+		if err = s.actionTokens.Redeem(ctx, inviteToken); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := s.repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entity, err := client.WithAtomic(func() (interface{}, error) {
+		membership := &auth.Membership{
+			OrganizationID: inv.OrganizationID,
+			UserID:         userID,
+			Role:           inv.Role,
+		}
+		if err := client.Membership().Create(ctx, membership); err != nil {
+			return nil, err
+		}
+
+		if err := client.Membership().RemoveInvitation(ctx, inv.ID); err != nil {
+			return nil, err
+		}
+
+		return membership, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := memberResponse{}
+	resp.Create(entity.(*auth.Membership))
+	return &resp, nil
+}
+
+// RemoveMember removes a member from an Organization. Owners and
+// admins may remove other members and any member may leave. Owners
+// may only be removed by other owners.
+func (s *service) RemoveMember(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+	orgID := mux.Vars(r)["orgID"]
+	memberID := mux.Vars(r)["userID"]
+
+	remover, err := s.membership(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.membership(ctx, orgID, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	if memberID != userID {
+		if !remover.CanManageMembers() {
+			return nil, auth.ErrForbidden("only owners and admins may remove members")
+		}
+		if member.Role == auth.RoleOwner && remover.Role != auth.RoleOwner {
+			return nil, auth.ErrForbidden("only owners may remove owners")
+		}
+	}
+
+	if member.Role == auth.RoleOwner {
+		memberships, err := s.repoMngr.Membership().ByOrganizationID(ctx, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if countOwners(memberships) == 1 {
+			return nil, auth.ErrBadRequest("organization must have an owner")
+		}
+	}
+
+	if err = s.repoMngr.Membership().Remove(ctx, orgID, memberID); err != nil {
+		return nil, err
+	}
+
+	return &Response{Result: "success"}, nil
+}
+
+// membership returns a User's Membership in an Organization.
+// Non members receive the same error as non existent Organizations.
+func (s *service) membership(ctx context.Context, orgID, userID string) (*auth.Membership, error) {
+	m, err := s.repoMngr.Membership().Get(ctx, orgID, userID)
+	if err == sql.ErrNoRows {
+		return nil, auth.ErrNotFound("membership does not exist")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func countOwners(memberships []*auth.Membership) int {
+	var owners int
+	for _, m := range memberships {
+		if m.Role == auth.RoleOwner {
+			owners++
+		}
+	}
+	return owners
+}
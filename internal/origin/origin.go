@@ -0,0 +1,123 @@
+// Package origin determines the web origin a request is made from,
+// e.g. `https://app.example.com`, for services serving several
+// frontends to tell them apart.
+package origin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type contextKey string
+
+const originContextKey contextKey = "origin"
+
+// FromRequest returns the origin a request is made from, read from
+// its Origin header or, for browsers omitting it on same origin
+// requests, its Referer header. It is empty if neither is set.
+func FromRequest(r *http.Request) string {
+	if o := r.Header.Get("Origin"); o != "" && o != "null" {
+		return Normalize(o)
+	}
+
+	ref, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || ref.Scheme == "" || ref.Host == "" {
+		return ""
+	}
+	return Normalize(ref.Scheme + "://" + ref.Host)
+}
+
+// Normalize returns an origin in lowercase without a trailing slash
+// so it may be compared with configured origins.
+func Normalize(o string) string {
+	return strings.TrimRight(strings.ToLower(strings.TrimSpace(o)), "/")
+}
+
+// NewContext returns a context carrying an origin.
+func NewContext(ctx context.Context, o string) context.Context {
+	return context.WithValue(ctx, originContextKey, o)
+}
+
+// FromContext returns the origin a request is made from or an
+// empty string if it is unknown.
+func FromContext(ctx context.Context) string {
+	o, _ := ctx.Value(originContextKey).(string)
+	return o
+}
+
+// Pattern matches origins. Patterns are an origin, e.g.
+// `https://example.com`, or an origin whose host begins with a
+// wildcard label, e.g. `https://*.example.com`, matching any
+// subdomain of the host but not the host itself.
+type Pattern struct {
+	scheme   string
+	host     string
+	wildcard bool
+}
+
+// ParsePattern parses an origin pattern. Patterns without a scheme
+// are assumed to be HTTPS origins.
+func ParsePattern(s string) (Pattern, error) {
+	s = Normalize(s)
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+
+	scheme := s[:strings.Index(s, "://")]
+	host := s[len(scheme)+3:]
+
+	var p Pattern
+	if strings.HasPrefix(host, "*.") {
+		p.wildcard = true
+		host = host[2:]
+	}
+
+	u, err := url.Parse(scheme + "://" + host)
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Host != host ||
+		u.User != nil || strings.Contains(host, "*") {
+		return Pattern{}, fmt.Errorf("origin %q must be a scheme and host, e.g. https://example.com or https://*.example.com", s)
+	}
+
+	p.scheme = u.Scheme
+	p.host = u.Host
+	return p, nil
+}
+
+// Match reports whether an origin matches the pattern.
+func (p Pattern) Match(o string) bool {
+	o = Normalize(o)
+	prefix := p.scheme + "://"
+	if !strings.HasPrefix(o, prefix) {
+		return false
+	}
+
+	host := o[len(prefix):]
+	if !p.wildcard {
+		return host == p.host
+	}
+
+	sub := strings.TrimSuffix(host, "."+p.host)
+	return sub != host && sub != "" && !strings.ContainsAny(sub, "/:@")
+}
+
+// Hostname returns the host of the pattern without a wildcard or port.
+func (p Pattern) Hostname() string {
+	u := url.URL{Host: p.host}
+	return u.Hostname()
+}
+
+// IsWildcard reports whether the pattern matches subdomains.
+func (p Pattern) IsWildcard() bool {
+	return p.wildcard
+}
+
+// String returns the pattern in its normalized form.
+func (p Pattern) String() string {
+	if p.wildcard {
+		return p.scheme + "://*." + p.host
+	}
+	return p.scheme + "://" + p.host
+}
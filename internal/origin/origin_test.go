@@ -0,0 +1,153 @@
+package origin
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOrigin_FromRequest(t *testing.T) {
+	tt := []struct {
+		name    string
+		headers map[string]string
+		origin  string
+	}{
+		{
+			name:    "Origin header",
+			headers: map[string]string{"Origin": "https://App.Example.com/"},
+			origin:  "https://app.example.com",
+		},
+		{
+			name: "Origin takes precedence over referer",
+			headers: map[string]string{
+				"Origin":  "https://app.example.com",
+				"Referer": "https://admin.example.com/login",
+			},
+			origin: "https://app.example.com",
+		},
+		{
+			name:    "Referer",
+			headers: map[string]string{"Referer": "https://app.example.com:8443/login?next=/"},
+			origin:  "https://app.example.com:8443",
+		},
+		{
+			name: "Opaque origin",
+			headers: map[string]string{
+				"Origin": "null",
+			},
+			origin: "",
+		},
+		{
+			name:    "Relative referer",
+			headers: map[string]string{"Referer": "/login"},
+			origin:  "",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/login", nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			if o := FromRequest(req); o != tc.origin {
+				t.Errorf("incorrect origin, want %q got %q", tc.origin, o)
+			}
+		})
+	}
+}
+
+func TestOrigin_Context(t *testing.T) {
+	ctx := context.Background()
+	if o := FromContext(ctx); o != "" {
+		t.Errorf("expected no origin, got %q", o)
+	}
+
+	ctx = NewContext(ctx, "https://app.example.com")
+	if o := FromContext(ctx); o != "https://app.example.com" {
+		t.Errorf("incorrect origin, got %q", o)
+	}
+}
+
+func TestOrigin_Pattern(t *testing.T) {
+	tt := []struct {
+		name     string
+		pattern  string
+		matches  []string
+		rejects  []string
+		hasError bool
+	}{
+		{
+			name:    "Origin",
+			pattern: "https://App.example.com/",
+			matches: []string{"https://app.example.com", "https://APP.example.com/"},
+			rejects: []string{"http://app.example.com", "https://example.com", "https://app.example.com:8443"},
+		},
+		{
+			name:    "Origin without scheme",
+			pattern: "app.example.com",
+			matches: []string{"https://app.example.com"},
+			rejects: []string{"http://app.example.com"},
+		},
+		{
+			name:    "Wildcard",
+			pattern: "https://*.example.com",
+			matches: []string{"https://app.example.com", "https://pr-1.staging.example.com"},
+			rejects: []string{
+				"https://example.com",
+				"https://badexample.com",
+				"https://app.example.com:8443",
+				"https://app.example.com.evil.com",
+				"http://app.example.com",
+			},
+		},
+		{
+			name:    "Wildcard with port",
+			pattern: "http://*.localhost:3000",
+			matches: []string{"http://app.localhost:3000"},
+			rejects: []string{"http://app.localhost", "http://localhost:3000"},
+		},
+		{
+			name:     "Path",
+			pattern:  "https://example.com/login",
+			hasError: true,
+		},
+		{
+			name:     "Wildcard inside label",
+			pattern:  "https://app-*.example.com",
+			hasError: true,
+		},
+		{
+			name:     "Credentials",
+			pattern:  "https://user@example.com",
+			hasError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := ParsePattern(tc.pattern)
+			if tc.hasError {
+				if err == nil {
+					t.Errorf("expected pattern %q to be rejected", tc.pattern)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+
+			for _, o := range tc.matches {
+				if !p.Match(o) {
+					t.Errorf("expected %s to match %s", p, o)
+				}
+			}
+			for _, o := range tc.rejects {
+				if p.Match(o) {
+					t.Errorf("expected %s not to match %s", p, o)
+				}
+			}
+		})
+	}
+}
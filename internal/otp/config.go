@@ -1,17 +1,26 @@
 package otp
 
 import (
+	"time"
+
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
 )
 
 const (
-	defaultLength = 6
+	defaultLength  = 6
+	defaultTimeout = time.Second
 )
 
+// CodeExpiry is the time an OTP code is valid for.
+const CodeExpiry = time.Minute * 5
+
 // NewOTP returns a new OTP validator.
 func NewOTP(options ...ConfigOption) auth.OTPService {
 	s := OTP{
 		codeLength: defaultLength,
+		timeout:    defaultTimeout,
+		clock:      clock.New(),
 	}
 
 	for _, opt := range options {
@@ -53,3 +62,18 @@ func WithDB(db rediser) ConfigOption {
 		s.db = db
 	}
 }
+
+// WithClock configures the service with a clock used to expire
+// OTP codes and validate TOTP codes. Defaults to the system clock.
+func WithClock(c clock.Clock) ConfigOption {
+	return func(s *OTP) {
+		s.clock = c
+	}
+}
+
+// WithTimeout configures the deadline for Redis operations.
+func WithTimeout(timeout time.Duration) ConfigOption {
+	return func(s *OTP) {
+		s.timeout = timeout
+	}
+}
@@ -21,13 +21,13 @@ import (
 	"github.com/pquerna/otp/totp"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
 	"github.com/fmitra/authenticator/internal/crypto"
 )
 
 // rediser is a minimal interface for go-redis
 type rediser interface {
-	Get(ctx context.Context, key string) *redis.StringCmd
-	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
 	Close() error
 }
 
@@ -53,6 +53,9 @@ type OTP struct {
 	totpIssuer string
 	secrets    []Secret
 	db         rediser
+	// timeout is the deadline for Redis operations.
+	timeout time.Duration
+	clock   clock.Clock
 }
 
 // OTPCode creates a random code and hash.
@@ -62,7 +65,7 @@ func (o *OTP) OTPCode(address string, method auth.DeliveryMethod) (code string,
 		return "", "", fmt.Errorf("cannot create random string: %w", err)
 	}
 
-	h, err := toOTPHash(c, address, method)
+	h, err := toOTPHash(c, address, method, o.clock.Now())
 	if err != nil {
 		return "", "", fmt.Errorf("cannot hash otp string: %w", err)
 	}
@@ -122,7 +125,7 @@ func (o *OTP) ValidateOTP(code string, hash string) error {
 		return err
 	}
 
-	now := time.Now().Unix()
+	now := o.clock.Now().Unix()
 	if now >= otp.ExpiresAt {
 		return auth.ErrInvalidCode("code is expired")
 	}
@@ -141,35 +144,44 @@ func (o *OTP) ValidateOTP(code string, hash string) error {
 
 // ValidateTOTP checks if a User's TOTP is valid.
 // We first validate the TOTP against the user's secret key.
-// If the validation passes, we then check if the code has been
-// set in redis, indicating that it has been used in the past 30
-// seconds. Codes that have been validated are cached to prevent
-// immediate reuse.
+// If the validation passes, we then attempt to set the code
+// in redis unless it is already present, indicating that it has
+// been used in the past 30 seconds. Codes that have been validated
+// are cached to prevent immediate reuse.
 func (o *OTP) ValidateTOTP(ctx context.Context, user *auth.User, code string) error {
 	secret, err := o.decrypt(user.TFASecret)
 	if err != nil {
 		return fmt.Errorf("cannot decrypt secret: %w", err)
 	}
-	if !totp.Validate(code, secret) {
+	// Equivalent to totp.Validate, evaluated at the service clock.
+	valid, err := totp.ValidateCustom(code, secret, o.clock.Now().UTC(), totp.ValidateOpts{
+		Period:    30,
+		Skew:      1,
+		Digits:    otpLib.DigitsSix,
+		Algorithm: otpLib.AlgorithmSHA1,
+	})
+	if err != nil || !valid {
 		return auth.ErrInvalidCode("incorrect code provided")
 	}
 
+	ctx, cancel := o.withTimeout(ctx)
+	defer cancel()
+
 	key := fmt.Sprintf("%s_%s", user.ID, code)
 
-	err = o.db.Get(ctx, key).Err()
+	// SETNX checks and marks the code as used in a single round trip,
+	// also preventing concurrent requests from reusing the same code.
+	ok, err := o.db.SetNX(ctx, key, true, time.Second*30).Result()
+	if err != nil {
+		return fmt.Errorf("failed to vaidated code: %w", err)
+	}
 
 	// Validated code has previously been used in the past 30 seconds
-	if err == nil {
+	if !ok {
 		return auth.ErrInvalidCode("code is no longer valid")
 	}
 
-	// No code found in redis, indicating the code is valid. Set it to the
-	// DB to prevent reuse.
-	if err == redis.Nil {
-		return o.db.Set(ctx, key, true, time.Second*30).Err()
-	}
-
-	return fmt.Errorf("failed to vaidated code: %w", err)
+	return nil
 }
 
 func (o *OTP) latestSecret() (Secret, error) {
@@ -279,13 +291,13 @@ func (o *OTP) decrypt(encryptedTxt string) (string, error) {
 	return string(decoded), nil
 }
 
-func toOTPHash(code, address string, method auth.DeliveryMethod) (string, error) {
+func toOTPHash(code, address string, method auth.DeliveryMethod, now time.Time) (string, error) {
 	codeHash, err := crypto.Hash(code)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash code: %w", err)
 	}
 
-	expiresAt := time.Now().Add(time.Minute * 5).Unix()
+	expiresAt := now.Add(CodeExpiry).Unix()
 
 	hash := &Hash{
 		CodeHash:       codeHash,
@@ -317,3 +329,11 @@ func FromOTPHash(otpHash string) (*Hash, error) {
 
 	return &o, nil
 }
+
+// withTimeout applies the deadline for Redis operations, if configured.
+func (o *OTP) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, o.timeout)
+}
@@ -1,15 +1,49 @@
 package otp
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-redis/redis/v8"
 	"github.com/google/go-cmp/cmp"
+	"github.com/pquerna/otp/totp"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
+	"github.com/fmitra/authenticator/internal/memstore"
 )
 
+// latencyDB is an in-memory rediser simulating a network round trip
+// for each command.
+type latencyDB struct {
+	*memstore.Store
+	rtt        time.Duration
+	roundTrips int
+}
+
+func (db *latencyDB) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	db.roundTrips++
+	time.Sleep(db.rtt)
+	return db.Store.SetNX(ctx, key, value, expiration)
+}
+
+func newTOTPUser(t testing.TB, svc *OTP) (*auth.User, string) {
+	secret := "572JFGKOMDRA6KHE5O3ZV62I6BP352E7"
+	tfaSecret, err := svc.encrypt(secret)
+	if err != nil {
+		t.Fatal("failed to encrypt secret:", err)
+	}
+	code, err := totp.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal("failed to generate code:", err)
+	}
+	return &auth.User{ID: "user-id", TFASecret: tfaSecret}, code
+}
+
 func TestOTPSvc_ValidateOTP(t *testing.T) {
 	codeLength := 10
 	svc := NewOTP(WithCodeLength(codeLength))
@@ -28,6 +62,27 @@ func TestOTPSvc_ValidateOTP(t *testing.T) {
 	}
 }
 
+func TestOTPSvc_ValidateOTPExpiry(t *testing.T) {
+	c := clock.NewFake(time.Date(2020, 6, 10, 15, 0, 0, 0, time.UTC))
+	svc := NewOTP(WithClock(c))
+	code, hash, err := svc.OTPCode("jane@example.com", auth.Email)
+	if err != nil {
+		t.Fatal("failed to create code:", err)
+	}
+
+	c.Advance(CodeExpiry - time.Second)
+	if err = svc.ValidateOTP(code, hash); err != nil {
+		t.Error("failed to validate code before expiry:", err)
+	}
+
+	c.Advance(time.Second)
+	err = svc.ValidateOTP(code, hash)
+	if auth.ErrorCode(err) != auth.EInvalidCode {
+		t.Errorf("incorrect error code for expired code, want %v got %v",
+			auth.EInvalidCode, auth.ErrorCode(err))
+	}
+}
+
 func TestOTPSvc_TOTPSecret(t *testing.T) {
 	svc := NewOTP(
 		WithIssuer("authenticator.local"),
@@ -111,3 +166,49 @@ func TestOTPSvc_EncryptsWithLatestSecret(t *testing.T) {
 		t.Error("value not decrypted")
 	}
 }
+
+func TestOTPSvc_ValidateTOTP(t *testing.T) {
+	ctx := context.Background()
+	db := &latencyDB{Store: memstore.New()}
+	svc := NewOTP(
+		WithDB(db),
+		WithSecret(Secret{Version: 0, Key: "secret-key"}),
+	).(*OTP)
+	user, code := newTOTPUser(t, svc)
+
+	if err := svc.ValidateTOTP(ctx, user, code); err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	if db.roundTrips != 1 {
+		t.Errorf("incorrect round trips, want 1 got %v", db.roundTrips)
+	}
+
+	err := svc.ValidateTOTP(ctx, user, code)
+	if auth.ErrorCode(err) != auth.EInvalidCode {
+		t.Errorf("incorrect error code, want '%s' got '%s'", auth.EInvalidCode, auth.ErrorCode(err))
+	}
+
+	err = svc.ValidateTOTP(ctx, user, "000000")
+	if auth.ErrorCode(err) != auth.EInvalidCode {
+		t.Errorf("incorrect error code, want '%s' got '%s'", auth.EInvalidCode, auth.ErrorCode(err))
+	}
+}
+
+func BenchmarkOTPSvc_ValidateTOTP(b *testing.B) {
+	ctx := context.Background()
+	db := &latencyDB{Store: memstore.New(), rtt: time.Millisecond}
+	svc := NewOTP(
+		WithDB(db),
+		WithSecret(Secret{Version: 0, Key: "secret-key"}),
+	).(*OTP)
+	user, code := newTOTPUser(b, svc)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		user.ID = fmt.Sprintf("user-%d", i)
+		if err := svc.ValidateTOTP(ctx, user, code); err != nil {
+			b.Fatal("expected nil error:", err)
+		}
+	}
+	b.ReportMetric(float64(db.roundTrips)/float64(b.N), "roundtrips/op")
+}
@@ -1,6 +1,8 @@
 package password
 
 import (
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 
 	auth "github.com/fmitra/authenticator"
@@ -24,6 +26,10 @@ func NewPassword(options ...ConfigOption) auth.PasswordService {
 		opt(&s)
 	}
 
+	if s.apiCost == 0 {
+		s.apiCost = s.cost
+	}
+
 	return &s
 }
 
@@ -37,6 +43,48 @@ func WithCost(cost int) ConfigOption {
 	}
 }
 
+// WithAPICost configures the cost of password hashes of Users logging
+// in from API clients, which may log in more often than interactive
+// clients. Defaults to the cost.
+func WithAPICost(cost int) ConfigOption {
+	return func(s *Password) {
+		s.apiCost = cost
+	}
+}
+
+// TuneCost returns the highest bcrypt cost, of at least minCost, whose
+// hash takes no longer than the target duration on this machine, along
+// with the measured duration. Each increment of the cost doubles the
+// duration, so tuning takes about twice the target duration.
+func TuneCost(target time.Duration, minCost int) (int, time.Duration) {
+	return tuneCost(measureCost, target, minCost)
+}
+
+func tuneCost(measure func(cost int) time.Duration, target time.Duration, minCost int) (int, time.Duration) {
+	if minCost < bcrypt.MinCost {
+		minCost = bcrypt.MinCost
+	}
+
+	cost := minCost
+	d := measure(cost)
+	for cost < bcrypt.MaxCost && d*2 <= target {
+		next := measure(cost + 1)
+		if next > target {
+			break
+		}
+		cost, d = cost+1, next
+	}
+
+	return cost, d
+}
+
+// measureCost returns the time taken to hash a password at a cost.
+func measureCost(cost int) time.Duration {
+	start := time.Now()
+	_, _ = bcrypt.GenerateFromPassword([]byte("cost-tuning-password"), cost)
+	return time.Since(start)
+}
+
 // WithMinLength sets a minimum password length.
 func WithMinLength(length int) ConfigOption {
 	return func(s *Password) {
@@ -14,6 +14,9 @@ type Password struct {
 	// cost is the bcrypt hash repetition. Higher cost results
 	// in slower computations.
 	cost int
+	// apiCost is the bcrypt hash repetition for Users logging in
+	// from API clients rather than interactively.
+	apiCost int
 	// minLength is the minimum length of a password.
 	minLength int
 	// maxLength is the maximum length of a password.
@@ -40,6 +43,27 @@ func (p *Password) Validate(user *auth.User, password string) error {
 	return bcrypt.CompareHashAndPassword(bPasswdHash, bPasswd)
 }
 
+// Rehash returns a new hash of a validated password if the User's
+// stored hash was created at a different cost than logins from
+// API or interactive clients use. It returns nil if the stored hash
+// is at the expected cost.
+func (p *Password) Rehash(user *auth.User, password string, isAPI bool) ([]byte, error) {
+	cost := p.cost
+	if isAPI {
+		cost = p.apiCost
+	}
+
+	storedCost, err := bcrypt.Cost([]byte(user.Password))
+	if err != nil {
+		return nil, err
+	}
+	if storedCost == cost {
+		return nil, nil
+	}
+
+	return bcrypt.GenerateFromPassword([]byte(password), cost)
+}
+
 // OKForUser tells us if a password meets minimum requirements to
 // be set for any users.
 func (p *Password) OKForUser(password string) error {
@@ -2,6 +2,7 @@ package password
 
 import (
 	"testing"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -71,3 +72,112 @@ func TestPasswordSvc_ValidatePassword(t *testing.T) {
 		t.Error("failed to validate password:", err)
 	}
 }
+
+func TestPasswordSvc_TuneCost(t *testing.T) {
+	// Hashes take 1ms at the minimum cost and double with each
+	// increment of the cost.
+	measure := func(cost int) time.Duration {
+		return time.Millisecond << uint(cost-bcrypt.MinCost)
+	}
+
+	tt := []struct {
+		name     string
+		target   time.Duration
+		minCost  int
+		cost     int
+		duration time.Duration
+	}{
+		{
+			name:     "Highest cost within target",
+			target:   time.Millisecond * 300,
+			minCost:  bcrypt.MinCost,
+			cost:     12,
+			duration: time.Millisecond * 256,
+		},
+		{
+			name:     "Exact target",
+			target:   time.Millisecond * 64,
+			minCost:  bcrypt.MinCost,
+			cost:     10,
+			duration: time.Millisecond * 64,
+		},
+		{
+			name:     "Minimum cost exceeding target",
+			target:   time.Millisecond * 10,
+			minCost:  bcrypt.DefaultCost,
+			cost:     bcrypt.DefaultCost,
+			duration: time.Millisecond * 64,
+		},
+		{
+			name:     "Maximum cost",
+			target:   time.Hour * 1000000,
+			minCost:  bcrypt.MinCost,
+			cost:     bcrypt.MaxCost,
+			duration: time.Millisecond << uint(bcrypt.MaxCost-bcrypt.MinCost),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			cost, d := tuneCost(measure, tc.target, tc.minCost)
+			if cost != tc.cost {
+				t.Errorf("incorrect cost, want %v got %v", tc.cost, cost)
+			}
+			if d != tc.duration {
+				t.Errorf("incorrect duration, want %v got %v", tc.duration, d)
+			}
+		})
+	}
+}
+
+func TestPasswordSvc_Rehash(t *testing.T) {
+	svc := NewPassword(
+		WithCost(bcrypt.MinCost+1),
+		WithAPICost(bcrypt.MinCost),
+	)
+
+	h, err := bcrypt.GenerateFromPassword([]byte("swordfish"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal("failed to hash password:", err)
+	}
+	user := &auth.User{Password: string(h)}
+
+	tt := []struct {
+		name  string
+		isAPI bool
+		cost  int
+	}{
+		{
+			name:  "Hash at the API cost",
+			isAPI: true,
+		},
+		{
+			name:  "Hash below the interactive cost",
+			isAPI: false,
+			cost:  bcrypt.MinCost + 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			rehashed, err := svc.Rehash(user, "swordfish", tc.isAPI)
+			if err != nil {
+				t.Fatal("failed to rehash password:", err)
+			}
+			if tc.cost == 0 {
+				if rehashed != nil {
+					t.Error("expected no rehash")
+				}
+				return
+			}
+
+			cost, err := bcrypt.Cost(rehashed)
+			if err != nil || cost != tc.cost {
+				t.Errorf("incorrect cost, want %v got %v", tc.cost, cost)
+			}
+			if err = bcrypt.CompareHashAndPassword(rehashed, []byte("swordfish")); err != nil {
+				t.Error("rehashed password does not match:", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+)
+
+// CanaryRepository is an implementation of auth.CanaryRepository.
+type CanaryRepository struct {
+	client *Client
+}
+
+// ByIdentity retrieves a Canary with a matching identity. Emails
+// are matched by their canonical form.
+func (r *CanaryRepository) ByIdentity(ctx context.Context, identity string) (*auth.Canary, error) {
+	canary := auth.Canary{}
+	row := r.client.queryRowContext(ctx, r.client.canaryQ["byIdentity"], canonicalIdentity(identity))
+	err := row.Scan(&canary.Identity, &canary.Note, &canary.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &canary, nil
+}
+
+// List retrieves all Canaries.
+func (r *CanaryRepository) List(ctx context.Context) ([]*auth.Canary, error) {
+	rows, err := r.client.queryContext(ctx, r.client.canaryQ["list"])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	canaries := make([]*auth.Canary, 0)
+	for rows.Next() {
+		canary := auth.Canary{}
+		err := rows.Scan(&canary.Identity, &canary.Note, &canary.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		canaries = append(canaries, &canary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return canaries, nil
+}
+
+// Create persists a new Canary to storage. Emails are stored
+// in their canonical form.
+func (r *CanaryRepository) Create(ctx context.Context, canary *auth.Canary) error {
+	canary.Identity = canonicalIdentity(canary.Identity)
+	row := r.client.queryRowContext(
+		ctx,
+		r.client.canaryQ["insert"],
+		canary.Identity,
+		canary.Note,
+	)
+	return row.Scan(&canary.CreatedAt)
+}
+
+// Remove removes a Canary from storage.
+func (r *CanaryRepository) Remove(ctx context.Context, identity string) error {
+	res, err := r.client.execContext(ctx, r.client.canaryQ["delete"], canonicalIdentity(identity))
+	if err != nil {
+		return fmt.Errorf("failed to execute delete: %w", err)
+	}
+
+	removedRows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if removedRows == 0 {
+		return auth.ErrNotFound("canary does not exist")
+	}
+
+	return nil
+}
+
+// canonicalIdentity returns the form a Canary's identity is stored
+// and matched by. Emails are matched by their canonical form, as
+// Users are, and phone numbers are normalized on intake.
+func canonicalIdentity(identity string) string {
+	if !strings.Contains(identity, "@") {
+		return identity
+	}
+	return contactchecker.CanonicalEmail(identity)
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestCanaryRepository_Create(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	canary := auth.Canary{
+		Identity: "decoy@example.com",
+		Note:     "planted in legacy CRM export",
+	}
+	if err = c.Canary().Create(ctx, &canary); err != nil {
+		t.Fatal("failed to create canary:", err)
+	}
+	if canary.CreatedAt.IsZero() {
+		t.Error("Canary.CreatedAt not set")
+	}
+
+	fetched, err := c.Canary().ByIdentity(ctx, "decoy@example.com")
+	if err != nil {
+		t.Fatal("failed to retrieve canary:", err)
+	}
+	if fetched.Note != canary.Note {
+		t.Errorf("incorrect note, want %s got %s", canary.Note, fetched.Note)
+	}
+
+	canaries, err := c.Canary().List(ctx)
+	if err != nil {
+		t.Fatal("failed to list canaries:", err)
+	}
+	if len(canaries) != 1 {
+		t.Errorf("incorrect canary count, want 1 got %v", len(canaries))
+	}
+}
+
+func TestCanaryRepository_CanonicalEmail(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	contactchecker.SetEmailAliases(true)
+	defer contactchecker.SetEmailAliases(false)
+
+	ctx := context.Background()
+	canary := auth.Canary{Identity: "Jane.Decoy@gmail.com"}
+	if err = c.Canary().Create(ctx, &canary); err != nil {
+		t.Fatal("failed to create canary:", err)
+	}
+	if canary.Identity != "janedecoy@gmail.com" {
+		t.Errorf("incorrect identity, want janedecoy@gmail.com got %s", canary.Identity)
+	}
+
+	for _, identity := range []string{"JANEDECOY@gmail.com", "jane.decoy+crm@googlemail.com"} {
+		if _, err = c.Canary().ByIdentity(ctx, identity); err != nil {
+			t.Errorf("failed to retrieve canary by %s: %v", identity, err)
+		}
+	}
+
+	if err = c.Canary().Remove(ctx, "Jane.Decoy@gmail.com"); err != nil {
+		t.Error("failed to remove canary:", err)
+	}
+}
+
+func TestCanaryRepository_Remove(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	canary := auth.Canary{Identity: "+15555555555"}
+	if err = c.Canary().Create(ctx, &canary); err != nil {
+		t.Fatal("failed to create canary:", err)
+	}
+
+	if err = c.Canary().Remove(ctx, canary.Identity); err != nil {
+		t.Fatal("failed to remove canary:", err)
+	}
+
+	_, err = c.Canary().ByIdentity(ctx, canary.Identity)
+	if err != sql.ErrNoRows {
+		t.Errorf("incorrect error, want %v got %v", sql.ErrNoRows, err)
+	}
+
+	err = c.Canary().Remove(ctx, canary.Identity)
+	if auth.ErrorCode(err) != auth.ENotFound {
+		t.Errorf("incorrect error code, want %s got %s", auth.ENotFound, auth.ErrorCode(err))
+	}
+}
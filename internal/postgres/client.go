@@ -5,21 +5,32 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	// pg driver registers itself as being available to the database/sql package.
 	_ "github.com/lib/pq"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/faultinject"
 )
 
 // Client represents a client for PostgreSQL.
 type Client struct {
 	db      *sql.DB
+	replica *sql.DB
 	tx      *sql.Tx
 	entropy io.Reader
 	logger  log.Logger
 
+	queryTimeout       time.Duration
+	slowQueryThreshold time.Duration
+
+	// cipher encrypts PII columns of Users.
+	cipher fieldCipher
+
+	faults *faultinject.Injector
+
 	loginHistoryRepository *LoginHistoryRepository
 	loginHistoryQ          map[string]string
 
@@ -28,24 +39,74 @@ type Client struct {
 
 	userRepository *UserRepository
 	userQ          map[string]string
+
+	canaryRepository *CanaryRepository
+	canaryQ          map[string]string
+
+	loginDigestRepository *LoginDigestRepository
+	loginDigestQ          map[string]string
+
+	organizationRepository *OrganizationRepository
+	organizationQ          map[string]string
+
+	membershipRepository *MembershipRepository
+	membershipQ          map[string]string
+
+	consentRepository *ConsentRepository
+	consentQ          map[string]string
+
+	externalAccountRepository *ExternalAccountRepository
+	externalAccountQ          map[string]string
+
+	clientApplicationRepository *ClientApplicationRepository
+	clientApplicationQ          map[string]string
+
+	trustedRecoveryRepository *TrustedRecoveryRepository
+	trustedRecoveryQ          map[string]string
+
+	messageDeliveryRepository *MessageDeliveryRepository
+	messageDeliveryQ          map[string]string
+
+	tfaEnrollmentRepository *TFAEnrollmentRepository
+	tfaEnrollmentQ          map[string]string
 }
 
 func (c *Client) createQueries() {
 	c.loginHistoryQ = map[string]string{
 		"byTokenID": `
-			SELECT user_id, token_id, is_revoked, expires_at, created_at, updated_at
+			SELECT user_id, token_id, is_revoked, expires_at, created_at, updated_at,
+				ip_address, country, city
 			FROM login_history
 			WHERE token_id = $1;
 		`,
 		"byUserID": `
-			SELECT user_id, token_id, is_revoked, expires_at, created_at, updated_at
+			SELECT user_id, token_id, is_revoked, expires_at, created_at, updated_at,
+				ip_address, country, city
 			FROM login_history
 			WHERE user_id = $1
+			ORDER BY created_at DESC
 			LIMIT $2
 			OFFSET $3;
 		`,
+		"list": `
+			SELECT user_id, token_id, is_revoked, expires_at, created_at, updated_at,
+				ip_address, country, city
+			FROM login_history
+			WHERE user_id = $1
+				AND ($2 = '' OR token_id < $2)
+				AND ($3::timestamptz IS NULL OR created_at >= $3)
+				AND ($4::timestamptz IS NULL OR created_at < $4)
+				AND (
+					$5 = ''
+					OR ($5 = 'revoked' AND is_revoked)
+					OR ($5 = 'active' AND NOT is_revoked AND expires_at > current_timestamp)
+				)
+			ORDER BY token_id DESC
+			LIMIT $6;
+		`,
 		"forUpdate": `
-			SELECT user_id, token_id, is_revoked, expires_at, created_at, updated_at
+			SELECT user_id, token_id, is_revoked, expires_at, created_at, updated_at,
+				ip_address, country, city
 			FROM login_history
 			WHERE token_id = $1;
 		`,
@@ -56,50 +117,70 @@ func (c *Client) createQueries() {
 		`,
 		"insert": `
 			INSERT INTO login_history (
-				user_id, token_id, is_revoked, expires_at
+				user_id, token_id, is_revoked, expires_at, ip_address, country, city
 			)
-			VALUES ($1, $2, $3, $4)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
 			RETURNING created_at, updated_at;
 		`,
+		"countActive": `
+			SELECT COUNT(*)
+			FROM login_history
+			WHERE NOT is_revoked AND expires_at > current_timestamp;
+		`,
+		"countActiveByUserID": `
+			SELECT COUNT(*)
+			FROM login_history
+			WHERE user_id = $1 AND NOT is_revoked AND expires_at > current_timestamp;
+		`,
 	}
 
 	c.deviceQ = map[string]string{
 		"forUpdate": `
 			SELECT id, user_id, client_id, public_key, name, aaguid, sign_count,
-				created_at, updated_at
+				backup_eligible, backed_up, model, metadata_status, created_at, updated_at
 			FROM device
 			WHERE id = $1
 			FOR UPDATE;
 		`,
+		"forUpdateByClientID": `
+			SELECT id, user_id, client_id, public_key, name, aaguid, sign_count,
+				backup_eligible, backed_up, model, metadata_status, created_at, updated_at
+			FROM device
+			WHERE user_id = $1
+			AND client_id = $2
+			FOR UPDATE;
+		`,
 		"byUserID": `
 			SELECT id, user_id, client_id, public_key, name, aaguid, sign_count,
-				created_at, updated_at
+				backup_eligible, backed_up, model, metadata_status, created_at, updated_at
 			FROM device
 			WHERE user_id = $1;
 		`,
 		"byClientID": `
 			SELECT id, user_id, client_id, public_key, name, aaguid, sign_count,
-				created_at, updated_at
+				backup_eligible, backed_up, model, metadata_status, created_at, updated_at
 			FROM device
 			WHERE user_id = $1
 			AND client_id = $2;
 		`,
 		"byID": `
 			SELECT id, user_id, client_id, public_key, name, aaguid, sign_count,
-				created_at, updated_at
+				backup_eligible, backed_up, model, metadata_status, created_at, updated_at
 			FROM device
 			WHERE id = $1;
 		`,
 		"update": `
 			UPDATE device
-			SET client_id=$2, public_key=$3, name=$4, sign_count=$5, updated_at=$6
+			SET client_id=$2, public_key=$3, name=$4, sign_count=$5,
+				backup_eligible=$6, backed_up=$7, updated_at=$8
 			WHERE id = $1;
 		`,
 		"insert": `
 			INSERT INTO device (
-				id, user_id, client_id, public_key, name, aaguid, sign_count
+				id, user_id, client_id, public_key, name, aaguid, sign_count,
+				backup_eligible, backed_up, model, metadata_status
 			)
-			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 			RETURNING created_at, updated_at;
 		`,
 		"delete": `
@@ -110,60 +191,412 @@ func (c *Client) createQueries() {
 	c.userQ = map[string]string{
 		"forUpdate": `
 			SELECT id, phone, email, password, tfa_secret, is_email_otp_allowed, is_sms_otp_allowed,
-				is_totp_allowed, is_device_allowed, is_verified, created_at, updated_at
+				is_totp_allowed, is_device_allowed, is_verified, is_password_expired, created_at, updated_at
 			FROM auth_user
 			WHERE id = $1
 			FOR UPDATE;
 		`,
 		"byPhone": `
 			SELECT id, phone, email, password, tfa_secret, is_email_otp_allowed, is_sms_otp_allowed,
-				is_totp_allowed, is_device_allowed, is_verified, created_at, updated_at
+				is_totp_allowed, is_device_allowed, is_verified, is_password_expired, created_at, updated_at
 			FROM auth_user
-			WHERE phone = $1;
+			WHERE phone_index = $2 OR (phone_index IS NULL AND phone = $1);
 		`,
 		"byEmail": `
 			SELECT id, phone, email, password, tfa_secret, is_email_otp_allowed, is_sms_otp_allowed,
-				is_totp_allowed, is_device_allowed, is_verified, created_at, updated_at
+				is_totp_allowed, is_device_allowed, is_verified, is_password_expired, created_at, updated_at
 			FROM auth_user
-			WHERE email = $1;
+			WHERE email_index = $3 OR email_canonical = $1
+				OR (email_canonical IS NULL AND email_index IS NULL AND email = $2);
 		`,
 		"byID": `
 			SELECT id, phone, email, password, tfa_secret, is_email_otp_allowed, is_sms_otp_allowed,
-				is_totp_allowed, is_device_allowed, is_verified, created_at, updated_at
+				is_totp_allowed, is_device_allowed, is_verified, is_password_expired, created_at, updated_at
 			FROM auth_user
 			WHERE id = $1;
 		`,
+		"list": `
+			SELECT id, phone, email, password, tfa_secret, is_email_otp_allowed, is_sms_otp_allowed,
+				is_totp_allowed, is_device_allowed, is_verified, is_password_expired, created_at, updated_at
+			FROM auth_user
+			WHERE id > $1
+			ORDER BY id
+			LIMIT $2;
+		`,
 		"update": `
 			UPDATE auth_user
 			SET phone=$2, email=$3, password=$4, tfa_secret=$5,
 				is_email_otp_allowed=$6, is_sms_otp_allowed=$7, is_totp_allowed=$8, is_device_allowed=$9,
-				is_verified=$10, created_at=$11, updated_at=$12, id=$13
+				is_verified=$10, created_at=$11, updated_at=$12, id=$13, email_canonical=$14,
+				phone_index=$15, email_index=$16, is_password_expired=$17
 			WHERE id=$1;
 		`,
 		"insert": `
 			INSERT INTO auth_user (
 				id, phone, email, password, tfa_secret, is_email_otp_allowed, is_sms_otp_allowed,
-					is_totp_allowed, is_device_allowed, is_verified
+					is_totp_allowed, is_device_allowed, is_verified, email_canonical,
+					phone_index, email_index
 			)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 			RETURNING created_at, updated_at
 		`,
+		"listPhones": `
+			SELECT id, phone, phone
+			FROM auth_user
+			WHERE id > $1 AND phone IS NOT NULL
+			ORDER BY id
+			LIMIT $2;
+		`,
+		"phoneExists": `
+			SELECT EXISTS(SELECT 1 FROM auth_user WHERE phone = $1 AND id <> $2);
+		`,
+		"updatePhone": `
+			UPDATE auth_user
+			SET phone=$2, updated_at=$3
+			WHERE id=$1 AND NOT EXISTS (
+				SELECT 1 FROM auth_user WHERE phone=$2 AND id <> $1
+			);
+		`,
+		"listEmails": `
+			SELECT id, email, COALESCE(email_canonical, '')
+			FROM auth_user
+			WHERE id > $1 AND email IS NOT NULL
+			ORDER BY id
+			LIMIT $2;
+		`,
+		"canonicalEmailExists": `
+			SELECT EXISTS(SELECT 1 FROM auth_user WHERE email_canonical = $1 AND id <> $2);
+		`,
+		"updateCanonicalEmail": `
+			UPDATE auth_user
+			SET email_canonical=$2, updated_at=$3
+			WHERE id=$1 AND NOT EXISTS (
+				SELECT 1 FROM auth_user WHERE email_canonical=$2 AND id <> $1
+			);
+		`,
+		"listEncrypted": `
+			SELECT id, phone, email, tfa_secret, email_canonical, phone_index, email_index
+			FROM auth_user
+			WHERE id > $1
+			ORDER BY id
+			LIMIT $2;
+		`,
+		"indexExists": `
+			SELECT EXISTS(
+				SELECT 1 FROM auth_user
+				WHERE id <> $1 AND (phone_index = $2 OR email_index = $3)
+			);
+		`,
+		"updateEncrypted": `
+			UPDATE auth_user
+			SET phone=$2, email=$3, tfa_secret=$4, email_canonical=$5,
+				phone_index=$6, email_index=$7, updated_at=$8
+			WHERE id=$1 AND NOT EXISTS (
+				SELECT 1 FROM auth_user
+				WHERE id <> $1 AND (phone_index = $6 OR email_index = $7)
+			);
+		`,
+		"countSignups": `
+			SELECT date_trunc('day', created_at AT TIME ZONE 'UTC') AS day, COUNT(*)
+			FROM auth_user
+			WHERE is_verified AND created_at >= $1
+			GROUP BY day
+			ORDER BY day;
+		`,
+		"countTFA": `
+			SELECT COUNT(*),
+				COUNT(*) FILTER (WHERE is_email_otp_allowed),
+				COUNT(*) FILTER (WHERE is_sms_otp_allowed),
+				COUNT(*) FILTER (WHERE is_totp_allowed),
+				COUNT(*) FILTER (WHERE is_device_allowed)
+			FROM auth_user
+			WHERE is_verified;
+		`,
+	}
+
+	c.canaryQ = map[string]string{
+		"byIdentity": `
+			SELECT identity, note, created_at
+			FROM canary
+			WHERE identity = $1;
+		`,
+		"list": `
+			SELECT identity, note, created_at
+			FROM canary
+			ORDER BY created_at;
+		`,
+		"insert": `
+			INSERT INTO canary (identity, note)
+			VALUES ($1, $2)
+			RETURNING created_at;
+		`,
+		"delete": `
+			DELETE FROM canary WHERE identity=$1;
+		`,
+		"updateIdentity": `
+			UPDATE canary
+			SET identity=$2
+			WHERE identity=$1 AND NOT EXISTS (
+				SELECT 1 FROM canary WHERE identity=$2
+			);
+		`,
+	}
+
+	c.clientApplicationQ = map[string]string{
+		"byID": `
+			SELECT id, name, allowed_origins, token_expiry_seconds,
+				refresh_token_expiry_seconds, required_tfa, logout_url,
+				audiences, scopes, created_at, updated_at
+			FROM client_application
+			WHERE id = $1;
+		`,
+		"list": `
+			SELECT id, name, allowed_origins, token_expiry_seconds,
+				refresh_token_expiry_seconds, required_tfa, logout_url,
+				audiences, scopes, created_at, updated_at
+			FROM client_application
+			ORDER BY created_at;
+		`,
+		"insert": `
+			INSERT INTO client_application (
+				id, name, allowed_origins, token_expiry_seconds,
+				refresh_token_expiry_seconds, required_tfa, logout_url,
+				audiences, scopes
+			)
+			VALUES (
+				$1, $2, COALESCE($3::TEXT[], '{}'), $4, $5, $6, $7,
+				COALESCE($8::TEXT[], '{}'), COALESCE($9::TEXT[], '{}')
+			)
+			RETURNING created_at, updated_at;
+		`,
+		"delete": `
+			DELETE FROM client_application WHERE id=$1;
+		`,
+	}
+
+	c.trustedRecoveryQ = map[string]string{
+		"byUserID": `
+			SELECT user_id, contacts, verified, threshold, code_hash, created_at
+			FROM trusted_recovery
+			WHERE user_id = $1;
+		`,
+		"upsert": `
+			INSERT INTO trusted_recovery (user_id, contacts, threshold, code_hash)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id)
+			DO UPDATE SET contacts = $2, verified = '{}', threshold = $3, code_hash = $4,
+				created_at = current_timestamp
+			RETURNING created_at;
+		`,
+		"verify": `
+			UPDATE trusted_recovery SET verified = array_append(verified, $2)
+			WHERE user_id = $1 AND $2 = ANY(contacts) AND NOT $2 = ANY(verified);
+		`,
+		"delete": `
+			DELETE FROM trusted_recovery WHERE user_id=$1;
+		`,
+	}
+
+	c.loginDigestQ = map[string]string{
+		"byUserID": `
+			SELECT user_id, last_sent_at, created_at
+			FROM login_digest
+			WHERE user_id = $1;
+		`,
+		"due": `
+			SELECT user_id, last_sent_at, created_at
+			FROM login_digest
+			WHERE last_sent_at < $1
+			ORDER BY last_sent_at
+			LIMIT $2;
+		`,
+		"insert": `
+			INSERT INTO login_digest (user_id)
+			VALUES ($1)
+			RETURNING last_sent_at, created_at;
+		`,
+		"markSent": `
+			UPDATE login_digest
+			SET last_sent_at=$2
+			WHERE user_id = $1;
+		`,
+		"delete": `
+			DELETE FROM login_digest WHERE user_id=$1;
+		`,
+	}
+
+	c.organizationQ = map[string]string{
+		"byID": `
+			SELECT id, name, created_at, updated_at
+			FROM organization
+			WHERE id = $1;
+		`,
+		"insert": `
+			INSERT INTO organization (id, name)
+			VALUES ($1, $2)
+			RETURNING created_at, updated_at;
+		`,
+	}
+
+	c.membershipQ = map[string]string{
+		"get": `
+			SELECT organization_id, user_id, role, created_at
+			FROM membership
+			WHERE organization_id = $1
+			AND user_id = $2;
+		`,
+		"byUserID": `
+			SELECT organization_id, user_id, role, created_at
+			FROM membership
+			WHERE user_id = $1
+			ORDER BY created_at;
+		`,
+		"byOrganizationID": `
+			SELECT organization_id, user_id, role, created_at
+			FROM membership
+			WHERE organization_id = $1
+			ORDER BY created_at;
+		`,
+		"insert": `
+			INSERT INTO membership (organization_id, user_id, role)
+			VALUES ($1, $2, $3)
+			RETURNING created_at;
+		`,
+		"delete": `
+			DELETE FROM membership WHERE organization_id=$1 AND user_id=$2;
+		`,
+		"invitationByID": `
+			SELECT id, organization_id, email, role, code_hash, invited_by,
+				expires_at, created_at
+			FROM org_invitation
+			WHERE id = $1;
+		`,
+		"insertInvitation": `
+			INSERT INTO org_invitation (
+				id, organization_id, email, role, code_hash, invited_by, expires_at
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING created_at;
+		`,
+		"deleteInvitation": `
+			DELETE FROM org_invitation WHERE id=$1;
+		`,
+	}
+
+	c.consentQ = map[string]string{
+		"byUserID": `
+			SELECT user_id, policy, version, ip_address, accepted_at
+			FROM consent
+			WHERE user_id = $1
+			ORDER BY accepted_at;
+		`,
+		"insert": `
+			INSERT INTO consent (user_id, policy, version, ip_address)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id, policy, version)
+			DO UPDATE SET ip_address = consent.ip_address
+			RETURNING ip_address, accepted_at;
+		`,
+	}
+
+	c.externalAccountQ = map[string]string{
+		"byExternalID": `
+			SELECT external_id, user_id, created_at
+			FROM external_account
+			WHERE external_id = $1;
+		`,
+		"insert": `
+			INSERT INTO external_account (external_id, user_id)
+			VALUES ($1, $2)
+			RETURNING created_at;
+		`,
+	}
+
+	c.messageDeliveryQ = map[string]string{
+		"byID": `
+			SELECT id, type, delivery, address, status, detail, created_at, updated_at
+			FROM message_delivery
+			WHERE id = $1;
+		`,
+		"byAddress": `
+			SELECT id, type, delivery, address, status, detail, created_at, updated_at
+			FROM message_delivery
+			WHERE address = $1
+			ORDER BY created_at DESC
+			LIMIT $2;
+		`,
+		"insert": `
+			INSERT INTO message_delivery (
+				id, type, delivery, address, status, detail
+			)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING created_at, updated_at;
+		`,
+		"updateStatus": `
+			UPDATE message_delivery
+			SET status=$2, detail=$3, updated_at=$4
+			WHERE id=$1 AND status = ANY($5);
+		`,
+	}
+
+	c.tfaEnrollmentQ = map[string]string{
+		"byUserID": `
+			SELECT user_id, deadline, last_reminded_at, created_at
+			FROM tfa_enrollment
+			WHERE user_id = $1;
+		`,
+		"due": `
+			SELECT user_id, deadline, last_reminded_at, created_at
+			FROM tfa_enrollment
+			WHERE deadline > $1
+			AND (last_reminded_at IS NULL OR last_reminded_at < $2)
+			ORDER BY deadline
+			LIMIT $3;
+		`,
+		"insert": `
+			INSERT INTO tfa_enrollment (user_id, deadline)
+			VALUES ($1, $2)
+			ON CONFLICT (user_id)
+			DO UPDATE SET deadline = tfa_enrollment.deadline
+			RETURNING deadline, last_reminded_at, created_at;
+		`,
+		"markReminded": `
+			UPDATE tfa_enrollment
+			SET last_reminded_at=$2
+			WHERE user_id = $1;
+		`,
 	}
 }
 
 // NewWithTransaction returns a new client with a transaction. All
 // repository operations using the new client will default to the transaction.
 func (c *Client) NewWithTransaction(ctx context.Context) (auth.RepositoryManager, error) {
+	if err := c.faults.Inject(ctx, faultinject.Postgres); err != nil {
+		return nil, err
+	}
+
 	tx, err := c.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	// Repositories are copied rather than shared so the transaction
+	// is not visible through the Client it was started from.
 	newClient := *c
 	newClient.tx = tx
-	newClient.loginHistoryRepository.client = &newClient
-	newClient.userRepository.client = &newClient
-	newClient.deviceRepository.client = &newClient
+	newClient.loginHistoryRepository = &LoginHistoryRepository{client: &newClient}
+	newClient.userRepository = &UserRepository{client: &newClient, password: c.userRepository.password}
+	newClient.deviceRepository = &DeviceRepository{client: &newClient}
+	newClient.canaryRepository = &CanaryRepository{client: &newClient}
+	newClient.loginDigestRepository = &LoginDigestRepository{client: &newClient}
+	newClient.organizationRepository = &OrganizationRepository{client: &newClient}
+	newClient.membershipRepository = &MembershipRepository{client: &newClient}
+	newClient.consentRepository = &ConsentRepository{client: &newClient}
+	newClient.externalAccountRepository = &ExternalAccountRepository{client: &newClient}
+	newClient.clientApplicationRepository = &ClientApplicationRepository{client: &newClient}
+	newClient.trustedRecoveryRepository = &TrustedRecoveryRepository{client: &newClient}
+	newClient.messageDeliveryRepository = &MessageDeliveryRepository{client: &newClient}
+	newClient.tfaEnrollmentRepository = &TFAEnrollmentRepository{client: &newClient}
 	return &newClient, nil
 }
 
@@ -210,26 +643,133 @@ func (c *Client) User() auth.UserRepository {
 	return c.userRepository
 }
 
-func (c *Client) queryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+// Canary returns a CanaryRepository.
+func (c *Client) Canary() auth.CanaryRepository {
+	return c.canaryRepository
+}
+
+// LoginDigest returns a LoginDigestRepository.
+func (c *Client) LoginDigest() auth.LoginDigestRepository {
+	return c.loginDigestRepository
+}
+
+// Organization returns an OrganizationRepository.
+func (c *Client) Organization() auth.OrganizationRepository {
+	return c.organizationRepository
+}
+
+// Membership returns a MembershipRepository.
+func (c *Client) Membership() auth.MembershipRepository {
+	return c.membershipRepository
+}
+
+// Consent returns a ConsentRepository.
+func (c *Client) Consent() auth.ConsentRepository {
+	return c.consentRepository
+}
+
+// ExternalAccount returns an ExternalAccountRepository.
+func (c *Client) ExternalAccount() auth.ExternalAccountRepository {
+	return c.externalAccountRepository
+}
+
+// ClientApplication returns a ClientApplicationRepository.
+func (c *Client) ClientApplication() auth.ClientApplicationRepository {
+	return c.clientApplicationRepository
+}
+
+// TrustedRecovery returns a TrustedRecoveryRepository.
+func (c *Client) TrustedRecovery() auth.TrustedRecoveryRepository {
+	return c.trustedRecoveryRepository
+}
+
+// MessageDelivery returns a MessageDeliveryRepository.
+func (c *Client) MessageDelivery() auth.MessageDeliveryRepository {
+	return c.messageDeliveryRepository
+}
+
+// TFAEnrollment returns a TFAEnrollmentRepository.
+func (c *Client) TFAEnrollment() auth.TFAEnrollmentRepository {
+	return c.tfaEnrollmentRepository
+}
+
+// queryer is satisfied by sql.DB and sql.Tx.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// primary returns the transaction in progress or the primary DB.
+func (c *Client) primary() queryer {
 	if c.tx != nil {
-		return c.tx.QueryRowContext(ctx, query, args...)
+		return c.tx
 	}
 
-	return c.db.QueryRowContext(ctx, query, args...)
+	return c.db
 }
 
-func (c *Client) queryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	if c.tx != nil {
-		return c.tx.QueryContext(ctx, query, args...)
+// reader returns a read replica if configured. Queries within a
+// transaction are always sent to the primary to guarantee consistency.
+func (c *Client) reader() queryer {
+	if c.tx == nil && c.replica != nil {
+		return c.replica
 	}
 
-	return c.db.QueryContext(ctx, query, args...)
+	return c.primary()
 }
 
-func (c *Client) execContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	if c.tx != nil {
-		return c.tx.ExecContext(ctx, query, args...)
+func (c *Client) queryRowContext(ctx context.Context, statement string, args ...interface{}) *row {
+	return c.queryRow(ctx, c.primary(), statement, args...)
+}
+
+func (c *Client) queryContext(ctx context.Context, statement string, args ...interface{}) (*rows, error) {
+	return c.query(ctx, c.primary(), statement, args...)
+}
+
+// readRowContext is equivalent to queryRowContext but may be served by
+// a read replica. Results may lag behind recent writes.
+func (c *Client) readRowContext(ctx context.Context, statement string, args ...interface{}) *row {
+	return c.queryRow(ctx, c.reader(), statement, args...)
+}
+
+// readContext is equivalent to queryContext but may be served by
+// a read replica. Results may lag behind recent writes.
+func (c *Client) readContext(ctx context.Context, statement string, args ...interface{}) (*rows, error) {
+	return c.query(ctx, c.reader(), statement, args...)
+}
+
+func (c *Client) execContext(ctx context.Context, statement string, args ...interface{}) (sql.Result, error) {
+	ctx, q := c.startQuery(ctx, statement, args)
+	defer q.finish()
+
+	if err := c.faults.Inject(ctx, faultinject.Postgres); err != nil {
+		return nil, err
+	}
+
+	return c.primary().ExecContext(ctx, statement, args...)
+}
+
+func (c *Client) queryRow(ctx context.Context, db queryer, statement string, args ...interface{}) *row {
+	ctx, q := c.startQuery(ctx, statement, args)
+	if err := c.faults.Inject(ctx, faultinject.Postgres); err != nil {
+		return &row{err: err, query: q}
+	}
+	return &row{Row: db.QueryRowContext(ctx, statement, args...), query: q}
+}
+
+func (c *Client) query(ctx context.Context, db queryer, statement string, args ...interface{}) (*rows, error) {
+	ctx, q := c.startQuery(ctx, statement, args)
+	if err := c.faults.Inject(ctx, faultinject.Postgres); err != nil {
+		q.finish()
+		return nil, err
+	}
+
+	r, err := db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		q.finish()
+		return nil, err
 	}
 
-	return c.db.ExecContext(ctx, query, args...)
+	return &rows{Rows: r, query: q}, nil
 }
@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/oklog/ulid/v2"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// ClientApplicationRepository is an implementation of auth.ClientApplicationRepository.
+type ClientApplicationRepository struct {
+	client *Client
+}
+
+// ByID retrieves a ClientApplication with a matching ID.
+func (r *ClientApplicationRepository) ByID(ctx context.Context, clientID string) (*auth.ClientApplication, error) {
+	row := r.client.queryRowContext(ctx, r.client.clientApplicationQ["byID"], clientID)
+	return scanClientApplication(row)
+}
+
+// List retrieves all ClientApplications.
+func (r *ClientApplicationRepository) List(ctx context.Context) ([]*auth.ClientApplication, error) {
+	rows, err := r.client.queryContext(ctx, r.client.clientApplicationQ["list"])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apps := make([]*auth.ClientApplication, 0)
+	for rows.Next() {
+		app, err := scanClientApplication(rows)
+		if err != nil {
+			return nil, err
+		}
+		apps = append(apps, app)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return apps, nil
+}
+
+// Create persists a new ClientApplication to storage.
+func (r *ClientApplicationRepository) Create(ctx context.Context, app *auth.ClientApplication) error {
+	clientID, err := ulid.New(ulid.Now(), r.client.entropy)
+	if err != nil {
+		return fmt.Errorf("cannot generate unique client application ID: %w", err)
+	}
+
+	if app.RequiredTFA == "" {
+		app.RequiredTFA = auth.TFALevelOTP
+	}
+
+	app.ID = clientID.String()
+	row := r.client.queryRowContext(
+		ctx,
+		r.client.clientApplicationQ["insert"],
+		app.ID,
+		app.Name,
+		pq.Array(app.AllowedOrigins),
+		int64(app.TokenExpiry/time.Second),
+		int64(app.RefreshTokenExpiry/time.Second),
+		app.RequiredTFA,
+		app.LogoutURL,
+		pq.Array(app.Audiences),
+		pq.Array(app.Scopes),
+	)
+	return row.Scan(&app.CreatedAt, &app.UpdatedAt)
+}
+
+// Remove removes a ClientApplication from storage.
+func (r *ClientApplicationRepository) Remove(ctx context.Context, clientID string) error {
+	res, err := r.client.execContext(ctx, r.client.clientApplicationQ["delete"], clientID)
+	if err != nil {
+		return fmt.Errorf("failed to execute delete: %w", err)
+	}
+
+	removedRows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if removedRows == 0 {
+		return auth.ErrNotFound("client application does not exist")
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanClientApplication(s scanner) (*auth.ClientApplication, error) {
+	var (
+		app                auth.ClientApplication
+		tokenExpiry        int64
+		refreshTokenExpiry int64
+		allowedOrigins     []string
+		audiences          []string
+		scopes             []string
+	)
+
+	err := s.Scan(
+		&app.ID,
+		&app.Name,
+		pq.Array(&allowedOrigins),
+		&tokenExpiry,
+		&refreshTokenExpiry,
+		&app.RequiredTFA,
+		&app.LogoutURL,
+		pq.Array(&audiences),
+		pq.Array(&scopes),
+		&app.CreatedAt,
+		&app.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	app.AllowedOrigins = allowedOrigins
+	app.Audiences = audiences
+	app.Scopes = scopes
+	app.TokenExpiry = time.Duration(tokenExpiry) * time.Second
+	app.RefreshTokenExpiry = time.Duration(refreshTokenExpiry) * time.Second
+	return &app, nil
+}
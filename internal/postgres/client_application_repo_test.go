@@ -0,0 +1,112 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestClientApplicationRepository_Create(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	app := auth.ClientApplication{
+		Name:               "Mobile",
+		AllowedOrigins:     []string{"https://m.example.com", "https://app.example.com"},
+		TokenExpiry:        time.Minute * 5,
+		RefreshTokenExpiry: time.Hour * 24 * 30,
+		RequiredTFA:        auth.TFALevelDevice,
+		LogoutURL:          "https://app.example.com/logout",
+		Audiences:          []string{"billing"},
+		Scopes:             []string{"invoices:read", "invoices:write"},
+	}
+	if err = c.ClientApplication().Create(ctx, &app); err != nil {
+		t.Fatal("failed to create client application:", err)
+	}
+	if app.ID == "" {
+		t.Error("ClientApplication.ID not set")
+	}
+	if app.CreatedAt.IsZero() {
+		t.Error("ClientApplication.CreatedAt not set")
+	}
+
+	fetched, err := c.ClientApplication().ByID(ctx, app.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve client application:", err)
+	}
+	if !cmp.Equal(fetched.AllowedOrigins, app.AllowedOrigins) {
+		t.Error(cmp.Diff(fetched.AllowedOrigins, app.AllowedOrigins))
+	}
+	if !cmp.Equal(fetched.Audiences, app.Audiences) {
+		t.Error(cmp.Diff(fetched.Audiences, app.Audiences))
+	}
+	if !cmp.Equal(fetched.Scopes, app.Scopes) {
+		t.Error(cmp.Diff(fetched.Scopes, app.Scopes))
+	}
+	if fetched.TokenExpiry != app.TokenExpiry {
+		t.Errorf("incorrect token expiry, want %v got %v", app.TokenExpiry, fetched.TokenExpiry)
+	}
+	if fetched.RefreshTokenExpiry != app.RefreshTokenExpiry {
+		t.Errorf("incorrect refresh token expiry, want %v got %v",
+			app.RefreshTokenExpiry, fetched.RefreshTokenExpiry)
+	}
+	if fetched.RequiredTFA != app.RequiredTFA {
+		t.Errorf("incorrect required TFA, want %s got %s", app.RequiredTFA, fetched.RequiredTFA)
+	}
+	if fetched.LogoutURL != app.LogoutURL {
+		t.Errorf("incorrect logout URL, want %s got %s", app.LogoutURL, fetched.LogoutURL)
+	}
+
+	apps, err := c.ClientApplication().List(ctx)
+	if err != nil {
+		t.Fatal("failed to list client applications:", err)
+	}
+	if len(apps) != 1 {
+		t.Errorf("incorrect client application count, want 1 got %v", len(apps))
+	}
+}
+
+func TestClientApplicationRepository_Remove(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	app := auth.ClientApplication{Name: "Web"}
+	if err = c.ClientApplication().Create(ctx, &app); err != nil {
+		t.Fatal("failed to create client application:", err)
+	}
+	if app.RequiredTFA != auth.TFALevelOTP {
+		t.Errorf("incorrect default required TFA, want %s got %s", auth.TFALevelOTP, app.RequiredTFA)
+	}
+
+	if err = c.ClientApplication().Remove(ctx, app.ID); err != nil {
+		t.Fatal("failed to remove client application:", err)
+	}
+
+	_, err = c.ClientApplication().ByID(ctx, app.ID)
+	if err != sql.ErrNoRows {
+		t.Errorf("incorrect error, want %v got %v", sql.ErrNoRows, err)
+	}
+
+	err = c.ClientApplication().Remove(ctx, app.ID)
+	if auth.ErrorCode(err) != auth.ENotFound {
+		t.Errorf("incorrect error code, want %s got %s", auth.ENotFound, auth.ErrorCode(err))
+	}
+}
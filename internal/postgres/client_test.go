@@ -0,0 +1,19 @@
+package postgres
+
+import (
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/repotest"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestClient_Conformance(t *testing.T) {
+	repotest.RunRepositoryManagerTests(t, func(t *testing.T) (auth.RepositoryManager, func()) {
+		pgDB, err := test.NewPGDB()
+		if err != nil {
+			t.Fatal("failed to create test database:", err)
+		}
+		return TestClient(pgDB.DB), func() { pgDB.DropDB() }
+	})
+}
@@ -2,20 +2,31 @@ package postgres
 
 import (
 	"database/sql"
+	"time"
 
 	"github.com/go-kit/kit/log"
 
 	auth "github.com/fmitra/authenticator"
 	"github.com/fmitra/authenticator/internal/entropy"
+	"github.com/fmitra/authenticator/internal/faultinject"
 )
 
 // NewClient returns a new Postgres client to manage repositories.
 func NewClient(options ...ConfigOption) *Client {
 	c := Client{
-		logger:                 log.NewNopLogger(),
-		loginHistoryRepository: &LoginHistoryRepository{},
-		deviceRepository:       &DeviceRepository{},
-		userRepository:         &UserRepository{},
+		logger:                      log.NewNopLogger(),
+		loginHistoryRepository:      &LoginHistoryRepository{},
+		deviceRepository:            &DeviceRepository{},
+		userRepository:              &UserRepository{},
+		canaryRepository:            &CanaryRepository{},
+		loginDigestRepository:       &LoginDigestRepository{},
+		organizationRepository:      &OrganizationRepository{},
+		membershipRepository:        &MembershipRepository{},
+		consentRepository:           &ConsentRepository{},
+		externalAccountRepository:   &ExternalAccountRepository{},
+		clientApplicationRepository: &ClientApplicationRepository{},
+		trustedRecoveryRepository:   &TrustedRecoveryRepository{},
+		messageDeliveryRepository:   &MessageDeliveryRepository{},
 	}
 
 	for _, opt := range options {
@@ -31,6 +42,15 @@ func NewClient(options ...ConfigOption) *Client {
 	c.loginHistoryRepository.client = &c
 	c.deviceRepository.client = &c
 	c.userRepository.client = &c
+	c.canaryRepository.client = &c
+	c.loginDigestRepository.client = &c
+	c.organizationRepository.client = &c
+	c.membershipRepository.client = &c
+	c.consentRepository.client = &c
+	c.externalAccountRepository.client = &c
+	c.clientApplicationRepository.client = &c
+	c.trustedRecoveryRepository.client = &c
+	c.messageDeliveryRepository.client = &c
 
 	return &c
 }
@@ -58,3 +78,52 @@ func WithDB(db *sql.DB) ConfigOption {
 		c.db = db
 	}
 }
+
+// WithReplica configures the client with a read-only Postgres DB.
+// Non-transactional reads which tolerate replication lag are routed
+// to the replica while writes remain on the primary DB.
+func WithReplica(db *sql.DB) ConfigOption {
+	return func(c *Client) {
+		c.replica = db
+	}
+}
+
+// WithQueryTimeout configures the maximum duration of a query. A
+// duration of zero disables the timeout.
+func WithQueryTimeout(d time.Duration) ConfigOption {
+	return func(c *Client) {
+		c.queryTimeout = d
+	}
+}
+
+// WithSlowQueryThreshold configures the duration after which queries
+// are logged as slow. A duration of zero disables slow query logging.
+func WithSlowQueryThreshold(d time.Duration) ConfigOption {
+	return func(c *Client) {
+		c.slowQueryThreshold = d
+	}
+}
+
+// WithSecret sets a versioned Secret to encrypt PII columns of Users.
+// Values are encrypted with the most recent Secret, while older
+// Secrets decrypt values until they are re-encrypted.
+func WithSecret(x Secret) ConfigOption {
+	return func(c *Client) {
+		c.cipher.secrets = append(c.cipher.secrets, x)
+	}
+}
+
+// WithIndexKey configures the key of blind indexes used to look up
+// Users by encrypted phone or email.
+func WithIndexKey(key string) ConfigOption {
+	return func(c *Client) {
+		c.cipher.indexKey = []byte(key)
+	}
+}
+
+// WithFaults configures the client to inject faults into queries.
+func WithFaults(i *faultinject.Injector) ConfigOption {
+	return func(c *Client) {
+		c.faults = i
+	}
+}
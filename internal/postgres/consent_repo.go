@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// ConsentRepository is an implementation of auth.ConsentRepository.
+type ConsentRepository struct {
+	client *Client
+}
+
+// ByUserID retrieves all Consent recorded for a User.
+func (r *ConsentRepository) ByUserID(ctx context.Context, userID string) ([]*auth.Consent, error) {
+	rows, err := r.client.queryContext(ctx, r.client.consentQ["byUserID"], userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	consents := make([]*auth.Consent, 0)
+	for rows.Next() {
+		c := auth.Consent{}
+		err = rows.Scan(&c.UserID, &c.Policy, &c.Version, &c.IPAddress, &c.AcceptedAt)
+		if err != nil {
+			return nil, err
+		}
+		consents = append(consents, &c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return consents, nil
+}
+
+// Create records a new Consent. If the User previously accepted
+// the same policy version, the original acceptance is retained.
+func (r *ConsentRepository) Create(ctx context.Context, c *auth.Consent) error {
+	row := r.client.queryRowContext(
+		ctx,
+		r.client.consentQ["insert"],
+		c.UserID,
+		c.Policy,
+		c.Version,
+		c.IPAddress,
+	)
+	return row.Scan(&c.IPAddress, &c.AcceptedAt)
+}
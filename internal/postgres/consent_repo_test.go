@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestConsentRepository_Create(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	consent := auth.Consent{
+		UserID:    user.ID,
+		Policy:    "tos",
+		Version:   "2020-06-01",
+		IPAddress: "127.0.0.1",
+	}
+	if err = c.Consent().Create(ctx, &consent); err != nil {
+		t.Fatal("failed to create consent:", err)
+	}
+
+	// Accepting the same version again retains the original record.
+	again := auth.Consent{
+		UserID:    user.ID,
+		Policy:    "tos",
+		Version:   "2020-06-01",
+		IPAddress: "10.0.0.1",
+	}
+	if err = c.Consent().Create(ctx, &again); err != nil {
+		t.Fatal("failed to create consent:", err)
+	}
+
+	if again.IPAddress != consent.IPAddress {
+		t.Errorf("incorrect IP address, want %s got %s", consent.IPAddress, again.IPAddress)
+	}
+	if !again.AcceptedAt.Equal(consent.AcceptedAt) {
+		t.Errorf("incorrect accepted time, want %v got %v", consent.AcceptedAt, again.AcceptedAt)
+	}
+
+	consents, err := c.Consent().ByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve consent:", err)
+	}
+	if len(consents) != 1 {
+		t.Errorf("incorrect consent count, want 1 got %v", len(consents))
+	}
+}
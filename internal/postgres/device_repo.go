@@ -26,8 +26,9 @@ func (r *DeviceRepository) ByClientID(ctx context.Context, userID string, client
 }
 
 // ByUserID retrieves all Devices associated with a User.
+// Outside of a transaction it may be served by a read replica.
 func (r *DeviceRepository) ByUserID(ctx context.Context, userID string) ([]*auth.Device, error) {
-	rows, err := r.client.queryContext(ctx, r.client.deviceQ["byUserID"], userID)
+	rows, err := r.client.readContext(ctx, r.client.deviceQ["byUserID"], userID)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +39,8 @@ func (r *DeviceRepository) ByUserID(ctx context.Context, userID string) ([]*auth
 		device := auth.Device{}
 		err := rows.Scan(
 			&device.ID, &device.UserID, &device.ClientID, &device.PublicKey, &device.Name,
-			&device.AAGUID, &device.SignCount, &device.CreatedAt, &device.UpdatedAt,
+			&device.AAGUID, &device.SignCount, &device.BackupEligible, &device.BackedUp,
+			&device.Model, &device.MetadataStatus, &device.CreatedAt, &device.UpdatedAt,
 		)
 		if err != nil {
 			return nil, err
@@ -70,6 +72,10 @@ func (r *DeviceRepository) Create(ctx context.Context, device *auth.Device) erro
 		device.Name,
 		device.AAGUID,
 		device.SignCount,
+		device.BackupEligible,
+		device.BackedUp,
+		device.Model,
+		device.MetadataStatus,
 	)
 	err = row.Scan(
 		&device.CreatedAt,
@@ -91,6 +97,8 @@ func (r *DeviceRepository) Update(ctx context.Context, device *auth.Device) erro
 		device.PublicKey,
 		device.Name,
 		device.SignCount,
+		device.BackupEligible,
+		device.BackedUp,
 		device.UpdatedAt,
 	)
 	if err != nil {
@@ -109,11 +117,22 @@ func (r *DeviceRepository) Update(ctx context.Context, device *auth.Device) erro
 
 // GetForUpdate retrieves a Device to be updated.
 func (r *DeviceRepository) GetForUpdate(ctx context.Context, deviceID string) (*auth.Device, error) {
+	return r.getForUpdate(ctx, "forUpdate", deviceID)
+}
+
+// GetForUpdateByClientID retrieves a Device with a matching ClientID
+// to be updated.
+func (r *DeviceRepository) GetForUpdateByClientID(ctx context.Context, userID string, clientID []byte) (*auth.Device, error) {
+	return r.getForUpdate(ctx, "forUpdateByClientID", userID, clientID)
+}
+
+func (r *DeviceRepository) getForUpdate(ctx context.Context, query string, args ...interface{}) (*auth.Device, error) {
 	device := auth.Device{}
-	row := r.client.queryRowContext(ctx, r.client.deviceQ["forUpdate"], deviceID)
+	row := r.client.queryRowContext(ctx, r.client.deviceQ[query], args...)
 	err := row.Scan(
 		&device.ID, &device.UserID, &device.ClientID, &device.PublicKey, &device.Name,
-		&device.AAGUID, &device.SignCount, &device.CreatedAt, &device.UpdatedAt,
+		&device.AAGUID, &device.SignCount, &device.BackupEligible, &device.BackedUp,
+		&device.Model, &device.MetadataStatus, &device.CreatedAt, &device.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve record for update: %w", err)
@@ -148,7 +167,8 @@ func (r *DeviceRepository) get(ctx context.Context, queryKey string, values ...i
 	row := r.client.queryRowContext(ctx, r.client.deviceQ[queryKey], values...)
 	err := row.Scan(
 		&device.ID, &device.UserID, &device.ClientID, &device.PublicKey, &device.Name,
-		&device.AAGUID, &device.SignCount, &device.CreatedAt, &device.UpdatedAt,
+		&device.AAGUID, &device.SignCount, &device.BackupEligible, &device.BackedUp,
+		&device.Model, &device.MetadataStatus, &device.CreatedAt, &device.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -200,6 +200,74 @@ func TestDeviceRepository_ByClientID(t *testing.T) {
 	}
 }
 
+func TestDeviceRepository_GetForUpdateByClientID(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	err = c.User().Create(ctx, &user)
+	if err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	clientID := []byte("372b0969c35944209ca7adb5e617365c")
+	device := auth.Device{
+		UserID:         user.ID,
+		ClientID:       clientID,
+		PublicKey:      []byte(publicKey),
+		AAGUID:         []byte("2bc7fd09a3d64cdea6f038023d0fa49e"),
+		Name:           "Passkey",
+		BackupEligible: true,
+		BackedUp:       true,
+		Model:          "YubiKey 5 Series",
+		MetadataStatus: "FIDO_CERTIFIED_L1",
+	}
+	err = c.Device().Create(ctx, &device)
+	if err != nil {
+		t.Fatal("failed to create device:", err)
+	}
+
+	client, err := c.NewWithTransaction(ctx)
+	if err != nil {
+		t.Fatal("failed to start transaction:", err)
+	}
+
+	entity, err := client.WithAtomic(func() (interface{}, error) {
+		return client.Device().GetForUpdateByClientID(ctx, user.ID, clientID)
+	})
+	if err != nil {
+		t.Fatal("failed to retrieve device:", err)
+	}
+	deviceB := entity.(*auth.Device)
+	if deviceB.ID != device.ID {
+		t.Errorf("device IDs do not match: want %s got %s", device.ID, deviceB.ID)
+	}
+	if !deviceB.BackupEligible || !deviceB.BackedUp {
+		t.Error("expected device backup flags to be stored")
+	}
+	if deviceB.Model != device.Model || deviceB.MetadataStatus != device.MetadataStatus {
+		t.Errorf("incorrect device metadata: want %s (%s) got %s (%s)",
+			device.Model, device.MetadataStatus, deviceB.Model, deviceB.MetadataStatus)
+	}
+
+	_, err = c.Device().GetForUpdateByClientID(ctx, "other-user-id", clientID)
+	if err == nil {
+		t.Error("expected error for device of another user")
+	}
+}
+
 func TestDeviceRepository_Update(t *testing.T) {
 	pgDB, err := test.NewPGDB()
 	if err != nil {
@@ -0,0 +1,304 @@
+package postgres
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+)
+
+// encryptedPrefix marks encrypted column values. Values without
+// the prefix were stored before encryption was enabled.
+const encryptedPrefix = "enc:"
+
+// Secret stores a versioned secret key to encrypt PII columns.
+type Secret struct {
+	Version int
+	Key     string
+}
+
+// ParseSecrets parses a comma separated list of versioned secret
+// keys in the format `version:key`.
+func ParseSecrets(s string) ([]Secret, error) {
+	var secrets []Secret
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		parts := strings.SplitN(v, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("secret must be in the format version:key")
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret version %s: %w", parts[0], err)
+		}
+
+		secrets = append(secrets, Secret{Version: version, Key: parts[1]})
+	}
+
+	return secrets, nil
+}
+
+// fieldCipher encrypts PII columns with AES-GCM using versioned secret
+// keys. Lookups are made against blind indexes, keyed hashes of the
+// plaintext value, as encrypted values are not deterministic.
+type fieldCipher struct {
+	secrets  []Secret
+	indexKey []byte
+}
+
+// enabled reports whether columns are encrypted.
+func (c *fieldCipher) enabled() bool {
+	return len(c.secrets) > 0
+}
+
+func (c *fieldCipher) latestSecret() (Secret, error) {
+	var secret Secret
+	for _, s := range c.secrets {
+		if s.Version >= secret.Version {
+			secret = s
+		}
+	}
+
+	if secret.Key == "" {
+		return secret, fmt.Errorf("no secret key")
+	}
+
+	return secret, nil
+}
+
+func (c *fieldCipher) secretByVersion(version int) (Secret, error) {
+	for _, s := range c.secrets {
+		if s.Version == version && s.Key != "" {
+			return s, nil
+		}
+	}
+
+	return Secret{}, fmt.Errorf("no secret key found for version %v", version)
+}
+
+// encrypt encrypts a string using the most recent versioned secret key
+// and returns the value as a base64 encoded string with a versioning
+// prefix. Blank values are stored as is.
+func (c *fieldCipher) encrypt(s string) (string, error) {
+	if s == "" || !c.enabled() {
+		return s, nil
+	}
+
+	secret, err := c.latestSecret()
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("failed to create nonce: %w", err)
+	}
+
+	ciphertext := aead.Seal(nonce, nonce, []byte(s), nil)
+	return fmt.Sprintf("%s%v:%s",
+		encryptedPrefix,
+		secret.Version,
+		base64.StdEncoding.EncodeToString(ciphertext),
+	), nil
+}
+
+// decrypt decrypts an encrypted string using a versioned secret.
+// Values stored before encryption was enabled are returned as is.
+func (c *fieldCipher) decrypt(s string) (string, error) {
+	if !strings.HasPrefix(s, encryptedPrefix) {
+		return s, nil
+	}
+
+	version, err := encryptedVersion(s)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := c.secretByVersion(version)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newAEAD(secret)
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(s, encryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("cannot decode base64 encoded value: %w", err)
+	}
+	if len(decoded) < aead.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+
+	plaintext, err := aead.Open(nil, decoded[:aead.NonceSize()], decoded[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// isCurrent reports whether a value is stored as it would be encrypted
+// now, i.e. encrypted with the most recent secret key if encryption
+// is enabled.
+func (c *fieldCipher) isCurrent(s string) bool {
+	if s == "" {
+		return true
+	}
+	if !c.enabled() {
+		return !strings.HasPrefix(s, encryptedPrefix)
+	}
+	if !strings.HasPrefix(s, encryptedPrefix) {
+		return false
+	}
+
+	secret, err := c.latestSecret()
+	if err != nil {
+		return false
+	}
+	version, err := encryptedVersion(s)
+	return err == nil && version == secret.Version
+}
+
+// blindIndex returns a keyed hash of a value for lookups. It is null
+// if encryption is disabled or the value is blank.
+func (c *fieldCipher) blindIndex(s string) sql.NullString {
+	if s == "" || !c.enabled() {
+		return sql.NullString{}
+	}
+
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(s))
+	return sql.NullString{
+		String: hex.EncodeToString(mac.Sum(nil)),
+		Valid:  true,
+	}
+}
+
+// encryptedUser holds the stored values of a User's PII columns.
+type encryptedUser struct {
+	phone          sql.NullString
+	email          sql.NullString
+	tfaSecret      string
+	phoneIndex     sql.NullString
+	emailIndex     sql.NullString
+	emailCanonical sql.NullString
+}
+
+// encryptUser returns the stored values of a User's PII columns. With
+// encryption enabled, the canonical email is stored as a blind index
+// in place of plaintext.
+func (c *fieldCipher) encryptUser(user *auth.User) (*encryptedUser, error) {
+	var (
+		e   encryptedUser
+		err error
+	)
+
+	e.phone = user.Phone
+	if e.phone.String, err = c.encrypt(user.Phone.String); err != nil {
+		return nil, fmt.Errorf("failed to encrypt phone: %w", err)
+	}
+	e.email = user.Email
+	if e.email.String, err = c.encrypt(user.Email.String); err != nil {
+		return nil, fmt.Errorf("failed to encrypt email: %w", err)
+	}
+	if e.tfaSecret, err = c.encrypt(user.TFASecret); err != nil {
+		return nil, fmt.Errorf("failed to encrypt TFA secret: %w", err)
+	}
+
+	if !c.enabled() {
+		e.emailCanonical = canonicalEmail(user)
+		return &e, nil
+	}
+
+	if user.Phone.Valid {
+		e.phoneIndex = c.blindIndex(user.Phone.String)
+	}
+	if canonical := canonicalEmail(user); canonical.Valid {
+		e.emailIndex = c.blindIndex(canonical.String)
+	}
+
+	return &e, nil
+}
+
+// decryptUser decrypts the PII columns of a User read from storage.
+func (c *fieldCipher) decryptUser(user *auth.User) error {
+	var err error
+	if user.Phone.String, err = c.decrypt(user.Phone.String); err != nil {
+		return fmt.Errorf("failed to decrypt phone: %w", err)
+	}
+	if user.Email.String, err = c.decrypt(user.Email.String); err != nil {
+		return fmt.Errorf("failed to decrypt email: %w", err)
+	}
+	if user.TFASecret, err = c.decrypt(user.TFASecret); err != nil {
+		return fmt.Errorf("failed to decrypt TFA secret: %w", err)
+	}
+	return nil
+}
+
+func newAEAD(secret Secret) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(secret.Key))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher block: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return aead, nil
+}
+
+func encryptedVersion(s string) (int, error) {
+	v := strings.SplitN(strings.TrimPrefix(s, encryptedPrefix), ":", 2)[0]
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine secret version: %w", err)
+	}
+	return version, nil
+}
+
+// phoneLookup returns the arguments to look up a User by phone.
+func (c *fieldCipher) phoneLookup(phone string) []interface{} {
+	phone = contactchecker.NormalizePhone(phone)
+	return []interface{}{phone, c.blindIndex(phone)}
+}
+
+// emailLookup returns the arguments to look up a User by email.
+func (c *fieldCipher) emailLookup(email string) []interface{} {
+	canonical := contactchecker.CanonicalEmail(email)
+	return []interface{}{
+		canonical,
+		strings.ToLower(strings.TrimSpace(email)),
+		c.blindIndex(canonical),
+	}
+}
@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFieldCipher_EncryptDecrypt(t *testing.T) {
+	c := fieldCipher{
+		secrets:  []Secret{{Version: 1, Key: "secret-key"}},
+		indexKey: []byte("index-key"),
+	}
+
+	encrypted, err := c.encrypt("+6594867353")
+	if err != nil {
+		t.Fatal("failed to encrypt value:", err)
+	}
+	if !strings.HasPrefix(encrypted, "enc:1:") {
+		t.Errorf("incorrect encrypted value prefix: %s", encrypted)
+	}
+	if !c.isCurrent(encrypted) {
+		t.Error("encrypted value should be current")
+	}
+
+	decrypted, err := c.decrypt(encrypted)
+	if err != nil {
+		t.Fatal("failed to decrypt value:", err)
+	}
+	if decrypted != "+6594867353" {
+		t.Errorf("incorrect decrypted value, want +6594867353 got %s", decrypted)
+	}
+
+	plaintext, err := c.decrypt("jane@example.com")
+	if err != nil {
+		t.Fatal("failed to decrypt plaintext value:", err)
+	}
+	if plaintext != "jane@example.com" {
+		t.Errorf("plaintext value changed: %s", plaintext)
+	}
+	if c.isCurrent("jane@example.com") {
+		t.Error("plaintext value should not be current")
+	}
+
+	if c.blindIndex("+6594867353") != c.blindIndex("+6594867353") {
+		t.Error("blind index should be deterministic")
+	}
+	if c.blindIndex("+6594867353") == c.blindIndex("+6591234567") {
+		t.Error("blind index should differ between values")
+	}
+
+	// Values encrypted with a rotated key remain readable
+	// until they are migrated.
+	rotated := fieldCipher{
+		secrets:  []Secret{{Version: 2, Key: "new-secret-key"}, {Version: 1, Key: "secret-key"}},
+		indexKey: []byte("index-key"),
+	}
+	if rotated.isCurrent(encrypted) {
+		t.Error("value encrypted with a retired key should not be current")
+	}
+	decrypted, err = rotated.decrypt(encrypted)
+	if err != nil {
+		t.Fatal("failed to decrypt value with retired key:", err)
+	}
+	if decrypted != "+6594867353" {
+		t.Errorf("incorrect decrypted value, want +6594867353 got %s", decrypted)
+	}
+	if rotated.blindIndex("+6594867353") != c.blindIndex("+6594867353") {
+		t.Error("blind index should not change with key rotation")
+	}
+
+	disabled := fieldCipher{}
+	if _, err = disabled.decrypt(encrypted); err == nil {
+		t.Error("expected error decrypting without a key, got nil")
+	}
+	if value, _ := disabled.encrypt("+6594867353"); value != "+6594867353" {
+		t.Errorf("value encrypted without a key: %s", value)
+	}
+}
+
+func TestParseSecrets(t *testing.T) {
+	tt := []struct {
+		name     string
+		value    string
+		secrets  []Secret
+		hasError bool
+	}{
+		{
+			name:  "Multiple secrets",
+			value: "1:first-key, 2:second:key",
+			secrets: []Secret{
+				{Version: 1, Key: "first-key"},
+				{Version: 2, Key: "second:key"},
+			},
+		},
+		{
+			name:  "No secrets",
+			value: "",
+		},
+		{
+			name:     "Missing version",
+			value:    "first-key",
+			hasError: true,
+		},
+		{
+			name:     "Invalid version",
+			value:    "one:first-key",
+			hasError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			secrets, err := ParseSecrets(tc.value)
+			if tc.hasError && err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !tc.hasError && err != nil {
+				t.Fatal("expected nil error, got:", err)
+			}
+			if !cmp.Equal(secrets, tc.secrets) {
+				t.Error(cmp.Diff(secrets, tc.secrets))
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// ExternalAccountRepository is an implementation of auth.ExternalAccountRepository.
+type ExternalAccountRepository struct {
+	client *Client
+}
+
+// ByExternalID retrieves an ExternalAccount by the external user's ID.
+func (r *ExternalAccountRepository) ByExternalID(ctx context.Context, externalID string) (*auth.ExternalAccount, error) {
+	account := auth.ExternalAccount{}
+	row := r.client.queryRowContext(ctx, r.client.externalAccountQ["byExternalID"], externalID)
+	err := row.Scan(&account.ExternalID, &account.UserID, &account.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+// Create links an external user to a User.
+func (r *ExternalAccountRepository) Create(ctx context.Context, account *auth.ExternalAccount) error {
+	row := r.client.queryRowContext(
+		ctx,
+		r.client.externalAccountQ["insert"],
+		account.ExternalID,
+		account.UserID,
+	)
+	return row.Scan(&account.CreatedAt)
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestExternalAccountRepository_Create(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	_, err = c.ExternalAccount().ByExternalID(ctx, "42")
+	if err != sql.ErrNoRows {
+		t.Errorf("incorrect error, want %v got %v", sql.ErrNoRows, err)
+	}
+
+	account := auth.ExternalAccount{
+		ExternalID: "42",
+		UserID:     user.ID,
+	}
+	if err = c.ExternalAccount().Create(ctx, &account); err != nil {
+		t.Fatal("failed to create external account:", err)
+	}
+
+	linked, err := c.ExternalAccount().ByExternalID(ctx, "42")
+	if err != nil {
+		t.Fatal("failed to retrieve external account:", err)
+	}
+	if linked.UserID != user.ID {
+		t.Errorf("incorrect user ID, want %s got %s", user.ID, linked.UserID)
+	}
+
+	duplicate := auth.ExternalAccount{
+		ExternalID: "43",
+		UserID:     user.ID,
+	}
+	if err = c.ExternalAccount().Create(ctx, &duplicate); err == nil {
+		t.Error("expected error linking a user twice")
+	}
+}
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// LoginDigestRepository is an implementation of auth.LoginDigestRepository.
+type LoginDigestRepository struct {
+	client *Client
+}
+
+// ByUserID retrieves a LoginDigestSubscription for a User.
+func (r *LoginDigestRepository) ByUserID(ctx context.Context, userID string) (*auth.LoginDigestSubscription, error) {
+	sub := auth.LoginDigestSubscription{}
+	row := r.client.queryRowContext(ctx, r.client.loginDigestQ["byUserID"], userID)
+	err := row.Scan(&sub.UserID, &sub.LastSentAt, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+// Due retrieves subscriptions last sent before a given time,
+// oldest first.
+func (r *LoginDigestRepository) Due(ctx context.Context, before time.Time, limit int) ([]*auth.LoginDigestSubscription, error) {
+	rows, err := r.client.queryContext(ctx, r.client.loginDigestQ["due"], before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := make([]*auth.LoginDigestSubscription, 0)
+	for rows.Next() {
+		sub := auth.LoginDigestSubscription{}
+		err := rows.Scan(&sub.UserID, &sub.LastSentAt, &sub.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, &sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+// Create persists a new LoginDigestSubscription to storage.
+func (r *LoginDigestRepository) Create(ctx context.Context, sub *auth.LoginDigestSubscription) error {
+	row := r.client.queryRowContext(ctx, r.client.loginDigestQ["insert"], sub.UserID)
+	return row.Scan(&sub.LastSentAt, &sub.CreatedAt)
+}
+
+// MarkSent updates the time a digest was last sent to a User.
+func (r *LoginDigestRepository) MarkSent(ctx context.Context, userID string, sentAt time.Time) error {
+	_, err := r.client.execContext(ctx, r.client.loginDigestQ["markSent"], userID, sentAt)
+	if err != nil {
+		return fmt.Errorf("failed to execute update: %w", err)
+	}
+
+	return nil
+}
+
+// Remove removes a User's LoginDigestSubscription from storage.
+func (r *LoginDigestRepository) Remove(ctx context.Context, userID string) error {
+	res, err := r.client.execContext(ctx, r.client.loginDigestQ["delete"], userID)
+	if err != nil {
+		return fmt.Errorf("failed to execute delete: %w", err)
+	}
+
+	removedRows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if removedRows == 0 {
+		return auth.ErrNotFound("subscription does not exist")
+	}
+
+	return nil
+}
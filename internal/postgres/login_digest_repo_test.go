@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestLoginDigestRepository_Due(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	sub := auth.LoginDigestSubscription{UserID: user.ID}
+	if err = c.LoginDigest().Create(ctx, &sub); err != nil {
+		t.Fatal("failed to create subscription:", err)
+	}
+
+	due, err := c.LoginDigest().Due(ctx, time.Now().Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal("failed to retrieve due subscriptions:", err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("incorrect due subscription count, want 1 got %v", len(due))
+	}
+
+	if err = c.LoginDigest().MarkSent(ctx, user.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("failed to mark subscription sent:", err)
+	}
+
+	due, err = c.LoginDigest().Due(ctx, time.Now().Add(time.Minute), 10)
+	if err != nil {
+		t.Fatal("failed to retrieve due subscriptions:", err)
+	}
+	if len(due) != 0 {
+		t.Errorf("incorrect due subscription count, want 0 got %v", len(due))
+	}
+
+	if err = c.LoginDigest().Remove(ctx, user.ID); err != nil {
+		t.Fatal("failed to remove subscription:", err)
+	}
+}
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"time"
 
@@ -19,7 +20,8 @@ func (r *LoginHistoryRepository) ByTokenID(ctx context.Context, tokenID string)
 	row := r.client.queryRowContext(ctx, r.client.loginHistoryQ["byTokenID"], tokenID)
 	err := row.Scan(
 		&login.UserID, &login.TokenID, &login.IsRevoked, &login.ExpiresAt,
-		&login.CreatedAt, &login.UpdatedAt,
+		&login.CreatedAt, &login.UpdatedAt, &login.IPAddress, &login.Country,
+		&login.City,
 	)
 	if err != nil {
 		return nil, err
@@ -29,8 +31,9 @@ func (r *LoginHistoryRepository) ByTokenID(ctx context.Context, tokenID string)
 }
 
 // ByUserID retrieves all LoginHistory records associated with a User.
+// Outside of a transaction it may be served by a read replica.
 func (r *LoginHistoryRepository) ByUserID(ctx context.Context, userID string, limit, offset int) ([]*auth.LoginHistory, error) {
-	rows, err := r.client.queryContext(
+	rows, err := r.client.readContext(
 		ctx,
 		r.client.loginHistoryQ["byUserID"],
 		userID,
@@ -47,7 +50,47 @@ func (r *LoginHistoryRepository) ByUserID(ctx context.Context, userID string, li
 		login := auth.LoginHistory{}
 		err := rows.Scan(
 			&login.UserID, &login.TokenID, &login.IsRevoked, &login.ExpiresAt,
-			&login.CreatedAt, &login.UpdatedAt,
+			&login.CreatedAt, &login.UpdatedAt, &login.IPAddress, &login.Country,
+			&login.City,
+		)
+		if err != nil {
+			return nil, err
+		}
+		logins = append(logins, &login)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return logins, nil
+}
+
+// List retrieves a page of LoginHistory records associated with a User
+// matching a filter, ordered from newest to oldest. Outside of a transaction
+// it may be served by a read replica.
+func (r *LoginHistoryRepository) List(ctx context.Context, userID string, filter *auth.LoginHistoryFilter) ([]*auth.LoginHistory, error) {
+	rows, err := r.client.readContext(
+		ctx,
+		r.client.loginHistoryQ["list"],
+		userID,
+		filter.Cursor,
+		sql.NullTime{Time: filter.From, Valid: !filter.From.IsZero()},
+		sql.NullTime{Time: filter.To, Valid: !filter.To.IsZero()},
+		string(filter.Status),
+		filter.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logins := make([]*auth.LoginHistory, 0)
+	for rows.Next() {
+		login := auth.LoginHistory{}
+		err := rows.Scan(
+			&login.UserID, &login.TokenID, &login.IsRevoked, &login.ExpiresAt,
+			&login.CreatedAt, &login.UpdatedAt, &login.IPAddress, &login.Country,
+			&login.City,
 		)
 		if err != nil {
 			return nil, err
@@ -70,6 +113,9 @@ func (r *LoginHistoryRepository) Create(ctx context.Context, login *auth.LoginHi
 		login.TokenID,
 		login.IsRevoked,
 		login.ExpiresAt,
+		login.IPAddress,
+		login.Country,
+		login.City,
 	)
 	return row.Scan(
 		&login.CreatedAt,
@@ -109,7 +155,8 @@ func (r *LoginHistoryRepository) GetForUpdate(ctx context.Context, tokenID strin
 	row := r.client.queryRowContext(ctx, r.client.loginHistoryQ["forUpdate"], tokenID)
 	err := row.Scan(
 		&login.UserID, &login.TokenID, &login.IsRevoked, &login.ExpiresAt,
-		&login.CreatedAt, &login.UpdatedAt,
+		&login.CreatedAt, &login.UpdatedAt, &login.IPAddress, &login.Country,
+		&login.City,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve record for update: %w", err)
@@ -117,3 +164,25 @@ func (r *LoginHistoryRepository) GetForUpdate(ctx context.Context, tokenID strin
 
 	return &login, nil
 }
+
+// CountActive returns the number of LoginHistory records which are
+// neither revoked nor expired. It may be served by a read replica.
+func (r *LoginHistoryRepository) CountActive(ctx context.Context) (int64, error) {
+	var count int64
+	row := r.client.readRowContext(ctx, r.client.loginHistoryQ["countActive"])
+	if err := row.Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// CountActiveByUserID returns the number of a User's LoginHistory
+// records which are neither revoked nor expired.
+func (r *LoginHistoryRepository) CountActiveByUserID(ctx context.Context, userID string) (int64, error) {
+	var count int64
+	row := r.client.queryRowContext(ctx, r.client.loginHistoryQ["countActiveByUserID"], userID)
+	if err := row.Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
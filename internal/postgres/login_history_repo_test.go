@@ -188,6 +188,119 @@ func TestLoginHistoryRepository_ByUserID(t *testing.T) {
 	}
 }
 
+func TestLoginHistoryRepository_List(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	err = c.User().Create(ctx, &user)
+	if err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	// 3 revoked, 2 expired and 5 active logins.
+	tokenIDs := make([]string, 10)
+	for i := range tokenIDs {
+		tokenID, err := ulid.New(ulid.Now(), c.entropy)
+		if err != nil {
+			t.Fatal("failed to generate token ID:", err)
+		}
+		tokenIDs[i] = tokenID.String()
+
+		login := auth.LoginHistory{
+			UserID:    user.ID,
+			TokenID:   tokenIDs[i],
+			IsRevoked: i < 3,
+			ExpiresAt: time.Now().Add(time.Minute * 30),
+		}
+		if i == 3 || i == 4 {
+			login.ExpiresAt = time.Now().Add(-time.Minute)
+		}
+		err = c.LoginHistory().Create(ctx, &login)
+		if err != nil {
+			t.Fatal("failed to create loginhistory:", err)
+		}
+	}
+
+	tt := []struct {
+		name       string
+		filter     auth.LoginHistoryFilter
+		resultSize int
+		firstID    string
+	}{
+		{
+			name:       "First page",
+			filter:     auth.LoginHistoryFilter{Limit: 4},
+			resultSize: 4,
+			firstID:    tokenIDs[9],
+		},
+		{
+			name:       "Page after cursor",
+			filter:     auth.LoginHistoryFilter{Cursor: tokenIDs[6], Limit: 10},
+			resultSize: 6,
+			firstID:    tokenIDs[5],
+		},
+		{
+			name:       "Revoked logins",
+			filter:     auth.LoginHistoryFilter{Status: auth.LoginRevoked, Limit: 10},
+			resultSize: 3,
+			firstID:    tokenIDs[2],
+		},
+		{
+			name:       "Active logins",
+			filter:     auth.LoginHistoryFilter{Status: auth.LoginActive, Limit: 10},
+			resultSize: 5,
+			firstID:    tokenIDs[9],
+		},
+		{
+			name:       "Logins after range",
+			filter:     auth.LoginHistoryFilter{From: time.Now().Add(time.Hour), Limit: 10},
+			resultSize: 0,
+		},
+		{
+			name: "Logins within range",
+			filter: auth.LoginHistoryFilter{
+				From:  time.Now().Add(-time.Hour),
+				To:    time.Now().Add(time.Hour),
+				Limit: 10,
+			},
+			resultSize: 10,
+			firstID:    tokenIDs[9],
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			logins, err := c.LoginHistory().List(ctx, user.ID, &tc.filter)
+			if err != nil {
+				t.Fatal("failed to retrieve loginhistory:", err)
+			}
+
+			if len(logins) != tc.resultSize {
+				t.Fatalf("incorrect number of logins: want %v got %v",
+					tc.resultSize, len(logins))
+			}
+			if len(logins) > 0 && logins[0].TokenID != tc.firstID {
+				t.Errorf("incorrect first login: want %v got %v",
+					tc.firstID, logins[0].TokenID)
+			}
+		})
+	}
+}
+
 func TestLoginHistoryRepository_Update(t *testing.T) {
 	pgDB, err := test.NewPGDB()
 	if err != nil {
@@ -259,3 +372,51 @@ func TestLoginHistoryRepository_Update(t *testing.T) {
 			login.TokenID, updatedLogin.TokenID)
 	}
 }
+
+func TestLoginHistoryRepository_CountActive(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	logins := []auth.LoginHistory{
+		{ExpiresAt: time.Now().Add(time.Minute * 30)},
+		{ExpiresAt: time.Now().Add(time.Minute * 30), IsRevoked: true},
+		{ExpiresAt: time.Now().Add(-time.Minute)},
+	}
+	for _, login := range logins {
+		tokenID, err := ulid.New(ulid.Now(), c.entropy)
+		if err != nil {
+			t.Fatal("failed to generate token ID:", err)
+		}
+		login.UserID = user.ID
+		login.TokenID = tokenID.String()
+		if err = c.LoginHistory().Create(ctx, &login); err != nil {
+			t.Fatal("failed to create LoginHistory:", err)
+		}
+	}
+
+	count, err := c.LoginHistory().CountActive(ctx)
+	if err != nil {
+		t.Fatal("failed to count active sessions:", err)
+	}
+	if count != 1 {
+		t.Errorf("incorrect active session count, want 1 got %v", count)
+	}
+}
@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oklog/ulid/v2"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// MembershipRepository is an implementation of auth.MembershipRepository.
+type MembershipRepository struct {
+	client *Client
+}
+
+// Get retrieves a User's Membership in an Organization.
+func (r *MembershipRepository) Get(ctx context.Context, orgID, userID string) (*auth.Membership, error) {
+	m := auth.Membership{}
+	row := r.client.queryRowContext(ctx, r.client.membershipQ["get"], orgID, userID)
+	err := row.Scan(&m.OrganizationID, &m.UserID, &m.Role, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// ByUserID retrieves all Memberships of a User.
+func (r *MembershipRepository) ByUserID(ctx context.Context, userID string) ([]*auth.Membership, error) {
+	rows, err := r.client.queryContext(ctx, r.client.membershipQ["byUserID"], userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanMemberships(rows)
+}
+
+// ByOrganizationID retrieves all Memberships of an Organization.
+func (r *MembershipRepository) ByOrganizationID(ctx context.Context, orgID string) ([]*auth.Membership, error) {
+	rows, err := r.client.queryContext(ctx, r.client.membershipQ["byOrganizationID"], orgID)
+	if err != nil {
+		return nil, err
+	}
+	return scanMemberships(rows)
+}
+
+// Create persists a new Membership to storage.
+func (r *MembershipRepository) Create(ctx context.Context, m *auth.Membership) error {
+	row := r.client.queryRowContext(
+		ctx,
+		r.client.membershipQ["insert"],
+		m.OrganizationID,
+		m.UserID,
+		m.Role,
+	)
+	return row.Scan(&m.CreatedAt)
+}
+
+// Remove removes a User from an Organization.
+func (r *MembershipRepository) Remove(ctx context.Context, orgID, userID string) error {
+	res, err := r.client.execContext(ctx, r.client.membershipQ["delete"], orgID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to execute delete: %w", err)
+	}
+
+	removedRows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if removedRows == 0 {
+		return auth.ErrNotFound("membership does not exist")
+	}
+
+	return nil
+}
+
+// CreateInvitation persists a new Invitation to storage.
+func (r *MembershipRepository) CreateInvitation(ctx context.Context, inv *auth.Invitation) error {
+	invitationID, err := ulid.New(ulid.Now(), r.client.entropy)
+	if err != nil {
+		return fmt.Errorf("cannot generate unique invitation ID: %w", err)
+	}
+
+	inv.ID = invitationID.String()
+	row := r.client.queryRowContext(
+		ctx,
+		r.client.membershipQ["insertInvitation"],
+		inv.ID,
+		inv.OrganizationID,
+		inv.Email,
+		inv.Role,
+		inv.CodeHash,
+		inv.InvitedBy,
+		inv.ExpiresAt,
+	)
+	return row.Scan(&inv.CreatedAt)
+}
+
+// InvitationByID retrieves an Invitation with a matching ID.
+func (r *MembershipRepository) InvitationByID(ctx context.Context, invitationID string) (*auth.Invitation, error) {
+	inv := auth.Invitation{}
+	row := r.client.queryRowContext(ctx, r.client.membershipQ["invitationByID"], invitationID)
+	err := row.Scan(
+		&inv.ID, &inv.OrganizationID, &inv.Email, &inv.Role, &inv.CodeHash,
+		&inv.InvitedBy, &inv.ExpiresAt, &inv.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+// RemoveInvitation removes an Invitation from storage.
+func (r *MembershipRepository) RemoveInvitation(ctx context.Context, invitationID string) error {
+	_, err := r.client.execContext(ctx, r.client.membershipQ["deleteInvitation"], invitationID)
+	if err != nil {
+		return fmt.Errorf("failed to execute delete: %w", err)
+	}
+
+	return nil
+}
+
+func scanMemberships(rows *rows) ([]*auth.Membership, error) {
+	defer rows.Close()
+
+	memberships := make([]*auth.Membership, 0)
+	for rows.Next() {
+		m := auth.Membership{}
+		err := rows.Scan(&m.OrganizationID, &m.UserID, &m.Role, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
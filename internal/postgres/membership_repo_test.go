@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestMembershipRepository_Membership(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	org := auth.Organization{Name: "Acme"}
+	if err = c.Organization().Create(ctx, &org); err != nil {
+		t.Fatal("failed to create organization:", err)
+	}
+
+	m := auth.Membership{
+		OrganizationID: org.ID,
+		UserID:         user.ID,
+		Role:           auth.RoleOwner,
+	}
+	if err = c.Membership().Create(ctx, &m); err != nil {
+		t.Fatal("failed to create membership:", err)
+	}
+
+	mB, err := c.Membership().Get(ctx, org.ID, user.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve membership:", err)
+	}
+	if mB.Role != auth.RoleOwner {
+		t.Errorf("incorrect membership role, want %s got %s", auth.RoleOwner, mB.Role)
+	}
+
+	byUser, err := c.Membership().ByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve memberships:", err)
+	}
+	if len(byUser) != 1 {
+		t.Errorf("incorrect membership count, want 1 got %v", len(byUser))
+	}
+
+	byOrg, err := c.Membership().ByOrganizationID(ctx, org.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve memberships:", err)
+	}
+	if len(byOrg) != 1 {
+		t.Errorf("incorrect membership count, want 1 got %v", len(byOrg))
+	}
+
+	if err = c.Membership().Remove(ctx, org.ID, user.ID); err != nil {
+		t.Fatal("failed to remove membership:", err)
+	}
+
+	_, err = c.Membership().Get(ctx, org.ID, user.ID)
+	if err != sql.ErrNoRows {
+		t.Errorf("incorrect error, want %v got %v", sql.ErrNoRows, err)
+	}
+}
+
+func TestMembershipRepository_Invitation(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	org := auth.Organization{Name: "Acme"}
+	if err = c.Organization().Create(ctx, &org); err != nil {
+		t.Fatal("failed to create organization:", err)
+	}
+
+	inv := auth.Invitation{
+		OrganizationID: org.ID,
+		Email:          "john@example.com",
+		Role:           auth.RoleMember,
+		CodeHash:       "code-hash",
+		InvitedBy:      user.ID,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	}
+	if err = c.Membership().CreateInvitation(ctx, &inv); err != nil {
+		t.Fatal("failed to create invitation:", err)
+	}
+
+	invB, err := c.Membership().InvitationByID(ctx, inv.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve invitation:", err)
+	}
+	if invB.Email != inv.Email {
+		t.Errorf("incorrect invitation email, want %s got %s", inv.Email, invB.Email)
+	}
+
+	if err = c.Membership().RemoveInvitation(ctx, inv.ID); err != nil {
+		t.Fatal("failed to remove invitation:", err)
+	}
+
+	_, err = c.Membership().InvitationByID(ctx, inv.ID)
+	if err != sql.ErrNoRows {
+		t.Errorf("incorrect error, want %v got %v", sql.ErrNoRows, err)
+	}
+}
@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/oklog/ulid/v2"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// maxDeliveryDetail is the maximum length of a MessageDelivery's detail.
+const maxDeliveryDetail = 255
+
+// MessageDeliveryRepository is an implementation of auth.MessageDeliveryRepository.
+type MessageDeliveryRepository struct {
+	client *Client
+}
+
+// ByID retrieves a MessageDelivery with a matching ID.
+func (r *MessageDeliveryRepository) ByID(ctx context.Context, id string) (*auth.MessageDelivery, error) {
+	d := auth.MessageDelivery{}
+	row := r.client.queryRowContext(ctx, r.client.messageDeliveryQ["byID"], id)
+	err := row.Scan(
+		&d.ID, &d.Type, &d.Delivery, &d.Address, &d.Status, &d.Detail,
+		&d.CreatedAt, &d.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+// ByAddress retrieves the most recent MessageDeliveries to an address,
+// newest first. Outside of a transaction it may be served by a read replica.
+func (r *MessageDeliveryRepository) ByAddress(ctx context.Context, address string, limit int) ([]*auth.MessageDelivery, error) {
+	rows, err := r.client.readContext(ctx, r.client.messageDeliveryQ["byAddress"], address, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*auth.MessageDelivery, 0)
+	for rows.Next() {
+		d := auth.MessageDelivery{}
+		err := rows.Scan(
+			&d.ID, &d.Type, &d.Delivery, &d.Address, &d.Status, &d.Detail,
+			&d.CreatedAt, &d.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Create persists a new MessageDelivery to storage.
+func (r *MessageDeliveryRepository) Create(ctx context.Context, d *auth.MessageDelivery) error {
+	id, err := ulid.New(ulid.Now(), r.client.entropy)
+	if err != nil {
+		return fmt.Errorf("failed to generate delivery ID: %w", err)
+	}
+
+	d.ID = id.String()
+	d.Detail = truncate(d.Detail, maxDeliveryDetail)
+	row := r.client.queryRowContext(
+		ctx,
+		r.client.messageDeliveryQ["insert"],
+		d.ID,
+		d.Type,
+		d.Delivery,
+		d.Address,
+		d.Status,
+		d.Detail,
+	)
+	return row.Scan(&d.CreatedAt, &d.UpdatedAt)
+}
+
+// UpdateStatus updates the status of a MessageDelivery if its current
+// status precedes it.
+func (r *MessageDeliveryRepository) UpdateStatus(ctx context.Context, id string, status auth.MessageDeliveryStatus, detail string) error {
+	var preceding []string
+	for _, s := range status.Preceding() {
+		preceding = append(preceding, string(s))
+	}
+
+	_, err := r.client.execContext(
+		ctx,
+		r.client.messageDeliveryQ["updateStatus"],
+		id,
+		status,
+		truncate(detail, maxDeliveryDetail),
+		time.Now(),
+		pq.Array(preceding),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery status: %w", err)
+	}
+	return nil
+}
+
+// truncate shortens a string to at most n bytes without splitting
+// a UTF-8 encoded character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
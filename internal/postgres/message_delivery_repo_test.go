@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestMessageDeliveryRepository_Create(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	delivery := auth.MessageDelivery{
+		Type:     auth.OTPLogin,
+		Delivery: auth.Email,
+		Address:  "jane@example.com",
+		Status:   auth.MessageQueued,
+		Detail:   strings.Repeat("x", 300),
+	}
+	if err = c.MessageDelivery().Create(ctx, &delivery); err != nil {
+		t.Fatal("failed to create delivery:", err)
+	}
+	if delivery.ID == "" || delivery.CreatedAt.IsZero() {
+		t.Error("MessageDelivery ID and CreatedAt not set")
+	}
+
+	fetched, err := c.MessageDelivery().ByID(ctx, delivery.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve delivery:", err)
+	}
+	if fetched.Status != auth.MessageQueued {
+		t.Errorf("incorrect status, want %s got %s", auth.MessageQueued, fetched.Status)
+	}
+	if len(fetched.Detail) != 255 {
+		t.Errorf("detail not truncated, got %v bytes", len(fetched.Detail))
+	}
+
+	deliveries, err := c.MessageDelivery().ByAddress(ctx, "jane@example.com", 10)
+	if err != nil {
+		t.Fatal("failed to retrieve deliveries:", err)
+	}
+	if len(deliveries) != 1 {
+		t.Errorf("incorrect delivery count, want 1 got %v", len(deliveries))
+	}
+}
+
+func TestMessageDeliveryRepository_UpdateStatus(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	delivery := auth.MessageDelivery{
+		Type:     auth.OTPLogin,
+		Delivery: auth.Phone,
+		Address:  "+15555555555",
+		Status:   auth.MessageQueued,
+	}
+	if err = c.MessageDelivery().Create(ctx, &delivery); err != nil {
+		t.Fatal("failed to create delivery:", err)
+	}
+
+	// Reports arriving out of order must not revert a final status.
+	updates := []struct {
+		status   auth.MessageDeliveryStatus
+		detail   string
+		expected auth.MessageDeliveryStatus
+	}{
+		{auth.MessageDelivered, "", auth.MessageDelivered},
+		{auth.MessageSent, "", auth.MessageDelivered},
+		{auth.MessageFailed, "twilio error 30003", auth.MessageDelivered},
+	}
+	for _, u := range updates {
+		err = c.MessageDelivery().UpdateStatus(ctx, delivery.ID, u.status, u.detail)
+		if err != nil {
+			t.Fatal("failed to update status:", err)
+		}
+
+		fetched, err := c.MessageDelivery().ByID(ctx, delivery.ID)
+		if err != nil {
+			t.Fatal("failed to retrieve delivery:", err)
+		}
+		if fetched.Status != u.expected {
+			t.Errorf("incorrect status after %s, want %s got %s", u.status, u.expected, fetched.Status)
+		}
+	}
+}
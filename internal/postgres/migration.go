@@ -0,0 +1,381 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+)
+
+// Migration is the result of a data migration.
+type Migration struct {
+	// Checked is the number of Users checked.
+	Checked int
+	// Updated is the number of Users updated.
+	Updated int
+	// Conflicts are the IDs of Users whose migrated value belongs to
+	// another User. Their values are left unchanged so the accounts
+	// may be merged manually.
+	Conflicts []string
+	// Invalid are the IDs of Users whose value cannot be migrated.
+	Invalid []string
+	// Canaries is the number of Canaries updated.
+	Canaries int
+}
+
+// columnMigration rewrites a unique column of auth_user with a value
+// derived from another column. Queries are keys of the User queries.
+type columnMigration struct {
+	// list selects a User's ID, source value and current value.
+	list string
+	// exists checks if a value belongs to another User.
+	exists string
+	// update sets a value unless it belongs to another User.
+	update string
+	// derive returns the migrated value of a source value.
+	derive func(source string) (string, error)
+}
+
+// MigratePhoneNumbers rewrites the stored phone numbers of all Users in
+// E.164. Phone numbers are normalized with the default region of the
+// contactchecker package. Encrypted phone numbers are normalized on
+// intake and cannot be migrated.
+func (c *Client) MigratePhoneNumbers(ctx context.Context, batchSize int, dryRun bool) (*Migration, error) {
+	if c.cipher.enabled() {
+		return nil, fmt.Errorf("phone numbers cannot be migrated with encryption enabled")
+	}
+	return c.migrateColumn(ctx, columnMigration{
+		list:   "listPhones",
+		exists: "phoneExists",
+		update: "updatePhone",
+		derive: contactchecker.ParsePhone,
+	}, batchSize, dryRun)
+}
+
+// MigrateCanonicalEmails stores the canonical form of all Users' email
+// addresses. It is required for Users stored before canonical addresses
+// were introduced and after alias matching of the contactchecker package
+// is changed. With encryption enabled, canonical addresses are stored as
+// blind indexes and rebuilt with MigrateEncryption instead. Canaries are
+// migrated alongside Users.
+func (c *Client) MigrateCanonicalEmails(ctx context.Context, batchSize int, dryRun bool) (*Migration, error) {
+	var (
+		result *Migration
+		err    error
+	)
+	if c.cipher.enabled() {
+		result, err = c.MigrateEncryption(ctx, batchSize, dryRun)
+	} else {
+		result, err = c.migrateColumn(ctx, columnMigration{
+			list:   "listEmails",
+			exists: "canonicalEmailExists",
+			update: "updateCanonicalEmail",
+			derive: func(email string) (string, error) {
+				return contactchecker.CanonicalEmail(email), nil
+			},
+		}, batchSize, dryRun)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result.Canaries, err = c.migrateCanaryEmails(ctx, dryRun)
+	return result, err
+}
+
+// migrateCanaryEmails stores the email identities of Canaries in their
+// canonical form. Canaries whose canonical form is already registered
+// are removed, as the registered Canary matches them.
+func (c *Client) migrateCanaryEmails(ctx context.Context, dryRun bool) (int, error) {
+	canaries, err := c.Canary().List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var updated int
+	for _, canary := range canaries {
+		canonical := canonicalIdentity(canary.Identity)
+		if canonical == canary.Identity {
+			continue
+		}
+		updated++
+		if dryRun {
+			continue
+		}
+
+		res, err := c.execContext(ctx, c.canaryQ["updateIdentity"], canary.Identity, canonical)
+		if err != nil {
+			return updated, err
+		}
+		updatedRows, err := res.RowsAffected()
+		if err != nil {
+			return updated, err
+		}
+		if updatedRows == 1 {
+			continue
+		}
+
+		_, err = c.execContext(ctx, c.canaryQ["delete"], canary.Identity)
+		if err != nil {
+			return updated, err
+		}
+	}
+
+	return updated, nil
+}
+
+// migrateColumn applies a column migration in batches ordered by User ID.
+// Conflicts are reported without changes if dryRun is set.
+func (c *Client) migrateColumn(ctx context.Context, m columnMigration, batchSize int, dryRun bool) (*Migration, error) {
+	var (
+		result  Migration
+		afterID string
+		// claimed holds values which would be set during a
+		// dry run to report conflicts between unmigrated Users.
+		claimed = make(map[string]bool)
+	)
+
+	for {
+		values, err := c.listColumn(ctx, m.list, afterID, batchSize)
+		if err != nil {
+			return &result, err
+		}
+		if len(values) == 0 {
+			return &result, nil
+		}
+
+		for _, v := range values {
+			afterID = v.userID
+			result.Checked++
+
+			derived, err := m.derive(v.source)
+			if err != nil {
+				result.Invalid = append(result.Invalid, v.userID)
+				continue
+			}
+			if derived == v.current {
+				continue
+			}
+
+			var updated bool
+			if dryRun {
+				updated, err = c.isAvailable(ctx, m.exists, v.userID, derived)
+				updated = updated && !claimed[derived]
+				claimed[derived] = true
+			} else {
+				updated, err = c.updateColumn(ctx, m.update, v.userID, derived)
+			}
+			if err != nil {
+				return &result, err
+			}
+			if !updated {
+				result.Conflicts = append(result.Conflicts, v.userID)
+				continue
+			}
+			result.Updated++
+		}
+	}
+}
+
+type columnValue struct {
+	userID  string
+	source  string
+	current string
+}
+
+func (c *Client) listColumn(ctx context.Context, q, afterID string, limit int) ([]columnValue, error) {
+	rows, err := c.queryContext(ctx, c.userQ[q], afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []columnValue
+	for rows.Next() {
+		var v columnValue
+		if err := rows.Scan(&v.userID, &v.source, &v.current); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// isAvailable returns true if a value does not belong to another User.
+func (c *Client) isAvailable(ctx context.Context, q, userID, value string) (bool, error) {
+	var exists bool
+	err := c.queryRowContext(ctx, c.userQ[q], value, userID).Scan(&exists)
+	return !exists, err
+}
+
+// updateColumn sets a User's value unless it belongs to another User.
+func (c *Client) updateColumn(ctx context.Context, q, userID, value string) (bool, error) {
+	res, err := c.execContext(ctx, c.userQ[q], userID, value, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+
+	updatedRows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return updatedRows == 1, nil
+}
+
+// MigrateEncryption encrypts the PII columns of all Users with the most
+// recent Secret and stores their blind indexes. It is required after
+// encryption is enabled and after a new Secret is introduced, before
+// older Secrets may be retired. Phone numbers and canonical emails
+// should be migrated before encryption is enabled. Blind indexes of
+// canonical emails are rebuilt after alias matching of the
+// contactchecker package is changed.
+func (c *Client) MigrateEncryption(ctx context.Context, batchSize int, dryRun bool) (*Migration, error) {
+	if !c.cipher.enabled() {
+		return nil, fmt.Errorf("no secret key configured")
+	}
+
+	var (
+		result  Migration
+		afterID string
+		// claimed holds blind indexes which would be set during a
+		// dry run to report conflicts between unmigrated Users.
+		claimed = make(map[string]bool)
+	)
+
+	for {
+		rows, err := c.listEncrypted(ctx, afterID, batchSize)
+		if err != nil {
+			return &result, err
+		}
+		if len(rows) == 0 {
+			return &result, nil
+		}
+
+		for _, row := range rows {
+			afterID = row.user.ID
+			result.Checked++
+
+			if err = c.cipher.decryptUser(&row.user); err != nil {
+				result.Invalid = append(result.Invalid, row.user.ID)
+				continue
+			}
+
+			stored, err := c.cipher.encryptUser(&row.user)
+			if err != nil {
+				return &result, err
+			}
+			if row.isCurrent(&c.cipher, stored) {
+				continue
+			}
+
+			var updated bool
+			if dryRun {
+				updated, err = c.isIndexAvailable(ctx, row.user.ID, stored)
+				for _, index := range []sql.NullString{stored.phoneIndex, stored.emailIndex} {
+					if index.Valid {
+						updated = updated && !claimed[index.String]
+						claimed[index.String] = true
+					}
+				}
+			} else {
+				updated, err = c.updateEncrypted(ctx, row.user.ID, stored)
+			}
+			if err != nil {
+				return &result, err
+			}
+			if !updated {
+				result.Conflicts = append(result.Conflicts, row.user.ID)
+				continue
+			}
+			result.Updated++
+		}
+	}
+}
+
+// encryptedRow holds the stored PII columns of a User.
+type encryptedRow struct {
+	user           auth.User
+	phone          sql.NullString
+	email          sql.NullString
+	tfaSecret      string
+	emailCanonical sql.NullString
+	phoneIndex     sql.NullString
+	emailIndex     sql.NullString
+}
+
+// isCurrent reports whether a row is stored with the most recent
+// Secret and blind indexes.
+func (row *encryptedRow) isCurrent(cipher *fieldCipher, stored *encryptedUser) bool {
+	return cipher.isCurrent(row.phone.String) &&
+		cipher.isCurrent(row.email.String) &&
+		cipher.isCurrent(row.tfaSecret) &&
+		row.emailCanonical == stored.emailCanonical &&
+		row.phoneIndex == stored.phoneIndex &&
+		row.emailIndex == stored.emailIndex
+}
+
+func (c *Client) listEncrypted(ctx context.Context, afterID string, limit int) ([]encryptedRow, error) {
+	rows, err := c.queryContext(ctx, c.userQ["listEncrypted"], afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []encryptedRow
+	for rows.Next() {
+		var v encryptedRow
+		err := rows.Scan(
+			&v.user.ID, &v.phone, &v.email, &v.tfaSecret,
+			&v.emailCanonical, &v.phoneIndex, &v.emailIndex,
+		)
+		if err != nil {
+			return nil, err
+		}
+		v.user.Phone = v.phone
+		v.user.Email = v.email
+		v.user.TFASecret = v.tfaSecret
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// isIndexAvailable returns true if a User's blind indexes do not
+// belong to another User.
+func (c *Client) isIndexAvailable(ctx context.Context, userID string, stored *encryptedUser) (bool, error) {
+	var exists bool
+	err := c.queryRowContext(ctx, c.userQ["indexExists"],
+		userID, stored.phoneIndex, stored.emailIndex,
+	).Scan(&exists)
+	return !exists, err
+}
+
+// updateEncrypted stores a User's PII columns unless their blind
+// indexes belong to another User.
+func (c *Client) updateEncrypted(ctx context.Context, userID string, stored *encryptedUser) (bool, error) {
+	res, err := c.execContext(ctx, c.userQ["updateEncrypted"],
+		userID, stored.phone, stored.email, stored.tfaSecret, stored.emailCanonical,
+		stored.phoneIndex, stored.emailIndex, time.Now().UTC(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	updatedRows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return updatedRows == 1, nil
+}
@@ -0,0 +1,279 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestClient_MigratePhoneNumbers(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+	ctx := context.Background()
+
+	// Phone numbers are inserted directly as they were
+	// stored before normalization.
+	users := []struct {
+		id    string
+		phone string
+	}{
+		{id: "01", phone: "+65 9486 7353"},
+		{id: "02", phone: "+6594867353"},
+		{id: "03", phone: "+1 (415) 555-2671"},
+		{id: "04", phone: "+65-9123-4567"},
+		{id: "05", phone: "+65 9123 4567"},
+		{id: "06", phone: "not-a-phone"},
+	}
+	for _, u := range users {
+		_, err = pgDB.DB.Exec(
+			"INSERT INTO auth_user (id, phone, password, tfa_secret) VALUES ($1, $2, '', '')",
+			u.id, u.phone,
+		)
+		if err != nil {
+			t.Fatal("failed to create user:", err)
+		}
+	}
+
+	want := &Migration{
+		Checked:   6,
+		Updated:   2,
+		Conflicts: []string{"01", "05"},
+		Invalid:   []string{"06"},
+	}
+
+	dryRun, err := c.MigratePhoneNumbers(ctx, 2, true)
+	if err != nil {
+		t.Fatal("failed dry run:", err)
+	}
+	if !cmp.Equal(dryRun, want) {
+		t.Error(cmp.Diff(dryRun, want))
+	}
+
+	user, err := c.User().ByIdentity(ctx, "ID", "03")
+	if err != nil {
+		t.Fatal("failed to retrieve user:", err)
+	}
+	if user.Phone.String != "+1 (415) 555-2671" {
+		t.Errorf("phone updated during dry run: %s", user.Phone.String)
+	}
+
+	result, err := c.MigratePhoneNumbers(ctx, 2, false)
+	if err != nil {
+		t.Fatal("failed to migrate phone numbers:", err)
+	}
+	if !cmp.Equal(result, want) {
+		t.Error(cmp.Diff(result, want))
+	}
+
+	phones := map[string]string{
+		"01": "+65 9486 7353",
+		"02": "+6594867353",
+		"03": "+14155552671",
+		"04": "+6591234567",
+		"05": "+65 9123 4567",
+	}
+	for id, phone := range phones {
+		user, err = c.User().ByIdentity(ctx, "ID", id)
+		if err != nil {
+			t.Fatal("failed to retrieve user:", err)
+		}
+		if user.Phone.String != phone {
+			t.Errorf("incorrect phone for user %s, want %s got %s", id, phone, user.Phone.String)
+		}
+	}
+}
+
+func TestClient_MigrateCanonicalEmails(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+	ctx := context.Background()
+
+	contactchecker.SetEmailAliases(true)
+	defer contactchecker.SetEmailAliases(false)
+
+	// Emails are inserted directly as they were stored
+	// before canonical addresses were introduced.
+	users := []struct {
+		id    string
+		email string
+	}{
+		{id: "01", email: "jane.doe@gmail.com"},
+		{id: "02", email: "janedoe+news@gmail.com"},
+		{id: "03", email: "john@example.com"},
+	}
+	for _, u := range users {
+		_, err = pgDB.DB.Exec(
+			"INSERT INTO auth_user (id, email, password, tfa_secret) VALUES ($1, $2, '', '')",
+			u.id, u.email,
+		)
+		if err != nil {
+			t.Fatal("failed to create user:", err)
+		}
+	}
+
+	for _, identity := range []string{"Decoy@Example.com", "decoy@example.com", "jane.decoy@gmail.com"} {
+		_, err = pgDB.DB.Exec("INSERT INTO canary (identity) VALUES ($1)", identity)
+		if err != nil {
+			t.Fatal("failed to create canary:", err)
+		}
+	}
+
+	user, err := c.User().ByIdentity(ctx, "Email", "John@Example.com")
+	if err != nil {
+		t.Fatal("failed to retrieve unmigrated user:", err)
+	}
+	if user.ID != "03" {
+		t.Errorf("incorrect unmigrated user, want 03 got %s", user.ID)
+	}
+
+	result, err := c.MigrateCanonicalEmails(ctx, 10, false)
+	if err != nil {
+		t.Fatal("failed to migrate emails:", err)
+	}
+
+	want := &Migration{
+		Checked:   3,
+		Updated:   2,
+		Conflicts: []string{"02"},
+		Canaries:  2,
+	}
+	if !cmp.Equal(result, want) {
+		t.Error(cmp.Diff(result, want))
+	}
+
+	canaries, err := c.Canary().List(ctx)
+	if err != nil {
+		t.Fatal("failed to list canaries:", err)
+	}
+	if len(canaries) != 2 {
+		t.Errorf("incorrect canary count, want 2 got %v", len(canaries))
+	}
+	if _, err = c.Canary().ByIdentity(ctx, "JaneDecoy+crm@gmail.com"); err != nil {
+		t.Error("failed to retrieve canary by alias:", err)
+	}
+
+	user, err = c.User().ByIdentity(ctx, "Email", "JaneDoe+alias@googlemail.com")
+	if err != nil {
+		t.Fatal("failed to retrieve user by alias:", err)
+	}
+	if user.ID != "01" {
+		t.Errorf("incorrect user for alias, want 01 got %s", user.ID)
+	}
+
+	result, err = c.MigrateCanonicalEmails(ctx, 10, false)
+	if err != nil {
+		t.Fatal("failed to repeat migration:", err)
+	}
+	if result.Updated != 0 {
+		t.Errorf("repeated migration updated %v users", result.Updated)
+	}
+	if result.Canaries != 0 {
+		t.Errorf("repeated migration updated %v canaries", result.Canaries)
+	}
+}
+
+func TestClient_MigrateEncryption(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+	ctx := context.Background()
+
+	for _, u := range []struct {
+		id    string
+		phone string
+		email string
+	}{
+		{id: "01", phone: "+6594867353", email: "jane@example.com"},
+		{id: "02", phone: "+14155552671", email: "john@example.com"},
+	} {
+		_, err = pgDB.DB.Exec(
+			"INSERT INTO auth_user (id, phone, email, email_canonical, password, tfa_secret) "+
+				"VALUES ($1, $2, $3, $3, '', 'tfa-secret')",
+			u.id, u.phone, u.email,
+		)
+		if err != nil {
+			t.Fatal("failed to create user:", err)
+		}
+	}
+
+	c.cipher = fieldCipher{
+		secrets:  []Secret{{Version: 1, Key: "secret-key"}},
+		indexKey: []byte("index-key"),
+	}
+
+	// Unmigrated users remain available while encryption is enabled.
+	user, err := c.User().ByIdentity(ctx, "Phone", "+6594867353")
+	if err != nil {
+		t.Fatal("failed to retrieve unmigrated user:", err)
+	}
+	if user.ID != "01" {
+		t.Errorf("incorrect unmigrated user, want 01 got %s", user.ID)
+	}
+
+	result, err := c.MigrateEncryption(ctx, 1, false)
+	if err != nil {
+		t.Fatal("failed to migrate encryption:", err)
+	}
+	if !cmp.Equal(result, &Migration{Checked: 2, Updated: 2}) {
+		t.Error(cmp.Diff(result, &Migration{Checked: 2, Updated: 2}))
+	}
+
+	var phone, email, tfaSecret string
+	err = pgDB.DB.QueryRow(
+		"SELECT phone, email, tfa_secret FROM auth_user WHERE id = '01'",
+	).Scan(&phone, &email, &tfaSecret)
+	if err != nil {
+		t.Fatal("failed to retrieve stored user:", err)
+	}
+	for _, v := range []string{phone, email, tfaSecret} {
+		if !strings.HasPrefix(v, "enc:1:") {
+			t.Errorf("value not encrypted: %s", v)
+		}
+	}
+
+	// Keys are rotated by introducing a new version.
+	c.cipher.secrets = append(c.cipher.secrets, Secret{Version: 2, Key: "new-secret-key"})
+	result, err = c.MigrateEncryption(ctx, 10, false)
+	if err != nil {
+		t.Fatal("failed to rotate encryption key:", err)
+	}
+	if result.Updated != 2 {
+		t.Errorf("incorrect rotated users, want 2 got %v", result.Updated)
+	}
+
+	c.cipher.secrets = c.cipher.secrets[1:]
+	user, err = c.User().ByIdentity(ctx, "Email", "John@Example.com")
+	if err != nil {
+		t.Fatal("failed to retrieve user by email:", err)
+	}
+	if user.ID != "02" || user.Phone.String != "+14155552671" || user.TFASecret != "tfa-secret" {
+		t.Errorf("incorrect decrypted user: %+v", user)
+	}
+
+	result, err = c.MigrateEncryption(ctx, 10, false)
+	if err != nil {
+		t.Fatal("failed to repeat migration:", err)
+	}
+	if result.Updated != 0 {
+		t.Errorf("repeated migration updated %v users", result.Updated)
+	}
+}
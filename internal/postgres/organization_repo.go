@@ -0,0 +1,39 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oklog/ulid/v2"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// OrganizationRepository is an implementation of auth.OrganizationRepository.
+type OrganizationRepository struct {
+	client *Client
+}
+
+// ByID retrieves an Organization with a matching ID.
+func (r *OrganizationRepository) ByID(ctx context.Context, orgID string) (*auth.Organization, error) {
+	org := auth.Organization{}
+	row := r.client.queryRowContext(ctx, r.client.organizationQ["byID"], orgID)
+	err := row.Scan(&org.ID, &org.Name, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &org, nil
+}
+
+// Create persists a new Organization to storage.
+func (r *OrganizationRepository) Create(ctx context.Context, org *auth.Organization) error {
+	orgID, err := ulid.New(ulid.Now(), r.client.entropy)
+	if err != nil {
+		return fmt.Errorf("cannot generate unique organization ID: %w", err)
+	}
+
+	org.ID = orgID.String()
+	row := r.client.queryRowContext(ctx, r.client.organizationQ["insert"], org.ID, org.Name)
+	return row.Scan(&org.CreatedAt, &org.UpdatedAt)
+}
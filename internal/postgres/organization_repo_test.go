@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestOrganizationRepository_Create(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	org := auth.Organization{Name: "Acme"}
+	if err = c.Organization().Create(ctx, &org); err != nil {
+		t.Fatal("failed to create organization:", err)
+	}
+
+	if org.ID == "" {
+		t.Error("organization ID not set")
+	}
+
+	orgB, err := c.Organization().ByID(ctx, org.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve organization:", err)
+	}
+
+	if orgB.Name != org.Name {
+		t.Errorf("incorrect organization name, want %s got %s", org.Name, orgB.Name)
+	}
+}
@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// redacted replaces query parameters in logs as they may contain
+// credentials or personal information.
+const redacted = "[REDACTED]"
+
+// row wraps sql.Row to release the query's context once scanned.
+// Errors raised before the query is sent are returned on Scan.
+type row struct {
+	*sql.Row
+	err   error
+	query *query
+}
+
+// Scan copies the columns of the matched row into dest.
+func (r *row) Scan(dest ...interface{}) error {
+	defer r.query.finish()
+	if r.err != nil {
+		return r.err
+	}
+	return r.Row.Scan(dest...)
+}
+
+// rows wraps sql.Rows to release the query's context once closed.
+type rows struct {
+	*sql.Rows
+	query *query
+}
+
+// Close closes the Rows, preventing further enumeration.
+func (r *rows) Close() error {
+	defer r.query.finish()
+	return r.Rows.Close()
+}
+
+// query tracks the execution of a statement from the moment it is
+// sent until its results are consumed.
+type query struct {
+	client    *Client
+	statement string
+	params    int
+	startedAt time.Time
+	cancel    context.CancelFunc
+	done      bool
+}
+
+// startQuery returns a context bound by the client's query timeout
+// and a query to be finished once its results are consumed.
+func (c *Client) startQuery(ctx context.Context, statement string, args []interface{}) (context.Context, *query) {
+	q := &query{
+		client:    c,
+		statement: statement,
+		params:    len(args),
+		startedAt: time.Now(),
+		cancel:    func() {},
+	}
+
+	if c.queryTimeout > 0 {
+		ctx, q.cancel = context.WithTimeout(ctx, c.queryTimeout)
+	}
+
+	return ctx, q
+}
+
+// finish releases the query's context and logs the query if it
+// exceeded the slow query threshold.
+func (q *query) finish() {
+	if q.done {
+		return
+	}
+	q.done = true
+	q.cancel()
+
+	threshold := q.client.slowQueryThreshold
+	duration := time.Since(q.startedAt)
+	if threshold <= 0 || duration < threshold {
+		return
+	}
+
+	params := make([]string, q.params)
+	for i := range params {
+		params[i] = redacted
+	}
+
+	level.Warn(q.client.logger).Log(
+		"source", "postgres.Client",
+		"message", "slow query",
+		"query", strings.Join(strings.Fields(q.statement), " "),
+		"params", strings.Join(params, ", "),
+		"duration", duration,
+	)
+}
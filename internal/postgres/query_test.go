@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/fmitra/authenticator/internal/faultinject"
+)
+
+func TestQuery_SlowQuery(t *testing.T) {
+	tt := []struct {
+		name      string
+		threshold time.Duration
+		isLogged  bool
+	}{
+		{
+			name:      "Slow query logged",
+			threshold: time.Nanosecond,
+			isLogged:  true,
+		},
+		{
+			name:      "Fast query ignored",
+			threshold: time.Hour,
+			isLogged:  false,
+		},
+		{
+			name:      "Logging disabled",
+			threshold: 0,
+			isLogged:  false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := NewClient(
+				WithLogger(log.NewLogfmtLogger(&buf)),
+				WithQueryTimeout(time.Second),
+				WithSlowQueryThreshold(tc.threshold),
+			)
+
+			ctx, q := c.startQuery(
+				context.Background(),
+				"SELECT id\n\t\tFROM auth_user\n\t\tWHERE email = $1;",
+				[]interface{}{"jane@example.com"},
+			)
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("expected query context to have a deadline")
+			}
+			time.Sleep(time.Millisecond)
+			q.finish()
+			q.finish()
+
+			if ctx.Err() == nil {
+				t.Error("expected query context to be released")
+			}
+
+			out := buf.String()
+			if tc.isLogged != (out != "") {
+				t.Fatalf("incorrect log output, want logged %v got %q", tc.isLogged, out)
+			}
+			if !tc.isLogged {
+				return
+			}
+			if strings.Count(out, "slow query") != 1 {
+				t.Errorf("expected query to be logged once, got %q", out)
+			}
+			if strings.Contains(out, "jane@example.com") {
+				t.Errorf("expected params to be redacted, got %q", out)
+			}
+			if !strings.Contains(out, "SELECT id FROM auth_user WHERE email = $1;") {
+				t.Errorf("expected compacted query, got %q", out)
+			}
+		})
+	}
+}
+
+func TestQuery_ReplicaRouting(t *testing.T) {
+	primary, err := sql.Open("postgres", "")
+	if err != nil {
+		t.Fatal("failed to create primary:", err)
+	}
+	replica, err := sql.Open("postgres", "")
+	if err != nil {
+		t.Fatal("failed to create replica:", err)
+	}
+
+	c := NewClient(WithDB(primary))
+	if c.reader() != primary {
+		t.Error("expected reads to use primary without a replica")
+	}
+
+	c = NewClient(WithDB(primary), WithReplica(replica))
+	if c.reader() != replica {
+		t.Error("expected reads to use replica")
+	}
+	if c.primary() != primary {
+		t.Error("expected writes to use primary")
+	}
+
+	tx := &sql.Tx{}
+	c.tx = tx
+	if c.reader() != tx {
+		t.Error("expected reads within a transaction to use the transaction")
+	}
+}
+
+func TestQuery_Faults(t *testing.T) {
+	db, err := sql.Open("postgres", "")
+	if err != nil {
+		t.Fatal("failed to create db:", err)
+	}
+
+	tt := []struct {
+		name  string
+		fault faultinject.Fault
+		err   error
+	}{
+		{
+			name:  "Injected error",
+			fault: faultinject.Fault{ErrorRate: 1},
+			err:   faultinject.ErrInjected,
+		},
+		{
+			name:  "Injected latency exceeds query timeout",
+			fault: faultinject.Fault{Latency: time.Second},
+			err:   context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewClient(
+				WithDB(db),
+				WithQueryTimeout(time.Millisecond*10),
+				WithFaults(faultinject.New(
+					faultinject.WithFault(faultinject.Postgres, tc.fault),
+				)),
+			)
+			ctx := context.Background()
+
+			var id string
+			err := c.queryRowContext(ctx, "SELECT id FROM auth_user;").Scan(&id)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("incorrect row error, want %v got %v", tc.err, err)
+			}
+			if _, err = c.queryContext(ctx, "SELECT id FROM auth_user;"); !errors.Is(err, tc.err) {
+				t.Errorf("incorrect query error, want %v got %v", tc.err, err)
+			}
+			if _, err = c.execContext(ctx, "DELETE FROM auth_user;"); !errors.Is(err, tc.err) {
+				t.Errorf("incorrect exec error, want %v got %v", tc.err, err)
+			}
+		})
+	}
+}
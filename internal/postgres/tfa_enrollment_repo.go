@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// TFAEnrollmentRepository is an implementation of auth.TFAEnrollmentRepository.
+type TFAEnrollmentRepository struct {
+	client *Client
+}
+
+// ByUserID retrieves a User's TFAEnrollment.
+func (r *TFAEnrollmentRepository) ByUserID(ctx context.Context, userID string) (*auth.TFAEnrollment, error) {
+	row := r.client.queryRowContext(ctx, r.client.tfaEnrollmentQ["byUserID"], userID)
+	return scanTFAEnrollment(row)
+}
+
+// Due retrieves enrollments whose deadline has yet to pass and which
+// were last reminded before a given time, earliest deadline first.
+func (r *TFAEnrollmentRepository) Due(ctx context.Context, now, remindedBefore time.Time, limit int) ([]*auth.TFAEnrollment, error) {
+	rows, err := r.client.queryContext(ctx, r.client.tfaEnrollmentQ["due"], now, remindedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	enrollments := make([]*auth.TFAEnrollment, 0)
+	for rows.Next() {
+		e, err := scanTFAEnrollment(rows)
+		if err != nil {
+			return nil, err
+		}
+		enrollments = append(enrollments, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return enrollments, nil
+}
+
+// Create persists a new TFAEnrollment to storage. A User's existing
+// deadline is retained and set on the TFAEnrollment.
+func (r *TFAEnrollmentRepository) Create(ctx context.Context, e *auth.TFAEnrollment) error {
+	var remindedAt sql.NullTime
+	row := r.client.queryRowContext(ctx, r.client.tfaEnrollmentQ["insert"], e.UserID, e.Deadline)
+	if err := row.Scan(&e.Deadline, &remindedAt, &e.CreatedAt); err != nil {
+		return err
+	}
+
+	e.LastRemindedAt = remindedAt.Time
+	return nil
+}
+
+// MarkReminded updates the time a User was last reminded.
+func (r *TFAEnrollmentRepository) MarkReminded(ctx context.Context, userID string, remindedAt time.Time) error {
+	_, err := r.client.execContext(ctx, r.client.tfaEnrollmentQ["markReminded"], userID, remindedAt)
+	if err != nil {
+		return fmt.Errorf("failed to execute update: %w", err)
+	}
+
+	return nil
+}
+
+func scanTFAEnrollment(row scanner) (*auth.TFAEnrollment, error) {
+	var (
+		e          auth.TFAEnrollment
+		remindedAt sql.NullTime
+	)
+	if err := row.Scan(&e.UserID, &e.Deadline, &remindedAt, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	e.LastRemindedAt = remindedAt.Time
+	return &e, nil
+}
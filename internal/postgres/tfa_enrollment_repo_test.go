@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestTFAEnrollmentRepository_CreateRetainsDeadline(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	deadline := time.Now().Add(time.Hour * 24).Truncate(time.Second)
+	enrollment := auth.TFAEnrollment{UserID: user.ID, Deadline: deadline}
+	if err = c.TFAEnrollment().Create(ctx, &enrollment); err != nil {
+		t.Fatal("failed to create enrollment:", err)
+	}
+
+	later := auth.TFAEnrollment{UserID: user.ID, Deadline: deadline.Add(time.Hour)}
+	if err = c.TFAEnrollment().Create(ctx, &later); err != nil {
+		t.Fatal("failed to create enrollment:", err)
+	}
+	if !later.Deadline.Equal(deadline) {
+		t.Errorf("expected existing deadline to be retained, want %v got %v", deadline, later.Deadline)
+	}
+}
+
+func TestTFAEnrollmentRepository_Due(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	now := time.Now()
+	enrollment := auth.TFAEnrollment{UserID: user.ID, Deadline: now.Add(time.Hour * 24)}
+	if err = c.TFAEnrollment().Create(ctx, &enrollment); err != nil {
+		t.Fatal("failed to create enrollment:", err)
+	}
+
+	due, err := c.TFAEnrollment().Due(ctx, now, now.Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal("failed to retrieve due enrollments:", err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("incorrect due enrollment count, want 1 got %v", len(due))
+	}
+
+	if err = c.TFAEnrollment().MarkReminded(ctx, user.ID, now); err != nil {
+		t.Fatal("failed to mark enrollment reminded:", err)
+	}
+
+	due, err = c.TFAEnrollment().Due(ctx, now, now.Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal("failed to retrieve due enrollments:", err)
+	}
+	if len(due) != 0 {
+		t.Errorf("incorrect due enrollment count, want 0 got %v", len(due))
+	}
+
+	due, err = c.TFAEnrollment().Due(ctx, now.Add(time.Hour*48), now.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatal("failed to retrieve due enrollments:", err)
+	}
+	if len(due) != 0 {
+		t.Errorf("expected enrollments past their deadline to be skipped, got %v", len(due))
+	}
+}
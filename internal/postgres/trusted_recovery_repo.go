@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// TrustedRecoveryRepository is an implementation of auth.TrustedRecoveryRepository.
+type TrustedRecoveryRepository struct {
+	client *Client
+}
+
+// ByUserID retrieves a User's TrustedRecovery.
+func (r *TrustedRecoveryRepository) ByUserID(ctx context.Context, userID string) (*auth.TrustedRecovery, error) {
+	recovery := auth.TrustedRecovery{}
+	row := r.client.queryRowContext(ctx, r.client.trustedRecoveryQ["byUserID"], userID)
+	err := row.Scan(
+		&recovery.UserID,
+		pq.Array(&recovery.Contacts),
+		pq.Array(&recovery.Verified),
+		&recovery.Threshold,
+		&recovery.CodeHash,
+		&recovery.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recovery, nil
+}
+
+// Create persists a TrustedRecovery to storage, replacing a
+// User's existing TrustedRecovery.
+func (r *TrustedRecoveryRepository) Create(ctx context.Context, recovery *auth.TrustedRecovery) error {
+	row := r.client.queryRowContext(
+		ctx,
+		r.client.trustedRecoveryQ["upsert"],
+		recovery.UserID,
+		pq.Array(recovery.Contacts),
+		recovery.Threshold,
+		recovery.CodeHash,
+	)
+	recovery.Verified = []string{}
+	return row.Scan(&recovery.CreatedAt)
+}
+
+// Verify marks a contact of a User's TrustedRecovery as verified.
+// Contacts already verified are left unchanged.
+func (r *TrustedRecoveryRepository) Verify(ctx context.Context, userID, contact string) error {
+	_, err := r.client.execContext(ctx, r.client.trustedRecoveryQ["verify"], userID, contact)
+	if err != nil {
+		return fmt.Errorf("failed to execute update: %w", err)
+	}
+
+	return nil
+}
+
+// Remove removes a User's TrustedRecovery from storage.
+func (r *TrustedRecoveryRepository) Remove(ctx context.Context, userID string) error {
+	res, err := r.client.execContext(ctx, r.client.trustedRecoveryQ["delete"], userID)
+	if err != nil {
+		return fmt.Errorf("failed to execute delete: %w", err)
+	}
+
+	removedRows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if removedRows == 0 {
+		return auth.ErrNotFound("trusted contacts are not configured")
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestTrustedRecoveryRepository_Create(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	_, err = c.TrustedRecovery().ByUserID(ctx, user.ID)
+	if err != sql.ErrNoRows {
+		t.Errorf("incorrect error, want %v got %v", sql.ErrNoRows, err)
+	}
+
+	recovery := auth.TrustedRecovery{
+		UserID:    user.ID,
+		Contacts:  []string{"john@example.com", "+15555555555", "mary@example.com"},
+		Threshold: 2,
+		CodeHash:  "code-hash",
+	}
+	if err = c.TrustedRecovery().Create(ctx, &recovery); err != nil {
+		t.Fatal("failed to create trusted recovery:", err)
+	}
+	if recovery.CreatedAt.IsZero() {
+		t.Error("expected created at to be set")
+	}
+
+	for _, contact := range []string{"john@example.com", "john@example.com", "eve@example.com"} {
+		if err = c.TrustedRecovery().Verify(ctx, user.ID, contact); err != nil {
+			t.Fatal("failed to verify contact:", err)
+		}
+	}
+
+	stored, err := c.TrustedRecovery().ByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve trusted recovery:", err)
+	}
+	if len(stored.Verified) != 1 || stored.Verified[0] != "john@example.com" {
+		t.Errorf("incorrect verified contacts, want [john@example.com] got %v", stored.Verified)
+	}
+
+	recovery.Contacts = []string{"john@example.com", "mary@example.com"}
+	recovery.CodeHash = "new-code-hash"
+	if err = c.TrustedRecovery().Create(ctx, &recovery); err != nil {
+		t.Fatal("failed to replace trusted recovery:", err)
+	}
+
+	stored, err = c.TrustedRecovery().ByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve trusted recovery:", err)
+	}
+	if len(stored.Verified) != 0 {
+		t.Errorf("expected verified contacts to be reset, got %v", stored.Verified)
+	}
+	if len(stored.Contacts) != 2 || stored.CodeHash != "new-code-hash" || stored.Threshold != 2 {
+		t.Errorf("incorrect trusted recovery: %+v", stored)
+	}
+}
+
+func TestTrustedRecoveryRepository_Remove(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+
+	ctx := context.Background()
+	user := auth.User{
+		TFASecret: "tfa_secret",
+		Email: sql.NullString{
+			String: "jane@example.com",
+			Valid:  true,
+		},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	err = c.TrustedRecovery().Remove(ctx, user.ID)
+	if auth.ErrorCode(err) != auth.ENotFound {
+		t.Errorf("incorrect error code, want %s got %s", auth.ENotFound, auth.ErrorCode(err))
+	}
+
+	recovery := auth.TrustedRecovery{
+		UserID:    user.ID,
+		Contacts:  []string{"john@example.com", "mary@example.com"},
+		Threshold: 2,
+		CodeHash:  "code-hash",
+	}
+	if err = c.TrustedRecovery().Create(ctx, &recovery); err != nil {
+		t.Fatal("failed to create trusted recovery:", err)
+	}
+	if err = c.TrustedRecovery().Remove(ctx, user.ID); err != nil {
+		t.Fatal("failed to remove trusted recovery:", err)
+	}
+
+	_, err = c.TrustedRecovery().ByUserID(ctx, user.ID)
+	if err != sql.ErrNoRows {
+		t.Errorf("incorrect error, want %v got %v", sql.ErrNoRows, err)
+	}
+}
@@ -20,36 +20,123 @@ type UserRepository struct {
 }
 
 // ByIdentity retrieves a User by their phone, email, or unique ID.
+// Outside of a transaction it may be served by a read replica.
 func (r *UserRepository) ByIdentity(ctx context.Context, attribute, value string) (*auth.User, error) {
 	var (
 		q    string
+		args []interface{}
 		user auth.User
 	)
 
 	switch attribute {
 	case "Phone":
 		q = "byPhone"
+		args = r.client.cipher.phoneLookup(value)
 	case "Email":
+		// Emails are matched by their canonical form. Users stored
+		// before the canonical form was introduced are matched by
+		// their address until migrated.
 		q = "byEmail"
+		args = r.client.cipher.emailLookup(value)
 	case "ID":
 		q = "byID"
+		args = []interface{}{value}
 	default:
 		return nil, fmt.Errorf("%s is not a valid query parameter", attribute)
 	}
 
-	row := r.client.queryRowContext(ctx, r.client.userQ[q], value)
+	row := r.client.readRowContext(ctx, r.client.userQ[q], args...)
 	err := row.Scan(
 		&user.ID, &user.Phone, &user.Email, &user.Password, &user.TFASecret,
 		&user.IsEmailOTPAllowed, &user.IsPhoneOTPAllowed, &user.IsTOTPAllowed, &user.IsDeviceAllowed,
-		&user.IsVerified, &user.CreatedAt, &user.UpdatedAt,
+		&user.IsVerified, &user.IsPasswordExpired, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	if err = r.client.cipher.decryptUser(&user); err != nil {
+		return nil, err
+	}
 
 	return &user, nil
 }
 
+// List retrieves Users ordered by ID, starting after a given ID.
+// User IDs are ULIDs, so Users are listed in order of creation.
+func (r *UserRepository) List(ctx context.Context, afterID string, limit int) ([]*auth.User, error) {
+	rows, err := r.client.readContext(ctx, r.client.userQ["list"], afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*auth.User, 0)
+	for rows.Next() {
+		user := auth.User{}
+		err := rows.Scan(
+			&user.ID, &user.Phone, &user.Email, &user.Password, &user.TFASecret,
+			&user.IsEmailOTPAllowed, &user.IsPhoneOTPAllowed, &user.IsTOTPAllowed, &user.IsDeviceAllowed,
+			&user.IsVerified, &user.IsPasswordExpired, &user.CreatedAt, &user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err = r.client.cipher.decryptUser(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// CountSignups returns the number of verified Users created on each
+// UTC day since a given time. Days without signups are omitted. It may
+// be served by a read replica.
+func (r *UserRepository) CountSignups(ctx context.Context, since time.Time) ([]*auth.DailyCount, error) {
+	rows, err := r.client.readContext(ctx, r.client.userQ["countSignups"], since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]*auth.DailyCount, 0)
+	for rows.Next() {
+		count := auth.DailyCount{}
+		if err := rows.Scan(&count.Date, &count.Count); err != nil {
+			return nil, err
+		}
+		count.Date = time.Date(
+			count.Date.Year(), count.Date.Month(), count.Date.Day(), 0, 0, 0, 0, time.UTC,
+		)
+		counts = append(counts, &count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// CountTFA returns the number of verified Users with each 2FA method
+// enabled. It may be served by a read replica.
+func (r *UserRepository) CountTFA(ctx context.Context) (*auth.TFAAdoption, error) {
+	adoption := auth.TFAAdoption{}
+	row := r.client.readRowContext(ctx, r.client.userQ["countTFA"])
+	err := row.Scan(
+		&adoption.Users, &adoption.Email, &adoption.Phone,
+		&adoption.TOTP, &adoption.Device,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &adoption, nil
+}
+
 // Create persists a new User to local storage.
 func (r *UserRepository) Create(ctx context.Context, user *auth.User) error {
 	sanitizeUser(user)
@@ -80,20 +167,28 @@ func (r *UserRepository) Create(ctx context.Context, user *auth.User) error {
 		user.IsEmailOTPAllowed = true
 	}
 
+	stored, err := r.client.cipher.encryptUser(user)
+	if err != nil {
+		return err
+	}
+
 	user.ID = userID.String()
 	row := r.client.queryRowContext(
 		ctx,
 		r.client.userQ["insert"],
 		user.ID,
-		user.Phone,
-		user.Email,
+		stored.phone,
+		stored.email,
 		user.Password,
-		user.TFASecret,
+		stored.tfaSecret,
 		user.IsEmailOTPAllowed,
 		user.IsPhoneOTPAllowed,
 		user.IsTOTPAllowed,
 		user.IsDeviceAllowed,
 		user.IsVerified,
+		stored.emailCanonical,
+		stored.phoneIndex,
+		stored.emailIndex,
 	)
 	err = row.Scan(
 		&user.CreatedAt,
@@ -150,11 +245,14 @@ func (r *UserRepository) GetForUpdate(ctx context.Context, userID string) (*auth
 	err := row.Scan(
 		&user.ID, &user.Phone, &user.Email, &user.Password, &user.TFASecret,
 		&user.IsEmailOTPAllowed, &user.IsPhoneOTPAllowed, &user.IsTOTPAllowed, &user.IsDeviceAllowed,
-		&user.IsVerified, &user.CreatedAt, &user.UpdatedAt,
+		&user.IsVerified, &user.IsPasswordExpired, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve record for update: %w", err)
 	}
+	if err = r.client.cipher.decryptUser(&user); err != nil {
+		return nil, err
+	}
 
 	return &user, nil
 }
@@ -264,6 +362,11 @@ func (r *UserRepository) DisableOTP(ctx context.Context, userID string, method a
 }
 
 func (r *UserRepository) update(ctx context.Context, userID string, user *auth.User) error {
+	stored, err := r.client.cipher.encryptUser(user)
+	if err != nil {
+		return err
+	}
+
 	currentTime := time.Now().UTC()
 	user.UpdatedAt = currentTime
 
@@ -271,10 +374,10 @@ func (r *UserRepository) update(ctx context.Context, userID string, user *auth.U
 		ctx,
 		r.client.userQ["update"],
 		userID,
-		user.Phone,
-		user.Email,
+		stored.phone,
+		stored.email,
 		user.Password,
-		user.TFASecret,
+		stored.tfaSecret,
 		user.IsEmailOTPAllowed,
 		user.IsPhoneOTPAllowed,
 		user.IsTOTPAllowed,
@@ -286,6 +389,10 @@ func (r *UserRepository) update(ctx context.Context, userID string, user *auth.U
 		user.CreatedAt,
 		user.UpdatedAt,
 		user.ID,
+		stored.emailCanonical,
+		stored.phoneIndex,
+		stored.emailIndex,
+		user.IsPasswordExpired,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to execute update: %w", err)
@@ -302,6 +409,12 @@ func (r *UserRepository) update(ctx context.Context, userID string, user *auth.U
 }
 
 func (r *UserRepository) hashPassword(user *auth.User) error {
+	// Users registered without a password authenticate
+	// solely through OTP codes delivered to their address.
+	if user.Password == "" {
+		return nil
+	}
+
 	err := r.password.OKForUser(user.Password)
 	if err != nil {
 		return err
@@ -381,7 +494,19 @@ func validateUserUnverified(user *auth.User) error {
 	return nil
 }
 
+// canonicalEmail returns the canonical form of a User's email
+// address, which must be unique across Users.
+func canonicalEmail(user *auth.User) sql.NullString {
+	if !user.Email.Valid || user.Email.String == "" {
+		return sql.NullString{}
+	}
+	return sql.NullString{
+		String: contactchecker.CanonicalEmail(user.Email.String),
+		Valid:  true,
+	}
+}
+
 func sanitizeUser(user *auth.User) {
-	user.Phone.String = strings.TrimSpace(user.Phone.String)
+	user.Phone.String = contactchecker.NormalizePhone(user.Phone.String)
 	user.Email.String = strings.ToLower(strings.TrimSpace(user.Email.String))
 }
@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"testing"
 	"time"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/oklog/ulid/v2"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
 	"github.com/fmitra/authenticator/internal/test"
 )
 
@@ -126,6 +128,46 @@ func TestUserRepository_Create(t *testing.T) {
 	}
 }
 
+func TestUserRepository_CreateCanonicalEmail(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+	ctx := context.Background()
+
+	contactchecker.SetEmailAliases(true)
+	defer contactchecker.SetEmailAliases(false)
+
+	user := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Email:     sql.NullString{String: "Jane.Doe@gmail.com", Valid: true},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	found, err := c.User().ByIdentity(ctx, "Email", "janedoe+news@gmail.com")
+	if err != nil {
+		t.Fatal("failed to retrieve user by alias:", err)
+	}
+	if found.ID != user.ID {
+		t.Errorf("incorrect user for alias, want %s got %s", user.ID, found.ID)
+	}
+
+	alias := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Email:     sql.NullString{String: "janedoe+news@gmail.com", Valid: true},
+	}
+	if err = c.User().Create(ctx, &alias); err == nil {
+		t.Error("expected user with aliased email to be rejected")
+	}
+}
+
 func TestUserRepository_ByIdentity(t *testing.T) {
 	pgDB, err := test.NewPGDB()
 	if err != nil {
@@ -207,6 +249,199 @@ func TestUserRepository_ByIdentity(t *testing.T) {
 	}
 }
 
+func TestUserRepository_ByIdentityEncrypted(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+	c.cipher = fieldCipher{
+		secrets:  []Secret{{Version: 1, Key: "secret-key"}},
+		indexKey: []byte("index-key"),
+	}
+	ctx := context.Background()
+
+	contactchecker.SetEmailAliases(true)
+	defer contactchecker.SetEmailAliases(false)
+
+	user := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Phone:     sql.NullString{String: "+6590000000", Valid: true},
+		Email:     sql.NullString{String: "jane.doe@gmail.com", Valid: true},
+	}
+	if err = c.User().Create(ctx, &user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	var phone, email string
+	var phoneIndex, emailIndex, emailCanonical sql.NullString
+	err = pgDB.DB.QueryRow(
+		"SELECT phone, email, phone_index, email_index, email_canonical FROM auth_user WHERE id = $1",
+		user.ID,
+	).Scan(&phone, &email, &phoneIndex, &emailIndex, &emailCanonical)
+	if err != nil {
+		t.Fatal("failed to retrieve stored user:", err)
+	}
+	if phone == "+6590000000" || email == "jane.doe@gmail.com" || emailCanonical.Valid {
+		t.Error("user stored in plaintext")
+	}
+	if !phoneIndex.Valid || !emailIndex.Valid {
+		t.Error("blind indexes not stored")
+	}
+
+	tt := []struct {
+		name        string
+		searchField string
+		searchValue string
+		hasError    bool
+	}{
+		{
+			name:        "Search by phone",
+			searchField: "Phone",
+			searchValue: "+65 9000 0000",
+		},
+		{
+			name:        "Search by email",
+			searchField: "Email",
+			searchValue: "Jane.Doe@gmail.com",
+		},
+		{
+			name:        "Search by email alias",
+			searchField: "Email",
+			searchValue: "janedoe+news@googlemail.com",
+		},
+		{
+			name:        "Search by encrypted value",
+			searchField: "Email",
+			searchValue: email,
+			hasError:    true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			found, err := c.User().ByIdentity(ctx, tc.searchField, tc.searchValue)
+			if tc.hasError {
+				if err == nil {
+					t.Error("expected error on user retrieval")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("failed to find user:", err)
+			}
+			if found.ID != user.ID || found.Email.String != "jane.doe@gmail.com" ||
+				found.Phone.String != "+6590000000" || found.TFASecret != "tfa_secret" {
+				t.Errorf("incorrect user: %+v", found)
+			}
+		})
+	}
+
+	duplicate := auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Phone:     sql.NullString{String: "+6590000000", Valid: true},
+	}
+	if err = c.User().Create(ctx, &duplicate); err == nil {
+		t.Error("expected user with duplicate phone to be rejected")
+	}
+}
+
+func TestUserRepository_List(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+	ctx := context.Background()
+
+	var ids []string
+	for _, email := range []string{"jane@example.com", "john@example.com", "june@example.com"} {
+		user := auth.User{
+			Password:  "swordfish",
+			TFASecret: "tfa_secret",
+			Email: sql.NullString{
+				String: email,
+				Valid:  true,
+			},
+		}
+		if err = c.User().Create(ctx, &user); err != nil {
+			t.Fatal("failed to create user:", err)
+		}
+		ids = append(ids, user.ID)
+	}
+
+	users, err := c.User().List(ctx, "", 2)
+	if err != nil {
+		t.Fatal("failed to list users:", err)
+	}
+	if len(users) != 2 || users[0].ID != ids[0] || users[1].ID != ids[1] {
+		t.Errorf("incorrect first page, want %v got %v", ids[:2], users)
+	}
+
+	users, err = c.User().List(ctx, ids[1], 2)
+	if err != nil {
+		t.Fatal("failed to list users:", err)
+	}
+	if len(users) != 1 || users[0].ID != ids[2] {
+		t.Errorf("incorrect second page, want %v got %v", ids[2:], users)
+	}
+}
+
+func TestUserRepository_CountSignupsAndTFA(t *testing.T) {
+	pgDB, err := test.NewPGDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer pgDB.DropDB()
+
+	c := TestClient(pgDB.DB)
+	ctx := context.Background()
+
+	users := []auth.User{
+		{IsVerified: true, IsEmailOTPAllowed: true, IsTOTPAllowed: true},
+		{IsVerified: true, IsEmailOTPAllowed: true},
+		{IsVerified: false, IsEmailOTPAllowed: true, IsTOTPAllowed: true},
+	}
+	for i, user := range users {
+		user.Password = "swordfish"
+		user.TFASecret = "tfa_secret"
+		user.Email = sql.NullString{
+			String: fmt.Sprintf("user-%v@example.com", i),
+			Valid:  true,
+		}
+		if err = c.User().Create(ctx, &user); err != nil {
+			t.Fatal("failed to create user:", err)
+		}
+	}
+
+	signups, err := c.User().CountSignups(ctx, time.Now().Add(-time.Hour*24))
+	if err != nil {
+		t.Fatal("failed to count signups:", err)
+	}
+	var total int64
+	for _, s := range signups {
+		total += s.Count
+	}
+	if total != 2 {
+		t.Errorf("incorrect signup count, want 2 got %v", total)
+	}
+
+	adoption, err := c.User().CountTFA(ctx)
+	if err != nil {
+		t.Fatal("failed to count 2FA adoption:", err)
+	}
+	expected := &auth.TFAAdoption{Users: 2, Email: 2, TOTP: 1}
+	if !cmp.Equal(adoption, expected) {
+		t.Error(cmp.Diff(adoption, expected))
+	}
+}
+
 func TestUserRepository_Update(t *testing.T) {
 	pgDB, err := test.NewPGDB()
 	if err != nil {
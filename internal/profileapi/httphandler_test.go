@@ -0,0 +1,132 @@
+package profileapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestProfileAPI_Profile(t *testing.T) {
+	tt := []struct {
+		name       string
+		statusCode int
+		authHeader bool
+		errMessage string
+	}{
+		{
+			name:       "Authentication error with no token",
+			statusCode: http.StatusUnauthorized,
+			authHeader: false,
+			errMessage: "User is not authenticated",
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			authHeader: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return &test.UserRepository{
+						ByIdentityFn: func() (*auth.User, error) {
+							return &auth.User{
+								ID:            "user-id",
+								Email:         sql.NullString{String: "jane@example.com", Valid: true},
+								Password:      "password-hash",
+								TFASecret:     "tfa-secret",
+								IsTOTPAllowed: true,
+								IsVerified:    true,
+							}, nil
+						},
+					}
+				},
+			}
+			tokenSvc := &test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					return &auth.Token{
+						UserID:        "user-id",
+						State:         auth.JWTAuthorized,
+						AuthMethods:   []string{"password", "totp"},
+						Organizations: []auth.OrganizationClaim{{ID: "org-id", Role: auth.RoleOwner}},
+						StandardClaims: jwt.StandardClaims{
+							Id:        "token-id",
+							IssuedAt:  1597017600,
+							ExpiresAt: 1597021200,
+						},
+					}, nil
+				},
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+			)
+
+			req, err := http.NewRequest("GET", "/api/v1/me", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			if tc.authHeader {
+				test.SetAuthHeaders(req)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if tc.statusCode != http.StatusOK {
+				err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+
+			body := rr.Body.String()
+			for _, secret := range []string{"password-hash", "tfa-secret"} {
+				if strings.Contains(body, secret) {
+					t.Errorf("response exposes a secret: %s", body)
+				}
+			}
+
+			var resp profileResponse
+			if err = json.NewDecoder(strings.NewReader(body)).Decode(&resp); err != nil {
+				t.Fatal("failed to decode response:", err)
+			}
+
+			if resp.User.Email != "jane@example.com" || resp.User.DefaultTFA != auth.TOTP {
+				t.Errorf("incorrect user: %+v", resp.User)
+			}
+			if resp.Session.TokenID != "token-id" || len(resp.Session.AuthMethods) != 2 ||
+				len(resp.Session.Organizations) != 1 {
+				t.Errorf("incorrect session: %+v", resp.Session)
+			}
+			if resp.Session.ExpiresAt.Unix() != 1597021200 {
+				t.Errorf("incorrect expiry, want 1597021200 got %v", resp.Session.ExpiresAt.Unix())
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package profileapi
+
+import (
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// userResponse is the response format for authenticator.User.
+// The password and TOTP secret are never included.
+type userResponse struct {
+	ID                string          `json:"id"`
+	Email             string          `json:"email,omitempty"`
+	Phone             string          `json:"phone,omitempty"`
+	IsVerified        bool            `json:"isVerified"`
+	IsEmailOTPAllowed bool            `json:"isEmailOTPAllowed"`
+	IsPhoneOTPAllowed bool            `json:"isPhoneOTPAllowed"`
+	IsTOTPAllowed     bool            `json:"isTOTPAllowed"`
+	IsDeviceAllowed   bool            `json:"isDeviceAllowed"`
+	DefaultTFA        auth.TFAOptions `json:"defaultTFA"`
+	CreatedAt         time.Time       `json:"createdAt"`
+	UpdatedAt         time.Time       `json:"updatedAt"`
+}
+
+// sessionResponse describes the claims of the token used for
+// a request.
+type sessionResponse struct {
+	TokenID            string                   `json:"tokenID"`
+	State              auth.TokenState          `json:"state"`
+	AuthMethods        []string                 `json:"authMethods"`
+	Organizations      []auth.OrganizationClaim `json:"organizations"`
+	Audiences          []string                 `json:"audiences"`
+	Scopes             []string                 `json:"scopes"`
+	ClientApplication  string                   `json:"clientApplication,omitempty"`
+	EnrollmentRequired bool                     `json:"enrollmentRequired"`
+	EnrollmentDeadline *time.Time               `json:"enrollmentDeadline,omitempty"`
+	IssuedAt           time.Time                `json:"issuedAt"`
+	ExpiresAt          time.Time                `json:"expiresAt"`
+}
+
+// profileResponse is a success response for ProfileAPI.Profile.
+type profileResponse struct {
+	User    userResponse    `json:"user"`
+	Session sessionResponse `json:"session"`
+}
+
+// Create populates a profileResponse from a User and their token.
+func (r *profileResponse) Create(user *auth.User, token *auth.Token) {
+	r.User = userResponse{
+		ID:                user.ID,
+		Email:             user.Email.String,
+		Phone:             user.Phone.String,
+		IsVerified:        user.IsVerified,
+		IsEmailOTPAllowed: user.IsEmailOTPAllowed,
+		IsPhoneOTPAllowed: user.IsPhoneOTPAllowed,
+		IsTOTPAllowed:     user.IsTOTPAllowed,
+		IsDeviceAllowed:   user.IsDeviceAllowed,
+		DefaultTFA:        user.DefaultTFA(),
+		CreatedAt:         user.CreatedAt,
+		UpdatedAt:         user.UpdatedAt,
+	}
+
+	r.Session = sessionResponse{
+		TokenID:            token.Id,
+		State:              token.State,
+		AuthMethods:        orEmpty(token.AuthMethods),
+		Organizations:      token.Organizations,
+		Audiences:          orEmpty(token.Audiences),
+		Scopes:             orEmpty(token.Scopes),
+		ClientApplication:  token.ClientApplicationID,
+		EnrollmentRequired: token.EnrollmentRequired,
+		IssuedAt:           time.Unix(token.IssuedAt, 0).UTC(),
+		ExpiresAt:          time.Unix(token.ExpiresAt, 0).UTC(),
+	}
+	if r.Session.Organizations == nil {
+		r.Session.Organizations = []auth.OrganizationClaim{}
+	}
+	if token.EnrollmentDeadline != 0 {
+		deadline := time.Unix(token.EnrollmentDeadline, 0).UTC()
+		r.Session.EnrollmentDeadline = &deadline
+	}
+}
+
+// orEmpty returns an empty slice in place of nil so lists are
+// encoded as [] rather than null.
+func orEmpty(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
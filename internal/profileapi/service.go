@@ -0,0 +1,34 @@
+// Package profileapi provides an HTTP API returning the profile
+// of the authenticated User.
+package profileapi
+
+import (
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+type service struct {
+	logger   log.Logger
+	repoMngr auth.RepositoryManager
+}
+
+// Profile returns the User's profile without secrets, along with the
+// claims of the token used for the request. The profile is retrieved
+// from storage and reflects changes made since the token was issued.
+func (s *service) Profile(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := profileResponse{}
+	resp.Create(user, httpapi.GetToken(r))
+	return &resp, nil
+}
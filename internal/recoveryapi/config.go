@@ -0,0 +1,143 @@
+package recoveryapi
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const (
+	defaultDelay              = time.Hour * 24
+	defaultWindow             = time.Hour * 72
+	defaultMaxTrustedContacts = 5
+)
+
+// NewService returns a new implementation of auth.RecoveryAPI.
+func NewService(options ...ConfigOption) auth.RecoveryAPI {
+	s := service{
+		logger: log.NewNopLogger(),
+		delay:  defaultDelay,
+		window: defaultWindow,
+		now:    time.Now,
+
+		maxTrustedContacts: defaultMaxTrustedContacts,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithTokenService configures the service with a new TokenService.
+func WithTokenService(tokenSvc auth.TokenService) ConfigOption {
+	return func(s *service) {
+		s.token = tokenSvc
+	}
+}
+
+// WithRepoManager configures the service with a new RepositoryManager.
+func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
+	return func(s *service) {
+		s.repoMngr = repoMngr
+	}
+}
+
+// WithWebAuthn configures the service with a WebAuthn library.
+func WithWebAuthn(w auth.WebAuthnService) ConfigOption {
+	return func(s *service) {
+		s.webauthn = w
+	}
+}
+
+// WithMessaging configures the service with a MessagingService.
+func WithMessaging(m auth.MessagingService) ConfigOption {
+	return func(s *service) {
+		s.message = m
+	}
+}
+
+// WithActionTokens configures the service with an ActionTokenService
+// to issue recovery and cancellation tokens. Cancellation tokens should
+// remain valid for the recovery's delay.
+func WithActionTokens(t auth.ActionTokenService) ConfigOption {
+	return func(s *service) {
+		s.actionTokens = t
+	}
+}
+
+// WithPassword configures the service with a PasswordService to
+// confirm a User's password before trusted contacts are configured.
+func WithPassword(p auth.PasswordService) ConfigOption {
+	return func(s *service) {
+		s.password = p
+	}
+}
+
+// WithOTP configures the service with an OTPService to confirm a
+// User's TOTP code before trusted contacts are configured.
+func WithOTP(o auth.OTPService) ConfigOption {
+	return func(s *service) {
+		s.otp = o
+	}
+}
+
+// WithDB configures the service with a Redis DB to track
+// pending recoveries.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithCancelURL configures the URL delivered to Users to cancel a
+// recovery. The cancellation token is appended as the token query
+// parameter. Account recovery is disabled without a URL.
+func WithCancelURL(u string) ConfigOption {
+	return func(s *service) {
+		s.cancelURL = u
+	}
+}
+
+// WithContactVerifyURL configures the URL delivered to trusted contacts
+// to confirm they received their share. The verification token is appended
+// as the token query parameter. Trusted contacts may not be configured
+// without a URL.
+func WithContactVerifyURL(u string) ConfigOption {
+	return func(s *service) {
+		s.verifyURL = u
+	}
+}
+
+// WithDelay configures how long a User must wait after starting a
+// recovery, either with a device or with shares held by trusted
+// contacts, before it may be completed, and the window after the delay
+// in which it may be completed before it expires. The default values
+// are 24 hours and 72 hours.
+func WithDelay(delay, window time.Duration) ConfigOption {
+	return func(s *service) {
+		s.delay = delay
+		s.window = window
+	}
+}
+
+// WithMaxTrustedContacts configures the maximum number of trusted
+// contacts a User may designate. The default value is 5.
+func WithMaxTrustedContacts(n int) ConfigOption {
+	return func(s *service) {
+		s.maxTrustedContacts = n
+	}
+}
@@ -0,0 +1,959 @@
+package recoveryapi
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/memstore"
+	"github.com/fmitra/authenticator/internal/password"
+	"github.com/fmitra/authenticator/internal/shamir"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestRecoveryAPI_Recover(t *testing.T) {
+	tt := []struct {
+		name            string
+		statusCode      int
+		reqBody         []byte
+		cancelURL       string
+		errMessage      string
+		userFn          func() (*auth.User, error)
+		beginLoginCalls int
+	}{
+		{
+			name:       "Recovery disabled",
+			statusCode: http.StatusForbidden,
+			reqBody:    []byte(`{"identity": "jane@example.com", "type": "email"}`),
+			errMessage: "Account recovery is disabled",
+		},
+		{
+			name:       "Invalid identity type",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"identity": "jane@example.com", "type": "fax"}`),
+			cancelURL:  "https://example.com/recovery/cancel",
+			errMessage: "Identity type must be email or phone",
+		},
+		{
+			name:       "User not found",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"identity": "jane@example.com", "type": "email"}`),
+			cancelURL:  "https://example.com/recovery/cancel",
+			errMessage: "Account cannot be recovered",
+			userFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+		},
+		{
+			name:       "User without devices",
+			statusCode: http.StatusBadRequest,
+			reqBody:    []byte(`{"identity": "jane@example.com", "type": "email"}`),
+			cancelURL:  "https://example.com/recovery/cancel",
+			errMessage: "Account cannot be recovered",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id"}, nil
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			reqBody:    []byte(`{"identity": "jane@example.com", "type": "email"}`),
+			cancelURL:  "https://example.com/recovery/cancel",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{ID: "user-id", IsDeviceAllowed: true}, nil
+			},
+			beginLoginCalls: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return &test.UserRepository{ByIdentityFn: tc.userFn}
+				},
+			}
+			webauthnSvc := &test.WebAuthnService{
+				BeginLoginFn: func() ([]byte, error) {
+					return []byte(`{"publicKey": {}}`), nil
+				},
+			}
+			actionTokens := &test.ActionTokenService{
+				IssueFn: func() (string, error) {
+					return "recovery-token", nil
+				},
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+				WithWebAuthn(webauthnSvc),
+				WithActionTokens(actionTokens),
+				WithDB(memstore.New()),
+				WithCancelURL(tc.cancelURL),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/recovery", bytes.NewBuffer(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, &test.TokenService{}, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if webauthnSvc.Calls.BeginLogin != tc.beginLoginCalls {
+				t.Errorf("incorrect WebAuthnService.BeginLogin() call count, want %v got %v",
+					tc.beginLoginCalls, webauthnSvc.Calls.BeginLogin)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRecoveryAPI_Verify(t *testing.T) {
+	now := time.Now()
+	recoveryToken := &auth.ActionToken{
+		UserID:  "user-id",
+		Purpose: auth.PurposeRecoverAccount,
+	}
+	cancelToken := &auth.ActionToken{
+		UserID:  "user-id",
+		Purpose: auth.PurposeCancelRecovery,
+	}
+
+	userRepo := &test.UserRepository{
+		ByIdentityFn: func() (*auth.User, error) {
+			return &auth.User{
+				ID:              "user-id",
+				Email:           sql.NullString{String: "jane@example.com", Valid: true},
+				Phone:           sql.NullString{String: "+15555555555", Valid: true},
+				IsDeviceAllowed: true,
+			}, nil
+		},
+	}
+	loginHistoryRepo := &test.LoginHistoryRepository{}
+	repoMngr := &test.RepositoryManager{
+		UserFn: func() auth.UserRepository {
+			return userRepo
+		},
+		LoginHistoryFn: func() auth.LoginHistoryRepository {
+			return loginHistoryRepo
+		},
+	}
+	tokenSvc := &test.TokenService{
+		CreateFn: func() (*auth.Token, error) {
+			return &auth.Token{State: auth.JWTAuthorized, RefreshToken: "refresh-token"}, nil
+		},
+		SignFn: func() (string, error) {
+			return "jwt-token", nil
+		},
+	}
+	webauthnSvc := &test.WebAuthnService{
+		FinishLoginFn: func() error {
+			return nil
+		},
+	}
+	actionTokens := &test.ActionTokenService{
+		IssueFn: func() (string, error) {
+			return "cancel-token", nil
+		},
+		ParseFn: func() (*auth.ActionToken, error) {
+			return recoveryToken, nil
+		},
+		RedeemFn: func() error {
+			return nil
+		},
+	}
+	messagingSvc := &test.MessagingService{}
+	svc := NewService(
+		WithLogger(&test.Logger{}),
+		WithTokenService(tokenSvc),
+		WithRepoManager(repoMngr),
+		WithWebAuthn(webauthnSvc),
+		WithMessaging(messagingSvc),
+		WithActionTokens(actionTokens),
+		WithDB(memstore.New()),
+		WithCancelURL("https://example.com/recovery/cancel"),
+		WithDelay(time.Hour, time.Hour),
+	)
+	svc.(*service).now = func() time.Time { return now }
+
+	router := mux.NewRouter()
+	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+	post := func(path string, body []byte) (*httptest.ResponseRecorder, *recoveryResponse) {
+		req, err := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatal("failed to create request:", err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var resp recoveryResponse
+		if rr.Code == http.StatusOK {
+			if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal("failed to decode response:", err)
+			}
+		}
+		return rr, &resp
+	}
+	verifyBody := []byte(`{"token": "recovery-token", "credential": {"id": "credential-id"}}`)
+
+	rr, resp := post("/api/v1/recovery/verify", []byte(`{"token": "recovery-token"}`))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusBadRequest, rr.Code)
+	}
+	if err := test.ValidateErrMessage("Credential must be provided", rr.Body); err != nil {
+		t.Error(err)
+	}
+
+	rr, resp = post("/api/v1/recovery/verify", verifyBody)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+	if resp.Status != recoveryPending || resp.Response != nil {
+		t.Errorf("incorrect response, want pending recovery got %+v", resp)
+	}
+	if resp.AvailableAt == nil || !resp.AvailableAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("incorrect available at, want %v got %v", now.Add(time.Hour), resp.AvailableAt)
+	}
+	if messagingSvc.Calls.Send != 2 {
+		t.Errorf("incorrect MessagingService.Send() call count, want 2 got %v", messagingSvc.Calls.Send)
+	}
+
+	now = now.Add(time.Minute * 30)
+	rr, resp = post("/api/v1/recovery/verify", verifyBody)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+	if resp.Status != recoveryPending || resp.Response != nil {
+		t.Errorf("incorrect response, want pending recovery got %+v", resp)
+	}
+	if messagingSvc.Calls.Send != 2 {
+		t.Errorf("incorrect MessagingService.Send() call count, want 2 got %v", messagingSvc.Calls.Send)
+	}
+
+	now = now.Add(time.Minute * 30)
+	rr, resp = post("/api/v1/recovery/verify", verifyBody)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+	if resp.Status != recoveryComplete || resp.Response == nil || resp.Token != "jwt-token" {
+		t.Errorf("incorrect response, want completed recovery got %+v", resp)
+	}
+	if loginHistoryRepo.Calls.Create != 1 {
+		t.Errorf("incorrect LoginHistoryRepository.Create() call count, want 1 got %v",
+			loginHistoryRepo.Calls.Create)
+	}
+	if webauthnSvc.Calls.FinishLogin != 3 {
+		t.Errorf("incorrect WebAuthnService.FinishLogin() call count, want 3 got %v",
+			webauthnSvc.Calls.FinishLogin)
+	}
+
+	// A completed recovery starts over.
+	rr, resp = post("/api/v1/recovery/verify", verifyBody)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+	if resp.Status != recoveryPending {
+		t.Errorf("incorrect status, want %s got %s", recoveryPending, resp.Status)
+	}
+
+	actionTokens.ParseFn = func() (*auth.ActionToken, error) {
+		return cancelToken, nil
+	}
+
+	cancelToken.Data = map[string]string{"recovery_id": "previous-recovery"}
+	rr, _ = post("/api/v1/recovery/cancel", []byte(`{"token": "cancel-token"}`))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusBadRequest, rr.Code)
+	}
+	if err := test.ValidateErrMessage("Recovery is not pending", rr.Body); err != nil {
+		t.Error(err)
+	}
+
+	rec, err := svc.(*service).pending(context.Background(), "user-id")
+	if err != nil || rec == nil {
+		t.Fatal("failed to retrieve pending recovery:", err)
+	}
+	cancelToken.Data = map[string]string{"recovery_id": rec.ID}
+	rr, resp = post("/api/v1/recovery/cancel", []byte(`{"token": "cancel-token"}`))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("incorrect status code, want %v got %v", http.StatusOK, rr.Code)
+	}
+	if resp.Status != recoveryCancelled {
+		t.Errorf("incorrect status, want %s got %s", recoveryCancelled, resp.Status)
+	}
+
+	rec, err = svc.(*service).pending(context.Background(), "user-id")
+	if err != nil || rec != nil {
+		t.Errorf("expected recovery to be cancelled, got %+v %v", rec, err)
+	}
+}
+
+func TestRecoveryAPI_ConfigureTrustedContacts(t *testing.T) {
+	passwordSvc := password.NewPassword()
+	passwordHash, err := passwordSvc.Hash("swordfish")
+	if err != nil {
+		t.Fatal("failed to hash password:", err)
+	}
+
+	tt := []struct {
+		name         string
+		passwordless bool
+		statusCode   int
+		reqBody      []byte
+		errMessage   string
+		createCalls  int
+		sendCalls    int
+	}{
+		{
+			name:       "Too few contacts",
+			statusCode: http.StatusBadRequest,
+			reqBody: []byte(`{
+				"contacts": [{"address": "john@example.com", "deliveryMethod": "email"}],
+				"threshold": 2
+			}`),
+			errMessage: "Between 2 and 3 contacts must be provided",
+		},
+		{
+			name:       "Threshold above contacts",
+			statusCode: http.StatusBadRequest,
+			reqBody: []byte(`{
+				"contacts": [
+					{"address": "john@example.com", "deliveryMethod": "email"},
+					{"address": "mary@example.com", "deliveryMethod": "email"}
+				],
+				"threshold": 3
+			}`),
+			errMessage: "Threshold must be between 2 and the number of contacts",
+		},
+		{
+			name:       "Duplicate contacts",
+			statusCode: http.StatusBadRequest,
+			reqBody: []byte(`{
+				"contacts": [
+					{"address": "john@example.com", "deliveryMethod": "email"},
+					{"address": "JOHN@example.com", "deliveryMethod": "email"}
+				],
+				"threshold": 2
+			}`),
+			errMessage: "Contacts must be unique",
+		},
+		{
+			name:       "User's own address",
+			statusCode: http.StatusBadRequest,
+			reqBody: []byte(`{
+				"contacts": [
+					{"address": "jane@example.com", "deliveryMethod": "email"},
+					{"address": "mary@example.com", "deliveryMethod": "email"}
+				],
+				"threshold": 2,
+				"password": "swordfish"
+			}`),
+			errMessage: "Trusted contacts cannot include your own address",
+		},
+		{
+			name:       "Missing password",
+			statusCode: http.StatusBadRequest,
+			reqBody: []byte(`{
+				"contacts": [
+					{"address": "john@example.com", "deliveryMethod": "email"},
+					{"address": "mary@example.com", "deliveryMethod": "email"}
+				],
+				"threshold": 2
+			}`),
+			errMessage: "Password must be provided",
+		},
+		{
+			name:       "Incorrect password",
+			statusCode: http.StatusBadRequest,
+			reqBody: []byte(`{
+				"contacts": [
+					{"address": "john@example.com", "deliveryMethod": "email"},
+					{"address": "mary@example.com", "deliveryMethod": "email"}
+				],
+				"threshold": 2,
+				"password": "hunter2"
+			}`),
+			errMessage: "Invalid password",
+		},
+		{
+			name:         "Passwordless user without TOTP code",
+			passwordless: true,
+			statusCode:   http.StatusBadRequest,
+			reqBody: []byte(`{
+				"contacts": [
+					{"address": "john@example.com", "deliveryMethod": "email"},
+					{"address": "mary@example.com", "deliveryMethod": "email"}
+				],
+				"threshold": 2
+			}`),
+			errMessage: "Password or TOTP code must be provided",
+		},
+		{
+			name:         "Passwordless user with TOTP code",
+			passwordless: true,
+			statusCode:   http.StatusOK,
+			reqBody: []byte(`{
+				"contacts": [
+					{"address": "john@example.com", "deliveryMethod": "email"},
+					{"address": "mary@example.com", "deliveryMethod": "email"}
+				],
+				"threshold": 2,
+				"code": "123456"
+			}`),
+			createCalls: 1,
+			sendCalls:   2,
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			reqBody: []byte(`{
+				"contacts": [
+					{"address": "john@example.com", "deliveryMethod": "email"},
+					{"address": "mary@example.com", "deliveryMethod": "email"},
+					{"address": "+6594867353", "deliveryMethod": "phone"}
+				],
+				"threshold": 2,
+				"password": "swordfish"
+			}`),
+			createCalls: 1,
+			sendCalls:   3,
+		},
+		{
+			name:       "Successful request with Matrix contact",
+			statusCode: http.StatusOK,
+			reqBody: []byte(`{
+				"contacts": [
+					{"address": "john@example.com", "deliveryMethod": "email"},
+					{"address": "@Mary:example.com", "deliveryMethod": "matrix"}
+				],
+				"threshold": 2,
+				"password": "swordfish"
+			}`),
+			createCalls: 1,
+			sendCalls:   2,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			trustedRepo := &test.TrustedRecoveryRepository{}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return &test.UserRepository{
+						ByIdentityFn: func() (*auth.User, error) {
+							user := &auth.User{
+								ID:       "user-id",
+								Email:    sql.NullString{String: "jane@example.com", Valid: true},
+								Password: string(passwordHash),
+							}
+							if tc.passwordless {
+								user.Password = ""
+								user.TFASecret = "tfa-secret"
+								user.IsTOTPAllowed = true
+							}
+							return user, nil
+						},
+					}
+				},
+				TrustedRecoveryFn: func() auth.TrustedRecoveryRepository {
+					return trustedRepo
+				},
+			}
+			tokenSvc := &test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+				},
+			}
+			messagingSvc := &test.MessagingService{}
+			actionTokens := &test.ActionTokenService{
+				IssueFn: func() (string, error) {
+					return "verify-token", nil
+				},
+			}
+			logger := &test.Logger{}
+			svc := NewService(
+				WithLogger(logger),
+				WithRepoManager(repoMngr),
+				WithMessaging(messagingSvc),
+				WithActionTokens(actionTokens),
+				WithPassword(passwordSvc),
+				WithOTP(&test.OTPService{}),
+				WithDB(memstore.New()),
+				WithCancelURL("https://example.com/recovery/cancel"),
+				WithContactVerifyURL("https://example.com/recovery/contacts/verify"),
+				WithMaxTrustedContacts(3),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/recovery/contacts", bytes.NewBuffer(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			test.SetAuthHeaders(req)
+
+			SetupHTTPHandler(svc, router, tokenSvc, log.NewNopLogger(), &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if trustedRepo.Calls.Create != tc.createCalls {
+				t.Errorf("incorrect TrustedRecoveryRepository.Create() call count, want %v got %v",
+					tc.createCalls, trustedRepo.Calls.Create)
+			}
+
+			if messagingSvc.Calls.Send != tc.sendCalls {
+				t.Errorf("incorrect MessagingService.Send() call count, want %v got %v",
+					tc.sendCalls, messagingSvc.Calls.Send)
+			}
+
+			if tc.createCalls > 0 && logger.Calls.Log != 1 {
+				t.Errorf("incorrect audit log count, want 1 got %v", logger.Calls.Log)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRecoveryAPI_VerifyTrustedContact(t *testing.T) {
+	createdAt := time.Now()
+	configured := &auth.TrustedRecovery{UserID: "user-id", CreatedAt: createdAt}
+
+	tt := []struct {
+		name        string
+		statusCode  int
+		createdAt   time.Time
+		errMessage  string
+		recoveryFn  func() (*auth.TrustedRecovery, error)
+		verifyCalls int
+	}{
+		{
+			name:       "Trusted contacts removed",
+			statusCode: http.StatusBadRequest,
+			createdAt:  createdAt,
+			errMessage: "Trusted contacts were changed",
+			recoveryFn: func() (*auth.TrustedRecovery, error) {
+				return nil, sql.ErrNoRows
+			},
+		},
+		{
+			name:       "Trusted contacts replaced",
+			statusCode: http.StatusBadRequest,
+			createdAt:  createdAt.Add(-time.Hour),
+			errMessage: "Trusted contacts were changed",
+			recoveryFn: func() (*auth.TrustedRecovery, error) {
+				return configured, nil
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			createdAt:  createdAt,
+			recoveryFn: func() (*auth.TrustedRecovery, error) {
+				return configured, nil
+			},
+			verifyCalls: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			trustedRepo := &test.TrustedRecoveryRepository{ByUserIDFn: tc.recoveryFn}
+			repoMngr := &test.RepositoryManager{
+				TrustedRecoveryFn: func() auth.TrustedRecoveryRepository {
+					return trustedRepo
+				},
+			}
+			actionTokens := &test.ActionTokenService{
+				ParseFn: func() (*auth.ActionToken, error) {
+					return &auth.ActionToken{
+						UserID:  "user-id",
+						Purpose: auth.PurposeVerifyContact,
+						Data: map[string]string{
+							"contact":    "john@example.com",
+							"created_at": configuredAt(&auth.TrustedRecovery{CreatedAt: tc.createdAt}),
+						},
+					}, nil
+				},
+				RedeemFn: func() error {
+					return nil
+				},
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+				WithActionTokens(actionTokens),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/recovery/contacts/verify",
+				bytes.NewBuffer([]byte(`{"token": "verify-token"}`)))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			SetupHTTPHandler(svc, router, &test.TokenService{}, log.NewNopLogger(), &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if trustedRepo.Calls.Verify != tc.verifyCalls {
+				t.Errorf("incorrect TrustedRecoveryRepository.Verify() call count, want %v got %v",
+					tc.verifyCalls, trustedRepo.Calls.Verify)
+			}
+
+			if actionTokens.Calls.Redeem != tc.verifyCalls {
+				t.Errorf("incorrect ActionTokenService.Redeem() call count, want %v got %v",
+					tc.verifyCalls, actionTokens.Calls.Redeem)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRecoveryAPI_RecoverWithShares(t *testing.T) {
+	code := []byte("0123456789abcdef")
+	codeHash, err := crypto.Hash(hex.EncodeToString(code))
+	if err != nil {
+		t.Fatal("failed to hash recovery code:", err)
+	}
+	shares, err := shamir.Split(code, 3, 2)
+	if err != nil {
+		t.Fatal("failed to split recovery code:", err)
+	}
+	otherShares, err := shamir.Split([]byte("fedcba9876543210"), 3, 2)
+	if err != nil {
+		t.Fatal("failed to split recovery code:", err)
+	}
+	verified := []string{"john@example.com", "mary@example.com"}
+
+	tt := []struct {
+		name       string
+		statusCode int
+		shares     []string
+		errMessage string
+		recoveryFn func() (*auth.TrustedRecovery, error)
+		sendCalls  int
+	}{
+		{
+			name:       "Too few shares",
+			statusCode: http.StatusBadRequest,
+			shares:     []string{hex.EncodeToString(shares[0])},
+			errMessage: "At least 2 shares must be provided",
+		},
+		{
+			name:       "Trusted contacts not configured",
+			statusCode: http.StatusBadRequest,
+			shares:     []string{hex.EncodeToString(shares[0]), hex.EncodeToString(shares[1])},
+			errMessage: "Invalid recovery shares",
+			recoveryFn: func() (*auth.TrustedRecovery, error) {
+				return nil, sql.ErrNoRows
+			},
+		},
+		{
+			name:       "Below threshold",
+			statusCode: http.StatusBadRequest,
+			shares:     []string{hex.EncodeToString(shares[0]), hex.EncodeToString(shares[1])},
+			errMessage: "Invalid recovery shares",
+			recoveryFn: func() (*auth.TrustedRecovery, error) {
+				return &auth.TrustedRecovery{UserID: "user-id", Threshold: 3, CodeHash: codeHash, Verified: verified}, nil
+			},
+		},
+		{
+			name:       "Shares of another code",
+			statusCode: http.StatusBadRequest,
+			shares:     []string{hex.EncodeToString(otherShares[0]), hex.EncodeToString(otherShares[1])},
+			errMessage: "Invalid recovery shares",
+			recoveryFn: func() (*auth.TrustedRecovery, error) {
+				return &auth.TrustedRecovery{UserID: "user-id", Threshold: 2, CodeHash: codeHash, Verified: verified}, nil
+			},
+		},
+		{
+			name:       "Invalid share encoding",
+			statusCode: http.StatusBadRequest,
+			shares:     []string{hex.EncodeToString(shares[0]), "not-hex"},
+			errMessage: "Invalid recovery shares",
+			recoveryFn: func() (*auth.TrustedRecovery, error) {
+				return &auth.TrustedRecovery{UserID: "user-id", Threshold: 2, CodeHash: codeHash, Verified: verified}, nil
+			},
+		},
+		{
+			name:       "Contacts not verified",
+			statusCode: http.StatusBadRequest,
+			shares:     []string{hex.EncodeToString(shares[2]), hex.EncodeToString(shares[0])},
+			errMessage: "Invalid recovery shares",
+			recoveryFn: func() (*auth.TrustedRecovery, error) {
+				return &auth.TrustedRecovery{UserID: "user-id", Threshold: 2, CodeHash: codeHash, Verified: verified[:1]}, nil
+			},
+		},
+		{
+			name:       "Successful request",
+			statusCode: http.StatusOK,
+			shares:     []string{hex.EncodeToString(shares[2]), hex.EncodeToString(shares[0])},
+			recoveryFn: func() (*auth.TrustedRecovery, error) {
+				return &auth.TrustedRecovery{UserID: "user-id", Threshold: 2, CodeHash: codeHash, Verified: verified}, nil
+			},
+			sendCalls: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			trustedRepo := &test.TrustedRecoveryRepository{ByUserIDFn: tc.recoveryFn}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return &test.UserRepository{
+						ByIdentityFn: func() (*auth.User, error) {
+							return &auth.User{
+								ID:    "user-id",
+								Email: sql.NullString{String: "jane@example.com", Valid: true},
+							}, nil
+						},
+					}
+				},
+				TrustedRecoveryFn: func() auth.TrustedRecoveryRepository {
+					return trustedRepo
+				},
+			}
+			actionTokens := &test.ActionTokenService{
+				IssueFn: func() (string, error) {
+					return "cancel-token", nil
+				},
+			}
+			messagingSvc := &test.MessagingService{}
+			logger := &test.Logger{}
+			svc := NewService(
+				WithLogger(logger),
+				WithTokenService(&test.TokenService{}),
+				WithRepoManager(repoMngr),
+				WithMessaging(messagingSvc),
+				WithActionTokens(actionTokens),
+				WithDB(memstore.New()),
+				WithCancelURL("https://example.com/recovery/cancel"),
+			)
+
+			body, err := json.Marshal(map[string]interface{}{
+				"identity": "jane@example.com",
+				"type":     "email",
+				"shares":   tc.shares,
+			})
+			if err != nil {
+				t.Fatal("failed to encode request:", err)
+			}
+
+			req, err := http.NewRequest("POST", "/api/v1/recovery/shares", bytes.NewBuffer(body))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			SetupHTTPHandler(svc, router, &test.TokenService{}, log.NewNopLogger(), &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			// Shares only start a recovery, which the User is notified of.
+			if trustedRepo.Calls.Remove != 0 {
+				t.Errorf("incorrect TrustedRecoveryRepository.Remove() call count, want 0 got %v",
+					trustedRepo.Calls.Remove)
+			}
+
+			if messagingSvc.Calls.Send != tc.sendCalls {
+				t.Errorf("incorrect MessagingService.Send() call count, want %v got %v",
+					tc.sendCalls, messagingSvc.Calls.Send)
+			}
+
+			if tc.recoveryFn != nil && logger.Calls.Log != 1 {
+				t.Errorf("incorrect audit log count, want 1 got %v", logger.Calls.Log)
+			}
+
+			err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRecoveryAPI_RecoverWithSharesDelay(t *testing.T) {
+	now := time.Now()
+	code := []byte("0123456789abcdef")
+	codeHash, err := crypto.Hash(hex.EncodeToString(code))
+	if err != nil {
+		t.Fatal("failed to hash recovery code:", err)
+	}
+	shares, err := shamir.Split(code, 3, 2)
+	if err != nil {
+		t.Fatal("failed to split recovery code:", err)
+	}
+
+	trustedRepo := &test.TrustedRecoveryRepository{
+		ByUserIDFn: func() (*auth.TrustedRecovery, error) {
+			return &auth.TrustedRecovery{
+				UserID:    "user-id",
+				Threshold: 2,
+				CodeHash:  codeHash,
+				Verified:  []string{"john@example.com", "mary@example.com"},
+			}, nil
+		},
+	}
+	loginHistoryRepo := &test.LoginHistoryRepository{}
+	repoMngr := &test.RepositoryManager{
+		UserFn: func() auth.UserRepository {
+			return &test.UserRepository{
+				ByIdentityFn: func() (*auth.User, error) {
+					return &auth.User{
+						ID:    "user-id",
+						Email: sql.NullString{String: "jane@example.com", Valid: true},
+					}, nil
+				},
+			}
+		},
+		TrustedRecoveryFn: func() auth.TrustedRecoveryRepository {
+			return trustedRepo
+		},
+		LoginHistoryFn: func() auth.LoginHistoryRepository {
+			return loginHistoryRepo
+		},
+	}
+	tokenSvc := &test.TokenService{
+		CreateFn: func() (*auth.Token, error) {
+			return &auth.Token{State: auth.JWTAuthorized}, nil
+		},
+		SignFn: func() (string, error) {
+			return "jwt-token", nil
+		},
+	}
+	actionTokens := &test.ActionTokenService{
+		IssueFn: func() (string, error) {
+			return "cancel-token", nil
+		},
+	}
+	messagingSvc := &test.MessagingService{}
+	svc := NewService(
+		WithLogger(&test.Logger{}),
+		WithTokenService(tokenSvc),
+		WithRepoManager(repoMngr),
+		WithMessaging(messagingSvc),
+		WithActionTokens(actionTokens),
+		WithDB(memstore.New()),
+		WithCancelURL("https://example.com/recovery/cancel"),
+		WithDelay(time.Hour, time.Hour),
+	)
+	svc.(*service).now = func() time.Time { return now }
+
+	router := mux.NewRouter()
+	SetupHTTPHandler(svc, router, tokenSvc, log.NewNopLogger(), &httpapi.MockLimiterFactory{})
+
+	body, err := json.Marshal(map[string]interface{}{
+		"identity": "jane@example.com",
+		"type":     "email",
+		"shares":   []string{hex.EncodeToString(shares[0]), hex.EncodeToString(shares[1])},
+	})
+	if err != nil {
+		t.Fatal("failed to encode request:", err)
+	}
+
+	post := func() *recoveryResponse {
+		req, err := http.NewRequest("POST", "/api/v1/recovery/shares", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatal("failed to create request:", err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("incorrect status code, want %v got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var resp recoveryResponse
+		if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal("failed to decode response:", err)
+		}
+		return &resp
+	}
+
+	resp := post()
+	if resp.Status != recoveryPending || resp.Response != nil {
+		t.Errorf("incorrect response, want pending recovery got %+v", resp)
+	}
+	if messagingSvc.Calls.Send != 1 {
+		t.Errorf("incorrect MessagingService.Send() call count, want 1 got %v", messagingSvc.Calls.Send)
+	}
+
+	now = now.Add(time.Minute * 30)
+	resp = post()
+	if resp.Status != recoveryPending || resp.Response != nil {
+		t.Errorf("incorrect response, want pending recovery got %+v", resp)
+	}
+	if trustedRepo.Calls.Remove != 0 {
+		t.Errorf("incorrect TrustedRecoveryRepository.Remove() call count, want 0 got %v",
+			trustedRepo.Calls.Remove)
+	}
+
+	now = now.Add(time.Minute * 30)
+	resp = post()
+	if resp.Status != recoveryComplete || resp.Response == nil || resp.Token != "jwt-token" {
+		t.Errorf("incorrect response, want completed recovery got %+v", resp)
+	}
+	if trustedRepo.Calls.Remove != 1 {
+		t.Errorf("incorrect TrustedRecoveryRepository.Remove() call count, want 1 got %v",
+			trustedRepo.Calls.Remove)
+	}
+	if loginHistoryRepo.Calls.Create != 1 {
+		t.Errorf("incorrect LoginHistoryRepository.Create() call count, want 1 got %v",
+			loginHistoryRepo.Calls.Create)
+	}
+}
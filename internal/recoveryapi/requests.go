@@ -0,0 +1,208 @@
+package recoveryapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/shamir"
+)
+
+type recoverRequest struct {
+	Identity string              `json:"identity"`
+	Type     auth.DeliveryMethod `json:"type"`
+}
+
+type verifyRequest struct {
+	Token      string          `json:"token"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// tokenRequest submits the action token of a link delivered
+// to a User or trusted contact.
+type tokenRequest struct {
+	Token string `json:"token"`
+}
+
+type trustedContact struct {
+	Address        string              `json:"address"`
+	DeliveryMethod auth.DeliveryMethod `json:"deliveryMethod"`
+}
+
+type configureContactsRequest struct {
+	Contacts  []trustedContact `json:"contacts"`
+	Threshold int              `json:"threshold"`
+	// Password or Code confirm the User's identity before
+	// trusted contacts are replaced.
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type sharesRequest struct {
+	recoverRequest
+	Shares []string `json:"shares"`
+}
+
+func (r *recoverRequest) UserAttribute() string {
+	switch r.Type {
+	case auth.Email:
+		return "Email"
+	case auth.Phone:
+		return "Phone"
+	default:
+		return ""
+	}
+}
+
+func decodeRecoverRequest(r *http.Request) (*recoverRequest, error) {
+	var (
+		req recoverRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	if req.UserAttribute() == "" {
+		return nil, auth.ErrBadRequest("identity type must be email or phone")
+	}
+
+	req.Identity = contactchecker.Normalize(req.Type, req.Identity)
+
+	return &req, nil
+}
+
+func decodeVerifyRequest(r *http.Request) (*verifyRequest, error) {
+	var (
+		req verifyRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		return nil, auth.ErrInvalidField("token must be provided")
+	}
+	if len(req.Credential) == 0 {
+		return nil, auth.ErrInvalidField("credential must be provided")
+	}
+
+	return &req, nil
+}
+
+func decodeTokenRequest(r *http.Request) (*tokenRequest, error) {
+	var (
+		req tokenRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		return nil, auth.ErrInvalidField("token must be provided")
+	}
+
+	return &req, nil
+}
+
+func decodeConfigureContactsRequest(r *http.Request, maxContacts int) (*configureContactsRequest, error) {
+	var (
+		req configureContactsRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	if len(req.Contacts) < 2 || len(req.Contacts) > maxContacts {
+		return nil, auth.ErrInvalidField(fmt.Sprintf("between 2 and %d contacts must be provided", maxContacts))
+	}
+
+	if req.Threshold < 2 || req.Threshold > len(req.Contacts) {
+		return nil, auth.ErrInvalidField("threshold must be between 2 and the number of contacts")
+	}
+
+	seen := make(map[string]bool, len(req.Contacts))
+	for i, contact := range req.Contacts {
+		if contact.DeliveryMethod != auth.Phone && contact.DeliveryMethod != auth.Email &&
+			contact.DeliveryMethod != auth.Matrix {
+			return nil, auth.ErrInvalidField("deliveryMethod must be `phone`, `email` or `matrix`")
+		}
+
+		address := contactchecker.Normalize(contact.DeliveryMethod, strings.ToLower(contact.Address))
+		if !contactchecker.Validator(contact.DeliveryMethod)(address) {
+			return nil, auth.ErrInvalidField("address format is invalid")
+		}
+
+		if seen[address] {
+			return nil, auth.ErrInvalidField("contacts must be unique")
+		}
+		seen[address] = true
+		req.Contacts[i].Address = address
+	}
+
+	return &req, nil
+}
+
+func decodeSharesRequest(r *http.Request) (*sharesRequest, error) {
+	var (
+		req sharesRequest
+		err error
+	)
+
+	if r == nil || r.Body == nil {
+		return nil, auth.ErrBadRequest("no request body received")
+	}
+
+	err = httpapi.DecodeJSON(r, &req)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	if req.UserAttribute() == "" {
+		return nil, auth.ErrBadRequest("identity type must be email or phone")
+	}
+
+	if len(req.Shares) < 2 || len(req.Shares) > shamir.MaxShares {
+		return nil, auth.ErrInvalidField("at least 2 shares must be provided")
+	}
+
+	req.Identity = contactchecker.Normalize(req.Type, req.Identity)
+	for i, share := range req.Shares {
+		req.Shares[i] = strings.ToLower(strings.TrimSpace(share))
+	}
+
+	return &req, nil
+}
@@ -0,0 +1,46 @@
+package recoveryapi
+
+import (
+	"encoding/json"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/token"
+)
+
+// challengeResponse is a device challenge to sign and the
+// recovery token to submit with it.
+type challengeResponse struct {
+	Token     string          `json:"token"`
+	Challenge json.RawMessage `json:"challenge"`
+}
+
+// recoveryResponse describes the status of a recovery. A completed
+// recovery includes an authorized token.
+type recoveryResponse struct {
+	Status      string     `json:"status"`
+	AvailableAt *time.Time `json:"availableAt,omitempty"`
+	*token.Response
+}
+
+// contactResponse describes the status of a trusted contact.
+type contactResponse struct {
+	Status string `json:"status"`
+}
+
+// trustedContactsResponse describes a User's trusted contacts.
+type trustedContactsResponse struct {
+	Contacts  []string   `json:"contacts"`
+	Verified  []string   `json:"verified"`
+	Threshold int        `json:"threshold,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+func newTrustedContactsResponse(recovery *auth.TrustedRecovery) *trustedContactsResponse {
+	return &trustedContactsResponse{
+		Contacts:  recovery.Contacts,
+		Verified:  recovery.Verified,
+		Threshold: recovery.Threshold,
+		CreatedAt: &recovery.CreatedAt,
+	}
+}
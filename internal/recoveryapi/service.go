@@ -0,0 +1,375 @@
+// Package recoveryapi provides an HTTP API to recover an account after
+// a User has lost their password or other 2FA options, either with a
+// signing device or with shares of a recovery code held by trusted
+// contacts.
+package recoveryapi
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/token"
+)
+
+const (
+	// recoveryPending is the status of a recovery awaiting its delay.
+	recoveryPending = "pending"
+	// recoveryComplete is the status of a recovery exchanged for
+	// an authorized token.
+	recoveryComplete = "complete"
+	// recoveryCancelled is the status of a cancelled recovery.
+	recoveryCancelled = "cancelled"
+	// contactVerified is the status of a trusted contact who
+	// confirmed receipt of their share.
+	contactVerified = "verified"
+)
+
+// rediser is a minimal interface for go-redis.
+type rediser interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+}
+
+// recovery is a pending account recovery.
+type recovery struct {
+	ID          string    `json:"id"`
+	AvailableAt time.Time `json:"availableAt"`
+}
+
+type service struct {
+	logger       log.Logger
+	token        auth.TokenService
+	repoMngr     auth.RepositoryManager
+	webauthn     auth.WebAuthnService
+	message      auth.MessagingService
+	actionTokens auth.ActionTokenService
+	password     auth.PasswordService
+	otp          auth.OTPService
+	db           rediser
+	cancelURL    string
+	verifyURL    string
+	delay        time.Duration
+	window       time.Duration
+	now          func() time.Time
+
+	maxTrustedContacts int
+}
+
+// Recover retrieves a device challenge for a User to sign. A recovery
+// token is returned to submit alongside the signed challenge.
+func (s *service) Recover(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	if err := s.enabled(); err != nil {
+		return nil, err
+	}
+
+	req, err := decodeRecoverRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, req.UserAttribute(), req.Identity)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("account cannot be recovered"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsDeviceAllowed {
+		return nil, auth.ErrBadRequest("account cannot be recovered")
+	}
+
+	challenge, err := s.webauthn.BeginLogin(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryToken, err := s.actionTokens.Issue(ctx, user.ID, auth.PurposeRecoverAccount, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &challengeResponse{
+		Token:     recoveryToken,
+		Challenge: challenge,
+	}, nil
+}
+
+// Verify verifies a device challenge signed for a recovery token. The
+// first verification starts a recovery and notifies the User, who may
+// cancel it until its delay has passed. Verifying again once the delay
+// has passed completes the recovery with an authorized token.
+func (s *service) Verify(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	if err := s.enabled(); err != nil {
+		return nil, err
+	}
+
+	req, err := decodeVerifyRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryToken, err := s.actionTokens.Parse(ctx, req.Token, auth.PurposeRecoverAccount)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", recoveryToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsDeviceAllowed {
+		return nil, auth.ErrBadRequest("account cannot be recovered")
+	}
+
+	// The signed challenge is verified from the request body
+	// as it is for device logins.
+	r.Body = ioutil.NopCloser(bytes.NewReader(req.Credential))
+	if err = s.webauthn.FinishLogin(ctx, user, r); err != nil {
+		return nil, err
+	}
+
+	if err = s.actionTokens.Redeem(ctx, recoveryToken); err != nil {
+		return nil, err
+	}
+
+	rec, err := s.pending(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if rec == nil {
+		rec, err = s.start(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		return &recoveryResponse{Status: recoveryPending, AvailableAt: &rec.AvailableAt}, nil
+	}
+
+	if s.now().Before(rec.AvailableAt) {
+		return &recoveryResponse{Status: recoveryPending, AvailableAt: &rec.AvailableAt}, nil
+	}
+
+	return s.complete(ctx, w, r, user)
+}
+
+// Cancel cancels a pending recovery with the token delivered to the
+// User when the recovery was started.
+func (s *service) Cancel(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	if err := s.enabled(); err != nil {
+		return nil, err
+	}
+
+	req, err := decodeTokenRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelToken, err := s.actionTokens.Parse(ctx, req.Token, auth.PurposeCancelRecovery)
+	if err != nil {
+		return nil, err
+	}
+
+	rec, err := s.pending(ctx, cancelToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens of previous recoveries may not cancel a newer recovery.
+	if rec == nil || rec.ID != cancelToken.Data["recovery_id"] {
+		return nil, auth.ErrBadRequest("recovery is not pending")
+	}
+
+	if err = s.actionTokens.Redeem(ctx, cancelToken); err != nil {
+		return nil, err
+	}
+
+	if err = s.db.Del(ctx, RecoveryKey(cancelToken.UserID)).Err(); err != nil {
+		return nil, fmt.Errorf("cannot remove recovery: %w", err)
+	}
+
+	return &recoveryResponse{Status: recoveryCancelled}, nil
+}
+
+// start stores a new pending recovery and notifies the User at every
+// address on the account with a link to cancel it.
+func (s *service) start(ctx context.Context, user *auth.User) (*recovery, error) {
+	id, err := crypto.String(32)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create recovery ID: %w", err)
+	}
+
+	rec := &recovery{
+		ID:          id,
+		AvailableAt: s.now().Add(s.delay),
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode recovery: %w", err)
+	}
+
+	if err = s.db.Set(ctx, RecoveryKey(user.ID), b, s.delay+s.window).Err(); err != nil {
+		return nil, fmt.Errorf("cannot store recovery: %w", err)
+	}
+
+	cancelToken, err := s.actionTokens.Issue(ctx, user.ID, auth.PurposeCancelRecovery, map[string]string{
+		"recovery_id": rec.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	link, err := withToken(s.cancelURL, cancelToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recovery cancel URL: %w", err)
+	}
+
+	addresses := map[auth.DeliveryMethod]string{
+		auth.Email: user.Email.String,
+		auth.Phone: user.Phone.String,
+	}
+	for delivery, address := range addresses {
+		if address == "" {
+			continue
+		}
+
+		msg := &auth.Message{
+			Type:     auth.AccountRecovery,
+			Delivery: delivery,
+			Address:  address,
+			Vars: map[string]string{
+				"link":         link,
+				"available_at": rec.AvailableAt.UTC().Format(time.RFC1123),
+			},
+		}
+		if err = s.message.Send(ctx, msg); err != nil {
+			return nil, err
+		}
+	}
+
+	return rec, nil
+}
+
+// complete exchanges a recovery which has passed its delay for an
+// authorized token. A recovery may only be exchanged once.
+func (s *service) complete(ctx context.Context, w http.ResponseWriter, r *http.Request, user *auth.User) (*recoveryResponse, error) {
+	removed, err := s.db.Del(ctx, RecoveryKey(user.ID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot remove recovery: %w", err)
+	}
+	if removed == 0 {
+		return nil, auth.ErrBadRequest("recovery is not pending")
+	}
+
+	resp, err := s.authorize(ctx, w, r, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recoveryResponse{Status: recoveryComplete, Response: resp}, nil
+}
+
+// authorize creates an authorized token for a recovered User.
+func (s *service) authorize(ctx context.Context, w http.ResponseWriter, r *http.Request, user *auth.User) (*token.Response, error) {
+	jwtToken, err := s.token.Create(
+		ctx,
+		user,
+		auth.JWTAuthorized,
+		token.WithDeviceBinding(httpapi.GetDeviceID(r)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	loginHistory := &auth.LoginHistory{
+		UserID:    user.ID,
+		TokenID:   jwtToken.Id,
+		ExpiresAt: s.token.RefreshableTill(ctx, jwtToken, jwtToken.RefreshToken),
+	}
+	httpapi.SetLoginOrigin(loginHistory, r)
+	if err = s.repoMngr.LoginHistory().Create(ctx, loginHistory); err != nil {
+		return nil, err
+	}
+
+	tokenStr, err := s.token.Sign(ctx, jwtToken)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cookie := range s.token.Cookies(ctx, jwtToken) {
+		http.SetCookie(w, cookie)
+	}
+
+	return &token.Response{
+		Token:        tokenStr,
+		ClientID:     jwtToken.ClientID,
+		RefreshToken: jwtToken.RefreshToken,
+	}, nil
+}
+
+// withToken appends an action token to a URL as the
+// token query parameter.
+func withToken(u, token string) (string, error) {
+	link, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// pending returns a User's pending recovery or nil if no
+// recovery was started.
+func (s *service) pending(ctx context.Context, userID string) (*recovery, error) {
+	b, err := s.db.Get(ctx, RecoveryKey(userID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve recovery: %w", err)
+	}
+
+	var rec recovery
+	if err = json.Unmarshal(b, &rec); err != nil {
+		return nil, fmt.Errorf("invalid recovery: %w", err)
+	}
+	return &rec, nil
+}
+
+// enabled returns an error if the service is not configured
+// to recover accounts.
+func (s *service) enabled() error {
+	if s.db == nil || s.cancelURL == "" {
+		return auth.ErrForbidden("account recovery is disabled")
+	}
+	return nil
+}
+
+// RecoveryKey is the key holding a User's pending recovery.
+func RecoveryKey(userID string) string {
+	return fmt.Sprintf("%s_recovery", userID)
+}
@@ -0,0 +1,353 @@
+package recoveryapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/shamir"
+)
+
+// recoveryCodeLen is the length in bytes of a recovery code
+// split between trusted contacts.
+const recoveryCodeLen = 16
+
+// TrustedContacts retrieves a User's trusted contacts.
+func (s *service) TrustedContacts(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	recovery, err := s.repoMngr.TrustedRecovery().ByUserID(ctx, userID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrNotFound("trusted contacts are not configured"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newTrustedContactsResponse(recovery), nil
+}
+
+// ConfigureTrustedContacts designates a User's trusted contacts. A new
+// recovery code is split into one share per contact, of which a threshold
+// restores access to the account. Shares are delivered to the contacts with
+// a link to confirm they received them and only a hash of the code is stored.
+// The User must confirm their password, or a TOTP code if they registered
+// without one. Contacts configured previously, and their shares, are replaced.
+func (s *service) ConfigureTrustedContacts(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	if err := s.trustedEnabled(); err != nil {
+		return nil, err
+	}
+
+	req, err := decodeConfigureContactsRequest(r, s.maxTrustedContacts)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.confirmIdentity(ctx, user, req); err != nil {
+		return nil, err
+	}
+
+	for _, contact := range req.Contacts {
+		if contact.Address == user.Email.String || contact.Address == user.Phone.String {
+			return nil, auth.ErrInvalidField("trusted contacts cannot include your own address")
+		}
+	}
+
+	code, err := crypto.Bytes(recoveryCodeLen)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create recovery code: %w", err)
+	}
+
+	shares, err := shamir.Split(code, len(req.Contacts), req.Threshold)
+	if err != nil {
+		return nil, fmt.Errorf("cannot split recovery code: %w", err)
+	}
+
+	codeHash, err := crypto.Hash(hex.EncodeToString(code))
+	if err != nil {
+		return nil, fmt.Errorf("cannot hash recovery code: %w", err)
+	}
+
+	recovery := &auth.TrustedRecovery{
+		UserID:    userID,
+		Threshold: req.Threshold,
+		CodeHash:  codeHash,
+	}
+	for _, contact := range req.Contacts {
+		recovery.Contacts = append(recovery.Contacts, contact.Address)
+	}
+	if err = s.repoMngr.TrustedRecovery().Create(ctx, recovery); err != nil {
+		return nil, err
+	}
+
+	identity := user.Email.String
+	if identity == "" {
+		identity = user.Phone.String
+	}
+	for i, contact := range req.Contacts {
+		verifyToken, err := s.actionTokens.Issue(ctx, userID, auth.PurposeVerifyContact, map[string]string{
+			"contact":    contact.Address,
+			"created_at": configuredAt(recovery),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		link, err := withToken(s.verifyURL, verifyToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted contact verify URL: %w", err)
+		}
+
+		msg := &auth.Message{
+			Type:     auth.TrustedContactShare,
+			Delivery: contact.DeliveryMethod,
+			Address:  contact.Address,
+			Vars: map[string]string{
+				"identity": identity,
+				"share":    hex.EncodeToString(shares[i]),
+				"link":     link,
+			},
+		}
+		if err = s.message.Send(ctx, msg); err != nil {
+			return nil, err
+		}
+	}
+
+	httpapi.Audit(s.logger, r, "RecoveryAPI", "trusted_contacts_configured", userID,
+		"contacts", len(recovery.Contacts),
+		"threshold", recovery.Threshold,
+	)
+
+	return newTrustedContactsResponse(recovery), nil
+}
+
+// VerifyTrustedContact confirms a trusted contact received their share
+// with the token delivered alongside it. Shares may only be used to recover
+// an account once a threshold of contacts are verified.
+func (s *service) VerifyTrustedContact(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	req, err := decodeTokenRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	verifyToken, err := s.actionTokens.Parse(ctx, req.Token, auth.PurposeVerifyContact)
+	if err != nil {
+		return nil, err
+	}
+
+	recovery, err := s.repoMngr.TrustedRecovery().ByUserID(ctx, verifyToken.UserID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("trusted contacts were changed"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens of replaced contacts may not verify the current contacts.
+	if verifyToken.Data["created_at"] != configuredAt(recovery) {
+		return nil, auth.ErrBadRequest("trusted contacts were changed")
+	}
+
+	if err = s.actionTokens.Redeem(ctx, verifyToken); err != nil {
+		return nil, err
+	}
+
+	err = s.repoMngr.TrustedRecovery().Verify(ctx, verifyToken.UserID, verifyToken.Data["contact"])
+	if err != nil {
+		return nil, err
+	}
+
+	httpapi.Audit(s.logger, r, "RecoveryAPI", "trusted_contact_verified", verifyToken.UserID)
+
+	return &contactResponse{Status: contactVerified}, nil
+}
+
+// RemoveTrustedContacts removes a User's trusted contacts. Shares held
+// by the contacts may no longer be used.
+func (s *service) RemoveTrustedContacts(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	if err := s.repoMngr.TrustedRecovery().Remove(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	httpapi.Audit(s.logger, r, "RecoveryAPI", "trusted_contacts_removed", userID)
+
+	return &trustedContactsResponse{Contacts: []string{}}, nil
+}
+
+// RecoverWithShares restores access to an account with a threshold of
+// shares collected from its verified trusted contacts. As with device
+// recovery, the first submission starts a recovery and notifies the User,
+// who may cancel it until its delay has passed. Submitting the shares
+// again once the delay has passed completes the recovery, after which the
+// User's trusted contacts are removed and must be configured again. Every
+// attempt is recorded in the audit log.
+func (s *service) RecoverWithShares(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+
+	if err := s.enabled(); err != nil {
+		return nil, err
+	}
+
+	req, err := decodeSharesRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, req.UserAttribute(), req.Identity)
+	if err == sql.ErrNoRows {
+		httpapi.Audit(s.logger, r, "RecoveryAPI", "trusted_recovery_failed", "", "reason", "unknown identity")
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid recovery shares"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	recovery, err := s.repoMngr.TrustedRecovery().ByUserID(ctx, user.ID)
+	if err == sql.ErrNoRows {
+		httpapi.Audit(s.logger, r, "RecoveryAPI", "trusted_recovery_failed", user.ID, "reason", "not configured")
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid recovery shares"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = verifyShares(recovery, req.Shares); err != nil {
+		httpapi.Audit(s.logger, r, "RecoveryAPI", "trusted_recovery_failed", user.ID,
+			"reason", err.Error(),
+			"shares", len(req.Shares),
+		)
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid recovery shares"))
+	}
+
+	if len(recovery.Verified) < recovery.Threshold {
+		httpapi.Audit(s.logger, r, "RecoveryAPI", "trusted_recovery_failed", user.ID,
+			"reason", "contacts not verified",
+			"verified", len(recovery.Verified),
+		)
+		return nil, auth.ErrBadRequest("invalid recovery shares")
+	}
+
+	rec, err := s.pending(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if rec == nil {
+		rec, err = s.start(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		httpapi.Audit(s.logger, r, "RecoveryAPI", "trusted_recovery_started", user.ID, "shares", len(req.Shares))
+		return &recoveryResponse{Status: recoveryPending, AvailableAt: &rec.AvailableAt}, nil
+	}
+
+	if s.now().Before(rec.AvailableAt) {
+		return &recoveryResponse{Status: recoveryPending, AvailableAt: &rec.AvailableAt}, nil
+	}
+
+	if err = s.repoMngr.TrustedRecovery().Remove(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.complete(ctx, w, r, user)
+	if err != nil {
+		return nil, err
+	}
+
+	httpapi.Audit(s.logger, r, "RecoveryAPI", "trusted_recovery_succeeded", user.ID, "shares", len(req.Shares))
+
+	return resp, nil
+}
+
+// verifyShares checks that shares reconstruct the recovery code
+// of a TrustedRecovery.
+func verifyShares(recovery *auth.TrustedRecovery, encodedShares []string) error {
+	if len(encodedShares) < recovery.Threshold {
+		return fmt.Errorf("%d of %d required shares provided", len(encodedShares), recovery.Threshold)
+	}
+
+	shares := make([][]byte, len(encodedShares))
+	for i, encoded := range encodedShares {
+		share, err := hex.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("share is not hex encoded")
+		}
+		shares[i] = share
+	}
+
+	code, err := shamir.Combine(shares)
+	if err != nil {
+		return err
+	}
+
+	codeHash, err := crypto.Hash(hex.EncodeToString(code))
+	if err != nil {
+		return fmt.Errorf("cannot hash recovery code: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(recovery.CodeHash)) != 1 {
+		return fmt.Errorf("shares do not match recovery code")
+	}
+
+	return nil
+}
+
+// confirmIdentity requires a User to confirm their password, or a TOTP
+// code if they registered without a password, before changing how their
+// account may be recovered.
+func (s *service) confirmIdentity(ctx context.Context, user *auth.User, req *configureContactsRequest) error {
+	if user.Password != "" {
+		if req.Password == "" {
+			return auth.ErrInvalidField("password must be provided")
+		}
+		if err := s.password.Validate(user, req.Password); err != nil {
+			return fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid password"))
+		}
+		return nil
+	}
+
+	if user.IsTOTPAllowed && user.TFASecret != "" && req.Code != "" {
+		return s.otp.ValidateTOTP(ctx, user, req.Code)
+	}
+
+	return auth.ErrInvalidField("password or TOTP code must be provided")
+}
+
+// trustedEnabled returns an error if the service is not configured
+// to recover accounts with trusted contacts.
+func (s *service) trustedEnabled() error {
+	if err := s.enabled(); err != nil {
+		return err
+	}
+	if s.verifyURL == "" {
+		return auth.ErrForbidden("trusted contacts are disabled")
+	}
+	return nil
+}
+
+// configuredAt identifies the configuration of a User's trusted
+// contacts by the time it was created.
+func configuredAt(recovery *auth.TrustedRecovery) string {
+	return strconv.FormatInt(recovery.CreatedAt.UnixNano(), 10)
+}
@@ -0,0 +1,124 @@
+package repotest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// RunDeviceRepositoryTests verifies the semantics of a DeviceRepository.
+func RunDeviceRepositoryTests(t *testing.T, newRepo Factory) {
+	run(t, newRepo, "CreateAndRetrieve", testDeviceCreateAndRetrieve)
+	run(t, newRepo, "Update", testDeviceUpdate)
+	run(t, newRepo, "Remove", testDeviceRemove)
+}
+
+func createDevice(t *testing.T, repoMngr auth.RepositoryManager, userID string, clientID []byte) *auth.Device {
+	device := &auth.Device{
+		UserID:    userID,
+		ClientID:  clientID,
+		PublicKey: []byte("public-key"),
+		AAGUID:    []byte("aaguid"),
+		Name:      "Security key",
+	}
+	if err := repoMngr.Device().Create(context.Background(), device); err != nil {
+		t.Fatal("failed to create device:", err)
+	}
+	return device
+}
+
+func testDeviceCreateAndRetrieve(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := createUser(t, repoMngr, "jane@example.com")
+	other := createUser(t, repoMngr, "john@example.com")
+
+	device := createDevice(t, repoMngr, user.ID, []byte("client-a"))
+	createDevice(t, repoMngr, user.ID, []byte("client-b"))
+	createDevice(t, repoMngr, other.ID, []byte("client-a"))
+
+	if device.ID == "" {
+		t.Error("expected device ID to be assigned")
+	}
+	if device.CreatedAt.IsZero() || device.UpdatedAt.IsZero() {
+		t.Error("expected device timestamps to be assigned")
+	}
+
+	stored, err := repoMngr.Device().ByID(ctx, device.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve device:", err)
+	}
+	if stored.UserID != user.ID || !bytes.Equal(stored.PublicKey, device.PublicKey) ||
+		stored.Name != device.Name {
+		t.Errorf("incorrect stored device: %+v", stored)
+	}
+
+	// Client IDs are not unique across Users.
+	stored, err = repoMngr.Device().ByClientID(ctx, user.ID, []byte("client-a"))
+	if err != nil {
+		t.Fatal("failed to retrieve device by client ID:", err)
+	}
+	if stored.ID != device.ID {
+		t.Errorf("incorrect device by client ID, want %s got %s", device.ID, stored.ID)
+	}
+
+	devices, err := repoMngr.Device().ByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve devices:", err)
+	}
+	if len(devices) != 2 {
+		t.Errorf("incorrect number of user devices, want 2 got %v", len(devices))
+	}
+
+	devices, err = repoMngr.Device().ByUserID(ctx, "01EJ0000000000000000000000")
+	if err != nil || len(devices) != 0 {
+		t.Errorf("expected no devices and no error for unknown user, got %v, %v", devices, err)
+	}
+
+	_, err = repoMngr.Device().ByID(ctx, "01EJ0000000000000000000000")
+	expectNoRows(t, err, "ByID of a missing device")
+
+	_, err = repoMngr.Device().ByClientID(ctx, other.ID, []byte("client-b"))
+	expectNoRows(t, err, "ByClientID of another user's device")
+}
+
+func testDeviceUpdate(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := createUser(t, repoMngr, "jane@example.com")
+	device := createDevice(t, repoMngr, user.ID, []byte("client-a"))
+
+	device.SignCount = 42
+	device.Name = "Backup key"
+	device.BackedUp = true
+	if err := repoMngr.Device().Update(ctx, device); err != nil {
+		t.Fatal("failed to update device:", err)
+	}
+
+	stored, err := repoMngr.Device().GetForUpdateByClientID(ctx, user.ID, []byte("client-a"))
+	if err != nil {
+		t.Fatal("failed to retrieve device:", err)
+	}
+	if stored.SignCount != 42 || stored.Name != "Backup key" || !stored.BackedUp {
+		t.Errorf("incorrect updated device: %+v", stored)
+	}
+}
+
+func testDeviceRemove(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := createUser(t, repoMngr, "jane@example.com")
+	other := createUser(t, repoMngr, "john@example.com")
+	device := createDevice(t, repoMngr, user.ID, []byte("client-a"))
+
+	err := repoMngr.Device().Remove(ctx, device.ID, other.ID)
+	if auth.ErrorCode(err) != auth.ENotFound {
+		t.Errorf("expected removal by another user to be reported as %s, got %v", auth.ENotFound, err)
+	}
+
+	if err = repoMngr.Device().Remove(ctx, device.ID, user.ID); err != nil {
+		t.Fatal("failed to remove device:", err)
+	}
+
+	_, err = repoMngr.Device().GetForUpdate(ctx, device.ID)
+	expectNoRows(t, err, "GetForUpdate of a removed device")
+}
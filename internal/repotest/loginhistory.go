@@ -0,0 +1,126 @@
+package repotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// RunLoginHistoryRepositoryTests verifies the semantics of a
+// LoginHistoryRepository.
+func RunLoginHistoryRepositoryTests(t *testing.T, newRepo Factory) {
+	run(t, newRepo, "CreateAndRetrieve", testLoginHistoryCreateAndRetrieve)
+	run(t, newRepo, "Revoke", testLoginHistoryRevoke)
+}
+
+func createLogin(t *testing.T, repoMngr auth.RepositoryManager, userID, tokenID string, expiresAt time.Time) *auth.LoginHistory {
+	login := &auth.LoginHistory{
+		UserID:    userID,
+		TokenID:   tokenID,
+		ExpiresAt: expiresAt,
+		IPAddress: "203.0.113.7",
+		Country:   "DE",
+		City:      "Berlin",
+	}
+	if err := repoMngr.LoginHistory().Create(context.Background(), login); err != nil {
+		t.Fatal("failed to create login history:", err)
+	}
+	return login
+}
+
+func testLoginHistoryCreateAndRetrieve(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := createUser(t, repoMngr, "jane@example.com")
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	tokenIDs := []string{"token-a", "token-b", "token-c"}
+	for _, tokenID := range tokenIDs {
+		createLogin(t, repoMngr, user.ID, tokenID, expiresAt)
+		// Logins are ordered by creation time, which must differ.
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	login, err := repoMngr.LoginHistory().ByTokenID(ctx, "token-a")
+	if err != nil {
+		t.Fatal("failed to retrieve login history:", err)
+	}
+	if login.UserID != user.ID || login.IsRevoked || !login.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("incorrect stored login history: %+v", login)
+	}
+	if login.IPAddress != "203.0.113.7" || login.Country != "DE" || login.City != "Berlin" {
+		t.Errorf("incorrect stored login origin: %+v", login)
+	}
+	if login.CreatedAt.IsZero() {
+		t.Error("expected login history creation time to be assigned")
+	}
+
+	logins, err := repoMngr.LoginHistory().ByUserID(ctx, user.ID, 2, 0)
+	if err != nil {
+		t.Fatal("failed to retrieve login history:", err)
+	}
+	if len(logins) != 2 || logins[0].TokenID != "token-c" || logins[1].TokenID != "token-b" {
+		t.Errorf("expected the most recent logins first, got %d logins", len(logins))
+	}
+
+	logins, err = repoMngr.LoginHistory().ByUserID(ctx, user.ID, 2, 2)
+	if err != nil {
+		t.Fatal("failed to retrieve login history:", err)
+	}
+	if len(logins) != 1 || logins[0].TokenID != "token-a" {
+		t.Errorf("expected the oldest login on the last page, got %d logins", len(logins))
+	}
+
+	_, err = repoMngr.LoginHistory().ByTokenID(ctx, "token-z")
+	expectNoRows(t, err, "ByTokenID of a missing login")
+}
+
+func testLoginHistoryRevoke(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := createUser(t, repoMngr, "jane@example.com")
+	createLogin(t, repoMngr, user.ID, "token-a", time.Now().Add(time.Hour))
+	createLogin(t, repoMngr, user.ID, "token-b", time.Now().Add(time.Hour))
+	createLogin(t, repoMngr, user.ID, "token-c", time.Now().Add(-time.Hour))
+
+	count, err := repoMngr.LoginHistory().CountActive(ctx)
+	if err != nil {
+		t.Fatal("failed to count active logins:", err)
+	}
+	if count != 2 {
+		t.Errorf("expected expired logins not to be active, want 2 got %v", count)
+	}
+
+	login, err := repoMngr.LoginHistory().GetForUpdate(ctx, "token-a")
+	if err != nil {
+		t.Fatal("failed to retrieve login history:", err)
+	}
+	login.IsRevoked = true
+	if err = repoMngr.LoginHistory().Update(ctx, login); err != nil {
+		t.Fatal("failed to revoke login:", err)
+	}
+
+	login, err = repoMngr.LoginHistory().ByTokenID(ctx, "token-a")
+	if err != nil {
+		t.Fatal("failed to retrieve login history:", err)
+	}
+	if !login.IsRevoked {
+		t.Error("expected login to be revoked")
+	}
+
+	count, err = repoMngr.LoginHistory().CountActive(ctx)
+	if err != nil {
+		t.Fatal("failed to count active logins:", err)
+	}
+	if count != 1 {
+		t.Errorf("expected revoked logins not to be active, want 1 got %v", count)
+	}
+
+	count, err = repoMngr.LoginHistory().CountActiveByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatal("failed to count active logins of user:", err)
+	}
+	if count != 1 {
+		t.Errorf("incorrect active logins of user, want 1 got %v", count)
+	}
+}
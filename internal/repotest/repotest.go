@@ -0,0 +1,66 @@
+// Package repotest provides conformance tests for implementations of
+// auth.RepositoryManager. Storage backends and external adapters run
+// the suites from their own tests to verify they satisfy the semantics
+// services rely on, beyond the method signatures of the interfaces:
+//
+//	func TestRepositoryManager(t *testing.T) {
+//		repotest.RunRepositoryManagerTests(t, func(t *testing.T) (auth.RepositoryManager, func()) {
+//			db := newTestDB(t)
+//			return NewClient(WithDB(db)), db.Drop
+//		})
+//	}
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// Factory returns an empty RepositoryManager for a test and a function
+// releasing its storage. Each call must return isolated storage as
+// tests run against a fresh RepositoryManager.
+type Factory func(t *testing.T) (auth.RepositoryManager, func())
+
+// RunRepositoryManagerTests runs all conformance suites.
+func RunRepositoryManagerTests(t *testing.T, newRepo Factory) {
+	t.Run("UserRepository", func(t *testing.T) { RunUserRepositoryTests(t, newRepo) })
+	t.Run("DeviceRepository", func(t *testing.T) { RunDeviceRepositoryTests(t, newRepo) })
+	t.Run("LoginHistoryRepository", func(t *testing.T) { RunLoginHistoryRepositoryTests(t, newRepo) })
+	t.Run("Transactions", func(t *testing.T) { RunTransactionTests(t, newRepo) })
+}
+
+// run runs a named test against a fresh RepositoryManager.
+func run(t *testing.T, newRepo Factory, name string, test func(t *testing.T, repoMngr auth.RepositoryManager)) {
+	t.Run(name, func(t *testing.T) {
+		repoMngr, release := newRepo(t)
+		defer release()
+		test(t, repoMngr)
+	})
+}
+
+// createUser creates a verified User with an email address.
+func createUser(t *testing.T, repoMngr auth.RepositoryManager, email string) *auth.User {
+	user := &auth.User{
+		Password:          "swordfish",
+		TFASecret:         "tfa_secret",
+		Email:             sql.NullString{String: email, Valid: true},
+		IsVerified:        true,
+		IsEmailOTPAllowed: true,
+	}
+	if err := repoMngr.User().Create(context.Background(), user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+	return user
+}
+
+// expectNoRows fails a test unless a lookup of a missing entity
+// returned sql.ErrNoRows, which services compare errors against.
+func expectNoRows(t *testing.T, err error, lookup string) {
+	t.Helper()
+	if err != sql.ErrNoRows {
+		t.Errorf("expected %s to return sql.ErrNoRows, got %v", lookup, err)
+	}
+}
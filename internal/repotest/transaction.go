@@ -0,0 +1,124 @@
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// RunTransactionTests verifies that operations within WithAtomic are
+// committed on success and rolled back on failure, and that changes
+// are not visible outside a transaction until committed.
+func RunTransactionTests(t *testing.T, newRepo Factory) {
+	run(t, newRepo, "Commit", testTransactionCommit)
+	run(t, newRepo, "Rollback", testTransactionRollback)
+	run(t, newRepo, "Isolation", testTransactionIsolation)
+	run(t, newRepo, "OutsideTransaction", testTransactionRequired)
+}
+
+func testTransactionCommit(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	txMngr, err := repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		t.Fatal("failed to start transaction:", err)
+	}
+
+	entity, err := txMngr.WithAtomic(func() (interface{}, error) {
+		user := createUser(t, txMngr, "jane@example.com")
+		createDevice(t, txMngr, user.ID, []byte("client-a"))
+		return user, nil
+	})
+	if err != nil {
+		t.Fatal("failed to commit transaction:", err)
+	}
+
+	user, ok := entity.(*auth.User)
+	if !ok {
+		t.Fatalf("expected WithAtomic to return the operation's entity, got %T", entity)
+	}
+
+	if _, err = repoMngr.User().ByIdentity(ctx, "ID", user.ID); err != nil {
+		t.Error("expected committed user to be stored:", err)
+	}
+	if _, err = repoMngr.Device().ByClientID(ctx, user.ID, []byte("client-a")); err != nil {
+		t.Error("expected committed device to be stored:", err)
+	}
+}
+
+func testTransactionRollback(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := createUser(t, repoMngr, "jane@example.com")
+
+	txMngr, err := repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		t.Fatal("failed to start transaction:", err)
+	}
+
+	errOperation := errors.New("operation failed")
+	_, err = txMngr.WithAtomic(func() (interface{}, error) {
+		stored, err := txMngr.User().GetForUpdate(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		stored.Phone = sql.NullString{String: "+6594867353", Valid: true}
+		if err = txMngr.User().Update(ctx, stored); err != nil {
+			return nil, err
+		}
+		createUser(t, txMngr, "john@example.com")
+		return nil, errOperation
+	})
+	if !errors.Is(err, errOperation) {
+		t.Errorf("expected WithAtomic to return the operation's error, got %v", err)
+	}
+
+	stored, err := repoMngr.User().ByIdentity(ctx, "ID", user.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve user:", err)
+	}
+	if stored.Phone.Valid {
+		t.Error("expected update to be rolled back")
+	}
+
+	_, err = repoMngr.User().ByIdentity(ctx, "Email", "john@example.com")
+	expectNoRows(t, err, "ByIdentity of a user created in a rolled back transaction")
+}
+
+func testTransactionIsolation(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	txMngr, err := repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		t.Fatal("failed to start transaction:", err)
+	}
+
+	_, err = txMngr.WithAtomic(func() (interface{}, error) {
+		user := createUser(t, txMngr, "jane@example.com")
+
+		if _, err := txMngr.User().ByIdentity(ctx, "ID", user.ID); err != nil {
+			t.Error("expected uncommitted user to be visible within the transaction:", err)
+		}
+
+		_, err := repoMngr.User().ByIdentity(ctx, "Email", "jane@example.com")
+		expectNoRows(t, err, "ByIdentity of an uncommitted user outside the transaction")
+		return user, nil
+	})
+	if err != nil {
+		t.Fatal("failed to commit transaction:", err)
+	}
+}
+
+func testTransactionRequired(t *testing.T, repoMngr auth.RepositoryManager) {
+	var called bool
+	_, err := repoMngr.WithAtomic(func() (interface{}, error) {
+		called = true
+		return nil, nil
+	})
+	if err == nil {
+		t.Error("expected WithAtomic outside a transaction to be rejected")
+	}
+	if called {
+		t.Error("expected operation not to run outside a transaction")
+	}
+}
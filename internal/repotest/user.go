@@ -0,0 +1,279 @@
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// RunUserRepositoryTests verifies the semantics of a UserRepository.
+func RunUserRepositoryTests(t *testing.T, newRepo Factory) {
+	run(t, newRepo, "Create", testUserCreate)
+	run(t, newRepo, "CreateValidation", testUserCreateValidation)
+	run(t, newRepo, "ByIdentity", testUserByIdentity)
+	run(t, newRepo, "Update", testUserUpdate)
+	run(t, newRepo, "ReCreate", testUserReCreate)
+	run(t, newRepo, "List", testUserList)
+	run(t, newRepo, "DisableOTP", testUserDisableOTP)
+	run(t, newRepo, "RemoveDeliveryMethod", testUserRemoveDeliveryMethod)
+}
+
+func testUserCreate(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := &auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Phone:     sql.NullString{String: "+6594867353", Valid: true},
+		Email:     sql.NullString{String: "Jane@Example.com", Valid: true},
+	}
+	if err := repoMngr.User().Create(ctx, user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	if user.ID == "" {
+		t.Error("expected user ID to be assigned")
+	}
+	if user.CreatedAt.IsZero() || user.UpdatedAt.IsZero() {
+		t.Error("expected user timestamps to be assigned")
+	}
+	if !user.IsPhoneOTPAllowed || !user.IsEmailOTPAllowed {
+		t.Error("expected OTP to be enabled for the user's phone and email")
+	}
+
+	stored, err := repoMngr.User().ByIdentity(ctx, "ID", user.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve user:", err)
+	}
+	if stored.Email.String != "jane@example.com" {
+		t.Errorf("expected email to be stored in lowercase, got %s", stored.Email.String)
+	}
+	if stored.Phone.String != "+6594867353" || stored.TFASecret != "tfa_secret" {
+		t.Errorf("incorrect stored user: %+v", stored)
+	}
+	if stored.IsVerified {
+		t.Error("expected user to be unverified")
+	}
+
+	duplicates := []*auth.User{
+		{
+			Password: "swordfish",
+			Email:    sql.NullString{String: "jane@example.com", Valid: true},
+		},
+		{
+			Password: "swordfish",
+			Phone:    sql.NullString{String: "+6594867353", Valid: true},
+		},
+	}
+	for _, duplicate := range duplicates {
+		if err = repoMngr.User().Create(ctx, duplicate); err == nil {
+			t.Errorf("expected duplicate user to be rejected: %+v", duplicate)
+		}
+	}
+}
+
+func testUserCreateValidation(t *testing.T, repoMngr auth.RepositoryManager) {
+	invalid := []*auth.User{
+		{Password: "swordfish"},
+		{Password: "swordfish", Email: sql.NullString{String: "jane", Valid: true}},
+		{Password: "swordfish", Phone: sql.NullString{String: "not-a-phone", Valid: true}},
+	}
+	for _, user := range invalid {
+		err := repoMngr.User().Create(context.Background(), user)
+		if auth.ErrorCode(err) != auth.EInvalidField {
+			t.Errorf("expected invalid user to be rejected with %s, got %v", auth.EInvalidField, err)
+		}
+	}
+}
+
+func testUserByIdentity(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := &auth.User{
+		Password:  "swordfish",
+		TFASecret: "tfa_secret",
+		Phone:     sql.NullString{String: "+6594867353", Valid: true},
+		Email:     sql.NullString{String: "jane@example.com", Valid: true},
+	}
+	if err := repoMngr.User().Create(ctx, user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+
+	lookups := []struct {
+		attribute string
+		value     string
+	}{
+		{attribute: "ID", value: user.ID},
+		{attribute: "Phone", value: "+6594867353"},
+		{attribute: "Email", value: "jane@example.com"},
+		{attribute: "Email", value: "JANE@Example.com"},
+	}
+	for _, l := range lookups {
+		found, err := repoMngr.User().ByIdentity(ctx, l.attribute, l.value)
+		if err != nil {
+			t.Errorf("failed to retrieve user by %s %q: %v", l.attribute, l.value, err)
+			continue
+		}
+		if found.ID != user.ID {
+			t.Errorf("incorrect user by %s %q, want %s got %s", l.attribute, l.value, user.ID, found.ID)
+		}
+	}
+
+	_, err := repoMngr.User().ByIdentity(ctx, "Email", "john@example.com")
+	expectNoRows(t, err, "ByIdentity of a missing user")
+
+	_, err = repoMngr.User().GetForUpdate(ctx, "01EJ0000000000000000000000")
+	expectNoRows(t, err, "GetForUpdate of a missing user")
+
+	if _, err = repoMngr.User().ByIdentity(ctx, "Password", "swordfish"); err == nil {
+		t.Error("expected lookup by unsupported attribute to be rejected")
+	}
+}
+
+func testUserUpdate(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := createUser(t, repoMngr, "jane@example.com")
+	createdAt := user.CreatedAt
+
+	user.Phone = sql.NullString{String: "+6594867353", Valid: true}
+	user.IsPhoneOTPAllowed = true
+	user.IsTOTPAllowed = true
+	user.TFASecret = "new_tfa_secret"
+	if err := repoMngr.User().Update(ctx, user); err != nil {
+		t.Fatal("failed to update user:", err)
+	}
+
+	stored, err := repoMngr.User().ByIdentity(ctx, "Phone", "+6594867353")
+	if err != nil {
+		t.Fatal("failed to retrieve user by updated phone:", err)
+	}
+	if stored.ID != user.ID || !stored.IsPhoneOTPAllowed || !stored.IsTOTPAllowed ||
+		stored.TFASecret != "new_tfa_secret" {
+		t.Errorf("incorrect updated user: %+v", stored)
+	}
+	if !stored.CreatedAt.Equal(createdAt) {
+		t.Errorf("expected creation time to be kept, want %v got %v", createdAt, stored.CreatedAt)
+	}
+
+	other := createUser(t, repoMngr, "john@example.com")
+	other.Email = sql.NullString{String: "jane@example.com", Valid: true}
+	if err = repoMngr.User().Update(ctx, other); err == nil {
+		t.Error("expected update to another user's email to be rejected")
+	}
+}
+
+func testUserReCreate(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := &auth.User{
+		Password: "swordfish",
+		Email:    sql.NullString{String: "jane@example.com", Valid: true},
+	}
+	if err := repoMngr.User().Create(ctx, user); err != nil {
+		t.Fatal("failed to create user:", err)
+	}
+	oldID := user.ID
+
+	if err := repoMngr.User().ReCreate(ctx, user); err != nil {
+		t.Fatal("failed to re-create unverified user:", err)
+	}
+	if user.ID == oldID {
+		t.Error("expected re-created user to be assigned a new ID")
+	}
+
+	_, err := repoMngr.User().ByIdentity(ctx, "ID", oldID)
+	expectNoRows(t, err, "ByIdentity of a re-created user's previous ID")
+
+	found, err := repoMngr.User().ByIdentity(ctx, "Email", "jane@example.com")
+	if err != nil {
+		t.Fatal("failed to retrieve re-created user:", err)
+	}
+	if found.ID != user.ID {
+		t.Errorf("incorrect re-created user, want %s got %s", user.ID, found.ID)
+	}
+
+	verified := createUser(t, repoMngr, "john@example.com")
+	if err = repoMngr.User().ReCreate(ctx, verified); err == nil {
+		t.Error("expected re-creation of a verified user to be rejected")
+	}
+}
+
+func testUserList(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	var ids []string
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		ids = append(ids, createUser(t, repoMngr, email).ID)
+	}
+	sort.Strings(ids)
+
+	var listed []string
+	afterID := ""
+	for _, size := range []int{2, 1, 0} {
+		page, err := repoMngr.User().List(ctx, afterID, 2)
+		if err != nil {
+			t.Fatal("failed to list users:", err)
+		}
+		if len(page) != size {
+			t.Fatalf("incorrect page size, want %v got %v", size, len(page))
+		}
+		for _, user := range page {
+			listed = append(listed, user.ID)
+			afterID = user.ID
+		}
+	}
+
+	if strings.Join(listed, ",") != strings.Join(ids, ",") {
+		t.Errorf("expected users to be listed once ordered by ID, want %v got %v", ids, listed)
+	}
+}
+
+func testUserDisableOTP(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := createUser(t, repoMngr, "jane@example.com")
+
+	_, err := repoMngr.User().DisableOTP(ctx, user.ID, auth.Email)
+	if auth.ErrorCode(err) != auth.EInvalidField {
+		t.Errorf("expected disabling the last 2FA method to be rejected, got %v", err)
+	}
+
+	user.IsTOTPAllowed = true
+	if err = repoMngr.User().Update(ctx, user); err != nil {
+		t.Fatal("failed to update user:", err)
+	}
+
+	updated, err := repoMngr.User().DisableOTP(ctx, user.ID, auth.Email)
+	if err != nil {
+		t.Fatal("failed to disable email OTP:", err)
+	}
+	if updated.IsEmailOTPAllowed || !updated.Email.Valid {
+		t.Errorf("expected email OTP to be disabled and email kept: %+v", updated)
+	}
+}
+
+func testUserRemoveDeliveryMethod(t *testing.T, repoMngr auth.RepositoryManager) {
+	ctx := context.Background()
+	user := createUser(t, repoMngr, "jane@example.com")
+
+	_, err := repoMngr.User().RemoveDeliveryMethod(ctx, user.ID, auth.Email)
+	if auth.ErrorCode(err) != auth.EInvalidField {
+		t.Errorf("expected removing the last contact address to be rejected, got %v", err)
+	}
+
+	user.Phone = sql.NullString{String: "+6594867353", Valid: true}
+	user.IsPhoneOTPAllowed = true
+	if err = repoMngr.User().Update(ctx, user); err != nil {
+		t.Fatal("failed to update user:", err)
+	}
+
+	updated, err := repoMngr.User().RemoveDeliveryMethod(ctx, user.ID, auth.Email)
+	if err != nil {
+		t.Fatal("failed to remove email:", err)
+	}
+	if updated.Email.Valid || updated.IsEmailOTPAllowed {
+		t.Errorf("expected email to be removed: %+v", updated)
+	}
+
+	_, err = repoMngr.User().ByIdentity(ctx, "Email", "jane@example.com")
+	expectNoRows(t, err, "ByIdentity of a removed email")
+}
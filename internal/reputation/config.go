@@ -0,0 +1,86 @@
+package reputation
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const (
+	defaultInterval = time.Hour
+	defaultCacheTTL = time.Hour
+)
+
+// NewService returns a new NetworkReputation. Without lists or an
+// API, no IP address is classified.
+func NewService(options ...ConfigOption) auth.NetworkReputation {
+	s := service{
+		logger:   log.NewNopLogger(),
+		client:   http.DefaultClient,
+		interval: defaultInterval,
+		cacheTTL: defaultCacheTTL,
+		cache:    map[string]cacheEntry{},
+		now:      time.Now,
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithClient configures the HTTP client used to retrieve lists
+// and query the API.
+func WithClient(c *http.Client) ConfigOption {
+	return func(s *service) {
+		s.client = c
+	}
+}
+
+// WithList configures a downloadable list of IP addresses and CIDR
+// ranges belonging to a class of network, e.g. the Tor bulk exit
+// list. Lists are retrieved by Run.
+func WithList(class auth.NetworkClass, url string) ConfigOption {
+	return func(s *service) {
+		if url != "" {
+			s.lists = append(s.lists, &list{class: class, url: url})
+		}
+	}
+}
+
+// WithAPI configures a third-party API queried for IP addresses
+// not found in any list.
+func WithAPI(url, apiKey string) ConfigOption {
+	return func(s *service) {
+		s.apiURL = url
+		s.apiKey = apiKey
+	}
+}
+
+// WithInterval sets the interval to refresh lists.
+func WithInterval(interval time.Duration) ConfigOption {
+	return func(s *service) {
+		s.interval = interval
+	}
+}
+
+// WithCacheTTL sets how long API results are cached.
+func WithCacheTTL(ttl time.Duration) ConfigOption {
+	return func(s *service) {
+		s.cacheTTL = ttl
+	}
+}
@@ -0,0 +1,257 @@
+// Package reputation classifies IP addresses belonging to Tor, VPN
+// and proxy networks from downloadable lists and third-party APIs.
+package reputation
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// maxListSize is the maximum size of a list we accept.
+const maxListSize = 32 << 20
+
+// maxCacheSize is the maximum number of API results held in memory.
+const maxCacheSize = 10000
+
+// list is a downloadable list of networks of a class.
+type list struct {
+	class auth.NetworkClass
+	url   string
+	ips   map[string]bool
+	nets  []*net.IPNet
+}
+
+// contains reports whether an IP address is listed.
+func (l *list) contains(ip net.IP) bool {
+	if l.ips[ip.String()] {
+		return true
+	}
+	for _, n := range l.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiResponse is the response expected from a third-party API.
+type apiResponse struct {
+	Tor   bool `json:"tor"`
+	VPN   bool `json:"vpn"`
+	Proxy bool `json:"proxy"`
+}
+
+type cacheEntry struct {
+	class     auth.NetworkClass
+	expiresAt time.Time
+}
+
+// service is an implementation of auth.NetworkReputation. Lists are
+// held in memory between refreshes and API results are cached.
+type service struct {
+	logger   log.Logger
+	client   *http.Client
+	interval time.Duration
+	apiURL   string
+	apiKey   string
+	cacheTTL time.Duration
+	now      func() time.Time
+
+	mu    sync.RWMutex
+	lists []*list
+	cache map[string]cacheEntry
+}
+
+// Classify returns the class of network an IP address belongs to.
+// Lists are checked before the API.
+func (s *service) Classify(ctx context.Context, ip string) (auth.NetworkClass, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", nil
+	}
+
+	s.mu.RLock()
+	for _, l := range s.lists {
+		if l.contains(addr) {
+			s.mu.RUnlock()
+			return l.class, nil
+		}
+	}
+	entry, ok := s.cache[addr.String()]
+	s.mu.RUnlock()
+
+	if s.apiURL == "" {
+		return "", nil
+	}
+	if ok && s.now().Before(entry.expiresAt) {
+		return entry.class, nil
+	}
+
+	class, err := s.query(ctx, addr.String())
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	if len(s.cache) >= maxCacheSize {
+		s.cache = map[string]cacheEntry{}
+	}
+	s.cache[addr.String()] = cacheEntry{class: class, expiresAt: s.now().Add(s.cacheTTL)}
+	s.mu.Unlock()
+
+	return class, nil
+}
+
+// query classifies an IP address through the third-party API. The
+// address is passed as the `ip` query parameter and the API key, if
+// any, as a bearer token.
+func (s *service) query(ctx context.Context, ip string) (auth.NetworkClass, error) {
+	u, err := url.Parse(s.apiURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid reputation API URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("ip", ip)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create reputation request: %w", err)
+	}
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("reputation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reputation request failed: status %d", resp.StatusCode)
+	}
+
+	var result apiResponse
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid reputation response: %w", err)
+	}
+
+	switch {
+	case result.Tor:
+		return auth.NetworkTor, nil
+	case result.VPN:
+		return auth.NetworkVPN, nil
+	case result.Proxy:
+		return auth.NetworkProxy, nil
+	default:
+		return "", nil
+	}
+}
+
+// Run refreshes lists on start and then periodically until the
+// context is cancelled.
+func (s *service) Run(ctx context.Context) error {
+	if len(s.lists) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh retrieves all lists. A list which fails to be retrieved
+// is logged and its previous entries remain in use.
+func (s *service) Refresh(ctx context.Context) {
+	for _, l := range s.lists {
+		ips, nets, err := s.fetch(ctx, l.url)
+		if err != nil {
+			level.Error(s.logger).Log(
+				"source", "NetworkReputation.Refresh",
+				"message", "failed to refresh network list",
+				"class", l.class,
+				"error", err,
+			)
+			continue
+		}
+
+		s.mu.Lock()
+		l.ips = ips
+		l.nets = nets
+		s.mu.Unlock()
+
+		level.Info(s.logger).Log(
+			"source", "NetworkReputation.Refresh",
+			"message", "refreshed network list",
+			"class", l.class,
+			"entries", len(ips)+len(nets),
+		)
+	}
+}
+
+// fetch retrieves a list of IP addresses and CIDR ranges, one per
+// line. Blank lines, comments starting with `#` and text following
+// the first field of a line are ignored.
+func (s *service) fetch(ctx context.Context, listURL string) (map[string]bool, []*net.IPNet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, listURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create list request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot retrieve list: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("cannot retrieve list: status %d", resp.StatusCode)
+	}
+
+	ips := map[string]bool{}
+	var nets []*net.IPNet
+
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxListSize))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if _, n, err := net.ParseCIDR(fields[0]); err == nil {
+			nets = append(nets, n)
+		} else if ip := net.ParseIP(fields[0]); ip != nil {
+			ips[ip.String()] = true
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("cannot read list: %w", err)
+	}
+
+	return ips, nets, nil
+}
@@ -0,0 +1,131 @@
+package reputation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestReputationSvc_ClassifyLists(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tor":
+			fmt.Fprint(w, "# Tor exit nodes\n198.51.100.7\n\n2001:db8::7\n")
+		case "/vpn":
+			fmt.Fprint(w, "203.0.113.0/24 Example VPN\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	s := NewService(
+		WithLogger(&test.Logger{}),
+		WithClient(srv.Client()),
+		WithList(auth.NetworkTor, srv.URL+"/tor"),
+		WithList(auth.NetworkVPN, srv.URL+"/vpn"),
+		WithList(auth.NetworkProxy, srv.URL+"/missing"),
+	).(*service)
+	s.Refresh(context.Background())
+
+	tt := []struct {
+		ip    string
+		class auth.NetworkClass
+	}{
+		{"198.51.100.7", auth.NetworkTor},
+		{"2001:db8::7", auth.NetworkTor},
+		{"203.0.113.42", auth.NetworkVPN},
+		{"192.0.2.1", ""},
+		{"invalid", ""},
+	}
+
+	for _, tc := range tt {
+		class, err := s.Classify(context.Background(), tc.ip)
+		if err != nil {
+			t.Error("expected nil error:", err)
+		}
+		if class != tc.class {
+			t.Errorf("incorrect class for %s, want %q got %q", tc.ip, tc.class, class)
+		}
+	}
+}
+
+func TestReputationSvc_ClassifyAPI(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("ip") {
+		case "198.51.100.7":
+			fmt.Fprint(w, `{"tor": true, "proxy": true}`)
+		case "203.0.113.42":
+			fmt.Fprint(w, `{"vpn": true}`)
+		case "192.0.2.1":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	s := NewService(
+		WithClient(srv.Client()),
+		WithAPI(srv.URL+"/check", "api-key"),
+		WithCacheTTL(time.Minute),
+	).(*service)
+	s.now = func() time.Time { return now }
+
+	tt := []struct {
+		ip       string
+		class    auth.NetworkClass
+		hasError bool
+	}{
+		{ip: "198.51.100.7", class: auth.NetworkTor},
+		{ip: "203.0.113.42", class: auth.NetworkVPN},
+		{ip: "198.51.100.8", class: ""},
+		{ip: "192.0.2.1", hasError: true},
+	}
+
+	for _, tc := range tt {
+		class, err := s.Classify(context.Background(), tc.ip)
+		if tc.hasError != (err != nil) {
+			t.Errorf("incorrect error for %s, want error %v got %v", tc.ip, tc.hasError, err)
+		}
+		if class != tc.class {
+			t.Errorf("incorrect class for %s, want %q got %q", tc.ip, tc.class, class)
+		}
+	}
+
+	if _, err := s.Classify(context.Background(), "198.51.100.7"); err != nil {
+		t.Error("expected nil error:", err)
+	}
+	if requests != 4 {
+		t.Errorf("expected cached result, want 4 requests got %d", requests)
+	}
+
+	now = now.Add(time.Minute * 2)
+	if _, err := s.Classify(context.Background(), "198.51.100.7"); err != nil {
+		t.Error("expected nil error:", err)
+	}
+	if requests != 5 {
+		t.Errorf("expected expired result to be queried, want 5 requests got %d", requests)
+	}
+}
+
+func TestReputationSvc_Disabled(t *testing.T) {
+	s := NewService()
+	class, err := s.Classify(context.Background(), "198.51.100.7")
+	if err != nil || class != "" {
+		t.Errorf("expected no classification, got %q %v", class, err)
+	}
+}
@@ -0,0 +1,160 @@
+package securityapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+func TestSecurityAPI_Settings(t *testing.T) {
+	loginAt := time.Date(2020, 8, 10, 0, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		name       string
+		statusCode int
+		authHeader bool
+		errMessage string
+		logins     []*auth.LoginHistory
+		lastLogin  *time.Time
+	}{
+		{
+			name:       "Authentication error with no token",
+			statusCode: http.StatusUnauthorized,
+			authHeader: false,
+			errMessage: "User is not authenticated",
+		},
+		{
+			name:       "Excludes current session from last login",
+			statusCode: http.StatusOK,
+			authHeader: true,
+			logins: []*auth.LoginHistory{
+				{TokenID: "token-id", CreatedAt: loginAt.Add(time.Hour)},
+				{TokenID: "previous-token-id", CreatedAt: loginAt},
+			},
+			lastLogin: &loginAt,
+		},
+		{
+			name:       "First login",
+			statusCode: http.StatusOK,
+			authHeader: true,
+			logins: []*auth.LoginHistory{
+				{TokenID: "token-id", CreatedAt: loginAt},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return &test.UserRepository{
+						ByIdentityFn: func() (*auth.User, error) {
+							return &auth.User{
+								Email:             sql.NullString{String: "jane@example.com", Valid: true},
+								Password:          "password-hash",
+								IsEmailOTPAllowed: true,
+								IsDeviceAllowed:   true,
+								IsVerified:        true,
+							}, nil
+						},
+					}
+				},
+				DeviceFn: func() auth.DeviceRepository {
+					return &test.DeviceRepository{
+						ByUserIDFn: func() ([]*auth.Device, error) {
+							return []*auth.Device{{ID: "device-id", Name: "Yubikey"}}, nil
+						},
+					}
+				},
+				LoginHistoryFn: func() auth.LoginHistoryRepository {
+					return &test.LoginHistoryRepository{
+						ByUserIDFn: func() ([]*auth.LoginHistory, error) {
+							return tc.logins, nil
+						},
+						CountActiveByUserIDFn: func() (int64, error) {
+							return 2, nil
+						},
+					}
+				},
+			}
+			tokenSvc := &test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					return &auth.Token{
+						UserID:         "user-id",
+						State:          auth.JWTAuthorized,
+						StandardClaims: jwt.StandardClaims{Id: "token-id"},
+					}, nil
+				},
+			}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+			)
+
+			req, err := http.NewRequest("GET", "/api/v1/me/security", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			if tc.authHeader {
+				test.SetAuthHeaders(req)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+
+			if tc.statusCode != http.StatusOK {
+				err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+
+			var resp settingsResponse
+			if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal("failed to decode response:", err)
+			}
+
+			if !resp.Factors.Password || !resp.Factors.Device || resp.Factors.TOTP {
+				t.Errorf("incorrect factors: %+v", resp.Factors)
+			}
+			if resp.Contacts.Email != "jane@example.com" || !resp.Contacts.Verified {
+				t.Errorf("incorrect contacts: %+v", resp.Contacts)
+			}
+			if len(resp.Devices) != 1 {
+				t.Errorf("incorrect device count, want 1 got %v", len(resp.Devices))
+			}
+			if resp.ActiveSessions != 2 {
+				t.Errorf("incorrect active sessions, want 2 got %v", resp.ActiveSessions)
+			}
+			if tc.lastLogin == nil && resp.LastLogin != nil {
+				t.Errorf("expected no last login, got %v", resp.LastLogin.CreatedAt)
+			}
+			if tc.lastLogin != nil && (resp.LastLogin == nil || !resp.LastLogin.CreatedAt.Equal(*tc.lastLogin)) {
+				t.Errorf("incorrect last login, want %v got %+v", tc.lastLogin, resp.LastLogin)
+			}
+		})
+	}
+}
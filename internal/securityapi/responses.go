@@ -0,0 +1,93 @@
+package securityapi
+
+import (
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// factorsResponse describes the factors a User may log in with.
+type factorsResponse struct {
+	Password   bool            `json:"password"`
+	TOTP       bool            `json:"totp"`
+	Device     bool            `json:"device"`
+	OTPEmail   bool            `json:"otpEmail"`
+	OTPPhone   bool            `json:"otpPhone"`
+	DefaultTFA auth.TFAOptions `json:"defaultTFA"`
+}
+
+// contactsResponse describes a User's contact addresses.
+type contactsResponse struct {
+	Email    string `json:"email,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	Verified bool   `json:"verified"`
+}
+
+// deviceResponse describes a registered WebAuthn device.
+type deviceResponse struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	BackupEligible bool      `json:"backupEligible"`
+	BackedUp       bool      `json:"backedUp"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// loginResponse describes a User's previous login.
+type loginResponse struct {
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	IsRevoked bool      `json:"isRevoked"`
+	IPAddress string    `json:"ipAddress,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	City      string    `json:"city,omitempty"`
+}
+
+// settingsResponse is a success response for SecurityAPI.Settings.
+type settingsResponse struct {
+	Factors        factorsResponse  `json:"factors"`
+	Contacts       contactsResponse `json:"contacts"`
+	Devices        []deviceResponse `json:"devices"`
+	ActiveSessions int64            `json:"activeSessions"`
+	LastLogin      *loginResponse   `json:"lastLogin"`
+}
+
+// Create populates a settingsResponse. LastLogin is nil if the
+// User has not logged in before the current session.
+func (r *settingsResponse) Create(user *auth.User, devices []*auth.Device, sessions int64, lastLogin *auth.LoginHistory) {
+	r.Factors = factorsResponse{
+		Password:   user.Password != "",
+		TOTP:       user.IsTOTPAllowed,
+		Device:     user.IsDeviceAllowed,
+		OTPEmail:   user.IsEmailOTPAllowed,
+		OTPPhone:   user.IsPhoneOTPAllowed,
+		DefaultTFA: user.DefaultTFA(),
+	}
+	r.Contacts = contactsResponse{
+		Email:    user.Email.String,
+		Phone:    user.Phone.String,
+		Verified: user.IsVerified,
+	}
+
+	r.Devices = []deviceResponse{}
+	for _, d := range devices {
+		r.Devices = append(r.Devices, deviceResponse{
+			ID:             d.ID,
+			Name:           d.Name,
+			BackupEligible: d.BackupEligible,
+			BackedUp:       d.BackedUp,
+			CreatedAt:      d.CreatedAt,
+		})
+	}
+
+	r.ActiveSessions = sessions
+	if lastLogin != nil {
+		r.LastLogin = &loginResponse{
+			CreatedAt: lastLogin.CreatedAt,
+			ExpiresAt: lastLogin.ExpiresAt,
+			IsRevoked: lastLogin.IsRevoked,
+			IPAddress: lastLogin.IPAddress,
+			Country:   lastLogin.Country,
+			City:      lastLogin.City,
+		}
+	}
+}
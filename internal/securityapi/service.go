@@ -0,0 +1,59 @@
+// Package securityapi provides an HTTP API summarizing the security
+// settings of a User's account.
+package securityapi
+
+import (
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+type service struct {
+	logger   log.Logger
+	repoMngr auth.RepositoryManager
+}
+
+// Settings returns a User's enabled factors, contact addresses,
+// WebAuthn devices, active session count and previous login, so
+// a security settings page can be rendered from a single request.
+func (s *service) Settings(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+	tokenID := httpapi.GetToken(r).Id
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := s.repoMngr.Device().ByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.repoMngr.LoginHistory().CountActiveByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The current session is excluded from the previous login.
+	logins, err := s.repoMngr.LoginHistory().ByUserID(ctx, userID, 2, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastLogin *auth.LoginHistory
+	for _, l := range logins {
+		if l.TokenID != tokenID {
+			lastLogin = l
+			break
+		}
+	}
+
+	resp := settingsResponse{}
+	resp.Create(user, devices, sessions, lastLogin)
+	return &resp, nil
+}
@@ -0,0 +1,87 @@
+package securitychange
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
+)
+
+const defaultChangeWindow = time.Hour * 72
+
+// NewService returns a new SecurityChangeService.
+func NewService(options ...ConfigOption) auth.SecurityChangeService {
+	s := service{
+		logger:       log.NewNopLogger(),
+		changeWindow: defaultChangeWindow,
+		clock:        clock.New(),
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithClock configures the service with a clock used to delay
+// changes. Defaults to the system clock.
+func WithClock(c clock.Clock) ConfigOption {
+	return func(s *service) {
+		s.clock = c
+	}
+}
+
+// WithMessaging configures the service with a MessagingService to
+// notify Users of pending changes.
+func WithMessaging(m auth.MessagingService) ConfigOption {
+	return func(s *service) {
+		s.message = m
+	}
+}
+
+// WithActionTokens configures the service with an ActionTokenService
+// to issue links cancelling pending changes.
+func WithActionTokens(a auth.ActionTokenService) ConfigOption {
+	return func(s *service) {
+		s.actionTokens = a
+	}
+}
+
+// WithDB configures the service with a Redis DB to store
+// pending changes.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithCancelURL configures the URL delivered to Users to cancel a
+// pending change. The token is set as the `token` query parameter.
+func WithCancelURL(u string) ConfigOption {
+	return func(s *service) {
+		s.cancelURL = u
+	}
+}
+
+// WithChangeDelay configures the time before a change takes effect
+// and the window after the delay in which it may be applied. Changes
+// are not delayed if the delay is 0.
+func WithChangeDelay(delay, window time.Duration) ConfigOption {
+	return func(s *service) {
+		s.changeDelay = delay
+		s.changeWindow = window
+	}
+}
@@ -0,0 +1,218 @@
+// Package securitychange delays sensitive changes to a User's account,
+// such as changing their email address or removing their last 2FA
+// method, and notifies the User with a link to cancel them.
+package securitychange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
+	"github.com/fmitra/authenticator/internal/crypto"
+	tokenLib "github.com/fmitra/authenticator/internal/token"
+)
+
+const (
+	// StatusPending is the status of a change awaiting its delay.
+	StatusPending = "pending"
+	// StatusApplied is the status of a change which took effect.
+	StatusApplied = "applied"
+	// StatusCancelled is the status of a cancelled change.
+	StatusCancelled = "cancelled"
+)
+
+// Response describes the status of a delayed security change.
+// An applied change includes a token reflecting the User's profile.
+type Response struct {
+	Status      string                  `json:"status"`
+	Change      auth.SecurityChangeType `json:"change"`
+	AvailableAt *time.Time              `json:"availableAt,omitempty"`
+	*tokenLib.Response
+}
+
+// NewPendingResponse returns a Response for a change
+// awaiting its delay.
+func NewPendingResponse(change *auth.PendingChange) *Response {
+	return &Response{
+		Status:      StatusPending,
+		Change:      change.Type,
+		AvailableAt: &change.AvailableAt,
+	}
+}
+
+// rediser is a minimal interface for go-redis.
+type rediser interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+}
+
+// service is an implementation of auth.SecurityChangeService
+// backed by redis.
+type service struct {
+	logger       log.Logger
+	clock        clock.Clock
+	message      auth.MessagingService
+	actionTokens auth.ActionTokenService
+	db           rediser
+	cancelURL    string
+	changeDelay  time.Duration
+	changeWindow time.Duration
+}
+
+// IsEnabled returns true if the service is configured to
+// delay security changes.
+func (s *service) IsEnabled() bool {
+	return s.changeDelay > 0 && s.db != nil && s.cancelURL != ""
+}
+
+// Delay stores a pending security change and notifies the User at the
+// address affected by the change with a link to cancel it. Changes
+// which do not affect an address are notified to the User's email
+// address, or phone number if they have none.
+func (s *service) Delay(ctx context.Context, user *auth.User, change *auth.PendingChange) error {
+	existing, err := s.Pending(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return auth.ErrBadRequest("a security change is already pending")
+	}
+
+	if change.DeliveryMethod == "" {
+		change.DeliveryMethod = auth.Email
+		if !user.Email.Valid {
+			change.DeliveryMethod = auth.Phone
+		}
+	}
+
+	change.ID, err = crypto.String(32)
+	if err != nil {
+		return fmt.Errorf("cannot create security change ID: %w", err)
+	}
+	change.AvailableAt = s.clock.Now().Add(s.changeDelay)
+
+	b, err := json.Marshal(change)
+	if err != nil {
+		return fmt.Errorf("cannot encode security change: %w", err)
+	}
+
+	if err = s.db.Set(ctx, ChangeKey(user.ID), b, s.changeDelay+s.changeWindow).Err(); err != nil {
+		return fmt.Errorf("cannot store security change: %w", err)
+	}
+
+	cancelToken, err := s.actionTokens.Issue(ctx, user.ID, auth.PurposeCancelChange, map[string]string{
+		"change_id": change.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(s.cancelURL)
+	if err != nil {
+		return fmt.Errorf("invalid security change cancel URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", cancelToken)
+	link.RawQuery = query.Encode()
+
+	address := user.Email.String
+	if change.DeliveryMethod == auth.Phone {
+		address = user.Phone.String
+	}
+
+	msg := &auth.Message{
+		Type:     auth.SecurityChange,
+		Delivery: change.DeliveryMethod,
+		Address:  address,
+		Vars: map[string]string{
+			"change":       describe(change),
+			"link":         link.String(),
+			"available_at": change.AvailableAt.UTC().Format(time.RFC1123),
+		},
+	}
+	return s.message.Send(ctx, msg)
+}
+
+// Pending returns a User's pending security change or nil if no
+// change is pending.
+func (s *service) Pending(ctx context.Context, userID string) (*auth.PendingChange, error) {
+	b, err := s.db.Get(ctx, ChangeKey(userID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve security change: %w", err)
+	}
+
+	var change auth.PendingChange
+	if err = json.Unmarshal(b, &change); err != nil {
+		return nil, fmt.Errorf("invalid security change: %w", err)
+	}
+	return &change, nil
+}
+
+// Remove removes a User's pending security change. A change may
+// only be removed once.
+func (s *service) Remove(ctx context.Context, userID string) (bool, error) {
+	removed, err := s.db.Del(ctx, ChangeKey(userID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("cannot remove security change: %w", err)
+	}
+	return removed > 0, nil
+}
+
+// Cancel cancels a pending security change with the token delivered
+// to the User. Tokens of previous changes may not cancel a newer change.
+func (s *service) Cancel(ctx context.Context, signedToken string) (*auth.PendingChange, error) {
+	cancelToken, err := s.actionTokens.Parse(ctx, signedToken, auth.PurposeCancelChange)
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := s.Pending(ctx, cancelToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if change == nil || change.ID != cancelToken.Data["change_id"] {
+		return nil, auth.ErrBadRequest("no security change is pending")
+	}
+
+	if err = s.actionTokens.Redeem(ctx, cancelToken); err != nil {
+		return nil, err
+	}
+
+	if _, err = s.Remove(ctx, cancelToken.UserID); err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// describe returns a description of a change for notifications.
+func describe(c *auth.PendingChange) string {
+	switch c.Type {
+	case auth.ChangeEmail:
+		return fmt.Sprintf("change your email address to %s", c.Address)
+	case auth.ChangeDisableOTP:
+		return fmt.Sprintf("stop sending login codes to your %s", c.DeliveryMethod)
+	case auth.ChangeRemoveDevice:
+		return "remove your last security key from your account"
+	case auth.ChangeDisableTOTP:
+		return "disable your authenticator app"
+	default:
+		return fmt.Sprintf("remove your %s from your account", c.DeliveryMethod)
+	}
+}
+
+// ChangeKey is the key holding a User's pending security change.
+func ChangeKey(userID string) string {
+	return fmt.Sprintf("%s_security_change", userID)
+}
@@ -0,0 +1,224 @@
+package securitychange
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
+	"github.com/fmitra/authenticator/internal/memstore"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+// messenger records the messages it is asked to send.
+type messenger struct {
+	msgs []*auth.Message
+}
+
+func (m *messenger) Send(ctx context.Context, msg *auth.Message) error {
+	m.msgs = append(m.msgs, msg)
+	return nil
+}
+
+func TestSecurityChangeSvc_IsEnabled(t *testing.T) {
+	tt := []struct {
+		name      string
+		options   []ConfigOption
+		isEnabled bool
+	}{
+		{
+			name: "Enabled",
+			options: []ConfigOption{
+				WithDB(memstore.New()),
+				WithCancelURL("https://example.com/cancel"),
+				WithChangeDelay(time.Hour, time.Hour),
+			},
+			isEnabled: true,
+		},
+		{
+			name: "Disabled without delay",
+			options: []ConfigOption{
+				WithDB(memstore.New()),
+				WithCancelURL("https://example.com/cancel"),
+			},
+		},
+		{
+			name: "Disabled without cancel URL",
+			options: []ConfigOption{
+				WithDB(memstore.New()),
+				WithChangeDelay(time.Hour, time.Hour),
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := NewService(tc.options...)
+			if svc.IsEnabled() != tc.isEnabled {
+				t.Errorf("incorrect enabled state, want %v got %v", tc.isEnabled, svc.IsEnabled())
+			}
+		})
+	}
+}
+
+func TestSecurityChangeSvc_Delay(t *testing.T) {
+	tt := []struct {
+		name     string
+		user     *auth.User
+		change   *auth.PendingChange
+		delivery auth.DeliveryMethod
+		address  string
+	}{
+		{
+			name: "Address change notified to affected address",
+			user: &auth.User{
+				ID:    "user-id",
+				Email: sql.NullString{String: "jane@example.com", Valid: true},
+				Phone: sql.NullString{String: "+6594867353", Valid: true},
+			},
+			change: &auth.PendingChange{
+				Type:           auth.ChangeRemoveAddress,
+				DeliveryMethod: auth.Phone,
+			},
+			delivery: auth.Phone,
+			address:  "+6594867353",
+		},
+		{
+			name: "Device change notified to email",
+			user: &auth.User{
+				ID:    "user-id",
+				Email: sql.NullString{String: "jane@example.com", Valid: true},
+				Phone: sql.NullString{String: "+6594867353", Valid: true},
+			},
+			change: &auth.PendingChange{
+				Type:     auth.ChangeRemoveDevice,
+				DeviceID: "device-id",
+			},
+			delivery: auth.Email,
+			address:  "jane@example.com",
+		},
+		{
+			name: "TOTP change notified to phone without email",
+			user: &auth.User{
+				ID:    "user-id",
+				Phone: sql.NullString{String: "+6594867353", Valid: true},
+			},
+			change:   &auth.PendingChange{Type: auth.ChangeDisableTOTP},
+			delivery: auth.Phone,
+			address:  "+6594867353",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			now := time.Now()
+
+			msgSvc := &messenger{}
+			actionTokens := &test.ActionTokenService{
+				IssueFn: func() (string, error) {
+					return "cancel-token", nil
+				},
+			}
+			svc := NewService(
+				WithClock(clock.NewFake(now)),
+				WithMessaging(msgSvc),
+				WithActionTokens(actionTokens),
+				WithDB(memstore.New()),
+				WithCancelURL("https://example.com/cancel"),
+				WithChangeDelay(time.Hour, time.Hour),
+			)
+
+			if err := svc.Delay(ctx, tc.user, tc.change); err != nil {
+				t.Fatal("failed to delay change:", err)
+			}
+			if !tc.change.AvailableAt.Equal(now.Add(time.Hour)) {
+				t.Errorf("incorrect available at, want %v got %v", now.Add(time.Hour), tc.change.AvailableAt)
+			}
+			if len(msgSvc.msgs) != 1 {
+				t.Fatalf("incorrect notification count, want 1 got %v", len(msgSvc.msgs))
+			}
+			msg := msgSvc.msgs[0]
+			if msg.Delivery != tc.delivery || msg.Address != tc.address {
+				t.Errorf("incorrect notification address, want %s %s got %s %s",
+					tc.delivery, tc.address, msg.Delivery, msg.Address)
+			}
+			if msg.Vars["link"] != "https://example.com/cancel?token=cancel-token" {
+				t.Errorf("incorrect cancel link, got %s", msg.Vars["link"])
+			}
+
+			pending, err := svc.Pending(ctx, tc.user.ID)
+			if err != nil || pending == nil {
+				t.Fatal("failed to retrieve pending change:", err)
+			}
+			if pending.ID != tc.change.ID || pending.DeviceID != tc.change.DeviceID {
+				t.Errorf("incorrect pending change, want %+v got %+v", tc.change, pending)
+			}
+
+			err = svc.Delay(ctx, tc.user, &auth.PendingChange{Type: auth.ChangeDisableTOTP})
+			if auth.ErrorCode(err) != auth.EBadRequest {
+				t.Errorf("incorrect error code, want %s got %s", auth.EBadRequest, auth.ErrorCode(err))
+			}
+		})
+	}
+}
+
+func TestSecurityChangeSvc_Cancel(t *testing.T) {
+	ctx := context.Background()
+	cancelToken := &auth.ActionToken{
+		UserID:  "user-id",
+		Purpose: auth.PurposeCancelChange,
+		Data:    map[string]string{"change_id": "stale-change-id"},
+	}
+	actionTokens := &test.ActionTokenService{
+		IssueFn: func() (string, error) {
+			return "cancel-token", nil
+		},
+		ParseFn: func() (*auth.ActionToken, error) {
+			return cancelToken, nil
+		},
+		RedeemFn: func() error {
+			return nil
+		},
+	}
+	svc := NewService(
+		WithMessaging(&test.MessagingService{}),
+		WithActionTokens(actionTokens),
+		WithDB(memstore.New()),
+		WithCancelURL("https://example.com/cancel"),
+		WithChangeDelay(time.Hour, time.Hour),
+	)
+
+	user := &auth.User{
+		ID:    "user-id",
+		Email: sql.NullString{String: "jane@example.com", Valid: true},
+	}
+	change := &auth.PendingChange{Type: auth.ChangeDisableTOTP}
+	if err := svc.Delay(ctx, user, change); err != nil {
+		t.Fatal("failed to delay change:", err)
+	}
+
+	_, err := svc.Cancel(ctx, "cancel-token")
+	if auth.ErrorCode(err) != auth.EBadRequest {
+		t.Errorf("incorrect error code, want %s got %s", auth.EBadRequest, auth.ErrorCode(err))
+	}
+
+	cancelToken.Data["change_id"] = change.ID
+	cancelled, err := svc.Cancel(ctx, "cancel-token")
+	if err != nil {
+		t.Fatal("failed to cancel change:", err)
+	}
+	if cancelled.Type != auth.ChangeDisableTOTP {
+		t.Errorf("incorrect change, want %s got %s", auth.ChangeDisableTOTP, cancelled.Type)
+	}
+
+	pending, err := svc.Pending(ctx, user.ID)
+	if err != nil {
+		t.Fatal("failed to retrieve pending change:", err)
+	}
+	if pending != nil {
+		t.Error("cancelled change is still pending")
+	}
+}
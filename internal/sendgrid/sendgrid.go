@@ -4,26 +4,40 @@ package sendgrid
 import (
 	"context"
 	"fmt"
+	"net/http"
 
+	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/msgdelivery"
+	"github.com/fmitra/authenticator/internal/msgsender"
 )
 
 type service struct {
-	apiKey   string
-	fromAddr string
-	fromName string
+	apiKey     string
+	fromAddr   string
+	fromName   string
+	httpClient *http.Client
 }
 
 // Email delivers an email to an email address.
 func (s *service) Email(ctx context.Context, email, subject, message string) error {
 	from := mail.NewEmail(s.fromName, s.fromAddr)
+	if sender := msgsender.FromContext(ctx); sender.FromAddr != "" {
+		from = mail.NewEmail(sender.FromName, sender.FromAddr)
+	}
 	to := mail.NewEmail("", email)
 	msg := mail.NewSingleEmail(from, subject, to, message, message)
-	client := sendgrid.NewSendClient(s.apiKey)
-	resp, err := client.Send(msg)
+	if id := msgdelivery.FromContext(ctx); id != "" {
+		// Custom arguments are returned with event webhook reports.
+		msg.SetCustomArg(msgdelivery.IDParam, id)
+	}
+	req := sendgrid.NewSendClient(s.apiKey).Request
+	req.Body = mail.GetRequestBody(msg)
+	client := &rest.Client{HTTPClient: s.httpClient}
+	resp, err := client.Send(req)
 	if err != nil {
 		return fmt.Errorf("sendgrid client failed: %w", err)
 	}
@@ -36,11 +50,27 @@ func (s *service) Email(ctx context.Context, email, subject, message string) err
 	return nil
 }
 
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
 // NewClient returns a new Sendgrid client
-func NewClient(apiKey, fromAddr, fromName string) auth.Emailer {
-	return &service{
-		apiKey:   apiKey,
-		fromAddr: fromAddr,
-		fromName: fromName,
+func NewClient(apiKey, fromAddr, fromName string, options ...ConfigOption) auth.Emailer {
+	s := service{
+		apiKey:     apiKey,
+		fromAddr:   fromAddr,
+		fromName:   fromName,
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range options {
+		opt(&s)
+	}
+	return &s
+}
+
+// WithHTTPClient configures the HTTP client requests to Sendgrid
+// are sent with.
+func WithHTTPClient(client *http.Client) ConfigOption {
+	return func(s *service) {
+		s.httpClient = client
 	}
 }
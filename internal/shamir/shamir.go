@@ -0,0 +1,133 @@
+// Package shamir splits secrets into shares with Shamir's Secret Sharing
+// over GF(2^8). Any threshold of shares reconstructs the secret while
+// fewer reveal nothing about it.
+package shamir
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// MaxShares is the maximum number of shares a secret may be split into.
+const MaxShares = 255
+
+// Split splits a secret into n shares of which any k reconstruct it.
+// Each share is one byte longer than the secret, its first byte
+// holding the share's x coordinate.
+func Split(secret []byte, n, k int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("secret cannot be empty")
+	}
+	if k < 2 || k > n || n > MaxShares {
+		return nil, fmt.Errorf("invalid threshold %d of %d shares", k, n)
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	// Each byte of the secret is the constant term of a random
+	// polynomial of degree k-1 evaluated at every share's x.
+	coefficients := make([]byte, k)
+	for idx, b := range secret {
+		coefficients[0] = b
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("cannot generate coefficients: %w", err)
+		}
+
+		for _, share := range shares {
+			share[idx+1] = evaluate(coefficients, share[0])
+		}
+	}
+
+	return shares, nil
+}
+
+// Combine reconstructs a secret from shares. Combining fewer shares than
+// the threshold, or shares of different secrets, returns an incorrect
+// secret rather than an error. Callers should verify the result.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("at least two shares are required")
+	}
+
+	length := len(shares[0])
+	if length < 2 {
+		return nil, fmt.Errorf("share is too short")
+	}
+
+	seen := make(map[byte]bool, len(shares))
+	for _, share := range shares {
+		if len(share) != length {
+			return nil, fmt.Errorf("shares must be the same length")
+		}
+		if share[0] == 0 || seen[share[0]] {
+			return nil, fmt.Errorf("shares must be distinct")
+		}
+		seen[share[0]] = true
+	}
+
+	// Lagrange interpolation at x=0.
+	secret := make([]byte, length-1)
+	for i, share := range shares {
+		var basis byte = 1
+		for j, other := range shares {
+			if i == j {
+				continue
+			}
+			basis = mul(basis, div(other[0], add(other[0], share[0])))
+		}
+
+		for idx := range secret {
+			secret[idx] = add(secret[idx], mul(share[idx+1], basis))
+		}
+	}
+
+	return secret, nil
+}
+
+// evaluate evaluates a polynomial at x with Horner's method.
+func evaluate(coefficients []byte, x byte) byte {
+	var y byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = add(mul(y, x), coefficients[i])
+	}
+	return y
+}
+
+// add adds two field elements. Subtraction is identical.
+func add(a, b byte) byte {
+	return a ^ b
+}
+
+// mul multiplies two field elements modulo the AES polynomial
+// x^8 + x^4 + x^3 + x + 1. It runs in constant time to avoid
+// leaking shares through timing.
+func mul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= a & -(b & 1)
+		a = a<<1 ^ 0x1b&-(a>>7)
+		b >>= 1
+	}
+	return p
+}
+
+// div divides two field elements. b must not be zero.
+func div(a, b byte) byte {
+	return mul(a, inverse(b))
+}
+
+// inverse returns the multiplicative inverse of a non zero
+// field element, a^254.
+func inverse(a byte) byte {
+	result := a
+	for i := 0; i < 6; i++ {
+		result = mul(result, result)
+		result = mul(result, a)
+	}
+	return mul(result, result)
+}
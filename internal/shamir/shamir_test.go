@@ -0,0 +1,91 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestShamir_SplitCombine(t *testing.T) {
+	secret := []byte("correct horse battery staple")
+
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal("failed to split secret:", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("incorrect share count, want 5 got %v", len(shares))
+	}
+
+	tt := []struct {
+		name    string
+		shares  [][]byte
+		isValid bool
+	}{
+		{
+			name:    "Threshold of shares",
+			shares:  [][]byte{shares[0], shares[2], shares[4]},
+			isValid: true,
+		},
+		{
+			name:    "All shares",
+			shares:  shares,
+			isValid: true,
+		},
+		{
+			name:    "Shares out of order",
+			shares:  [][]byte{shares[3], shares[1], shares[0]},
+			isValid: true,
+		},
+		{
+			name:    "Below threshold",
+			shares:  [][]byte{shares[0], shares[1]},
+			isValid: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			combined, err := Combine(tc.shares)
+			if err != nil {
+				t.Fatal("failed to combine shares:", err)
+			}
+			if bytes.Equal(combined, secret) != tc.isValid {
+				t.Errorf("incorrect secret reconstruction, want valid %v got %q", tc.isValid, combined)
+			}
+		})
+	}
+}
+
+func TestShamir_InvalidInput(t *testing.T) {
+	if _, err := Split([]byte("secret"), 3, 1); err == nil {
+		t.Error("expected error for threshold below 2")
+	}
+	if _, err := Split([]byte("secret"), 2, 3); err == nil {
+		t.Error("expected error for threshold above share count")
+	}
+	if _, err := Split(nil, 3, 2); err == nil {
+		t.Error("expected error for empty secret")
+	}
+
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal("failed to split secret:", err)
+	}
+	if _, err = Combine([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("expected error for duplicate shares")
+	}
+	if _, err = Combine([][]byte{shares[0], shares[1][:3]}); err == nil {
+		t.Error("expected error for mismatched share lengths")
+	}
+}
+
+func TestShamir_Field(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if got := mul(byte(a), inverse(byte(a))); got != 1 {
+			t.Fatalf("incorrect inverse of %v, product is %v", a, got)
+		}
+	}
+	if got := mul(0x57, 0x83); got != 0xc1 {
+		t.Errorf("incorrect product, want %#x got %#x", 0xc1, got)
+	}
+}
@@ -0,0 +1,68 @@
+package signalcli
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// defaultHealthInterval is the default time the health of the
+// gateway is cached for.
+const defaultHealthInterval = time.Second * 30
+
+// ConfigOption configures the client.
+type ConfigOption func(*client)
+
+// NewClient returns a client of a signal-cli REST gateway, e.g.
+// `http://localhost:8080`, sending messages from a phone number
+// registered with Signal.
+func NewClient(gatewayURL, number string, options ...ConfigOption) auth.SMSer {
+	c := client{
+		baseURL:        strings.TrimSuffix(gatewayURL, "/"),
+		number:         number,
+		httpClient:     &http.Client{},
+		logger:         log.NewNopLogger(),
+		healthInterval: defaultHealthInterval,
+		now:            time.Now,
+	}
+	for _, opt := range options {
+		opt(&c)
+	}
+	return &c
+}
+
+// WithLogger configures the client with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(c *client) {
+		c.logger = l
+	}
+}
+
+// WithFallback configures an SMS library to deliver messages
+// Signal could not, such as to recipients not registered with
+// Signal or while the gateway is unhealthy.
+func WithFallback(fallback auth.SMSer) ConfigOption {
+	return func(c *client) {
+		c.fallback = fallback
+	}
+}
+
+// WithHealthInterval configures the time the health of the gateway
+// is cached for before it is checked again.
+func WithHealthInterval(d time.Duration) ConfigOption {
+	return func(c *client) {
+		c.healthInterval = d
+	}
+}
+
+// WithHTTPClient configures the HTTP client requests to the gateway
+// are sent with.
+func WithHTTPClient(httpClient *http.Client) ConfigOption {
+	return func(c *client) {
+		c.httpClient = httpClient
+	}
+}
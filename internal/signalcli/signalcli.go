@@ -0,0 +1,174 @@
+// Package signalcli delivers messages to phone numbers over Signal
+// through a signal-cli REST gateway.
+package signalcli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// client is a consumer of the signal-cli REST API.
+type client struct {
+	baseURL        string
+	number         string
+	httpClient     *http.Client
+	logger         log.Logger
+	fallback       auth.SMSer
+	healthInterval time.Duration
+	now            func() time.Time
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	isHealthy bool
+}
+
+// gatewayError is an error caused by the gateway rather than the
+// message or its recipient.
+type gatewayError struct {
+	err error
+}
+
+func (e *gatewayError) Error() string {
+	return e.err.Error()
+}
+
+func (e *gatewayError) Unwrap() error {
+	return e.err
+}
+
+// SMS sends a Signal message to a phone number. Messages are delivered
+// through the fallback SMS library, if configured, when the gateway is
+// unhealthy or fails to deliver the message.
+func (c *client) SMS(ctx context.Context, phoneNumber string, message string) error {
+	if !c.healthy(ctx) {
+		return c.fallbackSMS(ctx, phoneNumber, message, fmt.Errorf("signal gateway is unhealthy"))
+	}
+
+	err := c.send(ctx, phoneNumber, message)
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := err.(*gatewayError); ok {
+		c.setHealth(false)
+	}
+
+	return c.fallbackSMS(ctx, phoneNumber, message, err)
+}
+
+func (c *client) send(ctx context.Context, phoneNumber, message string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"message":    message,
+		"number":     c.number,
+		"recipients": []string{phoneNumber},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v2/send", c.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return &gatewayError{fmt.Errorf("failed to send HTTP request: %w", err)}
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		rBody, _ := ioutil.ReadAll(resp.Body)
+		err = fmt.Errorf("expected status %v, got %v: %s",
+			http.StatusCreated, resp.StatusCode, string(rBody))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return &gatewayError{err}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// fallbackSMS delivers a message Signal failed to deliver through the
+// fallback SMS library.
+func (c *client) fallbackSMS(ctx context.Context, phoneNumber, message string, err error) error {
+	if c.fallback == nil {
+		return err
+	}
+
+	level.Info(c.logger).Log(
+		"source", "signalcli.SMS",
+		"message", "delivering message through fallback",
+		"error", err,
+	)
+
+	return c.fallback.SMS(ctx, phoneNumber, message)
+}
+
+// healthy reports whether the gateway is healthy. The result of a
+// health check is cached for the health interval.
+func (c *client) healthy(ctx context.Context) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checkedAt.IsZero() && c.now().Sub(c.checkedAt) < c.healthInterval {
+		return c.isHealthy
+	}
+
+	err := c.checkHealth(ctx)
+	if err != nil {
+		level.Error(c.logger).Log(
+			"source", "signalcli.healthy",
+			"message", "signal gateway health check failed",
+			"error", err,
+		)
+	}
+
+	c.checkedAt = c.now()
+	c.isHealthy = err == nil
+	return c.isHealthy
+}
+
+func (c *client) setHealth(isHealthy bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkedAt = c.now()
+	c.isHealthy = isHealthy
+}
+
+func (c *client) checkHealth(ctx context.Context) error {
+	url := fmt.Sprintf("%s/v1/health", c.baseURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create HTTP request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send HTTP request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected status %v, got %v", http.StatusNoContent, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package signalcli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type smsMock struct {
+	callCount int
+}
+
+func (m *smsMock) SMS(ctx context.Context, phoneNumber, message string) error {
+	m.callCount++
+	return nil
+}
+
+type gateway struct {
+	healthStatus int
+	sendStatus   int
+	healthCount  int
+	sendCount    int
+	t            *testing.T
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/health":
+		g.healthCount++
+		w.WriteHeader(g.healthStatus)
+	case "/v2/send":
+		g.sendCount++
+		var req struct {
+			Message    string   `json:"message"`
+			Number     string   `json:"number"`
+			Recipients []string `json:"recipients"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			g.t.Error("invalid send request:", err)
+		}
+		if req.Number != "+15555555555" || len(req.Recipients) != 1 || req.Recipients[0] != "+17777777777" {
+			g.t.Errorf("incorrect send request: %+v", req)
+		}
+		w.WriteHeader(g.sendStatus)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSignalCLI_SMS(t *testing.T) {
+	tt := []struct {
+		name          string
+		healthStatus  int
+		sendStatus    int
+		hasFallback   bool
+		sendCount     int
+		fallbackCount int
+		hasError      bool
+	}{
+		{
+			name:          "Sends over Signal",
+			healthStatus:  http.StatusNoContent,
+			sendStatus:    http.StatusCreated,
+			hasFallback:   true,
+			sendCount:     2,
+			fallbackCount: 0,
+		},
+		{
+			name:          "Falls back for rejected message",
+			healthStatus:  http.StatusNoContent,
+			sendStatus:    http.StatusBadRequest,
+			hasFallback:   true,
+			sendCount:     2,
+			fallbackCount: 2,
+		},
+		{
+			name:          "Falls back while gateway is unhealthy",
+			healthStatus:  http.StatusServiceUnavailable,
+			sendStatus:    http.StatusCreated,
+			hasFallback:   true,
+			sendCount:     0,
+			fallbackCount: 2,
+		},
+		{
+			name:          "Skips gateway after gateway failure",
+			healthStatus:  http.StatusNoContent,
+			sendStatus:    http.StatusInternalServerError,
+			hasFallback:   true,
+			sendCount:     1,
+			fallbackCount: 2,
+		},
+		{
+			name:         "Fails without fallback",
+			healthStatus: http.StatusNoContent,
+			sendStatus:   http.StatusBadRequest,
+			hasFallback:  false,
+			sendCount:    2,
+			hasError:     true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			g := &gateway{healthStatus: tc.healthStatus, sendStatus: tc.sendStatus, t: t}
+			srv := httptest.NewServer(g)
+			defer srv.Close()
+
+			fallback := &smsMock{}
+			options := []ConfigOption{WithHealthInterval(time.Minute)}
+			if tc.hasFallback {
+				options = append(options, WithFallback(fallback))
+			}
+			c := NewClient(srv.URL, "+15555555555", options...)
+
+			for i := 0; i < 2; i++ {
+				err := c.SMS(context.Background(), "+17777777777", "hello world")
+				if err != nil && !tc.hasError {
+					t.Error("expected nil error:", err)
+				}
+				if err == nil && tc.hasError {
+					t.Error("expected error, received nil")
+				}
+			}
+
+			if g.healthCount != 1 {
+				t.Errorf("incorrect health checks, want 1 got %v", g.healthCount)
+			}
+			if g.sendCount != tc.sendCount {
+				t.Errorf("incorrect Signal messages, want %v got %v", tc.sendCount, g.sendCount)
+			}
+			if fallback.callCount != tc.fallbackCount {
+				t.Errorf("incorrect fallback messages, want %v got %v", tc.fallbackCount, fallback.callCount)
+			}
+		})
+	}
+}
+
+func TestSignalCLI_HealthInterval(t *testing.T) {
+	g := &gateway{healthStatus: http.StatusServiceUnavailable, sendStatus: http.StatusCreated, t: t}
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	now := time.Now()
+	c := NewClient(srv.URL, "+15555555555", WithFallback(&smsMock{})).(*client)
+	c.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if err := c.SMS(ctx, "+17777777777", "hello world"); err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+
+	g.healthStatus = http.StatusNoContent
+	now = now.Add(defaultHealthInterval)
+	if err := c.SMS(ctx, "+17777777777", "hello world"); err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+
+	if g.healthCount != 2 {
+		t.Errorf("incorrect health checks, want 2 got %v", g.healthCount)
+	}
+	if g.sendCount != 1 {
+		t.Errorf("incorrect Signal messages, want 1 got %v", g.sendCount)
+	}
+}
@@ -0,0 +1,106 @@
+package signupabuse
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/anomaly"
+)
+
+const (
+	defaultWindow           = time.Hour
+	defaultSourceLimit      = 20
+	defaultFingerprintLimit = 5
+	defaultDomainLimit      = 100
+)
+
+// NewService returns a new SignupAbuseDetector. Without a database,
+// detection is disabled.
+func NewService(options ...ConfigOption) auth.SignupAbuseDetector {
+	s := service{
+		logger: log.NewNopLogger(),
+		source: anomaly.PrefixSource(24, 48),
+		window: defaultWindow,
+		limits: Limits{
+			Source:      defaultSourceLimit,
+			Fingerprint: defaultFingerprintLimit,
+			Domain:      defaultDomainLimit,
+		},
+		now: time.Now,
+	}
+	WithDisposableDomains(defaultDisposable)(&s)
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return &s
+}
+
+// ConfigOption configures the service.
+type ConfigOption func(*service)
+
+// WithLogger configures the service with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(s *service) {
+		s.logger = l
+	}
+}
+
+// WithDB configures the service with a Redis DB.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithSourceResolver configures how IP addresses are grouped into sources.
+func WithSourceResolver(r anomaly.SourceResolver) ConfigOption {
+	return func(s *service) {
+		s.source = r
+	}
+}
+
+// WithCaptcha requires suspicious signups to solve a CAPTCHA. Without
+// a CaptchaVerifier, suspicious signups are throttled.
+func WithCaptcha(c anomaly.CaptchaVerifier) ConfigOption {
+	return func(s *service) {
+		s.captcha = c
+	}
+}
+
+// WithAllowlist exempts network ranges and email domains from heuristics.
+func WithAllowlist(a *Allowlist) ConfigOption {
+	return func(s *service) {
+		s.allowlist = a
+	}
+}
+
+// WithDisposableDomains replaces the domains of disposable email
+// providers requiring additional verification.
+func WithDisposableDomains(domains []string) ConfigOption {
+	return func(s *service) {
+		s.disposable = make(map[string]bool, len(domains))
+		for _, domain := range domains {
+			if domain = normalizeDomain(domain); domain != "" {
+				s.disposable[domain] = true
+			}
+		}
+	}
+}
+
+// WithWindow configures the window in which signup attempts are counted.
+func WithWindow(window time.Duration) ConfigOption {
+	return func(s *service) {
+		s.window = window
+	}
+}
+
+// WithLimits configures the signup attempts allowed within a window.
+func WithLimits(l Limits) ConfigOption {
+	return func(s *service) {
+		s.limits = l
+	}
+}
@@ -0,0 +1,137 @@
+package signupabuse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// defaultDisposable are well known disposable email domains. Operators
+// may supply a maintained list with WithDisposableDomains.
+var defaultDisposable = []string{
+	"10minutemail.com",
+	"guerrillamail.com",
+	"mailinator.com",
+	"maildrop.cc",
+	"sharklasers.com",
+	"temp-mail.org",
+	"throwawaymail.com",
+	"trashmail.com",
+	"yopmail.com",
+}
+
+// Allowlist exempts network ranges and email domains from heuristics,
+// such as an office network or a partner's domain. Requests from an
+// allowlisted network skip every check while allowlisted domains skip
+// the email domain checks.
+type Allowlist struct {
+	networks []*net.IPNet
+	domains  map[string]bool
+}
+
+// ParseAllowlist parses comma separated lists of IP addresses or CIDR
+// ranges and email domains. Subdomains of a domain are also allowed.
+func ParseAllowlist(networks, domains string) (*Allowlist, error) {
+	a := Allowlist{domains: make(map[string]bool)}
+
+	for _, entry := range strings.Split(networks, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist network %q: %w", entry, err)
+		}
+		a.networks = append(a.networks, n)
+	}
+
+	for _, domain := range strings.Split(domains, ",") {
+		if domain = normalizeDomain(domain); domain != "" {
+			a.domains[domain] = true
+		}
+	}
+
+	return &a, nil
+}
+
+// HasIP reports whether an IP address is allowlisted.
+func (a *Allowlist) HasIP(ip string) bool {
+	if a == nil {
+		return false
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range a.networks {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasDomain reports whether an email domain is allowlisted.
+func (a *Allowlist) HasDomain(domain string) bool {
+	if a == nil {
+		return false
+	}
+	return matchDomain(a.domains, domain)
+}
+
+// ReadDomains reads a list of domains, one per line. Blank lines and
+// lines starting with # are ignored.
+func ReadDomains(r io.Reader) ([]string, error) {
+	var domains []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read domains: %w", err)
+	}
+	return domains, nil
+}
+
+// matchDomain reports whether a domain or one of its parent
+// domains is in a set.
+func matchDomain(set map[string]bool, domain string) bool {
+	for domain != "" {
+		if set[domain] {
+			return true
+		}
+		i := strings.Index(domain, ".")
+		if i < 0 {
+			return false
+		}
+		domain = domain[i+1:]
+	}
+	return false
+}
+
+// emailDomain returns the normalized domain of an email address.
+func emailDomain(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return ""
+	}
+	return normalizeDomain(email[i+1:])
+}
+
+func normalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
@@ -0,0 +1,286 @@
+// Package signupabuse detects bursts of registrations from a network
+// source, device or email domain and throttles them or requires
+// additional verification.
+package signupabuse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/anomaly"
+	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+const captchaHeader = "X-Captcha-Token"
+
+// Outcomes of a signup attempt recorded as metrics.
+const (
+	// OutcomeAllowed is an attempt which did not trigger a heuristic.
+	OutcomeAllowed = "allowed"
+	// OutcomeAllowlisted is an attempt exempt from heuristics.
+	OutcomeAllowlisted = "allowlisted"
+	// OutcomeChallenged is an attempt rejected for missing or failing
+	// additional verification.
+	OutcomeChallenged = "challenged"
+	// OutcomeVerified is an attempt which passed additional verification.
+	OutcomeVerified = "verified"
+	// OutcomeThrottled is an attempt rejected for exceeding a limit.
+	OutcomeThrottled = "throttled"
+)
+
+var outcomes = []string{
+	OutcomeAllowed,
+	OutcomeAllowlisted,
+	OutcomeChallenged,
+	OutcomeVerified,
+	OutcomeThrottled,
+}
+
+// rediser is a minimal interface for go-redis.
+type rediser interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+}
+
+// Limits are the signup attempts allowed within a window before
+// mitigations apply. A limit of 0 disables the check.
+type Limits struct {
+	// Source is the attempts allowed from a network source before
+	// they are throttled.
+	Source int64
+	// Fingerprint is the attempts allowed from a device fingerprint
+	// before they are throttled.
+	Fingerprint int64
+	// Domain is the attempts allowed for an email domain before
+	// additional verification is required.
+	Domain int64
+}
+
+// service is an implementation of auth.SignupAbuseDetector backed by
+// redis. Signup attempts are counted per network source, device
+// fingerprint and email domain in fixed windows. Sources and devices
+// exceeding their limit are throttled while bursts to a single email
+// domain, or addresses from disposable domains, must solve a CAPTCHA.
+type service struct {
+	logger     log.Logger
+	db         rediser
+	source     anomaly.SourceResolver
+	captcha    anomaly.CaptchaVerifier
+	allowlist  *Allowlist
+	disposable map[string]bool
+	window     time.Duration
+	limits     Limits
+	now        func() time.Time
+}
+
+// Check records a signup attempt for an email address and returns an
+// error if the attempt is throttled or requires additional verification.
+func (s *service) Check(ctx context.Context, r *http.Request, email string) error {
+	if s.db == nil {
+		return nil
+	}
+
+	ip := httpapi.GetIP(r)
+	if s.allowlist.HasIP(ip) {
+		s.record(ctx, OutcomeAllowlisted)
+		return nil
+	}
+
+	bucket := s.bucket(s.now())
+	var reasons []string
+	var throttle bool
+
+	if source := s.source(ip); source != "" {
+		exceeded, err := s.exceeds(ctx, attemptsKey(bucket, "source", source), s.limits.Source)
+		if err != nil {
+			return err
+		}
+		if exceeded {
+			throttle = true
+			reasons = append(reasons, "source")
+		}
+	}
+
+	if fp := r.Header.Get(httpapi.DeviceFingerprintHeader); fp != "" {
+		h, err := crypto.Hash(fp)
+		if err != nil {
+			return fmt.Errorf("cannot hash fingerprint: %w", err)
+		}
+		exceeded, err := s.exceeds(ctx, attemptsKey(bucket, "fingerprint", h), s.limits.Fingerprint)
+		if err != nil {
+			return err
+		}
+		if exceeded {
+			throttle = true
+			reasons = append(reasons, "fingerprint")
+		}
+	}
+
+	var challenge bool
+	if domain := emailDomain(email); domain != "" && !s.allowlist.HasDomain(domain) {
+		if matchDomain(s.disposable, domain) {
+			challenge = true
+			reasons = append(reasons, "disposable_domain")
+		}
+		exceeded, err := s.exceeds(ctx, attemptsKey(bucket, "domain", domain), s.limits.Domain)
+		if err != nil {
+			return err
+		}
+		if exceeded {
+			challenge = true
+			reasons = append(reasons, "domain")
+		}
+	}
+
+	switch {
+	case throttle:
+		s.record(ctx, OutcomeThrottled)
+		s.log(ip, OutcomeThrottled, reasons)
+		return auth.ErrThrottle("too many signup attempts")
+	case challenge:
+		return s.verify(ctx, r, ip, reasons)
+	default:
+		s.record(ctx, OutcomeAllowed)
+		return nil
+	}
+}
+
+// Challenge reports whether a signup for an email address must solve
+// a CAPTCHA. Attempts which would be throttled are not challenged, and
+// the attempt is not recorded.
+func (s *service) Challenge(ctx context.Context, r *http.Request, email string) (bool, error) {
+	if s.db == nil || s.captcha == nil {
+		return false, nil
+	}
+
+	if s.allowlist.HasIP(httpapi.GetIP(r)) {
+		return false, nil
+	}
+
+	domain := emailDomain(email)
+	if domain == "" || s.allowlist.HasDomain(domain) {
+		return false, nil
+	}
+	if matchDomain(s.disposable, domain) {
+		return true, nil
+	}
+	if s.limits.Domain <= 0 {
+		return false, nil
+	}
+
+	key := attemptsKey(s.bucket(s.now()), "domain", domain)
+	count, err := s.db.Get(ctx, key).Int64()
+	if err != nil && err != redis.Nil {
+		return false, fmt.Errorf("cannot retrieve signup attempts: %w", err)
+	}
+
+	return count >= s.limits.Domain, nil
+}
+
+// Stats returns the number of signup attempts by outcome.
+func (s *service) Stats(ctx context.Context) (map[string]int64, error) {
+	stats := make(map[string]int64, len(outcomes))
+	for _, outcome := range outcomes {
+		stats[outcome] = 0
+	}
+	if s.db == nil {
+		return stats, nil
+	}
+
+	for _, outcome := range outcomes {
+		count, err := s.db.Get(ctx, outcomeKey(outcome)).Int64()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("cannot retrieve signup outcomes: %w", err)
+		}
+		stats[outcome] = count
+	}
+	return stats, nil
+}
+
+// verify requires a CAPTCHA of a suspicious attempt. Attempts are
+// throttled if a CaptchaVerifier is not configured.
+func (s *service) verify(ctx context.Context, r *http.Request, ip string, reasons []string) error {
+	if s.captcha == nil {
+		s.record(ctx, OutcomeThrottled)
+		s.log(ip, OutcomeThrottled, reasons)
+		return auth.ErrThrottle("too many signup attempts")
+	}
+
+	token := r.Header.Get(captchaHeader)
+	if token == "" {
+		s.record(ctx, OutcomeChallenged)
+		s.log(ip, OutcomeChallenged, reasons)
+		return auth.ErrChallenge("captcha is required")
+	}
+	if err := s.captcha.Verify(ctx, token, ip); err != nil {
+		s.record(ctx, OutcomeChallenged)
+		s.log(ip, OutcomeChallenged, reasons)
+		return fmt.Errorf("%v: %w", err, auth.ErrChallenge("captcha is invalid"))
+	}
+
+	s.record(ctx, OutcomeVerified)
+	return nil
+}
+
+// exceeds increments an attempt counter and reports whether it
+// exceeds a limit.
+func (s *service) exceeds(ctx context.Context, key string, limit int64) (bool, error) {
+	if limit <= 0 {
+		return false, nil
+	}
+
+	count, err := s.db.Incr(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("cannot record signup attempt: %w", err)
+	}
+	if err = s.db.Expire(ctx, key, s.window).Err(); err != nil {
+		return false, fmt.Errorf("cannot record signup attempt: %w", err)
+	}
+	return count > limit, nil
+}
+
+// record increments the metric of an outcome. Failures are logged
+// rather than failing the signup.
+func (s *service) record(ctx context.Context, outcome string) {
+	if err := s.db.Incr(ctx, outcomeKey(outcome)).Err(); err != nil {
+		level.Error(s.logger).Log(
+			"source", "SignupAbuseDetector.record",
+			"message", "failed to record signup outcome",
+			"outcome", outcome,
+			"error", err,
+		)
+	}
+}
+
+func (s *service) log(ip, outcome string, reasons []string) {
+	level.Warn(s.logger).Log(
+		"source", "SignupAbuseDetector.Check",
+		"message", "signup attempt was mitigated",
+		"ip", ip,
+		"outcome", outcome,
+		"reasons", strings.Join(reasons, ","),
+	)
+}
+
+func (s *service) bucket(t time.Time) string {
+	return strconv.FormatInt(t.Truncate(s.window).Unix(), 10)
+}
+
+func attemptsKey(bucket, kind, value string) string {
+	return fmt.Sprintf("signupabuse:%s:%s:%s", bucket, kind, value)
+}
+
+func outcomeKey(outcome string) string {
+	return fmt.Sprintf("signupabuse:outcome:%s", outcome)
+}
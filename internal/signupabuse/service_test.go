@@ -0,0 +1,289 @@
+package signupabuse
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/memstore"
+)
+
+type mockCaptcha struct {
+	err error
+}
+
+func (m *mockCaptcha) Verify(ctx context.Context, token, ip string) error {
+	return m.err
+}
+
+func TestSignupAbuse_Check(t *testing.T) {
+	tt := []struct {
+		name         string
+		requests     int
+		email        func(i int) string
+		ip           func(i int) string
+		fingerprint  func(i int) string
+		captcha      *mockCaptcha
+		captchaToken string
+		allowlist    [2]string
+		errCode      auth.ErrCode
+		outcome      string
+	}{
+		{
+			name:     "Allows attempts within limits",
+			requests: 3,
+			outcome:  OutcomeAllowed,
+		},
+		{
+			name:     "Throttles bursts from a source",
+			requests: 4,
+			fingerprint: func(i int) string {
+				return fmt.Sprintf("device-%v", i)
+			},
+			errCode: auth.EThrottle,
+			outcome: OutcomeThrottled,
+		},
+		{
+			name:     "Throttles bursts from a device across sources",
+			requests: 3,
+			ip: func(i int) string {
+				return fmt.Sprintf("198.51.%v.1", i)
+			},
+			fingerprint: func(i int) string {
+				return "device"
+			},
+			errCode: auth.EThrottle,
+			outcome: OutcomeThrottled,
+		},
+		{
+			name:     "Requires captcha for bursts to a domain",
+			requests: 4,
+			ip: func(i int) string {
+				return fmt.Sprintf("198.51.%v.1", i)
+			},
+			captcha: &mockCaptcha{},
+			errCode: auth.EChallenge,
+			outcome: OutcomeChallenged,
+		},
+		{
+			name:     "Requires captcha for disposable domains",
+			requests: 1,
+			email: func(i int) string {
+				return "jane@eu.mailinator.com"
+			},
+			captcha: &mockCaptcha{},
+			errCode: auth.EChallenge,
+			outcome: OutcomeChallenged,
+		},
+		{
+			name:     "Rejects invalid captcha",
+			requests: 1,
+			email: func(i int) string {
+				return "jane@yopmail.com"
+			},
+			captcha:      &mockCaptcha{err: fmt.Errorf("invalid response")},
+			captchaToken: "captcha-token",
+			errCode:      auth.EChallenge,
+			outcome:      OutcomeChallenged,
+		},
+		{
+			name:     "Accepts valid captcha",
+			requests: 1,
+			email: func(i int) string {
+				return "jane@yopmail.com"
+			},
+			captcha:      &mockCaptcha{},
+			captchaToken: "captcha-token",
+			outcome:      OutcomeVerified,
+		},
+		{
+			name:     "Throttles disposable domains without captcha",
+			requests: 1,
+			email: func(i int) string {
+				return "jane@yopmail.com"
+			},
+			errCode: auth.EThrottle,
+			outcome: OutcomeThrottled,
+		},
+		{
+			name:      "Exempts allowlisted networks",
+			requests:  10,
+			allowlist: [2]string{"203.0.113.0/24", ""},
+			outcome:   OutcomeAllowlisted,
+		},
+		{
+			name:     "Exempts allowlisted domains",
+			requests: 4,
+			ip: func(i int) string {
+				return fmt.Sprintf("198.51.%v.1", i)
+			},
+			allowlist: [2]string{"", "example.com"},
+			outcome:   OutcomeAllowed,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			allowlist, err := ParseAllowlist(tc.allowlist[0], tc.allowlist[1])
+			if err != nil {
+				t.Fatal("failed to parse allowlist:", err)
+			}
+
+			options := []ConfigOption{
+				WithDB(memstore.New()),
+				WithAllowlist(allowlist),
+				WithLimits(Limits{Source: 3, Fingerprint: 2, Domain: 3}),
+			}
+			if tc.captcha != nil {
+				options = append(options, WithCaptcha(tc.captcha))
+			}
+			svc := NewService(options...)
+
+			for i := 0; i < tc.requests; i++ {
+				r := httptest.NewRequest("POST", "/api/v1/signup", nil)
+				r.RemoteAddr = "203.0.113.5:5000"
+				if tc.ip != nil {
+					r.RemoteAddr = tc.ip(i) + ":5000"
+				}
+				if tc.fingerprint != nil {
+					r.Header.Set("X-Device-Fingerprint", tc.fingerprint(i))
+				}
+				if tc.captchaToken != "" {
+					r.Header.Set("X-Captcha-Token", tc.captchaToken)
+				}
+				email := fmt.Sprintf("user-%v@example.com", i)
+				if tc.email != nil {
+					email = tc.email(i)
+				}
+				err = svc.Check(ctx, r, email)
+			}
+
+			if auth.ErrorCode(err) != tc.errCode {
+				t.Errorf("incorrect error code, want '%s' got '%s'", tc.errCode, auth.ErrorCode(err))
+			}
+
+			stats, err := svc.Stats(ctx)
+			if err != nil {
+				t.Fatal("failed to retrieve stats:", err)
+			}
+			if stats[tc.outcome] == 0 {
+				t.Errorf("outcome %s was not recorded: %v", tc.outcome, stats)
+			}
+		})
+	}
+}
+
+func TestSignupAbuse_Challenge(t *testing.T) {
+	ctx := context.Background()
+	allowlist, err := ParseAllowlist("", "example.org")
+	if err != nil {
+		t.Fatal("failed to parse allowlist:", err)
+	}
+	svc := NewService(
+		WithDB(memstore.New()),
+		WithAllowlist(allowlist),
+		WithCaptcha(&mockCaptcha{}),
+		WithLimits(Limits{Domain: 2}),
+	)
+
+	challenge := func(email string) bool {
+		r := httptest.NewRequest("GET", "/api/v1/signup/challenge", nil)
+		r.RemoteAddr = "203.0.113.5:5000"
+		required, err := svc.Challenge(ctx, r, email)
+		if err != nil {
+			t.Fatal("expected nil error:", err)
+		}
+		return required
+	}
+
+	if !challenge("jane@yopmail.com") {
+		t.Error("expected challenge for disposable domain")
+	}
+	if challenge("jane@example.org") {
+		t.Error("expected no challenge for allowlisted domain")
+	}
+
+	for i := 0; i < 3; i++ {
+		if challenge("jane@example.com") {
+			t.Error("expected no challenge before attempts are recorded")
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("POST", "/api/v1/signup", nil)
+		r.RemoteAddr = fmt.Sprintf("198.51.%v.1:5000", i)
+		if err = svc.Check(ctx, r, fmt.Sprintf("user-%v@example.com", i)); err != nil {
+			t.Fatal("expected nil error:", err)
+		}
+	}
+	if !challenge("jane@example.com") {
+		t.Error("expected challenge once domain limit is reached")
+	}
+}
+
+func TestSignupAbuse_Disabled(t *testing.T) {
+	svc := NewService(WithLimits(Limits{Source: 1}))
+	r := httptest.NewRequest("POST", "/api/v1/signup", nil)
+
+	for i := 0; i < 3; i++ {
+		if err := svc.Check(context.Background(), r, "jane@yopmail.com"); err != nil {
+			t.Error("expected nil error:", err)
+		}
+	}
+
+	stats, err := svc.Stats(context.Background())
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	if stats[OutcomeAllowed] != 0 {
+		t.Errorf("incorrect stats: %v", stats)
+	}
+}
+
+func TestSignupAbuse_ParseAllowlist(t *testing.T) {
+	allowlist, err := ParseAllowlist("203.0.113.0/24, 2001:db8::1", "Example.com")
+	if err != nil {
+		t.Fatal("failed to parse allowlist:", err)
+	}
+
+	for ip, allowed := range map[string]bool{
+		"203.0.113.9":  true,
+		"2001:db8::1":  true,
+		"2001:db8::2":  false,
+		"198.51.100.1": false,
+		"not-an-ip":    false,
+	} {
+		if allowlist.HasIP(ip) != allowed {
+			t.Errorf("incorrect IP result for %s, want %v", ip, allowed)
+		}
+	}
+	for domain, allowed := range map[string]bool{
+		"example.com":      true,
+		"mail.example.com": true,
+		"notexample.com":   false,
+	} {
+		if allowlist.HasDomain(domain) != allowed {
+			t.Errorf("incorrect domain result for %s, want %v", domain, allowed)
+		}
+	}
+
+	if _, err = ParseAllowlist("203.0.113.0/33", ""); err == nil {
+		t.Error("expected error for invalid network")
+	}
+}
+
+func TestSignupAbuse_ReadDomains(t *testing.T) {
+	domains, err := ReadDomains(strings.NewReader("# disposable\nyopmail.com\n\n mailinator.com \n"))
+	if err != nil {
+		t.Fatal("failed to read domains:", err)
+	}
+	if !cmp.Equal(domains, []string{"yopmail.com", "mailinator.com"}) {
+		t.Error(cmp.Diff(domains, []string{"yopmail.com", "mailinator.com"}))
+	}
+}
@@ -1,15 +1,35 @@
 package signupapi
 
 import (
+	"time"
+
 	"github.com/go-kit/kit/log"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/attestation"
+	"github.com/fmitra/authenticator/internal/featureflag"
+	"github.com/fmitra/authenticator/internal/signupabuse"
+	"github.com/fmitra/authenticator/internal/signuppolicy"
+)
+
+const (
+	defaultResendCooldown = time.Minute
+	defaultResendLimit    = 5
+	defaultResendWindow   = time.Hour
 )
 
 // NewService returns a new implementation of auth.SignUpAPI.
 func NewService(options ...ConfigOption) auth.SignUpAPI {
 	s := service{
-		logger: log.NewNopLogger(),
+		logger:         log.NewNopLogger(),
+		attestation:    attestation.NewService(),
+		policy:         signuppolicy.Default(),
+		abuse:          signupabuse.NewService(),
+		features:       featureflag.NewService(),
+		resendCooldown: defaultResendCooldown,
+		resendLimit:    defaultResendLimit,
+		resendWindow:   defaultResendWindow,
+		hooks:          auth.NopHooks{},
 	}
 
 	for _, opt := range options {
@@ -56,3 +76,67 @@ func WithOTP(o auth.OTPService) ConfigOption {
 		s.otp = o
 	}
 }
+
+// WithAttestation configures the service with an AttestationService
+// to verify mobile clients before issuing tokens.
+func WithAttestation(a auth.AttestationService) ConfigOption {
+	return func(s *service) {
+		s.attestation = a
+	}
+}
+
+// WithPolicy configures the requirements a new User must meet
+// to register.
+func WithPolicy(p *signuppolicy.Policy) ConfigOption {
+	return func(s *service) {
+		s.policy = p
+	}
+}
+
+// WithAbuseDetector configures the service to throttle bursts
+// of registrations.
+func WithAbuseDetector(a auth.SignupAbuseDetector) ConfigOption {
+	return func(s *service) {
+		s.abuse = a
+	}
+}
+
+// WithCaptchaSiteKey configures the public site key clients render
+// a CAPTCHA with when a registration is challenged.
+func WithCaptchaSiteKey(key string) ConfigOption {
+	return func(s *service) {
+		s.captchaSiteKey = key
+	}
+}
+
+// WithFeatureFlags configures the service with a FeatureFlagService.
+func WithFeatureFlags(f auth.FeatureFlagService) ConfigOption {
+	return func(s *service) {
+		s.features = f
+	}
+}
+
+// WithDB configures the service with a Redis DB to throttle
+// resent signup codes.
+func WithDB(db rediser) ConfigOption {
+	return func(s *service) {
+		s.db = db
+	}
+}
+
+// WithResendThrottle configures the cooldown between resent signup
+// codes and the number of codes an address may receive within a window.
+func WithResendThrottle(cooldown time.Duration, limit int64, window time.Duration) ConfigOption {
+	return func(s *service) {
+		s.resendCooldown = cooldown
+		s.resendLimit = limit
+		s.resendWindow = window
+	}
+}
+
+// WithHooks configures the service with Hooks run during signup.
+func WithHooks(h auth.Hooks) ConfigOption {
+	return func(s *service) {
+		s.hooks = h
+	}
+}
@@ -15,7 +15,7 @@ import (
 func SetupHTTPHandler(svc auth.SignUpAPI, router *mux.Router, tokenSvc auth.TokenService, logger log.Logger, lmt httpapi.LimiterFactory) {
 	var handler httpapi.JSONAPIHandler
 	{
-		handler = svc.SignUp
+		handler = httpapi.PolicyMiddleware(svc.SignUp, tokenSvc, httpapi.PublicPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"SignUpAPI.SignUp", httpapi.PerMinute, int64(10),
 		))
@@ -24,7 +24,7 @@ func SetupHTTPHandler(svc auth.SignUpAPI, router *mux.Router, tokenSvc auth.Toke
 		router.HandleFunc("/api/v1/signup", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Verify, tokenSvc, auth.JWTPreAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Verify, tokenSvc, httpapi.PreAuthorizedPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"SignUpAPI.Verify", httpapi.PerMinute, int64(10),
 		))
@@ -32,4 +32,22 @@ func SetupHTTPHandler(svc auth.SignUpAPI, router *mux.Router, tokenSvc auth.Toke
 		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
 		router.HandleFunc("/api/v1/signup/verify", httpHandler).Methods("Post")
 	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.Resend, tokenSvc, httpapi.PreAuthorizedPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"SignUpAPI.Resend", httpapi.PerMinute, int64(5),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/signup/resend", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.Challenge, tokenSvc, httpapi.PublicPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"SignUpAPI.Challenge", httpapi.PerMinute, int64(20),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/signup/challenge", httpHandler).Methods("Get")
+	}
 }
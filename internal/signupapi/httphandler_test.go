@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -16,8 +17,10 @@ import (
 
 	auth "github.com/fmitra/authenticator"
 	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/memstore"
 	"github.com/fmitra/authenticator/internal/otp"
 	"github.com/fmitra/authenticator/internal/postgres"
+	"github.com/fmitra/authenticator/internal/signuppolicy"
 	"github.com/fmitra/authenticator/internal/test"
 )
 
@@ -29,6 +32,7 @@ func TestSignUpAPI_SignUp(t *testing.T) {
 		reqBody         []byte
 		userCreateCalls int
 		messagingCalls  int
+		policy          *signuppolicy.Policy
 		userGetFn       func() (*auth.User, error)
 		userCreateFn    func() error
 		tokenCreateFn   func() (*auth.Token, error)
@@ -174,6 +178,71 @@ func TestSignUpAPI_SignUp(t *testing.T) {
 				return "jwt-token", nil
 			},
 		},
+		{
+			name:       "Password required by policy",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Password is required",
+			reqBody: []byte(`{
+				"type": "email",
+				"identity": "jane@example.com"
+			}`),
+			userCreateCalls: 0,
+			messagingCalls:  0,
+			userGetFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+		},
+		{
+			name:       "Phone required by policy",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Phone number is required",
+			reqBody: []byte(`{
+				"type": "email",
+				"password": "swordfish",
+				"identity": "jane@example.com"
+			}`),
+			userCreateCalls: 0,
+			messagingCalls:  0,
+			policy: &signuppolicy.Policy{
+				RequireEmail:    true,
+				RequirePhone:    true,
+				RequirePassword: true,
+			},
+			userGetFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+		},
+		{
+			name:       "Passwordless signup allowed by policy",
+			statusCode: http.StatusCreated,
+			reqBody: []byte(`{
+				"type": "email",
+				"identity": "jane@example.com",
+				"phone": "+15555555555"
+			}`),
+			userCreateCalls: 1,
+			messagingCalls:  1,
+			policy: &signuppolicy.Policy{
+				RequireEmail: true,
+				RequirePhone: true,
+			},
+			userGetFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+			userCreateFn: func() error {
+				return nil
+			},
+			tokenCreateFn: func() (*auth.Token, error) {
+				return &auth.Token{
+					CodeHash: test.MockTokenHash("", "", time.Now().Add(time.Minute*5).Unix()),
+					State:    auth.JWTPreAuthorized,
+					Code:     test.OTPCode,
+				}, nil
+			},
+			tokenSignFn: func() (string, error) {
+				return "jwt-token", nil
+			},
+		},
 		{
 			name:       "Successful request",
 			statusCode: http.StatusCreated,
@@ -195,6 +264,7 @@ func TestSignUpAPI_SignUp(t *testing.T) {
 				return &auth.Token{
 					CodeHash: test.MockTokenHash("", "", time.Now().Add(time.Minute*5).Unix()),
 					State:    auth.JWTPreAuthorized,
+					Code:     test.OTPCode,
 				}, nil
 			},
 			tokenSignFn: func() (string, error) {
@@ -221,12 +291,16 @@ func TestSignUpAPI_SignUp(t *testing.T) {
 				SignFn:   tc.tokenSignFn,
 			}
 			messagingSvc := &test.MessagingService{}
-			svc := NewService(
+			options := []ConfigOption{
 				WithLogger(&test.Logger{}),
 				WithTokenService(tokenSvc),
 				WithRepoManager(repoMngr),
 				WithMessaging(messagingSvc),
-			)
+			}
+			if tc.policy != nil {
+				options = append(options, WithPolicy(tc.policy))
+			}
+			svc := NewService(options...)
 
 			req, err := http.NewRequest(
 				"POST",
@@ -577,3 +651,214 @@ func TestSignUpAPI_VerifyCodeSuccess(t *testing.T) {
 			messagingSvc.Calls.Send)
 	}
 }
+
+func TestSignUpAPI_Resend(t *testing.T) {
+	tt := []struct {
+		name           string
+		statusCode     int
+		errMessage     string
+		requests       int
+		cooldown       time.Duration
+		resendLimit    int64
+		user           *auth.User
+		messagingCalls int
+		tokenCalls     int
+	}{
+		{
+			name:           "Verified user failure",
+			statusCode:     http.StatusBadRequest,
+			errMessage:     "User is already verified",
+			requests:       1,
+			resendLimit:    5,
+			user:           &auth.User{IsVerified: true, IsEmailOTPAllowed: true},
+			messagingCalls: 0,
+			tokenCalls:     0,
+		},
+		{
+			name:           "Cooldown failure",
+			statusCode:     http.StatusTooManyRequests,
+			errMessage:     "Code was sent recently",
+			requests:       2,
+			cooldown:       time.Minute,
+			resendLimit:    5,
+			user:           &auth.User{IsEmailOTPAllowed: true},
+			messagingCalls: 1,
+			tokenCalls:     1,
+		},
+		{
+			name:           "Attempt limit failure",
+			statusCode:     http.StatusTooManyRequests,
+			errMessage:     "Too many codes requested",
+			requests:       3,
+			resendLimit:    2,
+			user:           &auth.User{IsEmailOTPAllowed: true},
+			messagingCalls: 2,
+			tokenCalls:     2,
+		},
+		{
+			name:           "Successful request",
+			statusCode:     http.StatusOK,
+			requests:       1,
+			cooldown:       time.Minute,
+			resendLimit:    5,
+			user:           &auth.User{IsEmailOTPAllowed: true},
+			messagingCalls: 1,
+			tokenCalls:     1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			userRepo := &test.UserRepository{
+				ByIdentityFn: func() (*auth.User, error) {
+					return tc.user, nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return userRepo
+				},
+			}
+			codeHash := test.MockTokenHash("", "", time.Now().Add(time.Minute*5).Unix())
+			tokenSvc := &test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					return &auth.Token{
+						CodeHash: codeHash,
+						State:    auth.JWTPreAuthorized,
+					}, nil
+				},
+				CreateFn: func() (*auth.Token, error) {
+					return &auth.Token{Code: "123456", CodeHash: codeHash}, nil
+				},
+				SignFn: func() (string, error) {
+					return "jwt-token", nil
+				},
+			}
+			messagingSvc := &test.MessagingService{}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithTokenService(tokenSvc),
+				WithRepoManager(repoMngr),
+				WithMessaging(messagingSvc),
+				WithDB(memstore.New()),
+				WithResendThrottle(tc.cooldown, tc.resendLimit, time.Hour),
+			)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			var rr *httptest.ResponseRecorder
+			for i := 0; i < tc.requests; i++ {
+				req, err := http.NewRequest("POST", "/api/v1/signup/resend", nil)
+				if err != nil {
+					t.Fatal("failed to create request:", err)
+				}
+				test.SetAuthHeaders(req)
+
+				rr = httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+			}
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+
+			err := test.ValidateErrMessage(tc.errMessage, rr.Body)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if messagingSvc.Calls.Send != tc.messagingCalls {
+				t.Errorf("incorrect MessagingService.Send() call count, want %v got %v",
+					tc.messagingCalls, messagingSvc.Calls.Send)
+			}
+
+			if tokenSvc.Calls.Create != tc.tokenCalls {
+				t.Errorf("incorrect TokenService.Create() call count, want %v got %v",
+					tc.tokenCalls, tokenSvc.Calls.Create)
+			}
+		})
+	}
+}
+
+func TestSignUpAPI_Challenge(t *testing.T) {
+	tt := []struct {
+		name        string
+		statusCode  int
+		challengeFn func() (bool, error)
+		required    bool
+	}{
+		{
+			name:       "No challenge required",
+			statusCode: http.StatusOK,
+			challengeFn: func() (bool, error) {
+				return false, nil
+			},
+		},
+		{
+			name:       "Challenge required",
+			statusCode: http.StatusOK,
+			challengeFn: func() (bool, error) {
+				return true, nil
+			},
+			required: true,
+		},
+		{
+			name:       "Abuse detector failure",
+			statusCode: http.StatusInternalServerError,
+			challengeFn: func() (bool, error) {
+				return false, fmt.Errorf("whoops")
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			tokenSvc := &test.TokenService{}
+			abuse := &test.SignupAbuseDetector{ChallengeFn: tc.challengeFn}
+			svc := NewService(
+				WithLogger(&test.Logger{}),
+				WithTokenService(tokenSvc),
+				WithRepoManager(&test.RepositoryManager{}),
+				WithAbuseDetector(abuse),
+				WithCaptchaSiteKey("site-key"),
+			)
+
+			req, err := http.NewRequest("GET", "/api/v1/signup/challenge?email=jane@yopmail.com", nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+				t.Error(rr.Body.String())
+			}
+			if abuse.Calls.Challenge != 1 {
+				t.Errorf("incorrect SignupAbuseDetector.Challenge() call count, want 1 got %v",
+					abuse.Calls.Challenge)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var resp challengeResponse
+			if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal("failed to decode response:", err)
+			}
+			if resp.Required != tc.required {
+				t.Errorf("incorrect challenge, want %v got %v", tc.required, resp.Required)
+			}
+			if tc.required && (resp.Type != "captcha" || resp.SiteKey != "site-key") {
+				t.Errorf("incorrect challenge details: %+v", resp)
+			}
+		})
+	}
+}
@@ -2,18 +2,23 @@ package signupapi
 
 import (
 	"database/sql"
-	"encoding/json"
-	"fmt"
 	"net/http"
 	"strings"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/httpapi"
 )
 
 type signupRequest struct {
 	Password string              `json:"password"`
 	Identity string              `json:"identity"`
 	Type     auth.DeliveryMethod `json:"type"`
+	// Email and Phone are optional addresses collected in addition
+	// to the Identity when required by the signup policy.
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	BirthDate string `json:"birthDate"`
 }
 
 type signupVerifyRequest struct {
@@ -43,10 +48,14 @@ func (r *signupRequest) ToUser() *auth.User {
 
 	if r.Type == "email" {
 		user.Email = identity
+	} else if r.Email != "" {
+		user.Email = sql.NullString{String: r.Email, Valid: true}
 	}
 
 	if r.Type == "phone" {
 		user.Phone = identity
+	} else if r.Phone != "" {
+		user.Phone = sql.NullString{String: r.Phone, Valid: true}
 	}
 
 	return &user
@@ -62,16 +71,30 @@ func decodeSignupRequest(r *http.Request) (*signupRequest, error) {
 		return nil, auth.ErrBadRequest("no request body received")
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err = httpapi.DecodeJSON(r, &req)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+		return nil, httpapi.DecodeJSONError(err)
 	}
 
+	req.Identity = contactchecker.Normalize(req.Type, req.Identity)
+	req.Email = contactchecker.NormalizeUnicode(req.Email)
+	req.Phone = contactchecker.NormalizePhone(req.Phone)
+	req.BirthDate = strings.TrimSpace(req.BirthDate)
+
+	var errs auth.ErrValidation
 	if req.UserAttribute() == "" {
-		return nil, auth.ErrBadRequest("identity type must be email or phone")
+		errs = append(errs, auth.FieldError{
+			Field: "type", Code: auth.FieldInvalid, Message: "identity type must be email or phone",
+		})
+	}
+	if req.Identity == "" {
+		errs = append(errs, auth.FieldError{
+			Field: "identity", Code: auth.FieldRequired, Message: "identity cannot be empty",
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errs
 	}
-
-	req.Identity = strings.TrimSpace(req.Identity)
 
 	return &req, nil
 }
@@ -86,9 +109,9 @@ func decodeSignupVerifyRequest(r *http.Request) (*signupVerifyRequest, error) {
 		return nil, auth.ErrBadRequest("no request body received")
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&req)
+	err = httpapi.DecodeJSON(r, &req)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+		return nil, httpapi.DecodeJSONError(err)
 	}
 
 	req.Code = strings.TrimSpace(req.Code)
@@ -36,6 +36,19 @@ func TestSignUpAPI_SignUpRequest(t *testing.T) {
 			}`),
 			hasError: false,
 		},
+		{
+			name:  "Is email attribute with additional phone",
+			email: "jane@example.com",
+			phone: "+15555555555",
+			request: []byte(`{
+				"password": "swordfish",
+				"identity": "jane@example.com",
+				"type": "email",
+				"email": "john@example.com",
+				"phone": " +15555555555 "
+			}`),
+			hasError: false,
+		},
 		{
 			name:  "Is missing attribute",
 			email: "",
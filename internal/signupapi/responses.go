@@ -0,0 +1,8 @@
+package signupapi
+
+// challengeResponse is a success response for SignUpAPI.Challenge.
+type challengeResponse struct {
+	Required bool   `json:"required"`
+	Type     string `json:"type,omitempty"`
+	SiteKey  string `json:"siteKey,omitempty"`
+}
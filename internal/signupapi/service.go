@@ -6,33 +6,81 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-redis/redis/v8"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
 	"github.com/fmitra/authenticator/internal/httpapi"
 	"github.com/fmitra/authenticator/internal/otp"
+	"github.com/fmitra/authenticator/internal/signuppolicy"
 	"github.com/fmitra/authenticator/internal/token"
 )
 
+// rediser is a minimal interface for go-redis.
+type rediser interface {
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+}
+
 type service struct {
-	logger   log.Logger
-	token    auth.TokenService
-	repoMngr auth.RepositoryManager
-	message  auth.MessagingService
-	otp      auth.OTPService
+	logger         log.Logger
+	token          auth.TokenService
+	repoMngr       auth.RepositoryManager
+	message        auth.MessagingService
+	otp            auth.OTPService
+	attestation    auth.AttestationService
+	policy         *signuppolicy.Policy
+	abuse          auth.SignupAbuseDetector
+	features       auth.FeatureFlagService
+	db             rediser
+	resendCooldown time.Duration
+	resendLimit    int64
+	resendWindow   time.Duration
+	hooks          auth.Hooks
+	captchaSiteKey string
 }
 
 // SignUp is the initial registration step to create a new User.
 func (s *service) SignUp(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	ctx := r.Context()
 
+	if !s.features.Enabled(ctx, auth.FeatureSignUp) {
+		return nil, auth.ErrForbidden("signup is disabled")
+	}
+
+	if err := s.attestation.Verify(ctx, r); err != nil {
+		return nil, err
+	}
+
 	req, err := decodeSignupRequest(r)
 	if err != nil {
 		return nil, err
 	}
 
 	newUser := req.ToUser()
+	applicant := signuppolicy.Applicant{
+		Email:     newUser.Email.String,
+		Phone:     newUser.Phone.String,
+		Password:  req.Password,
+		BirthDate: req.BirthDate,
+		Region:    s.policy.Region(r),
+	}
+	if err = s.policy.Evaluate(&applicant); err != nil {
+		return nil, err
+	}
+
+	if err = s.abuse.Check(ctx, r, newUser.Email.String); err != nil {
+		return nil, err
+	}
+
+	if err = s.hooks.BeforeSignup(ctx, newUser); err != nil {
+		return nil, err
+	}
+
 	user, err := s.repoMngr.User().ByIdentity(ctx, req.UserAttribute(), req.Identity)
 
 	if isUserCheckFailed(err) {
@@ -69,14 +117,55 @@ func (s *service) SignUp(w http.ResponseWriter, r *http.Request) (interface{}, e
 		return nil, err
 	}
 
-	return s.respond(ctx, w, newUser, jwtToken)
+	return s.respond(ctx, w, auth.OTPSignup, jwtToken)
+}
+
+// Resend delivers a new signup code to the address the previous code
+// was sent to. The previous code is invalidated. Requests are subject
+// to a cooldown and a cap on attempts per address.
+func (s *service) Resend(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+	preAuthToken := httpapi.GetToken(r)
+
+	user, err := s.repoMngr.User().ByIdentity(ctx, "ID", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsVerified {
+		return nil, auth.ErrBadRequest("user is already verified")
+	}
+
+	h, err := otp.FromOTPHash(preAuthToken.CodeHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.throttleResend(ctx, h.Address); err != nil {
+		return nil, err
+	}
+
+	jwtToken, err := s.token.Create(
+		ctx,
+		user,
+		auth.JWTPreAuthorized,
+		token.WithOTPDeliveryMethod(h.DeliveryMethod),
+		token.WithOTPAddress(h.Address),
+		token.WithRefreshableToken(preAuthToken),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.respond(ctx, w, auth.OTPResend, jwtToken)
 }
 
 // Verify is the final registration step to validate a new User's authenticity.
 func (s *service) Verify(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	ctx := r.Context()
 	userID := httpapi.GetUserID(r)
-	token := httpapi.GetToken(r)
+	preAuthToken := httpapi.GetToken(r)
 
 	req, err := decodeSignupVerifyRequest(r)
 	if err != nil {
@@ -88,16 +177,27 @@ func (s *service) Verify(w http.ResponseWriter, r *http.Request) (interface{}, e
 		return nil, err
 	}
 
-	if err = s.otp.ValidateOTP(req.Code, token.CodeHash); err != nil {
+	if err = s.otp.ValidateOTP(req.Code, preAuthToken.CodeHash); err != nil {
 		return nil, err
 	}
 
-	jwtToken, err := s.token.Create(ctx, user, auth.JWTAuthorized)
+	h, err := otp.FromOTPHash(preAuthToken.CodeHash)
 	if err != nil {
 		return nil, err
 	}
+	restrictOTPDelivery(user, h.DeliveryMethod)
 
-	if err = s.markUserVerified(ctx, user); err != nil {
+	jwtToken, err := s.token.Create(
+		ctx,
+		user,
+		auth.JWTAuthorized,
+		token.WithDeviceBinding(httpapi.GetDeviceID(r)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.markUserVerified(ctx, user, h.DeliveryMethod); err != nil {
 		return nil, err
 	}
 
@@ -106,11 +206,66 @@ func (s *service) Verify(w http.ResponseWriter, r *http.Request) (interface{}, e
 		TokenID:   jwtToken.Id,
 		ExpiresAt: s.token.RefreshableTill(ctx, jwtToken, jwtToken.RefreshToken),
 	}
+	httpapi.SetLoginOrigin(loginHistory, r)
 	if err = s.repoMngr.LoginHistory().Create(ctx, loginHistory); err != nil {
 		return nil, err
 	}
 
-	return s.respond(ctx, w, user, jwtToken)
+	if err = s.hooks.AfterSignup(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return s.respond(ctx, w, auth.OTPSignup, jwtToken)
+}
+
+// throttleResend enforces the resend cooldown and attempt cap
+// of an address. Without a database, resends are not throttled.
+// A cooldown of zero is disabled.
+func (s *service) throttleResend(ctx context.Context, address string) error {
+	if s.db == nil {
+		return nil
+	}
+
+	h, err := crypto.Hash(address)
+	if err != nil {
+		return fmt.Errorf("cannot hash address: %w", err)
+	}
+
+	if s.resendCooldown > 0 {
+		ok, err := s.db.SetNX(ctx, CooldownKey(h), true, s.resendCooldown).Result()
+		if err != nil {
+			return fmt.Errorf("cannot apply resend cooldown: %w", err)
+		}
+		if !ok {
+			return auth.ErrThrottle("code was sent recently")
+		}
+	}
+
+	count, err := s.db.Incr(ctx, AttemptsKey(h)).Result()
+	if err != nil {
+		return fmt.Errorf("cannot count resend attempts: %w", err)
+	}
+	if count == 1 {
+		if err = s.db.Expire(ctx, AttemptsKey(h), s.resendWindow).Err(); err != nil {
+			return fmt.Errorf("cannot count resend attempts: %w", err)
+		}
+	}
+	if count > s.resendLimit {
+		return auth.ErrThrottle("too many codes requested")
+	}
+
+	return nil
+}
+
+// CooldownKey is the key of an address hash which may not receive
+// another signup code until it expires.
+func CooldownKey(addressHash string) string {
+	return fmt.Sprintf("signup_resend_%s_cooldown", addressHash)
+}
+
+// AttemptsKey is the key counting signup codes resent to an address hash.
+func AttemptsKey(addressHash string) string {
+	return fmt.Sprintf("signup_resend_%s_attempts", addressHash)
 }
 
 // reCreateUser re-creates the account of a non verified user. A user
@@ -158,8 +313,9 @@ func (s *service) createUser(ctx context.Context, newUser *auth.User) error {
 	return s.repoMngr.User().Create(ctx, newUser)
 }
 
-// respond creates a JWT token response.
-func (s *service) respond(ctx context.Context, w http.ResponseWriter, _ *auth.User, jwtToken *auth.Token) (*token.Response, error) {
+// respond creates a JWT token response and delivers the token's
+// OTP code, if any, as a message of the given type.
+func (s *service) respond(ctx context.Context, w http.ResponseWriter, msgType auth.MessageType, jwtToken *auth.Token) (*token.Response, error) {
 	tokenStr, err := s.token.Sign(ctx, jwtToken)
 	if err != nil {
 		return nil, err
@@ -169,14 +325,16 @@ func (s *service) respond(ctx context.Context, w http.ResponseWriter, _ *auth.Us
 		http.SetCookie(w, cookie)
 	}
 
-	if jwtToken.CodeHash != "" {
+	// Tokens reusing a code delivered moments ago carry no code
+	// to deliver.
+	if jwtToken.Code != "" {
 		h, err := otp.FromOTPHash(jwtToken.CodeHash)
 		if err != nil {
 			return nil, fmt.Errorf("invalid OTP created: %w", err)
 		}
 
 		msg := &auth.Message{
-			Type:     auth.OTPSignup,
+			Type:     msgType,
 			Delivery: h.DeliveryMethod,
 			Vars:     map[string]string{"code": jwtToken.Code},
 			Address:  h.Address,
@@ -187,8 +345,10 @@ func (s *service) respond(ctx context.Context, w http.ResponseWriter, _ *auth.Us
 	}
 
 	resp := token.Response{
-		Token:    tokenStr,
-		ClientID: jwtToken.ClientID,
+		Token:      tokenStr,
+		ClientID:   jwtToken.ClientID,
+		State:      jwtToken.State,
+		TFAOptions: jwtToken.TFAOptions,
 	}
 	if jwtToken.State == auth.JWTAuthorized {
 		resp.RefreshToken = jwtToken.RefreshToken
@@ -196,7 +356,9 @@ func (s *service) respond(ctx context.Context, w http.ResponseWriter, _ *auth.Us
 	return &resp, nil
 }
 
-func (s *service) markUserVerified(ctx context.Context, user *auth.User) error {
+// markUserVerified marks a User as verified along with the address
+// the signup code was delivered to.
+func (s *service) markUserVerified(ctx context.Context, user *auth.User, method auth.DeliveryMethod) error {
 	client, err := s.repoMngr.NewWithTransaction(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
@@ -209,6 +371,8 @@ func (s *service) markUserVerified(ctx context.Context, user *auth.User) error {
 		}
 
 		user.IsVerified = true
+		restrictOTPDelivery(user, method)
+
 		if err = client.User().Update(ctx, user); err != nil {
 			return nil, fmt.Errorf("failed to save verified user: %w", err)
 		}
@@ -222,6 +386,18 @@ func (s *service) markUserVerified(ctx context.Context, user *auth.User) error {
 	return nil
 }
 
+// restrictOTPDelivery limits OTP delivery to the address the signup
+// code was delivered to. Any additional address collected at signup
+// may not receive OTP codes until verified through the Contact API.
+func restrictOTPDelivery(user *auth.User, method auth.DeliveryMethod) {
+	switch method {
+	case auth.Email:
+		user.IsPhoneOTPAllowed = false
+	case auth.Phone:
+		user.IsEmailOTPAllowed = false
+	}
+}
+
 func isUserVerified(user *auth.User, err error) bool {
 	return err == nil && user.IsVerified
 }
@@ -237,3 +413,21 @@ func isUserNonExistent(user *auth.User, err error) bool {
 func isUserCheckFailed(err error) bool {
 	return err != nil && err != sql.ErrNoRows
 }
+
+// Challenge reports whether a registration from the client must solve
+// a CAPTCHA. Clients may pass the email address being registered as the
+// `email` query parameter, as disposable and busy email domains are
+// challenged.
+func (s *service) Challenge(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	required, err := s.abuse.Challenge(r.Context(), r, r.URL.Query().Get("email"))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := challengeResponse{Required: required}
+	if required {
+		resp.Type = "captcha"
+		resp.SiteKey = s.captchaSiteKey
+	}
+	return resp, nil
+}
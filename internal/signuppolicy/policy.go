@@ -0,0 +1,155 @@
+// Package signuppolicy evaluates the requirements a new User must
+// meet to register. Requirements are declared in a single Policy
+// loaded from config rather than checked throughout the signup flow.
+package signuppolicy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/phonenumbers"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+)
+
+// birthDateLayout is the expected format of an Applicant's birth date.
+const birthDateLayout = "2006-01-02"
+
+// Policy declares the requirements for registration.
+type Policy struct {
+	// RequireEmail requires an email address to register.
+	RequireEmail bool
+	// RequirePhone requires a phone number to register.
+	RequirePhone bool
+	// RequirePassword requires a password to register. Users
+	// registered without a password authenticate with an OTP
+	// code delivered to their address.
+	RequirePassword bool
+	// DeniedRegions are ISO 3166-1 alpha-2 region codes from which
+	// registration is not allowed. Regions are matched against the
+	// region of an Applicant's phone number and RegionHeader.
+	DeniedRegions []string
+	// RegionHeader is a request header set by a trusted proxy with
+	// the client's ISO 3166-1 alpha-2 region code (e.g. CF-IPCountry).
+	RegionHeader string
+	// MinimumAge is the minimum age in years to register. A birth
+	// date is required when set.
+	MinimumAge int
+	// RejectMixedScripts rejects email addresses mixing letters of
+	// different scripts, such as homographs of existing addresses
+	// using Cyrillic lookalikes of Latin letters.
+	RejectMixedScripts bool
+}
+
+// Applicant describes a registration attempt.
+type Applicant struct {
+	Email    string
+	Phone    string
+	Password string
+	// BirthDate is the Applicant's birth date as YYYY-MM-DD.
+	BirthDate string
+	// Region is the client's region as reported by RegionHeader.
+	Region string
+}
+
+// Default returns the Policy applied when none is configured.
+func Default() *Policy {
+	return &Policy{RequirePassword: true}
+}
+
+// Region returns the client's region as reported by the
+// Policy's RegionHeader.
+func (p *Policy) Region(r *http.Request) string {
+	if p.RegionHeader == "" {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimSpace(r.Header.Get(p.RegionHeader)))
+}
+
+// Evaluate checks if an Applicant meets all requirements to register.
+func (p *Policy) Evaluate(a *Applicant) error {
+	if p.RequireEmail && a.Email == "" {
+		return auth.ErrField("email", auth.FieldRequired, "email address is required")
+	}
+
+	if p.RequirePhone && a.Phone == "" {
+		return auth.ErrField("phone", auth.FieldRequired, "phone number is required")
+	}
+
+	if p.RequirePassword && a.Password == "" {
+		return auth.ErrField("password", auth.FieldRequired, "password is required")
+	}
+
+	if p.RejectMixedScripts && contactchecker.IsEmailHomograph(a.Email) {
+		return auth.ErrField("email", auth.FieldInvalid, "email address mixes characters from different scripts")
+	}
+
+	if p.isRegionDenied(a.Region) || p.isRegionDenied(phoneRegion(a.Phone)) {
+		return auth.ErrForbidden("signup is not available in your region")
+	}
+
+	return p.checkAge(a.BirthDate, time.Now())
+}
+
+func (p *Policy) isRegionDenied(region string) bool {
+	if region == "" {
+		return false
+	}
+
+	for _, denied := range p.DeniedRegions {
+		if strings.EqualFold(strings.TrimSpace(denied), region) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) checkAge(birthDate string, now time.Time) error {
+	if p.MinimumAge <= 0 {
+		return nil
+	}
+
+	if birthDate == "" {
+		return auth.ErrField("birthDate", auth.FieldRequired, "birth date is required")
+	}
+
+	born, err := time.Parse(birthDateLayout, birthDate)
+	if err != nil {
+		return auth.ErrField("birthDate", auth.FieldFormat, "birth date must be in the format YYYY-MM-DD")
+	}
+
+	if age(born, now) < p.MinimumAge {
+		return auth.ErrForbidden(
+			fmt.Sprintf("you must be at least %v years old to sign up", p.MinimumAge),
+		)
+	}
+
+	return nil
+}
+
+// age returns the number of full years between born and now.
+func age(born, now time.Time) int {
+	years := now.Year() - born.Year()
+	if now.Month() < born.Month() || (now.Month() == born.Month() && now.Day() < born.Day()) {
+		years--
+	}
+	return years
+}
+
+// phoneRegion returns the ISO 3166-1 alpha-2 region of a phone number.
+func phoneRegion(phone string) string {
+	if phone == "" {
+		return ""
+	}
+
+	meta, err := phonenumbers.Parse(phone, "")
+	if err != nil {
+		return ""
+	}
+
+	return phonenumbers.GetRegionCodeForNumber(meta)
+}
@@ -0,0 +1,178 @@
+package signuppolicy
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+func TestSignUpPolicy_Evaluate(t *testing.T) {
+	adult := time.Now().AddDate(-20, 0, 0).Format(birthDateLayout)
+	minor := time.Now().AddDate(-12, 0, 0).Format(birthDateLayout)
+
+	tt := []struct {
+		name       string
+		policy     Policy
+		applicant  Applicant
+		errMessage string
+	}{
+		{
+			name:      "Default policy with password",
+			policy:    *Default(),
+			applicant: Applicant{Email: "jane@example.com", Password: "swordfish"},
+		},
+		{
+			name:       "Default policy without password",
+			policy:     *Default(),
+			applicant:  Applicant{Email: "jane@example.com"},
+			errMessage: "password is required",
+		},
+		{
+			name:      "Password optional",
+			policy:    Policy{},
+			applicant: Applicant{Email: "jane@example.com"},
+		},
+		{
+			name:       "Email required",
+			policy:     Policy{RequireEmail: true},
+			applicant:  Applicant{Phone: "+15555555555"},
+			errMessage: "email address is required",
+		},
+		{
+			name:       "Phone required",
+			policy:     Policy{RequireEmail: true, RequirePhone: true},
+			applicant:  Applicant{Email: "jane@example.com"},
+			errMessage: "phone number is required",
+		},
+		{
+			name:   "Email and phone provided",
+			policy: Policy{RequireEmail: true, RequirePhone: true},
+			applicant: Applicant{
+				Email: "jane@example.com",
+				Phone: "+6594867353",
+			},
+		},
+		{
+			name:       "Phone from denied region",
+			policy:     Policy{DeniedRegions: []string{"SG"}},
+			applicant:  Applicant{Phone: "+6594867353"},
+			errMessage: "signup is not available in your region",
+		},
+		{
+			name:       "Client from denied region",
+			policy:     Policy{DeniedRegions: []string{"US", " sg"}},
+			applicant:  Applicant{Email: "jane@example.com", Region: "SG"},
+			errMessage: "signup is not available in your region",
+		},
+		{
+			name:      "Client from allowed region",
+			policy:    Policy{DeniedRegions: []string{"SG"}},
+			applicant: Applicant{Email: "jane@example.com", Region: "US"},
+		},
+		{
+			name:       "Mixed script email rejected",
+			policy:     Policy{RejectMixedScripts: true},
+			applicant:  Applicant{Email: "j\u0430ne@example.com"},
+			errMessage: "email address mixes characters from different scripts",
+		},
+		{
+			name:      "Mixed script email allowed",
+			policy:    Policy{},
+			applicant: Applicant{Email: "j\u0430ne@example.com"},
+		},
+		{
+			name:      "Single non-Latin script email allowed",
+			policy:    Policy{RejectMixedScripts: true},
+			applicant: Applicant{Email: "\u0438\u0432\u0430\u043d@example.com"},
+		},
+		{
+			name:       "Birth date missing",
+			policy:     Policy{MinimumAge: 13},
+			applicant:  Applicant{Email: "jane@example.com"},
+			errMessage: "birth date is required",
+		},
+		{
+			name:       "Birth date invalid",
+			policy:     Policy{MinimumAge: 13},
+			applicant:  Applicant{Email: "jane@example.com", BirthDate: "01/02/2000"},
+			errMessage: "birth date must be in the format YYYY-MM-DD",
+		},
+		{
+			name:       "Applicant under minimum age",
+			policy:     Policy{MinimumAge: 13},
+			applicant:  Applicant{Email: "jane@example.com", BirthDate: minor},
+			errMessage: "you must be at least 13 years old to sign up",
+		},
+		{
+			name:      "Applicant over minimum age",
+			policy:    Policy{MinimumAge: 13},
+			applicant: Applicant{Email: "jane@example.com", BirthDate: adult},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.policy.Evaluate(&tc.applicant)
+			if tc.errMessage == "" && err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+
+			if tc.errMessage != "" {
+				domainErr := auth.DomainError(err)
+				if domainErr == nil || domainErr.Message() != tc.errMessage {
+					t.Errorf("error message does not match, want '%s' got '%v'", tc.errMessage, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSignUpPolicy_Age(t *testing.T) {
+	now := time.Date(2020, time.June, 15, 0, 0, 0, 0, time.UTC)
+	tt := []struct {
+		name string
+		born time.Time
+		age  int
+	}{
+		{
+			name: "Birthday passed",
+			born: time.Date(2000, time.June, 14, 0, 0, 0, 0, time.UTC),
+			age:  20,
+		},
+		{
+			name: "Birthday today",
+			born: time.Date(2000, time.June, 15, 0, 0, 0, 0, time.UTC),
+			age:  20,
+		},
+		{
+			name: "Birthday upcoming",
+			born: time.Date(2000, time.June, 16, 0, 0, 0, 0, time.UTC),
+			age:  19,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := age(tc.born, now); got != tc.age {
+				t.Errorf("incorrect age, want %v got %v", tc.age, got)
+			}
+		})
+	}
+}
+
+func TestSignUpPolicy_Region(t *testing.T) {
+	p := Policy{RegionHeader: "CF-IPCountry"}
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("CF-IPCountry", " sg ")
+
+	if region := p.Region(r); region != "SG" {
+		t.Errorf("incorrect region, want SG got %s", region)
+	}
+
+	p = Policy{}
+	if region := p.Region(r); region != "" {
+		t.Errorf("region should not be read without a header, got %s", region)
+	}
+}
@@ -0,0 +1,166 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContainersEnv is the environment variable enabling ephemeral
+// Postgres and Redis containers for integration tests. When set to
+// a true value, NewPGDB and NewRedisDB start (or reuse) containers
+// through the docker CLI instead of expecting manually provisioned
+// services.
+const ContainersEnv = "TEST_CONTAINERS"
+
+// containerReadyTimeout is the maximum time we wait for a container
+// to accept connections after it is started.
+const containerReadyTimeout = 60 * time.Second
+
+// container is a docker container backing a test dependency.
+// Containers are named so that test binaries running in parallel
+// share a single instance rather than each starting their own.
+type container struct {
+	name  string
+	image string
+	port  string
+	env   []string
+	cmd   []string
+
+	once sync.Once
+	addr string
+	err  error
+}
+
+var (
+	pgContainer = &container{
+		name:  "authenticator-test-postgres",
+		image: "postgres:11.2",
+		port:  "5432",
+		env: []string{
+			"POSTGRES_USER=auth",
+			"POSTGRES_PASSWORD=swordfish",
+			"POSTGRES_DB=authenticator_test",
+		},
+	}
+	redisContainer = &container{
+		name:  "authenticator-test-redis",
+		image: "redis:5.0.4",
+		port:  "6379",
+		cmd:   []string{"redis-server", "--requirepass", "swordfish"},
+	}
+)
+
+// containersEnabled reports whether ephemeral containers are
+// requested for this test run.
+func containersEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(ContainersEnv))
+	return enabled
+}
+
+// Addr ensures the container is running and returns the host address
+// its port is published on. The result is cached for the lifetime of
+// the test binary.
+func (c *container) Addr() (string, error) {
+	c.once.Do(func() {
+		c.addr, c.err = c.start()
+	})
+	return c.addr, c.err
+}
+
+// start runs the container if it does not already exist and looks up
+// the host port docker assigned to it.
+func (c *container) start() (string, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", fmt.Errorf("%s requires the docker CLI: %w", ContainersEnv, err)
+	}
+
+	running, exists := c.state()
+	switch {
+	case running:
+	case exists:
+		if _, err := docker("start", c.name); err != nil {
+			return "", err
+		}
+	default:
+		args := []string{
+			"run", "-d",
+			"--name", c.name,
+			"--label", "authenticator-test",
+			"-p", "127.0.0.1::" + c.port,
+		}
+		for _, e := range c.env {
+			args = append(args, "-e", e)
+		}
+		args = append(args, c.image)
+		args = append(args, c.cmd...)
+
+		// Another test binary may have won the race to create the
+		// container, in which case we reuse it.
+		if _, err := docker(args...); err != nil {
+			if running, _ = c.state(); !running {
+				return "", err
+			}
+		}
+	}
+
+	out, err := docker("port", c.name, c.port)
+	if err != nil {
+		return "", err
+	}
+
+	// Docker may list both IPv4 and IPv6 bindings, we only
+	// publish on 127.0.0.1 so the first line is sufficient.
+	addr := strings.TrimSpace(strings.SplitN(out, "\n", 2)[0])
+	if addr == "" {
+		return "", fmt.Errorf("no published port for container %s", c.name)
+	}
+
+	return addr, nil
+}
+
+// state reports whether the container is running and whether it
+// exists at all.
+func (c *container) state() (running, exists bool) {
+	out, err := docker("inspect", "-f", "{{.State.Running}}", c.name)
+	if err != nil {
+		return false, false
+	}
+	return strings.TrimSpace(out) == "true", true
+}
+
+// docker runs a docker CLI command and returns its standard output.
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s failed: %v: %w",
+			args[0], strings.TrimSpace(stderr.String()), err)
+	}
+
+	return stdout.String(), nil
+}
+
+// waitReady calls ping until it succeeds or the container
+// ready timeout is reached.
+func waitReady(ping func() error) error {
+	deadline := time.Now().Add(containerReadyTimeout)
+	for {
+		err := ping()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("container not ready: %w", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
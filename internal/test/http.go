@@ -10,8 +10,19 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/gorilla/mux"
+
+	auth "github.com/fmitra/authenticator"
 )
 
+// errResponse is an API error response.
+type errResponse struct {
+	Error struct {
+		Code    string            `json:"code"`
+		Message string            `json:"message"`
+		Fields  []auth.FieldError `json:"fields"`
+	} `json:"error"`
+}
+
 // ServerResp is a path and response for an external test server.
 type ServerResp struct {
 	Path       string
@@ -49,14 +60,30 @@ func ValidateErrMessage(expectedMsg string, body *bytes.Buffer) error {
 		return nil
 	}
 
-	var errResponse map[string]map[string]string
-	err := json.NewDecoder(body).Decode(&errResponse)
+	var resp errResponse
+	err := json.NewDecoder(body).Decode(&resp)
+	if err != nil {
+		return err
+	}
+
+	if resp.Error.Message != expectedMsg {
+		return fmt.Errorf(cmp.Diff(expectedMsg, resp.Error.Message))
+	}
+
+	return nil
+}
+
+// ValidateErrFields validates the field errors of an API validation
+// error in the format of { error: { fields: [] } }
+func ValidateErrFields(expectedFields []auth.FieldError, body *bytes.Buffer) error {
+	var resp errResponse
+	err := json.NewDecoder(body).Decode(&resp)
 	if err != nil {
 		return err
 	}
 
-	if errResponse["error"]["message"] != expectedMsg {
-		return fmt.Errorf(cmp.Diff(expectedMsg, errResponse["error"]["message"]))
+	if !cmp.Equal(expectedFields, resp.Error.Fields) {
+		return fmt.Errorf(cmp.Diff(expectedFields, resp.Error.Fields))
 	}
 
 	return nil
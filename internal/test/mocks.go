@@ -85,6 +85,88 @@ type MessagingService struct {
 	}
 }
 
+// Hooks mocks auth.Hooks interface.
+type Hooks struct {
+	BeforeSignupFn     func() error
+	AfterSignupFn      func() error
+	AfterLoginFn       func() error
+	BeforeTokenIssueFn func(token *auth.Token) error
+	Calls              struct {
+		BeforeSignup     int
+		AfterSignup      int
+		AfterLogin       int
+		BeforeTokenIssue int
+	}
+}
+
+// AttestationService mocks auth.AttestationService interface.
+type AttestationService struct {
+	ChallengeFn func() (string, error)
+	VerifyFn    func() error
+	Calls       struct {
+		Challenge int
+		Verify    int
+	}
+}
+
+// AnomalyDetector mocks auth.AnomalyDetector interface.
+type AnomalyDetector struct {
+	RecordFailureFn func() error
+	CheckFn         func() error
+	ChallengeFn     func() (bool, error)
+	RunFn           func() error
+	Calls           struct {
+		RecordFailure int
+		Check         int
+		Challenge     int
+		Run           int
+	}
+}
+
+// DeliveryStatsService mocks auth.DeliveryStatsService interface.
+type DeliveryStatsService struct {
+	RecordFn func(delivery auth.DeliveryMethod, outcome auth.DeliveryOutcome) error
+	DailyFn  func() ([]*auth.DeliveryStats, error)
+	Calls    struct {
+		Record int
+		Daily  int
+	}
+}
+
+// SignupAbuseDetector mocks auth.SignupAbuseDetector interface.
+type SignupAbuseDetector struct {
+	CheckFn     func() error
+	ChallengeFn func() (bool, error)
+	StatsFn     func() (map[string]int64, error)
+	Calls       struct {
+		Check     int
+		Challenge int
+		Stats     int
+	}
+}
+
+// CanaryService mocks auth.CanaryService interface.
+type CanaryService struct {
+	TripFn func() (bool, error)
+	Calls  struct {
+		Trip int
+	}
+}
+
+// FeatureFlagService mocks auth.FeatureFlagService interface.
+type FeatureFlagService struct {
+	EnabledFn func(f auth.Feature) bool
+	SetFn     func() error
+	ResetFn   func() error
+	ListFn    func() (map[auth.Feature]bool, error)
+	Calls     struct {
+		Enabled int
+		Set     int
+		Reset   int
+		List    int
+	}
+}
+
 // TokenService mocks auth.TokenService interface.
 type TokenService struct {
 	RefreshableTillFn func() time.Time
@@ -93,7 +175,9 @@ type TokenService struct {
 	SignFn            func() (string, error)
 	ValidateFn        func() (*auth.Token, error)
 	RevokeFn          func() error
+	RevokeAllFn       func() error
 	CookiesFn         func() []*http.Cookie
+	CookieNamesFn     func() (string, string)
 	Calls             struct {
 		RefreshableTill int
 		Refreshable     int
@@ -101,7 +185,37 @@ type TokenService struct {
 		Sign            int
 		Validate        int
 		Revoke          int
+		RevokeAll       int
 		Cookies         int
+		CookieNames     int
+	}
+}
+
+// ActionTokenService mocks auth.ActionTokenService interface.
+type ActionTokenService struct {
+	IssueFn  func() (string, error)
+	ParseFn  func() (*auth.ActionToken, error)
+	RedeemFn func() error
+	Calls    struct {
+		Issue  int
+		Parse  int
+		Redeem int
+	}
+}
+
+// SecurityChangeService mocks auth.SecurityChangeService interface.
+type SecurityChangeService struct {
+	IsEnabledFn func() bool
+	DelayFn     func() error
+	PendingFn   func() (*auth.PendingChange, error)
+	RemoveFn    func() (bool, error)
+	CancelFn    func() (*auth.PendingChange, error)
+	Calls       struct {
+		IsEnabled int
+		Delay     int
+		Pending   int
+		Remove    int
+		Cancel    int
 	}
 }
 
@@ -112,12 +226,46 @@ type RepositoryManager struct {
 	LoginHistoryFn       func() auth.LoginHistoryRepository
 	DeviceFn             func() auth.DeviceRepository
 	UserFn               func() auth.UserRepository
+	CanaryFn             func() auth.CanaryRepository
+	LoginDigestFn        func() auth.LoginDigestRepository
+	OrganizationFn       func() auth.OrganizationRepository
+	MembershipFn         func() auth.MembershipRepository
+	ConsentFn            func() auth.ConsentRepository
+	ExternalAccountFn    func() auth.ExternalAccountRepository
+	ClientApplicationFn  func() auth.ClientApplicationRepository
+	TrustedRecoveryFn    func() auth.TrustedRecoveryRepository
+	MessageDeliveryFn    func() auth.MessageDeliveryRepository
+	TFAEnrollmentFn      func() auth.TFAEnrollmentRepository
 	Calls                struct {
 		NewWithTransaction int
 		WithAtomic         int
 		LoginHistory       int
 		Device             int
 		User               int
+		Canary             int
+		LoginDigest        int
+		Organization       int
+		Membership         int
+		Consent            int
+		ExternalAccount    int
+		ClientApplication  int
+		TrustedRecovery    int
+		MessageDelivery    int
+		TFAEnrollment      int
+	}
+}
+
+// MessageDeliveryRepository mocks auth.MessageDeliveryRepository.
+type MessageDeliveryRepository struct {
+	ByIDFn         func() (*auth.MessageDelivery, error)
+	ByAddressFn    func(address string, limit int) ([]*auth.MessageDelivery, error)
+	CreateFn       func(d *auth.MessageDelivery) error
+	UpdateStatusFn func(id string, status auth.MessageDeliveryStatus, detail string) error
+	Calls          struct {
+		ByID         int
+		ByAddress    int
+		Create       int
+		UpdateStatus int
 	}
 }
 
@@ -125,35 +273,45 @@ type RepositoryManager struct {
 type LoginHistoryRepository struct {
 	ByTokenIDFn    func() (*auth.LoginHistory, error)
 	ByUserIDFn     func() ([]*auth.LoginHistory, error)
+	ListFn         func(filter *auth.LoginHistoryFilter) ([]*auth.LoginHistory, error)
 	CreateFn       func() error
 	GetForUpdateFn func() (*auth.LoginHistory, error)
 	UpdateFn       func() error
-	Calls          struct {
+	CountActiveFn  func() (int64, error)
+
+	CountActiveByUserIDFn func() (int64, error)
+	Calls                 struct {
 		ByUserID     int
+		List         int
 		Create       int
 		GetForUpdate int
 		Update       int
 		ByTokenID    int
+		CountActive  int
+
+		CountActiveByUserID int
 	}
 }
 
 // DeviceRepository mocks auth.DeviceRepository.
 type DeviceRepository struct {
-	ByIDFn         func() (*auth.Device, error)
-	ByClientIDFn   func() (*auth.Device, error)
-	ByUserIDFn     func() ([]*auth.Device, error)
-	CreateFn       func() error
-	GetForUpdateFn func() (*auth.Device, error)
-	UpdateFn       func() error
-	RemoveFn       func() error
-	Calls          struct {
-		ByID         int
-		ByClientID   int
-		ByUserID     int
-		Create       int
-		GetForUpdate int
-		Update       int
-		Remove       int
+	ByIDFn                   func() (*auth.Device, error)
+	ByClientIDFn             func() (*auth.Device, error)
+	ByUserIDFn               func() ([]*auth.Device, error)
+	CreateFn                 func() error
+	GetForUpdateFn           func() (*auth.Device, error)
+	GetForUpdateByClientIDFn func() (*auth.Device, error)
+	UpdateFn                 func() error
+	RemoveFn                 func() error
+	Calls                    struct {
+		ByID                   int
+		ByClientID             int
+		ByUserID               int
+		Create                 int
+		GetForUpdate           int
+		GetForUpdateByClientID int
+		Update                 int
+		Remove                 int
 	}
 }
 
@@ -161,19 +319,169 @@ type DeviceRepository struct {
 type UserRepository struct {
 	ByIdentityFn           func() (*auth.User, error)
 	GetForUpdateFn         func() (*auth.User, error)
+	ListFn                 func() ([]*auth.User, error)
 	DisableOTPFn           func() (*auth.User, error)
 	RemoveDeliveryMethodFn func() (*auth.User, error)
 	CreateFn               func() error
 	ReCreateFn             func() error
 	UpdateFn               func() error
+	CountSignupsFn         func() ([]*auth.DailyCount, error)
+	CountTFAFn             func() (*auth.TFAAdoption, error)
 	Calls                  struct {
 		ByIdentity           int
 		DisableOTP           int
 		RemoveDeliveryMethod int
 		GetForUpdate         int
+		List                 int
 		Create               int
 		ReCreate             int
 		Update               int
+		CountSignups         int
+		CountTFA             int
+	}
+}
+
+// CanaryRepository mocks auth.CanaryRepository.
+type CanaryRepository struct {
+	ByIdentityFn func() (*auth.Canary, error)
+	ListFn       func() ([]*auth.Canary, error)
+	CreateFn     func() error
+	RemoveFn     func() error
+	Calls        struct {
+		ByIdentity int
+		List       int
+		Create     int
+		Remove     int
+	}
+}
+
+// ClientApplicationRepository mocks auth.ClientApplicationRepository.
+type ClientApplicationRepository struct {
+	ByIDFn   func() (*auth.ClientApplication, error)
+	ListFn   func() ([]*auth.ClientApplication, error)
+	CreateFn func() error
+	RemoveFn func() error
+	Calls    struct {
+		ByID   int
+		List   int
+		Create int
+		Remove int
+	}
+}
+
+// ClientApplicationService mocks auth.ClientApplicationService.
+type ClientApplicationService struct {
+	ByIDFn            func() (*auth.ClientApplication, error)
+	IsOriginAllowedFn func(origin string) bool
+	NotifyLogoutFn    func(clientID string, notice *auth.LogoutNotice) error
+	Calls             struct {
+		ByID            int
+		IsOriginAllowed int
+		NotifyLogout    int
+	}
+}
+
+// LoginDigestRepository mocks auth.LoginDigestRepository.
+type LoginDigestRepository struct {
+	ByUserIDFn func() (*auth.LoginDigestSubscription, error)
+	DueFn      func() ([]*auth.LoginDigestSubscription, error)
+	CreateFn   func() error
+	MarkSentFn func() error
+	RemoveFn   func() error
+	Calls      struct {
+		ByUserID int
+		Due      int
+		Create   int
+		MarkSent int
+		Remove   int
+	}
+}
+
+// TFAEnrollmentRepository mocks auth.TFAEnrollmentRepository.
+type TFAEnrollmentRepository struct {
+	ByUserIDFn     func() (*auth.TFAEnrollment, error)
+	CreateFn       func(enrollment *auth.TFAEnrollment) error
+	DueFn          func() ([]*auth.TFAEnrollment, error)
+	MarkRemindedFn func() error
+	Calls          struct {
+		ByUserID     int
+		Create       int
+		Due          int
+		MarkReminded int
+	}
+}
+
+// OrganizationRepository mocks auth.OrganizationRepository.
+type OrganizationRepository struct {
+	ByIDFn   func() (*auth.Organization, error)
+	CreateFn func() error
+	Calls    struct {
+		ByID   int
+		Create int
+	}
+}
+
+// MembershipRepository mocks auth.MembershipRepository.
+type MembershipRepository struct {
+	GetFn              func() (*auth.Membership, error)
+	ByUserIDFn         func() ([]*auth.Membership, error)
+	ByOrganizationIDFn func() ([]*auth.Membership, error)
+	CreateFn           func() error
+	RemoveFn           func() error
+	CreateInvitationFn func() error
+	InvitationByIDFn   func() (*auth.Invitation, error)
+	RemoveInvitationFn func() error
+	Calls              struct {
+		Get              int
+		ByUserID         int
+		ByOrganizationID int
+		Create           int
+		Remove           int
+		CreateInvitation int
+		InvitationByID   int
+		RemoveInvitation int
+	}
+}
+
+// ConsentRepository mocks auth.ConsentRepository.
+type ConsentRepository struct {
+	ByUserIDFn func() ([]*auth.Consent, error)
+	CreateFn   func() error
+	Calls      struct {
+		ByUserID int
+		Create   int
+	}
+}
+
+// ExternalAccountRepository mocks auth.ExternalAccountRepository.
+type ExternalAccountRepository struct {
+	ByExternalIDFn func() (*auth.ExternalAccount, error)
+	CreateFn       func() error
+	Calls          struct {
+		ByExternalID int
+		Create       int
+	}
+}
+
+// TrustedRecoveryRepository mocks auth.TrustedRecoveryRepository.
+type TrustedRecoveryRepository struct {
+	ByUserIDFn func() (*auth.TrustedRecovery, error)
+	CreateFn   func() error
+	VerifyFn   func() error
+	RemoveFn   func() error
+	Calls      struct {
+		ByUserID int
+		Create   int
+		Verify   int
+		Remove   int
+	}
+}
+
+// ExternalUserProvider mocks auth.ExternalUserProvider.
+type ExternalUserProvider struct {
+	AuthenticateFn func() (*auth.ExternalUser, error)
+	Calls          struct {
+		Authenticate int
 	}
 }
 
@@ -193,15 +501,51 @@ type WebAuthnLib struct {
 
 // WebAuthnService mocks auth.WebAuthnService.
 type WebAuthnService struct {
-	BeginSignUpFn  func() ([]byte, error)
-	FinishSignUpFn func() (*auth.Device, error)
-	BeginLoginFn   func() ([]byte, error)
-	FinishLoginFn  func() error
-	Calls          struct {
-		BeginSignUp  int
-		FinishSignUp int
-		BeginLogin   int
-		FinishLogin  int
+	BeginSignUpFn             func() ([]byte, error)
+	FinishSignUpFn            func() (*auth.Device, error)
+	BeginLoginFn              func() ([]byte, error)
+	FinishLoginFn             func() error
+	BeginDiscoverableLoginFn  func() ([]byte, error)
+	FinishDiscoverableLoginFn func() (*auth.User, error)
+	ImportU2FFn               func() (*auth.Device, error)
+	Calls                     struct {
+		BeginSignUp             int
+		FinishSignUp            int
+		BeginLogin              int
+		FinishLogin             int
+		BeginDiscoverableLogin  int
+		FinishDiscoverableLogin int
+		ImportU2F               int
+	}
+}
+
+// MetadataService mocks auth.MetadataService.
+type MetadataService struct {
+	LookupFn func() *auth.AuthenticatorMetadata
+	RunFn    func() error
+	Calls    struct {
+		Lookup int
+		Run    int
+	}
+}
+
+// GeoResolver mocks auth.GeoResolver.
+type GeoResolver struct {
+	LookupFn func(ip string) *auth.GeoLocation
+	RunFn    func() error
+	Calls    struct {
+		Lookup int
+		Run    int
+	}
+}
+
+// NetworkReputation mocks auth.NetworkReputation.
+type NetworkReputation struct {
+	ClassifyFn func(ip string) (auth.NetworkClass, error)
+	RunFn      func() error
+	Calls      struct {
+		Classify int
+		Run      int
 	}
 }
 
@@ -217,11 +561,13 @@ type Logger struct {
 type Rediser struct {
 	GetFn         func() *redisLib.StringCmd
 	SetFn         func() *redisLib.StatusCmd
+	DelFn         func() *redisLib.IntCmd
 	WithContextFn func() *redisLib.Client
 	CloseFn       func() error
 	Calls         struct {
 		Get         int
 		Set         int
+		Del         int
 		WithContext int
 		Close       int
 	}
@@ -236,78 +582,555 @@ func (m *WebAuthnLib) BeginRegistration(user webauthnLib.User, opts ...webauthnL
 	return nil, nil, fmt.Errorf("failed to begin registration")
 }
 
-// FinishRegistration mock.
-func (m *WebAuthnLib) FinishRegistration(user webauthnLib.User, session webauthnLib.SessionData, r *http.Request) (*webauthnLib.Credential, error) {
-	m.Calls.FinishRegistration++
-	if m.FinishRegistrationFn != nil {
-		return m.FinishRegistrationFn()
+// FinishRegistration mock.
+func (m *WebAuthnLib) FinishRegistration(user webauthnLib.User, session webauthnLib.SessionData, r *http.Request) (*webauthnLib.Credential, error) {
+	m.Calls.FinishRegistration++
+	if m.FinishRegistrationFn != nil {
+		return m.FinishRegistrationFn()
+	}
+	return nil, fmt.Errorf("failed to fnish registration")
+}
+
+// BeginLogin mock.
+func (m *WebAuthnLib) BeginLogin(user webauthnLib.User, opts ...webauthnLib.LoginOption) (*webauthnProto.CredentialAssertion, *webauthnLib.SessionData, error) {
+	m.Calls.BeginLogin++
+	if m.BeginLoginFn != nil {
+		return m.BeginLoginFn()
+	}
+	return nil, nil, fmt.Errorf("failed to begin login")
+}
+
+// FinishLogin mock.
+func (m *WebAuthnLib) FinishLogin(user webauthnLib.User, session webauthnLib.SessionData, r *http.Request) (*webauthnLib.Credential, error) {
+	m.Calls.FinishLogin++
+	if m.FinishLoginFn != nil {
+		return m.FinishLoginFn()
+	}
+
+	return nil, fmt.Errorf("failed to finish login")
+}
+
+// NewWithTransaction mock.
+func (m *RepositoryManager) NewWithTransaction(ctx context.Context) (auth.RepositoryManager, error) {
+	m.Calls.NewWithTransaction++
+	if m.NewWithTransactionFn != nil {
+		return m.NewWithTransactionFn()
+	}
+
+	return m, nil
+}
+
+// WithAtomic mock.
+func (m *RepositoryManager) WithAtomic(operation func() (interface{}, error)) (interface{}, error) {
+	m.Calls.WithAtomic++
+	if m.WithAtomicFn != nil {
+		return m.WithAtomicFn()
+	}
+	return nil, fmt.Errorf("failed to start transaction")
+}
+
+// LoginHistory mock.
+func (m *RepositoryManager) LoginHistory() auth.LoginHistoryRepository {
+	m.Calls.LoginHistory++
+	if m.LoginHistoryFn != nil {
+		return m.LoginHistoryFn()
+	}
+	return &LoginHistoryRepository{}
+}
+
+// Device mock.
+func (m *RepositoryManager) Device() auth.DeviceRepository {
+	m.Calls.Device++
+	if m.DeviceFn != nil {
+		return m.DeviceFn()
+	}
+	return &DeviceRepository{}
+}
+
+// User mock.
+func (m *RepositoryManager) User() auth.UserRepository {
+	m.Calls.User++
+	if m.UserFn != nil {
+		return m.UserFn()
+	}
+	return &UserRepository{}
+}
+
+// Canary mock.
+func (m *RepositoryManager) Canary() auth.CanaryRepository {
+	m.Calls.Canary++
+	if m.CanaryFn != nil {
+		return m.CanaryFn()
+	}
+	return &CanaryRepository{}
+}
+
+// LoginDigest mock.
+func (m *RepositoryManager) LoginDigest() auth.LoginDigestRepository {
+	m.Calls.LoginDigest++
+	if m.LoginDigestFn != nil {
+		return m.LoginDigestFn()
+	}
+	return &LoginDigestRepository{}
+}
+
+// Organization mock.
+func (m *RepositoryManager) Organization() auth.OrganizationRepository {
+	m.Calls.Organization++
+	if m.OrganizationFn != nil {
+		return m.OrganizationFn()
+	}
+	return &OrganizationRepository{}
+}
+
+// Membership mock.
+func (m *RepositoryManager) Membership() auth.MembershipRepository {
+	m.Calls.Membership++
+	if m.MembershipFn != nil {
+		return m.MembershipFn()
+	}
+	return &MembershipRepository{}
+}
+
+// Consent mock.
+func (m *RepositoryManager) Consent() auth.ConsentRepository {
+	m.Calls.Consent++
+	if m.ConsentFn != nil {
+		return m.ConsentFn()
+	}
+	return &ConsentRepository{}
+}
+
+// ExternalAccount mock.
+func (m *RepositoryManager) ExternalAccount() auth.ExternalAccountRepository {
+	m.Calls.ExternalAccount++
+	if m.ExternalAccountFn != nil {
+		return m.ExternalAccountFn()
+	}
+	return &ExternalAccountRepository{}
+}
+
+// ClientApplication mock.
+func (m *RepositoryManager) ClientApplication() auth.ClientApplicationRepository {
+	m.Calls.ClientApplication++
+	if m.ClientApplicationFn != nil {
+		return m.ClientApplicationFn()
+	}
+	return &ClientApplicationRepository{}
+}
+
+// TrustedRecovery mock.
+func (m *RepositoryManager) TrustedRecovery() auth.TrustedRecoveryRepository {
+	m.Calls.TrustedRecovery++
+	if m.TrustedRecoveryFn != nil {
+		return m.TrustedRecoveryFn()
+	}
+	return &TrustedRecoveryRepository{}
+}
+
+// MessageDelivery mock.
+func (m *RepositoryManager) MessageDelivery() auth.MessageDeliveryRepository {
+	m.Calls.MessageDelivery++
+	if m.MessageDeliveryFn != nil {
+		return m.MessageDeliveryFn()
+	}
+	return &MessageDeliveryRepository{}
+}
+
+// TFAEnrollment mock.
+func (m *RepositoryManager) TFAEnrollment() auth.TFAEnrollmentRepository {
+	m.Calls.TFAEnrollment++
+	if m.TFAEnrollmentFn != nil {
+		return m.TFAEnrollmentFn()
+	}
+	return &TFAEnrollmentRepository{}
+}
+
+// ByID mock.
+func (m *MessageDeliveryRepository) ByID(ctx context.Context, id string) (*auth.MessageDelivery, error) {
+	m.Calls.ByID++
+	if m.ByIDFn != nil {
+		return m.ByIDFn()
+	}
+	return &auth.MessageDelivery{}, nil
+}
+
+// ByAddress mock.
+func (m *MessageDeliveryRepository) ByAddress(ctx context.Context, address string, limit int) ([]*auth.MessageDelivery, error) {
+	m.Calls.ByAddress++
+	if m.ByAddressFn != nil {
+		return m.ByAddressFn(address, limit)
+	}
+	return []*auth.MessageDelivery{}, nil
+}
+
+// Create mock.
+func (m *MessageDeliveryRepository) Create(ctx context.Context, d *auth.MessageDelivery) error {
+	m.Calls.Create++
+	if m.CreateFn != nil {
+		return m.CreateFn(d)
+	}
+	return nil
+}
+
+// UpdateStatus mock.
+func (m *MessageDeliveryRepository) UpdateStatus(ctx context.Context, id string, status auth.MessageDeliveryStatus, detail string) error {
+	m.Calls.UpdateStatus++
+	if m.UpdateStatusFn != nil {
+		return m.UpdateStatusFn(id, status, detail)
+	}
+	return nil
+}
+
+// ByID mock.
+func (m *OrganizationRepository) ByID(ctx context.Context, orgID string) (*auth.Organization, error) {
+	m.Calls.ByID++
+	if m.ByIDFn != nil {
+		return m.ByIDFn()
+	}
+	return &auth.Organization{}, nil
+}
+
+// Create mock.
+func (m *OrganizationRepository) Create(ctx context.Context, org *auth.Organization) error {
+	m.Calls.Create++
+	if m.CreateFn != nil {
+		return m.CreateFn()
+	}
+	return nil
+}
+
+// Get mock.
+func (m *MembershipRepository) Get(ctx context.Context, orgID, userID string) (*auth.Membership, error) {
+	m.Calls.Get++
+	if m.GetFn != nil {
+		return m.GetFn()
+	}
+	return &auth.Membership{}, nil
+}
+
+// ByUserID mock.
+func (m *MembershipRepository) ByUserID(ctx context.Context, userID string) ([]*auth.Membership, error) {
+	m.Calls.ByUserID++
+	if m.ByUserIDFn != nil {
+		return m.ByUserIDFn()
+	}
+	return []*auth.Membership{}, nil
+}
+
+// ByOrganizationID mock.
+func (m *MembershipRepository) ByOrganizationID(ctx context.Context, orgID string) ([]*auth.Membership, error) {
+	m.Calls.ByOrganizationID++
+	if m.ByOrganizationIDFn != nil {
+		return m.ByOrganizationIDFn()
+	}
+	return []*auth.Membership{}, nil
+}
+
+// Create mock.
+func (m *MembershipRepository) Create(ctx context.Context, membership *auth.Membership) error {
+	m.Calls.Create++
+	if m.CreateFn != nil {
+		return m.CreateFn()
+	}
+	return nil
+}
+
+// Remove mock.
+func (m *MembershipRepository) Remove(ctx context.Context, orgID, userID string) error {
+	m.Calls.Remove++
+	if m.RemoveFn != nil {
+		return m.RemoveFn()
+	}
+	return nil
+}
+
+// CreateInvitation mock.
+func (m *MembershipRepository) CreateInvitation(ctx context.Context, inv *auth.Invitation) error {
+	m.Calls.CreateInvitation++
+	if m.CreateInvitationFn != nil {
+		return m.CreateInvitationFn()
+	}
+	return nil
+}
+
+// InvitationByID mock.
+func (m *MembershipRepository) InvitationByID(ctx context.Context, invitationID string) (*auth.Invitation, error) {
+	m.Calls.InvitationByID++
+	if m.InvitationByIDFn != nil {
+		return m.InvitationByIDFn()
+	}
+	return &auth.Invitation{}, nil
+}
+
+// RemoveInvitation mock.
+func (m *MembershipRepository) RemoveInvitation(ctx context.Context, invitationID string) error {
+	m.Calls.RemoveInvitation++
+	if m.RemoveInvitationFn != nil {
+		return m.RemoveInvitationFn()
+	}
+	return nil
+}
+
+// ByUserID mock.
+func (m *ConsentRepository) ByUserID(ctx context.Context, userID string) ([]*auth.Consent, error) {
+	m.Calls.ByUserID++
+	if m.ByUserIDFn != nil {
+		return m.ByUserIDFn()
+	}
+	return []*auth.Consent{}, nil
+}
+
+// Create mock.
+func (m *ConsentRepository) Create(ctx context.Context, consent *auth.Consent) error {
+	m.Calls.Create++
+	if m.CreateFn != nil {
+		return m.CreateFn()
+	}
+	return nil
+}
+
+// ByExternalID mock.
+func (m *ExternalAccountRepository) ByExternalID(ctx context.Context, externalID string) (*auth.ExternalAccount, error) {
+	m.Calls.ByExternalID++
+	if m.ByExternalIDFn != nil {
+		return m.ByExternalIDFn()
+	}
+	return &auth.ExternalAccount{}, nil
+}
+
+// Create mock.
+func (m *ExternalAccountRepository) Create(ctx context.Context, account *auth.ExternalAccount) error {
+	m.Calls.Create++
+	if m.CreateFn != nil {
+		return m.CreateFn()
+	}
+	return nil
+}
+
+// ByUserID mock.
+func (m *TrustedRecoveryRepository) ByUserID(ctx context.Context, userID string) (*auth.TrustedRecovery, error) {
+	m.Calls.ByUserID++
+	if m.ByUserIDFn != nil {
+		return m.ByUserIDFn()
+	}
+	return &auth.TrustedRecovery{}, nil
+}
+
+// Create mock.
+func (m *TrustedRecoveryRepository) Create(ctx context.Context, recovery *auth.TrustedRecovery) error {
+	m.Calls.Create++
+	if m.CreateFn != nil {
+		return m.CreateFn()
+	}
+	return nil
+}
+
+// Verify mock.
+func (m *TrustedRecoveryRepository) Verify(ctx context.Context, userID, contact string) error {
+	m.Calls.Verify++
+	if m.VerifyFn != nil {
+		return m.VerifyFn()
+	}
+	return nil
+}
+
+// Remove mock.
+func (m *TrustedRecoveryRepository) Remove(ctx context.Context, userID string) error {
+	m.Calls.Remove++
+	if m.RemoveFn != nil {
+		return m.RemoveFn()
+	}
+	return nil
+}
+
+// Authenticate mock.
+func (m *ExternalUserProvider) Authenticate(ctx context.Context, attribute, identity, password string) (*auth.ExternalUser, error) {
+	m.Calls.Authenticate++
+	if m.AuthenticateFn != nil {
+		return m.AuthenticateFn()
+	}
+	return &auth.ExternalUser{}, nil
+}
+
+// ByUserID mock.
+func (m *LoginDigestRepository) ByUserID(ctx context.Context, userID string) (*auth.LoginDigestSubscription, error) {
+	m.Calls.ByUserID++
+	if m.ByUserIDFn != nil {
+		return m.ByUserIDFn()
+	}
+	return &auth.LoginDigestSubscription{}, nil
+}
+
+// Due mock.
+func (m *LoginDigestRepository) Due(ctx context.Context, before time.Time, limit int) ([]*auth.LoginDigestSubscription, error) {
+	m.Calls.Due++
+	if m.DueFn != nil {
+		return m.DueFn()
+	}
+	return []*auth.LoginDigestSubscription{}, nil
+}
+
+// Create mock.
+func (m *LoginDigestRepository) Create(ctx context.Context, sub *auth.LoginDigestSubscription) error {
+	m.Calls.Create++
+	if m.CreateFn != nil {
+		return m.CreateFn()
+	}
+	return nil
+}
+
+// MarkSent mock.
+func (m *LoginDigestRepository) MarkSent(ctx context.Context, userID string, sentAt time.Time) error {
+	m.Calls.MarkSent++
+	if m.MarkSentFn != nil {
+		return m.MarkSentFn()
+	}
+	return nil
+}
+
+// Remove mock.
+func (m *LoginDigestRepository) Remove(ctx context.Context, userID string) error {
+	m.Calls.Remove++
+	if m.RemoveFn != nil {
+		return m.RemoveFn()
+	}
+	return nil
+}
+
+// ByUserID mock.
+func (m *TFAEnrollmentRepository) ByUserID(ctx context.Context, userID string) (*auth.TFAEnrollment, error) {
+	m.Calls.ByUserID++
+	if m.ByUserIDFn != nil {
+		return m.ByUserIDFn()
+	}
+	return &auth.TFAEnrollment{}, nil
+}
+
+// Create mock.
+func (m *TFAEnrollmentRepository) Create(ctx context.Context, enrollment *auth.TFAEnrollment) error {
+	m.Calls.Create++
+	if m.CreateFn != nil {
+		return m.CreateFn(enrollment)
+	}
+	return nil
+}
+
+// Due mock.
+func (m *TFAEnrollmentRepository) Due(ctx context.Context, now, remindedBefore time.Time, limit int) ([]*auth.TFAEnrollment, error) {
+	m.Calls.Due++
+	if m.DueFn != nil {
+		return m.DueFn()
+	}
+	return []*auth.TFAEnrollment{}, nil
+}
+
+// MarkReminded mock.
+func (m *TFAEnrollmentRepository) MarkReminded(ctx context.Context, userID string, remindedAt time.Time) error {
+	m.Calls.MarkReminded++
+	if m.MarkRemindedFn != nil {
+		return m.MarkRemindedFn()
+	}
+	return nil
+}
+
+// ByIdentity mock.
+func (m *CanaryRepository) ByIdentity(ctx context.Context, identity string) (*auth.Canary, error) {
+	m.Calls.ByIdentity++
+	if m.ByIdentityFn != nil {
+		return m.ByIdentityFn()
+	}
+	return &auth.Canary{}, nil
+}
+
+// List mock.
+func (m *CanaryRepository) List(ctx context.Context) ([]*auth.Canary, error) {
+	m.Calls.List++
+	if m.ListFn != nil {
+		return m.ListFn()
+	}
+	return []*auth.Canary{}, nil
+}
+
+// Create mock.
+func (m *CanaryRepository) Create(ctx context.Context, c *auth.Canary) error {
+	m.Calls.Create++
+	if m.CreateFn != nil {
+		return m.CreateFn()
+	}
+	return nil
+}
+
+// Remove mock.
+func (m *CanaryRepository) Remove(ctx context.Context, identity string) error {
+	m.Calls.Remove++
+	if m.RemoveFn != nil {
+		return m.RemoveFn()
 	}
-	return nil, fmt.Errorf("failed to fnish registration")
+	return nil
 }
 
-// BeginLogin mock.
-func (m *WebAuthnLib) BeginLogin(user webauthnLib.User, opts ...webauthnLib.LoginOption) (*webauthnProto.CredentialAssertion, *webauthnLib.SessionData, error) {
-	m.Calls.BeginLogin++
-	if m.BeginLoginFn != nil {
-		return m.BeginLoginFn()
+// ByID mock.
+func (m *ClientApplicationRepository) ByID(ctx context.Context, clientID string) (*auth.ClientApplication, error) {
+	m.Calls.ByID++
+	if m.ByIDFn != nil {
+		return m.ByIDFn()
 	}
-	return nil, nil, fmt.Errorf("failed to begin login")
+	return &auth.ClientApplication{}, nil
 }
 
-// FinishLogin mock.
-func (m *WebAuthnLib) FinishLogin(user webauthnLib.User, session webauthnLib.SessionData, r *http.Request) (*webauthnLib.Credential, error) {
-	m.Calls.FinishLogin++
-	if m.FinishLoginFn != nil {
-		return m.FinishLoginFn()
+// List mock.
+func (m *ClientApplicationRepository) List(ctx context.Context) ([]*auth.ClientApplication, error) {
+	m.Calls.List++
+	if m.ListFn != nil {
+		return m.ListFn()
 	}
-
-	return nil, fmt.Errorf("failed to finish login")
+	return []*auth.ClientApplication{}, nil
 }
 
-// NewWithTransaction mock.
-func (m *RepositoryManager) NewWithTransaction(ctx context.Context) (auth.RepositoryManager, error) {
-	m.Calls.NewWithTransaction++
-	if m.NewWithTransactionFn != nil {
-		return m.NewWithTransactionFn()
+// Create mock.
+func (m *ClientApplicationRepository) Create(ctx context.Context, c *auth.ClientApplication) error {
+	m.Calls.Create++
+	if m.CreateFn != nil {
+		return m.CreateFn()
 	}
-
-	return m, nil
+	return nil
 }
 
-// WithAtomic mock.
-func (m *RepositoryManager) WithAtomic(operation func() (interface{}, error)) (interface{}, error) {
-	m.Calls.WithAtomic++
-	if m.WithAtomicFn != nil {
-		return m.WithAtomicFn()
+// Remove mock.
+func (m *ClientApplicationRepository) Remove(ctx context.Context, clientID string) error {
+	m.Calls.Remove++
+	if m.RemoveFn != nil {
+		return m.RemoveFn()
 	}
-	return nil, fmt.Errorf("failed to start transaction")
+	return nil
 }
 
-// LoginHistory mock.
-func (m *RepositoryManager) LoginHistory() auth.LoginHistoryRepository {
-	m.Calls.LoginHistory++
-	if m.LoginHistoryFn != nil {
-		return m.LoginHistoryFn()
+// ByID mock.
+func (m *ClientApplicationService) ByID(ctx context.Context, clientID string) (*auth.ClientApplication, error) {
+	m.Calls.ByID++
+	if m.ByIDFn != nil {
+		return m.ByIDFn()
 	}
-	return &LoginHistoryRepository{}
+	return nil, auth.ErrBadRequest("client application is invalid")
 }
 
-// Device mock.
-func (m *RepositoryManager) Device() auth.DeviceRepository {
-	m.Calls.Device++
-	if m.DeviceFn != nil {
-		return m.DeviceFn()
+// IsOriginAllowed mock.
+func (m *ClientApplicationService) IsOriginAllowed(ctx context.Context, origin string) bool {
+	m.Calls.IsOriginAllowed++
+	if m.IsOriginAllowedFn != nil {
+		return m.IsOriginAllowedFn(origin)
 	}
-	return &DeviceRepository{}
+	return false
 }
 
-// User mock.
-func (m *RepositoryManager) User() auth.UserRepository {
-	m.Calls.User++
-	if m.UserFn != nil {
-		return m.UserFn()
+// NotifyLogout mock.
+func (m *ClientApplicationService) NotifyLogout(ctx context.Context, clientID string, notice *auth.LogoutNotice) error {
+	m.Calls.NotifyLogout++
+	if m.NotifyLogoutFn != nil {
+		return m.NotifyLogoutFn(clientID, notice)
 	}
-	return &UserRepository{}
+	return nil
 }
 
 // RemoveDeliveryMethod mock.
@@ -337,6 +1160,15 @@ func (m *UserRepository) ByIdentity(ctx context.Context, attribute, value string
 	return &auth.User{}, nil
 }
 
+// List mock.
+func (m *UserRepository) List(ctx context.Context, afterID string, limit int) ([]*auth.User, error) {
+	m.Calls.List++
+	if m.ListFn != nil {
+		return m.ListFn()
+	}
+	return []*auth.User{}, nil
+}
+
 // GetForUpdate mock.
 func (m *UserRepository) GetForUpdate(ctx context.Context, userID string) (*auth.User, error) {
 	m.Calls.GetForUpdate++
@@ -355,6 +1187,24 @@ func (m *UserRepository) Create(ctx context.Context, u *auth.User) error {
 	return nil
 }
 
+// CountSignups mock.
+func (m *UserRepository) CountSignups(ctx context.Context, since time.Time) ([]*auth.DailyCount, error) {
+	m.Calls.CountSignups++
+	if m.CountSignupsFn != nil {
+		return m.CountSignupsFn()
+	}
+	return []*auth.DailyCount{}, nil
+}
+
+// CountTFA mock.
+func (m *UserRepository) CountTFA(ctx context.Context) (*auth.TFAAdoption, error) {
+	m.Calls.CountTFA++
+	if m.CountTFAFn != nil {
+		return m.CountTFAFn()
+	}
+	return &auth.TFAAdoption{}, nil
+}
+
 // ReCreate mock.
 func (m *UserRepository) ReCreate(ctx context.Context, u *auth.User) error {
 	m.Calls.ReCreate++
@@ -429,6 +1279,15 @@ func (m *DeviceRepository) GetForUpdate(ctx context.Context, deviceID string) (*
 	return &auth.Device{}, nil
 }
 
+// GetForUpdateByClientID mock.
+func (m *DeviceRepository) GetForUpdateByClientID(ctx context.Context, userID string, clientID []byte) (*auth.Device, error) {
+	m.Calls.GetForUpdateByClientID++
+	if m.GetForUpdateByClientIDFn != nil {
+		return m.GetForUpdateByClientIDFn()
+	}
+	return &auth.Device{}, nil
+}
+
 // Update mock.
 func (m *DeviceRepository) Update(ctx context.Context, device *auth.Device) error {
 	m.Calls.Update++
@@ -449,6 +1308,15 @@ func (m *LoginHistoryRepository) ByUserID(ctx context.Context, userID string, li
 	return logins, nil
 }
 
+// List mock.
+func (m *LoginHistoryRepository) List(ctx context.Context, userID string, filter *auth.LoginHistoryFilter) ([]*auth.LoginHistory, error) {
+	m.Calls.List++
+	if m.ListFn != nil {
+		return m.ListFn(filter)
+	}
+	return []*auth.LoginHistory{}, nil
+}
+
 // ByTokenID mock.
 func (m *LoginHistoryRepository) ByTokenID(ctx context.Context, tokenID string) (*auth.LoginHistory, error) {
 	m.Calls.ByTokenID++
@@ -467,6 +1335,24 @@ func (m *LoginHistoryRepository) Create(ctx context.Context, login *auth.LoginHi
 	return nil
 }
 
+// CountActive mock.
+func (m *LoginHistoryRepository) CountActive(ctx context.Context) (int64, error) {
+	m.Calls.CountActive++
+	if m.CountActiveFn != nil {
+		return m.CountActiveFn()
+	}
+	return 0, nil
+}
+
+// CountActiveByUserID mock.
+func (m *LoginHistoryRepository) CountActiveByUserID(ctx context.Context, userID string) (int64, error) {
+	m.Calls.CountActiveByUserID++
+	if m.CountActiveByUserIDFn != nil {
+		return m.CountActiveByUserIDFn()
+	}
+	return 0, nil
+}
+
 // GetForUpdate mock.
 func (m *LoginHistoryRepository) GetForUpdate(ctx context.Context, tokenID string) (*auth.LoginHistory, error) {
 	m.Calls.GetForUpdate++
@@ -495,7 +1381,7 @@ func (m *TokenService) RefreshableTill(ctx context.Context, token *auth.Token, r
 }
 
 // Refreshable mock.
-func (m *TokenService) Refreshable(ctx context.Context, token *auth.Token, refreshToken string) error {
+func (m *TokenService) Refreshable(ctx context.Context, token *auth.Token, refreshToken string, options ...auth.ValidateOption) error {
 	m.Calls.Refreshable++
 	if m.RefreshableFn != nil {
 		return m.RefreshableFn()
@@ -512,6 +1398,15 @@ func (m *TokenService) Cookies(ctx context.Context, token *auth.Token) []*http.C
 	return []*http.Cookie{{}}
 }
 
+// CookieNames mock.
+func (m *TokenService) CookieNames() (string, string) {
+	m.Calls.CookieNames++
+	if m.CookieNamesFn != nil {
+		return m.CookieNamesFn()
+	}
+	return "CLIENTID", "REFRESHTOKEN"
+}
+
 // Create mock.
 func (m *TokenService) Create(ctx context.Context, u *auth.User, state auth.TokenState, options ...auth.TokenOption) (*auth.Token, error) {
 	m.Calls.Create++
@@ -531,7 +1426,7 @@ func (m *TokenService) Sign(ctx context.Context, token *auth.Token) (string, err
 }
 
 // Validate mock.
-func (m *TokenService) Validate(ctx context.Context, signedToken string, clientID string) (*auth.Token, error) {
+func (m *TokenService) Validate(ctx context.Context, signedToken string, clientID string, options ...auth.ValidateOption) (*auth.Token, error) {
 	m.Calls.Validate++
 	if m.ValidateFn != nil {
 		return m.ValidateFn()
@@ -548,6 +1443,231 @@ func (m *TokenService) Revoke(ctx context.Context, tokenID string) error {
 	return fmt.Errorf("token revocation failed")
 }
 
+// RevokeAll mock.
+func (m *TokenService) RevokeAll(ctx context.Context, userID string) error {
+	m.Calls.RevokeAll++
+	if m.RevokeAllFn != nil {
+		return m.RevokeAllFn()
+	}
+	return fmt.Errorf("token revocation failed")
+}
+
+// IsEnabled mock.
+func (m *SecurityChangeService) IsEnabled() bool {
+	m.Calls.IsEnabled++
+	if m.IsEnabledFn != nil {
+		return m.IsEnabledFn()
+	}
+	return true
+}
+
+// Delay mock.
+func (m *SecurityChangeService) Delay(ctx context.Context, user *auth.User, change *auth.PendingChange) error {
+	m.Calls.Delay++
+	if m.DelayFn != nil {
+		return m.DelayFn()
+	}
+	return nil
+}
+
+// Pending mock.
+func (m *SecurityChangeService) Pending(ctx context.Context, userID string) (*auth.PendingChange, error) {
+	m.Calls.Pending++
+	if m.PendingFn != nil {
+		return m.PendingFn()
+	}
+	return nil, nil
+}
+
+// Remove mock.
+func (m *SecurityChangeService) Remove(ctx context.Context, userID string) (bool, error) {
+	m.Calls.Remove++
+	if m.RemoveFn != nil {
+		return m.RemoveFn()
+	}
+	return true, nil
+}
+
+// Cancel mock.
+func (m *SecurityChangeService) Cancel(ctx context.Context, signedToken string) (*auth.PendingChange, error) {
+	m.Calls.Cancel++
+	if m.CancelFn != nil {
+		return m.CancelFn()
+	}
+	return nil, auth.ErrBadRequest("no security change is pending")
+}
+
+// Issue mock.
+func (m *ActionTokenService) Issue(ctx context.Context, userID string, purpose auth.ActionPurpose, data map[string]string) (string, error) {
+	m.Calls.Issue++
+	if m.IssueFn != nil {
+		return m.IssueFn()
+	}
+	return "", fmt.Errorf("failed to issue token")
+}
+
+// Parse mock.
+func (m *ActionTokenService) Parse(ctx context.Context, signedToken string, purpose auth.ActionPurpose) (*auth.ActionToken, error) {
+	m.Calls.Parse++
+	if m.ParseFn != nil {
+		return m.ParseFn()
+	}
+	return nil, fmt.Errorf("token is not valid")
+}
+
+// Redeem mock.
+func (m *ActionTokenService) Redeem(ctx context.Context, token *auth.ActionToken) error {
+	m.Calls.Redeem++
+	if m.RedeemFn != nil {
+		return m.RedeemFn()
+	}
+	return fmt.Errorf("token redemption failed")
+}
+
+// Challenge mock.
+func (m *AttestationService) Challenge(ctx context.Context) (string, error) {
+	m.Calls.Challenge++
+	if m.ChallengeFn != nil {
+		return m.ChallengeFn()
+	}
+	return "challenge", nil
+}
+
+// Verify mock.
+func (m *AttestationService) Verify(ctx context.Context, r *http.Request) error {
+	m.Calls.Verify++
+	if m.VerifyFn != nil {
+		return m.VerifyFn()
+	}
+	return nil
+}
+
+// RecordFailure mock.
+func (m *AnomalyDetector) RecordFailure(ctx context.Context, ip, identity string) error {
+	m.Calls.RecordFailure++
+	if m.RecordFailureFn != nil {
+		return m.RecordFailureFn()
+	}
+	return nil
+}
+
+// Check mock.
+func (m *AnomalyDetector) Check(ctx context.Context, r *http.Request) error {
+	m.Calls.Check++
+	if m.CheckFn != nil {
+		return m.CheckFn()
+	}
+	return nil
+}
+
+// Challenge mock.
+func (m *AnomalyDetector) Challenge(ctx context.Context, r *http.Request) (bool, error) {
+	m.Calls.Challenge++
+	if m.ChallengeFn != nil {
+		return m.ChallengeFn()
+	}
+	return false, nil
+}
+
+// Run mock.
+func (m *AnomalyDetector) Run(ctx context.Context) error {
+	m.Calls.Run++
+	if m.RunFn != nil {
+		return m.RunFn()
+	}
+	return nil
+}
+
+// Record mock.
+func (m *DeliveryStatsService) Record(ctx context.Context, delivery auth.DeliveryMethod, outcome auth.DeliveryOutcome) error {
+	m.Calls.Record++
+	if m.RecordFn != nil {
+		return m.RecordFn(delivery, outcome)
+	}
+	return nil
+}
+
+// Daily mock.
+func (m *DeliveryStatsService) Daily(ctx context.Context, days int) ([]*auth.DeliveryStats, error) {
+	m.Calls.Daily++
+	if m.DailyFn != nil {
+		return m.DailyFn()
+	}
+	return []*auth.DeliveryStats{}, nil
+}
+
+// Check mock.
+func (m *SignupAbuseDetector) Check(ctx context.Context, r *http.Request, email string) error {
+	m.Calls.Check++
+	if m.CheckFn != nil {
+		return m.CheckFn()
+	}
+	return nil
+}
+
+// Challenge mock.
+func (m *SignupAbuseDetector) Challenge(ctx context.Context, r *http.Request, email string) (bool, error) {
+	m.Calls.Challenge++
+	if m.ChallengeFn != nil {
+		return m.ChallengeFn()
+	}
+	return false, nil
+}
+
+// Stats mock.
+func (m *SignupAbuseDetector) Stats(ctx context.Context) (map[string]int64, error) {
+	m.Calls.Stats++
+	if m.StatsFn != nil {
+		return m.StatsFn()
+	}
+	return map[string]int64{}, nil
+}
+
+// Trip mock.
+func (m *CanaryService) Trip(ctx context.Context, r *http.Request, identity string) (bool, error) {
+	m.Calls.Trip++
+	if m.TripFn != nil {
+		return m.TripFn()
+	}
+	return false, nil
+}
+
+// Enabled mock.
+func (m *FeatureFlagService) Enabled(ctx context.Context, f auth.Feature) bool {
+	m.Calls.Enabled++
+	if m.EnabledFn != nil {
+		return m.EnabledFn(f)
+	}
+	return true
+}
+
+// Set mock.
+func (m *FeatureFlagService) Set(ctx context.Context, f auth.Feature, enabled bool) error {
+	m.Calls.Set++
+	if m.SetFn != nil {
+		return m.SetFn()
+	}
+	return nil
+}
+
+// Reset mock.
+func (m *FeatureFlagService) Reset(ctx context.Context, f auth.Feature) error {
+	m.Calls.Reset++
+	if m.ResetFn != nil {
+		return m.ResetFn()
+	}
+	return nil
+}
+
+// List mock.
+func (m *FeatureFlagService) List(ctx context.Context) (map[auth.Feature]bool, error) {
+	m.Calls.List++
+	if m.ListFn != nil {
+		return m.ListFn()
+	}
+	return map[auth.Feature]bool{}, nil
+}
+
 // BeginSignUp mock.
 func (m *WebAuthnService) BeginSignUp(ctx context.Context, user *auth.User) ([]byte, error) {
 	m.Calls.BeginSignUp++
@@ -588,6 +1708,96 @@ func (m *WebAuthnService) FinishLogin(ctx context.Context, user *auth.User, r *h
 	return fmt.Errorf("failed to finsih login")
 }
 
+// BeginDiscoverableLogin mock.
+func (m *WebAuthnService) BeginDiscoverableLogin(ctx context.Context) ([]byte, error) {
+	m.Calls.BeginDiscoverableLogin++
+	if m.BeginDiscoverableLoginFn != nil {
+		return m.BeginDiscoverableLoginFn()
+	}
+
+	return nil, fmt.Errorf("failed to begin discoverable login")
+}
+
+// FinishDiscoverableLogin mock.
+func (m *WebAuthnService) FinishDiscoverableLogin(ctx context.Context, r *http.Request) (*auth.User, error) {
+	m.Calls.FinishDiscoverableLogin++
+	if m.FinishDiscoverableLoginFn != nil {
+		return m.FinishDiscoverableLoginFn()
+	}
+
+	return nil, fmt.Errorf("failed to finish discoverable login")
+}
+
+// ImportU2F mock.
+func (m *WebAuthnService) ImportU2F(ctx context.Context, user *auth.User, reg *auth.U2FRegistration) (*auth.Device, error) {
+	m.Calls.ImportU2F++
+	if m.ImportU2FFn != nil {
+		return m.ImportU2FFn()
+	}
+
+	return nil, fmt.Errorf("failed to import U2F registration")
+}
+
+// Lookup mock.
+func (m *MetadataService) Lookup(aaguid []byte) *auth.AuthenticatorMetadata {
+	m.Calls.Lookup++
+	if m.LookupFn != nil {
+		return m.LookupFn()
+	}
+
+	return nil
+}
+
+// Run mock.
+func (m *MetadataService) Run(ctx context.Context) error {
+	m.Calls.Run++
+	if m.RunFn != nil {
+		return m.RunFn()
+	}
+
+	return nil
+}
+
+// Lookup mock.
+func (m *GeoResolver) Lookup(ip string) *auth.GeoLocation {
+	m.Calls.Lookup++
+	if m.LookupFn != nil {
+		return m.LookupFn(ip)
+	}
+
+	return nil
+}
+
+// Run mock.
+func (m *GeoResolver) Run(ctx context.Context) error {
+	m.Calls.Run++
+	if m.RunFn != nil {
+		return m.RunFn()
+	}
+
+	return nil
+}
+
+// Classify mock.
+func (m *NetworkReputation) Classify(ctx context.Context, ip string) (auth.NetworkClass, error) {
+	m.Calls.Classify++
+	if m.ClassifyFn != nil {
+		return m.ClassifyFn(ip)
+	}
+
+	return "", nil
+}
+
+// Run mock.
+func (m *NetworkReputation) Run(ctx context.Context) error {
+	m.Calls.Run++
+	if m.RunFn != nil {
+		return m.RunFn()
+	}
+
+	return nil
+}
+
 // Log mock.
 func (m *Logger) Log(keyvals ...interface{}) error {
 	m.Calls.Log++
@@ -616,6 +1826,15 @@ func (m *Rediser) Set(ctx context.Context, key string, v interface{}, t time.Dur
 	return nil
 }
 
+// Del mock.
+func (m *Rediser) Del(ctx context.Context, keys ...string) *redisLib.IntCmd {
+	m.Calls.Del++
+	if m.DelFn != nil {
+		return m.DelFn()
+	}
+	return nil
+}
+
 // Close mock.
 func (m *Rediser) Close() error {
 	m.Calls.Close++
@@ -695,3 +1914,39 @@ func (s *OTPService) ValidateTOTP(ctx context.Context, u *auth.User, code string
 	}
 	return nil
 }
+
+// BeforeSignup mock.
+func (m *Hooks) BeforeSignup(ctx context.Context, user *auth.User) error {
+	m.Calls.BeforeSignup++
+	if m.BeforeSignupFn != nil {
+		return m.BeforeSignupFn()
+	}
+	return nil
+}
+
+// AfterSignup mock.
+func (m *Hooks) AfterSignup(ctx context.Context, user *auth.User) error {
+	m.Calls.AfterSignup++
+	if m.AfterSignupFn != nil {
+		return m.AfterSignupFn()
+	}
+	return nil
+}
+
+// AfterLogin mock.
+func (m *Hooks) AfterLogin(ctx context.Context, user *auth.User, token *auth.Token) error {
+	m.Calls.AfterLogin++
+	if m.AfterLoginFn != nil {
+		return m.AfterLoginFn()
+	}
+	return nil
+}
+
+// BeforeTokenIssue mock.
+func (m *Hooks) BeforeTokenIssue(ctx context.Context, user *auth.User, token *auth.Token) error {
+	m.Calls.BeforeTokenIssue++
+	if m.BeforeTokenIssueFn != nil {
+		return m.BeforeTokenIssueFn(token)
+	}
+	return nil
+}
@@ -4,12 +4,17 @@ import (
 	"database/sql"
 	"fmt"
 	"math/rand"
+	"net"
 	"os"
 	"time"
 
 	auth "github.com/fmitra/authenticator"
 )
 
+// sysDBName is the maintenance database used to create and
+// drop test databases.
+const sysDBName = "postgres"
+
 // PGClient provies a test database.
 type PGClient struct {
 	DB     *sql.DB
@@ -20,18 +25,16 @@ type PGClient struct {
 // names are randomly generated to avoid race conditions with
 // tear down and set up methods with tests.
 func NewPGDB() (*PGClient, error) {
-	host := os.Getenv("POSTGRES_HOST")
-	if host == "" {
-		host = "localhost"
-	}
-
 	testDBName := randomDB()
 
-	sysDBName := "postgres"
-	connectionString := "user=auth password=swordfish host=%s port=5432 dbname=%s connect_timeout=3 sslmode=disable"
-
-	testConnDetails := fmt.Sprintf(connectionString, host, testDBName)
-	sysConnDetails := fmt.Sprintf(connectionString, host, sysDBName)
+	testConnDetails, err := pgConnString(testDBName)
+	if err != nil {
+		return nil, err
+	}
+	sysConnDetails, err := pgConnString(sysDBName)
+	if err != nil {
+		return nil, err
+	}
 
 	sysDB, err := sql.Open("postgres", sysConnDetails)
 	if err != nil {
@@ -39,6 +42,12 @@ func NewPGDB() (*PGClient, error) {
 	}
 	defer sysDB.Close()
 
+	if containersEnabled() {
+		if err = waitReady(sysDB.Ping); err != nil {
+			return nil, fmt.Errorf("system db connect failed: %w", err)
+		}
+	}
+
 	_, err = sysDB.Exec("DROP DATABASE IF EXISTS " + testDBName)
 	if err != nil {
 		return nil, fmt.Errorf("test DB drop failed: %w", err)
@@ -86,16 +95,11 @@ func randomDB() string {
 func (c *PGClient) DropDB() error {
 	c.DB.Close()
 
-	host := os.Getenv("POSTGRES_HOST")
-	if host == "" {
-		host = "localhost"
+	sysConnDetails, err := pgConnString(sysDBName)
+	if err != nil {
+		return err
 	}
 
-	sysDBName := "postgres"
-	connectionString := "user=auth password=swordfish host=%s port=5432 dbname=%s connect_timeout=3 sslmode=disable"
-
-	sysConnDetails := fmt.Sprintf(connectionString, host, sysDBName)
-
 	sysDB, err := sql.Open("postgres", sysConnDetails)
 	if err != nil {
 		return err
@@ -105,3 +109,27 @@ func (c *PGClient) DropDB() error {
 	_, err = sysDB.Exec("DROP DATABASE IF EXISTS " + c.dbName)
 	return err
 }
+
+// pgConnString returns the connection string for a database on the test
+// Postgres server. The server is expected on POSTGRES_HOST:5432 unless
+// ephemeral containers are enabled.
+func pgConnString(dbName string) (string, error) {
+	host := os.Getenv("POSTGRES_HOST")
+	if host == "" {
+		host = "localhost"
+	}
+	port := "5432"
+
+	if containersEnabled() {
+		addr, err := pgContainer.Addr()
+		if err != nil {
+			return "", fmt.Errorf("cannot start postgres container: %w", err)
+		}
+		if host, port, err = net.SplitHostPort(addr); err != nil {
+			return "", fmt.Errorf("invalid postgres container address: %w", err)
+		}
+	}
+
+	connectionString := "user=auth password=swordfish host=%s port=%s dbname=%s connect_timeout=3 sslmode=disable"
+	return fmt.Sprintf(connectionString, host, port, dbName), nil
+}
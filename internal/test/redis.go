@@ -15,7 +15,15 @@ import (
 func NewRedisDB() (*redis.Client, error) {
 	rand.Seed(time.Now().UnixNano())
 	dbNo := rand.Intn(16)
-	redisURL := fmt.Sprintf("redis://:swordfish@localhost:6379/%v", dbNo)
+
+	addr := "localhost:6379"
+	if containersEnabled() {
+		var err error
+		if addr, err = redisContainer.Addr(); err != nil {
+			return nil, fmt.Errorf("cannot start redis container: %w", err)
+		}
+	}
+	redisURL := fmt.Sprintf("redis://:swordfish@%s/%v", addr, dbNo)
 
 	redisConfig, err := redis.ParseURL(redisURL)
 	if err != nil {
@@ -24,7 +32,14 @@ func NewRedisDB() (*redis.Client, error) {
 
 	ctx := context.Background()
 	db := redis.NewClient(redisConfig)
-	_, err = db.Ping(ctx).Result()
+	ping := func() error {
+		return db.Ping(ctx).Err()
+	}
+	if containersEnabled() {
+		err = waitReady(ping)
+	} else {
+		err = ping()
+	}
 	if err != nil {
 		db.Close()
 
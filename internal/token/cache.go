@@ -0,0 +1,178 @@
+package token
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	redislib "github.com/go-redis/redis/v8"
+)
+
+// RevocationChannel is the Redis channel revoked keys are published
+// to so every instance evicts them from its RevocationCache.
+const RevocationChannel = "token_revocations"
+
+const (
+	defaultRevocationCacheSize = 100000
+	defaultRevocationCacheTTL  = time.Second * 30
+)
+
+// pubsuber is an interface to go-redis publish/subscribe.
+type pubsuber interface {
+	Publish(ctx context.Context, channel string, message interface{}) *redislib.IntCmd
+	Subscribe(ctx context.Context, channels ...string) *redislib.PubSub
+}
+
+// RevocationCache is an in-process LRU cache of token revocation state,
+// sparing Redis a round trip for each token validated. Revocations are
+// published to RevocationChannel and evicted from the cache of every
+// instance subscribed through Run. Entries also expire after a TTL,
+// bounding how long a revocation may go unnoticed if a message is lost.
+type RevocationCache struct {
+	db   pubsuber
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// evictions counts evictions so lookups started before an eviction
+	// do not cache the state they read.
+	evictions uint64
+}
+
+// cacheEntry is the cached result of a Redis GET.
+type cacheEntry struct {
+	key       string
+	value     string
+	found     bool
+	expiresAt time.Time
+}
+
+// NewRevocationCache returns a RevocationCache of up to size entries,
+// each cached for at most ttl.
+func NewRevocationCache(db pubsuber, size int, ttl time.Duration) *RevocationCache {
+	if size <= 0 {
+		size = defaultRevocationCacheSize
+	}
+	if ttl <= 0 {
+		ttl = defaultRevocationCacheTTL
+	}
+
+	return &RevocationCache{
+		db:      db,
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Run evicts keys as they are published to RevocationChannel until the
+// context is done. The cache is cleared whenever the subscription is
+// established, as revocations published while disconnected are lost.
+func (c *RevocationCache) Run(ctx context.Context) error {
+	pubsub := c.db.Subscribe(ctx, RevocationChannel)
+	defer pubsub.Close()
+
+	msgc := pubsub.ChannelWithSubscriptions(ctx, 100)
+	for {
+		select {
+		case msg, ok := <-msgc:
+			if !ok {
+				return nil
+			}
+			switch m := msg.(type) {
+			case *redislib.Subscription:
+				c.clear()
+			case *redislib.Message:
+				c.evict(m.Payload)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// get returns the value of a key as Redis GET does, reading it from the
+// cache if present. Missing keys are cached as well, returning
+// redislib.Nil.
+func (c *RevocationCache) get(ctx context.Context, db rediser, key string) (string, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if c.now().Before(entry.expiresAt) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			if !entry.found {
+				return "", redislib.Nil
+			}
+			return entry.value, nil
+		}
+		c.remove(el)
+	}
+	evictions := c.evictions
+	c.mu.Unlock()
+
+	value, err := db.Get(ctx, key).Result()
+	if err != nil && err != redislib.Nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if evictions != c.evictions {
+		return value, err
+	}
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{
+		key:       key,
+		value:     value,
+		found:     err == nil,
+		expiresAt: c.now().Add(c.ttl),
+	})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+
+	return value, err
+}
+
+// publish evicts a key from every instance's cache after it is written.
+func (c *RevocationCache) publish(ctx context.Context, key string) error {
+	c.evict(key)
+	return c.db.Publish(ctx, RevocationChannel, key).Err()
+}
+
+// evict removes a key from the cache.
+func (c *RevocationCache) evict(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evictions++
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// clear removes every key from the cache.
+func (c *RevocationCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evictions++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+func (c *RevocationCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
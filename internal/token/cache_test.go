@@ -0,0 +1,142 @@
+package token
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	redislib "github.com/go-redis/redis/v8"
+)
+
+// countingDB is a rediser counting GETs of keys stored in memory.
+type countingDB struct {
+	rediser
+	values    map[string]string
+	gets      int
+	published []string
+}
+
+func (db *countingDB) Get(ctx context.Context, key string) *redislib.StringCmd {
+	db.gets++
+	value, ok := db.values[key]
+	if !ok {
+		return redislib.NewStringResult("", redislib.Nil)
+	}
+	return redislib.NewStringResult(value, nil)
+}
+
+func (db *countingDB) Publish(ctx context.Context, channel string, message interface{}) *redislib.IntCmd {
+	if channel == RevocationChannel {
+		db.published = append(db.published, message.(string))
+	}
+	return redislib.NewIntResult(1, nil)
+}
+
+func (db *countingDB) Subscribe(ctx context.Context, channels ...string) *redislib.PubSub {
+	return nil
+}
+
+func TestRevocationCache_CachesLookups(t *testing.T) {
+	ctx := context.Background()
+	db := &countingDB{values: map[string]string{GenerationKey("user-id"): "2"}}
+	c := NewRevocationCache(db, 10, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.get(ctx, db, RevocationKey("token-id")); err != redislib.Nil {
+			t.Fatalf("incorrect error, want redis.Nil got %v", err)
+		}
+		value, err := c.get(ctx, db, GenerationKey("user-id"))
+		if err != nil {
+			t.Fatal("expected nil error:", err)
+		}
+		if value != "2" {
+			t.Fatalf("incorrect generation, want 2 got %s", value)
+		}
+	}
+
+	if db.gets != 2 {
+		t.Errorf("incorrect GET count, want 2 got %v", db.gets)
+	}
+}
+
+func TestRevocationCache_EvictsPublishedKeys(t *testing.T) {
+	ctx := context.Background()
+	db := &countingDB{values: map[string]string{}}
+	c := NewRevocationCache(db, 10, time.Minute)
+
+	key := RevocationKey("token-id")
+	if _, err := c.get(ctx, db, key); err != redislib.Nil {
+		t.Fatalf("incorrect error, want redis.Nil got %v", err)
+	}
+
+	db.values[key] = "1"
+	if err := c.publish(ctx, key); err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	if len(db.published) != 1 || db.published[0] != key {
+		t.Errorf("incorrect published keys: %v", db.published)
+	}
+
+	if _, err := c.get(ctx, db, key); err != nil {
+		t.Error("expected revoked key to be read from Redis:", err)
+	}
+
+	// Keys published by another instance are received through Run.
+	db.values[GenerationKey("user-id")] = "1"
+	if _, err := c.get(ctx, db, GenerationKey("user-id")); err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	db.values[GenerationKey("user-id")] = "2"
+	c.evict(GenerationKey("user-id"))
+
+	value, err := c.get(ctx, db, GenerationKey("user-id"))
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	if value != "2" {
+		t.Errorf("incorrect generation, want 2 got %s", value)
+	}
+}
+
+func TestRevocationCache_ExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	db := &countingDB{values: map[string]string{}}
+	c := NewRevocationCache(db, 10, time.Minute)
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	key := RevocationKey("token-id")
+	_, _ = c.get(ctx, db, key)
+
+	db.values[key] = "1"
+	now = now.Add(time.Minute)
+
+	if _, err := c.get(ctx, db, key); err != nil {
+		t.Error("expected expired entry to be read from Redis:", err)
+	}
+	if db.gets != 2 {
+		t.Errorf("incorrect GET count, want 2 got %v", db.gets)
+	}
+}
+
+func TestRevocationCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	db := &countingDB{values: map[string]string{}}
+	c := NewRevocationCache(db, 2, time.Minute)
+
+	_, _ = c.get(ctx, db, "a")
+	_, _ = c.get(ctx, db, "b")
+	_, _ = c.get(ctx, db, "a")
+	_, _ = c.get(ctx, db, "c")
+
+	if _, ok := c.entries["b"]; ok {
+		t.Error("expected least recently used key to be evicted")
+	}
+	if _, ok := c.entries["a"]; !ok {
+		t.Error("expected recently used key to be cached")
+	}
+	if c.lru.Len() != 2 {
+		t.Errorf("incorrect cache size, want 2 got %v", c.lru.Len())
+	}
+}
@@ -0,0 +1,34 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClaimsMode is how a token's claims identifying a User are exposed
+// to the clients holding it.
+type ClaimsMode string
+
+const (
+	// ClaimsFull issues signed tokens with every claim, including
+	// the User's email address and phone number.
+	ClaimsFull ClaimsMode = "full"
+	// ClaimsMinimal omits the User's email address and phone number
+	// from tokens. Clients retrieve them from the Profile API.
+	ClaimsMinimal ClaimsMode = "minimal"
+	// ClaimsEncrypted encrypts signed tokens as JWE so their claims
+	// may only be read by services holding the token secret.
+	ClaimsEncrypted ClaimsMode = "encrypted"
+)
+
+// ParseClaimsMode parses a ClaimsMode. An empty string is ClaimsFull.
+func ParseClaimsMode(s string) (ClaimsMode, error) {
+	switch m := ClaimsMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return ClaimsFull, nil
+	case ClaimsFull, ClaimsMinimal, ClaimsEncrypted:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unsupported claims mode %q", s)
+	}
+}
@@ -1,18 +1,26 @@
 package token
 
 import (
+	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clock"
+	"github.com/fmitra/authenticator/internal/consent"
 	"github.com/fmitra/authenticator/internal/entropy"
+	"github.com/fmitra/authenticator/internal/fingerprint"
+	"github.com/fmitra/authenticator/internal/jwe"
 )
 
 const (
 	defaultTokenExpiry        = time.Minute * 20
 	defaultRefreshTokenExpiry = time.Hour * 24 * 15
 	defaultIssuer             = "authenticator"
+	defaultMinTTL             = time.Minute
 )
 
 // NewService returns a new TokenService.
@@ -22,14 +30,29 @@ func NewService(options ...ConfigOption) auth.TokenService {
 		tokenExpiry:        defaultTokenExpiry,
 		refreshTokenExpiry: defaultRefreshTokenExpiry,
 		issuer:             defaultIssuer,
+		minTTL:             defaultMinTTL,
+		claimsMode:         ClaimsFull,
+		fingerprintMode:    fingerprint.Off,
+		cookiePath:         "/",
+		cookieSecure:       true,
+		clientIDCookie:     ClientIDCookie,
+		refreshTokenCookie: RefreshTokenCookie,
 	}
 
 	s.entropy = entropy.New()
+	s.clock = clock.New()
+	s.hooks = auth.NopHooks{}
+	s.metrics = discardMetrics()
 
 	for _, opt := range options {
 		opt(&s)
 	}
 
+	// Encrypted tokens are accepted in every mode so deployments
+	// may stop encrypting without invalidating issued tokens. Tokens
+	// which are not encrypted are rejected in ClaimsEncrypted mode.
+	s.encryptionKey = jwe.DeriveKey(s.secret)
+
 	return &s
 }
 
@@ -43,6 +66,26 @@ func WithLogger(l log.Logger) ConfigOption {
 	}
 }
 
+// WithClock configures the service with a clock used to issue
+// and expire tokens. Defaults to the system clock.
+func WithClock(c clock.Clock) ConfigOption {
+	return func(s *service) {
+		s.clock = c
+	}
+}
+
+// WithLeeway configures the clock skew tolerated when validating
+// the iat, exp and nbf claims of a token. Defaults to no leeway.
+// A negative leeway, which would reject valid tokens, is ignored.
+func WithLeeway(leeway time.Duration) ConfigOption {
+	return func(s *service) {
+		if leeway < 0 {
+			return
+		}
+		s.leeway = leeway
+	}
+}
+
 // WithDB configures the service with a redis DB
 func WithDB(db rediser) ConfigOption {
 	return func(s *service) {
@@ -66,6 +109,15 @@ func WithRefreshTokenExpiry(expiresIn time.Duration) ConfigOption {
 	}
 }
 
+// WithMinTTL sets the shortest lifetime which may be requested for
+// a token with WithTTL. Shorter requests are raised to it. The default
+// value is 1 minute.
+func WithMinTTL(ttl time.Duration) ConfigOption {
+	return func(s *service) {
+		s.minTTL = ttl
+	}
+}
+
 // WithSecret configures the service with a secret value
 // for signing functions.
 func WithSecret(secret string) ConfigOption {
@@ -103,9 +155,203 @@ func WithCookieMaxAge(age int) ConfigOption {
 	}
 }
 
+// WithCookiePath sets the path of HTTP cookies. Defaults to `/`.
+func WithCookiePath(path string) ConfigOption {
+	return func(s *service) {
+		s.cookiePath = path
+	}
+}
+
+// WithCookieSecure sets whether HTTP cookies are restricted to HTTPS.
+// Defaults to true and should only be disabled for local development.
+func WithCookieSecure(secure bool) ConfigOption {
+	return func(s *service) {
+		s.cookieSecure = secure
+	}
+}
+
+// WithCookieSameSite sets the SameSite attribute of HTTP cookies. By
+// default the attribute is omitted and the browser's default applies.
+func WithCookieSameSite(sameSite http.SameSite) ConfigOption {
+	return func(s *service) {
+		s.cookieSameSite = sameSite
+	}
+}
+
+// WithCookieNames sets the names of the client ID and refresh token
+// cookies. Defaults to ClientIDCookie and RefreshTokenCookie.
+func WithCookieNames(clientID, refreshToken string) ConfigOption {
+	return func(s *service) {
+		s.clientIDCookie = clientID
+		s.refreshTokenCookie = refreshToken
+	}
+}
+
+// WithHostOnlyCookies restricts HTTP cookies to the host which set
+// them. Host-only cookies are prefixed with `__Host-`, are always
+// secure and ignore the configured domain and path.
+func WithHostOnlyCookies(hostOnly bool) ConfigOption {
+	return func(s *service) {
+		s.cookieHostOnly = hostOnly
+	}
+}
+
+// ParseSameSite parses a SameSite cookie attribute from its
+// name: lax, strict or none. An empty name omits the attribute.
+func ParseSameSite(name string) (http.SameSite, error) {
+	switch strings.ToLower(name) {
+	case "":
+		// The zero value omits the attribute on every Go release,
+		// unlike SameSiteDefaultMode.
+		return 0, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("unknown SameSite attribute %q", name)
+	}
+}
+
 // WithRepoManager configures the service with a new RepositoryManager.
 func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
 	return func(s *service) {
 		s.repoMngr = repoMngr
 	}
 }
+
+// WithRequiredConsent configures the policies a User must accept
+// before an authorized token may be used beyond recording consent.
+func WithRequiredConsent(policies consent.Policies) ConfigOption {
+	return func(s *service) {
+		s.requiredConsent = policies
+	}
+}
+
+// WithRequiredEnrollment configures whether Users must enable a TOTP
+// app or WebAuthn device before an authorized token may be used beyond
+// 2FA and contact setup.
+func WithRequiredEnrollment(required bool) ConfigOption {
+	return func(s *service) {
+		s.requireEnrollment = required
+	}
+}
+
+// WithEnrollmentGracePeriod configures how long Users may use
+// unrestricted tokens without a TOTP app or WebAuthn device while 2FA
+// enrollment is required. The period starts from the first authorized
+// token issued to a User and requires a RepositoryManager to track
+// deadlines. Tokens are restricted immediately without a grace period.
+func WithEnrollmentGracePeriod(d time.Duration) ConfigOption {
+	return func(s *service) {
+		s.enrollmentGracePeriod = d
+	}
+}
+
+// WithHooks configures the service with Hooks run before
+// a token is issued.
+func WithHooks(h auth.Hooks) ConfigOption {
+	return func(s *service) {
+		s.hooks = h
+	}
+}
+
+// WithAllowedAudiences configures the audiences which may be
+// requested for a token.
+func WithAllowedAudiences(audiences []string) ConfigOption {
+	return func(s *service) {
+		s.allowedAudiences = toSet(audiences)
+	}
+}
+
+// WithAllowedScopes configures the scopes which may be
+// requested for a token.
+func WithAllowedScopes(scopes []string) ConfigOption {
+	return func(s *service) {
+		s.allowedScopes = toSet(scopes)
+	}
+}
+
+// WithCodeReuseWindow reuses the code delivered to an address for a
+// new token within the window instead of delivering another, so a
+// login or signup submitted twice delivers a single code. Tokens
+// reusing a code are created without one to deliver. Codes are not
+// reused if it is 0.
+func WithCodeReuseWindow(d time.Duration) ConfigOption {
+	return func(s *service) {
+		s.codeReuseWindow = d
+	}
+}
+
+// WithIdleTimeout invalidates tokens which are not used within
+// the timeout, regardless of their expiry. A zero timeout disables
+// idle invalidation.
+func WithIdleTimeout(timeout time.Duration) ConfigOption {
+	return func(s *service) {
+		s.idleTimeout = timeout
+	}
+}
+
+// WithFingerprintBinding binds tokens to the fingerprint of the
+// client they are issued to. Tokens presented from another client
+// are logged or rejected depending on the mode.
+func WithFingerprintBinding(mode fingerprint.Mode) ConfigOption {
+	return func(s *service) {
+		s.fingerprintMode = mode
+	}
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
+
+// WithRevocationCache configures the service to cache revocation
+// state in process. Revocations are published to the cache of every
+// instance running RevocationCache.Run.
+func WithRevocationCache(c *RevocationCache) ConfigOption {
+	return func(s *service) {
+		s.revocations = c
+	}
+}
+
+// WithUserQuota limits the tokens created and refreshed per hour
+// for each User. Denied tokens return ErrQuota. Unlimited by default.
+func WithUserQuota(q Quota) ConfigOption {
+	return func(s *service) {
+		s.userQuota = q
+	}
+}
+
+// WithTenantQuota limits the tokens created and refreshed per hour
+// on behalf of each ClientApplication. Denied tokens return ErrQuota.
+// Unlimited by default.
+func WithTenantQuota(q Quota) ConfigOption {
+	return func(s *service) {
+		s.tenantQuota = q
+	}
+}
+
+// WithClaimsMode configures how the claims identifying a User are
+// exposed to clients. Defaults to ClaimsFull.
+func WithClaimsMode(mode ClaimsMode) ConfigOption {
+	return func(s *service) {
+		s.claimsMode = mode
+	}
+}
+
+// WithMetrics configures the service to record token issuance.
+// Defaults to discarding metrics.
+func WithMetrics(m Metrics) ConfigOption {
+	return func(s *service) {
+		s.metrics = m
+	}
+}
@@ -0,0 +1,45 @@
+package token
+
+import (
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are the instruments token issuance is observed with.
+type Metrics struct {
+	// Issued counts tokens issued, labeled by `kind`: create
+	// or refresh.
+	Issued metrics.Counter
+	// QuotaExceeded counts tokens denied by a quota, labeled by
+	// `scope`: user or tenant, and `kind`: create or refresh.
+	QuotaExceeded metrics.Counter
+}
+
+// NewPrometheusMetrics returns Metrics registered with the default
+// Prometheus registry. It may only be called once.
+func NewPrometheusMetrics() Metrics {
+	return Metrics{
+		Issued: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "authenticator",
+			Subsystem: "tokens",
+			Name:      "issued_total",
+			Help:      "Number of tokens issued.",
+		}, []string{"kind"}),
+		QuotaExceeded: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "authenticator",
+			Subsystem: "tokens",
+			Name:      "quota_exceeded_total",
+			Help:      "Number of tokens denied by a quota.",
+		}, []string{"scope", "kind"}),
+	}
+}
+
+// discardMetrics returns Metrics which record nothing.
+func discardMetrics() Metrics {
+	return Metrics{
+		Issued:        discard.NewCounter(),
+		QuotaExceeded: discard.NewCounter(),
+	}
+}
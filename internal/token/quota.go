@@ -0,0 +1,99 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+const (
+	quotaCreate  = "create"
+	quotaRefresh = "refresh"
+
+	quotaUser   = "user"
+	quotaTenant = "tenant"
+
+	// quotaWindow is the period quotas are counted over.
+	quotaWindow = time.Hour
+)
+
+// Quota limits the tokens issued per hour to a User or to the
+// ClientApplication, or tenant, they are issued to. A zero limit
+// is unlimited.
+type Quota struct {
+	// Creates is the number of new tokens which may be issued.
+	Creates int64
+	// Refreshes is the number of tokens which may be refreshed.
+	Refreshes int64
+}
+
+// limit returns the quota of a kind of issuance.
+func (q Quota) limit(kind string) int64 {
+	if kind == quotaRefresh {
+		return q.Refreshes
+	}
+	return q.Creates
+}
+
+// checkQuotas counts the issuance of a token against the quotas of
+// its User and tenant, returning ErrQuota once either is exhausted.
+// Tokens issued without a ClientApplication only count against the
+// User's quota.
+func (s *service) checkQuotas(ctx context.Context, userID, appID, kind string) error {
+	if err := s.checkQuota(ctx, quotaUser, userID, kind, s.userQuota.limit(kind)); err != nil {
+		return err
+	}
+	if appID == "" {
+		return nil
+	}
+	return s.checkQuota(ctx, quotaTenant, appID, kind, s.tenantQuota.limit(kind))
+}
+
+// checkQuota counts an issuance within the current quota window
+// of a User or tenant.
+func (s *service) checkQuota(ctx context.Context, scope, id, kind string, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+
+	window := s.clock.Now().Unix() / int64(quotaWindow/time.Second)
+	key := QuotaKey(scope, id, kind, window)
+	count, err := s.db.Incr(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("cannot count token quota: %w", err)
+	}
+	if count == 1 {
+		if err = s.db.Expire(ctx, key, quotaWindow).Err(); err != nil {
+			return fmt.Errorf("cannot expire token quota: %w", err)
+		}
+	}
+	if count <= limit {
+		return nil
+	}
+
+	s.metrics.QuotaExceeded.With("scope", scope, "kind", kind).Add(1)
+	// Only the first denial of a window is logged, as automation
+	// exceeding a quota is likely to keep retrying.
+	if count == limit+1 {
+		level.Warn(s.logger).Log(
+			"source", "TokenService.Create",
+			"message", "token quota exceeded",
+			"scope", scope,
+			"id", id,
+			"kind", kind,
+			"limit", limit,
+		)
+	}
+
+	return auth.ErrQuota(fmt.Sprintf("%s %s quota exceeded", scope, kind))
+}
+
+// QuotaKey is the key counting the tokens of a kind issued to a User
+// or tenant within a quota window.
+func QuotaKey(scope, id, kind string, window int64) string {
+	return fmt.Sprintf("%s_%s_token_%s_quota_%d", scope, id, kind, window)
+}
@@ -1,8 +1,16 @@
 package token
 
+import (
+	auth "github.com/fmitra/authenticator"
+)
+
 // Response ensures consistent formatting for JSON APIs.
 type Response struct {
 	Token        string `json:"token"`
 	ClientID     string `json:"clientID,omitempty"`
 	RefreshToken string `json:"refreshToken,omitempty"`
+	// State and TFAOptions are returned alongside tokens issued by
+	// login and signup, as encrypted tokens may not be read by clients.
+	State      auth.TokenState   `json:"state,omitempty"`
+	TFAOptions []auth.TFAOptions `json:"tfaOptions,omitempty"`
 }
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,7 +19,13 @@ import (
 	"github.com/oklog/ulid/v2"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clientapp"
+	"github.com/fmitra/authenticator/internal/clock"
+	"github.com/fmitra/authenticator/internal/consent"
 	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/fingerprint"
+	"github.com/fmitra/authenticator/internal/jwe"
+	"github.com/fmitra/authenticator/internal/otp"
 )
 
 const (
@@ -26,13 +33,20 @@ const (
 	refreshTokenLen = 40
 )
 
+// ActivityInterval is the minimum time between recording the
+// activity of a token, limiting writes for busy sessions.
+const ActivityInterval = time.Minute
+
 const (
-	// ClientIDCookie is the cookie name used to set the token's
-	// ClientID value on a client.
+	// ClientIDCookie is the default cookie name used to set the
+	// token's ClientID value on a client.
 	ClientIDCookie = "CLIENTID"
-	// RefreshTokenCookie is the cookie name used to set the refresh
-	// token value on a client.
+	// RefreshTokenCookie is the default cookie name used to set the
+	// refresh token value on a client.
 	RefreshTokenCookie = "REFRESHTOKEN"
+	// hostOnlyCookiePrefix is prepended to the names of host-only
+	// cookies so browsers enforce they are secure and unscoped.
+	hostOnlyCookiePrefix = "__Host-"
 )
 
 // RefreshToken is a token capable of refreshing an expired
@@ -40,12 +54,19 @@ const (
 type RefreshToken struct {
 	Code      string `json:"code"`
 	ExpiresAt int64  `json:"expires_at"`
+	// DeviceHash is the hash of a device ID the refresh token is
+	// bound to. Bound refresh tokens may only be used alongside
+	// the same device ID.
+	DeviceHash string `json:"device_hash,omitempty"`
 }
 
 // rediser is an interface to go-redis.
 type rediser interface {
 	Get(ctx context.Context, key string) *redislib.StringCmd
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redislib.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redislib.BoolCmd
+	Incr(ctx context.Context, key string) *redislib.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redislib.BoolCmd
 	Close() error
 }
 
@@ -76,6 +97,104 @@ func WithRefreshableToken(token *auth.Token) auth.TokenOption {
 	}
 }
 
+// WithRefreshTokenRotation replaces the refresh token of a refreshed
+// JWT token. The previous refresh token may not be used again. It
+// must be provided alongside WithRefreshableToken.
+func WithRefreshTokenRotation(refreshToken string) auth.TokenOption {
+	return func(conf *auth.TokenConfiguration) {
+		conf.RotatedRefreshToken = refreshToken
+	}
+}
+
+// WithTTL requests a lifetime for a JWT token and its refresh token
+// shorter than the defaults, e.g. for kiosk logins. The lifetime is
+// clamped between the service's minimum TTL and the defaults. Tokens
+// refreshed from a token with a TTL keep it unless a shorter one is
+// requested. A zero TTL keeps the defaults.
+func WithTTL(ttl time.Duration) auth.TokenOption {
+	return func(conf *auth.TokenConfiguration) {
+		conf.TTL = ttl
+	}
+}
+
+// WithDeviceBinding binds a JWT token's refresh token to a device ID
+// generated by a native client. The refresh token may only be used
+// alongside the same device ID. An empty device ID is ignored.
+func WithDeviceBinding(deviceID string) auth.TokenOption {
+	return func(conf *auth.TokenConfiguration) {
+		conf.DeviceID = deviceID
+	}
+}
+
+// WithAudiences restricts a JWT token to the APIs it is intended for.
+// Audiences must be allowed by the service configuration and by the
+// ClientApplication the token is issued to.
+func WithAudiences(audiences ...string) auth.TokenOption {
+	return func(conf *auth.TokenConfiguration) {
+		conf.Audiences = audiences
+	}
+}
+
+// WithScopes grants permissions to a JWT token. Scopes must be
+// allowed by the service configuration and by the ClientApplication
+// the token is issued to.
+func WithScopes(scopes ...string) auth.TokenOption {
+	return func(conf *auth.TokenConfiguration) {
+		conf.Scopes = scopes
+	}
+}
+
+// WithAuthMethods records the factors a User completed to obtain
+// a JWT token.
+func WithAuthMethods(methods ...string) auth.TokenOption {
+	return func(conf *auth.TokenConfiguration) {
+		conf.AuthMethods = methods
+	}
+}
+
+// WithTFAOptions restricts the 2FA options offered by a JWT token to
+// the options given. Options the User has not enabled are ignored.
+func WithTFAOptions(options ...auth.TFAOptions) auth.TokenOption {
+	return func(conf *auth.TokenConfiguration) {
+		if options == nil {
+			options = []auth.TFAOptions{}
+		}
+		conf.TFAOptions = options
+	}
+}
+
+// ExpectAudience rejects JWT tokens which are not intended for an
+// audience, including tokens without an audience.
+func ExpectAudience(audience string) auth.ValidateOption {
+	return func(conf *auth.ValidateConfiguration) {
+		conf.Audience = audience
+	}
+}
+
+// AllowAudienceless accepts JWT tokens without an audience alongside
+// tokens intended for the audience given to ExpectAudience.
+func AllowAudienceless() auth.ValidateOption {
+	return func(conf *auth.ValidateConfiguration) {
+		conf.AllowAudienceless = true
+	}
+}
+
+// ExpectDevice provides the device ID a refresh token is used from.
+// Refresh tokens bound to another device are rejected.
+func ExpectDevice(deviceID string) auth.ValidateOption {
+	return func(conf *auth.ValidateConfiguration) {
+		conf.DeviceID = deviceID
+	}
+}
+
+// RequireScopes rejects JWT tokens which have not been granted
+// every scope.
+func RequireScopes(scopes ...string) auth.ValidateOption {
+	return func(conf *auth.ValidateConfiguration) {
+		conf.Scopes = scopes
+	}
+}
+
 // service is an implementation of auth.TokenService
 // backed by redis.
 type service struct {
@@ -90,16 +209,59 @@ type service struct {
 	otp                auth.OTPService
 	cookieMaxAge       int
 	cookieDomain       string
+	cookiePath         string
+	cookieSecure       bool
+	cookieSameSite     http.SameSite
+	cookieHostOnly     bool
+	clientIDCookie     string
+	refreshTokenCookie string
+	requiredConsent    consent.Policies
+	requireEnrollment  bool
+	allowedAudiences   map[string]bool
+	allowedScopes      map[string]bool
+	fingerprintMode    fingerprint.Mode
+	idleTimeout        time.Duration
+	revocations        *RevocationCache
+	clock              clock.Clock
+	leeway             time.Duration
+	minTTL             time.Duration
+	claimsMode         ClaimsMode
+	encryptionKey      []byte
+	codeReuseWindow    time.Duration
+	userQuota          Quota
+	tenantQuota        Quota
+	metrics            Metrics
+
+	enrollmentGracePeriod time.Duration
+	hooks                 auth.Hooks
 }
 
 // Create creates a new, unsigned JWT token for a User
-// with optional configuration settings.
+// with optional configuration settings. Tokens created for a request
+// made on behalf of a ClientApplication are issued to it and use its
+// token lifetimes.
 func (s *service) Create(ctx context.Context, user *auth.User, state auth.TokenState, options ...auth.TokenOption) (*auth.Token, error) {
 	conf := &auth.TokenConfiguration{}
 	for _, opt := range options {
 		opt(conf)
 	}
 
+	app := clientapp.FromContext(ctx)
+	appID, err := s.genClientApplicationID(conf, app)
+	if err != nil {
+		return nil, err
+	}
+
+	kind := quotaCreate
+	if conf.RefreshableToken != nil {
+		kind = quotaRefresh
+	}
+	if err = s.checkQuotas(ctx, user.ID, appID, kind); err != nil {
+		return nil, err
+	}
+
+	tokenExpiry, refreshTokenExpiry, ttl := s.genExpiry(conf, app)
+
 	tokenULID, err := s.genULID(conf)
 	if err != nil {
 		return nil, err
@@ -110,44 +272,91 @@ func (s *service) Create(ctx context.Context, user *auth.User, state auth.TokenS
 		return nil, err
 	}
 
-	code, codeHash, err := s.genOTPAndHash(conf, user)
+	code, codeHash, err := s.genOTPAndHash(ctx, conf, user)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, refreshTokenHash, err := s.genRefreshTokenAndHash(conf)
+	refreshToken, refreshTokenHash, err := s.genRefreshTokenAndHash(ctx, conf, refreshTokenExpiry)
 	if err != nil {
 		return nil, err
 	}
 
-	expiresAt := time.Now().Add(s.tokenExpiry).Unix()
-	tfaOptions := s.genTFAOptions(user)
+	orgClaims, err := s.genOrganizationClaims(ctx, user, state)
+	if err != nil {
+		return nil, err
+	}
+
+	consentRequired, err := s.isConsentRequired(ctx, user, state)
+	if err != nil {
+		return nil, err
+	}
+
+	generation, err := s.generation(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	audiences, scopes, err := s.genAudiencesAndScopes(conf, app)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	enrollmentRequired, enrollmentDeadline, err := s.enrollmentStatus(ctx, user, state, now)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := now.Add(tokenExpiry).Unix()
+	tfaOptions := s.genTFAOptions(user, app, conf.TFAOptions)
 
 	token := auth.Token{
 		StandardClaims: jwt.StandardClaims{
-			IssuedAt:  time.Now().Unix(),
+			IssuedAt:  now.Unix(),
 			ExpiresAt: expiresAt,
 			Id:        tokenULID,
 			Issuer:    s.issuer,
 		},
-		Code:             code,
-		CodeHash:         codeHash,
-		RefreshToken:     refreshToken,
-		RefreshTokenHash: refreshTokenHash,
-		UserID:           user.ID,
-		Email:            user.Email.String,
-		Phone:            user.Phone.String,
-		ClientID:         clientID,
-		ClientIDHash:     clientIDHash,
-		State:            state,
-		TFAOptions:       tfaOptions,
-		DefaultTFA:       user.DefaultTFA(),
+		Code:                code,
+		CodeHash:            codeHash,
+		RefreshToken:        refreshToken,
+		RefreshTokenHash:    refreshTokenHash,
+		UserID:              user.ID,
+		Email:               s.genContactClaim(user.Email.String),
+		Phone:               s.genContactClaim(user.Phone.String),
+		ClientID:            clientID,
+		ClientIDHash:        clientIDHash,
+		State:               state,
+		TFAOptions:          tfaOptions,
+		DefaultTFA:          genDefaultTFA(user, tfaOptions, conf.TFAOptions),
+		Organizations:       orgClaims,
+		ConsentRequired:     consentRequired,
+		EnrollmentRequired:  enrollmentRequired,
+		EnrollmentDeadline:  enrollmentDeadline,
+		Generation:          generation,
+		Audiences:           audiences,
+		Scopes:              scopes,
+		ClientApplicationID: appID,
+		Fingerprint:         s.genFingerprint(ctx),
+		AuthMethods:         genAuthMethods(conf),
+		TTL:                 int64(ttl / time.Second),
+	}
+
+	if err = s.hooks.BeforeTokenIssue(ctx, user, &token); err != nil {
+		return nil, err
 	}
 
 	if err = s.invalidateOldTokens(ctx, conf, &token); err != nil {
 		return nil, fmt.Errorf("cannot invalidate old tokens: %w", err)
 	}
 
+	if err = s.recordActivity(ctx, token.Id, now); err != nil {
+		return nil, err
+	}
+
+	s.metrics.Issued.With("kind", kind).Add(1)
+
 	return &token, nil
 }
 
@@ -159,13 +368,27 @@ func (s *service) Sign(ctx context.Context, token *auth.Token) (string, error) {
 		return "", fmt.Errorf("failed to sign JWT token: %w", err)
 	}
 
-	return jwtSigned, nil
+	if s.claimsMode != ClaimsEncrypted {
+		return jwtSigned, nil
+	}
+
+	jwtEncrypted, err := jwe.Encrypt(s.encryptionKey, jwtSigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt JWT token: %w", err)
+	}
+
+	return jwtEncrypted, nil
 }
 
 // Validate checks that a JWT token is signed by us, unexpired, unrevoked
 // and originating from a valid client. On success it will return the unpacked
 // Token struct.
-func (s *service) Validate(ctx context.Context, signedToken string, clientID string) (*auth.Token, error) {
+func (s *service) Validate(ctx context.Context, signedToken string, clientID string, options ...auth.ValidateOption) (*auth.Token, error) {
+	conf := &auth.ValidateConfiguration{}
+	for _, opt := range options {
+		opt(conf)
+	}
+
 	if !strings.HasPrefix(signedToken, "Bearer ") {
 		return nil, auth.ErrInvalidToken("bearer token expected")
 	}
@@ -178,8 +401,20 @@ func (s *service) Validate(ctx context.Context, signedToken string, clientID str
 		return s.secret, nil
 	}
 
+	// Time based claims are checked against the service clock
+	// rather than jwt-go's package level TimeFunc.
+	parser := jwt.Parser{SkipClaimsValidation: true}
 	signedToken = strings.TrimPrefix(signedToken, "Bearer ")
-	unpackedToken, err := jwt.Parse(signedToken, tokenParser)
+	if jwe.IsEncrypted(signedToken) {
+		var err error
+		signedToken, err = jwe.Decrypt(s.encryptionKey, signedToken)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", err, auth.ErrInvalidToken("token is invalid"))
+		}
+	} else if s.claimsMode == ClaimsEncrypted {
+		return nil, auth.ErrInvalidToken("token is not encrypted")
+	}
+	unpackedToken, err := parser.Parse(signedToken, tokenParser)
 	if err != nil {
 		return nil, fmt.Errorf("%v: %w", err, auth.ErrInvalidToken("token is invalid"))
 	}
@@ -188,6 +423,9 @@ func (s *service) Validate(ctx context.Context, signedToken string, clientID str
 	if !ok || !unpackedToken.Valid {
 		return nil, fmt.Errorf("token claims unavailable")
 	}
+	if err = ValidateClaims(claims, s.clock.Now(), s.leeway); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrInvalidToken("token is invalid"))
+	}
 
 	var token auth.Token
 	{
@@ -215,6 +453,14 @@ func (s *service) Validate(ctx context.Context, signedToken string, clientID str
 		return nil, auth.ErrInvalidToken("token source is invalid")
 	}
 
+	if conf.Audience != "" && !isAudienceValid(&token, conf.Audience, conf.AllowAudienceless) {
+		return nil, auth.ErrInvalidToken("token audience is invalid")
+	}
+
+	if !token.HasScopes(conf.Scopes...) {
+		return nil, auth.ErrForbidden("token scope is insufficient")
+	}
+
 	if err := s.checkRevocation(ctx, &token); err != nil {
 		return nil, err
 	}
@@ -223,6 +469,18 @@ func (s *service) Validate(ctx context.Context, signedToken string, clientID str
 		return nil, err
 	}
 
+	if err := s.checkGeneration(ctx, &token); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkFingerprint(ctx, &token); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkActivity(ctx, &token); err != nil {
+		return nil, err
+	}
+
 	return &token, nil
 }
 
@@ -241,7 +499,7 @@ func (s *service) Revoke(ctx context.Context, tokenID string) error {
 		return fmt.Errorf("cannot start transaction: %w", err)
 	}
 
-	_, err = tx.WithAtomic(func() (interface{}, error) {
+	entity, err := tx.WithAtomic(func() (interface{}, error) {
 		lh, err := tx.LoginHistory().GetForUpdate(ctx, tokenID)
 		if err != nil {
 			return nil, err
@@ -258,42 +516,128 @@ func (s *service) Revoke(ctx context.Context, tokenID string) error {
 		return fmt.Errorf("failed to invalidate login history record: %w", err)
 	}
 
-	return s.db.Set(ctx, revocationKey(tokenID), true, s.tokenExpiry).Err()
+	// Tokens issued to a ClientApplication may outlive the default
+	// token expiry but never the login they were issued for.
+	expiresIn := s.tokenExpiry
+	if lh, ok := entity.(*auth.LoginHistory); ok {
+		if d := lh.ExpiresAt.Sub(s.clock.Now()); d > expiresIn {
+			expiresIn = d
+		}
+	}
+
+	if err = s.db.Set(ctx, RevocationKey(tokenID), true, expiresIn).Err(); err != nil {
+		return err
+	}
+
+	s.publishRevocation(ctx, RevocationKey(tokenID))
+	return nil
+}
+
+// RevokeAll revokes every outstanding token for a User by advancing
+// the User's token generation. Tokens issued under an earlier generation
+// fail validation and may not be refreshed.
+func (s *service) RevokeAll(ctx context.Context, userID string) error {
+	if err := s.db.Incr(ctx, GenerationKey(userID)).Err(); err != nil {
+		return fmt.Errorf("cannot advance token generation: %w", err)
+	}
+
+	s.publishRevocation(ctx, GenerationKey(userID))
+	return nil
+}
+
+// publishRevocation evicts a revoked key from the revocation cache of
+// every instance. Instances which miss it notice the revocation once
+// their cached entry expires.
+func (s *service) publishRevocation(ctx context.Context, key string) {
+	if s.revocations == nil {
+		return
+	}
+
+	if err := s.revocations.publish(ctx, key); err != nil {
+		level.Error(s.logger).Log(
+			"source", "TokenService.publishRevocation",
+			"message", "failed to publish revocation",
+			"key", key,
+			"error", err,
+		)
+	}
+}
+
+// getRevocationState reads a key of revocation state, through the
+// revocation cache if it is configured.
+func (s *service) getRevocationState(ctx context.Context, key string) (string, error) {
+	if s.revocations == nil {
+		return s.db.Get(ctx, key).Result()
+	}
+	return s.revocations.get(ctx, s.db, key)
 }
 
 // Cookies returns a secure cookies to accompany a token.
 func (s *service) Cookies(ctx context.Context, token *auth.Token) []*http.Cookie {
+	clientIDCookie, refreshTokenCookie := s.CookieNames()
 	cookies := []*http.Cookie{
-		{
-			Name:     ClientIDCookie,
-			Value:    token.ClientID,
-			MaxAge:   s.cookieMaxAge,
-			Domain:   s.cookieDomain,
-			Path:     "/",
-			Secure:   true,
-			HttpOnly: true,
-		},
-		{
-			Name:     RefreshTokenCookie,
-			Value:    token.RefreshToken,
-			MaxAge:   s.cookieMaxAge,
-			Domain:   s.cookieDomain,
-			Path:     "/",
-			Secure:   true,
-			HttpOnly: true,
-		},
+		s.cookie(clientIDCookie, token.ClientID),
+		s.cookie(refreshTokenCookie, token.RefreshToken),
 	}
 
 	return cookies
 }
 
-// Refreshable checks if a provided token can be refreshed.
-func (s *service) Refreshable(ctx context.Context, token *auth.Token, refreshToken string) error {
-	_, err := unpackRefreshToken(refreshToken, token.RefreshTokenHash)
+// CookieNames returns the names of the client ID and refresh token
+// cookies. Host-only cookies are prefixed with `__Host-`.
+func (s *service) CookieNames() (clientID, refreshToken string) {
+	if s.cookieHostOnly {
+		return hostOnlyCookiePrefix + s.clientIDCookie, hostOnlyCookiePrefix + s.refreshTokenCookie
+	}
+	return s.clientIDCookie, s.refreshTokenCookie
+}
+
+// cookie returns a cookie with the service's configured attributes.
+// Host-only cookies are never scoped to a domain and are always
+// secure, as browsers reject `__Host-` cookies otherwise.
+func (s *service) cookie(name, value string) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		MaxAge:   s.cookieMaxAge,
+		Domain:   s.cookieDomain,
+		Path:     s.cookiePath,
+		Secure:   s.cookieSecure,
+		SameSite: s.cookieSameSite,
+		HttpOnly: true,
+	}
+
+	if s.cookieHostOnly {
+		cookie.Domain = ""
+		cookie.Path = "/"
+		cookie.Secure = true
+	}
+
+	return cookie
+}
+
+// Refreshable checks if a provided token can be refreshed. Reusing a
+// rotated refresh token indicates it was stolen and revokes the token
+// it was issued for.
+func (s *service) Refreshable(ctx context.Context, token *auth.Token, refreshToken string, options ...auth.ValidateOption) error {
+	conf := &auth.ValidateConfiguration{}
+	for _, opt := range options {
+		opt(conf)
+	}
+
+	r, err := unpackRefreshToken(refreshToken, token.RefreshTokenHash, s.clock.Now())
 	if err != nil {
 		return err
 	}
 
+	if r.DeviceHash != "" && !isHashValid(conf.DeviceID, r.DeviceHash) {
+		return auth.ErrInvalidToken("refresh token is bound to another device")
+	}
+
+	if err = s.checkRotation(ctx, token); err != nil {
+		return err
+	}
+
 	lh, err := s.repoMngr.LoginHistory().ByTokenID(ctx, token.Id)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve login history record: %w", err)
@@ -303,12 +647,12 @@ func (s *service) Refreshable(ctx context.Context, token *auth.Token, refreshTok
 		return auth.ErrInvalidToken("token is revoked")
 	}
 
-	return nil
+	return s.checkGeneration(ctx, token)
 }
 
 // RefreshableTill returns the last validity time of a refresh token.
 func (s *service) RefreshableTill(ctx context.Context, token *auth.Token, refreshToken string) time.Time {
-	r, err := unpackRefreshToken(refreshToken, token.RefreshTokenHash)
+	r, err := unpackRefreshToken(refreshToken, token.RefreshTokenHash, s.clock.Now())
 	if err != nil {
 		return time.Time{}
 	}
@@ -316,7 +660,10 @@ func (s *service) RefreshableTill(ctx context.Context, token *auth.Token, refres
 	return time.Unix(r.ExpiresAt, 0)
 }
 
-func (s *service) genTFAOptions(user *auth.User) []auth.TFAOptions {
+// genTFAOptions returns the 2FA options a User may complete authentication
+// with, excluding options the ClientApplication does not accept and,
+// if restricted, options which were not requested.
+func (s *service) genTFAOptions(user *auth.User, app *auth.ClientApplication, restricted []auth.TFAOptions) []auth.TFAOptions {
 	options := []auth.TFAOptions{}
 
 	if user.IsPhoneOTPAllowed {
@@ -335,7 +682,250 @@ func (s *service) genTFAOptions(user *auth.User) []auth.TFAOptions {
 		options = append(options, auth.FIDODevice)
 	}
 
-	return options
+	if app == nil && restricted == nil {
+		return options
+	}
+
+	allowed := []auth.TFAOptions{}
+	for _, option := range options {
+		if app != nil && !app.AllowsTFA(option) {
+			continue
+		}
+		if restricted != nil && !hasTFAOption(restricted, option) {
+			continue
+		}
+		allowed = append(allowed, option)
+	}
+
+	return allowed
+}
+
+// genDefaultTFA returns the User's default 2FA option, or the first
+// option offered if the token's 2FA options are restricted and exclude
+// the User's default.
+func genDefaultTFA(user *auth.User, options, restricted []auth.TFAOptions) auth.TFAOptions {
+	defaultTFA := user.DefaultTFA()
+	if restricted == nil || hasTFAOption(options, defaultTFA) || len(options) == 0 {
+		return defaultTFA
+	}
+
+	return options[0]
+}
+
+func hasTFAOption(options []auth.TFAOptions, option auth.TFAOptions) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+
+	return false
+}
+
+// genOrganizationClaims returns the Organizations a User is a member of.
+// Claims are only included in authorized tokens.
+func (s *service) genOrganizationClaims(ctx context.Context, user *auth.User, state auth.TokenState) ([]auth.OrganizationClaim, error) {
+	if state != auth.JWTAuthorized || s.repoMngr == nil {
+		return nil, nil
+	}
+
+	memberships, err := s.repoMngr.Membership().ByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot retrieve memberships: %w", err)
+	}
+
+	var claims []auth.OrganizationClaim
+	for _, m := range memberships {
+		claims = append(claims, auth.OrganizationClaim{
+			ID:   m.OrganizationID,
+			Role: m.Role,
+		})
+	}
+
+	return claims, nil
+}
+
+// isConsentRequired checks if a User has yet to accept the latest
+// version of a required policy. Only authorized tokens are checked,
+// allowing consent to be recorded prior to completing login.
+func (s *service) isConsentRequired(ctx context.Context, user *auth.User, state auth.TokenState) (bool, error) {
+	if state != auth.JWTAuthorized || len(s.requiredConsent) == 0 || s.repoMngr == nil {
+		return false, nil
+	}
+
+	consents, err := s.repoMngr.Consent().ByUserID(ctx, user.ID)
+	if err != nil {
+		return false, fmt.Errorf("cannot retrieve consent: %w", err)
+	}
+
+	return len(s.requiredConsent.Pending(consents)) > 0, nil
+}
+
+// enrollmentStatus checks if a User has yet to enable a TOTP app or
+// WebAuthn device while 2FA enrollment is mandatory. OTP codes delivered
+// to a User's address do not count as enrollment. During a grace period,
+// which starts from the first authorized token issued to the User,
+// enrollment is not yet required and the deadline is returned instead.
+func (s *service) enrollmentStatus(ctx context.Context, user *auth.User, state auth.TokenState, now time.Time) (bool, int64, error) {
+	if state != auth.JWTAuthorized || !s.requireEnrollment || user.IsTOTPAllowed || user.IsDeviceAllowed {
+		return false, 0, nil
+	}
+
+	if s.enrollmentGracePeriod <= 0 || s.repoMngr == nil {
+		return true, 0, nil
+	}
+
+	enrollment := auth.TFAEnrollment{
+		UserID:   user.ID,
+		Deadline: now.Add(s.enrollmentGracePeriod),
+	}
+	if err := s.repoMngr.TFAEnrollment().Create(ctx, &enrollment); err != nil {
+		return false, 0, fmt.Errorf("cannot record enrollment deadline: %w", err)
+	}
+
+	if !now.Before(enrollment.Deadline) {
+		return true, 0, nil
+	}
+
+	return false, enrollment.Deadline.Unix(), nil
+}
+
+// isAudienceValid checks if a token is intended for an audience. Tokens
+// without an audience are only accepted if allowAudienceless is set.
+func isAudienceValid(token *auth.Token, audience string, allowAudienceless bool) bool {
+	if len(token.Audiences) == 0 {
+		return allowAudienceless
+	}
+	return token.HasAudience(audience)
+}
+
+// genAuthMethods returns the factors completed to obtain a token.
+// Refreshed tokens retain the factors of the original token.
+func genAuthMethods(conf *auth.TokenConfiguration) []string {
+	if len(conf.AuthMethods) == 0 && conf.RefreshableToken != nil {
+		return conf.RefreshableToken.AuthMethods
+	}
+
+	return conf.AuthMethods
+}
+
+// genAudiencesAndScopes returns the audiences and scopes requested for
+// a token. Refreshed tokens retain the audiences and scopes of the
+// original token unless new values are requested. Audiences and scopes
+// may only be requested by a ClientApplication they are granted to and
+// are checked again on refresh in case the grant was withdrawn.
+func (s *service) genAudiencesAndScopes(conf *auth.TokenConfiguration, app *auth.ClientApplication) ([]string, []string, error) {
+	audiences := conf.Audiences
+	scopes := conf.Scopes
+	if conf.RefreshableToken != nil {
+		if len(audiences) == 0 {
+			audiences = conf.RefreshableToken.Audiences
+		}
+		if len(scopes) == 0 {
+			scopes = conf.RefreshableToken.Scopes
+		}
+	}
+
+	for _, aud := range audiences {
+		if !s.allowedAudiences[aud] {
+			return nil, nil, auth.ErrBadRequest(fmt.Sprintf("audience %s is not supported", aud))
+		}
+		if app == nil || !app.AllowsAudience(aud) {
+			return nil, nil, auth.ErrForbidden(fmt.Sprintf("audience %s is not granted to the client", aud))
+		}
+	}
+
+	for _, scope := range scopes {
+		if !s.allowedScopes[scope] {
+			return nil, nil, auth.ErrBadRequest(fmt.Sprintf("scope %s is not supported", scope))
+		}
+		if app == nil || !app.AllowsScope(scope) {
+			return nil, nil, auth.ErrForbidden(fmt.Sprintf("scope %s is not granted to the client", scope))
+		}
+	}
+
+	return audiences, scopes, nil
+}
+
+// genClientApplicationID returns the ID of the ClientApplication a token
+// is issued to. Refreshed tokens must be requested by the same
+// ClientApplication as the original token.
+func (s *service) genClientApplicationID(conf *auth.TokenConfiguration, app *auth.ClientApplication) (string, error) {
+	var appID string
+	if app != nil {
+		appID = app.ID
+	}
+
+	if conf.RefreshableToken != nil && conf.RefreshableToken.ClientApplicationID != appID {
+		return "", auth.ErrInvalidToken("token was issued to another client application")
+	}
+
+	return appID, nil
+}
+
+// genContactClaim returns the claim of a User's email address or
+// phone number, which is omitted in ClaimsMinimal mode.
+func (s *service) genContactClaim(address string) string {
+	if s.claimsMode == ClaimsMinimal {
+		return ""
+	}
+	return address
+}
+
+// genExpiry returns the lifetime of a token and its refresh token,
+// applying overrides of the ClientApplication it is issued to and
+// the TTL requested for the token, which is also returned.
+func (s *service) genExpiry(conf *auth.TokenConfiguration, app *auth.ClientApplication) (time.Duration, time.Duration, time.Duration) {
+	tokenExpiry, refreshTokenExpiry := s.tokenExpiry, s.refreshTokenExpiry
+	if app != nil && app.TokenExpiry > 0 {
+		tokenExpiry = app.TokenExpiry
+	}
+	if app != nil && app.RefreshTokenExpiry > 0 {
+		refreshTokenExpiry = app.RefreshTokenExpiry
+	}
+
+	// TTLs may only shorten a session.
+	ttl := s.genTTL(conf)
+	if ttl <= 0 || ttl >= refreshTokenExpiry {
+		return tokenExpiry, refreshTokenExpiry, 0
+	}
+
+	if ttl < tokenExpiry {
+		tokenExpiry = ttl
+	}
+
+	return tokenExpiry, ttl, ttl
+}
+
+// genTTL returns the lifetime requested for a token, clamped to the
+// minimum TTL. Refreshed tokens may only shorten the TTL of the token
+// they are refreshed from.
+func (s *service) genTTL(conf *auth.TokenConfiguration) time.Duration {
+	ttl := conf.TTL
+	if conf.RefreshableToken != nil && conf.RefreshableToken.TTL > 0 {
+		previous := time.Duration(conf.RefreshableToken.TTL) * time.Second
+		if ttl <= 0 || ttl > previous {
+			ttl = previous
+		}
+	}
+
+	if ttl <= 0 {
+		return 0
+	}
+	if ttl < s.minTTL {
+		ttl = s.minTTL
+	}
+	return ttl.Truncate(time.Second)
+}
+
+// genFingerprint returns the fingerprint of the client a token is
+// issued to if tokens are bound to clients.
+func (s *service) genFingerprint(ctx context.Context) string {
+	if s.fingerprintMode == fingerprint.Off {
+		return ""
+	}
+
+	return fingerprint.FromContext(ctx)
 }
 
 func (s *service) genULID(conf *auth.TokenConfiguration) (string, error) {
@@ -370,7 +960,7 @@ func (s *service) genClientIDAndHash(conf *auth.TokenConfiguration) (string, str
 	return encodedID, clientIDHash, nil
 }
 
-func (s *service) genOTPAndHash(conf *auth.TokenConfiguration, user *auth.User) (string, string, error) {
+func (s *service) genOTPAndHash(ctx context.Context, conf *auth.TokenConfiguration, user *auth.User) (string, string, error) {
 	if conf.DeliveryMethod == "" {
 		return "", "", nil
 	}
@@ -403,11 +993,51 @@ func (s *service) genOTPAndHash(conf *auth.TokenConfiguration, user *auth.User)
 		return "", "", fmt.Errorf("failed to generate OTP code: %w", err)
 	}
 
-	return code, codeHash, nil
+	// Codes requested for an existing token, such as resends, are
+	// always delivered.
+	if s.codeReuseWindow <= 0 || conf.RefreshableToken != nil {
+		return code, codeHash, nil
+	}
+
+	return s.reusePendingCode(ctx, conf.DeliveryMethod, address, code, codeHash)
 }
 
-func (s *service) genRefreshTokenAndHash(conf *auth.TokenConfiguration) (string, string, error) {
-	if conf.RefreshableToken != nil {
+// reusePendingCode returns the hash of a code delivered to an address
+// within the code reuse window in place of a new code, such as when a
+// login is submitted twice, so only one code is delivered. The code is
+// omitted from the returned values as it must not be delivered again.
+func (s *service) reusePendingCode(ctx context.Context, method auth.DeliveryMethod, address, code, codeHash string) (string, string, error) {
+	key, err := PendingCodeKey(method, address)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot create pending code key: %w", err)
+	}
+
+	isNew, err := s.db.SetNX(ctx, key, codeHash, s.codeReuseWindow).Result()
+	if err != nil {
+		return "", "", fmt.Errorf("cannot store pending code: %w", err)
+	}
+	if isNew {
+		return code, codeHash, nil
+	}
+
+	pending, err := s.db.Get(ctx, key).Result()
+	if err == redislib.Nil {
+		return code, codeHash, nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("cannot lookup pending code: %w", err)
+	}
+
+	h, err := otp.FromOTPHash(pending)
+	if err != nil || s.clock.Now().Unix() >= h.ExpiresAt {
+		return code, codeHash, s.db.Set(ctx, key, codeHash, s.codeReuseWindow).Err()
+	}
+
+	return "", pending, nil
+}
+
+func (s *service) genRefreshTokenAndHash(ctx context.Context, conf *auth.TokenConfiguration, expiresIn time.Duration) (string, string, error) {
+	if conf.RefreshableToken != nil && conf.RotatedRefreshToken == "" {
 		return "", conf.RefreshableToken.RefreshTokenHash, nil
 	}
 
@@ -416,10 +1046,25 @@ func (s *service) genRefreshTokenAndHash(conf *auth.TokenConfiguration) (string,
 		return "", "", err
 	}
 
-	expiresAt := time.Now().Add(s.refreshTokenExpiry).Unix()
 	token := &RefreshToken{
 		Code:      code,
-		ExpiresAt: expiresAt,
+		ExpiresAt: s.clock.Now().Add(expiresIn).Unix(),
+	}
+
+	if conf.RefreshableToken != nil {
+		// Rotated refresh tokens keep the expiry and device binding
+		// of the refresh token they replace.
+		previous, err := s.rotateRefreshToken(ctx, conf)
+		if err != nil {
+			return "", "", err
+		}
+		token.ExpiresAt = previous.ExpiresAt
+		token.DeviceHash = previous.DeviceHash
+	} else if conf.DeviceID != "" {
+		token.DeviceHash, err = crypto.Hash(conf.DeviceID)
+		if err != nil {
+			return "", "", err
+		}
 	}
 
 	b, err := json.Marshal(token)
@@ -436,6 +1081,28 @@ func (s *service) genRefreshTokenAndHash(conf *auth.TokenConfiguration) (string,
 	return encodedToken, h, nil
 }
 
+// rotateRefreshToken marks a refresh token as used. Concurrent
+// rotations of the same refresh token fail.
+func (s *service) rotateRefreshToken(ctx context.Context, conf *auth.TokenConfiguration) (*RefreshToken, error) {
+	hash := conf.RefreshableToken.RefreshTokenHash
+	now := s.clock.Now()
+	previous, err := unpackRefreshToken(conf.RotatedRefreshToken, hash, now)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresIn := time.Unix(previous.ExpiresAt, 0).Sub(now)
+	ok, err := s.db.SetNX(ctx, RotationKey(hash), true, expiresIn).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot record refresh token rotation: %w", err)
+	}
+	if !ok {
+		return nil, auth.ErrInvalidToken("refresh token is already used")
+	}
+
+	return previous, nil
+}
+
 func (s *service) invalidateOldTokens(ctx context.Context, conf *auth.TokenConfiguration, token *auth.Token) error {
 	proceed := conf.RefreshableToken != nil &&
 		conf.DeliveryMethod != "" &&
@@ -445,15 +1112,15 @@ func (s *service) invalidateOldTokens(ctx context.Context, conf *auth.TokenConfi
 		return nil
 	}
 
-	key := invalidationKey(token.Id)
+	key := InvalidationKey(token.Id)
 	latestValidTimestamp := token.IssuedAt
+	expiresIn := time.Unix(token.ExpiresAt, 0).Sub(s.clock.Now())
 
-	return s.db.Set(ctx, key, latestValidTimestamp, s.tokenExpiry).Err()
+	return s.db.Set(ctx, key, latestValidTimestamp, expiresIn).Err()
 }
 
 func (s *service) checkRevocation(ctx context.Context, token *auth.Token) error {
-	key := revocationKey(token.Id)
-	err := s.db.Get(ctx, key).Err()
+	_, err := s.getRevocationState(ctx, RevocationKey(token.Id))
 	if err == nil {
 		return auth.ErrInvalidToken("token is revoked")
 	}
@@ -472,7 +1139,7 @@ func (s *service) checkInvalidation(ctx context.Context, token *auth.Token) erro
 		return nil
 	}
 
-	key := invalidationKey(token.Id)
+	key := InvalidationKey(token.Id)
 	ts, err := s.db.Get(ctx, key).Int64()
 
 	level.Info(s.logger).Log(
@@ -497,11 +1164,172 @@ func (s *service) checkInvalidation(ctx context.Context, token *auth.Token) erro
 	return fmt.Errorf("cannot lookup token invalidation history: %w", err)
 }
 
-func invalidationKey(tokenID string) string {
+// checkRotation rejects refresh tokens which were already rotated.
+// The token they were issued for is revoked as only a stolen copy
+// of the refresh token would be presented again.
+func (s *service) checkRotation(ctx context.Context, token *auth.Token) error {
+	err := s.db.Get(ctx, RotationKey(token.RefreshTokenHash)).Err()
+	if err == redislib.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot lookup refresh token rotation: %w", err)
+	}
+
+	level.Warn(s.logger).Log(
+		"source", "TokenService.checkRotation",
+		"message", "rotated refresh token reused",
+		"token_id", token.Id,
+		"user_id", token.UserID,
+	)
+
+	if err = s.Revoke(ctx, token.Id); err != nil {
+		return fmt.Errorf("cannot revoke token after refresh token reuse: %w", err)
+	}
+
+	return auth.ErrInvalidToken("refresh token is already used")
+}
+
+// checkFingerprint compares the fingerprint a token was issued to with
+// the client presenting it. Tokens issued without a fingerprint, or
+// presented outside of an HTTP request, are not checked.
+func (s *service) checkFingerprint(ctx context.Context, token *auth.Token) error {
+	if s.fingerprintMode == fingerprint.Off || token.Fingerprint == "" {
+		return nil
+	}
+
+	fp := fingerprint.FromContext(ctx)
+	if fp == "" || fp == token.Fingerprint {
+		return nil
+	}
+
+	level.Warn(s.logger).Log(
+		"source", "TokenService.checkFingerprint",
+		"message", "token presented from another client",
+		"token_id", token.Id,
+		"user_id", token.UserID,
+		"mode", s.fingerprintMode,
+	)
+
+	if s.fingerprintMode == fingerprint.Strict {
+		return auth.ErrInvalidToken("token source is invalid")
+	}
+
+	return nil
+}
+
+// checkActivity invalidates tokens which were not used within the idle
+// timeout and records the activity of the remainder. Tokens issued
+// before activity was tracked are considered last active when issued.
+func (s *service) checkActivity(ctx context.Context, token *auth.Token) error {
+	if s.idleTimeout <= 0 {
+		return nil
+	}
+
+	lastActive, err := s.db.Get(ctx, ActivityKey(token.Id)).Int64()
+	if err == redislib.Nil {
+		lastActive = token.IssuedAt
+	} else if err != nil {
+		return fmt.Errorf("cannot lookup token activity: %w", err)
+	}
+
+	now := s.clock.Now()
+	idle := now.Sub(time.Unix(lastActive, 0))
+	if idle >= s.idleTimeout {
+		return auth.ErrInvalidToken("session is idle")
+	}
+	if idle < ActivityInterval {
+		return nil
+	}
+
+	return s.recordActivity(ctx, token.Id, now)
+}
+
+// recordActivity records the last time a token was used. The record
+// expires along with the session once the idle timeout passes.
+func (s *service) recordActivity(ctx context.Context, tokenID string, at time.Time) error {
+	if s.idleTimeout <= 0 {
+		return nil
+	}
+
+	err := s.db.Set(ctx, ActivityKey(tokenID), at.Unix(), s.idleTimeout).Err()
+	if err != nil {
+		return fmt.Errorf("cannot record token activity: %w", err)
+	}
+
+	return nil
+}
+
+func (s *service) checkGeneration(ctx context.Context, token *auth.Token) error {
+	var generation int64
+	value, err := s.getRevocationState(ctx, GenerationKey(token.UserID))
+	if err == nil {
+		generation, err = strconv.ParseInt(value, 10, 64)
+	}
+	if err != nil && err != redislib.Nil {
+		return fmt.Errorf("cannot lookup token generation: %w", err)
+	}
+
+	if token.Generation < generation {
+		return auth.ErrInvalidToken("token is revoked")
+	}
+
+	return nil
+}
+
+// generation returns the User's current token generation. Users
+// who have never revoked all tokens are on generation 0. It is read
+// from Redis rather than the revocation cache so new tokens are never
+// issued under a stale generation.
+func (s *service) generation(ctx context.Context, userID string) (int64, error) {
+	generation, err := s.db.Get(ctx, GenerationKey(userID)).Int64()
+	if err == redislib.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("cannot lookup token generation: %w", err)
+	}
+
+	return generation, nil
+}
+
+// PendingCodeKey returns the key used to store the hash of the
+// latest code delivered to an address for a new token.
+func PendingCodeKey(method auth.DeliveryMethod, address string) (string, error) {
+	h, err := crypto.Hash(fmt.Sprintf("%s:%s", method, address))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s_pending_code", h), nil
+}
+
+// InvalidationKey returns the key used to store the timestamp
+// before which tokens for a token ID are considered invalid.
+func InvalidationKey(tokenID string) string {
 	return fmt.Sprintf("%s_invalid_after", tokenID)
 }
 
-func revocationKey(tokenID string) string {
+// GenerationKey returns the key used to store a User's token
+// generation. It is stored without expiry as it must outlive
+// every token issued to the User.
+func GenerationKey(userID string) string {
+	return fmt.Sprintf("%s_token_generation", userID)
+}
+
+// ActivityKey returns the key used to store the last time a
+// token ID was used.
+func ActivityKey(tokenID string) string {
+	return fmt.Sprintf("%s_last_active", tokenID)
+}
+
+// RotationKey returns the key used to flag a rotated refresh
+// token, by its hash, as used.
+func RotationKey(refreshTokenHash string) string {
+	return fmt.Sprintf("%s_is_rotated", refreshTokenHash)
+}
+
+// RevocationKey returns the key used to flag a token ID as revoked.
+func RevocationKey(tokenID string) string {
 	return fmt.Sprintf("%s_is_revoked", tokenID)
 }
 
@@ -518,7 +1346,7 @@ func isHashValid(str, hash string) bool {
 	return true
 }
 
-func unpackRefreshToken(refreshToken, refreshTokenHash string) (*RefreshToken, error) {
+func unpackRefreshToken(refreshToken, refreshTokenHash string, now time.Time) (*RefreshToken, error) {
 	decoded, err := base64.RawURLEncoding.DecodeString(refreshToken)
 	if err != nil {
 		return nil, fmt.Errorf("cannot decode refresh token: %w", err)
@@ -534,10 +1362,37 @@ func unpackRefreshToken(refreshToken, refreshTokenHash string) (*RefreshToken, e
 		return nil, fmt.Errorf("invalid refresh token format: %w", err)
 	}
 
-	now := time.Now().Unix()
-	if now >= t.ExpiresAt {
+	if now.Unix() >= t.ExpiresAt {
 		return nil, auth.ErrInvalidToken("refresh token is expired")
 	}
 
 	return &t, nil
 }
+
+// TimeClaims are the time based claims of a token, implemented by
+// both jwt.MapClaims and *jwt.StandardClaims.
+type TimeClaims interface {
+	VerifyExpiresAt(cmp int64, req bool) bool
+	VerifyIssuedAt(cmp int64, req bool) bool
+	VerifyNotBefore(cmp int64, req bool) bool
+}
+
+// ValidateClaims verifies the time based claims of a token at
+// the given time, mirroring jwt.MapClaims.Valid. Leeway tolerates
+// skew between our clock and the clock of the token's issuer and
+// is ignored if negative.
+func ValidateClaims(claims TimeClaims, now time.Time, leeway time.Duration) error {
+	if leeway < 0 {
+		leeway = 0
+	}
+	if !claims.VerifyExpiresAt(now.Add(-leeway).Unix(), false) {
+		return fmt.Errorf("token is expired")
+	}
+	if !claims.VerifyIssuedAt(now.Add(leeway).Unix(), false) {
+		return fmt.Errorf("token used before issued")
+	}
+	if !claims.VerifyNotBefore(now.Add(leeway).Unix(), false) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	return nil
+}
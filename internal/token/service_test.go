@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
@@ -15,7 +16,13 @@ import (
 	"github.com/oklog/ulid/v2"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/clientapp"
+	"github.com/fmitra/authenticator/internal/clock"
+	"github.com/fmitra/authenticator/internal/consent"
 	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/fingerprint"
+	"github.com/fmitra/authenticator/internal/jwe"
+	"github.com/fmitra/authenticator/internal/memstore"
 	"github.com/fmitra/authenticator/internal/otp"
 	"github.com/fmitra/authenticator/internal/postgres"
 	"github.com/fmitra/authenticator/internal/test"
@@ -122,6 +129,329 @@ func TestTokenSvc_CreateAuthorized(t *testing.T) {
 	}
 }
 
+func TestTokenSvc_CreateOrganizationClaims(t *testing.T) {
+	db, err := test.NewRedisDB()
+	if err != nil {
+		t.Fatal("faliled to create test database:", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	user := &auth.User{ID: "user_id"}
+	repoMngr := &test.RepositoryManager{
+		MembershipFn: func() auth.MembershipRepository {
+			return &test.MembershipRepository{
+				ByUserIDFn: func() ([]*auth.Membership, error) {
+					return []*auth.Membership{
+						{OrganizationID: "org_id", UserID: "user_id", Role: auth.RoleAdmin},
+					}, nil
+				},
+			}
+		},
+	}
+	tokenSvc := NewTestTokenSvc(db, repoMngr)
+
+	token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+
+	expected := []auth.OrganizationClaim{{ID: "org_id", Role: auth.RoleAdmin}}
+	if !cmp.Equal(token.Organizations, expected) {
+		t.Error("organization claims do not match", cmp.Diff(
+			token.Organizations, expected,
+		))
+	}
+
+	token, err = tokenSvc.Create(ctx, user, auth.JWTPreAuthorized)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+
+	if len(token.Organizations) != 0 {
+		t.Error("organization claims should not be set on pre-authorized tokens")
+	}
+}
+
+func TestTokenSvc_CreateConsentRequired(t *testing.T) {
+	db, err := test.NewRedisDB()
+	if err != nil {
+		t.Fatal("faliled to create test database:", err)
+	}
+	defer db.Close()
+
+	tt := []struct {
+		name            string
+		state           auth.TokenState
+		consents        []*auth.Consent
+		consentRequired bool
+	}{
+		{
+			name:            "Authorized token without consent",
+			state:           auth.JWTAuthorized,
+			consentRequired: true,
+		},
+		{
+			name:  "Authorized token with outdated consent",
+			state: auth.JWTAuthorized,
+			consents: []*auth.Consent{
+				{Policy: "tos", Version: "1"},
+			},
+			consentRequired: true,
+		},
+		{
+			name:  "Authorized token with latest consent",
+			state: auth.JWTAuthorized,
+			consents: []*auth.Consent{
+				{Policy: "tos", Version: "2"},
+			},
+			consentRequired: false,
+		},
+		{
+			name:            "Pre-authorized token without consent",
+			state:           auth.JWTPreAuthorized,
+			consentRequired: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			user := &auth.User{ID: "user_id", IsEmailOTPAllowed: true}
+			repoMngr := &test.RepositoryManager{
+				ConsentFn: func() auth.ConsentRepository {
+					return &test.ConsentRepository{
+						ByUserIDFn: func() ([]*auth.Consent, error) {
+							return tc.consents, nil
+						},
+					}
+				},
+			}
+			tokenSvc := NewService(
+				WithDB(db),
+				WithSecret("my-signing-secret"),
+				WithOTP(otp.NewOTP()),
+				WithRepoManager(repoMngr),
+				WithRequiredConsent(consent.Policies{"tos": "2"}),
+			)
+
+			token, err := tokenSvc.Create(ctx, user, tc.state)
+			if err != nil {
+				t.Fatal("failed to create token:", err)
+			}
+
+			if token.ConsentRequired != tc.consentRequired {
+				t.Errorf("incorrect consent requirement, want %v got %v",
+					tc.consentRequired, token.ConsentRequired)
+			}
+		})
+	}
+}
+
+func TestTokenSvc_CreateEnrollmentRequired(t *testing.T) {
+	db, err := test.NewRedisDB()
+	if err != nil {
+		t.Fatal("faliled to create test database:", err)
+	}
+	defer db.Close()
+
+	tt := []struct {
+		name               string
+		state              auth.TokenState
+		user               auth.User
+		enrollmentRequired bool
+	}{
+		{
+			name:               "Authorized token with OTP only",
+			state:              auth.JWTAuthorized,
+			user:               auth.User{ID: "user_id", IsEmailOTPAllowed: true},
+			enrollmentRequired: true,
+		},
+		{
+			name:               "Authorized token with TOTP",
+			state:              auth.JWTAuthorized,
+			user:               auth.User{ID: "user_id", IsTOTPAllowed: true},
+			enrollmentRequired: false,
+		},
+		{
+			name:               "Authorized token with device",
+			state:              auth.JWTAuthorized,
+			user:               auth.User{ID: "user_id", IsDeviceAllowed: true},
+			enrollmentRequired: false,
+		},
+		{
+			name:               "Pre-authorized token with OTP only",
+			state:              auth.JWTPreAuthorized,
+			user:               auth.User{ID: "user_id", IsEmailOTPAllowed: true},
+			enrollmentRequired: false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			tokenSvc := NewService(
+				WithDB(db),
+				WithSecret("my-signing-secret"),
+				WithOTP(otp.NewOTP()),
+				WithRequiredEnrollment(true),
+			)
+
+			token, err := tokenSvc.Create(ctx, &tc.user, tc.state)
+			if err != nil {
+				t.Fatal("failed to create token:", err)
+			}
+
+			if token.EnrollmentRequired != tc.enrollmentRequired {
+				t.Errorf("incorrect enrollment requirement, want %v got %v",
+					tc.enrollmentRequired, token.EnrollmentRequired)
+			}
+		})
+	}
+}
+
+func TestTokenSvc_CreateHooks(t *testing.T) {
+	db, err := test.NewRedisDB()
+	if err != nil {
+		t.Fatal("faliled to create test database:", err)
+	}
+	defer db.Close()
+
+	tt := []struct {
+		name               string
+		beforeTokenIssueFn func(token *auth.Token) error
+		hasErr             bool
+		tenant             interface{}
+	}{
+		{
+			name: "Hook adding claims",
+			beforeTokenIssueFn: func(token *auth.Token) error {
+				token.Custom = map[string]interface{}{"tenant": "acme"}
+				return nil
+			},
+			tenant: "acme",
+		},
+		{
+			name: "Hook rejecting token",
+			beforeTokenIssueFn: func(token *auth.Token) error {
+				return auth.ErrForbidden("account is suspended")
+			},
+			hasErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			hooks := &test.Hooks{BeforeTokenIssueFn: tc.beforeTokenIssueFn}
+			tokenSvc := NewService(
+				WithDB(db),
+				WithSecret("my-signing-secret"),
+				WithOTP(otp.NewOTP()),
+				WithHooks(hooks),
+			)
+
+			user := &auth.User{ID: "user_id", IsEmailOTPAllowed: true}
+			token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+			if tc.hasErr {
+				if err == nil {
+					t.Error("expected hook error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("failed to create token:", err)
+			}
+
+			if hooks.Calls.BeforeTokenIssue != 1 {
+				t.Errorf("incorrect Hooks.BeforeTokenIssue() call count, want 1 got %v",
+					hooks.Calls.BeforeTokenIssue)
+			}
+			if token.Custom["tenant"] != tc.tenant {
+				t.Errorf("incorrect custom claim, want %v got %v", tc.tenant, token.Custom["tenant"])
+			}
+		})
+	}
+}
+
+func TestTokenSvc_CreateEnrollmentGracePeriod(t *testing.T) {
+	db, err := test.NewRedisDB()
+	if err != nil {
+		t.Fatal("faliled to create test database:", err)
+	}
+	defer db.Close()
+
+	tt := []struct {
+		name               string
+		deadline           time.Time
+		enrollmentRequired bool
+		hasDeadline        bool
+	}{
+		{
+			name:               "First authorized token",
+			enrollmentRequired: false,
+			hasDeadline:        true,
+		},
+		{
+			name:               "Deadline not yet passed",
+			deadline:           time.Now().Add(time.Hour),
+			enrollmentRequired: false,
+			hasDeadline:        true,
+		},
+		{
+			name:               "Deadline passed",
+			deadline:           time.Now().Add(-time.Hour),
+			enrollmentRequired: true,
+			hasDeadline:        false,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			user := &auth.User{ID: "user_id", IsEmailOTPAllowed: true}
+			enrollmentRepo := &test.TFAEnrollmentRepository{
+				CreateFn: func(e *auth.TFAEnrollment) error {
+					if !tc.deadline.IsZero() {
+						e.Deadline = tc.deadline
+					}
+					return nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				TFAEnrollmentFn: func() auth.TFAEnrollmentRepository {
+					return enrollmentRepo
+				},
+			}
+			tokenSvc := NewService(
+				WithDB(db),
+				WithSecret("my-signing-secret"),
+				WithOTP(otp.NewOTP()),
+				WithRepoManager(repoMngr),
+				WithRequiredEnrollment(true),
+				WithEnrollmentGracePeriod(time.Hour*24),
+			)
+
+			token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+			if err != nil {
+				t.Fatal("failed to create token:", err)
+			}
+
+			if token.EnrollmentRequired != tc.enrollmentRequired {
+				t.Errorf("incorrect enrollment requirement, want %v got %v",
+					tc.enrollmentRequired, token.EnrollmentRequired)
+			}
+			if (token.EnrollmentDeadline != 0) != tc.hasDeadline {
+				t.Errorf("incorrect enrollment deadline %v", token.EnrollmentDeadline)
+			}
+			if enrollmentRepo.Calls.Create != 1 {
+				t.Errorf("incorrect TFAEnrollment.Create() call count, want 1 got %v",
+					enrollmentRepo.Calls.Create)
+			}
+		})
+	}
+}
+
 func TestTokenSvc_CreatePreAuthorized(t *testing.T) {
 	db, err := test.NewRedisDB()
 	if err != nil {
@@ -150,6 +480,8 @@ func TestTokenSvc_CreateWithTFAOptions(t *testing.T) {
 		name       string
 		user       auth.User
 		tfaOptions []auth.TFAOptions
+		defaultTFA auth.TFAOptions
+		options    []auth.TokenOption
 	}{
 		{
 			name: "Support Email OTP delivery",
@@ -191,6 +523,22 @@ func TestTokenSvc_CreateWithTFAOptions(t *testing.T) {
 				auth.FIDODevice,
 			},
 		},
+		{
+			name: "Restricted options",
+			user: auth.User{
+				ID:                "user_id",
+				IsEmailOTPAllowed: true,
+				IsPhoneOTPAllowed: true,
+				IsDeviceAllowed:   true,
+			},
+			tfaOptions: []auth.TFAOptions{
+				auth.OTPEmail,
+			},
+			defaultTFA: auth.OTPEmail,
+			options: []auth.TokenOption{
+				WithTFAOptions(auth.OTPEmail, auth.TOTP),
+			},
+		},
 	}
 
 	db, err := test.NewRedisDB()
@@ -204,7 +552,7 @@ func TestTokenSvc_CreateWithTFAOptions(t *testing.T) {
 			ctx := context.Background()
 			tokenSvc := NewTestTokenSvc(db, &test.RepositoryManager{})
 
-			token, err := tokenSvc.Create(ctx, &tc.user, auth.JWTAuthorized)
+			token, err := tokenSvc.Create(ctx, &tc.user, auth.JWTAuthorized, tc.options...)
 			if err != nil {
 				t.Fatal("failed to create token", err)
 			}
@@ -214,6 +562,9 @@ func TestTokenSvc_CreateWithTFAOptions(t *testing.T) {
 					token.TFAOptions, tc.tfaOptions,
 				))
 			}
+			if tc.defaultTFA != "" && token.DefaultTFA != tc.defaultTFA {
+				t.Errorf("incorrect default TFA, want %s got %s", tc.defaultTFA, token.DefaultTFA)
+			}
 		})
 	}
 }
@@ -409,10 +760,12 @@ func TestTokenSvc_InvalidateAfterExpiry(t *testing.T) {
 
 	ctx := context.Background()
 	user := &auth.User{ID: "user_id"}
+	c := clock.NewFake(time.Now())
 
 	tokenSvc := NewService(
 		WithDB(db),
-		WithTokenExpiry(time.Millisecond),
+		WithClock(c),
+		WithTokenExpiry(time.Minute),
 		WithSecret("my-signing-secret"),
 		WithIssuer("authenticator"),
 		WithOTP(otp.NewOTP()),
@@ -434,14 +787,14 @@ func TestTokenSvc_InvalidateAfterExpiry(t *testing.T) {
 		t.Error("failed to validate token:", err)
 	}
 
-	time.Sleep(time.Second)
+	c.Advance(time.Minute + time.Second)
 	_, err = tokenSvc.Validate(ctx, jwtToken, token.ClientID)
 	if err == nil {
 		t.Error("expired token should return error")
 	}
 }
 
-func TestTokenSvc_InvalidateNotBearer(t *testing.T) {
+func TestTokenSvc_InvalidateAfterRevokeAll(t *testing.T) {
 	db, err := test.NewRedisDB()
 	if err != nil {
 		t.Fatal("faliled to create test database:", err)
@@ -449,78 +802,92 @@ func TestTokenSvc_InvalidateNotBearer(t *testing.T) {
 	defer db.Close()
 
 	ctx := context.Background()
+	user := &auth.User{ID: "user_id"}
 	tokenSvc := NewTestTokenSvc(db, &test.RepositoryManager{})
 
-	_, err = tokenSvc.Validate(ctx, "jwt-token", "client-id")
-	domainErr := auth.DomainError(err)
-	if domainErr == nil {
-		t.Fatal("expected domain error")
+	signToken := func() (*auth.Token, string) {
+		token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+		if err != nil {
+			t.Fatal("failed to create token:", err)
+		}
+		jwtToken, err := tokenSvc.Sign(ctx, token)
+		if err != nil {
+			t.Fatal("failed to sign token:", err)
+		}
+		return token, fmt.Sprintf("Bearer %s", jwtToken)
 	}
 
-	if domainErr.Code() != auth.EInvalidToken {
-		t.Errorf("incorrect error code, want %s got %s",
-			auth.EInvalidToken, domainErr.Code())
+	oldToken, oldJWTToken := signToken()
+	if err = tokenSvc.RevokeAll(ctx, user.ID); err != nil {
+		t.Fatal("failed to revoke tokens:", err)
 	}
 
-	if domainErr.Message() != "bearer token expected" {
-		t.Errorf("incorrect error code, want %s got %s",
-			"bearer token expected", domainErr.Message())
+	_, err = tokenSvc.Validate(ctx, oldJWTToken, oldToken.ClientID)
+	if auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code, want %s got %v", auth.EInvalidToken, err)
+	}
+
+	newToken, newJWTToken := signToken()
+	if _, err = tokenSvc.Validate(ctx, newJWTToken, newToken.ClientID); err != nil {
+		t.Error("token issued after revocation should be valid:", err)
 	}
 }
 
-func TestTokenSvc_InvalidateNoUserID(t *testing.T) {
+func TestTokenSvc_AudiencesAndScopes(t *testing.T) {
 	db, err := test.NewRedisDB()
 	if err != nil {
 		t.Fatal("faliled to create test database:", err)
 	}
 	defer db.Close()
 
-	ctx := context.Background()
-	user := &auth.User{}
-
+	app := &auth.ClientApplication{
+		ID:        "billing-dashboard",
+		Audiences: []string{"billing"},
+		Scopes:    []string{"read"},
+	}
+	ctx := clientapp.NewContext(context.Background(), app)
+	user := &auth.User{ID: "user_id"}
 	tokenSvc := NewService(
 		WithDB(db),
-		WithTokenExpiry(time.Millisecond),
 		WithSecret("my-signing-secret"),
-		WithIssuer("authenticator"),
 		WithOTP(otp.NewOTP()),
+		WithRepoManager(&test.RepositoryManager{}),
+		WithAllowedAudiences([]string{"billing", "payments"}),
+		WithAllowedScopes([]string{"read", "admin"}),
 	)
 
-	token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
-	if err != nil {
-		t.Fatal("failed to create token:", err)
+	_, err = tokenSvc.Create(ctx, user, auth.JWTAuthorized, WithAudiences("unknown"))
+	if auth.ErrorCode(err) != auth.EBadRequest {
+		t.Errorf("incorrect error code, want %s got %v", auth.EBadRequest, err)
 	}
 
-	jwtToken, err := tokenSvc.Sign(ctx, token)
-	if err != nil {
-		t.Fatal("failed to sign token:", err)
+	_, err = tokenSvc.Create(ctx, user, auth.JWTAuthorized, WithScopes("write"))
+	if auth.ErrorCode(err) != auth.EBadRequest {
+		t.Errorf("incorrect error code, want %s got %v", auth.EBadRequest, err)
 	}
 
-	_, err = tokenSvc.Validate(ctx, jwtToken, token.ClientID)
-	if err == nil {
-		t.Error("token with no user ID should return error, not nil")
+	_, err = tokenSvc.Create(ctx, user, auth.JWTAuthorized, WithAudiences("payments"))
+	if auth.ErrorCode(err) != auth.EForbidden {
+		t.Errorf("incorrect error code, want %s got %v", auth.EForbidden, err)
 	}
-}
 
-func TestTokenSvc_InvalidateClientIDMismatch(t *testing.T) {
-	db, err := test.NewRedisDB()
-	if err != nil {
-		t.Fatal("failed to create test database:", err)
+	_, err = tokenSvc.Create(ctx, user, auth.JWTAuthorized, WithScopes("admin"))
+	if auth.ErrorCode(err) != auth.EForbidden {
+		t.Errorf("incorrect error code, want %s got %v", auth.EForbidden, err)
 	}
-	defer db.Close()
 
-	ctx := context.Background()
-	user := &auth.User{ID: "user_id"}
+	_, err = tokenSvc.Create(context.Background(), user, auth.JWTAuthorized, WithScopes("read"))
+	if auth.ErrorCode(err) != auth.EForbidden {
+		t.Errorf("incorrect error code, want %s got %v", auth.EForbidden, err)
+	}
 
-	tokenSvc := NewService(
-		WithDB(db),
-		WithTokenExpiry(time.Millisecond),
-		WithSecret("my-signing-secret"),
-		WithIssuer("authenticator"),
-		WithOTP(otp.NewOTP()),
+	token, err := tokenSvc.Create(
+		ctx,
+		user,
+		auth.JWTAuthorized,
+		WithAudiences("billing"),
+		WithScopes("read"),
 	)
-
-	token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
 	if err != nil {
 		t.Fatal("failed to create token:", err)
 	}
@@ -529,49 +896,459 @@ func TestTokenSvc_InvalidateClientIDMismatch(t *testing.T) {
 	if err != nil {
 		t.Fatal("failed to sign token:", err)
 	}
-
 	jwtToken = fmt.Sprintf("Bearer %s", jwtToken)
-	_, err = tokenSvc.Validate(ctx, jwtToken, token.ClientID)
-	if err != nil {
-		t.Error("failed to validate token:", err)
-	}
-
-	_, err = tokenSvc.Validate(ctx, jwtToken, base64.RawURLEncoding.EncodeToString([]byte("bad-client-id")))
-	domainErr := auth.DomainError(err)
-	if domainErr == nil {
-		t.Fatal("expected domain error")
-	}
-
-	if domainErr.Code() != auth.EInvalidToken {
-		t.Errorf("incorrect error code, want %s got %s",
-			auth.EInvalidToken, domainErr.Code())
-	}
-}
 
-func TestTokenSvc_Refreshable(t *testing.T) {
 	tt := []struct {
-		name               string
-		errCode            auth.ErrCode
-		refreshTokenExpiry time.Duration
-		isRevoked          bool
+		name    string
+		options []auth.ValidateOption
+		errCode auth.ErrCode
 	}{
 		{
-			name:               "Validates refreshable token",
-			refreshTokenExpiry: time.Minute * 2,
-			errCode:            auth.ErrCode(""),
-			isRevoked:          false,
+			name: "No requirements",
 		},
 		{
-			name:               "Invalidates expired refreshable token",
-			errCode:            auth.EInvalidToken,
-			refreshTokenExpiry: time.Millisecond,
-			isRevoked:          false,
+			name:    "Expected audience",
+			options: []auth.ValidateOption{ExpectAudience("billing"), RequireScopes("read")},
 		},
 		{
-			name:               "Invalidates revoked refreshable token",
-			errCode:            auth.EInvalidToken,
-			refreshTokenExpiry: time.Minute * 2,
-			isRevoked:          true,
+			name:    "Unexpected audience",
+			options: []auth.ValidateOption{ExpectAudience("payments")},
+			errCode: auth.EInvalidToken,
+		},
+		{
+			name:    "Missing scope",
+			options: []auth.ValidateOption{RequireScopes("write")},
+			errCode: auth.EForbidden,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tokenSvc.Validate(ctx, jwtToken, token.ClientID, tc.options...)
+			if auth.ErrorCode(err) != tc.errCode {
+				t.Errorf("incorrect error code, want %s got %v", tc.errCode, err)
+			}
+		})
+	}
+
+	unbound, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	unboundJWTToken, err := tokenSvc.Sign(ctx, unbound)
+	if err != nil {
+		t.Fatal("failed to sign token:", err)
+	}
+	unboundJWTToken = fmt.Sprintf("Bearer %s", unboundJWTToken)
+
+	_, err = tokenSvc.Validate(ctx, unboundJWTToken, unbound.ClientID, ExpectAudience("billing"))
+	if auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code for token without audience, want %s got %v", auth.EInvalidToken, err)
+	}
+
+	_, err = tokenSvc.Validate(ctx, unboundJWTToken, unbound.ClientID, ExpectAudience("billing"), AllowAudienceless())
+	if err != nil {
+		t.Error("token without audience should be accepted when allowed:", err)
+	}
+
+	refreshed, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized, WithRefreshableToken(token))
+	if err != nil {
+		t.Fatal("failed to refresh token:", err)
+	}
+	if !refreshed.HasAudience("billing") || refreshed.HasAudience("payments") || !refreshed.HasScopes("read") {
+		t.Errorf("refreshed token should retain audiences and scopes, got %v %v",
+			refreshed.Audiences, refreshed.Scopes)
+	}
+}
+
+func TestTokenSvc_ClientApplication(t *testing.T) {
+	db, err := test.NewRedisDB()
+	if err != nil {
+		t.Fatal("faliled to create test database:", err)
+	}
+	defer db.Close()
+
+	user := &auth.User{ID: "user_id"}
+	tokenSvc := NewTestTokenSvc(db, &test.RepositoryManager{})
+	app := &auth.ClientApplication{
+		ID:                 "mobile",
+		TokenExpiry:        time.Hour,
+		RefreshTokenExpiry: time.Hour * 24 * 90,
+	}
+	ctx := clientapp.NewContext(context.Background(), app)
+
+	token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	if token.ClientApplicationID != app.ID {
+		t.Errorf("incorrect client application ID, want %s got %s", app.ID, token.ClientApplicationID)
+	}
+
+	expiry := time.Now().Add(app.TokenExpiry).Unix()
+	if token.ExpiresAt < expiry-1 || token.ExpiresAt > expiry {
+		t.Errorf("incorrect token expiry, want %v got %v", expiry, token.ExpiresAt)
+	}
+
+	refreshExpiry := time.Now().Add(app.RefreshTokenExpiry)
+	refreshableTill := tokenSvc.RefreshableTill(ctx, token, token.RefreshToken)
+	if refreshableTill.Before(refreshExpiry.Add(-time.Second)) || refreshableTill.After(refreshExpiry) {
+		t.Errorf("incorrect refresh token expiry, want %v got %v", refreshExpiry, refreshableTill)
+	}
+
+	_, err = tokenSvc.Create(context.Background(), user, auth.JWTAuthorized, WithRefreshableToken(token))
+	if auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code, want %s got %v", auth.EInvalidToken, err)
+	}
+
+	refreshed, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized, WithRefreshableToken(token))
+	if err != nil {
+		t.Fatal("failed to refresh token:", err)
+	}
+	if refreshed.ClientApplicationID != app.ID {
+		t.Errorf("incorrect client application ID, want %s got %s", app.ID, refreshed.ClientApplicationID)
+	}
+}
+
+func TestTokenSvc_RefreshTokenRotation(t *testing.T) {
+	db, err := test.NewRedisDB()
+	if err != nil {
+		t.Fatal("faliled to create test database:", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	user := &auth.User{ID: "user_id"}
+	repoMngr := &test.RepositoryManager{
+		WithAtomicFn: func() (interface{}, error) {
+			return &auth.LoginHistory{}, nil
+		},
+	}
+	tokenSvc := NewTestTokenSvc(db, repoMngr)
+
+	token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized, WithDeviceBinding("device-a"))
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+
+	err = tokenSvc.Refreshable(ctx, token, token.RefreshToken)
+	if auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code without device, want %s got %v", auth.EInvalidToken, err)
+	}
+	err = tokenSvc.Refreshable(ctx, token, token.RefreshToken, ExpectDevice("device-b"))
+	if auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code with another device, want %s got %v", auth.EInvalidToken, err)
+	}
+	if err = tokenSvc.Refreshable(ctx, token, token.RefreshToken, ExpectDevice("device-a")); err != nil {
+		t.Fatal("expected refresh token to be refreshable:", err)
+	}
+
+	rotated, err := tokenSvc.Create(
+		ctx,
+		user,
+		auth.JWTAuthorized,
+		WithRefreshableToken(token),
+		WithRefreshTokenRotation(token.RefreshToken),
+	)
+	if err != nil {
+		t.Fatal("failed to rotate refresh token:", err)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshTokenHash == token.RefreshTokenHash {
+		t.Error("expected a new refresh token")
+	}
+	if rotated.Id != token.Id {
+		t.Errorf("incorrect token ID, want %s got %s", token.Id, rotated.Id)
+	}
+
+	originalTill := tokenSvc.RefreshableTill(ctx, token, token.RefreshToken)
+	rotatedTill := tokenSvc.RefreshableTill(ctx, rotated, rotated.RefreshToken)
+	if !originalTill.Equal(rotatedTill) {
+		t.Errorf("incorrect refresh token expiry, want %v got %v", originalTill, rotatedTill)
+	}
+	if err = tokenSvc.Refreshable(ctx, rotated, rotated.RefreshToken, ExpectDevice("device-a")); err != nil {
+		t.Error("expected rotated refresh token to be refreshable:", err)
+	}
+
+	_, err = tokenSvc.Create(
+		ctx,
+		user,
+		auth.JWTAuthorized,
+		WithRefreshableToken(token),
+		WithRefreshTokenRotation(token.RefreshToken),
+	)
+	if auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code rotating twice, want %s got %v", auth.EInvalidToken, err)
+	}
+
+	err = tokenSvc.Refreshable(ctx, token, token.RefreshToken, ExpectDevice("device-a"))
+	if auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code reusing refresh token, want %s got %v", auth.EInvalidToken, err)
+	}
+	if repoMngr.Calls.WithAtomic != 1 {
+		t.Errorf("expected token to be revoked after refresh token reuse, got %v revocations",
+			repoMngr.Calls.WithAtomic)
+	}
+}
+
+func TestTokenSvc_FingerprintBinding(t *testing.T) {
+	tt := []struct {
+		name    string
+		mode    fingerprint.Mode
+		errCode auth.ErrCode
+		isBound bool
+	}{
+		{
+			name:    "Disabled binding",
+			mode:    fingerprint.Off,
+			errCode: auth.ErrCode(""),
+		},
+		{
+			name:    "Logged mismatch",
+			mode:    fingerprint.Log,
+			errCode: auth.ErrCode(""),
+			isBound: true,
+		},
+		{
+			name:    "Rejected mismatch",
+			mode:    fingerprint.Strict,
+			errCode: auth.EInvalidToken,
+			isBound: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := test.NewRedisDB()
+			if err != nil {
+				t.Fatal("faliled to create test database:", err)
+			}
+			defer db.Close()
+
+			tokenSvc := NewService(
+				WithLogger(log.NewNopLogger()),
+				WithDB(db),
+				WithSecret("my-signing-secret"),
+				WithRepoManager(&test.RepositoryManager{}),
+				WithFingerprintBinding(tc.mode),
+			)
+			user := &auth.User{ID: "user_id"}
+			ctx := fingerprint.NewContext(context.Background(), "client-a")
+
+			token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+			if err != nil {
+				t.Fatal("failed to create token:", err)
+			}
+			if isBound := token.Fingerprint != ""; isBound != tc.isBound {
+				t.Errorf("incorrect fingerprint binding, want %v got %v", tc.isBound, isBound)
+			}
+
+			signed, err := tokenSvc.Sign(ctx, token)
+			if err != nil {
+				t.Fatal("failed to sign token:", err)
+			}
+
+			_, err = tokenSvc.Validate(ctx, "Bearer "+signed, token.ClientID)
+			if err != nil {
+				t.Error("expected token to be valid from the same client:", err)
+			}
+
+			otherCtx := fingerprint.NewContext(context.Background(), "client-b")
+			_, err = tokenSvc.Validate(otherCtx, "Bearer "+signed, token.ClientID)
+			if auth.ErrorCode(err) != tc.errCode {
+				t.Errorf("incorrect error code, want %s got %v", tc.errCode, err)
+			}
+		})
+	}
+}
+
+func TestTokenSvc_IdleTimeout(t *testing.T) {
+	db, err := test.NewRedisDB()
+	if err != nil {
+		t.Fatal("faliled to create test database:", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	tokenSvc := NewService(
+		WithLogger(log.NewNopLogger()),
+		WithDB(db),
+		WithSecret("my-signing-secret"),
+		WithRepoManager(&test.RepositoryManager{}),
+		WithIdleTimeout(time.Hour),
+	)
+	user := &auth.User{ID: "user_id"}
+
+	validate := func(token *auth.Token) error {
+		signed, err := tokenSvc.Sign(ctx, token)
+		if err != nil {
+			t.Fatal("failed to sign token:", err)
+		}
+		_, err = tokenSvc.Validate(ctx, "Bearer "+signed, token.ClientID)
+		return err
+	}
+
+	token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	if err = validate(token); err != nil {
+		t.Error("expected active token to be valid:", err)
+	}
+
+	lastActive := time.Now().Add(-time.Minute * 10).Unix()
+	db.Set(ctx, ActivityKey(token.Id), lastActive, time.Hour)
+	if err = validate(token); err != nil {
+		t.Error("expected recently active token to be valid:", err)
+	}
+	recorded, _ := db.Get(ctx, ActivityKey(token.Id)).Int64()
+	if recorded <= lastActive {
+		t.Errorf("expected activity to be recorded, want after %v got %v", lastActive, recorded)
+	}
+
+	db.Set(ctx, ActivityKey(token.Id), time.Now().Add(-time.Hour*2).Unix(), time.Hour)
+	if err = validate(token); auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code for idle token, want %s got %v", auth.EInvalidToken, err)
+	}
+
+	untracked := *token
+	untracked.Id = "untracked"
+	untracked.IssuedAt = time.Now().Add(-time.Hour * 2).Unix()
+	if err = validate(&untracked); auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code for untracked token, want %s got %v", auth.EInvalidToken, err)
+	}
+}
+
+func TestTokenSvc_InvalidateNotBearer(t *testing.T) {
+	db, err := test.NewRedisDB()
+	if err != nil {
+		t.Fatal("faliled to create test database:", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	tokenSvc := NewTestTokenSvc(db, &test.RepositoryManager{})
+
+	_, err = tokenSvc.Validate(ctx, "jwt-token", "client-id")
+	domainErr := auth.DomainError(err)
+	if domainErr == nil {
+		t.Fatal("expected domain error")
+	}
+
+	if domainErr.Code() != auth.EInvalidToken {
+		t.Errorf("incorrect error code, want %s got %s",
+			auth.EInvalidToken, domainErr.Code())
+	}
+
+	if domainErr.Message() != "bearer token expected" {
+		t.Errorf("incorrect error code, want %s got %s",
+			"bearer token expected", domainErr.Message())
+	}
+}
+
+func TestTokenSvc_InvalidateNoUserID(t *testing.T) {
+	db, err := test.NewRedisDB()
+	if err != nil {
+		t.Fatal("faliled to create test database:", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	user := &auth.User{}
+
+	tokenSvc := NewService(
+		WithDB(db),
+		WithTokenExpiry(time.Millisecond),
+		WithSecret("my-signing-secret"),
+		WithIssuer("authenticator"),
+		WithOTP(otp.NewOTP()),
+	)
+
+	token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+
+	jwtToken, err := tokenSvc.Sign(ctx, token)
+	if err != nil {
+		t.Fatal("failed to sign token:", err)
+	}
+
+	_, err = tokenSvc.Validate(ctx, jwtToken, token.ClientID)
+	if err == nil {
+		t.Error("token with no user ID should return error, not nil")
+	}
+}
+
+func TestTokenSvc_InvalidateClientIDMismatch(t *testing.T) {
+	db, err := test.NewRedisDB()
+	if err != nil {
+		t.Fatal("failed to create test database:", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	user := &auth.User{ID: "user_id"}
+
+	tokenSvc := NewService(
+		WithDB(db),
+		WithTokenExpiry(time.Millisecond),
+		WithSecret("my-signing-secret"),
+		WithIssuer("authenticator"),
+		WithOTP(otp.NewOTP()),
+	)
+
+	token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+
+	jwtToken, err := tokenSvc.Sign(ctx, token)
+	if err != nil {
+		t.Fatal("failed to sign token:", err)
+	}
+
+	jwtToken = fmt.Sprintf("Bearer %s", jwtToken)
+	_, err = tokenSvc.Validate(ctx, jwtToken, token.ClientID)
+	if err != nil {
+		t.Error("failed to validate token:", err)
+	}
+
+	_, err = tokenSvc.Validate(ctx, jwtToken, base64.RawURLEncoding.EncodeToString([]byte("bad-client-id")))
+	domainErr := auth.DomainError(err)
+	if domainErr == nil {
+		t.Fatal("expected domain error")
+	}
+
+	if domainErr.Code() != auth.EInvalidToken {
+		t.Errorf("incorrect error code, want %s got %s",
+			auth.EInvalidToken, domainErr.Code())
+	}
+}
+
+func TestTokenSvc_Refreshable(t *testing.T) {
+	tt := []struct {
+		name               string
+		errCode            auth.ErrCode
+		refreshTokenExpiry time.Duration
+		isRevoked          bool
+	}{
+		{
+			name:               "Validates refreshable token",
+			refreshTokenExpiry: time.Minute * 2,
+			errCode:            auth.ErrCode(""),
+			isRevoked:          false,
+		},
+		{
+			name:               "Invalidates expired refreshable token",
+			errCode:            auth.EInvalidToken,
+			refreshTokenExpiry: time.Millisecond,
+			isRevoked:          false,
+		},
+		{
+			name:               "Invalidates revoked refreshable token",
+			errCode:            auth.EInvalidToken,
+			refreshTokenExpiry: time.Minute * 2,
+			isRevoked:          true,
 		},
 	}
 	for idx, tc := range tt {
@@ -598,6 +1375,7 @@ func TestTokenSvc_Refreshable(t *testing.T) {
 			}
 
 			tokenSvc := &service{
+				clock:              clock.New(),
 				refreshTokenExpiry: tc.refreshTokenExpiry,
 				repoMngr:           repoMngr,
 			}
@@ -616,7 +1394,7 @@ func TestTokenSvc_Refreshable(t *testing.T) {
 				t.Fatal("failed to create login history", err)
 			}
 
-			refreshToken, refreshTokenHash, err := tokenSvc.genRefreshTokenAndHash(&auth.TokenConfiguration{})
+			refreshToken, refreshTokenHash, err := tokenSvc.genRefreshTokenAndHash(context.Background(), &auth.TokenConfiguration{}, tokenSvc.refreshTokenExpiry)
 			if err != nil {
 				t.Fatal("failed to create refresh token")
 			}
@@ -653,7 +1431,7 @@ func TestTokenSvc_InvalidatesOldTokensWithOTP(t *testing.T) {
 		t.Fatal("failed to create token:", err)
 	}
 
-	ts, err := db.Get(ctx, invalidationKey(token.Id)).Int64()
+	ts, err := db.Get(ctx, InvalidationKey(token.Id)).Int64()
 	if err != nil {
 		t.Fatal("no cached token found:", err)
 	}
@@ -664,3 +1442,493 @@ func TestTokenSvc_InvalidatesOldTokensWithOTP(t *testing.T) {
 		))
 	}
 }
+
+func TestTokenSvc_Cookies(t *testing.T) {
+	tt := []struct {
+		name     string
+		options  []ConfigOption
+		names    [2]string
+		domain   string
+		path     string
+		secure   bool
+		sameSite http.SameSite
+	}{
+		{
+			name:   "Default attributes",
+			names:  [2]string{"CLIENTID", "REFRESHTOKEN"},
+			domain: "authenticator.local",
+			path:   "/",
+			secure: true,
+		},
+		{
+			name: "Custom attributes",
+			options: []ConfigOption{
+				WithCookieNames("APP_CLIENTID", "APP_REFRESHTOKEN"),
+				WithCookiePath("/api"),
+				WithCookieSecure(false),
+				WithCookieSameSite(http.SameSiteStrictMode),
+			},
+			names:    [2]string{"APP_CLIENTID", "APP_REFRESHTOKEN"},
+			domain:   "authenticator.local",
+			path:     "/api",
+			secure:   false,
+			sameSite: http.SameSiteStrictMode,
+		},
+		{
+			name: "Host-only cookies",
+			options: []ConfigOption{
+				WithCookiePath("/api"),
+				WithCookieSecure(false),
+				WithCookieSameSite(http.SameSiteLaxMode),
+				WithHostOnlyCookies(true),
+			},
+			names:    [2]string{"__Host-CLIENTID", "__Host-REFRESHTOKEN"},
+			domain:   "",
+			path:     "/",
+			secure:   true,
+			sameSite: http.SameSiteLaxMode,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			options := append([]ConfigOption{
+				WithCookieDomain("authenticator.local"),
+				WithCookieMaxAge(1000),
+			}, tc.options...)
+			tokenSvc := NewService(options...)
+
+			clientIDName, refreshTokenName := tokenSvc.CookieNames()
+			if clientIDName != tc.names[0] || refreshTokenName != tc.names[1] {
+				t.Errorf("incorrect cookie names, want %v got %s, %s", tc.names, clientIDName, refreshTokenName)
+			}
+
+			cookies := tokenSvc.Cookies(context.Background(), &auth.Token{
+				ClientID:     "client-id",
+				RefreshToken: "refresh-token",
+			})
+			if len(cookies) != 2 {
+				t.Fatalf("incorrect cookie count, want 2 got %v", len(cookies))
+			}
+
+			for i, cookie := range cookies {
+				if cookie.Name != tc.names[i] {
+					t.Errorf("incorrect cookie name, want %s got %s", tc.names[i], cookie.Name)
+				}
+				if cookie.Domain != tc.domain {
+					t.Errorf("incorrect cookie domain, want %q got %q", tc.domain, cookie.Domain)
+				}
+				if cookie.Path != tc.path {
+					t.Errorf("incorrect cookie path, want %s got %s", tc.path, cookie.Path)
+				}
+				if cookie.Secure != tc.secure {
+					t.Errorf("incorrect cookie secure flag, want %v got %v", tc.secure, cookie.Secure)
+				}
+				if cookie.SameSite != tc.sameSite {
+					t.Errorf("incorrect cookie SameSite, want %v got %v", tc.sameSite, cookie.SameSite)
+				}
+				if !cookie.HttpOnly || cookie.MaxAge != 1000 {
+					t.Errorf("incorrect cookie attributes: %+v", cookie)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenSvc_ValidateClaimsLeeway(t *testing.T) {
+	now := time.Date(2020, 6, 10, 15, 0, 0, 0, time.UTC)
+
+	tt := []struct {
+		name   string
+		claims jwt.MapClaims
+		leeway time.Duration
+		isErr  bool
+	}{
+		{
+			name:   "Valid claims",
+			claims: jwt.MapClaims{"iat": float64(now.Unix()), "exp": float64(now.Add(time.Minute).Unix())},
+		},
+		{
+			name:   "Expired without leeway",
+			claims: jwt.MapClaims{"exp": float64(now.Add(-5 * time.Second).Unix())},
+			isErr:  true,
+		},
+		{
+			name:   "Expired within leeway",
+			claims: jwt.MapClaims{"exp": float64(now.Add(-5 * time.Second).Unix())},
+			leeway: 10 * time.Second,
+		},
+		{
+			name:   "Expired beyond leeway",
+			claims: jwt.MapClaims{"exp": float64(now.Add(-time.Minute).Unix())},
+			leeway: 10 * time.Second,
+			isErr:  true,
+		},
+		{
+			name:   "Issued in the future without leeway",
+			claims: jwt.MapClaims{"iat": float64(now.Add(5 * time.Second).Unix())},
+			isErr:  true,
+		},
+		{
+			name:   "Issued in the future within leeway",
+			claims: jwt.MapClaims{"iat": float64(now.Add(5 * time.Second).Unix())},
+			leeway: 10 * time.Second,
+		},
+		{
+			name:   "Not valid yet without leeway",
+			claims: jwt.MapClaims{"nbf": float64(now.Add(5 * time.Second).Unix())},
+			isErr:  true,
+		},
+		{
+			name:   "Not valid yet within leeway",
+			claims: jwt.MapClaims{"nbf": float64(now.Add(5 * time.Second).Unix())},
+			leeway: 10 * time.Second,
+		},
+		{
+			name:   "Valid claims with negative leeway",
+			claims: jwt.MapClaims{"exp": float64(now.Add(5 * time.Second).Unix())},
+			leeway: -10 * time.Second,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateClaims(tc.claims, now, tc.leeway)
+			if tc.isErr && err == nil {
+				t.Error("expected claims to be invalid")
+			}
+			if !tc.isErr && err != nil {
+				t.Error("expected claims to be valid:", err)
+			}
+		})
+	}
+}
+
+func TestTokenSvc_Quota(t *testing.T) {
+	clk := clock.NewFake(time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC))
+	tokenSvc := NewService(
+		WithDB(memstore.New()),
+		WithSecret("my-signing-secret"),
+		WithOTP(otp.NewOTP()),
+		WithRepoManager(&test.RepositoryManager{}),
+		WithClock(clk),
+		WithUserQuota(Quota{Creates: 2, Refreshes: 1}),
+		WithTenantQuota(Quota{Creates: 3}),
+	)
+
+	user := &auth.User{ID: "user_id"}
+	otherUser := &auth.User{ID: "other_user_id"}
+	app := &auth.ClientApplication{ID: "mobile"}
+	ctx := clientapp.NewContext(context.Background(), app)
+
+	token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	if _, err = tokenSvc.Create(ctx, user, auth.JWTAuthorized); err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+
+	_, err = tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+	if auth.ErrorCode(err) != auth.EQuota {
+		t.Fatalf("incorrect error code, want %s got %v", auth.EQuota, err)
+	}
+	if msg := auth.DomainError(err).Message(); msg != "user create quota exceeded" {
+		t.Errorf("incorrect error message, want 'user create quota exceeded' got '%s'", msg)
+	}
+
+	// Refreshes are counted separately from creates.
+	if _, err = tokenSvc.Create(ctx, user, auth.JWTAuthorized, WithRefreshableToken(token)); err != nil {
+		t.Fatal("failed to refresh token:", err)
+	}
+	_, err = tokenSvc.Create(ctx, user, auth.JWTAuthorized, WithRefreshableToken(token))
+	if auth.ErrorCode(err) != auth.EQuota {
+		t.Errorf("incorrect error code, want %s got %v", auth.EQuota, err)
+	}
+
+	// Tokens of other Users count against the tenant's quota.
+	if _, err = tokenSvc.Create(ctx, otherUser, auth.JWTAuthorized); err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	_, err = tokenSvc.Create(ctx, otherUser, auth.JWTAuthorized)
+	if auth.ErrorCode(err) != auth.EQuota {
+		t.Fatalf("incorrect error code, want %s got %v", auth.EQuota, err)
+	}
+	if msg := auth.DomainError(err).Message(); msg != "tenant create quota exceeded" {
+		t.Errorf("incorrect error message, want 'tenant create quota exceeded' got '%s'", msg)
+	}
+
+	// Tokens without a ClientApplication are not counted against tenants.
+	if _, err = tokenSvc.Create(context.Background(), &auth.User{ID: "third_user_id"}, auth.JWTAuthorized); err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+
+	clk.Advance(time.Hour)
+	if _, err = tokenSvc.Create(ctx, user, auth.JWTAuthorized); err != nil {
+		t.Error("failed to create token in the next quota window:", err)
+	}
+}
+
+func TestTokenSvc_TTL(t *testing.T) {
+	tt := []struct {
+		name          string
+		ttl           time.Duration
+		expiresIn     time.Duration
+		refreshableIn time.Duration
+		claim         int64
+	}{
+		{
+			name:          "Default TTL",
+			expiresIn:     time.Minute * 20,
+			refreshableIn: time.Hour * 24,
+		},
+		{
+			name:          "Shorter TTL",
+			ttl:           time.Minute * 10,
+			expiresIn:     time.Minute * 10,
+			refreshableIn: time.Minute * 10,
+			claim:         600,
+		},
+		{
+			name:          "TTL between expiries",
+			ttl:           time.Hour,
+			expiresIn:     time.Minute * 20,
+			refreshableIn: time.Hour,
+			claim:         3600,
+		},
+		{
+			name:          "TTL clamped to minimum",
+			ttl:           time.Second * 5,
+			expiresIn:     time.Minute,
+			refreshableIn: time.Minute,
+			claim:         60,
+		},
+		{
+			name:          "TTL clamped to defaults",
+			ttl:           time.Hour * 48,
+			expiresIn:     time.Minute * 20,
+			refreshableIn: time.Hour * 24,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+			tokenSvc := NewService(
+				WithDB(memstore.New()),
+				WithSecret("my-signing-secret"),
+				WithOTP(otp.NewOTP()),
+				WithRepoManager(&test.RepositoryManager{}),
+				WithClock(clock.NewFake(now)),
+				WithTokenExpiry(time.Minute*20),
+				WithRefreshTokenExpiry(time.Hour*24),
+			)
+
+			token, err := tokenSvc.Create(context.Background(), &auth.User{ID: "user_id"},
+				auth.JWTAuthorized, WithTTL(tc.ttl))
+			if err != nil {
+				t.Fatal("failed to create token:", err)
+			}
+
+			if token.ExpiresAt != now.Add(tc.expiresIn).Unix() {
+				t.Errorf("incorrect token expiry, want %v got %v",
+					now.Add(tc.expiresIn).Unix(), token.ExpiresAt)
+			}
+			refreshableTill := tokenSvc.RefreshableTill(context.Background(), token, token.RefreshToken)
+			if !refreshableTill.Equal(now.Add(tc.refreshableIn)) {
+				t.Errorf("incorrect refresh token expiry, want %v got %v",
+					now.Add(tc.refreshableIn), refreshableTill)
+			}
+			if token.TTL != tc.claim {
+				t.Errorf("incorrect TTL claim, want %v got %v", tc.claim, token.TTL)
+			}
+		})
+	}
+}
+
+func TestTokenSvc_TTLRefresh(t *testing.T) {
+	tokenSvc := NewService(
+		WithDB(memstore.New()),
+		WithSecret("my-signing-secret"),
+		WithOTP(otp.NewOTP()),
+		WithRepoManager(&test.RepositoryManager{}),
+	)
+	user := &auth.User{ID: "user_id"}
+
+	token, err := tokenSvc.Create(context.Background(), user, auth.JWTAuthorized, WithTTL(time.Minute*10))
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+
+	refreshed, err := tokenSvc.Create(context.Background(), user, auth.JWTAuthorized,
+		WithRefreshableToken(token), WithTTL(time.Hour))
+	if err != nil {
+		t.Fatal("failed to refresh token:", err)
+	}
+	if refreshed.TTL != token.TTL {
+		t.Errorf("refreshed token extended its TTL, want %v got %v", token.TTL, refreshed.TTL)
+	}
+
+	refreshed, err = tokenSvc.Create(context.Background(), user, auth.JWTAuthorized,
+		WithRefreshableToken(token), WithTTL(time.Minute*5))
+	if err != nil {
+		t.Fatal("failed to refresh token:", err)
+	}
+	if refreshed.TTL != 300 {
+		t.Errorf("incorrect TTL claim, want 300 got %v", refreshed.TTL)
+	}
+}
+
+func TestTokenSvc_ClaimsMode(t *testing.T) {
+	tt := []struct {
+		name      string
+		mode      ClaimsMode
+		email     string
+		encrypted bool
+	}{
+		{
+			name:  "Full claims",
+			mode:  ClaimsFull,
+			email: "jane@example.com",
+		},
+		{
+			name: "Minimal claims",
+			mode: ClaimsMinimal,
+		},
+		{
+			name:      "Encrypted claims",
+			mode:      ClaimsEncrypted,
+			email:     "jane@example.com",
+			encrypted: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			tokenSvc := NewService(
+				WithDB(memstore.New()),
+				WithSecret("my-signing-secret"),
+				WithRepoManager(&test.RepositoryManager{}),
+				WithClaimsMode(tc.mode),
+			)
+			user := &auth.User{
+				ID:    "user_id",
+				Email: sql.NullString{String: "jane@example.com", Valid: true},
+				Phone: sql.NullString{String: "+15555555555", Valid: true},
+			}
+
+			token, err := tokenSvc.Create(ctx, user, auth.JWTAuthorized)
+			if err != nil {
+				t.Fatal("failed to create token:", err)
+			}
+			signed, err := tokenSvc.Sign(ctx, token)
+			if err != nil {
+				t.Fatal("failed to sign token:", err)
+			}
+			if jwe.IsEncrypted(signed) != tc.encrypted {
+				t.Errorf("incorrect token encryption, want %v got %v", tc.encrypted, jwe.IsEncrypted(signed))
+			}
+
+			validated, err := tokenSvc.Validate(ctx, "Bearer "+signed, token.ClientID)
+			if err != nil {
+				t.Fatal("failed to validate token:", err)
+			}
+			if validated.Email != tc.email {
+				t.Errorf("incorrect email claim, want '%s' got '%s'", tc.email, validated.Email)
+			}
+			if (validated.Phone == "") != (tc.email == "") {
+				t.Errorf("incorrect phone claim, got '%s'", validated.Phone)
+			}
+		})
+	}
+}
+
+func TestTokenSvc_RequiresEncryption(t *testing.T) {
+	ctx := context.Background()
+	db := memstore.New()
+	plainSvc := NewService(
+		WithDB(db),
+		WithSecret("my-signing-secret"),
+		WithRepoManager(&test.RepositoryManager{}),
+	)
+	encryptedSvc := NewService(
+		WithDB(db),
+		WithSecret("my-signing-secret"),
+		WithRepoManager(&test.RepositoryManager{}),
+		WithClaimsMode(ClaimsEncrypted),
+	)
+	user := &auth.User{ID: "user_id"}
+
+	token, err := plainSvc.Create(ctx, user, auth.JWTAuthorized)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	signed, err := plainSvc.Sign(ctx, token)
+	if err != nil {
+		t.Fatal("failed to sign token:", err)
+	}
+
+	_, err = encryptedSvc.Validate(ctx, "Bearer "+signed, token.ClientID)
+	if auth.ErrorCode(err) != auth.EInvalidToken {
+		t.Errorf("incorrect error code, want %s got %s", auth.EInvalidToken, auth.ErrorCode(err))
+	}
+
+	encrypted, err := encryptedSvc.Sign(ctx, token)
+	if err != nil {
+		t.Fatal("failed to sign token:", err)
+	}
+	if _, err = plainSvc.Validate(ctx, "Bearer "+encrypted, token.ClientID); err != nil {
+		t.Error("expected encrypted token to be accepted without encryption:", err)
+	}
+}
+
+func TestTokenSvc_CodeReuse(t *testing.T) {
+	tokenSvc := NewService(
+		WithDB(memstore.New()),
+		WithSecret("my-signing-secret"),
+		WithOTP(otp.NewOTP()),
+		WithRepoManager(&test.RepositoryManager{}),
+		WithCodeReuseWindow(time.Minute),
+	)
+
+	ctx := context.Background()
+	user := &auth.User{
+		ID:                "user_id",
+		Email:             sql.NullString{String: "jane@example.com", Valid: true},
+		IsEmailOTPAllowed: true,
+	}
+
+	first, err := tokenSvc.Create(ctx, user, auth.JWTPreAuthorized, WithOTPDeliveryMethod(auth.Email))
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	if first.Code == "" {
+		t.Fatal("expected first token to have a code to deliver")
+	}
+
+	second, err := tokenSvc.Create(ctx, user, auth.JWTPreAuthorized, WithOTPDeliveryMethod(auth.Email))
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	if second.Code != "" {
+		t.Error("expected second token to reuse the delivered code")
+	}
+	if second.CodeHash != first.CodeHash {
+		t.Error("expected second token to accept the delivered code")
+	}
+
+	resent, err := tokenSvc.Create(
+		ctx,
+		user,
+		auth.JWTPreAuthorized,
+		WithOTPDeliveryMethod(auth.Email),
+		WithRefreshableToken(second),
+	)
+	if err != nil {
+		t.Fatal("failed to create token:", err)
+	}
+	if resent.Code == "" || resent.CodeHash == first.CodeHash {
+		t.Error("expected code requested for an existing token to be delivered")
+	}
+}
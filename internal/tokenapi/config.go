@@ -42,3 +42,11 @@ func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
 		s.repoMngr = repoMngr
 	}
 }
+
+// WithClientApplications configures the service to notify
+// ClientApplications when Users log out.
+func WithClientApplications(apps auth.ClientApplicationService) ConfigOption {
+	return func(s *service) {
+		s.apps = apps
+	}
+}
@@ -15,16 +15,19 @@ import (
 func SetupHTTPHandler(svc auth.TokenAPI, router *mux.Router, tokenSvc auth.TokenService, logger log.Logger, lmt httpapi.LimiterFactory) {
 	var handler httpapi.JSONAPIHandler
 	{
-		handler = httpapi.AuthMiddleware(svc.Verify, tokenSvc, auth.JWTAuthorized)
-		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
-		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
-			"Token.Verify", httpapi.PerSecond, int64(1),
+		// Verification is rate limited per user once the token is
+		// validated, rather than per IP, as services introspecting
+		// tokens verify the requests of every user they serve.
+		handler = httpapi.RateLimitMiddleware(svc.Verify, lmt.NewLimiter(
+			"Token.Verify", httpapi.PerSecond, int64(20),
 		))
+		handler = httpapi.PolicyMiddleware(handler, tokenSvc, httpapi.AuthorizedPolicy)
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
 		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
 		router.HandleFunc("/api/v1/token/verify", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Revoke, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Revoke, tokenSvc, httpapi.AuthorizedPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"Token.Revoke", httpapi.PerMinute, int64(20),
 		))
@@ -33,8 +36,26 @@ func SetupHTTPHandler(svc auth.TokenAPI, router *mux.Router, tokenSvc auth.Token
 		router.HandleFunc("/api/v1/token/{tokenID}", httpHandler).Methods("Delete")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Refresh, tokenSvc, auth.JWTAuthorized)
-		handler = httpapi.RefreshTokenMiddleware(handler)
+		handler = httpapi.PolicyMiddleware(svc.History, tokenSvc, httpapi.AuthorizedPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"Token.History", httpapi.PerMinute, int64(20),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/token/history", httpHandler).Methods("Get")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.RevokeAll, tokenSvc, httpapi.AuthorizedPolicy)
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"Token.RevokeAll", httpapi.PerMinute, int64(5),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/token/revoke-all", httpHandler).Methods("Post")
+	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.Refresh, tokenSvc, httpapi.EnrollmentPolicy)
+		handler = httpapi.RefreshTokenMiddleware(handler, tokenSvc)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"Token.Refresh", httpapi.PerMinute, int64(1),
 		))
@@ -42,4 +63,17 @@ func SetupHTTPHandler(svc auth.TokenAPI, router *mux.Router, tokenSvc auth.Token
 		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
 		router.HandleFunc("/api/v1/token/refresh", httpHandler).Methods("Post")
 	}
+	{
+		handler = httpapi.PolicyMiddleware(svc.Logout, tokenSvc, httpapi.Policy{
+			States:                 []auth.TokenState{auth.JWTAuthorized},
+			AllowPendingConsent:    true,
+			AllowPendingEnrollment: true,
+		})
+		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
+			"Token.Logout", httpapi.PerMinute, int64(10),
+		))
+		handler = httpapi.ErrorLoggingMiddleware(handler, logger)
+		httpHandler := httpapi.ToHandlerFunc(handler, http.StatusOK)
+		router.HandleFunc("/api/v1/logout", httpHandler).Methods("Post")
+	}
 }
@@ -1,12 +1,16 @@
 package tokenapi
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/google/go-cmp/cmp"
@@ -14,8 +18,10 @@ import (
 
 	auth "github.com/fmitra/authenticator"
 	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/memstore"
 	"github.com/fmitra/authenticator/internal/postgres"
 	"github.com/fmitra/authenticator/internal/test"
+	tokenLib "github.com/fmitra/authenticator/internal/token"
 )
 
 func TestTokenAPI_Verify(t *testing.T) {
@@ -70,6 +76,52 @@ func TestTokenAPI_Verify(t *testing.T) {
 	}
 }
 
+func TestTokenAPI_VerifyRateLimitedPerUser(t *testing.T) {
+	router := mux.NewRouter()
+	tokenSvc := &test.TokenService{
+		ValidateFn: func() (*auth.Token, error) {
+			return &auth.Token{State: auth.JWTAuthorized, UserID: "user-a"}, nil
+		},
+	}
+	svc := NewService(
+		WithTokenService(tokenSvc),
+		WithRepoManager(&test.RepositoryManager{}),
+	)
+
+	logger := log.NewNopLogger()
+	lmt := httpapi.NewMemoryRateLimiter(memstore.New())
+	SetupHTTPHandler(svc, router, tokenSvc, logger, lmt)
+
+	verify := func() int {
+		req := httptest.NewRequest("POST", "/api/v1/token/verify", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		test.SetAuthHeaders(req)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// Requests are counted per second, so they start at the next
+	// second to fall within a single window.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	for i := 0; i < 20; i++ {
+		if code := verify(); code != http.StatusOK {
+			t.Fatalf("request %v from the same IP should be allowed, got %v", i+1, code)
+		}
+	}
+	if code := verify(); code != http.StatusTooManyRequests {
+		t.Errorf("incorrect status code, want %v got %v", http.StatusTooManyRequests, code)
+	}
+
+	tokenSvc.ValidateFn = func() (*auth.Token, error) {
+		return &auth.Token{State: auth.JWTAuthorized, UserID: "user-b"}, nil
+	}
+	if code := verify(); code != http.StatusOK {
+		t.Errorf("tokens of another user should be verified, got %v", code)
+	}
+}
+
 func TestTokenAPI_Revoke(t *testing.T) {
 	router := mux.NewRouter()
 	tokenSvc := &test.TokenService{
@@ -113,6 +165,49 @@ func TestTokenAPI_Revoke(t *testing.T) {
 	}
 }
 
+func TestTokenAPI_RevokeAll(t *testing.T) {
+	router := mux.NewRouter()
+	tokenSvc := &test.TokenService{
+		ValidateFn: func() (*auth.Token, error) {
+			return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+		},
+		RevokeAllFn: func() error {
+			return nil
+		},
+	}
+	repoMngr := &test.RepositoryManager{}
+	svc := NewService(
+		WithTokenService(tokenSvc),
+		WithRepoManager(repoMngr),
+	)
+
+	expectedCalls := 1
+	expectedStatus := http.StatusOK
+
+	req, err := http.NewRequest("POST", "/api/v1/token/revoke-all", nil)
+	if err != nil {
+		t.Fatal("failed to create request:", err)
+	}
+
+	test.SetAuthHeaders(req)
+
+	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if expectedCalls != tokenSvc.Calls.RevokeAll {
+		t.Error("TokenService.RevokeAll call count mismatch", cmp.Diff(
+			expectedCalls, tokenSvc.Calls.RevokeAll,
+		))
+	}
+
+	if rr.Code != expectedStatus {
+		t.Error("status code does not match", cmp.Diff(rr.Code, expectedStatus))
+	}
+}
+
 func TestTokenAPI_Refresh(t *testing.T) {
 	router := mux.NewRouter()
 	ctx := context.Background()
@@ -197,3 +292,313 @@ func TestTokenAPI_Refresh(t *testing.T) {
 		))
 	}
 }
+
+func TestTokenAPI_RefreshWithHeader(t *testing.T) {
+	router := mux.NewRouter()
+	tokenSvc := &test.TokenService{
+		ValidateFn: func() (*auth.Token, error) {
+			return &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}, nil
+		},
+		CreateFn: func() (*auth.Token, error) {
+			return &auth.Token{RefreshToken: "rotated-refresh-token"}, nil
+		},
+		SignFn: func() (string, error) {
+			return "signed-token", nil
+		},
+	}
+	svc := NewService(
+		WithTokenService(tokenSvc),
+		WithRepoManager(&test.RepositoryManager{}),
+	)
+
+	req, err := http.NewRequest("POST", "/api/v1/token/refresh", nil)
+	if err != nil {
+		t.Fatal("failed to create request:", err)
+	}
+	req.Header.Set("AUTHORIZATION", "Bearer token")
+	req.Header.Set(httpapi.TokenClientIDHeader, "client-id")
+	req.Header.Set(httpapi.RefreshTokenHeader, "refresh-token")
+	req.Header.Set(httpapi.DeviceIDHeader, "device-id")
+
+	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+	SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Error("status code does not match", cmp.Diff(rr.Code, http.StatusOK))
+	}
+
+	var resp tokenLib.Response
+	if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal("failed to decode response:", err)
+	}
+	if resp.RefreshToken != "rotated-refresh-token" {
+		t.Error("refresh token does not match", cmp.Diff(resp.RefreshToken, "rotated-refresh-token"))
+	}
+}
+
+func TestTokenAPI_Logout(t *testing.T) {
+	tt := []struct {
+		name           string
+		reqBody        []byte
+		appID          string
+		statusCode     int
+		revokeCalls    int
+		revokeAllCalls int
+		notifyCalls    int
+		notifyClientID string
+		notifyTokenID  string
+	}{
+		{
+			name:        "Logout of session",
+			statusCode:  http.StatusOK,
+			revokeCalls: 1,
+		},
+		{
+			name:           "Logout of client application session",
+			appID:          "mobile",
+			statusCode:     http.StatusOK,
+			revokeCalls:    1,
+			notifyCalls:    1,
+			notifyClientID: "mobile",
+			notifyTokenID:  "token-id",
+		},
+		{
+			name:           "Logout of every session",
+			reqBody:        []byte(`{"all":true}`),
+			appID:          "mobile",
+			statusCode:     http.StatusOK,
+			revokeAllCalls: 1,
+			notifyCalls:    1,
+		},
+		{
+			name:       "Invalid request",
+			reqBody:    []byte(`{"all":`),
+			statusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			tokenSvc := &test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					token := &auth.Token{
+						UserID:              "user-id",
+						State:               auth.JWTAuthorized,
+						ClientApplicationID: tc.appID,
+					}
+					token.Id = "token-id"
+					return token, nil
+				},
+				RevokeFn: func() error {
+					return nil
+				},
+				RevokeAllFn: func() error {
+					return nil
+				},
+				CookiesFn: func() []*http.Cookie {
+					return []*http.Cookie{{Name: "CLIENTID", Value: "client-id"}}
+				},
+			}
+			var notice *auth.LogoutNotice
+			apps := &test.ClientApplicationService{
+				NotifyLogoutFn: func(clientID string, n *auth.LogoutNotice) error {
+					if clientID != tc.notifyClientID {
+						t.Errorf("incorrect client application notified, want %q got %q",
+							tc.notifyClientID, clientID)
+					}
+					notice = n
+					return fmt.Errorf("delivery failed")
+				},
+			}
+			svc := NewService(
+				WithTokenService(tokenSvc),
+				WithRepoManager(&test.RepositoryManager{}),
+				WithClientApplications(apps),
+			)
+
+			req, err := http.NewRequest("POST", "/api/v1/logout", bytes.NewBuffer(tc.reqBody))
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+			test.SetAuthHeaders(req)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Error("status code does not match", cmp.Diff(rr.Code, tc.statusCode))
+			}
+			if tokenSvc.Calls.Revoke != tc.revokeCalls {
+				t.Error("TokenService.Revoke call count mismatch", cmp.Diff(
+					tokenSvc.Calls.Revoke, tc.revokeCalls,
+				))
+			}
+			if tokenSvc.Calls.RevokeAll != tc.revokeAllCalls {
+				t.Error("TokenService.RevokeAll call count mismatch", cmp.Diff(
+					tokenSvc.Calls.RevokeAll, tc.revokeAllCalls,
+				))
+			}
+			if apps.Calls.NotifyLogout != tc.notifyCalls {
+				t.Error("ClientApplicationService.NotifyLogout call count mismatch", cmp.Diff(
+					apps.Calls.NotifyLogout, tc.notifyCalls,
+				))
+			}
+			if notice != nil && notice.TokenID != tc.notifyTokenID {
+				t.Error("notified token ID does not match", cmp.Diff(notice.TokenID, tc.notifyTokenID))
+			}
+
+			if tc.statusCode != http.StatusOK {
+				return
+			}
+			cookies := rr.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+				t.Errorf("expected session cookies to be cleared, got %v", cookies)
+			}
+		})
+	}
+}
+
+func TestTokenAPI_History(t *testing.T) {
+	now := time.Now()
+	logins := []*auth.LoginHistory{
+		{TokenID: "token-3", ExpiresAt: now.Add(time.Hour)},
+		{TokenID: "token-2", IsRevoked: true, ExpiresAt: now.Add(time.Hour)},
+		{TokenID: "token-1", ExpiresAt: now.Add(-time.Hour)},
+	}
+
+	tt := []struct {
+		name       string
+		query      string
+		statusCode int
+		errMessage string
+		filter     auth.LoginHistoryFilter
+		statuses   []string
+		nextCursor string
+	}{
+		{
+			name:       "Default page",
+			query:      "",
+			statusCode: http.StatusOK,
+			filter:     auth.LoginHistoryFilter{Limit: 21},
+			statuses:   []string{"active", "revoked", "expired"},
+		},
+		{
+			name:       "Page with next cursor",
+			query:      "?limit=2&cursor=token-4&status=active&from=2020-01-01T00:00:00Z",
+			statusCode: http.StatusOK,
+			filter: auth.LoginHistoryFilter{
+				Cursor: "token-4",
+				Limit:  3,
+				Status: auth.LoginActive,
+				From:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			statuses:   []string{"active", "revoked"},
+			nextCursor: "token-2",
+		},
+		{
+			name:       "Invalid limit",
+			query:      "?limit=101",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Limit must be between 1 and 100",
+		},
+		{
+			name:       "Invalid status",
+			query:      "?status=expired",
+			statusCode: http.StatusBadRequest,
+			errMessage: "Status must be active or revoked",
+		},
+		{
+			name:       "Invalid date range",
+			query:      "?from=2020-01-02T00:00:00Z&to=2020-01-01T00:00:00Z",
+			statusCode: http.StatusBadRequest,
+			errMessage: "From must be before to",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			tokenSvc := &test.TokenService{
+				ValidateFn: func() (*auth.Token, error) {
+					token := &auth.Token{UserID: "user-id", State: auth.JWTAuthorized}
+					token.Id = "token-3"
+					return token, nil
+				},
+			}
+			var filter *auth.LoginHistoryFilter
+			loginHistoryRepo := &test.LoginHistoryRepository{
+				ListFn: func(f *auth.LoginHistoryFilter) ([]*auth.LoginHistory, error) {
+					filter = f
+					if len(logins) > f.Limit {
+						return logins[:f.Limit], nil
+					}
+					return logins, nil
+				},
+			}
+			repoMngr := &test.RepositoryManager{
+				LoginHistoryFn: func() auth.LoginHistoryRepository {
+					return loginHistoryRepo
+				},
+			}
+			svc := NewService(
+				WithTokenService(tokenSvc),
+				WithRepoManager(repoMngr),
+			)
+
+			req, err := http.NewRequest("GET", "/api/v1/token/history"+tc.query, nil)
+			if err != nil {
+				t.Fatal("failed to create request:", err)
+			}
+
+			test.SetAuthHeaders(req)
+
+			logger := log.NewJSONLogger(log.NewSyncWriter(os.Stderr))
+			SetupHTTPHandler(svc, router, tokenSvc, logger, &httpapi.MockLimiterFactory{})
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+
+			if tc.statusCode != http.StatusOK {
+				err = test.ValidateErrMessage(tc.errMessage, rr.Body)
+				if err != nil {
+					t.Error(err)
+				}
+				return
+			}
+
+			if !cmp.Equal(*filter, tc.filter) {
+				t.Error("incorrect filter", cmp.Diff(*filter, tc.filter))
+			}
+
+			var resp historyResponse
+			if err = json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal("failed to decode response:", err)
+			}
+
+			var statuses []string
+			for _, l := range resp.Logins {
+				statuses = append(statuses, l.Status)
+			}
+			if !cmp.Equal(statuses, tc.statuses) {
+				t.Error("incorrect login statuses", cmp.Diff(statuses, tc.statuses))
+			}
+			if !resp.Logins[0].IsCurrent {
+				t.Error("expected current session to be marked")
+			}
+			if resp.NextCursor != tc.nextCursor {
+				t.Errorf("incorrect next cursor, want %s got %s", tc.nextCursor, resp.NextCursor)
+			}
+		})
+	}
+}
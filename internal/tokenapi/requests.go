@@ -0,0 +1,110 @@
+package tokenapi
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+)
+
+type logoutRequest struct {
+	// All logs the User out of every session.
+	All bool `json:"all"`
+}
+
+func decodeLogoutRequest(r *http.Request) (*logoutRequest, error) {
+	var req logoutRequest
+
+	if r == nil || r.Body == nil {
+		return &req, nil
+	}
+
+	err := httpapi.DecodeJSON(r, &req)
+	if err == io.EOF {
+		return &req, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
+	}
+
+	return &req, nil
+}
+
+type refreshRequest struct {
+	// TTL is the lifetime requested for the refreshed token when
+	// shorter than its current TTL.
+	TTL time.Duration
+}
+
+func decodeRefreshRequest(r *http.Request) (*refreshRequest, error) {
+	var req refreshRequest
+
+	ttl := r.URL.Query().Get("ttl")
+	if ttl == "" {
+		return &req, nil
+	}
+
+	seconds, err := strconv.ParseInt(ttl, 10, 64)
+	if err != nil || seconds < 1 {
+		return nil, auth.ErrInvalidField("ttl must be a positive number of seconds")
+	}
+	req.TTL = time.Duration(seconds) * time.Second
+
+	return &req, nil
+}
+
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+func decodeHistoryRequest(r *http.Request) (*auth.LoginHistoryFilter, error) {
+	query := r.URL.Query()
+	filter := auth.LoginHistoryFilter{
+		Cursor: query.Get("cursor"),
+		Limit:  defaultHistoryLimit,
+		Status: auth.LoginStatus(query.Get("status")),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxHistoryLimit {
+			return nil, auth.ErrInvalidField(
+				fmt.Sprintf("limit must be between 1 and %v", maxHistoryLimit),
+			)
+		}
+		filter.Limit = n
+	}
+
+	switch filter.Status {
+	case "", auth.LoginActive, auth.LoginRevoked:
+	default:
+		return nil, auth.ErrInvalidField("status must be active or revoked")
+	}
+
+	var err error
+	if filter.From, err = parseTime(query.Get("from")); err != nil {
+		return nil, auth.ErrInvalidField("from must be an RFC 3339 timestamp")
+	}
+	if filter.To, err = parseTime(query.Get("to")); err != nil {
+		return nil, auth.ErrInvalidField("to must be an RFC 3339 timestamp")
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, auth.ErrInvalidField("from must be before to")
+	}
+
+	return &filter, nil
+}
+
+// parseTime parses an optional RFC 3339 timestamp. An empty
+// value returns the zero time.
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
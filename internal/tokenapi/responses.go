@@ -1,6 +1,56 @@
 package tokenapi
 
+import (
+	"time"
+
+	auth "github.com/fmitra/authenticator"
+)
+
 // Response is a success response.
 type Response struct {
 	Result string `json:"result"`
 }
+
+// loginResponse is the response format for authenticator.LoginHistory.
+type loginResponse struct {
+	TokenID   string    `json:"tokenID"`
+	Status    string    `json:"status"`
+	IsCurrent bool      `json:"isCurrent"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+	IPAddress string    `json:"ipAddress,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	City      string    `json:"city,omitempty"`
+}
+
+// historyResponse is a success response for TokenAPI.History.
+type historyResponse struct {
+	Logins     []loginResponse `json:"logins"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+// Create populates a historyResponse with a list of LoginHistory.
+// The session of the current token is marked as current.
+func (r *historyResponse) Create(logins []*auth.LoginHistory, currentTokenID string, now time.Time) {
+	rl := []loginResponse{}
+	for _, l := range logins {
+		status := string(auth.LoginActive)
+		if l.IsRevoked {
+			status = string(auth.LoginRevoked)
+		} else if !l.ExpiresAt.After(now) {
+			status = "expired"
+		}
+
+		rl = append(rl, loginResponse{
+			TokenID:   l.TokenID,
+			Status:    status,
+			IsCurrent: l.TokenID == currentTokenID,
+			ExpiresAt: l.ExpiresAt,
+			CreatedAt: l.CreatedAt,
+			IPAddress: l.IPAddress,
+			Country:   l.Country,
+			City:      l.City,
+		})
+	}
+	r.Logins = rl
+}
@@ -4,8 +4,10 @@ package tokenapi
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 
 	auth "github.com/fmitra/authenticator"
 	"github.com/fmitra/authenticator/internal/httpapi"
@@ -16,6 +18,7 @@ type service struct {
 	logger   log.Logger
 	token    auth.TokenService
 	repoMngr auth.RepositoryManager
+	apps     auth.ClientApplicationService
 }
 
 // Revoke revokes a User's token for a logged in session. Revoked tokens may not be
@@ -30,18 +33,121 @@ func (s *service) Revoke(w http.ResponseWriter, r *http.Request) (interface{}, e
 	return &Response{Result: "success"}, nil
 }
 
+// RevokeAll revokes every logged in session of a User, including the
+// session making the request. It is intended for use after a password
+// change or suspected account compromise.
+func (s *service) RevokeAll(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+	if err := s.token.RevokeAll(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return &Response{Result: "success"}, nil
+}
+
+// History returns a page of the User's logins, newest first. Pages are
+// requested with the cursor returned by the previous page and may be
+// filtered by creation time and session status.
+func (s *service) History(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	userID := httpapi.GetUserID(r)
+
+	filter, err := decodeHistoryRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// An extra login is requested to determine if another page exists.
+	limit := filter.Limit
+	filter.Limit = limit + 1
+
+	logins, err := s.repoMngr.LoginHistory().List(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var nextCursor string
+	if len(logins) > limit {
+		logins = logins[:limit]
+		nextCursor = logins[len(logins)-1].TokenID
+	}
+
+	resp := historyResponse{NextCursor: nextCursor}
+	resp.Create(logins, httpapi.GetToken(r).Id, time.Now())
+	return &resp, nil
+}
+
+// Logout revokes the current session, or every session of the User if
+// requested, and clears the session's cookies. ClientApplications are
+// notified through their back-channel logout URL. Failed notifications
+// do not fail the logout.
+func (s *service) Logout(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	token := httpapi.GetToken(r)
+
+	req, err := decodeLogoutRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	notice := &auth.LogoutNotice{
+		UserID:   token.UserID,
+		IssuedAt: time.Now().Unix(),
+	}
+	clientID := token.ClientApplicationID
+	if req.All {
+		err = s.token.RevokeAll(ctx, token.UserID)
+		clientID = ""
+	} else {
+		err = s.token.Revoke(ctx, token.Id)
+		notice.TokenID = token.Id
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cookie := range s.token.Cookies(ctx, &auth.Token{}) {
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+	}
+
+	// Sessions outside of a ClientApplication have no one to notify.
+	if s.apps != nil && (req.All || clientID != "") {
+		if err = s.apps.NotifyLogout(ctx, clientID, notice); err != nil {
+			level.Error(s.logger).Log(
+				"source", "TokenAPI.Logout",
+				"message", "failed to deliver logout notifications",
+				"user_id", token.UserID,
+				"error", err,
+			)
+		}
+	}
+
+	return &Response{Result: "success"}, nil
+}
+
 // Verify check's if a User's header credentials (token and matching client ID) are valid.
 func (s *service) Verify(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	return &Response{Result: "success"}, nil
 }
 
 // Refresh refreshes an expired token with a new expiry time. Refresh tokens share
-// a token's original ID and client ID.
+// a token's original ID and client ID. Refresh tokens delivered by header, as
+// native clients do, are rotated and the replacement returned in the response.
+// Clients may request a TTL shorter than the token's current TTL.
 func (s *service) Refresh(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	ctx := r.Context()
+	req, err := decodeRefreshRequest(r)
+	if err != nil {
+		return nil, err
+	}
+
 	token := httpapi.GetToken(r)
 	refreshToken := httpapi.GetRefreshToken(r)
-	if err := s.token.Refreshable(ctx, token, refreshToken); err != nil {
+	deviceID := httpapi.GetDeviceID(r)
+	err = s.token.Refreshable(ctx, token, refreshToken, tokenLib.ExpectDevice(deviceID))
+	if err != nil {
 		return nil, err
 	}
 
@@ -51,12 +157,16 @@ func (s *service) Refresh(w http.ResponseWriter, r *http.Request) (interface{},
 		return nil, err
 	}
 
-	token, err = s.token.Create(
-		ctx,
-		user,
-		auth.JWTAuthorized,
+	isRotated := httpapi.IsRefreshTokenHeader(r)
+	options := []auth.TokenOption{
 		tokenLib.WithRefreshableToken(token),
-	)
+		tokenLib.WithTTL(req.TTL),
+	}
+	if isRotated {
+		options = append(options, tokenLib.WithRefreshTokenRotation(refreshToken))
+	}
+
+	token, err = s.token.Create(ctx, user, auth.JWTAuthorized, options...)
 	if err != nil {
 		return nil, err
 	}
@@ -66,5 +176,10 @@ func (s *service) Refresh(w http.ResponseWriter, r *http.Request) (interface{},
 		return nil, err
 	}
 
-	return &tokenLib.Response{Token: signedToken}, nil
+	resp := tokenLib.Response{Token: signedToken}
+	if isRotated {
+		resp.RefreshToken = token.RefreshToken
+	}
+
+	return &resp, nil
 }
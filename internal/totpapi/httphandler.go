@@ -15,7 +15,7 @@ import (
 func SetupHTTPHandler(svc auth.TOTPAPI, router *mux.Router, tokenSvc auth.TokenService, logger log.Logger, lmt httpapi.LimiterFactory) {
 	var handler httpapi.JSONAPIHandler
 	{
-		handler = httpapi.AuthMiddleware(svc.Secret, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Secret, tokenSvc, httpapi.EnrollmentPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"TOTPAPI.Secret", httpapi.PerMinute, int64(20),
 		))
@@ -24,7 +24,7 @@ func SetupHTTPHandler(svc auth.TOTPAPI, router *mux.Router, tokenSvc auth.TokenS
 		router.HandleFunc("/api/v1/totp", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Verify, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Verify, tokenSvc, httpapi.EnrollmentPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"TOTPAPI.Verify", httpapi.PerMinute, int64(10),
 		))
@@ -33,7 +33,7 @@ func SetupHTTPHandler(svc auth.TOTPAPI, router *mux.Router, tokenSvc auth.TokenS
 		router.HandleFunc("/api/v1/totp/configure", httpHandler).Methods("Post")
 	}
 	{
-		handler = httpapi.AuthMiddleware(svc.Remove, tokenSvc, auth.JWTAuthorized)
+		handler = httpapi.PolicyMiddleware(svc.Remove, tokenSvc, httpapi.AuthorizedPolicy)
 		handler = httpapi.RateLimitMiddleware(handler, lmt.NewLimiter(
 			"TOTPAPI.Remove", httpapi.PerMinute, int64(10),
 		))
@@ -593,6 +593,8 @@ func TestTOTPAPI_Remove(t *testing.T) {
 		tokenCreateFn   func() (*auth.Token, error)
 		tokenSignFn     func() (string, error)
 		validateTOTPFn  func(ctx context.Context, u *auth.User, code string) error
+		delaysChanges   bool
+		delayCalls      int
 	}{
 		{
 			name:       "Authentication error with no token",
@@ -761,6 +763,63 @@ func TestTOTPAPI_Remove(t *testing.T) {
 				return auth.ErrInvalidCode("incorrect code provided")
 			},
 		},
+		{
+			name:       "TOTP removal delayed",
+			statusCode: http.StatusOK,
+			authHeader: true,
+			errMessage: "",
+			user: auth.User{
+				Password:  "swordfish",
+				TFASecret: "SECRET",
+				Email: sql.NullString{
+					String: "jane@example.com",
+					Valid:  true,
+				},
+				IsVerified:        true,
+				IsEmailOTPAllowed: true,
+				IsTOTPAllowed:     true,
+			},
+			isTOTPAllowed: true,
+			reqBody:       []byte(`{"code": "123456"}`),
+			tokenValidateFn: func(userID string) func() (*auth.Token, error) {
+				return func() (*auth.Token, error) {
+					return &auth.Token{UserID: userID, State: auth.JWTAuthorized}, nil
+				}
+			},
+			validateTOTPFn: func(ctx context.Context, u *auth.User, code string) error {
+				return nil
+			},
+			delaysChanges: true,
+			delayCalls:    1,
+		},
+		{
+			name:       "Incorrect code provided for delayed removal",
+			statusCode: http.StatusBadRequest,
+			authHeader: true,
+			errMessage: "Incorrect code provided",
+			user: auth.User{
+				Password:  "swordfish",
+				TFASecret: "SECRET",
+				Email: sql.NullString{
+					String: "jane@example.com",
+					Valid:  true,
+				},
+				IsVerified:        true,
+				IsEmailOTPAllowed: true,
+				IsTOTPAllowed:     true,
+			},
+			isTOTPAllowed: true,
+			reqBody:       []byte(`{"code": "123456"}`),
+			tokenValidateFn: func(userID string) func() (*auth.Token, error) {
+				return func() (*auth.Token, error) {
+					return &auth.Token{UserID: userID, State: auth.JWTAuthorized}, nil
+				}
+			},
+			validateTOTPFn: func(ctx context.Context, u *auth.User, code string) error {
+				return auth.ErrInvalidCode("incorrect code provided")
+			},
+			delaysChanges: true,
+		},
 	}
 
 	for _, tc := range tt {
@@ -788,10 +847,17 @@ func TestTOTPAPI_Remove(t *testing.T) {
 				SignFn:     tc.tokenSignFn,
 			}
 
+			changes := &test.SecurityChangeService{
+				IsEnabledFn: func() bool {
+					return tc.delaysChanges
+				},
+			}
+
 			svc := NewService(
 				WithOTP(otpSvc),
 				WithRepoManager(repoMngr),
 				WithTokenService(tokenSvc),
+				WithSecurityChanges(changes),
 			)
 
 			req, err := http.NewRequest("DELETE", "/api/v1/totp/configure", bytes.NewBuffer(tc.reqBody))
@@ -826,6 +892,11 @@ func TestTOTPAPI_Remove(t *testing.T) {
 			if user.IsTOTPAllowed != tc.isTOTPAllowed {
 				t.Error(cmp.Diff(user.IsTOTPAllowed, tc.isTOTPAllowed))
 			}
+
+			if changes.Calls.Delay != tc.delayCalls {
+				t.Errorf("incorrect SecurityChangeService.Delay() call count, want %v got %v",
+					tc.delayCalls, changes.Calls.Delay)
+			}
 		})
 	}
 }
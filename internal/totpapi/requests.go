@@ -1,12 +1,12 @@
 package totpapi
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"strings"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
 )
 
 type totpRequest struct {
@@ -23,7 +23,7 @@ func decodeTOTPRequest(r *http.Request) (*totpRequest, error) {
 		return nil, auth.ErrBadRequest("no request body received")
 	}
 
-	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err = httpapi.DecodeJSON(r, &req); err != nil {
 		return nil, fmt.Errorf("%v: %w", err, auth.ErrBadRequest("invalid JSON request"))
 	}
 
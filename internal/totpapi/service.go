@@ -10,6 +10,7 @@ import (
 
 	auth "github.com/fmitra/authenticator"
 	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/securitychange"
 	tokenLib "github.com/fmitra/authenticator/internal/token"
 )
 
@@ -18,6 +19,7 @@ type service struct {
 	otp      auth.OTPService
 	repoMngr auth.RepositoryManager
 	token    auth.TokenService
+	changes  auth.SecurityChangeService
 }
 
 // Secret sets a new TOTP secret on a User's profile and delivers it back to the user
@@ -93,7 +95,8 @@ func (s *service) Verify(w http.ResponseWriter, r *http.Request) (interface{}, e
 }
 
 // Remove validates a recently generated TOTP code. If a code is valid, TOTP is disabled
-// for the user.
+// for the user. If changes are delayed, disabling TOTP only takes effect once the delay
+// has passed.
 func (s *service) Remove(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	ctx := r.Context()
 	userID := httpapi.GetUserID(r)
@@ -107,6 +110,24 @@ func (s *service) Remove(w http.ResponseWriter, r *http.Request) (interface{}, e
 		return nil, auth.ErrBadRequest("TOTP is not enabled")
 	}
 
+	if s.changes.IsEnabled() {
+		req, err := decodeTOTPRequest(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = s.otp.ValidateTOTP(ctx, user, req.Code); err != nil {
+			return nil, err
+		}
+
+		change := &auth.PendingChange{Type: auth.ChangeDisableTOTP}
+		if err = s.changes.Delay(ctx, user, change); err != nil {
+			return nil, err
+		}
+
+		return securitychange.NewPendingResponse(change), nil
+	}
+
 	isEnabled := false
 	return s.configureTOTP(ctx, r, user, isEnabled)
 }
@@ -121,29 +142,12 @@ func (s *service) configureTOTP(ctx context.Context, r *http.Request, user *auth
 		return nil, err
 	}
 
-	client, err := s.repoMngr.NewWithTransaction(ctx)
+	updated, err := SetTOTP(ctx, s.repoMngr, user.ID, isEnabled)
 	if err != nil {
 		return nil, err
 	}
 
-	entity, err := client.WithAtomic(func() (interface{}, error) {
-		user, err := client.User().GetForUpdate(ctx, user.ID)
-		if err != nil {
-			return nil, err
-		}
-
-		user.IsTOTPAllowed = isEnabled
-		if err = client.User().Update(ctx, user); err != nil {
-			return nil, fmt.Errorf("cannot update TOTP setting: %w", err)
-		}
-
-		return user, nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	*user = *entity.(*auth.User)
+	*user = *updated
 
 	token := httpapi.GetToken(r)
 	token, err = s.token.Create(
@@ -163,3 +167,30 @@ func (s *service) configureTOTP(ctx context.Context, r *http.Request, user *auth
 
 	return &tokenLib.Response{Token: signedToken}, nil
 }
+
+// SetTOTP enables or disables TOTP for a User.
+func SetTOTP(ctx context.Context, repoMngr auth.RepositoryManager, userID string, isEnabled bool) (*auth.User, error) {
+	client, err := repoMngr.NewWithTransaction(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entity, err := client.WithAtomic(func() (interface{}, error) {
+		user, err := client.User().GetForUpdate(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		user.IsTOTPAllowed = isEnabled
+		if err = client.User().Update(ctx, user); err != nil {
+			return nil, fmt.Errorf("cannot update TOTP setting: %w", err)
+		}
+
+		return user, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entity.(*auth.User), nil
+}
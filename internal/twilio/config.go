@@ -1,6 +1,7 @@
 package twilio
 
 import (
+	"net/http"
 	"strings"
 
 	auth "github.com/fmitra/authenticator"
@@ -21,9 +22,11 @@ type Config struct {
 type ConfigOption func(*client)
 
 // NewClient returns a Twilio client.
-func NewClient(configuration ConfigOption) auth.SMSer {
-	c := client{}
-	configuration(&c)
+func NewClient(options ...ConfigOption) auth.SMSer {
+	c := client{httpClient: &http.Client{}}
+	for _, opt := range options {
+		opt(&c)
+	}
 	return &c
 }
 
@@ -48,3 +51,35 @@ func WithDefaults(accountSID, authToken, smsSender string) ConfigOption {
 		c.smsSender = smsSender
 	}
 }
+
+// WithStatusCallback configures the URL Twilio reports the
+// status of tracked messages to.
+func WithStatusCallback(url string) ConfigOption {
+	return func(c *client) {
+		c.statusCallback = url
+	}
+}
+
+// WithSenderID configures an alphanumeric sender ID, such as a brand
+// name, to send SMS from. Recipients in regions whose carriers reject
+// alphanumeric sender IDs, given as ISO 3166-1 region codes, receive
+// SMS from the numeric sender instead.
+func WithSenderID(senderID string, numericRegions []string) ConfigOption {
+	return func(c *client) {
+		c.senderID = senderID
+		c.numericRegions = make(map[string]bool, len(numericRegions))
+		for _, region := range numericRegions {
+			if region = strings.ToUpper(strings.TrimSpace(region)); region != "" {
+				c.numericRegions[region] = true
+			}
+		}
+	}
+}
+
+// WithHTTPClient configures the HTTP client requests to Twilio
+// are sent with.
+func WithHTTPClient(httpClient *http.Client) ConfigOption {
+	return func(c *client) {
+		c.httpClient = httpClient
+	}
+}
@@ -9,6 +9,11 @@ import (
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
+	"strings"
+
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/msgdelivery"
+	"github.com/fmitra/authenticator/internal/msgsender"
 )
 
 // client is a consumer of the Twilio API.
@@ -17,6 +22,16 @@ type client struct {
 	accountSID string
 	authToken  string
 	smsSender  string
+	// statusCallback is the URL Twilio reports the status of
+	// messages to. Status is not reported if it is empty.
+	statusCallback string
+	// senderID is an alphanumeric sender ID preferred over smsSender
+	// in regions which allow it.
+	senderID string
+	// numericRegions are the regions whose carriers reject
+	// alphanumeric sender IDs.
+	numericRegions map[string]bool
+	httpClient     *http.Client
 }
 
 // SMS sends an SMS message to a phone number.
@@ -31,10 +46,18 @@ func (c *client) SMS(ctx context.Context, phoneNumber string, message string) er
 
 	smsTemplate := map[string]string{
 		"To":   phoneNumber,
-		"From": c.smsSender,
+		"From": c.sender(ctx, phoneNumber),
 		"Body": message,
 	}
 
+	if id := msgdelivery.FromContext(ctx); id != "" && c.statusCallback != "" {
+		callback, err := msgdelivery.CallbackURL(c.statusCallback, id)
+		if err != nil {
+			return fmt.Errorf("invalid status callback URL: %w", err)
+		}
+		smsTemplate["StatusCallback"] = callback
+	}
+
 	if err := writeFields(writer, smsTemplate); err != nil {
 		return err
 	}
@@ -69,9 +92,7 @@ func (c *client) request(ctx context.Context, url string, body io.Reader, writer
 	req.SetBasicAuth(c.accountSID, c.authToken)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	httpClient := &http.Client{}
-
-	resp, err := httpClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
 	}
@@ -91,3 +112,21 @@ func writeFields(writer *multipart.Writer, fields map[string]string) error {
 
 	return nil
 }
+
+// sender returns the sender of an SMS to a phone number. Alphanumeric
+// sender IDs fall back to the numeric sender in regions whose carriers
+// reject them.
+func (c *client) sender(ctx context.Context, phoneNumber string) string {
+	sender := c.smsSender
+	if c.senderID != "" {
+		sender = c.senderID
+	}
+	if s := msgsender.FromContext(ctx).SMSSender; s != "" {
+		sender = s
+	}
+
+	if !strings.HasPrefix(sender, "+") && c.numericRegions[contactchecker.PhoneRegion(phoneNumber)] {
+		return c.smsSender
+	}
+	return sender
+}
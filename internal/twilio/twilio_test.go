@@ -3,8 +3,12 @@ package twilio
 import (
 	"context"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/msgdelivery"
+	"github.com/fmitra/authenticator/internal/msgsender"
 	"github.com/fmitra/authenticator/internal/test"
 )
 
@@ -57,3 +61,121 @@ func TestTwilio_SMS(t *testing.T) {
 		})
 	}
 }
+
+func TestTwilio_SMSStatusCallback(t *testing.T) {
+	tt := []struct {
+		name       string
+		deliveryID string
+		callback   string
+	}{
+		{
+			name:       "Untracked message",
+			deliveryID: "",
+			callback:   "",
+		},
+		{
+			name:       "Tracked message",
+			deliveryID: "delivery-id",
+			callback:   "https://auth.example.com/api/v1/delivery/twilio?deliveryID=delivery-id",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var callback string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				callback = r.FormValue("StatusCallback")
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer srv.Close()
+
+			ctx := msgdelivery.NewContext(context.Background(), tc.deliveryID)
+			c := NewClient(
+				WithConfig(Config{
+					baseURL:    srv.URL,
+					accountSID: "accountSID",
+					authToken:  "authToken",
+					smsSender:  "+15555555555",
+				}),
+				WithStatusCallback("https://auth.example.com/api/v1/delivery/twilio"),
+			)
+
+			if err := c.SMS(ctx, "+17777777777", "hello world"); err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+			if callback != tc.callback {
+				t.Errorf("incorrect status callback, want '%s' got '%s'", tc.callback, callback)
+			}
+		})
+	}
+}
+
+func TestTwilio_SMSSender(t *testing.T) {
+	tt := []struct {
+		name     string
+		sender   auth.MessageSender
+		senderID string
+		phone    string
+		from     string
+	}{
+		{
+			name:  "Default sender",
+			phone: "+442071838750",
+			from:  "+15555555555",
+		},
+		{
+			name:     "Sender ID",
+			senderID: "Example",
+			phone:    "+442071838750",
+			from:     "Example",
+		},
+		{
+			name:   "Message sender",
+			sender: auth.MessageSender{SMSSender: "Partner"},
+			phone:  "+442071838750",
+			from:   "Partner",
+		},
+		{
+			name:     "Numeric sender in regions rejecting sender IDs",
+			sender:   auth.MessageSender{SMSSender: "Partner"},
+			senderID: "Example",
+			phone:    "+14155552671",
+			from:     "+15555555555",
+		},
+		{
+			name:   "Numeric message sender in regions rejecting sender IDs",
+			sender: auth.MessageSender{SMSSender: "+16666666666"},
+			phone:  "+14155552671",
+			from:   "+16666666666",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var from string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				from = r.FormValue("From")
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer srv.Close()
+
+			ctx := msgsender.NewContext(context.Background(), tc.sender)
+			c := NewClient(
+				WithConfig(Config{
+					baseURL:    srv.URL,
+					accountSID: "accountSID",
+					authToken:  "authToken",
+					smsSender:  "+15555555555",
+				}),
+				WithSenderID(tc.senderID, []string{"us", "CA"}),
+			)
+
+			if err := c.SMS(ctx, tc.phone, "hello world"); err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+			if from != tc.from {
+				t.Errorf("incorrect sender, want '%s' got '%s'", tc.from, from)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package userimport
+
+import (
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// New returns a new Importer. The RepositoryManager's UserRepository
+// must be configured with a HashedPassword to store exported hashes.
+func New(options ...ConfigOption) *Importer {
+	i := Importer{
+		logger: log.NewNopLogger(),
+	}
+
+	for _, opt := range options {
+		opt(&i)
+	}
+
+	return &i
+}
+
+// ConfigOption configures the Importer.
+type ConfigOption func(*Importer)
+
+// WithLogger configures the Importer with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(i *Importer) {
+		i.logger = l
+	}
+}
+
+// WithRepoManager configures the Importer with a RepositoryManager.
+func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
+	return func(i *Importer) {
+		i.repoMngr = repoMngr
+	}
+}
+
+// WithDryRun validates records and checks for duplicates
+// without creating Users.
+func WithDryRun(dryRun bool) ConfigOption {
+	return func(i *Importer) {
+		i.dryRun = dryRun
+	}
+}
+
+// WithStopOnDuplicate aborts the import on the first duplicate
+// record instead of skipping it.
+func WithStopOnDuplicate(stop bool) ConfigOption {
+	return func(i *Importer) {
+		i.stopOnDuplicate = stop
+	}
+}
+
+// WithProgress logs progress after every n records.
+func WithProgress(n int) ConfigOption {
+	return func(i *Importer) {
+		i.progressEvery = n
+	}
+}
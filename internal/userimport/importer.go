@@ -0,0 +1,193 @@
+// Package userimport migrates users exported from other authentication
+// systems into the UserRepository.
+package userimport
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+)
+
+// errDuplicate is returned for records matching an existing user
+// or an earlier record in the same export.
+var errDuplicate = errors.New("user already exists")
+
+// Summary reports the outcome of an import.
+type Summary struct {
+	// Total is the number of records processed.
+	Total int
+	// Imported is the number of users created, or which would be
+	// created during a dry run.
+	Imported int
+	// Skipped is the number of duplicate records.
+	Skipped int
+	// Invalid is the number of records failing validation.
+	Invalid int
+	// Errors describes each record which was not imported.
+	Errors []*RecordError
+}
+
+// RecordError describes why a record was not imported.
+type RecordError struct {
+	Line int
+	Err  error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %v: %v", e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Importer creates Users from exported records.
+type Importer struct {
+	logger          log.Logger
+	repoMngr        auth.RepositoryManager
+	dryRun          bool
+	stopOnDuplicate bool
+	progressEvery   int
+}
+
+// Run imports records in order. Invalid and duplicate records are
+// skipped and reported in the Summary. Storage failures abort the
+// import, as do duplicates if the Importer is configured to stop on them.
+func (i *Importer) Run(ctx context.Context, records []*Record) (*Summary, error) {
+	summary := &Summary{}
+	seen := make(map[string]int)
+
+	for _, record := range records {
+		summary.Total++
+
+		err := i.importRecord(ctx, record, seen)
+		switch {
+		case err == nil:
+			summary.Imported++
+		case errors.Is(err, errDuplicate):
+			summary.Skipped++
+			summary.Errors = append(summary.Errors, &RecordError{Line: record.Line, Err: err})
+			if i.stopOnDuplicate {
+				return summary, &RecordError{Line: record.Line, Err: err}
+			}
+		case auth.DomainError(err) != nil:
+			summary.Invalid++
+			summary.Errors = append(summary.Errors, &RecordError{Line: record.Line, Err: err})
+		default:
+			return summary, &RecordError{Line: record.Line, Err: err}
+		}
+
+		if i.progressEvery > 0 && summary.Total%i.progressEvery == 0 {
+			i.logProgress("import in progress", summary, len(records))
+		}
+	}
+
+	i.logProgress("import complete", summary, len(records))
+	return summary, nil
+}
+
+// importRecord validates a record and creates its User unless the
+// record duplicates an existing identity.
+func (i *Importer) importRecord(ctx context.Context, record *Record, seen map[string]int) error {
+	user, err := toUser(record)
+	if err != nil {
+		return err
+	}
+
+	identities := []struct {
+		attribute string
+		value     string
+	}{
+		{"Email", user.Email.String},
+		{"Phone", user.Phone.String},
+	}
+	for _, identity := range identities {
+		if identity.value == "" {
+			continue
+		}
+
+		if line, ok := seen[identity.value]; ok {
+			return fmt.Errorf("%w: %s duplicates record %v", errDuplicate, identity.attribute, line)
+		}
+
+		_, err = i.repoMngr.User().ByIdentity(ctx, identity.attribute, identity.value)
+		if err == nil {
+			return fmt.Errorf("%w: %s is registered", errDuplicate, identity.attribute)
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("cannot check user identity: %w", err)
+		}
+	}
+
+	for _, identity := range identities {
+		if identity.value != "" {
+			seen[identity.value] = record.Line
+		}
+	}
+
+	if i.dryRun {
+		return nil
+	}
+
+	return i.repoMngr.User().Create(ctx, user)
+}
+
+func (i *Importer) logProgress(message string, summary *Summary, total int) {
+	level.Info(i.logger).Log(
+		"message", message,
+		"processed", summary.Total,
+		"total", total,
+		"imported", summary.Imported,
+		"skipped", summary.Skipped,
+		"invalid", summary.Invalid,
+		"dry_run", i.dryRun,
+		"source", "userimport.Run",
+	)
+}
+
+// toUser validates a record and converts it to a User. Imported Users
+// are verified as their addresses were verified by the original system.
+// Records without a password hash create passwordless Users who login
+// with OTP codes.
+func toUser(record *Record) (*auth.User, error) {
+	email := strings.ToLower(strings.TrimSpace(record.Email))
+	phone := strings.TrimSpace(record.Phone)
+	hash := strings.TrimSpace(record.PasswordHash)
+
+	if email == "" && phone == "" {
+		return nil, auth.ErrInvalidField("email or phone is required")
+	}
+	if email != "" && !contactchecker.IsEmailValid(email) {
+		return nil, auth.ErrInvalidField("email address is invalid")
+	}
+	if phone != "" && !contactchecker.IsPhoneValid(phone) {
+		return nil, auth.ErrInvalidField("phone number is invalid")
+	}
+	phone = contactchecker.NormalizePhone(phone)
+	if hash != "" {
+		if err := (&HashedPassword{}).OKForUser(hash); err != nil {
+			return nil, err
+		}
+	}
+
+	return &auth.User{
+		Email: sql.NullString{
+			String: email,
+			Valid:  email != "",
+		},
+		Phone: sql.NullString{
+			String: phone,
+			Valid:  phone != "",
+		},
+		Password:   hash,
+		IsVerified: true,
+	}, nil
+}
@@ -0,0 +1,168 @@
+package userimport
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/test"
+)
+
+const testHash = "$2a$10$zURdae3ekOWKobmadhWdROZLolGAIWrCEzjSfegV6Y/nsxJ1wqM2y" // nolint
+
+func TestUserImport_ReadCSV(t *testing.T) {
+	export := "Phone,Email,Password_Hash,Name\n" +
+		"+6594867353,jane@example.com," + testHash + ",Jane\n" +
+		",john@example.com,,John\n"
+
+	records, err := ReadCSV(strings.NewReader(export))
+	if err != nil {
+		t.Fatal("failed to read CSV:", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("incorrect record count, want 2 got %v", len(records))
+	}
+	if records[0].Phone != "+6594867353" || records[0].PasswordHash != testHash {
+		t.Errorf("incorrect record: %+v", records[0])
+	}
+	if records[1].Email != "john@example.com" || records[1].Line != 2 {
+		t.Errorf("incorrect record: %+v", records[1])
+	}
+
+	_, err = ReadCSV(strings.NewReader("name\nJane\n"))
+	if err == nil {
+		t.Error("expected error for CSV without identity columns")
+	}
+}
+
+func TestUserImport_ReadJSON(t *testing.T) {
+	export := `[
+		{"email": "jane@example.com", "password_hash": "` + testHash + `"},
+		{"phone": "+6594867353"}
+	]`
+
+	records, err := ReadJSON(strings.NewReader(export))
+	if err != nil {
+		t.Fatal("failed to read JSON:", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("incorrect record count, want 2 got %v", len(records))
+	}
+	if records[1].Phone != "+6594867353" || records[1].Line != 2 {
+		t.Errorf("incorrect record: %+v", records[1])
+	}
+}
+
+func TestUserImport_Run(t *testing.T) {
+	records := []*Record{
+		{Line: 1, Email: "jane@example.com", PasswordHash: testHash},
+		{Line: 2, Phone: "+6594867353"},
+		{Line: 3, Email: "JANE@example.com"},
+		{Line: 4, Email: "john"},
+		{Line: 5, Email: "john@example.com", PasswordHash: "swordfish"},
+		{Line: 6},
+	}
+
+	tt := []struct {
+		name            string
+		dryRun          bool
+		stopOnDuplicate bool
+		userFn          func() (*auth.User, error)
+		hasErr          bool
+		imported        int
+		skipped         int
+		invalid         int
+		createCalls     int
+	}{
+		{
+			name: "Imports valid records",
+			userFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+			imported:    2,
+			skipped:     1,
+			invalid:     3,
+			createCalls: 2,
+		},
+		{
+			name:   "Dry run does not create users",
+			dryRun: true,
+			userFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+			imported: 2,
+			skipped:  1,
+			invalid:  3,
+		},
+		{
+			name: "Skips existing users",
+			userFn: func() (*auth.User, error) {
+				return &auth.User{}, nil
+			},
+			skipped: 3,
+			invalid: 3,
+		},
+		{
+			name:            "Stops on duplicate",
+			stopOnDuplicate: true,
+			userFn: func() (*auth.User, error) {
+				return nil, sql.ErrNoRows
+			},
+			hasErr:      true,
+			imported:    2,
+			skipped:     1,
+			createCalls: 2,
+		},
+		{
+			name: "Aborts on storage failure",
+			userFn: func() (*auth.User, error) {
+				return nil, fmt.Errorf("database connection error")
+			},
+			hasErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			userRepo := &test.UserRepository{ByIdentityFn: tc.userFn}
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return userRepo
+				},
+			}
+			importer := New(
+				WithLogger(&test.Logger{}),
+				WithRepoManager(repoMngr),
+				WithDryRun(tc.dryRun),
+				WithStopOnDuplicate(tc.stopOnDuplicate),
+			)
+
+			summary, err := importer.Run(context.Background(), records)
+			if tc.hasErr && err == nil {
+				t.Error("expected error, got nil")
+			}
+			if !tc.hasErr && err != nil {
+				t.Error("expected nil error, got", err)
+			}
+
+			if summary.Imported != tc.imported {
+				t.Errorf("incorrect imported count, want %v got %v", tc.imported, summary.Imported)
+			}
+			if summary.Skipped != tc.skipped {
+				t.Errorf("incorrect skipped count, want %v got %v", tc.skipped, summary.Skipped)
+			}
+			if summary.Invalid != tc.invalid {
+				t.Errorf("incorrect invalid count, want %v got %v", tc.invalid, summary.Invalid)
+			}
+			if userRepo.Calls.Create != tc.createCalls {
+				t.Errorf("incorrect UserRepository.Create() call count, want %v got %v",
+					tc.createCalls, userRepo.Calls.Create)
+			}
+		})
+	}
+}
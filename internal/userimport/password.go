@@ -0,0 +1,37 @@
+package userimport
+
+import (
+	"golang.org/x/crypto/bcrypt"
+
+	auth "github.com/fmitra/authenticator"
+)
+
+// HashedPassword is an auth.PasswordService for passwords which have
+// already been hashed by another system. It is used to store exported
+// bcrypt hashes as is through the UserRepository.
+type HashedPassword struct{}
+
+// Hash returns an exported hash unchanged.
+func (p *HashedPassword) Hash(hash string) ([]byte, error) {
+	return []byte(hash), nil
+}
+
+// Validate validates if a submitted password is valid for a
+// stored password hash.
+func (p *HashedPassword) Validate(user *auth.User, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+}
+
+// Rehash does not rehash exported hashes. They are rehashed by
+// the PasswordService of the API when Users log in.
+func (p *HashedPassword) Rehash(user *auth.User, password string, isAPI bool) ([]byte, error) {
+	return nil, nil
+}
+
+// OKForUser checks if an exported hash is a bcrypt hash.
+func (p *HashedPassword) OKForUser(hash string) error {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return auth.ErrInvalidField("password hash must be a bcrypt hash")
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package userimport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Record is a user exported from another authentication system.
+type Record struct {
+	// Line is the position of the record in the export, starting at 1.
+	Line         int    `json:"-"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone"`
+	PasswordHash string `json:"password_hash"`
+}
+
+// ReadCSV reads records from a CSV export. The first row must be a
+// header naming the email, phone and password_hash columns. Columns
+// may appear in any order and unrecognized columns are ignored.
+func ReadCSV(r io.Reader) ([]*Record, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	_, hasEmail := columns["email"]
+	_, hasPhone := columns["phone"]
+	if !hasEmail && !hasPhone {
+		return nil, fmt.Errorf("CSV header must include an email or phone column")
+	}
+
+	field := func(row []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return row[i]
+	}
+
+	var records []*Record
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CSV record %v: %w", line, err)
+		}
+
+		records = append(records, &Record{
+			Line:         line,
+			Email:        field(row, "email"),
+			Phone:        field(row, "phone"),
+			PasswordHash: field(row, "password_hash"),
+		})
+	}
+
+	return records, nil
+}
+
+// ReadJSON reads records from a JSON export containing an array
+// of objects with email, phone and password_hash fields.
+func ReadJSON(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, fmt.Errorf("cannot read JSON records: %w", err)
+	}
+
+	for i, record := range records {
+		if record == nil {
+			return nil, fmt.Errorf("cannot read JSON record %v: record is null", i+1)
+		}
+		record.Line = i + 1
+	}
+
+	return records, nil
+}
@@ -1,37 +1,123 @@
 package webauthn
 
 import (
+	"fmt"
+	"time"
+
+	webauthnProto "github.com/duo-labs/webauthn/protocol"
 	webauthnLib "github.com/duo-labs/webauthn/webauthn"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/origin"
 )
 
-const defaultMaxDevices = 5
+const (
+	defaultMaxDevices       = 5
+	defaultTimeout          = time.Second
+	defaultSessionTTL       = time.Minute * 10
+	defaultChallengeTimeout = time.Minute * 2
+	defaultUserVerification = webauthnProto.VerificationPreferred
+)
 
 // NewService returns a new WebAuthn validator.
 func NewService(options ...ConfigOption) (auth.WebAuthnService, error) {
 	s := WebAuthn{
-		maxDevices: defaultMaxDevices,
+		maxDevices:       defaultMaxDevices,
+		timeout:          defaultTimeout,
+		sessionTTL:       defaultSessionTTL,
+		challengeTimeout: defaultChallengeTimeout,
+		userVerification: defaultUserVerification,
 	}
 
 	for _, opt := range options {
 		opt(&s)
 	}
 
-	lib, err := webauthnLib.New(&webauthnLib.Config{
-		RPDisplayName: s.displayName,
-		RPID:          s.domain,
-		RPOrigin:      s.requestOrigin,
-	})
+	switch s.userVerification {
+	case webauthnProto.VerificationRequired,
+		webauthnProto.VerificationPreferred,
+		webauthnProto.VerificationDiscouraged:
+	default:
+		return nil, fmt.Errorf("invalid user verification requirement: %s", s.userVerification)
+	}
+	if s.challengeTimeout > s.sessionTTL {
+		return nil, fmt.Errorf("challenge timeout %s exceeds session TTL %s", s.challengeTimeout, s.sessionTTL)
+	}
+
+	origins, err := parseOrigins(s.requestOrigin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request origin: %w", err)
+	}
+	s.origins = origins
+
+	lib, err := s.newLib(s.domain, firstOrigin(s.origins))
 	if err != nil {
 		return nil, err
 	}
 
 	s.lib = lib
 
+	// Relying parties listed for several origins are grouped by ID.
+	for _, rp := range s.extraParties {
+		pattern, err := rp.pattern()
+		if err != nil {
+			return nil, fmt.Errorf("invalid relying party %s: %w", rp.Origin, err)
+		}
+
+		i := 0
+		for i < len(s.relyingParties) && s.relyingParties[i].id != rp.ID {
+			i++
+		}
+		if i == len(s.relyingParties) {
+			s.relyingParties = append(s.relyingParties, relyingParty{id: rp.ID})
+		}
+		s.relyingParties[i].origins = append(s.relyingParties[i].origins, pattern)
+	}
+	for i := range s.relyingParties {
+		rp := &s.relyingParties[i]
+		if rp.lib, err = s.newLib(rp.id, firstOrigin(rp.origins)); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.appID != "" {
+		legacyLib, err := s.newLib(s.appID, firstOrigin(s.origins))
+		if err != nil {
+			return nil, err
+		}
+
+		s.legacyLib = legacyLib
+	}
+
 	return &s, nil
 }
 
+// newLib returns a WebAuthn library verifying credentials
+// scoped to an RP ID and requested from an origin.
+func (s *WebAuthn) newLib(rpID, rpOrigin string) (*webauthnLib.WebAuthn, error) {
+	return webauthnLib.New(&webauthnLib.Config{
+		RPDisplayName: s.displayName,
+		RPID:          rpID,
+		RPOrigin:      rpOrigin,
+		AuthenticatorSelection: webauthnProto.AuthenticatorSelection{
+			UserVerification: s.userVerification,
+		},
+		Timeout: int(s.challengeTimeout / time.Millisecond),
+	})
+}
+
+// firstOrigin returns the first origin without a wildcard, which
+// responses are verified against unless they name another allowed
+// origin. It is empty if there is none.
+func firstOrigin(patterns []origin.Pattern) string {
+	for _, p := range patterns {
+		if !p.IsWildcard() {
+			return p.String()
+		}
+	}
+	return ""
+}
+
 // ConfigOption configures the validator.
 type ConfigOption func(*WebAuthn)
 
@@ -56,13 +142,24 @@ func WithDomain(domain string) ConfigOption {
 	}
 }
 
-// WithRequestOrigin configures the validator with a request origin.
+// WithRequestOrigin configures the validator with the origins requests
+// are made from, as a comma separated list of origins or wildcard
+// patterns, e.g. `https://example.com,https://*.staging.example.com`.
 func WithRequestOrigin(origin string) ConfigOption {
 	return func(s *WebAuthn) {
 		s.requestOrigin = origin
 	}
 }
 
+// WithRelyingParties configures relying parties in addition to the
+// domain and request origin, chosen by the origin of each request so
+// that several frontends may register and use devices.
+func WithRelyingParties(rps []RelyingParty) ConfigOption {
+	return func(s *WebAuthn) {
+		s.extraParties = rps
+	}
+}
+
 // WithRepoManager configures the service with a new RepositoryManager.
 func WithRepoManager(repoMngr auth.RepositoryManager) ConfigOption {
 	return func(s *WebAuthn) {
@@ -77,3 +174,61 @@ func WithMaxDevices(max int) ConfigOption {
 		s.maxDevices = max
 	}
 }
+
+// WithTimeout configures the deadline for Redis operations.
+func WithTimeout(timeout time.Duration) ConfigOption {
+	return func(s *WebAuthn) {
+		s.timeout = timeout
+	}
+}
+
+// WithSessionTTL sets the time a client has to answer a registration
+// or login challenge.
+func WithSessionTTL(ttl time.Duration) ConfigOption {
+	return func(s *WebAuthn) {
+		s.sessionTTL = ttl
+	}
+}
+
+// WithChallengeTimeout sets the time clients are hinted to wait for
+// the user to interact with their device. It may not exceed the
+// session TTL.
+func WithChallengeTimeout(timeout time.Duration) ConfigOption {
+	return func(s *WebAuthn) {
+		s.challengeTimeout = timeout
+	}
+}
+
+// WithUserVerification sets the requirement for devices to verify the
+// user: `required`, `preferred` or `discouraged`.
+func WithUserVerification(requirement string) ConfigOption {
+	return func(s *WebAuthn) {
+		s.userVerification = webauthnProto.UserVerificationRequirement(requirement)
+	}
+}
+
+// WithMetadata configures the service with a MetadataService to
+// record the model and status of registered devices.
+func WithMetadata(md auth.MetadataService) ConfigOption {
+	return func(s *WebAuthn) {
+		s.metadata = md
+	}
+}
+
+// WithBlockCompromised rejects registration of authenticator models
+// which should no longer be trusted, such as revoked models. Otherwise
+// such devices are registered and flagged through their status.
+func WithBlockCompromised(block bool) ConfigOption {
+	return func(s *WebAuthn) {
+		s.blockCompromised = block
+	}
+}
+
+// WithAppID configures the FIDO U2F AppID of imported legacy keys,
+// e.g. `https://example.com/app-id.json`. Logins request the appid
+// extension so keys registered under the AppID remain usable.
+func WithAppID(appID string) ConfigOption {
+	return func(s *WebAuthn) {
+		s.appID = appID
+	}
+}
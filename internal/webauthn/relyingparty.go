@@ -0,0 +1,161 @@
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	webauthnProto "github.com/duo-labs/webauthn/protocol"
+
+	"github.com/fmitra/authenticator/internal/origin"
+)
+
+// RelyingParty is a frontend devices are registered with and log in
+// to. Its ID is the domain credentials are scoped to, which must be
+// the host of its origin or a parent domain of it. The origin may be
+// a wildcard pattern, e.g. `https://*.example.com`.
+type RelyingParty struct {
+	ID     string
+	Origin string
+}
+
+// relyingParty is a relying party with the origins it may be used from.
+type relyingParty struct {
+	id      string
+	origins []origin.Pattern
+	// lib verifies responses from the first origin.
+	lib Webauthner
+}
+
+// allows reports whether the relying party may be used from an origin.
+func (rp *relyingParty) allows(o string) bool {
+	for _, p := range rp.origins {
+		if p.Match(o) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRelyingParties parses a comma separated list of relying parties
+// formatted as `<origin>=<rp ID>`, e.g.
+// `https://app.example.com=example.com,https://example.org=example.org`.
+// A relying party may be listed once for every origin it is used from.
+func ParseRelyingParties(s string) ([]RelyingParty, error) {
+	var rps []RelyingParty
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !strings.Contains(parts[0], "://") {
+			return nil, fmt.Errorf("invalid relying party %q", entry)
+		}
+
+		rp := RelyingParty{
+			Origin: origin.Normalize(parts[0]),
+			ID:     strings.ToLower(strings.TrimSpace(parts[1])),
+		}
+		if _, err := rp.pattern(); err != nil {
+			return nil, fmt.Errorf("invalid relying party %q: %w", entry, err)
+		}
+
+		rps = append(rps, rp)
+	}
+	return rps, nil
+}
+
+// pattern returns the origin pattern of the relying party, or an error
+// if the RP ID may not be used from it.
+func (rp RelyingParty) pattern() (origin.Pattern, error) {
+	p, err := origin.ParsePattern(rp.Origin)
+	if err != nil {
+		return p, err
+	}
+
+	host := p.Hostname()
+	if rp.ID == "" || (host != rp.ID && !strings.HasSuffix(host, "."+rp.ID)) {
+		return p, fmt.Errorf("RP ID must be the origin's host or a parent domain of it")
+	}
+
+	return p, nil
+}
+
+// parseOrigins parses a comma separated list of origin patterns.
+func parseOrigins(s string) ([]origin.Pattern, error) {
+	var patterns []origin.Pattern
+	for _, entry := range strings.Split(s, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		p, err := origin.ParsePattern(entry)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// relyingParty returns the ID and library of the relying party a request
+// is made to, chosen by the origin in context. Requests from other
+// origins are served by the default relying party.
+func (w *WebAuthn) relyingParty(ctx context.Context) (string, Webauthner) {
+	rp := w.party(ctx)
+	return rp.id, rp.lib
+}
+
+func (w *WebAuthn) party(ctx context.Context) *relyingParty {
+	o := origin.FromContext(ctx)
+	for i := range w.relyingParties {
+		if w.relyingParties[i].allows(o) {
+			return &w.relyingParties[i]
+		}
+	}
+	return &relyingParty{id: w.domain, origins: w.origins, lib: w.lib}
+}
+
+// verifier returns the library verifying a response to a challenge of
+// the relying party a request is made to. The signed client data of
+// the response names the origin it was made from, and responses from
+// any origin allowed for the relying party are verified against it.
+func (w *WebAuthn) verifier(ctx context.Context, body []byte) Webauthner {
+	rp := w.party(ctx)
+
+	o := clientDataOrigin(body)
+	if o == "" || !rp.allows(o) {
+		return rp.lib
+	}
+
+	lib, err := w.newLib(rp.id, o)
+	if err != nil {
+		return rp.lib
+	}
+	return lib
+}
+
+// clientDataOrigin returns the origin named in the client data of a
+// registration or login response, or an empty string if it cannot
+// be read. The origin is not verified.
+func clientDataOrigin(body []byte) string {
+	var resp struct {
+		Response struct {
+			ClientDataJSON webauthnProto.URLEncodedBase64 `json:"clientDataJSON"`
+		} `json:"response"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&resp); err != nil {
+		return ""
+	}
+
+	var clientData webauthnProto.CollectedClientData
+	if err := json.Unmarshal(resp.Response.ClientDataJSON, &clientData); err != nil {
+		return ""
+	}
+
+	return origin.Normalize(clientData.Origin)
+}
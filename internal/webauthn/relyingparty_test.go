@@ -0,0 +1,243 @@
+package webauthn
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	webauthnLib "github.com/duo-labs/webauthn/webauthn"
+
+	"github.com/fmitra/authenticator/internal/origin"
+)
+
+func TestWebAuthn_ParseRelyingParties(t *testing.T) {
+	tt := []struct {
+		name     string
+		value    string
+		parties  []RelyingParty
+		hasError bool
+	}{
+		{
+			name:    "Empty",
+			value:   "",
+			parties: nil,
+		},
+		{
+			name:  "Several parties",
+			value: "https://App.example.com/=example.com, https://example.org=example.org",
+			parties: []RelyingParty{
+				{Origin: "https://app.example.com", ID: "example.com"},
+				{Origin: "https://example.org", ID: "example.org"},
+			},
+		},
+		{
+			name:  "Origin with port",
+			value: "http://localhost:3000=localhost",
+			parties: []RelyingParty{
+				{Origin: "http://localhost:3000", ID: "localhost"},
+			},
+		},
+		{
+			name:  "Wildcard origin",
+			value: "https://*.example.org=example.org",
+			parties: []RelyingParty{
+				{Origin: "https://*.example.org", ID: "example.org"},
+			},
+		},
+		{
+			name:     "Missing RP ID",
+			value:    "https://app.example.com",
+			hasError: true,
+		},
+		{
+			name:     "Origin without scheme",
+			value:    "app.example.com=example.com",
+			hasError: true,
+		},
+		{
+			name:     "Origin with path",
+			value:    "https://app.example.com/login=example.com",
+			hasError: true,
+		},
+		{
+			name:     "RP ID of another domain",
+			value:    "https://app.example.com=example.org",
+			hasError: true,
+		},
+		{
+			name:     "RP ID matching a suffix of the host",
+			value:    "https://badexample.com=example.com",
+			hasError: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			parties, err := ParseRelyingParties(tc.value)
+			if tc.hasError {
+				if err == nil {
+					t.Error("expected relying parties to be rejected")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+
+			if len(parties) != len(tc.parties) {
+				t.Fatalf("incorrect relying parties, want %v got %v", tc.parties, parties)
+			}
+			for i := range parties {
+				if parties[i] != tc.parties[i] {
+					t.Errorf("incorrect relying party, want %v got %v", tc.parties[i], parties[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWebAuthn_RelyingPartyByOrigin(t *testing.T) {
+	svc, err := NewService(
+		WithDisplayName("Authenticator"),
+		WithDomain("example.com"),
+		WithRequestOrigin("https://example.com"),
+		WithRelyingParties([]RelyingParty{
+			{Origin: "https://example.org", ID: "example.org"},
+		}),
+	)
+	if err != nil {
+		t.Fatal("failed to create service:", err)
+	}
+	w := svc.(*WebAuthn)
+
+	tt := []struct {
+		name   string
+		origin string
+		rpID   string
+	}{
+		{
+			name:   "Configured origin",
+			origin: "https://example.org",
+			rpID:   "example.org",
+		},
+		{
+			name:   "Default origin",
+			origin: "https://example.com",
+			rpID:   "example.com",
+		},
+		{
+			name:   "Unknown origin",
+			origin: "https://evil.com",
+			rpID:   "example.com",
+		},
+		{
+			name:   "No origin",
+			origin: "",
+			rpID:   "example.com",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := origin.NewContext(context.Background(), tc.origin)
+			rpID, lib := w.relyingParty(ctx)
+			if rpID != tc.rpID {
+				t.Errorf("incorrect RP ID, want %s got %s", tc.rpID, rpID)
+			}
+			if lib == nil {
+				t.Error("expected webauthn library")
+			}
+			if tc.rpID == "example.com" && lib != w.lib {
+				t.Error("expected default webauthn library")
+			}
+		})
+	}
+
+	_, err = NewService(
+		WithDomain("example.com"),
+		WithRequestOrigin("https://example.com"),
+		WithRelyingParties([]RelyingParty{
+			{Origin: "https://example.org", ID: "example.com"},
+		}),
+	)
+	if err == nil {
+		t.Error("expected invalid relying party to be rejected")
+	}
+}
+
+func TestWebAuthn_VerifierByClientDataOrigin(t *testing.T) {
+	svc, err := NewService(
+		WithDisplayName("Authenticator"),
+		WithDomain("example.com"),
+		WithRequestOrigin("https://example.com, https://*.example.com"),
+		WithRelyingParties([]RelyingParty{
+			{Origin: "https://example.org", ID: "example.org"},
+			{Origin: "https://app.example.org", ID: "example.org"},
+		}),
+	)
+	if err != nil {
+		t.Fatal("failed to create service:", err)
+	}
+	w := svc.(*WebAuthn)
+
+	if len(w.relyingParties) != 1 {
+		t.Fatalf("expected relying parties to be grouped by ID, got %d", len(w.relyingParties))
+	}
+
+	tt := []struct {
+		name       string
+		origin     string
+		dataOrigin string
+		rpOrigin   string
+	}{
+		{
+			name:       "Default origin",
+			origin:     "https://example.com",
+			dataOrigin: "https://example.com",
+			rpOrigin:   "https://example.com",
+		},
+		{
+			name:       "Wildcard origin",
+			origin:     "https://staging.example.com",
+			dataOrigin: "https://staging.example.com",
+			rpOrigin:   "https://staging.example.com",
+		},
+		{
+			name:       "Second origin of relying party",
+			origin:     "https://app.example.org",
+			dataOrigin: "https://app.example.org",
+			rpOrigin:   "https://app.example.org",
+		},
+		{
+			name:       "Origin of another relying party",
+			origin:     "https://example.com",
+			dataOrigin: "https://example.org",
+			rpOrigin:   "https://example.com",
+		},
+		{
+			name:       "Unknown origin",
+			origin:     "https://evil.com",
+			dataOrigin: "https://evil.com",
+			rpOrigin:   "https://example.com",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			clientData := fmt.Sprintf(`{"type":"webauthn.get","challenge":"abc","origin":%q}`, tc.dataOrigin)
+			body := fmt.Sprintf(`{"response":{"clientDataJSON":%q}}`,
+				base64.RawURLEncoding.EncodeToString([]byte(clientData)),
+			)
+
+			ctx := origin.NewContext(context.Background(), tc.origin)
+			lib, ok := w.verifier(ctx, []byte(body)).(*webauthnLib.WebAuthn)
+			if !ok {
+				t.Fatal("expected webauthn library")
+			}
+			if lib.Config.RPOrigin != tc.rpOrigin {
+				t.Errorf("incorrect RP origin, want %s got %s", tc.rpOrigin, lib.Config.RPOrigin)
+			}
+		})
+	}
+}
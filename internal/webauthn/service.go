@@ -3,16 +3,44 @@ package webauthn
 import (
 	"bytes"
 	"context"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"net/http"
 	"time"
 
 	webauthnProto "github.com/duo-labs/webauthn/protocol"
+	"github.com/duo-labs/webauthn/protocol/webauthncose"
 	webauthnLib "github.com/duo-labs/webauthn/webauthn"
+	"github.com/fxamacker/cbor/v2"
 	"github.com/go-redis/redis/v8"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/origin"
+)
+
+// Backup flags of authenticator data, set by authenticators syncing
+// credentials across devices such as Apple and Google passkeys.
+const (
+	// flagBackupEligible (BE) is set if a credential may be synced.
+	flagBackupEligible webauthnProto.AuthenticatorFlags = 1 << 3
+	// flagBackedUp (BS) is set while a credential is synced.
+	flagBackedUp webauthnProto.AuthenticatorFlags = 1 << 4
+)
+
+// COSE key parameters of a P-256 public key (RFC 8152).
+const (
+	coseKeyType    = 1
+	coseAlgorithm  = 3
+	coseCurve      = -1
+	coseX          = -2
+	coseY          = -3
+	coseKeyTypeEC2 = 2
+	coseCurveP256  = 1
 )
 
 // Webauthner is an interface to duo-labs/webauthn
@@ -27,9 +55,16 @@ type Webauthner interface {
 type rediser interface {
 	Get(ctx context.Context, key string) *redis.StringCmd
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
 	Close() error
 }
 
+// txPipeliner is implemented by go-redis clients supporting
+// MULTI/EXEC transactions.
+type txPipeliner interface {
+	TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+}
+
 // WebAuthn is a implements the WebAuthn authentication protocol.
 // Under the hood it defers the actual validation to the /duo-labs/webauthn
 // library and wraps the service's domain entities to provide compatibility
@@ -45,14 +80,44 @@ type WebAuthn struct {
 	// requestOrigin is the origin domain for
 	// authentication requests.
 	requestOrigin string
+	// origins are the parsed request origins.
+	origins []origin.Pattern
 	// lib is the underlying WebAuthn library
 	// used by this adapter.
 	lib Webauthner
+	// extraParties are the configured relying parties
+	// in addition to the domain.
+	extraParties []RelyingParty
+	// relyingParties are the relying parties other
+	// than the domain.
+	relyingParties []relyingParty
 	// db is a redis DB to store sessions.
 	db rediser
+	// timeout is the deadline for Redis operations.
+	timeout time.Duration
+	// sessionTTL is the time a client has to answer a challenge
+	// before its session expires.
+	sessionTTL time.Duration
+	// challengeTimeout is the time a client is hinted to wait
+	// for the user to interact with their device.
+	challengeTimeout time.Duration
+	// userVerification is the requirement for a device to verify
+	// the user, e.g. through a PIN or biometrics.
+	userVerification webauthnProto.UserVerificationRequirement
 	// repoMngr is an instance of a RepositoryManager
 	// to manage domain entitites.
 	repoMngr auth.RepositoryManager
+	// metadata resolves authenticator models during
+	// registration.
+	metadata auth.MetadataService
+	// blockCompromised rejects registration of authenticator
+	// models which should no longer be trusted.
+	blockCompromised bool
+	// appID is the FIDO U2F AppID of imported legacy keys.
+	appID string
+	// legacyLib verifies logins of legacy keys signed with
+	// the appid extension.
+	legacyLib Webauthner
 }
 
 // BeginSignUp attempts to register a new WebAuthn capable device for a user.
@@ -70,14 +135,21 @@ func (w *WebAuthn) BeginSignUp(ctx context.Context, user *auth.User) ([]byte, er
 
 	wu := User{User: user}
 
-	credentialOptions, session, err := w.lib.BeginRegistration(&wu)
+	residentKey := false
+	_, lib := w.relyingParty(ctx)
+	credentialOptions, session, err := lib.BeginRegistration(&wu,
+		webauthnLib.WithAuthenticatorSelection(webauthnProto.AuthenticatorSelection{
+			RequireResidentKey: &residentKey,
+			UserVerification:   w.userVerification,
+		}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("webauthn registration initialization failed: %w",
 			auth.ErrWebAuthn(err.Error()),
 		)
 	}
 
-	return w.prepareChallenge(ctx, user, session, credentialOptions)
+	return w.prepareChallenge(ctx, newSessionKey(user.ID), session, credentialOptions)
 }
 
 // FinishSignUp attempts to verify a registration attempt for a new WebAuthn
@@ -85,36 +157,91 @@ func (w *WebAuthn) BeginSignUp(ctx context.Context, user *auth.User) ([]byte, er
 func (w *WebAuthn) FinishSignUp(ctx context.Context, user *auth.User, r *http.Request) (*auth.Device, error) {
 	wu := User{User: user}
 
-	session, err := w.retrieveSession(ctx, user)
+	session, err := w.retrieveSession(ctx, newSessionKey(user.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := bufferBody(r)
 	if err != nil {
 		return nil, err
 	}
 
-	credential, err := w.lib.FinishRegistration(&wu, *session, r)
+	lib := w.verifier(ctx, body)
+	credential, err := lib.FinishRegistration(&wu, *session, r)
 	if err != nil {
 		return nil, fmt.Errorf("webauthn registration failed: %w",
 			auth.ErrWebAuthn(err.Error()),
 		)
 	}
 
+	flags, err := registrationFlags(body)
+	if err != nil {
+		return nil, err
+	}
+
 	device := auth.Device{
-		UserID:    user.ID,
-		ClientID:  credential.ID,
-		PublicKey: credential.PublicKey,
-		AAGUID:    credential.Authenticator.AAGUID,
-		SignCount: credential.Authenticator.SignCount,
+		UserID:         user.ID,
+		ClientID:       credential.ID,
+		PublicKey:      credential.PublicKey,
+		AAGUID:         credential.Authenticator.AAGUID,
+		SignCount:      credential.Authenticator.SignCount,
+		BackupEligible: flags&flagBackupEligible != 0,
+		BackedUp:       flags&flagBackedUp != 0,
 	}
 
-	var enableDeviceFn func(ctx context.Context, user *auth.User, device *auth.Device) error
-	if user.IsDeviceAllowed {
-		enableDeviceFn = w.enableAdditionalDevice
-	} else {
-		enableDeviceFn = w.enableNewDevice
+	if w.metadata != nil {
+		if md := w.metadata.Lookup(device.AAGUID); md != nil {
+			if md.Compromised && w.blockCompromised {
+				return nil, auth.ErrWebAuthn(fmt.Sprintf(
+					"authenticator model %s is not trusted", md.Description,
+				))
+			}
+			device.Model = md.Description
+			device.MetadataStatus = md.Status
+		}
+	}
+
+	if err = w.enableDevice(ctx, user, &device); err != nil {
+		return nil, err
 	}
 
-	err = enableDeviceFn(ctx, user, &device)
+	return &device, nil
+}
+
+// ImportU2F registers a device from a legacy FIDO U2F registration.
+// Its public key is converted to a COSE key and logins are verified
+// against the AppID it was registered with.
+func (w *WebAuthn) ImportU2F(ctx context.Context, user *auth.User, reg *auth.U2FRegistration) (*auth.Device, error) {
+	if w.legacyLib == nil {
+		return nil, auth.ErrWebAuthn("U2F app ID is not configured")
+	}
+
+	publicKey, err := u2fPublicKey(reg.PublicKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create device: %w", err)
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrInvalidField("invalid U2F public key"))
+	}
+
+	_, err = w.repoMngr.Device().ByClientID(ctx, user.ID, reg.KeyHandle)
+	if err == nil {
+		return nil, auth.ErrBadRequest("key handle is already registered")
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to check devices: %w", err)
+	}
+
+	// U2F keys do not report an AAGUID.
+	device := auth.Device{
+		UserID:    user.ID,
+		ClientID:  reg.KeyHandle,
+		PublicKey: publicKey,
+		Name:      reg.Name,
+		AAGUID:    make([]byte, 16),
+		SignCount: reg.Counter,
+	}
+
+	if err = w.enableDevice(ctx, user, &device); err != nil {
+		return nil, err
 	}
 
 	return &device, nil
@@ -132,19 +259,110 @@ func (w *WebAuthn) BeginLogin(ctx context.Context, user *auth.User) ([]byte, err
 		Devices: devices,
 	}
 
-	assertion, session, err := w.lib.BeginLogin(&wu)
+	var opts []webauthnLib.LoginOption
+	if w.appID != "" {
+		opts = append(opts, webauthnLib.WithAssertionExtensions(
+			webauthnProto.AuthenticationExtensions{"appid": w.appID},
+		))
+	}
+
+	_, lib := w.relyingParty(ctx)
+	assertion, session, err := lib.BeginLogin(&wu, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("webauthn login request failed: %w",
 			auth.ErrWebAuthn(err.Error()),
 		)
 	}
 
-	return w.prepareChallenge(ctx, user, session, assertion)
+	return w.prepareChallenge(ctx, newSessionKey(user.ID), session, assertion)
 }
 
 // FinishLogin determines if a user successfully proved ownership of their device,
 // thereby asserting their identity.
 func (w *WebAuthn) FinishLogin(ctx context.Context, user *auth.User, r *http.Request) error {
+	session, err := w.retrieveSession(ctx, newSessionKey(user.ID))
+	if err != nil {
+		return err
+	}
+
+	return w.finishLogin(ctx, user, session, r)
+}
+
+// BeginDiscoverableLogin attempts to authenticate a user who is not yet
+// identified. Any discoverable credential (passkey) may sign the challenge,
+// allowing browsers to offer passkeys through autofill (conditional mediation).
+// Its session is stored under the challenge, which the client returns in
+// its signed client data.
+func (w *WebAuthn) BeginDiscoverableLogin(ctx context.Context) ([]byte, error) {
+	challenge, err := webauthnProto.CreateChallenge()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webauthn challenge: %w", err)
+	}
+
+	rpID, _ := w.relyingParty(ctx)
+
+	// Without a password, the device is the only factor verifying
+	// the user so user verification is always required.
+	assertion := webauthnProto.CredentialAssertion{
+		Response: webauthnProto.PublicKeyCredentialRequestOptions{
+			Challenge:        challenge,
+			Timeout:          int(w.challengeTimeout / time.Millisecond),
+			RelyingPartyID:   rpID,
+			UserVerification: webauthnProto.VerificationRequired,
+		},
+	}
+	session := webauthnLib.SessionData{
+		Challenge:        challenge.String(),
+		UserVerification: webauthnProto.VerificationRequired,
+	}
+
+	return w.prepareChallenge(ctx, newDiscoverableSessionKey(session.Challenge), &session, assertion)
+}
+
+// FinishDiscoverableLogin determines if a discoverable credential signed
+// a challenge and returns the user owning it, identified by the user
+// handle returned by the device.
+func (w *WebAuthn) FinishDiscoverableLogin(ctx context.Context, r *http.Request) (*auth.User, error) {
+	body, err := bufferBody(r)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := webauthnProto.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrWebAuthn("invalid webauthn response"))
+	}
+
+	userHandle := parsed.Response.UserHandle
+	if len(userHandle) == 0 {
+		return nil, auth.ErrWebAuthn("credential is not discoverable")
+	}
+
+	sessionKey := newDiscoverableSessionKey(parsed.Response.CollectedClientData.Challenge)
+	session, err := w.retrieveSession(ctx, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := w.repoMngr.User().ByIdentity(ctx, "ID", string(userHandle))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrWebAuthn("credential is not registered"))
+	}
+	if !user.IsDeviceAllowed {
+		return nil, auth.ErrWebAuthn("credential is not registered")
+	}
+
+	session.UserID = userHandle
+	if err = w.finishLogin(ctx, user, session, r); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// finishLogin verifies a login session was signed by one of the user's
+// devices and updates the device's sign count.
+func (w *WebAuthn) finishLogin(ctx context.Context, user *auth.User, session *webauthnLib.SessionData, r *http.Request) error {
 	devices, err := w.repoMngr.Device().ByUserID(ctx, user.ID)
 	if err != nil {
 		return fmt.Errorf("%v: %w", err, auth.ErrWebAuthn("no devices found"))
@@ -155,12 +373,19 @@ func (w *WebAuthn) FinishLogin(ctx context.Context, user *auth.User, r *http.Req
 		Devices: devices,
 	}
 
-	session, err := w.retrieveSession(ctx, user)
+	body, err := bufferBody(r)
 	if err != nil {
 		return err
 	}
 
-	credential, err := w.lib.FinishLogin(&wu, *session, r)
+	// Legacy keys answering the appid extension sign with the
+	// AppID in place of the RP ID.
+	lib := w.verifier(ctx, body)
+	if w.legacyLib != nil && signedWithAppID(body, w.appID) {
+		lib = w.legacyLib
+	}
+
+	credential, err := lib.FinishLogin(&wu, *session, r)
 	if err != nil {
 		return fmt.Errorf("webauthn login failed: %w",
 			auth.ErrWebAuthn(err.Error()),
@@ -171,20 +396,24 @@ func (w *WebAuthn) FinishLogin(ctx context.Context, user *auth.User, r *http.Req
 		return auth.ErrWebAuthn("device is possibly cloned")
 	}
 
+	flags, err := loginFlags(body)
+	if err != nil {
+		return err
+	}
+
 	client, err := w.repoMngr.NewWithTransaction(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
 
-	deviceID := deviceID(devices, credential.ID)
-
 	_, err = client.WithAtomic(func() (interface{}, error) {
-		device, err := client.Device().GetForUpdate(ctx, deviceID)
+		device, err := client.Device().GetForUpdateByClientID(ctx, user.ID, credential.ID)
 		if err != nil {
 			return nil, err
 		}
 
 		device.SignCount = credential.Authenticator.SignCount
+		device.BackedUp = flags&flagBackedUp != 0
 		err = client.Device().Update(ctx, device)
 		if err != nil {
 			return nil, err
@@ -199,9 +428,11 @@ func (w *WebAuthn) FinishLogin(ctx context.Context, user *auth.User, r *http.Req
 	return nil
 }
 
-func (w *WebAuthn) retrieveSession(ctx context.Context, user *auth.User) (*webauthnLib.SessionData, error) {
-	sessionKey := newSessionKey(user.ID)
-	b, err := w.db.Get(ctx, sessionKey).Bytes()
+func (w *WebAuthn) retrieveSession(ctx context.Context, sessionKey string) (*webauthnLib.SessionData, error) {
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
+
+	b, err := w.consumeSession(ctx, sessionKey)
 	if err != nil {
 		return nil, fmt.Errorf("%v: %w", err, auth.ErrWebAuthn("webauthn session not started"))
 	}
@@ -215,7 +446,33 @@ func (w *WebAuthn) retrieveSession(ctx context.Context, user *auth.User) (*webau
 	return &session, nil
 }
 
-func (w *WebAuthn) prepareChallenge(ctx context.Context, user *auth.User, session *webauthnLib.SessionData, credentials interface{}) ([]byte, error) {
+// consumeSession reads and deletes a session so its challenge may only
+// be answered once. Clients supporting transactions do so atomically in
+// a single round trip.
+func (w *WebAuthn) consumeSession(ctx context.Context, sessionKey string) ([]byte, error) {
+	tx, ok := w.db.(txPipeliner)
+	if !ok {
+		b, err := w.db.Get(ctx, sessionKey).Bytes()
+		if err != nil {
+			return nil, err
+		}
+		return b, w.db.Del(ctx, sessionKey).Err()
+	}
+
+	var get *redis.StringCmd
+	_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, sessionKey)
+		pipe.Del(ctx, sessionKey)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	return get.Bytes()
+}
+
+func (w *WebAuthn) prepareChallenge(ctx context.Context, sessionKey string, session *webauthnLib.SessionData, credentials interface{}) ([]byte, error) {
 	credentialBytes, err := json.Marshal(credentials)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal webauthn credentials: %w", err)
@@ -226,9 +483,10 @@ func (w *WebAuthn) prepareChallenge(ctx context.Context, user *auth.User, sessio
 		return nil, fmt.Errorf("failed to marshal webauthn session: %w", err)
 	}
 
-	sessionKey := newSessionKey(user.ID)
-	expiresIn := time.Minute * 5
-	err = w.db.Set(ctx, sessionKey, sessionBytes, expiresIn).Err()
+	ctx, cancel := w.withTimeout(ctx)
+	defer cancel()
+
+	err = w.db.Set(ctx, sessionKey, sessionBytes, w.sessionTTL).Err()
 	if err != nil {
 		return nil, fmt.Errorf("failed to store webauthn login session: %w", err)
 	}
@@ -236,6 +494,23 @@ func (w *WebAuthn) prepareChallenge(ctx context.Context, user *auth.User, sessio
 	return credentialBytes, nil
 }
 
+// enableDevice stores a device, enabling device 2FA for users
+// registering their first device.
+func (w *WebAuthn) enableDevice(ctx context.Context, user *auth.User, device *auth.Device) error {
+	var enableDeviceFn func(ctx context.Context, user *auth.User, device *auth.Device) error
+	if user.IsDeviceAllowed {
+		enableDeviceFn = w.enableAdditionalDevice
+	} else {
+		enableDeviceFn = w.enableNewDevice
+	}
+
+	if err := enableDeviceFn(ctx, user, device); err != nil {
+		return fmt.Errorf("failed to create device: %w", err)
+	}
+
+	return nil
+}
+
 func (w *WebAuthn) enableAdditionalDevice(ctx context.Context, user *auth.User, device *auth.Device) error {
 	return w.repoMngr.Device().Create(ctx, device)
 }
@@ -279,17 +554,97 @@ func newSessionKey(userID string) string {
 	return fmt.Sprintf("%s-webauthn-session", userID)
 }
 
-func deviceID(devices []*auth.Device, credentialID []byte) string {
-	var deviceID string
-	{
-		// TODO Update repository to support querying
-		// by credential ID for updates.
-		for _, device := range devices {
-			if bytes.Equal(device.ClientID, credentialID) {
-				deviceID = device.ID
-				break
-			}
-		}
+func newDiscoverableSessionKey(challenge string) string {
+	return fmt.Sprintf("%s-webauthn-discoverable-session", challenge)
+}
+
+// withTimeout applies the deadline for Redis operations, if configured.
+func (w *WebAuthn) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if w.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, w.timeout)
+}
+
+// bufferBody reads a request body and replaces it with a copy, allowing
+// authenticator data to be read after the WebAuthn library verifies it.
+func bufferBody(r *http.Request) ([]byte, error) {
+	if r == nil || r.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webauthn response: %w", err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
+
+// registrationFlags returns the authenticator data flags of a verified
+// registration response.
+func registrationFlags(body []byte) (webauthnProto.AuthenticatorFlags, error) {
+	if len(body) == 0 {
+		return 0, nil
+	}
+
+	parsed, err := webauthnProto.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse webauthn registration flags: %w", err)
+	}
+
+	return parsed.Response.AttestationObject.AuthData.Flags, nil
+}
+
+// loginFlags returns the authenticator data flags of a verified
+// login response.
+func loginFlags(body []byte) (webauthnProto.AuthenticatorFlags, error) {
+	if len(body) == 0 {
+		return 0, nil
 	}
-	return deviceID
+
+	parsed, err := webauthnProto.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse webauthn login flags: %w", err)
+	}
+
+	return parsed.Response.AuthenticatorData.Flags, nil
+}
+
+// signedWithAppID reports whether a login response was signed for
+// a FIDO U2F AppID rather than the RP ID.
+func signedWithAppID(body []byte, appID string) bool {
+	if len(body) == 0 {
+		return false
+	}
+
+	parsed, err := webauthnProto.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	appIDHash := sha256.Sum256([]byte(appID))
+	return bytes.Equal(parsed.Response.AuthenticatorData.RPIDHash, appIDHash[:])
+}
+
+// u2fPublicKey converts an uncompressed P-256 public key of a FIDO U2F
+// registration to the COSE key format of WebAuthn credentials.
+func u2fPublicKey(raw []byte) ([]byte, error) {
+	if len(raw) != 65 || raw[0] != 0x04 {
+		return nil, fmt.Errorf("public key is not an uncompressed P-256 point")
+	}
+
+	x, y := new(big.Int).SetBytes(raw[1:33]), new(big.Int).SetBytes(raw[33:])
+	if !elliptic.P256().IsOnCurve(x, y) {
+		return nil, fmt.Errorf("public key is not on the P-256 curve")
+	}
+
+	return cbor.Marshal(map[int]interface{}{
+		coseKeyType:   coseKeyTypeEC2,
+		coseAlgorithm: int(webauthncose.AlgES256),
+		coseCurve:     coseCurveP256,
+		coseX:         raw[1:33],
+		coseY:         raw[33:],
+	})
 }
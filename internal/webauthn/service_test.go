@@ -3,17 +3,27 @@ package webauthn
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/asn1"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math/big"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	webauthnProto "github.com/duo-labs/webauthn/protocol"
 	webauthnLib "github.com/duo-labs/webauthn/webauthn"
+	"github.com/go-redis/redis/v8"
 	"github.com/google/go-cmp/cmp"
 
 	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/memstore"
 	"github.com/fmitra/authenticator/internal/postgres"
 	"github.com/fmitra/authenticator/internal/test"
 )
@@ -32,6 +42,55 @@ func setSession(ctx context.Context, userID string, redisDB rediser) error {
 	return redisDB.Set(ctx, key, b, time.Second).Err()
 }
 
+// latencyDB is an in-memory rediser simulating a network round trip
+// for each command.
+type latencyDB struct {
+	*memstore.Store
+	rtt        time.Duration
+	roundTrips int
+}
+
+func (db *latencyDB) roundTrip() {
+	db.roundTrips++
+	time.Sleep(db.rtt)
+}
+
+func (db *latencyDB) Get(ctx context.Context, key string) *redis.StringCmd {
+	db.roundTrip()
+	return db.Store.Get(ctx, key)
+}
+
+func (db *latencyDB) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	db.roundTrip()
+	return db.Store.Del(ctx, keys...)
+}
+
+// txLatencyDB is a latencyDB sending transactions in a single round trip.
+type txLatencyDB struct {
+	*latencyDB
+}
+
+func (db *txLatencyDB) TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error) {
+	db.roundTrip()
+	pipe := &queuedPipe{db: db.Store}
+	return nil, fn(pipe)
+}
+
+// queuedPipe is a redis.Pipeliner executing Get and Del against
+// an in-memory store.
+type queuedPipe struct {
+	redis.Pipeliner
+	db *memstore.Store
+}
+
+func (p *queuedPipe) Get(ctx context.Context, key string) *redis.StringCmd {
+	return p.db.Get(ctx, key)
+}
+
+func (p *queuedPipe) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	return p.db.Del(ctx, keys...)
+}
+
 func TestWebAuthnSvc_ConfiguresService(t *testing.T) {
 	_, err := NewService(
 		WithDB(&test.Rediser{}),
@@ -45,6 +104,55 @@ func TestWebAuthnSvc_ConfiguresService(t *testing.T) {
 	}
 }
 
+func TestWebAuthnSvc_ValidatesConfig(t *testing.T) {
+	tt := []struct {
+		name    string
+		options []ConfigOption
+		isValid bool
+	}{
+		{
+			name:    "Default values",
+			isValid: true,
+		},
+		{
+			name: "Custom values",
+			options: []ConfigOption{
+				WithSessionTTL(time.Minute * 15),
+				WithChallengeTimeout(time.Minute * 5),
+				WithUserVerification("required"),
+			},
+			isValid: true,
+		},
+		{
+			name:    "Invalid user verification",
+			options: []ConfigOption{WithUserVerification("always")},
+		},
+		{
+			name: "Challenge timeout exceeding session TTL",
+			options: []ConfigOption{
+				WithSessionTTL(time.Minute),
+				WithChallengeTimeout(time.Minute * 2),
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			options := append([]ConfigOption{
+				WithDisplayName("username"),
+				WithDomain("api.authenticator.local"),
+			}, tc.options...)
+			_, err := NewService(options...)
+			if tc.isValid && err != nil {
+				t.Error("expected nil error:", err)
+			}
+			if !tc.isValid && err == nil {
+				t.Error("expected configuration error")
+			}
+		})
+	}
+}
+
 func TestWebAuthnSvc_BeginSignUp(t *testing.T) {
 	redisDB, err := test.NewRedisDB()
 	if err != nil {
@@ -575,3 +683,568 @@ func TestWebAuthnSvc_FinishLoginSuccess(t *testing.T) {
 			device.SignCount, signCount)
 	}
 }
+
+func TestWebAuthnSvc_ConsumesSession(t *testing.T) {
+	tt := []struct {
+		name       string
+		db         func(db *latencyDB) rediser
+		roundTrips int
+	}{
+		{
+			name:       "Sequential commands",
+			db:         func(db *latencyDB) rediser { return db },
+			roundTrips: 2,
+		},
+		{
+			name:       "Transaction",
+			db:         func(db *latencyDB) rediser { return &txLatencyDB{db} },
+			roundTrips: 1,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := &latencyDB{Store: memstore.New()}
+			svc := WebAuthn{db: tc.db(db), timeout: time.Second}
+			user := &auth.User{ID: "user-id"}
+
+			if err := setSession(ctx, user.ID, db.Store); err != nil {
+				t.Fatal("failed to set session:", err)
+			}
+
+			if _, err := svc.retrieveSession(ctx, newSessionKey(user.ID)); err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+			if db.roundTrips != tc.roundTrips {
+				t.Errorf("incorrect round trips, want %v got %v", tc.roundTrips, db.roundTrips)
+			}
+
+			_, err := svc.retrieveSession(ctx, newSessionKey(user.ID))
+			if auth.ErrorCode(err) != auth.EWebAuthn {
+				t.Errorf("incorrect error code, want '%s' got '%s'", auth.EWebAuthn, auth.ErrorCode(err))
+			}
+		})
+	}
+}
+
+func BenchmarkWebAuthnSvc_RetrieveSession(b *testing.B) {
+	tt := []struct {
+		name string
+		db   func(db *latencyDB) rediser
+	}{
+		{
+			name: "Sequential",
+			db:   func(db *latencyDB) rediser { return db },
+		},
+		{
+			name: "Transaction",
+			db:   func(db *latencyDB) rediser { return &txLatencyDB{db} },
+		},
+	}
+
+	for _, tc := range tt {
+		b.Run(tc.name, func(b *testing.B) {
+			ctx := context.Background()
+			db := &latencyDB{Store: memstore.New(), rtt: time.Millisecond}
+			svc := WebAuthn{db: tc.db(db), timeout: time.Second}
+			user := &auth.User{ID: "user-id"}
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				if err := setSession(ctx, user.ID, db.Store); err != nil {
+					b.Fatal("failed to set session:", err)
+				}
+				b.StartTimer()
+
+				if _, err := svc.retrieveSession(ctx, newSessionKey(user.ID)); err != nil {
+					b.Fatal("expected nil error:", err)
+				}
+			}
+			b.ReportMetric(float64(db.roundTrips)/float64(b.N), "roundtrips/op")
+		})
+	}
+}
+
+func TestWebAuthnSvc_FinishSignUpMetadata(t *testing.T) {
+	tt := []struct {
+		name             string
+		metadata         *auth.AuthenticatorMetadata
+		blockCompromised bool
+		model            string
+		status           string
+		errCode          auth.ErrCode
+	}{
+		{
+			name:  "Unknown model",
+			model: "",
+		},
+		{
+			name: "Certified model",
+			metadata: &auth.AuthenticatorMetadata{
+				Description: "YubiKey 5 Series",
+				Status:      "FIDO_CERTIFIED_L1",
+			},
+			model:  "YubiKey 5 Series",
+			status: "FIDO_CERTIFIED_L1",
+		},
+		{
+			name: "Compromised model is flagged",
+			metadata: &auth.AuthenticatorMetadata{
+				Description: "Compromised Key",
+				Status:      "REVOKED",
+				Compromised: true,
+			},
+			model:  "Compromised Key",
+			status: "REVOKED",
+		},
+		{
+			name: "Compromised model is blocked",
+			metadata: &auth.AuthenticatorMetadata{
+				Description: "Compromised Key",
+				Status:      "REVOKED",
+				Compromised: true,
+			},
+			blockCompromised: true,
+			errCode:          auth.EWebAuthn,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := memstore.New()
+
+			deviceRepo := &test.DeviceRepository{}
+			repoMngr := &test.RepositoryManager{
+				DeviceFn: func() auth.DeviceRepository {
+					return deviceRepo
+				},
+			}
+			lib := &test.WebAuthnLib{
+				FinishRegistrationFn: func() (*webauthnLib.Credential, error) {
+					return &webauthnLib.Credential{
+						ID: []byte("my-credential"),
+						Authenticator: webauthnLib.Authenticator{
+							AAGUID: []byte("aaguid"),
+						},
+					}, nil
+				},
+			}
+			metadata := &test.MetadataService{
+				LookupFn: func() *auth.AuthenticatorMetadata {
+					return tc.metadata
+				},
+			}
+			svc := WebAuthn{
+				db:               db,
+				lib:              lib,
+				repoMngr:         repoMngr,
+				metadata:         metadata,
+				blockCompromised: tc.blockCompromised,
+			}
+
+			if err := setSession(ctx, "user-id", db); err != nil {
+				t.Fatal("failed to set test session:", err)
+			}
+
+			user := &auth.User{ID: "user-id", IsDeviceAllowed: true}
+			device, err := svc.FinishSignUp(ctx, user, nil)
+			if auth.ErrorCode(err) != tc.errCode {
+				t.Fatalf("incorrect error code, want '%s' got '%s'", tc.errCode, auth.ErrorCode(err))
+			}
+			if metadata.Calls.Lookup != 1 {
+				t.Errorf("incorrect Lookup call count, want 1 got %v", metadata.Calls.Lookup)
+			}
+			if tc.errCode != "" {
+				if deviceRepo.Calls.Create != 0 {
+					t.Error("expected blocked device not to be created")
+				}
+				return
+			}
+			if device.Model != tc.model {
+				t.Errorf("incorrect device model, want '%s' got '%s'", tc.model, device.Model)
+			}
+			if device.MetadataStatus != tc.status {
+				t.Errorf("incorrect metadata status, want '%s' got '%s'", tc.status, device.MetadataStatus)
+			}
+		})
+	}
+}
+
+func TestWebAuthnSvc_ImportU2F(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	rawKey := elliptic.Marshal(elliptic.P256(), key.X, key.Y)
+	keyHandle := []byte("legacy-key-handle")
+
+	tt := []struct {
+		name       string
+		appID      string
+		publicKey  []byte
+		byClientFn func() (*auth.Device, error)
+		errCode    auth.ErrCode
+	}{
+		{
+			name:      "Fails without app ID",
+			publicKey: rawKey,
+			errCode:   auth.EWebAuthn,
+		},
+		{
+			name:      "Fails on invalid public key",
+			appID:     "https://authenticator.local/app-id.json",
+			publicKey: rawKey[:33],
+			errCode:   auth.EInvalidField,
+		},
+		{
+			name:      "Fails on public key off curve",
+			appID:     "https://authenticator.local/app-id.json",
+			publicKey: append([]byte{0x04}, bytes.Repeat([]byte{0x01}, 64)...),
+			errCode:   auth.EInvalidField,
+		},
+		{
+			name:      "Fails on registered key handle",
+			appID:     "https://authenticator.local/app-id.json",
+			publicKey: rawKey,
+			byClientFn: func() (*auth.Device, error) {
+				return &auth.Device{}, nil
+			},
+			errCode: auth.EBadRequest,
+		},
+		{
+			name:      "Imports key",
+			appID:     "https://authenticator.local/app-id.json",
+			publicKey: rawKey,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var device *auth.Device
+			deviceRepo := &test.DeviceRepository{
+				ByClientIDFn: func() (*auth.Device, error) {
+					return nil, sql.ErrNoRows
+				},
+				ByUserIDFn: func() ([]*auth.Device, error) {
+					return []*auth.Device{device}, nil
+				},
+				GetForUpdateByClientIDFn: func() (*auth.Device, error) {
+					return device, nil
+				},
+			}
+			if tc.byClientFn != nil {
+				deviceRepo.ByClientIDFn = tc.byClientFn
+			}
+			repoMngr := &test.RepositoryManager{
+				DeviceFn: func() auth.DeviceRepository {
+					return deviceRepo
+				},
+				WithAtomicFn: func() (interface{}, error) {
+					return nil, nil
+				},
+			}
+			svc, err := NewService(
+				WithDB(memstore.New()),
+				WithDisplayName("Authenticator"),
+				WithDomain("authenticator.local"),
+				WithRequestOrigin("https://authenticator.local"),
+				WithRepoManager(repoMngr),
+				WithAppID(tc.appID),
+			)
+			if err != nil {
+				t.Fatal("failed to create service:", err)
+			}
+
+			user := &auth.User{ID: "user-id", IsDeviceAllowed: true}
+			device, err = svc.ImportU2F(ctx, user, &auth.U2FRegistration{
+				KeyHandle: keyHandle,
+				PublicKey: tc.publicKey,
+				Counter:   7,
+				Name:      "Security key",
+			})
+			if auth.ErrorCode(err) != tc.errCode {
+				t.Fatalf("incorrect error code, want '%s' got '%s'", tc.errCode, auth.ErrorCode(err))
+			}
+			if tc.errCode != "" {
+				if deviceRepo.Calls.Create != 0 {
+					t.Error("expected device not to be created")
+				}
+				return
+			}
+			if device.SignCount != 7 || !bytes.Equal(device.ClientID, keyHandle) {
+				t.Errorf("incorrect device: %+v", device)
+			}
+
+			b, err := svc.BeginLogin(ctx, user)
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+
+			var assertion webauthnProto.CredentialAssertion
+			if err = json.Unmarshal(b, &assertion); err != nil {
+				t.Fatal("failed to unmarshal assertion:", err)
+			}
+			if assertion.Response.Extensions["appid"] != tc.appID {
+				t.Errorf("incorrect appid extension, want %s got %v",
+					tc.appID, assertion.Response.Extensions["appid"])
+			}
+
+			// A legacy key signs for the AppID in place of the RP ID.
+			body := newU2FAssertionBody(t, key, keyHandle, tc.appID, assertion.Response.Challenge.String())
+			r := httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+			if err = svc.FinishLogin(ctx, user, r); err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+		})
+	}
+}
+
+// newU2FAssertionBody returns a login response signed by a legacy key
+// answering the appid extension.
+func newU2FAssertionBody(t *testing.T, key *ecdsa.PrivateKey, keyHandle []byte, appID, challenge string) string {
+	rpIDHash := sha256.Sum256([]byte(appID))
+	authData := append(rpIDHash[:], byte(webauthnProto.FlagUserPresent), 0, 0, 0, 8)
+	clientData := []byte(fmt.Sprintf(
+		`{"type":"webauthn.get","challenge":"%s","origin":"https://authenticator.local"}`, challenge,
+	))
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal("failed to sign assertion:", err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal("failed to encode signature:", err)
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(keyHandle)
+	return fmt.Sprintf(`{
+		"id": "%[1]s",
+		"rawId": "%[1]s",
+		"type": "public-key",
+		"response": {
+			"authenticatorData": "%[2]s",
+			"clientDataJSON": "%[3]s",
+			"signature": "%[4]s"
+		}
+	}`,
+		id,
+		base64.RawURLEncoding.EncodeToString(authData),
+		base64.RawURLEncoding.EncodeToString(clientData),
+		base64.RawURLEncoding.EncodeToString(sig),
+	)
+}
+
+func TestWebAuthnSvc_ReadsBackupFlags(t *testing.T) {
+	// A `none` attestation of a registration with the backup eligible
+	// and backed up flags set in its authenticator data.
+	attestation, err := base64.RawURLEncoding.DecodeString(
+		"o2NmbXRkbm9uZWdhdHRTdG10oGhhdXRoRGF0YVjEdKbqkhPJnC90siSSsyDPQCYqlMGpUKA5fyklC2CEHvBBAAAA" +
+			"AAAAAAAAAAAAAAAAAAAAAAAAQOsa7QYSUFukFOLTmgeK6x2ktirNMgwy_6vIwwtegxI2flS1X-JAkZL5dsadg-9b" +
+			"Ez2J7PnsbB0B08txvsyUSvKlAQIDJiABIVggLKF5xS0_BntttUIrm2Z2tgZ4uQDwllbdIfrrBMABCNciWCDHwin8" +
+			"Zdkr56iSIh0MrB5qZiEzYLQpEOREhMUkY6q4Vw",
+	)
+	if err != nil {
+		t.Fatal("failed to decode attestation:", err)
+	}
+	// authData is a CBOR byte string of 2 header bytes, followed by
+	// a 32 byte RP ID hash and the flags.
+	flagsIdx := bytes.Index(attestation, []byte("authData")) + len("authData") + 2 + 32
+	attestation[flagsIdx] |= byte(flagBackupEligible | flagBackedUp)
+
+	credentialID := "6xrtBhJQW6QU4tOaB4rrHaS2Ks0yDDL_q8jDC16DEjZ-VLVf4kCRkvl2xp2D71sTPYns-exsHQHTy3G-zJRK8g"
+	registration := fmt.Sprintf(`{
+		"id": "%[1]s",
+		"rawId": "%[1]s",
+		"type": "public-key",
+		"response": {
+			"attestationObject": "%[2]s",
+			"clientDataJSON": "%[3]s"
+		}
+	}`,
+		credentialID,
+		base64.RawURLEncoding.EncodeToString(attestation),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"type":"webauthn.create"}`)),
+	)
+
+	flags, err := registrationFlags([]byte(registration))
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	if flags&flagBackupEligible == 0 || flags&flagBackedUp == 0 {
+		t.Errorf("incorrect registration flags: %08b", flags)
+	}
+
+	// Authenticator data of a login with only the backup eligible
+	// flag set, as for a passkey no longer synced.
+	authData := make([]byte, 37)
+	authData[32] = byte(webauthnProto.FlagUserPresent | flagBackupEligible)
+	login := fmt.Sprintf(`{
+		"id": "%[1]s",
+		"rawId": "%[1]s",
+		"type": "public-key",
+		"response": {
+			"authenticatorData": "%[2]s",
+			"clientDataJSON": "%[3]s",
+			"signature": ""
+		}
+	}`,
+		credentialID,
+		base64.RawURLEncoding.EncodeToString(authData),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"type":"webauthn.get"}`)),
+	)
+
+	flags, err = loginFlags([]byte(login))
+	if err != nil {
+		t.Fatal("expected nil error:", err)
+	}
+	if flags&flagBackupEligible == 0 || flags&flagBackedUp != 0 {
+		t.Errorf("incorrect login flags: %08b", flags)
+	}
+
+	if _, err = loginFlags([]byte("{}")); err == nil {
+		t.Error("expected error for invalid login response")
+	}
+}
+
+func TestWebAuthnSvc_DiscoverableLogin(t *testing.T) {
+	tt := []struct {
+		name       string
+		userHandle string
+		challenge  func(challenge string) string
+		user       *auth.User
+		errCode    auth.ErrCode
+	}{
+		{
+			name:       "Credential without user handle",
+			userHandle: "",
+			user:       &auth.User{ID: "user-id", IsDeviceAllowed: true},
+			errCode:    auth.EWebAuthn,
+		},
+		{
+			name:       "Challenge not issued",
+			userHandle: "user-id",
+			challenge:  func(challenge string) string { return "unknown-challenge" },
+			user:       &auth.User{ID: "user-id", IsDeviceAllowed: true},
+			errCode:    auth.EWebAuthn,
+		},
+		{
+			name:       "Device login not enabled",
+			userHandle: "user-id",
+			user:       &auth.User{ID: "user-id"},
+			errCode:    auth.EWebAuthn,
+		},
+		{
+			name:       "Successful login",
+			userHandle: "user-id",
+			user:       &auth.User{ID: "user-id", IsDeviceAllowed: true},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			repoMngr := &test.RepositoryManager{
+				UserFn: func() auth.UserRepository {
+					return &test.UserRepository{
+						ByIdentityFn: func() (*auth.User, error) {
+							return tc.user, nil
+						},
+					}
+				},
+				DeviceFn: func() auth.DeviceRepository {
+					return &test.DeviceRepository{}
+				},
+				WithAtomicFn: func() (interface{}, error) {
+					return nil, nil
+				},
+			}
+			lib := &test.WebAuthnLib{
+				FinishLoginFn: func() (*webauthnLib.Credential, error) {
+					return &webauthnLib.Credential{}, nil
+				},
+			}
+			svc := WebAuthn{
+				db:         memstore.New(),
+				lib:        lib,
+				repoMngr:   repoMngr,
+				domain:     "authenticator.local",
+				sessionTTL: time.Minute,
+			}
+
+			b, err := svc.BeginDiscoverableLogin(ctx)
+			if err != nil {
+				t.Fatal("expected nil error:", err)
+			}
+
+			var assertion webauthnProto.CredentialAssertion
+			if err = json.Unmarshal(b, &assertion); err != nil {
+				t.Fatal("failed to unmarshal assertion:", err)
+			}
+			if assertion.Response.UserVerification != webauthnProto.VerificationRequired {
+				t.Errorf("incorrect user verification, want %s got %s",
+					webauthnProto.VerificationRequired, assertion.Response.UserVerification)
+			}
+			if len(assertion.Response.AllowedCredentials) != 0 {
+				t.Error("expected no allowed credentials")
+			}
+
+			challenge := assertion.Response.Challenge.String()
+			if tc.challenge != nil {
+				challenge = tc.challenge(challenge)
+			}
+			body := newAssertionBody(challenge, tc.userHandle)
+
+			r := httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+			user, err := svc.FinishDiscoverableLogin(ctx, r)
+			if auth.ErrorCode(err) != tc.errCode {
+				t.Fatalf("incorrect error code, want '%s' got '%s'", tc.errCode, auth.ErrorCode(err))
+			}
+			if tc.errCode != "" {
+				return
+			}
+			if user.ID != tc.userHandle {
+				t.Errorf("incorrect user, want %s got %s", tc.userHandle, user.ID)
+			}
+			if lib.Calls.FinishLogin != 1 {
+				t.Errorf("incorrect FinishLogin call count, want 1 got %v", lib.Calls.FinishLogin)
+			}
+
+			r = httptest.NewRequest("POST", "/", bytes.NewBufferString(body))
+			_, err = svc.FinishDiscoverableLogin(ctx, r)
+			if auth.ErrorCode(err) != auth.EWebAuthn {
+				t.Errorf("expected replayed challenge to fail, got '%s'", auth.ErrorCode(err))
+			}
+		})
+	}
+}
+
+// newAssertionBody returns a login response for a challenge, signed
+// by a credential with a user handle.
+func newAssertionBody(challenge, userHandle string) string {
+	authData := make([]byte, 37)
+	authData[32] = byte(webauthnProto.FlagUserPresent | webauthnProto.FlagUserVerified)
+	clientData := fmt.Sprintf(`{"type":"webauthn.get","challenge":"%s"}`, challenge)
+
+	return fmt.Sprintf(`{
+		"id": "6xrtBhJQW6QU4tOaB4rrHaS2Ks0yDDL_q8jDC16DEjZ-VLVf4kCRkvl2xp2D71sTPYns-exsHQHTy3G-zJRK8g",
+		"rawId": "6xrtBhJQW6QU4tOaB4rrHaS2Ks0yDDL_q8jDC16DEjZ-VLVf4kCRkvl2xp2D71sTPYns-exsHQHTy3G-zJRK8g",
+		"type": "public-key",
+		"response": {
+			"authenticatorData": "%s",
+			"clientDataJSON": "%s",
+			"signature": "",
+			"userHandle": "%s"
+		}
+	}`,
+		base64.RawURLEncoding.EncodeToString(authData),
+		base64.RawURLEncoding.EncodeToString([]byte(clientData)),
+		base64.RawURLEncoding.EncodeToString([]byte(userHandle)),
+	)
+}
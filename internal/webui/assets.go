@@ -0,0 +1,452 @@
+package webui
+
+// indexHTML is the single page of the UI. Every flow is a section
+// shown or hidden by app.js.
+const indexHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Brand.Name}}</title>
+<link rel="stylesheet" href="style.css">
+</head>
+<body data-api-base="{{.APIBase}}">
+<main>
+  {{if .Brand.LogoURL}}<img class="logo" src="{{.Brand.LogoURL}}" alt="{{.Brand.Name}}">{{else}}<h1>{{.Brand.Name}}</h1>{{end}}
+  <p id="message" class="message" hidden></p>
+
+  <section id="view-start">
+    <form id="login-form">
+      <h2>Log in</h2>
+      <label>Identity <input name="identity" autocomplete="username" required></label>
+      <label>Type
+        <select name="type"><option value="email">Email</option><option value="phone">Phone</option></select>
+      </label>
+      <label>Password <input name="password" type="password" autocomplete="current-password" required></label>
+      <button type="submit">Log in</button>
+    </form>
+
+    <form id="signup-form">
+      <h2>Sign up</h2>
+      <label>Identity <input name="identity" autocomplete="username" required></label>
+      <label>Type
+        <select name="type"><option value="email">Email</option><option value="phone">Phone</option></select>
+      </label>
+      <label>Password <input name="password" type="password" autocomplete="new-password" required></label>
+      <button type="submit">Sign up</button>
+    </form>
+  </section>
+
+  <section id="view-signup-verify" hidden>
+    <form id="signup-verify-form">
+      <h2>Verify your account</h2>
+      <p>Enter the code we sent you.</p>
+      <label>Code <input name="code" autocomplete="one-time-code" required></label>
+      <button type="submit">Verify</button>
+      <button type="button" id="signup-resend">Resend code</button>
+    </form>
+  </section>
+
+  <section id="view-tfa" hidden>
+    <h2>Two-factor authentication</h2>
+    <form id="tfa-code-form">
+      <p id="tfa-code-hint"></p>
+      <label>Code <input name="code" autocomplete="one-time-code" required></label>
+      <button type="submit">Verify</button>
+    </form>
+    <button type="button" id="tfa-device">Use security key</button>
+  </section>
+
+  <section id="view-account" hidden>
+    <h2>Account</h2>
+    <p id="enrollment-hint" hidden>Set up an authenticator app or security key to continue.</p>
+    <pre id="claims"></pre>
+    <div class="actions">
+      <button type="button" id="token-refresh">Refresh token</button>
+      <button type="button" id="totp-start">Set up authenticator app</button>
+      <button type="button" id="device-add">Register security key</button>
+      <button type="button" id="logout">Log out</button>
+    </div>
+    <form id="totp-form" hidden>
+      <h3>Authenticator app</h3>
+      <p>Add this URI to your authenticator app, then enter a generated code.</p>
+      <pre id="totp-uri"></pre>
+      <label>Code <input name="code" autocomplete="one-time-code" required></label>
+      <button type="submit">Enable</button>
+    </form>
+  </section>
+
+  {{if .Brand.SupportEmail}}<p class="support">Need help? Contact <a href="mailto:{{.Brand.SupportEmail}}">{{.Brand.SupportEmail}}</a></p>{{end}}
+</main>
+<script src="app.js"></script>
+</body>
+</html>
+`
+
+// appJS drives the UI through the JSON API. Tokens are kept in
+// session storage and refresh tokens in the API's HTTP only cookie.
+const appJS = `(function () {
+  "use strict";
+
+  var apiBase = document.body.getAttribute("data-api-base");
+  var storageKey = "authenticator.token";
+  var flowKey = "authenticator.flow";
+  var sessionKey = "authenticator.session";
+  var token = sessionStorage.getItem(storageKey) || "";
+
+  function $(id) { return document.getElementById(id); }
+
+  function show(view) {
+    ["view-start", "view-signup-verify", "view-tfa", "view-account"].forEach(function (id) {
+      $(id).hidden = id !== view;
+    });
+  }
+
+  function notify(text, isError) {
+    var el = $("message");
+    el.textContent = text || "";
+    el.className = isError ? "message error" : "message";
+    el.hidden = !text;
+  }
+
+  function setToken(value) {
+    token = value || "";
+    if (token) {
+      sessionStorage.setItem(storageKey, token);
+    } else {
+      sessionStorage.removeItem(storageKey);
+      sessionStorage.removeItem(flowKey);
+      sessionStorage.removeItem(sessionKey);
+    }
+  }
+
+  // session returns the state and 2FA options returned alongside the
+  // current token. Tokens are not decoded as they may be encrypted.
+  function session() {
+    if (!token) { return null; }
+    try {
+      return JSON.parse(sessionStorage.getItem(sessionKey)) || { state: "authorized" };
+    } catch (e) {
+      return null;
+    }
+  }
+
+  function api(method, path, body) {
+    var headers = {};
+    if (token) { headers.Authorization = "Bearer " + token; }
+    if (body !== undefined) { headers["Content-Type"] = "application/json"; }
+    return fetch(apiBase + path, {
+      method: method,
+      headers: headers,
+      credentials: "same-origin",
+      body: body === undefined ? undefined : JSON.stringify(body)
+    }).then(function (resp) {
+      return resp.text().then(function (text) {
+        var data = text ? JSON.parse(text) : {};
+        if (!resp.ok) {
+          var err = new Error((data.error || {}).message || resp.statusText);
+          err.status = resp.status;
+          throw err;
+        }
+        return data;
+      });
+    });
+  }
+
+  function formData(form) {
+    var data = {};
+    Array.prototype.forEach.call(form.elements, function (el) {
+      if (el.name) { data[el.name] = el.value; }
+    });
+    return data;
+  }
+
+  function onSubmit(id, handler) {
+    $(id).addEventListener("submit", function (event) {
+      event.preventDefault();
+      notify("");
+      handler(formData(event.target), event.target).catch(function (err) {
+        notify(err.message, true);
+      });
+    });
+  }
+
+  function onClick(id, handler) {
+    $(id).addEventListener("click", function () {
+      notify("");
+      handler().catch(function (err) {
+        notify(err.message, true);
+      });
+    });
+  }
+
+  // render shows the view matching the state of the current token.
+  function render() {
+    var s = session();
+    if (!s) {
+      show("view-start");
+      return;
+    }
+    if (s.state === "authorized") {
+      api("GET", "/me").then(function (profile) {
+        $("claims").textContent = JSON.stringify(profile.session, null, 2);
+        $("enrollment-hint").hidden = !profile.session.enrollmentRequired;
+        show("view-account");
+      }, function (err) {
+        if (err.status === 401) {
+          setToken("");
+          show("view-start");
+          return;
+        }
+        $("claims").textContent = "";
+        show("view-account");
+        notify(err.message, true);
+      });
+      return;
+    }
+    // Pre-authorized tokens are issued by both signup and login, we
+    // remember which flow was started to verify the right one.
+    if (sessionStorage.getItem(flowKey) === "signup") {
+      show("view-signup-verify");
+      return;
+    }
+
+    var options = s.tfaOptions || [];
+    var hasCode = options.indexOf("otp_email") !== -1 ||
+      options.indexOf("otp_phone") !== -1 ||
+      options.indexOf("totp") !== -1;
+    $("tfa-code-form").hidden = !hasCode;
+    $("tfa-code-hint").textContent = options.indexOf("totp") !== -1 ?
+      "Enter the code from your authenticator app or the code we sent you." :
+      "Enter the code we sent you.";
+    $("tfa-device").hidden = options.indexOf("device") === -1;
+    show("view-tfa");
+  }
+
+  // accept stores a token from a response. Tokens returned without a
+  // state are issued to authorized users managing their account.
+  function accept(data) {
+    setToken(data.token);
+    sessionStorage.setItem(sessionKey, JSON.stringify({
+      state: data.state || "authorized",
+      tfaOptions: data.tfaOptions || []
+    }));
+    render();
+  }
+
+  function start(flow) {
+    return function (data) {
+      sessionStorage.setItem(flowKey, flow);
+      accept(data);
+    };
+  }
+
+  // WebAuthn options and credentials are exchanged with the API as
+  // base64url encoded strings and with the browser as ArrayBuffers.
+  function decode(value) {
+    var s = atob(value.replace(/-/g, "+").replace(/_/g, "/"));
+    var bytes = new Uint8Array(s.length);
+    for (var i = 0; i < s.length; i++) { bytes[i] = s.charCodeAt(i); }
+    return bytes.buffer;
+  }
+
+  function encode(buffer) {
+    if (!buffer) { return undefined; }
+    var s = "";
+    var bytes = new Uint8Array(buffer);
+    for (var i = 0; i < bytes.length; i++) { s += String.fromCharCode(bytes[i]); }
+    return btoa(s).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+  }
+
+  function decodeCredentials(list) {
+    return (list || []).map(function (cred) {
+      return Object.assign({}, cred, { id: decode(cred.id) });
+    });
+  }
+
+  function requireWebAuthn() {
+    if (!window.PublicKeyCredential) {
+      throw new Error("This browser does not support security keys");
+    }
+  }
+
+  function createCredential(options) {
+    requireWebAuthn();
+    var publicKey = options.publicKey;
+    publicKey.challenge = decode(publicKey.challenge);
+    publicKey.user.id = decode(publicKey.user.id);
+    publicKey.excludeCredentials = decodeCredentials(publicKey.excludeCredentials);
+    return navigator.credentials.create({ publicKey: publicKey }).then(function (cred) {
+      return {
+        id: cred.id,
+        rawId: encode(cred.rawId),
+        type: cred.type,
+        response: {
+          attestationObject: encode(cred.response.attestationObject),
+          clientDataJSON: encode(cred.response.clientDataJSON)
+        }
+      };
+    });
+  }
+
+  function getCredential(options) {
+    requireWebAuthn();
+    var publicKey = options.publicKey;
+    publicKey.challenge = decode(publicKey.challenge);
+    publicKey.allowCredentials = decodeCredentials(publicKey.allowCredentials);
+    return navigator.credentials.get({ publicKey: publicKey }).then(function (cred) {
+      return {
+        id: cred.id,
+        rawId: encode(cred.rawId),
+        type: cred.type,
+        response: {
+          authenticatorData: encode(cred.response.authenticatorData),
+          clientDataJSON: encode(cred.response.clientDataJSON),
+          signature: encode(cred.response.signature),
+          userHandle: encode(cred.response.userHandle)
+        }
+      };
+    });
+  }
+
+  onSubmit("login-form", function (data) {
+    return api("POST", "/login", data).then(start("login"));
+  });
+
+  onSubmit("signup-form", function (data) {
+    return api("POST", "/signup", data).then(start("signup"));
+  });
+
+  onSubmit("signup-verify-form", function (data) {
+    return api("POST", "/signup/verify", data).then(accept);
+  });
+
+  onClick("signup-resend", function () {
+    return api("POST", "/signup/resend").then(function () {
+      notify("A new code is on its way.");
+    });
+  });
+
+  onSubmit("tfa-code-form", function (data) {
+    return api("POST", "/login/verify-code", data).then(accept);
+  });
+
+  onClick("tfa-device", function () {
+    return api("GET", "/login/verify-device")
+      .then(getCredential)
+      .then(function (cred) { return api("POST", "/login/verify-device", cred); })
+      .then(accept);
+  });
+
+  onClick("token-refresh", function () {
+    return api("POST", "/token/refresh").then(function (data) {
+      accept(data);
+      notify("Token refreshed.");
+    });
+  });
+
+  onClick("totp-start", function () {
+    return api("POST", "/totp").then(function (data) {
+      $("totp-uri").textContent = data.totp;
+      $("totp-form").hidden = false;
+    });
+  });
+
+  onSubmit("totp-form", function (data, form) {
+    return api("POST", "/totp/configure", data).then(function (resp) {
+      form.hidden = true;
+      if (resp.token) { accept(resp); }
+      notify("Authenticator app enabled.");
+    });
+  });
+
+  onClick("device-add", function () {
+    return api("POST", "/device")
+      .then(createCredential)
+      .then(function (cred) { return api("POST", "/device/verify", cred); })
+      .then(function (resp) {
+        if (resp.token) { accept(resp); }
+        notify("Security key registered.");
+      });
+  });
+
+  onClick("logout", function () {
+    return api("POST", "/logout").then(function () {
+      setToken("");
+      render();
+    }, function () {
+      setToken("");
+      render();
+    });
+  });
+
+  render();
+})();
+`
+
+// styleCSS is a small stylesheet so the UI is usable without
+// any further assets. It is a text/template executed with the
+// Brand, whose color is validated before it is rendered.
+const styleCSS = `body {
+  margin: 0;
+  font-family: system-ui, -apple-system, "Segoe UI", Roboto, sans-serif;
+  background: #f5f5f5;
+  color: #222;
+}
+main {
+  max-width: 28rem;
+  margin: 2rem auto;
+  padding: 0 1rem;
+}
+form, .actions {
+  display: flex;
+  flex-direction: column;
+  gap: 0.5rem;
+  margin-bottom: 2rem;
+}
+label {
+  display: flex;
+  flex-direction: column;
+  font-size: 0.9rem;
+}
+input, select, button {
+  font: inherit;
+  padding: 0.5rem;
+}
+button {
+  cursor: pointer;
+  border: 0;
+  border-radius: 0.25rem;
+  color: #fff;
+  background: {{.Color}};
+}
+a {
+  color: {{.Color}};
+}
+.logo {
+  max-height: 3rem;
+  margin: 1rem 0;
+}
+.support {
+  font-size: 0.85rem;
+  color: #666;
+}
+pre {
+  overflow-x: auto;
+  padding: 0.5rem;
+  background: #fff;
+  border: 1px solid #ddd;
+  white-space: pre-wrap;
+  word-break: break-all;
+}
+.message {
+  padding: 0.5rem;
+  background: #e7f4e4;
+}
+.message.error {
+  background: #fbe3e4;
+}
+[hidden] {
+  display: none !important;
+}
+`
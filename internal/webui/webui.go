@@ -0,0 +1,96 @@
+// Package webui serves a minimal reference web UI for the API. It
+// exercises signup, login and 2FA (OTP, TOTP and WebAuthn devices)
+// so that the service may be run standalone before a client UI is
+// written, and doubles as an example of how clients use the API.
+//
+// Assets are kept as Go source rather than embedded files as the
+// module supports Go versions without go:embed.
+package webui
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+	textTemplate "text/template"
+
+	"github.com/fmitra/authenticator/internal/branding"
+)
+
+// Path is the path the UI is served under.
+const Path = "/ui"
+
+// asset is a static file served by the UI.
+type asset struct {
+	contentType string
+	content     []byte
+}
+
+// Handler returns an http.Handler serving the UI under Path. apiBase
+// is the path prefix the API is served under, e.g. `/api/v1`.
+func Handler(apiBase string, brand branding.Brand) (http.Handler, error) {
+	brand = brand.WithDefaults()
+	if err := brand.Validate(); err != nil {
+		return nil, err
+	}
+
+	var index bytes.Buffer
+	err := indexTemplate.Execute(&index, struct {
+		APIBase string
+		Brand   branding.Brand
+	}{
+		APIBase: strings.TrimRight(apiBase, "/"),
+		Brand:   brand,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var style bytes.Buffer
+	if err = styleTemplate.Execute(&style, brand); err != nil {
+		return nil, err
+	}
+
+	assets := map[string]asset{
+		Path + "/":          {"text/html; charset=utf-8", index.Bytes()},
+		Path + "/app.js":    {"application/javascript; charset=utf-8", []byte(appJS)},
+		Path + "/style.css": {"text/css; charset=utf-8", style.Bytes()},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == Path {
+			http.Redirect(w, r, Path+"/", http.StatusMovedPermanently)
+			return
+		}
+
+		a, ok := assets[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Content-Type", a.contentType)
+		h.Set("Cache-Control", "no-cache")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Content-Security-Policy",
+			"default-src 'self'; script-src 'self'; style-src 'self'; img-src 'self' https: data:; frame-ancestors 'none'",
+		)
+		if r.Method == http.MethodHead {
+			return
+		}
+		_, _ = w.Write(a.content)
+	}), nil
+}
+
+var (
+	indexTemplate = template.Must(template.New("index").Parse(indexHTML))
+	styleTemplate = textTemplate.Must(textTemplate.New("style").Parse(styleCSS))
+)
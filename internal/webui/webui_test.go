@@ -0,0 +1,112 @@
+package webui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fmitra/authenticator/internal/branding"
+)
+
+func TestWebUI_Handler(t *testing.T) {
+	tt := []struct {
+		name        string
+		method      string
+		path        string
+		statusCode  int
+		contentType string
+		body        string
+	}{
+		{
+			name:        "Serves index",
+			method:      http.MethodGet,
+			path:        "/ui/",
+			statusCode:  http.StatusOK,
+			contentType: "text/html; charset=utf-8",
+			body:        `data-api-base="/auth/api/v1"`,
+		},
+		{
+			name:        "Serves brand",
+			method:      http.MethodGet,
+			path:        "/ui/",
+			statusCode:  http.StatusOK,
+			contentType: "text/html; charset=utf-8",
+			body:        `<a href="mailto:help@acme.com">`,
+		},
+		{
+			name:        "Serves script",
+			method:      http.MethodGet,
+			path:        "/ui/app.js",
+			statusCode:  http.StatusOK,
+			contentType: "application/javascript; charset=utf-8",
+			body:        "/login/verify-code",
+		},
+		{
+			name:        "Serves stylesheet",
+			method:      http.MethodGet,
+			path:        "/ui/style.css",
+			statusCode:  http.StatusOK,
+			contentType: "text/css; charset=utf-8",
+			body:        "background: #ff0000;",
+		},
+		{
+			name:       "Redirects to index",
+			method:     http.MethodGet,
+			path:       "/ui",
+			statusCode: http.StatusMovedPermanently,
+		},
+		{
+			name:       "Unknown asset",
+			method:     http.MethodGet,
+			path:       "/ui/config.json",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "Rejects writes",
+			method:     http.MethodPost,
+			path:       "/ui/",
+			statusCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	h, err := Handler("/auth/api/v1/", branding.Brand{
+		Name:         "Acme",
+		Color:        "#ff0000",
+		SupportEmail: "help@acme.com",
+	})
+	if err != nil {
+		t.Fatal("failed to create handler:", err)
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+
+			if rr.Code != tc.statusCode {
+				t.Errorf("incorrect status code, want %v got %v", tc.statusCode, rr.Code)
+			}
+			if tc.contentType == "" {
+				return
+			}
+			if got := rr.Header().Get("Content-Type"); got != tc.contentType {
+				t.Errorf("incorrect content type, want %s got %s", tc.contentType, got)
+			}
+			if rr.Header().Get("Content-Security-Policy") == "" {
+				t.Error("expected content security policy")
+			}
+			if !strings.Contains(rr.Body.String(), tc.body) {
+				t.Errorf("expected body to contain %q", tc.body)
+			}
+		})
+	}
+}
+
+func TestWebUI_InvalidBrand(t *testing.T) {
+	_, err := Handler("/api/v1", branding.Brand{Color: "red; background: url(x)"})
+	if err == nil {
+		t.Error("expected invalid brand to be rejected")
+	}
+}
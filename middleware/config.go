@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/jwe"
+	tokenLib "github.com/fmitra/authenticator/internal/token"
+)
+
+// NewVerifier returns a new Verifier. By default only tokens
+// in an authorized state are accepted.
+func NewVerifier(options ...ConfigOption) *Verifier {
+	v := Verifier{
+		logger:         log.NewNopLogger(),
+		state:          auth.JWTAuthorized,
+		clientIDCookie: tokenLib.ClientIDCookie,
+	}
+
+	for _, opt := range options {
+		opt(&v)
+	}
+
+	v.encryptionKey = jwe.DeriveKey(v.secret)
+
+	return &v
+}
+
+// ConfigOption configures the Verifier.
+type ConfigOption func(*Verifier)
+
+// WithLogger configures the Verifier with a logger.
+func WithLogger(l log.Logger) ConfigOption {
+	return func(v *Verifier) {
+		v.logger = l
+	}
+}
+
+// WithSecret configures the secret used to sign tokens. It
+// must match the secret configured for authenticator. Tokens
+// encrypted by authenticator are decrypted with a key derived
+// from the secret.
+func WithSecret(secret string) ConfigOption {
+	return func(v *Verifier) {
+		v.secret = []byte(secret)
+	}
+}
+
+// WithIssuer configures the Verifier to only accept tokens
+// from an issuer.
+func WithIssuer(issuer string) ConfigOption {
+	return func(v *Verifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithState configures the token state required by the Verifier.
+// An empty state accepts tokens in any state.
+func WithState(state auth.TokenState) ConfigOption {
+	return func(v *Verifier) {
+		v.state = state
+	}
+}
+
+// WithAudience configures the Verifier to only accept tokens
+// intended for an audience. Tokens without an audience are rejected
+// unless WithAudienceless is also set.
+func WithAudience(audience string) ConfigOption {
+	return func(v *Verifier) {
+		v.audience = audience
+	}
+}
+
+// WithAudienceless configures the Verifier to accept tokens without an
+// audience alongside tokens intended for its audience, e.g. while
+// clients are migrated to requesting audiences.
+func WithAudienceless() ConfigOption {
+	return func(v *Verifier) {
+		v.allowAudienceless = true
+	}
+}
+
+// WithScopes configures the Verifier to only accept tokens
+// granted every scope.
+func WithScopes(scopes ...string) ConfigOption {
+	return func(v *Verifier) {
+		v.scopes = scopes
+	}
+}
+
+// WithRevocationChecker configures the Verifier to check
+// if a token has been revoked.
+func WithRevocationChecker(c RevocationChecker) ConfigOption {
+	return func(v *Verifier) {
+		v.revocation = c
+	}
+}
+
+// WithClientIDCookie configures the name of the cookie the client ID is
+// read from. It must match the name authenticator is configured with
+// and defaults to CLIENTID.
+func WithClientIDCookie(name string) ConfigOption {
+	return func(v *Verifier) {
+		v.clientIDCookie = name
+	}
+}
+
+// WithLeeway configures the clock skew tolerated when validating
+// the iat, exp and nbf claims of a token. It should match
+// authenticator's token.leeway. A negative leeway is ignored.
+func WithLeeway(leeway time.Duration) ConfigOption {
+	return func(v *Verifier) {
+		if leeway < 0 {
+			return
+		}
+		v.leeway = leeway
+	}
+}
+
+// WithEncryption configures the Verifier to only accept tokens
+// encrypted by authenticator, which it issues when configured with
+// the encrypted claims mode.
+func WithEncryption() ConfigOption {
+	return func(v *Verifier) {
+		v.requireEncryption = true
+	}
+}
+
+// WithStrictFingerprint configures the Verifier to reject tokens
+// presented from a client other than the one they were issued to. It
+// should be set if authenticator's token.fingerprint is strict. Tokens
+// issued without a fingerprint are accepted.
+func WithStrictFingerprint() ConfigOption {
+	return func(v *Verifier) {
+		v.strictFingerprint = true
+	}
+}
+
+// WithPendingConsent configures the Verifier to accept tokens of
+// users who have yet to accept the latest policies.
+func WithPendingConsent() ConfigOption {
+	return func(v *Verifier) {
+		v.allowPendingConsent = true
+	}
+}
+
+// WithPendingEnrollment configures the Verifier to accept tokens of
+// users who have yet to complete a mandatory 2FA enrollment.
+func WithPendingEnrollment() ConfigOption {
+	return func(v *Verifier) {
+		v.allowPendingEnrollment = true
+	}
+}
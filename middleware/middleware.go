@@ -0,0 +1,228 @@
+// Package middleware validates JWT tokens issued by authenticator. It
+// is intended for Go services that accept authenticator's tokens and
+// need to authenticate requests without reimplementing token validation.
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/fingerprint"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/jwe"
+	tokenLib "github.com/fmitra/authenticator/internal/token"
+)
+
+type contextKey string
+
+const (
+	tokenContextKey   contextKey = "token"
+	headersContextKey contextKey = "headers"
+)
+
+const authorizationHeader = "AUTHORIZATION"
+
+// RevocationChecker checks if a validated token has since been
+// revoked or invalidated by authenticator.
+type RevocationChecker interface {
+	// Check returns an error if a token may no longer be used. The
+	// signed token and client ID are provided as they were received
+	// from the client.
+	Check(ctx context.Context, token *auth.Token, signedToken, clientID string) error
+}
+
+// Verifier validates JWT tokens issued by authenticator.
+type Verifier struct {
+	logger         log.Logger
+	secret         []byte
+	encryptionKey  []byte
+	issuer         string
+	state          auth.TokenState
+	audience       string
+	scopes         []string
+	revocation     RevocationChecker
+	clientIDCookie string
+	leeway         time.Duration
+
+	strictFingerprint bool
+
+	requireEncryption      bool
+	allowAudienceless      bool
+	allowPendingConsent    bool
+	allowPendingEnrollment bool
+}
+
+// Verify checks that a JWT token is signed with the shared secret, unexpired,
+// from a valid client and, if a RevocationChecker is configured, unrevoked.
+// Tokens of users with pending consent or 2FA enrollment are rejected
+// unless the Verifier is configured to accept them. On success it will
+// return the unpacked Token.
+func (v *Verifier) Verify(ctx context.Context, signedToken, clientID string) (*auth.Token, error) {
+	if !strings.HasPrefix(signedToken, "Bearer ") {
+		return nil, auth.ErrInvalidToken("bearer token expected")
+	}
+
+	tokenParser := func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+
+		return v.secret, nil
+	}
+
+	jwtToken := strings.TrimPrefix(signedToken, "Bearer ")
+	if jwe.IsEncrypted(jwtToken) {
+		var err error
+		jwtToken, err = jwe.Decrypt(v.encryptionKey, jwtToken)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", err, auth.ErrInvalidToken("token is invalid"))
+		}
+	} else if v.requireEncryption {
+		return nil, auth.ErrInvalidToken("token is not encrypted")
+	}
+
+	// Time based claims are validated with the configured leeway
+	// rather than by jwt-go.
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	var token auth.Token
+	_, err := parser.ParseWithClaims(jwtToken, &token, tokenParser)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrInvalidToken("token is invalid"))
+	}
+	if err = tokenLib.ValidateClaims(&token.StandardClaims, time.Now(), v.leeway); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrInvalidToken("token is invalid"))
+	}
+
+	if token.UserID == "" {
+		return nil, auth.ErrInvalidToken("token is not associated with user")
+	}
+
+	if v.issuer != "" && token.Issuer != v.issuer {
+		return nil, auth.ErrInvalidToken("token issuer is invalid")
+	}
+
+	if v.state != "" && token.State != v.state {
+		return nil, auth.ErrInvalidToken("token state is not supported")
+	}
+
+	if v.audience != "" && !v.isAudienceValid(&token) {
+		return nil, auth.ErrInvalidToken("token audience is invalid")
+	}
+
+	if !token.HasScopes(v.scopes...) {
+		return nil, auth.ErrForbidden("token scope is insufficient")
+	}
+
+	if token.ConsentRequired && !v.allowPendingConsent {
+		return nil, auth.ErrForbidden("consent to the latest policies is required")
+	}
+
+	if token.EnrollmentRequired && !v.allowPendingEnrollment {
+		return nil, auth.ErrForbidden("enrollment of a TOTP app or WebAuthn device is required")
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(clientID)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", err, auth.ErrInvalidToken("token source is invalid"))
+	}
+
+	h, err := crypto.Hash(string(decoded))
+	if err != nil || h != token.ClientIDHash {
+		return nil, auth.ErrInvalidToken("token source is invalid")
+	}
+
+	if v.strictFingerprint && !isFingerprintValid(ctx, &token) {
+		return nil, auth.ErrInvalidToken("token source is invalid")
+	}
+
+	if v.revocation != nil {
+		if err = v.revocation.Check(ctx, &token, signedToken, clientID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &token, nil
+}
+
+// isAudienceValid checks if a token is intended for the Verifier's
+// audience. Tokens without an audience are only accepted if the
+// Verifier is configured to accept them.
+func (v *Verifier) isAudienceValid(token *auth.Token) bool {
+	if len(token.Audiences) == 0 {
+		return v.allowAudienceless
+	}
+	return token.HasAudience(v.audience)
+}
+
+// isFingerprintValid checks if a token is presented from the client it
+// was issued to. Tokens issued without a fingerprint, or verified
+// outside of an HTTP request, are not checked.
+func isFingerprintValid(ctx context.Context, token *auth.Token) bool {
+	fp := fingerprint.FromContext(ctx)
+	return token.Fingerprint == "" || fp == "" || fp == token.Fingerprint
+}
+
+// Handler wraps an http.Handler to reject requests without a valid token.
+// The token is read from the Authorization header and validated against
+// the client ID cookie set by authenticator, or the TokenClientIDHeader
+// sent by native clients without cookies. Validated tokens are set in
+// context for retrieval by GetToken.
+func (v *Verifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := v.verifyRequest(r)
+		if err != nil {
+			level.Info(v.logger).Log(
+				"source", "middleware.Handler",
+				"path", r.URL.Path,
+				"method", r.Method,
+				"error", err,
+			)
+			httpapi.ErrorResponse(w, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), tokenContextKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (v *Verifier) verifyRequest(r *http.Request) (*auth.Token, error) {
+	signedToken := r.Header.Get(authorizationHeader)
+	if signedToken == "" {
+		return nil, auth.ErrInvalidToken("user is not authenticated")
+	}
+
+	clientID := r.Header.Get(httpapi.TokenClientIDHeader)
+	if clientIDCookie, err := r.Cookie(v.clientIDCookie); err == nil {
+		clientID = clientIDCookie.Value
+	}
+	if clientID == "" {
+		return nil, auth.ErrInvalidToken("token source is invalid")
+	}
+
+	// The client's fingerprint is compared in strict mode and its
+	// headers are forwarded by the introspection RevocationChecker.
+	ctx := fingerprint.NewContext(r.Context(), fingerprint.FromRequest(r))
+	ctx = context.WithValue(ctx, headersContextKey, fingerprint.Headers(r))
+
+	return v.Verify(ctx, signedToken, clientID)
+}
+
+// GetToken retrieves a validated Token from context.
+func GetToken(ctx context.Context) *auth.Token {
+	token, ok := ctx.Value(tokenContextKey).(*auth.Token)
+	if !ok {
+		return nil
+	}
+	return token
+}
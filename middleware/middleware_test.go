@@ -0,0 +1,609 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/crypto"
+	"github.com/fmitra/authenticator/internal/fingerprint"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/jwe"
+	"github.com/fmitra/authenticator/internal/memstore"
+	tokenLib "github.com/fmitra/authenticator/internal/token"
+)
+
+const testSecret = "my-signing-secret"
+
+type mockChecker struct {
+	err   error
+	calls int
+}
+
+func (m *mockChecker) Check(ctx context.Context, token *auth.Token, signedToken, clientID string) error {
+	m.calls++
+	return m.err
+}
+
+func signToken(t *testing.T, secret string, token *auth.Token) (string, string) {
+	clientID := "client-id"
+	h, err := crypto.Hash(clientID)
+	if err != nil {
+		t.Fatal("failed to hash client ID:", err)
+	}
+	token.ClientIDHash = h
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS512, token).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal("failed to sign token:", err)
+	}
+
+	return "Bearer " + signed, base64.RawURLEncoding.EncodeToString([]byte(clientID))
+}
+
+func newToken(state auth.TokenState, expiresAt time.Time) *auth.Token {
+	return &auth.Token{
+		StandardClaims: jwt.StandardClaims{
+			Id:        "token-id",
+			Issuer:    "authenticator",
+			ExpiresAt: expiresAt.Unix(),
+		},
+		UserID: "user-id",
+		State:  state,
+	}
+}
+
+func TestMiddleware_Verify(t *testing.T) {
+	tt := []struct {
+		name       string
+		secret     string
+		token      *auth.Token
+		clientID   string
+		encrypt    bool
+		options    []ConfigOption
+		checkerErr error
+		errCode    auth.ErrCode
+	}{
+		{
+			name:   "Valid token",
+			secret: testSecret,
+			token:  newToken(auth.JWTAuthorized, time.Now().Add(time.Minute)),
+		},
+		{
+			name:    "Valid encrypted token",
+			secret:  testSecret,
+			token:   newToken(auth.JWTAuthorized, time.Now().Add(time.Minute)),
+			encrypt: true,
+		},
+		{
+			name:    "Encrypted token required",
+			secret:  testSecret,
+			token:   newToken(auth.JWTAuthorized, time.Now().Add(time.Minute)),
+			encrypt: true,
+			options: []ConfigOption{WithEncryption()},
+		},
+		{
+			name:    "Unencrypted token rejected",
+			secret:  testSecret,
+			token:   newToken(auth.JWTAuthorized, time.Now().Add(time.Minute)),
+			options: []ConfigOption{WithEncryption()},
+			errCode: auth.EInvalidToken,
+		},
+		{
+			name:    "Encrypted with another secret",
+			secret:  "another-secret",
+			token:   newToken(auth.JWTAuthorized, time.Now().Add(time.Minute)),
+			encrypt: true,
+			errCode: auth.EInvalidToken,
+		},
+		{
+			name:    "Invalid signature",
+			secret:  "another-secret",
+			token:   newToken(auth.JWTAuthorized, time.Now().Add(time.Minute)),
+			errCode: auth.EInvalidToken,
+		},
+		{
+			name:    "Expired token",
+			secret:  testSecret,
+			token:   newToken(auth.JWTAuthorized, time.Now().Add(-time.Minute)),
+			errCode: auth.EInvalidToken,
+		},
+		{
+			name:    "Expired token within leeway",
+			secret:  testSecret,
+			token:   newToken(auth.JWTAuthorized, time.Now().Add(-5*time.Second)),
+			options: []ConfigOption{WithLeeway(time.Minute)},
+		},
+		{
+			name:    "Expired token beyond leeway",
+			secret:  testSecret,
+			token:   newToken(auth.JWTAuthorized, time.Now().Add(-time.Minute)),
+			options: []ConfigOption{WithLeeway(5 * time.Second)},
+			errCode: auth.EInvalidToken,
+		},
+		{
+			name:   "Token issued in the future within leeway",
+			secret: testSecret,
+			token: func() *auth.Token {
+				token := newToken(auth.JWTAuthorized, time.Now().Add(time.Minute))
+				token.IssuedAt = time.Now().Add(5 * time.Second).Unix()
+				return token
+			}(),
+			options: []ConfigOption{WithLeeway(time.Minute)},
+		},
+		{
+			name:    "Valid token with negative leeway",
+			secret:  testSecret,
+			token:   newToken(auth.JWTAuthorized, time.Now().Add(5*time.Second)),
+			options: []ConfigOption{WithLeeway(-time.Minute)},
+		},
+		{
+			name:    "Unsupported state",
+			secret:  testSecret,
+			token:   newToken(auth.JWTPreAuthorized, time.Now().Add(time.Minute)),
+			errCode: auth.EInvalidToken,
+		},
+		{
+			name:     "Invalid client ID",
+			secret:   testSecret,
+			token:    newToken(auth.JWTAuthorized, time.Now().Add(time.Minute)),
+			clientID: base64.RawURLEncoding.EncodeToString([]byte("bad-client-id")),
+			errCode:  auth.EInvalidToken,
+		},
+		{
+			name:       "Revoked token",
+			secret:     testSecret,
+			token:      newToken(auth.JWTAuthorized, time.Now().Add(time.Minute)),
+			checkerErr: auth.ErrInvalidToken("token is revoked"),
+			errCode:    auth.EInvalidToken,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			checker := &mockChecker{err: tc.checkerErr}
+			v := NewVerifier(append([]ConfigOption{
+				WithSecret(testSecret),
+				WithIssuer("authenticator"),
+				WithRevocationChecker(checker),
+			}, tc.options...)...)
+
+			signedToken, clientID := signToken(t, tc.secret, tc.token)
+			if tc.clientID != "" {
+				clientID = tc.clientID
+			}
+			if tc.encrypt {
+				encrypted, err := jwe.Encrypt(
+					jwe.DeriveKey([]byte(tc.secret)), strings.TrimPrefix(signedToken, "Bearer "),
+				)
+				if err != nil {
+					t.Fatal("failed to encrypt token:", err)
+				}
+				signedToken = "Bearer " + encrypted
+			}
+
+			token, err := v.Verify(context.Background(), signedToken, clientID)
+			if auth.ErrorCode(err) != tc.errCode {
+				t.Fatalf("incorrect error code, want %s got %s", tc.errCode, auth.ErrorCode(err))
+			}
+			if tc.errCode == "" && token.UserID != "user-id" {
+				t.Errorf("incorrect user ID, want user-id got %s", token.UserID)
+			}
+		})
+	}
+}
+
+func TestMiddleware_VerifyAudienceAndScopes(t *testing.T) {
+	tt := []struct {
+		name      string
+		audiences []string
+		scopes    []string
+		options   []ConfigOption
+		errCode   auth.ErrCode
+	}{
+		{
+			name:    "Token without audience",
+			scopes:  []string{"read", "write"},
+			errCode: auth.EInvalidToken,
+		},
+		{
+			name:    "Token without audience accepted",
+			scopes:  []string{"read", "write"},
+			options: []ConfigOption{WithAudienceless()},
+		},
+		{
+			name:      "Token for audience",
+			audiences: []string{"billing", "payments"},
+			scopes:    []string{"read"},
+		},
+		{
+			name:      "Token for another audience",
+			audiences: []string{"payments"},
+			scopes:    []string{"read"},
+			errCode:   auth.EInvalidToken,
+		},
+		{
+			name:      "Token without scope",
+			audiences: []string{"billing"},
+			errCode:   auth.EForbidden,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			options := append([]ConfigOption{
+				WithSecret(testSecret),
+				WithAudience("billing"),
+				WithScopes("read"),
+			}, tc.options...)
+			v := NewVerifier(options...)
+
+			token := newToken(auth.JWTAuthorized, time.Now().Add(time.Minute))
+			token.Audiences = tc.audiences
+			token.Scopes = tc.scopes
+			signedToken, clientID := signToken(t, testSecret, token)
+
+			_, err := v.Verify(context.Background(), signedToken, clientID)
+			if auth.ErrorCode(err) != tc.errCode {
+				t.Errorf("incorrect error code, want %s got %s", tc.errCode, auth.ErrorCode(err))
+			}
+		})
+	}
+}
+
+func TestMiddleware_VerifyPendingRequirements(t *testing.T) {
+	tt := []struct {
+		name               string
+		consentRequired    bool
+		enrollmentRequired bool
+		options            []ConfigOption
+		errCode            auth.ErrCode
+	}{
+		{
+			name: "Token without pending requirements",
+		},
+		{
+			name:            "Token with pending consent",
+			consentRequired: true,
+			errCode:         auth.EForbidden,
+		},
+		{
+			name:               "Token with pending enrollment",
+			enrollmentRequired: true,
+			errCode:            auth.EForbidden,
+		},
+		{
+			name:            "Pending consent accepted",
+			consentRequired: true,
+			options:         []ConfigOption{WithPendingConsent()},
+		},
+		{
+			name:               "Pending enrollment accepted",
+			enrollmentRequired: true,
+			options:            []ConfigOption{WithPendingEnrollment()},
+		},
+		{
+			name:               "Pending enrollment with consent accepted",
+			enrollmentRequired: true,
+			options:            []ConfigOption{WithPendingConsent()},
+			errCode:            auth.EForbidden,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewVerifier(append([]ConfigOption{WithSecret(testSecret)}, tc.options...)...)
+
+			token := newToken(auth.JWTAuthorized, time.Now().Add(time.Minute))
+			token.ConsentRequired = tc.consentRequired
+			token.EnrollmentRequired = tc.enrollmentRequired
+			signedToken, clientID := signToken(t, testSecret, token)
+
+			_, err := v.Verify(context.Background(), signedToken, clientID)
+			if auth.ErrorCode(err) != tc.errCode {
+				t.Errorf("incorrect error code, want %s got %s", tc.errCode, auth.ErrorCode(err))
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handler(t *testing.T) {
+	v := NewVerifier(WithSecret(testSecret))
+	signedToken, clientID := signToken(t, testSecret, newToken(auth.JWTAuthorized, time.Now().Add(time.Minute)))
+
+	var userID string
+	handler := v.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID = GetToken(r.Context()).UserID
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", signedToken)
+	r.AddCookie(&http.Cookie{Name: tokenLib.ClientIDCookie, Value: clientID})
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("incorrect status code, want %v got %v", http.StatusOK, w.Code)
+	}
+	if userID != "user-id" {
+		t.Errorf("incorrect user ID in context, want user-id got %s", userID)
+	}
+
+	userID = ""
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", signedToken)
+	r.Header.Set(httpapi.TokenClientIDHeader, clientID)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("incorrect status code, want %v got %v", http.StatusOK, w.Code)
+	}
+	if userID != "user-id" {
+		t.Errorf("incorrect user ID in context, want user-id got %s", userID)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", signedToken)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("incorrect status code, want %v got %v", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestMiddleware_StrictFingerprint(t *testing.T) {
+	client := httptest.NewRequest("GET", "/", nil)
+	client.Header.Set("User-Agent", "Mozilla/5.0")
+	client.Header.Set("Sec-CH-UA", `"Chromium";v="86"`)
+
+	token := newToken(auth.JWTAuthorized, time.Now().Add(time.Minute))
+	token.Fingerprint = fingerprint.FromRequest(client)
+	signedToken, clientID := signToken(t, testSecret, token)
+
+	// The introspection endpoint compares the fingerprint of the
+	// request it receives, as authenticator does in strict mode.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fingerprint.FromRequest(r) != token.Fingerprint {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	checkers := []struct {
+		name    string
+		checker RevocationChecker
+	}{
+		{"Redis checker", NewRedisChecker(memstore.New())},
+		{"Introspection checker", NewIntrospectionChecker(srv.URL, nil)},
+	}
+
+	tt := []struct {
+		name       string
+		userAgent  string
+		statusCode int
+	}{
+		{
+			name:       "Same client",
+			userAgent:  "Mozilla/5.0",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Other client",
+			userAgent:  "curl/7.64.1",
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, c := range checkers {
+		for _, tc := range tt {
+			t.Run(c.name+" "+tc.name, func(t *testing.T) {
+				v := NewVerifier(
+					WithSecret(testSecret),
+					WithStrictFingerprint(),
+					WithRevocationChecker(c.checker),
+				)
+				handler := v.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header.Set("Authorization", signedToken)
+				r.Header.Set(httpapi.TokenClientIDHeader, clientID)
+				r.Header.Set("User-Agent", tc.userAgent)
+				r.Header.Set("Sec-CH-UA", `"Chromium";v="86"`)
+				handler.ServeHTTP(w, r)
+
+				if w.Code != tc.statusCode {
+					t.Errorf("incorrect status code, want %v got %v", tc.statusCode, w.Code)
+				}
+			})
+		}
+	}
+
+	// Without strict mode the Verifier relies on the introspection
+	// endpoint, which must see the client's headers.
+	v := NewVerifier(WithSecret(testSecret), WithRevocationChecker(NewIntrospectionChecker(srv.URL, nil)))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header = client.Header.Clone()
+	r.Header.Set("Authorization", signedToken)
+	r.Header.Set(httpapi.TokenClientIDHeader, clientID)
+	if _, err := v.verifyRequest(r); err != nil {
+		t.Error("client headers not forwarded to introspection:", err)
+	}
+}
+
+func TestMiddleware_IntrospectionChecker(t *testing.T) {
+	tt := []struct {
+		name       string
+		statusCode int
+		errCode    auth.ErrCode
+		hasErr     bool
+	}{
+		{
+			name:       "Accepted token",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Rejected token",
+			statusCode: http.StatusUnauthorized,
+			errCode:    auth.EInvalidToken,
+			hasErr:     true,
+		},
+		{
+			name:       "Unavailable service",
+			statusCode: http.StatusInternalServerError,
+			errCode:    auth.EInternal,
+			hasErr:     true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				cookie, err := r.Cookie(tokenLib.ClientIDCookie)
+				if err != nil || cookie.Value != "client-id" {
+					t.Error("client ID cookie not forwarded")
+				}
+				if r.Header.Get(httpapi.TokenClientIDHeader) != "client-id" {
+					t.Error("client ID header not forwarded")
+				}
+				if r.Header.Get("Authorization") != "Bearer token" {
+					t.Error("authorization header not forwarded")
+				}
+				w.WriteHeader(tc.statusCode)
+			}))
+			defer srv.Close()
+
+			checker := NewIntrospectionChecker(srv.URL, nil)
+			err := checker.Check(context.Background(), &auth.Token{}, "Bearer token", "client-id")
+			if tc.hasErr != (err != nil) {
+				t.Fatalf("incorrect error result, want error %v got %v", tc.hasErr, err)
+			}
+			if tc.hasErr && auth.ErrorCode(err) != tc.errCode {
+				t.Errorf("incorrect error code, want %s got %s", tc.errCode, auth.ErrorCode(err))
+			}
+		})
+	}
+}
+
+func TestMiddleware_RedisChecker(t *testing.T) {
+	tt := []struct {
+		name        string
+		token       *auth.Token
+		idleTimeout time.Duration
+		setup       func(db *memstore.Store)
+		errCode     auth.ErrCode
+		hasErr      bool
+		lastActive  bool
+	}{
+		{
+			name:  "Valid token",
+			token: &auth.Token{UserID: "user-id"},
+			setup: func(db *memstore.Store) {},
+		},
+		{
+			name: "Revoked token",
+			token: &auth.Token{
+				StandardClaims: jwt.StandardClaims{Id: "token-id"},
+				UserID:         "user-id",
+			},
+			setup: func(db *memstore.Store) {
+				db.Set(context.Background(), tokenLib.RevocationKey("token-id"), true, time.Minute)
+			},
+			errCode: auth.EInvalidToken,
+			hasErr:  true,
+		},
+		{
+			name:  "Token from revoked generation",
+			token: &auth.Token{UserID: "user-id"},
+			setup: func(db *memstore.Store) {
+				db.Incr(context.Background(), tokenLib.GenerationKey("user-id"))
+			},
+			errCode: auth.EInvalidToken,
+			hasErr:  true,
+		},
+		{
+			name:  "Token from current generation",
+			token: &auth.Token{UserID: "user-id", Generation: 1},
+			setup: func(db *memstore.Store) {
+				db.Incr(context.Background(), tokenLib.GenerationKey("user-id"))
+			},
+		},
+		{
+			name: "Idle session",
+			token: &auth.Token{
+				StandardClaims: jwt.StandardClaims{
+					Id:       "token-id",
+					IssuedAt: time.Now().Add(-2 * time.Hour).Unix(),
+				},
+				UserID: "user-id",
+			},
+			idleTimeout: time.Hour,
+			setup:       func(db *memstore.Store) {},
+			errCode:     auth.EInvalidToken,
+			hasErr:      true,
+		},
+		{
+			name: "Session active within idle timeout",
+			token: &auth.Token{
+				StandardClaims: jwt.StandardClaims{
+					Id:       "token-id",
+					IssuedAt: time.Now().Add(-2 * time.Hour).Unix(),
+				},
+				UserID: "user-id",
+			},
+			idleTimeout: time.Hour,
+			setup: func(db *memstore.Store) {
+				lastActive := time.Now().Add(-30 * time.Minute).Unix()
+				db.Set(context.Background(), tokenLib.ActivityKey("token-id"), lastActive, time.Hour)
+			},
+			lastActive: true,
+		},
+		{
+			name: "Idle session without idle timeout",
+			token: &auth.Token{
+				StandardClaims: jwt.StandardClaims{
+					Id:       "token-id",
+					IssuedAt: time.Now().Add(-2 * time.Hour).Unix(),
+				},
+				UserID: "user-id",
+			},
+			setup: func(db *memstore.Store) {},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			db := memstore.New()
+			tc.setup(db)
+
+			checker := NewRedisChecker(db, WithIdleTimeout(tc.idleTimeout))
+			err := checker.Check(context.Background(), tc.token, "Bearer token", "client-id")
+			if tc.hasErr != (err != nil) {
+				t.Fatalf("incorrect error result, want error %v got %v", tc.hasErr, err)
+			}
+			if tc.hasErr && auth.ErrorCode(err) != tc.errCode {
+				t.Errorf("incorrect error code, want %s got %s", tc.errCode, auth.ErrorCode(err))
+			}
+			if !tc.lastActive {
+				return
+			}
+
+			lastActive, err := db.Get(context.Background(), tokenLib.ActivityKey(tc.token.Id)).Int64()
+			if err != nil {
+				t.Fatal("failed to retrieve token activity:", err)
+			}
+			if time.Since(time.Unix(lastActive, 0)) > time.Minute {
+				t.Error("token activity not recorded")
+			}
+		})
+	}
+}
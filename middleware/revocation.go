@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	redislib "github.com/go-redis/redis/v8"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	tokenLib "github.com/fmitra/authenticator/internal/token"
+)
+
+// rediser is an interface to go-redis.
+type rediser interface {
+	Get(ctx context.Context, key string) *redislib.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redislib.StatusCmd
+}
+
+type redisChecker struct {
+	db          rediser
+	idleTimeout time.Duration
+}
+
+// RedisCheckerOption configures the Redis RevocationChecker.
+type RedisCheckerOption func(*redisChecker)
+
+// WithIdleTimeout configures the Redis RevocationChecker to reject
+// sessions unused for the timeout and record the activity of the
+// remainder. It must match authenticator's token.idle-timeout.
+func WithIdleTimeout(d time.Duration) RedisCheckerOption {
+	return func(c *redisChecker) {
+		c.idleTimeout = d
+	}
+}
+
+// NewRedisChecker returns a RevocationChecker reading revocation
+// records directly from authenticator's Redis database.
+func NewRedisChecker(db rediser, options ...RedisCheckerOption) RevocationChecker {
+	c := &redisChecker{db: db}
+	for _, opt := range options {
+		opt(c)
+	}
+	return c
+}
+
+// Check returns an error if a token is revoked, issued before all of
+// the User's tokens were revoked, invalidated by a newer token or
+// belongs to an idle session.
+func (c *redisChecker) Check(ctx context.Context, token *auth.Token, signedToken, clientID string) error {
+	err := c.db.Get(ctx, tokenLib.RevocationKey(token.Id)).Err()
+	if err == nil {
+		return auth.ErrInvalidToken("token is revoked")
+	}
+	if err != redislib.Nil {
+		return fmt.Errorf("cannot lookup token revocation history: %w", err)
+	}
+
+	generation, err := c.db.Get(ctx, tokenLib.GenerationKey(token.UserID)).Int64()
+	if err != nil && err != redislib.Nil {
+		return fmt.Errorf("cannot lookup token generation: %w", err)
+	}
+	if token.Generation < generation {
+		return auth.ErrInvalidToken("token is revoked")
+	}
+
+	if token.CodeHash != "" {
+		ts, err := c.db.Get(ctx, tokenLib.InvalidationKey(token.Id)).Int64()
+		if err != nil && err != redislib.Nil {
+			return fmt.Errorf("cannot lookup token invalidation history: %w", err)
+		}
+		if err == nil && token.IssuedAt < ts {
+			return auth.ErrInvalidToken("token is revoked")
+		}
+	}
+
+	return c.checkActivity(ctx, token)
+}
+
+// checkActivity rejects tokens which were not used within the idle
+// timeout and records the activity of the remainder, sharing the
+// activity record of authenticator.
+func (c *redisChecker) checkActivity(ctx context.Context, token *auth.Token) error {
+	if c.idleTimeout <= 0 {
+		return nil
+	}
+
+	lastActive, err := c.db.Get(ctx, tokenLib.ActivityKey(token.Id)).Int64()
+	if err == redislib.Nil {
+		lastActive = token.IssuedAt
+	} else if err != nil {
+		return fmt.Errorf("cannot lookup token activity: %w", err)
+	}
+
+	now := time.Now()
+	idle := now.Sub(time.Unix(lastActive, 0))
+	if idle >= c.idleTimeout {
+		return auth.ErrInvalidToken("session is idle")
+	}
+	if idle < tokenLib.ActivityInterval {
+		return nil
+	}
+
+	err = c.db.Set(ctx, tokenLib.ActivityKey(token.Id), now.Unix(), c.idleTimeout).Err()
+	if err != nil {
+		return fmt.Errorf("cannot record token activity: %w", err)
+	}
+
+	return nil
+}
+
+type introspectionChecker struct {
+	url    string
+	client *http.Client
+}
+
+// NewIntrospectionChecker returns a RevocationChecker that validates
+// tokens against authenticator's token verification endpoint
+// (e.g. https://authenticator.local/api/v1/token/verify). It is
+// intended for services without access to authenticator's Redis database.
+func NewIntrospectionChecker(url string, client *http.Client) RevocationChecker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &introspectionChecker{url: url, client: client}
+}
+
+// Check returns an error if authenticator does not accept the token.
+func (c *introspectionChecker) Check(ctx context.Context, token *auth.Token, signedToken, clientID string) error {
+	req, err := http.NewRequest("POST", c.url, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create introspection request: %w", err)
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set(authorizationHeader, signedToken)
+	// The client ID is also delivered as a header as authenticator
+	// may be configured with a different cookie name.
+	req.AddCookie(&http.Cookie{Name: tokenLib.ClientIDCookie, Value: clientID})
+	req.Header.Set(httpapi.TokenClientIDHeader, clientID)
+	// Headers identifying the client are forwarded so authenticator
+	// compares the fingerprint of the client rather than this service.
+	if h, ok := ctx.Value(headersContextKey).(http.Header); ok {
+		for name, values := range h {
+			req.Header[name] = values
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("introspection request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return auth.ErrInvalidToken("token is revoked")
+	default:
+		return fmt.Errorf("unexpected introspection response: %s", resp.Status)
+	}
+}
@@ -6,6 +6,7 @@ CREATE TABLE IF NOT EXISTS auth_user (
 	id VARCHAR(26) PRIMARY KEY,
 	phone VARCHAR(20) UNIQUE NULL,
 	email VARCHAR(255) UNIQUE NULL,
+	email_canonical VARCHAR(255) UNIQUE NULL,
 	password VARCHAR(60) NOT NULL,
 	tfa_secret VARCHAR(70) NOT NULL,
 	is_sms_otp_allowed BOOLEAN DEFAULT false,
@@ -16,6 +17,13 @@ CREATE TABLE IF NOT EXISTS auth_user (
 	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp,
 	updated_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
 );
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS email_canonical VARCHAR(255) UNIQUE NULL;
+ALTER TABLE auth_user ALTER COLUMN phone TYPE TEXT;
+ALTER TABLE auth_user ALTER COLUMN email TYPE TEXT;
+ALTER TABLE auth_user ALTER COLUMN tfa_secret TYPE TEXT;
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS phone_index VARCHAR(64) UNIQUE NULL;
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS email_index VARCHAR(64) UNIQUE NULL;
+ALTER TABLE auth_user ADD COLUMN IF NOT EXISTS is_password_expired BOOLEAN DEFAULT false;
 CREATE TABLE IF NOT EXISTS device (
 	id VARCHAR(26) PRIMARY KEY,
 	user_id VARCHAR(26) REFERENCES auth_user(id) NOT NULL,
@@ -27,6 +35,11 @@ CREATE TABLE IF NOT EXISTS device (
 	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp,
 	updated_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
 );
+ALTER TABLE device ADD COLUMN IF NOT EXISTS backup_eligible BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE device ADD COLUMN IF NOT EXISTS backed_up BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE device ADD COLUMN IF NOT EXISTS model VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE device ADD COLUMN IF NOT EXISTS metadata_status VARCHAR(40) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS device_user_client_idx ON device (user_id, client_id);
 CREATE TABLE IF NOT EXISTS login_history (
 	token_id VARCHAR(26) PRIMARY KEY,
 	user_id VARCHAR(26) REFERENCES auth_user(id) NOT NULL,
@@ -35,4 +48,91 @@ CREATE TABLE IF NOT EXISTS login_history (
 	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp,
 	updated_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
 );
+ALTER TABLE login_history ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE login_history ADD COLUMN IF NOT EXISTS country VARCHAR(2) NOT NULL DEFAULT '';
+ALTER TABLE login_history ADD COLUMN IF NOT EXISTS city VARCHAR(255) NOT NULL DEFAULT '';
+CREATE TABLE IF NOT EXISTS login_digest (
+	user_id VARCHAR(26) PRIMARY KEY REFERENCES auth_user(id),
+	last_sent_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
+);
+CREATE TABLE IF NOT EXISTS organization (
+	id VARCHAR(26) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
+);
+CREATE TABLE IF NOT EXISTS membership (
+	organization_id VARCHAR(26) REFERENCES organization(id) NOT NULL,
+	user_id VARCHAR(26) REFERENCES auth_user(id) NOT NULL,
+	role VARCHAR(20) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp,
+	PRIMARY KEY (organization_id, user_id)
+);
+CREATE TABLE IF NOT EXISTS org_invitation (
+	id VARCHAR(26) PRIMARY KEY,
+	organization_id VARCHAR(26) REFERENCES organization(id) NOT NULL,
+	email VARCHAR(255) NOT NULL,
+	role VARCHAR(20) NOT NULL,
+	code_hash VARCHAR(128) NOT NULL,
+	invited_by VARCHAR(26) REFERENCES auth_user(id) NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
+);
+CREATE TABLE IF NOT EXISTS consent (
+	user_id VARCHAR(26) REFERENCES auth_user(id) NOT NULL,
+	policy VARCHAR(64) NOT NULL,
+	version VARCHAR(64) NOT NULL,
+	ip_address VARCHAR(45) NOT NULL DEFAULT '',
+	accepted_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp,
+	PRIMARY KEY (user_id, policy, version)
+);
+CREATE TABLE IF NOT EXISTS external_account (
+	external_id VARCHAR(255) PRIMARY KEY,
+	user_id VARCHAR(26) UNIQUE REFERENCES auth_user(id) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
+);
+CREATE TABLE IF NOT EXISTS client_application (
+	id VARCHAR(26) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	allowed_origins TEXT[] NOT NULL DEFAULT '{}',
+	token_expiry_seconds INT NOT NULL DEFAULT 0,
+	refresh_token_expiry_seconds INT NOT NULL DEFAULT 0,
+	required_tfa VARCHAR(20) NOT NULL DEFAULT 'otp',
+	logout_url TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
+);
+ALTER TABLE client_application ADD COLUMN IF NOT EXISTS audiences TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE client_application ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}';
+CREATE TABLE IF NOT EXISTS trusted_recovery (
+	user_id VARCHAR(26) PRIMARY KEY REFERENCES auth_user(id),
+	contacts TEXT[] NOT NULL DEFAULT '{}',
+	threshold INT NOT NULL,
+	code_hash VARCHAR(128) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
+);
+ALTER TABLE trusted_recovery ADD COLUMN IF NOT EXISTS verified TEXT[] NOT NULL DEFAULT '{}';
+CREATE TABLE IF NOT EXISTS canary (
+	identity VARCHAR(255) PRIMARY KEY,
+	note VARCHAR(255) NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
+);
+CREATE TABLE IF NOT EXISTS message_delivery (
+	id VARCHAR(26) PRIMARY KEY,
+	type VARCHAR(30) NOT NULL,
+	delivery VARCHAR(10) NOT NULL,
+	address VARCHAR(255) NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	detail VARCHAR(255) NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp,
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
+);
+CREATE INDEX IF NOT EXISTS message_delivery_address_idx ON message_delivery (address, created_at);
+CREATE TABLE IF NOT EXISTS tfa_enrollment (
+	user_id VARCHAR(26) PRIMARY KEY REFERENCES auth_user(id),
+	deadline TIMESTAMP WITH TIME ZONE NOT NULL,
+	last_reminded_at TIMESTAMP WITH TIME ZONE NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
+);
 `
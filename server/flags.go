@@ -0,0 +1,282 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	flag "github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/fmitra/authenticator/internal/branding"
+	"github.com/fmitra/authenticator/internal/token"
+)
+
+// RegisterFlags registers a flag for every setting read by New,
+// along with its default value.
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.String("api.http-addr", ":8080", "Address to listen on. Supports unix:// and systemd:// schemes")
+	fs.String("api.base-path", "/api/v1", "Path prefix all APIs are served under, e.g. /auth/api/v1")
+	fs.String("api.disabled-modules", "", "Comma separated list of APIs not to serve: login, recovery, signup, device, contact, totp, token, login-digest, org, consent, profile, security, delivery, attestation and admin")
+	fs.String("branding.name", branding.DefaultName, "Product name shown in messages, web pages and authenticator apps")
+	fs.String("branding.logo-url", "", "HTTPS URL of the product logo shown in emails and web pages")
+	fs.String("branding.color", branding.DefaultColor, "Accent color of emails and web pages, as a hex color or CSS color name")
+	fs.String("branding.support-email", "", "Support address shown in emails and web pages. Omitted if empty")
+	fs.Bool("ui.enabled", false, "Serve a reference login, signup and 2FA web UI on /ui")
+	fs.Bool("links.enabled", false, "Serve landing pages for approval and cancellation links on /links, e.g. /links/approve-login")
+	fs.String("links.template-file", "", "Path to an html/template file replacing the default landing page")
+	fs.String("links.success-redirect-url", "", "URL to redirect to after a landing page action succeeds, instead of showing a result page")
+	fs.String("links.failure-redirect-url", "", "URL to redirect to after a landing page action fails, instead of showing a result page")
+	fs.String("api.internal-addr", "", "Address to serve Prometheus metrics on /metrics and message queue state on /internal/queues. Disabled if empty")
+	fs.Duration("api.read-timeout", time.Second*5, "Maximum duration for reading a request, including its body")
+	fs.Duration("api.read-header-timeout", 0, "Maximum duration for reading request headers, 0 uses the read timeout")
+	fs.Duration("api.write-timeout", time.Second*10, "Maximum duration before timing out writes of a response")
+	fs.Duration("api.idle-timeout", time.Second*30, "Maximum duration to wait for the next request on a keep-alive connection")
+	fs.Int("api.max-header-bytes", http.DefaultMaxHeaderBytes, "Maximum size of request headers, in bytes")
+	fs.Int64("api.max-body-bytes", 1<<20, "Maximum size of request bodies, in bytes. Unlimited if 0")
+	fs.Int("api.max-json-depth", 32, "Maximum nesting depth of JSON request bodies. Unlimited if 0")
+	fs.Bool("api.strict-json", false, "Reject JSON request bodies containing unknown fields")
+	fs.Bool("api.http2", true, "Enable HTTP/2 for TLS connections")
+	fs.Bool("api.h2c", false, "Enable HTTP/2 without TLS for gRPC-aware load balancers")
+	fs.Int("api.http2-max-concurrent-streams", 0, "Maximum HTTP/2 streams per connection, 0 uses the default")
+	fs.String("api.allowed-origins", "*", "Comma separated list of allowed origins. Origins only allowed by * may not send credentials")
+	fs.String("api.cors-rules", "", "Semicolon separated CORS rules overriding allowed origins for route prefixes, e.g. /api/v1/admin/=https://admin.internal")
+	fs.String("api.cookie-domain", "", "Domain to set HTTP cookie")
+	fs.Int("api.cookie-max-age", 605800, "Max age of cookie, in seconds")
+	fs.String("api.cookie-path", "/", "Path to set HTTP cookie")
+	fs.Bool("api.cookie-secure", true, "Restrict HTTP cookies to HTTPS")
+	fs.String("api.cookie-same-site", "", "SameSite attribute of HTTP cookies: lax, strict or none. Omitted if empty")
+	fs.Bool("api.cookie-host-only", false, "Restrict HTTP cookies to the API host with the __Host- prefix, ignoring the cookie domain and path")
+	fs.String("api.cookie-client-id-name", token.ClientIDCookie, "Name of the client ID cookie")
+	fs.String("api.cookie-refresh-token-name", token.RefreshTokenCookie, "Name of the refresh token cookie")
+	fs.String("api.ip-allowlist", "", "Comma separated list of CIDR ranges allowed to access the API")
+	fs.String("api.ip-denylist", "", "Comma separated list of CIDR ranges denied access to the API")
+	fs.String("api.trusted-proxies", "", "Comma separated list of CIDR ranges trusted to set X-Forwarded-For")
+	fs.Int("api.trusted-proxy-hops", 0, "Number of reverse proxies in front of the API")
+	fs.String("api.tls.cert-file", "", "Path to a TLS certificate file")
+	fs.String("api.tls.key-file", "", "Path to a TLS private key file")
+	fs.String("api.tls.min-version", "1.2", "Minimum TLS version to accept")
+	fs.String("api.tls.autocert-domains", "", "Comma separated list of domains to request ACME certificates for")
+	fs.String("api.tls.autocert-email", "", "Contact email for the ACME account")
+	fs.String("api.tls.autocert-cache-dir", "certs", "Directory to cache ACME certificates")
+	fs.String("api.tls.redirect-addr", "", "Address to listen on for HTTP to HTTPS redirects")
+	fs.String("pg.conn-string", "", "Postgres connection string")
+	fs.String("pg.encryption.key", "", "Secret key to encrypt PII columns of users. Encryption is disabled if empty")
+	fs.Int("pg.encryption.version", 1, "Version of the PII encryption key. Increment when rotating the key")
+	fs.String("pg.encryption.retired-keys", "", "Comma separated version:key list of previous PII encryption keys")
+	fs.String("pg.encryption.index-key", "", "Secret key of blind indexes used to look up encrypted phones and emails. Must not change")
+	fs.String("pg.replica-conn-string", "", "Read-only Postgres connection string for replica reads")
+	fs.Int("pg.max-open-conns", 0, "Maximum open Postgres connections, 0 is unlimited")
+	fs.Int("pg.max-idle-conns", 2, "Maximum idle Postgres connections")
+	fs.Duration("pg.conn-max-lifetime", 0, "Maximum lifetime of a Postgres connection, 0 is unlimited")
+	fs.Duration("pg.query-timeout", time.Second*5, "Maximum duration of a Postgres query, 0 disables the timeout")
+	fs.Duration("pg.slow-query-threshold", time.Millisecond*500, "Log Postgres queries slower than this, 0 disables logging")
+	fs.String("phone.default-region", "", "ISO 3166-1 region of phone numbers supplied without a country code. Country codes are required if empty")
+	fs.Bool("email.match-aliases", false, "Match Gmail addresses which differ only by dots or a plus suffix. Requires the email-canonical migration when changed")
+	fs.String("redis.conn-string", "", "Redis connection string")
+	fs.String("redis.mode", "standalone", "Redis topology: standalone, cluster, sentinel or memory")
+	fs.String("redis.addrs", "", "Comma separated list of cluster nodes or sentinel addresses")
+	fs.String("redis.master-name", "", "Sentinel master name")
+	fs.String("redis.password", "", "Redis password for cluster and sentinel topologies")
+	fs.Int("redis.db", 0, "Redis database for sentinel topologies")
+	fs.Duration("redis.op-timeout", time.Second, "Deadline for OTP and WebAuthn session Redis operations")
+	fs.Int("ratelimit.shards", 1, "Redis keys each rate limit counter is split across to avoid hot keys")
+	fs.Int("ratelimit.batch", 1, "Requests counted in process before they are added to Redis in a single increment")
+	fs.Int("password.min-length", 8, "Minimum password length")
+	fs.Int("password.max-length", 1000, "Maximum password length")
+	fs.Int("password.cost", 10, "bcrypt cost of password hashes. The minimum cost when tuning to a target duration")
+	fs.Duration("password.target-duration", 0, "Tune the bcrypt cost at startup to the highest cost hashing within this duration, 0 uses the configured cost")
+	fs.Int("password.api-cost", 0, "bcrypt cost of password hashes of users logging in from API clients. The minimum cost when tuning to a target duration, 0 uses password.cost")
+	fs.Duration("password.api-target-duration", 0, "Tune the API bcrypt cost at startup to the highest cost hashing within this duration, 0 uses the configured API cost")
+	fs.Int("otp.code-length", 6, "OTP code length")
+	fs.String("otp.issuer", "", "TOTP issuer shown in authenticator apps. Defaults to the branding name")
+	fs.String("otp.secret.key", "", "Encryption key for TOTP secrets")
+	fs.Int("otp.secret.version", 1, "Current version of encryption key")
+	fs.Int("msgconsumer.workers", 4, "Number of workers delivering normal priority messages, such as security alerts")
+	fs.Int("msgconsumer.high-priority-workers", 4, "Number of workers delivering high priority messages, such as OTP codes")
+	fs.Int("msgconsumer.low-priority-workers", 1, "Number of workers delivering low priority messages, such as digests and invitations")
+	fs.Int("msgconsumer.queue-size", 100, "Number of messages of each priority held in memory awaiting a worker")
+	fs.Duration("msgconsumer.drain-timeout", time.Second*10, "Maximum duration to deliver queued messages on shutdown")
+	fs.Int("msgconsumer.stats-retention", 30, "Days the outcomes of message deliveries are retained for the admin stats API")
+	fs.Duration("messaging.dedup-window", time.Second*30, "Time an identical message to the same address is dropped for, and a login code reused for, after it is sent, 0 disables deduplication")
+	fs.String("messaging.app-name", "", "Name of the service in messages, available to templates as {{app_name}}. Defaults to the branding name")
+	fs.String("messaging.sms-templates-file", "", "Path to a JSON file of SMS templates by locale and message type")
+	fs.String("messaging.senders", "", "Semicolon separated sender overrides by message category and client application, e.g. otp=Example <otp@example.com>;client-id/*=Partner")
+	fs.Duration("token.expires-in", time.Minute*20, "JWT token expiry time")
+	fs.Duration("token.refresh-expires-in", time.Hour*24*15, "Refresh token expiry time")
+	fs.String("token.issuer", "authenticator", "JWT token issuer")
+	fs.String("token.secret", "", "JWT token secret")
+	fs.String("token.audiences", "", "Comma separated list of audiences which may be requested for a token")
+	fs.String("token.scopes", "", "Comma separated list of scopes which may be requested for a token")
+	fs.Duration("token.idle-timeout", 0, "Invalidate sessions unused for this duration, 0 disables idle invalidation")
+	fs.String("token.claims", "full", "Claims identifying users in tokens: full, minimal to omit email and phone, or encrypted to encrypt tokens as JWE")
+	fs.Duration("token.min-ttl", time.Minute, "Shortest lifetime clients may request for a session, e.g. for kiosk logins")
+	fs.Duration("token.leeway", 0, "Clock skew tolerated when validating the iat, exp and nbf claims of a token")
+	fs.Int("token.revocation-cache-size", 0, "Revocation records of tokens cached in process, invalidated through Redis pub/sub. Disabled if 0")
+	fs.Duration("token.revocation-cache-ttl", time.Second*30, "Maximum duration a revocation record is cached for")
+	fs.String("token.fingerprint-binding", "off", "Bind tokens to the client's fingerprint: off, log or strict")
+	fs.Int64("token.quota.user-creates", 0, "Tokens which may be created per hour for a user. Unlimited if 0")
+	fs.Int64("token.quota.user-refreshes", 0, "Tokens which may be refreshed per hour for a user. Unlimited if 0")
+	fs.Int64("token.quota.tenant-creates", 0, "Tokens which may be created per hour for a client application. Unlimited if 0")
+	fs.Int64("token.quota.tenant-refreshes", 0, "Tokens which may be refreshed per hour for a client application. Unlimited if 0")
+	fs.Duration("action-token.expires-in", time.Minute*30, "Single use action token expiry time")
+	fs.Duration("org.invite-expires-in", time.Hour*24*7, "Time an organization invitation may be accepted")
+	fs.String("login.approval-url", "", "URL delivered to users to approve a login from another device. Login approval is disabled if empty")
+	fs.Duration("login.approval-expires-in", time.Minute*10, "Time a login approval link may be used")
+	fs.Bool("login.require-tfa-enrollment", false, "Require users to enable a TOTP app or WebAuthn device, restricting their tokens to 2FA and contact setup until they do")
+	fs.Duration("login.tfa-enrollment-grace-period", 0, "Time users may keep full access after their first login before enrolling a second factor is enforced. Enforced immediately if 0")
+	fs.Duration("login.tfa-enrollment-reminder-period", time.Hour*72, "How often users within the grace period are reminded to enroll a second factor")
+	fs.Duration("login.tfa-enrollment-reminder-interval", time.Hour, "Interval to check for due enrollment reminders")
+	fs.String("login.tfa-policy", "", "Comma separated factor combinations which authorize a login, e.g. password+device,password+totp,passkey. Any 2FA option or a passkey is accepted if empty")
+	fs.Int64("login.lockout.max-failures", 0, "Failed passwords within the lockout window which lock an account. Lockout is disabled if 0")
+	fs.Duration("login.lockout.window", time.Minute*15, "Window in which failed passwords are counted towards a lockout")
+	fs.Duration("login.lockout.duration", time.Minute*30, "Time an account remains locked unless unlocked with a code delivered to a verified contact")
+	fs.String("login.password-reset-url", "", "URL delivered to users to set a new password after an operator expires it. The reset token is appended as the token query parameter")
+	fs.Duration("login.password-reset-expires-in", time.Hour*72, "Time a password reset link may be used")
+	fs.String("recovery.cancel-url", "", "URL delivered to users to cancel an account recovery. Account recovery is disabled if empty")
+	fs.String("recovery.contact-verify-url", "", "URL delivered to trusted contacts to confirm they received their share. Trusted contacts are disabled if empty")
+	fs.Duration("recovery.delay", time.Hour*24, "Time before a device or trusted contact verified account recovery may be completed")
+	fs.Duration("recovery.window", time.Hour*72, "Time after the delay in which an account recovery may be completed")
+	fs.Int("recovery.max-trusted-contacts", 5, "Maximum amount of trusted contacts a user may designate for recovery")
+	fs.String("contact.cancel-url", "", "URL delivered to users to cancel a pending security change. Changes are applied immediately if empty")
+	fs.Duration("contact.change-delay", 0, "Time before changing an email address, removing the last OTP method, removing the last WebAuthn device or disabling TOTP takes effect, 0 applies changes immediately")
+	fs.Duration("contact.change-window", time.Hour*72, "Time after the delay in which a security change may be applied")
+	fs.Int("webauthn.max-devices", 5, "Maximum amount of devices for registration")
+	fs.String("webauthn.display-name", "Authenticator", "Webauthn display name")
+	fs.String("webauthn.domain", "authenticator.local", "Public client domain")
+	fs.String("webauthn.request-origin", "authenticator.local", "Comma separated origins of client requests, may include wildcard subdomains, e.g. https://*.example.com")
+	fs.String("webauthn.relying-parties", "", "Comma separated relying parties for additional frontends, chosen by request origin, e.g. https://app.example.org=example.org")
+	fs.Duration("webauthn.session-ttl", time.Minute*10, "Time a client has to answer a registration or login challenge")
+	fs.Duration("webauthn.challenge-timeout", time.Minute*2, "Time clients wait for the user to interact with their device")
+	fs.String("webauthn.user-verification", "preferred", "User verification requirement: required, preferred or discouraged")
+	fs.Bool("webauthn.block-compromised", false, "Reject registration of revoked or compromised authenticator models")
+	fs.String("webauthn.u2f-app-id", "", "FIDO U2F AppID of imported legacy keys. Leave empty to disable imports")
+	fs.String("mds.url", "", "URL of the FIDO Metadata Service BLOB. Leave empty to disable")
+	fs.String("mds.root-cert", "", "Path to PEM root certificates trusted to sign the metadata BLOB")
+	fs.Duration("mds.refresh-interval", time.Hour*24, "Interval to refresh authenticator metadata")
+	fs.String("geo.city-database", "", "Path to a MaxMind GeoLite2 City or Country database. Leave empty to disable")
+	fs.String("geo.asn-database", "", "Path to a MaxMind GeoLite2 ASN database used to group anomalies by network")
+	fs.Duration("geo.reload-interval", time.Minute, "Interval to check geo databases for changes")
+	fs.Bool("attestation.required", false, "Require mobile app attestation for signup and login")
+	fs.Duration("attestation.challenge-ttl", time.Minute*5, "Time an attestation challenge may be used")
+	fs.String("attestation.android.package-name", "", "Android package name to verify with Play Integrity")
+	fs.String("attestation.android.credentials-file", "", "Path to a Google service account key for Play Integrity")
+	fs.String("attestation.ios.app-id", "", "iOS team and bundle ID to verify with App Attest")
+	fs.Bool("attestation.ios.allow-development", false, "Accept App Attest attestations from the development environment")
+	fs.Duration("anomaly.window", time.Minute*5, "Window in which failed logins are counted per source")
+	fs.Duration("anomaly.interval", time.Minute, "Interval to analyze failed logins")
+	fs.Int64("anomaly.min-failures", 50, "Failed logins from a source before it is flagged")
+	fs.Int64("anomaly.min-accounts", 10, "Distinct accounts targeted by a source before it is flagged")
+	fs.Duration("anomaly.flag-duration", time.Hour, "Duration a source remains flagged")
+	fs.Int64("anomaly.flagged-rate-limit", 5, "Login requests per minute allowed from a flagged source")
+	fs.Int("anomaly.ipv4-prefix", 24, "IPv4 prefix length used to group sources")
+	fs.Int("anomaly.ipv6-prefix", 48, "IPv6 prefix length used to group sources")
+	fs.String("anomaly.alert-webhook-url", "", "Webhook URL to receive alerts for flagged sources")
+	fs.String("anomaly.captcha.verify-url", "", "CAPTCHA siteverify URL required from flagged sources")
+	fs.String("anomaly.captcha.secret", "", "CAPTCHA provider secret")
+	fs.String("anomaly.captcha.site-key", "", "Public CAPTCHA site key returned to clients which are challenged")
+	fs.String("reputation.tor-list-url", "", "URL of a list of Tor exit nodes, e.g. https://check.torproject.org/torbulkexitlist")
+	fs.String("reputation.vpn-list-url", "", "URL of a list of VPN addresses and CIDR ranges")
+	fs.String("reputation.proxy-list-url", "", "URL of a list of proxy addresses and CIDR ranges")
+	fs.Duration("reputation.refresh-interval", time.Hour, "Interval to refresh network lists")
+	fs.String("reputation.api-url", "", "URL of a third-party API classifying addresses not found in any list")
+	fs.String("reputation.api-key", "", "Bearer token for the reputation API")
+	fs.Duration("reputation.cache-ttl", time.Hour, "Duration reputation API results are cached")
+	fs.String("reputation.tor-action", "allow", "Action for logins from Tor: allow, step-up or block")
+	fs.String("reputation.vpn-action", "allow", "Action for logins from VPNs: allow, step-up or block")
+	fs.String("reputation.proxy-action", "allow", "Action for logins from proxies: allow, step-up or block")
+	fs.Bool("signup-abuse.enabled", false, "Throttle bursts of registrations by source, device fingerprint and email domain")
+	fs.Duration("signup-abuse.window", time.Hour, "Window in which signup attempts are counted")
+	fs.Int64("signup-abuse.source-limit", 20, "Signup attempts allowed from a source within a window before they are throttled")
+	fs.Int64("signup-abuse.fingerprint-limit", 5, "Signup attempts allowed from a device fingerprint within a window before they are throttled")
+	fs.Int64("signup-abuse.domain-limit", 100, "Signup attempts allowed for an email domain within a window before a CAPTCHA is required")
+	fs.String("signup-abuse.disposable-domains-file", "", "Path to a list of disposable email domains, one per line, requiring a CAPTCHA. A built-in list is used if not set")
+	fs.String("signup-abuse.allowlist.networks", "", "Comma separated list of IP addresses or CIDR ranges exempt from signup throttling")
+	fs.String("signup-abuse.allowlist.domains", "", "Comma separated list of email domains exempt from domain heuristics")
+	fs.String("admin.api-key", "", "API key for admin routes. Admin routes are disabled if not set")
+	fs.String("admin.ip-allowlist", "", "Comma separated list of CIDR ranges allowed to access admin routes")
+	fs.String("admin.ip-denylist", "", "Comma separated list of CIDR ranges denied access to admin routes")
+	fs.String("canary.alert-webhook-url", "", "Webhook URL to receive alerts for canary login attempts")
+	fs.String("canary.alert-recipients", "", "Comma separated list of emails, phone numbers or Matrix IDs to alert of canary login attempts")
+	fs.Duration("login-digest.period", time.Hour*24*7, "How often subscribed users receive a login digest")
+	fs.Duration("login-digest.interval", time.Hour, "Interval to check for due login digests")
+	fs.Int("login-digest.batch-size", 100, "Maximum login digests sent per interval")
+	fs.String("hooks.script-path", "", "Path to a Lua script defining before_signup, after_signup, after_login or before_token_issue functions. Script hooks are disabled if empty")
+	fs.Duration("hooks.script-timeout", time.Millisecond*100, "Maximum time a script hook may run")
+	fs.Bool("hooks.script-fail-open", false, "Allow requests when a script hook fails or times out instead of failing them")
+	fs.Bool("signup.require-email", false, "Require an email address to sign up")
+	fs.Bool("signup.require-phone", false, "Require a phone number to sign up")
+	fs.Bool("signup.require-password", true, "Require a password to sign up. Users without a password login with OTP codes")
+	fs.String("signup.denied-regions", "", "Comma separated list of ISO 3166-1 alpha-2 region codes denied signup")
+	fs.String("signup.region-header", "", "Header set by a trusted proxy with the client's ISO 3166-1 alpha-2 region code")
+	fs.Int("signup.minimum-age", 0, "Minimum age in years to sign up. A birth date is required when set")
+	fs.Bool("signup.reject-mixed-scripts", false, "Reject email addresses mixing letters of different scripts, such as Cyrillic lookalikes of Latin letters")
+	fs.Duration("signup.resend-cooldown", time.Minute, "Duration an address must wait before another signup code is resent")
+	fs.Int64("signup.resend-limit", 5, "Signup codes which may be resent to an address within the resend window")
+	fs.Duration("signup.resend-window", time.Hour, "Window in which resent signup codes are counted per address")
+	fs.String("consent.required-policies", "", "Comma separated list of policy=version pairs users must accept to complete login")
+	fs.String("features.disabled", "", "Comma separated list of features disabled by default. Operators may toggle features at runtime through the admin API")
+	fs.Duration("features.cache-ttl", time.Second*10, "Duration runtime feature flag overrides are cached")
+	fs.Duration("client.refresh-interval", time.Minute, "Interval registered client applications are reloaded from the database")
+	fs.String("client.logout-secret", "", "Secret used to sign back-channel logout notifications. Notifications are disabled if empty")
+	fs.Bool("maintenance.enabled", false, "Start in maintenance mode, rejecting requests which modify state")
+	fs.Duration("maintenance.retry-after", time.Minute*5, "Retry-After duration returned to clients during maintenance")
+	fs.Duration("idempotency.ttl", time.Minute*10, "Duration responses to requests with an Idempotency-Key header are replayed. Disabled if 0")
+	fs.String("external-users.conn-string", "", "Postgres connection string for an external user database. Login credentials are verified externally if set")
+	fs.String("external-users.table", "users", "Table holding external users")
+	fs.String("external-users.id-column", "id", "Column holding an external user's unique ID")
+	fs.String("external-users.email-column", "email", "Column holding an external user's email address")
+	fs.String("external-users.phone-column", "", "Column holding an external user's phone number. Phone login is disabled if not set")
+	fs.String("external-users.password-column", "password", "Column holding an external user's bcrypt password hash")
+	fs.String("providers.proxy", "", "URL of a proxy requests to messaging providers are sent through. If not set, HTTP_PROXY, HTTPS_PROXY and NO_PROXY are honored")
+	fs.Duration("providers.timeout", time.Second*10, "Time to connect to a messaging provider and await its response on each attempt of a request")
+	fs.Int("providers.max-retries", 2, "Times a request to a messaging provider is retried when the provider is unavailable or rate limiting")
+	fs.Duration("providers.retry-wait", time.Millisecond*500, "Base time to wait before retrying a request to a messaging provider, doubled on each retry")
+	fs.Duration("providers.max-retry-wait", time.Second*5, "Maximum time to wait before retrying a request to a messaging provider")
+	fs.Bool("faults.enabled", false, "Inject faults into dependencies. For staging environments only")
+	fs.String("faults.postgres", "", "Latency and error rate injected into Postgres queries, e.g. 200ms,0.05")
+	fs.String("faults.redis", "", "Latency and error rate injected into Redis commands, e.g. 50ms,0.01")
+	fs.String("faults.providers", "", "Latency and error rate injected into messaging provider requests, e.g. 2s,0.2")
+	fs.Duration("clock.offset", 0, "Offset applied to the clock used to issue and expire tokens, OTP codes and messages, e.g. -30s. For debugging clock skew only")
+	fs.String("twilio.account-sid", "", "Account SID from Twilio")
+	fs.String("twilio.token", "", "Authentication token for Twilio API")
+	fs.String("twilio.sms-sender", "", "Origin phone number for outgoing SMS")
+	fs.String("twilio.sender-id", "", "Alphanumeric sender ID, such as a brand name, to send SMS from where carriers allow it")
+	fs.String("twilio.numeric-sender-regions", "US,CA", "Comma separated regions whose carriers reject alphanumeric sender IDs. SMS to these regions are sent from twilio.sms-sender")
+	fs.String("twilio.status-callback-url", "", "Public URL of the Twilio status callback route. SMS delivery status is not reported if not set")
+	fs.String("mail.server-addr", "", "Outgoing mail server")
+	fs.String("mail.from-addr", "", "Origin email address for outgoing email")
+	fs.String("mail.auth.username", "", "Username for mailing service")
+	fs.String("mail.auth.password", "", "Password for mailing service")
+	fs.String("mail.auth.hostname", "", "Hostname for mailing service")
+	fs.String("mail.tls", "opportunistic", "Securing of connections to the mail server: opportunistic, starttls, implicit or none")
+	fs.Duration("mail.timeout", time.Second*30, "Time to connect to the mail server and to deliver each message")
+	fs.Int("mail.max-idle-conns", 2, "Idle connections to the mail server kept open for reuse, 0 disables reuse")
+	fs.String("mail.dkim.domain", "", "Domain outgoing mail is signed for with DKIM. DKIM signing is disabled if not set")
+	fs.String("mail.dkim.selector", "", "Selector of the DKIM public key record, published at <selector>._domainkey.<domain>")
+	fs.String("mail.dkim.private-key-file", "", "Path to the PEM encoded RSA or Ed25519 DKIM private key")
+	fs.String("sendgrid.api-key", "", "Sendgrid API Key for mailing services")
+	fs.String("sendgrid.from-addr", "", "Origin email address for outgoing email")
+	fs.String("sendgrid.from-name", "", "Origin name for outgoing email")
+	fs.String("sendgrid.webhook-public-key", "", "Base64 encoded verification key of the Sendgrid event webhook. Email delivery status is not reported if not set")
+	fs.String("maillib", "", "Email library to use. If not set, it will us net/smtp")
+	fs.String("signal.gateway-url", "", "URL of a signal-cli REST gateway to deliver SMS over Signal. Signal delivery is disabled if not set")
+	fs.String("signal.number", "", "Phone number registered with Signal to send messages from")
+	fs.Bool("signal.fallback-to-sms", true, "Deliver messages through Twilio SMS when Signal cannot, such as to recipients not registered with Signal")
+	fs.Duration("signal.health-interval", time.Second*30, "Time the health of the Signal gateway is cached for")
+	fs.String("matrix.homeserver-url", "", "URL of the homeserver of the Matrix bot account delivering messages. Matrix delivery is disabled if not set")
+	fs.String("matrix.access-token", "", "Access token of the Matrix bot account")
+}
+
+// NewSettings returns settings holding the default value of every
+// flag registered by RegisterFlags. Programs embedding a Server
+// override individual settings with Set before calling New.
+func NewSettings() *viper.Viper {
+	fs := flag.NewFlagSet("authenticator", flag.ContinueOnError)
+	RegisterFlags(fs)
+
+	settings := viper.New()
+	// BindPFlags only fails on a nil flag, which RegisterFlags
+	// never registers.
+	_ = settings.BindPFlags(fs)
+	return settings
+}
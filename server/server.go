@@ -0,0 +1,1765 @@
+// Package server wires the authenticator's services into an HTTP API.
+// It is used by cmd/api and may be embedded by other Go programs to run
+// the authenticator in-process:
+//
+//	settings := server.NewSettings()
+//	settings.Set("pg.conn-string", "...")
+//	settings.Set("token.secret", "...")
+//
+//	srv, err := server.New(server.Config{Settings: settings, Logger: logger})
+//	if err != nil {
+//		return err
+//	}
+//	defer srv.Close()
+//
+//	srv.Router().HandleFunc("/api/v1/platform/status", status)
+//	return srv.Run(ctx)
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/crypto/bcrypt"
+
+	auth "github.com/fmitra/authenticator"
+	"github.com/fmitra/authenticator/internal/actiontoken"
+	"github.com/fmitra/authenticator/internal/adminapi"
+	"github.com/fmitra/authenticator/internal/anomaly"
+	"github.com/fmitra/authenticator/internal/attestation"
+	"github.com/fmitra/authenticator/internal/attestationapi"
+	"github.com/fmitra/authenticator/internal/branding"
+	"github.com/fmitra/authenticator/internal/canary"
+	"github.com/fmitra/authenticator/internal/clientapp"
+	"github.com/fmitra/authenticator/internal/clock"
+	"github.com/fmitra/authenticator/internal/consent"
+	"github.com/fmitra/authenticator/internal/consentapi"
+	"github.com/fmitra/authenticator/internal/contactapi"
+	"github.com/fmitra/authenticator/internal/contactchecker"
+	"github.com/fmitra/authenticator/internal/deliveryapi"
+	"github.com/fmitra/authenticator/internal/deliverystats"
+	"github.com/fmitra/authenticator/internal/deviceapi"
+	"github.com/fmitra/authenticator/internal/enrollmentreminder"
+	"github.com/fmitra/authenticator/internal/externaluser"
+	"github.com/fmitra/authenticator/internal/faultinject"
+	"github.com/fmitra/authenticator/internal/featureflag"
+	"github.com/fmitra/authenticator/internal/fidomds"
+	"github.com/fmitra/authenticator/internal/fingerprint"
+	"github.com/fmitra/authenticator/internal/geo"
+	"github.com/fmitra/authenticator/internal/hooks"
+	"github.com/fmitra/authenticator/internal/httpapi"
+	"github.com/fmitra/authenticator/internal/linkpages"
+	"github.com/fmitra/authenticator/internal/loginapi"
+	"github.com/fmitra/authenticator/internal/logindigest"
+	"github.com/fmitra/authenticator/internal/logindigestapi"
+	"github.com/fmitra/authenticator/internal/mail"
+	"github.com/fmitra/authenticator/internal/matrix"
+	"github.com/fmitra/authenticator/internal/memstore"
+	"github.com/fmitra/authenticator/internal/msgconsumer"
+	"github.com/fmitra/authenticator/internal/msgpublisher"
+	"github.com/fmitra/authenticator/internal/msgrepo"
+	"github.com/fmitra/authenticator/internal/orgapi"
+	"github.com/fmitra/authenticator/internal/otp"
+	"github.com/fmitra/authenticator/internal/password"
+	"github.com/fmitra/authenticator/internal/postgres"
+	"github.com/fmitra/authenticator/internal/profileapi"
+	"github.com/fmitra/authenticator/internal/recoveryapi"
+	"github.com/fmitra/authenticator/internal/reputation"
+	"github.com/fmitra/authenticator/internal/securityapi"
+	"github.com/fmitra/authenticator/internal/securitychange"
+	"github.com/fmitra/authenticator/internal/sendgrid"
+	"github.com/fmitra/authenticator/internal/signalcli"
+	"github.com/fmitra/authenticator/internal/signupabuse"
+	"github.com/fmitra/authenticator/internal/signupapi"
+	"github.com/fmitra/authenticator/internal/signuppolicy"
+	"github.com/fmitra/authenticator/internal/token"
+	"github.com/fmitra/authenticator/internal/tokenapi"
+	"github.com/fmitra/authenticator/internal/totpapi"
+	"github.com/fmitra/authenticator/internal/twilio"
+	"github.com/fmitra/authenticator/internal/webauthn"
+	"github.com/fmitra/authenticator/internal/webui"
+)
+
+// keyValueStore is the storage shared by the token, action token, OTP,
+// WebAuthn, feature flag, anomaly, signup, login, recovery and contact
+// services as well as idempotent requests. It is satisfied by go-redis
+// clients as well as the in-memory store.
+type keyValueStore interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SMembers(ctx context.Context, key string) *redis.StringSliceCmd
+	PFAdd(ctx context.Context, key string, els ...interface{}) *redis.IntCmd
+	PFCount(ctx context.Context, keys ...string) *redis.IntCmd
+	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
+	HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd
+	ZAdd(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd
+	ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd
+	ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	Close() error
+}
+
+// consumerMetrics and tokenMetrics are registered with Prometheus
+// once per process, as registering them again for another Server
+// would panic.
+var (
+	consumerMetricsOnce sync.Once
+	consumerMetrics     msgconsumer.Metrics
+	tokenMetricsOnce    sync.Once
+	tokenMetrics        token.Metrics
+)
+
+// Config configures a Server.
+type Config struct {
+	// Settings are keyed by the flags registered by RegisterFlags,
+	// e.g. "token.secret". They should be created with NewSettings
+	// so that unset keys take their default value.
+	Settings *viper.Viper
+	// Logger receives the logs of every service. Defaults to a
+	// no-op logger.
+	Logger log.Logger
+	// Hooks run custom logic during signup, login and token
+	// issuance. Defaults to auth.NopHooks. Hooks of a script set
+	// with hooks.script-path run after them.
+	Hooks auth.Hooks
+}
+
+// Server is an authenticator API along with the background services
+// it depends on.
+type Server struct {
+	logger   log.Logger
+	settings *viper.Viper
+	router   *mux.Router
+
+	httpServer      *http.Server
+	certManager     *autocert.Manager
+	redirectServer  *http.Server
+	internalServer  *http.Server
+	msgd            msgconsumer.Consumer
+	metadataSvc     auth.MetadataService
+	geoResolver     auth.GeoResolver
+	reputationSvc   auth.NetworkReputation
+	anomalySvc      auth.AnomalyDetector
+	loginDigestSvc  auth.LoginDigestService
+	reminderSvc     auth.EnrollmentReminderService
+	adminAPI        auth.AdminAPI
+	revocationCache *token.RevocationCache
+
+	// closers release connections in the reverse order they
+	// were opened.
+	closers []closer
+}
+
+// New connects to the databases configured in cfg and builds every
+// service of the API. Nothing is served until Run is called. The
+// Server must be closed to release its connections.
+func New(cfg Config) (_ *Server, err error) {
+	conf := cfg.Settings
+	if conf == nil {
+		conf = NewSettings()
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	eventHooks := cfg.Hooks
+	if eventHooks == nil {
+		eventHooks = auth.NopHooks{}
+	}
+	if path := conf.GetString("hooks.script-path"); path != "" {
+		var scriptHooks auth.Hooks
+		scriptHooks, err = hooks.NewScript(
+			hooks.WithLogger(logger),
+			hooks.WithScript(path),
+			hooks.WithTimeout(conf.GetDuration("hooks.script-timeout")),
+			hooks.WithFailOpen(conf.GetBool("hooks.script-fail-open")),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hooks script: %w", err)
+		}
+		eventHooks = hooks.Chain(eventHooks, scriptHooks)
+	}
+
+	srv := &Server{logger: logger, settings: conf}
+	defer func() {
+		if err != nil {
+			srv.Close()
+		}
+	}()
+
+	if err = contactchecker.SetDefaultRegion(conf.GetString("phone.default-region")); err != nil {
+		return nil, fmt.Errorf("invalid phone region: %w", err)
+	}
+	contactchecker.SetEmailAliases(conf.GetBool("email.match-aliases"))
+
+	brand := branding.Brand{
+		Name:         conf.GetString("branding.name"),
+		LogoURL:      conf.GetString("branding.logo-url"),
+		Color:        conf.GetString("branding.color"),
+		SupportEmail: conf.GetString("branding.support-email"),
+	}.WithDefaults()
+	if err = brand.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid branding: %w", err)
+	}
+
+	passwordCost := conf.GetInt("password.cost")
+	if passwordCost < bcrypt.MinCost || passwordCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("password cost must be between %v and %v", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	// The API cost defaults to the interactive cost.
+	apiPasswordCost := conf.GetInt("password.api-cost")
+	if apiPasswordCost == 0 {
+		apiPasswordCost = passwordCost
+	}
+	if apiPasswordCost < bcrypt.MinCost || apiPasswordCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("password API cost must be between %v and %v", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	if conf.GetDuration("token.leeway") < 0 {
+		return nil, fmt.Errorf("token leeway must not be negative")
+	}
+
+	if target := conf.GetDuration("password.target-duration"); target > 0 {
+		var d time.Duration
+		passwordCost, d = password.TuneCost(target, passwordCost)
+		logger.Log(
+			"message", "tuned password hashing cost",
+			"cost", passwordCost,
+			"duration", d,
+			"target", target,
+			"source", "server.New",
+		)
+	}
+
+	if target := conf.GetDuration("password.api-target-duration"); target > 0 {
+		var d time.Duration
+		apiPasswordCost, d = password.TuneCost(target, apiPasswordCost)
+		logger.Log(
+			"message", "tuned API password hashing cost",
+			"cost", apiPasswordCost,
+			"duration", d,
+			"target", target,
+			"source", "server.New",
+		)
+	}
+
+	passwordSvc := password.NewPassword(
+		password.WithCost(passwordCost),
+		password.WithAPICost(apiPasswordCost),
+		password.WithMinLength(conf.GetInt("password.min-length")),
+		password.WithMaxLength(conf.GetInt("password.max-length")),
+	)
+
+	var faults *faultinject.Injector
+	if conf.GetBool("faults.enabled") {
+		var options []faultinject.ConfigOption
+		for _, dependency := range []string{faultinject.Postgres, faultinject.Redis, faultinject.Providers} {
+			fault, err := faultinject.ParseFault(conf.GetString("faults." + dependency))
+			if err != nil {
+				return nil, fmt.Errorf("invalid fault %v: %w", dependency, err)
+			}
+			options = append(options, faultinject.WithFault(dependency, fault))
+		}
+		faults = faultinject.New(options...)
+		level.Warn(logger).Log(
+			"message", "fault injection is enabled, do not use in production",
+			"postgres", conf.GetString("faults.postgres"),
+			"redis", conf.GetString("faults.redis"),
+			"providers", conf.GetString("faults.providers"),
+			"source", "server.New",
+		)
+	}
+
+	clk := clock.WithOffset(clock.New(), conf.GetDuration("clock.offset"))
+	if offset := conf.GetDuration("clock.offset"); offset != 0 {
+		level.Warn(logger).Log(
+			"message", "clock offset is enabled, token and code expiry are shifted",
+			"offset", offset,
+			"source", "server.New",
+		)
+	}
+
+	var pgDB *sql.DB
+	{
+		pgDB, err = sql.Open("postgres", conf.GetString("pg.conn-string"))
+		if err != nil {
+			return nil, fmt.Errorf("postgres connection failed: %w", err)
+		}
+		srv.addCloser("postgres", pgDB.Close)
+		pgDB.SetMaxOpenConns(conf.GetInt("pg.max-open-conns"))
+		pgDB.SetMaxIdleConns(conf.GetInt("pg.max-idle-conns"))
+		pgDB.SetConnMaxLifetime(conf.GetDuration("pg.conn-max-lifetime"))
+		if err = pgDB.Ping(); err != nil {
+			return nil, fmt.Errorf("postgres did not respond: %w", err)
+		}
+	}
+
+	var replicaDB *sql.DB
+	if connString := conf.GetString("pg.replica-conn-string"); connString != "" {
+		replicaDB, err = sql.Open("postgres", connString)
+		if err != nil {
+			return nil, fmt.Errorf("postgres replica connection failed: %w", err)
+		}
+		srv.addCloser("postgres replica", replicaDB.Close)
+		replicaDB.SetMaxOpenConns(conf.GetInt("pg.max-open-conns"))
+		replicaDB.SetMaxIdleConns(conf.GetInt("pg.max-idle-conns"))
+		replicaDB.SetConnMaxLifetime(conf.GetDuration("pg.conn-max-lifetime"))
+		if err = replicaDB.Ping(); err != nil {
+			return nil, fmt.Errorf("postgres replica did not respond: %w", err)
+		}
+	}
+
+	var redisDB keyValueStore
+	var lmt httpapi.LimiterFactory
+	{
+		var addrs []string
+		if v := conf.GetString("redis.addrs"); v != "" {
+			addrs = strings.Split(v, ",")
+		}
+
+		var client redis.UniversalClient
+		switch mode := conf.GetString("redis.mode"); mode {
+		case "memory":
+			logger.Log(
+				"message", "using in-memory store, state will not be shared between instances",
+				"source", "server.New",
+			)
+			store := memstore.New()
+			redisDB = store
+			lmt = httpapi.NewMemoryRateLimiter(store)
+		case "cluster":
+			if len(addrs) == 0 {
+				return nil, fmt.Errorf("redis cluster requires addrs")
+			}
+			client = redis.NewClusterClient(&redis.ClusterOptions{
+				Addrs:    addrs,
+				Password: conf.GetString("redis.password"),
+			})
+		case "sentinel":
+			masterName := conf.GetString("redis.master-name")
+			if len(addrs) == 0 || masterName == "" {
+				return nil, fmt.Errorf("redis sentinel requires addrs and master-name")
+			}
+			client = redis.NewFailoverClient(&redis.FailoverOptions{
+				MasterName:    masterName,
+				SentinelAddrs: addrs,
+				Password:      conf.GetString("redis.password"),
+				DB:            conf.GetInt("redis.db"),
+			})
+		case "standalone", "":
+			redisConf, err := redis.ParseURL(conf.GetString("redis.conn-string"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid redis configuration: %w", err)
+			}
+			client = redis.NewClient(redisConf)
+		default:
+			return nil, fmt.Errorf("unsupported redis mode %v", mode)
+		}
+
+		if client != nil {
+			srv.addCloser("redis", client.Close)
+			if _, err = client.Ping(context.Background()).Result(); err != nil {
+				return nil, fmt.Errorf("redis connection failed: %w", err)
+			}
+
+			if faults != nil {
+				client.AddHook(faults.RedisHook())
+			}
+			redisDB = client
+			lmt = httpapi.NewRateLimiter(client, httpapi.LimiterConfig{
+				Shards: conf.GetInt("ratelimit.shards"),
+				Batch:  conf.GetInt("ratelimit.batch"),
+			})
+		}
+	}
+
+	messageRepo := msgrepo.NewService(
+		msgrepo.WithLogger(logger),
+		msgrepo.WithDB(redisDB),
+		msgrepo.WithDedupWindow(conf.GetDuration("messaging.dedup-window")),
+	)
+
+	pgOptions, err := EncryptionOptions(conf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption keys: %w", err)
+	}
+	repoMngr := postgres.NewClient(append(pgOptions,
+		postgres.WithLogger(logger),
+		postgres.WithPassword(passwordSvc),
+		postgres.WithDB(pgDB),
+		postgres.WithReplica(replicaDB),
+		postgres.WithQueryTimeout(conf.GetDuration("pg.query-timeout")),
+		postgres.WithSlowQueryThreshold(conf.GetDuration("pg.slow-query-threshold")),
+		postgres.WithFaults(faults),
+	)...)
+
+	otpSvc := otp.NewOTP(
+		otp.WithCodeLength(conf.GetInt("otp.code-length")),
+		otp.WithIssuer(orDefault(conf.GetString("otp.issuer"), brand.Name)),
+		otp.WithSecret(otp.Secret{
+			Key:     conf.GetString("otp.secret.key"),
+			Version: conf.GetInt("otp.secret.version"),
+		}),
+		otp.WithDB(redisDB),
+		otp.WithTimeout(conf.GetDuration("redis.op-timeout")),
+		otp.WithClock(clk),
+	)
+
+	var messagingSvc auth.MessagingService
+	{
+		senders, err := msgpublisher.ParseSenders(conf.GetString("messaging.senders"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid message senders: %w", err)
+		}
+
+		options := []msgpublisher.ConfigOption{
+			msgpublisher.WithLogger(logger),
+			msgpublisher.WithSenders(senders),
+			msgpublisher.WithAppName(orDefault(conf.GetString("messaging.app-name"), brand.Name)),
+			msgpublisher.WithBrand(brand),
+			msgpublisher.WithCodeExpiry(otp.CodeExpiry),
+		}
+
+		if path := conf.GetString("messaging.sms-templates-file"); path != "" {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open SMS templates file: %w", err)
+			}
+			templates, err := msgpublisher.ReadSMSTemplates(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read SMS templates file: %w", err)
+			}
+			options = append(options, msgpublisher.WithSMSTemplates(templates))
+		}
+
+		messagingSvc = msgpublisher.NewService(messageRepo, options...)
+	}
+
+	requiredConsent, err := consent.Parse(conf.GetString("consent.required-policies"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid required consent policies: %w", err)
+	}
+
+	fingerprintMode, err := fingerprint.ParseMode(conf.GetString("token.fingerprint-binding"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token fingerprint binding: %w", err)
+	}
+
+	claimsMode, err := token.ParseClaimsMode(conf.GetString("token.claims"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token claims mode: %w", err)
+	}
+
+	cookieSameSite, err := token.ParseSameSite(conf.GetString("api.cookie-same-site"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cookie SameSite attribute: %w", err)
+	}
+	isCookieSecure := conf.GetBool("api.cookie-secure") || conf.GetBool("api.cookie-host-only")
+	if cookieSameSite == http.SameSiteNoneMode && !isCookieSecure {
+		return nil, fmt.Errorf("SameSite=None cookies must be secure")
+	}
+
+	clientApps := clientapp.NewService(
+		clientapp.WithLogger(logger),
+		clientapp.WithRepoManager(repoMngr),
+		clientapp.WithRefreshInterval(conf.GetDuration("client.refresh-interval")),
+		clientapp.WithLogoutSecret(conf.GetString("client.logout-secret")),
+	)
+
+	tokenOptions := []token.ConfigOption{
+		token.WithLogger(logger),
+		token.WithDB(redisDB),
+		token.WithTokenExpiry(conf.GetDuration("token.expires-in")),
+		token.WithRefreshTokenExpiry(conf.GetDuration("token.refresh-expires-in")),
+		token.WithIssuer(conf.GetString("token.issuer")),
+		token.WithSecret(conf.GetString("token.secret")),
+		token.WithAllowedAudiences(strings.Split(conf.GetString("token.audiences"), ",")),
+		token.WithAllowedScopes(strings.Split(conf.GetString("token.scopes"), ",")),
+		token.WithOTP(otpSvc),
+		token.WithCodeReuseWindow(conf.GetDuration("messaging.dedup-window")),
+		token.WithCookieMaxAge(conf.GetInt("api.cookie-max-age")),
+		token.WithCookieDomain(conf.GetString("api.cookie-domain")),
+		token.WithCookiePath(conf.GetString("api.cookie-path")),
+		token.WithCookieSecure(conf.GetBool("api.cookie-secure")),
+		token.WithCookieSameSite(cookieSameSite),
+		token.WithHostOnlyCookies(conf.GetBool("api.cookie-host-only")),
+		token.WithCookieNames(
+			conf.GetString("api.cookie-client-id-name"),
+			conf.GetString("api.cookie-refresh-token-name"),
+		),
+		token.WithRepoManager(repoMngr),
+		token.WithRequiredConsent(requiredConsent),
+		token.WithRequiredEnrollment(conf.GetBool("login.require-tfa-enrollment")),
+		token.WithEnrollmentGracePeriod(conf.GetDuration("login.tfa-enrollment-grace-period")),
+		token.WithHooks(eventHooks),
+		token.WithFingerprintBinding(fingerprintMode),
+		token.WithIdleTimeout(conf.GetDuration("token.idle-timeout")),
+		token.WithLeeway(conf.GetDuration("token.leeway")),
+		token.WithMinTTL(conf.GetDuration("token.min-ttl")),
+		token.WithClaimsMode(claimsMode),
+		token.WithClock(clk),
+		token.WithUserQuota(token.Quota{
+			Creates:   conf.GetInt64("token.quota.user-creates"),
+			Refreshes: conf.GetInt64("token.quota.user-refreshes"),
+		}),
+		token.WithTenantQuota(token.Quota{
+			Creates:   conf.GetInt64("token.quota.tenant-creates"),
+			Refreshes: conf.GetInt64("token.quota.tenant-refreshes"),
+		}),
+		token.WithMetrics(tokenPrometheusMetrics()),
+	}
+
+	// The in-memory store is not shared between instances and has
+	// nothing to gain from a cache.
+	var revocationCache *token.RevocationCache
+	if size := conf.GetInt("token.revocation-cache-size"); size > 0 {
+		if client, ok := redisDB.(redis.UniversalClient); ok {
+			revocationCache = token.NewRevocationCache(
+				client, size, conf.GetDuration("token.revocation-cache-ttl"),
+			)
+			tokenOptions = append(tokenOptions, token.WithRevocationCache(revocationCache))
+		}
+	}
+
+	tokenSvc := token.NewService(tokenOptions...)
+
+	actionTokenSvc := actiontoken.NewService(
+		actiontoken.WithLogger(logger),
+		actiontoken.WithDB(redisDB),
+		actiontoken.WithTokenExpiry(conf.GetDuration("action-token.expires-in")),
+		actiontoken.WithPurposeExpiry(auth.PurposeAcceptInvite, conf.GetDuration("org.invite-expires-in")),
+		actiontoken.WithPurposeExpiry(auth.PurposeApproveLogin, conf.GetDuration("login.approval-expires-in")),
+		actiontoken.WithPurposeExpiry(auth.PurposeResetPassword, conf.GetDuration("login.password-reset-expires-in")),
+		actiontoken.WithPurposeExpiry(
+			auth.PurposeCancelRecovery,
+			conf.GetDuration("recovery.delay")+conf.GetDuration("recovery.window"),
+		),
+		actiontoken.WithPurposeExpiry(
+			auth.PurposeCancelChange,
+			conf.GetDuration("contact.change-delay")+conf.GetDuration("contact.change-window"),
+		),
+		actiontoken.WithIssuer(conf.GetString("token.issuer")),
+		actiontoken.WithSecret(conf.GetString("token.secret")),
+	)
+
+	disabledFeatures, err := featureflag.ParseList(conf.GetString("features.disabled"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid disabled features: %w", err)
+	}
+
+	featureOptions := []featureflag.ConfigOption{
+		featureflag.WithLogger(logger),
+		featureflag.WithDB(redisDB),
+		featureflag.WithDisabled(disabledFeatures...),
+		featureflag.WithCacheTTL(conf.GetDuration("features.cache-ttl")),
+	}
+	if conf.GetBool("maintenance.enabled") {
+		featureOptions = append(featureOptions, featureflag.WithEnabled(auth.FeatureMaintenance))
+	}
+	featureSvc := featureflag.NewService(featureOptions...)
+
+	var metadataSvc auth.MetadataService
+	{
+		options := []fidomds.ConfigOption{
+			fidomds.WithLogger(logger),
+			fidomds.WithInterval(conf.GetDuration("mds.refresh-interval")),
+		}
+
+		if url := conf.GetString("mds.url"); url != "" {
+			f, err := os.Open(conf.GetString("mds.root-cert"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to open metadata root certificates: %w", err)
+			}
+			roots, err := fidomds.ReadRoots(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("invalid metadata root certificates: %w", err)
+			}
+			options = append(options, fidomds.WithURL(url), fidomds.WithRoots(roots))
+		}
+
+		metadataSvc = fidomds.NewService(options...)
+	}
+
+	geoResolver, err := geo.NewResolver(
+		geo.WithLogger(logger),
+		geo.WithCityDB(conf.GetString("geo.city-database")),
+		geo.WithASNDB(conf.GetString("geo.asn-database")),
+		geo.WithInterval(conf.GetDuration("geo.reload-interval")),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load geo databases: %w", err)
+	}
+
+	sourceResolver := anomaly.ASNSource(geoResolver, anomaly.PrefixSource(
+		conf.GetInt("anomaly.ipv4-prefix"),
+		conf.GetInt("anomaly.ipv6-prefix"),
+	))
+
+	loginPolicy, err := loginapi.ParsePolicy(conf.GetString("login.tfa-policy"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid login 2FA policy: %w", err)
+	}
+
+	relyingParties, err := webauthn.ParseRelyingParties(conf.GetString("webauthn.relying-parties"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn relying parties: %w", err)
+	}
+
+	webauthnSvc, err := webauthn.NewService(
+		webauthn.WithDB(redisDB),
+		webauthn.WithTimeout(conf.GetDuration("redis.op-timeout")),
+		webauthn.WithDisplayName(conf.GetString("webauthn.display-name")),
+		webauthn.WithDomain(conf.GetString("webauthn.domain")),
+		webauthn.WithRequestOrigin(conf.GetString("webauthn.request-origin")),
+		webauthn.WithRelyingParties(relyingParties),
+		webauthn.WithRepoManager(repoMngr),
+		webauthn.WithMaxDevices(conf.GetInt("webauthn.max-devices")),
+		webauthn.WithSessionTTL(conf.GetDuration("webauthn.session-ttl")),
+		webauthn.WithChallengeTimeout(conf.GetDuration("webauthn.challenge-timeout")),
+		webauthn.WithUserVerification(conf.GetString("webauthn.user-verification")),
+		webauthn.WithMetadata(metadataSvc),
+		webauthn.WithAppID(conf.GetString("webauthn.u2f-app-id")),
+		webauthn.WithBlockCompromised(conf.GetBool("webauthn.block-compromised")),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build webauthn service: %w", err)
+	}
+
+	var attestationSvc auth.AttestationService
+	{
+		options := []attestation.ConfigOption{
+			attestation.WithLogger(logger),
+			attestation.WithRequired(conf.GetBool("attestation.required")),
+			attestation.WithDB(redisDB),
+			attestation.WithChallengeTTL(conf.GetDuration("attestation.challenge-ttl")),
+		}
+
+		if pkg := conf.GetString("attestation.android.package-name"); pkg != "" {
+			key, err := ioutil.ReadFile(conf.GetString("attestation.android.credentials-file"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Play Integrity credentials: %w", err)
+			}
+			tokenSource, err := attestation.NewServiceAccountTokenSource(key, nil)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Play Integrity credentials: %w", err)
+			}
+			options = append(options, attestation.WithVerifier(
+				attestation.PlatformAndroid,
+				attestation.NewPlayIntegrityVerifier(pkg, tokenSource, nil),
+			))
+		}
+
+		if appID := conf.GetString("attestation.ios.app-id"); appID != "" {
+			options = append(options, attestation.WithVerifier(
+				attestation.PlatformIOS,
+				attestation.NewAppAttestVerifier(appID, conf.GetBool("attestation.ios.allow-development"), redisDB),
+			))
+		}
+
+		attestationSvc = attestation.NewService(options...)
+	}
+
+	reputationSvc := reputation.NewService(
+		reputation.WithLogger(logger),
+		reputation.WithList(auth.NetworkTor, conf.GetString("reputation.tor-list-url")),
+		reputation.WithList(auth.NetworkVPN, conf.GetString("reputation.vpn-list-url")),
+		reputation.WithList(auth.NetworkProxy, conf.GetString("reputation.proxy-list-url")),
+		reputation.WithInterval(conf.GetDuration("reputation.refresh-interval")),
+		reputation.WithAPI(conf.GetString("reputation.api-url"), conf.GetString("reputation.api-key")),
+		reputation.WithCacheTTL(conf.GetDuration("reputation.cache-ttl")),
+	)
+
+	networkPolicy := anomaly.NetworkPolicy{}
+	for class, key := range map[auth.NetworkClass]string{
+		auth.NetworkTor:   "reputation.tor-action",
+		auth.NetworkVPN:   "reputation.vpn-action",
+		auth.NetworkProxy: "reputation.proxy-action",
+	} {
+		action, err := anomaly.ParseNetworkAction(conf.GetString(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		networkPolicy[class] = action
+	}
+
+	var anomalySvc auth.AnomalyDetector
+	{
+		options := []anomaly.ConfigOption{
+			anomaly.WithLogger(logger),
+			anomaly.WithDB(redisDB),
+			anomaly.WithFeatureFlags(featureSvc),
+			anomaly.WithSourceResolver(sourceResolver),
+			anomaly.WithWindow(
+				conf.GetDuration("anomaly.window"),
+				conf.GetDuration("anomaly.interval"),
+			),
+			anomaly.WithThresholds(
+				conf.GetInt64("anomaly.min-failures"),
+				conf.GetInt64("anomaly.min-accounts"),
+			),
+			anomaly.WithFlagDuration(conf.GetDuration("anomaly.flag-duration")),
+			anomaly.WithFlaggedRateLimit(conf.GetInt64("anomaly.flagged-rate-limit")),
+			anomaly.WithReputation(reputationSvc, networkPolicy),
+		}
+
+		if url := conf.GetString("anomaly.alert-webhook-url"); url != "" {
+			options = append(options, anomaly.WithAlerter(anomaly.NewWebhookAlerter(url, nil)))
+		}
+
+		if url := conf.GetString("anomaly.captcha.verify-url"); url != "" {
+			options = append(options, anomaly.WithCaptcha(anomaly.NewSiteVerifyCaptcha(
+				url, conf.GetString("anomaly.captcha.secret"), nil,
+			)))
+		}
+
+		anomalySvc = anomaly.NewService(options...)
+	}
+
+	var signupAbuseSvc auth.SignupAbuseDetector
+	{
+		allowlist, err := signupabuse.ParseAllowlist(
+			conf.GetString("signup-abuse.allowlist.networks"),
+			conf.GetString("signup-abuse.allowlist.domains"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signup abuse allowlist: %w", err)
+		}
+
+		options := []signupabuse.ConfigOption{
+			signupabuse.WithLogger(logger),
+			signupabuse.WithAllowlist(allowlist),
+			signupabuse.WithSourceResolver(sourceResolver),
+			signupabuse.WithWindow(conf.GetDuration("signup-abuse.window")),
+			signupabuse.WithLimits(signupabuse.Limits{
+				Source:      conf.GetInt64("signup-abuse.source-limit"),
+				Fingerprint: conf.GetInt64("signup-abuse.fingerprint-limit"),
+				Domain:      conf.GetInt64("signup-abuse.domain-limit"),
+			}),
+		}
+
+		if conf.GetBool("signup-abuse.enabled") {
+			options = append(options, signupabuse.WithDB(redisDB))
+		}
+
+		if path := conf.GetString("signup-abuse.disposable-domains-file"); path != "" {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open disposable domains file: %w", err)
+			}
+			domains, err := signupabuse.ReadDomains(f)
+			f.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read disposable domains file: %w", err)
+			}
+			options = append(options, signupabuse.WithDisposableDomains(domains))
+		}
+
+		if url := conf.GetString("anomaly.captcha.verify-url"); url != "" {
+			options = append(options, signupabuse.WithCaptcha(anomaly.NewSiteVerifyCaptcha(
+				url, conf.GetString("anomaly.captcha.secret"), nil,
+			)))
+		}
+
+		signupAbuseSvc = signupabuse.NewService(options...)
+	}
+
+	var canarySvc auth.CanaryService
+	{
+		options := []canary.ConfigOption{
+			canary.WithLogger(logger),
+			canary.WithRepoManager(repoMngr),
+		}
+
+		if url := conf.GetString("canary.alert-webhook-url"); url != "" {
+			options = append(options, canary.WithWebhook(url, nil))
+		}
+
+		if recipients := conf.GetString("canary.alert-recipients"); recipients != "" {
+			options = append(options, canary.WithMessaging(messagingSvc, strings.Split(recipients, ",")))
+		}
+
+		canarySvc = canary.NewService(options...)
+	}
+
+	var externalUsers auth.ExternalUserProvider
+	if connString := conf.GetString("external-users.conn-string"); connString != "" {
+		externalDB, err := sql.Open("postgres", connString)
+		if err != nil {
+			return nil, fmt.Errorf("external user database connection failed: %w", err)
+		}
+		srv.addCloser("external user database", externalDB.Close)
+		if err = externalDB.Ping(); err != nil {
+			return nil, fmt.Errorf("external user database did not respond: %w", err)
+		}
+
+		externalUsers, err = externaluser.NewService(
+			externaluser.WithLogger(logger),
+			externaluser.WithDB(externalDB),
+			externaluser.WithSchema(externaluser.Schema{
+				Table:          conf.GetString("external-users.table"),
+				IDColumn:       conf.GetString("external-users.id-column"),
+				EmailColumn:    conf.GetString("external-users.email-column"),
+				PhoneColumn:    conf.GetString("external-users.phone-column"),
+				PasswordColumn: conf.GetString("external-users.password-column"),
+			}),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("invalid external user configuration: %w", err)
+		}
+	}
+
+	// Login approval event streams are closed before the API
+	// server's write timeout.
+	approvalStreamDuration := time.Minute
+	if writeTimeout := conf.GetDuration("api.write-timeout"); writeTimeout > 0 {
+		approvalStreamDuration = writeTimeout * 4 / 5
+	}
+
+	loginAPI := loginapi.NewService(
+		loginapi.WithLogger(logger),
+		loginapi.WithTokenService(tokenSvc),
+		loginapi.WithRepoManager(repoMngr),
+		loginapi.WithWebAuthn(webauthnSvc),
+		loginapi.WithOTP(otpSvc),
+		loginapi.WithMessaging(messagingSvc),
+		loginapi.WithPassword(passwordSvc),
+		loginapi.WithAttestation(attestationSvc),
+		loginapi.WithAnomalyDetector(anomalySvc),
+		loginapi.WithCaptchaSiteKey(conf.GetString("anomaly.captcha.site-key")),
+		loginapi.WithCanary(canarySvc),
+		loginapi.WithExternalUsers(externalUsers),
+		loginapi.WithDB(redisDB),
+		loginapi.WithActionTokens(actionTokenSvc),
+		loginapi.WithApprovalURL(conf.GetString("login.approval-url")),
+		loginapi.WithApprovalStream(time.Second, approvalStreamDuration),
+		loginapi.WithPolicy(loginPolicy),
+		loginapi.WithLockout(
+			conf.GetInt64("login.lockout.max-failures"),
+			conf.GetDuration("login.lockout.window"),
+			conf.GetDuration("login.lockout.duration"),
+		),
+		loginapi.WithHooks(eventHooks),
+	)
+
+	recoveryAPI := recoveryapi.NewService(
+		recoveryapi.WithLogger(logger),
+		recoveryapi.WithTokenService(tokenSvc),
+		recoveryapi.WithRepoManager(repoMngr),
+		recoveryapi.WithWebAuthn(webauthnSvc),
+		recoveryapi.WithMessaging(messagingSvc),
+		recoveryapi.WithActionTokens(actionTokenSvc),
+		recoveryapi.WithPassword(passwordSvc),
+		recoveryapi.WithOTP(otpSvc),
+		recoveryapi.WithDB(redisDB),
+		recoveryapi.WithCancelURL(conf.GetString("recovery.cancel-url")),
+		recoveryapi.WithContactVerifyURL(conf.GetString("recovery.contact-verify-url")),
+		recoveryapi.WithDelay(conf.GetDuration("recovery.delay"), conf.GetDuration("recovery.window")),
+		recoveryapi.WithMaxTrustedContacts(conf.GetInt("recovery.max-trusted-contacts")),
+	)
+
+	signupAPI := signupapi.NewService(
+		signupapi.WithLogger(logger),
+		signupapi.WithTokenService(tokenSvc),
+		signupapi.WithRepoManager(repoMngr),
+		signupapi.WithMessaging(messagingSvc),
+		signupapi.WithOTP(otpSvc),
+		signupapi.WithAttestation(attestationSvc),
+		signupapi.WithFeatureFlags(featureSvc),
+		signupapi.WithAbuseDetector(signupAbuseSvc),
+		signupapi.WithCaptchaSiteKey(conf.GetString("anomaly.captcha.site-key")),
+		signupapi.WithDB(redisDB),
+		signupapi.WithHooks(eventHooks),
+		signupapi.WithResendThrottle(
+			conf.GetDuration("signup.resend-cooldown"),
+			conf.GetInt64("signup.resend-limit"),
+			conf.GetDuration("signup.resend-window"),
+		),
+		signupapi.WithPolicy(&signuppolicy.Policy{
+			RequireEmail:       conf.GetBool("signup.require-email"),
+			RequirePhone:       conf.GetBool("signup.require-phone"),
+			RequirePassword:    conf.GetBool("signup.require-password"),
+			DeniedRegions:      strings.Split(conf.GetString("signup.denied-regions"), ","),
+			RegionHeader:       conf.GetString("signup.region-header"),
+			MinimumAge:         conf.GetInt("signup.minimum-age"),
+			RejectMixedScripts: conf.GetBool("signup.reject-mixed-scripts"),
+		}),
+	)
+
+	securityChangeSvc := securitychange.NewService(
+		securitychange.WithLogger(logger),
+		securitychange.WithMessaging(messagingSvc),
+		securitychange.WithActionTokens(actionTokenSvc),
+		securitychange.WithDB(redisDB),
+		securitychange.WithCancelURL(conf.GetString("contact.cancel-url")),
+		securitychange.WithChangeDelay(conf.GetDuration("contact.change-delay"), conf.GetDuration("contact.change-window")),
+	)
+
+	deviceAPI := deviceapi.NewService(
+		deviceapi.WithLogger(logger),
+		deviceapi.WithWebAuthn(webauthnSvc),
+		deviceapi.WithRepoManager(repoMngr),
+		deviceapi.WithTokenService(tokenSvc),
+		deviceapi.WithSecurityChanges(securityChangeSvc),
+	)
+
+	contactAPI := contactapi.NewService(
+		contactapi.WithLogger(logger),
+		contactapi.WithOTP(otpSvc),
+		contactapi.WithRepoManager(repoMngr),
+		contactapi.WithMessaging(messagingSvc),
+		contactapi.WithTokenService(tokenSvc),
+		contactapi.WithSecurityChanges(securityChangeSvc),
+	)
+
+	totpAPI := totpapi.NewService(
+		totpapi.WithLogger(logger),
+		totpapi.WithOTP(otpSvc),
+		totpapi.WithRepoManager(repoMngr),
+		totpapi.WithTokenService(tokenSvc),
+		totpapi.WithSecurityChanges(securityChangeSvc),
+	)
+
+	tokenAPI := tokenapi.NewService(
+		tokenapi.WithLogger(logger),
+		tokenapi.WithTokenService(tokenSvc),
+		tokenapi.WithRepoManager(repoMngr),
+		tokenapi.WithClientApplications(clientApps),
+	)
+
+	loginDigestAPI := logindigestapi.NewService(
+		logindigestapi.WithLogger(logger),
+		logindigestapi.WithRepoManager(repoMngr),
+		logindigestapi.WithFeatureFlags(featureSvc),
+	)
+
+	loginDigestSvc := logindigest.NewService(
+		logindigest.WithLogger(logger),
+		logindigest.WithRepoManager(repoMngr),
+		logindigest.WithMessaging(messagingSvc),
+		logindigest.WithSchedule(
+			conf.GetDuration("login-digest.period"),
+			conf.GetDuration("login-digest.interval"),
+		),
+		logindigest.WithBatchSize(conf.GetInt("login-digest.batch-size")),
+		logindigest.WithFeatureFlags(featureSvc),
+	)
+
+	reminderSvc := enrollmentreminder.NewService(
+		enrollmentreminder.WithLogger(logger),
+		enrollmentreminder.WithRepoManager(repoMngr),
+		enrollmentreminder.WithMessaging(messagingSvc),
+		enrollmentreminder.WithSchedule(
+			conf.GetDuration("login.tfa-enrollment-reminder-period"),
+			conf.GetDuration("login.tfa-enrollment-reminder-interval"),
+		),
+	)
+
+	profileAPI := profileapi.NewService(
+		profileapi.WithLogger(logger),
+		profileapi.WithRepoManager(repoMngr),
+	)
+
+	securityAPI := securityapi.NewService(
+		securityapi.WithLogger(logger),
+		securityapi.WithRepoManager(repoMngr),
+	)
+
+	attestationAPI := attestationapi.NewService(
+		attestationapi.WithLogger(logger),
+		attestationapi.WithAttestation(attestationSvc),
+	)
+
+	consentAPI := consentapi.NewService(
+		consentapi.WithLogger(logger),
+		consentapi.WithRepoManager(repoMngr),
+		consentapi.WithTokenService(tokenSvc),
+		consentapi.WithPolicies(requiredConsent),
+	)
+
+	orgAPI := orgapi.NewService(
+		orgapi.WithLogger(logger),
+		orgapi.WithRepoManager(repoMngr),
+		orgapi.WithMessaging(messagingSvc),
+		orgapi.WithActionTokens(actionTokenSvc),
+		orgapi.WithInviteExpiry(conf.GetDuration("org.invite-expires-in")),
+		orgapi.WithFeatureFlags(featureSvc),
+	)
+
+	deliveryStatsSvc := deliverystats.NewService(
+		deliverystats.WithDB(redisDB),
+		deliverystats.WithRetention(conf.GetInt("msgconsumer.stats-retention")),
+		deliverystats.WithClock(clk),
+	)
+
+	adminAPI := adminapi.NewService(
+		adminapi.WithLogger(logger),
+		adminapi.WithRepoManager(repoMngr),
+		adminapi.WithFeatureFlags(featureSvc),
+		adminapi.WithTokenService(tokenSvc),
+		adminapi.WithWebAuthn(webauthnSvc),
+		adminapi.WithSignupAbuseDetector(signupAbuseSvc),
+		adminapi.WithDeliveryStats(deliveryStatsSvc),
+		adminapi.WithDB(redisDB),
+		adminapi.WithPasswordReset(conf.GetString("login.password-reset-url"), actionTokenSvc, messagingSvc),
+	)
+
+	deliveryOptions := []deliveryapi.ConfigOption{
+		deliveryapi.WithLogger(logger),
+		deliveryapi.WithRepoManager(repoMngr),
+		deliveryapi.WithTwilio(
+			conf.GetString("twilio.token"),
+			conf.GetString("twilio.status-callback-url"),
+		),
+	}
+	if key := conf.GetString("sendgrid.webhook-public-key"); key != "" {
+		sendGridKey, err := deliveryapi.ParseSendGridKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sendgrid webhook key: %w", err)
+		}
+		deliveryOptions = append(deliveryOptions, deliveryapi.WithSendGrid(sendGridKey))
+	}
+	deliveryAPI := deliveryapi.NewService(deliveryOptions...)
+
+	ipResolver, err := httpapi.NewIPResolver(
+		strings.Split(conf.GetString("api.trusted-proxies"), ","),
+		conf.GetInt("api.trusted-proxy-hops"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy configuration: %w", err)
+	}
+
+	ipFilter, err := httpapi.NewIPFilter(
+		strings.Split(conf.GetString("api.ip-allowlist"), ","),
+		strings.Split(conf.GetString("api.ip-denylist"), ","),
+		ipResolver,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP filter configuration: %w", err)
+	}
+
+	adminIPFilter, err := httpapi.NewIPFilter(
+		strings.Split(conf.GetString("admin.ip-allowlist"), ","),
+		strings.Split(conf.GetString("admin.ip-denylist"), ","),
+		ipResolver,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin IP filter configuration: %w", err)
+	}
+
+	maintenance := httpapi.MaintenanceMiddleware(
+		featureSvc,
+		conf.GetDuration("maintenance.retry-after"),
+		"/api/v1/admin/",
+	)
+
+	// Only requests creating users or sending codes are replayed. Their
+	// responses carry pre-authorized tokens, while responses carrying
+	// authorized and refresh tokens are never stored.
+	idempotency := httpapi.IdempotencyMiddleware(
+		redisDB,
+		conf.GetDuration("idempotency.ttl"),
+		"/api/v1/signup",
+		"/api/v1/signup/resend",
+		"/api/v1/login",
+		"/api/v1/contact/check-address",
+		"/api/v1/contact/send",
+	)
+
+	bodyLimit := httpapi.BodyLimitMiddleware(httpapi.BodyLimits{
+		MaxBytes:              conf.GetInt64("api.max-body-bytes"),
+		MaxDepth:              conf.GetInt("api.max-json-depth"),
+		DisallowUnknownFields: conf.GetBool("api.strict-json"),
+	})
+
+	corsRules, err := httpapi.ParseCORSRules(conf.GetString("api.cors-rules"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CORS rules: %w", err)
+	}
+	cors := httpapi.CORSMiddleware(
+		clientApps,
+		strings.Split(conf.GetString("api.allowed-origins"), ","),
+		corsRules...,
+	)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/healthcheck", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	registrar, err := httpapi.NewRegistrar(
+		router,
+		conf.GetString("api.base-path"),
+		strings.Split(conf.GetString("api.disabled-modules"), ","),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API base path: %w", err)
+	}
+
+	registrar.Register("login", func(router *mux.Router) {
+		loginapi.SetupHTTPHandler(loginAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("recovery", func(router *mux.Router) {
+		recoveryapi.SetupHTTPHandler(recoveryAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("signup", func(router *mux.Router) {
+		signupapi.SetupHTTPHandler(signupAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("device", func(router *mux.Router) {
+		deviceapi.SetupHTTPHandler(deviceAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("contact", func(router *mux.Router) {
+		contactapi.SetupHTTPHandler(contactAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("totp", func(router *mux.Router) {
+		totpapi.SetupHTTPHandler(totpAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("token", func(router *mux.Router) {
+		tokenapi.SetupHTTPHandler(tokenAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("login-digest", func(router *mux.Router) {
+		logindigestapi.SetupHTTPHandler(loginDigestAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("org", func(router *mux.Router) {
+		orgapi.SetupHTTPHandler(orgAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("consent", func(router *mux.Router) {
+		consentapi.SetupHTTPHandler(consentAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("profile", func(router *mux.Router) {
+		profileapi.SetupHTTPHandler(profileAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("security", func(router *mux.Router) {
+		securityapi.SetupHTTPHandler(securityAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("delivery", func(router *mux.Router) {
+		deliveryapi.SetupHTTPHandler(deliveryAPI, router, logger, lmt)
+	})
+	registrar.Register("attestation", func(router *mux.Router) {
+		attestationapi.SetupHTTPHandler(attestationAPI, router, tokenSvc, logger, lmt)
+	})
+	registrar.Register("admin", func(router *mux.Router) {
+		if apiKey := conf.GetString("admin.api-key"); apiKey != "" {
+			adminapi.SetupHTTPHandler(adminAPI, router, apiKey, adminIPFilter, logger, lmt)
+		}
+	})
+	if err = registrar.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid disabled modules: %w", err)
+	}
+
+	if conf.GetBool("links.enabled") {
+		options := []linkpages.ConfigOption{
+			linkpages.WithLogger(logger),
+			linkpages.WithRateLimiter(lmt),
+			linkpages.WithBrand(brand),
+			linkpages.WithTemplateFile(conf.GetString("links.template-file")),
+			linkpages.WithRedirects(
+				conf.GetString("links.success-redirect-url"),
+				conf.GetString("links.failure-redirect-url"),
+			),
+		}
+		// Actions of disabled APIs are not served either.
+		if registrar.Enabled("login") {
+			options = append(options, linkpages.WithAction(linkpages.ApproveLogin(loginAPI.Approve)))
+		}
+		if registrar.Enabled("recovery") {
+			options = append(options, linkpages.WithAction(linkpages.CancelRecovery(recoveryAPI.Cancel)))
+			options = append(options, linkpages.WithAction(linkpages.VerifyTrustedContact(recoveryAPI.VerifyTrustedContact)))
+		}
+		if registrar.Enabled("contact") {
+			options = append(options, linkpages.WithAction(linkpages.CancelChange(contactAPI.CancelChange)))
+		}
+
+		links, err := linkpages.NewHandler(options...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid landing page configuration: %w", err)
+		}
+		router.PathPrefix(linkpages.Path + "/").Handler(links)
+	}
+
+	if conf.GetBool("ui.enabled") {
+		ui, err := webui.Handler(registrar.BasePath(), brand)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build web UI: %w", err)
+		}
+		router.PathPrefix(webui.Path).Handler(ui)
+	}
+
+	httpServer := &http.Server{
+		Addr: conf.GetString("api.http-addr"),
+		Handler: registrar.Middleware(cors(httpapi.ClientIPMiddleware(ipResolver)(httpapi.GeoMiddleware(geoResolver)(ipFilter.Handler(
+			httpapi.ClientApplicationMiddleware(clientApps)(httpapi.FingerprintMiddleware(httpapi.OriginMiddleware(httpapi.LocaleMiddleware(
+				maintenance(bodyLimit(idempotency(router))),
+			)))),
+		))))),
+	}
+
+	tlsMinVersion, err := httpapi.ParseTLSVersion(conf.GetString("api.tls.min-version"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+
+	var certManager *autocert.Manager
+	var redirectServer *http.Server
+	{
+		certFile := conf.GetString("api.tls.cert-file")
+		keyFile := conf.GetString("api.tls.key-file")
+		autocertDomains := conf.GetString("api.tls.autocert-domains")
+
+		if autocertDomains != "" {
+			certManager = &autocert.Manager{
+				Prompt:     autocert.AcceptTOS,
+				HostPolicy: autocert.HostWhitelist(strings.Split(autocertDomains, ",")...),
+				Cache:      autocert.DirCache(conf.GetString("api.tls.autocert-cache-dir")),
+				Email:      conf.GetString("api.tls.autocert-email"),
+			}
+			httpServer.TLSConfig = certManager.TLSConfig()
+			httpServer.TLSConfig.MinVersion = tlsMinVersion
+		} else if certFile != "" || keyFile != "" {
+			if certFile == "" || keyFile == "" {
+				return nil, fmt.Errorf("TLS requires both a certificate and key file")
+			}
+			httpServer.TLSConfig = &tls.Config{MinVersion: tlsMinVersion}
+		}
+
+		redirectAddr := conf.GetString("api.tls.redirect-addr")
+		if redirectAddr != "" && httpServer.TLSConfig != nil {
+			// Non TCP addresses (e.g. Unix sockets) have no port and
+			// redirect to the default HTTPS port.
+			_, httpsPort, _ := net.SplitHostPort(httpServer.Addr)
+
+			redirectHandler := httpapi.HTTPSRedirectHandler(httpsPort)
+			if certManager != nil {
+				// ACME HTTP-01 challenges are served over plain HTTP.
+				redirectHandler = certManager.HTTPHandler(redirectHandler)
+			}
+
+			redirectServer = &http.Server{
+				Addr:         redirectAddr,
+				Handler:      redirectHandler,
+				ReadTimeout:  5 * time.Second,
+				WriteTimeout: 10 * time.Second,
+				IdleTimeout:  30 * time.Second,
+			}
+		}
+	}
+
+	err = httpapi.ConfigureServer(httpServer, httpapi.ServerConfig{
+		ReadTimeout:          conf.GetDuration("api.read-timeout"),
+		ReadHeaderTimeout:    conf.GetDuration("api.read-header-timeout"),
+		WriteTimeout:         conf.GetDuration("api.write-timeout"),
+		IdleTimeout:          conf.GetDuration("api.idle-timeout"),
+		MaxHeaderBytes:       conf.GetInt("api.max-header-bytes"),
+		HTTP2:                conf.GetBool("api.http2"),
+		H2C:                  conf.GetBool("api.h2c"),
+		MaxConcurrentStreams: uint32(conf.GetInt("api.http2-max-concurrent-streams")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid server configuration: %w", err)
+	}
+
+	providerClient, err := httpapi.NewClient(httpapi.ClientConfig{
+		Proxy:        conf.GetString("providers.proxy"),
+		Timeout:      conf.GetDuration("providers.timeout"),
+		MaxRetries:   conf.GetInt("providers.max-retries"),
+		RetryWait:    conf.GetDuration("providers.retry-wait"),
+		MaxRetryWait: conf.GetDuration("providers.max-retry-wait"),
+		Faults:       faults,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid provider HTTP client configuration: %w", err)
+	}
+
+	smsProvider := "twilio"
+	var smsLib auth.SMSer = twilio.NewClient(
+		twilio.WithDefaults(
+			conf.GetString("twilio.account-sid"),
+			conf.GetString("twilio.token"),
+			conf.GetString("twilio.sms-sender"),
+		),
+		twilio.WithStatusCallback(conf.GetString("twilio.status-callback-url")),
+		twilio.WithSenderID(
+			conf.GetString("twilio.sender-id"),
+			strings.Split(conf.GetString("twilio.numeric-sender-regions"), ","),
+		),
+		twilio.WithHTTPClient(providerClient),
+	)
+	if gateway := conf.GetString("signal.gateway-url"); gateway != "" {
+		options := []signalcli.ConfigOption{
+			signalcli.WithLogger(logger),
+			signalcli.WithHealthInterval(conf.GetDuration("signal.health-interval")),
+			signalcli.WithHTTPClient(providerClient),
+		}
+		if conf.GetBool("signal.fallback-to-sms") {
+			options = append(options, signalcli.WithFallback(smsLib))
+		}
+		smsLib = signalcli.NewClient(gateway, conf.GetString("signal.number"), options...)
+		smsProvider = "signal"
+	}
+
+	sendGrid := sendgrid.NewClient(
+		conf.GetString("sendgrid.api-key"),
+		conf.GetString("sendgrid.from-addr"),
+		conf.GetString("sendgrid.from-name"),
+		sendgrid.WithHTTPClient(providerClient),
+	)
+	var stdMailer auth.Emailer
+	{
+		tlsMode, err := mail.ParseTLSMode(conf.GetString("mail.tls"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid mail TLS mode: %w", err)
+		}
+
+		options := []mail.ConfigOption{
+			mail.WithDefaults(
+				conf.GetString("mail.server-addr"),
+				conf.GetString("mail.from-addr"),
+				smtp.PlainAuth(
+					"",
+					conf.GetString("mail.auth.username"),
+					conf.GetString("mail.auth.password"),
+					conf.GetString("mail.auth.hostname"),
+				),
+			),
+			mail.WithTLS(tlsMode, nil),
+			mail.WithTimeout(conf.GetDuration("mail.timeout")),
+			mail.WithMaxIdleConns(conf.GetInt("mail.max-idle-conns")),
+		}
+
+		if domain := conf.GetString("mail.dkim.domain"); domain != "" {
+			b, err := ioutil.ReadFile(conf.GetString("mail.dkim.private-key-file"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read DKIM private key: %w", err)
+			}
+			key, err := mail.ParseDKIMKey(b)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DKIM private key: %w", err)
+			}
+			options = append(options, mail.WithDKIM(domain, conf.GetString("mail.dkim.selector"), key))
+		}
+
+		stdMailer = faults.Emailer(faultinject.Providers, mail.NewService(options...))
+	}
+
+	var emailLib auth.Emailer
+	emailProvider := conf.GetString("maillib")
+	if emailProvider == "sendgrid" {
+		emailLib = sendGrid
+	} else {
+		emailLib = stdMailer
+		emailProvider = "smtp"
+	}
+
+	consumerOptions := []msgconsumer.ConfigOption{
+		msgconsumer.WithWorkers(auth.PriorityHigh, conf.GetInt("msgconsumer.high-priority-workers")),
+		msgconsumer.WithWorkers(auth.PriorityNormal, conf.GetInt("msgconsumer.workers")),
+		msgconsumer.WithWorkers(auth.PriorityLow, conf.GetInt("msgconsumer.low-priority-workers")),
+		msgconsumer.WithQueueSize(conf.GetInt("msgconsumer.queue-size")),
+		msgconsumer.WithDrainTimeout(conf.GetDuration("msgconsumer.drain-timeout")),
+		msgconsumer.WithLogger(logger),
+		msgconsumer.WithDeliveryStats(deliveryStatsSvc),
+		msgconsumer.WithDeliveryRepository(repoMngr.MessageDelivery()),
+		msgconsumer.WithClock(clk),
+		msgconsumer.WithMetrics(prometheusMetrics()),
+		msgconsumer.WithProvider(auth.Phone, smsProvider),
+		msgconsumer.WithProvider(auth.Email, emailProvider),
+	}
+	if homeserver := conf.GetString("matrix.homeserver-url"); homeserver != "" {
+		consumerOptions = append(consumerOptions, msgconsumer.WithMatrix(
+			matrix.NewClient(
+				homeserver,
+				conf.GetString("matrix.access-token"),
+				matrix.WithHTTPClient(providerClient),
+			),
+		))
+	}
+
+	msgd := msgconsumer.NewService(
+		messageRepo,
+		smsLib,
+		emailLib,
+		consumerOptions...,
+	)
+
+	var internalServer *http.Server
+	if addr := conf.GetString("api.internal-addr"); addr != "" {
+		internalRouter := mux.NewRouter()
+		internalRouter.Handle("/metrics", promhttp.Handler())
+		msgconsumer.SetupHTTPHandler(msgd, internalRouter)
+
+		internalServer = &http.Server{
+			Addr:         addr,
+			Handler:      internalRouter,
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			IdleTimeout:  30 * time.Second,
+		}
+	}
+
+	srv.router = router
+	srv.httpServer = httpServer
+	srv.certManager = certManager
+	srv.redirectServer = redirectServer
+	srv.internalServer = internalServer
+	srv.msgd = msgd
+	srv.metadataSvc = metadataSvc
+	srv.geoResolver = geoResolver
+	srv.reputationSvc = reputationSvc
+	srv.anomalySvc = anomalySvc
+	srv.loginDigestSvc = loginDigestSvc
+	srv.reminderSvc = reminderSvc
+	srv.adminAPI = adminAPI
+	srv.revocationCache = revocationCache
+
+	return srv, nil
+}
+
+// Router returns the router API routes are registered on. Routes
+// registered by an embedding program are served behind the same
+// middleware as the API, and routes under httpapi.RoutePrefix are
+// served under the configured base path.
+func (s *Server) Router() *mux.Router {
+	return s.router
+}
+
+// Handler returns the API handler, for programs serving it on their
+// own listener with api.http-addr set to an empty string.
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
+}
+
+// Run serves the API and runs its background services until ctx is
+// cancelled or one of them fails. The API is not served if
+// api.http-addr is empty.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	logger := s.logger
+
+	var g run.Group
+	{
+		g.Add(func() error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, func(err error) {
+			cancel()
+		})
+	}
+	{
+		g.Add(func() error {
+			logger.Log(
+				"message", "message daemon is starting to check messages",
+				"source", "server.Run",
+			)
+			return s.msgd.Run(ctx)
+		}, func(err error) {
+			logger.Log(
+				"message", "message daemon was shut down",
+				"error", err,
+				"source", "server.Run",
+			)
+		})
+	}
+	if s.httpServer.Addr != "" {
+		listener, err := httpapi.Listen(s.httpServer.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on API address: %w", err)
+		}
+
+		g.Add(func() error {
+			logger.Log(
+				"message", "API server is starting",
+				"address", s.httpServer.Addr,
+				"tls", s.httpServer.TLSConfig != nil,
+				"source", "server.Run",
+			)
+			if s.certManager != nil {
+				return s.httpServer.ServeTLS(listener, "", "")
+			}
+			if s.httpServer.TLSConfig != nil {
+				return s.httpServer.ServeTLS(
+					listener,
+					s.settings.GetString("api.tls.cert-file"),
+					s.settings.GetString("api.tls.key-file"),
+				)
+			}
+			return s.httpServer.Serve(listener)
+		}, func(err error) {
+			logger.Log(
+				"message", "API server was interrupted",
+				"error", err,
+				"source", "server.Run",
+			)
+			logger.Log(
+				"message", "API server shut down",
+				"error", s.httpServer.Shutdown(ctx),
+				"source", "server.Run",
+			)
+		})
+	}
+	{
+		g.Add(func() error {
+			logger.Log(
+				"message", "metadata service is starting to refresh authenticator metadata",
+				"source", "server.Run",
+			)
+			return s.metadataSvc.Run(ctx)
+		}, func(err error) {
+			logger.Log(
+				"message", "metadata service was shut down",
+				"error", err,
+				"source", "server.Run",
+			)
+		})
+	}
+	{
+		g.Add(func() error {
+			logger.Log(
+				"message", "geo resolver is starting to watch geo databases",
+				"source", "server.Run",
+			)
+			return s.geoResolver.Run(ctx)
+		}, func(err error) {
+			logger.Log(
+				"message", "geo resolver was shut down",
+				"error", err,
+				"source", "server.Run",
+			)
+		})
+	}
+	{
+		g.Add(func() error {
+			logger.Log(
+				"message", "network reputation is starting to refresh network lists",
+				"source", "server.Run",
+			)
+			return s.reputationSvc.Run(ctx)
+		}, func(err error) {
+			logger.Log(
+				"message", "network reputation was shut down",
+				"error", err,
+				"source", "server.Run",
+			)
+		})
+	}
+	{
+		g.Add(func() error {
+			logger.Log(
+				"message", "anomaly detector is starting to analyze login failures",
+				"source", "server.Run",
+			)
+			return s.anomalySvc.Run(ctx)
+		}, func(err error) {
+			logger.Log(
+				"message", "anomaly detector was shut down",
+				"error", err,
+				"source", "server.Run",
+			)
+		})
+	}
+	{
+		g.Add(func() error {
+			logger.Log(
+				"message", "login digest service is starting to send digests",
+				"source", "server.Run",
+			)
+			return s.loginDigestSvc.Run(ctx)
+		}, func(err error) {
+			logger.Log(
+				"message", "login digest service was shut down",
+				"error", err,
+				"source", "server.Run",
+			)
+		})
+	}
+	{
+		g.Add(func() error {
+			logger.Log(
+				"message", "enrollment reminder service is starting to send reminders",
+				"source", "server.Run",
+			)
+			return s.reminderSvc.Run(ctx)
+		}, func(err error) {
+			logger.Log(
+				"message", "enrollment reminder service was shut down",
+				"error", err,
+				"source", "server.Run",
+			)
+		})
+	}
+	{
+		g.Add(func() error {
+			return s.adminAPI.Run(ctx)
+		}, func(err error) {
+			logger.Log(
+				"message", "admin jobs were shut down",
+				"error", err,
+				"source", "server.Run",
+			)
+		})
+	}
+	if s.redirectServer != nil {
+		g.Add(func() error {
+			logger.Log(
+				"message", "HTTPS redirect server is starting",
+				"address", s.redirectServer.Addr,
+				"source", "server.Run",
+			)
+			return s.redirectServer.ListenAndServe()
+		}, func(err error) {
+			logger.Log(
+				"message", "HTTPS redirect server shut down",
+				"error", s.redirectServer.Shutdown(ctx),
+				"source", "server.Run",
+			)
+		})
+	}
+	if s.revocationCache != nil {
+		g.Add(func() error {
+			logger.Log(
+				"message", "revocation cache is subscribing to revocations",
+				"source", "server.Run",
+			)
+			return s.revocationCache.Run(ctx)
+		}, func(err error) {
+			logger.Log(
+				"message", "revocation cache was shut down",
+				"error", err,
+				"source", "server.Run",
+			)
+		})
+	}
+	if s.internalServer != nil {
+		g.Add(func() error {
+			logger.Log(
+				"message", "internal server is starting",
+				"address", s.internalServer.Addr,
+				"source", "server.Run",
+			)
+			return s.internalServer.ListenAndServe()
+		}, func(err error) {
+			logger.Log(
+				"message", "internal server shut down",
+				"error", s.internalServer.Shutdown(ctx),
+				"source", "server.Run",
+			)
+		})
+	}
+
+	return g.Run()
+}
+
+// Close releases the database connections of the Server. It should
+// be called once Run returns.
+func (s *Server) Close() error {
+	var firstErr error
+	for i := len(s.closers) - 1; i >= 0; i-- {
+		c := s.closers[i]
+		if err := c.close(); err != nil {
+			s.logger.Log(
+				"message", fmt.Sprintf("failed to close %s connection", c.name),
+				"error", err,
+				"source", "server.Close",
+			)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	s.closers = nil
+	return firstErr
+}
+
+// closer releases a named connection.
+type closer struct {
+	name  string
+	close func() error
+}
+
+func (s *Server) addCloser(name string, close func() error) {
+	s.closers = append(s.closers, closer{name: name, close: close})
+}
+
+// prometheusMetrics returns the message consumer metrics registered
+// with Prometheus.
+func prometheusMetrics() msgconsumer.Metrics {
+	consumerMetricsOnce.Do(func() {
+		consumerMetrics = msgconsumer.NewPrometheusMetrics()
+	})
+	return consumerMetrics
+}
+
+// tokenPrometheusMetrics returns the token issuance metrics registered
+// with Prometheus.
+func tokenPrometheusMetrics() token.Metrics {
+	tokenMetricsOnce.Do(func() {
+		tokenMetrics = token.NewPrometheusMetrics()
+	})
+	return tokenMetrics
+}
+
+// EncryptionOptions returns the options to encrypt PII columns
+// of users. It is shared by every binary with access to the
+// user table so they agree on the configured keys.
+func EncryptionOptions(conf *viper.Viper) ([]postgres.ConfigOption, error) {
+	key := conf.GetString("pg.encryption.key")
+	if key == "" {
+		return nil, nil
+	}
+	if conf.GetString("pg.encryption.index-key") == "" {
+		return nil, fmt.Errorf("pg.encryption.index-key is required")
+	}
+
+	retired, err := postgres.ParseSecrets(conf.GetString("pg.encryption.retired-keys"))
+	if err != nil {
+		return nil, err
+	}
+
+	options := []postgres.ConfigOption{
+		postgres.WithSecret(postgres.Secret{
+			Key:     key,
+			Version: conf.GetInt("pg.encryption.version"),
+		}),
+		postgres.WithIndexKey(conf.GetString("pg.encryption.index-key")),
+	}
+	for _, secret := range retired {
+		options = append(options, postgres.WithSecret(secret))
+	}
+
+	return options, nil
+}
+
+// orDefault returns value, or def if value is empty.
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
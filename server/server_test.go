@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServer_NewSettings(t *testing.T) {
+	settings := NewSettings()
+
+	if d := settings.GetDuration("token.expires-in"); d != 20*time.Minute {
+		t.Errorf("incorrect default token expiry, want 20m got %v", d)
+	}
+	if addr := settings.GetString("api.http-addr"); addr != ":8080" {
+		t.Errorf("incorrect default address, want :8080 got %s", addr)
+	}
+
+	settings.Set("api.http-addr", "")
+	if addr := settings.GetString("api.http-addr"); addr != "" {
+		t.Errorf("default address was not overridden, got %s", addr)
+	}
+}
+
+func TestServer_NewInvalidSettings(t *testing.T) {
+	tt := []struct {
+		name  string
+		key   string
+		value interface{}
+	}{
+		{
+			name:  "Invalid phone region",
+			key:   "phone.default-region",
+			value: "not-a-region",
+		},
+		{
+			name:  "Invalid password cost",
+			key:   "password.cost",
+			value: 100,
+		},
+		{
+			name:  "Invalid password API cost",
+			key:   "password.api-cost",
+			value: 100,
+		},
+		{
+			name:  "Negative token leeway",
+			key:   "token.leeway",
+			value: "-5s",
+		},
+		{
+			name:  "Invalid branding color",
+			key:   "branding.color",
+			value: "red; background: url(x)",
+		},
+		{
+			name:  "Invalid fault",
+			key:   "faults.postgres",
+			value: "not-a-fault",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			settings := NewSettings()
+			settings.Set("faults.enabled", true)
+			settings.Set(tc.key, tc.value)
+
+			srv, err := New(Config{Settings: settings})
+			if err == nil {
+				t.Error("expected invalid settings to be rejected")
+			}
+			if srv != nil {
+				t.Error("expected no server to be returned")
+			}
+		})
+	}
+}